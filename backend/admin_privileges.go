@@ -0,0 +1,167 @@
+package backend
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/mysql_db"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// The administrative privileges, i.e., REPLICATION and ADMIN, are granted over both protocols, see catalog/admin_privileges.go:
+//
+//	GRANT { REPLICATION | ADMIN } [, ...] TO user [, ...]
+//	REVOKE { REPLICATION | ADMIN } [, ...] FROM user [, ...]
+//
+// Granting them requires a superuser, see IsSuperuser. The superusers have them implicitly, and the MySQL accounts
+// with the dynamic privilege REPLICATION_SLAVE_ADMIN have REPLICATION as well. The other users, including those
+// that have no MySQL account, have them only if they are granted them. The statements take precedence over
+// the grants of the roles named REPLICATION or ADMIN.
+//
+// The grants and the audit log are changed only by these statements and by the statements that use the privileges,
+// so the statements of the users that change them directly are refused, see checkProtectedTableWrite.
+
+// ErrAdminPrivilegeRequired is returned for a statement that requires an administrative privilege the user does not have.
+var ErrAdminPrivilegeRequired = errors.NewKind("permission denied: %s requires the %s privilege")
+
+const adminPrivilegeList = `(?:REPLICATION|ADMIN)\b(?:\s*,\s*(?:REPLICATION|ADMIN)\b)*`
+
+var (
+	grantAdminRegex  = regexp.MustCompile(`(?is)^\s*GRANT\s+(` + adminPrivilegeList + `)\s+TO\s+(.+?)[\s;]*$`)
+	revokeAdminRegex = regexp.MustCompile(`(?is)^\s*REVOKE\s+(` + adminPrivilegeList + `)\s+FROM\s+(.+?)[\s;]*$`)
+
+	// credentialRegexes match the credentials in the statements, which are redacted in the audit log.
+	credentialRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b((?:ACCESS_KEY_ID|SECRET_ACCESS_KEY|PASSWORD)\s*=?\s*)'(?:[^']|'')*'`),
+		regexp.MustCompile(`(?i)\b(password\s*=\s*)[^\s']+`),
+		regexp.MustCompile(`(://[^:/@\s']+:)[^@\s']+(@)`),
+	}
+)
+
+// IsAdminPrivilegeStatement reports whether the query grants or revokes the administrative privileges.
+func IsAdminPrivilegeStatement(query string) bool {
+	return grantAdminRegex.MatchString(query) || revokeAdminRegex.MatchString(query)
+}
+
+// ExecAdminPrivilegeStatement grants or revokes the administrative privileges, and returns its command tag.
+// It returns false if the query is not such a statement.
+func ExecAdminPrivilegeStatement(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb, query string) (tag string, ok bool, err error) {
+	grant := grantAdminRegex.MatchString(query)
+	var m []string
+	if grant {
+		m, tag = grantAdminRegex.FindStringSubmatch(query), "GRANT"
+	} else if m = revokeAdminRegex.FindStringSubmatch(query); m != nil {
+		tag = "REVOKE"
+	} else {
+		return "", false, nil
+	}
+	users, err := parseMaskingUsers(m[2])
+	if err != nil {
+		return "", true, err
+	}
+
+	err = checkGlobalPrivilege(ctx, mysqlDb, sql.PrivilegeType_Super)
+	defer func() {
+		AuditAdminStatement(ctx, "SUPER", query, !sql.ErrPrivilegeCheckFailed.Is(err), err)
+	}()
+	if err != nil {
+		return "", true, err
+	}
+	provider := ctx.Session.(*Session).Provider()
+	for _, privilege := range strings.Split(m[1], ",") {
+		privilege = strings.ToUpper(strings.TrimSpace(privilege))
+		for _, user := range users {
+			if grant {
+				err = provider.GrantAdminPrivilege(user, privilege, ctx.Session.Client().User)
+			} else {
+				_, err = provider.RevokeAdminPrivilege(user, privilege)
+			}
+			if err != nil {
+				return "", true, catalog.ErrDuckDB.New(err)
+			}
+		}
+	}
+	return tag, true, nil
+}
+
+// CheckAdminPrivilege returns ErrAdminPrivilegeRequired if the user of the session does not have the administrative
+// privilege that the statement with the given tag requires.
+func CheckAdminPrivilege(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb, privilege, tag string) error {
+	if mysqlDb == nil || !mysqlDb.Enabled() || IsSuperuser(ctx, mysqlDb) {
+		return nil
+	}
+	client := ctx.Session.Client()
+	if privilege == catalog.PrivilegeReplication {
+		rd := mysqlDb.Reader()
+		account := mysqlDb.GetUser(rd, client.User, client.Address, false)
+		rd.Close()
+		if account != nil && mysqlDb.UserHasPrivileges(ctx, sql.NewDynamicPrivilegedOperation(plan.DynamicPrivilege_ReplicationSlaveAdmin)) {
+			return nil
+		}
+	}
+	granted, err := ctx.Session.(*Session).Provider().HasAdminPrivilege(client.User, privilege)
+	if err != nil {
+		return catalog.ErrDuckDB.New(err)
+	}
+	if !granted {
+		return ErrAdminPrivilegeRequired.New(tag, privilege)
+	}
+	return nil
+}
+
+// checkProtectedTableWrite returns an error if a statement changes an internal table that may be changed only by
+// the statements that grant and revoke the privileges, see catalog.ProtectedInternalTables. It is refused for
+// the superusers as well, so that the audit log cannot be rewritten.
+func checkProtectedTableWrite(ctx *sql.Context, root sql.Node) error {
+	if root.IsReadOnly() {
+		return nil
+	}
+	var name string
+	if !findTable(root, func(t *plan.ResolvedTable) bool {
+		name = t.Name()
+		return catalog.IsProtectedInternalTable(t.Database().Name(), name)
+	}) {
+		return nil
+	}
+	return sql.ErrTableAccessDeniedForUser.New(ctx.Session.Client().User, name)
+}
+
+// RunAdminStatement runs a statement with the given tag that requires an administrative privilege if the user
+// of the session has the privilege, and records it in the audit log, whether it was allowed or not.
+func RunAdminStatement(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb, privilege, tag, query string, run func() error) error {
+	if err := CheckAdminPrivilege(ctx, mysqlDb, privilege, tag); err != nil {
+		AuditAdminStatement(ctx, privilege, query, false, err)
+		return err
+	}
+	err := run()
+	AuditAdminStatement(ctx, privilege, query, true, err)
+	return err
+}
+
+// AuditAdminStatement records a statement that requires an administrative privilege, with its credentials redacted.
+// The failures to record it are logged rather than returned, so that the statement is not affected by them.
+func AuditAdminStatement(ctx *sql.Context, privilege, query string, allowed bool, stmtErr error) {
+	client := ctx.Session.Client()
+	entry := catalog.AdminAuditEntry{
+		ConnectionID: ctx.Session.ID(),
+		User:         client.User,
+		Address:      client.Address,
+		Privilege:    privilege,
+		Statement:    RedactCredentials(query),
+		Allowed:      allowed,
+		Err:          stmtErr,
+	}
+	if err := ctx.Session.(*Session).Provider().AuditAdminStatement(entry); err != nil {
+		ctx.GetLogger().WithError(err).Warnf("Failed to audit the statement that requires the %s privilege", privilege)
+	}
+}
+
+// RedactCredentials replaces the passwords and the keys in the statement with '****'.
+func RedactCredentials(query string) string {
+	query = credentialRegexes[0].ReplaceAllString(query, "$1'****'")
+	query = credentialRegexes[1].ReplaceAllString(query, "$1****")
+	return credentialRegexes[2].ReplaceAllString(query, "$1****$2")
+}
@@ -0,0 +1,316 @@
+// Copyright 2024-2025 ApeCloud, Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/dolthub/go-mysql-server/server"
+	"github.com/dolthub/vitess/go/mysql"
+)
+
+// COM_CHANGE_USER, see https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_change_user.html
+//
+// The protocol handler of the MySQL server does not dispatch the command to the handler, so it is intercepted
+// below it, the same as the compressed protocol: the user is authenticated again with the mysql_native_password
+// method of an auth switch request, and the session is reset by MyHandler.ChangeUser.
+// The accounts that use the other authentication plugins cannot be changed to, and the command fails explicitly.
+//
+// If TLS is enabled, the listener performs the TLS handshake in place of the server, so that the packets can be seen:
+// the SSL request is not passed to the server, and the sequence numbers of the rest of the handshake are shifted by one.
+
+const (
+	comChangeUser = 0x11
+
+	packetAuthSwitch = 0xfe
+	nativePassword   = "mysql_native_password"
+)
+
+type changeUserState int
+
+const (
+	changeUserGreeting    changeUserState = iota // the server has not sent the initial handshake packet yet
+	changeUserResponse                           // the client has not sent the handshake response yet
+	changeUserAuth                               // the authentication is in progress
+	changeUserCommand                            // the client sends the commands
+	changeUserPassthrough                        // the connection is not intercepted, e.g., the handshake failed
+)
+
+// ChangeUserListener wraps the listener of the MySQL server to support COM_CHANGE_USER.
+type ChangeUserListener struct {
+	net.Listener
+	tlsConfig *tls.Config
+	handler   atomic.Pointer[MyHandler]
+}
+
+// NewChangeUserListener wraps l. tlsConfig must be the TLS config of the MySQL server, if any.
+func NewChangeUserListener(l net.Listener, tlsConfig *tls.Config) *ChangeUserListener {
+	return &ChangeUserListener{Listener: l, tlsConfig: tlsConfig}
+}
+
+// WrapHandler returns the handler wrapper that wraps the handler with wrapper,
+// and changes the users of the connections of the listener with the resulting MyHandler.
+func (l *ChangeUserListener) WrapHandler(wrapper server.HandlerWrapper) server.HandlerWrapper {
+	return func(h mysql.Handler) (mysql.Handler, error) {
+		wrapped, err := wrapper(h)
+		if err != nil {
+			return nil, err
+		}
+		if my, ok := wrapped.(*MyHandler); ok {
+			l.handler.Store(my)
+		}
+		return wrapped, nil
+	}
+}
+
+func (l *ChangeUserListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &changeUserConn{Conn: conn, tlsConfig: l.tlsConfig, authMethod: func(connID uint32, user string) (string, error) {
+		h := l.handler.Load()
+		if h == nil {
+			return "", mysql.NewSQLError(mysql.ERUnknownComError, mysql.SSUnknownComError, "COM_CHANGE_USER is not supported")
+		}
+		return h.ChangeUserAuthMethod(connID, user)
+	}, changeUser: func(connID uint32, user string, salt, authResponse []byte, schema string) error {
+		return l.handler.Load().ChangeUser(connID, user, salt, authResponse, schema)
+	}}, nil
+}
+
+// changeUserConn is a connection that handles COM_CHANGE_USER of the client, and passes the other packets through.
+// Like the connections of the MySQL server, it is not safe for concurrent reads or concurrent writes.
+type changeUserConn struct {
+	net.Conn
+	tlsConfig *tls.Config
+	// authMethod returns the authentication method to ask the user for, mysql_native_password if it is nil.
+	authMethod func(connID uint32, user string) (string, error)
+	// changeUser authenticates the user and resets the session of the connection.
+	changeUser func(connID uint32, user string, salt, authResponse []byte, schema string) error
+	state      changeUserState
+	connID     uint32
+	seqShift   byte   // the difference between the sequence numbers of the client and the server during the handshake
+	pending    []byte // unprocessed bytes written by the server during the handshake
+	rdata      []byte // bytes that are ready to be read by the server
+}
+
+func (c *changeUserConn) Read(p []byte) (int, error) {
+	for len(c.rdata) == 0 {
+		switch c.state {
+		case changeUserResponse, changeUserCommand, changeUserAuth:
+			if c.state == changeUserAuth && c.seqShift == 0 {
+				return c.Conn.Read(p)
+			}
+			header, payload, err := c.readPacket()
+			if err != nil {
+				return 0, err
+			}
+			switch {
+			case c.state == changeUserResponse:
+				c.state = changeUserAuth
+				// The flags of the SSL request are the first field, and TLS follows it.
+				// The server ignores the flag if TLS is not enabled, and so does the listener.
+				if c.tlsConfig != nil && len(payload) >= 4 && binary.LittleEndian.Uint32(payload)&capabilityClientSSL != 0 {
+					if header, payload, err = c.startTLS(); err != nil {
+						return 0, err
+					}
+				}
+			case c.state == changeUserAuth:
+				header[3] -= c.seqShift
+			case header[3] == 0 && len(payload) > 0 && payload[0] == comChangeUser:
+				if err := c.handleChangeUser(payload); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			c.rdata = append(header, payload...)
+		default:
+			return c.Conn.Read(p)
+		}
+	}
+	n := copy(p, c.rdata)
+	c.rdata = c.rdata[n:]
+	return n, nil
+}
+
+func (c *changeUserConn) Write(p []byte) (int, error) {
+	if c.state != changeUserGreeting && c.state != changeUserAuth {
+		return c.Conn.Write(p)
+	}
+	// The packets are written as they are, unless their sequence numbers are shifted.
+	shift := c.seqShift
+	if shift == 0 {
+		if _, err := c.Conn.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	// Follow the handshake packet by packet.
+	c.pending = append(c.pending, p...)
+	for len(c.pending) >= packetHeaderSize && (c.state == changeUserGreeting || c.state == changeUserAuth) {
+		size := packetHeaderSize + int(uint24(c.pending))
+		if len(c.pending) < size {
+			break
+		}
+		if shift != 0 {
+			c.pending[3] += shift
+			if _, err := c.Conn.Write(c.pending[:size]); err != nil {
+				return 0, err
+			}
+		}
+		payload := c.pending[packetHeaderSize:size]
+		switch c.state {
+		case changeUserGreeting:
+			c.state = changeUserPassthrough
+			// protocol version (1), server version (NUL-terminated), connection id (4)
+			if end := bytes.IndexByte(payload, 0); len(payload) > 0 && payload[0] != packetERR && end >= 0 && len(payload) >= end+5 {
+				c.connID = binary.LittleEndian.Uint32(payload[end+1:])
+				c.state = changeUserResponse
+			}
+		case changeUserAuth:
+			switch {
+			case len(payload) > 0 && payload[0] == packetOK:
+				c.state = changeUserCommand
+			case len(payload) > 0 && payload[0] == packetERR:
+				c.state = changeUserPassthrough
+			}
+		}
+		c.pending = c.pending[size:]
+	}
+	if c.state != changeUserGreeting && c.state != changeUserAuth {
+		c.seqShift = 0
+		if shift != 0 && len(c.pending) > 0 {
+			if _, err := c.Conn.Write(c.pending); err != nil {
+				return 0, err
+			}
+		}
+		c.pending = nil
+	}
+	return len(p), nil
+}
+
+// startTLS performs the TLS handshake that follows the SSL request of the client,
+// and returns the handshake response that the client sends over TLS, which the server reads in place of the SSL request.
+func (c *changeUserConn) startTLS() (header, payload []byte, err error) {
+	conn := tls.Server(c.Conn, c.tlsConfig)
+	if err := conn.Handshake(); err != nil {
+		return nil, nil, err
+	}
+	c.Conn = conn
+	if header, payload, err = c.readPacket(); err != nil {
+		return nil, nil, err
+	}
+	if len(payload) >= 4 {
+		flags := binary.LittleEndian.Uint32(payload) &^ capabilityClientSSL
+		binary.LittleEndian.PutUint32(payload, flags)
+	}
+	c.seqShift = 1
+	header[3] -= c.seqShift
+	return header, payload, nil
+}
+
+func (c *changeUserConn) readPacket() (header, payload []byte, err error) {
+	header = make([]byte, packetHeaderSize)
+	if _, err := io.ReadFull(c.Conn, header); err != nil {
+		return nil, nil, err
+	}
+	payload = make([]byte, uint24(header))
+	if _, err := io.ReadFull(c.Conn, payload); err != nil {
+		return nil, nil, err
+	}
+	return header, payload, nil
+}
+
+func (c *changeUserConn) writePacket(seq byte, payload []byte) error {
+	header := make([]byte, packetHeaderSize, packetHeaderSize+len(payload))
+	putUint24(header, uint32(len(payload)))
+	header[3] = seq
+	_, err := c.Conn.Write(append(header, payload...))
+	return err
+}
+
+// handleChangeUser authenticates the user of a COM_CHANGE_USER, changes the user of the session,
+// and replies with an OK packet, or an ERR packet if the user cannot be authenticated, which closes the connection.
+func (c *changeUserConn) handleChangeUser(payload []byte) error {
+	user, rest, ok := cutNul(payload[1:])
+	if !ok || len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		err := mysql.NewSQLError(mysql.ERUnknownError, mysql.SSUnknownSQLState, "malformed COM_CHANGE_USER packet")
+		if werr := c.writeError(1, err); werr != nil {
+			return werr
+		}
+		return err
+	}
+	schema, _, _ := cutNul(rest[1+int(rest[0]):])
+
+	// The password is always asked for again with a new salt, whichever method the client used.
+	method := nativePassword
+	if c.authMethod != nil {
+		var err error
+		if method, err = c.authMethod(c.connID, string(user)); err != nil {
+			if werr := c.writeError(1, err); werr != nil {
+				return werr
+			}
+			return fmt.Errorf("failed to change the user of connection %d: %w", c.connID, err)
+		}
+	}
+	salt, err := mysql.NewSalt()
+	if err != nil {
+		return err
+	}
+	request := append([]byte{packetAuthSwitch}, method+"\x00"...)
+	request = append(append(request, salt...), 0)
+	if err := c.writePacket(1, request); err != nil {
+		return err
+	}
+	header, authResponse, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	if err := c.changeUser(c.connID, string(user), salt, authResponse, string(schema)); err != nil {
+		// Like MySQL, the connection is closed if the user cannot be changed.
+		if err := c.writeError(header[3]+1, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("failed to change the user of connection %d: %w", c.connID, err)
+	}
+	// OK: header, affected rows, last insert id, status flags (autocommit), warnings
+	return c.writePacket(header[3]+1, []byte{packetOK, 0, 0, 0x02, 0, 0, 0})
+}
+
+func (c *changeUserConn) writeError(seq byte, err error) error {
+	sqlErr, ok := err.(*mysql.SQLError)
+	if !ok {
+		sqlErr = mysql.NewSQLError(mysql.ERAccessDeniedError, mysql.SSAccessDeniedError, "%v", err)
+	}
+	packet := binary.LittleEndian.AppendUint16([]byte{packetERR}, uint16(sqlErr.Number()))
+	packet = append(packet, fmt.Sprintf("#%-5.5s%s", sqlErr.SQLState(), sqlErr.Message)...)
+	return c.writePacket(seq, packet)
+}
+
+// cutNul cuts a NUL-terminated string from the front of b.
+func cutNul(b []byte) (s, rest []byte, ok bool) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return b, nil, false
+	}
+	return b[:i], b[i+1:], true
+}
@@ -0,0 +1,227 @@
+package backend
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeUserConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	var changed []string
+	conn := &changeUserConn{Conn: server, changeUser: func(connID uint32, user string, salt, authResponse []byte, schema string) error {
+		require.EqualValues(t, 1, connID)
+		require.Len(t, salt, 20)
+		if string(authResponse) != "secret" {
+			return errors.New("access denied")
+		}
+		changed = append(changed, user+"/"+schema)
+		return nil
+	}}
+
+	// The server side: the handshake, and then the commands that reach the server.
+	commands := make(chan []byte, 2)
+	go func() {
+		defer server.Close()
+		if _, err := conn.Write(makePacket(0, makeGreeting())); err != nil {
+			return
+		}
+		if _, err := readPacket(conn); err != nil { // the handshake response
+			return
+		}
+		if _, err := conn.Write(makePacket(2, []byte{packetOK, 0, 0, 2, 0, 0, 0})); err != nil {
+			return
+		}
+		for {
+			payload, err := readPacket(conn)
+			if err != nil {
+				close(commands)
+				return
+			}
+			commands <- payload
+		}
+	}()
+
+	_, err := readPacket(client) // the greeting
+	require.NoError(t, err)
+	response := binary.LittleEndian.AppendUint32(nil, 0x8200|0x80000)
+	response = append(response, make([]byte, 28)...)
+	response = append(response, "root\x00\x00"...)
+	_, err = client.Write(makePacket(1, response))
+	require.NoError(t, err)
+	ok, err := readPacket(client)
+	require.NoError(t, err)
+	require.EqualValues(t, packetOK, ok[0])
+
+	changeUser := func(user, password, schema string) []byte {
+		payload := append([]byte{comChangeUser}, user+"\x00"...)
+		payload = append(payload, 0) // the client's own auth response is ignored
+		payload = append(payload, schema+"\x00"...)
+		_, err := client.Write(makePacket(0, payload))
+		require.NoError(t, err)
+		authSwitch, err := readPacket(client)
+		require.NoError(t, err)
+		require.EqualValues(t, packetAuthSwitch, authSwitch[0])
+		require.Contains(t, string(authSwitch), nativePassword)
+		_, err = client.Write(makePacket(2, []byte(password)))
+		require.NoError(t, err)
+		result, err := readPacket(client)
+		require.NoError(t, err)
+		return result
+	}
+
+	require.EqualValues(t, packetOK, changeUser("alice", "secret", "db1")[0])
+	require.Equal(t, []string{"alice/db1"}, changed)
+
+	// The other commands pass through.
+	_, err = client.Write(makePacket(0, []byte{0x03, 'S', 'E', 'L', 'E', 'C', 'T', ' ', '1'}))
+	require.NoError(t, err)
+	require.Equal(t, "\x03SELECT 1", string(<-commands))
+
+	// A failed authentication closes the connection.
+	result := changeUser("bob", "wrong", "")
+	require.EqualValues(t, packetERR, result[0])
+	require.Contains(t, string(result), "access denied")
+	_, ok2 := <-commands
+	require.False(t, ok2)
+	require.Equal(t, []string{"alice/db1"}, changed)
+}
+
+func TestChangeUserConnTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+
+	raw, server := net.Pipe()
+	defer raw.Close()
+
+	var changed []string
+	conn := &changeUserConn{
+		Conn:      server,
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{certificate}},
+		authMethod: func(connID uint32, user string) (string, error) {
+			if user == "carol" {
+				return "", errors.New("unsupported authentication plugin")
+			}
+			return nativePassword, nil
+		},
+		changeUser: func(connID uint32, user string, salt, authResponse []byte, schema string) error {
+			if string(authResponse) != "secret" {
+				return errors.New("access denied")
+			}
+			changed = append(changed, user+"/"+schema)
+			return nil
+		},
+	}
+
+	// The server side does not see the SSL request, and its sequence numbers continue from the greeting.
+	responses := make(chan []byte, 1)
+	commands := make(chan []byte, 2)
+	go func() {
+		defer server.Close()
+		if _, err := conn.Write(makePacket(0, makeGreeting())); err != nil {
+			return
+		}
+		header := make([]byte, packetHeaderSize)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		response := make([]byte, uint24(header))
+		if _, err := io.ReadFull(conn, response); err != nil || header[3] != 1 {
+			return
+		}
+		responses <- response
+		if _, err := conn.Write(makePacket(2, []byte{packetOK, 0, 0, 2, 0, 0, 0})); err != nil {
+			return
+		}
+		for {
+			payload, err := readPacket(conn)
+			if err != nil {
+				close(commands)
+				return
+			}
+			commands <- payload
+		}
+	}()
+
+	_, err = readPacket(raw) // the greeting
+	require.NoError(t, err)
+	flags := uint32(0x8200 | 0x80000 | capabilityClientSSL)
+	request := binary.LittleEndian.AppendUint32(nil, flags)
+	request = append(request, make([]byte, 28)...)
+	_, err = raw.Write(makePacket(1, request))
+	require.NoError(t, err)
+	client := tls.Client(raw, &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, client.Handshake())
+	_, err = client.Write(makePacket(2, append(request, "root\x00\x00"...)))
+	require.NoError(t, err)
+
+	response := <-responses
+	require.Zero(t, binary.LittleEndian.Uint32(response)&capabilityClientSSL)
+	require.Equal(t, "root", string(response[32:36]))
+	header := make([]byte, packetHeaderSize)
+	_, err = io.ReadFull(client, header)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, header[3])
+	ok := make([]byte, uint24(header))
+	_, err = io.ReadFull(client, ok)
+	require.NoError(t, err)
+	require.EqualValues(t, packetOK, ok[0])
+
+	changeUser := func(user, password, schema string) []byte {
+		payload := append([]byte{comChangeUser}, user+"\x00"...)
+		payload = append(payload, 0)
+		payload = append(payload, schema+"\x00"...)
+		_, err := client.Write(makePacket(0, payload))
+		require.NoError(t, err)
+		reply, err := readPacket(client)
+		require.NoError(t, err)
+		if reply[0] != packetAuthSwitch {
+			return reply
+		}
+		require.Contains(t, string(reply), nativePassword)
+		_, err = client.Write(makePacket(2, []byte(password)))
+		require.NoError(t, err)
+		result, err := readPacket(client)
+		require.NoError(t, err)
+		return result
+	}
+
+	// COM_CHANGE_USER is intercepted over TLS.
+	require.EqualValues(t, packetOK, changeUser("alice", "secret", "db1")[0])
+	require.Equal(t, []string{"alice/db1"}, changed)
+
+	_, err = client.Write(makePacket(0, []byte{0x03, 'S', 'E', 'L', 'E', 'C', 'T', ' ', '1'}))
+	require.NoError(t, err)
+	require.Equal(t, "\x03SELECT 1", string(<-commands))
+
+	// The users whose authentication plugins are not supported are refused before their passwords are asked for.
+	result := changeUser("carol", "secret", "")
+	require.EqualValues(t, packetERR, result[0])
+	require.Contains(t, string(result), "unsupported authentication plugin")
+	_, ok2 := <-commands
+	require.False(t, ok2)
+	require.Equal(t, []string{"alice/db1"}, changed)
+}
@@ -0,0 +1,73 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// All data is stored in DuckDB as UTF-8, so the character set variables of a MySQL session
+// do not change how the values are stored or compared. They are still tracked per session
+// and reported back as-is, because many client libraries and frameworks validate them
+// (e.g., `SELECT @@character_set_client`) right after connecting.
+
+// setNamesCollateRegex matches the prefix `SET NAMES <charset> COLLATE <collation>`.
+// The parser of the engine accepts the COLLATE clause but drops it silently,
+// so the statement is rewritten into the equivalent assignments of the session variables.
+var setNamesCollateRegex = regexp.MustCompile("(?is)^\\s*SET\\s+NAMES\\s+['\"`]?(\\w+)['\"`]?\\s+COLLATE\\s+['\"`]?(\\w+)['\"`]?")
+
+// rewriteSetNames rewrites `SET NAMES <charset> COLLATE <collation>` into
+// assignments of character_set_client, character_set_connection, character_set_results
+// and collation_connection, keeping the rest of the query (e.g., further assignments) as-is.
+// Other queries are returned unchanged.
+func rewriteSetNames(query string) (string, error) {
+	m := setNamesCollateRegex.FindStringSubmatchIndex(query)
+	if m == nil {
+		return query, nil
+	}
+	charsetName, collationName := query[m[2]:m[3]], query[m[4]:m[5]]
+	charset, err := sql.ParseCharacterSet(charsetName)
+	if err != nil {
+		return "", err
+	}
+	collation, err := sql.ParseCollation("", collationName, false)
+	if err != nil {
+		return "", err
+	}
+	if !collation.WorksWithCharacterSet(charset) {
+		return "", sql.ErrCollationInvalidForCharSet.New(collation.Name(), charsetName)
+	}
+	// collation_connection must come after character_set_connection,
+	// since the latter resets the former to the default collation of the character set.
+	assignments := fmt.Sprintf(
+		"SET character_set_client = '%[1]s', character_set_connection = '%[1]s', character_set_results = '%[1]s', collation_connection = '%[2]s'",
+		charsetName, collation.Name(),
+	)
+	return assignments + query[m[1]:], nil
+}
+
+// applyHandshakeCharset applies the character set that the client requested in the handshake
+// to the character set variables of the session, as MySQL does.
+// The collation_connection is only changed if it does not belong to the requested character set,
+// so that the comparison semantics of the common UTF-8 clients stay the same.
+func applyHandshakeCharset(ctx *sql.Context, sess sql.Session, id uint8) error {
+	if id == 0 {
+		return nil
+	}
+	collation := sql.CollationID(id)
+	if collation.Name() == "" {
+		// An unknown collation: keep the defaults, as MySQL does.
+		return nil
+	}
+	charset := collation.CharacterSet()
+	for _, name := range []string{"character_set_client", "character_set_connection", "character_set_results"} {
+		if err := sess.SetSessionVariable(ctx, name, charset.Name()); err != nil {
+			return err
+		}
+	}
+	if sess.GetCollation().CharacterSet() != charset {
+		return sess.SetSessionVariable(ctx, "collation_connection", collation.Name())
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteSetNames(t *testing.T) {
+	for _, q := range []string{"SET NAMES utf8mb4", "SET autocommit = 1", "SELECT 'SET NAMES utf8mb4 COLLATE utf8mb4_bin'"} {
+		rewritten, err := rewriteSetNames(q)
+		require.NoError(t, err)
+		require.Equal(t, q, rewritten)
+	}
+
+	rewritten, err := rewriteSetNames("set names 'utf8mb4' collate 'utf8mb4_unicode_ci', autocommit = 1")
+	require.NoError(t, err)
+	require.Equal(t, "SET character_set_client = 'utf8mb4', character_set_connection = 'utf8mb4', character_set_results = 'utf8mb4', collation_connection = 'utf8mb4_unicode_ci', autocommit = 1", rewritten)
+
+	_, err = rewriteSetNames("SET NAMES latin1 COLLATE utf8mb4_bin")
+	require.True(t, sql.ErrCollationInvalidForCharSet.Is(err), err)
+	_, err = rewriteSetNames("SET NAMES bogus COLLATE utf8mb4_bin")
+	require.True(t, sql.ErrCharSetUnknown.Is(err), err)
+	_, err = rewriteSetNames("SET NAMES utf8mb4 COLLATE bogus")
+	require.True(t, sql.ErrCollationUnknown.Is(err), err)
+}
+
+func TestCharsetVariables(t *testing.T) {
+	db := memory.NewDatabase("mydb")
+	provider := memory.NewDBProvider(db)
+	engine := sqle.NewDefault(provider)
+
+	newSession := func() (*sql.Context, sql.Session) {
+		session := memory.NewSession(sql.NewBaseSession(), provider)
+		ctx := sql.NewContext(context.Background(), sql.WithSession(session))
+		ctx.SetCurrentDatabase("mydb")
+		return ctx, session
+	}
+	query := func(ctx *sql.Context, q string) sql.Row {
+		_, iter, _, err := engine.Query(ctx, q)
+		require.NoError(t, err, q)
+		rows, err := sql.RowIterToRows(ctx, iter)
+		require.NoError(t, err, q)
+		require.Len(t, rows, 1)
+		return rows[0]
+	}
+	const variables = "SELECT @@character_set_client, @@character_set_connection, @@character_set_results, @@collation_connection"
+
+	// latin1_swedish_ci, as sent by the old clients in the handshake.
+	ctx, session := newSession()
+	require.NoError(t, applyHandshakeCharset(ctx, session, 8))
+	require.Equal(t, sql.Row{"latin1", "latin1", "latin1", "latin1_swedish_ci"}, query(ctx, variables))
+
+	// utf8mb4_general_ci keeps the default collation of the connection.
+	ctx, session = newSession()
+	require.NoError(t, applyHandshakeCharset(ctx, session, 45))
+	require.Equal(t, sql.Row{"utf8mb4", "utf8mb4", "utf8mb4", "utf8mb4_0900_bin"}, query(ctx, variables))
+
+	rewritten, err := rewriteSetNames("SET NAMES utf8mb4 COLLATE utf8mb4_unicode_ci")
+	require.NoError(t, err)
+	query(ctx, rewritten)
+	require.Equal(t, sql.Row{"utf8mb4", "utf8mb4", "utf8mb4", "utf8mb4_unicode_ci"}, query(ctx, variables))
+}
@@ -0,0 +1,269 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/sirupsen/logrus"
+)
+
+// The Compactor rewrites the tables that are heavily updated by the replication, see (*catalog.Table).Rewrite.
+// It runs as the system job JobKindCompaction of the JobScheduler, but only does the work
+// in the configured maintenance window and while no query is running,
+// and checkpoints the database after the rewrites to reclaim the freed blocks.
+// The storage quotas of the tenants are checked in each round as well, see catalog.Tenant.
+// The churn of the tables is recorded by the delta pipeline in catalog.InternalTables.TableChurn.
+
+// JobKindCompaction is the kind, as well as the name, of the system job of the Compactor.
+const JobKindCompaction = "compaction"
+
+// The system variables that control the Compactor.
+const (
+	// CompactionPausedVariable pauses the compactions.
+	CompactionPausedVariable = "myduck_compaction_paused"
+	// CompactionWindowVariable is the daily maintenance window in the local time, e.g., "02:00-05:00".
+	// The window may wrap around midnight. The compactions are disabled if it is empty.
+	CompactionWindowVariable = "myduck_compaction_window"
+	// CompactionChurnThresholdVariable is the number of the changed rows that makes a table a candidate for compaction.
+	CompactionChurnThresholdVariable = "myduck_compaction_churn_threshold"
+	// CompactionCheckIntervalVariable is the number of seconds between the rounds of compactions.
+	CompactionCheckIntervalVariable = "myduck_compaction_check_interval"
+)
+
+func init() {
+	sql.SystemVariables.AddSystemVariables([]sql.SystemVariable{
+		&sql.MysqlSystemVariable{
+			Name:              CompactionPausedVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemBoolType(CompactionPausedVariable),
+			Default:           int8(0),
+		},
+		&sql.MysqlSystemVariable{
+			Name:              CompactionWindowVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemStringType(CompactionWindowVariable),
+			Default:           "",
+		},
+		&sql.MysqlSystemVariable{
+			Name:              CompactionChurnThresholdVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemIntType(CompactionChurnThresholdVariable, 1, 1<<62, false),
+			Default:           int64(1000000),
+		},
+		&sql.MysqlSystemVariable{
+			Name:              CompactionCheckIntervalVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemIntType(CompactionCheckIntervalVariable, 1, 86400, false),
+			Default:           int64(300),
+		},
+	})
+}
+
+type Compactor struct {
+	provider  *catalog.DatabaseProvider
+	scheduler *QueryScheduler
+	logger    *logrus.Entry
+}
+
+func NewCompactor(provider *catalog.DatabaseProvider) *Compactor {
+	return &Compactor{
+		provider:  provider,
+		scheduler: DefaultScheduler,
+		logger:    logrus.WithField("component", "compaction"),
+	}
+}
+
+// Job returns the system job that runs a round of compactions every CompactionCheckIntervalVariable seconds.
+func (c *Compactor) Job() SystemJob {
+	return SystemJob{
+		Name: JobKindCompaction,
+		Interval: func() time.Duration {
+			return time.Duration(globalIntVariable(CompactionCheckIntervalVariable)) * time.Second
+		},
+		Run: func(ctx context.Context, _ *Job) (string, error) {
+			n, err := c.Compact(ctx, time.Now())
+			return fmt.Sprintf("%d tables compacted", n), err
+		},
+	}
+}
+
+type churnedTable struct {
+	schema, table string
+	changedRows   int64
+}
+
+// Compact rewrites the tables whose churn exceeds the threshold if now is in the maintenance window,
+// and returns the number of rewritten tables. A round stops as soon as a query arrives or the window ends.
+func (c *Compactor) Compact(ctx context.Context, now time.Time) (int, error) {
+	if !c.runnable(now) {
+		return 0, nil
+	}
+	// The tenants are checkpointed and checked against their storage quotas in the window as well.
+	defer func() {
+		if err := c.provider.CheckTenantQuotas(); err != nil && ctx.Err() == nil {
+			c.logger.WithError(err).Warnln("Failed to check the storage quotas of the tenants")
+		}
+	}()
+	tables, err := c.candidates(ctx)
+	if err != nil || len(tables) == 0 {
+		return 0, err
+	}
+
+	session := NewSession(memory.NewSession(sql.NewBaseSession(), c.provider), c.provider)
+	defer session.CloseConn()
+	sqlCtx := sql.NewContext(ctx, sql.WithSession(session))
+
+	db := c.provider.Storage()
+	compacted := 0
+	for i, candidate := range tables {
+		if i > 0 && !c.runnable(time.Now()) {
+			break
+		}
+		table, err := lookupTable(sqlCtx, c.provider, candidate.schema, candidate.table)
+		if err != nil {
+			return compacted, err
+		}
+		if table == nil {
+			// The table has been dropped since its rows were changed.
+			if _, err := db.ExecContext(ctx,
+				"DELETE FROM "+catalog.InternalTables.TableChurn.QualifiedName()+" WHERE schema_name = ? AND table_name = ?",
+				candidate.schema, candidate.table,
+			); err != nil {
+				return compacted, err
+			}
+			continue
+		}
+
+		start := time.Now()
+		if err := table.Rewrite(sqlCtx); err != nil {
+			if ctx.Err() != nil {
+				return compacted, ctx.Err()
+			}
+			c.logger.WithError(err).Warnf("Failed to compact %s.%s", candidate.schema, candidate.table)
+			continue
+		}
+		compacted++
+		c.logger.Infof("Compacted %s.%s with %d changed rows in %v", candidate.schema, candidate.table, candidate.changedRows, time.Since(start))
+
+		// Keep the rows changed during the rewrite for the next round.
+		if _, err := db.ExecContext(ctx,
+			"UPDATE "+catalog.InternalTables.TableChurn.QualifiedName()+
+				" SET changed_rows = changed_rows - ?, last_compacted_at = now() WHERE schema_name = ? AND table_name = ?",
+			candidate.changedRows, candidate.schema, candidate.table,
+		); err != nil {
+			return compacted, err
+		}
+	}
+
+	if compacted > 0 {
+		// Reclaim the blocks freed by the rewrites.
+		if _, err := db.ExecContext(ctx, "CHECKPOINT"); err != nil {
+			return compacted, err
+		}
+	}
+	return compacted, nil
+}
+
+// runnable reports whether the compactions are allowed to run at the given time.
+func (c *Compactor) runnable(now time.Time) bool {
+	if globalIntVariable(CompactionPausedVariable) != 0 || !c.scheduler.Idle() {
+		return false
+	}
+	_, value, _ := sql.SystemVariables.GetGlobal(CompactionWindowVariable)
+	window, _ := value.(string)
+	if window == "" {
+		return false
+	}
+	start, end, err := parseMaintenanceWindow(window)
+	if err != nil {
+		c.logger.WithError(err).Warnf("Invalid %s", CompactionWindowVariable)
+		return false
+	}
+	return inMaintenanceWindow(now, start, end)
+}
+
+func (c *Compactor) candidates(ctx context.Context) ([]churnedTable, error) {
+	rows, err := c.provider.Storage().QueryContext(ctx,
+		"SELECT schema_name, table_name, changed_rows FROM "+catalog.InternalTables.TableChurn.QualifiedName()+
+			" WHERE changed_rows >= ? ORDER BY changed_rows DESC",
+		globalIntVariable(CompactionChurnThresholdVariable),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []churnedTable
+	for rows.Next() {
+		var t churnedTable
+		if err := rows.Scan(&t.schema, &t.table, &t.changedRows); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// lookupTable returns the table with the given name, or nil if it does not exist.
+func lookupTable(ctx *sql.Context, provider *catalog.DatabaseProvider, schema, name string) (*catalog.Table, error) {
+	if !provider.HasDatabase(ctx, schema) {
+		return nil, nil
+	}
+	db, err := provider.Database(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	table, ok, err := db.GetTableInsensitive(ctx, name)
+	if err != nil || !ok {
+		return nil, err
+	}
+	t, _ := table.(*catalog.Table)
+	return t, nil
+}
+
+// parseMaintenanceWindow parses a window in the form of "HH:MM-HH:MM",
+// and returns its start and end as the offsets from midnight.
+func parseMaintenanceWindow(window string) (start, end time.Duration, err error) {
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected HH:MM-HH:MM, got %q", window)
+	}
+	if start, err = parseTimeOfDay(strings.TrimSpace(from)); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseTimeOfDay(strings.TrimSpace(to)); err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// inMaintenanceWindow reports whether the time of day of now is in [start, end).
+// A window whose end is not after its start wraps around midnight.
+func inMaintenanceWindow(now time.Time, start, end time.Duration) bool {
+	offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+	if start < end {
+		return offset >= start && offset < end
+	}
+	return offset >= start || offset < end
+}
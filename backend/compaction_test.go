@@ -0,0 +1,36 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	start, end, err := parseMaintenanceWindow("02:00-05:30")
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Hour, start)
+	require.Equal(t, 5*time.Hour+30*time.Minute, end)
+	require.False(t, inMaintenanceWindow(at(1, 59), start, end))
+	require.True(t, inMaintenanceWindow(at(2, 0), start, end))
+	require.True(t, inMaintenanceWindow(at(5, 29), start, end))
+	require.False(t, inMaintenanceWindow(at(5, 30), start, end))
+
+	// The window wraps around midnight.
+	start, end, err = parseMaintenanceWindow("23:00 - 01:00")
+	require.NoError(t, err)
+	require.True(t, inMaintenanceWindow(at(23, 30), start, end))
+	require.True(t, inMaintenanceWindow(at(0, 30), start, end))
+	require.False(t, inMaintenanceWindow(at(1, 0), start, end))
+	require.False(t, inMaintenanceWindow(at(12, 0), start, end))
+
+	for _, window := range []string{"02:00", "2am-5am", "02:00-25:00"} {
+		_, _, err := parseMaintenanceWindow(window)
+		require.Error(t, err, window)
+	}
+}
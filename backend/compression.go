@@ -0,0 +1,386 @@
+// Copyright 2024-2025 ApeCloud, Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The compressed MySQL client/server protocol.
+// See https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_compression.html
+//
+// The protocol handler of the MySQL server does not support compression itself,
+// so it is implemented transparently below it: the capability flags of the handshake are rewritten,
+// and the compressed frames are converted to and from the plain packet stream once the client is authenticated.
+
+const (
+	capabilityClientCompress                 = 1 << 5
+	capabilityClientSSL                      = 1 << 11
+	capabilityClientZstdCompressionAlgorithm = 1 << 26
+
+	packetHeaderSize     = 4
+	compressedHeaderSize = 7
+	maxPayloadSize       = 1<<24 - 1
+	// Payloads shorter than this are not worth compressing.
+	minCompressLength = 50
+
+	packetOK  = 0x00
+	packetERR = 0xff
+)
+
+type compressionAlgorithm int
+
+const (
+	compressionNone compressionAlgorithm = iota
+	compressionZlib
+	compressionZstd
+)
+
+type compressionState int
+
+const (
+	stateGreeting    compressionState = iota // the server has not sent the initial handshake packet yet
+	stateResponse                            // the client has not sent the handshake response yet
+	stateAuth                                // the authentication is in progress
+	stateCompressed                          // the compressed protocol is in effect
+	statePassthrough                         // the connection does not use the compressed protocol
+)
+
+// CompressionListener wraps the listener of the MySQL server to support the compressed protocol
+// with the zlib and zstd algorithms.
+type CompressionListener struct {
+	net.Listener
+}
+
+func NewCompressionListener(l net.Listener) *CompressionListener {
+	return &CompressionListener{Listener: l}
+}
+
+func (l *CompressionListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newCompressedConn(conn), nil
+}
+
+// compressedConn is a connection that speaks the compressed protocol with the client
+// if the client asks for it, and exposes the plain packet stream to the server.
+// Like the connections of the MySQL server, it is not safe for concurrent reads or concurrent writes.
+type compressedConn struct {
+	net.Conn
+	state     compressionState
+	algorithm compressionAlgorithm
+	zstdLevel int
+
+	pending []byte // unprocessed bytes written by the server during the handshake
+	rdata   []byte // bytes that are ready to be read by the server
+	reader  *bufio.Reader
+	seq     uint8 // the sequence number of the next compressed frame
+
+	zlibWriter  *zlib.Writer
+	zlibReader  io.ReadCloser
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	buf         bytes.Buffer
+}
+
+func newCompressedConn(conn net.Conn) *compressedConn {
+	return &compressedConn{Conn: conn}
+}
+
+func (c *compressedConn) Read(p []byte) (int, error) {
+	for len(c.rdata) == 0 {
+		switch c.state {
+		case stateResponse:
+			if err := c.readHandshakeResponse(); err != nil {
+				return 0, err
+			}
+		case stateCompressed:
+			if err := c.readFrame(); err != nil {
+				return 0, err
+			}
+		default:
+			return c.Conn.Read(p)
+		}
+	}
+	n := copy(p, c.rdata)
+	c.rdata = c.rdata[n:]
+	return n, nil
+}
+
+func (c *compressedConn) Write(p []byte) (int, error) {
+	switch c.state {
+	case stateCompressed:
+		if err := c.writeFrames(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	case statePassthrough, stateResponse:
+		return c.Conn.Write(p)
+	}
+
+	// Process the handshake packet by packet.
+	c.pending = append(c.pending, p...)
+	for len(c.pending) >= packetHeaderSize && (c.state == stateGreeting || c.state == stateAuth) {
+		size := packetHeaderSize + int(uint24(c.pending))
+		if len(c.pending) < size {
+			break
+		}
+		packet := c.pending[:size]
+		payload := packet[packetHeaderSize:]
+		next := c.state
+		switch c.state {
+		case stateGreeting:
+			next = stateResponse
+			if len(payload) == 0 || payload[0] == packetERR || !advertiseCompression(payload) {
+				next = statePassthrough
+			}
+		case stateAuth:
+			if len(payload) > 0 && (payload[0] == packetOK || payload[0] == packetERR) {
+				// The compressed protocol takes effect after the OK packet of the authentication.
+				next = statePassthrough
+				if payload[0] == packetOK && c.algorithm != compressionNone {
+					next = stateCompressed
+				}
+			}
+		}
+		if _, err := c.Conn.Write(packet); err != nil {
+			return 0, err
+		}
+		c.pending = c.pending[size:]
+		c.state = next
+	}
+	if len(c.pending) > 0 && c.state != stateGreeting && c.state != stateAuth {
+		// The rest of the data follows the handshake.
+		rest := c.pending
+		c.pending = nil
+		if _, err := c.Write(rest); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *compressedConn) Close() error {
+	if c.zstdEncoder != nil {
+		c.zstdEncoder.Close()
+	}
+	if c.zstdDecoder != nil {
+		c.zstdDecoder.Close()
+	}
+	return c.Conn.Close()
+}
+
+// advertiseCompression sets the compression capabilities in the initial handshake packet of the server.
+func advertiseCompression(payload []byte) bool {
+	// protocol version (1), server version (NUL-terminated), connection id (4), auth-plugin-data-part-1 (8), filler (1)
+	end := bytes.IndexByte(payload[1:], 0)
+	if end < 0 {
+		return false
+	}
+	pos := 1 + end + 1 + 4 + 8 + 1
+	// capability flags (lower 2 bytes), character set (1), status flags (2), capability flags (upper 2 bytes)
+	if len(payload) < pos+7 {
+		return false
+	}
+	lower := binary.LittleEndian.Uint16(payload[pos:])
+	binary.LittleEndian.PutUint16(payload[pos:], lower|capabilityClientCompress)
+	upper := binary.LittleEndian.Uint16(payload[pos+5:])
+	binary.LittleEndian.PutUint16(payload[pos+5:], upper|capabilityClientZstdCompressionAlgorithm>>16)
+	return true
+}
+
+// readHandshakeResponse reads the handshake response of the client and negotiates the compression algorithm.
+// The compression capabilities are removed from the response before it is passed to the server.
+func (c *compressedConn) readHandshakeResponse() error {
+	header := make([]byte, packetHeaderSize)
+	if _, err := io.ReadFull(c.Conn, header); err != nil {
+		return err
+	}
+	payload := make([]byte, uint24(header))
+	if _, err := io.ReadFull(c.Conn, payload); err != nil {
+		return err
+	}
+
+	c.state = stateAuth
+	if len(payload) < 4 {
+		c.state = statePassthrough
+		c.rdata = append(header, payload...)
+		return nil
+	}
+	flags := binary.LittleEndian.Uint32(payload)
+	switch {
+	case flags&capabilityClientSSL != 0:
+		// The compressed frames would have to be wrapped in TLS, which is handled by the server.
+		c.state = statePassthrough
+	case flags&capabilityClientZstdCompressionAlgorithm != 0 && len(payload) > 32:
+		// The zstd compression level is the last field of the response.
+		c.algorithm = compressionZstd
+		c.zstdLevel = int(payload[len(payload)-1])
+		payload = payload[:len(payload)-1]
+	case flags&capabilityClientCompress != 0:
+		c.algorithm = compressionZlib
+	}
+	if c.state == stateAuth {
+		flags &^= capabilityClientCompress | capabilityClientZstdCompressionAlgorithm
+		binary.LittleEndian.PutUint32(payload, flags)
+	}
+	putUint24(header, uint32(len(payload)))
+	c.rdata = append(header, payload...)
+	return nil
+}
+
+// readFrame reads a compressed frame and makes its uncompressed content available for reading.
+func (c *compressedConn) readFrame() error {
+	if c.reader == nil {
+		c.reader = bufio.NewReader(c.Conn)
+	}
+	var header [compressedHeaderSize]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return err
+	}
+	compressedLen := uint24(header[:])
+	uncompressedLen := uint24(header[4:])
+	c.seq = header[3] + 1
+
+	payload := make([]byte, compressedLen)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+	if uncompressedLen == 0 {
+		c.rdata = payload
+		return nil
+	}
+
+	data, err := c.decompress(payload, int(uncompressedLen))
+	if err != nil {
+		return fmt.Errorf("failed to decompress packet: %w", err)
+	}
+	if len(data) != int(uncompressedLen) {
+		return fmt.Errorf("failed to decompress packet: expected %d bytes, got %d", uncompressedLen, len(data))
+	}
+	c.rdata = data
+	return nil
+}
+
+func (c *compressedConn) decompress(payload []byte, size int) ([]byte, error) {
+	switch c.algorithm {
+	case compressionZstd:
+		if c.zstdDecoder == nil {
+			decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxPayloadSize))
+			if err != nil {
+				return nil, err
+			}
+			c.zstdDecoder = decoder
+		}
+		return c.zstdDecoder.DecodeAll(payload, make([]byte, 0, size))
+	default:
+		var err error
+		if c.zlibReader == nil {
+			c.zlibReader, err = zlib.NewReader(bytes.NewReader(payload))
+		} else {
+			err = c.zlibReader.(zlib.Resetter).Reset(bytes.NewReader(payload), nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size)
+		n, err := io.ReadFull(c.zlibReader, data)
+		return data[:n], err
+	}
+}
+
+// writeFrames writes the data as compressed frames.
+// A frame does not necessarily contain whole packets; the client reassembles the packet stream.
+func (c *compressedConn) writeFrames(p []byte) error {
+	for len(p) > 0 {
+		n := min(len(p), maxPayloadSize)
+		chunk := p[:n]
+		p = p[n:]
+
+		var header [compressedHeaderSize]byte
+		payload := chunk
+		if len(chunk) >= minCompressLength {
+			compressed, err := c.compress(chunk)
+			if err != nil {
+				return err
+			}
+			// Send the data uncompressed if the compression does not pay off.
+			if len(compressed) < len(chunk) {
+				payload = compressed
+				putUint24(header[4:], uint32(len(chunk)))
+			}
+		}
+		putUint24(header[:], uint32(len(payload)))
+		header[3] = c.seq
+		c.seq++
+
+		if _, err := c.Conn.Write(append(header[:], payload...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compressedConn) compress(data []byte) ([]byte, error) {
+	switch c.algorithm {
+	case compressionZstd:
+		if c.zstdEncoder == nil {
+			level := zstd.SpeedDefault
+			if c.zstdLevel > 0 {
+				level = zstd.EncoderLevelFromZstd(c.zstdLevel)
+			}
+			encoder, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(level))
+			if err != nil {
+				return nil, err
+			}
+			c.zstdEncoder = encoder
+		}
+		return c.zstdEncoder.EncodeAll(data, nil), nil
+	default:
+		c.buf.Reset()
+		if c.zlibWriter == nil {
+			c.zlibWriter = zlib.NewWriter(&c.buf)
+		} else {
+			c.zlibWriter.Reset(&c.buf)
+		}
+		if _, err := c.zlibWriter.Write(data); err != nil {
+			return nil, err
+		}
+		if err := c.zlibWriter.Close(); err != nil {
+			return nil, err
+		}
+		return bytes.Clone(c.buf.Bytes()), nil
+	}
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
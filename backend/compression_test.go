@@ -0,0 +1,130 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/dolthub/vitess/go/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func makePacket(seq byte, payload []byte) []byte {
+	packet := make([]byte, packetHeaderSize, packetHeaderSize+len(payload))
+	putUint24(packet, uint32(len(payload)))
+	packet[3] = seq
+	return append(packet, payload...)
+}
+
+func readPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, packetHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, uint24(header))
+	_, err := io.ReadFull(r, payload)
+	return payload, err
+}
+
+func makeGreeting() []byte {
+	var b bytes.Buffer
+	b.WriteByte(10)
+	b.WriteString("8.0.33\x00")
+	b.Write([]byte{1, 0, 0, 0})                // connection id
+	b.Write(bytes.Repeat([]byte{'a'}, 8))      // auth-plugin-data-part-1
+	b.WriteByte(0)                             // filler
+	b.Write([]byte{0xff, 0xf7})                // capability flags (lower 2 bytes)
+	b.WriteByte(255)                           // character set
+	b.Write([]byte{2, 0})                      // status flags
+	b.Write([]byte{0xff, 0x01})                // capability flags (upper 2 bytes)
+	b.WriteByte(21)                            // length of auth-plugin-data
+	b.Write(make([]byte, 10))                  // reserved
+	b.Write(bytes.Repeat([]byte{'b'}, 13))     // auth-plugin-data-part-2
+	b.WriteString("mysql_native_password\x00") // auth plugin name
+	return b.Bytes()
+}
+
+func TestCompressedConn(t *testing.T) {
+	tests := []struct {
+		name      string
+		flags     uint32
+		level     []byte
+		algorithm compressionAlgorithm
+	}{
+		{name: "No compression", flags: 0},
+		{name: "zlib", flags: capabilityClientCompress, algorithm: compressionZlib},
+		{name: "zstd", flags: capabilityClientZstdCompressionAlgorithm, level: []byte{3}, algorithm: compressionZstd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer listener.Close()
+			clientEnd, err := net.Dial("tcp", listener.Addr().String())
+			require.NoError(t, err)
+			defer clientEnd.Close()
+			conn, err := NewCompressionListener(listener).Accept()
+			require.NoError(t, err)
+			server := conn.(*compressedConn)
+			defer server.Close()
+
+			command := append([]byte{0x03}, bytes.Repeat([]byte("SELECT 1; "), 100)...)
+			result := bytes.Repeat([]byte("row data "), 1000)
+			errs := make(chan error, 1)
+			go func() {
+				errs <- func() error {
+					if _, err := server.Write(makePacket(0, makeGreeting())); err != nil {
+						return err
+					}
+					response, err := readPacket(server)
+					if err != nil {
+						return err
+					}
+					flags := binary.LittleEndian.Uint32(response)
+					if flags&(capabilityClientCompress|capabilityClientZstdCompressionAlgorithm) != 0 || len(response) != 32 {
+						return io.ErrUnexpectedEOF
+					}
+					// The OK packet and the beginning of the next packet are written at once.
+					next := makePacket(0, result)
+					if _, err := server.Write(append(makePacket(2, []byte{packetOK, 0, 0, 2, 0, 0, 0}), next[:10]...)); err != nil {
+						return err
+					}
+					if received, err := readPacket(server); err != nil || !bytes.Equal(received, command) {
+						return io.ErrUnexpectedEOF
+					}
+					_, err = server.Write(next[10:])
+					return err
+				}()
+			}()
+
+			greeting, err := readPacket(clientEnd)
+			require.NoError(t, err)
+			require.True(t, advertiseCompression(bytes.Clone(greeting)))
+			require.NotEqual(t, makeGreeting(), greeting)
+
+			response := make([]byte, 32, 33)
+			binary.LittleEndian.PutUint32(response, mysql.CapabilityClientProtocol41|tt.flags)
+			response = append(response, tt.level...)
+			_, err = clientEnd.Write(makePacket(1, response))
+			require.NoError(t, err)
+			ok, err := readPacket(clientEnd)
+			require.NoError(t, err)
+			require.Equal(t, byte(packetOK), ok[0])
+
+			// The client speaks the compressed protocol from now on.
+			client := io.ReadWriter(clientEnd)
+			if tt.algorithm != compressionNone {
+				client = &compressedConn{Conn: clientEnd, state: stateCompressed, algorithm: tt.algorithm}
+			}
+			_, err = client.Write(makePacket(0, command))
+			require.NoError(t, err)
+			received, err := readPacket(client)
+			require.NoError(t, err)
+			require.Equal(t, result, received)
+			require.NoError(t, <-errs)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+)
+
+// ExecutionPathVariable is the session variable that chooses how the queries of the MySQL protocol are executed,
+// to work around the translation bugs of either path, or to compare their results:
+//
+//   - `auto` executes the pure data queries in DuckDB directly, and the others in the engine, see DuckBuilder.build.
+//   - `engine` executes all queries in the engine of go-mysql-server, which only scans the tables in DuckDB.
+//   - `duckdb` executes the queries that can be translated in DuckDB directly, even if they are not pure data queries
+//     or refer to variables, which DuckDB may fail to run.
+//
+// A query may choose its path with an optimizer hint as well, e.g., `SELECT /*+ myduck:engine */ ...`,
+// which takes precedence over the variable.
+const ExecutionPathVariable = "myduck_execution_path"
+
+// The execution paths.
+const (
+	ExecutionPathAuto   = "auto"
+	ExecutionPathEngine = "engine"
+	ExecutionPathDuckDB = "duckdb"
+)
+
+func init() {
+	sql.SystemVariables.AddSystemVariables([]sql.SystemVariable{
+		&sql.MysqlSystemVariable{
+			Name:              ExecutionPathVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Both),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemEnumType(ExecutionPathVariable, ExecutionPathAuto, ExecutionPathEngine, ExecutionPathDuckDB),
+			Default:           ExecutionPathAuto,
+		},
+	})
+}
+
+// executionPathHintRegex matches the hint of the execution path in an optimizer hint comment.
+var executionPathHintRegex = regexp.MustCompile(`(?is)/\*\+(?:[^*]|\*[^/])*?\bmyduck\s*:\s*(engine|duckdb|auto)\b`)
+
+// executionPathHint returns the execution path chosen by the optimizer hint of the query, or "" if there is none.
+func executionPathHint(query string) string {
+	if !strings.Contains(query, "/*+") {
+		return ""
+	}
+	if m := executionPathHintRegex.FindStringSubmatch(query); m != nil {
+		return strings.ToLower(m[1])
+	}
+	return ""
+}
+
+// executionPath returns the execution path of the query of the context.
+func executionPath(ctx *sql.Context) string {
+	if path := executionPathHint(ctx.Query()); path != "" {
+		return path
+	}
+	if v, err := ctx.GetSessionVariable(ctx, ExecutionPathVariable); err == nil {
+		if path, ok := v.(string); ok && path != "" {
+			return strings.ToLower(path)
+		}
+	}
+	return ExecutionPathAuto
+}
@@ -0,0 +1,35 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutionPath(t *testing.T) {
+	for query, expected := range map[string]string{
+		"SELECT * FROM t":                                    "",
+		"SELECT /*+ myduck:engine */ * FROM t":               ExecutionPathEngine,
+		"SELECT /*+ JOIN_ORDER(a, b) MYDUCK:DuckDB */ 1":     ExecutionPathDuckDB,
+		"INSERT /*+ myduck : auto */ INTO t VALUES (1)":      ExecutionPathAuto,
+		"SELECT /* myduck:engine */ * FROM t":                "",
+		"SELECT /*+ JOIN_ORDER(a) */ 'myduck:engine' FROM t": "",
+	} {
+		require.Equal(t, expected, executionPathHint(query), query)
+	}
+
+	sess := sql.NewBaseSession()
+	newCtx := func(query string) *sql.Context {
+		return sql.NewContext(context.Background(), sql.WithSession(sess), sql.WithQuery(query))
+	}
+	require.Equal(t, ExecutionPathAuto, executionPath(newCtx("SELECT 1")))
+
+	require.NoError(t, sess.SetSessionVariable(newCtx(""), ExecutionPathVariable, ExecutionPathEngine))
+	require.Equal(t, ExecutionPathEngine, executionPath(newCtx("SELECT 1")))
+	// The hint takes precedence over the variable.
+	require.Equal(t, ExecutionPathDuckDB, executionPath(newCtx("SELECT /*+ myduck:duckdb */ 1")))
+
+	require.Error(t, sess.SetSessionVariable(newCtx(""), ExecutionPathVariable, "fast"))
+}
@@ -14,12 +14,12 @@
 package backend
 
 import (
+	"context"
 	stdsql "database/sql"
 	"fmt"
 
 	"github.com/apecloud/myduckserver/adapter"
 	"github.com/apecloud/myduckserver/catalog"
-	"github.com/apecloud/myduckserver/transpiler"
 	"github.com/dolthub/go-mysql-server/sql"
 	"github.com/dolthub/go-mysql-server/sql/expression"
 	"github.com/dolthub/go-mysql-server/sql/expression/function"
@@ -51,7 +51,74 @@ func (b *DuckBuilder) Provider() *catalog.DatabaseProvider {
 	return b.provider
 }
 
-func (b *DuckBuilder) Build(ctx *sql.Context, root sql.Node, r sql.Row) (sql.RowIter, error) {
+func (b *DuckBuilder) Build(ctx *sql.Context, root sql.Node, r sql.Row) (iter sql.RowIter, err error) {
+	updateStatusVariables(ctx, root)
+	defer func() {
+		if err == nil {
+			recordSchemaChanges(ctx, root)
+		}
+		if err == nil {
+			if err = markFTSIndexesStale(ctx, root); err != nil {
+				iter.Close(ctx)
+				iter = nil
+			}
+		}
+	}()
+
+	// The statements that change the session state only are never queued by the scheduler,
+	// so that a session can always switch its workload class or end its transaction.
+	switch root.(type) {
+	case *plan.Set, *plan.ShowVariables, *plan.StartTransaction, *plan.Commit, *plan.Rollback:
+		return b.build(ctx, root, r)
+	}
+	// The queries without a cancelable context, e.g., the ones of the replication appliers, are not queued,
+	// since their end cannot be observed.
+	sess, ok := ctx.Session.(*Session)
+	if !ok || ctx.Done() == nil {
+		return b.buildMasked(ctx, root, r)
+	}
+	release, err := sess.AcquireQuerySlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The context of the query is canceled when the query ends, after the rows have been sent to the client.
+	context.AfterFunc(ctx, release)
+	iter, err = b.buildMasked(ctx, root, r)
+	if err != nil {
+		release()
+	}
+	return iter, err
+}
+
+// buildMasked builds root, masking the columns of its result for the user of the session, see masking.go,
+// after checking the access of the statement to the tenants, the query profiles, and the protected internal tables,
+// see CheckTenantAccess, checkQueryProfileAccess, and checkProtectedTableWrite.
+func (b *DuckBuilder) buildMasked(ctx *sql.Context, root sql.Node, r sql.Row) (sql.RowIter, error) {
+	if err := CheckTenantAccess(ctx, ctx.Query(), !root.IsReadOnly()); err != nil {
+		return nil, err
+	}
+	if err := checkQueryProfileAccess(ctx, root); err != nil {
+		return nil, err
+	}
+	if err := checkProtectedTableWrite(ctx, root); err != nil {
+		return nil, err
+	}
+	if err := checkMaskedWrite(ctx, root); err != nil {
+		return nil, err
+	}
+	iter, err := b.build(ctx, root, r)
+	if err != nil || types.IsOkResultSchema(root.Schema()) {
+		return iter, err
+	}
+	masked, err := maskResults(ctx, root, iter)
+	if err != nil {
+		iter.Close(ctx)
+		return nil, err
+	}
+	return masked, nil
+}
+
+func (b *DuckBuilder) build(ctx *sql.Context, root sql.Node, r sql.Row) (sql.RowIter, error) {
 	// Flush the delta buffer before executing the query.
 	// TODO(fan): Be fine-grained and flush only when the replicated tables are touched.
 	if b.FlushDeltaBuffer != nil {
@@ -73,6 +140,7 @@ func (b *DuckBuilder) Build(ctx *sql.Context, root sql.Node, r sql.Row) (sql.Row
 	switch n.(type) {
 	case *plan.CreateDB, *plan.DropDB, *plan.DropTable, *plan.RenameTable,
 		*plan.CreateTable, *plan.AddColumn, *plan.RenameColumn, *plan.DropColumn, *plan.ModifyColumn,
+		*plan.AlterPK,
 		*plan.Truncate,
 		*plan.CreateIndex, *plan.DropIndex, *plan.AlterIndex, *plan.ShowIndexes,
 		*plan.ShowTables, *plan.ShowCreateTable, *plan.ShowColumns,
@@ -81,6 +149,16 @@ func (b *DuckBuilder) Build(ctx *sql.Context, root sql.Node, r sql.Row) (sql.Row
 		*plan.Set, *plan.ShowVariables,
 		*plan.AlterDefaultSet, *plan.AlterDefaultDrop:
 		return b.base.Build(ctx, root, r)
+	}
+
+	// The execution path may be forced by the session or by the query, see ExecutionPathVariable.
+	path := executionPath(ctx)
+	if path == ExecutionPathEngine {
+		ctx.GetLogger().Traceln("Executing in the engine as forced")
+		return b.base.Build(ctx, root, r)
+	}
+
+	switch n.(type) {
 	case *plan.InsertInto:
 		insert := n.(*plan.InsertInto)
 
@@ -113,6 +191,10 @@ func (b *DuckBuilder) Build(ctx *sql.Context, root sql.Node, r sql.Row) (sql.Row
 					return b.base.Build(ctx, root, r)
 				}
 			}
+			// Large multi-row INSERTs, e.g., the ones written by mysqldump, are appended directly.
+			if iter, ok, err := b.buildAppendValues(ctx, insert, dst); ok || err != nil {
+				return iter, err
+			}
 		}
 	}
 
@@ -121,8 +203,12 @@ func (b *DuckBuilder) Build(ctx *sql.Context, root sql.Node, r sql.Row) (sql.Row
 	switch n := n.(type) {
 	case *plan.TableCopier:
 		tree = n.Source
+	case *plan.DescribeQuery:
+		tree = n.Query()
 	}
-	if containsVariable(tree) || !IsPureDataQuery(tree) {
+	if path != ExecutionPathDuckDB && (containsVariable(tree) || !IsPureDataQuery(tree)) ||
+		path == ExecutionPathDuckDB && callsMySQLQuery(tree) ||
+		calcsFoundRows(tree) {
 		ctx.GetLogger().Traceln("Falling back to the base builder")
 		return b.base.Build(ctx, root, r)
 	}
@@ -134,13 +220,7 @@ func (b *DuckBuilder) Build(ctx *sql.Context, root sql.Node, r sql.Row) (sql.Row
 
 	switch node := n.(type) {
 	case *plan.Use:
-		useStmt := "USE " + catalog.FullSchemaName(adapter.GetCurrentCatalog(ctx), node.Database().Name())
-		if _, err := conn.ExecContext(ctx.Context, useStmt); err != nil {
-			if catalog.IsDuckDBSetSchemaNotFoundError(err) {
-				return nil, sql.ErrDatabaseNotFound.New(node.Database().Name())
-			}
-			return nil, err
-		}
+		// The DuckDB connection is switched by Session.UseDatabase.
 		return b.base.Build(ctx, root, r)
 	// ResolvedTable is for `SELECT * FROM table` and `TABLE table`
 	// SubqueryAlias is for `SELECT * FROM view`
@@ -156,7 +236,9 @@ func (b *DuckBuilder) Build(ctx *sql.Context, root sql.Node, r sql.Row) (sql.Row
 		if _, ok := node.Source.(*plan.ResolvedTable); ok {
 			return b.base.Build(ctx, root, r)
 		}
-		return b.executeDML(ctx, node, conn)
+		return b.executeCTAS(ctx, node, conn)
+	case *plan.DescribeQuery:
+		return b.executeExplain(ctx, node, r, conn)
 	case sql.Expressioner:
 		return b.executeExpressioner(ctx, node, conn)
 	case *plan.DeleteFrom:
@@ -168,11 +250,71 @@ func (b *DuckBuilder) Build(ctx *sql.Context, root sql.Node, r sql.Row) (sql.Row
 	}
 }
 
+// executeCTAS executes a `CREATE TABLE ... AS SELECT` statement in DuckDB,
+// then records the MySQL types of the query in the comments of the created columns.
+func (b *DuckBuilder) executeCTAS(ctx *sql.Context, n *plan.TableCopier, conn *stdsql.Conn) (sql.RowIter, error) {
+	iter, err := b.executeDML(ctx, n, conn)
+	if err != nil {
+		return nil, err
+	}
+	if ct, ok := n.Destination.(*plan.CreateTable); ok && !ct.Temporary() {
+		if err := catalog.AnnotateColumnTypes(ctx, adapter.GetCurrentCatalog(ctx), n.Database().Name(), ct.Name(), n.Source.Schema()); err != nil {
+			ctx.GetLogger().WithError(err).Warnf("Failed to record the column types of table %s", ct.Name())
+		}
+	}
+	return iter, nil
+}
+
+// annotateInsertedColumns records the MySQL types of the query of an `INSERT INTO ... SELECT` statement
+// in the comments of the columns that it writes, if they have none, e.g., in a table created over Postgres.
+func annotateInsertedColumns(ctx *sql.Context, insert *plan.InsertInto) {
+	if insert.LiteralValueSource {
+		return
+	}
+	// The analyzer wraps the query in a projection onto the full schema of the table, with the defaults filled.
+	source := insert.Source
+	if proj, ok := source.(*plan.Project); ok {
+		source = proj.Child
+	}
+	if _, ok := source.(*plan.Values); ok {
+		return
+	}
+	dst, err := plan.GetInsertable(insert.Destination)
+	if err != nil {
+		return
+	}
+	names := insert.ColumnNames
+	if len(names) == 0 {
+		for _, col := range dst.Schema() {
+			names = append(names, col.Name)
+		}
+	}
+	schema := source.Schema()
+	if len(schema) != len(names) {
+		return
+	}
+	written := make(sql.Schema, len(schema))
+	for i, col := range schema {
+		written[i] = col.Copy()
+		written[i].Name, written[i].Comment = names[i], ""
+	}
+	if err := catalog.AnnotateColumnTypes(ctx, adapter.GetCurrentCatalog(ctx), insert.Database().Name(), dst.Name(), written); err != nil {
+		ctx.GetLogger().WithError(err).Warnf("Failed to record the column types of table %s", dst.Name())
+	}
+}
+
 func (b *DuckBuilder) executeExpressioner(ctx *sql.Context, n sql.Expressioner, conn *stdsql.Conn) (sql.RowIter, error) {
 	node := n.(sql.Node)
-	switch n.(type) {
+	switch n := n.(type) {
 	case *plan.InsertInto:
-		return b.executeDML(ctx, node, conn)
+		if isUpsert(n) {
+			return b.executeUpsert(ctx, n, conn)
+		}
+		iter, err := b.executeDML(ctx, node, conn)
+		if err == nil {
+			annotateInsertedColumns(ctx, n)
+		}
+		return iter, err
 	case *plan.Update:
 		return b.executeDML(ctx, node, conn)
 	default:
@@ -196,7 +338,7 @@ func (b *DuckBuilder) executeQuery(ctx *sql.Context, n sql.Node, conn *stdsql.Co
 		// SQLGlot cannot translate MySQL's `TABLE t` into DuckDB's `FROM t` - it produces `"table" AS t` instead.
 		duckSQL = `FROM ` + catalog.ConnectIdentifiersANSI(n.Database().Name(), n.Name())
 	default:
-		duckSQL, err = transpiler.TranslateWithSQLGlot(ctx.Query())
+		duckSQL, err = translateToDuckDB(ctx.Query())
 	}
 	if err != nil {
 		return nil, catalog.ErrTranspiler.New(err)
@@ -220,7 +362,7 @@ func (b *DuckBuilder) executeQuery(ctx *sql.Context, n sql.Node, conn *stdsql.Co
 
 func (b *DuckBuilder) executeDML(ctx *sql.Context, n sql.Node, conn *stdsql.Conn) (sql.RowIter, error) {
 	// Translate the MySQL query to a DuckDB query
-	duckSQL, err := transpiler.TranslateWithSQLGlot(ctx.Query())
+	duckSQL, err := translateToDuckDB(ctx.Query())
 	if err != nil {
 		return nil, catalog.ErrTranspiler.New(err)
 	}
@@ -253,6 +395,8 @@ func (b *DuckBuilder) executeDML(ctx *sql.Context, n sql.Node, conn *stdsql.Conn
 
 	var info fmt.Stringer
 	if _, ok := n.(*plan.Update); ok {
+		// UPDATE statements also set FOUND_ROWS() to the number of the matched rows.
+		ctx.SetLastQueryInfoInt(sql.FoundRows, affected)
 		if (ctx.Client().Capabilities & mysql.CapabilityClientFoundRows) > 0 {
 			info = plan.UpdateInfo{
 				Matched: int(affected),
@@ -261,11 +405,11 @@ func (b *DuckBuilder) executeDML(ctx *sql.Context, n sql.Node, conn *stdsql.Conn
 		}
 	}
 
-	return sql.RowsToRowIter(sql.NewRow(types.OkResult{
+	return okResultIter(ctx, types.OkResult{
 		RowsAffected: uint64(affected),
 		InsertID:     uint64(insertId),
 		Info:         info,
-	})), nil
+	}), nil
 }
 
 // containsVariable inspects if the plan contains a system or user variable.
@@ -282,6 +426,13 @@ func containsVariable(n sql.Node) bool {
 	return found
 }
 
+// callsMySQLQuery reports whether the plan calls the mysql_query table function, which is always run in the engine.
+func callsMySQLQuery(n sql.Node) bool {
+	c := &tableAndFuncCollector{}
+	transform.Walk(c, n)
+	return c.federated
+}
+
 // IsPureDataQuery inspects if the plan is a pure data query,
 // i.e., it operates on (>=1) data tables and does not touch any system tables.
 // The following examples are NOT pure data queries:
@@ -292,6 +443,11 @@ func IsPureDataQuery(n sql.Node) bool {
 	c := &tableAndFuncCollector{}
 	transform.Walk(c, n)
 
+	// The queries on other MySQL servers are run by the table function, since DuckDB expects an attached source.
+	if c.federated {
+		return false
+	}
+
 	hasDataTable := false
 	for _, tn := range c.tables {
 		switch tn.Database().Name() {
@@ -310,7 +466,7 @@ func IsPureDataQuery(n sql.Node) bool {
 	}
 
 	for _, fe := range c.functions {
-		if _, ok := fe.(*function.Database); ok {
+		if _, ok := fe.(*function.Database); ok || isQueryInfoFunction(fe) {
 			return false
 		}
 	}
@@ -320,6 +476,7 @@ func IsPureDataQuery(n sql.Node) bool {
 type tableAndFuncCollector struct {
 	functions []sql.FunctionExpression
 	tables    []sql.TableNode
+	federated bool // whether mysql_query is called
 }
 
 type exprVisitor tableAndFuncCollector
@@ -346,6 +503,8 @@ func (c *tableAndFuncCollector) Visit(n sql.Node) transform.Visitor {
 		return nil
 	} else if tn, ok := n.(sql.TableNode); ok {
 		c.tables = append(c.tables, tn)
+	} else if _, ok := n.(*MySQLQueryTable); ok {
+		c.federated = true
 	}
 
 	// Visit expressions to find functions e.g. database() and walk subquery nodes to collect any nested table references
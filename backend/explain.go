@@ -0,0 +1,190 @@
+package backend
+
+import (
+	stdsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	ast "github.com/dolthub/vitess/go/vt/sqlparser"
+)
+
+// The queries run by DuckDB are explained with the plan of DuckDB rather than the one of the engine:
+//
+//   - `EXPLAIN SELECT ...` (or `DESCRIBE SELECT ...`) returns the MySQL plan table, with a row for each table
+//     scanned by DuckDB, whose type is ALL for a sequential scan or ref for an index scan, and whose rows
+//     is the cardinality estimated by DuckDB.
+//   - `EXPLAIN FORMAT=TREE SELECT ...` returns the plan rendered by DuckDB as is, in a single row.
+//
+// The other forms, e.g., EXPLAIN ANALYZE or EXPLAIN PLAN, and the queries run by the engine are explained by the engine.
+
+// explainRegex matches an EXPLAIN statement, capturing its format and the explained statement.
+var explainRegex = regexp.MustCompile(`(?is)^\s*(?:explain|describe|desc)\s+(?:format\s*=\s*['"]?(\w+)['"]?\s+)?(.*)$`)
+
+// splitExplain returns the format of an EXPLAIN statement in lower case and the explained statement.
+func splitExplain(query string) (format string, stmt string, ok bool) {
+	m := explainRegex.FindStringSubmatch(query)
+	if m == nil {
+		return "", "", false
+	}
+	return strings.ToLower(m[1]), m[2], true
+}
+
+// withTreeExplain makes `EXPLAIN FORMAT=TREE` return the single-column plan schema, which the engine
+// otherwise uses for `EXPLAIN PLAN` only.
+func withTreeExplain(stmt ast.Statement) {
+	if explain, ok := stmt.(*ast.Explain); ok && strings.EqualFold(explain.ExplainFormat, ast.TreeStr) {
+		explain.Plan = true
+	}
+}
+
+// executeExplain explains the query of n with the plan of DuckDB, see the top of this file.
+func (b *DuckBuilder) executeExplain(ctx *sql.Context, n *plan.DescribeQuery, r sql.Row, conn *stdsql.Conn) (sql.RowIter, error) {
+	format, stmt, ok := splitExplain(ctx.Query())
+	tree := format == ast.TreeStr
+	if !ok || n.Format.Analyze || n.Format.Debug || n.Format.Estimates || n.Format.Plan != tree {
+		return b.base.Build(ctx, n, r)
+	}
+
+	duckSQL, err := translateToDuckDB(stmt)
+	if err != nil {
+		return nil, catalog.ErrTranspiler.New(err)
+	}
+	if tree {
+		duckSQL = `EXPLAIN ` + duckSQL
+	} else {
+		duckSQL = `EXPLAIN (FORMAT JSON) ` + duckSQL
+	}
+
+	physicalPlan, err := queryPhysicalPlan(ctx, conn, duckSQL)
+	if err != nil {
+		return nil, err
+	}
+	if tree {
+		return sql.RowsToRowIter(sql.NewRow(physicalPlan)), nil
+	}
+
+	var nodes []duckPlanNode
+	if err := json.Unmarshal([]byte(physicalPlan), &nodes); err != nil {
+		return nil, fmt.Errorf("failed to decode the plan of DuckDB: %w", err)
+	}
+	return sql.RowsToRowIter(explainRows(nodes)...), nil
+}
+
+// queryPhysicalPlan returns the physical plan of the result of a DuckDB EXPLAIN statement.
+func queryPhysicalPlan(ctx *sql.Context, conn *stdsql.Conn, query string) (string, error) {
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var physicalPlan string
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return "", err
+		}
+		if key == "physical_plan" {
+			physicalPlan = value
+		}
+	}
+	return physicalPlan, rows.Err()
+}
+
+// duckPlanNode is an operator of a plan of DuckDB in the JSON format.
+type duckPlanNode struct {
+	Name      string         `json:"name"`
+	Children  []duckPlanNode `json:"children"`
+	ExtraInfo map[string]any `json:"extra_info"`
+}
+
+// explainRows returns the rows of the MySQL plan table, see plan.DescribeSchema, for a plan of DuckDB.
+func explainRows(nodes []duckPlanNode) []sql.Row {
+	var rows []sql.Row
+	empty := false
+	var walk func(node duckPlanNode, filtered bool, joinBuffer string)
+	walk = func(node duckPlanNode, filtered bool, joinBuffer string) {
+		name := strings.TrimSpace(node.Name)
+		if name == "EMPTY_RESULT" {
+			empty = true
+		}
+		if table := planInfo(node, "Table", "Text"); table != "" && strings.HasSuffix(name, "_SCAN") {
+			var extra []string
+			if filtered || planInfo(node, "Filters") != "" {
+				extra = append(extra, "Using where")
+			}
+			if joinBuffer != "" {
+				extra = append(extra, joinBuffer)
+			}
+			rows = append(rows, explainRow(table, scanType(name), estimatedRows(node), strings.Join(extra, "; ")))
+		}
+		for i, child := range node.Children {
+			buffer := joinBuffer
+			if strings.HasSuffix(name, "JOIN") && i > 0 {
+				// The right side of a join is built into a buffer, which is probed with the rows of the left side.
+				buffer = "Using join buffer (" + strings.ToLower(strings.ReplaceAll(name, "_", " ")) + ")"
+			}
+			walk(child, name == "FILTER", buffer)
+		}
+	}
+	for _, node := range nodes {
+		walk(node, false, "")
+	}
+
+	if len(rows) == 0 {
+		extra := "No tables used"
+		if empty {
+			extra = "Impossible WHERE"
+		}
+		rows = append(rows, explainRow(nil, nil, nil, extra))
+	}
+	return rows
+}
+
+func explainRow(table, typ, rows any, extra string) sql.Row {
+	var filtered any
+	if table != nil {
+		filtered = float64(100)
+	}
+	// | id | select_type | table | partitions | type | possible_keys | key | key_len | ref | rows | filtered | Extra |
+	return sql.NewRow(uint64(1), "SIMPLE", table, nil, typ, nil, nil, nil, nil, rows, filtered, extra)
+}
+
+// scanType returns the MySQL access type of a scan operator of DuckDB.
+func scanType(name string) string {
+	if name == "INDEX_SCAN" {
+		return "ref"
+	}
+	return "ALL"
+}
+
+// estimatedRows returns the cardinality estimated by DuckDB for an operator, or nil if there is none.
+func estimatedRows(node duckPlanNode) any {
+	if n, err := strconv.ParseUint(planInfo(node, "Estimated Cardinality"), 10, 64); err == nil {
+		return n
+	}
+	return nil
+}
+
+// planInfo returns the first of the given keys in the extra info of an operator, joining a list of values.
+func planInfo(node duckPlanNode, keys ...string) string {
+	for _, key := range keys {
+		switch v := node.ExtraInfo[key].(type) {
+		case string:
+			return v
+		case []any:
+			values := make([]string, len(v))
+			for i, e := range v {
+				values[i] = fmt.Sprint(e)
+			}
+			return strings.Join(values, ", ")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package backend
+
+import (
+	stdsql "database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	ast "github.com/dolthub/vitess/go/vt/sqlparser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitExplain(t *testing.T) {
+	for query, expected := range map[string][2]string{
+		"EXPLAIN SELECT * FROM t":              {"", "SELECT * FROM t"},
+		"explain format=tree select 1":         {"tree", "select 1"},
+		"DESCRIBE FORMAT = 'TREE'\nSELECT 1":   {"tree", "SELECT 1"},
+		"desc select a from t where a = 1":     {"", "select a from t where a = 1"},
+		"EXPLAIN FORMAT=TRADITIONAL SELECT 1":  {"traditional", "SELECT 1"},
+		"  EXPLAIN  SELECT 1 FROM t LIMIT 1  ": {"", "SELECT 1 FROM t LIMIT 1  "},
+	} {
+		format, stmt, ok := splitExplain(query)
+		require.True(t, ok, query)
+		require.Equal(t, expected, [2]string{format, stmt}, query)
+	}
+	_, _, ok := splitExplain("SELECT 1")
+	require.False(t, ok)
+}
+
+func TestTreeExplain(t *testing.T) {
+	p := NewParser()
+	stmt, err := p.ParseSimple("EXPLAIN FORMAT=TREE SELECT 1")
+	require.NoError(t, err)
+	require.True(t, stmt.(*ast.Explain).Plan)
+
+	stmt, err = p.ParseSimple("EXPLAIN SELECT 1")
+	require.NoError(t, err)
+	require.False(t, stmt.(*ast.Explain).Plan)
+}
+
+func TestExplainRows(t *testing.T) {
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+	for _, q := range []string{
+		"CREATE TABLE t (a INT PRIMARY KEY, c INT)",
+		"CREATE TABLE u (a INT, d INT)",
+		"INSERT INTO t SELECT range, range FROM range(1000)",
+		"INSERT INTO u SELECT range, range FROM range(50)",
+	} {
+		_, err := db.Exec(q)
+		require.NoError(t, err)
+	}
+
+	explain := func(query string) []sql.Row {
+		var key, value string
+		require.NoError(t, db.QueryRow("EXPLAIN (FORMAT JSON) "+query).Scan(&key, &value))
+		var nodes []duckPlanNode
+		require.NoError(t, json.Unmarshal([]byte(value), &nodes))
+		return explainRows(nodes)
+	}
+
+	require.Equal(t, []sql.Row{
+		{uint64(1), "SIMPLE", "t", nil, "ALL", nil, nil, nil, nil, uint64(200), float64(100), "Using where"},
+	}, explain("SELECT * FROM t WHERE c > 5 AND c < 10"))
+
+	require.Equal(t, []sql.Row{
+		{uint64(1), "SIMPLE", "t", nil, "ref", nil, nil, nil, nil, uint64(1000), float64(100), "Using where"},
+	}, explain("SELECT * FROM t WHERE a = 5"))
+
+	require.Equal(t, []sql.Row{
+		{uint64(1), "SIMPLE", "t", nil, "ALL", nil, nil, nil, nil, uint64(1000), float64(100), "Using where"},
+		{uint64(1), "SIMPLE", "u", nil, "ALL", nil, nil, nil, nil, uint64(50), float64(100), "Using join buffer (hash join)"},
+	}, explain("SELECT * FROM t WHERE a IN (SELECT d FROM u)"))
+
+	require.Equal(t, []sql.Row{
+		{uint64(1), "SIMPLE", nil, nil, nil, nil, nil, nil, nil, nil, nil, "No tables used"},
+	}, explain("SELECT 1"))
+}
@@ -0,0 +1,210 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/apecloud/myduckserver/storage"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/mysql_db"
+)
+
+// The exports of the tables and the results of the queries to the object storage, e.g., for a lakehouse to pick up
+// the data of the replica, are written by the COPY of DuckDB over both protocols:
+//
+//	COPY { [schema.]table | (query) } TO 's3://bucket/path/' [WITH] (
+//	    FORMAT parquet, PARTITION_BY (column, ...), COMPRESSION zstd, OVERWRITE_OR_IGNORE, ...
+//	    [, ENDPOINT '<endpoint>', ACCESS_KEY_ID '<access_key>', SECRET_ACCESS_KEY '<secret_key>'])
+//
+// The options other than the credentials are passed to DuckDB as they are, e.g., PARTITION_BY writes a directory of
+// Hive-partitioned files. The format is parquet unless it is given. The credentials are given the same as for
+// BACKUP DATABASE, and s3c:// is an S3-compatible storage at the endpoint. They are kept in a temporary secret of DuckDB
+// during the export only. Without them, the S3 secrets of DuckDB, e.g., created by `CREATE SECRET (TYPE s3, ...)`
+// over the Postgres protocol, or the credentials in the environment of the server are used.
+//
+// An export requires the global FILE privilege of the MySQL account with the name of the user, if there is one,
+// the same as SELECT ... INTO OUTFILE, and the masked tables cannot be exported by the users without UNMASK.
+
+var (
+	exportRegex = regexp.MustCompile(`(?is)^\s*COPY\s+(.+?)\s+TO\s+'((?:s3|s3c)://(?:[^']|'')+)'\s*(?:(?:WITH\s*)?\((.*)\))?[\s;]*$`)
+	// exportOptionRegex matches an option of an export, whose value may be preceded by '='.
+	exportOptionRegex = regexp.MustCompile(`(?s)^([A-Za-z_]+)(?:\s*=?\s*(.*))?$`)
+)
+
+// exportCredentialOptions are the options of an export that are the credentials of the storage.
+var exportCredentialOptions = map[string]struct{}{
+	"ENDPOINT":          {},
+	"ACCESS_KEY_ID":     {},
+	"SECRET_ACCESS_KEY": {},
+}
+
+// Export is a parsed export to the object storage.
+type Export struct {
+	// Source is the table or the parenthesized query that is exported.
+	Source string
+	// URL is the URL that DuckDB writes to.
+	URL string
+	// Options are the options passed to the COPY of DuckDB.
+	Options []string
+	// Storage is the storage of the credentials given, or nil if there are none.
+	Storage *storage.ObjectStorageConfig
+}
+
+// IsExportStatement reports whether the query exports a table or a query to the object storage.
+func IsExportStatement(query string) bool {
+	return exportRegex.MatchString(query)
+}
+
+// ParseExport parses an export to the object storage. It returns nil if the query is not an export.
+func ParseExport(query string) (*Export, error) {
+	m := exportRegex.FindStringSubmatch(query)
+	if m == nil {
+		return nil, nil
+	}
+	uri := strings.ReplaceAll(m[2], "''", "'")
+	e := &Export{Source: strings.TrimSpace(m[1]), URL: uri}
+
+	credentials := make(map[string]string)
+	hasFormat := false
+	for _, option := range splitExportOptions(m[3]) {
+		om := exportOptionRegex.FindStringSubmatch(option)
+		if om == nil {
+			return nil, fmt.Errorf("invalid option of COPY: %q", option)
+		}
+		name := strings.ToUpper(om[1])
+		if _, ok := exportCredentialOptions[name]; ok {
+			value := strings.TrimSpace(om[2])
+			if len(value) < 2 || value[0] != '\'' || value[len(value)-1] != '\'' {
+				return nil, fmt.Errorf("the value of option %s must be a string literal", name)
+			}
+			credentials[name] = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+			continue
+		}
+		if name == "FORMAT" {
+			hasFormat = true
+		}
+		e.Options = append(e.Options, option)
+	}
+	if !hasFormat {
+		e.Options = append([]string{"FORMAT parquet"}, e.Options...)
+	}
+
+	if len(credentials) > 0 {
+		for name := range exportCredentialOptions {
+			if credentials[name] == "" {
+				return nil, fmt.Errorf("missing required export configuration: %s", name)
+			}
+		}
+		config, remotePath, err := storage.ConstructStorageConfig(uri,
+			credentials["ENDPOINT"], credentials["ACCESS_KEY_ID"], credentials["SECRET_ACCESS_KEY"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to construct storage configuration for export: %w", err)
+		}
+		e.Storage, e.URL = config, config.DuckDBURL(remotePath)
+	} else if strings.HasPrefix(strings.ToLower(uri), "s3c://") {
+		return nil, fmt.Errorf("the credentials of the S3-compatible storage are required: ENDPOINT, ACCESS_KEY_ID, SECRET_ACCESS_KEY")
+	}
+	return e, nil
+}
+
+// splitExportOptions splits the options at the commas outside of the parentheses and the quotes.
+func splitExportOptions(options string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(options); i++ {
+		c := options[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, options[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, options[start:])
+
+	var trimmed []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			trimmed = append(trimmed, part)
+		}
+	}
+	return trimmed
+}
+
+// CopyStmt returns the COPY statement of DuckDB that writes the export.
+func (e *Export) CopyStmt() string {
+	return fmt.Sprintf("COPY %s TO '%s' (%s)", e.Source, strings.ReplaceAll(e.URL, "'", "''"), strings.Join(e.Options, ", "))
+}
+
+var (
+	// exportSecretMu serializes the exports with credentials, whose secrets may have the same scope.
+	exportSecretMu  sync.Mutex
+	exportSecretSeq atomic.Uint64
+)
+
+// ExecExport executes an export to the object storage, and returns the number of the exported rows.
+// It returns false if the query is not an export.
+func ExecExport(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb, query string) (rows int64, ok bool, err error) {
+	e, err := ParseExport(query)
+	if e == nil || err != nil {
+		return 0, err != nil, err
+	}
+	if err := checkGlobalPrivilege(ctx, mysqlDb, sql.PrivilegeType_File); err != nil {
+		return 0, true, err
+	}
+	if err := checkExportMasking(ctx, e.Source); err != nil {
+		return 0, true, err
+	}
+
+	if e.Storage != nil {
+		exportSecretMu.Lock()
+		defer exportSecretMu.Unlock()
+		secret := fmt.Sprintf("__myduck_export_%d", exportSecretSeq.Add(1))
+		if _, err := adapter.Exec(ctx, e.Storage.DuckDBSecretStmt(secret, e.URL)); err != nil {
+			return 0, true, fmt.Errorf("failed to create the secret of the storage: %w", err)
+		}
+		defer func() {
+			if _, err := adapter.Exec(ctx, "DROP TEMPORARY SECRET IF EXISTS "+secret); err != nil {
+				ctx.GetLogger().WithError(err).Warn("Failed to drop the secret of the export")
+			}
+		}()
+	}
+
+	res, err := adapter.Exec(ctx, e.CopyStmt())
+	if err != nil {
+		return 0, true, err
+	}
+	rows, err = res.RowsAffected()
+	return rows, true, err
+}
+
+// checkExportMasking returns an error if the source of an export reads a masked table
+// for a user that is not granted UNMASK.
+func checkExportMasking(ctx *sql.Context, source string) error {
+	masking, err := catalog.SessionMasking(ctx)
+	if err != nil || masking == nil {
+		return err
+	}
+	lower := strings.ToLower(source)
+	for _, table := range masking.MaskedTables() {
+		if regexp.MustCompile(`\b` + regexp.QuoteMeta(table[1]) + `\b`).MatchString(lower) {
+			return fmt.Errorf("permission denied to export the masked table %s", table[1])
+		}
+	}
+	return nil
+}
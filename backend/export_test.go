@@ -0,0 +1,50 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExport(t *testing.T) {
+	e, err := ParseExport("COPY t TO 's3://bucket/path/' (FORMAT parquet, PARTITION_BY (a, b), COMPRESSION zstd);")
+	require.NoError(t, err)
+	require.Equal(t, "t", e.Source)
+	require.Equal(t, "s3://bucket/path/", e.URL)
+	require.Equal(t, []string{"FORMAT parquet", "PARTITION_BY (a, b)", "COMPRESSION zstd"}, e.Options)
+	require.Nil(t, e.Storage)
+	require.Equal(t, "COPY t TO 's3://bucket/path/' (FORMAT parquet, PARTITION_BY (a, b), COMPRESSION zstd)", e.CopyStmt())
+
+	// The format defaults to parquet.
+	e, err = ParseExport("copy (SELECT a, 'x,y' FROM t WHERE b > 1) to 's3://bucket/q/' WITH (PARTITION_BY (a), OVERWRITE_OR_IGNORE)")
+	require.NoError(t, err)
+	require.Equal(t, "(SELECT a, 'x,y' FROM t WHERE b > 1)", e.Source)
+	require.Equal(t, []string{"FORMAT parquet", "PARTITION_BY (a)", "OVERWRITE_OR_IGNORE"}, e.Options)
+
+	e, err = ParseExport("COPY s.t TO 's3c://bucket/path/' (FORMAT parquet, ENDPOINT = 'minio:9000', ACCESS_KEY_ID 'key', SECRET_ACCESS_KEY 'it''s')")
+	require.NoError(t, err)
+	require.Equal(t, "s3://bucket/path/", e.URL)
+	require.Equal(t, []string{"FORMAT parquet"}, e.Options)
+	require.NotNil(t, e.Storage)
+	require.Equal(t, "it's", e.Storage.SecretAccessKey)
+	require.Equal(t, "CREATE OR REPLACE TEMPORARY SECRET s1 (TYPE s3, KEY_ID 'key', SECRET 'it''s', REGION 'my-duck-server', "+
+		"SCOPE 's3://bucket/path/', ENDPOINT 'minio:9000', URL_STYLE 'path', USE_SSL false)", e.Storage.DuckDBSecretStmt("s1", e.URL))
+
+	_, err = ParseExport("COPY t TO 's3://bucket/path/' (ENDPOINT 's3.us-east-1.amazonaws.com')")
+	require.ErrorContains(t, err, "missing required export configuration")
+	_, err = ParseExport("COPY t TO 's3c://bucket/path/'")
+	require.Error(t, err)
+	_, err = ParseExport("COPY t TO 's3://bucket/path/' (ACCESS_KEY_ID key)")
+	require.Error(t, err)
+
+	for _, query := range []string{
+		"COPY t TO STDOUT",
+		"COPY t TO '/tmp/t.parquet' (FORMAT parquet)",
+		"COPY t FROM 's3://bucket/t.parquet'",
+	} {
+		e, err := ParseExport(query)
+		require.NoError(t, err, query)
+		require.Nil(t, e, query)
+		require.False(t, IsExportStatement(query), query)
+	}
+}
@@ -0,0 +1,553 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/apecloud/myduckserver/transpiler"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/mysql_db"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	"github.com/dolthub/go-mysql-server/sql/transform"
+	"github.com/dolthub/go-mysql-server/sql/types"
+)
+
+// The full-text search of MySQL is built on the full-text indexes of the Postgres protocol, see pgserver/fts.go,
+// which are shared by both protocols:
+//
+//	CREATE FULLTEXT INDEX name ON t (col [, ...])
+//	ALTER TABLE t ADD FULLTEXT [INDEX | KEY] [name] (col [, ...])
+//	DROP INDEX name ON t
+//	ALTER TABLE t DROP {INDEX | KEY} name
+//	MATCH (col [, ...]) AGAINST ('query' [search_modifier])
+//
+// The documents are identified by the primary key of the table, which must consist of a single column, and the words
+// are not stemmed, as in MySQL. A table has at most one full-text index.
+//
+// MATCH ... AGAINST is rewritten into myduck_fts_match before the query is parsed, which is the BM25 score of a row,
+// or 0 if it does not match, so it is both a predicate and a relevance. The index of a match is the one over exactly
+// the columns of the match, or over more columns, in which case only the given columns are searched. A document
+// matches if it contains any term of the query, and in BOOLEAN MODE, it contains all the terms if all of them are
+// required by `+`. The excluded terms (`-`) are dropped and the other operators are ignored, as is QUERY EXPANSION.
+//
+// A query run in DuckDB calls the match_bm25 macro of the index directly, see expandFTSMatches,
+// while a query run in the engine evaluates the macro row by row, which is much slower.
+
+var (
+	ftsCreateIndexRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+FULLTEXT\s+(?:INDEX|KEY)\s+(` + maskingIdentifier + `)\s+ON\s+(` +
+		ftsQualifiedIdentifier + `)\s*\(([^()]*)\)(?:\s*WITH\s+PARSER\s+\w+)?[\s;]*$`)
+	ftsAddIndexRegex = regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(` + ftsQualifiedIdentifier + `)\s+ADD\s+FULLTEXT(?:\s+(?:INDEX|KEY))?(?:\s+(` +
+		maskingIdentifier + `))?\s*\(([^()]*)\)(?:\s*WITH\s+PARSER\s+\w+)?[\s;]*$`)
+	ftsDropIndexRegex = regexp.MustCompile(`(?is)^\s*DROP\s+INDEX\s+(` + maskingIdentifier + `)\s+ON\s+(` + ftsQualifiedIdentifier + `)[\s;]*$`)
+	// ftsAlterDropIndexRegex matches `ALTER TABLE t DROP INDEX name`, where the table comes first.
+	ftsAlterDropIndexRegex = regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(` + ftsQualifiedIdentifier + `)\s+DROP\s+(?:INDEX|KEY)\s+(` +
+		maskingIdentifier + `)[\s;]*$`)
+
+	// matchAgainstRegex matches `MATCH (col [, ...]) AGAINST ('query' [search_modifier])`.
+	matchAgainstRegex = regexp.MustCompile(`(?is)\bMATCH\s*\(\s*(` + ftsQualifiedIdentifier + `(?:\s*,\s*` + ftsQualifiedIdentifier +
+		`)*)\s*\)\s*AGAINST\s*\(\s*('(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*")\s*(IN\s+NATURAL\s+LANGUAGE\s+MODE(?:\s+WITH\s+QUERY\s+EXPANSION)?` +
+		`|IN\s+BOOLEAN\s+MODE|WITH\s+QUERY\s+EXPANSION)?\s*\)`)
+	// ftsMatchCallRegex matches the calls of myduck_fts_match in a query translated to DuckDB.
+	ftsMatchCallRegex = regexp.MustCompile(`(?i)\bmyduck_fts_match\s*\(\s*('(?:[^']|'')*')\s*,\s*('(?:[^']|'')*')\s*,\s*(` +
+		ftsDuckIdentifier + `(?:\s*\.\s*` + ftsDuckIdentifier + `)*)\s*,\s*('(?:[^']|'')*')\s*,\s*('(?:[^']|'')*')\s*,\s*(1|0|TRUE|FALSE)\s*\)`)
+
+	// ftsTermSeparatorRegex matches the characters between the terms of a query, which the fts extension ignores.
+	ftsTermSeparatorRegex = regexp.MustCompile(`[^\p{L}\p{N}_]+`)
+)
+
+const (
+	ftsQualifiedIdentifier = maskingIdentifier + `(?:\s*\.\s*` + maskingIdentifier + `){0,2}`
+	ftsDuckIdentifier      = `(?:[A-Za-z_][\w$]*|"(?:[^"]|"")+")`
+)
+
+// IsFullTextIndexStatement reports whether the query may be a statement that creates or drops a full-text index.
+// The ones that drop other indexes are left to the engine, see ExecFullTextIndexStatement.
+func IsFullTextIndexStatement(query string) bool {
+	return ftsCreateIndexRegex.MatchString(query) || ftsAddIndexRegex.MatchString(query) ||
+		ftsDropIndexRegex.MatchString(query) || ftsAlterDropIndexRegex.MatchString(query)
+}
+
+// ExecFullTextIndexStatement creates or drops a full-text index. It returns false if the query is not such a
+// statement, e.g., if it drops an index that is not a full-text one.
+func ExecFullTextIndexStatement(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb, query string) (ok bool, err error) {
+	var tableName, indexName, columns string
+	create := true
+	if m := ftsCreateIndexRegex.FindStringSubmatch(query); m != nil {
+		indexName, tableName, columns = m[1], m[2], m[3]
+	} else if m := ftsAddIndexRegex.FindStringSubmatch(query); m != nil {
+		tableName, indexName, columns = m[1], m[2], m[3]
+	} else if m := ftsDropIndexRegex.FindStringSubmatch(query); m != nil {
+		indexName, tableName, create = m[1], m[2], false
+	} else if m := ftsAlterDropIndexRegex.FindStringSubmatch(query); m != nil {
+		tableName, indexName, create = m[1], m[2], false
+	} else {
+		return false, nil
+	}
+
+	schema, name := ctx.GetCurrentDatabase(), unquoteMaskingIdentifier(tableName)
+	if qualifier, n, ok := splitQualifiedIdentifier(tableName); ok {
+		schema, name = unquoteMaskingIdentifier(qualifier), unquoteMaskingIdentifier(n)
+	}
+	table, err := lookupTable(ctx, ctx.Session.(*Session).Provider(), schema, name)
+	if err != nil {
+		return true, err
+	}
+	if table == nil {
+		if !create {
+			// The engine reports the missing table.
+			return false, nil
+		}
+		return true, sql.ErrTableNotFound.New(name)
+	}
+	indexName = unquoteMaskingIdentifier(indexName)
+
+	existing, err := catalog.LookupFTSIndexOfTable(ctx, schema, table.Name())
+	if err != nil {
+		return true, err
+	}
+	if !create {
+		if existing == nil || !strings.EqualFold(existing.Name, indexName) {
+			return false, nil
+		}
+		if err := checkTablePrivilege(ctx, mysqlDb, schema, table.Name(), sql.PrivilegeType_Index); err != nil {
+			return true, err
+		}
+		return true, catalog.DropFTSIndex(ctx, existing)
+	}
+
+	if err := checkTablePrivilege(ctx, mysqlDb, schema, table.Name(), sql.PrivilegeType_Index); err != nil {
+		return true, err
+	}
+	index, err := newFTSIndex(schema, table.Name(), indexName, table.Schema(), columns)
+	if err != nil {
+		return true, err
+	}
+	if existing != nil && strings.EqualFold(existing.Name, index.Name) {
+		return true, sql.ErrDuplicateKey.New(existing.Name)
+	} else if existing != nil {
+		return true, fmt.Errorf("table `%s` already has the FULLTEXT index `%s`", table.Name(), existing.Name)
+	}
+	return true, catalog.CreateFTSIndex(ctx, index)
+}
+
+// newFTSIndex returns the full-text index of a table over the comma-separated columns.
+func newFTSIndex(schema, table, name string, tableSchema sql.Schema, columns string) (*catalog.FTSIndex, error) {
+	index := &catalog.FTSIndex{Schema: schema, Table: table, Name: name, Stemmer: "none"}
+	for _, col := range tableSchema {
+		if !col.PrimaryKey {
+			continue
+		}
+		if index.Key != "" {
+			index.Key = ""
+			break
+		}
+		index.Key = col.Name
+	}
+	if index.Key == "" {
+		return nil, fmt.Errorf("a FULLTEXT index requires a single-column primary key on table `%s`", table)
+	}
+	for _, column := range strings.Split(columns, ",") {
+		column = unquoteMaskingIdentifier(column)
+		idx := tableSchema.IndexOfColName(column)
+		if idx < 0 {
+			return nil, sql.ErrKeyColumnDoesNotExist.New(column)
+		}
+		if !types.IsText(tableSchema[idx].Type) {
+			return nil, fmt.Errorf("column `%s` cannot be part of a FULLTEXT index", column)
+		}
+		if !slices.Contains(index.Columns, tableSchema[idx].Name) {
+			index.Columns = append(index.Columns, tableSchema[idx].Name)
+		}
+	}
+	if index.Name == "" {
+		// The default name of MySQL, which is the first column of the index.
+		index.Name = index.Columns[0]
+	}
+	return index, nil
+}
+
+// RewriteFullTextMatch rewrites MATCH ... AGAINST in the query into myduck_fts_match,
+// and rebuilds the stale indexes searched by the query.
+func RewriteFullTextMatch(ctx *sql.Context, query string) (string, error) {
+	if !matchAgainstRegex.MatchString(query) {
+		return query, nil
+	}
+	indexes, err := catalog.LoadFTSIndexes(ctx)
+	if err != nil {
+		return "", err
+	}
+	query, used, err := rewriteFullTextMatch(query, indexes, ctx.GetCurrentDatabase())
+	if err != nil {
+		return "", err
+	}
+	return query, catalog.RefreshFTSIndexes(ctx, used)
+}
+
+// rewriteFullTextMatch rewrites MATCH ... AGAINST in the query with the given full-text indexes,
+// and returns the indexes searched by the query.
+func rewriteFullTextMatch(query string, indexes []catalog.FTSIndex, currentSchema string) (string, []*catalog.FTSIndex, error) {
+	var rewriteErr error
+	var used []*catalog.FTSIndex
+	query = matchAgainstRegex.ReplaceAllStringFunc(query, func(s string) string {
+		m := matchAgainstRegex.FindStringSubmatch(s)
+		var qualifier string
+		var columns []string
+		for _, ref := range strings.Split(m[1], ",") {
+			ref = strings.TrimSpace(ref)
+			if q, name, ok := splitLastIdentifier(ref); ok {
+				qualifier, ref = q, name
+			}
+			columns = append(columns, unquoteMaskingIdentifier(ref))
+		}
+		index, err := resolveFullTextIndex(query, qualifier, columns, indexes, currentSchema)
+		if err != nil {
+			if rewriteErr == nil {
+				rewriteErr = err
+			}
+			return s
+		}
+		if !slices.Contains(used, index) {
+			used = append(used, index)
+		}
+
+		var fields []string
+		if len(columns) < len(index.Columns) {
+			for _, column := range index.Columns {
+				if containsFold(columns, column) {
+					fields = append(fields, column)
+				}
+			}
+		}
+		terms, conjunctive := ftsQueryTerms(unquoteMySQLString(m[2]), strings.HasPrefix(strings.ToUpper(m[3]), "IN BOOLEAN"))
+		keyRef := quoteMySQLIdentifier(index.Key)
+		if qualifier != "" {
+			keyRef = qualifier + "." + keyRef
+		}
+		conj := "0"
+		if conjunctive {
+			conj = "1"
+		}
+		return "myduck_fts_match(" + quoteMySQLString(index.Schema) + ", " + quoteMySQLString(index.Table) + ", " + keyRef + ", " +
+			quoteMySQLString(strings.Join(terms, " ")) + ", " + quoteMySQLString(strings.Join(fields, ",")) + ", " + conj + ")"
+	})
+	if rewriteErr != nil {
+		return "", nil, rewriteErr
+	}
+	return query, used, nil
+}
+
+// resolveFullTextIndex returns the full-text index over the columns of a match. If several indexes are,
+// the one of the table named by the qualifier or the query is preferred, and then the one in the current schema.
+func resolveFullTextIndex(query, qualifier string, columns []string, indexes []catalog.FTSIndex, currentSchema string) (*catalog.FTSIndex, error) {
+	var candidates []*catalog.FTSIndex
+	for i, index := range indexes {
+		covered := true
+		for _, column := range columns {
+			if !containsFold(index.Columns, column) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			candidates = append(candidates, &indexes[i])
+		}
+	}
+	prefer := func(pred func(*catalog.FTSIndex) bool) {
+		var preferred []*catalog.FTSIndex
+		for _, index := range candidates {
+			if pred(index) {
+				preferred = append(preferred, index)
+			}
+		}
+		if len(preferred) > 0 {
+			candidates = preferred
+		}
+	}
+	// An index over exactly the columns is preferred, as MySQL requires.
+	prefer(func(index *catalog.FTSIndex) bool { return len(index.Columns) == len(columns) })
+	if qualifier != "" {
+		table := qualifier
+		if _, name, ok := splitLastIdentifier(qualifier); ok {
+			table = name
+		}
+		table = unquoteMaskingIdentifier(table)
+		prefer(func(index *catalog.FTSIndex) bool { return strings.EqualFold(index.Table, table) })
+	}
+	if len(candidates) > 1 {
+		prefer(func(index *catalog.FTSIndex) bool {
+			return regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(index.Table) + `\b`).MatchString(query)
+		})
+	}
+	if len(candidates) > 1 {
+		prefer(func(index *catalog.FTSIndex) bool { return strings.EqualFold(index.Schema, currentSchema) })
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, sql.ErrNoFullTextIndexFound.New(strings.Join(columns, ", "))
+	case 1:
+		return candidates[0], nil
+	default:
+		return nil, fmt.Errorf("full-text search over the columns %s is ambiguous", strings.Join(columns, ", "))
+	}
+}
+
+// ftsQueryTerms returns the terms of the query of a match, and whether all of them are required.
+func ftsQueryTerms(query string, booleanMode bool) (terms []string, conjunctive bool) {
+	if !booleanMode {
+		return strings.Fields(ftsTermSeparatorRegex.ReplaceAllString(query, " ")), false
+	}
+	conjunctive = true
+	for _, word := range strings.Fields(query) {
+		word = strings.TrimLeft(word, `(<>~"`)
+		required := strings.HasPrefix(word, "+")
+		if strings.HasPrefix(word, "-") {
+			continue
+		}
+		words := strings.Fields(ftsTermSeparatorRegex.ReplaceAllString(word, " "))
+		if len(words) == 0 {
+			continue
+		}
+		terms = append(terms, words...)
+		conjunctive = conjunctive && required
+	}
+	return terms, conjunctive && len(terms) > 0
+}
+
+// markFTSIndexesStale marks the full-text indexes of the tables written by a statement stale,
+// in the transaction of the statement. See catalog.RefreshFTSIndexes.
+func markFTSIndexesStale(ctx *sql.Context, root sql.Node) error {
+	if root.IsReadOnly() {
+		return nil
+	}
+	var targets []sql.Node
+	transform.Inspect(root, func(n sql.Node) bool {
+		switch n := n.(type) {
+		case *plan.InsertInto:
+			targets = append(targets, n.Destination)
+		case *plan.Update:
+			targets = append(targets, n.Child)
+		case *plan.DeleteFrom:
+			if n.HasExplicitTargets() {
+				targets = append(targets, n.GetDeleteTargets()...)
+			} else {
+				targets = append(targets, n.Child)
+			}
+		case *plan.Truncate:
+			targets = append(targets, n.Child)
+		default:
+			return true
+		}
+		return false
+	})
+	for _, target := range targets {
+		var err error
+		transform.Inspect(target, func(n sql.Node) bool {
+			if table, ok := n.(*plan.ResolvedTable); ok && table.Database() != nil && err == nil {
+				err = catalog.MarkFTSIndexStale(ctx, table.Database().Name(), table.Name())
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandFTSMatches replaces the calls of myduck_fts_match in a query translated to DuckDB with the BM25 matches of
+// the fts extension, see catalog.FTSMatchExpr.
+func expandFTSMatches(duckSQL string) string {
+	if !strings.Contains(strings.ToLower(duckSQL), "myduck_fts_match") {
+		return duckSQL
+	}
+	return ftsMatchCallRegex.ReplaceAllStringFunc(duckSQL, func(s string) string {
+		m := ftsMatchCallRegex.FindStringSubmatch(s)
+		var fields []string
+		if f := unquoteMaskingIdentifier(m[5]); f != "" {
+			fields = strings.Split(f, ",")
+		}
+		conjunctive := m[6] == "1" || strings.EqualFold(m[6], "TRUE")
+		match := catalog.FTSMatchExpr(unquoteMaskingIdentifier(m[1]), unquoteMaskingIdentifier(m[2]), m[3], m[4], fields, conjunctive)
+		return "coalesce(" + match + ", 0)"
+	})
+}
+
+// translateToDuckDB translates a MySQL query to DuckDB, including the full-text matches and the vector functions.
+func translateToDuckDB(query string) (string, error) {
+	duckSQL, err := transpiler.TranslateWithSQLGlot(query)
+	if err != nil {
+		return "", err
+	}
+	return expandVectorFunctions(expandFTSMatches(duckSQL)), nil
+}
+
+// splitLastIdentifier splits `qualifier.name` at the last dot outside of the quotes.
+func splitLastIdentifier(s string) (qualifier, name string, ok bool) {
+	var quote rune
+	last := -1
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case c == '.':
+			last = i
+		}
+	}
+	if last < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(s[:last]), strings.TrimSpace(s[last+1:]), true
+}
+
+// unquoteMySQLString returns the value of a MySQL string literal, which may contain backslash escapes.
+func unquoteMySQLString(s string) string {
+	q := s[0]
+	s = strings.ReplaceAll(s[1:len(s)-1], string([]byte{q, q}), string(q))
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func quoteMySQLString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(s) + "'"
+}
+
+func quoteMySQLIdentifier(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// FullTextFunctions are the functions of the full-text search on the MySQL protocol.
+var FullTextFunctions = []sql.Function{
+	sql.FunctionN{Name: "myduck_fts_match", Fn: NewFTSMatch},
+}
+
+// FTSMatch is myduck_fts_match(schema, table, key, query, fields, conjunctive), which MATCH ... AGAINST is rewritten
+// into. It is the BM25 score of the document with the given key, or 0 if the document does not match.
+type FTSMatch struct {
+	args []sql.Expression
+}
+
+var _ sql.FunctionExpression = (*FTSMatch)(nil)
+var _ sql.CollationCoercible = (*FTSMatch)(nil)
+
+func NewFTSMatch(args ...sql.Expression) (sql.Expression, error) {
+	if len(args) != 6 {
+		return nil, sql.ErrInvalidArgumentNumber.New("myduck_fts_match", 6, len(args))
+	}
+	return &FTSMatch{args: args}, nil
+}
+
+// FunctionName implements sql.FunctionExpression
+func (f *FTSMatch) FunctionName() string {
+	return "myduck_fts_match"
+}
+
+// Description implements sql.FunctionExpression
+func (f *FTSMatch) Description() string {
+	return "returns the BM25 score of a document of a full-text index, or 0 if it does not match."
+}
+
+// Resolved implements the Expression interface.
+func (f *FTSMatch) Resolved() bool {
+	for _, arg := range f.args {
+		if !arg.Resolved() {
+			return false
+		}
+	}
+	return true
+}
+
+// IsNullable implements the Expression interface.
+func (f *FTSMatch) IsNullable() bool {
+	return false
+}
+
+// Children implements the Expression interface.
+func (f *FTSMatch) Children() []sql.Expression {
+	return f.args
+}
+
+// Eval implements the Expression interface. It runs the match of the document in DuckDB.
+func (f *FTSMatch) Eval(ctx *sql.Context, row sql.Row) (interface{}, error) {
+	values := make([]any, len(f.args))
+	for i, arg := range f.args {
+		v, err := arg.Eval(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	if values[2] == nil {
+		return float64(0), nil
+	}
+	var strs [4]string
+	for i, idx := range []int{0, 1, 3, 4} {
+		s, _, err := types.LongText.Convert(values[idx])
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			strs[i] = s.(string)
+		}
+	}
+	conjunctive, err := sql.ConvertToBool(ctx, values[5])
+	if err != nil {
+		return nil, err
+	}
+	var fields []string
+	if strs[3] != "" {
+		fields = strings.Split(strs[3], ",")
+	}
+	var score float64
+	err = adapter.QueryRowCatalog(ctx,
+		"SELECT coalesce("+catalog.FTSMatchExpr(strs[0], strs[1], "?", "?", fields, conjunctive)+", 0)",
+		values[2], strs[2],
+	).Scan(&score)
+	return score, err
+}
+
+func (f *FTSMatch) String() string {
+	args := make([]string, len(f.args))
+	for i, arg := range f.args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", f.FunctionName(), strings.Join(args, ", "))
+}
+
+// WithChildren implements the Expression interface.
+func (f *FTSMatch) WithChildren(children ...sql.Expression) (sql.Expression, error) {
+	return NewFTSMatch(children...)
+}
+
+// Type implements the Expression interface.
+func (f *FTSMatch) Type() sql.Type {
+	return types.Float64
+}
+
+// CollationCoercibility implements the interface sql.CollationCoercible.
+func (*FTSMatch) CollationCoercibility(ctx *sql.Context) (collation sql.CollationID, coercibility byte) {
+	return sql.Collation_binary, 5
+}
@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsFullTextIndexStatement(t *testing.T) {
+	for query, want := range map[string]bool{
+		"CREATE FULLTEXT INDEX ft ON docs (title, body)":          true,
+		"create fulltext key `ft` on db.docs(`body`);":            true,
+		"ALTER TABLE docs ADD FULLTEXT (body)":                    true,
+		"ALTER TABLE docs ADD FULLTEXT INDEX ft (title, body)":    true,
+		"DROP INDEX ft ON docs":                                   true,
+		"ALTER TABLE db.docs DROP KEY ft":                         true,
+		"CREATE INDEX idx ON docs (title)":                        false,
+		"ALTER TABLE docs ADD INDEX idx (title)":                  false,
+		"SELECT * FROM docs WHERE MATCH (body) AGAINST ('index')": false,
+	} {
+		require.Equal(t, want, IsFullTextIndexStatement(query), query)
+	}
+}
+
+func TestNewFTSIndex(t *testing.T) {
+	schema := sql.Schema{
+		{Name: "id", Type: types.Int64, PrimaryKey: true},
+		{Name: "title", Type: types.Text},
+		{Name: "body", Type: types.LongText},
+		{Name: "views", Type: types.Int64},
+	}
+	index, err := newFTSIndex("db", "docs", "", schema, " `Body` , title")
+	require.NoError(t, err)
+	require.Equal(t, &catalog.FTSIndex{Schema: "db", Table: "docs", Name: "body", Key: "id", Columns: []string{"body", "title"}, Stemmer: "none"}, index)
+
+	_, err = newFTSIndex("db", "docs", "ft", schema, "views")
+	require.Error(t, err)
+	_, err = newFTSIndex("db", "docs", "ft", schema, "summary")
+	require.Error(t, err)
+	_, err = newFTSIndex("db", "docs", "ft", sql.Schema{{Name: "body", Type: types.Text}}, "body")
+	require.Error(t, err)
+}
+
+func TestFTSQueryTerms(t *testing.T) {
+	for _, tt := range []struct {
+		query       string
+		boolean     bool
+		terms       []string
+		conjunctive bool
+	}{
+		{"cats and dogs", false, []string{"cats", "and", "dogs"}, false},
+		{"+cats +dogs", false, []string{"cats", "dogs"}, false},
+		{"+cats +dogs", true, []string{"cats", "dogs"}, true},
+		{"+cats dogs", true, []string{"cats", "dogs"}, false},
+		{`+cats -dogs +"big birds" ~mice*`, true, []string{"cats", "big", "birds", "mice"}, false},
+		{"+(cats) +>dogs", true, []string{"cats", "dogs"}, true},
+		{"-dogs", true, nil, false},
+	} {
+		terms, conjunctive := ftsQueryTerms(tt.query, tt.boolean)
+		require.Equal(t, tt.terms, terms, tt.query)
+		require.Equal(t, tt.conjunctive, conjunctive, tt.query)
+	}
+}
+
+func TestRewriteFullTextMatch(t *testing.T) {
+	indexes := []catalog.FTSIndex{
+		{Schema: "db", Table: "docs", Name: "ft", Key: "id", Columns: []string{"title", "body"}},
+		{Schema: "db", Table: "notes", Name: "body", Key: "note_id", Columns: []string{"body"}},
+	}
+	for _, tt := range []struct {
+		query    string
+		expected string
+		err      bool
+	}{
+		{
+			"SELECT id FROM docs WHERE MATCH (title, body) AGAINST ('cat''s dog')",
+			"SELECT id FROM docs WHERE myduck_fts_match('db', 'docs', `id`, 'cat s dog', '', 0)",
+			false,
+		},
+		{
+			"SELECT d.id, MATCH (d.title) AGAINST ('+cat +dog' IN BOOLEAN MODE) AS score FROM docs d ORDER BY score DESC",
+			"SELECT d.id, myduck_fts_match('db', 'docs', d.`id`, 'cat dog', 'title', 1) AS score FROM docs d ORDER BY score DESC",
+			false,
+		},
+		{
+			// The index over exactly the columns is preferred.
+			"SELECT * FROM notes WHERE MATCH (`body`) AGAINST (\"birds\" IN NATURAL LANGUAGE MODE)",
+			"SELECT * FROM notes WHERE myduck_fts_match('db', 'notes', `note_id`, 'birds', '', 0)",
+			false,
+		},
+		{
+			"SELECT * FROM docs WHERE MATCH (summary) AGAINST ('cat')",
+			"",
+			true,
+		},
+		{
+			"SELECT 'MATCH' FROM docs",
+			"SELECT 'MATCH' FROM docs",
+			false,
+		},
+	} {
+		t.Run(tt.query, func(t *testing.T) {
+			rewritten, _, err := rewriteFullTextMatch(tt.query, indexes, "db")
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, rewritten)
+		})
+	}
+
+	// The indexes searched by a query are refreshed before it runs, once each.
+	_, used, err := rewriteFullTextMatch(
+		"SELECT MATCH (title, body) AGAINST ('cat') FROM docs WHERE MATCH (title, body) AGAINST ('cat')",
+		indexes, "db",
+	)
+	require.NoError(t, err)
+	require.Len(t, used, 1)
+	require.Same(t, &indexes[0], used[0])
+}
+
+func TestExpandFTSMatches(t *testing.T) {
+	for duckSQL, expected := range map[string]string{
+		`SELECT id FROM docs WHERE MYDUCK_FTS_MATCH('db', 'docs', "id", 'cat dog', '', 0)`:                         `SELECT id FROM docs WHERE coalesce("fts_db_docs".match_bm25("id", 'cat dog'), 0)`,
+		`SELECT d.id, myduck_fts_match('db', 'docs', d."id", 'it''s', 'title,body', TRUE) AS score FROM docs AS d`: `SELECT d.id, coalesce("fts_db_docs".match_bm25(d."id", 'it''s', fields := 'title,body', conjunctive := 1), 0) AS score FROM docs AS d`,
+		`SELECT 1`: `SELECT 1`,
+	} {
+		require.Equal(t, expected, expandFTSMatches(duckSQL))
+	}
+}
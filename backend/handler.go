@@ -17,9 +17,13 @@ package backend
 import (
 	"context"
 	"fmt"
+	"net"
+	"sync"
+
 	"github.com/apecloud/myduckserver/catalog"
 
 	"github.com/dolthub/go-mysql-server/server"
+	"github.com/dolthub/go-mysql-server/sql/mysql_db"
 	"github.com/dolthub/vitess/go/mysql"
 	"github.com/dolthub/vitess/go/sqltypes"
 )
@@ -27,19 +31,89 @@ import (
 type MyHandler struct {
 	*server.Handler
 	provider *catalog.DatabaseProvider
+	mysqlDb  *mysql_db.MySQLDb
+	// conns are the open connections by their IDs, whose users may be changed by ChangeUser.
+	conns sync.Map
+}
+
+func (h *MyHandler) NewConnection(c *mysql.Conn) {
+	h.conns.Store(c.ConnectionID, c)
+	h.Handler.NewConnection(c)
 }
 
 func (h *MyHandler) ConnectionClosed(c *mysql.Conn) {
+	h.conns.Delete(c.ConnectionID)
 	h.provider.Pool().CloseConn(c.ConnectionID)
+	h.provider.Pool().UnrestrictTenants(c.ConnectionID)
 	h.Handler.ConnectionClosed(c)
 }
 
-func (h *MyHandler) ComInitDB(c *mysql.Conn, schemaName string) error {
-	_, err := h.provider.Pool().GetConnForSchema(context.Background(), c.ConnectionID, schemaName)
+// ComResetConnection resets the session of the connection for reuse, e.g., by a connection pool or a proxy.
+// The DuckDB connection of the session is closed first, so that its open transaction is rolled back,
+// and its temporary tables and settings are discarded.
+func (h *MyHandler) ComResetConnection(c *mysql.Conn) error {
+	pool := h.provider.Pool()
+	if err := pool.CloseConn(c.ConnectionID); err != nil {
+		return err
+	}
+	// The current database is resolved in the current catalog of the DuckDB connection when the session is restored.
+	if _, err := pool.GetConn(context.Background(), c.ConnectionID); err != nil {
+		return err
+	}
+	return h.Handler.ComResetConnection(c)
+}
+
+// ChangeUser handles COM_CHANGE_USER, see ChangeUserListener: it authenticates the user with the response
+// to the salt of mysql_native_password, and resets the session of the connection like ComResetConnection,
+// including its prepared statements, with the new user. The current database is switched to schema, if given.
+func (h *MyHandler) ChangeUser(connID uint32, user string, salt, authResponse []byte, schema string) error {
+	v, ok := h.conns.Load(connID)
+	if !ok {
+		return fmt.Errorf("connection %d is not found", connID)
+	}
+	c := v.(*mysql.Conn)
+	getter, err := h.mysqlDb.ValidateHash(salt, user, authResponse, c.RemoteAddr())
 	if err != nil {
 		return err
 	}
-	return h.Handler.ComInitDB(c, schemaName)
+	c.User, c.UserData = user, getter
+	c.PrepareData = make(map[uint32]*mysql.PrepareData)
+	if err := h.ComResetConnection(c); err != nil {
+		return err
+	}
+	if schema != "" {
+		return h.ComInitDB(c, schema)
+	}
+	return nil
+}
+
+// ChangeUserAuthMethod returns the authentication method that COM_CHANGE_USER asks the client to use for user.
+// Only mysql_native_password can be verified by ChangeUser, so the accounts that use the other plugins are refused.
+// The unknown users are asked for the password as well, and then rejected by ChangeUser, like MySQL.
+func (h *MyHandler) ChangeUserAuthMethod(connID uint32, user string) (string, error) {
+	v, ok := h.conns.Load(connID)
+	if !ok {
+		return "", fmt.Errorf("connection %d is not found", connID)
+	}
+	if !h.mysqlDb.Enabled() {
+		return nativePassword, nil
+	}
+	// The host is resolved like the authentication of the server does.
+	host, addr := "localhost", v.(*mysql.Conn).RemoteAddr()
+	if addr.Network() != "unix" {
+		var err error
+		if host, _, err = net.SplitHostPort(addr.String()); err != nil {
+			host = addr.String()
+		}
+	}
+	rd := h.mysqlDb.Reader()
+	defer rd.Close()
+	account := h.mysqlDb.GetUser(rd, user, host, false)
+	if account != nil && account.Plugin != "" && account.Plugin != nativePassword {
+		return "", mysql.NewSQLError(mysql.ERNotSupportedYet, mysql.SSClientError,
+			"COM_CHANGE_USER does not support the authentication plugin %s of user '%s'", account.Plugin, user)
+	}
+	return nativePassword, nil
 }
 
 func wrapResultCallback(callback mysql.ResultSpoolFn, modifiers ...ResultModifier) mysql.ResultSpoolFn {
@@ -59,6 +133,35 @@ func (h *MyHandler) ComMultiQuery(
 	query string,
 	callback mysql.ResultSpoolFn,
 ) (string, error) {
+	if IsMaskingStatement(query) {
+		return "", h.execMaskingStatement(ctx, c, query, callback)
+	}
+	if IsExportStatement(query) {
+		return "", h.execExport(ctx, c, query, callback)
+	}
+	if IsLakeSinkStatement(query) {
+		return "", h.execLakeSinkStatement(ctx, c, query, callback)
+	}
+	if IsStorageStatement(query) {
+		return "", h.execStorageStatement(ctx, c, query, callback)
+	}
+	if IsAdminPrivilegeStatement(query) {
+		return "", h.execAdminPrivilegeStatement(ctx, c, query, callback)
+	}
+	if IsFullTextIndexStatement(query) {
+		if ok, err := h.execFullTextIndexStatement(ctx, c, query, callback); ok || err != nil {
+			return "", err
+		}
+	}
+
+	query, err := rewriteSetNames(query)
+	if err != nil {
+		return "", err
+	}
+	if query, err = h.rewriteFullTextMatch(ctx, c, query); err != nil {
+		return "", err
+	}
+
 	var modifiers []ResultModifier
 	query, modifiers = applyRequestModifiers(query, defaultRequestModifiers)
 
@@ -73,13 +176,129 @@ func (h *MyHandler) ComQuery(
 	query string,
 	callback mysql.ResultSpoolFn,
 ) error {
+	if IsMaskingStatement(query) {
+		return h.execMaskingStatement(ctx, c, query, callback)
+	}
+	if IsExportStatement(query) {
+		return h.execExport(ctx, c, query, callback)
+	}
+	if IsLakeSinkStatement(query) {
+		return h.execLakeSinkStatement(ctx, c, query, callback)
+	}
+	if IsStorageStatement(query) {
+		return h.execStorageStatement(ctx, c, query, callback)
+	}
+	if IsAdminPrivilegeStatement(query) {
+		return h.execAdminPrivilegeStatement(ctx, c, query, callback)
+	}
+	if IsFullTextIndexStatement(query) {
+		if ok, err := h.execFullTextIndexStatement(ctx, c, query, callback); ok || err != nil {
+			return err
+		}
+	}
+
+	query, err := rewriteSetNames(query)
+	if err != nil {
+		return err
+	}
+	if query, err = h.rewriteFullTextMatch(ctx, c, query); err != nil {
+		return err
+	}
+
 	var modifiers []ResultModifier
 	query, modifiers = applyRequestModifiers(query, defaultRequestModifiers)
 
 	return h.Handler.ComQuery(ctx, c, query, wrapResultCallback(callback, modifiers...))
 }
 
-func WrapHandler(provider *catalog.DatabaseProvider) server.HandlerWrapper {
+// execMaskingStatement executes a statement that manages the masking policies, which the engine cannot parse.
+func (h *MyHandler) execMaskingStatement(ctx context.Context, c *mysql.Conn, query string, callback mysql.ResultSpoolFn) error {
+	sqlCtx, err := h.Handler.NewContext(ctx, c, query)
+	if err != nil {
+		return err
+	}
+	if _, _, err := ExecMaskingStatement(sqlCtx, h.mysqlDb, query); err != nil {
+		return err
+	}
+	return callback(&sqltypes.Result{}, false)
+}
+
+// execExport executes an export to the object storage, which the engine cannot parse.
+func (h *MyHandler) execExport(ctx context.Context, c *mysql.Conn, query string, callback mysql.ResultSpoolFn) error {
+	sqlCtx, err := h.Handler.NewContext(ctx, c, query)
+	if err != nil {
+		return err
+	}
+	rows, _, err := ExecExport(sqlCtx, h.mysqlDb, query)
+	if err != nil {
+		return err
+	}
+	return callback(&sqltypes.Result{RowsAffected: uint64(rows)}, false)
+}
+
+// execLakeSinkStatement executes a statement that manages the lake sinks, which the engine cannot parse.
+func (h *MyHandler) execLakeSinkStatement(ctx context.Context, c *mysql.Conn, query string, callback mysql.ResultSpoolFn) error {
+	sqlCtx, err := h.Handler.NewContext(ctx, c, query)
+	if err != nil {
+		return err
+	}
+	if _, _, err := ExecLakeSinkStatement(sqlCtx, h.mysqlDb, query); err != nil {
+		return err
+	}
+	return callback(&sqltypes.Result{}, false)
+}
+
+// execStorageStatement executes a statement that maintains the storage, which the engine cannot parse.
+func (h *MyHandler) execStorageStatement(ctx context.Context, c *mysql.Conn, query string, callback mysql.ResultSpoolFn) error {
+	sqlCtx, err := h.Handler.NewContext(ctx, c, query)
+	if err != nil {
+		return err
+	}
+	if _, _, err := ExecStorageStatement(sqlCtx, h.mysqlDb, query); err != nil {
+		return err
+	}
+	return callback(&sqltypes.Result{}, false)
+}
+
+// execAdminPrivilegeStatement grants or revokes the administrative privileges, which the engine cannot parse.
+func (h *MyHandler) execAdminPrivilegeStatement(ctx context.Context, c *mysql.Conn, query string, callback mysql.ResultSpoolFn) error {
+	sqlCtx, err := h.Handler.NewContext(ctx, c, query)
+	if err != nil {
+		return err
+	}
+	if _, _, err := ExecAdminPrivilegeStatement(sqlCtx, h.mysqlDb, query); err != nil {
+		return err
+	}
+	return callback(&sqltypes.Result{}, false)
+}
+
+// execFullTextIndexStatement creates or drops a full-text index, which the engine does not support.
+// It returns false if the query is left to the engine.
+func (h *MyHandler) execFullTextIndexStatement(ctx context.Context, c *mysql.Conn, query string, callback mysql.ResultSpoolFn) (bool, error) {
+	sqlCtx, err := h.Handler.NewContext(ctx, c, query)
+	if err != nil {
+		return false, err
+	}
+	if ok, err := ExecFullTextIndexStatement(sqlCtx, h.mysqlDb, query); !ok || err != nil {
+		return ok, err
+	}
+	return true, callback(&sqltypes.Result{}, false)
+}
+
+// rewriteFullTextMatch rewrites MATCH ... AGAINST in the query, which the engine cannot run without its own
+// full-text indexes, see RewriteFullTextMatch.
+func (h *MyHandler) rewriteFullTextMatch(ctx context.Context, c *mysql.Conn, query string) (string, error) {
+	if !matchAgainstRegex.MatchString(query) {
+		return query, nil
+	}
+	sqlCtx, err := h.Handler.NewContext(ctx, c, query)
+	if err != nil {
+		return "", err
+	}
+	return RewriteFullTextMatch(sqlCtx, query)
+}
+
+func WrapHandler(provider *catalog.DatabaseProvider, mysqlDb *mysql_db.MySQLDb) server.HandlerWrapper {
 	return func(h mysql.Handler) (mysql.Handler, error) {
 		handler, ok := h.(*server.Handler)
 		if !ok {
@@ -89,6 +308,7 @@ func WrapHandler(provider *catalog.DatabaseProvider) server.HandlerWrapper {
 		return &MyHandler{
 			Handler:  handler,
 			provider: provider,
+			mysqlDb:  mysqlDb,
 		}, nil
 	}
 }
@@ -0,0 +1,326 @@
+package backend
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	"github.com/dolthub/go-mysql-server/sql/transform"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/dolthub/go-mysql-server/sql/variables"
+	"github.com/marcboeker/go-duckdb"
+)
+
+// InsertAppenderThreshold is the system variable that sets the minimum number of rows of an
+// INSERT ... VALUES statement to be loaded through the DuckDB Appender instead of SQL.
+// mysqldump writes the data as INSERT statements of thousands of rows each,
+// which are much slower to parse, plan, and execute in DuckDB than to append directly.
+// 0 disables the appender.
+const InsertAppenderThreshold = "myduck_insert_appender_threshold"
+
+func init() {
+	if sql.SystemVariables == nil {
+		// unlikely this would happen since init() in gms package is executed first
+		variables.InitSystemVariables()
+	}
+	sql.SystemVariables.AddSystemVariables([]sql.SystemVariable{
+		&sql.MysqlSystemVariable{
+			Name:              InsertAppenderThreshold,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Both),
+			Dynamic:           true,
+			SetVarHintApplies: true,
+			Type:              types.NewSystemIntType(InsertAppenderThreshold, 0, 1<<31-1, false),
+			Default:           int64(1000),
+		},
+	})
+}
+
+// appendValueConverter converts a value of a MySQL column, as converted by the column type,
+// to the Go value that the DuckDB Appender accepts for the column type in DuckDB.
+type appendValueConverter func(v any) (driver.Value, bool)
+
+// appendValueConverters are the converters for the DuckDB column types that INSERT ... VALUES can append directly.
+var appendValueConverters = map[string]appendValueConverter{
+	"BOOLEAN":   appendBool,
+	"TINYINT":   appendInt(func(v int64) (driver.Value, bool) { return int8(v), v == int64(int8(v)) }),
+	"SMALLINT":  appendInt(func(v int64) (driver.Value, bool) { return int16(v), v == int64(int16(v)) }),
+	"INTEGER":   appendInt(func(v int64) (driver.Value, bool) { return int32(v), v == int64(int32(v)) }),
+	"BIGINT":    appendInt(func(v int64) (driver.Value, bool) { return v, true }),
+	"UTINYINT":  appendUint(func(v uint64) (driver.Value, bool) { return uint8(v), v == uint64(uint8(v)) }),
+	"USMALLINT": appendUint(func(v uint64) (driver.Value, bool) { return uint16(v), v == uint64(uint16(v)) }),
+	"UINTEGER":  appendUint(func(v uint64) (driver.Value, bool) { return uint32(v), v == uint64(uint32(v)) }),
+	"UBIGINT":   appendUint(func(v uint64) (driver.Value, bool) { return v, true }),
+	"FLOAT": func(v any) (driver.Value, bool) {
+		f, ok := v.(float32)
+		return f, ok
+	},
+	"DOUBLE": func(v any) (driver.Value, bool) {
+		f, ok := v.(float64)
+		return f, ok
+	},
+	"VARCHAR": func(v any) (driver.Value, bool) {
+		switch v := v.(type) {
+		case string:
+			return v, true
+		case []byte:
+			return string(v), true
+		}
+		return nil, false
+	},
+	"BLOB": func(v any) (driver.Value, bool) {
+		switch v := v.(type) {
+		case string:
+			return []byte(v), true
+		case []byte:
+			return v, true
+		}
+		return nil, false
+	},
+	"DATE":         appendTime,
+	"TIMESTAMP":    appendTime,
+	"TIMESTAMP_S":  appendTime,
+	"TIMESTAMP_MS": appendTime,
+	"TIMESTAMP_NS": appendTime,
+}
+
+func appendBool(v any) (driver.Value, bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case int8:
+		return v != 0, true
+	}
+	return nil, false
+}
+
+func appendInt(conv func(int64) (driver.Value, bool)) appendValueConverter {
+	return func(v any) (driver.Value, bool) {
+		switch v := v.(type) {
+		case int8:
+			return conv(int64(v))
+		case int16:
+			return conv(int64(v))
+		case int32:
+			return conv(int64(v))
+		case int64:
+			return conv(v)
+		}
+		return nil, false
+	}
+}
+
+func appendUint(conv func(uint64) (driver.Value, bool)) appendValueConverter {
+	return func(v any) (driver.Value, bool) {
+		switch v := v.(type) {
+		case uint8:
+			return conv(uint64(v))
+		case uint16:
+			return conv(uint64(v))
+		case uint32:
+			return conv(uint64(v))
+		case uint64:
+			return conv(v)
+		}
+		return nil, false
+	}
+}
+
+func appendTime(v any) (driver.Value, bool) {
+	t, ok := v.(time.Time)
+	return t, ok
+}
+
+// insertAppenderThreshold returns the minimum number of rows to use the appender in the current session.
+func insertAppenderThreshold(ctx *sql.Context) int {
+	v, err := ctx.GetSessionVariable(ctx, InsertAppenderThreshold)
+	if err != nil {
+		return 0
+	}
+	threshold, _ := v.(int64)
+	return int(threshold)
+}
+
+// buildAppendValues loads the rows of a large INSERT ... VALUES statement through the DuckDB Appender.
+// The values are evaluated and converted here, and appended to the table without
+// transpiling, parsing, and planning the statement in DuckDB.
+//
+// The Appender writes all columns of the table and cannot resolve conflicts, so it is only used for
+// a plain INSERT of literal values, and the omitted columns are filled with their defaults here.
+// Every column must have a type in appendValueConverters.
+// The appended rows cannot be taken back by the statement, so it runs in a transaction of its own,
+// and is only used outside of transactions.
+// It returns false if the statement is not eligible, in which case it should be executed in DuckDB as usual.
+// The tables with AUTO_INCREMENT columns are handled by the framework, so the last insert ID is not changed.
+func (b *DuckBuilder) buildAppendValues(ctx *sql.Context, insert *plan.InsertInto, dst sql.InsertableTable) (sql.RowIter, bool, error) {
+	threshold := insertAppenderThreshold(ctx)
+	if threshold <= 0 || insert.IsReplace || insert.Ignore || len(insert.OnDupExprs) > 0 {
+		return nil, false, nil
+	}
+	if _, ok := dst.(*catalog.Table); !ok || adapter.TryGetTxn(ctx) != nil {
+		return nil, false, nil
+	}
+
+	// The omitted columns are filled with the defaults by a projection over the values.
+	var proj *plan.Project
+	src := insert.Source
+	if p, ok := src.(*plan.Project); ok {
+		proj, src = p, p.Child
+	}
+	values, ok := src.(*plan.Values)
+	if !ok || len(values.ExpressionTuples) < threshold {
+		return nil, false, nil
+	}
+
+	schema := insert.Database().Name()
+	converters, ok, err := appendTargetConverters(ctx, schema, dst.Name(), dst.Schema())
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	rows, ok, err := evalAppendRows(ctx, values, proj, dst.Schema(), converters)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	conn, err := b.provider.Pool().GetConnForSchema(ctx, ctx.ID(), ctx.GetCurrentDatabase())
+	if err != nil {
+		return nil, false, err
+	}
+	ctx.GetLogger().Debugf("Appending %d rows to %s.%s", len(rows), schema, dst.Name())
+	if err := appendRows(ctx, conn, schema, dst.Name(), rows); err != nil {
+		if yes, column := catalog.IsDuckDBNotNullConstraintViolationError(err); yes {
+			return nil, true, sql.ErrInsertIntoNonNullableProvidedNull.New(column)
+		}
+		return nil, true, err
+	}
+	return okResultIter(ctx, types.OkResult{RowsAffected: uint64(len(rows))}), true, nil
+}
+
+// appendTargetConverters returns the converters for the columns of the table in DuckDB.
+// It returns false if the columns do not match the schema of the table or have types that cannot be appended.
+func appendTargetConverters(ctx *sql.Context, schema, table string, sch sql.Schema) ([]appendValueConverter, bool, error) {
+	rows, err := adapter.QueryCatalog(ctx,
+		"SELECT column_name, data_type FROM duckdb_columns() WHERE database_name = ? AND schema_name = ? AND table_name = ? ORDER BY column_index",
+		adapter.GetCurrentCatalog(ctx), schema, table,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	converters := make([]appendValueConverter, 0, len(sch))
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, false, err
+		}
+		convert, ok := appendValueConverters[typ]
+		if !ok || len(converters) >= len(sch) || !strings.EqualFold(sch[len(converters)].Name, name) {
+			return nil, false, rows.Err()
+		}
+		converters = append(converters, convert)
+	}
+	return converters, len(converters) == len(sch), rows.Err()
+}
+
+// evalAppendRows evaluates the rows of the VALUES and converts them to the values to append.
+// It returns false if a value cannot be converted, so that DuckDB reports the error.
+func evalAppendRows(ctx *sql.Context, values *plan.Values, proj *plan.Project, sch sql.Schema, converters []appendValueConverter) ([][]driver.Value, bool, error) {
+	rows := make([][]driver.Value, len(values.ExpressionTuples))
+	for i, tuple := range values.ExpressionTuples {
+		row := make(sql.Row, len(tuple))
+		for j, expr := range tuple {
+			if !isLiteralValue(expr) {
+				return nil, false, nil
+			}
+			v, err := expr.Eval(ctx, nil)
+			if err != nil {
+				return nil, false, err
+			}
+			row[j] = v
+		}
+		if proj != nil {
+			projected := make(sql.Row, len(proj.Projections))
+			for j, expr := range proj.Projections {
+				v, err := expr.Eval(ctx, row)
+				if err != nil {
+					return nil, false, err
+				}
+				projected[j] = v
+			}
+			row = projected
+		}
+		if len(row) != len(sch) {
+			return nil, false, nil
+		}
+
+		rows[i] = make([]driver.Value, len(row))
+		for j, v := range row {
+			if v == nil {
+				continue
+			}
+			converted, inRange, err := sch[j].Type.Convert(v)
+			if err != nil || inRange != sql.InRange {
+				return nil, false, nil
+			}
+			value, ok := converters[j](converted)
+			if !ok {
+				return nil, false, nil
+			}
+			rows[i][j] = value
+		}
+	}
+	return rows, true, nil
+}
+
+// isLiteralValue returns true if the expression is a literal, such as NULL, 'abc', or -1.
+// The LiteralValueSource of the INSERT is not used since it is false for NULLs.
+func isLiteralValue(e sql.Expression) bool {
+	return !transform.InspectExpr(e, func(e sql.Expression) bool {
+		switch e.(type) {
+		case *expression.Literal, *expression.UnaryMinus:
+			return false
+		}
+		return true
+	})
+}
+
+// appendRows appends the rows to the table in a transaction of its own.
+func appendRows(ctx *sql.Context, conn *stdsql.Conn, schema, table string, rows [][]driver.Value) (err error) {
+	if _, err := conn.ExecContext(ctx, "BEGIN"); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			// The statement may have failed because the context was canceled.
+			_, rollbackErr := conn.ExecContext(context.WithoutCancel(ctx), "ROLLBACK")
+			err = errors.Join(err, rollbackErr)
+		}
+	}()
+
+	var appender *duckdb.Appender
+	if err = conn.Raw(func(driverConn any) (rawErr error) {
+		appender, rawErr = duckdb.NewAppenderFromConn(driverConn.(driver.Conn), schema, table)
+		return rawErr
+	}); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := appender.AppendRow(row...); err != nil {
+			return errors.Join(err, appender.Close())
+		}
+	}
+	// Closing the appender flushes the appended rows, which reports the constraint violations.
+	if err := appender.Close(); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "COMMIT")
+	return err
+}
@@ -17,9 +17,8 @@ package backend
 import (
 	stdsql "database/sql"
 	"io"
-	"math/big"
-	"reflect"
 	"strings"
+	"time"
 
 	"github.com/apecloud/myduckserver/charset"
 	"github.com/dolthub/go-mysql-server/sql"
@@ -31,8 +30,8 @@ import (
 var _ sql.RowIter = (*SQLRowIter)(nil)
 
 type typeConversion struct {
-	idx  int
-	kind reflect.Kind
+	idx     int
+	convert func(any) (any, error)
 }
 
 // SQLRowIter wraps a standard sql.Rows as a RowIter.
@@ -44,6 +43,8 @@ type SQLRowIter struct {
 	pointers    []any // pointers to the buffer
 	decimals    []int
 	intervals   []int
+	instants    []int          // TIMESTAMPTZ columns, displayed in the session time zone
+	location    *time.Location // the session time zone, resolved on the first row
 	nonUTF8     []int
 	charsets    []sql.CharacterSetID
 	conversions []typeConversion
@@ -69,6 +70,14 @@ func NewSQLRowIter(rows *stdsql.Rows, schema sql.Schema) (*SQLRowIter, error) {
 		}
 	}
 
+	var instants []int
+	for i, t := range columns {
+		// The results over the Postgres protocol keep the instants, which are encoded with their offsets.
+		if t.DatabaseTypeName() == "TIMESTAMPTZ" && i < len(schema) && types.IsTime(schema[i].Type) {
+			instants = append(instants, i)
+		}
+	}
+
 	var (
 		nonUTF8  []int
 		charsets []sql.CharacterSetID
@@ -82,19 +91,12 @@ func NewSQLRowIter(rows *stdsql.Rows, schema sql.Schema) (*SQLRowIter, error) {
 
 	var conversions []typeConversion
 	for i, c := range columns {
-		if c.DatabaseTypeName() == "HUGEINT" {
-			expectedType := schema[i].Type
-			if ok := types.IsFloat(expectedType); ok {
-				conversions = append(conversions, typeConversion{idx: i, kind: reflect.Float64})
-			} else {
-				conversions = append(conversions, typeConversion{idx: i, kind: reflect.Int64})
-			}
+		var expected sql.Type
+		if i < len(schema) {
+			expected = schema[i].Type
 		}
-		if c.DatabaseTypeName() == "DOUBLE" || c.DatabaseTypeName() == "FLOAT" {
-			expectedType := schema[i].Type
-			if ok := types.IsInteger(expectedType); ok {
-				conversions = append(conversions, typeConversion{idx: i, kind: reflect.Int64})
-			}
+		if convert := resultConversion(c.DatabaseTypeName(), expected); convert != nil {
+			conversions = append(conversions, typeConversion{idx: i, convert: convert})
 		}
 	}
 
@@ -105,7 +107,7 @@ func NewSQLRowIter(rows *stdsql.Rows, schema sql.Schema) (*SQLRowIter, error) {
 		ptrs[i] = &buf[i]
 	}
 
-	return &SQLRowIter{rows, columns, schema, buf, ptrs, decimals, intervals, nonUTF8, charsets, conversions}, nil
+	return &SQLRowIter{rows, columns, schema, buf, ptrs, decimals, intervals, instants, nil, nonUTF8, charsets, conversions}, nil
 }
 
 // Next retrieves the next row. It will return io.EOF if it's the last row.
@@ -118,7 +120,8 @@ func (iter *SQLRowIter) Next(ctx *sql.Context) (sql.Row, error) {
 	}
 
 	// Scan the values into the buffer
-	if err := iter.rows.Scan(iter.pointers[:len(iter.columns)]...); err != nil {
+	var err error
+	if err = iter.rows.Scan(iter.pointers[:len(iter.columns)]...); err != nil {
 		return nil, err
 	}
 
@@ -141,24 +144,24 @@ func (iter *SQLRowIter) Next(ctx *sql.Context) (sql.Row, error) {
 		}
 	}
 
-	// Process type conversions
-	for _, targetType := range iter.conversions {
-		idx := targetType.idx
-		rawValue := iter.buffer[idx]
-		if targetType.kind == reflect.Float64 {
-			switch v := rawValue.(type) {
-			case *big.Int:
-				iter.buffer[idx], _ = v.Float64()
-			}
+	// Process timestamptz values
+	if len(iter.instants) > 0 && iter.location == nil {
+		if iter.location, err = sessionLocation(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for _, idx := range iter.instants {
+		switch v := iter.buffer[idx].(type) {
+		case time.Time:
+			iter.buffer[idx] = inLocation(v, iter.location)
 		}
-		if targetType.kind == reflect.Int64 {
-			switch v := rawValue.(type) {
-			case float64:
-				iter.buffer[idx] = int64(v)
-			case float32:
-				iter.buffer[idx] = int64(v)
-			case *big.Int:
-				iter.buffer[idx] = v.Int64()
+	}
+
+	// Cast the values to the types of the schema, see resultConversion
+	for _, c := range iter.conversions {
+		if v := iter.buffer[c.idx]; v != nil {
+			if iter.buffer[c.idx], err = c.convert(v); err != nil {
+				return nil, err
 			}
 		}
 	}
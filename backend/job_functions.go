@@ -0,0 +1,107 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression"
+	"github.com/dolthub/go-mysql-server/sql/types"
+)
+
+// JobFunctions are the functions that run and cancel the background jobs on the MySQL protocol.
+// They require the ADMIN privilege, see CheckAdminPrivilege, and are recorded in the audit log. See JobScheduler.
+var JobFunctions = []sql.Function{
+	sql.Function1{Name: "myduck_run_job", Fn: NewRunJob},
+	sql.Function1{Name: "myduck_cancel_job", Fn: NewCancelJob},
+}
+
+// JobControl is myduck_run_job(name) or myduck_cancel_job(name) of the job scheduler of the server, see JobSchedulerOf.
+type JobControl struct {
+	expression.UnaryExpression
+	cancel bool
+}
+
+var _ sql.FunctionExpression = (*JobControl)(nil)
+var _ sql.CollationCoercible = (*JobControl)(nil)
+
+func NewRunJob(e sql.Expression) sql.Expression {
+	return &JobControl{UnaryExpression: expression.UnaryExpression{Child: e}}
+}
+
+func NewCancelJob(e sql.Expression) sql.Expression {
+	return &JobControl{UnaryExpression: expression.UnaryExpression{Child: e}, cancel: true}
+}
+
+// FunctionName implements sql.FunctionExpression
+func (f *JobControl) FunctionName() string {
+	if f.cancel {
+		return "myduck_cancel_job"
+	}
+	return "myduck_run_job"
+}
+
+// Description implements sql.FunctionExpression
+func (f *JobControl) Description() string {
+	if f.cancel {
+		return "cancels the current run of a background job, and returns whether the job was running."
+	}
+	return "runs a background job as soon as possible, and returns false if the job is already running."
+}
+
+func (f *JobControl) IsNonDeterministic() bool {
+	return true
+}
+
+// Eval implements the Expression interface.
+func (f *JobControl) Eval(ctx *sql.Context, row sql.Row) (interface{}, error) {
+	v, err := f.Child.Eval(ctx, row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	name, _, err := types.LongText.Convert(v)
+	if err != nil {
+		return nil, err
+	}
+	scheduler := sessionJobScheduler(ctx)
+	var result bool
+	run := func() error {
+		if f.cancel {
+			result = scheduler.CancelJob(name.(string))
+			return nil
+		}
+		result, err = scheduler.RunJob(ctx, name.(string))
+		return err
+	}
+	if sess, ok := ctx.Session.(*Session); ok {
+		err = RunAdminStatement(ctx, sess.mysqlDb, catalog.PrivilegeAdmin, f.FunctionName(), ctx.Query(), run)
+	} else {
+		err = run()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (f *JobControl) String() string {
+	return fmt.Sprintf("%s(%s)", f.FunctionName(), f.Child)
+}
+
+// WithChildren implements the Expression interface.
+func (f *JobControl) WithChildren(children ...sql.Expression) (sql.Expression, error) {
+	if len(children) != 1 {
+		return nil, sql.ErrInvalidChildrenNumber.New(f, len(children), 1)
+	}
+	return &JobControl{UnaryExpression: expression.UnaryExpression{Child: children[0]}, cancel: f.cancel}, nil
+}
+
+// Type implements the Expression interface.
+func (f *JobControl) Type() sql.Type {
+	return types.Boolean
+}
+
+// CollationCoercibility implements the interface sql.CollationCoercible.
+func (*JobControl) CollationCoercibility(ctx *sql.Context) (collation sql.CollationID, coercibility byte) {
+	return sql.Collation_binary, 5
+}
@@ -0,0 +1,467 @@
+package backend
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/sirupsen/logrus"
+)
+
+// The JobScheduler runs the background jobs, which are the rows of catalog.InternalTables.Jobs
+// managed with plain DML, e.g.,
+//
+//	INSERT INTO __sys__.jobs (name, kind, command, interval_seconds)
+//	VALUES ('daily-sales', 'sql', 'CREATE OR REPLACE TABLE main.daily_sales AS SELECT ...', 3600);
+//
+// A job runs every interval_seconds after the start of its previous run, or only on demand if its interval is NULL.
+// The kind of a job selects the handler that runs it: a job of kind `sql` runs its command in DuckDB,
+// whose tables must be qualified, and the other subsystems add their kinds with RegisterJobKind.
+// The background services of the server, e.g., the TTLPurger, run as the SystemJobs, which are defined on startup.
+// A job never overlaps itself, and at most MaxConcurrentJobsVariable jobs run at the same time;
+// the due jobs beyond the limit wait for the next check.
+//
+// Each run is recorded in catalog.InternalTables.JobRuns along with its status and message,
+// and only the latest jobRunsKept runs of each job are kept. The runs left running by a crash are marked
+// as aborted on startup. The jobs are run and canceled on demand with SQL on both protocols:
+//
+//   - `SELECT myduck_run_job('name')` runs the job as soon as possible, even if it is disabled.
+//   - `SELECT myduck_cancel_job('name')` cancels the current run of the job, and returns whether there is one.
+
+// The system variables that control the JobScheduler.
+const (
+	// JobsPausedVariable pauses the scheduled runs of the jobs. The runs requested on demand still start.
+	JobsPausedVariable = "myduck_jobs_paused"
+	// MaxConcurrentJobsVariable limits the number of the jobs that run at the same time.
+	MaxConcurrentJobsVariable = "myduck_max_concurrent_jobs"
+)
+
+// JobKindSQL is the kind of the jobs that run their commands in DuckDB.
+const JobKindSQL = "sql"
+
+// The statuses of the runs of the jobs.
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+	JobAborted   = "aborted"
+)
+
+const (
+	// jobCheckInterval is the interval between the checks of the due jobs.
+	jobCheckInterval = time.Second
+	// jobRunsKept is the number of the latest runs of each job kept in the history.
+	jobRunsKept = 100
+)
+
+func init() {
+	sql.SystemVariables.AddSystemVariables([]sql.SystemVariable{
+		&sql.MysqlSystemVariable{
+			Name:              JobsPausedVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemBoolType(JobsPausedVariable),
+			Default:           int8(0),
+		},
+		&sql.MysqlSystemVariable{
+			Name:              MaxConcurrentJobsVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemIntType(MaxConcurrentJobsVariable, 1, 1024, false),
+			Default:           int64(2),
+		},
+	})
+}
+
+// Job is a background job defined in catalog.InternalTables.Jobs.
+type Job struct {
+	Name     string
+	Kind     string
+	Command  string
+	Interval time.Duration // 0 if the job only runs on demand
+	Enabled  bool
+}
+
+// JobHandler runs a job of a kind until it finishes or ctx is canceled,
+// and returns the message recorded in the history of the job.
+type JobHandler func(ctx context.Context, job *Job) (string, error)
+
+// SystemJob is a job of the server itself, e.g., the purges of the TTLPurger. It is defined in
+// catalog.InternalTables.Jobs when the scheduler starts, so that it is listed, run, and canceled like the other jobs,
+// and it may be disabled by its row. Its name is its kind as well. It runs every Interval(), which follows
+// a system variable of its service, unless interval_seconds is set in its row.
+type SystemJob struct {
+	Name     string
+	Interval func() time.Duration
+	Run      JobHandler
+}
+
+// ErrJobNotFound is returned by RunJob if the job is not defined.
+var ErrJobNotFound = errors.New("job does not exist")
+
+// jobSchedulers are the job schedulers of the servers in the process by their database providers, see JobSchedulerOf.
+var jobSchedulers sync.Map // map[*catalog.DatabaseProvider]*JobScheduler
+
+// SetJobScheduler makes s the job scheduler of the server of the provider, whose sessions run and cancel the jobs
+// with myduck_run_job and myduck_cancel_job. A nil s removes the job scheduler of the server.
+func SetJobScheduler(provider *catalog.DatabaseProvider, s *JobScheduler) {
+	if s == nil {
+		jobSchedulers.Delete(provider)
+		return
+	}
+	jobSchedulers.Store(provider, s)
+}
+
+// JobSchedulerOf returns the job scheduler of the server of the provider, or nil if it has none, e.g., on a reader.
+// The methods of a nil scheduler report that the scheduler is not running.
+func JobSchedulerOf(provider *catalog.DatabaseProvider) *JobScheduler {
+	if s, ok := jobSchedulers.Load(provider); ok {
+		return s.(*JobScheduler)
+	}
+	return nil
+}
+
+// sessionJobScheduler returns the job scheduler of the server of the session.
+func sessionJobScheduler(ctx *sql.Context) *JobScheduler {
+	if sess, ok := ctx.Session.(*Session); ok {
+		return JobSchedulerOf(sess.Provider())
+	}
+	return nil
+}
+
+// errJobSchedulerNotRunning is returned by RunJob if the scheduler has not started.
+var errJobSchedulerNotRunning = errors.New("the job scheduler is not running")
+
+type jobRun struct {
+	id       uint64
+	cancel   context.CancelFunc
+	canceled bool // whether the run is canceled by myduck_cancel_job
+}
+
+type JobScheduler struct {
+	logger *logrus.Entry
+
+	mu        sync.Mutex
+	db        *stdsql.DB
+	kinds     map[string]JobHandler
+	system    map[string]SystemJob
+	running   map[string]*jobRun
+	requested map[string]bool
+	lastRunID uint64
+	wake      chan struct{}
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewJobScheduler() *JobScheduler {
+	s := &JobScheduler{
+		logger:    logrus.WithField("component", "jobs"),
+		kinds:     make(map[string]JobHandler),
+		system:    make(map[string]SystemJob),
+		running:   make(map[string]*jobRun),
+		requested: make(map[string]bool),
+		wake:      make(chan struct{}, 1),
+	}
+	s.kinds[JobKindSQL] = s.runSQL
+	s.kinds[JobKindLakeSink] = s.runLakeSink
+	return s
+}
+
+// RegisterJobKind adds a kind of jobs, which are run by the handler.
+func (s *JobScheduler) RegisterJobKind(kind string, handler JobHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kinds[kind] = handler
+}
+
+// AddSystemJob adds a system job, which is defined when the scheduler starts.
+func (s *JobScheduler) AddSystemJob(job SystemJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kinds[job.Name] = job.Run
+	s.system[job.Name] = job
+}
+
+// Start runs the jobs defined in the database in the background until Stop is called.
+func (s *JobScheduler) Start(db *stdsql.DB) error {
+	ctx := context.Background()
+	// The runs of the previous process have ended with it.
+	if _, err := db.ExecContext(ctx,
+		"UPDATE "+catalog.InternalTables.JobRuns.QualifiedName()+
+			" SET status = ?, finished_at = now(), message = 'the server stopped during the run' WHERE status = ?",
+		JobAborted, JobRunning,
+	); err != nil {
+		return err
+	}
+	// The system jobs deleted by the users are defined again.
+	s.mu.Lock()
+	system := slices.Sorted(maps.Keys(s.system))
+	s.mu.Unlock()
+	for _, name := range system {
+		if _, err := db.ExecContext(ctx,
+			"INSERT OR IGNORE INTO "+catalog.InternalTables.Jobs.QualifiedName()+" (name, kind) VALUES (?, ?)", name, name,
+		); err != nil {
+			return err
+		}
+	}
+	var lastRunID uint64
+	if err := db.QueryRowContext(ctx,
+		"SELECT coalesce(max(run_id), 0) FROM "+catalog.InternalTables.JobRuns.QualifiedName(),
+	).Scan(&lastRunID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.db = db
+	s.lastRunID = lastRunID
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(jobCheckInterval):
+			case <-s.wake:
+			}
+			if _, err := s.Dispatch(ctx, time.Now()); err != nil && ctx.Err() == nil {
+				s.logger.WithError(err).Warnln("Failed to check the due jobs")
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop cancels the running jobs and waits for them to finish.
+func (s *JobScheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+		s.wg.Wait()
+	}
+}
+
+// RunJob requests the job to run as soon as possible, and returns false if it is already running.
+func (s *JobScheduler) RunJob(ctx context.Context, name string) (bool, error) {
+	if s == nil {
+		return false, errJobSchedulerNotRunning
+	}
+	s.mu.Lock()
+	db := s.db
+	s.mu.Unlock()
+	if db == nil {
+		return false, errJobSchedulerNotRunning
+	}
+	var kind string
+	err := db.QueryRowContext(ctx,
+		"SELECT kind FROM "+catalog.InternalTables.Jobs.QualifiedName()+" WHERE name = ?", name,
+	).Scan(&kind)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return false, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	} else if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.running[name]; ok {
+		return false, nil
+	}
+	s.requested[name] = true
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// CancelJob cancels the current run of the job, and returns false if the job is not running.
+func (s *JobScheduler) CancelJob(name string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.running[name]
+	if !ok {
+		return false
+	}
+	run.canceled = true
+	run.cancel()
+	return true
+}
+
+// Dispatch starts the jobs that are due at now, up to the concurrency limit, and returns the number of started runs.
+func (s *JobScheduler) Dispatch(ctx context.Context, now time.Time) (int, error) {
+	jobs, lastStarts, err := s.jobs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	paused := globalIntVariable(JobsPausedVariable) != 0
+	limit := int(globalIntVariable(MaxConcurrentJobsVariable))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	started := 0
+	for i, job := range jobs {
+		if _, ok := s.running[job.Name]; ok {
+			continue
+		}
+		interval := job.Interval
+		if system, ok := s.system[job.Name]; ok && interval == 0 && job.Kind == system.Name {
+			interval = system.Interval()
+		}
+		due := s.requested[job.Name] ||
+			!paused && job.Enabled && interval > 0 && (lastStarts[i].IsZero() || !now.Before(lastStarts[i].Add(interval)))
+		if !due {
+			continue
+		}
+		if len(s.running) >= limit {
+			break
+		}
+		delete(s.requested, job.Name)
+		if err := s.startLocked(ctx, job); err != nil {
+			return started, err
+		}
+		started++
+	}
+	// The requests of the jobs that have been deleted are dropped.
+	for name := range s.requested {
+		if !slices.ContainsFunc(jobs, func(job *Job) bool { return job.Name == name }) {
+			delete(s.requested, name)
+		}
+	}
+	return started, nil
+}
+
+// jobs returns the defined jobs along with the start times of their last runs.
+func (s *JobScheduler) jobs(ctx context.Context) ([]*Job, []time.Time, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT j.name, j.kind, j.command, j.interval_seconds, j.enabled, max(r.started_at) FROM "+
+			catalog.InternalTables.Jobs.QualifiedName()+" j LEFT JOIN "+catalog.InternalTables.JobRuns.QualifiedName()+
+			" r ON r.job_name = j.name GROUP BY ALL ORDER BY j.name",
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var jobs []*Job
+	var lastStarts []time.Time
+	for rows.Next() {
+		job := &Job{}
+		var command stdsql.NullString
+		var interval stdsql.NullInt64
+		var lastStart stdsql.NullTime
+		if err := rows.Scan(&job.Name, &job.Kind, &command, &interval, &job.Enabled, &lastStart); err != nil {
+			return nil, nil, err
+		}
+		job.Command = command.String
+		job.Interval = time.Duration(interval.Int64) * time.Second
+		jobs = append(jobs, job)
+		lastStarts = append(lastStarts, lastStart.Time)
+	}
+	return jobs, lastStarts, rows.Err()
+}
+
+// startLocked records a new run of the job and runs it in the background. s.mu must be held.
+func (s *JobScheduler) startLocked(ctx context.Context, job *Job) error {
+	s.lastRunID++
+	run := &jobRun{id: s.lastRunID}
+	if _, err := s.db.ExecContext(ctx, catalog.InternalTables.JobRuns.UpsertStmt(),
+		run.id, job.Name, time.Now(), nil, JobRunning, nil,
+	); err != nil {
+		return err
+	}
+	handler := s.kinds[job.Kind]
+
+	runCtx, cancel := context.WithCancel(ctx)
+	run.cancel = cancel
+	s.running[job.Name] = run
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+
+		start := time.Now()
+		var message string
+		var err error
+		if handler == nil {
+			err = fmt.Errorf("unknown job kind %q", job.Kind)
+		} else {
+			message, err = handler(runCtx, job)
+		}
+
+		s.mu.Lock()
+		delete(s.running, job.Name)
+		canceled := run.canceled
+		s.mu.Unlock()
+
+		status := JobSucceeded
+		switch {
+		case err == nil:
+			s.logger.Infof("Job %s finished in %v", job.Name, time.Since(start))
+		case canceled:
+			status, message = JobCanceled, err.Error()
+			s.logger.Infof("Job %s canceled", job.Name)
+		case ctx.Err() != nil:
+			status, message = JobAborted, err.Error()
+		default:
+			status, message = JobFailed, err.Error()
+			s.logger.WithError(err).Warnf("Job %s failed", job.Name)
+		}
+		if err := s.finish(job.Name, run.id, status, message); err != nil {
+			s.logger.WithError(err).Warnf("Failed to record the run %d of job %s", run.id, job.Name)
+		}
+	}()
+	return nil
+}
+
+// finish records the end of a run, and prunes the old runs of the job.
+func (s *JobScheduler) finish(name string, runID uint64, status, message string) error {
+	// The run is recorded even if the scheduler is stopping.
+	ctx := context.Background()
+	if _, err := s.db.ExecContext(ctx,
+		"UPDATE "+catalog.InternalTables.JobRuns.QualifiedName()+
+			" SET finished_at = now(), status = ?, message = ? WHERE run_id = ?",
+		status, message, runID,
+	); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM "+catalog.InternalTables.JobRuns.QualifiedName()+" WHERE job_name = ? AND run_id NOT IN ("+
+			"SELECT run_id FROM "+catalog.InternalTables.JobRuns.QualifiedName()+" WHERE job_name = ? ORDER BY run_id DESC LIMIT ?)",
+		name, name, jobRunsKept,
+	)
+	return err
+}
+
+// runSQL runs the command of a job of kind JobKindSQL.
+func (s *JobScheduler) runSQL(ctx context.Context, job *Job) (string, error) {
+	if job.Command == "" {
+		return "", fmt.Errorf("job %q has no command", job.Name)
+	}
+	res, err := s.db.ExecContext(ctx, job.Command)
+	if err != nil {
+		return "", err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", nil
+	}
+	return fmt.Sprintf("%d rows affected", n), nil
+}
@@ -0,0 +1,135 @@
+package backend
+
+import (
+	"context"
+	stdsql "database/sql"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobScheduler(t *testing.T) {
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE SCHEMA __sys__")
+	require.NoError(t, err)
+	for _, it := range []catalog.InternalTable{catalog.InternalTables.Jobs, catalog.InternalTables.JobRuns} {
+		_, err = db.Exec("CREATE TABLE " + it.QualifiedName() + " (" + it.DDL + ")")
+		require.NoError(t, err)
+	}
+	// A run left by a crash.
+	_, err = db.Exec(catalog.InternalTables.JobRuns.UpsertStmt(), 7, "old", time.Now(), nil, JobRunning, nil)
+	require.NoError(t, err)
+
+	s := NewJobScheduler()
+	s.RegisterJobKind("wait", func(ctx context.Context, job *Job) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	require.NoError(t, s.Start(db))
+	defer s.Stop()
+
+	status := func(job string) string {
+		var status string
+		err := db.QueryRow("SELECT status FROM "+catalog.InternalTables.JobRuns.QualifiedName()+
+			" WHERE job_name = ? ORDER BY run_id DESC LIMIT 1", job).Scan(&status)
+		if err != nil {
+			return err.Error()
+		}
+		return status
+	}
+	require.Equal(t, JobAborted, status("old"))
+
+	_, err = db.Exec("INSERT INTO " + catalog.InternalTables.Jobs.QualifiedName() + " (name, kind, command, interval_seconds) VALUES " +
+		"('create', 'sql', 'CREATE TABLE main.t AS SELECT 42 AS x', 3600), " +
+		"('broken', 'sql', 'SELECT * FROM main.missing', 3600), " +
+		"('wait', 'wait', NULL, NULL)")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return status("create") == JobSucceeded && status("broken") == JobFailed }, 10*time.Second, 50*time.Millisecond)
+	var x int
+	require.NoError(t, db.QueryRow("SELECT x FROM main.t").Scan(&x))
+	require.Equal(t, 42, x)
+
+	// A job without an interval runs on demand only.
+	require.False(t, s.CancelJob("wait"))
+	started, err := s.RunJob(context.Background(), "wait")
+	require.NoError(t, err)
+	require.True(t, started)
+	require.Eventually(t, func() bool { return status("wait") == JobRunning }, 10*time.Second, 50*time.Millisecond)
+	started, err = s.RunJob(context.Background(), "wait")
+	require.NoError(t, err)
+	require.False(t, started)
+	require.True(t, s.CancelJob("wait"))
+	require.Eventually(t, func() bool { return status("wait") == JobCanceled }, 10*time.Second, 50*time.Millisecond)
+
+	_, err = s.RunJob(context.Background(), "missing")
+	require.ErrorIs(t, err, ErrJobNotFound)
+
+	// The jobs are not due again until their intervals pass.
+	n, err := s.Dispatch(context.Background(), time.Now())
+	require.NoError(t, err)
+	require.Zero(t, n)
+	n, err = s.Dispatch(context.Background(), time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+}
+
+func TestSystemJobs(t *testing.T) {
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE SCHEMA __sys__")
+	require.NoError(t, err)
+	for _, it := range []catalog.InternalTable{catalog.InternalTables.Jobs, catalog.InternalTables.JobRuns} {
+		_, err = db.Exec("CREATE TABLE " + it.QualifiedName() + " (" + it.DDL + ")")
+		require.NoError(t, err)
+	}
+	// A system job disabled by a previous run of the server stays disabled.
+	_, err = db.Exec("INSERT INTO " + catalog.InternalTables.Jobs.QualifiedName() + " (name, kind, enabled) VALUES ('disabled', 'disabled', false)")
+	require.NoError(t, err)
+
+	s := NewJobScheduler()
+	var interval atomic.Int64
+	interval.Store(int64(time.Hour))
+	for _, name := range []string{"service", "disabled"} {
+		s.AddSystemJob(SystemJob{
+			Name:     name,
+			Interval: func() time.Duration { return time.Duration(interval.Load()) },
+			Run: func(ctx context.Context, job *Job) (string, error) {
+				<-ctx.Done()
+				return "", ctx.Err()
+			},
+		})
+	}
+	require.NoError(t, s.Start(db))
+	defer s.Stop()
+
+	var kind string
+	require.NoError(t, db.QueryRow("SELECT kind FROM "+catalog.InternalTables.Jobs.QualifiedName()+" WHERE name = 'service'").Scan(&kind))
+	require.Equal(t, "service", kind)
+
+	// The system jobs are run and canceled like the other jobs.
+	require.Eventually(t, func() bool { return s.CancelJob("service") }, 10*time.Second, 50*time.Millisecond)
+	require.False(t, s.CancelJob("disabled"))
+	require.Eventually(t, func() bool {
+		var status string
+		err := db.QueryRow("SELECT status FROM " + catalog.InternalTables.JobRuns.QualifiedName() +
+			" WHERE job_name = 'service' ORDER BY run_id DESC LIMIT 1").Scan(&status)
+		return err == nil && status == JobCanceled
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// The interval follows the service unless it is set in the row of the job.
+	n, err := s.Dispatch(context.Background(), time.Now().Add(30*time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, n)
+	interval.Store(int64(time.Minute))
+	n, err = s.Dispatch(context.Background(), time.Now().Add(30*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.True(t, s.CancelJob("service"))
+}
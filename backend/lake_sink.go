@@ -0,0 +1,533 @@
+package backend
+
+import (
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/mysql_db"
+	"github.com/google/uuid"
+)
+
+// The lake sinks maintain copies of the tables of the replica as Delta Lake tables on the object storage,
+// so that the lakehouse engines read the replicated data without another pipeline. They are managed over both protocols:
+//
+//	CREATE LAKE SINK name FOR TABLE [schema.]table TO 's3://bucket/path' [WITH (FORMAT delta, INTERVAL seconds)]
+//	DROP LAKE SINK [IF EXISTS] name
+//
+// A sink is synced by the background job 'lake_sink:<name>' of kind JobKindLakeSink, every INTERVAL seconds
+// (60 by default, or on demand only if 0), so it is also synced by `SELECT myduck_run_job('lake_sink:<name>')`.
+// The state of the sinks and their last syncs are listed in the myduck_lake_sinks view. A sync commits a new version
+// of the Delta table if the table has changed, whether by the replication or by the clients:
+//
+//   - The first sync exports the whole table along with the metadata of the Delta table.
+//   - If rows have only been added since the last sync, they are appended in a new data file.
+//   - Otherwise, i.e., rows have been updated or deleted, or the columns have changed, the table is exported again,
+//     replacing the data files of the previous version.
+//
+// The changes are found by comparing the table with the data files of the current version, so they are read back
+// from the object storage on each sync. The data files and the commits are written by DuckDB, with the S3 secrets
+// of DuckDB, e.g., created by `CREATE PERSISTENT SECRET (TYPE s3, ...)` over the Postgres protocol, or the credentials
+// in the environment of the server. Dropping a sink leaves the Delta table on the object storage.
+//
+// Iceberg is not supported, since its manifests are Avro files, which DuckDB cannot write.
+// Creating a sink requires the global FILE privilege, the same as an export, see ExecExport.
+
+// JobKindLakeSink is the kind of the jobs that sync the lake sinks.
+const JobKindLakeSink = "lake_sink"
+
+// LakeSinkFormatDelta is the format of the Delta Lake tables.
+const LakeSinkFormatDelta = "delta"
+
+// DefaultLakeSinkInterval is the default interval between the syncs of a lake sink, in seconds.
+const DefaultLakeSinkInterval = 60
+
+var (
+	createLakeSinkRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+LAKE\s+SINK\s+(` + maskingIdentifier + `)\s+FOR\s+(?:TABLE\s+)?(` +
+		maskingIdentifier + `(?:\s*\.\s*` + maskingIdentifier + `)?)\s+TO\s+'((?:[^']|'')+)'(?:\s+WITH\s*\((.*)\))?[\s;]*$`)
+	dropLakeSinkRegex = regexp.MustCompile(`(?is)^\s*DROP\s+LAKE\s+SINK\s+(IF\s+EXISTS\s+)?(` + maskingIdentifier + `)[\s;]*$`)
+	// lakeSinkOptionRegex matches an option of CREATE LAKE SINK, whose value may be quoted or preceded by '='.
+	lakeSinkOptionRegex = regexp.MustCompile(`(?s)^([A-Za-z_]+)\s*=?\s*'?([^']*?)'?$`)
+)
+
+// LakeSinkJobName returns the name of the job that syncs a lake sink.
+func LakeSinkJobName(sink string) string {
+	return JobKindLakeSink + ":" + sink
+}
+
+// IsLakeSinkStatement reports whether the query is a statement that manages the lake sinks.
+func IsLakeSinkStatement(query string) bool {
+	return createLakeSinkRegex.MatchString(query) || dropLakeSinkRegex.MatchString(query)
+}
+
+// ExecLakeSinkStatement executes a statement that manages the lake sinks, and returns its command tag.
+// It returns false if the query is not such a statement.
+func ExecLakeSinkStatement(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb, query string) (tag string, ok bool, err error) {
+	switch {
+	case createLakeSinkRegex.MatchString(query):
+		m := createLakeSinkRegex.FindStringSubmatch(query)
+		if err := checkGlobalPrivilege(ctx, mysqlDb, sql.PrivilegeType_File); err != nil {
+			return "", true, err
+		}
+		schema, table := ctx.GetCurrentDatabase(), unquoteMaskingIdentifier(m[2])
+		if qualifier, name, ok := splitQualifiedIdentifier(m[2]); ok {
+			schema, table = unquoteMaskingIdentifier(qualifier), unquoteMaskingIdentifier(name)
+		}
+		interval, err := parseLakeSinkOptions(m[4])
+		if err != nil {
+			return "", true, err
+		}
+		location := strings.TrimRight(strings.ReplaceAll(m[3], "''", "'"), "/")
+		return "CREATE LAKE SINK", true, createLakeSink(ctx, unquoteMaskingIdentifier(m[1]), schema, table, location, interval)
+
+	case dropLakeSinkRegex.MatchString(query):
+		m := dropLakeSinkRegex.FindStringSubmatch(query)
+		if err := checkGlobalPrivilege(ctx, mysqlDb, sql.PrivilegeType_File); err != nil {
+			return "", true, err
+		}
+		name := unquoteMaskingIdentifier(m[2])
+		dropped, err := dropLakeSink(ctx, name)
+		if err == nil && !dropped && m[1] == "" {
+			err = fmt.Errorf("lake sink %q does not exist", name)
+		}
+		return "DROP LAKE SINK", true, err
+	}
+	return "", false, nil
+}
+
+// parseLakeSinkOptions parses the options of CREATE LAKE SINK, and returns the interval between the syncs.
+func parseLakeSinkOptions(options string) (int, error) {
+	interval := DefaultLakeSinkInterval
+	for _, option := range splitExportOptions(options) {
+		m := lakeSinkOptionRegex.FindStringSubmatch(option)
+		if m == nil {
+			return 0, fmt.Errorf("invalid option of lake sink: %q", option)
+		}
+		switch name, value := strings.ToUpper(m[1]), strings.TrimSpace(m[2]); name {
+		case "FORMAT":
+			if !strings.EqualFold(value, LakeSinkFormatDelta) {
+				return 0, fmt.Errorf("unsupported format of lake sink %q, only %s is supported", value, LakeSinkFormatDelta)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid interval of lake sink: %q", value)
+			}
+			interval = n
+		default:
+			return 0, fmt.Errorf("unknown option of lake sink: %s", name)
+		}
+	}
+	return interval, nil
+}
+
+func createLakeSink(ctx *sql.Context, name, schema, table, location string, interval int) error {
+	var n int
+	if err := adapter.QueryRowCatalog(ctx, "SELECT count(*) FROM information_schema.tables WHERE table_catalog = current_database() "+
+		"AND table_schema = ? AND table_name = ? AND table_type = 'BASE TABLE'", schema, table).Scan(&n); err != nil {
+		return catalog.ErrDuckDB.New(err)
+	}
+	if n == 0 {
+		return sql.ErrTableNotFound.New(table)
+	}
+	// The sinks are synced without the masks of the users, so the masked tables are synced by the users without them.
+	if masking, err := catalog.SessionMasking(ctx); err != nil {
+		return err
+	} else if masking != nil && masking.IsMaskedTable(schema, table) {
+		return fmt.Errorf("permission denied to sync the masked table %s", table)
+	}
+	if err := adapter.QueryRowCatalog(ctx, "SELECT count(*) FROM "+catalog.InternalTables.LakeSinks.QualifiedName()+
+		" WHERE sink_name = ?", name).Scan(&n); err != nil {
+		return catalog.ErrDuckDB.New(err)
+	}
+	if n > 0 {
+		return fmt.Errorf("lake sink %q already exists", name)
+	}
+
+	var intervalSeconds any
+	if interval > 0 {
+		intervalSeconds = interval
+	}
+	now := time.Now()
+	if _, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.LakeSinks.UpsertStmt(),
+		name, adapter.GetCurrentCatalog(ctx), schema, table, LakeSinkFormatDelta, location, uuid.NewString(),
+		-1, "", "", nil, nil, now,
+	); err != nil {
+		return catalog.ErrDuckDB.New(err)
+	}
+	if _, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.Jobs.UpsertStmt(),
+		LakeSinkJobName(name), JobKindLakeSink, name, intervalSeconds, true, now,
+	); err != nil {
+		return catalog.ErrDuckDB.New(err)
+	}
+	if err := adapter.CommitAndCloseTxn(ctx); err != nil {
+		return err
+	}
+	// The initial export starts right away.
+	if _, err := sessionJobScheduler(ctx).RunJob(ctx, LakeSinkJobName(name)); err != nil {
+		ctx.GetLogger().WithError(err).Warnf("Failed to start the initial sync of lake sink %s", name)
+	}
+	return nil
+}
+
+// dropLakeSink drops a lake sink and its job, and returns false if it does not exist.
+func dropLakeSink(ctx *sql.Context, name string) (bool, error) {
+	res, err := adapter.ExecCatalogInTxn(ctx, "DELETE FROM "+catalog.InternalTables.LakeSinks.QualifiedName()+" WHERE sink_name = ?", name)
+	if err != nil {
+		return false, catalog.ErrDuckDB.New(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if _, err := adapter.ExecCatalogInTxn(ctx, "DELETE FROM "+catalog.InternalTables.Jobs.QualifiedName()+" WHERE name = ?", LakeSinkJobName(name)); err != nil {
+		return false, catalog.ErrDuckDB.New(err)
+	}
+	if err := adapter.CommitAndCloseTxn(ctx); err != nil {
+		return false, err
+	}
+	sessionJobScheduler(ctx).CancelJob(LakeSinkJobName(name))
+	return n > 0, nil
+}
+
+// lakeSink is a lake sink along with the state of its table.
+type lakeSink struct {
+	Name         string
+	Catalog      string
+	Schema       string
+	Table        string
+	Location     string
+	TableID      string
+	Version      int64
+	Files        []string
+	SchemaString string
+	SyncedRows   int64
+}
+
+func loadLakeSink(ctx context.Context, conn *stdsql.Conn, name string) (*lakeSink, error) {
+	s := &lakeSink{Name: name}
+	var files, schemaString stdsql.NullString
+	var syncedRows stdsql.NullInt64
+	err := conn.QueryRowContext(ctx, "SELECT catalog_name, schema_name, table_name, location, table_id, version, files, schema_string, synced_rows FROM "+
+		catalog.InternalTables.LakeSinks.QualifiedName()+" WHERE sink_name = ?", name,
+	).Scan(&s.Catalog, &s.Schema, &s.Table, &s.Location, &s.TableID, &s.Version, &files, &schemaString, &syncedRows)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return nil, fmt.Errorf("lake sink %q does not exist", name)
+	} else if err != nil {
+		return nil, err
+	}
+	if files.String != "" {
+		s.Files = strings.Split(files.String, ",")
+	}
+	s.SchemaString, s.SyncedRows = schemaString.String, syncedRows.Int64
+	return s, nil
+}
+
+func (s *lakeSink) url(file string) string {
+	return s.Location + "/" + file
+}
+
+// runLakeSink syncs the lake sink of a job of kind JobKindLakeSink.
+func (s *JobScheduler) runLakeSink(ctx context.Context, job *Job) (string, error) {
+	return SyncLakeSink(ctx, s.db, job.Command)
+}
+
+// SyncLakeSink commits the changes of the table of a lake sink since its last sync to the Delta table,
+// and returns the result of the sync.
+func SyncLakeSink(ctx context.Context, db *stdsql.DB, name string) (string, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	sink, err := loadLakeSink(ctx, conn, name)
+	if err != nil {
+		return "", err
+	}
+
+	columns, err := lakeSinkColumns(ctx, conn, sink)
+	if err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		return "", sql.ErrTableNotFound.New(sink.Table)
+	}
+	projection, schemaString, err := deltaSchema(columns)
+	if err != nil {
+		return "", err
+	}
+	source := "SELECT " + projection + " FROM " + catalog.ConnectIdentifiersANSI(sink.Catalog, sink.Schema, sink.Table)
+
+	overwrite := sink.Version < 0 || schemaString != sink.SchemaString
+	rows := source
+	if !overwrite && len(sink.Files) > 0 {
+		quoted := make([]string, len(sink.Files))
+		for i, file := range sink.Files {
+			quoted[i] = "'" + strings.ReplaceAll(sink.url(file), "'", "''") + "'"
+		}
+		exported := "SELECT * FROM read_parquet([" + strings.Join(quoted, ", ") + "])"
+		var removed int64
+		if err := conn.QueryRowContext(ctx, "SELECT count(*) FROM ("+exported+" EXCEPT ALL "+source+")").Scan(&removed); err != nil {
+			return "", err
+		}
+		overwrite = removed > 0
+		if !overwrite {
+			rows = "SELECT * FROM (" + source + " EXCEPT ALL " + exported + ")"
+		}
+	}
+	var n int64
+	if err := conn.QueryRowContext(ctx, "SELECT count(*) FROM ("+rows+")").Scan(&n); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if !overwrite && n == 0 {
+		if _, err := conn.ExecContext(ctx, "UPDATE "+catalog.InternalTables.LakeSinks.QualifiedName()+
+			" SET synced_at = ? WHERE sink_name = ?", now, name); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("version %d is up to date", sink.Version), nil
+	}
+
+	version := sink.Version + 1
+	file := fmt.Sprintf("part-%05d-%s.parquet", version, uuid.NewString())
+	if _, err := conn.ExecContext(ctx, "COPY ("+rows+") TO '"+strings.ReplaceAll(sink.url(file), "'", "''")+"' (FORMAT parquet)"); err != nil {
+		return "", fmt.Errorf("failed to write the data file: %w", err)
+	}
+	var size int64
+	if err := conn.QueryRowContext(ctx, "SELECT size FROM read_blob(?)", sink.url(file)).Scan(&size); err != nil {
+		return "", fmt.Errorf("failed to stat the data file: %w", err)
+	}
+
+	commit := &deltaCommit{
+		Timestamp: now,
+		Overwrite: overwrite,
+		TableID:   sink.TableID,
+		Schema:    schemaString,
+		Protocol:  sink.Version < 0,
+		Metadata:  schemaString != sink.SchemaString,
+		Added:     []deltaFile{{Path: file, Size: size}},
+	}
+	files := []string{file}
+	if overwrite {
+		commit.Removed = sink.Files
+	} else {
+		files = append(sink.Files, file)
+	}
+	lines, err := commit.lines()
+	if err != nil {
+		return "", err
+	}
+	// The state is recorded after the commit is written, so a failure in between writes the same version again
+	// on the next sync, replacing the commit whose data files are not recorded.
+	if _, err := conn.ExecContext(ctx, deltaLogStmt(sink.url(fmt.Sprintf("_delta_log/%020d.json", version)), lines)); err != nil {
+		return "", fmt.Errorf("failed to write the commit of version %d: %w", version, err)
+	}
+	syncedRows := n
+	if !overwrite {
+		syncedRows += sink.SyncedRows
+	}
+	if _, err := conn.ExecContext(ctx, "UPDATE "+catalog.InternalTables.LakeSinks.QualifiedName()+
+		" SET version = ?, files = ?, schema_string = ?, synced_rows = ?, synced_at = ? WHERE sink_name = ?",
+		version, strings.Join(files, ","), schemaString, syncedRows, now, name,
+	); err != nil {
+		return "", err
+	}
+	if overwrite {
+		return fmt.Sprintf("committed version %d: exported %d rows", version, n), nil
+	}
+	return fmt.Sprintf("committed version %d: appended %d rows", version, n), nil
+}
+
+// lakeSinkColumn is a column of the table of a lake sink.
+type lakeSinkColumn struct {
+	Name string
+	Type string // the type in DuckDB
+}
+
+func lakeSinkColumns(ctx context.Context, conn *stdsql.Conn, sink *lakeSink) ([]lakeSinkColumn, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT column_name, data_type FROM duckdb_columns() "+
+		"WHERE database_name = ? AND schema_name = ? AND table_name = ? ORDER BY column_index",
+		sink.Catalog, sink.Schema, sink.Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []lakeSinkColumn
+	for rows.Next() {
+		var c lakeSinkColumn
+		if err := rows.Scan(&c.Name, &c.Type); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+var decimalTypeRegex = regexp.MustCompile(`^DECIMAL\((\d+),\s*(\d+)\)$`)
+
+// deltaColumnType returns the type of Delta Lake of a type of DuckDB, and the type of DuckDB that the values
+// are cast to before they are written, or "" if they are written as they are.
+// The types that Delta Lake does not have are written as strings.
+func deltaColumnType(duckType string) (deltaType, cast string) {
+	switch t := strings.ToUpper(duckType); t {
+	case "BOOLEAN":
+		return "boolean", ""
+	case "TINYINT":
+		return "byte", ""
+	case "SMALLINT":
+		return "short", ""
+	case "INTEGER":
+		return "integer", ""
+	case "BIGINT":
+		return "long", ""
+	case "UTINYINT":
+		return "short", "SMALLINT"
+	case "USMALLINT":
+		return "integer", "INTEGER"
+	case "UINTEGER":
+		return "long", "BIGINT"
+	case "UBIGINT":
+		return "decimal(20,0)", "DECIMAL(20,0)"
+	case "HUGEINT", "UHUGEINT":
+		return "decimal(38,0)", "DECIMAL(38,0)"
+	case "FLOAT":
+		return "float", ""
+	case "DOUBLE":
+		return "double", ""
+	case "VARCHAR":
+		return "string", ""
+	case "BLOB":
+		return "binary", ""
+	case "DATE":
+		return "date", ""
+	case "TIMESTAMP WITH TIME ZONE":
+		return "timestamp", ""
+	case "TIMESTAMP", "TIMESTAMP_S", "TIMESTAMP_MS", "TIMESTAMP_NS":
+		// The timestamps without time zone require a newer protocol, so they are written in UTC.
+		return "timestamp", "TIMESTAMPTZ"
+	default:
+		if m := decimalTypeRegex.FindStringSubmatch(t); m != nil {
+			return "decimal(" + m[1] + "," + m[2] + ")", ""
+		}
+		return "string", "VARCHAR"
+	}
+}
+
+// deltaSchema returns the projection of the columns that are written to the data files,
+// and the schema of the columns in the metadata of the Delta table.
+func deltaSchema(columns []lakeSinkColumn) (projection string, schemaString string, err error) {
+	type field struct {
+		Name     string         `json:"name"`
+		Type     string         `json:"type"`
+		Nullable bool           `json:"nullable"`
+		Metadata map[string]any `json:"metadata"`
+	}
+	fields := make([]field, len(columns))
+	exprs := make([]string, len(columns))
+	for i, c := range columns {
+		deltaType, cast := deltaColumnType(c.Type)
+		fields[i] = field{Name: c.Name, Type: deltaType, Nullable: true, Metadata: map[string]any{}}
+		exprs[i] = catalog.QuoteIdentifierANSI(c.Name)
+		if cast != "" {
+			exprs[i] = "CAST(" + exprs[i] + " AS " + cast + ") AS " + catalog.QuoteIdentifierANSI(c.Name)
+		}
+	}
+	schema, err := json.Marshal(struct {
+		Type   string  `json:"type"`
+		Fields []field `json:"fields"`
+	}{Type: "struct", Fields: fields})
+	return strings.Join(exprs, ", "), string(schema), err
+}
+
+// deltaFile is a data file added by a commit.
+type deltaFile struct {
+	Path string
+	Size int64
+}
+
+// deltaCommit is a commit of a Delta table, whose actions are written as the lines of the commit file.
+type deltaCommit struct {
+	Timestamp time.Time
+	Overwrite bool
+	TableID   string
+	Schema    string
+	// Protocol is true for the first commit, which declares the protocol of the table.
+	Protocol bool
+	// Metadata is true if the commit declares the schema of the table.
+	Metadata bool
+	Added    []deltaFile
+	Removed  []string
+}
+
+func (c *deltaCommit) lines() ([]string, error) {
+	ms := c.Timestamp.UnixMilli()
+	mode := "Append"
+	if c.Overwrite {
+		mode = "Overwrite"
+	}
+	actions := []any{
+		map[string]any{"commitInfo": map[string]any{
+			"timestamp":           ms,
+			"operation":           "WRITE",
+			"operationParameters": map[string]any{"mode": mode, "partitionBy": "[]"},
+			"engineInfo":          "myduckserver",
+		}},
+	}
+	if c.Protocol {
+		actions = append(actions, map[string]any{"protocol": map[string]any{"minReaderVersion": 1, "minWriterVersion": 2}})
+	}
+	if c.Metadata {
+		actions = append(actions, map[string]any{"metaData": map[string]any{
+			"id":               c.TableID,
+			"format":           map[string]any{"provider": "parquet", "options": map[string]any{}},
+			"schemaString":     c.Schema,
+			"partitionColumns": []string{},
+			"configuration":    map[string]any{},
+			"createdTime":      ms,
+		}})
+	}
+	for _, path := range c.Removed {
+		actions = append(actions, map[string]any{"remove": map[string]any{
+			"path": path, "deletionTimestamp": ms, "dataChange": true,
+		}})
+	}
+	for _, f := range c.Added {
+		actions = append(actions, map[string]any{"add": map[string]any{
+			"path": f.Path, "partitionValues": map[string]any{}, "size": f.Size, "modificationTime": ms, "dataChange": true,
+		}})
+	}
+
+	lines := make([]string, len(actions))
+	for i, action := range actions {
+		b, err := json.Marshal(action)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = string(b)
+	}
+	return lines, nil
+}
+
+// deltaLogStmt returns the statement that writes the lines to a commit file as they are.
+// The lines are JSON, which escapes the control characters, so the delimiter never appears in them.
+func deltaLogStmt(url string, lines []string) string {
+	var b strings.Builder
+	b.WriteString("COPY (SELECT * FROM (VALUES ")
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("('" + strings.ReplaceAll(line, "'", "''") + "')")
+	}
+	b.WriteString(") v(line)) TO '" + strings.ReplaceAll(url, "'", "''") + "' (FORMAT csv, HEADER false, QUOTE '', ESCAPE '', DELIMITER '\x01')")
+	return b.String()
+}
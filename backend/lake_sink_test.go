@@ -0,0 +1,133 @@
+package backend
+
+import (
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLakeSinkStatements(t *testing.T) {
+	m := createLakeSinkRegex.FindStringSubmatch("CREATE LAKE SINK orders_lake FOR TABLE shop.orders TO 's3://bucket/lake/orders/' WITH (FORMAT delta, INTERVAL 300);")
+	require.NotNil(t, m)
+	require.Equal(t, "orders_lake", m[1])
+	require.Equal(t, "shop.orders", m[2])
+	require.Equal(t, "s3://bucket/lake/orders/", m[3])
+	interval, err := parseLakeSinkOptions(m[4])
+	require.NoError(t, err)
+	require.Equal(t, 300, interval)
+
+	require.True(t, IsLakeSinkStatement("create lake sink s for orders to 's3://b/o'"))
+	require.True(t, IsLakeSinkStatement("DROP LAKE SINK IF EXISTS s"))
+	require.False(t, IsLakeSinkStatement("CREATE TABLE s (x int)"))
+
+	interval, err = parseLakeSinkOptions("")
+	require.NoError(t, err)
+	require.Equal(t, DefaultLakeSinkInterval, interval)
+	interval, err = parseLakeSinkOptions("INTERVAL = 0")
+	require.NoError(t, err)
+	require.Zero(t, interval)
+	_, err = parseLakeSinkOptions("FORMAT iceberg")
+	require.ErrorContains(t, err, "unsupported format")
+	_, err = parseLakeSinkOptions("PARTITION_BY (x)")
+	require.ErrorContains(t, err, "unknown option")
+}
+
+func TestDeltaSchema(t *testing.T) {
+	projection, schema, err := deltaSchema([]lakeSinkColumn{
+		{"id", "BIGINT"},
+		{"n", "UBIGINT"},
+		{"price", "DECIMAL(10,2)"},
+		{"at", "TIMESTAMP"},
+		{"tags", "VARCHAR[]"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, `"id", CAST("n" AS DECIMAL(20,0)) AS "n", "price", CAST("at" AS TIMESTAMPTZ) AS "at", CAST("tags" AS VARCHAR) AS "tags"`, projection)
+	var parsed struct {
+		Fields []struct {
+			Name string
+			Type string
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(schema), &parsed))
+	var types []string
+	for _, f := range parsed.Fields {
+		types = append(types, f.Name+":"+f.Type)
+	}
+	require.Equal(t, []string{"id:long", "n:decimal(20,0)", "price:decimal(10,2)", "at:timestamp", "tags:string"}, types)
+}
+
+func TestSyncLakeSink(t *testing.T) {
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE SCHEMA __sys__")
+	require.NoError(t, err)
+	it := catalog.InternalTables.LakeSinks
+	_, err = db.Exec("CREATE TABLE " + it.QualifiedName() + " (" + it.DDL + ")")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE main.t (id INTEGER, name VARCHAR)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO main.t VALUES (1, 'a'), (2, 'b')")
+	require.NoError(t, err)
+
+	// The object storage creates the directories by itself, unlike the local file system.
+	location := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(location, "_delta_log"), 0755))
+	_, err = db.Exec(it.UpsertStmt(), "s", "memory", "main", "t", LakeSinkFormatDelta, location, "table-id", -1, "", "", nil, nil, time.Now())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	sync := func() string {
+		msg, err := SyncLakeSink(ctx, db, "s")
+		require.NoError(t, err)
+		return msg
+	}
+	actions := func(version int) []string {
+		b, err := os.ReadFile(filepath.Join(location, "_delta_log", strings.Repeat("0", 19)+string(rune('0'+version))+".json"))
+		require.NoError(t, err)
+		var kinds []string
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			var action map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal([]byte(line), &action), line)
+			for kind := range action {
+				kinds = append(kinds, kind)
+			}
+		}
+		return kinds
+	}
+	exported := func() int {
+		var files string
+		require.NoError(t, db.QueryRow("SELECT files FROM "+it.QualifiedName()+" WHERE sink_name = 's'").Scan(&files))
+		var n int
+		for _, file := range strings.Split(files, ",") {
+			var c int
+			require.NoError(t, db.QueryRow("SELECT count(*) FROM read_parquet(?)", filepath.Join(location, file)).Scan(&c))
+			n += c
+		}
+		return n
+	}
+
+	require.Equal(t, "committed version 0: exported 2 rows", sync())
+	require.Equal(t, []string{"commitInfo", "protocol", "metaData", "add"}, actions(0))
+	require.Equal(t, "version 0 is up to date", sync())
+
+	_, err = db.Exec("INSERT INTO main.t VALUES (3, 'c')")
+	require.NoError(t, err)
+	require.Equal(t, "committed version 1: appended 1 rows", sync())
+	require.Equal(t, []string{"commitInfo", "add"}, actions(1))
+	require.Equal(t, 3, exported())
+
+	_, err = db.Exec("DELETE FROM main.t WHERE id = 1")
+	require.NoError(t, err)
+	require.Equal(t, "committed version 2: exported 2 rows", sync())
+	require.Equal(t, []string{"commitInfo", "remove", "remove", "add"}, actions(2))
+	require.Equal(t, 2, exported())
+}
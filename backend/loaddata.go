@@ -205,25 +205,31 @@ func (db *DuckBuilder) executeLoadData(ctx *sql.Context, insert *plan.InsertInto
 	duckSQL := b.String()
 	ctx.GetLogger().Trace(duckSQL)
 
-	result, err := adapter.Exec(ctx, duckSQL)
-	if err != nil {
-		return nil, err
+	// The AUTO_INCREMENT column that is not loaded is filled by its sequence in DuckDB.
+	if key := generatedKeyColumn(dst.Schema(), load.ColNames); key != nil {
+		affected, insertId, err := execInsertReturningKey(ctx, duckSQL, key.Name)
+		if err != nil {
+			return nil, err
+		}
+		return okResultIter(ctx, types.OkResult{
+			RowsAffected: uint64(affected),
+			InsertID:     uint64(insertId),
+		}), nil
 	}
 
-	affected, err := result.RowsAffected()
+	result, err := adapter.Exec(ctx, duckSQL)
 	if err != nil {
 		return nil, err
 	}
 
-	insertId, err := result.LastInsertId()
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return nil, err
 	}
 
-	return sql.RowsToRowIter(sql.NewRow(types.OkResult{
+	return okResultIter(ctx, types.OkResult{
 		RowsAffected: uint64(affected),
-		InsertID:     uint64(insertId),
-	})), nil
+	}), nil
 }
 
 func singleQuotedDuckChar(s string) string {
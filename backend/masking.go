@@ -0,0 +1,417 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression"
+	"github.com/dolthub/go-mysql-server/sql/mysql_db"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	"github.com/dolthub/go-mysql-server/sql/transform"
+)
+
+// The masking policies, see catalog/masking.go, are managed by the statements below over both protocols:
+//
+//	CREATE [OR REPLACE] MASKING POLICY name ON [schema.]table (column, ...) USING method
+//	DROP MASKING POLICY [IF EXISTS] name
+//	GRANT UNMASK TO user, ...
+//	REVOKE UNMASK FROM user, ...
+//
+// They require a superuser, see checkMaskingPrivilege. The masking policies and the grants of UNMASK are changed
+// only by these statements, so the statements that change them directly are refused, see checkProtectedTableWrite.
+// Over MySQL, the result columns are mapped to the masked columns through the plan of the query,
+// so that an expression over a masked column, e.g., `LOWER(email)`, is returned as NULL, and the statements
+// that write the values read from a masked table, e.g., INSERT ... SELECT, are refused.
+
+const maskingIdentifier = "(?:[A-Za-z_][\\w$]*|\"(?:[^\"]|\"\")+\"|`(?:[^`]|``)+`)"
+
+var (
+	createMaskingPolicyRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+(OR\s+REPLACE\s+)?MASKING\s+POLICY\s+(` + maskingIdentifier + `)\s+ON\s+(` +
+		maskingIdentifier + `(?:\s*\.\s*` + maskingIdentifier + `)?)\s*\(([^)]*)\)\s+USING\s+(.+?)[\s;]*$`)
+	dropMaskingPolicyRegex = regexp.MustCompile(`(?is)^\s*DROP\s+MASKING\s+POLICY\s+(IF\s+EXISTS\s+)?(` + maskingIdentifier + `)[\s;]*$`)
+	grantUnmaskRegex       = regexp.MustCompile(`(?is)^\s*GRANT\s+UNMASK\s+TO\s+(.+?)[\s;]*$`)
+	revokeUnmaskRegex      = regexp.MustCompile(`(?is)^\s*REVOKE\s+UNMASK\s+FROM\s+(.+?)[\s;]*$`)
+	// maskingUserRegex matches a user name, ignoring the host of a MySQL account, e.g., 'alice'@'%'.
+	maskingUserRegex = regexp.MustCompile("^(" + maskingIdentifier + `|'(?:[^']|'')+'|[^\s@']+)(?:\s*@\s*\S+)?$`)
+)
+
+// IsMaskingStatement reports whether the query is a statement that manages the masking policies.
+func IsMaskingStatement(query string) bool {
+	return createMaskingPolicyRegex.MatchString(query) || dropMaskingPolicyRegex.MatchString(query) ||
+		grantUnmaskRegex.MatchString(query) || revokeUnmaskRegex.MatchString(query)
+}
+
+// ExecMaskingStatement executes a statement that manages the masking policies, and returns its command tag.
+// It returns false if the query is not such a statement.
+func ExecMaskingStatement(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb, query string) (tag string, ok bool, err error) {
+	switch {
+	case createMaskingPolicyRegex.MatchString(query):
+		m := createMaskingPolicyRegex.FindStringSubmatch(query)
+		if err := checkMaskingPrivilege(ctx, mysqlDb); err != nil {
+			return "", true, err
+		}
+		schema, table := ctx.GetCurrentDatabase(), unquoteMaskingIdentifier(m[3])
+		if qualifier, name, ok := splitQualifiedIdentifier(m[3]); ok {
+			schema, table = unquoteMaskingIdentifier(qualifier), unquoteMaskingIdentifier(name)
+		}
+		var columns []string
+		for _, column := range strings.Split(m[4], ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				columns = append(columns, unquoteMaskingIdentifier(column))
+			}
+		}
+		if len(columns) == 0 {
+			return "", true, fmt.Errorf("masking policy must mask at least one column")
+		}
+		name := unquoteMaskingIdentifier(m[2])
+		return "CREATE MASKING POLICY", true, catalog.CreateMaskingPolicy(ctx, name, schema, table, columns, m[5], m[1] != "")
+
+	case dropMaskingPolicyRegex.MatchString(query):
+		m := dropMaskingPolicyRegex.FindStringSubmatch(query)
+		if err := checkMaskingPrivilege(ctx, mysqlDb); err != nil {
+			return "", true, err
+		}
+		name := unquoteMaskingIdentifier(m[2])
+		dropped, err := catalog.DropMaskingPolicy(ctx, name)
+		if err == nil && !dropped && m[1] == "" {
+			err = fmt.Errorf("masking policy %q does not exist", name)
+		}
+		return "DROP MASKING POLICY", true, err
+
+	case grantUnmaskRegex.MatchString(query), revokeUnmaskRegex.MatchString(query):
+		grant := grantUnmaskRegex.MatchString(query)
+		var list string
+		if grant {
+			list = grantUnmaskRegex.FindStringSubmatch(query)[1]
+		} else {
+			list = revokeUnmaskRegex.FindStringSubmatch(query)[1]
+		}
+		users, err := parseMaskingUsers(list)
+		if err != nil {
+			return "", true, err
+		}
+		if err := checkMaskingPrivilege(ctx, mysqlDb); err != nil {
+			return "", true, err
+		}
+		for _, user := range users {
+			if grant {
+				err = catalog.GrantUnmask(ctx, user)
+			} else {
+				_, err = catalog.RevokeUnmask(ctx, user)
+			}
+			if err != nil {
+				return "", true, err
+			}
+		}
+		if grant {
+			return "GRANT", true, nil
+		}
+		return "REVOKE", true, nil
+	}
+	return "", false, nil
+}
+
+// checkMaskingPrivilege returns an error if the user may not manage the masking policies, i.e., is not a superuser.
+func checkMaskingPrivilege(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb) error {
+	return checkGlobalPrivilege(ctx, mysqlDb, sql.PrivilegeType_Super)
+}
+
+// checkGlobalPrivilege returns an error if the user does not have the global privilege given, see HasPrivilege.
+func checkGlobalPrivilege(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb, privilege sql.PrivilegeType) error {
+	if !HasPrivilege(ctx, mysqlDb, sql.PrivilegeCheckSubject{}, privilege) {
+		return sql.ErrPrivilegeCheckFailed.New(ctx.Session.Client().User)
+	}
+	return nil
+}
+
+// checkTablePrivilege checks that the user of the session has the privilege on a table, see HasPrivilege.
+func checkTablePrivilege(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb, schema, table string, privilege sql.PrivilegeType) error {
+	if !HasPrivilege(ctx, mysqlDb, sql.PrivilegeCheckSubject{Database: schema, Table: table}, privilege) {
+		return sql.ErrTableAccessDeniedForUser.New(ctx.Session.Client().User, table)
+	}
+	return nil
+}
+
+// HasPrivilege reports whether the user of the session has the privilege on the subject. The privileges are denied
+// by default: the superusers have all of them, see IsSuperuser, and the other users have those granted to their
+// MySQL accounts, so that the users that have no MySQL account have none. All of them are allowed if
+// the authentication is disabled.
+func HasPrivilege(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb, subject sql.PrivilegeCheckSubject, privilege sql.PrivilegeType) bool {
+	if mysqlDb == nil || !mysqlDb.Enabled() || IsSuperuser(ctx, mysqlDb) {
+		return true
+	}
+	client := ctx.Session.Client()
+	rd := mysqlDb.Reader()
+	account := mysqlDb.GetUser(rd, client.User, client.Address, false)
+	rd.Close()
+	return account != nil && mysqlDb.UserHasPrivileges(ctx, sql.NewPrivilegedOperation(subject, privilege))
+}
+
+// parseMaskingUsers parses a comma-separated list of user names.
+func parseMaskingUsers(list string) ([]string, error) {
+	var users []string
+	for _, user := range strings.Split(list, ",") {
+		m := maskingUserRegex.FindStringSubmatch(strings.TrimSpace(user))
+		if m == nil {
+			return nil, fmt.Errorf("invalid user name: %q", strings.TrimSpace(user))
+		}
+		users = append(users, unquoteMaskingIdentifier(m[1]))
+	}
+	return users, nil
+}
+
+// splitQualifiedIdentifier splits `schema.name` at the dot outside of the quotes.
+func splitQualifiedIdentifier(s string) (qualifier, name string, ok bool) {
+	var quote rune
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case c == '.':
+			return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// unquoteMaskingIdentifier removes the quotes of an identifier or a string.
+func unquoteMaskingIdentifier(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 {
+		switch q := s[0]; q {
+		case '"', '`', '\'':
+			if s[len(s)-1] == q {
+				return strings.ReplaceAll(s[1:len(s)-1], string([]byte{q, q}), string(q))
+			}
+		}
+	}
+	return s
+}
+
+// maskResults wraps the iterator of the result of root with the masks of its columns for the user of the session.
+func maskResults(ctx *sql.Context, root sql.Node, iter sql.RowIter) (sql.RowIter, error) {
+	masking, err := catalog.SessionMasking(ctx)
+	if err != nil || masking == nil {
+		return iter, err
+	}
+	return NewMaskingIter(iter, planMasks(ctx, masking, root)), nil
+}
+
+// checkMaskedWrite returns an error if a statement writes the values that it reads from a masked table,
+// e.g., INSERT ... SELECT or CREATE TABLE ... AS SELECT, which would copy them unmasked.
+func checkMaskedWrite(ctx *sql.Context, root sql.Node) error {
+	if root.IsReadOnly() {
+		return nil
+	}
+	masking, err := catalog.SessionMasking(ctx)
+	if err != nil || masking == nil {
+		return err
+	}
+	var source sql.Node
+	transform.Inspect(root, func(n sql.Node) bool {
+		switch n := n.(type) {
+		case *plan.InsertInto:
+			if containsMaskedTable(ctx, masking, n.Source) || exprsReadMaskedTable(ctx, masking, n.OnDupExprs) {
+				source = n
+			}
+			return false
+		case *plan.CreateTable:
+			if sel := n.Select(); sel != nil && containsMaskedTable(ctx, masking, sel) {
+				source = n
+			}
+			return false
+		case *plan.UpdateSource:
+			// The SET expressions may copy the masked columns of the rows, or read the other masked tables.
+			masks := planMasks(ctx, masking, n.Child)
+			for _, e := range n.UpdateExprs {
+				if set, ok := e.(*expression.SetField); ok && expressionMasks(ctx, masking, []sql.Expression{set.RightChild}, masks)[0] != nil {
+					source = n
+				}
+			}
+			return false
+		}
+		return source == nil
+	})
+	if source != nil {
+		return fmt.Errorf("permission denied to copy the values of a masked table")
+	}
+	return nil
+}
+
+// exprsReadMaskedTable reports whether any of the expressions reads a masked table in a subquery.
+func exprsReadMaskedTable(ctx *sql.Context, masking *catalog.Masking, exprs []sql.Expression) bool {
+	masked := false
+	for _, e := range exprs {
+		sql.Inspect(e, func(e sql.Expression) bool {
+			if sq, ok := e.(*plan.Subquery); ok {
+				masked = masked || containsMaskedTable(ctx, masking, sq.Query)
+			}
+			return !masked
+		})
+	}
+	return masked
+}
+
+// nullMask masks the values derived from a masked column.
+func nullMask(any) any { return nil }
+
+// planMasks returns the functions that mask the result columns of n, which are nil for the unmasked columns.
+func planMasks(ctx *sql.Context, masking *catalog.Masking, n sql.Node) []func(any) any {
+	masks := make([]func(any) any, len(n.Schema()))
+	switch n := n.(type) {
+	case *plan.ResolvedTable:
+		for i, col := range n.Schema() {
+			masks[i] = masking.Mask(n.Database().Name(), n.Name(), col.Name)
+		}
+		return masks
+	case *plan.SubqueryAlias:
+		// A view may be masked by itself, besides the tables that it selects from.
+		copy(masks, planMasks(ctx, masking, n.Child))
+		if masking.IsMaskedTable(ctx.GetCurrentDatabase(), n.Name()) {
+			for i, col := range n.Schema() {
+				if mask := masking.Mask(ctx.GetCurrentDatabase(), n.Name(), col.Name); mask != nil {
+					masks[i] = mask
+				}
+			}
+		}
+		return masks
+	case *plan.TableAlias, *plan.Filter, *plan.Having, *plan.Sort, *plan.TopN, *plan.Limit, *plan.Offset,
+		*plan.Distinct, *plan.OrderedDistinct, *plan.IndexedTableAccess, *plan.StripRowNode:
+		copy(masks, planMasks(ctx, masking, n.Children()[0]))
+		return masks
+	case *plan.Project:
+		return expressionMasks(ctx, masking, n.Projections, planMasks(ctx, masking, n.Child))
+	case *plan.GroupBy:
+		return expressionMasks(ctx, masking, n.SelectedExprs, planMasks(ctx, masking, n.Child))
+	case *plan.Window:
+		return expressionMasks(ctx, masking, n.SelectExprs, planMasks(ctx, masking, n.Child))
+	case *plan.JoinNode:
+		left := planMasks(ctx, masking, n.Left())
+		copy(masks, left)
+		copy(masks[min(len(left), len(masks)):], planMasks(ctx, masking, n.Right()))
+		return masks
+	case *plan.SetOp:
+		for _, side := range []sql.Node{n.Left(), n.Right()} {
+			for i, mask := range planMasks(ctx, masking, side) {
+				if mask != nil && i < len(masks) {
+					masks[i] = nullMask
+				}
+			}
+		}
+		return masks
+	}
+	// The columns of the other nodes cannot be traced, so all of them are masked if a masked table is read.
+	if containsMaskedTable(ctx, masking, n) {
+		for i := range masks {
+			masks[i] = nullMask
+		}
+	}
+	return masks
+}
+
+// expressionMasks returns the masks of the columns computed by the expressions from a row with the given masks.
+// A column that is a masked column of the row keeps its mask, and a column derived from a masked column is NULL.
+func expressionMasks(ctx *sql.Context, masking *catalog.Masking, exprs []sql.Expression, input []func(any) any) []func(any) any {
+	masks := make([]func(any) any, len(exprs))
+	anyMasked := false
+	for _, mask := range input {
+		anyMasked = anyMasked || mask != nil
+	}
+	for i, e := range exprs {
+		if alias, ok := e.(*expression.Alias); ok {
+			e = alias.Child
+		}
+		if field, ok := e.(*expression.GetField); ok && field.Index() >= 0 && field.Index() < len(input) {
+			masks[i] = input[field.Index()]
+			continue
+		}
+		derived := false
+		sql.Inspect(e, func(e sql.Expression) bool {
+			switch e := e.(type) {
+			case *expression.GetField:
+				// A field out of the row is from an outer scope, which is masked conservatively.
+				if e.Index() < 0 || e.Index() >= len(input) {
+					derived = derived || anyMasked
+				} else {
+					derived = derived || input[e.Index()] != nil
+				}
+			case *plan.Subquery:
+				derived = derived || containsMaskedTable(ctx, masking, e.Query)
+			}
+			return !derived
+		})
+		if derived {
+			masks[i] = nullMask
+		}
+	}
+	return masks
+}
+
+// containsMaskedTable reports whether n reads a masked table or view, including in its subqueries.
+func containsMaskedTable(ctx *sql.Context, masking *catalog.Masking, n sql.Node) bool {
+	switch n := n.(type) {
+	case *plan.ResolvedTable:
+		return masking.IsMaskedTable(n.Database().Name(), n.Name())
+	case *plan.SubqueryAlias:
+		if masking.IsMaskedTable(ctx.GetCurrentDatabase(), n.Name()) {
+			return true
+		}
+	}
+	if n, ok := n.(sql.Expressioner); ok {
+		masked := false
+		for _, e := range n.Expressions() {
+			sql.Inspect(e, func(e sql.Expression) bool {
+				if sq, ok := e.(*plan.Subquery); ok {
+					masked = masked || containsMaskedTable(ctx, masking, sq.Query)
+				}
+				return !masked
+			})
+		}
+		if masked {
+			return true
+		}
+	}
+	for _, child := range n.Children() {
+		if containsMaskedTable(ctx, masking, child) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewMaskingIter returns the iterator that masks the columns of the rows of iter with the non-nil masks.
+func NewMaskingIter(iter sql.RowIter, masks []func(any) any) sql.RowIter {
+	for _, mask := range masks {
+		if mask != nil {
+			return &maskingIter{RowIter: iter, masks: masks}
+		}
+	}
+	return iter
+}
+
+// maskingIter masks the values of the rows of its RowIter.
+type maskingIter struct {
+	sql.RowIter
+	masks []func(any) any
+}
+
+func (it *maskingIter) Next(ctx *sql.Context) (sql.Row, error) {
+	row, err := it.RowIter.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	masked := row.Copy()
+	for i, mask := range it.masks {
+		if mask != nil && i < len(masked) && masked[i] != nil {
+			masked[i] = mask(masked[i])
+		}
+	}
+	return masked, nil
+}
@@ -0,0 +1,70 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/mysql_db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsMaskingStatement(t *testing.T) {
+	for _, query := range []string{
+		"CREATE MASKING POLICY p ON users (email) USING email",
+		"create or replace masking policy \"p\" on db.users (email, `phone`) using partial(0, 4);",
+		"DROP MASKING POLICY IF EXISTS p",
+		"GRANT UNMASK TO 'alice'@'%', bob",
+		"REVOKE UNMASK FROM alice",
+	} {
+		require.True(t, IsMaskingStatement(query), query)
+	}
+	for _, query := range []string{
+		"CREATE TABLE p (a INT)",
+		"DROP POLICY p ON t",
+		"GRANT SELECT ON t TO alice",
+		"REVOKE ALL ON t FROM alice",
+	} {
+		require.False(t, IsMaskingStatement(query), query)
+	}
+}
+
+func TestParseMaskingUsers(t *testing.T) {
+	users, err := parseMaskingUsers(`'alice'@'%', bob , "Carol", ` + "`dave`@localhost")
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice", "bob", "Carol", "dave"}, users)
+
+	_, err = parseMaskingUsers("alice bob")
+	require.Error(t, err)
+}
+
+func TestSplitQualifiedIdentifier(t *testing.T) {
+	schema, table, ok := splitQualifiedIdentifier(`"my.db" . users`)
+	require.True(t, ok)
+	require.Equal(t, "my.db", unquoteMaskingIdentifier(schema))
+	require.Equal(t, "users", unquoteMaskingIdentifier(table))
+
+	_, _, ok = splitQualifiedIdentifier("`a.b`")
+	require.False(t, ok)
+}
+
+func TestHasPrivilege(t *testing.T) {
+	mysqlDb := mysql_db.CreateEmptyMySQLDb()
+	contextOf := func(user string) *sql.Context {
+		session := sql.NewBaseSessionWithClientServer("", sql.Client{User: user, Address: "localhost"}, 1)
+		return sql.NewContext(context.Background(), sql.WithSession(session))
+	}
+	subject := sql.PrivilegeCheckSubject{Database: "db", Table: "t"}
+
+	// Every privilege is allowed without the authentication.
+	require.True(t, HasPrivilege(contextOf("nobody"), mysqlDb, subject, sql.PrivilegeType_Insert))
+
+	mysqlDb.SetEnabled(true)
+	ed := mysqlDb.Editor()
+	mysqlDb.AddSuperUser(ed, "root", "%", "")
+	ed.Close()
+	require.True(t, HasPrivilege(contextOf("root"), mysqlDb, subject, sql.PrivilegeType_Insert))
+	// The users that have no MySQL account are denied.
+	require.False(t, HasPrivilege(contextOf("nobody"), mysqlDb, subject, sql.PrivilegeType_Insert))
+	require.True(t, sql.ErrPrivilegeCheckFailed.Is(checkGlobalPrivilege(contextOf("nobody"), mysqlDb, sql.PrivilegeType_Super)))
+}
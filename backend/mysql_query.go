@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression"
+)
+
+// MySQLQueryTable is the mysql_query table function of the MySQL protocol, which runs a query on another MySQL
+// server through the mysql extension of DuckDB, see catalog/mysql_scanner.go:
+//
+//	SELECT * FROM mysql_query('replication_source', 'SELECT * FROM db.t WHERE id > 100') AS src;
+//
+// The schema of the result is determined when the query is planned, so both arguments must be literals.
+type MySQLQueryTable struct {
+	provider *catalog.DatabaseProvider
+	db       sql.Database
+	source   string
+	query    string
+	name     string // the name of the attached source
+	schema   sql.Schema
+}
+
+var _ sql.TableFunction = (*MySQLQueryTable)(nil)
+var _ sql.ExecSourceRel = (*MySQLQueryTable)(nil)
+var _ sql.CollationCoercible = (*MySQLQueryTable)(nil)
+
+// NewMySQLQueryFunction returns the mysql_query table function to be registered to the provider.
+func NewMySQLQueryFunction(provider *catalog.DatabaseProvider) *MySQLQueryTable {
+	return &MySQLQueryTable{provider: provider}
+}
+
+// NewInstance implements sql.TableFunction.
+func (t *MySQLQueryTable) NewInstance(ctx *sql.Context, db sql.Database, args []sql.Expression) (sql.Node, error) {
+	if len(args) != 2 {
+		return nil, sql.ErrInvalidArgumentNumber.New(t.Name(), 2, len(args))
+	}
+	var values [2]string
+	for i, arg := range args {
+		lit, ok := arg.(*expression.Literal)
+		if !ok {
+			return nil, sql.ErrInvalidArgumentDetails.New(t.Name(), "the source and the query must be string literals")
+		}
+		value, ok := lit.Value().(string)
+		if !ok {
+			return nil, sql.ErrInvalidArgumentDetails.New(t.Name(), "the source and the query must be string literals")
+		}
+		values[i] = value
+	}
+
+	name, err := t.provider.AttachMySQLSource(ctx, values[0])
+	if err != nil {
+		return nil, err
+	}
+	schema, err := t.provider.MySQLQuerySchema(ctx, name, values[1], t.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &MySQLQueryTable{
+		provider: t.provider,
+		db:       db,
+		source:   values[0],
+		query:    values[1],
+		name:     name,
+		schema:   schema,
+	}, nil
+}
+
+// RowIter implements sql.ExecSourceRel.
+func (t *MySQLQueryTable) RowIter(ctx *sql.Context, _ sql.Row) (sql.RowIter, error) {
+	rows, err := adapter.Query(ctx, catalog.MySQLQueryStmt(t.name, t.query))
+	if err != nil {
+		return nil, err
+	}
+	return NewSQLRowIter(rows, t.schema)
+}
+
+func (t *MySQLQueryTable) Name() string {
+	return "mysql_query"
+}
+
+func (t *MySQLQueryTable) Description() string {
+	return "runs a query on another MySQL server"
+}
+
+func (t *MySQLQueryTable) Resolved() bool {
+	return true
+}
+
+func (t *MySQLQueryTable) IsReadOnly() bool {
+	return true
+}
+
+// String does not show the source, which may contain a password.
+func (t *MySQLQueryTable) String() string {
+	return fmt.Sprintf("mysql_query(%s)", t.query)
+}
+
+func (t *MySQLQueryTable) Schema() sql.Schema {
+	return t.schema
+}
+
+func (t *MySQLQueryTable) Children() []sql.Node {
+	return nil
+}
+
+func (t *MySQLQueryTable) WithChildren(children ...sql.Node) (sql.Node, error) {
+	if len(children) != 0 {
+		return nil, sql.ErrInvalidChildrenNumber.New(t, len(children), 0)
+	}
+	return t, nil
+}
+
+func (t *MySQLQueryTable) Expressions() []sql.Expression {
+	return nil
+}
+
+func (t *MySQLQueryTable) WithExpressions(exprs ...sql.Expression) (sql.Node, error) {
+	if len(exprs) != 0 {
+		return nil, sql.ErrInvalidChildrenNumber.New(t, len(exprs), 0)
+	}
+	return t, nil
+}
+
+func (t *MySQLQueryTable) Database() sql.Database {
+	return t.db
+}
+
+func (t *MySQLQueryTable) WithDatabase(db sql.Database) (sql.Node, error) {
+	nt := *t
+	nt.db = db
+	return &nt, nil
+}
+
+func (t *MySQLQueryTable) CollationCoercibility(ctx *sql.Context) (collation sql.CollationID, coercibility byte) {
+	return sql.Collation_binary, 5
+}
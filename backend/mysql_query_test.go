@@ -0,0 +1,33 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLQueryTable(t *testing.T) {
+	fn := NewMySQLQueryFunction(&catalog.DatabaseProvider{})
+	ctx := sql.NewEmptyContext()
+	source := expression.NewLiteral("replication_source", types.Text)
+	query := expression.NewLiteral("SELECT 1", types.Text)
+
+	_, err := fn.NewInstance(ctx, nil, []sql.Expression{source})
+	require.True(t, sql.ErrInvalidArgumentNumber.Is(err), err)
+
+	_, err = fn.NewInstance(ctx, nil, []sql.Expression{source, expression.NewLiteral(1, types.Int64)})
+	require.True(t, sql.ErrInvalidArgumentDetails.Is(err), err)
+
+	_, err = fn.NewInstance(ctx, nil, []sql.Expression{source, query})
+	require.ErrorIs(t, err, catalog.ErrMySQLScannerUnavailable)
+
+	// The queries calling mysql_query are never run in DuckDB directly.
+	node := plan.NewTableAlias("src", fn)
+	require.True(t, callsMySQLQuery(node))
+	require.False(t, IsPureDataQuery(node))
+}
@@ -0,0 +1,73 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	ast "github.com/dolthub/vitess/go/vt/sqlparser"
+)
+
+// Parser is the MySQL parser of go-mysql-server, extended to accept the syntax that it cannot parse
+// but that we can handle otherwise:
+//
+//   - The partitioning clause of CREATE TABLE is removed. See catalog.LocatePartitionClause.
+//   - The types `VECTOR(n)` are replaced with JSON of the same length. See catalog.ReplaceVectorTypes.
+//
+// It also makes `EXPLAIN FORMAT=TREE` return the plan in a single column, see executeExplain.
+//
+// The query of the *sql.Context keeps the original text, so the removed parts can be looked up later.
+type Parser struct {
+	sql.MysqlParser
+}
+
+var _ sql.Parser = (*Parser)(nil)
+
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// ParseSimple implements sql.Parser.
+func (p *Parser) ParseSimple(query string) (ast.Statement, error) {
+	query, _ = catalog.ReplaceVectorTypes(query)
+	query, _, _ = catalog.RemovePartitionClause(query)
+	stmt, err := p.MysqlParser.ParseSimple(query)
+	withTreeExplain(stmt)
+	return stmt, err
+}
+
+// Parse implements sql.Parser.
+func (p *Parser) Parse(ctx *sql.Context, query string, multi bool) (ast.Statement, string, string, error) {
+	return p.ParseWithOptions(ctx, query, ';', multi, sql.LoadSqlMode(ctx).ParserOptions())
+}
+
+// ParseWithOptions implements sql.Parser.
+func (p *Parser) ParseWithOptions(ctx context.Context, query string, delimiter rune, multi bool, options ast.ParserOptions) (ast.Statement, string, string, error) {
+	query = sql.RemoveSpaceAndDelimiter(query, delimiter)
+	replaced, vectors := catalog.ReplaceVectorTypes(query)
+	stripped, _, removed := catalog.RemovePartitionClause(replaced)
+	stmt, parsed, remainder, err := p.MysqlParser.ParseWithOptions(ctx, stripped, delimiter, multi, options)
+	withTreeExplain(stmt)
+	if err == nil && (removed > 0 || vectors) {
+		// Return the original text of the parsed statement, which is what the handler executes.
+		// The removed text belongs to the first statement, while the vector types of the remainder are restored,
+		// since the replacement keeps the positions.
+		parsed = sql.RemoveSpaceAndDelimiter(query[:len(query)-len(remainder)], delimiter)
+		remainder = query[len(query)-len(remainder):]
+	}
+	return stmt, parsed, remainder, err
+}
+
+// ParseOneWithOptions implements sql.Parser.
+func (p *Parser) ParseOneWithOptions(ctx context.Context, query string, options ast.ParserOptions) (ast.Statement, int, error) {
+	// The replacement of the vector types keeps the positions.
+	query, _ = catalog.ReplaceVectorTypes(query)
+	stripped, start, removed := catalog.RemovePartitionClause(query)
+	stmt, end, err := p.MysqlParser.ParseOneWithOptions(ctx, stripped, options)
+	withTreeExplain(stmt)
+	if end > start {
+		// Map the end of the statement back to the original query.
+		end += removed
+	}
+	return stmt, end, err
+}
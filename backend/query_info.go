@@ -0,0 +1,102 @@
+package backend
+
+import (
+	stdsql "database/sql"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression/function"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	"github.com/dolthub/go-mysql-server/sql/transform"
+	"github.com/dolthub/go-mysql-server/sql/types"
+)
+
+// The metrics of the last statement of a session, i.e., ROW_COUNT(), FOUND_ROWS() and LAST_INSERT_ID(),
+// are kept in the query info of the session. The engine records them in its row update accumulators
+// and in the tracked iterator of the results; the statements executed in DuckDB record them here.
+
+// okResultIter returns the iterator of the OK result of a DML statement executed in DuckDB,
+// and records the affected rows as ROW_COUNT() of the session, as the accumulators of the engine do.
+// A non-zero InsertID, i.e., the first key generated by the statement, is recorded as LAST_INSERT_ID().
+func okResultIter(ctx *sql.Context, res types.OkResult) sql.RowIter {
+	ctx.SetLastQueryInfoInt(sql.RowCount, int64(res.RowsAffected))
+	if res.InsertID != 0 {
+		ctx.SetLastQueryInfoInt(sql.LastInsertId, int64(res.InsertID))
+	}
+	return sql.RowsToRowIter(sql.NewRow(res))
+}
+
+// generatedKeyColumn returns the AUTO_INCREMENT column of the schema if the rows inserted into the given columns,
+// or into all columns if none is given, leave it to be generated by its sequence. Otherwise, it returns nil.
+func generatedKeyColumn(schema sql.Schema, columns []string) *sql.Column {
+	if len(columns) == 0 {
+		return nil
+	}
+	for _, col := range schema {
+		if !col.AutoIncrement {
+			continue
+		}
+		for _, name := range columns {
+			if strings.EqualFold(name, col.Name) {
+				return nil
+			}
+		}
+		return col
+	}
+	return nil
+}
+
+// execInsertReturningKey executes an INSERT statement in DuckDB whose rows get their keys in the given column
+// from its sequence, and returns the number of the inserted rows and the first generated key.
+// The result of DuckDB does not report the generated keys, i.e., its LastInsertId is always zero,
+// so the keys are returned by the statement instead.
+func execInsertReturningKey(ctx *sql.Context, duckSQL string, column string) (affected int64, firstKey int64, err error) {
+	rows, err := adapter.Query(ctx, duckSQL+" RETURNING "+catalog.QuoteIdentifierANSI(column))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+	return scanFirstKey(rows)
+}
+
+// scanFirstKey counts the keys returned by an INSERT statement and finds the first one.
+func scanFirstKey(rows *stdsql.Rows) (count int64, firstKey int64, err error) {
+	for rows.Next() {
+		var key stdsql.NullInt64
+		if err := rows.Scan(&key); err != nil {
+			return 0, 0, err
+		}
+		count++
+		// The sequence generates the keys of a statement in ascending order, but DuckDB may return the rows in any order.
+		if key.Valid && (firstKey == 0 || key.Int64 < firstKey) {
+			firstKey = key.Int64
+		}
+	}
+	return count, firstKey, rows.Err()
+}
+
+// calcsFoundRows returns whether the query is a `SELECT SQL_CALC_FOUND_ROWS ... LIMIT`,
+// whose FOUND_ROWS() is counted by the engine while it applies the limit.
+func calcsFoundRows(n sql.Node) bool {
+	return transform.InspectUp(n, func(n sql.Node) bool {
+		switch n := n.(type) {
+		case *plan.Limit:
+			return n.CalcFoundRows
+		case *plan.TopN:
+			return n.CalcFoundRows
+		}
+		return false
+	})
+}
+
+// isQueryInfoFunction returns whether the function reads the metrics of the last statement of the session,
+// which DuckDB knows nothing about.
+func isQueryInfoFunction(fe sql.FunctionExpression) bool {
+	switch fe.(type) {
+	case *function.RowCount, *function.FoundRows, *function.LastInsertId:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package backend
+
+import (
+	"context"
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression"
+	"github.com/dolthub/go-mysql-server/sql/expression/function"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOkResultIter(t *testing.T) {
+	provider := memory.NewDBProvider()
+	ctx := sql.NewContext(context.Background(), sql.WithSession(memory.NewSession(sql.NewBaseSession(), provider)))
+
+	rows, err := sql.RowIterToRows(ctx, okResultIter(ctx, types.OkResult{RowsAffected: 3}))
+	require.NoError(t, err)
+	require.Equal(t, []sql.Row{{types.OkResult{RowsAffected: 3}}}, rows)
+	require.EqualValues(t, 3, ctx.GetLastQueryInfoInt(sql.RowCount))
+}
+
+func TestCalcsFoundRows(t *testing.T) {
+	limit := plan.NewLimit(expression.NewLiteral(10, types.Int64), plan.NewProject(nil, plan.NewEmptyTableWithSchema(nil)))
+	require.False(t, calcsFoundRows(limit))
+	require.True(t, calcsFoundRows(limit.WithCalcFoundRows(true)))
+	require.True(t, calcsFoundRows(plan.NewProject(nil, limit.WithCalcFoundRows(true))))
+}
+
+func TestIsQueryInfoFunction(t *testing.T) {
+	lastInsertId, err := function.NewLastInsertId()
+	require.NoError(t, err)
+	require.True(t, isQueryInfoFunction(function.NewRowCount().(sql.FunctionExpression)))
+	require.True(t, isQueryInfoFunction(function.NewFoundRows().(sql.FunctionExpression)))
+	require.True(t, isQueryInfoFunction(lastInsertId.(sql.FunctionExpression)))
+	require.False(t, isQueryInfoFunction(function.NewDatabase().(sql.FunctionExpression)))
+}
+
+func TestGeneratedKeyColumn(t *testing.T) {
+	schema := sql.Schema{
+		{Name: "id", Type: types.Int64, AutoIncrement: true},
+		{Name: "name", Type: types.Text},
+	}
+	require.Nil(t, generatedKeyColumn(schema, nil))
+	require.Nil(t, generatedKeyColumn(schema, []string{"ID", "name"}))
+	require.Equal(t, schema[0], generatedKeyColumn(schema, []string{"name"}))
+	require.Nil(t, generatedKeyColumn(schema[1:], []string{"name"}))
+}
+
+func TestScanFirstKey(t *testing.T) {
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE SEQUENCE s START 5; CREATE TABLE t (id BIGINT DEFAULT nextval('s'), name VARCHAR)")
+	require.NoError(t, err)
+
+	insert := func(query string) (int64, int64) {
+		rows, err := db.Query(query + ` RETURNING "id"`)
+		require.NoError(t, err)
+		defer rows.Close()
+		count, firstKey, err := scanFirstKey(rows)
+		require.NoError(t, err)
+		return count, firstKey
+	}
+	count, firstKey := insert("INSERT INTO t (name) SELECT 'n' || i FROM range(3) r(i)")
+	require.EqualValues(t, 3, count)
+	require.EqualValues(t, 5, firstKey)
+	count, firstKey = insert("INSERT INTO t (name) VALUES ('x')")
+	require.EqualValues(t, 1, count)
+	require.EqualValues(t, 8, firstKey)
+	count, firstKey = insert("INSERT INTO t (name) SELECT 'y' WHERE false")
+	require.Zero(t, count)
+	require.Zero(t, firstKey)
+
+	provider := memory.NewDBProvider()
+	ctx := sql.NewContext(context.Background(), sql.WithSession(memory.NewSession(sql.NewBaseSession(), provider)))
+	_, err = sql.RowIterToRows(ctx, okResultIter(ctx, types.OkResult{RowsAffected: 1, InsertID: 8}))
+	require.NoError(t, err)
+	require.EqualValues(t, 8, ctx.GetLastQueryInfoInt(sql.LastInsertId))
+}
@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"strings"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+)
+
+// checkQueryProfileAccess returns an error if a statement of a restricted user reads the query profiles,
+// including through the views, see catalog.QueryProfileRelations. The profiles are captured over PostgreSQL only,
+// where the users other than the superusers read their own profiles.
+func checkQueryProfileAccess(ctx *sql.Context, root sql.Node) error {
+	if sess, ok := ctx.Session.(*Session); !ok || !sess.restricted || !readsQueryProfiles(root) {
+		return nil
+	}
+	return sql.ErrTableAccessDeniedForUser.New(ctx.Session.Client().User, catalog.QueryProfilesView)
+}
+
+// readsQueryProfiles reports whether n reads the internal table of the query profiles, including in its subqueries.
+func readsQueryProfiles(n sql.Node) bool {
+	return findTable(n, func(t *plan.ResolvedTable) bool {
+		return strings.EqualFold(t.Database().Name(), catalog.InternalTables.QueryProfiles.Schema) &&
+			catalog.IsQueryProfileRelation(t.Name())
+	})
+}
+
+// findTable reports whether n accesses a table that matches, including in its subqueries.
+func findTable(n sql.Node, match func(t *plan.ResolvedTable) bool) bool {
+	if t, ok := n.(*plan.ResolvedTable); ok {
+		return match(t)
+	}
+	if n, ok := n.(sql.Expressioner); ok {
+		found := false
+		for _, e := range n.Expressions() {
+			sql.Inspect(e, func(e sql.Expression) bool {
+				if sq, ok := e.(*plan.Subquery); ok {
+					found = found || findTable(sq.Query, match)
+				}
+				return !found
+			})
+		}
+		if found {
+			return true
+		}
+	}
+	for _, child := range n.Children() {
+		if findTable(child, match) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadsQueryProfiles(t *testing.T) {
+	sys := memory.NewDatabase("__sys__")
+	other := memory.NewDatabase("db")
+	table := func(db *memory.Database, name string) *plan.ResolvedTable {
+		return plan.NewResolvedTable(memory.NewTable(db, name, sql.PrimaryKeySchema{}, nil), db, nil)
+	}
+
+	require.True(t, readsQueryProfiles(table(sys, "query_profile_log")))
+	require.True(t, readsQueryProfiles(plan.NewSubqueryAlias("p", "", plan.NewProject(nil, table(sys, "QUERY_PROFILE_LOG")))))
+	require.False(t, readsQueryProfiles(table(other, "query_profile_log")))
+	require.False(t, readsQueryProfiles(table(sys, "jobs")))
+
+	// The subqueries of the expressions are inspected as well.
+	subquery := plan.NewSubquery(table(sys, "query_profile_log"), "SELECT * FROM __sys__.query_profile_log")
+	require.True(t, readsQueryProfiles(plan.NewFilter(expression.NewNot(subquery), table(other, "t"))))
+}
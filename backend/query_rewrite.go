@@ -0,0 +1,474 @@
+package backend
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/sirupsen/logrus"
+)
+
+// The QueryRewriter patches the queries that MyDuck cannot handle, e.g., those emitted by closed-source tools,
+// before they are parsed or transpiled on either protocol. The rules are the rows of
+// catalog.InternalTables.RewriteRules, which are managed with plain DML, e.g.,
+//
+//	INSERT INTO __sys__.query_rewrite_rules (name, kind, pattern, replacement)
+//	VALUES ('bi-tool-version', 'fingerprint', 'SELECT tool_version(42)', 'SELECT $1 AS tool_version');
+//
+// A rule of kind `regex` replaces all matches of the regular expression in the query with the replacement,
+// which may refer to the submatches as `$1` or `${name}`. A rule of kind `fingerprint` replaces the whole query
+// if it has the same fingerprint as the pattern, i.e., the same tokens regardless of the case of the keywords,
+// the whitespace, the comments, and the values of the literals. Its replacement may refer to the literals
+// of the query in order as `$1`, `$2`, and so on. The enabled rules of the protocol are applied in the order
+// of their names, each to the result of the previous ones.
+//
+// The rules are reloaded by the RewriteRuleRefresher periodically, which also adds the numbers of the queries
+// rewritten by each rule to its `hits` column.
+
+// Protocols of the rewrite rules.
+const (
+	RewriteProtocolMySQL    = "mysql"
+	RewriteProtocolPostgres = "postgres"
+)
+
+// Kinds of the rewrite rules.
+const (
+	RewriteKindRegex       = "regex"
+	RewriteKindFingerprint = "fingerprint"
+)
+
+// RewriteRefreshIntervalVariable is the number of seconds between the reloads of the rewrite rules.
+const RewriteRefreshIntervalVariable = "myduck_rewrite_refresh_interval"
+
+func init() {
+	sql.SystemVariables.AddSystemVariables([]sql.SystemVariable{
+		&sql.MysqlSystemVariable{
+			Name:              RewriteRefreshIntervalVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemIntType(RewriteRefreshIntervalVariable, 1, 3600, false),
+			Default:           int64(5),
+		},
+	})
+}
+
+// DefaultRewriter is the rewriter of the queries of all sessions.
+var DefaultRewriter = NewQueryRewriter()
+
+type rewriteRule struct {
+	name        string
+	protocol    string // empty for both protocols
+	regex       *regexp.Regexp
+	fingerprint string
+	replacement string
+	// hits is the number of the queries rewritten by the rule since its hits were last saved.
+	hits *atomic.Uint64
+}
+
+type QueryRewriter struct {
+	rules atomic.Pointer[[]*rewriteRule]
+
+	mu sync.Mutex
+	// hits are the counters of the rules by name, which are kept across the reloads until they are saved.
+	hits map[string]*atomic.Uint64
+	// invalid are the rules that have failed to compile, so that each of them is reported only once.
+	invalid map[string]string
+}
+
+func NewQueryRewriter() *QueryRewriter {
+	return &QueryRewriter{
+		hits:    make(map[string]*atomic.Uint64),
+		invalid: make(map[string]string),
+	}
+}
+
+// Rewrite applies the rules of the protocol to the query.
+func (r *QueryRewriter) Rewrite(protocol string, query string) string {
+	rules := r.rules.Load()
+	if rules == nil {
+		return query
+	}
+	var fp *queryFingerprint
+	for _, rule := range *rules {
+		if rule.protocol != "" && rule.protocol != protocol {
+			continue
+		}
+		if rule.regex != nil {
+			if !rule.regex.MatchString(query) {
+				continue
+			}
+			query = rule.regex.ReplaceAllString(query, rule.replacement)
+			fp = nil
+		} else {
+			if fp == nil {
+				fp = fingerprintQuery(query)
+			}
+			if fp.text != rule.fingerprint {
+				continue
+			}
+			query = expandFingerprintTemplate(rule.replacement, fp.literals)
+			fp = nil
+		}
+		rule.hits.Add(1)
+	}
+	return query
+}
+
+// Load replaces the rules with the enabled ones in the table.
+func (r *QueryRewriter) Load(ctx context.Context, db *stdsql.DB) error {
+	rows, err := db.QueryContext(ctx,
+		"SELECT name, protocol, kind, pattern, replacement FROM "+catalog.InternalTables.RewriteRules.QualifiedName()+
+			" WHERE enabled ORDER BY name",
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rules []*rewriteRule
+	for rows.Next() {
+		var name, kind, pattern, replacement string
+		var protocol stdsql.NullString
+		if err := rows.Scan(&name, &protocol, &kind, &pattern, &replacement); err != nil {
+			return err
+		}
+		rule, err := newRewriteRule(name, protocol.String, kind, pattern, replacement)
+		if err != nil {
+			key := kind + "\x00" + pattern + "\x00" + replacement
+			if r.invalid[name] != key {
+				r.invalid[name] = key
+				logrus.WithError(err).Warnf("Ignoring the invalid query rewrite rule %q", name)
+			}
+			continue
+		}
+		delete(r.invalid, name)
+		if r.hits[name] == nil {
+			r.hits[name] = new(atomic.Uint64)
+		}
+		rule.hits = r.hits[name]
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	r.rules.Store(&rules)
+	return nil
+}
+
+// SaveHits adds the numbers of the queries rewritten by the rules since the last save to the table.
+func (r *QueryRewriter) SaveHits(ctx context.Context, db *stdsql.DB) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for name, counter := range r.hits {
+		n := counter.Swap(0)
+		if n == 0 {
+			continue
+		}
+		if _, err := db.ExecContext(ctx,
+			"UPDATE "+catalog.InternalTables.RewriteRules.QualifiedName()+
+				" SET hits = hits + ?, last_hit_at = ? WHERE name = ?",
+			n, now, name,
+		); err != nil {
+			counter.Add(n)
+			return err
+		}
+	}
+	// The counters of the deleted and disabled rules are not needed anymore once saved.
+	active := make(map[string]bool)
+	if rules := r.rules.Load(); rules != nil {
+		for _, rule := range *rules {
+			active[rule.name] = true
+		}
+	}
+	for name, counter := range r.hits {
+		if !active[name] && counter.Load() == 0 {
+			delete(r.hits, name)
+		}
+	}
+	return nil
+}
+
+func newRewriteRule(name, protocol, kind, pattern, replacement string) (*rewriteRule, error) {
+	rule := &rewriteRule{
+		name:        name,
+		protocol:    strings.ToLower(protocol),
+		replacement: replacement,
+	}
+	switch rule.protocol {
+	case "", RewriteProtocolMySQL, RewriteProtocolPostgres:
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", protocol)
+	}
+	switch strings.ToLower(kind) {
+	case RewriteKindRegex:
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		rule.regex = regex
+	case RewriteKindFingerprint:
+		fp := fingerprintQuery(pattern)
+		if err := checkFingerprintTemplate(replacement, len(fp.literals)); err != nil {
+			return nil, err
+		}
+		rule.fingerprint = fp.text
+	default:
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+	return rule, nil
+}
+
+// queryFingerprint is the normalized form of a query, where the literals are replaced with `?`.
+type queryFingerprint struct {
+	text     string
+	literals []string
+}
+
+// fingerprintQuery splits the query into tokens, drops the comments, lowercases the keywords and
+// the unquoted identifiers, and replaces the string and numeric literals with `?`.
+// The tokens are joined with single spaces, and the trailing semicolons are dropped.
+func fingerprintQuery(query string) *queryFingerprint {
+	fp := &queryFingerprint{}
+	var tokens []string
+	isIdentStart := func(c byte) bool {
+		return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+	}
+	isDigit := func(c byte) bool {
+		return c >= '0' && c <= '9'
+	}
+	// quoted returns the end of the quoted token starting at i.
+	quoted := func(i int) int {
+		quote := query[i]
+		for j := i + 1; j < len(query); j++ {
+			switch query[j] {
+			case '\\':
+				if quote == '\'' {
+					j++
+				}
+			case quote:
+				if j+1 < len(query) && query[j+1] == quote {
+					j++
+					continue
+				}
+				return j + 1
+			}
+		}
+		return len(query)
+	}
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(query)
+			}
+		case c == '\'':
+			end := quoted(i)
+			fp.literals = append(fp.literals, query[i:end])
+			tokens = append(tokens, "?")
+			i = end
+		case c == '"' || c == '`':
+			end := quoted(i)
+			tokens = append(tokens, query[i:end])
+			i = end
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(query) && (isIdentStart(query[j]) || isDigit(query[j]) || query[j] == '$') {
+				j++
+			}
+			tokens = append(tokens, strings.ToLower(query[i:j]))
+			i = j
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			// A parameter of a prepared statement of Postgres.
+			j := i + 1
+			for j < len(query) && isDigit(query[j]) {
+				j++
+			}
+			tokens = append(tokens, query[i:j])
+			i = j
+		case isDigit(c) || c == '.' && i+1 < len(query) && isDigit(query[i+1]):
+			j := i
+			for j < len(query) && (isDigit(query[j]) || query[j] == '.') {
+				j++
+			}
+			if j < len(query) && (query[j] == 'e' || query[j] == 'E') {
+				k := j + 1
+				if k < len(query) && (query[k] == '+' || query[k] == '-') {
+					k++
+				}
+				if k < len(query) && isDigit(query[k]) {
+					j = k
+					for j < len(query) && isDigit(query[j]) {
+						j++
+					}
+				}
+			}
+			fp.literals = append(fp.literals, query[i:j])
+			tokens = append(tokens, "?")
+			i = j
+		default:
+			tokens = append(tokens, query[i:i+1])
+			i++
+		}
+	}
+	for len(tokens) > 0 && tokens[len(tokens)-1] == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	fp.text = strings.Join(tokens, " ")
+	return fp
+}
+
+// fingerprintTemplateRegex matches the references to the literals in the replacement of a fingerprint rule,
+// i.e., `$1` or `${1}`, and the escaped dollar sign `$$`.
+var fingerprintTemplateRegex = regexp.MustCompile(`\$(?:\$|(\d+)|\{(\d+)\})`)
+
+func checkFingerprintTemplate(template string, literals int) error {
+	for _, m := range fingerprintTemplateRegex.FindAllStringSubmatch(template, -1) {
+		if m[0] == "$$" {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1] + m[2])
+		if n < 1 || n > literals {
+			return fmt.Errorf("the replacement refers to literal %s, but the pattern has %d literals", m[0], literals)
+		}
+	}
+	return nil
+}
+
+func expandFingerprintTemplate(template string, literals []string) string {
+	return fingerprintTemplateRegex.ReplaceAllStringFunc(template, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		n, _ := strconv.Atoi(strings.Trim(ref, "${}"))
+		if n < 1 || n > len(literals) {
+			return ref
+		}
+		return literals[n-1]
+	})
+}
+
+// JobKindRewriteRefresh is the kind, as well as the name, of the system job of the RewriteRuleRefresher.
+const JobKindRewriteRefresh = "rewrite_refresh"
+
+// The RewriteRuleRefresher reloads the rules of DefaultRewriter and saves their hits periodically.
+// It runs as the system job JobKindRewriteRefresh of the JobScheduler on the writer,
+// and in a loop of its own on a reader, which has no JobScheduler.
+type RewriteRuleRefresher struct {
+	provider *catalog.DatabaseProvider
+	rewriter *QueryRewriter
+	logger   *logrus.Entry
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewRewriteRuleRefresher(provider *catalog.DatabaseProvider) *RewriteRuleRefresher {
+	return &RewriteRuleRefresher{
+		provider: provider,
+		rewriter: DefaultRewriter,
+		logger:   logrus.WithField("component", "rewrite"),
+	}
+}
+
+// Load loads the rules.
+func (r *RewriteRuleRefresher) Load() {
+	if err := r.rewriter.Load(context.Background(), r.provider.Storage()); err != nil {
+		r.logger.WithError(err).Warnln("Failed to load the query rewrite rules")
+	}
+}
+
+// Job returns the system job that refreshes the rules every RewriteRefreshIntervalVariable seconds.
+func (r *RewriteRuleRefresher) Job() SystemJob {
+	return SystemJob{
+		Name: JobKindRewriteRefresh,
+		Interval: func() time.Duration {
+			return time.Duration(globalIntVariable(RewriteRefreshIntervalVariable)) * time.Second
+		},
+		Run: func(ctx context.Context, _ *Job) (string, error) {
+			return "", r.refresh(ctx)
+		},
+	}
+}
+
+// Start loads the rules, and then refreshes them in the background until Stop is called.
+func (r *RewriteRuleRefresher) Start() {
+	r.Load()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(globalIntVariable(RewriteRefreshIntervalVariable)) * time.Second):
+			}
+			if err := r.refresh(ctx); err != nil && ctx.Err() == nil {
+				r.logger.WithError(err).Warnln("Failed to refresh the query rewrite rules")
+			}
+		}
+	}()
+}
+
+// Stop stops the refreshes, and saves the hits counted since the last one.
+func (r *RewriteRuleRefresher) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+		r.wg.Wait()
+		r.SaveHits()
+	}
+}
+
+// SaveHits saves the hits counted since the last refresh, unless the server is a reader.
+func (r *RewriteRuleRefresher) SaveHits() {
+	if r.provider.IsReadOnly() {
+		return
+	}
+	if err := r.rewriter.SaveHits(context.Background(), r.provider.Storage()); err != nil {
+		r.logger.WithError(err).Warnln("Failed to save the hits of the query rewrite rules")
+	}
+}
+
+// refresh saves the hits of the rules, and reloads the rules.
+func (r *RewriteRuleRefresher) refresh(ctx context.Context) error {
+	db := r.provider.Storage()
+	var errs []error
+	// The hits are saved by the writer only, and the readers load the rules saved by the writer.
+	if !r.provider.IsReadOnly() {
+		if err := r.rewriter.SaveHits(ctx, db); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save the hits of the query rewrite rules: %w", err))
+		}
+	}
+	if err := r.rewriter.Load(ctx, db); err != nil {
+		errs = append(errs, fmt.Errorf("failed to reload the query rewrite rules: %w", err))
+	}
+	return errors.Join(errs...)
+}
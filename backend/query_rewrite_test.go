@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprintQuery(t *testing.T) {
+	fp := fingerprintQuery("SELECT  a, \"B\" FROM t -- comment\n WHERE id = 42 AND name = 'it''s' /* c */ AND x > 1.5e3;")
+	require.Equal(t, `select a , "B" from t where id = ? and name = ? and x > ?`, fp.text)
+	require.Equal(t, []string{"42", "'it''s'", "1.5e3"}, fp.literals)
+
+	// The parameters of the prepared statements are not literals.
+	fp = fingerprintQuery("select * from t2 where c = $1")
+	require.Equal(t, "select * from t2 where c = $1", fp.text)
+	require.Empty(t, fp.literals)
+}
+
+func TestQueryRewriter(t *testing.T) {
+	r := NewQueryRewriter()
+	require.Equal(t, "SELECT 1", r.Rewrite(RewriteProtocolMySQL, "SELECT 1"))
+
+	var rules []*rewriteRule
+	add := func(name, protocol, kind, pattern, replacement string) *rewriteRule {
+		rule, err := newRewriteRule(name, protocol, kind, pattern, replacement)
+		require.NoError(t, err)
+		rule.hits = new(atomic.Uint64)
+		rules = append(rules, rule)
+		return rule
+	}
+	tool := add("a", "", RewriteKindFingerprint, "SELECT tool_version(1) FROM dual", "SELECT $1 AS version, '$$' AS currency")
+	nvl := add("b", RewriteProtocolPostgres, RewriteKindRegex, `(?i)\bnvl\(`, "coalesce(")
+	r.rules.Store(&rules)
+
+	require.Equal(t, "SELECT 42 AS version, '$' AS currency", r.Rewrite(RewriteProtocolMySQL, "select TOOL_VERSION( 42 )\nfrom dual;"))
+	require.Equal(t, "select tool_version(42)", r.Rewrite(RewriteProtocolMySQL, "select tool_version(42)"))
+	require.Equal(t, "SELECT nvl(a, 0) FROM t", r.Rewrite(RewriteProtocolMySQL, "SELECT nvl(a, 0) FROM t"))
+	require.Equal(t, "SELECT coalesce(a, 0) FROM t", r.Rewrite(RewriteProtocolPostgres, "SELECT NVL(a, 0) FROM t"))
+	require.EqualValues(t, 1, tool.hits.Load())
+	require.EqualValues(t, 1, nvl.hits.Load())
+
+	for _, rule := range [][]string{
+		{"", RewriteKindRegex, "(unclosed", ""},
+		{"", RewriteKindFingerprint, "SELECT 1", "SELECT $2"},
+		{"", "ast", "SELECT 1", "SELECT 2"},
+		{"oracle", RewriteKindRegex, "x", "y"},
+	} {
+		_, err := newRewriteRule("bad", rule[0], rule[1], rule[2], rule[3])
+		require.Error(t, err, rule)
+	}
+}
@@ -7,9 +7,15 @@ type RequestModifier func(string, *[]ResultModifier) string
 
 // default request modifier list
 var defaultRequestModifiers = []RequestModifier{
+	applyRewriteRules,
 	replaceMariaDBCollation,
 }
 
+// applyRewriteRules applies the user-defined rewrite rules of the MySQL protocol, see QueryRewriter.
+func applyRewriteRules(query string, _ *[]ResultModifier) string {
+	return DefaultRewriter.Rewrite(RewriteProtocolMySQL, query)
+}
+
 // Newer MariaDB versions use utf8mb4_uca1400_ai_ci as the default collation,
 // which is not supported by go-mysql-server.
 // This function replaces the collation with the MySQL default utf8mb4_0900_ai_ci.
@@ -0,0 +1,223 @@
+package backend
+
+import (
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/shopspring/decimal"
+)
+
+// The result types of the functions differ between MySQL and DuckDB, e.g., FLOOR(x) returns an integer for
+// a DOUBLE or DECIMAL x in MySQL, but a DOUBLE or DECIMAL in DuckDB, and SUM(x) returns a DOUBLE or DECIMAL
+// for an integer x in MySQL, but a HUGEINT in DuckDB. The schema of a query is resolved by the engine with
+// the MySQL signatures of the functions, so the numbers scanned from DuckDB are cast to the types of the schema
+// before they are encoded, see resultConversion.
+
+// numericClass is the class of a numeric type, whose values are cast to one another.
+type numericClass int
+
+const (
+	notNumeric numericClass = iota
+	signedClass
+	unsignedClass
+	floatClass
+	decimalClass
+)
+
+// duckNumericClass returns the class of a DuckDB type by its name.
+func duckNumericClass(typeName string) numericClass {
+	switch {
+	case strings.HasPrefix(typeName, "DECIMAL"):
+		return decimalClass
+	}
+	switch typeName {
+	case "TINYINT", "SMALLINT", "INTEGER", "BIGINT", "HUGEINT":
+		return signedClass
+	case "UTINYINT", "USMALLINT", "UINTEGER", "UBIGINT", "UHUGEINT":
+		return unsignedClass
+	case "FLOAT", "DOUBLE":
+		return floatClass
+	}
+	return notNumeric
+}
+
+// mysqlNumericClass returns the class of a MySQL type.
+func mysqlNumericClass(t sql.Type) numericClass {
+	switch {
+	case types.IsSigned(t):
+		return signedClass
+	case types.IsUnsigned(t):
+		return unsignedClass
+	case types.IsFloat(t):
+		return floatClass
+	case types.IsDecimal(t):
+		return decimalClass
+	}
+	return notNumeric
+}
+
+// resultConversion returns the function that casts the values of a column of the DuckDB type to the MySQL type,
+// or nil if the values need no cast. HUGEINT values are always cast, since they are scanned as *big.Int.
+// The integers out of the range of the MySQL type are rejected instead of being wrapped around.
+func resultConversion(duckType string, expected sql.Type) func(any) (any, error) {
+	from, to := duckNumericClass(duckType), mysqlNumericClass(expected)
+	if from == notNumeric {
+		return nil
+	}
+	if to == notNumeric || to == from {
+		if duckType != "HUGEINT" && duckType != "UHUGEINT" {
+			return nil
+		}
+		to = from
+	}
+	switch to {
+	case signedClass:
+		return toInt64
+	case unsignedClass:
+		return toUint64
+	case floatClass:
+		return toFloat64
+	default:
+		return toDecimal
+	}
+}
+
+func toInt64(v any) (any, error) {
+	var b *big.Int
+	switch v := v.(type) {
+	case float64:
+		return floatToInt64(v)
+	case float32:
+		return floatToInt64(float64(v))
+	case decimal.Decimal:
+		b = v.Round(0).BigInt()
+	case *big.Int:
+		b = v
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, sql.ErrValueOutOfRange.New(v, "BIGINT")
+		}
+		return int64(v), nil
+	default:
+		return v, nil
+	}
+	if !b.IsInt64() {
+		return nil, sql.ErrValueOutOfRange.New(b, "BIGINT")
+	}
+	return b.Int64(), nil
+}
+
+func floatToInt64(v float64) (any, error) {
+	r := math.Round(v)
+	if r < math.MinInt64 || r >= math.MaxInt64 || math.IsNaN(r) {
+		return nil, sql.ErrValueOutOfRange.New(v, "BIGINT")
+	}
+	return int64(r), nil
+}
+
+func toUint64(v any) (any, error) {
+	var b *big.Int
+	switch v := v.(type) {
+	case float64:
+		return floatToUint64(v)
+	case float32:
+		return floatToUint64(float64(v))
+	case decimal.Decimal:
+		b = v.Round(0).BigInt()
+	case *big.Int:
+		b = v
+	case int8:
+		return signedToUint64(int64(v))
+	case int16:
+		return signedToUint64(int64(v))
+	case int32:
+		return signedToUint64(int64(v))
+	case int64:
+		return signedToUint64(v)
+	default:
+		return v, nil
+	}
+	if !b.IsUint64() {
+		return nil, sql.ErrValueOutOfRange.New(b, "BIGINT UNSIGNED")
+	}
+	return b.Uint64(), nil
+}
+
+func floatToUint64(v float64) (any, error) {
+	r := math.Round(v)
+	if r < 0 || r >= math.MaxUint64 || math.IsNaN(r) {
+		return nil, sql.ErrValueOutOfRange.New(v, "BIGINT UNSIGNED")
+	}
+	return uint64(r), nil
+}
+
+func signedToUint64(v int64) (any, error) {
+	if v < 0 {
+		return nil, sql.ErrValueOutOfRange.New(v, "BIGINT UNSIGNED")
+	}
+	return uint64(v), nil
+}
+
+func toFloat64(v any) (any, error) {
+	switch v := v.(type) {
+	case decimal.Decimal:
+		return v.InexactFloat64(), nil
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	case int8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	}
+	return v, nil
+}
+
+func toDecimal(v any) (any, error) {
+	switch v := v.(type) {
+	case float64:
+		return decimal.NewFromFloat(v), nil
+	case float32:
+		return decimal.NewFromFloat32(v), nil
+	case *big.Int:
+		return decimal.NewFromBigInt(v, 0), nil
+	case int8:
+		return decimal.NewFromInt(int64(v)), nil
+	case int16:
+		return decimal.NewFromInt(int64(v)), nil
+	case int32:
+		return decimal.NewFromInt(int64(v)), nil
+	case int64:
+		return decimal.NewFromInt(v), nil
+	case uint8:
+		return decimal.NewFromInt(int64(v)), nil
+	case uint16:
+		return decimal.NewFromInt(int64(v)), nil
+	case uint32:
+		return decimal.NewFromInt(int64(v)), nil
+	case uint64:
+		return decimal.NewFromBigInt(new(big.Int).SetUint64(v), 0), nil
+	}
+	return v, nil
+}
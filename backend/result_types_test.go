@@ -0,0 +1,83 @@
+package backend
+
+import (
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultConversion(t *testing.T) {
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	tests := []struct {
+		query    string
+		expected sql.Type
+		value    any
+	}{
+		// FLOOR, CEIL, and ROUND of DOUBLE and DECIMAL return integers in MySQL.
+		{"SELECT floor(2.5::DOUBLE)", types.Int32, int64(2)},
+		{"SELECT ceil(2.5::DECIMAL(4,1))", types.Int64, int64(3)},
+		// SUM of integers returns DOUBLE or DECIMAL in MySQL, but HUGEINT in DuckDB.
+		{"SELECT sum(x) FROM range(5) t(x)", types.Float64, float64(10)},
+		{"SELECT sum(x) FROM range(5) t(x)", types.MustCreateDecimalType(65, 0), decimal.NewFromInt(10)},
+		{"SELECT 12::HUGEINT", types.Int64, int64(12)},
+		{"SELECT 12::HUGEINT", types.Text, int64(12)},
+		{"SELECT 1.25::DECIMAL(4,2)", types.Float64, 1.25},
+		{"SELECT 7::UINTEGER", types.Int64, int64(7)},
+		// The unsigned integers keep their full range.
+		{"SELECT 18446744073709551615::UBIGINT", types.Uint64, uint64(18446744073709551615)},
+		{"SELECT 18446744073709551615::HUGEINT", types.Uint64, uint64(18446744073709551615)},
+		{"SELECT 4294967295::UINTEGER", types.Uint32, uint32(4294967295)},
+		// The values of the same class are not cast.
+		{"SELECT 7::INTEGER", types.Int64, int32(7)},
+		{"SELECT NULL::DOUBLE", types.Int64, nil},
+		{"SELECT 'a'", types.Int64, "a"},
+	}
+	for _, tt := range tests {
+		rows, err := db.Query(tt.query)
+		require.NoError(t, err, tt.query)
+		iter, err := NewSQLRowIter(rows, sql.Schema{{Name: "x", Type: tt.expected}})
+		require.NoError(t, err, tt.query)
+		row, err := iter.Next(sql.NewEmptyContext())
+		require.NoError(t, err, tt.query)
+		if d, ok := tt.value.(decimal.Decimal); ok {
+			require.True(t, d.Equal(row[0].(decimal.Decimal)), "%s: %v", tt.query, row[0])
+		} else {
+			require.Equal(t, tt.value, row[0], tt.query)
+		}
+		require.NoError(t, iter.Close(sql.NewEmptyContext()))
+	}
+}
+
+func TestResultConversionOutOfRange(t *testing.T) {
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	tests := []struct {
+		query    string
+		expected sql.Type
+	}{
+		{"SELECT 18446744073709551615::UBIGINT", types.Int64},
+		{"SELECT 9223372036854775808::HUGEINT", types.Int64},
+		{"SELECT -1::BIGINT", types.Uint64},
+		{"SELECT -1::HUGEINT", types.Uint64},
+		{"SELECT 18446744073709551616::HUGEINT", types.Uint64},
+		{"SELECT -1.5::DOUBLE", types.Uint64},
+	}
+	for _, tt := range tests {
+		rows, err := db.Query(tt.query)
+		require.NoError(t, err, tt.query)
+		iter, err := NewSQLRowIter(rows, sql.Schema{{Name: "x", Type: tt.expected}})
+		require.NoError(t, err, tt.query)
+		_, err = iter.Next(sql.NewEmptyContext())
+		require.True(t, sql.ErrValueOutOfRange.Is(err), "%s: %v", tt.query, err)
+		require.NoError(t, iter.Close(sql.NewEmptyContext()))
+	}
+}
@@ -0,0 +1,192 @@
+package backend
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/dolthub/go-mysql-server/sql/variables"
+)
+
+// The queries of all sessions share a single DuckDB instance, so a few large analytical queries
+// can use up the CPU and memory, and slow down the short queries of the other sessions.
+// The QueryScheduler puts the queries into two workload classes, each with a concurrency limit of its own,
+// so that the queries of one class never wait for the queries of the other class:
+//
+//   - interactive: the default class, for short OLTP-style queries.
+//   - background: for large analytical queries and batch jobs, tagged by the session.
+//
+// The sessions choose their class with the WorkloadClassVariable.
+// The replication appliers write DuckDB directly and are never queued.
+
+// WorkloadClassVariable is the session variable that sets the workload class of the queries of the session.
+const WorkloadClassVariable = "myduck_workload_class"
+
+// The workload classes.
+const (
+	WorkloadInteractive = "interactive"
+	WorkloadBackground  = "background"
+)
+
+// The system variables that limit the number of queries of a workload class that run concurrently.
+// 0 means unlimited.
+const (
+	MaxInteractiveQueriesVariable = "myduck_max_interactive_queries"
+	MaxBackgroundQueriesVariable  = "myduck_max_background_queries"
+)
+
+// DefaultScheduler is the scheduler of the queries of all sessions.
+var DefaultScheduler = NewQueryScheduler()
+
+func init() {
+	if sql.SystemVariables == nil {
+		// unlikely this would happen since init() in gms package is executed first
+		variables.InitSystemVariables()
+	}
+	sql.SystemVariables.AddSystemVariables([]sql.SystemVariable{
+		&sql.MysqlSystemVariable{
+			Name:              WorkloadClassVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Both),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemEnumType(WorkloadClassVariable, WorkloadInteractive, WorkloadBackground),
+			Default:           WorkloadInteractive,
+		},
+		newMaxQueriesVariable(MaxInteractiveQueriesVariable, WorkloadInteractive, 0),
+		newMaxQueriesVariable(MaxBackgroundQueriesVariable, WorkloadBackground, 2),
+	})
+}
+
+func newMaxQueriesVariable(name, class string, defaultLimit int) sql.SystemVariable {
+	DefaultScheduler.SetLimit(class, defaultLimit)
+	return &sql.MysqlSystemVariable{
+		Name:              name,
+		Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+		Dynamic:           true,
+		SetVarHintApplies: false,
+		Type:              types.NewSystemIntType(name, 0, 1<<16, false),
+		Default:           int64(defaultLimit),
+		NotifyChanged: func(_ sql.SystemVariableScope, value sql.SystemVarValue) error {
+			limit, _ := value.Val.(int64)
+			DefaultScheduler.SetLimit(class, int(limit))
+			return nil
+		},
+	}
+}
+
+// QueryScheduler limits the number of queries of each workload class that run concurrently.
+// The queries that exceed the limit of their class wait in a FIFO queue of the class.
+type QueryScheduler struct {
+	mu      sync.Mutex
+	classes map[string]*workloadQueue
+}
+
+type workloadQueue struct {
+	limit   int // 0 means unlimited
+	running int
+	waiting list.List // of chan struct{}, closed when the query is admitted
+}
+
+func NewQueryScheduler() *QueryScheduler {
+	return &QueryScheduler{
+		classes: map[string]*workloadQueue{
+			WorkloadInteractive: {},
+			WorkloadBackground:  {},
+		},
+	}
+}
+
+func (s *QueryScheduler) queue(class string) (*workloadQueue, error) {
+	q, ok := s.classes[strings.ToLower(class)]
+	if !ok {
+		return nil, fmt.Errorf("unknown workload class %q", class)
+	}
+	return q, nil
+}
+
+// SetLimit changes the concurrency limit of a workload class. The waiting queries are admitted if the limit is raised.
+func (s *QueryScheduler) SetLimit(class string, limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, err := s.queue(class); err == nil {
+		q.limit = limit
+		q.admit()
+	}
+}
+
+// Acquire waits until a query of the workload class can run, or the context is done.
+// The returned function must be called when the query finishes.
+func (s *QueryScheduler) Acquire(ctx context.Context, class string) (release func(), err error) {
+	s.mu.Lock()
+	q, err := s.queue(class)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	release = sync.OnceFunc(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		q.running--
+		q.admit()
+	})
+	if q.waiting.Len() == 0 && (q.limit <= 0 || q.running < q.limit) {
+		q.running++
+		s.mu.Unlock()
+		return release, nil
+	}
+	admitted := make(chan struct{})
+	elem := q.waiting.PushBack(admitted)
+	s.mu.Unlock()
+
+	select {
+	case <-admitted:
+		return release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-admitted:
+			// Admitted just before the context was done; give the slot to the next query.
+			q.running--
+			q.admit()
+		default:
+			q.waiting.Remove(elem)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Status returns the number of running and waiting queries of the workload class.
+func (s *QueryScheduler) Status(class string) (running, waiting int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, err := s.queue(class); err == nil {
+		return q.running, q.waiting.Len()
+	}
+	return 0, 0
+}
+
+// Idle reports whether no query is running or waiting in any workload class.
+func (s *QueryScheduler) Idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, q := range s.classes {
+		if q.running > 0 || q.waiting.Len() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// admit lets the waiting queries run while the limit allows. The caller must hold the lock.
+func (q *workloadQueue) admit() {
+	for q.waiting.Len() > 0 && (q.limit <= 0 || q.running < q.limit) {
+		admitted := q.waiting.Remove(q.waiting.Front()).(chan struct{})
+		q.running++
+		close(admitted)
+	}
+}
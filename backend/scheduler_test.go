@@ -0,0 +1,81 @@
+package backend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryScheduler(t *testing.T) {
+	ctx := context.Background()
+	s := NewQueryScheduler()
+	s.SetLimit(WorkloadBackground, 1)
+
+	// The interactive class is unlimited, and never waits for the background class.
+	release1, err := s.Acquire(ctx, WorkloadBackground)
+	require.NoError(t, err)
+	for range 3 {
+		release, err := s.Acquire(ctx, WorkloadInteractive)
+		require.NoError(t, err)
+		defer release()
+	}
+	running, waiting := s.Status(WorkloadInteractive)
+	require.Equal(t, 3, running)
+	require.Zero(t, waiting)
+
+	// The background queries beyond the limit wait in FIFO order.
+	admitted := make(chan int, 2)
+	releases := make(chan func(), 2)
+	for i := range 2 {
+		go func() {
+			release, err := s.Acquire(ctx, WorkloadBackground)
+			if err == nil {
+				admitted <- i
+				releases <- release
+			}
+		}()
+		require.Eventually(t, func() bool {
+			_, waiting := s.Status(WorkloadBackground)
+			return waiting == i+1
+		}, time.Second, time.Millisecond)
+	}
+	select {
+	case i := <-admitted:
+		t.Fatalf("query %d admitted beyond the limit", i)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release1()
+	release1() // releasing twice is harmless
+	require.Equal(t, 0, <-admitted)
+	running, waiting = s.Status(WorkloadBackground)
+	require.Equal(t, 1, running)
+	require.Equal(t, 1, waiting)
+
+	// Raising the limit admits the waiting queries.
+	s.SetLimit(WorkloadBackground, 2)
+	require.Equal(t, 1, <-admitted)
+	(<-releases)()
+	(<-releases)()
+	running, waiting = s.Status(WorkloadBackground)
+	require.Zero(t, running)
+	require.Zero(t, waiting)
+
+	// A waiting query can be canceled.
+	s.SetLimit(WorkloadBackground, 1)
+	release, err := s.Acquire(ctx, WorkloadBackground)
+	require.NoError(t, err)
+	canceled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = s.Acquire(canceled, WorkloadBackground)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	release()
+	running, waiting = s.Status(WorkloadBackground)
+	require.Zero(t, running)
+	require.Zero(t, waiting)
+
+	_, err = s.Acquire(ctx, "batch")
+	require.ErrorContains(t, err, "unknown workload class")
+}
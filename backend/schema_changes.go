@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/apecloud/myduckserver/mycontext"
+	"github.com/apecloud/myduckserver/mysqlutil"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+)
+
+// recordSchemaChanges records the schema changes made by a DDL statement of the session, including the ones
+// applied by the binlog replication, which are published when the transaction is committed, see catalog.SchemaChange.
+func recordSchemaChanges(ctx *sql.Context, node sql.Node) {
+	sess, ok := ctx.Session.(*Session)
+	if !ok || !mysqlutil.CauseSchemaChange(node) {
+		return
+	}
+	sess.schemaChanges = append(sess.schemaChanges, schemaChangesOf(ctx, node)...)
+}
+
+// schemaChangesOf returns the schema changes made by a DDL statement. A MySQL database is a schema of DuckDB.
+func schemaChangesOf(ctx *sql.Context, node sql.Node) []catalog.SchemaChange {
+	origin := catalog.SchemaChangeLocal
+	if mycontext.IsReplicationQuery(ctx) {
+		origin = catalog.SchemaChangeReplication
+	}
+	change := func(command, objectType, schema, name string) catalog.SchemaChange {
+		if schema == "" {
+			schema = ctx.GetCurrentDatabase()
+		}
+		return catalog.SchemaChange{
+			Command:      command,
+			ObjectType:   objectType,
+			Database:     adapter.GetCurrentCatalog(ctx),
+			Schema:       schema,
+			Name:         name,
+			Origin:       origin,
+			ConnectionID: ctx.Session.ID(),
+		}
+	}
+	table := func(command string, table sql.Node) catalog.SchemaChange {
+		schema, name := tableNodeName(table)
+		return change(command, catalog.SchemaObjectTable, schema, name)
+	}
+
+	switch n := node.(type) {
+	case *plan.CreateDB:
+		return []catalog.SchemaChange{change("CREATE DATABASE", catalog.SchemaObjectSchema, n.DbName, "")}
+	case *plan.DropDB:
+		return []catalog.SchemaChange{change("DROP DATABASE", catalog.SchemaObjectSchema, n.DbName, "")}
+	case *plan.AlterDB:
+		return []catalog.SchemaChange{change("ALTER DATABASE", catalog.SchemaObjectSchema, n.Database(ctx), "")}
+	case *plan.CreateTable:
+		return []catalog.SchemaChange{change("CREATE TABLE", catalog.SchemaObjectTable, n.Database().Name(), n.Name())}
+	case *plan.DropTable:
+		changes := make([]catalog.SchemaChange, 0, len(n.Tables))
+		for _, t := range n.Tables {
+			changes = append(changes, table("DROP TABLE", t))
+		}
+		return changes
+	case *plan.RenameTable:
+		changes := make([]catalog.SchemaChange, 0, 2*len(n.OldNames))
+		for i := range n.OldNames {
+			changes = append(changes,
+				change("RENAME TABLE", catalog.SchemaObjectTable, n.Database().Name(), n.OldNames[i]),
+				change("RENAME TABLE", catalog.SchemaObjectTable, n.Database().Name(), n.NewNames[i]),
+			)
+		}
+		return changes
+	case *plan.AddColumn:
+		return []catalog.SchemaChange{table("ALTER TABLE", n.Table)}
+	case *plan.RenameColumn:
+		return []catalog.SchemaChange{table("ALTER TABLE", n.Table)}
+	case *plan.DropColumn:
+		return []catalog.SchemaChange{table("ALTER TABLE", n.Table)}
+	case *plan.ModifyColumn:
+		return []catalog.SchemaChange{table("ALTER TABLE", n.Table)}
+	case *plan.AlterDefaultSet:
+		return []catalog.SchemaChange{table("ALTER TABLE", n.Table)}
+	case *plan.AlterDefaultDrop:
+		return []catalog.SchemaChange{table("ALTER TABLE", n.Table)}
+	case *plan.AlterPK:
+		return []catalog.SchemaChange{table("ALTER TABLE", n.Table)}
+	case *plan.AlterIndex:
+		return []catalog.SchemaChange{table("ALTER TABLE", n.Table)}
+	case *plan.CreateIndex:
+		return []catalog.SchemaChange{table("CREATE INDEX", n.Table)}
+	case *plan.DropIndex:
+		return []catalog.SchemaChange{table("DROP INDEX", n.Table)}
+	case *plan.CreateView:
+		return []catalog.SchemaChange{change("CREATE VIEW", catalog.SchemaObjectView, n.Database().Name(), n.Name)}
+	case *plan.DropView:
+		changes := make([]catalog.SchemaChange, 0, len(n.Children()))
+		for _, child := range n.Children() {
+			if v, ok := child.(*plan.SingleDropView); ok {
+				changes = append(changes, change("DROP VIEW", catalog.SchemaObjectView, v.Database().Name(), v.ViewName))
+			}
+		}
+		return changes
+	}
+	return nil
+}
+
+// tableNodeName returns the database and the name of the table of a DDL statement.
+// The database is empty if it is not known.
+func tableNodeName(node sql.Node) (database, name string) {
+	if n, ok := node.(sql.Nameable); ok {
+		name = n.Name()
+	}
+	if n, ok := node.(sql.Databaser); ok && n.Database() != nil {
+		database = n.Database().Name()
+	}
+	return database, name
+}
+
+// publishSchemaChanges publishes the schema changes of the committed transaction of the session.
+func (sess *Session) publishSchemaChanges() {
+	catalog.PublishSchemaChanges(sess.schemaChanges...)
+	sess.schemaChanges = nil
+}
@@ -18,6 +18,8 @@ import (
 	stdsql "database/sql"
 	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 
@@ -25,6 +27,7 @@ import (
 	"github.com/apecloud/myduckserver/catalog"
 	"github.com/dolthub/go-mysql-server/memory"
 	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/mysql_db"
 	"github.com/dolthub/go-mysql-server/sql/plan"
 	"github.com/dolthub/vitess/go/mysql"
 )
@@ -32,10 +35,23 @@ import (
 type Session struct {
 	*memory.Session
 	db *catalog.DatabaseProvider
+	// querySlotPid is the process ID of the query of the session that has been admitted by the scheduler.
+	querySlotPid atomic.Uint64
+	// schemaChanges are the schema changes made in the current transaction, see recordSchemaChanges.
+	schemaChanges []catalog.SchemaChange
+	// mysqlDb holds the accounts whose privileges are checked, see HasPrivilege.
+	mysqlDb *mysql_db.MySQLDb
+	// postgresSuperuser reports whether the user of the session is the superuser role of PostgreSQL,
+	// which has no MySQL account, see SetPostgresSuperuser.
+	postgresSuperuser bool
+	// restricted reports whether the authentication is enabled and the user of the session is not a superuser,
+	// who may access only the tenants granted to it, see CheckTenantAccess and ConnectionPool.RestrictTenants,
+	// and may not read the query profiles, see checkQueryProfileAccess.
+	restricted bool
 }
 
 func NewSession(base *memory.Session, provider *catalog.DatabaseProvider) *Session {
-	return &Session{base, provider}
+	return &Session{Session: base, db: provider}
 }
 
 // Provider returns the database provider for the session.
@@ -43,12 +59,63 @@ func (sess *Session) Provider() *catalog.DatabaseProvider {
 	return sess.db
 }
 
+// AcquireQuerySlot waits until the scheduler admits the current query of the session
+// in the workload class of the session, see WorkloadClassVariable.
+// A query that has been admitted is not queued again, e.g., for its subqueries.
+// The returned function must be called when the query finishes.
+func (sess *Session) AcquireQuerySlot(ctx *sql.Context) (release func(), err error) {
+	pid := ctx.Pid()
+	if pid != 0 && sess.querySlotPid.Load() == pid {
+		return func() {}, nil
+	}
+	class, err := sess.GetSessionVariable(ctx, WorkloadClassVariable)
+	if err != nil {
+		return nil, err
+	}
+	schedulerRelease, err := DefaultScheduler.Acquire(ctx, fmt.Sprint(class))
+	if err != nil {
+		return nil, err
+	}
+	sess.querySlotPid.Store(pid)
+	return sync.OnceFunc(func() {
+		sess.querySlotPid.CompareAndSwap(pid, 0)
+		schedulerRelease()
+	}), nil
+}
+
 func (sess *Session) CurrentSchemaOfUnderlyingConn() string {
 	return sess.db.Pool().CurrentSchema(sess.ID())
 }
 
+// UseDatabase implements sql.Session. It is called by the engine for `USE` and COM_INIT_DB of MySQL,
+// and switches the DuckDB connection to the schema of the database in the current catalog.
+func (sess *Session) UseDatabase(ctx *sql.Context, db sql.Database) error {
+	return sess.UseSchema(ctx, sess.GetCurrentCatalog(), db.Name())
+}
+
+// UseSchema switches the current database of the session, which is the current schema of its DuckDB connection,
+// see catalog.ConnectionPool.UseSchema. Both protocols switch the database this way, i.e., UseDatabase for MySQL,
+// and `USE` and `SET database` for Postgres, so that the session and the connection always agree on the current schema.
+func (sess *Session) UseSchema(ctx context.Context, catalogName, schemaName string) error {
+	schema, err := sess.db.Pool().UseSchema(ctx, sess.ID(), catalogName, schemaName)
+	if err != nil {
+		return err
+	}
+	sess.SetCurrentDatabase(schema)
+	return nil
+}
+
+// SyncCurrentDatabase updates the current database of the session to the current schema of its DuckDB connection,
+// after a statement executed by DuckDB as it is may have switched the schema, e.g., `RESET schema`.
+func (sess *Session) SyncCurrentDatabase() {
+	if schema := sess.CurrentSchemaOfUnderlyingConn(); schema != "" {
+		sess.SetCurrentDatabase(schema)
+	}
+}
+
 // NewSessionBuilder returns a session builder for the given database provider.
-func NewSessionBuilder(provider *catalog.DatabaseProvider) func(ctx context.Context, conn *mysql.Conn, addr string) (sql.Session, error) {
+// The sessions of the users other than the superusers are restricted, see isSuperuser and IsSuperuser.
+func NewSessionBuilder(provider *catalog.DatabaseProvider, mysqlDb *mysql_db.MySQLDb) func(ctx context.Context, conn *mysql.Conn, addr string) (sql.Session, error) {
 	return func(ctx context.Context, conn *mysql.Conn, addr string) (sql.Session, error) {
 		host := ""
 		user := ""
@@ -68,8 +135,60 @@ func NewSessionBuilder(provider *catalog.DatabaseProvider) func(ctx context.Cont
 			memSession.SetCurrentDatabase(schema)
 		}
 
-		return &Session{memSession, provider}, nil
+		sqlCtx := sql.NewContext(ctx, sql.WithSession(memSession))
+		if err := applyHandshakeCharset(sqlCtx, memSession, conn.CharacterSet); err != nil {
+			return nil, err
+		}
+
+		restricted := mysqlDb != nil && mysqlDb.Enabled() && !isSuperuser(mysqlDb, user, host)
+		if restricted {
+			provider.Pool().RestrictTenants(conn.ConnectionID, user)
+		} else {
+			provider.Pool().UnrestrictTenants(conn.ConnectionID)
+		}
+		return &Session{
+			Session:    memSession,
+			db:         provider,
+			mysqlDb:    mysqlDb,
+			restricted: restricted,
+		}, nil
+	}
+}
+
+// SetPostgresSuperuser marks the user of the session as the superuser role of PostgreSQL once it is authenticated,
+// so that it is a superuser without a MySQL account, see IsSuperuser.
+func (sess *Session) SetPostgresSuperuser() {
+	sess.postgresSuperuser = true
+	sess.restricted = false
+	sess.db.Pool().UnrestrictTenants(sess.ID())
+}
+
+// IsSuperuser reports whether the user of the session is a superuser, i.e., the superuser role of PostgreSQL,
+// see Session.SetPostgresSuperuser, or a user whose MySQL account has SUPER. It is false if the authentication
+// is disabled, in which case the privileges are not checked at all.
+func IsSuperuser(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb) bool {
+	if mysqlDb == nil || !mysqlDb.Enabled() {
+		return false
+	}
+	if sess, ok := ctx.Session.(*Session); ok && sess.postgresSuperuser {
+		return true
+	}
+	client := ctx.Session.Client()
+	rd := mysqlDb.Reader()
+	account := mysqlDb.GetUser(rd, client.User, client.Address, false)
+	rd.Close()
+	return account != nil && mysqlDb.UserHasPrivileges(ctx, sql.NewPrivilegedOperation(sql.PrivilegeCheckSubject{}, sql.PrivilegeType_Super))
+}
+
+// isSuperuser reports whether the MySQL account of a user has SUPER.
+func isSuperuser(mysqlDb *mysql_db.MySQLDb, user, host string) bool {
+	if mysqlDb == nil || !mysqlDb.Enabled() {
+		return false
 	}
+	rd := mysqlDb.Reader()
+	defer rd.Close()
+	account := mysqlDb.GetUser(rd, user, host, false)
+	return account != nil && account.PrivilegeSet.Has(sql.PrivilegeType_Super)
 }
 
 var _ sql.TransactionSession = (*Session)(nil)
@@ -125,12 +244,14 @@ func (sess *Session) CommitTransaction(ctx *sql.Context, tx sql.Transaction) err
 			return err
 		}
 	}
+	sess.publishSchemaChanges()
 	return sess.Session.CommitTransaction(ctx, &transaction.Transaction)
 }
 
 // Rollback implements sql.TransactionSession.
 func (sess *Session) Rollback(ctx *sql.Context, tx sql.Transaction) error {
 	sess.GetLogger().Trace("Rollback")
+	sess.schemaChanges = nil
 	transaction := tx.(*Transaction)
 	if transaction.tx != nil {
 		sess.GetLogger().Trace("RollbackDuckTransaction")
@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/sirupsen/logrus"
+)
+
+// snapshotBusyRetryInterval is how often a refresh postponed by the open transactions is retried.
+const snapshotBusyRetryInterval = time.Second
+
+// The SnapshotRefresher reopens the database files of a reader periodically, see catalog.DatabaseProvider.Refresh.
+// A refresh is postponed while the sessions have transactions open, for at most another interval,
+// after which the transactions are aborted so that the reader does not fall behind indefinitely.
+type SnapshotRefresher struct {
+	provider *catalog.DatabaseProvider
+	interval time.Duration
+	logger   *logrus.Entry
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewSnapshotRefresher(provider *catalog.DatabaseProvider, interval time.Duration) *SnapshotRefresher {
+	return &SnapshotRefresher{
+		provider: provider,
+		interval: interval,
+		logger:   logrus.WithField("component", "reader"),
+	}
+}
+
+// Start refreshes the snapshot in the background until Stop is called.
+func (r *SnapshotRefresher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(r.interval):
+			}
+			r.refresh(ctx)
+		}
+	}()
+}
+
+// Stop stops the refreshes and waits for the current one to finish.
+func (r *SnapshotRefresher) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+		r.wg.Wait()
+	}
+}
+
+func (r *SnapshotRefresher) refresh(ctx context.Context) {
+	deadline := time.Now().Add(r.interval)
+	for {
+		force := !time.Now().Before(deadline)
+		refreshed, err := r.provider.Refresh(force)
+		switch {
+		case errors.Is(err, catalog.ErrRefreshBusy):
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(snapshotBusyRetryInterval):
+			}
+			continue
+		case err != nil:
+			// The previous snapshot is still served, e.g., while a writer has the files open.
+			r.logger.WithError(err).Warnln("Failed to refresh the snapshot")
+		case refreshed && force:
+			r.logger.Warnln("Refreshed the snapshot, aborting the transactions open for longer than the refresh interval")
+		case refreshed:
+			r.logger.Infoln("Refreshed the snapshot")
+		}
+		return
+	}
+}
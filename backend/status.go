@@ -0,0 +1,81 @@
+// Copyright 2024-2025 ApeCloud, Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"net"
+	"time"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+)
+
+// Most of the status variables shown by SHOW STATUS are maintained by the engine, e.g., Questions and
+// Threads_connected. The ones below are maintained by the server itself, for both the MySQL and Postgres protocols.
+
+var startTime = time.Now()
+
+// StatusListener counts the bytes received from and sent to the clients in Bytes_received and Bytes_sent.
+// Only the global values are maintained, as the connections are not bound to the sessions at this level.
+type StatusListener struct {
+	net.Listener
+}
+
+func NewStatusListener(l net.Listener) *StatusListener {
+	return &StatusListener{Listener: l}
+}
+
+func (l *StatusListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &statusConn{Conn: conn}, nil
+}
+
+type statusConn struct {
+	net.Conn
+}
+
+func (c *statusConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		sql.StatusVariables.IncrementGlobal("Bytes_received", n)
+	}
+	return n, err
+}
+
+func (c *statusConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		sql.StatusVariables.IncrementGlobal("Bytes_sent", n)
+	}
+	return n, err
+}
+
+// updateStatusVariables updates the status variables that are not counted by the engine before they are shown,
+// and counts the transaction statements.
+func updateStatusVariables(ctx *sql.Context, n sql.Node) {
+	switch n.(type) {
+	case *plan.ShowStatus:
+		_ = sql.StatusVariables.SetGlobal("Uptime", uint64(time.Since(startTime).Seconds()))
+	case *plan.StartTransaction:
+		sql.IncrementStatusVariable(ctx, "Com_begin", 1)
+	case *plan.Commit:
+		sql.IncrementStatusVariable(ctx, "Com_commit", 1)
+	case *plan.Rollback:
+		sql.IncrementStatusVariable(ctx, "Com_rollback", 1)
+	}
+}
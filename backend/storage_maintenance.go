@@ -0,0 +1,152 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/mysql_db"
+)
+
+// The storage of the databases is maintained over both protocols, so that the DBAs reclaim the space
+// without access to the files of the server:
+//
+//	[FORCE] CHECKPOINT [database]
+//	VACUUM [FULL] [[schema.]table [, ...]]
+//
+// CHECKPOINT writes the WAL of a database, i.e., a catalog of DuckDB, or the current one if it is not given,
+// into its file, where the blocks freed by the deleted rows and the dropped tables are reused or truncated.
+// It fails if another transaction is writing to the database, unless it is FORCE CHECKPOINT, which aborts them.
+// The storage quota of a tenant is checked after it is checkpointed, see catalog.Tenant.
+//
+// DuckDB has no VACUUM that reclaims space, since the deleted rows leave holes in the row groups until the table
+// is rewritten. VACUUM checkpoints the current database, and VACUUM FULL rewrites the given tables, or all the tables
+// of the current database, before the checkpoint, the same as the Compactor does in the maintenance window.
+//
+// The statements require the global RELOAD privilege of the MySQL account with the name of the user, if there is one,
+// the same as FLUSH TABLES. The estimated sizes of the tables are listed in the __sys__.table_sizes view.
+
+var (
+	checkpointRegex = regexp.MustCompile(`(?is)^\s*(FORCE\s+)?CHECKPOINT(?:\s+(` + maskingIdentifier + `))?[\s;]*$`)
+	vacuumRegex     = regexp.MustCompile(`(?is)^\s*VACUUM(\s+FULL\b)?(?:\s+(.+?))?[\s;]*$`)
+	// vacuumTableRegex matches the first table of the list of VACUUM.
+	vacuumTableRegex = regexp.MustCompile(`(?s)^\s*(` + maskingIdentifier + `(?:\s*\.\s*` + maskingIdentifier + `)?)\s*(?:,|$)`)
+)
+
+// IsStorageStatement reports whether the query is a statement that maintains the storage.
+func IsStorageStatement(query string) bool {
+	return checkpointRegex.MatchString(query) || vacuumRegex.MatchString(query)
+}
+
+// ExecStorageStatement executes a statement that maintains the storage, and returns its command tag.
+// It returns false if the query is not such a statement.
+func ExecStorageStatement(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb, query string) (tag string, ok bool, err error) {
+	switch {
+	case checkpointRegex.MatchString(query):
+		m := checkpointRegex.FindStringSubmatch(query)
+		if err := checkGlobalPrivilege(ctx, mysqlDb, sql.PrivilegeType_Reload); err != nil {
+			return "", true, err
+		}
+		database := adapter.GetCurrentCatalog(ctx)
+		if m[2] != "" {
+			database = unquoteMaskingIdentifier(m[2])
+		}
+		return "CHECKPOINT", true, checkpoint(ctx, database, m[1] != "")
+
+	case vacuumRegex.MatchString(query):
+		m := vacuumRegex.FindStringSubmatch(query)
+		tables, err := parseVacuumTables(ctx, m[2])
+		if err != nil {
+			return "", true, err
+		}
+		if err := checkGlobalPrivilege(ctx, mysqlDb, sql.PrivilegeType_Reload); err != nil {
+			return "", true, err
+		}
+		if m[1] != "" {
+			if err := rewriteTables(ctx, tables); err != nil {
+				return "", true, err
+			}
+		}
+		return "VACUUM", true, checkpoint(ctx, adapter.GetCurrentCatalog(ctx), false)
+	}
+	return "", false, nil
+}
+
+// checkpoint checkpoints a database, and checks its storage quota if it is a tenant.
+func checkpoint(ctx *sql.Context, database string, force bool) error {
+	if database == "" {
+		// The connection of the session has not been opened yet.
+		if _, err := adapter.GetCatalogConn(ctx); err != nil {
+			return err
+		}
+		database = adapter.GetCurrentCatalog(ctx)
+	}
+	stmt := "CHECKPOINT " + catalog.QuoteIdentifierANSI(database)
+	if force {
+		stmt = "FORCE " + stmt
+	}
+	if _, err := adapter.ExecCatalog(ctx, stmt); err != nil {
+		return catalog.ErrDuckDB.New(err)
+	}
+	// The tenants above their quotas are logged, and the checkpoint itself has succeeded.
+	if err := ctx.Session.(*Session).Provider().CheckTenantQuota(database); err != nil && !catalog.ErrTenantQuotaExceeded.Is(err) {
+		return err
+	}
+	return nil
+}
+
+// qualifiedTable is a table of VACUUM, whose schema is the current one if it is not given.
+type qualifiedTable struct {
+	schema, name string
+}
+
+// parseVacuumTables parses the comma-separated list of the tables of VACUUM.
+func parseVacuumTables(ctx *sql.Context, list string) ([]qualifiedTable, error) {
+	var tables []qualifiedTable
+	for rest := strings.TrimSpace(list); rest != ""; {
+		m := vacuumTableRegex.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("invalid table of VACUUM: %q", rest)
+		}
+		table := qualifiedTable{schema: ctx.GetCurrentDatabase(), name: unquoteMaskingIdentifier(m[1])}
+		if qualifier, name, ok := splitQualifiedIdentifier(m[1]); ok {
+			table = qualifiedTable{schema: unquoteMaskingIdentifier(qualifier), name: unquoteMaskingIdentifier(name)}
+		}
+		tables = append(tables, table)
+		rest = strings.TrimSpace(rest[len(m[0]):])
+	}
+	return tables, nil
+}
+
+// rewriteTables rewrites the given tables, or all the tables of the current database if none is given,
+// see (*catalog.Table).Rewrite.
+func rewriteTables(ctx *sql.Context, tables []qualifiedTable) error {
+	provider := ctx.Session.(*Session).Provider()
+	if len(tables) == 0 {
+		for _, db := range provider.AllDatabases(ctx) {
+			names, err := db.GetTableNames(ctx)
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				tables = append(tables, qualifiedTable{schema: db.Name(), name: name})
+			}
+		}
+	}
+	for _, t := range tables {
+		table, err := lookupTable(ctx, provider, t.schema, t.name)
+		if err != nil {
+			return err
+		}
+		if table == nil {
+			return sql.ErrTableNotFound.New(t.name)
+		}
+		if err := table.Rewrite(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsStorageStatement(t *testing.T) {
+	for query, want := range map[string]bool{
+		"CHECKPOINT":                  true,
+		"checkpoint;":                 true,
+		"FORCE CHECKPOINT":            true,
+		`CHECKPOINT "my tenant"`:      true,
+		"VACUUM":                      true,
+		"VACUUM FULL":                 true,
+		"vacuum full db.t1, `t 2`;":   true,
+		"VACUUM fulltable":            true,
+		"CHECKPOINT a b":              false,
+		"SELECT 'CHECKPOINT'":         false,
+		"CREATE TABLE vacuum (i INT)": false,
+	} {
+		require.Equal(t, want, IsStorageStatement(query), query)
+	}
+}
+
+func TestParseVacuumTables(t *testing.T) {
+	ctx := sql.NewEmptyContext()
+	ctx.SetCurrentDatabase("db")
+
+	for _, tt := range []struct {
+		query string
+		full  bool
+		want  []qualifiedTable
+	}{
+		{query: "VACUUM"},
+		{query: "VACUUM FULL", full: true},
+		{query: "VACUUM fulltable", want: []qualifiedTable{{"db", "fulltable"}}},
+		{query: `VACUUM FULL t1, other.t2 , "Mixed ""Case"""`, full: true,
+			want: []qualifiedTable{{"db", "t1"}, {"other", "t2"}, {"db", `Mixed "Case"`}}},
+		{query: "VACUUM `s`.`t`;", want: []qualifiedTable{{"s", "t"}}},
+	} {
+		m := vacuumRegex.FindStringSubmatch(tt.query)
+		require.NotNil(t, m, tt.query)
+		require.Equal(t, tt.full, m[1] != "", tt.query)
+		tables, err := parseVacuumTables(ctx, m[2])
+		require.NoError(t, err, tt.query)
+		require.Equal(t, tt.want, tables, tt.query)
+	}
+
+	_, err := parseVacuumTables(ctx, "t1 t2")
+	require.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package backend
+
+import (
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// CheckTenantAccess returns an error if the current database of a statement of the session, or a tenant that it
+// references, is not granted to its user while its user is not a superuser, or if the statement writes while its
+// current database, or any tenant that it references, is above its storage quota. The statements of both protocols
+// are checked, see catalog/tenants.go. The sessions cannot switch to the tenants not granted to their users in
+// the first place, see ConnectionPool.RestrictTenants, so this check takes effect when a grant is revoked, or when
+// a statement qualifies a name with another tenant.
+func CheckTenantAccess(ctx *sql.Context, query string, write bool) error {
+	sess, ok := ctx.Session.(*Session)
+	if !ok || sess.db == nil || !sess.db.HasTenants() {
+		return nil
+	}
+	provider := sess.db
+	references := provider.TenantReferences(query)
+	if sess.restricted {
+		user := sess.Client().User
+		for _, name := range append(references, sess.GetCurrentCatalog()) {
+			if !provider.TenantGranted(name, user) {
+				return catalog.ErrTenantAccessDenied.New(name)
+			}
+		}
+	}
+	if write && provider.HasTenantsOverQuota() {
+		for _, name := range append(references, sess.GetCurrentCatalog()) {
+			if provider.TenantOverQuota(name) {
+				return catalog.ErrTenantOverQuota.New(name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package backend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The TIMESTAMPTZ values of DuckDB, e.g., those of the tables created over the Postgres protocol,
+// are instants in time, as the TIMESTAMP values of MySQL are. MySQL displays them in the time zone
+// of the session, i.e., @@time_zone, so they are converted before they are encoded, see SQLRowIter.
+
+// sessionLocation returns the location of the time zone of the session, which is either SYSTEM,
+// a named time zone, e.g., 'Asia/Shanghai', or an offset from UTC, e.g., '+08:00'.
+func sessionLocation(ctx *sql.Context) (*time.Location, error) {
+	v, err := ctx.GetSessionVariable(ctx, "time_zone")
+	if err != nil {
+		return nil, err
+	}
+	name, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid type for @@session.time_zone: %T", v)
+	}
+	return parseTimeZone(name)
+}
+
+func parseTimeZone(name string) (*time.Location, error) {
+	if strings.EqualFold(name, "SYSTEM") {
+		return time.Local, nil
+	}
+	if loc, ok := parseTimeZoneOffset(name); ok {
+		return loc, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown or incorrect time zone: '%s'", name)
+	}
+	return loc, nil
+}
+
+// parseTimeZoneOffset parses an offset from UTC in the form of [+|-]HH:MM.
+func parseTimeZoneOffset(offset string) (*time.Location, bool) {
+	if len(offset) < 5 || (offset[0] != '+' && offset[0] != '-') {
+		return nil, false
+	}
+	hours, minutes, ok := strings.Cut(offset[1:], ":")
+	if !ok {
+		return nil, false
+	}
+	h, err := strconv.Atoi(hours)
+	if err != nil || h > 14 {
+		return nil, false
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m > 59 {
+		return nil, false
+	}
+	seconds := h*60*60 + m*60
+	if offset[0] == '-' {
+		seconds = -seconds
+	}
+	return time.FixedZone(offset, seconds), true
+}
+
+// inLocation returns the wall clock of the instant in the location as a UTC time, since the datetime types
+// of the engine encode the UTC wall clock of the values.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
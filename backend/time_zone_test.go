@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"context"
+	stdsql "database/sql"
+	"testing"
+	"time"
+
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/dolthub/vitess/go/sqltypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimeZone(t *testing.T) {
+	loc, err := parseTimeZone("SYSTEM")
+	require.NoError(t, err)
+	require.Equal(t, time.Local, loc)
+
+	loc, err = parseTimeZone("+08:00")
+	require.NoError(t, err)
+	_, offset := time.Date(2024, 1, 1, 0, 0, 0, 0, loc).Zone()
+	require.Equal(t, 8*60*60, offset)
+
+	loc, err = parseTimeZone("-05:30")
+	require.NoError(t, err)
+	_, offset = time.Date(2024, 1, 1, 0, 0, 0, 0, loc).Zone()
+	require.Equal(t, -(5*60*60 + 30*60), offset)
+
+	loc, err = parseTimeZone("UTC")
+	require.NoError(t, err)
+	require.Equal(t, time.UTC, loc)
+
+	_, err = parseTimeZone("Nowhere/Nothing")
+	require.ErrorContains(t, err, "unknown or incorrect time zone")
+}
+
+func TestTimestampRoundTrip(t *testing.T) {
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE t (dt TIMESTAMP, ms TIMESTAMP_MS, tz TIMESTAMPTZ);
+		INSERT INTO t VALUES ('2024-02-29 23:59:58.123456', '2024-02-29 23:59:58.123', '2024-02-29 23:59:58.654321+00')`)
+	require.NoError(t, err)
+
+	provider := memory.NewDBProvider()
+	ctx := sql.NewContext(context.Background(), sql.WithSession(memory.NewSession(sql.NewBaseSession(), provider)))
+	require.NoError(t, ctx.SetSessionVariable(ctx, "time_zone", "+08:00"))
+
+	schema := sql.Schema{
+		{Name: "dt", Type: types.MustCreateDatetimeType(sqltypes.Datetime, 6)},
+		{Name: "ms", Type: types.MustCreateDatetimeType(sqltypes.Datetime, 3)},
+		{Name: "tz", Type: types.MustCreateDatetimeType(sqltypes.Timestamp, 6)},
+	}
+	rows, err := db.Query("SELECT dt, ms, tz FROM t")
+	require.NoError(t, err)
+	iter, err := NewSQLRowIter(rows, schema)
+	require.NoError(t, err)
+	defer iter.Close(ctx)
+
+	row, err := iter.Next(ctx)
+	require.NoError(t, err)
+	var encoded []string
+	for i, v := range row {
+		val, err := schema[i].Type.SQL(ctx, nil, v)
+		require.NoError(t, err)
+		encoded = append(encoded, val.ToString())
+	}
+	require.Equal(t, []string{
+		"2024-02-29 23:59:58.123456",
+		"2024-02-29 23:59:58.123",
+		// The instant is displayed in the session time zone.
+		"2024-03-01 07:59:58.654321",
+	}, encoded)
+}
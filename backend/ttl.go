@@ -0,0 +1,183 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/sirupsen/logrus"
+)
+
+// The TTLPurger deletes the expired rows of the tables with a retention policy, see catalog.TTLPurgeStmt.
+// It checks the policies periodically as the system job JobKindTTL of the JobScheduler,
+// and purges the tables in batches only while no query is running,
+// so that the purges do not compete with the queries of the clients. A round of purges stops
+// as soon as a query arrives, and the rest of the expired rows are deleted in the next round.
+
+// JobKindTTL is the kind, as well as the name, of the system job of the TTLPurger.
+const JobKindTTL = "ttl_purge"
+
+// The system variables that control the TTLPurger.
+const (
+	// TTLPausedVariable pauses the purges, e.g., during a bulk load or an incident.
+	TTLPausedVariable = "myduck_ttl_paused"
+	// TTLBatchSizeVariable limits the number of rows deleted by a statement.
+	TTLBatchSizeVariable = "myduck_ttl_batch_size"
+	// TTLCheckIntervalVariable is the number of seconds between the rounds of purges.
+	TTLCheckIntervalVariable = "myduck_ttl_check_interval"
+)
+
+func init() {
+	sql.SystemVariables.AddSystemVariables([]sql.SystemVariable{
+		&sql.MysqlSystemVariable{
+			Name:              TTLPausedVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemBoolType(TTLPausedVariable),
+			Default:           int8(0),
+		},
+		&sql.MysqlSystemVariable{
+			Name:              TTLBatchSizeVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemIntType(TTLBatchSizeVariable, 1, 1<<30, false),
+			Default:           int64(10000),
+		},
+		&sql.MysqlSystemVariable{
+			Name:              TTLCheckIntervalVariable,
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemIntType(TTLCheckIntervalVariable, 1, 86400, false),
+			Default:           int64(60),
+		},
+	})
+}
+
+type TTLPurger struct {
+	provider  *catalog.DatabaseProvider
+	scheduler *QueryScheduler
+	logger    *logrus.Entry
+}
+
+func NewTTLPurger(provider *catalog.DatabaseProvider) *TTLPurger {
+	return &TTLPurger{
+		provider:  provider,
+		scheduler: DefaultScheduler,
+		logger:    logrus.WithField("component", "ttl"),
+	}
+}
+
+// Job returns the system job that runs a round of purges every TTLCheckIntervalVariable seconds.
+func (p *TTLPurger) Job() SystemJob {
+	return SystemJob{
+		Name: JobKindTTL,
+		Interval: func() time.Duration {
+			return time.Duration(globalIntVariable(TTLCheckIntervalVariable)) * time.Second
+		},
+		Run: func(ctx context.Context, _ *Job) (string, error) {
+			n, err := p.PurgeExpired(ctx)
+			return fmt.Sprintf("%d rows purged", n), err
+		},
+	}
+}
+
+type ttlPolicy struct {
+	schema, table, ttl, column string
+}
+
+// PurgeExpired runs a round of purges, and returns the number of deleted rows.
+// The statistics of the purges and the last error of each table are recorded in catalog.InternalTables.TTLTables.
+func (p *TTLPurger) PurgeExpired(ctx context.Context) (int64, error) {
+	if globalIntVariable(TTLPausedVariable) != 0 || !p.scheduler.Idle() {
+		return 0, nil
+	}
+	policies, err := p.policies(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	db := p.provider.Storage()
+	batchSize := int(globalIntVariable(TTLBatchSizeVariable))
+	var total int64
+	for _, policy := range policies {
+		stmt := catalog.TTLPurgeStmt(policy.schema, policy.table, policy.column, batchSize)
+		var purged int64
+		var purgeErr error
+		for globalIntVariable(TTLPausedVariable) == 0 && p.scheduler.Idle() {
+			res, err := db.ExecContext(ctx, stmt, policy.ttl)
+			if err != nil {
+				purgeErr = err
+				break
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				purgeErr = err
+				break
+			}
+			purged += n
+			if n < int64(batchSize) {
+				break
+			}
+		}
+		total += purged
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+
+		if purgeErr != nil {
+			p.logger.WithError(purgeErr).Warnf("Failed to purge the expired rows of %s.%s", policy.schema, policy.table)
+		} else if purged > 0 {
+			p.logger.Infof("Purged %d expired rows of %s.%s", purged, policy.schema, policy.table)
+		}
+		var lastError any
+		if purgeErr != nil {
+			lastError = purgeErr.Error()
+		}
+		if _, err := db.ExecContext(ctx,
+			"UPDATE "+catalog.InternalTables.TTLTables.QualifiedName()+
+				" SET purged_rows = purged_rows + ?, last_purged_at = now(), last_error = ? WHERE schema_name = ? AND table_name = ?",
+			purged, lastError, policy.schema, policy.table,
+		); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (p *TTLPurger) policies(ctx context.Context) ([]ttlPolicy, error) {
+	rows, err := p.provider.Storage().QueryContext(ctx,
+		"SELECT schema_name, table_name, ttl, ttl_column FROM "+catalog.InternalTables.TTLTables.QualifiedName()+
+			" WHERE ttl IS NOT NULL AND ttl_column IS NOT NULL ORDER BY schema_name, table_name",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var policies []ttlPolicy
+	for rows.Next() {
+		var policy ttlPolicy
+		if err := rows.Scan(&policy.schema, &policy.table, &policy.ttl, &policy.column); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, rows.Err()
+}
+
+// globalIntVariable returns the value of a global integer or Boolean system variable.
+func globalIntVariable(name string) int64 {
+	_, value, _ := sql.SystemVariables.GetGlobal(name)
+	switch v := value.(type) {
+	case int8:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,156 @@
+package backend
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/analyzer"
+	"github.com/dolthub/go-mysql-server/sql/expression"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	"github.com/dolthub/go-mysql-server/sql/transform"
+	"github.com/dolthub/go-mysql-server/sql/types"
+)
+
+// In MySQL, the integer arithmetic with an UNSIGNED operand and the bit operations return BIGINT UNSIGNED,
+// e.g., `u + 1` of a BIGINT UNSIGNED column u. The engine types them as signed BIGINT (or DOUBLE), so
+// the values beyond the signed range, which DuckDB returns as UBIGINT, could not be encoded on the wire.
+// The unsignedResultRule restores the UNSIGNED types of the result columns of the top-level query.
+
+// unsignedResultRuleId is the id of unsignedResultRule, chosen not to collide with the rules of the engine.
+const unsignedResultRuleId analyzer.RuleId = -1000
+
+// AddUnsignedResultRule adds the rule that keeps the result columns UNSIGNED to the analyzer.
+func AddUnsignedResultRule(a *analyzer.Analyzer) {
+	for _, batch := range a.Batches {
+		if batch.Desc == "post-analyzer" {
+			batch.Rules = append(batch.Rules, analyzer.Rule{Id: unsignedResultRuleId, Apply: unsignedResultRule})
+			return
+		}
+	}
+}
+
+func unsignedResultRule(ctx *sql.Context, a *analyzer.Analyzer, n sql.Node, scope *plan.Scope, sel analyzer.RuleSelector, qFlags *sql.QueryFlags) (sql.Node, transform.TreeIdentity, error) {
+	if !scope.IsEmpty() {
+		return n, transform.SameTree, nil
+	}
+	return withUnsignedProjections(n)
+}
+
+// withUnsignedProjections rewrites the projections of the Project that produces the result columns of n.
+func withUnsignedProjections(n sql.Node) (sql.Node, transform.TreeIdentity, error) {
+	switch n := n.(type) {
+	case *plan.Project:
+		var projections []sql.Expression
+		for i, projection := range n.Projections {
+			e := projection
+			alias, aliased := projection.(*expression.Alias)
+			if aliased {
+				e = alias.Child
+			}
+			if _, ok := e.(*unsignedResult); ok || types.IsUnsigned(e.Type()) || !isUnsignedResult(e) {
+				continue
+			}
+			if projections == nil {
+				projections = slices.Clone(n.Projections)
+			}
+			var wrapped sql.Expression = &unsignedResult{UnaryExpression: expression.UnaryExpression{Child: e}}
+			if aliased {
+				var err error
+				if wrapped, err = alias.WithChildren(wrapped); err != nil {
+					return nil, transform.SameTree, err
+				}
+			}
+			projections[i] = wrapped
+		}
+		if projections == nil {
+			return n, transform.SameTree, nil
+		}
+		node, err := n.WithExpressions(projections...)
+		return node, transform.NewTree, err
+	case *plan.Limit, *plan.Offset, *plan.Sort, *plan.TopN, *plan.Distinct, *plan.OrderedDistinct, *plan.Filter, *plan.Having:
+		child, same, err := withUnsignedProjections(n.Children()[0])
+		if err != nil || same {
+			return n, transform.SameTree, err
+		}
+		node, err := n.WithChildren(child)
+		return node, transform.NewTree, err
+	}
+	return n, transform.SameTree, nil
+}
+
+// isUnsignedResult returns whether the expression returns an UNSIGNED integer in MySQL.
+func isUnsignedResult(e sql.Expression) bool {
+	switch e := e.(type) {
+	case *expression.Arithmetic:
+		switch e.Op {
+		case "+", "-", "*":
+			return isIntegerResult(e.LeftChild) && isIntegerResult(e.RightChild) &&
+				(isUnsignedResult(e.LeftChild) || isUnsignedResult(e.RightChild))
+		}
+		return false
+	case *expression.IntDiv:
+		return isIntegerResult(e.LeftChild) && isIntegerResult(e.RightChild) &&
+			(isUnsignedResult(e.LeftChild) || isUnsignedResult(e.RightChild))
+	case *expression.Mod:
+		return isIntegerResult(e.LeftChild) && isIntegerResult(e.RightChild) && isUnsignedResult(e.LeftChild)
+	case *expression.BitOp:
+		// The bit operations on two binary strings return a binary string.
+		return !types.IsBinaryType(e.LeftChild.Type()) || !types.IsBinaryType(e.RightChild.Type())
+	}
+	return types.IsUnsigned(e.Type())
+}
+
+func isIntegerResult(e sql.Expression) bool {
+	return types.IsInteger(e.Type()) || isUnsignedResult(e)
+}
+
+// unsignedResult types its child as BIGINT UNSIGNED, so that the result column is sent with the UNSIGNED flag.
+type unsignedResult struct {
+	expression.UnaryExpression
+}
+
+var _ sql.Expression = (*unsignedResult)(nil)
+var _ sql.CollationCoercible = (*unsignedResult)(nil)
+
+// Eval implements the Expression interface.
+func (e *unsignedResult) Eval(ctx *sql.Context, row sql.Row) (interface{}, error) {
+	v, err := e.Child.Eval(ctx, row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	u, inRange, err := types.Uint64.Convert(v)
+	if err != nil {
+		return nil, err
+	}
+	if inRange != sql.InRange {
+		return nil, sql.ErrValueOutOfRange.New(v, "BIGINT UNSIGNED")
+	}
+	return u, nil
+}
+
+func (e *unsignedResult) String() string {
+	return e.Child.String()
+}
+
+func (e *unsignedResult) DebugString() string {
+	return fmt.Sprintf("unsigned(%s)", sql.DebugString(e.Child))
+}
+
+// WithChildren implements the Expression interface.
+func (e *unsignedResult) WithChildren(children ...sql.Expression) (sql.Expression, error) {
+	if len(children) != 1 {
+		return nil, sql.ErrInvalidChildrenNumber.New(e, len(children), 1)
+	}
+	return &unsignedResult{UnaryExpression: expression.UnaryExpression{Child: children[0]}}, nil
+}
+
+// Type implements the Expression interface.
+func (e *unsignedResult) Type() sql.Type {
+	return types.Uint64
+}
+
+// CollationCoercibility implements the interface sql.CollationCoercible.
+func (*unsignedResult) CollationCoercibility(ctx *sql.Context) (collation sql.CollationID, coercibility byte) {
+	return sql.Collation_binary, 5
+}
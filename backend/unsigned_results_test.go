@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	"github.com/dolthub/go-mysql-server/sql/transform"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnsignedResults(t *testing.T) {
+	u := expression.NewGetField(0, types.Uint64, "u", true)
+	i := expression.NewGetField(1, types.Int64, "i", true)
+	d := expression.NewGetField(2, types.Float64, "d", true)
+	one := expression.NewLiteral(int8(1), types.Int8)
+
+	require.True(t, isUnsignedResult(expression.NewPlus(u, one)))
+	require.True(t, isUnsignedResult(expression.NewMult(expression.NewMinus(u, one), i)))
+	require.True(t, isUnsignedResult(expression.NewIntDiv(u, one)))
+	require.True(t, isUnsignedResult(expression.NewBitAnd(i, one)))
+	require.False(t, isUnsignedResult(expression.NewPlus(i, one)))
+	require.False(t, isUnsignedResult(expression.NewPlus(u, d)))
+	require.False(t, isUnsignedResult(expression.NewMod(i, u)))
+
+	project := plan.NewProject([]sql.Expression{
+		expression.NewAlias("next", expression.NewPlus(u, one)),
+		expression.NewMinus(u, one),
+		expression.NewPlus(i, one),
+	}, plan.NewEmptyTableWithSchema(sql.Schema{
+		{Name: "u", Type: types.Uint64},
+		{Name: "i", Type: types.Int64},
+		{Name: "d", Type: types.Float64},
+	}))
+	n, same, err := withUnsignedProjections(plan.NewLimit(one, project))
+	require.NoError(t, err)
+	require.Equal(t, transform.NewTree, same)
+	schema := n.Schema()
+	require.Equal(t, "next", schema[0].Name)
+	require.Equal(t, types.Uint64, schema[0].Type)
+	require.Equal(t, types.Uint64, schema[1].Type)
+	require.Equal(t, types.Int64, schema[2].Type)
+
+	// The rule is idempotent.
+	_, same, err = withUnsignedProjections(n)
+	require.NoError(t, err)
+	require.Equal(t, transform.SameTree, same)
+
+	v, err := (&unsignedResult{UnaryExpression: expression.UnaryExpression{Child: expression.NewMinus(u, one)}}).Eval(sql.NewEmptyContext(), sql.Row{uint64(0)})
+	require.Error(t, err)
+	require.Nil(t, v)
+}
@@ -0,0 +1,576 @@
+package backend
+
+import (
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression"
+	"github.com/dolthub/go-mysql-server/sql/plan"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/dolthub/vitess/go/mysql"
+)
+
+// The upserts of MySQL, i.e., REPLACE and INSERT ... ON DUPLICATE KEY UPDATE, are translated into
+// INSERT ... ON CONFLICT (key) DO UPDATE of DuckDB, which takes a single conflict target, while MySQL checks
+// all unique keys. So the rows are staged in a temporary table first, with the defaults of the omitted columns:
+//
+//   - Each staged row is matched against the unique keys in order, the primary key first, like MySQL does,
+//     and the rows that conflict on each key are upserted with the key as the conflict target.
+//   - The rows that conflict on no key are inserted.
+//   - REPLACE sets all columns to the staged values. DuckDB cannot assign to the indexed columns in DO UPDATE,
+//     nor delete and insert a key in one transaction, so REPLACE fails if it would change the indexed
+//     columns of an existing row, or replace several rows with one row.
+//   - VALUES(col) and the row alias of INSERT ... AS alias refer to the excluded values.
+//   - The staged rows that conflict with each other are rejected by DuckDB, while MySQL applies them in order.
+//
+// MySQL counts an inserted row as 1 affected row, and a replaced or updated row as 2. A row updated to
+// its current values counts as 0, or 1 with CLIENT_FOUND_ROWS, and a row replaced by an equal one as 1.
+// The conflicting rows are found by the keys of the staged rows, and the updates are counted by DuckDB,
+// which skips the rows whose values do not change.
+
+const (
+	upsertStagingTable   = "__myduck_upsert"
+	upsertConflictsTable = "__myduck_upsert_conflicts"
+)
+
+var (
+	replaceKeywordRegex = regexp.MustCompile(`(?i)^(\s|/\*.*?\*/)*(REPLACE)\b`)
+	onDuplicateRegex    = regexp.MustCompile(`(?i)\bON\s+DUPLICATE\s+KEY\s+UPDATE\b`)
+	rowAliasRegex       = regexp.MustCompile(`(?i)\s+AS\s+(\w+|` + "`[^`]+`" + `)\s*$`)
+	valuesFuncRegex     = regexp.MustCompile(`(?i)\bVALUES\s*\(\s*(\w+|` + "`[^`]+`" + `)\s*\)`)
+	insertTargetRegex   = regexp.MustCompile(`(?is)^((?:\s|/\*.*?\*/)*INSERT\s+(?:OR\s+\w+\s+)?(?:INTO\s+)?)` +
+		`((?:"(?:[^"]|"")*"|[\w$]+)(?:\s*\.\s*(?:"(?:[^"]|"")*"|[\w$]+))*)`)
+)
+
+// isUpsert returns true if the INSERT is a REPLACE or has an ON DUPLICATE KEY UPDATE clause.
+func isUpsert(insert *plan.InsertInto) bool {
+	return insert.IsReplace || len(insert.OnDupExprs) > 0
+}
+
+// upsert is a REPLACE or INSERT ... ON DUPLICATE KEY UPDATE statement translated into DuckDB.
+type upsert struct {
+	table   string     // the qualified name of the table
+	columns []string   // the columns of the table
+	keys    [][]string // the unique keys of the table, the primary key first
+	indexed []string   // the columns of all indexes of the table
+	replace bool
+	insert  string      // the INSERT of the rows into the table
+	set     [][2]string // the assignments of ON DUPLICATE KEY UPDATE
+}
+
+// executeUpsert executes a REPLACE or INSERT ... ON DUPLICATE KEY UPDATE statement in DuckDB,
+// and reports the affected rows in the way of MySQL.
+func (b *DuckBuilder) executeUpsert(ctx *sql.Context, insert *plan.InsertInto, conn *stdsql.Conn) (sql.RowIter, error) {
+	dst, err := plan.GetInsertable(insert.Destination)
+	if err != nil {
+		return nil, err
+	}
+	u := &upsert{table: catalog.ConnectIdentifiersANSI(insert.Database().Name(), dst.Name()), replace: insert.IsReplace}
+	for _, col := range dst.Schema() {
+		u.columns = append(u.columns, col.Name)
+	}
+	if u.keys, u.indexed, err = upsertKeys(ctx, dst); err != nil {
+		return nil, err
+	}
+	if u.insert, u.set, err = translateUpsert(ctx.Query(), insert.IsReplace, translateToDuckDB); err != nil {
+		return nil, catalog.ErrTranspiler.New(err)
+	}
+	ctx.GetLogger().WithField("DuckSQL", u.insert).Trace("Executing upsert...")
+
+	var key string
+	if col := generatedKeyColumn(dst.Schema(), insert.ColumnNames); col != nil {
+		key = col.Name
+	}
+	foundRows := ctx.Client().Capabilities&mysql.CapabilityClientFoundRows != 0
+
+	// The statements of the upsert run in one transaction.
+	if adapter.TryGetTxn(ctx) != nil {
+		return execUpsert(ctx, conn, insert.Database().Name(), dst.Name(), u, key, foundRows)
+	}
+	if _, err := conn.ExecContext(ctx.Context, "BEGIN TRANSACTION"); err != nil {
+		return nil, err
+	}
+	iter, err := execUpsert(ctx, conn, insert.Database().Name(), dst.Name(), u, key, foundRows)
+	if err != nil {
+		if _, rbErr := conn.ExecContext(ctx.Context, "ROLLBACK"); rbErr != nil {
+			ctx.GetLogger().WithError(rbErr).Warn("Failed to roll back the upsert")
+		}
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx.Context, "COMMIT"); err != nil {
+		return nil, err
+	}
+	return iter, nil
+}
+
+// execUpsert executes the upsert, and returns the affected rows counted in the way of MySQL.
+// The generated keys of the inserted rows are returned from the given column if it is not empty.
+func execUpsert(ctx *sql.Context, conn *stdsql.Conn, schema, table string, u *upsert, key string, foundRows bool) (sql.RowIter, error) {
+	if len(u.keys) == 0 {
+		// Nothing can conflict.
+		inserted, insertID, err := execUpsertInsert(ctx, conn, u.insert, key)
+		if err != nil {
+			return nil, err
+		}
+		return okResultIter(ctx, types.OkResult{RowsAffected: uint64(inserted), InsertID: uint64(insertID)}), nil
+	}
+
+	// Stage the rows, with the defaults of the table.
+	if err := createStagingTable(ctx, conn, schema, table); err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, name := range []string{upsertStagingTable, upsertConflictsTable} {
+			if _, err := conn.ExecContext(ctx.Context, "DROP TABLE IF EXISTS temp.main."+catalog.QuoteIdentifierANSI(name)); err != nil {
+				ctx.GetLogger().WithError(err).Warnf("Failed to drop the temporary table %s of the upsert", name)
+			}
+		}
+	}()
+	stage, err := u.stagingInsert()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx.Context, stage); err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx.Context, u.conflicts()); err != nil {
+		return nil, err
+	}
+
+	// The number of the conflicting rows by key, and the most rows that a staged row conflicts with.
+	conflicts := make([]int64, len(u.keys))
+	var matches int64
+	rows, err := conn.QueryContext(ctx.Context, "SELECT key, count(*), max(matches) FROM temp.main."+
+		catalog.QuoteIdentifierANSI(upsertConflictsTable)+" GROUP BY key")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var i, n, m int64
+		if err := rows.Scan(&i, &n, &m); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		conflicts[i], matches = n, max(matches, m)
+	}
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return nil, err
+	}
+	if u.replace && matches > 1 {
+		return nil, fmt.Errorf("REPLACE cannot replace several rows of table %s with one row", table)
+	}
+
+	var found, changed int64
+	for i, n := range conflicts {
+		if n == 0 {
+			continue
+		}
+		if check := u.indexedCheck(i); check != "" {
+			var differ int64
+			if err := conn.QueryRowContext(ctx.Context, check).Scan(&differ); err != nil {
+				return nil, err
+			}
+			if differ > 0 {
+				return nil, fmt.Errorf("REPLACE cannot change the indexed columns of the existing rows of table %s", table)
+			}
+		}
+		result, err := execUpsertStmt(ctx, conn, u.update(i))
+		if err != nil {
+			return nil, err
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		found, changed = found+n, changed+updated
+	}
+	inserted, insertID, err := execUpsertInsert(ctx, conn, u.insertRest(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := inserted + 2*changed
+	switch {
+	case u.replace:
+		// A row replaced by an equal one is counted as inserted only.
+		affected = inserted + found + changed
+	case foundRows:
+		affected += found - changed
+	}
+	return okResultIter(ctx, types.OkResult{RowsAffected: uint64(affected), InsertID: uint64(insertID)}), nil
+}
+
+// execUpsertStmt executes a statement of an upsert, which writes the rows of the table.
+func execUpsertStmt(ctx *sql.Context, conn *stdsql.Conn, duckSQL string) (stdsql.Result, error) {
+	result, err := conn.ExecContext(ctx.Context, duckSQL)
+	if err != nil {
+		if yes, column := catalog.IsDuckDBNotNullConstraintViolationError(err); yes {
+			return nil, sql.ErrInsertIntoNonNullableProvidedNull.New(column)
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// execUpsertInsert executes an INSERT of an upsert, and returns the number of the inserted rows,
+// and the first generated key in the given column if it is not empty.
+func execUpsertInsert(ctx *sql.Context, conn *stdsql.Conn, duckSQL string, key string) (inserted int64, insertID int64, err error) {
+	if key == "" {
+		result, err := execUpsertStmt(ctx, conn, duckSQL)
+		if err != nil {
+			return 0, 0, err
+		}
+		inserted, err = result.RowsAffected()
+		return inserted, 0, err
+	}
+	rows, err := conn.QueryContext(ctx.Context, duckSQL+" RETURNING "+catalog.QuoteIdentifierANSI(key))
+	if err != nil {
+		if yes, column := catalog.IsDuckDBNotNullConstraintViolationError(err); yes {
+			return 0, 0, sql.ErrInsertIntoNonNullableProvidedNull.New(column)
+		}
+		return 0, 0, err
+	}
+	defer rows.Close()
+	return scanFirstKey(rows)
+}
+
+// createStagingTable creates the temporary table that stages the rows of an upsert into a table,
+// with the same columns and defaults as the table, but no constraints.
+func createStagingTable(ctx *sql.Context, conn *stdsql.Conn, schema, table string) error {
+	rows, err := conn.QueryContext(ctx.Context, `SELECT column_name, data_type, column_default FROM duckdb_columns()
+		WHERE database_name = current_database() AND schema_name = ? AND table_name = ? ORDER BY column_index`, schema, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name, typ string
+		var def stdsql.NullString
+		if err := rows.Scan(&name, &typ, &def); err != nil {
+			return err
+		}
+		column := catalog.QuoteIdentifierANSI(name) + " " + typ
+		if def.Valid {
+			column += " DEFAULT " + def.String
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return sql.ErrTableNotFound.New(table)
+	}
+	_, err = conn.ExecContext(ctx.Context, "CREATE OR REPLACE TEMP TABLE "+catalog.QuoteIdentifierANSI(upsertStagingTable)+
+		" ("+strings.Join(columns, ", ")+")")
+	return err
+}
+
+// upsertKeys returns the unique keys of a table, the primary key first, and the columns of all its indexes.
+func upsertKeys(ctx *sql.Context, dst sql.Table) (keys [][]string, indexed []string, err error) {
+	var indexes []sql.Index
+	if it, ok := dst.(sql.IndexAddressable); ok {
+		if indexes, err = it.GetIndexes(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, idx := range indexes {
+		var columns []string
+		if idx, ok := idx.(*catalog.Index); ok {
+			for _, expr := range idx.Exprs {
+				if field, ok := expr.(*expression.GetField); ok {
+					columns = append(columns, field.Name())
+				}
+			}
+		}
+		for _, column := range columns {
+			if !seen[strings.ToLower(column)] {
+				seen[strings.ToLower(column)] = true
+				indexed = append(indexed, column)
+			}
+		}
+		if !idx.IsUnique() || len(columns) == 0 {
+			continue
+		}
+		if idx.ID() == "PRIMARY" {
+			keys = append([][]string{columns}, keys...)
+		} else {
+			keys = append(keys, columns)
+		}
+	}
+	return keys, indexed, nil
+}
+
+// stagingInsert returns the INSERT of the rows into the staging table.
+func (u *upsert) stagingInsert() (string, error) {
+	m := insertTargetRegex.FindStringSubmatchIndex(u.insert)
+	if m == nil {
+		return "", fmt.Errorf("unexpected translation of the upsert: %s", u.insert)
+	}
+	return u.insert[:m[4]] + catalog.QuoteIdentifierANSI(upsertStagingTable) + u.insert[m[5]:], nil
+}
+
+// conflicts returns the statement that matches the staged rows against the unique keys, and records
+// the first key that each of them conflicts on, and the number of the existing rows that it conflicts with.
+func (u *upsert) conflicts() string {
+	var b strings.Builder
+	b.WriteString("CREATE OR REPLACE TEMP TABLE " + catalog.QuoteIdentifierANSI(upsertConflictsTable) + " AS ")
+	b.WriteString("SELECT src, min(key) AS key, count(DISTINCT dst) AS matches FROM (")
+	for i, key := range u.keys {
+		if i > 0 {
+			b.WriteString(" UNION ALL ")
+		}
+		fmt.Fprintf(&b, "SELECT s.rowid AS src, %d AS key, t.rowid AS dst FROM %s", i, u.keyJoin(key))
+	}
+	b.WriteString(") GROUP BY src")
+	return b.String()
+}
+
+// keyJoin returns the join of the staged rows (s) and the rows of the table (t) on a key.
+func (u *upsert) keyJoin(key []string) string {
+	var b strings.Builder
+	b.WriteString("temp.main." + catalog.QuoteIdentifierANSI(upsertStagingTable) + " AS s JOIN " + u.table + " AS t ON ")
+	for i, column := range key {
+		if i > 0 {
+			b.WriteString(" AND ")
+		}
+		column = catalog.QuoteIdentifierANSI(column)
+		b.WriteString("s." + column + " = t." + column)
+	}
+	return b.String()
+}
+
+// conflicting returns the condition on the rowid of the staged rows that conflict first on the i-th key,
+// or on no key if i is negative.
+func (u *upsert) conflicting(i int) string {
+	conflicts := "temp.main." + catalog.QuoteIdentifierANSI(upsertConflictsTable)
+	if i < 0 {
+		return "rowid NOT IN (SELECT src FROM " + conflicts + ")"
+	}
+	return fmt.Sprintf("rowid IN (SELECT src FROM %s WHERE key = %d)", conflicts, i)
+}
+
+// indexedCheck returns the query that counts the rows that REPLACE would change the indexed columns of,
+// among the ones that conflict on the i-th key, or an empty string if the check is not needed.
+func (u *upsert) indexedCheck(i int) string {
+	if !u.replace {
+		return ""
+	}
+	var columns []string
+	for _, column := range u.indexed {
+		if !slices.ContainsFunc(u.keys[i], func(c string) bool { return strings.EqualFold(c, column) }) {
+			columns = append(columns, catalog.QuoteIdentifierANSI(column))
+		}
+	}
+	if len(columns) == 0 {
+		return ""
+	}
+	return "SELECT count(*) FROM " + u.keyJoin(u.keys[i]) + " WHERE s." + u.conflicting(i) +
+		" AND (t." + strings.Join(columns, ", t.") + ") IS DISTINCT FROM (s." + strings.Join(columns, ", s.") + ")"
+}
+
+// update returns the upsert of the staged rows that conflict first on the i-th key.
+// The rows whose values would not change are not updated, so that DuckDB does not count them.
+func (u *upsert) update(i int) string {
+	set := u.set
+	if u.replace {
+		set = nil
+		for _, column := range u.columns {
+			if !slices.ContainsFunc(u.indexed, func(c string) bool { return strings.EqualFold(c, column) }) {
+				column = catalog.QuoteIdentifierANSI(column)
+				set = append(set, [2]string{column, "excluded." + column})
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(u.insertFrom(i))
+	b.WriteString(" ON CONFLICT (")
+	for j, column := range u.keys[i] {
+		if j > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(catalog.QuoteIdentifierANSI(column))
+	}
+	b.WriteString(") ")
+	if len(set) == 0 {
+		b.WriteString("DO NOTHING")
+		return b.String()
+	}
+	targets, values := make([]string, len(set)), make([]string, len(set))
+	for j, assignment := range set {
+		targets[j], values[j] = assignment[0], assignment[1]
+		if j > 0 {
+			b.WriteString(", ")
+		} else {
+			b.WriteString("DO UPDATE SET ")
+		}
+		b.WriteString(assignment[0] + " = " + assignment[1])
+	}
+	b.WriteString(" WHERE (" + strings.Join(targets, ", ") + ") IS DISTINCT FROM (" + strings.Join(values, ", ") + ")")
+	return b.String()
+}
+
+// insertRest returns the INSERT of the staged rows that conflict on no key.
+func (u *upsert) insertRest() string {
+	return u.insertFrom(-1)
+}
+
+func (u *upsert) insertFrom(i int) string {
+	columns := make([]string, len(u.columns))
+	for j, column := range u.columns {
+		columns[j] = catalog.QuoteIdentifierANSI(column)
+	}
+	list := strings.Join(columns, ", ")
+	return "INSERT INTO " + u.table + " (" + list + ") SELECT " + list + " FROM temp.main." +
+		catalog.QuoteIdentifierANSI(upsertStagingTable) + " WHERE " + u.conflicting(i)
+}
+
+// translateUpsert translates a REPLACE or INSERT ... ON DUPLICATE KEY UPDATE statement of MySQL
+// into the INSERT of the rows, and the assignments of ON DUPLICATE KEY UPDATE, in DuckDB.
+func translateUpsert(query string, replace bool, translate func(string) (string, error)) (insert string, set [][2]string, err error) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	if replace {
+		if m := replaceKeywordRegex.FindStringSubmatchIndex(maskQuoted(query)); m != nil {
+			query = query[:m[4]] + "INSERT" + query[m[5]:]
+		}
+	}
+
+	// Split the assignments of ON DUPLICATE KEY UPDATE off the INSERT.
+	var assignments, rowAlias string
+	masked := maskQuoted(query)
+	if m := onDuplicateRegex.FindStringIndex(masked); m != nil {
+		assignments = query[m[1]:]
+		query, masked = strings.TrimSpace(query[:m[0]]), strings.TrimSpace(masked[:m[0]])
+		if m := rowAliasRegex.FindStringSubmatchIndex(masked); m != nil {
+			rowAlias = strings.Trim(query[m[2]:m[3]], "`")
+			query = query[:m[0]]
+		}
+	}
+
+	if insert, err = translate(query); err != nil {
+		return "", nil, err
+	}
+	insert = strings.TrimRight(strings.TrimSpace(insert), ";")
+	if replace || assignments == "" {
+		return insert, nil, nil
+	}
+
+	// VALUES(col) and alias.col refer to the excluded values.
+	assignments = replaceUnquoted(assignments, valuesFuncRegex, "excluded.$1")
+	if rowAlias != "" {
+		aliasRegex := regexp.MustCompile(`(?i)(\b|` + "`)" + regexp.QuoteMeta(rowAlias) + "`?\\.")
+		assignments = replaceUnquoted(assignments, aliasRegex, "excluded.")
+	}
+	// The assignments are translated as the ones of an UPDATE.
+	update, err := translate("UPDATE t SET " + assignments)
+	if err != nil {
+		return "", nil, err
+	}
+	_, translated, ok := strings.Cut(update, " SET ")
+	if !ok {
+		return "", nil, fmt.Errorf("unexpected translation of the assignments: %s", update)
+	}
+	if set = splitAssignments(strings.TrimRight(strings.TrimSpace(translated), ";")); set == nil {
+		return "", nil, fmt.Errorf("unexpected translation of the assignments: %s", update)
+	}
+	return insert, set, nil
+}
+
+// splitAssignments splits the assignments of a SET clause of DuckDB into the targets and the values.
+// It returns nil if the clause is malformed.
+func splitAssignments(s string) [][2]string {
+	var set [][2]string
+	depth, start, eq := 0, 0, -1
+	var quote byte
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			c := s[i]
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+				continue
+			case c == '\'' || c == '"':
+				quote = c
+				continue
+			case c == '(' || c == '[' || c == '{':
+				depth++
+				continue
+			case c == ')' || c == ']' || c == '}':
+				depth--
+				continue
+			case depth == 0 && c == '=' && eq < 0:
+				eq = i
+				continue
+			case depth > 0 || c != ',':
+				continue
+			}
+		}
+		if eq < 0 {
+			return nil
+		}
+		target, value := strings.TrimSpace(s[start:eq]), strings.TrimSpace(s[eq+1:i])
+		if target == "" || value == "" {
+			return nil
+		}
+		set = append(set, [2]string{target, value})
+		start, eq = i+1, -1
+	}
+	return set
+}
+
+// replaceUnquoted replaces the matches of the regex that are not in quoted strings or identifiers.
+func replaceUnquoted(s string, re *regexp.Regexp, repl string) string {
+	masked := maskQuoted(s)
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(masked, -1) {
+		b.WriteString(s[last:m[0]])
+		b.Write(re.ExpandString(nil, repl, s, m))
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// maskQuoted returns the string with the content of the quoted strings replaced with spaces,
+// so that the keywords can be matched outside them at the same positions.
+// The backtick-quoted identifiers are kept as they are.
+func maskQuoted(s string) string {
+	masked := []byte(s)
+	var quote byte
+	for i := 0; i < len(masked); i++ {
+		c := masked[i]
+		switch {
+		case quote == 0:
+			if c == '\'' || c == '"' {
+				quote = c
+			}
+		case c == '\\' && i+1 < len(masked):
+			masked[i], masked[i+1] = ' ', ' '
+			i++
+		case c == quote:
+			if i+1 < len(masked) && masked[i+1] == quote {
+				masked[i], masked[i+1] = ' ', ' '
+				i++
+			} else {
+				quote = 0
+			}
+		default:
+			masked[i] = ' '
+		}
+	}
+	return string(masked)
+}
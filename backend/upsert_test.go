@@ -0,0 +1,146 @@
+package backend
+
+import (
+	"context"
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateUpsert(t *testing.T) {
+	identity := func(q string) (string, error) { return q, nil }
+	tests := []struct {
+		name    string
+		query   string
+		replace bool
+		insert  string
+		set     [][2]string
+	}{
+		{
+			name:    "replace",
+			query:   "/* x */ replace t (id, v) VALUES (1, 'a');",
+			replace: true,
+			insert:  "/* x */ INSERT t (id, v) VALUES (1, 'a')",
+		},
+		{
+			name:   "on duplicate key update",
+			query:  "INSERT INTO t VALUES (1, 'on duplicate key update') ON DUPLICATE KEY UPDATE v = VALUES(v), n = greatest(n, 1) + 1",
+			insert: "INSERT INTO t VALUES (1, 'on duplicate key update')",
+			set:    [][2]string{{"v", "excluded.v"}, {"n", "greatest(n, 1) + 1"}},
+		},
+		{
+			name:   "row alias",
+			query:  "INSERT INTO t VALUES (1, 2) AS new ON DUPLICATE KEY UPDATE v = new.v + `new`.n, s = 'new.v, x = 1'",
+			insert: "INSERT INTO t VALUES (1, 2)",
+			set:    [][2]string{{"v", "excluded.v + excluded.n"}, {"s", "'new.v, x = 1'"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			insert, set, err := translateUpsert(tt.query, tt.replace, identity)
+			require.NoError(t, err)
+			require.Equal(t, tt.insert, insert)
+			require.Equal(t, tt.set, set)
+		})
+	}
+}
+
+func TestSplitAssignments(t *testing.T) {
+	require.Equal(t, [][2]string{{"a", "b = c"}, {`"x,y"`, "f(1, 2)"}}, splitAssignments(`a = b = c, "x,y" = f(1, 2)`))
+	require.Nil(t, splitAssignments("a, b = 1"))
+}
+
+func TestExecUpsert(t *testing.T) {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for _, stmt := range []string{
+		`CREATE TABLE t (id INT PRIMARY KEY, u INT UNIQUE, c INT, v VARCHAR DEFAULT 'default', n INT DEFAULT 0)`,
+		`CREATE INDEX t_c ON t (c)`,
+		`INSERT INTO t VALUES (1, 10, 100, 'a', 0), (2, 20, 200, 'b', 0)`,
+	} {
+		_, err := conn.ExecContext(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	exec := func(insert string, replace bool, set [][2]string, foundRows bool) (uint64, error) {
+		u := &upsert{
+			table:   `"main"."t"`,
+			columns: []string{"id", "u", "c", "v", "n"},
+			keys:    [][]string{{"id"}, {"u"}},
+			indexed: []string{"id", "u", "c"},
+			replace: replace,
+			insert:  insert,
+			set:     set,
+		}
+		sqlCtx := sql.NewEmptyContext()
+		iter, err := execUpsert(sqlCtx, conn, "main", "t", u, "", foundRows)
+		if err != nil {
+			return 0, err
+		}
+		row, err := iter.Next(sqlCtx)
+		require.NoError(t, err)
+		return row[0].(types.OkResult).RowsAffected, nil
+	}
+	rows := func() [][]any {
+		rs, err := conn.QueryContext(ctx, "SELECT id, u, c, v, n FROM t ORDER BY id")
+		require.NoError(t, err)
+		defer rs.Close()
+		var all [][]any
+		for rs.Next() {
+			var id, u, c, n int32
+			var v string
+			require.NoError(t, rs.Scan(&id, &u, &c, &v, &n))
+			all = append(all, []any{id, u, c, v, n})
+		}
+		return all
+	}
+
+	// REPLACE: a replaced row, an equal row, a row that conflicts on the unique key, and a new row with defaults.
+	affected, err := exec(`INSERT INTO t (id, u, c) VALUES (1, 10, 100), (2, 20, 200)`, true, nil, false)
+	require.NoError(t, err)
+	require.EqualValues(t, 2+2, affected)
+	affected, err = exec(`INSERT INTO t VALUES (1, 10, 100, 'default', 0)`, true, nil, false)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, affected)
+	affected, err = exec(`INSERT INTO t (id, u, c, v) VALUES (2, 20, 200, 'x'), (3, 30, 300, 'y')`, true, nil, false)
+	require.NoError(t, err)
+	require.EqualValues(t, 2+1, affected)
+	require.Equal(t, [][]any{{int32(1), int32(10), int32(100), "default", int32(0)}, {int32(2), int32(20), int32(200), "x", int32(0)}, {int32(3), int32(30), int32(300), "y", int32(0)}}, rows())
+
+	// REPLACE cannot change the indexed columns, nor replace several rows.
+	_, err = exec(`INSERT INTO t (id, u, c) VALUES (1, 10, 101)`, true, nil, false)
+	require.ErrorContains(t, err, "indexed columns")
+	_, err = exec(`INSERT INTO t (id, u, c) VALUES (1, 20, 100)`, true, nil, false)
+	require.ErrorContains(t, err, "several rows")
+
+	// ON DUPLICATE KEY UPDATE: the rows are matched on the primary key first, then the unique key.
+	set := [][2]string{{`"n"`, `"n" + 1`}}
+	affected, err = exec(`INSERT INTO t (id, u, c) VALUES (1, 0, 0), (9, 30, 0), (4, 40, 400)`, false, set, false)
+	require.NoError(t, err)
+	require.EqualValues(t, 2+2+1, affected)
+	require.Equal(t, [][]any{{int32(1), int32(10), int32(100), "default", int32(1)}, {int32(2), int32(20), int32(200), "x", int32(0)}, {int32(3), int32(30), int32(300), "y", int32(1)}, {int32(4), int32(40), int32(400), "default", int32(0)}}, rows())
+
+	// An update to the current values counts as 0, or 1 with CLIENT_FOUND_ROWS.
+	set = [][2]string{{`"v"`, `excluded."v"`}}
+	affected, err = exec(`INSERT INTO t (id, v) VALUES (2, 'x'), (3, 'z')`, false, set, false)
+	require.NoError(t, err)
+	require.EqualValues(t, 0+2, affected)
+	affected, err = exec(`INSERT INTO t (id, v) VALUES (2, 'x'), (3, 'z')`, false, set, true)
+	require.NoError(t, err)
+	require.EqualValues(t, 1+1, affected)
+}
+
+func TestMaskQuoted(t *testing.T) {
+	require.Equal(t, `SELECT '   ', "    ", `+"`a`"+` AS x`, maskQuoted(`SELECT 'a\'', "b""c", `+"`a`"+` AS x`))
+}
@@ -0,0 +1,324 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+)
+
+// The vectors of MySQL are stored as the arrays of FLOAT of DuckDB, e.g., the columns of type VECTOR(n),
+// see catalog/vector.go, and read as JSON arrays. The vector functions of MySQL and MariaDB are supported:
+//
+//	STRING_TO_VECTOR(s), TO_VECTOR(s), VEC_FROMTEXT(s)   the vector of the text, e.g., '[1,2,3]'
+//	VECTOR_TO_STRING(v), FROM_VECTOR(v), VEC_TOTEXT(v)   the text of the vector, e.g., '[1.00000e+00,...]'
+//	VECTOR_DIM(v)                                        the dimension of the vector
+//	DISTANCE(a, b, metric)                               the distance of the metric: EUCLIDEAN, COSINE, or DOT
+//	VEC_DISTANCE_EUCLIDEAN(a, b), VEC_DISTANCE_COSINE(a, b)
+//
+// The DOT metric is the inner product. The arguments are the vectors or their text.
+// A query run in DuckDB calls the corresponding macros of the catalog instead, see expandVectorFunctions,
+// while a query run in the engine evaluates the functions below.
+
+// vectorMacros maps the vector functions to the macros of the catalog that implement them in DuckDB.
+var vectorMacros = map[string]string{
+	"string_to_vector":       catalog.MacroNameMyVecFromText,
+	"to_vector":              catalog.MacroNameMyVecFromText,
+	"vec_fromtext":           catalog.MacroNameMyVecFromText,
+	"vector_to_string":       catalog.MacroNameMyVecToText,
+	"from_vector":            catalog.MacroNameMyVecToText,
+	"vec_totext":             catalog.MacroNameMyVecToText,
+	"vector_dim":             catalog.MacroNameMyVecDim,
+	"distance":               catalog.MacroNameMyVecDistance,
+	"vec_distance_euclidean": catalog.MacroNameMyVecDistanceEuclidean,
+	"vec_distance_cosine":    catalog.MacroNameMyVecDistanceCosine,
+}
+
+// vectorFunctionCallRegex matches the calls of the vector functions in a query translated to DuckDB.
+var vectorFunctionCallRegex = regexp.MustCompile(`(?i)(^|[^\w$."])(string_to_vector|to_vector|vec_fromtext|vector_to_string|` +
+	`from_vector|vec_totext|vector_dim|distance|vec_distance_euclidean|vec_distance_cosine)\s*\(`)
+
+// expandVectorFunctions replaces the calls of the vector functions in a query translated to DuckDB
+// with the calls of their macros.
+func expandVectorFunctions(duckSQL string) string {
+	lower := strings.ToLower(duckSQL)
+	if !strings.Contains(lower, "vec") && !strings.Contains(lower, "distance") {
+		return duckSQL
+	}
+	masked := maskQuoted(duckSQL)
+	var b strings.Builder
+	last := 0
+	for _, m := range vectorFunctionCallRegex.FindAllStringSubmatchIndex(masked, -1) {
+		b.WriteString(duckSQL[last:m[4]])
+		b.WriteString(catalog.SchemaNameSYS + "." + vectorMacros[strings.ToLower(duckSQL[m[4]:m[5]])] + "(")
+		last = m[1]
+	}
+	b.WriteString(duckSQL[last:])
+	return b.String()
+}
+
+// VectorFunctions are the vector functions on the MySQL protocol.
+var VectorFunctions = []sql.Function{
+	sql.Function1{Name: "string_to_vector", Fn: newVectorFunc("string_to_vector", vecFromText)},
+	sql.Function1{Name: "to_vector", Fn: newVectorFunc("to_vector", vecFromText)},
+	sql.Function1{Name: "vec_fromtext", Fn: newVectorFunc("vec_fromtext", vecFromText)},
+	sql.Function1{Name: "vector_to_string", Fn: newVectorFunc("vector_to_string", vecToText)},
+	sql.Function1{Name: "from_vector", Fn: newVectorFunc("from_vector", vecToText)},
+	sql.Function1{Name: "vec_totext", Fn: newVectorFunc("vec_totext", vecToText)},
+	sql.Function1{Name: "vector_dim", Fn: newVectorFunc("vector_dim", vecDim)},
+	sql.Function3{Name: "distance", Fn: newVectorFunc3("distance", vecDistance)},
+	sql.Function2{Name: "vec_distance_euclidean", Fn: newVectorFunc2("vec_distance_euclidean", vecDistanceEuclidean)},
+	sql.Function2{Name: "vec_distance_cosine", Fn: newVectorFunc2("vec_distance_cosine", vecDistanceCosine)},
+}
+
+// vectorKind is the implementation of a vector function in the engine.
+type vectorKind struct {
+	typ  sql.Type
+	eval func(args []any) (any, error)
+}
+
+var (
+	vecFromText = vectorKind{types.JSON, func(args []any) (any, error) {
+		v, err := parseVector(args[0])
+		if err != nil {
+			return nil, err
+		}
+		doc := make([]any, len(v))
+		for i, x := range v {
+			doc[i] = x
+		}
+		return types.JSONDocument{Val: doc}, nil
+	}}
+	vecToText = vectorKind{types.LongText, func(args []any) (any, error) {
+		v, err := parseVector(args[0])
+		if err != nil {
+			return nil, err
+		}
+		elems := make([]string, len(v))
+		for i, x := range v {
+			elems[i] = fmt.Sprintf("%.5e", float32(x))
+		}
+		return "[" + strings.Join(elems, ",") + "]", nil
+	}}
+	vecDim = vectorKind{types.Int64, func(args []any) (any, error) {
+		v, err := parseVector(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return int64(len(v)), nil
+	}}
+	vecDistance = vectorKind{types.Float64, func(args []any) (any, error) {
+		metric, _, err := types.LongText.Convert(args[2])
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToUpper(metric.(string)) {
+		case "EUCLIDEAN":
+			return vecDistanceEuclidean.eval(args[:2])
+		case "COSINE":
+			return vecDistanceCosine.eval(args[:2])
+		case "DOT":
+			a, b, err := parseVectorPair(args[0], args[1])
+			if err != nil {
+				return nil, err
+			}
+			var dot float64
+			for i := range a {
+				dot += a[i] * b[i]
+			}
+			return dot, nil
+		default:
+			return nil, fmt.Errorf("unknown distance metric: %v", metric)
+		}
+	}}
+	vecDistanceEuclidean = vectorKind{types.Float64, func(args []any) (any, error) {
+		a, b, err := parseVectorPair(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		var sum float64
+		for i := range a {
+			sum += (a[i] - b[i]) * (a[i] - b[i])
+		}
+		return math.Sqrt(sum), nil
+	}}
+	vecDistanceCosine = vectorKind{types.Float64, func(args []any) (any, error) {
+		a, b, err := parseVectorPair(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		var dot, normA, normB float64
+		for i := range a {
+			dot += a[i] * b[i]
+			normA += a[i] * a[i]
+			normB += b[i] * b[i]
+		}
+		return 1 - dot/math.Sqrt(normA*normB), nil
+	}}
+)
+
+// parseVector returns the elements of a vector, which is a JSON array or its text.
+func parseVector(value any) ([]float64, error) {
+	switch v := value.(type) {
+	case sql.JSONWrapper:
+		doc, err := v.ToInterface()
+		if err != nil {
+			return nil, err
+		}
+		value = doc
+	case []byte:
+		value = string(v)
+	}
+	if s, ok := value.(string); ok {
+		if err := json.Unmarshal([]byte(s), &value); err != nil {
+			return nil, fmt.Errorf("invalid vector: %s", s)
+		}
+	}
+	elems, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid vector: %v", value)
+	}
+	v := make([]float64, len(elems))
+	for i, e := range elems {
+		switch e := e.(type) {
+		case float64:
+			v[i] = e
+		case float32:
+			v[i] = float64(e)
+		case json.Number:
+			f, err := e.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("invalid vector: %v", value)
+			}
+			v[i] = f
+		default:
+			x, _, err := types.Float64.Convert(e)
+			if err != nil || x == nil {
+				return nil, fmt.Errorf("invalid vector: %v", value)
+			}
+			v[i] = x.(float64)
+		}
+	}
+	return v, nil
+}
+
+// parseVectorPair returns the elements of two vectors of the same dimension.
+func parseVectorPair(a, b any) ([]float64, []float64, error) {
+	va, err := parseVector(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	vb, err := parseVector(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(va) != len(vb) {
+		return nil, nil, fmt.Errorf("the dimensions of the vectors differ: %d and %d", len(va), len(vb))
+	}
+	return va, vb, nil
+}
+
+func newVectorFunc(name string, kind vectorKind) sql.CreateFunc1Args {
+	return func(arg sql.Expression) sql.Expression {
+		return &VectorFunc{name: name, kind: kind, args: []sql.Expression{arg}}
+	}
+}
+
+func newVectorFunc2(name string, kind vectorKind) sql.CreateFunc2Args {
+	return func(a, b sql.Expression) sql.Expression {
+		return &VectorFunc{name: name, kind: kind, args: []sql.Expression{a, b}}
+	}
+}
+
+func newVectorFunc3(name string, kind vectorKind) sql.CreateFunc3Args {
+	return func(a, b, c sql.Expression) sql.Expression {
+		return &VectorFunc{name: name, kind: kind, args: []sql.Expression{a, b, c}}
+	}
+}
+
+// VectorFunc is a vector function evaluated in the engine. It is NULL if any argument is NULL.
+type VectorFunc struct {
+	name string
+	kind vectorKind
+	args []sql.Expression
+}
+
+var _ sql.FunctionExpression = (*VectorFunc)(nil)
+var _ sql.CollationCoercible = (*VectorFunc)(nil)
+
+// FunctionName implements sql.FunctionExpression
+func (f *VectorFunc) FunctionName() string {
+	return f.name
+}
+
+// Description implements sql.FunctionExpression
+func (f *VectorFunc) Description() string {
+	return "a vector function of MySQL."
+}
+
+// Resolved implements the Expression interface.
+func (f *VectorFunc) Resolved() bool {
+	for _, arg := range f.args {
+		if !arg.Resolved() {
+			return false
+		}
+	}
+	return true
+}
+
+// IsNullable implements the Expression interface.
+func (f *VectorFunc) IsNullable() bool {
+	return true
+}
+
+// Children implements the Expression interface.
+func (f *VectorFunc) Children() []sql.Expression {
+	return f.args
+}
+
+// Eval implements the Expression interface.
+func (f *VectorFunc) Eval(ctx *sql.Context, row sql.Row) (interface{}, error) {
+	values := make([]any, len(f.args))
+	for i, arg := range f.args {
+		v, err := arg.Eval(ctx, row)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return f.kind.eval(values)
+}
+
+func (f *VectorFunc) String() string {
+	args := make([]string, len(f.args))
+	for i, arg := range f.args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", f.name, strings.Join(args, ", "))
+}
+
+// WithChildren implements the Expression interface.
+func (f *VectorFunc) WithChildren(children ...sql.Expression) (sql.Expression, error) {
+	if len(children) != len(f.args) {
+		return nil, sql.ErrInvalidChildrenNumber.New(f, len(children), len(f.args))
+	}
+	return &VectorFunc{name: f.name, kind: f.kind, args: children}, nil
+}
+
+// Type implements the Expression interface.
+func (f *VectorFunc) Type() sql.Type {
+	return f.kind.typ
+}
+
+// CollationCoercibility implements the interface sql.CollationCoercible.
+func (f *VectorFunc) CollationCoercibility(ctx *sql.Context) (collation sql.CollationID, coercibility byte) {
+	if types.IsText(f.kind.typ) {
+		return sql.Collation_Default, 4
+	}
+	return sql.Collation_binary, 5
+}
@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectorFunctions(t *testing.T) {
+	ctx := sql.NewEmptyContext()
+	eval := func(name string, args ...any) any {
+		exprs := make([]sql.Expression, len(args))
+		for i, arg := range args {
+			exprs[i] = expression.NewLiteral(arg, types.LongText)
+		}
+		var f sql.Expression
+		switch fn := findVectorFunction(t, name).(type) {
+		case sql.Function1:
+			f = fn.Fn(exprs[0])
+		case sql.Function2:
+			f = fn.Fn(exprs[0], exprs[1])
+		case sql.Function3:
+			f = fn.Fn(exprs[0], exprs[1], exprs[2])
+		}
+		v, err := f.Eval(ctx, nil)
+		require.NoError(t, err)
+		return v
+	}
+
+	require.Equal(t, types.JSONDocument{Val: []any{1.0, 2.0, 3.0}}, eval("string_to_vector", "[1,2,3]"))
+	require.Equal(t, "[1.00000e+00,2.50000e+00]", eval("vector_to_string", "[1,2.5]"))
+	require.Equal(t, int64(3), eval("vector_dim", "[1,2,3]"))
+	require.Equal(t, 5.0, eval("distance", "[0,0]", "[3,4]", "euclidean"))
+	require.Equal(t, 5.0, eval("vec_distance_euclidean", "[0,0]", "[3,4]"))
+	require.Equal(t, 1.0, eval("vec_distance_cosine", "[1,0]", "[0,1]"))
+	require.Equal(t, 11.0, eval("distance", "[1,2]", "[3,4]", "DOT"))
+	require.Nil(t, eval("vector_dim", nil))
+
+	_, err := vecDistanceEuclidean.eval([]any{"[1,2]", "[1,2,3]"})
+	require.Error(t, err)
+	_, err = vecDistance.eval([]any{"[1]", "[1]", "MANHATTAN"})
+	require.Error(t, err)
+	_, err = vecDim.eval([]any{"not a vector"})
+	require.Error(t, err)
+}
+
+func findVectorFunction(t *testing.T, name string) sql.Function {
+	for _, f := range VectorFunctions {
+		if f.FunctionName() == name {
+			return f
+		}
+	}
+	t.Fatalf("function %s is not found", name)
+	return nil
+}
+
+func TestExpandVectorFunctions(t *testing.T) {
+	require.Equal(t,
+		"SELECT id FROM t ORDER BY __sys__.my_vec_distance(v, __sys__.my_vec_from_text('[1,2]'), 'COSINE') LIMIT 3",
+		expandVectorFunctions("SELECT id FROM t ORDER BY DISTANCE(v, STRING_TO_VECTOR('[1,2]'), 'COSINE') LIMIT 3"))
+	require.Equal(t,
+		"SELECT __sys__.my_vec_distance_euclidean(a, b), __sys__.my_vec_dim(a) FROM t",
+		expandVectorFunctions("SELECT vec_distance_euclidean (a, b), VECTOR_DIM(a) FROM t"))
+	// The strings, the identifiers, and the qualified functions are left untouched.
+	for _, query := range []string{
+		"SELECT 'distance(a)', \"vector_dim\"(a), s.distance(a) FROM t",
+		"SELECT distance FROM t",
+	} {
+		require.Equal(t, query, expandVectorFunctions(query))
+	}
+}
@@ -0,0 +1,536 @@
+package binlogreplication
+
+import (
+	"context"
+	stdsql "database/sql"
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	gms "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/sirupsen/logrus"
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/mysql/replication"
+	"vitess.io/vitess/go/sqltypes"
+	vquery "vitess.io/vitess/go/vt/proto/query"
+)
+
+const (
+	// initialSyncBatchRows and initialSyncBatchSize bound the number of rows and the size of the data
+	// that are loaded into DuckDB at a time during the initial sync.
+	initialSyncBatchRows = 1 << 17
+	initialSyncBatchSize = 64 << 20 // 64MB
+	// initialSyncMaxWorkers is the maximum number of source connections that read the tables in parallel.
+	initialSyncMaxWorkers = 8
+)
+
+// snapshotTable is a table of the replication source that is cloned by the initial sync.
+type snapshotTable struct {
+	database, name string
+	createStmt     string
+}
+
+// snapshotBatch is a batch of rows read from a source table, to be loaded into the replica.
+type snapshotBatch struct {
+	table  *snapshotTable
+	record arrow.Record
+}
+
+// sourceSnapshot is a consistent view of the replication source. All worker connections read
+// the tables in transactions that were started at the binlog position of the snapshot.
+type sourceSnapshot struct {
+	position  replication.Position
+	tables    []*snapshotTable
+	workers   []*mysql.Conn
+	closeOnce sync.Once
+}
+
+func (s *sourceSnapshot) Close() {
+	s.closeOnce.Do(func() {
+		for _, conn := range s.workers {
+			conn.Close()
+		}
+	})
+}
+
+// isInitialSyncEnabled returns true if the replica should clone the source before streaming binlog events,
+// as configured by the @@GLOBAL.replica_initial_sync system variable.
+func isInitialSyncEnabled() bool {
+	_, value, ok := sql.SystemVariables.GetGlobal("replica_initial_sync")
+	if !ok {
+		return false
+	}
+	if b, ok := value.(int8); ok {
+		return b != 0
+	}
+	return false
+}
+
+// runInitialSyncIfNeeded clones the schemas and data of the replication source into the replica and records
+// the binlog position of the clone, from which the binlog streaming then starts. This happens only if the
+// initial sync is enabled, it has not been done before, and the replica has not applied any binlog events
+// from the source yet.
+func (a *binlogReplicaApplier) runInitialSyncIfNeeded(ctx *sql.Context, params mysql.ConnParams, mariaDB bool) error {
+	if !isInitialSyncEnabled() {
+		return nil
+	}
+	position, err := positionStore.Load(params.Flavor, ctx, a.engine)
+	if err != nil {
+		return err
+	}
+	if !position.IsZero() {
+		return nil
+	}
+	// The position stays empty after a sync of a source that has executed nothing yet,
+	// until an event is applied, so the marker keeps the sync from being repeated on reconnection.
+	if synced, err := positionStore.InitialSynced(ctx); err != nil || synced {
+		return err
+	}
+
+	ctx.GetLogger().Info("starting the initial sync from the replication source...")
+	start := time.Now()
+	position, err = a.initialSync(ctx, params, mariaDB)
+	if err != nil {
+		return err
+	}
+
+	// An empty GTID set means that nothing has been executed on the source yet,
+	// so the binlog streaming starts at the very beginning as usual.
+	if !position.IsZero() {
+		if err := positionStore.Save(ctx, a.engine, position); err != nil {
+			return err
+		}
+	}
+	if err := positionStore.MarkInitialSynced(ctx, position); err != nil {
+		return err
+	}
+	if err := adapter.CommitAndCloseTxn(ctx); err != nil {
+		return err
+	}
+	ctx.GetLogger().WithFields(logrus.Fields{
+		"position": position.String(),
+		"elapsed":  time.Since(start).String(),
+	}).Info("finished the initial sync from the replication source")
+	return nil
+}
+
+// initialSync copies the tables of the replication source into the replica and returns the binlog position
+// of the copy. Existing tables of the same names on the replica are replaced.
+// The sync is aborted with ErrReplicationStopped if STOP REPLICA is called in the meantime.
+func (a *binlogReplicaApplier) initialSync(ctx *sql.Context, params mysql.ConnParams, mariaDB bool) (replication.Position, error) {
+	syncCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() {
+		select {
+		case <-a.stopReplicationChan:
+			cancel(ErrReplicationStopped)
+		case <-syncCtx.Done():
+		}
+	}()
+
+	workers := min(runtime.GOMAXPROCS(0), initialSyncMaxWorkers)
+	snapshot, err := openSourceSnapshot(syncCtx, params, mariaDB, workers, func(database, table string) bool {
+		return a.filters.isTableFilteredOut(ctx, &mysql.TableMap{Database: database, Name: table})
+	})
+	if err != nil {
+		return replication.Position{}, err
+	}
+	defer snapshot.Close()
+
+	// The source connections do not support cancellation, so they are closed to interrupt the reads.
+	go func() {
+		<-syncCtx.Done()
+		snapshot.Close()
+	}()
+
+	if err := a.createSnapshotTables(ctx, a.engine, snapshot.tables); err != nil {
+		return replication.Position{}, err
+	}
+
+	if err := a.copySnapshotTables(ctx, syncCtx, snapshot); err != nil {
+		if cause := context.Cause(syncCtx); cause != nil {
+			return replication.Position{}, cause
+		}
+		return replication.Position{}, err
+	}
+	return snapshot.position, nil
+}
+
+// openSourceSnapshot opens |workers| connections to the source that share a consistent snapshot.
+// The source is locked with FLUSH TABLES WITH READ LOCK (which requires the RELOAD privilege) while
+// the snapshot transactions are started and the binlog position and the table definitions are read.
+func openSourceSnapshot(
+	ctx context.Context, params mysql.ConnParams, mariaDB bool, workers int,
+	filteredOut func(database, table string) bool,
+) (snapshot *sourceSnapshot, err error) {
+	lockConn, err := mysql.Connect(ctx, &params)
+	if err != nil {
+		return nil, err
+	}
+	defer lockConn.Close()
+
+	if _, err := lockConn.ExecuteFetch("FLUSH TABLES WITH READ LOCK", 0, false); err != nil {
+		return nil, fmt.Errorf("unable to lock the replication source for a consistent snapshot: %w", err)
+	}
+
+	snapshot = &sourceSnapshot{}
+	defer func() {
+		if err != nil {
+			snapshot.Close()
+		}
+	}()
+
+	for range workers {
+		conn, err := mysql.Connect(ctx, &params)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.workers = append(snapshot.workers, conn)
+		for _, query := range []string{
+			// The values of TIMESTAMP columns are read in UTC, in which they are written by the binlog applier.
+			"SET SESSION time_zone = '+00:00'",
+			"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+			"START TRANSACTION WITH CONSISTENT SNAPSHOT",
+		} {
+			if _, err := conn.ExecuteFetch(query, 0, false); err != nil {
+				return nil, fmt.Errorf("unable to start a snapshot transaction on the replication source: %w", err)
+			}
+		}
+	}
+
+	if snapshot.position, err = querySourcePosition(lockConn, mariaDB, params.Flavor); err != nil {
+		return nil, err
+	}
+	if snapshot.tables, err = querySourceTables(lockConn, filteredOut); err != nil {
+		return nil, err
+	}
+
+	if _, err := lockConn.ExecuteFetch("UNLOCK TABLES", 0, false); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// querySourcePosition returns the binlog position of the locked source.
+func querySourcePosition(conn *mysql.Conn, mariaDB bool, flavorName string) (replication.Position, error) {
+	if flavorName == replication.FilePosFlavorID {
+		// SHOW MASTER STATUS was renamed to SHOW BINARY LOG STATUS in MySQL 8.4.
+		qr, err := conn.ExecuteFetch("SHOW BINARY LOG STATUS", 1, false)
+		if err != nil {
+			qr, err = conn.ExecuteFetch("SHOW MASTER STATUS", 1, false)
+		}
+		if err != nil {
+			return replication.Position{}, fmt.Errorf("unable to query the binlog position of the replication source: %w", err)
+		}
+		if len(qr.Rows) == 0 {
+			return replication.Position{}, fmt.Errorf("binary logging is not enabled on the replication source")
+		}
+		pos, err := qr.Rows[0][1].ToUint32()
+		if err != nil {
+			return replication.Position{}, err
+		}
+		return replication.Position{GTIDSet: replication.FilePosGTID{File: qr.Rows[0][0].ToString(), Pos: pos}}, nil
+	}
+
+	query := "SELECT @@GLOBAL.gtid_executed"
+	if mariaDB {
+		query = "SELECT @@GLOBAL.gtid_binlog_pos"
+	}
+	qr, err := conn.ExecuteFetch(query, 1, false)
+	if err != nil {
+		return replication.Position{}, fmt.Errorf("unable to query the executed GTIDs of the replication source: %w", err)
+	}
+	if len(qr.Rows) == 0 {
+		return replication.Position{}, fmt.Errorf("no rows returned when querying the executed GTIDs of the replication source")
+	}
+	// A GTID set with multiple source UUIDs is printed on multiple lines.
+	gtidSet := strings.Join(strings.Fields(qr.Rows[0][0].ToString()), "")
+	if gtidSet == "" {
+		return replication.Position{}, nil
+	}
+	return replication.ParsePosition(flavorName, gtidSet)
+}
+
+// querySourceTables returns the user tables of the source along with their definitions.
+func querySourceTables(conn *mysql.Conn, filteredOut func(database, table string) bool) ([]*snapshotTable, error) {
+	qr, err := conn.ExecuteFetch(
+		"SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES"+
+			" WHERE TABLE_TYPE = 'BASE TABLE'"+
+			" AND TABLE_SCHEMA NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys')"+
+			" ORDER BY TABLE_SCHEMA, TABLE_NAME",
+		-1, false,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the tables of the replication source: %w", err)
+	}
+
+	var tables []*snapshotTable
+	for _, row := range qr.Rows {
+		database, name := row[0].ToString(), row[1].ToString()
+		if filteredOut(database, name) {
+			continue
+		}
+		ddl, err := conn.ExecuteFetch("SHOW CREATE TABLE "+quoteMySQLIdentifier(database)+"."+quoteMySQLIdentifier(name), 1, false)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the definition of table %s.%s: %w", database, name, err)
+		}
+		if len(ddl.Rows) == 0 {
+			return nil, fmt.Errorf("no rows returned when reading the definition of table %s.%s", database, name)
+		}
+		tables = append(tables, &snapshotTable{database: database, name: name, createStmt: ddl.Rows[0][1].ToString()})
+	}
+	return tables, nil
+}
+
+// createSnapshotTables creates the databases and tables of the snapshot on the replica, replacing existing tables,
+// which may have been left by an interrupted sync.
+func (a *binlogReplicaApplier) createSnapshotTables(ctx *sql.Context, engine *gms.Engine, tables []*snapshotTable) error {
+	created := make(map[string]bool)
+	for _, t := range tables {
+		if !created[t.database] {
+			if err := a.execute(ctx, engine, "CREATE DATABASE IF NOT EXISTS "+quoteMySQLIdentifier(t.database)); err != nil {
+				return err
+			}
+			created[t.database] = true
+		}
+		for _, query := range []string{"DROP TABLE IF EXISTS " + quoteMySQLIdentifier(t.name), t.createStmt} {
+			subctx := sql.NewContext(ctx, sql.WithSession(ctx.Session)).WithQuery(query)
+			subctx.SetCurrentDatabase(t.database)
+			if err := a.execute(subctx, engine, query); err != nil {
+				return fmt.Errorf("unable to create table %s.%s: %w", t.database, t.name, err)
+			}
+		}
+	}
+	return adapter.CommitAndCloseTxn(ctx)
+}
+
+// copySnapshotTables reads the tables with the worker connections of the snapshot in parallel,
+// and loads the rows into the replica through a single DuckDB connection.
+func (a *binlogReplicaApplier) copySnapshotTables(ctx *sql.Context, syncCtx context.Context, snapshot *sourceSnapshot) error {
+	conn, err := adapter.GetCatalogConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The reads are canceled as soon as a table fails to be read or loaded.
+	copyCtx, cancel := context.WithCancelCause(syncCtx)
+	defer cancel(nil)
+
+	tableChan := make(chan *snapshotTable, len(snapshot.tables))
+	for _, t := range snapshot.tables {
+		tableChan <- t
+	}
+	close(tableChan)
+
+	var (
+		batchChan = make(chan snapshotBatch, len(snapshot.workers))
+		errChan   = make(chan error, len(snapshot.workers))
+		wg        sync.WaitGroup
+	)
+	for _, worker := range snapshot.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tableChan {
+				if err := readSnapshotTable(copyCtx, worker, t, batchChan); err != nil {
+					err = fmt.Errorf("unable to read table %s.%s from the replication source: %w", t.database, t.name, err)
+					errChan <- err
+					cancel(err)
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(batchChan)
+	}()
+
+	rows := make(map[*snapshotTable]int64)
+	var loadErr error
+	for batch := range batchChan {
+		if loadErr == nil {
+			if loadErr = loadSnapshotBatch(copyCtx, conn, batch); loadErr != nil {
+				cancel(loadErr)
+			}
+			rows[batch.table] += batch.record.NumRows()
+		}
+		batch.record.Release()
+	}
+	if loadErr != nil {
+		return loadErr
+	}
+	select {
+	case err := <-errChan:
+		return err
+	default:
+	}
+
+	for _, t := range snapshot.tables {
+		ctx.GetLogger().WithFields(logrus.Fields{
+			"database": t.database,
+			"table":    t.name,
+			"rows":     rows[t],
+		}).Debug("copied table from the replication source")
+	}
+	return nil
+}
+
+// readSnapshotTable streams the rows of the table from the source and sends them in batches of Arrow records.
+func readSnapshotTable(ctx context.Context, conn *mysql.Conn, t *snapshotTable, batchChan chan<- snapshotBatch) error {
+	if err := conn.ExecuteStreamFetch("SELECT * FROM " + quoteMySQLIdentifier(t.database) + "." + quoteMySQLIdentifier(t.name)); err != nil {
+		return err
+	}
+	defer conn.CloseResult()
+	fields, err := conn.Fields()
+	if err != nil {
+		return err
+	}
+
+	builder := newSnapshotRecordBuilder(fields)
+	defer builder.Release()
+	send := func() error {
+		record := builder.NewRecord()
+		select {
+		case batchChan <- snapshotBatch{table: t, record: record}:
+			return nil
+		case <-ctx.Done():
+			record.Release()
+			return context.Cause(ctx)
+		}
+	}
+
+	var (
+		row       []sqltypes.Value
+		batchRows int
+		batchSize int
+	)
+	for {
+		row, err = conn.FetchNext(row[:0])
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+		batchSize += appendSnapshotRow(builder, fields, row)
+		batchRows++
+		if batchRows >= initialSyncBatchRows || batchSize >= initialSyncBatchSize {
+			if err := send(); err != nil {
+				return err
+			}
+			batchRows, batchSize = 0, 0
+		}
+	}
+	if batchRows > 0 {
+		return send()
+	}
+	return nil
+}
+
+// newSnapshotRecordBuilder creates a builder of Arrow records for the rows of a source table.
+// The values are kept in their text representations and cast by DuckDB when they are inserted,
+// except that the binary strings are kept as bytes.
+func newSnapshotRecordBuilder(fields []*vquery.Field) *array.RecordBuilder {
+	arrowFields := make([]arrow.Field, len(fields))
+	for i, field := range fields {
+		typ := arrow.DataType(arrow.BinaryTypes.String)
+		if sqltypes.IsBinary(field.Type) && field.Type != sqltypes.Bit {
+			typ = arrow.BinaryTypes.Binary
+		}
+		arrowFields[i] = arrow.Field{Name: field.Name, Type: typ, Nullable: true}
+	}
+	return array.NewRecordBuilder(memory.DefaultAllocator, arrow.NewSchema(arrowFields, nil))
+}
+
+// appendSnapshotRow appends a row of the text protocol to the record builder and returns the size of the row.
+func appendSnapshotRow(builder *array.RecordBuilder, fields []*vquery.Field, row []sqltypes.Value) int {
+	size := 0
+	for i, value := range row {
+		switch b := builder.Field(i).(type) {
+		case *array.StringBuilder:
+			if value.IsNull() {
+				b.AppendNull()
+			} else if fields[i].Type == sqltypes.Bit {
+				// BIT values are sent as big-endian bytes and stored as unsigned integers.
+				var buf [8]byte
+				raw := value.Raw()
+				copy(buf[8-min(len(raw), 8):], raw)
+				b.Append(strconv.FormatUint(binary.BigEndian.Uint64(buf[:]), 10))
+			} else {
+				b.Append(value.ToString())
+			}
+		case *array.BinaryBuilder:
+			if value.IsNull() {
+				b.AppendNull()
+			} else {
+				b.Append(value.Raw())
+			}
+		}
+		size += value.Len()
+	}
+	return size
+}
+
+// loadSnapshotBatch inserts the rows of the batch into the replica table.
+func loadSnapshotBatch(ctx context.Context, conn *stdsql.Conn, batch snapshotBatch) error {
+	schema := batch.record.Schema()
+	reader, err := array.NewRecordReader(schema, []arrow.Record{batch.record})
+	if err != nil {
+		return err
+	}
+	defer reader.Release()
+
+	viewName := "__sys_initial_sync_" + strconv.FormatUint(uint64(time.Now().UnixNano()), 36) + "__"
+	var release func()
+	if err := conn.Raw(func(driverConn any) error {
+		arrow, err := duckdb.NewArrowFromConn(driverConn.(*duckdb.Conn))
+		if err != nil {
+			return err
+		}
+		release, err = arrow.RegisterView(reader, viewName)
+		return err
+	}); err != nil {
+		return err
+	}
+	defer release()
+
+	if _, err := conn.ExecContext(ctx, buildSnapshotInsert(batch.table, schema, viewName)); err != nil {
+		return fmt.Errorf("unable to load table %s.%s: %w", batch.table.database, batch.table.name, err)
+	}
+	return nil
+}
+
+// buildSnapshotInsert builds the statement that inserts the rows of the Arrow view into the replica table.
+// DuckDB casts the text values to the column types.
+func buildSnapshotInsert(t *snapshotTable, schema *arrow.Schema, viewName string) string {
+	var b strings.Builder
+	b.WriteString("INSERT INTO ")
+	b.WriteString(catalog.ConnectIdentifiersANSI(t.database, t.name))
+	b.WriteString(" (")
+	for i, field := range schema.Fields() {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(catalog.QuoteIdentifierANSI(field.Name))
+	}
+	b.WriteString(") SELECT * FROM ")
+	b.WriteString(viewName)
+	return b.String()
+}
+
+// quoteMySQLIdentifier quotes an identifier for MySQL with backticks.
+func quoteMySQLIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
@@ -0,0 +1,102 @@
+package binlogreplication
+
+import (
+	"context"
+	stdsql "database/sql"
+	"testing"
+	"time"
+
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/sqltypes"
+	vquery "vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestLoadSnapshotBatch(t *testing.T) {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+
+	// The column types are those that the MySQL types are mapped to.
+	_, err = db.Exec(`CREATE SCHEMA db01`)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE db01."my table" (id INTEGER PRIMARY KEY, price DECIMAL(10, 2), created TIMESTAMP, elapsed INTERVAL, flags UBIGINT, data BLOB, "my note" VARCHAR, size ENUM('S', 'M', 'L'))`)
+	require.NoError(t, err)
+
+	fields := []*vquery.Field{
+		{Name: "id", Type: sqltypes.Int32},
+		{Name: "price", Type: sqltypes.Decimal},
+		{Name: "created", Type: sqltypes.Datetime},
+		{Name: "elapsed", Type: sqltypes.Time},
+		{Name: "flags", Type: sqltypes.Bit},
+		{Name: "data", Type: sqltypes.Blob},
+		{Name: "my note", Type: sqltypes.Text},
+		{Name: "size", Type: sqltypes.Enum},
+	}
+	rows := [][]sqltypes.Value{
+		{
+			sqltypes.MakeTrusted(sqltypes.Int32, []byte("1")),
+			sqltypes.MakeTrusted(sqltypes.Decimal, []byte("12.34")),
+			sqltypes.MakeTrusted(sqltypes.Datetime, []byte("2024-01-02 03:04:05.123456")),
+			sqltypes.MakeTrusted(sqltypes.Time, []byte("-838:59:59")),
+			sqltypes.MakeTrusted(sqltypes.Bit, []byte{0x01, 0x02}),
+			sqltypes.MakeTrusted(sqltypes.Blob, []byte{0x00, 0xff, '\\'}),
+			sqltypes.MakeTrusted(sqltypes.Text, []byte("it's")),
+			sqltypes.MakeTrusted(sqltypes.Enum, []byte("M")),
+		},
+		{
+			sqltypes.MakeTrusted(sqltypes.Int32, []byte("2")),
+			sqltypes.NULL, sqltypes.NULL, sqltypes.NULL, sqltypes.NULL, sqltypes.NULL, sqltypes.NULL, sqltypes.NULL,
+		},
+	}
+
+	builder := newSnapshotRecordBuilder(fields)
+	defer builder.Release()
+	rowSize := 0
+	for _, row := range rows {
+		rowSize += appendSnapshotRow(builder, fields, row)
+	}
+	require.Positive(t, rowSize)
+	record := builder.NewRecord()
+	defer record.Release()
+
+	table := &snapshotTable{database: "db01", name: "my table"}
+	require.Equal(t,
+		`INSERT INTO "db01"."my table" ("id", "price", "created", "elapsed", "flags", "data", "my note", "size") SELECT * FROM v`,
+		buildSnapshotInsert(table, record.Schema(), "v"),
+	)
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, loadSnapshotBatch(ctx, conn, snapshotBatch{table: table, record: record}))
+
+	var (
+		id      int32
+		price   string
+		created time.Time
+		elapsed string
+		flags   uint64
+		data    []byte
+		note    string
+		size    string
+	)
+	require.NoError(t, conn.QueryRowContext(ctx,
+		`SELECT id, price::VARCHAR, created, elapsed::VARCHAR, flags, data, "my note", size FROM db01."my table" WHERE id = 1`,
+	).Scan(&id, &price, &created, &elapsed, &flags, &data, &note, &size))
+	require.Equal(t, "12.34", price)
+	require.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC), created.UTC())
+	require.Equal(t, "-838:59:59", elapsed)
+	require.EqualValues(t, 0x0102, flags)
+	require.Equal(t, []byte{0x00, 0xff, '\\'}, data)
+	require.Equal(t, "it's", note)
+	require.Equal(t, "M", size)
+
+	var nulls int
+	require.NoError(t, conn.QueryRowContext(ctx,
+		`SELECT count(*) FROM db01."my table" WHERE id = 2 AND price IS NULL AND created IS NULL AND elapsed IS NULL AND flags IS NULL AND data IS NULL AND "my note" IS NULL AND size IS NULL`,
+	).Scan(&nulls))
+	require.Equal(t, 1, nulls)
+}
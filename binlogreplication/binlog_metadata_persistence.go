@@ -15,12 +15,21 @@
 package binlogreplication
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	stdsql "database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sync"
 
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
 	"github.com/apecloud/myduckserver/configuration"
 	gms "github.com/dolthub/go-mysql-server"
 	"github.com/dolthub/go-mysql-server/sql"
@@ -42,13 +51,74 @@ const (
 	notRunning
 )
 
-// persistReplicationConfiguration saves the specified |replicaSourceInfo| to the "mysql"
-// database |mysqlDb|. If any problems are encountered while saving to disk, an error is returned.
-func persistReplicationConfiguration(ctx *sql.Context, replicaSourceInfo *mysql_db.ReplicaSourceInfo, mysqlDb *mysql_db.MySQLDb) error {
-	ed := mysqlDb.Editor()
-	defer ed.Close()
-	ed.PutReplicaSourceInfo(replicaSourceInfo)
-	return mysqlDb.Persist(ctx, ed)
+// replicaSourceKeyFilename holds the name of the file that stores the key to encrypt the source password.
+const replicaSourceKeyFilename = "source-key"
+
+// SourceKeyFile returns the path of the file that stores the key to encrypt the source password in the data
+// directory, which is shipped along with the data file when a replica is bootstrapped from another one.
+func SourceKeyFile(dataDir string) string {
+	return filepath.Join(dataDir, binlogPositionDirectory, replicaSourceKeyFilename)
+}
+
+// replicaSourceKeyMutex serializes the creation of the source password key.
+var replicaSourceKeyMutex sync.Mutex
+
+// ErrSourcePasswordUnavailable is returned when the stored source password cannot be decrypted, e.g., the data was
+// restored or bootstrapped from another server whose key is not here, so the password has to be given again.
+var ErrSourcePasswordUnavailable = fmt.Errorf("unable to decrypt the source password, which was encrypted with " +
+	"the key of another server; set it again with CHANGE REPLICATION SOURCE TO SOURCE_PASSWORD")
+
+// persistReplicationConfiguration saves the specified |replicaSourceInfo| for the default channel ("") to the
+// replica source info table. The password is encrypted before it is stored. If any problems are encountered
+// while saving the configuration, an error is returned.
+func persistReplicationConfiguration(ctx *sql.Context, engine *gms.Engine, replicaSourceInfo *mysql_db.ReplicaSourceInfo) error {
+	dir, err := createReplicaDir(engine)
+	if err != nil {
+		return err
+	}
+	password, err := encryptSourcePassword(dir, replicaSourceInfo.Password)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt the source password: %w", err)
+	}
+	if _, err := adapter.ExecCatalog(
+		ctx,
+		catalog.InternalTables.ReplicaSourceInfo.UpsertStmt(),
+		defaultChannelName,
+		replicaSourceInfo.Host,
+		replicaSourceInfo.User,
+		password,
+		replicaSourceInfo.Port,
+		replicaSourceInfo.ConnectRetryInterval,
+		replicaSourceInfo.ConnectRetryCount,
+		replicaSourceInfo.SourceLogFile,
+		replicaSourceInfo.SourceLogPos,
+		replicaSourceInfo.Uuid,
+	); err != nil {
+		return fmt.Errorf("unable to save replication configuration: %w", err)
+	}
+	syncReplicationSourceSecret(ctx, engine, replicaSourceInfo)
+	return nil
+}
+
+// syncReplicationSourceSecret keeps the MySQL secret of the replication source up to date with the specified
+// |replicaSourceInfo|, so that the source can be queried with mysql_query('replication_source', ...). The secret
+// is kept in memory only. A nil |replicaSourceInfo| drops the secret. Failures are logged only, since the
+// federated queries are optional.
+func syncReplicationSourceSecret(ctx *sql.Context, engine *gms.Engine, replicaSourceInfo *mysql_db.ReplicaSourceInfo) {
+	provider, ok := engine.Analyzer.Catalog.DbProvider.(*catalog.DatabaseProvider)
+	if !ok || !provider.HasMySQLScanner() {
+		return
+	}
+	var err error
+	if replicaSourceInfo == nil || replicaSourceInfo.Host == "" {
+		err = provider.DropMySQLSecret(ctx, catalog.MySQLReplicationSourceSecret)
+	} else {
+		err = provider.SetMySQLSecret(ctx, catalog.MySQLReplicationSourceSecret,
+			replicaSourceInfo.Host, replicaSourceInfo.Port, replicaSourceInfo.User, replicaSourceInfo.Password)
+	}
+	if err != nil {
+		ctx.GetLogger().Warnf("unable to update the secret of the replication source: %s", err.Error())
+	}
 }
 
 func getDataDir(engine *gms.Engine) string {
@@ -104,41 +174,205 @@ func persistReplicaRunningState(ctx *sql.Context, engine *gms.Engine, state repl
 }
 
 // loadReplicationConfiguration loads the replication configuration for default channel ("") from
-// the "mysql" database, |mysqlDb|.
-func loadReplicationConfiguration(_ *sql.Context, mysqlDb *mysql_db.MySQLDb) (*mysql_db.ReplicaSourceInfo, error) {
-	rd := mysqlDb.Reader()
-	defer rd.Close()
-
-	rsi, ok := rd.GetReplicaSourceInfo(mysql_db.ReplicaSourceInfoPrimaryKey{
-		Channel: "",
-	})
-	if ok {
-		return rsi, nil
+// the replica source info table. If the replica has not been configured, nil is returned. If the source password
+// cannot be decrypted, the configuration is returned without the password, along with ErrSourcePasswordUnavailable.
+func loadReplicationConfiguration(ctx *sql.Context, engine *gms.Engine) (*mysql_db.ReplicaSourceInfo, error) {
+	var (
+		rsi      mysql_db.ReplicaSourceInfo
+		password string
+	)
+	err := adapter.QueryRowCatalog(ctx, catalog.InternalTables.ReplicaSourceInfo.SelectStmt(), defaultChannelName).Scan(
+		&rsi.Host,
+		&rsi.User,
+		&password,
+		&rsi.Port,
+		&rsi.ConnectRetryInterval,
+		&rsi.ConnectRetryCount,
+		&rsi.SourceLogFile,
+		&rsi.SourceLogPos,
+		&rsi.Uuid,
+	)
+	if err == stdsql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to load replication configuration: %w", err)
 	}
 
-	return nil, nil
+	dir, err := createReplicaDir(engine)
+	if err != nil {
+		return nil, err
+	}
+	if rsi.Password, err = decryptSourcePassword(dir, password); err != nil {
+		ctx.GetLogger().Warnf("unable to decrypt the source password: %s", err.Error())
+		return &rsi, ErrSourcePasswordUnavailable
+	}
+	return &rsi, nil
 }
 
 // deleteReplicationConfiguration deletes all replication configuration for the default channel ("")
-// from the specified "mysql" database, |mysqlDb|.
-func deleteReplicationConfiguration(ctx *sql.Context, mysqlDb *mysql_db.MySQLDb) error {
-	ed := mysqlDb.Editor()
-	defer ed.Close()
+// from the replica source info table.
+func deleteReplicationConfiguration(ctx *sql.Context, engine *gms.Engine) error {
+	if _, err := adapter.ExecCatalog(ctx, catalog.InternalTables.ReplicaSourceInfo.DeleteStmt(), defaultChannelName); err != nil {
+		return err
+	}
+	syncReplicationSourceSecret(ctx, engine, nil)
+	return nil
+}
+
+// migrateReplicationConfiguration moves the replication configuration that earlier versions stored in the "mysql"
+// database, whose persisted file keeps the password in plaintext, to the replica source info table.
+func migrateReplicationConfiguration(ctx *sql.Context, engine *gms.Engine) error {
+	mysqlDb := engine.Analyzer.Catalog.MySQLDb
+	rd := mysqlDb.Reader()
+	legacy, ok := rd.GetReplicaSourceInfo(mysql_db.ReplicaSourceInfoPrimaryKey{Channel: defaultChannelName})
+	rd.Close()
+	if !ok {
+		return nil
+	}
 
-	ed.RemoveReplicaSourceInfo(mysql_db.ReplicaSourceInfoPrimaryKey{})
+	current, err := loadReplicationConfiguration(ctx, engine)
+	if err != nil && !errors.Is(err, ErrSourcePasswordUnavailable) {
+		return err
+	}
+	if current == nil {
+		if err := persistReplicationConfiguration(ctx, engine, legacy); err != nil {
+			return err
+		}
+	}
 
+	ed := mysqlDb.Editor()
+	defer ed.Close()
+	ed.RemoveReplicaSourceInfo(mysql_db.ReplicaSourceInfoPrimaryKey{Channel: defaultChannelName})
 	return mysqlDb.Persist(ctx, ed)
 }
 
-// persistSourceUuid saves the specified |sourceUuid| to the "mysql" database, |mysqlDb|.
-func persistSourceUuid(ctx *sql.Context, sourceUuid string, mysqlDb *mysql_db.MySQLDb) error {
-	replicaSourceInfo, err := loadReplicationConfiguration(ctx, mysqlDb)
+// persistSourceUuid saves the specified |sourceUuid| to the replica source info table.
+func persistSourceUuid(ctx *sql.Context, engine *gms.Engine, sourceUuid string) error {
+	replicaSourceInfo, err := loadReplicationConfiguration(ctx, engine)
 	if err != nil {
 		return err
+	} else if replicaSourceInfo == nil {
+		return ErrServerNotConfiguredAsReplica
 	}
 
 	replicaSourceInfo.Uuid = sourceUuid
-	return persistReplicationConfiguration(ctx, replicaSourceInfo, mysqlDb)
+	return persistReplicationConfiguration(ctx, engine, replicaSourceInfo)
+}
+
+// loadOrCreateSourceKey loads the AES-256 key that encrypts the source password from the .replica directory |dir|,
+// generating the key if it does not exist yet. The key file is readable only by the owner.
+func loadOrCreateSourceKey(dir string) ([]byte, error) {
+	replicaSourceKeyMutex.Lock()
+	defer replicaSourceKeyMutex.Unlock()
+
+	key, err := loadSourceKey(dir)
+	if err != nil || key != nil {
+		return key, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, replicaSourceKeyFilename), key, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// loadSourceKey loads the key file from the .replica directory |dir|, or returns nil if it does not exist.
+func loadSourceKey(dir string) ([]byte, error) {
+	keyFilepath := filepath.Join(dir, replicaSourceKeyFilename)
+	key, err := os.ReadFile(keyFilepath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid key length in %s", keyFilepath)
+	}
+	return key, nil
+}
+
+// sourceSecretKey returns the key derived from the configured secret, or nil if no secret is configured.
+func sourceSecretKey() []byte {
+	secret := configuration.ReplicaSourceSecret()
+	if secret == "" {
+		return nil
+	}
+	key := sha256.Sum256([]byte(secret))
+	return key[:]
+}
+
+func newSourcePasswordCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSourcePassword encrypts the |password| with AES-GCM and returns the nonce and the ciphertext
+// encoded in base64. The key is derived from the configured secret, or kept in the .replica directory |dir|
+// if there is no secret. An empty password is stored as is.
+func encryptSourcePassword(dir string, password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	key := sourceSecretKey()
+	if key == nil {
+		var err error
+		if key, err = loadOrCreateSourceKey(dir); err != nil {
+			return "", err
+		}
+	}
+	aead, err := newSourcePasswordCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(password)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(password), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSourcePassword decrypts a password encrypted by encryptSourcePassword. Both the key derived from
+// the configured secret and the key in the .replica directory |dir| are tried, so that the passwords encrypted
+// before a secret is configured can still be decrypted.
+func decryptSourcePassword(dir string, encrypted string) (string, error) {
+	if encrypted == "" {
+		return "", nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	fileKey, err := loadSourceKey(dir)
+	if err != nil {
+		return "", err
+	}
+	err = fmt.Errorf("no key to decrypt the source password")
+	for _, key := range [][]byte{sourceSecretKey(), fileKey} {
+		if key == nil {
+			continue
+		}
+		aead, cerr := newSourcePasswordCipher(key)
+		if cerr != nil {
+			return "", cerr
+		}
+		if len(sealed) < aead.NonceSize() {
+			return "", fmt.Errorf("ciphertext too short")
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		var password []byte
+		if password, err = aead.Open(nil, nonce, ciphertext, nil); err == nil {
+			return string(password), nil
+		}
+	}
+	return "", err
 }
 
 // createEmptyFile creates an empty file at |fullFilepath| if a file does not exist already. If a file does exist
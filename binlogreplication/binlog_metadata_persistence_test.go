@@ -0,0 +1,72 @@
+package binlogreplication
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourcePasswordEncryption(t *testing.T) {
+	dir := t.TempDir()
+
+	encrypted, err := encryptSourcePassword(dir, "Zqr8_blrGm1!")
+	require.NoError(t, err)
+	require.NotEmpty(t, encrypted)
+	require.NotContains(t, encrypted, "Zqr8_blrGm1!")
+
+	// The key is generated once and readable only by the owner
+	info, err := os.Stat(filepath.Join(dir, replicaSourceKeyFilename))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// A random nonce is used for every encryption
+	again, err := encryptSourcePassword(dir, "Zqr8_blrGm1!")
+	require.NoError(t, err)
+	require.NotEqual(t, encrypted, again)
+
+	for _, s := range []string{encrypted, again} {
+		password, err := decryptSourcePassword(dir, s)
+		require.NoError(t, err)
+		require.Equal(t, "Zqr8_blrGm1!", password)
+	}
+
+	// An empty password is stored as is
+	encrypted, err = encryptSourcePassword(dir, "")
+	require.NoError(t, err)
+	require.Empty(t, encrypted)
+	password, err := decryptSourcePassword(dir, "")
+	require.NoError(t, err)
+	require.Empty(t, password)
+
+	// The password cannot be decrypted with another key
+	_, err = decryptSourcePassword(t.TempDir(), again)
+	require.Error(t, err)
+}
+
+func TestSourcePasswordSecret(t *testing.T) {
+	dir := t.TempDir()
+	byFile, err := encryptSourcePassword(dir, "Zqr8_blrGm1!")
+	require.NoError(t, err)
+
+	t.Setenv("REPLICA_SOURCE_SECRET", "s3cret")
+	bySecret, err := encryptSourcePassword(dir, "Zqr8_blrGm1!")
+	require.NoError(t, err)
+
+	// The servers that share the secret decrypt the passwords without the key file,
+	// e.g., after the data is restored on another server
+	other := t.TempDir()
+	password, err := decryptSourcePassword(other, bySecret)
+	require.NoError(t, err)
+	require.Equal(t, "Zqr8_blrGm1!", password)
+	_, err = os.Stat(filepath.Join(other, replicaSourceKeyFilename))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// The passwords encrypted before the secret is configured are still decrypted with the key file
+	password, err = decryptSourcePassword(dir, byFile)
+	require.NoError(t, err)
+	require.Equal(t, "Zqr8_blrGm1!", password)
+	_, err = decryptSourcePassword(other, byFile)
+	require.Error(t, err)
+}
@@ -34,6 +34,10 @@ import (
 const binlogPositionDirectory = ".replica"
 const defaultChannelName = ""
 
+// initialSyncChannel is the key of the row of the binlog position table that marks the initial sync as done.
+// Its position is that of the clone, which may be empty if nothing had been executed on the source yet.
+const initialSyncChannel = "initial_sync"
+
 // binlogPositionStore manages loading and saving data to the binlog position metadata table. This provides
 // durable storage for the set of GTIDs that have been successfully executed on the replica, so that the replica
 // server can be restarted and resume binlog event messages at the correct point.
@@ -86,15 +90,56 @@ func (store *binlogPositionStore) Save(ctx *sql.Context, engine *gms.Engine, pos
 	return nil
 }
 
+// MarkInitialSynced records that the initial sync has cloned the source at |position|, so that it is not
+// run again even if no binlog events are applied afterward.
+func (store *binlogPositionStore) MarkInitialSynced(ctx *sql.Context, position replication.Position) error {
+	var positionString string
+	if !position.IsZero() {
+		positionString = position.String()
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, err := adapter.ExecCatalogInTxn(
+		ctx,
+		catalog.InternalTables.BinlogPosition.UpsertStmt(),
+		initialSyncChannel, positionString,
+	); err != nil {
+		return fmt.Errorf("unable to mark the initial sync as done: %w", err)
+	}
+	return nil
+}
+
+// InitialSynced returns whether the initial sync has been done, see MarkInitialSynced.
+func (store *binlogPositionStore) InitialSynced(ctx *sql.Context) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var positionString string
+	err := adapter.QueryRowCatalog(ctx, catalog.InternalTables.BinlogPosition.SelectStmt(), initialSyncChannel).Scan(&positionString)
+	if err == stdsql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("unable to load the initial sync marker: %w", err)
+	}
+	return true, nil
+}
+
 // Delete deletes the stored mysql.Position information stored in .replica/binlog-position in the root of the provider's
 // filesystem. This is useful for the "RESET REPLICA" command, since it clears out the current replication state. If
 // any errors are encountered removing the position file, an error is returned.
+// The initial sync marker is deleted as well, so that the replica is synced from the source again.
 func (store *binlogPositionStore) Delete(ctx *sql.Context, engine *gms.Engine) error {
 	store.mu.Lock()
 	defer store.mu.Unlock()
 
-	_, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.BinlogPosition.DeleteStmt(), defaultChannelName)
-	return err
+	for _, channel := range []string{defaultChannelName, initialSyncChannel} {
+		if _, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.BinlogPosition.DeleteStmt(), channel); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // createReplicaDir creates the .replica directory if it doesn't already exist.
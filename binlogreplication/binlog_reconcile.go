@@ -0,0 +1,206 @@
+package binlogreplication
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/mysql_db"
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/mysql/replication"
+)
+
+// A backup carries the executed GTIDs of the replica in the data file, but the source keeps the binlog only for a
+// while, and the replica that took the backup may have been replicating from another source since. A replica
+// restored from the backup can resume the replication only if the source still has the binlog since the executed
+// GTIDs of the replica, and has executed all of them. So the restored replica is reconciled with its source before
+// the replication is started, see ReconcileRestored. It is the counterpart of logrepl.ReconcileSubscriptions.
+
+// ReplicaReconcileStatus is the state of a restored replica relative to its replication source.
+type ReplicaReconcileStatus string
+
+const (
+	// ReplicaResumable means that the source has the binlog since the executed GTIDs of the replica.
+	ReplicaResumable ReplicaReconcileStatus = "resumable"
+	// ReplicaBinlogPurged means that the source has purged the binlog that the replica needs.
+	ReplicaBinlogPurged ReplicaReconcileStatus = "binlog purged"
+	// ReplicaDiverged means that the replica has executed the transactions that the source has not.
+	ReplicaDiverged ReplicaReconcileStatus = "diverged"
+	// ReplicaPasswordUnavailable means that the source password cannot be decrypted, see ErrSourcePasswordUnavailable.
+	ReplicaPasswordUnavailable ReplicaReconcileStatus = "password unavailable"
+	// ReplicaUnknown means that the source could not be checked, e.g., since it is unreachable.
+	ReplicaUnknown ReplicaReconcileStatus = "unknown"
+)
+
+// ReplicaReconciliation is the result of the reconciliation of a restored replica.
+type ReplicaReconciliation struct {
+	// Executed is the executed GTIDs of the replica, and SourceExecuted and SourcePurged are the ones of the source.
+	// In the file position mode, they are the binlog positions, and SourcePurged is the first binlog file.
+	Executed       string
+	SourceExecuted string
+	SourcePurged   string
+	Status         ReplicaReconcileStatus
+	// Reset is true if the binlog position has been reset, so that the replica is synced from the source again
+	// when the replication starts with replica_initial_sync enabled, and Stopped is true if the replication is kept from starting since it cannot resume.
+	Reset   bool
+	Stopped bool
+	Err     error
+}
+
+func (rec ReplicaReconciliation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "binlog replication: %s (replica at %q", rec.Status, rec.Executed)
+	if rec.SourceExecuted != "" || rec.SourcePurged != "" {
+		fmt.Fprintf(&b, ", source at %q, purged %q", rec.SourceExecuted, rec.SourcePurged)
+	}
+	b.WriteString(")")
+	switch {
+	case rec.Err != nil:
+		fmt.Fprintf(&b, ": %v", rec.Err)
+	case rec.Reset:
+		b.WriteString(", reset to sync from the source again")
+	case rec.Stopped:
+		b.WriteString(", stopped")
+	}
+	return b.String()
+}
+
+// reconcileReplicaStatus compares the executed GTIDs of the replica with the ones of the source.
+// The purged GTIDs of the source are nil if they are unknown.
+func reconcileReplicaStatus(executed, sourceExecuted, sourcePurged replication.GTIDSet) ReplicaReconcileStatus {
+	switch {
+	case sourcePurged != nil && !executed.Contains(sourcePurged):
+		return ReplicaBinlogPurged
+	case !sourceExecuted.Contains(executed):
+		return ReplicaDiverged
+	}
+	return ReplicaResumable
+}
+
+// ReconcileRestored checks the binlog position of a restored replica against its replication source. It must be
+// called before the replication is started, see AutoStart. A replica that cannot resume is reset if resync is true,
+// so that it is synced from the source again when the replication starts with replica_initial_sync enabled, or kept
+// from starting otherwise, so that it never skips the changes in between. It returns nil if the server is not
+// configured as a replica.
+func (d *MyBinlogReplicaController) ReconcileRestored(resync bool) (*ReplicaReconciliation, error) {
+	ctx := d.ctx
+	rsi, err := loadReplicationConfiguration(ctx, d.engine)
+	if errors.Is(err, ErrSourcePasswordUnavailable) {
+		d.setIoError(ERFatalReplicaError, err.Error())
+		return &ReplicaReconciliation{Status: ReplicaPasswordUnavailable, Stopped: true}, nil
+	} else if err != nil {
+		return nil, err
+	} else if rsi == nil {
+		return nil, nil
+	}
+
+	rec := &ReplicaReconciliation{Status: ReplicaUnknown}
+	if rec.Err = d.checkRestored(ctx, rsi, rec); rec.Err != nil {
+		// The source may be down for a while, in which case the replication is left to retry as usual.
+		return rec, nil
+	}
+	if rec.Status == ReplicaResumable {
+		return rec, nil
+	}
+
+	if resync {
+		if rec.Err = positionStore.Delete(ctx, d.engine); rec.Err == nil {
+			rec.Err = adapter.CommitAndCloseTxn(ctx)
+		}
+		rec.Reset = rec.Err == nil
+		return rec, nil
+	}
+	d.setIoError(ERFatalReplicaError, fmt.Sprintf("the restored replica cannot resume the replication: %s; "+
+		"restore it again with --restore-resync to sync it from the source again", rec.Status))
+	rec.Err = persistReplicaRunningState(ctx, d.engine, notRunning)
+	rec.Stopped = rec.Err == nil
+	return rec, nil
+}
+
+// checkRestored compares the binlog position of the replica with the ones of the source.
+func (d *MyBinlogReplicaController) checkRestored(ctx *sql.Context, rsi *mysql_db.ReplicaSourceInfo, rec *ReplicaReconciliation) error {
+	params := mysql.ConnParams{
+		Host:             rsi.Host,
+		Port:             int(rsi.Port),
+		Uname:            rsi.User,
+		Pass:             rsi.Password,
+		ConnectTimeoutMs: 4_000,
+	}
+	mariaDB, gtidMode, err := detectVersionAndGTIDMode(ctx, params)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !gtidMode:
+		params.Flavor = replication.FilePosFlavorID
+	case mariaDB:
+		params.Flavor = replication.MariadbFlavorID
+	default:
+		params.Flavor = replication.Mysql56FlavorID
+	}
+
+	position, err := positionStore.Load(params.Flavor, ctx, d.engine)
+	if err != nil {
+		return err
+	}
+	if position.IsZero() {
+		// Nothing has been replicated yet.
+		rec.Status = ReplicaResumable
+		return nil
+	}
+	rec.Executed = position.GTIDSet.String()
+
+	conn, err := mysql.Connect(ctx, &params)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	source, err := querySourcePosition(conn, mariaDB, params.Flavor)
+	if err != nil {
+		return err
+	}
+	if source.IsZero() {
+		rec.Status = ReplicaDiverged
+		return nil
+	}
+	rec.SourceExecuted = source.GTIDSet.String()
+	purged, err := querySourcePurged(conn, mariaDB, params.Flavor)
+	if err != nil {
+		return err
+	}
+	if purged != nil {
+		rec.SourcePurged = purged.String()
+	}
+	rec.Status = reconcileReplicaStatus(position.GTIDSet, source.GTIDSet, purged)
+	return nil
+}
+
+// querySourcePurged returns the GTIDs that the source has purged from its binlog, or the position of its first binlog
+// file in the file position mode. It returns nil if they are unknown, e.g., for MariaDB.
+func querySourcePurged(conn *mysql.Conn, mariaDB bool, flavorName string) (replication.GTIDSet, error) {
+	switch {
+	case mariaDB:
+		return nil, nil
+	case flavorName == replication.FilePosFlavorID:
+		qr, err := conn.ExecuteFetch("SHOW BINARY LOGS", -1, false)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the binlog files of the replication source: %w", err)
+		}
+		if len(qr.Rows) == 0 {
+			return nil, nil
+		}
+		return replication.FilePosGTID{File: qr.Rows[0][0].ToString()}, nil
+	}
+
+	qr, err := conn.ExecuteFetch("SELECT @@GLOBAL.gtid_purged", 1, false)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query the purged GTIDs of the replication source: %w", err)
+	}
+	if len(qr.Rows) == 0 {
+		return nil, nil
+	}
+	gtidSet := strings.Join(strings.Fields(qr.Rows[0][0].ToString()), "")
+	return replication.ParseMysql56GTIDSet(gtidSet)
+}
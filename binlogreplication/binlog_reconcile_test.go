@@ -0,0 +1,40 @@
+package binlogreplication
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/mysql/replication"
+)
+
+func TestReconcileReplicaStatus(t *testing.T) {
+	const uuid = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	gtids := func(s string) replication.GTIDSet {
+		set, err := replication.ParseMysql56GTIDSet(s)
+		require.NoError(t, err)
+		return set
+	}
+	executed := gtids(uuid + ":1-10")
+	for _, tt := range []struct {
+		source, purged string
+		want           ReplicaReconcileStatus
+	}{
+		{uuid + ":1-20", "", ReplicaResumable},
+		{uuid + ":1-20", uuid + ":1-10", ReplicaResumable},
+		{uuid + ":1-10", uuid + ":1-5", ReplicaResumable},
+		{uuid + ":1-20", uuid + ":1-11", ReplicaBinlogPurged},
+		{uuid + ":1-9", "", ReplicaDiverged},
+	} {
+		require.Equal(t, tt.want, reconcileReplicaStatus(executed, gtids(tt.source), gtids(tt.purged)), "%+v", tt)
+	}
+
+	// In the file position mode, the replica needs the binlog files since its position.
+	position := replication.FilePosGTID{File: "binlog.000003", Pos: 100}
+	source := replication.FilePosGTID{File: "binlog.000005", Pos: 4}
+	require.Equal(t, ReplicaResumable, reconcileReplicaStatus(position, source, replication.FilePosGTID{File: "binlog.000003"}))
+	require.Equal(t, ReplicaBinlogPurged, reconcileReplicaStatus(position, source, replication.FilePosGTID{File: "binlog.000004"}))
+	require.Equal(t, ReplicaDiverged, reconcileReplicaStatus(position, replication.FilePosGTID{File: "binlog.000003", Pos: 50}, nil))
+
+	rec := ReplicaReconciliation{Executed: uuid + ":1-10", SourceExecuted: uuid + ":1-20", SourcePurged: uuid + ":1-11", Status: ReplicaBinlogPurged, Stopped: true}
+	require.Equal(t, `binlog replication: binlog purged (replica at "`+uuid+`:1-10", source at "`+uuid+`:1-20", purged "`+uuid+`:1-11"), stopped`, rec.String())
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/apecloud/myduckserver/binlog"
 	"github.com/apecloud/myduckserver/charset"
 	"github.com/apecloud/myduckserver/delta"
+	"github.com/apecloud/myduckserver/health"
 	"github.com/apecloud/myduckserver/mysqlutil"
 	gms "github.com/dolthub/go-mysql-server"
 	"github.com/dolthub/go-mysql-server/sql"
@@ -53,6 +54,17 @@ const (
 	ERFatalReplicaError = 13117
 )
 
+// deltaBufSizeLimit is the size of the buffered row changes at which they are flushed: a batched transaction is
+// committed at its next transaction boundary, and a single large transaction is flushed in the middle.
+const deltaBufSizeLimit = 128 << 20 // 128MB
+
+// healthReplicationName is the name of the replication from MySQL whose lag is checked by the readiness probe.
+const healthReplicationName = "mysql"
+
+// heartbeatPeriod is the interval of the heartbeats that the source sends while it has no events to send,
+// which keep the lag checked by the readiness probe up to date.
+const heartbeatPeriod = 10 * time.Second
+
 type tableIdentifier struct {
 	dbName, tableName string
 }
@@ -66,10 +78,12 @@ type binlogReplicaApplier struct {
 	tableMapsById         map[uint64]*mysql.TableMap
 	tablesByName          map[tableIdentifier]sql.Table
 	stopReplicationChan   chan struct{}
+	done                  chan struct{} // closed when the event handler started by Go returns
 	currentGtid           replication.GTID
 	replicationSourceUuid string
 	currentPosition       replication.Position // successfully executed GTIDs
 	filters               *filterConfiguration
+	controller            *MyBinlogReplicaController // the controller whose status the applier reports
 	running               atomic.Bool
 	engine                *gms.Engine
 
@@ -84,12 +98,13 @@ type binlogReplicaApplier struct {
 	lastCommitTime      time.Time     // time of the last commit
 }
 
-func newBinlogReplicaApplier(filters *filterConfiguration) *binlogReplicaApplier {
+func newBinlogReplicaApplier(controller *MyBinlogReplicaController) *binlogReplicaApplier {
 	return &binlogReplicaApplier{
 		tableMapsById:       make(map[uint64]*mysql.TableMap),
 		tablesByName:        make(map[tableIdentifier]sql.Table),
 		stopReplicationChan: make(chan struct{}),
-		filters:             filters,
+		filters:             controller.filters,
+		controller:          controller,
 	}
 }
 
@@ -106,13 +121,15 @@ const rowFlag_rowsAreComplete = 0x0008
 
 // Go spawns a new goroutine to run the applier's binlog event handler.
 func (a *binlogReplicaApplier) Go(ctx *sql.Context) {
+	a.done = make(chan struct{})
 	go func() {
+		defer close(a.done)
 		a.running.Store(true)
 		err := a.replicaBinlogEventHandler(ctx)
 		a.running.Store(false)
 		if err != nil {
 			ctx.GetLogger().Errorf("unexpected error of type %T: '%v'", err, err.Error())
-			MyBinlogReplicaController.setSqlError(sqlerror.ERUnknownError, err.Error())
+			a.controller.setSqlError(sqlerror.ERUnknownError, err.Error())
 		}
 	}()
 }
@@ -170,7 +187,7 @@ func detectVersionAndGTIDMode(ctx *sql.Context, params mysql.ConnParams) (mariaD
 func (a *binlogReplicaApplier) connectAndStartReplicationEventStream(ctx *sql.Context) (*mysql.Conn, error) {
 	var maxConnectionAttempts uint64
 	var connectRetryDelay uint32
-	MyBinlogReplicaController.updateStatus(func(status *binlogreplication.ReplicaStatus) {
+	a.controller.updateStatus(func(status *binlogreplication.ReplicaStatus) {
 		status.ReplicaIoRunning = binlogreplication.ReplicaIoConnecting
 		status.ReplicaSqlRunning = binlogreplication.ReplicaSqlRunning
 		maxConnectionAttempts = status.SourceRetryCount
@@ -179,31 +196,35 @@ func (a *binlogReplicaApplier) connectAndStartReplicationEventStream(ctx *sql.Co
 
 	var (
 		conn       *mysql.Conn
+		connParams mysql.ConnParams
 		err        error
 		gtidMode   = false
 		mariaDB    = false
 		flavorName = ""
 	)
 	for connectionAttempts := uint64(0); ; connectionAttempts++ {
-		replicaSourceInfo, err := loadReplicationConfiguration(ctx, a.engine.Analyzer.Catalog.MySQLDb)
+		replicaSourceInfo, err := loadReplicationConfiguration(ctx, a.engine)
 
-		if replicaSourceInfo == nil {
+		if err != nil {
+			a.controller.setIoError(ERFatalReplicaError, err.Error())
+			return nil, err
+		} else if replicaSourceInfo == nil {
 			err = ErrServerNotConfiguredAsReplica
-			MyBinlogReplicaController.setIoError(ERFatalReplicaError, err.Error())
+			a.controller.setIoError(ERFatalReplicaError, err.Error())
 			return nil, err
 		} else if replicaSourceInfo.Uuid != "" {
 			a.replicationSourceUuid = replicaSourceInfo.Uuid
 		}
 
 		if replicaSourceInfo.Host == "" {
-			MyBinlogReplicaController.setIoError(ERFatalReplicaError, ErrEmptyHostname.Error())
+			a.controller.setIoError(ERFatalReplicaError, ErrEmptyHostname.Error())
 			return nil, ErrEmptyHostname
 		} else if replicaSourceInfo.User == "" {
-			MyBinlogReplicaController.setIoError(ERFatalReplicaError, ErrEmptyUsername.Error())
+			a.controller.setIoError(ERFatalReplicaError, ErrEmptyUsername.Error())
 			return nil, ErrEmptyUsername
 		}
 
-		connParams := mysql.ConnParams{
+		connParams = mysql.ConnParams{
 			Host:             replicaSourceInfo.Host,
 			Port:             int(replicaSourceInfo.Port),
 			Uname:            replicaSourceInfo.User,
@@ -250,6 +271,15 @@ func (a *binlogReplicaApplier) connectAndStartReplicationEventStream(ctx *sql.Co
 		}
 	}
 
+	// Clone the source first if this is a fresh replica and the initial sync is enabled
+	if err = a.runInitialSyncIfNeeded(ctx, connParams, mariaDB); err != nil {
+		conn.Close()
+		if err != ErrReplicationStopped {
+			a.controller.setIoError(ERFatalReplicaError, err.Error())
+		}
+		return nil, err
+	}
+
 	// Request binlog events to start
 	// TODO: This should also have retry logic
 	err = a.startReplicationEventStream(ctx, conn, gtidMode, flavorName)
@@ -257,7 +287,7 @@ func (a *binlogReplicaApplier) connectAndStartReplicationEventStream(ctx *sql.Co
 		return nil, err
 	}
 
-	MyBinlogReplicaController.updateStatus(func(status *binlogreplication.ReplicaStatus) {
+	a.controller.updateStatus(func(status *binlogreplication.ReplicaStatus) {
 		status.ReplicaIoRunning = binlogreplication.ReplicaIoRunning
 	})
 
@@ -320,9 +350,11 @@ func (a *binlogReplicaApplier) loadLogFilePosition(ctx *sql.Context, positionSto
 	}
 
 	if position.IsZero() {
-		replicaSourceInfo, err := loadReplicationConfiguration(ctx, a.engine.Analyzer.Catalog.MySQLDb)
-		if err != nil {
+		replicaSourceInfo, err := loadReplicationConfiguration(ctx, a.engine)
+		if err != nil && !errors.Is(err, ErrSourcePasswordUnavailable) {
 			return replication.Position{}, err
+		} else if replicaSourceInfo == nil {
+			return replication.Position{}, ErrServerNotConfiguredAsReplica
 		}
 		filePosGtid := replication.FilePosGTID{
 			File: replicaSourceInfo.SourceLogFile,
@@ -386,6 +418,13 @@ func (a *binlogReplicaApplier) startReplicationEventStream(ctx *sql.Context, con
 		return err
 	}
 
+	// The source reads the heartbeat period, in nanoseconds, from a user variable of the dump connection,
+	// which was renamed in MySQL 8.0.26.
+	_, err = conn.ExecuteFetch(fmt.Sprintf("set @master_heartbeat_period=%[1]d, @source_heartbeat_period=%[1]d;", heartbeatPeriod.Nanoseconds()), 0, false)
+	if err != nil {
+		return err
+	}
+
 	binlogFile := ""
 	if filePos, ok := position.GTIDSet.(replication.FilePosGTID); ok {
 		binlogFile = filePos.File
@@ -434,7 +473,7 @@ func (a *binlogReplicaApplier) replicaBinlogEventHandler(ctx *sql.Context) error
 			err := a.processBinlogEvent(ctx, engine, event)
 			if err != nil {
 				ctx.GetLogger().Errorf("unexpected error of type %T: '%v'", err, err.Error())
-				MyBinlogReplicaController.setSqlError(sqlerror.ERUnknownError, err.Error())
+				a.controller.setSqlError(sqlerror.ERUnknownError, err.Error())
 			}
 
 		case err := <-eventProducer.ErrorChan():
@@ -442,7 +481,7 @@ func (a *binlogReplicaApplier) replicaBinlogEventHandler(ctx *sql.Context) error
 				badConnection := sqlError.Message == io.EOF.Error() ||
 					strings.HasPrefix(sqlError.Message, io.ErrUnexpectedEOF.Error())
 				if badConnection {
-					MyBinlogReplicaController.updateStatus(func(status *binlogreplication.ReplicaStatus) {
+					a.controller.updateStatus(func(status *binlogreplication.ReplicaStatus) {
 						status.LastIoError = sqlError.Message
 						status.LastIoErrNumber = ERNetReadError
 						currentTime := time.Now()
@@ -455,7 +494,7 @@ func (a *binlogReplicaApplier) replicaBinlogEventHandler(ctx *sql.Context) error
 				}
 			} else {
 				// otherwise, log the error if it's something we don't expect and continue
-				recordReplicationError(ctx, err)
+				a.recordReplicationError(ctx, err)
 			}
 
 		case <-ticker.C:
@@ -463,16 +502,17 @@ func (a *binlogReplicaApplier) replicaBinlogEventHandler(ctx *sql.Context) error
 				// We should commit the transaction to flush the changes to the database
 				// if we're in a batched transaction and haven't seen any changes for a while.
 				if err := a.extendOrCommitBatchTxn(ctx, engine); err != nil {
-					recordReplicationError(ctx, err)
+					a.recordReplicationError(ctx, err)
 				}
 			}
 
 		case <-a.stopReplicationChan:
 			ctx.GetLogger().Trace("received stop replication signal")
 			eventProducer.Stop()
+			health.RemoveReplication(healthReplicationName)
 			if a.ongoingBatchTxn.Load() && !a.dirtyStream.Load() {
 				if err := a.commitOngoingTxn(ctx, engine, NormalCommit, delta.OnCloseFlushReason); err != nil {
-					recordReplicationError(ctx, err)
+					a.recordReplicationError(ctx, err)
 				}
 			}
 			return nil
@@ -480,18 +520,16 @@ func (a *binlogReplicaApplier) replicaBinlogEventHandler(ctx *sql.Context) error
 	}
 }
 
-func recordReplicationError(ctx *sql.Context, err error) {
+func (a *binlogReplicaApplier) recordReplicationError(ctx *sql.Context, err error) {
 	ctx.GetLogger().Errorf("unexpected error of type %T: '%v'", err, err.Error())
-	MyBinlogReplicaController.setSqlError(sqlerror.ERUnknownError, err.Error())
+	a.controller.setSqlError(sqlerror.ERUnknownError, err.Error())
 }
 
 // processBinlogEvent processes a single binlog event message and returns an error if there were any problems
 // processing it.
 func (a *binlogReplicaApplier) processBinlogEvent(ctx *sql.Context, engine *gms.Engine, event mysql.BinlogEvent) error {
-	var err error
-
 	// TODO(fan): detect server ID changes and reset the replication
-	MyBinlogReplicaController.setSourceServerID(event.ServerID())
+	a.controller.setSourceServerID(event.ServerID())
 
 	// We don't support checksum validation, so we MUST strip off any checksum bytes if present, otherwise it gets
 	// interpreted as part of the payload and corrupts the data. Future checksum sizes, are not guaranteed to be the
@@ -505,10 +543,17 @@ func (a *binlogReplicaApplier) processBinlogEvent(ctx *sql.Context, engine *gms.
 		if err != nil {
 			msg := fmt.Sprintf("unable to strip checksum from binlog event: '%v'", err.Error())
 			ctx.GetLogger().Error(msg)
-			MyBinlogReplicaController.setSqlError(sqlerror.ERUnknownError, msg)
+			a.controller.setSqlError(sqlerror.ERUnknownError, msg)
 		}
 	}
 
+	return a.applyBinlogEvent(ctx, engine, event)
+}
+
+// applyBinlogEvent applies a binlog event whose checksum, if any, has been stripped off.
+func (a *binlogReplicaApplier) applyBinlogEvent(ctx *sql.Context, engine *gms.Engine, event mysql.BinlogEvent) error {
+	var err error
+
 	// ------------------- NOTE -----------------------
 	// Since this function is called in a hot loop,
 	// we invoke the logging API conditionally
@@ -533,6 +578,7 @@ func (a *binlogReplicaApplier) processBinlogEvent(ctx *sql.Context, engine *gms.
 		if isTraceLevelEnabled {
 			logger.Trace("Received binlog event: XID")
 		}
+		health.ReportCommit(healthReplicationName, time.Unix(int64(event.Timestamp()), 0))
 		return a.extendOrCommitBatchTxn(ctx, engine)
 
 	case event.IsQuery():
@@ -609,7 +655,7 @@ func (a *binlogReplicaApplier) processBinlogEvent(ctx *sql.Context, engine *gms.
 				"query": query.SQL,
 			}).Error("Applying query failed")
 			msg := fmt.Sprintf("Applying query failed: %v", err.Error())
-			MyBinlogReplicaController.setSqlError(sqlerror.ERUnknownError, msg)
+			a.controller.setSqlError(sqlerror.ERUnknownError, msg)
 		}
 		a.inTxnStmtID.Add(1)
 
@@ -687,7 +733,7 @@ func (a *binlogReplicaApplier) processBinlogEvent(ctx *sql.Context, engine *gms.
 		// if the source's UUID hasn't been set yet, set it and persist it
 		if a.replicationSourceUuid == "" {
 			uuid := fmt.Sprintf("%v", gtid.SourceServer())
-			err = persistSourceUuid(ctx, uuid, a.engine.Analyzer.Catalog.MySQLDb)
+			err = persistSourceUuid(ctx, a.engine, uuid)
 			if err != nil {
 				return err
 			}
@@ -732,7 +778,7 @@ func (a *binlogReplicaApplier) processBinlogEvent(ctx *sql.Context, engine *gms.
 			if flags != 0 {
 				msg := fmt.Sprintf("unsupported binlog protocol message: TableMap event with unsupported flags '%x'", flags)
 				ctx.GetLogger().Error(msg)
-				MyBinlogReplicaController.setSqlError(sqlerror.ERUnknownError, msg)
+				a.controller.setSqlError(sqlerror.ERUnknownError, msg)
 			}
 			a.tableMapsById[tableId] = tableMap
 		}
@@ -748,6 +794,25 @@ func (a *binlogReplicaApplier) processBinlogEvent(ctx *sql.Context, engine *gms.
 		a.dirtyStream.Store(true)
 		a.inTxnStmtID.Add(1)
 
+		// A large transaction is split into bounded flushes to keep the memory usage flat.
+		// The flushed changes are not visible until the transaction is committed.
+		if a.deltaBufSize.Load() >= deltaBufSizeLimit {
+			if err := a.flushDeltaBuffer(ctx, delta.MemoryLimitFlushReason); err != nil {
+				return err
+			}
+		}
+
+	case event.IsTransactionPayload():
+		// A Transaction_payload event carries the events of a whole transaction compressed with zstd,
+		// which is written when binlog_transaction_compression=ON. For more details, see:
+		// https://dev.mysql.com/doc/refman/8.0/en/binary-log-transaction-compression.html
+		if isTraceLevelEnabled {
+			logger.Trace("Received binlog event: TransactionPayload")
+		}
+		return forEachPayloadEvent(*a.format, event, func(event mysql.BinlogEvent) error {
+			return a.applyBinlogEvent(ctx, engine, event)
+		})
+
 	default:
 		// https://mariadb.com/kb/en/2-binlog-event-header/
 		bytes := event.Bytes()
@@ -758,6 +823,7 @@ func (a *binlogReplicaApplier) processBinlogEvent(ctx *sql.Context, engine *gms.
 			// when the primary has no binlog events to send to replica servers.
 			// For more details, see: https://mariadb.com/kb/en/heartbeat_log_event/
 			ctx.GetLogger().Trace("Received binlog event: Heartbeat")
+			health.ReportCaughtUp(healthReplicationName)
 		case 0x03:
 			ctx.GetLogger().Trace("Received binlog event: Stop")
 		default:
@@ -810,6 +876,7 @@ func (a *binlogReplicaApplier) commitOngoingTxn(ctx *sql.Context, engine *gms.En
 		}
 		adapter.CloseTxn(ctx)
 	}
+	a.tableWriterProvider.DeltaBufferCommitted(ctx)
 
 	// --- Update the in-memory states --- //
 
@@ -841,7 +908,7 @@ func (a *binlogReplicaApplier) mayExtendBatchTxn() (bool, delta.FlushReason) {
 		switch {
 		case time.Since(a.lastCommitTime) >= 200*time.Millisecond: // commit the batched txn every 200ms
 			extend, reason = false, delta.TimeTickFlushReason
-		case a.deltaBufSize.Load() >= (128 << 20): // commit the batched txn if the delta buffer is too large (>= 128MB)
+		case a.deltaBufSize.Load() >= deltaBufSizeLimit: // commit the batched txn if the delta buffer is too large
 			extend, reason = false, delta.MemoryLimitFlushReason
 		}
 	}
@@ -1038,7 +1105,7 @@ func (a *binlogReplicaApplier) processRowEvent(ctx *sql.Context, event mysql.Bin
 	if flags != 0 {
 		msg := fmt.Sprintf("unsupported binlog protocol message: row event with unsupported flags '%x'", flags)
 		ctx.GetLogger().Errorf(msg)
-		MyBinlogReplicaController.setSqlError(sqlerror.ERUnknownError, msg)
+		a.controller.setSqlError(sqlerror.ERUnknownError, msg)
 	}
 	pkSchema, tableName, err := a.getTableSchema(ctx, engine, tableMap.Name, tableMap.Database)
 	if err != nil {
@@ -1051,31 +1118,50 @@ func (a *binlogReplicaApplier) processRowEvent(ctx *sql.Context, event mysql.Bin
 		return fmt.Errorf("schema mismatch: expected %d fields, got %d from binlog", fieldCount, len(tableMap.Types))
 	}
 
+	// The changes can be buffered in the delta appender if the rows are identified by the primary key
+	// and the after images contain all columns. With --binlog-row-image=minimal, the before images contain
+	// only the primary key columns, which are enough to delete the old rows, but the after images of UPDATEs
+	// contain only the changed columns, which are applied to the table as partial-column UPDATEs.
 	var eventType binlog.RowEventType
-	var isRowFormat bool // all columns are present
+	var isBufferable bool
+	hasPrimaryKey := len(pkSchema.PkOrdinals) > 0
 	switch {
 	case event.IsDeleteRows():
 		eventType = binlog.DeleteRowEvent
-		isRowFormat = rows.IdentifyColumns.BitCount() == fieldCount
+		isBufferable = hasPrimaryKey && containsAllColumns(rows.IdentifyColumns, pkSchema.PkOrdinals)
 	case event.IsUpdateRows():
 		eventType = binlog.UpdateRowEvent
-		isRowFormat = rows.IdentifyColumns.BitCount() == fieldCount && rows.DataColumns.BitCount() == fieldCount
+		isBufferable = hasPrimaryKey && containsAllColumns(rows.IdentifyColumns, pkSchema.PkOrdinals) && rows.DataColumns.BitCount() == fieldCount
 	case event.IsWriteRows():
 		eventType = binlog.InsertRowEvent
-		isRowFormat = rows.DataColumns.BitCount() == fieldCount
+		isBufferable = hasPrimaryKey && rows.DataColumns.BitCount() == fieldCount
 	}
 
 	if log := ctx.GetLogger(); log.Logger.IsLevelEnabled(logrus.TraceLevel) {
-		log.Tracef(" - %s Rows (db: %s, table: %s, IsRowFormat: %v, RowCount: %v)", eventType, tableMap.Database, tableName, isRowFormat, len(rows.Rows))
+		log.Tracef(" - %s Rows (db: %s, table: %s, IsBufferable: %v, RowCount: %v)", eventType, tableMap.Database, tableName, isBufferable, len(rows.Rows))
 	}
 
-	if isRowFormat && len(pkSchema.PkOrdinals) > 0 {
-		// --binlog-format=ROW & --binlog-row-image=full
+	if isBufferable {
+		// --binlog-format=ROW & --binlog-row-image=full|minimal
 		return a.appendRowFormatChanges(ctx, tableMap, tableName, schema, eventType, &rows)
-	} else {
-		a.ongoingBatchTxn.Store(false)
-		return a.writeChanges(ctx, engine, tableMap, tableName, pkSchema, eventType, &rows, foreignKeyChecksDisabled)
 	}
+
+	// The rows are written to the table directly, so the buffered changes must be applied first.
+	if err := a.flushDeltaBuffer(ctx, delta.DMLStmtFlushReason); err != nil {
+		return err
+	}
+	a.ongoingBatchTxn.Store(false)
+	return a.writeChanges(ctx, engine, tableMap, tableName, pkSchema, eventType, &rows, foreignKeyChecksDisabled)
+}
+
+// containsAllColumns returns true if all the specified columns are present in the row image.
+func containsAllColumns(columns mysql.Bitmap, ordinals []int) bool {
+	for _, i := range ordinals {
+		if i >= columns.Count() || !columns.Bit(i) {
+			return false
+		}
+	}
+	return true
 }
 
 func (a *binlogReplicaApplier) writeChanges(
@@ -1209,11 +1295,19 @@ func (a *binlogReplicaApplier) appendRowFormatChanges(
 			txnSeqNumbers.Append(txnSeq)
 			TxnStmtOrdinals.Append(txnStmtOrdinal)
 
-			pos := 0
+			pos, valueIndex := 0, 0
 			for i := range schema {
 				builder := fields[i]
 
-				if row.NullIdentifyColumns.Bit(i) {
+				// A minimal before image contains only the primary key columns, which identify the row to delete.
+				// The NULL bitmap covers only the columns present in the image.
+				if !rows.IdentifyColumns.Bit(i) {
+					builder.AppendNull()
+					continue
+				}
+				isNull := row.NullIdentifyColumns.Bit(valueIndex)
+				valueIndex++
+				if isNull {
 					builder.AppendNull()
 					continue
 				}
@@ -1264,6 +1358,29 @@ func (a *binlogReplicaApplier) appendRowFormatChanges(
 	return nil
 }
 
+// forEachPayloadEvent decompresses a Transaction_payload event and calls |fn| on each of the events
+// of the transaction in order. The events in the payload do not carry checksums. Large payloads are
+// decompressed as a stream, so the uncompressed transaction is never held in memory as a whole.
+func forEachPayloadEvent(format mysql.BinlogFormat, event mysql.BinlogEvent, fn func(mysql.BinlogEvent) error) error {
+	payload, err := event.TransactionPayload(format)
+	if err != nil {
+		return err
+	}
+	defer payload.Close()
+	for {
+		event, err := payload.GetNextEvent()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
+
 func (a *binlogReplicaApplier) flushDeltaBuffer(ctx *sql.Context, reason delta.FlushReason) error {
 	conn, err := adapter.GetCatalogConn(ctx)
 	if err != nil {
@@ -1278,7 +1395,7 @@ func (a *binlogReplicaApplier) flushDeltaBuffer(ctx *sql.Context, reason delta.F
 
 	if err = a.tableWriterProvider.FlushDeltaBuffer(ctx, conn, tx, reason); err != nil {
 		ctx.GetLogger().Errorf("Failed to flush changelog: %v", err.Error())
-		MyBinlogReplicaController.setSqlError(sqlerror.ERUnknownError, err.Error())
+		a.controller.setSqlError(sqlerror.ERUnknownError, err.Error())
 	}
 	return err
 }
@@ -1359,6 +1476,7 @@ func (a *binlogReplicaApplier) getTableSchema(ctx *sql.Context, engine *gms.Engi
 func parseRow(ctx *sql.Context, engine *gms.Engine, tableMap *mysql.TableMap, schema sql.Schema, columnsPresentBitmap, nullValuesBitmap mysql.Bitmap, data []byte) (sql.Row, error) {
 	var parsedRow sql.Row
 	pos := 0
+	valueIndex := 0 // the NULL bitmap covers only the columns present in the row image
 
 	for i, typ := range tableMap.Types {
 		column := schema[i]
@@ -1367,10 +1485,12 @@ func parseRow(ctx *sql.Context, engine *gms.Engine, tableMap *mysql.TableMap, sc
 			parsedRow = append(parsedRow, nil)
 			continue
 		}
+		isNull := nullValuesBitmap.Bit(valueIndex)
+		valueIndex++
 
 		var value sqltypes.Value
 		var err error
-		if nullValuesBitmap.Bit(i) {
+		if isNull {
 			value, err = sqltypes.NewValue(vquery.Type_NULL_TYPE, nil)
 			if err != nil {
 				return nil, err
@@ -16,7 +16,9 @@ package binlogreplication
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -31,8 +33,6 @@ import (
 	"github.com/dolthub/go-mysql-server/sql/mysql_db"
 )
 
-var MyBinlogReplicaController = newMyBinlogReplicaController()
-
 // binlogApplierUser is the locked, super user account that is used to execute replicated SQL statements.
 // We cannot always assume the root account will exist, so we automatically create this account that is
 // specific to binlog replication and lock it so that it cannot be used to login.
@@ -53,12 +53,13 @@ var ErrEmptyUsername = fmt.Errorf("fatal error: Invalid (empty) username when at
 // ErrReplicationStopped is an internal error that is not returned to users, and signals that STOP REPLICA was called.
 var ErrReplicationStopped = fmt.Errorf("replication stop requested")
 
-// myBinlogReplicaController implements the BinlogReplicaController interface for a database in order to
-// provide support for a Dolt server to be a replica of a MySQL primary.
+// MyBinlogReplicaController implements the BinlogReplicaController interface for a database in order to
+// provide support for a Dolt server to be a replica of a MySQL primary. Each server has a controller of its own,
+// see NewMyBinlogReplicaController.
 //
 // This type is used concurrently – multiple sessions on the DB can call this interface concurrently,
 // so all state that the controller tracks MUST be protected with a mutex.
-type myBinlogReplicaController struct {
+type MyBinlogReplicaController struct {
 	status  binlogreplication.ReplicaStatus
 	filters *filterConfiguration
 	applier *binlogReplicaApplier
@@ -72,11 +73,11 @@ type myBinlogReplicaController struct {
 	engine         *sqle.Engine
 }
 
-var _ binlogreplication.BinlogReplicaController = (*myBinlogReplicaController)(nil)
+var _ binlogreplication.BinlogReplicaController = (*MyBinlogReplicaController)(nil)
 
-// newMyBinlogReplicaController creates a new myBinlogReplicaController instance.
-func newMyBinlogReplicaController() *myBinlogReplicaController {
-	controller := myBinlogReplicaController{
+// NewMyBinlogReplicaController creates a new MyBinlogReplicaController instance.
+func NewMyBinlogReplicaController() *MyBinlogReplicaController {
+	controller := MyBinlogReplicaController{
 		filters:        newFilterConfiguration(),
 		statusMutex:    &sync.Mutex{},
 		operationMutex: &sync.Mutex{},
@@ -86,12 +87,12 @@ func newMyBinlogReplicaController() *myBinlogReplicaController {
 	controller.status.AutoPosition = true
 	controller.status.ReplicaIoRunning = binlogreplication.ReplicaIoNotRunning
 	controller.status.ReplicaSqlRunning = binlogreplication.ReplicaSqlNotRunning
-	controller.applier = newBinlogReplicaApplier(controller.filters)
+	controller.applier = newBinlogReplicaApplier(&controller)
 	return &controller
 }
 
 // StartReplica implements the BinlogReplicaController interface.
-func (d *myBinlogReplicaController) StartReplica(ctx *sql.Context) error {
+func (d *MyBinlogReplicaController) StartReplica(ctx *sql.Context) error {
 	d.operationMutex.Lock()
 	defer d.operationMutex.Unlock()
 
@@ -118,16 +119,16 @@ func (d *myBinlogReplicaController) StartReplica(ctx *sql.Context) error {
 		return fmt.Errorf("unable to start replication: %s", err.Error())
 	}
 
-	configuration, err := loadReplicationConfiguration(ctx, d.engine.Analyzer.Catalog.MySQLDb)
+	configuration, err := loadReplicationConfiguration(ctx, d.engine)
 	if err != nil {
 		return err
 	} else if configuration == nil {
 		return ErrServerNotConfiguredAsReplica
 	} else if configuration.Host == "" {
-		MyBinlogReplicaController.setIoError(ERFatalReplicaError, ErrEmptyHostname.Error())
+		d.setIoError(ERFatalReplicaError, ErrEmptyHostname.Error())
 		return ErrEmptyHostname
 	} else if configuration.User == "" {
-		MyBinlogReplicaController.setIoError(ERFatalReplicaError, ErrEmptyUsername.Error())
+		d.setIoError(ERFatalReplicaError, ErrEmptyUsername.Error())
 		return ErrEmptyUsername
 	}
 
@@ -162,7 +163,7 @@ func (d *myBinlogReplicaController) StartReplica(ctx *sql.Context) error {
 // changes and execute DDL statements on the running server. If the account doesn't exist, it will be
 // created and locked to disable log ins, and if it does exist, but is missing super privs or is not
 // locked, it will be given super user privs and locked.
-func (d *myBinlogReplicaController) configureReplicationUser(ctx *sql.Context) error {
+func (d *MyBinlogReplicaController) configureReplicationUser(ctx *sql.Context) error {
 	mySQLDb := d.engine.Analyzer.Catalog.MySQLDb
 	ed := mySQLDb.Editor()
 	defer ed.Close()
@@ -191,25 +192,25 @@ func (d *myBinlogReplicaController) configureReplicationUser(ctx *sql.Context) e
 // SetExecutionContext sets the unique |ctx| for the replica's applier to use when applying changes from binlog events
 // to a database. The applier cannot reuse any existing context, because it executes in a separate routine and would
 // cause race conditions.
-func (d *myBinlogReplicaController) SetExecutionContext(ctx *sql.Context) {
+func (d *MyBinlogReplicaController) SetExecutionContext(ctx *sql.Context) {
 	d.ctx = ctx
 }
 
 // SetEngine sets the SQL engine this replica will use when running replicated statements and
 // when loading the Catalog to find the "mysql" database.
-func (d *myBinlogReplicaController) SetEngine(engine *sqle.Engine) {
+func (d *MyBinlogReplicaController) SetEngine(engine *sqle.Engine) {
 	d.engine = engine
 	d.applier.engine = engine
 }
 
 // SetTableWriterProvider sets the table writer provider for the replica's applier to use when writing replicated
 // changes to the database.
-func (d *myBinlogReplicaController) SetTableWriterProvider(provider TableWriterProvider) {
+func (d *MyBinlogReplicaController) SetTableWriterProvider(provider TableWriterProvider) {
 	d.applier.tableWriterProvider = provider
 }
 
 // StopReplica implements the BinlogReplicaController interface.
-func (d *myBinlogReplicaController) StopReplica(ctx *sql.Context) error {
+func (d *MyBinlogReplicaController) StopReplica(ctx *sql.Context) error {
 	if d.applier.IsRunning() == false {
 		ctx.Warn(3084, "Replication thread(s) for channel '' are already stopped.")
 		return nil
@@ -231,10 +232,36 @@ func (d *myBinlogReplicaController) StopReplica(ctx *sql.Context) error {
 	return nil
 }
 
+// Stop stops the replication when the server shuts down, and waits for the applier to stop. Unlike StopReplica,
+// it leaves the running state persisted, so that the replication starts again with the server, see AutoStart.
+func (d *MyBinlogReplicaController) Stop() {
+	d.operationMutex.Lock()
+	defer d.operationMutex.Unlock()
+	if !d.applier.IsRunning() {
+		return
+	}
+	select {
+	case d.applier.stopReplicationChan <- struct{}{}:
+		<-d.applier.done
+	case <-d.applier.done:
+	}
+	d.updateStatus(func(status *binlogreplication.ReplicaStatus) {
+		status.ReplicaIoRunning = binlogreplication.ReplicaIoNotRunning
+		status.ReplicaSqlRunning = binlogreplication.ReplicaSqlNotRunning
+	})
+}
+
 // SetReplicationSourceOptions implements the BinlogReplicaController interface.
-func (d *myBinlogReplicaController) SetReplicationSourceOptions(ctx *sql.Context, options []binlogreplication.ReplicationOption) error {
-	replicaSourceInfo, err := loadReplicationConfiguration(ctx, d.engine.Analyzer.Catalog.MySQLDb)
-	if err != nil {
+func (d *MyBinlogReplicaController) SetReplicationSourceOptions(ctx *sql.Context, options []binlogreplication.ReplicationOption) error {
+	replicaSourceInfo, err := loadReplicationConfiguration(ctx, d.engine)
+	if errors.Is(err, ErrSourcePasswordUnavailable) {
+		// The configuration can be changed only along with the password that cannot be decrypted.
+		if !slices.ContainsFunc(options, func(option binlogreplication.ReplicationOption) bool {
+			return strings.EqualFold(option.Name, "SOURCE_PASSWORD")
+		}) {
+			return err
+		}
+	} else if err != nil {
 		return err
 	}
 
@@ -306,11 +333,11 @@ func (d *myBinlogReplicaController) SetReplicationSourceOptions(ctx *sql.Context
 	}
 
 	// Persist the updated replica source configuration to disk
-	return persistReplicationConfiguration(ctx, replicaSourceInfo, d.engine.Analyzer.Catalog.MySQLDb)
+	return persistReplicationConfiguration(ctx, d.engine, replicaSourceInfo)
 }
 
 // SetReplicationFilterOptions implements the BinlogReplicaController interface.
-func (d *myBinlogReplicaController) SetReplicationFilterOptions(_ *sql.Context, options []binlogreplication.ReplicationOption) error {
+func (d *MyBinlogReplicaController) SetReplicationFilterOptions(_ *sql.Context, options []binlogreplication.ReplicationOption) error {
 	for _, option := range options {
 		switch strings.ToUpper(option.Name) {
 		case "REPLICATE_DO_DB":
@@ -366,9 +393,10 @@ func changeSourceLogFileToInvalidIfEmpty(status *binlogreplication.ReplicaStatus
 }
 
 // GetReplicaStatus implements the BinlogReplicaController interface
-func (d *myBinlogReplicaController) GetReplicaStatus(ctx *sql.Context) (*binlogreplication.ReplicaStatus, error) {
-	replicaSourceInfo, err := loadReplicationConfiguration(ctx, d.engine.Analyzer.Catalog.MySQLDb)
-	if err != nil {
+func (d *MyBinlogReplicaController) GetReplicaStatus(ctx *sql.Context) (*binlogreplication.ReplicaStatus, error) {
+	// The status does not include the password.
+	replicaSourceInfo, err := loadReplicationConfiguration(ctx, d.engine)
+	if err != nil && !errors.Is(err, ErrSourcePasswordUnavailable) {
 		return nil, err
 	}
 
@@ -405,7 +433,7 @@ func (d *myBinlogReplicaController) GetReplicaStatus(ctx *sql.Context) (*binlogr
 }
 
 // ResetReplica implements the BinlogReplicaController interface
-func (d *myBinlogReplicaController) ResetReplica(ctx *sql.Context, resetAll bool) error {
+func (d *MyBinlogReplicaController) ResetReplica(ctx *sql.Context, resetAll bool) error {
 	d.operationMutex.Lock()
 	defer d.operationMutex.Unlock()
 
@@ -424,7 +452,7 @@ func (d *myBinlogReplicaController) ResetReplica(ctx *sql.Context, resetAll bool
 	})
 
 	if resetAll {
-		err := deleteReplicationConfiguration(ctx, d.engine.Analyzer.Catalog.MySQLDb)
+		err := deleteReplicationConfiguration(ctx, d.engine)
 		if err != nil {
 			return err
 		}
@@ -438,14 +466,14 @@ func (d *myBinlogReplicaController) ResetReplica(ctx *sql.Context, resetAll bool
 // updateStatus allows the caller to safely update the replica controller's status. The controller locks it's mutex
 // before the specified function |f| is called, and unlocks it after |f| is finished running. The current status is
 // passed into the callback function |f| and the caller can safely update or copy any fields they need.
-func (d *myBinlogReplicaController) updateStatus(f func(status *binlogreplication.ReplicaStatus)) {
+func (d *MyBinlogReplicaController) updateStatus(f func(status *binlogreplication.ReplicaStatus)) {
 	d.statusMutex.Lock()
 	defer d.statusMutex.Unlock()
 	f(&d.status)
 }
 
 // setIoError updates the current replication status with the specific |errno| and |message| to describe an IO error.
-func (d *myBinlogReplicaController) setIoError(errno sqlerror.ErrorCode, message string) {
+func (d *MyBinlogReplicaController) setIoError(errno sqlerror.ErrorCode, message string) {
 	d.statusMutex.Lock()
 	defer d.statusMutex.Unlock()
 
@@ -461,7 +489,7 @@ func (d *myBinlogReplicaController) setIoError(errno sqlerror.ErrorCode, message
 }
 
 // setSqlError updates the current replication status with the specific |errno| and |message| to describe an SQL error.
-func (d *myBinlogReplicaController) setSqlError(errno sqlerror.ErrorCode, message string) {
+func (d *MyBinlogReplicaController) setSqlError(errno sqlerror.ErrorCode, message string) {
 	d.statusMutex.Lock()
 	defer d.statusMutex.Unlock()
 
@@ -477,7 +505,7 @@ func (d *myBinlogReplicaController) setSqlError(errno sqlerror.ErrorCode, messag
 }
 
 // setSourceServerID updates the current replication status with the specific |serverID| to identify the source server.
-func (d *myBinlogReplicaController) setSourceServerID(serverID uint32) {
+func (d *MyBinlogReplicaController) setSourceServerID(serverID uint32) {
 	d.statusMutex.Lock()
 	d.status.SourceServerId = strconv.Itoa(int(serverID))
 	d.statusMutex.Unlock()
@@ -486,8 +514,22 @@ func (d *myBinlogReplicaController) setSourceServerID(serverID uint32) {
 // AutoStart starts up replication if replication was running before the server was shutdown. If
 // replication is not configured, hasn't been started, or has been stopped before the server was
 // shutdown, then this method will not start replication. This method should only be called during
-// the server startup process and should not be invoked after that.
-func (d *myBinlogReplicaController) AutoStart(_ context.Context) error {
+// the server startup process and should not be invoked after that. The replication configuration stored
+// in the "mysql" database by earlier versions is migrated to the replica source info table beforehand, and the secret
+// of the replication source is created for mysql_query.
+func (d *MyBinlogReplicaController) AutoStart(_ context.Context) error {
+	if err := migrateReplicationConfiguration(d.ctx, d.engine); err != nil {
+		logrus.Errorf("Unable to migrate replication configuration: %s", err.Error())
+		return err
+	}
+
+	// The secret of the replication source is kept in memory only, so it is created again on startup.
+	if configuration, err := loadReplicationConfiguration(d.ctx, d.engine); err != nil {
+		logrus.Errorf("Unable to load replication configuration: %s", err.Error())
+	} else {
+		syncReplicationSourceSecret(d.ctx, d.engine, configuration)
+	}
+
 	runningState, err := loadReplicationRunningState(d.ctx, d.engine)
 	if err != nil {
 		logrus.Errorf("Unable to load replication running state: %s", err.Error())
@@ -16,6 +16,7 @@ package binlogreplication
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"math/rand"
@@ -284,6 +285,164 @@ func TestFlushLogs(t *testing.T) {
 
 // TestResetReplica tests that "RESET REPLICA" and "RESET REPLICA ALL" correctly clear out
 // replication configuration and metadata.
+// TestBinlogTransactionCompression tests that the transactions compressed by a source with
+// binlog_transaction_compression=ON are decompressed and applied.
+func TestBinlogTransactionCompression(t *testing.T) {
+	defer teardown(t)
+	startSqlServersWithSystemVars(t, duckReplicaSystemVars)
+	startReplicationAndCreateTestDb(t, mySqlPort)
+
+	primaryDatabase.MustExec("create table t (pk int primary key, c1 varchar(100));")
+	waitForReplicaToCatchUp(t)
+
+	// The session variable must be set on the connection that runs the transaction
+	ctx := context.Background()
+	conn, err := primaryDatabase.Connx(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "set session binlog_transaction_compression = ON;")
+	require.NoError(t, err)
+
+	_, err = conn.ExecContext(ctx, "start transaction;")
+	require.NoError(t, err)
+	for i := 1; i <= 100; i++ {
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("insert into t values (%d, repeat('x', %d));", i, i))
+		require.NoError(t, err)
+	}
+	_, err = conn.ExecContext(ctx, "update t set c1 = 'updated' where pk % 10 = 0;")
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "delete from t where pk > 90;")
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "commit;")
+	require.NoError(t, err)
+
+	// A compressed single-statement transaction
+	_, err = conn.ExecContext(ctx, "insert into t values (1000, 'single');")
+	require.NoError(t, err)
+	waitForReplicaToCatchUp(t)
+
+	requireReplicaResults(t, "select count(*), sum(pk) from db01.t;", [][]any{{"91", "5095"}})
+	requireReplicaResults(t, "select c1 from db01.t where pk in (5, 10, 1000) order by pk;", [][]any{
+		{"xxxxx"}, {"updated"}, {"single"},
+	})
+}
+
+// TestBinlogRowImageMinimal tests that the partial row images written by a source with
+// binlog_row_image=MINIMAL are applied correctly, interleaved with the buffered full row images.
+func TestBinlogRowImageMinimal(t *testing.T) {
+	defer teardown(t)
+	startSqlServersWithSystemVars(t, duckReplicaSystemVars)
+	startReplicationAndCreateTestDb(t, mySqlPort)
+
+	primaryDatabase.MustExec("create table t (pk1 int, pk2 int, c1 varchar(100), c2 int default 42, primary key (pk2, pk1));")
+	waitForReplicaToCatchUp(t)
+
+	// The session variable must be set on the connection that runs the statements
+	ctx := context.Background()
+	conn, err := primaryDatabase.Connx(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "set session binlog_row_image = MINIMAL;")
+	require.NoError(t, err)
+
+	for _, stmt := range []string{
+		"insert into t (pk1, pk2, c1) values (1, 1, 'a'), (2, 1, 'b'), (3, 1, 'c'), (4, 1, 'd');",
+		"update t set c1 = 'updated' where pk1 = 1;",
+		"start transaction;",
+		"insert into t values (5, 1, 'e', 5);",
+		"update t set c2 = c2 + 1 where pk1 in (2, 5);",
+		"update t set pk1 = 30 where pk1 = 3;",
+		"delete from t where pk1 = 4;",
+		"commit;",
+	} {
+		_, err = conn.ExecContext(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+	waitForReplicaToCatchUp(t)
+
+	requireReplicaResults(t, "select pk1, pk2, c1, c2 from db01.t order by pk1;", [][]any{
+		{"1", "1", "updated", "42"},
+		{"2", "1", "b", "43"},
+		{"5", "1", "e", "6"},
+		{"30", "1", "c", "42"},
+	})
+}
+
+// TestInitialSync tests that a fresh replica with replica_initial_sync enabled clones the existing
+// tables of the source, and then streams the binlog from the position of the clone.
+func TestInitialSync(t *testing.T) {
+	defer teardown(t)
+	startSqlServersWithSystemVars(t, duckReplicaSystemVars)
+
+	// The initial sync locks the source and reads its tables
+	primaryDatabase.MustExec("GRANT RELOAD, SELECT ON *.* TO 'replicator'@'%';")
+	primaryDatabase.MustExec("create database db01;")
+	primaryDatabase.MustExec("create table db01.t (pk int primary key, c1 varchar(100), c2 datetime);")
+	primaryDatabase.MustExec("create table db01.ignored (pk int primary key);")
+	primaryDatabase.MustExec("insert into db01.t values (1, 'one', '2024-01-01 12:00:00'), (2, NULL, NULL);")
+
+	replicaDatabase.MustExec("set global replica_initial_sync = ON;")
+	replicaDatabase.MustExec("CHANGE REPLICATION FILTER REPLICATE_IGNORE_TABLE=(db01.ignored);")
+	startReplication(t, mySqlPort)
+
+	// The changes after the clone are replicated through the binlog
+	primaryDatabase.MustExec("insert into db01.t values (3, 'three', NULL);")
+	primaryDatabase.MustExec("update db01.t set c1 = 'two' where pk = 2;")
+	waitForReplicaToCatchUp(t)
+
+	requireReplicaResults(t, "select pk, c1, c2 from db01.t order by pk;", [][]any{
+		{"1", "one", "2024-01-01 12:00:00"},
+		{"2", "two", nil},
+		{"3", "three", nil},
+	})
+	requireReplicaResults(t, "select count(*) from information_schema.tables where table_schema = 'db01' and table_name = 'ignored';", [][]any{{"0"}})
+}
+
+// TestInitialSyncOfEmptySource tests that the initial sync of a source that has not executed any transactions
+// is not repeated when the replica reconnects before it has applied any binlog events.
+func TestInitialSyncOfEmptySource(t *testing.T) {
+	defer teardown(t)
+	startSqlServersWithSystemVars(t, duckReplicaSystemVars)
+	if !getGtidEnabled() {
+		t.Skip("the position of the source is never empty without GTIDs")
+	}
+
+	// The table is created without being logged, so the GTID set of the source stays empty
+	primaryDatabase.MustExec("GRANT RELOAD, SELECT ON *.* TO 'replicator'@'%';")
+	primaryDatabase.MustExec("RESET BINARY LOGS AND GTIDS;")
+	conn, err := primaryDatabase.Conn(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	for _, stmt := range []string{
+		"set session sql_log_bin = 0;",
+		"create database db01;",
+		"create table db01.t (pk int primary key);",
+		"insert into db01.t values (1);",
+	} {
+		_, err = conn.ExecContext(context.Background(), stmt)
+		require.NoError(t, err)
+	}
+
+	replicaDatabase.MustExec("set global replica_initial_sync = ON;")
+	startReplication(t, mySqlPort)
+	waitForReplicaIoRunning(t)
+	requireReplicaResults(t, "select pk from db01.t;", [][]any{{"1"}})
+
+	// A repeated sync would replace the table along with the row written on the replica
+	replicaDatabase.MustExec("insert into db01.t values (2);")
+	replicaDatabase.MustExec("stop replica;")
+	replicaDatabase.MustExec("start replica;")
+	waitForReplicaIoRunning(t)
+	requireReplicaResults(t, "select pk from db01.t order by pk;", [][]any{{"1"}, {"2"}})
+}
+
+// waitForReplicaIoRunning waits (up to 30s) for the replica to connect to the source, which is after the initial sync.
+func waitForReplicaIoRunning(t *testing.T) {
+	require.Eventually(t, func() bool {
+		return queryReplicaStatus(t)["Replica_IO_Running"] == "Yes"
+	}, 30*time.Second, 100*time.Millisecond)
+}
+
 func TestResetReplica(t *testing.T) {
 	defer teardown(t)
 	startSqlServersWithSystemVars(t, duckReplicaSystemVars)
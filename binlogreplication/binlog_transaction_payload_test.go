@@ -0,0 +1,85 @@
+package binlogreplication
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/mysql"
+)
+
+// newTransactionPayloadEvent compresses the events into a Transaction_payload event,
+// in the same way as a MySQL source with binlog_transaction_compression=ON.
+func newTransactionPayloadEvent(t *testing.T, format mysql.BinlogFormat, stream *mysql.FakeBinlogStream, events ...mysql.BinlogEvent) mysql.BinlogEvent {
+	var uncompressed []byte
+	for _, event := range events {
+		uncompressed = append(uncompressed, event.Bytes()...)
+	}
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	compressed := encoder.EncodeAll(uncompressed, nil)
+	require.NoError(t, encoder.Close())
+
+	// The payload header is a list of (type, length, value) fields terminated by a zero type.
+	field := func(typ byte, value uint64) []byte {
+		b := []byte{typ, 9, 0xfe}
+		return binary.LittleEndian.AppendUint64(b, value)
+	}
+	var data []byte
+	data = append(data, field(1, uint64(len(compressed)))...)                 // payload size
+	data = append(data, field(2, mysql.TransactionPayloadCompressionZstd)...) // compression type
+	data = append(data, field(3, uint64(len(uncompressed)))...)               // uncompressed size
+	data = append(data, 0)                                                    // end of the header
+	data = append(data, compressed...)
+	return mysql.NewMysql56BinlogEvent(stream.Packetize(format, 40, 0, data))
+}
+
+func TestForEachPayloadEvent(t *testing.T) {
+	format := mysql.NewMySQL56BinlogFormat()
+	stream := mysql.NewFakeBinlogStream()
+
+	// The events in the payload are written without checksums.
+	innerFormat := format
+	innerFormat.ChecksumAlgorithm = mysql.BinlogChecksumAlgOff
+	queries := []string{"BEGIN", "INSERT INTO t VALUES (1)", "INSERT INTO t VALUES (2)"}
+	var events []mysql.BinlogEvent
+	for _, sql := range queries {
+		events = append(events, mysql.NewQueryEvent(innerFormat, stream, mysql.Query{Database: "db01", SQL: sql}))
+	}
+	events = append(events, mysql.NewXIDEvent(innerFormat, stream))
+
+	event := newTransactionPayloadEvent(t, format, stream, events...)
+	require.True(t, event.IsValid())
+	require.True(t, event.IsTransactionPayload())
+	event, _, err := event.StripChecksum(format)
+	require.NoError(t, err)
+
+	var got []string
+	err = forEachPayloadEvent(format, event, func(event mysql.BinlogEvent) error {
+		switch {
+		case event.IsQuery():
+			query, err := event.Query(format)
+			require.NoError(t, err)
+			got = append(got, query.SQL)
+		case event.IsXID():
+			got = append(got, "XID")
+		default:
+			t.Fatalf("unexpected event in the payload: %v", event)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, append(queries, "XID"), got)
+
+	// An error stops the iteration.
+	stop := errors.New("stop")
+	count := 0
+	err = forEachPayloadEvent(format, event, func(mysql.BinlogEvent) error {
+		count++
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1, count)
+}
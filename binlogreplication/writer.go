@@ -55,4 +55,7 @@ type TableWriterProvider interface {
 
 	// DiscardDeltaBuffer discards the accumulated changes.
 	DiscardDeltaBuffer(ctx *sql.Context)
+
+	// DeltaBufferCommitted notifies the write hooks of the changes flushed in the transaction that has committed.
+	DeltaBufferCommitted(ctx *sql.Context)
 }
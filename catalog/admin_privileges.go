@@ -0,0 +1,96 @@
+package catalog
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// The administrative privileges allow the users other than the superusers to run the statements
+// that manage the replication, the backups, and the background jobs of the server:
+//   - REPLICATION manages the subscriptions, i.e., CREATE, ALTER, and DROP SUBSCRIPTION.
+//   - ADMIN takes and restores the backups, i.e., BACKUP DATABASE and RESTORE DATABASE,
+//     and runs and cancels the background jobs, i.e., myduck_run_job and myduck_cancel_job.
+//
+// They are granted and revoked by the superusers, see backend.ExecAdminPrivilegeStatement:
+//
+//	GRANT { REPLICATION | ADMIN } [, ...] TO user [, ...]
+//	REVOKE { REPLICATION | ADMIN } [, ...] FROM user [, ...]
+//
+// Every use of them, whether it was allowed or not, is recorded in InternalTables.AdminAuditLog along with
+// the grants themselves. Only the tables in the default catalog are used, like the tenants.
+
+// The administrative privileges.
+const (
+	PrivilegeReplication = "REPLICATION"
+	PrivilegeAdmin       = "ADMIN"
+)
+
+// IsAdminPrivilege reports whether the name is an administrative privilege, case-insensitively.
+func IsAdminPrivilege(name string) bool {
+	switch strings.ToUpper(name) {
+	case PrivilegeReplication, PrivilegeAdmin:
+		return true
+	}
+	return false
+}
+
+// AdminAuditEntry is a use of an administrative privilege, see InternalTables.AdminAuditLog.
+type AdminAuditEntry struct {
+	ConnectionID uint32
+	User         string
+	Address      string
+	Privilege    string
+	Statement    string // the statement with its credentials redacted
+	Allowed      bool
+	Err          error // the error of the statement, if any
+}
+
+func (prov *DatabaseProvider) adminTable(table InternalTable) string {
+	return FullTableName(prov.defaultCatalogName, table.Schema, table.Name)
+}
+
+// GrantAdminPrivilege grants an administrative privilege to a user.
+func (prov *DatabaseProvider) GrantAdminPrivilege(user, privilege, grantedBy string) error {
+	_, err := prov.storage.ExecContext(context.Background(),
+		"INSERT OR REPLACE INTO "+prov.adminTable(InternalTables.AdminGrants)+" VALUES (?, ?, ?, ?)",
+		user, strings.ToUpper(privilege), grantedBy, time.Now(),
+	)
+	return err
+}
+
+// RevokeAdminPrivilege revokes an administrative privilege from a user, and returns false if the user was not granted it.
+func (prov *DatabaseProvider) RevokeAdminPrivilege(user, privilege string) (bool, error) {
+	res, err := prov.storage.ExecContext(context.Background(),
+		"DELETE FROM "+prov.adminTable(InternalTables.AdminGrants)+" WHERE user_name = ? AND privilege = ?",
+		user, strings.ToUpper(privilege),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// HasAdminPrivilege reports whether a user has been granted an administrative privilege.
+func (prov *DatabaseProvider) HasAdminPrivilege(user, privilege string) (bool, error) {
+	var n int
+	err := prov.storage.QueryRowContext(context.Background(),
+		"SELECT count(*) FROM "+prov.adminTable(InternalTables.AdminGrants)+" WHERE user_name = ? AND privilege = ?",
+		user, strings.ToUpper(privilege),
+	).Scan(&n)
+	return n > 0, err
+}
+
+// AuditAdminStatement records a use of an administrative privilege.
+func (prov *DatabaseProvider) AuditAdminStatement(entry AdminAuditEntry) error {
+	var errMsg any
+	if entry.Err != nil {
+		errMsg = entry.Err.Error()
+	}
+	_, err := prov.storage.ExecContext(context.Background(),
+		"INSERT OR REPLACE INTO "+prov.adminTable(InternalTables.AdminAuditLog)+" VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		time.Now(), entry.ConnectionID, entry.User, entry.Address, entry.Privilege, entry.Statement, entry.Allowed, errMsg,
+	)
+	return err
+}
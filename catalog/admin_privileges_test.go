@@ -0,0 +1,60 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminPrivileges(t *testing.T) {
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	prov := &DatabaseProvider{storage: db, defaultCatalogName: "memory"}
+	_, err = db.Exec("CREATE SCHEMA __sys__")
+	require.NoError(t, err)
+	for _, table := range []InternalTable{InternalTables.AdminGrants, InternalTables.AdminAuditLog} {
+		_, err = db.Exec("CREATE TABLE " + table.QualifiedName() + " (" + table.DDL + ")")
+		require.NoError(t, err)
+	}
+
+	require.True(t, IsAdminPrivilege("replication"))
+	require.False(t, IsAdminPrivilege("super"))
+
+	require.NoError(t, prov.GrantAdminPrivilege("alice", "replication", "root"))
+	require.NoError(t, prov.GrantAdminPrivilege("alice", PrivilegeReplication, "root"))
+	ok, err := prov.HasAdminPrivilege("alice", PrivilegeReplication)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = prov.HasAdminPrivilege("alice", PrivilegeAdmin)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = prov.RevokeAdminPrivilege("alice", PrivilegeReplication)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = prov.RevokeAdminPrivilege("alice", PrivilegeReplication)
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = prov.HasAdminPrivilege("alice", PrivilegeReplication)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, prov.AuditAdminStatement(AdminAuditEntry{
+		ConnectionID: 1, User: "bob", Address: "127.0.0.1", Privilege: PrivilegeAdmin,
+		Statement: "BACKUP DATABASE db TO 'file:///tmp/db.bak'", Err: errors.New("denied"),
+	}))
+	var user, privilege, errMsg string
+	var allowed bool
+	err = db.QueryRow("SELECT user_name, privilege, allowed, error FROM "+InternalTables.AdminAuditLog.QualifiedName()).
+		Scan(&user, &privilege, &allowed, &errMsg)
+	require.NoError(t, err)
+	require.Equal(t, "bob", user)
+	require.Equal(t, PrivilegeAdmin, privilege)
+	require.False(t, allowed)
+	require.Equal(t, "denied", errMsg)
+}
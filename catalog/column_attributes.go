@@ -0,0 +1,113 @@
+package catalog
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/dolthub/vitess/go/sqltypes"
+	"github.com/dolthub/vitess/go/vt/sqlparser"
+)
+
+// The engine drops the display width and the ZEROFILL attribute of the integer columns when it builds their types,
+// e.g., INT(5) ZEROFILL becomes INT, so they are looked up in the original CREATE TABLE or ALTER TABLE statement,
+// as the partitioning clause is. A ZEROFILL column is also UNSIGNED in MySQL. The attributes are recorded
+// in the MySQLType of the column comment, so that they survive the later ALTER TABLE statements
+// that do not redefine the column, e.g., RENAME COLUMN. So is the dimension of a vector column, see vector.go.
+
+// columnAttributes are the attributes of a column that are not kept in its type.
+type columnAttributes struct {
+	display  uint8
+	zerofill bool
+	vector   int // the dimension of a VECTOR(n) column, which the engine reads as JSON
+}
+
+// columnDefinitions returns the attributes of the columns defined by the statement by their lower-cased names.
+// The columns that are not defined by the statement, e.g., those renamed by RENAME COLUMN, are absent.
+func columnDefinitions(query string) map[string]columnAttributes {
+	columns := make(map[string]columnAttributes)
+	replaced, _ := ReplaceVectorTypes(query)
+	stmt, err := sqlparser.Parse(replaced)
+	if err != nil {
+		return columns
+	}
+	dims := vectorDimensions(query)
+
+	var ddls []*sqlparser.DDL
+	switch stmt := stmt.(type) {
+	case *sqlparser.DDL:
+		ddls = append(ddls, stmt)
+	case *sqlparser.AlterTable:
+		ddls = stmt.Statements
+	}
+
+	for _, ddl := range ddls {
+		if ddl.TableSpec == nil {
+			continue
+		}
+		for _, col := range ddl.TableSpec.Columns {
+			var attrs columnAttributes
+			if col.Type.Length != nil {
+				if display, err := strconv.ParseUint(string(col.Type.Length.Val), 10, 8); err == nil {
+					attrs.display = uint8(display)
+				}
+			}
+			attrs.zerofill = bool(col.Type.Zerofill)
+			if dim, ok := dims[col.Name.Lowered()]; ok && strings.EqualFold(col.Type.Type, "json") {
+				attrs.vector = dim
+			}
+			columns[col.Name.Lowered()] = attrs
+		}
+	}
+	return columns
+}
+
+// unsignedType returns the unsigned counterpart of an integer type.
+func unsignedType(t sql.Type) sql.Type {
+	base := sqltypes.Null
+	switch t.Type() {
+	case sqltypes.Int8:
+		base = sqltypes.Uint8
+	case sqltypes.Int16:
+		base = sqltypes.Uint16
+	case sqltypes.Int24:
+		base = sqltypes.Uint24
+	case sqltypes.Int32:
+		base = sqltypes.Uint32
+	case sqltypes.Int64:
+		base = sqltypes.Uint64
+	default:
+		return t
+	}
+	return types.MustCreateNumberType(base)
+}
+
+// columnDataType returns the MySQL type and the annotated DuckDB type of a column,
+// taking the attributes of the column defined by the statement into account.
+func columnDataType(column *sql.Column, definitions map[string]columnAttributes) (sql.Type, AnnotatedDuckType, error) {
+	mysqlType := column.Type
+	attrs := definitions[strings.ToLower(column.Name)]
+	if attrs.vector != 0 && types.IsJSON(mysqlType) {
+		typ, err := newVectorType(attrs.vector)
+		return mysqlType, typ, err
+	}
+	integer := types.IsInteger(mysqlType)
+	if integer && attrs.zerofill {
+		mysqlType = unsignedType(mysqlType)
+	}
+	typ, err := DuckdbDataType(mysqlType)
+	if err != nil {
+		return nil, typ, err
+	}
+	if integer {
+		if attrs.display > 0 {
+			typ.mysql.Display = attrs.display
+		}
+		if attrs.zerofill {
+			typ.mysql.Unsigned = true
+			typ.mysql.Zerofill = true
+		}
+	}
+	return mysqlType, typ, nil
+}
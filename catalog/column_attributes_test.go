@@ -0,0 +1,66 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/dolthub/vitess/go/sqltypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnDefinitions(t *testing.T) {
+	require.Equal(t, map[string]columnAttributes{"id": {display: 5, zerofill: true}, "n": {}, "s": {display: 10}},
+		columnDefinitions("CREATE TABLE t (ID INT(5) ZEROFILL PRIMARY KEY, n INT, s VARCHAR(10))"))
+	require.Equal(t, map[string]columnAttributes{"c": {display: 3, zerofill: true}},
+		columnDefinitions("ALTER TABLE t MODIFY COLUMN c SMALLINT(3) UNSIGNED ZEROFILL"))
+	require.Equal(t, map[string]columnAttributes{"d": {}},
+		columnDefinitions("ALTER TABLE t CHANGE COLUMN c d INT"))
+	require.Empty(t, columnDefinitions("ALTER TABLE t RENAME COLUMN c TO d"))
+	require.Empty(t, columnDefinitions("not a statement"))
+}
+
+func TestColumnDataType(t *testing.T) {
+	column := &sql.Column{Name: "c", Type: types.Int32}
+
+	mysqlType, typ, err := columnDataType(column, map[string]columnAttributes{"c": {display: 5, zerofill: true}})
+	require.NoError(t, err)
+	require.Equal(t, types.Uint32, mysqlType)
+	require.Equal(t, "UINTEGER", typ.Name())
+	require.Equal(t, MySQLType{Name: "UINTEGER", Display: 5, Unsigned: true, Zerofill: true}, typ.MySQL())
+
+	// The annotations are kept in the column comment.
+	meta := DecodeComment[MySQLType](NewCommentWithMeta("", typ.MySQL()).Encode()).Meta
+	require.Equal(t, typ.MySQL(), meta)
+	restored, err := mysqlDataType(AnnotatedDuckType{typ.Name(), meta}, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, types.Uint32, restored)
+
+	mysqlType, typ, err = columnDataType(column, nil)
+	require.NoError(t, err)
+	require.Equal(t, types.Int32, mysqlType)
+	require.Equal(t, MySQLType{Name: "INTEGER"}, typ.MySQL())
+
+	// The attributes of the integer types do not apply to the other types.
+	column = &sql.Column{Name: "c", Type: types.MustCreateString(sqltypes.VarChar, 5, sql.Collation_Default)}
+	_, typ, err = columnDataType(column, map[string]columnAttributes{"c": {display: 5}})
+	require.NoError(t, err)
+	require.Zero(t, typ.MySQL().Display)
+}
+
+func TestTextCharsetRoundTrip(t *testing.T) {
+	for _, mysqlType := range []sql.Type{
+		types.CreateTinyText(sql.Collation_latin1_swedish_ci),
+		types.CreateText(sql.Collation_latin1_bin),
+		types.CreateMediumText(sql.Collation_utf8mb3_general_ci),
+		types.CreateLongText(sql.Collation_utf8mb4_0900_bin),
+		types.MustCreateString(sqltypes.VarChar, 10, sql.Collation_latin1_swedish_ci),
+	} {
+		typ, err := DuckdbDataType(mysqlType)
+		require.NoError(t, err)
+		meta := DecodeComment[MySQLType](NewCommentWithMeta("", typ.MySQL()).Encode()).Meta
+		restored, err := mysqlDataType(AnnotatedDuckType{typ.Name(), meta}, 0, 0)
+		require.NoError(t, err)
+		require.True(t, mysqlType.Equals(restored), "%s is restored as %s", mysqlType, restored)
+	}
+}
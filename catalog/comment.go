@@ -1,10 +1,14 @@
 package catalog
 
 import (
+	stdsql "database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"strings"
 
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/dolthub/go-mysql-server/sql"
 	"github.com/sirupsen/logrus"
 )
 
@@ -51,3 +55,52 @@ func (c *Comment[T]) Encode() string {
 	}
 	return ManagedCommentPrefix + base64.StdEncoding.EncodeToString(jsonData)
 }
+
+// SetTableComment sets the text of the comment of a table, or clears it if text is nil, e.g., for COMMENT ON TABLE.
+// The meta of a managed comment, such as the extra information of the tables created over MySQL, is kept.
+// It returns false if the table does not exist.
+func SetTableComment(ctx *sql.Context, schema, table string, text *string) (bool, error) {
+	var comment stdsql.NullString
+	err := adapter.QueryRow(ctx, `SELECT comment FROM duckdb_tables() WHERE database_name = current_database() AND schema_name = ? AND table_name = ?`,
+		schema, table).Scan(&comment)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, ErrDuckDB.New(err)
+	}
+	_, err = adapter.Exec(ctx, `COMMENT ON TABLE `+ConnectIdentifiersANSI(schema, table)+` IS `+mergeComment(comment, text))
+	return true, err
+}
+
+// SetColumnComment sets the text of the comment of a column, or clears it if text is nil, e.g., for COMMENT ON COLUMN.
+// The meta of a managed comment, such as the original MySQL type of the column, is kept.
+// It returns false if the column does not exist.
+func SetColumnComment(ctx *sql.Context, schema, table, column string, text *string) (bool, error) {
+	var comment stdsql.NullString
+	err := adapter.QueryRow(ctx, `SELECT comment FROM duckdb_columns() WHERE database_name = current_database() AND schema_name = ? AND table_name = ? AND column_name = ?`,
+		schema, table, column).Scan(&comment)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, ErrDuckDB.New(err)
+	}
+	_, err = adapter.Exec(ctx, `COMMENT ON COLUMN `+ConnectIdentifiersANSI(schema, table, column)+` IS `+mergeComment(comment, text))
+	return true, err
+}
+
+// mergeComment returns the literal of the comment that replaces the text of the current comment.
+// The meta is copied verbatim, so it needs not be decoded into its type.
+func mergeComment(current stdsql.NullString, text *string) string {
+	if current.Valid && strings.HasPrefix(current.String, ManagedCommentPrefix) {
+		c := DecodeComment[json.RawMessage](current.String)
+		c.Text = ""
+		if text != nil {
+			c.Text = *text
+		}
+		return "'" + c.Encode() + "'"
+	}
+	if text == nil {
+		return "NULL"
+	}
+	return "'" + strings.ReplaceAll(*text, "'", "''") + "'"
+}
@@ -0,0 +1,27 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeComment(t *testing.T) {
+	text := "it's new"
+	require.Equal(t, `'it''s new'`, mergeComment(stdsql.NullString{}, &text))
+	require.Equal(t, `'it''s new'`, mergeComment(stdsql.NullString{String: "old", Valid: true}, &text))
+	require.Equal(t, "NULL", mergeComment(stdsql.NullString{String: "old", Valid: true}, nil))
+
+	// The meta of a managed comment is kept.
+	managed := NewCommentWithMeta("old", MySQLType{Name: "TINYINT", Unsigned: true}).Encode()
+	merged := mergeComment(stdsql.NullString{String: managed, Valid: true}, &text)
+	c := DecodeComment[MySQLType](merged[1 : len(merged)-1])
+	require.Equal(t, text, c.Text)
+	require.Equal(t, MySQLType{Name: "TINYINT", Unsigned: true}, c.Meta)
+
+	merged = mergeComment(stdsql.NullString{String: managed, Valid: true}, nil)
+	c = DecodeComment[MySQLType](merged[1 : len(merged)-1])
+	require.Empty(t, c.Text)
+	require.Equal(t, "TINYINT", c.Meta.Name)
+}
@@ -0,0 +1,20 @@
+package catalog
+
+import "github.com/dolthub/go-mysql-server/sql"
+
+// The tables that are heavily updated by the replication fragment the storage of DuckDB:
+// the deleted and the updated rows leave holes in the row groups until the table is rewritten.
+// The delta pipeline records the churn of the tables in InternalTables.TableChurn,
+// and the tables with a high churn are rewritten in the maintenance window.
+
+// Rewrite replaces the table with a fresh copy of its rows, along with its primary key, comments, and indexes.
+func (t *Table) Rewrite(ctx *sql.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ordinals []int
+	if t.hasPrimaryKey {
+		ordinals = t.schema.PkOrdinals
+	}
+	return t.rebuild(ctx, ordinals, t.comment.Meta)
+}
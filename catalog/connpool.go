@@ -30,8 +30,9 @@ import (
 type ConnectionPool struct {
 	*stdsql.DB
 	connector *duckdb.Connector
-	conns     sync.Map // concurrent-safe map[uint32]*stdsql.Conn
-	txns      sync.Map // concurrent-safe map[uint32]*stdsql.Tx
+	conns     sync.Map        // concurrent-safe map[uint32]*stdsql.Conn
+	txns      sync.Map        // concurrent-safe map[uint32]*stdsql.Tx
+	sessions  *tenantSessions // the sessions counted in the tenants, see UseSchema
 }
 
 func NewConnectionPool(connector *duckdb.Connector, db *stdsql.DB) *ConnectionPool {
@@ -107,11 +108,10 @@ func (p *ConnectionPool) GetConnForSchema(ctx context.Context, id uint32, schema
 			logrus.WithError(err).Error("Failed to get current schema")
 			return nil, err
 		} else if currentSchema != schemaName {
-			if _, err := conn.ExecContext(context.Background(), "USE "+FullSchemaName(p.CurrentCatalog(id), schemaName)); err != nil {
-				if IsDuckDBSetSchemaNotFoundError(err) {
-					return nil, sql.ErrDatabaseNotFound.New(schemaName)
+			if _, err := p.UseSchema(ctx, id, p.CurrentCatalog(id), schemaName); err != nil {
+				if !sql.ErrDatabaseNotFound.Is(err) {
+					logrus.WithField("schema", schemaName).WithError(err).Error("Failed to switch schema")
 				}
-				logrus.WithField("schema", schemaName).WithError(err).Error("Failed to switch schema")
 				return nil, err
 			}
 		}
@@ -120,8 +120,62 @@ func (p *ConnectionPool) GetConnForSchema(ctx context.Context, id uint32, schema
 	return conn, nil
 }
 
+// UseSchema switches the current schema of the connection to the given schema in the given catalog.
+// If the catalog is empty, the name is resolved the same way as DuckDB's `USE`, i.e., as a schema
+// in the current catalog, or else as a catalog, whose default schema becomes the current one.
+// It returns the current schema of the connection after the switch.
+// The switch to a tenant beyond its connection limit fails with ErrTenantConnectionLimit, and the switch of
+// a restricted session to a tenant not granted to its user fails with ErrTenantAccessDenied, see RestrictTenants.
+// The connection is switched back on either error.
+func (p *ConnectionPool) UseSchema(ctx context.Context, id uint32, catalogName, schemaName string) (string, error) {
+	conn, err := p.GetConn(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	var lastCatalog, lastSchema string
+	if err := conn.QueryRowContext(ctx, "SELECT CURRENT_CATALOG, CURRENT_SCHEMA").Scan(&lastCatalog, &lastSchema); err != nil {
+		return "", err
+	}
+	if _, err := conn.ExecContext(ctx, "USE "+FullSchemaName(catalogName, schemaName)); err != nil {
+		if IsDuckDBSetSchemaNotFoundError(err) {
+			return "", sql.ErrDatabaseNotFound.New(schemaName)
+		}
+		return "", err
+	}
+	var currentCatalog, currentSchema string
+	if err := conn.QueryRowContext(ctx, "SELECT CURRENT_CATALOG, CURRENT_SCHEMA").Scan(&currentCatalog, &currentSchema); err != nil {
+		return "", err
+	}
+	if err := p.sessions.enter(id, currentCatalog); err != nil {
+		if _, useErr := conn.ExecContext(ctx, "USE "+FullSchemaName(lastCatalog, lastSchema)); useErr != nil {
+			logrus.WithError(useErr).Warn("Failed to switch back to the last schema")
+		}
+		return "", err
+	}
+	return currentSchema, nil
+}
+
+// RestrictTenants binds the session to its user, so that UseSchema switches it only to the tenants
+// granted to the user, until UnrestrictTenants is called, e.g., when the session is closed.
+func (p *ConnectionPool) RestrictTenants(id uint32, user string) {
+	p.sessions.restrict(id, user)
+}
+
+// UnrestrictTenants unbinds the session from its user, see RestrictTenants.
+func (p *ConnectionPool) UnrestrictTenants(id uint32) {
+	p.sessions.unrestrict(id)
+}
+
+// CloseConn rolls back the transaction of the connection, if any, and closes the connection.
 func (p *ConnectionPool) CloseConn(id uint32) error {
 	defer p.conns.Delete(id)
+	p.sessions.leave(id)
+	if entry, ok := p.txns.LoadAndDelete(id); ok {
+		tx := entry.(*stdsql.Tx)
+		if err := tx.Rollback(); err != nil && !errors.Is(err, stdsql.ErrTxDone) && !strings.Contains(err.Error(), "no transaction is active") {
+			logrus.WithError(err).Warn("Failed to rollback transaction")
+		}
+	}
 	entry, ok := p.conns.Load(id)
 	if ok {
 		conn := entry.(*stdsql.Conn)
@@ -174,6 +228,16 @@ func (p *ConnectionPool) CloseTxn(id uint32) {
 	p.txns.Delete(id)
 }
 
+// HasTxns reports whether any session has a transaction open.
+func (p *ConnectionPool) HasTxns() bool {
+	found := false
+	p.txns.Range(func(any, any) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
 func (p *ConnectionPool) Close() error {
 	var txns []*stdsql.Tx
 	p.txns.Range(func(_, value any) bool {
@@ -202,16 +266,19 @@ func (p *ConnectionPool) Close() error {
 	return errors.Join(lastErr, p.DB.Close())
 }
 
+// Reset closes the connections and the transactions of the sessions, and switches to the given database.
+// The pool is switched even if some of the connections fail to close.
 func (p *ConnectionPool) Reset(connector *duckdb.Connector, db *stdsql.DB) error {
 	err := p.Close()
-	if err != nil {
-		return fmt.Errorf("failed to close connection pool: %w", err)
-	}
 
 	p.conns.Clear()
 	p.txns.Clear()
+	p.sessions.clear()
 	p.DB = db
 	p.connector = connector
 
+	if err != nil {
+		return fmt.Errorf("failed to close connection pool: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,61 @@
+package catalog
+
+import (
+	"context"
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionPoolUseSchema(t *testing.T) {
+	ctx := context.Background()
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	pool := NewConnectionPool(connector, stdsql.OpenDB(connector))
+	defer pool.Close()
+
+	for _, stmt := range []string{
+		"CREATE SCHEMA s1",
+		"CREATE SCHEMA s2",
+		"ATTACH ':memory:' AS analytics",
+		"CREATE SCHEMA analytics.s3",
+	} {
+		_, err := pool.ExecContext(ctx, stmt)
+		require.NoError(t, err)
+	}
+
+	const id = 1
+	schema, err := pool.UseSchema(ctx, id, "", "s1")
+	require.NoError(t, err)
+	require.Equal(t, "s1", schema)
+
+	// GetConnForSchema switches back and forth only if the schema differs.
+	conn, err := pool.GetConnForSchema(ctx, id, "s2")
+	require.NoError(t, err)
+	require.Equal(t, "s2", pool.CurrentSchema(id))
+	_, err = conn.ExecContext(ctx, "CREATE TABLE t (id INT)")
+	require.NoError(t, err)
+	_, err = pool.UseSchema(ctx, id, "memory", "s1")
+	require.NoError(t, err)
+	_, err = pool.GetConnForSchema(ctx, id, "s2")
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "SELECT * FROM t")
+	require.NoError(t, err)
+
+	// A catalog switches to its default schema, and a qualified name to the schema of the catalog.
+	schema, err = pool.UseSchema(ctx, id, "", "analytics")
+	require.NoError(t, err)
+	require.Equal(t, "main", schema)
+	require.Equal(t, "analytics", pool.CurrentCatalog(id))
+	schema, err = pool.UseSchema(ctx, id, "analytics", "s3")
+	require.NoError(t, err)
+	require.Equal(t, "s3", schema)
+
+	// The current schema is kept when the switch fails.
+	_, err = pool.UseSchema(ctx, id, "", "nonexistent")
+	require.True(t, sql.ErrDatabaseNotFound.Is(err), "unexpected error: %v", err)
+	require.Equal(t, "s3", pool.CurrentSchema(id))
+}
@@ -0,0 +1,180 @@
+package catalog
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// A table created by `CREATE TABLE ... AS SELECT` in DuckDB gets the types inferred by DuckDB,
+// but not the column comments that record the original MySQL types, e.g., TINYINT(1) or ENUM.
+// Without them, the table reads back with the types derived from the DuckDB types.
+// The same holds for the columns of an existing table without comments, e.g., created over the Postgres protocol,
+// which are written by `INSERT INTO ... SELECT`.
+// The functions below restore the comments after the table has been written.
+
+// AnnotateColumnTypes records the given MySQL types of the columns of a table written from a query.
+// A column is annotated only if it has no comment yet, and DuckDB has created it with the type
+// that its MySQL type maps to.
+func AnnotateColumnTypes(ctx *sql.Context, catalogName, schemaName, tableName string, schema sql.Schema) error {
+	columns, err := queryColumns(ctx, catalogName, schemaName, tableName)
+	if err != nil {
+		return ErrDuckDB.New(err)
+	}
+
+	var sqls []string
+	for _, column := range columns {
+		idx := schema.IndexOfColName(column.ColumnName)
+		if idx < 0 || column.Comment.Valid {
+			continue
+		}
+		typ, err := DuckdbDataType(schema[idx].Type)
+		if err != nil || !sameDuckType(typ.name, column.DuckType) {
+			continue
+		}
+		comment := NewCommentWithMeta(schema[idx].Comment, typ.mysql)
+		sqls = append(sqls, commentOnColumnStmt(catalogName, schemaName, tableName, column.ColumnName, comment.Encode()))
+	}
+	return execColumnComments(ctx, sqls)
+}
+
+// ColumnSource is where a column of the result of a query is read from.
+// The zero value stands for a column that is not a direct reference to a table column, e.g., an expression,
+// which has no comment to inherit even if it is named after a table column.
+type ColumnSource struct {
+	// Tables are the tables that the column may be read from. An unqualified column reference may be read
+	// from any table in the FROM clause, and it is resolved to the only one that has a column of the name.
+	Tables []TableName
+	// Column is the name of the column, or empty for all columns of the tables in order, i.e., `*`.
+	Column string
+}
+
+// InheritColumnComments copies the managed comments of the columns read by a query to the columns of a table
+// that the result of the query is written to, i.e., created by `CREATE TABLE ... AS` or inserted into by
+// `INSERT INTO ... SELECT`. The sources are those of the result columns in order, and the columns are those
+// of the table written in the same order, which are all columns of the table if empty.
+// A column without a comment inherits the comment of its source column if they have the same DuckDB type.
+func InheritColumnComments(ctx *sql.Context, catalogName, schemaName, tableName string, columns []string, sources []ColumnSource) error {
+	tables := make(map[TableName][]*ColumnInfo)
+	tableColumns := func(table TableName) ([]*ColumnInfo, error) {
+		if cols, ok := tables[table]; ok {
+			return cols, nil
+		}
+		cols, err := queryOrderedColumns(ctx, catalogName, table.Schema, table.Table)
+		if err != nil {
+			return nil, err
+		}
+		tables[table] = cols
+		return cols, nil
+	}
+
+	var read []*ColumnInfo
+	for _, source := range sources {
+		if len(source.Tables) == 0 {
+			read = append(read, nil)
+			continue
+		}
+		if source.Column == "" {
+			for _, table := range source.Tables {
+				cols, err := tableColumns(table)
+				if err != nil {
+					return err
+				}
+				read = append(read, cols...)
+			}
+			continue
+		}
+		var matched []*ColumnInfo
+		for _, table := range source.Tables {
+			cols, err := tableColumns(table)
+			if err != nil {
+				return err
+			}
+			for _, col := range cols {
+				if strings.EqualFold(col.ColumnName, source.Column) {
+					matched = append(matched, col)
+				}
+			}
+		}
+		if len(matched) != 1 {
+			// The column may be read from a derived table, or the reference is ambiguous.
+			matched = []*ColumnInfo{nil}
+		}
+		read = append(read, matched[0])
+	}
+	if !slices.ContainsFunc(read, hasManagedComment) {
+		return nil
+	}
+
+	written, err := queryOrderedColumns(ctx, catalogName, schemaName, tableName)
+	if err != nil {
+		return err
+	}
+	if len(columns) > 0 {
+		named := make([]*ColumnInfo, 0, len(columns))
+		for _, name := range columns {
+			idx := slices.IndexFunc(written, func(col *ColumnInfo) bool { return strings.EqualFold(col.ColumnName, name) })
+			if idx < 0 {
+				return nil
+			}
+			named = append(named, written[idx])
+		}
+		written = named
+	}
+	if len(read) != len(written) {
+		// The query has not been resolved to the columns that it writes.
+		return nil
+	}
+
+	var sqls []string
+	for i, column := range written {
+		source := read[i]
+		if !hasManagedComment(source) || column.Comment.Valid || !sameDuckType(source.DuckType, column.DuckType) {
+			continue
+		}
+		sqls = append(sqls, commentOnColumnStmt(catalogName, schemaName, tableName, column.ColumnName, source.Comment.String))
+	}
+	return execColumnComments(ctx, sqls)
+}
+
+func hasManagedComment(column *ColumnInfo) bool {
+	return column != nil && column.Comment.Valid && strings.HasPrefix(column.Comment.String, ManagedCommentPrefix)
+}
+
+// queryOrderedColumns returns the columns of a table in their order in the table.
+func queryOrderedColumns(ctx *sql.Context, catalogName, schemaName, tableName string) ([]*ColumnInfo, error) {
+	columns, err := queryColumns(ctx, catalogName, schemaName, tableName)
+	if err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+	slices.SortStableFunc(columns, func(a, b *ColumnInfo) int { return a.ColumnIndex - b.ColumnIndex })
+	return columns, nil
+}
+
+// TableName is a table qualified by its schema.
+type TableName struct {
+	Schema string
+	Table  string
+}
+
+// sameDuckType reports whether two DuckDB type names denote the same type, e.g., `DECIMAL(10, 2)` and `DECIMAL(10,2)`.
+func sameDuckType(a, b string) bool {
+	return strings.EqualFold(strings.ReplaceAll(a, " ", ""), strings.ReplaceAll(b, " ", ""))
+}
+
+func commentOnColumnStmt(catalogName, schemaName, tableName, columnName, comment string) string {
+	return `COMMENT ON COLUMN ` + FullColumnName(catalogName, schemaName, tableName, columnName) +
+		` IS '` + strings.ReplaceAll(comment, "'", "''") + `'`
+}
+
+func execColumnComments(ctx *sql.Context, sqls []string) error {
+	if len(sqls) == 0 {
+		return nil
+	}
+	if _, err := adapter.Exec(ctx, strings.Join(sqls, "; ")); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
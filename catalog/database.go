@@ -137,8 +137,19 @@ func (d *Database) createAllTable(ctx *sql.Context, name string, schema sql.Prim
 
 	var sequenceName, fullSequenceName string
 
+	// The partitioning clause has been removed from the statement before parsing, so look it up in the original query.
+	var partitioning *PartitionInfo
+	if _, _, clause := LocatePartitionClause(ctx.Query()); clause != "" && !temporary {
+		var err error
+		if partitioning, err = ParsePartitionClause(clause); err != nil {
+			return sql.ErrSyntaxError.New(err)
+		}
+		ctx.Warn(ErrPartitionNotSupported, "Partitioning is not supported yet; table '%s' is created without partitions", name)
+	}
+
+	definitions := columnDefinitions(ctx.Query())
 	for _, col := range schema.Schema {
-		typ, err := DuckdbDataType(col.Type)
+		_, typ, err := columnDataType(col, definitions)
 		if err != nil {
 			return err
 		}
@@ -230,7 +241,7 @@ func (d *Database) createAllTable(ctx *sql.Context, name string, schema sql.Prim
 	b.WriteString(")")
 
 	// Add comment to the table
-	info := ExtraTableInfo{schema.PkOrdinals, withoutIndex, fullSequenceName, nil}
+	info := ExtraTableInfo{schema.PkOrdinals, withoutIndex, fullSequenceName, nil, partitioning}
 	b.WriteString(fmt.Sprintf(
 		"; COMMENT ON TABLE %s IS '%s'",
 		fullTableName,
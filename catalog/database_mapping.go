@@ -0,0 +1,155 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"gopkg.in/src-d/go-errors.v1"
+
+	"github.com/apecloud/myduckserver/adapter"
+)
+
+// A MySQL database is mapped to the DuckDB schema of the same name in the current catalog.
+// The schemas are shared with the PostgreSQL protocol, so some of the names are treated specially:
+//   - The reserved schemas are used by DuckDB and MyDuck themselves. They are not listed as databases,
+//     and databases with these names cannot be created or dropped.
+//   - The shared schemas are the default schemas of DuckDB and PostgreSQL. They are listed as databases,
+//     but cannot be dropped, since the PostgreSQL clients rely on them.
+//
+// DuckDB resolves schema names case-insensitively, so a database is found by any casing of its name and
+// reported with the name it was created with. With lower_case_table_names = 1, new databases are created
+// with lower-cased names, as in MySQL.
+
+// SchemaKind classifies a DuckDB schema by how it is exposed as a MySQL database.
+type SchemaKind string
+
+const (
+	UserSchema     SchemaKind = "user"
+	SharedSchema   SchemaKind = "shared"
+	ReservedSchema SchemaKind = "reserved"
+)
+
+// specialSchemas maps the reserved and shared schemas to the systems that own them.
+var specialSchemas = map[string]struct {
+	kind  SchemaKind
+	owner string
+}{
+	"information_schema":         {ReservedSchema, "DuckDB"},
+	"pg_catalog":                 {ReservedSchema, "DuckDB"},
+	InternalSchemas.SYS.Schema:   {ReservedSchema, "MyDuck"},
+	InternalSchemas.MySQL.Schema: {ReservedSchema, "MyDuck"},
+	"main":                       {SharedSchema, "DuckDB"},
+	"public":                     {SharedSchema, "PostgreSQL"},
+}
+
+var (
+	ErrReservedDatabaseName = errors.NewKind("database name '%s' is reserved for the internal schema of %s")
+	ErrSharedDatabase       = errors.NewKind("database '%s' is the default schema of %s and cannot be dropped")
+)
+
+// SchemaKindOf returns the kind of the schema with the given name.
+func SchemaKindOf(name string) SchemaKind {
+	if s, ok := specialSchemas[strings.ToLower(name)]; ok {
+		return s.kind
+	}
+	return UserSchema
+}
+
+// ReservedSchemaNames returns the sorted names of the reserved schemas, which are not listed as databases.
+func ReservedSchemaNames() []string {
+	var names []string
+	for name, s := range specialSchemas {
+		if s.kind == ReservedSchema {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// checkCreateDatabase returns an error if a database with the given name cannot be created.
+func checkCreateDatabase(name string) error {
+	if s, ok := specialSchemas[strings.ToLower(name)]; ok && s.kind == ReservedSchema {
+		return ErrReservedDatabaseName.New(name, s.owner)
+	}
+	return nil
+}
+
+// checkDropDatabase returns an error if the database with the given name cannot be dropped.
+func checkDropDatabase(name string) error {
+	s, ok := specialSchemas[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	if s.kind == ReservedSchema {
+		return ErrReservedDatabaseName.New(name, s.owner)
+	}
+	return ErrSharedDatabase.New(name, s.owner)
+}
+
+// newDatabaseSchemaName returns the name of the schema that is created for a new database.
+func newDatabaseSchemaName(name string) string {
+	if lowerCaseTableNames() == 1 {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+func lowerCaseTableNames() int64 {
+	_, v, ok := sql.SystemVariables.GetGlobal("lower_case_table_names")
+	if !ok {
+		return 0
+	}
+	if n, ok := v.(int64); ok {
+		return n
+	}
+	return 0
+}
+
+// resolveDatabase looks up the schema of the database case-insensitively and returns its actual name.
+func resolveDatabase(ctx *sql.Context, catalog string, name string) (string, bool, error) {
+	var schemaName string
+	err := adapter.QueryRowCatalog(ctx,
+		"SELECT schema_name FROM information_schema.schemata WHERE catalog_name = ? AND lower(schema_name) = lower(?) LIMIT 1",
+		catalog, name,
+	).Scan(&schemaName)
+	if err == stdsql.ErrNoRows {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, ErrDuckDB.New(err)
+	}
+	return schemaName, true, nil
+}
+
+// databaseMappingViewDDL returns the definition of the view that lists the schemas of all catalogs
+// along with the MySQL databases that they are exposed as.
+func databaseMappingViewDDL() string {
+	var reserved, shared []string
+	for _, name := range slices.Sorted(maps.Keys(specialSchemas)) {
+		quoted := "'" + name + "'"
+		if specialSchemas[name].kind == ReservedSchema {
+			reserved = append(reserved, quoted)
+		} else {
+			shared = append(shared, quoted)
+		}
+	}
+	return `SELECT
+    catalog_name,                                                   -- DuckDB catalog (PostgreSQL database)
+    schema_name,                                                    -- DuckDB schema (PostgreSQL schema)
+    CASE
+        WHEN lower(schema_name) IN (` + strings.Join(reserved, ", ") + `) THEN 'reserved'
+        WHEN lower(schema_name) IN (` + strings.Join(shared, ", ") + `) THEN 'shared'
+        ELSE 'user'
+    END AS kind,                                                    -- Whether the name is special
+    CASE
+        WHEN lower(schema_name) IN (` + strings.Join(reserved, ", ") + `) THEN NULL
+        ELSE schema_name
+    END AS mysql_database                                           -- MySQL database, if the schema is visible
+FROM
+    information_schema.schemata
+WHERE
+    catalog_name NOT IN ('system', 'temp')`
+}
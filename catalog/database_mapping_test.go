@@ -0,0 +1,85 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabaseNamePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		kind       SchemaKind
+		createsErr bool
+		dropsErr   bool
+	}{
+		{name: "db01", kind: UserSchema},
+		{name: "Public_2", kind: UserSchema},
+		{name: "main", kind: SharedSchema, dropsErr: true},
+		{name: "PUBLIC", kind: SharedSchema, dropsErr: true},
+		{name: "pg_catalog", kind: ReservedSchema, createsErr: true, dropsErr: true},
+		{name: "__SYS__", kind: ReservedSchema, createsErr: true, dropsErr: true},
+		{name: "information_schema", kind: ReservedSchema, createsErr: true, dropsErr: true},
+		{name: "mysql", kind: ReservedSchema, createsErr: true, dropsErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.kind, SchemaKindOf(tt.name))
+			if tt.createsErr {
+				require.True(t, ErrReservedDatabaseName.Is(checkCreateDatabase(tt.name)))
+			} else {
+				require.NoError(t, checkCreateDatabase(tt.name))
+			}
+			err := checkDropDatabase(tt.name)
+			switch {
+			case tt.kind == SharedSchema:
+				require.True(t, ErrSharedDatabase.Is(err))
+			case tt.dropsErr:
+				require.True(t, ErrReservedDatabaseName.Is(err))
+			default:
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDatabaseMappingView(t *testing.T) {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+
+	for _, stmt := range []string{
+		`CREATE SCHEMA __sys__`,
+		`CREATE SCHEMA public`,
+		`CREATE SCHEMA "MixedCase"`,
+		`CREATE VIEW __sys__.myduck_database_mapping AS ` + databaseMappingViewDDL(),
+	} {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	rows, err := db.Query(`SELECT schema_name, kind, mysql_database FROM __sys__.myduck_database_mapping WHERE catalog_name = current_database() ORDER BY schema_name`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	type mapping struct {
+		kind     string
+		database stdsql.NullString
+	}
+	got := make(map[string]mapping)
+	for rows.Next() {
+		var schema string
+		var m mapping
+		require.NoError(t, rows.Scan(&schema, &m.kind, &m.database))
+		got[schema] = m
+	}
+	require.NoError(t, rows.Err())
+
+	require.Equal(t, mapping{"user", stdsql.NullString{String: "MixedCase", Valid: true}}, got["MixedCase"])
+	require.Equal(t, mapping{"shared", stdsql.NullString{String: "main", Valid: true}}, got["main"])
+	require.Equal(t, mapping{"shared", stdsql.NullString{String: "public", Valid: true}}, got["public"])
+	require.Equal(t, mapping{"reserved", stdsql.NullString{}}, got["__sys__"])
+}
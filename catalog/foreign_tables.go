@@ -0,0 +1,305 @@
+package catalog
+
+import (
+	"cmp"
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/sirupsen/logrus"
+)
+
+// The foreign servers and the foreign tables give an FDW-like access to the external sources, on top of ATTACH:
+//
+//   - A server of Postgres, MySQL, or SQLite is attached read-only as the database `__fdw_<server>`, when it is
+//     created and on startup. Its options are the connection parameters, e.g., host, port, dbname, user, and password
+//     of Postgres, or the database file of SQLite. A server of Parquet has no options and is not attached.
+//   - A foreign table is a view in the local schema, which reads the remote table of its server, or the Parquet
+//     files, so it is resolved transparently in queries. Its columns, if given, are cast to their declared types.
+//
+// Both are registered in InternalTables.ForeignServers and InternalTables.ForeignTables.
+// The options are stored as they are given, the same as the connection strings of the subscriptions.
+
+// The foreign data wrappers, i.e., the kinds of the foreign servers.
+const (
+	ForeignWrapperPostgres = "postgres"
+	ForeignWrapperMySQL    = "mysql"
+	ForeignWrapperSQLite   = "sqlite"
+	ForeignWrapperParquet  = "parquet"
+)
+
+// foreignServerPrefix is the prefix of the names of the attached foreign servers.
+const foreignServerPrefix = "__fdw_"
+
+// ForeignServer is a server created by CREATE SERVER.
+type ForeignServer struct {
+	Name    string
+	Wrapper string
+	Options map[string]string
+}
+
+// ForeignTable is a table created by CREATE FOREIGN TABLE.
+type ForeignTable struct {
+	Schema string
+	Name   string
+	Server string
+	// Remote is the relation that the view reads, i.e., the qualified name of the remote table,
+	// or the call of read_parquet.
+	Remote string
+	// Columns are the expressions of the columns of the view, or empty for all columns of the remote table.
+	Columns []string
+}
+
+// ForeignWrapper returns the wrapper of the name given in FOREIGN DATA WRAPPER, e.g., postgres_fdw.
+func ForeignWrapper(name string) (string, bool) {
+	wrapper := strings.TrimSuffix(strings.ToLower(name), "_fdw")
+	switch wrapper {
+	case ForeignWrapperPostgres, ForeignWrapperMySQL, ForeignWrapperSQLite, ForeignWrapperParquet:
+		return wrapper, true
+	case "postgresql", "postgres_scanner":
+		return ForeignWrapperPostgres, true
+	case "mysql_scanner":
+		return ForeignWrapperMySQL, true
+	case "sqlite_scanner", "sqlite3":
+		return ForeignWrapperSQLite, true
+	}
+	return "", false
+}
+
+// ForeignServerDatabase returns the name of the database that the server is attached as.
+func ForeignServerDatabase(server string) string {
+	return foreignServerPrefix + server
+}
+
+// attachStmt returns the statement that attaches the server, or "" if the server is not attached.
+func (s *ForeignServer) attachStmt() (string, error) {
+	var location, typ string
+	switch s.Wrapper {
+	case ForeignWrapperPostgres:
+		location, typ = connectionString(s.Options, nil), "postgres"
+	case ForeignWrapperMySQL:
+		// The options of mysql_fdw, whose user names and databases are named differently.
+		location, typ = connectionString(s.Options, map[string]string{"username": "user", "dbname": "database"}), "mysql"
+	case ForeignWrapperSQLite:
+		location, typ = s.Options["database"], "sqlite"
+		if location == "" {
+			return "", fmt.Errorf(`option "database" is required for the servers of sqlite`)
+		}
+	case ForeignWrapperParquet:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unknown foreign data wrapper %q", s.Wrapper)
+	}
+	return fmt.Sprintf("ATTACH IF NOT EXISTS %s AS %s (TYPE %s, READ_ONLY)",
+		quoteStringLiteral(location), QuoteIdentifierANSI(ForeignServerDatabase(s.Name)), typ), nil
+}
+
+// connectionString returns the options as a libpq-style connection string, with the keys renamed as given.
+func connectionString(options map[string]string, rename map[string]string) string {
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := options[k]
+		if r, ok := rename[k]; ok {
+			k = r
+		}
+		if v == "" || strings.ContainsAny(v, ` '\`) {
+			v = "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, " ")
+}
+
+// RemoteTable returns the relation that a foreign table of the server reads, given the options of the table:
+// schema_name (or dbname for MySQL) and table_name for the attached servers, and filename for Parquet.
+func (s *ForeignServer) RemoteTable(name string, options map[string]string) (string, error) {
+	if s.Wrapper == ForeignWrapperParquet {
+		filename := options["filename"]
+		if filename == "" {
+			return "", fmt.Errorf(`option "filename" is required for the foreign tables of parquet`)
+		}
+		return "read_parquet(" + quoteStringLiteral(filename) + ")", nil
+	}
+	schema := options["schema_name"]
+	if schema == "" {
+		switch s.Wrapper {
+		case ForeignWrapperPostgres:
+			schema = "public"
+		case ForeignWrapperMySQL:
+			schema = cmp.Or(options["dbname"], s.Options["dbname"], s.Options["database"])
+			if schema == "" {
+				return "", fmt.Errorf(`option "dbname" is required for the foreign tables of mysql`)
+			}
+		case ForeignWrapperSQLite:
+			schema = "main"
+		}
+	}
+	table := cmp.Or(options["table_name"], name)
+	return ConnectIdentifiersANSI(ForeignServerDatabase(s.Name), schema, table), nil
+}
+
+// CreateForeignServer attaches the server and registers it.
+func CreateForeignServer(ctx *sql.Context, s *ForeignServer) error {
+	stmt, err := s.attachStmt()
+	if err != nil {
+		return err
+	}
+	if stmt != "" {
+		if _, err := adapter.ExecCatalog(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to attach server %q: %w", s.Name, err)
+		}
+	}
+	options, err := json.Marshal(s.Options)
+	if err != nil {
+		return err
+	}
+	if _, err := adapter.ExecCatalog(ctx, InternalTables.ForeignServers.UpsertStmt(), s.Name, s.Wrapper, string(options)); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// DropForeignServer drops the foreign tables of the server if cascade is true, detaches the server, and unregisters it.
+func DropForeignServer(ctx *sql.Context, name string, cascade bool) error {
+	tables, err := ListForeignTables(ctx, name)
+	if err != nil {
+		return err
+	}
+	if len(tables) > 0 && !cascade {
+		return fmt.Errorf("cannot drop server %s because other objects depend on it", name)
+	}
+	for _, t := range tables {
+		if err := DropForeignTable(ctx, t.Schema, t.Name); err != nil {
+			return err
+		}
+	}
+	if _, err := adapter.ExecCatalog(ctx, "DETACH DATABASE IF EXISTS "+QuoteIdentifierANSI(ForeignServerDatabase(name))); err != nil {
+		return err
+	}
+	if _, err := adapter.ExecCatalog(ctx, InternalTables.ForeignServers.DeleteStmt(), name); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// LookupForeignServer returns the registered server with the given name, or nil if there is none.
+func LookupForeignServer(ctx *sql.Context, name string) (*ForeignServer, error) {
+	s := &ForeignServer{Name: name}
+	var options string
+	err := adapter.QueryRowCatalog(ctx, InternalTables.ForeignServers.SelectStmt(), name).Scan(&s.Wrapper, &options)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+	if err := json.Unmarshal([]byte(options), &s.Options); err != nil {
+		return nil, fmt.Errorf("invalid options of server %q: %w", name, err)
+	}
+	return s, nil
+}
+
+// CreateForeignTable creates the view of the foreign table and registers it.
+func CreateForeignTable(ctx *sql.Context, t *ForeignTable) error {
+	columns := "*"
+	if len(t.Columns) > 0 {
+		columns = strings.Join(t.Columns, ", ")
+	}
+	if _, err := adapter.Exec(ctx, "CREATE VIEW "+ConnectIdentifiersANSI(t.Schema, t.Name)+" AS SELECT "+columns+" FROM "+t.Remote); err != nil {
+		return err
+	}
+	if _, err := adapter.ExecCatalog(ctx, InternalTables.ForeignTables.UpsertStmt(), t.Schema, t.Name, t.Server, t.Remote); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// DropForeignTable drops the view of the foreign table and unregisters it.
+func DropForeignTable(ctx *sql.Context, schema, name string) error {
+	if _, err := adapter.Exec(ctx, "DROP VIEW IF EXISTS "+ConnectIdentifiersANSI(schema, name)); err != nil {
+		return err
+	}
+	if _, err := adapter.ExecCatalog(ctx, InternalTables.ForeignTables.DeleteStmt(), schema, name); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// IsForeignTable reports whether the table is a registered foreign table.
+func IsForeignTable(ctx *sql.Context, schema, name string) (bool, error) {
+	var server, remote string
+	err := adapter.QueryRowCatalog(ctx, InternalTables.ForeignTables.SelectStmt(), schema, name).Scan(&server, &remote)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, ErrDuckDB.New(err)
+	}
+	return true, nil
+}
+
+// ListForeignTables returns the registered foreign tables of the server.
+func ListForeignTables(ctx *sql.Context, server string) ([]*ForeignTable, error) {
+	rows, err := adapter.QueryCatalog(ctx, "SELECT schema_name, table_name, remote FROM "+
+		InternalTables.ForeignTables.QualifiedName()+" WHERE server_name = ? ORDER BY schema_name, table_name", server)
+	if err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+	defer rows.Close()
+	var tables []*ForeignTable
+	for rows.Next() {
+		t := &ForeignTable{Server: server}
+		if err := rows.Scan(&t.Schema, &t.Name, &t.Remote); err != nil {
+			return nil, ErrDuckDB.New(err)
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// attachForeignServers attaches the registered servers on startup. The servers that cannot be reached are skipped,
+// so that MyDuck starts anyway; their foreign tables cannot be queried until the next startup.
+func (prov *DatabaseProvider) attachForeignServers() error {
+	rows, err := prov.storage.QueryContext(context.Background(), InternalTables.ForeignServers.SelectAllStmt())
+	if err != nil {
+		return fmt.Errorf("failed to load the foreign servers: %w", err)
+	}
+	var servers []*ForeignServer
+	for rows.Next() {
+		s := &ForeignServer{}
+		var options string
+		if err := rows.Scan(&s.Name, &s.Wrapper, &options); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to load the foreign servers: %w", err)
+		}
+		if err := json.Unmarshal([]byte(options), &s.Options); err != nil {
+			logrus.WithError(err).Warnf("Invalid options of foreign server %q", s.Name)
+			continue
+		}
+		servers = append(servers, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load the foreign servers: %w", err)
+	}
+
+	for _, s := range servers {
+		stmt, err := s.attachStmt()
+		if err == nil && stmt != "" {
+			_, err = prov.storage.ExecContext(context.Background(), stmt)
+		}
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to attach foreign server %q", s.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForeignServer(t *testing.T) {
+	for name, want := range map[string]string{
+		"postgres_fdw": ForeignWrapperPostgres,
+		"MYSQL_FDW":    ForeignWrapperMySQL,
+		"sqlite":       ForeignWrapperSQLite,
+		"parquet_fdw":  ForeignWrapperParquet,
+	} {
+		wrapper, ok := ForeignWrapper(name)
+		require.True(t, ok, name)
+		require.Equal(t, want, wrapper, name)
+	}
+	_, ok := ForeignWrapper("oracle_fdw")
+	require.False(t, ok)
+
+	pg := &ForeignServer{Name: "pg", Wrapper: ForeignWrapperPostgres, Options: map[string]string{
+		"host": "localhost", "dbname": "db", "password": "it's secret",
+	}}
+	stmt, err := pg.attachStmt()
+	require.NoError(t, err)
+	require.Equal(t, `ATTACH IF NOT EXISTS 'dbname=db host=localhost password=''it\''s secret''' AS "__fdw_pg" (TYPE postgres, READ_ONLY)`, stmt)
+	remote, err := pg.RemoteTable("orders", nil)
+	require.NoError(t, err)
+	require.Equal(t, `"__fdw_pg"."public"."orders"`, remote)
+	remote, err = pg.RemoteTable("orders", map[string]string{"schema_name": "sales", "table_name": "Orders"})
+	require.NoError(t, err)
+	require.Equal(t, `"__fdw_pg"."sales"."Orders"`, remote)
+
+	my := &ForeignServer{Name: "my", Wrapper: ForeignWrapperMySQL, Options: map[string]string{
+		"host": "127.0.0.1", "username": "root", "dbname": "shop",
+	}}
+	stmt, err = my.attachStmt()
+	require.NoError(t, err)
+	require.Equal(t, `ATTACH IF NOT EXISTS 'database=shop host=127.0.0.1 user=root' AS "__fdw_my" (TYPE mysql, READ_ONLY)`, stmt)
+	remote, err = my.RemoteTable("orders", nil)
+	require.NoError(t, err)
+	require.Equal(t, `"__fdw_my"."shop"."orders"`, remote)
+
+	_, err = (&ForeignServer{Name: "lite", Wrapper: ForeignWrapperSQLite}).attachStmt()
+	require.Error(t, err)
+
+	files := &ForeignServer{Name: "files", Wrapper: ForeignWrapperParquet}
+	stmt, err = files.attachStmt()
+	require.NoError(t, err)
+	require.Empty(t, stmt)
+	remote, err = files.RemoteTable("events", map[string]string{"filename": "/data/*.parquet"})
+	require.NoError(t, err)
+	require.Equal(t, `read_parquet('/data/*.parquet')`, remote)
+	_, err = files.RemoteTable("events", nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,177 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The full-text indexes are built by the fts extension of DuckDB, which indexes the documents of a table
+// in a separate schema, e.g., `fts_main_docs` for the table `main.docs`, and ranks them with BM25.
+// A document is identified by a unique column of the table, i.e., its primary key.
+// The index is not updated along with the table. Instead, the writes to the table mark the index stale in the same
+// transaction, see MarkFTSIndexStaleStmt, and a stale index is rebuilt before it is searched, see RefreshFTSIndexes.
+// The indexes are registered in InternalTables.FTSIndexes, which both protocols share.
+
+// FTSIndex is a full-text index registered in InternalTables.FTSIndexes.
+type FTSIndex struct {
+	Schema  string
+	Table   string
+	Name    string
+	Key     string // The unique column that identifies the documents
+	Columns []string
+	Stemmer string
+	Stale   bool // Whether the table has been written since the index was built
+}
+
+// FTSSchemaName returns the name of the schema that holds the full-text index of a table.
+func FTSSchemaName(schema, table string) string {
+	return "fts_" + schema + "_" + table
+}
+
+// CreateFTSIndexStmt returns the statement that builds the full-text index of a table, replacing the existing one.
+func CreateFTSIndexStmt(schema, table, keyColumn string, columns []string, stemmer string) string {
+	var b strings.Builder
+	b.WriteString("PRAGMA create_fts_index(")
+	b.WriteString(quoteStringLiteral(ConnectIdentifiersANSI(schema, table)))
+	b.WriteString(", ")
+	b.WriteString(quoteStringLiteral(keyColumn))
+	for _, column := range columns {
+		b.WriteString(", ")
+		b.WriteString(quoteStringLiteral(column))
+	}
+	b.WriteString(", stemmer = ")
+	b.WriteString(quoteStringLiteral(stemmer))
+	b.WriteString(", overwrite = 1)")
+	return b.String()
+}
+
+// DropFTSIndexStmt returns the statement that drops the full-text index of a table.
+func DropFTSIndexStmt(schema, table string) string {
+	return "PRAGMA drop_fts_index(" + quoteStringLiteral(ConnectIdentifiersANSI(schema, table)) + ")"
+}
+
+// FTSMatchExpr returns the expression that scores the documents of a table against a query with BM25.
+// The score is NULL for the documents that do not match. If fields is not empty, only the given columns are searched.
+// If conjunctive is true, a document matches only if it contains all the terms of the query.
+func FTSMatchExpr(schema, table, keyRef, query string, fields []string, conjunctive bool) string {
+	var b strings.Builder
+	b.WriteString(QuoteIdentifierANSI(FTSSchemaName(schema, table)))
+	b.WriteString(".match_bm25(")
+	b.WriteString(keyRef)
+	b.WriteString(", ")
+	b.WriteString(query)
+	if len(fields) > 0 {
+		b.WriteString(", fields := ")
+		b.WriteString(quoteStringLiteral(strings.Join(fields, ",")))
+	}
+	if conjunctive {
+		b.WriteString(", conjunctive := 1")
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// LoadFTSIndexes returns the full-text indexes of the current catalog.
+func LoadFTSIndexes(ctx *sql.Context) ([]FTSIndex, error) {
+	rows, err := adapter.QueryCatalog(ctx,
+		"SELECT schema_name, table_name, index_name, key_column, columns, stemmer, coalesce(stale, false) FROM "+
+			InternalTables.FTSIndexes.QualifiedName(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var indexes []FTSIndex
+	for rows.Next() {
+		var index FTSIndex
+		var columns string
+		if err := rows.Scan(&index.Schema, &index.Table, &index.Name, &index.Key, &columns, &index.Stemmer, &index.Stale); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(columns), &index.Columns); err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, rows.Err()
+}
+
+// LookupFTSIndexOfTable returns the full-text index of a table, or nil if the table has none.
+func LookupFTSIndexOfTable(ctx *sql.Context, schema, table string) (*FTSIndex, error) {
+	indexes, err := LoadFTSIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, index := range indexes {
+		if strings.EqualFold(index.Schema, schema) && strings.EqualFold(index.Table, table) {
+			return &indexes[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateFTSIndex builds the full-text index of a table and registers it, replacing the existing one of the table.
+func CreateFTSIndex(ctx *sql.Context, index *FTSIndex) error {
+	if _, err := adapter.Exec(ctx, CreateFTSIndexStmt(index.Schema, index.Table, index.Key, index.Columns, index.Stemmer)); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(index.Columns)
+	if err != nil {
+		return err
+	}
+	_, err = adapter.ExecCatalog(ctx,
+		"INSERT INTO "+InternalTables.FTSIndexes.QualifiedName()+
+			" (schema_name, table_name, index_name, key_column, columns, stemmer, created_at, stale) VALUES (?, ?, ?, ?, ?, ?, now(), false)"+
+			" ON CONFLICT DO UPDATE SET index_name = excluded.index_name, key_column = excluded.key_column,"+
+			" columns = excluded.columns, stemmer = excluded.stemmer, created_at = excluded.created_at, stale = false",
+		index.Schema, index.Table, index.Name, index.Key, string(encoded), index.Stemmer,
+	)
+	if err == nil {
+		index.Stale = false
+	}
+	return err
+}
+
+// DropFTSIndex drops the full-text index of a table and unregisters it.
+func DropFTSIndex(ctx *sql.Context, index *FTSIndex) error {
+	if _, err := adapter.Exec(ctx, DropFTSIndexStmt(index.Schema, index.Table)); err != nil {
+		return err
+	}
+	_, err := adapter.ExecCatalog(ctx, InternalTables.FTSIndexes.DeleteStmt(), index.Schema, index.Table)
+	return err
+}
+
+// MarkFTSIndexStaleStmt returns the statement that marks the full-text index of a table stale, whose arguments are
+// the schema and the name of the table. The table is matched in all schemas if the schema is empty,
+// e.g., if the name of a written table is not qualified.
+func MarkFTSIndexStaleStmt() string {
+	return "UPDATE " + InternalTables.FTSIndexes.QualifiedName() + " SET stale = true" +
+		" WHERE (lower(schema_name) = lower($1) OR $1 = '') AND lower(table_name) = lower($2) AND stale IS NOT TRUE"
+}
+
+// MarkFTSIndexStale marks the full-text index of a table stale after the table is written, see MarkFTSIndexStaleStmt.
+func MarkFTSIndexStale(ctx *sql.Context, schema, table string) error {
+	_, err := adapter.ExecCatalog(ctx, MarkFTSIndexStaleStmt(), schema, table)
+	return err
+}
+
+// RefreshFTSIndexes rebuilds the stale ones of the given full-text indexes, before they are searched.
+func RefreshFTSIndexes(ctx *sql.Context, indexes []*FTSIndex) error {
+	var errs []error
+	for _, index := range indexes {
+		if !index.Stale {
+			continue
+		}
+		ctx.GetLogger().Debugf("Rebuilding the stale full-text index %s of %s.%s", index.Name, index.Schema, index.Table)
+		errs = append(errs, CreateFTSIndex(ctx, index))
+	}
+	return errors.Join(errs...)
+}
+
+func quoteStringLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,82 @@
+package catalog
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A table in history mode has a companion history table in the same schema,
+// which retains every change that the replication applies to the table.
+// The history table has the columns of the table, followed by the HistoryColumns that describe the change.
+// When the history mode is enabled, the rows in the table are recorded as insertions,
+// so the historical state of the table can be reconstructed at any time after that.
+
+// HistoryTableSuffix is appended to the name of a table to name its history table.
+const HistoryTableSuffix = "__history"
+
+// The values of the __action column, which are the same as the ones of the delta buffer.
+const (
+	HistoryActionDelete = 0
+	HistoryActionInsert = 2
+)
+
+// HistoryColumns are the columns of a history table that describe the change, in order.
+var HistoryColumns = []struct {
+	Name string
+	Type string
+}{
+	{"__action", "TINYINT"},          // delete = 0, insert = 2; an update is recorded as a deletion followed by an insertion
+	{"__txn_tag", "VARCHAR"},         // GTID tag in MySQL>=8.4; GTID domain in MariaDB
+	{"__txn_server", "BLOB"},         // GTID server UUID in MySQL; server ID in MariaDB
+	{"__txn_group", "VARCHAR"},       // binlog file name for file position based replication
+	{"__txn_seq", "UBIGINT"},         // GTID transaction ID or binlog position in MySQL; commit LSN in PostgreSQL
+	{"__txn_stmt", "UBIGINT"},        // ordinal number of the statement in the transaction
+	{"__recorded_at", "TIMESTAMPTZ"}, // the time at which the change was committed on this server
+}
+
+// HistoryTableName returns the name of the history table of a table.
+func HistoryTableName(table string) string {
+	return table + HistoryTableSuffix
+}
+
+// CreateHistoryTableStmt returns the statement that creates the history table of a table
+// and records the current rows of the table as insertions.
+func CreateHistoryTableStmt(schema, table string) string {
+	var b strings.Builder
+	b.WriteString("CREATE TABLE ")
+	b.WriteString(ConnectIdentifiersANSI(schema, HistoryTableName(table)))
+	b.WriteString(" AS SELECT *, ")
+	b.WriteString(strconv.Itoa(HistoryActionInsert))
+	b.WriteString("::TINYINT AS __action")
+	for _, col := range HistoryColumns[1 : len(HistoryColumns)-1] {
+		b.WriteString(", NULL::")
+		b.WriteString(col.Type)
+		b.WriteString(" AS ")
+		b.WriteString(col.Name)
+	}
+	b.WriteString(", now() AS __recorded_at FROM ")
+	b.WriteString(ConnectIdentifiersANSI(schema, table))
+	return b.String()
+}
+
+// HistoryAsOfQuery returns a query that reconstructs the state of a table at the given time from its history table.
+// The time is an SQL expression, and the columns and the primary key columns must be quoted already.
+// For each primary key, the last change recorded at or before the time is picked,
+// and the row exists if the change is an insertion.
+func HistoryAsOfQuery(schema, historyTable string, columns, primaryKey []string, asOf string) string {
+	columnList := strings.Join(columns, ", ")
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	b.WriteString(columnList)
+	b.WriteString(" FROM (SELECT ")
+	b.WriteString(columnList)
+	b.WriteString(", __action, row_number() OVER (PARTITION BY ")
+	b.WriteString(strings.Join(primaryKey, ", "))
+	b.WriteString(" ORDER BY __recorded_at DESC, __txn_group DESC NULLS LAST, __txn_seq DESC NULLS LAST, __txn_stmt DESC NULLS LAST, __action DESC) AS __rank FROM ")
+	b.WriteString(ConnectIdentifiersANSI(schema, historyTable))
+	b.WriteString(" WHERE __recorded_at <= ")
+	b.WriteString(asOf)
+	b.WriteString(") AS __history WHERE __rank = 1 AND __action = ")
+	b.WriteString(strconv.Itoa(HistoryActionInsert))
+	return b.String()
+}
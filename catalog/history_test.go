@@ -0,0 +1,61 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryAsOfQuery(t *testing.T) {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+
+	for _, stmt := range []string{
+		`CREATE TABLE t (id INT PRIMARY KEY, v VARCHAR)`,
+		`INSERT INTO t VALUES (1, 'a'), (2, 'b')`,
+		CreateHistoryTableStmt("main", "t"),
+		// Move the snapshot back in time, so that the changes below are recorded after it.
+		`UPDATE t__history SET __recorded_at = '2024-01-01 00:00:00+00'`,
+		// An update of row 1 in a transaction, and a deletion of row 2 in a later one.
+		`INSERT INTO t__history VALUES
+			(1, 'a', 0, NULL, NULL, NULL, 10, 0, '2024-01-02 00:00:00+00'),
+			(1, 'c', 2, NULL, NULL, NULL, 10, 0, '2024-01-02 00:00:00+00'),
+			(2, 'b', 0, NULL, NULL, NULL, 11, 0, '2024-01-02 00:00:00+00'),
+			(3, 'd', 2, NULL, NULL, NULL, 12, 0, '2024-01-03 00:00:00+00')`,
+	} {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	tests := []struct {
+		asOf string
+		want map[int]string
+	}{
+		{"'2023-12-31 00:00:00+00'", map[int]string{}},
+		{"'2024-01-01 00:00:00+00'", map[int]string{1: "a", 2: "b"}},
+		{"'2024-01-02 12:00:00+00'", map[int]string{1: "c"}},
+		{"'2024-01-03 00:00:00+00'", map[int]string{1: "c", 3: "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.asOf, func(t *testing.T) {
+			query := HistoryAsOfQuery("main", HistoryTableName("t"), []string{`"id"`, `"v"`}, []string{`"id"`}, tt.asOf+"::TIMESTAMPTZ")
+			rows, err := db.Query(query)
+			require.NoError(t, err, query)
+			defer rows.Close()
+
+			got := make(map[int]string)
+			for rows.Next() {
+				var id int
+				var v string
+				require.NoError(t, rows.Scan(&id, &v))
+				got[id] = v
+			}
+			require.NoError(t, rows.Err())
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
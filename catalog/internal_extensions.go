@@ -0,0 +1,168 @@
+package catalog
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// An internal extension is a set of internal tables, views, and macros registered by a package outside of
+// the catalog, e.g., a plugin or a downstream fork, so that it does not have to patch the lists of the catalog.
+// The extensions are registered in the init functions of their packages, before the database provider is created:
+//
+//	func init() {
+//		err := catalog.RegisterInternalExtension(catalog.InternalExtension{
+//			Name:   "audit",
+//			Tables: []catalog.InternalTable{{Schema: "__sys__", Name: "audit_log", KeyColumns: ..., DDL: ...}},
+//		})
+//		...
+//	}
+//
+// Their objects are created after the built-in ones, in the order of registration, which respects DependsOn,
+// since an extension may only depend on the extensions registered before it, e.g., by the packages it imports.
+// The tables are created if they do not exist and upgraded by the Migrations of the extension, whose version
+// is recorded in the schema_version internal table as the component "extension:<name>". The views and the macros
+// are recreated when their definitions change, along with the built-in ones.
+
+// InternalExtension is a set of internal objects registered by RegisterInternalExtension.
+type InternalExtension struct {
+	// Name identifies the extension. It is a simple identifier.
+	Name string
+	// DependsOn are the names of the extensions whose objects are used by the objects of this one.
+	DependsOn []string
+	Tables    []InternalTable
+	Views     []InternalView
+	Macros    []InternalMacro
+	// Migrations change the tables of the extension that may already exist, in ascending order of version.
+	Migrations []CatalogMigration
+}
+
+var internalExtensions struct {
+	sync.Mutex
+	registered []InternalExtension
+	frozen     bool // set when a database provider is created
+}
+
+// RegisterInternalExtension registers the internal objects of an extension.
+// It fails if the database provider has been created, or if an object collides with an existing one.
+func RegisterInternalExtension(ext InternalExtension) error {
+	internalExtensions.Lock()
+	defer internalExtensions.Unlock()
+	if internalExtensions.frozen {
+		return fmt.Errorf("internal extension %q must be registered before the database provider is created", ext.Name)
+	}
+	if !simpleIdentifierRegex.MatchString(ext.Name) {
+		return fmt.Errorf("invalid name of internal extension: %q", ext.Name)
+	}
+
+	names := make(map[string]struct{})
+	for _, e := range internalExtensions.registered {
+		names[e.Name] = struct{}{}
+	}
+	if _, ok := names[ext.Name]; ok {
+		return fmt.Errorf("internal extension %q is already registered", ext.Name)
+	}
+	for _, dep := range ext.DependsOn {
+		if _, ok := names[dep]; !ok {
+			return fmt.Errorf("internal extension %q depends on %q, which is not registered before it", ext.Name, dep)
+		}
+	}
+
+	objects := make(map[string]struct{})
+	for _, t := range allInternalTables() {
+		objects[t.QualifiedName()] = struct{}{}
+	}
+	for _, v := range allInternalViews() {
+		objects[v.QualifiedName()] = struct{}{}
+	}
+	for _, m := range allInternalMacros() {
+		objects[m.QualifiedName()] = struct{}{}
+	}
+	var added []string
+	for _, t := range ext.Tables {
+		if len(t.KeyColumns) == 0 {
+			return fmt.Errorf("internal table %q of extension %q has no key columns", t.QualifiedName(), ext.Name)
+		}
+		added = append(added, t.QualifiedName())
+	}
+	for _, v := range ext.Views {
+		added = append(added, v.QualifiedName())
+	}
+	for _, m := range ext.Macros {
+		added = append(added, m.QualifiedName())
+	}
+	for _, name := range added {
+		if _, ok := objects[name]; ok {
+			return fmt.Errorf("internal object %q of extension %q already exists", name, ext.Name)
+		}
+		objects[name] = struct{}{}
+	}
+
+	if !slices.IsSortedFunc(ext.Migrations, func(a, b CatalogMigration) int { return a.Version - b.Version }) {
+		return fmt.Errorf("migrations of internal extension %q are not in ascending order of version", ext.Name)
+	}
+
+	internalExtensions.registered = append(internalExtensions.registered, ext)
+	return nil
+}
+
+// freezeInternalExtensions disallows the registration of the extensions from now on.
+func freezeInternalExtensions() {
+	internalExtensions.Lock()
+	defer internalExtensions.Unlock()
+	internalExtensions.frozen = true
+}
+
+// registeredInternalExtensions returns the registered extensions in the order of registration.
+// The caller must not modify the returned slice.
+func registeredInternalExtensions() []InternalExtension {
+	internalExtensions.Lock()
+	defer internalExtensions.Unlock()
+	return internalExtensions.registered
+}
+
+// extensionComponent is the component in the schema_version internal table of the migrations of an extension.
+func extensionComponent(name string) string {
+	return "extension:" + name
+}
+
+// allInternalTables returns the built-in internal tables followed by the ones of the extensions.
+func allInternalTables() []InternalTable {
+	tables := slices.Clone(internalTables)
+	for _, ext := range internalExtensions.registered {
+		tables = append(tables, ext.Tables...)
+	}
+	return tables
+}
+
+// allInternalViews returns the built-in internal views followed by the ones of the extensions.
+func allInternalViews() []InternalView {
+	views := slices.Clone(InternalViews)
+	for _, ext := range internalExtensions.registered {
+		views = append(views, ext.Views...)
+	}
+	return views
+}
+
+// allInternalMacros returns the built-in internal macros followed by the ones of the extensions.
+func allInternalMacros() []InternalMacro {
+	macros := slices.Clone(InternalMacros)
+	for _, ext := range internalExtensions.registered {
+		macros = append(macros, ext.Macros...)
+	}
+	return macros
+}
+
+// GetInternalViews returns the internal views, including the ones of the extensions.
+func GetInternalViews() []InternalView {
+	internalExtensions.Lock()
+	defer internalExtensions.Unlock()
+	return allInternalViews()
+}
+
+// GetInternalMacros returns the internal macros, including the ones of the extensions.
+func GetInternalMacros() []InternalMacro {
+	internalExtensions.Lock()
+	defer internalExtensions.Unlock()
+	return allInternalMacros()
+}
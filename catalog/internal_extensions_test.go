@@ -0,0 +1,83 @@
+package catalog
+
+import (
+	"context"
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// resetInternalExtensions restores the registry of the extensions after the test.
+func resetInternalExtensions(t *testing.T) {
+	internalExtensions.Lock()
+	registered, frozen := internalExtensions.registered, internalExtensions.frozen
+	internalExtensions.registered, internalExtensions.frozen = nil, false
+	internalExtensions.Unlock()
+	t.Cleanup(func() {
+		internalExtensions.Lock()
+		internalExtensions.registered, internalExtensions.frozen = registered, frozen
+		internalExtensions.Unlock()
+	})
+}
+
+func TestRegisterInternalExtension(t *testing.T) {
+	resetInternalExtensions(t)
+
+	audit := InternalExtension{
+		Name: "audit",
+		Tables: []InternalTable{{
+			Schema:       SchemaNameSYS,
+			Name:         "audit_log",
+			KeyColumns:   []string{"id"},
+			ValueColumns: []string{"message"},
+			DDL:          "id UBIGINT PRIMARY KEY, message TEXT",
+		}},
+		Migrations: []CatalogMigration{{
+			Version:     1,
+			Description: "add the user of the audit log",
+			Up: func(ctx context.Context, tx *stdsql.Tx) error {
+				_, err := tx.ExecContext(ctx, "ALTER TABLE __sys__.audit_log ADD COLUMN IF NOT EXISTS username TEXT")
+				return err
+			},
+		}},
+	}
+	require.NoError(t, RegisterInternalExtension(audit))
+	require.ErrorContains(t, RegisterInternalExtension(audit), "already registered")
+
+	// The dependencies must be registered first, and the names must not collide.
+	require.ErrorContains(t, RegisterInternalExtension(InternalExtension{Name: "report", DependsOn: []string{"stats"}}), "not registered before")
+	require.ErrorContains(t, RegisterInternalExtension(InternalExtension{
+		Name:  "shadow",
+		Views: []InternalView{{Schema: SchemaNameSYS, Name: InternalTables.Jobs.Name, DDL: "SELECT 1"}},
+	}), "already exists")
+	require.Error(t, RegisterInternalExtension(InternalExtension{Name: "bad name"}))
+	require.NoError(t, RegisterInternalExtension(InternalExtension{
+		Name:      "report",
+		DependsOn: []string{"audit"},
+		Views:     []InternalView{{Schema: SchemaNameSYS, Name: "audit_report", DDL: "SELECT count(*) AS n FROM __sys__.audit_log"}},
+	}))
+
+	require.Contains(t, GetInternalTables(), audit.Tables[0])
+	views := GetInternalViews()
+	require.Equal(t, "audit_report", views[len(views)-1].Name)
+
+	// The objects are created with the built-in ones.
+	ctx := context.Background()
+	db := newMigrationTestDB(t)
+	_, err := db.Exec("CREATE TABLE __sys__.audit_log (id UBIGINT PRIMARY KEY, message TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, migrateComponent(ctx, db, extensionComponent("audit"), audit.Migrations))
+	require.NoError(t, createInternalObjects(ctx, db))
+	_, err = db.Exec("INSERT INTO __sys__.audit_log VALUES (1, 'login', 'root')")
+	require.NoError(t, err)
+	var n int
+	require.NoError(t, db.QueryRow("SELECT n FROM __sys__.audit_report").Scan(&n))
+	require.Equal(t, 1, n)
+	version, err := schemaVersion(ctx, db, extensionComponent("audit"))
+	require.NoError(t, err)
+	require.Equal(t, "1", version)
+
+	freezeInternalExtensions()
+	require.ErrorContains(t, RegisterInternalExtension(InternalExtension{Name: "late"}), "before the database provider is created")
+}
@@ -1,6 +1,9 @@
 package catalog
 
-import "strings"
+import (
+	"strconv"
+	"strings"
+)
 
 type MacroDefinition struct {
 	Params []string
@@ -12,8 +15,25 @@ var (
 	MacroNameMyListContains string = "my_list_contains"
 
 	MacroNameMySplitListStr string = "my_split_list_str"
+
+	MacroNameMyLSNToUBigInt string = "my_lsn_to_ubigint"
+
+	MacroNameMyCommentText string = "my_comment_text"
+
+	MacroNameMyVecFromText          string = "my_vec_from_text"
+	MacroNameMyVecToText            string = "my_vec_to_text"
+	MacroNameMyVecDim               string = "my_vec_dim"
+	MacroNameMyVecDistance          string = "my_vec_distance"
+	MacroNameMyVecDistanceEuclidean string = "my_vec_distance_euclidean"
+	MacroNameMyVecDistanceCosine    string = "my_vec_distance_cosine"
 )
 
+// relationCommentDDL is the comment of the table or the view of object_oid.
+// The aliases are unlikely to shadow the tables of the arguments, which are expanded in place.
+const relationCommentDDL = `coalesce(
+    (SELECT __sys__.my_comment_text(__t.comment) FROM duckdb_tables() __t WHERE __t.table_oid = object_oid),
+    (SELECT __sys__.my_comment_text(__v.comment) FROM duckdb_views() __v WHERE __v.view_oid = object_oid))`
+
 type InternalMacro struct {
 	Schema       string
 	Name         string
@@ -106,4 +126,202 @@ var InternalMacros = []InternalMacro{
 			},
 		},
 	},
+	{
+		// Converts a WAL position in the text form of pg_lsn, e.g., '16/B374D848', to a number for comparisons.
+		Schema:       SchemaNameSYS,
+		Name:         MacroNameMyLSNToUBigInt,
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{"lsn"},
+				DDL:    `(('0x' || split_part(lsn, '/', 1))::UBIGINT << 32) + ('0x' || split_part(lsn, '/', 2))::UBIGINT`,
+			},
+		},
+	},
+	{
+		// Extracts the text of a comment, which is encoded with its meta if it is managed, see Comment.
+		Schema:       SchemaNameSYS,
+		Name:         MacroNameMyCommentText,
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{"c"},
+				DDL: `CASE WHEN starts_with(c, '` + ManagedCommentPrefix + `')
+    THEN nullif(json_extract_string(decode(from_base64(c[` + strconv.Itoa(len(ManagedCommentPrefix)+1) + `:])), '$.text'), '')
+    ELSE c END`,
+			},
+		},
+	},
+	// The vector functions of MySQL, which the queries run in DuckDB call instead, see backend/vector.go.
+	// The vectors are the arrays of FLOAT, e.g., the columns of type VECTOR(n), or their text, e.g., '[1,2,3]'.
+	{
+		Schema:       SchemaNameSYS,
+		Name:         MacroNameMyVecFromText,
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{"s"},
+				DDL:    `s::FLOAT[]`,
+			},
+		},
+	},
+	{
+		Schema:       SchemaNameSYS,
+		Name:         MacroNameMyVecToText,
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{"v"},
+				DDL:    `'[' || array_to_string(list_transform(v::FLOAT[], x -> printf('%.5e', x)), ',') || ']'`,
+			},
+		},
+	},
+	{
+		Schema:       SchemaNameSYS,
+		Name:         MacroNameMyVecDim,
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{"v"},
+				DDL:    `len(v::FLOAT[])`,
+			},
+		},
+	},
+	{
+		Schema:       SchemaNameSYS,
+		Name:         MacroNameMyVecDistanceEuclidean,
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{"a", "b"},
+				DDL:    `list_distance(a::DOUBLE[], b::DOUBLE[])`,
+			},
+		},
+	},
+	{
+		Schema:       SchemaNameSYS,
+		Name:         MacroNameMyVecDistanceCosine,
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{"a", "b"},
+				DDL:    `1 - list_cosine_similarity(a::DOUBLE[], b::DOUBLE[])`,
+			},
+		},
+	},
+	{
+		Schema:       SchemaNameSYS,
+		Name:         MacroNameMyVecDistance,
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{"a", "b", "metric"},
+				DDL: `CASE upper(metric)
+    WHEN 'EUCLIDEAN' THEN list_distance(a::DOUBLE[], b::DOUBLE[])
+    WHEN 'COSINE' THEN 1 - list_cosine_similarity(a::DOUBLE[], b::DOUBLE[])
+    WHEN 'DOT' THEN list_inner_product(a::DOUBLE[], b::DOUBLE[])
+    ELSE error('unknown distance metric: ' || metric)::DOUBLE
+    END`,
+			},
+		},
+	},
+	// The comments of the tables, the views, and the columns, e.g., set by COMMENT ON, for psql and the other clients.
+	{
+		Schema:       "pg_catalog",
+		Name:         "obj_description",
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{"object_oid"},
+				DDL:    relationCommentDDL,
+			},
+			{
+				Params: []string{"object_oid", "catalog_name"},
+				DDL:    `CASE WHEN catalog_name = 'pg_class' THEN ` + relationCommentDDL + ` END`,
+			},
+		},
+	},
+	{
+		Schema:       "pg_catalog",
+		Name:         "col_description",
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{"relation_oid", "column_no"},
+				DDL:    `(SELECT __sys__.my_comment_text(__c.comment) FROM duckdb_columns() __c WHERE __c.table_oid = relation_oid AND __c.column_index = column_no)`,
+			},
+		},
+	},
+	// The recovery functions. A server is in recovery, i.e., a replica, if it has any subscription,
+	// and its WAL positions are the positions of its subscriptions in the WAL of their primaries,
+	// up to which the changes have been applied.
+	{
+		Schema:       "pg_catalog",
+		Name:         "pg_is_in_recovery",
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{},
+				DDL:    `EXISTS (SELECT 1 FROM __sys__.pg_subscription)`,
+			},
+		},
+	},
+	{
+		// The replication is paused if all subscriptions are disabled.
+		Schema:       "pg_catalog",
+		Name:         "pg_is_wal_replay_paused",
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{},
+				DDL:    `EXISTS (SELECT 1 FROM __sys__.pg_subscription) AND NOT EXISTS (SELECT 1 FROM __sys__.pg_subscription WHERE subenabled)`,
+			},
+		},
+	},
+	{
+		// NULL if the server is not in recovery, same as Postgres.
+		Schema:       "pg_catalog",
+		Name:         "pg_last_wal_replay_lsn",
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{},
+				DDL:    `(SELECT max_by(subskiplsn, __sys__.my_lsn_to_ubigint(subskiplsn)) FROM __sys__.pg_subscription)`,
+			},
+		},
+	},
+	{
+		// The changes are applied as soon as they are received.
+		Schema:       "pg_catalog",
+		Name:         "pg_last_wal_receive_lsn",
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{},
+				DDL:    `(SELECT max_by(subskiplsn, __sys__.my_lsn_to_ubigint(subskiplsn)) FROM __sys__.pg_subscription)`,
+			},
+		},
+	},
+	{
+		Schema:       "pg_catalog",
+		Name:         "pg_current_wal_lsn",
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{},
+				DDL:    `coalesce((SELECT max_by(subskiplsn, __sys__.my_lsn_to_ubigint(subskiplsn)) FROM __sys__.pg_subscription), '0/0')`,
+			},
+		},
+	},
+	{
+		Schema:       "pg_catalog",
+		Name:         "pg_wal_lsn_diff",
+		IsTableMacro: false,
+		Definitions: []MacroDefinition{
+			{
+				Params: []string{"lsn1", "lsn2"},
+				DDL:    `(__sys__.my_lsn_to_ubigint(lsn1)::HUGEINT - __sys__.my_lsn_to_ubigint(lsn2)::HUGEINT)::DECIMAL(38, 0)`,
+			},
+		},
+	},
 }
@@ -0,0 +1,64 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryMacros(t *testing.T) {
+	db := newMigrationTestDB(t)
+	for _, m := range InternalMacros {
+		_, err := db.Exec(createInternalMacroStmt(m))
+		require.NoError(t, err, m.Name)
+	}
+
+	var inRecovery, paused bool
+	var current string
+	query := "SELECT __sys__.pg_is_in_recovery(), __sys__.pg_is_wal_replay_paused(), __sys__.pg_current_wal_lsn()"
+	require.NoError(t, db.QueryRow(query).Scan(&inRecovery, &paused, &current))
+	require.False(t, inRecovery)
+	require.False(t, paused)
+	require.Equal(t, "0/0", current)
+
+	// The positions are compared as numbers, so '1/16B3748' is ahead of '0/FFFFFFFF'.
+	_, err := db.Exec(`INSERT INTO __sys__.pg_subscription VALUES
+		('s1', '', 'p', '0/FFFFFFFF', false, NULL, NULL, NULL), ('s2', '', 'p', '1/16B3748', false, NULL, NULL, NULL)`)
+	require.NoError(t, err)
+	require.NoError(t, db.QueryRow(query).Scan(&inRecovery, &paused, &current))
+	require.True(t, inRecovery)
+	require.True(t, paused)
+	require.Equal(t, "1/16B3748", current)
+
+	_, err = db.Exec("UPDATE __sys__.pg_subscription SET subenabled = true WHERE subname = 's1'")
+	require.NoError(t, err)
+	var replay, diff string
+	require.NoError(t, db.QueryRow(`SELECT __sys__.pg_is_wal_replay_paused(), __sys__.pg_last_wal_replay_lsn(),
+		__sys__.pg_wal_lsn_diff('1/16B3748', '0/FFFFFFFF')::VARCHAR`).Scan(&paused, &replay, &diff))
+	require.False(t, paused)
+	require.Equal(t, "1/16B3748", replay)
+	require.Equal(t, "23803721", diff)
+}
+
+func TestCommentMacros(t *testing.T) {
+	db := newMigrationTestDB(t)
+	for _, m := range InternalMacros {
+		_, err := db.Exec(createInternalMacroStmt(m))
+		require.NoError(t, err, m.Name)
+	}
+
+	managed := NewCommentWithMeta("orders of customers", ExtraTableInfo{}).Encode()
+	_, err := db.Exec(`CREATE TABLE t (a INT, b INT); CREATE VIEW v AS SELECT 1;
+		COMMENT ON TABLE t IS '` + managed + `'; COMMENT ON COLUMN t.b IS 'plain'; COMMENT ON VIEW v IS 'a view'`)
+	require.NoError(t, err)
+
+	var table, view, a, b stdsql.NullString
+	require.NoError(t, db.QueryRow(`SELECT __sys__.obj_description(t.table_oid, 'pg_class'), __sys__.obj_description(v.view_oid),
+		__sys__.col_description(t.table_oid, 1), __sys__.col_description(t.table_oid, 2)
+		FROM duckdb_tables() t, duckdb_views() v WHERE t.table_name = 't' AND v.view_name = 'v'`).Scan(&table, &view, &a, &b))
+	require.Equal(t, "orders of customers", table.String)
+	require.Equal(t, "a view", view.String)
+	require.False(t, a.Valid)
+	require.Equal(t, "plain", b.String)
+}
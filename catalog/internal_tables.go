@@ -79,6 +79,7 @@ func (it *InternalTable) DeleteStmt() string {
 	b.WriteString(it.KeyColumns[0])
 	b.WriteString(" = ?")
 	for _, c := range it.KeyColumns[1:] {
+		b.WriteString(" AND ")
 		b.WriteString(c)
 		b.WriteString(" = ?")
 	}
@@ -157,18 +158,46 @@ func (it *InternalTable) CountAllStmt() string {
 var InternalTables = struct {
 	PersistentVariable InternalTable
 	BinlogPosition     InternalTable
+	ReplicaSourceInfo  InternalTable
 	PgSubscription     InternalTable
+	PgSubscriptionRel  InternalTable
 	GlobalStatus       InternalTable
 	// TODO(sean): This is a temporary work around for clients that query the 'pg_catalog.pg_stat_replication'.
 	//             Once we add 'pg_catalog' and support views for PG, replace this by a view.
 	//             https://www.postgresql.org/docs/current/monitoring-stats.html#MONITORING-PG-STAT-REPLICATION-VIEW
-	PGStatReplication InternalTable
-	PGRange           InternalTable
-	PGType            InternalTable
-	PGProc            InternalTable
-	PGClass           InternalTable
-	PGNamespace       InternalTable
-	PGMatViews        InternalTable
+	PGStatReplication   InternalTable
+	PGRange             InternalTable
+	PGType              InternalTable
+	PGProc              InternalTable
+	PGClass             InternalTable
+	PGNamespace         InternalTable
+	PGMatViews          InternalTable
+	QueryProfiles       InternalTable
+	HistoryTables       InternalTable
+	TTLTables           InternalTable
+	TableChurn          InternalTable
+	RowTransforms       InternalTable
+	FTSIndexes          InternalTable
+	UserTypes           InternalTable
+	PGEnum              InternalTable
+	SequenceOwners      InternalTable
+	BackupHistory       InternalTable
+	SchemaVersion       InternalTable
+	RewriteRules        InternalTable
+	RoleChanges         InternalTable
+	ForeignServers      InternalTable
+	ForeignTables       InternalTable
+	Jobs                InternalTable
+	JobRuns             InternalTable
+	MaskingPolicies     InternalTable
+	UnmaskGrants        InternalTable
+	RowSecurity         InternalTable
+	RowSecurityPolicies InternalTable
+	LakeSinks           InternalTable
+	Tenants             InternalTable
+	TenantGrants        InternalTable
+	AdminGrants         InternalTable
+	AdminAuditLog       InternalTable
 }{
 	PersistentVariable: InternalTable{
 		Schema:       "__sys__",
@@ -184,12 +213,59 @@ var InternalTables = struct {
 		ValueColumns: []string{"position"},
 		DDL:          "channel TEXT PRIMARY KEY, position TEXT",
 	},
+	// ReplicaSourceInfo stores the replication source configured by CHANGE REPLICATION SOURCE TO.
+	// The password is encrypted with a key stored in the data directory.
+	ReplicaSourceInfo: InternalTable{
+		Schema: "__sys__",
+		Name:   "replica_source_info",
+		KeyColumns: []string{
+			"channel",
+		},
+		ValueColumns: []string{
+			"source_host",
+			"source_user",
+			"source_password",
+			"source_port",
+			"source_connect_retry",
+			"source_retry_count",
+			"source_log_file",
+			"source_log_pos",
+			"source_uuid",
+		},
+		DDL: "channel TEXT PRIMARY KEY, " +
+			"source_host TEXT, " +
+			"source_user TEXT, " +
+			"source_password TEXT, " +
+			"source_port USMALLINT, " +
+			"source_connect_retry UINTEGER, " +
+			"source_retry_count UBIGINT, " +
+			"source_log_file TEXT, " +
+			"source_log_pos UBIGINT, " +
+			"source_uuid TEXT",
+	},
 	PgSubscription: InternalTable{
 		Schema:       "__sys__",
 		Name:         "pg_subscription",
 		KeyColumns:   []string{"subname"},
-		ValueColumns: []string{"subconninfo", "subpublication", "subskiplsn", "subenabled"},
-		DDL:          "subname TEXT PRIMARY KEY, subconninfo TEXT, subpublication TEXT, subskiplsn TEXT, subenabled BOOLEAN",
+		ValueColumns: []string{"subconninfo", "subpublication", "subskiplsn", "subenabled", "subschema", "subschemamapping", "subslotname"},
+		// subslotname is the replication slot of the subscription, or NULL for the slot named after the publication.
+		DDL: "subname TEXT PRIMARY KEY, subconninfo TEXT, subpublication TEXT, subskiplsn TEXT, subenabled BOOLEAN, subschema TEXT, subschemamapping TEXT, subslotname TEXT",
+	},
+	// PgSubscriptionRel stores the state of the initial copy of each table of a subscription,
+	// like pg_subscription_rel of Postgres. See logrepl.TableSyncState.
+	PgSubscriptionRel: InternalTable{
+		Schema:       "__sys__",
+		Name:         "pg_subscription_rel",
+		KeyColumns:   []string{"subname", "schemaname", "relname"},
+		ValueColumns: []string{"srsubstate", "srsublsn", "srlasterror", "srupdated"},
+		DDL: "subname TEXT, " +
+			"schemaname TEXT, " +
+			"relname TEXT, " +
+			"srsubstate TEXT NOT NULL, " + // 'i' (waiting), 'd' (copying), 'r' (synced), or 'e' (error)
+			"srsublsn TEXT, " + // The LSN of the snapshot that the table was copied in, if synced
+			"srlasterror TEXT, " + // The error of the last copy, if failed
+			"srupdated TIMESTAMPTZ, " +
+			"PRIMARY KEY (subname, schemaname, relname)",
 	},
 	GlobalStatus: InternalTable{
 		Schema:       "performance_schema",
@@ -405,9 +481,12 @@ var InternalTables = struct {
 	// prosqlbody      | pg_node_tree | C         |          |         | extended |             |              |
 	// proconfig       | text[]       | C         |          |         | extended |             |              |
 	// proacl          | aclitem[]    |           |          |         | extended |             |              |
+	//
+	// PGProc stores the built-in functions of Postgres. pg_proc is the view of them and the functions of DuckDB,
+	// see pgProcViewDDL.
 	PGProc: InternalTable{
 		Schema: "__sys__",
-		Name:   "pg_proc",
+		Name:   "pg_proc_builtin",
 		KeyColumns: []string{
 			"oid",
 		},
@@ -655,12 +734,381 @@ var InternalTables = struct {
 			"ispopulated BOOLEAN, " +
 			"definition TEXT",
 	},
+	// QueryProfiles stores the DuckDB query profiles captured while `myduck.profiling` is enabled on a session.
+	// Only the latest MaxQueryProfiles are kept. See DatabaseProvider.RecordQueryProfile.
+	// The profiles are read through the `__sys__.query_profiles` view. See QueryProfileRelations for who may read them.
+	QueryProfiles: InternalTable{
+		Schema:       "__sys__",
+		Name:         "query_profile_log",
+		KeyColumns:   []string{"query_id"},
+		ValueColumns: []string{"connection_id", "query", "started_at", "latency_ms", "plan", "user_name"},
+		DDL: "query_id TEXT PRIMARY KEY, " +
+			"connection_id UBIGINT, " +
+			"query TEXT, " +
+			"started_at TIMESTAMP, " +
+			"latency_ms DOUBLE, " +
+			"plan TEXT, " + // The profile tree in JSON format
+			"user_name TEXT", // The user of the session, who may read the profile
+	},
+	// HistoryTables stores the tables in history mode, whose changes are retained in their history tables.
+	// See CreateHistoryTableStmt.
+	HistoryTables: InternalTable{
+		Schema:       "__sys__",
+		Name:         "history_tables",
+		KeyColumns:   []string{"schema_name", "table_name"},
+		ValueColumns: []string{"history_table", "key_columns", "enabled_at"},
+		DDL: "schema_name TEXT, " +
+			"table_name TEXT, " +
+			"history_table TEXT, " +
+			"key_columns TEXT, " + // The primary key columns of the table in a JSON array
+			"enabled_at TIMESTAMPTZ, " +
+			"PRIMARY KEY (schema_name, table_name)",
+	},
+	// TTLTables stores the retention policies of the tables along with the statistics of their purges.
+	// See TTLPurgeStmt.
+	TTLTables: InternalTable{
+		Schema:       "__sys__",
+		Name:         "ttl_tables",
+		KeyColumns:   []string{"schema_name", "table_name"},
+		ValueColumns: []string{"ttl", "ttl_column", "purged_rows", "last_purged_at", "last_error"},
+		DDL: "schema_name TEXT, " +
+			"table_name TEXT, " +
+			"ttl TEXT, " + // The retention period, e.g., '30 days'
+			"ttl_column TEXT, " +
+			"purged_rows UBIGINT DEFAULT 0, " + // The number of rows deleted since the policy was set
+			"last_purged_at TIMESTAMPTZ, " +
+			"last_error TEXT, " +
+			"PRIMARY KEY (schema_name, table_name)",
+	},
+	// TableChurn stores the numbers of the rows deleted or updated by the replication in the tables
+	// since they were last compacted. See (*Table).Rewrite.
+	TableChurn: InternalTable{
+		Schema:       "__sys__",
+		Name:         "table_churn",
+		KeyColumns:   []string{"schema_name", "table_name"},
+		ValueColumns: []string{"changed_rows", "last_changed_at", "last_compacted_at"},
+		DDL: "schema_name TEXT, " +
+			"table_name TEXT, " +
+			"changed_rows UBIGINT, " +
+			"last_changed_at TIMESTAMPTZ, " +
+			"last_compacted_at TIMESTAMPTZ, " +
+			"PRIMARY KEY (schema_name, table_name)",
+	},
+	// RowTransforms stores the filters and the transforms of the rows of the replicated tables,
+	// which are applied when the changes are flushed. See RowFilterParam.
+	RowTransforms: InternalTable{
+		Schema:       "__sys__",
+		Name:         "row_transforms",
+		KeyColumns:   []string{"schema_name", "table_name"},
+		ValueColumns: []string{"row_filter", "column_exprs"},
+		DDL: "schema_name TEXT, " +
+			"table_name TEXT, " +
+			"row_filter TEXT, " + // The condition of the rows to keep
+			"column_exprs TEXT, " + // The expressions of the transformed columns in a JSON object
+			"PRIMARY KEY (schema_name, table_name)",
+	},
+	// FTSIndexes stores the full-text indexes of the tables, which are built by the fts extension of DuckDB.
+	// See CreateFTSIndex.
+	FTSIndexes: InternalTable{
+		Schema:       "__sys__",
+		Name:         "fts_indexes",
+		KeyColumns:   []string{"schema_name", "table_name"},
+		ValueColumns: []string{"index_name", "key_column", "columns", "stemmer", "created_at", "stale"},
+		DDL: "schema_name TEXT, " +
+			"table_name TEXT, " +
+			"index_name TEXT, " +
+			"key_column TEXT, " + // The unique column that identifies the documents, i.e., the primary key
+			"columns TEXT, " + // The indexed columns in a JSON array
+			"stemmer TEXT, " +
+			"created_at TIMESTAMPTZ, " +
+			"stale BOOLEAN DEFAULT false, " + // Whether the table has been written since the index was built
+
+			"PRIMARY KEY (schema_name, table_name)",
+	},
+	// UserTypes stores the types created by CREATE TYPE and CREATE DOMAIN over the Postgres protocol,
+	// which are listed in pg_type as well. See CreateUserType.
+	UserTypes: InternalTable{
+		Schema:       "__sys__",
+		Name:         "user_types",
+		KeyColumns:   []string{"schema_name", "type_name"},
+		ValueColumns: []string{"oid", "kind", "base_type", "base_type_oid", "labels", "not_null", "default_value", "check_constraint"},
+		DDL: "schema_name TEXT, " +
+			"type_name TEXT, " +
+			"oid BIGINT, " +
+			"kind TEXT, " + // The typtype of pg_type, i.e., 'e' for enums, 'd' for domains, and 'c' for composite types
+			"base_type TEXT, " + // The DuckDB type of the domains and the composite types
+			"base_type_oid BIGINT, " + // The Postgres type of the domains
+			"labels TEXT, " + // The labels of the enums in a JSON array
+			"not_null BOOLEAN, " +
+			"default_value TEXT, " +
+			"check_constraint TEXT, " + // The CHECK constraint of the domains on VALUE
+			"PRIMARY KEY (schema_name, type_name)",
+	},
+	// postgres=# \d+ pg_enum
+	//                                    Table "pg_catalog.pg_enum"
+	//     Column     | Type | Collation | Nullable | Default | Storage | Compression | Stats target | Description
+	// ---------------+------+-----------+----------+---------+---------+-------------+--------------+-------------
+	//  oid           | oid  |           | not null |         | plain   |             |              |
+	//  enumtypid     | oid  |           | not null |         | plain   |             |              |
+	//  enumsortorder | real |           | not null |         | plain   |             |              |
+	//  enumlabel     | name |           | not null |         | plain   |             |              |
+	PGEnum: InternalTable{
+		Schema:       "__sys__",
+		Name:         "pg_enum",
+		KeyColumns:   []string{"oid"},
+		ValueColumns: []string{"enumtypid", "enumsortorder", "enumlabel"},
+		DDL: "oid BIGINT NOT NULL PRIMARY KEY, " +
+			"enumtypid BIGINT NOT NULL, " +
+			"enumsortorder FLOAT NOT NULL, " +
+			"enumlabel VARCHAR NOT NULL",
+	},
+	// SequenceOwners stores the columns that own the sequences, i.e., the serial columns and the columns
+	// given by OWNED BY. A sequence is dropped along with the table of its column. See RegisterSequence.
+	SequenceOwners: InternalTable{
+		Schema:       "__sys__",
+		Name:         "sequence_owners",
+		KeyColumns:   []string{"schema_name", "sequence_name"},
+		ValueColumns: []string{"table_name", "column_name"},
+		DDL: "schema_name TEXT, " + // The schema of both the sequence and the table
+			"sequence_name TEXT, " +
+			"table_name TEXT, " +
+			"column_name TEXT, " +
+			"PRIMARY KEY (schema_name, sequence_name)",
+	},
+	// BackupHistory stores the backups taken by BACKUP DATABASE, whether they succeeded or not.
+	BackupHistory: InternalTable{
+		Schema:       "__sys__",
+		Name:         "backup_history",
+		KeyColumns:   []string{"started_at"},
+		ValueColumns: []string{"db_name", "remote_path", "finished_at", "message", "error"},
+		DDL: "started_at TIMESTAMPTZ PRIMARY KEY, " +
+			"db_name TEXT, " +
+			"remote_path TEXT, " +
+			"finished_at TIMESTAMPTZ, " +
+			"message TEXT, " +
+			"error TEXT", // NULL if the backup succeeded
+	},
+	// SchemaVersion stores the versions of the internal objects of the catalog. See CatalogMigrations.
+	SchemaVersion: InternalTable{
+		Schema:       "__sys__",
+		Name:         "schema_version",
+		KeyColumns:   []string{"component"},
+		ValueColumns: []string{"version", "updated_at"},
+		DDL:          "component TEXT PRIMARY KEY, version TEXT, updated_at TIMESTAMPTZ",
+	},
+	// RewriteRules stores the rules that rewrite the incoming queries before they are parsed or transpiled,
+	// which are managed with plain DML on the table. See backend.QueryRewriter.
+	RewriteRules: InternalTable{
+		Schema:       "__sys__",
+		Name:         "query_rewrite_rules",
+		KeyColumns:   []string{"name"},
+		ValueColumns: []string{"protocol", "kind", "pattern", "replacement", "enabled", "hits", "last_hit_at"},
+		DDL: "name TEXT PRIMARY KEY, " + // The rules are applied in the order of their names
+			"protocol TEXT, " + // 'mysql', 'postgres', or NULL for both
+			"kind TEXT NOT NULL DEFAULT 'regex', " + // 'regex' or 'fingerprint'
+			"pattern TEXT NOT NULL, " +
+			"replacement TEXT NOT NULL, " +
+			"enabled BOOLEAN NOT NULL DEFAULT true, " +
+			"hits UBIGINT NOT NULL DEFAULT 0, " +
+			"last_hit_at TIMESTAMPTZ",
+	},
+	// RoleChanges records the switchovers of the server between the primary and the replica roles made by
+	// myduck.promote() and myduck.demote(). The last change is the current role.
+	RoleChanges: InternalTable{
+		Schema:       "__sys__",
+		Name:         "role_changes",
+		KeyColumns:   []string{"changed_at"},
+		ValueColumns: []string{"role", "subscriptions"},
+		DDL: "changed_at TIMESTAMPTZ PRIMARY KEY, " +
+			"role TEXT NOT NULL, " + // 'primary' or 'replica'
+			"subscriptions TEXT", // The subscriptions parked or resumed, separated by commas
+	},
+	// ForeignServers stores the servers created by CREATE SERVER, which are attached on startup.
+	ForeignServers: InternalTable{
+		Schema:       "__sys__",
+		Name:         "foreign_servers",
+		KeyColumns:   []string{"server_name"},
+		ValueColumns: []string{"wrapper", "options"},
+		DDL: "server_name TEXT PRIMARY KEY, " +
+			"wrapper TEXT NOT NULL, " + // 'postgres', 'mysql', 'sqlite', or 'parquet'
+			"options TEXT", // The options of CREATE SERVER in JSON
+	},
+	// ForeignTables stores the foreign tables created by CREATE FOREIGN TABLE, which are the views of the remote tables.
+	ForeignTables: InternalTable{
+		Schema:       "__sys__",
+		Name:         "foreign_tables",
+		KeyColumns:   []string{"schema_name", "table_name"},
+		ValueColumns: []string{"server_name", "remote"},
+		DDL: "schema_name TEXT, " +
+			"table_name TEXT, " +
+			"server_name TEXT NOT NULL, " +
+			"remote TEXT NOT NULL, " + // The remote table or file that the view reads
+			"PRIMARY KEY (schema_name, table_name)",
+	},
+	// Jobs stores the definitions of the background jobs, which are managed with plain DML on the table.
+	// See backend.JobScheduler.
+	Jobs: InternalTable{
+		Schema:       "__sys__",
+		Name:         "jobs",
+		KeyColumns:   []string{"name"},
+		ValueColumns: []string{"kind", "command", "interval_seconds", "enabled", "created_at"},
+		DDL: "name TEXT PRIMARY KEY, " +
+			"kind TEXT NOT NULL DEFAULT 'sql', " + // The kind of the job, e.g., 'sql'
+			"command TEXT, " + // The argument of the job, e.g., the statements of a job of kind 'sql'
+			"interval_seconds UBIGINT, " + // NULL if the job only runs on demand
+			"enabled BOOLEAN NOT NULL DEFAULT true, " +
+			"created_at TIMESTAMPTZ DEFAULT now()",
+	},
+	// JobRuns stores the recent runs of the background jobs, including the running ones.
+	JobRuns: InternalTable{
+		Schema:       "__sys__",
+		Name:         "job_runs",
+		KeyColumns:   []string{"run_id"},
+		ValueColumns: []string{"job_name", "started_at", "finished_at", "status", "message"},
+		DDL: "run_id UBIGINT PRIMARY KEY, " +
+			"job_name TEXT NOT NULL, " +
+			"started_at TIMESTAMPTZ NOT NULL, " +
+			"finished_at TIMESTAMPTZ, " +
+			"status TEXT NOT NULL, " + // 'running', 'succeeded', 'failed', 'canceled', or 'aborted'
+			"message TEXT", // The result or the error of the run
+	},
+	// MaskingPolicies stores the columns masked by CREATE MASKING POLICY. See CreateMaskingPolicy.
+	MaskingPolicies: InternalTable{
+		Schema:       "__sys__",
+		Name:         "masking_policies",
+		KeyColumns:   []string{"schema_name", "table_name", "column_name"},
+		ValueColumns: []string{"policy_name", "method"},
+		DDL: "schema_name TEXT, " +
+			"table_name TEXT, " +
+			"column_name TEXT, " +
+			"policy_name TEXT NOT NULL, " +
+			"method TEXT NOT NULL, " + // The masking method, e.g., 'email' or 'partial(2, 4)'
+			"PRIMARY KEY (schema_name, table_name, column_name)",
+	},
+	// UnmaskGrants stores the users granted the UNMASK privilege by GRANT UNMASK, who see the unmasked values.
+	UnmaskGrants: InternalTable{
+		Schema:       "__sys__",
+		Name:         "unmask_grants",
+		KeyColumns:   []string{"user_name"},
+		ValueColumns: []string{"granted_at"},
+		DDL:          "user_name TEXT PRIMARY KEY, granted_at TIMESTAMPTZ",
+	},
+	// RowSecurity stores the tables whose row-level security is enabled or forced. See SetRowSecurity.
+	RowSecurity: InternalTable{
+		Schema:       "__sys__",
+		Name:         "row_security",
+		KeyColumns:   []string{"schema_name", "table_name"},
+		ValueColumns: []string{"owner_name", "enabled", "forced"},
+		DDL: "schema_name TEXT, " +
+			"table_name TEXT, " +
+			"owner_name TEXT NOT NULL, " + // The user that enabled the row-level security first
+			"enabled BOOLEAN NOT NULL, " +
+			"forced BOOLEAN NOT NULL, " +
+			"PRIMARY KEY (schema_name, table_name)",
+	},
+	// RowSecurityPolicies stores the policies created by CREATE POLICY. See CreateRowSecurityPolicy.
+	RowSecurityPolicies: InternalTable{
+		Schema:       "__sys__",
+		Name:         "row_security_policies",
+		KeyColumns:   []string{"schema_name", "table_name", "policy_name"},
+		ValueColumns: []string{"permissive", "command", "roles", "qual", "with_check"},
+		DDL: "schema_name TEXT, " +
+			"table_name TEXT, " +
+			"policy_name TEXT, " +
+			"permissive BOOLEAN NOT NULL, " +
+			"command TEXT NOT NULL, " + // ALL, SELECT, INSERT, UPDATE, or DELETE
+			"roles TEXT NOT NULL, " + // The comma-separated roles, or 'public'
+			"qual TEXT, " + // The USING expression
+			"with_check TEXT, " + // The WITH CHECK expression
+			"PRIMARY KEY (schema_name, table_name, policy_name)",
+	},
+	// LakeSinks stores the lake sinks created by CREATE LAKE SINK, along with the state of the tables they maintain
+	// on the object storage. See backend.SyncLakeSink.
+	LakeSinks: InternalTable{
+		Schema:     "__sys__",
+		Name:       "lake_sinks",
+		KeyColumns: []string{"sink_name"},
+		ValueColumns: []string{"catalog_name", "schema_name", "table_name", "format", "location", "table_id",
+			"version", "files", "schema_string", "synced_rows", "synced_at", "created_at"},
+		DDL: "sink_name TEXT PRIMARY KEY, " +
+			"catalog_name TEXT NOT NULL, " +
+			"schema_name TEXT NOT NULL, " +
+			"table_name TEXT NOT NULL, " +
+			"format TEXT NOT NULL, " + // 'delta'
+			"location TEXT NOT NULL, " + // The directory of the table on the object storage, e.g., 's3://bucket/path'
+			"table_id TEXT NOT NULL, " + // The ID of the table in its metadata
+			"version BIGINT NOT NULL DEFAULT -1, " + // The version of the last commit, or -1 before the initial export
+			"files TEXT, " + // The data files of the current version, separated by commas
+			"schema_string TEXT, " + // The schema of the current version in the metadata
+			"synced_rows UBIGINT, " + // The number of the rows as of the last sync
+			"synced_at TIMESTAMPTZ, " +
+			"created_at TIMESTAMPTZ",
+	},
+	// Tenants stores the tenants created by CREATE TENANT and the result of the last check of their storage quotas.
+	// Only the table in the default catalog is used, see tenants.go.
+	Tenants: InternalTable{
+		Schema:       "__sys__",
+		Name:         "tenants",
+		KeyColumns:   []string{"tenant_name"},
+		ValueColumns: []string{"max_connections", "storage_quota", "checked_size", "checked_at", "over_quota", "created_at"},
+		DDL: "tenant_name TEXT PRIMARY KEY, " +
+			"max_connections INTEGER NOT NULL DEFAULT 0, " + // 0 for no limit
+			"storage_quota BIGINT NOT NULL DEFAULT 0, " + // In bytes, 0 for no limit
+			"checked_size BIGINT, " + // The size of the files of the tenant in bytes at the last check
+			"checked_at TIMESTAMPTZ, " +
+			"over_quota BOOLEAN NOT NULL DEFAULT FALSE, " +
+			"created_at TIMESTAMPTZ",
+	},
+	// TenantGrants stores the users granted access to the tenants by GRANT CONNECT ON DATABASE.
+	// Only the table in the default catalog is used, see tenants.go.
+	TenantGrants: InternalTable{
+		Schema:       "__sys__",
+		Name:         "tenant_grants",
+		KeyColumns:   []string{"tenant_name", "user_name"},
+		ValueColumns: []string{"granted_at"},
+		DDL: "tenant_name TEXT, " +
+			"user_name TEXT, " +
+			"granted_at TIMESTAMPTZ, " +
+			"PRIMARY KEY (tenant_name, user_name)",
+	},
+	// AdminGrants stores the administrative privileges granted by GRANT REPLICATION and GRANT ADMIN.
+	// Only the table in the default catalog is used, see admin_privileges.go.
+	AdminGrants: InternalTable{
+		Schema:       "__sys__",
+		Name:         "admin_grants",
+		KeyColumns:   []string{"user_name", "privilege"},
+		ValueColumns: []string{"granted_by", "granted_at"},
+		DDL: "user_name TEXT, " +
+			"privilege TEXT, " + // 'REPLICATION' or 'ADMIN'
+			"granted_by TEXT, " +
+			"granted_at TIMESTAMPTZ, " +
+			"PRIMARY KEY (user_name, privilege)",
+	},
+	// AdminAuditLog stores the uses of the administrative privileges, whether they were allowed or not.
+	// Only the table in the default catalog is used, see admin_privileges.go.
+	AdminAuditLog: InternalTable{
+		Schema:       "__sys__",
+		Name:         "admin_audit_log",
+		KeyColumns:   []string{"occurred_at", "connection_id"},
+		ValueColumns: []string{"user_name", "address", "privilege", "statement", "allowed", "error"},
+		DDL: "occurred_at TIMESTAMPTZ, " +
+			"connection_id UINTEGER, " +
+			"user_name TEXT, " +
+			"address TEXT, " + // The address of the client
+			"privilege TEXT NOT NULL, " + // The privilege required by the statement
+			"statement TEXT NOT NULL, " + // The statement with its credentials redacted
+			"allowed BOOLEAN NOT NULL, " + // Whether the user had the privilege
+			"error TEXT, " + // NULL if the statement succeeded
+			"PRIMARY KEY (occurred_at, connection_id)",
+	},
 }
 
 var internalTables = []InternalTable{
 	InternalTables.PersistentVariable,
 	InternalTables.BinlogPosition,
+	InternalTables.ReplicaSourceInfo,
 	InternalTables.PgSubscription,
+	InternalTables.PgSubscriptionRel,
 	InternalTables.GlobalStatus,
 	InternalTables.PGStatReplication,
 	InternalTables.PGRange,
@@ -669,8 +1117,58 @@ var internalTables = []InternalTable{
 	InternalTables.PGClass,
 	InternalTables.PGNamespace,
 	InternalTables.PGMatViews,
+	InternalTables.QueryProfiles,
+	InternalTables.HistoryTables,
+	InternalTables.TTLTables,
+	InternalTables.TableChurn,
+	InternalTables.RowTransforms,
+	InternalTables.FTSIndexes,
+	InternalTables.UserTypes,
+	InternalTables.PGEnum,
+	InternalTables.SequenceOwners,
+	InternalTables.BackupHistory,
+	InternalTables.SchemaVersion,
+	InternalTables.RewriteRules,
+	InternalTables.RoleChanges,
+	InternalTables.ForeignServers,
+	InternalTables.ForeignTables,
+	InternalTables.Jobs,
+	InternalTables.JobRuns,
+	InternalTables.MaskingPolicies,
+	InternalTables.UnmaskGrants,
+	InternalTables.RowSecurity,
+	InternalTables.RowSecurityPolicies,
+	InternalTables.LakeSinks,
+	InternalTables.Tenants,
+	InternalTables.TenantGrants,
+	InternalTables.AdminGrants,
+	InternalTables.AdminAuditLog,
+}
+
+// ProtectedInternalTables are the internal tables of the masking policies, the grants of the privileges, and
+// the uses of the privileges, which are changed only by the statements that manage the policies and grant, revoke,
+// and use the privileges, rather than directly by the users.
+var ProtectedInternalTables = []InternalTable{
+	InternalTables.MaskingPolicies,
+	InternalTables.UnmaskGrants,
+	InternalTables.TenantGrants,
+	InternalTables.AdminGrants,
+	InternalTables.AdminAuditLog,
+}
+
+// IsProtectedInternalTable reports whether the table is one of ProtectedInternalTables, case-insensitively.
+func IsProtectedInternalTable(schema, name string) bool {
+	for _, t := range ProtectedInternalTables {
+		if strings.EqualFold(schema, t.Schema) && strings.EqualFold(name, t.Name) {
+			return true
+		}
+	}
+	return false
 }
 
+// GetInternalTables returns the internal tables, including the ones of the extensions, see RegisterInternalExtension.
 func GetInternalTables() []InternalTable {
-	return internalTables
+	internalExtensions.Lock()
+	defer internalExtensions.Unlock()
+	return allInternalTables()
 }
@@ -11,6 +11,37 @@ func (v *InternalView) QualifiedName() string {
 }
 
 var InternalViews = []InternalView{
+	{
+		Schema: "__sys__",
+		Name:   "myduck_database_mapping",
+		DDL:    databaseMappingViewDDL(),
+	},
+	{
+		Schema: "__sys__",
+		Name:   "pg_database",
+		DDL: `SELECT
+    database_oid AS oid,                           -- OID of the catalog
+    database_name AS datname,                      -- Every attached DuckDB catalog is a PostgreSQL database
+    10 AS datdba,                                  -- OID of the bootstrap superuser
+    6 AS encoding,                                 -- UTF8
+    'c' AS datlocprovider,                         -- libc
+    FALSE AS datistemplate,                        -- There are no template databases
+    TRUE AS datallowconn,                          -- Any catalog can be connected to
+    -1 AS datconnlimit,                            -- No limit
+    0 AS datfrozenxid,                             -- Placeholder
+    0 AS datminmxid,                               -- Placeholder
+    1663 AS dattablespace,                         -- pg_default
+    'en_US.UTF-8' AS datcollate,                   -- Collation
+    'en_US.UTF-8' AS datctype,                     -- Character classification
+    NULL AS datlocale,                             -- Placeholder
+    NULL AS daticurules,                           -- Placeholder
+    NULL AS datcollversion,                        -- Placeholder
+    NULL AS datacl                                 -- Default privileges
+FROM
+    duckdb_databases()
+WHERE
+    NOT internal;                                  -- Exclude the system and temp catalogs`,
+	},
 	{
 		Schema: "__sys__",
 		Name:   "pg_stat_user_tables",
@@ -45,6 +76,35 @@ FROM
     information_schema.tables t
 WHERE
     t.table_type = 'BASE TABLE'; -- Include only base tables (not views)`,
+	},
+	{
+		Schema: "information_schema",
+		Name:   "sequences",
+		DDL: `SELECT
+    database_name AS sequence_catalog,             -- Catalog of the sequence
+    schema_name AS sequence_schema,                -- Schema of the sequence
+    sequence_name,                                 -- Name of the sequence
+    CASE max_value                                 -- DuckDB sequences are BIGINT, but the bounds tell
+        WHEN 32767 THEN 'smallint'                 -- the types of the serial columns
+        WHEN 2147483647 THEN 'integer'
+        ELSE 'bigint'
+    END AS data_type,
+    CASE max_value
+        WHEN 32767 THEN 16
+        WHEN 2147483647 THEN 32
+        ELSE 64
+    END AS numeric_precision,
+    2 AS numeric_precision_radix,                  -- Binary precision
+    0 AS numeric_scale,                            -- Integers
+    start_value::VARCHAR AS start_value,           -- The values are character data in Postgres
+    min_value::VARCHAR AS minimum_value,
+    max_value::VARCHAR AS maximum_value,
+    increment_by::VARCHAR AS increment,
+    CASE WHEN cycle THEN 'YES' ELSE 'NO' END AS cycle_option
+FROM
+    duckdb_sequences()
+WHERE
+    NOT temporary;                                 -- Temporary sequences are not listed`,
 	},
 	{
 		Schema: "__sys__",
@@ -85,4 +145,128 @@ GROUP BY
 ORDER BY
     t.table_oid;`,
 	},
+	{
+		Schema: "__sys__",
+		Name:   "pg_proc",
+		DDL:    pgProcViewDDL(),
+	},
+	{
+		Schema: "__sys__",
+		Name:   "pg_policies",
+		DDL: `SELECT
+    schema_name AS schemaname,                     -- Schema of the table
+    table_name AS tablename,                       -- Table of the policy
+    policy_name AS policyname,                     -- Name of the policy
+    CASE WHEN permissive THEN 'PERMISSIVE' ELSE 'RESTRICTIVE' END AS permissive,
+    string_split(roles, ',') AS roles,             -- Roles to which the policy applies
+    command AS cmd,                                -- Command to which the policy applies
+    qual,                                          -- USING expression
+    with_check                                     -- WITH CHECK expression
+FROM
+    __sys__.row_security_policies;`,
+	},
+	{
+		Schema: "__sys__",
+		Name:   "myduck_lake_sinks",
+		DDL: `SELECT
+    s.sink_name,                                   -- Name of the sink
+    s.schema_name,                                 -- Schema of the synced table
+    s.table_name,                                  -- Synced table
+    s.format,                                      -- Format of the table on the object storage
+    s.location,                                    -- Directory of the table on the object storage
+    s.version,                                     -- Version of the last commit, -1 before the initial export
+    CASE WHEN coalesce(s.files, '') = '' THEN 0 ELSE len(string_split(s.files, ',')) END AS files,
+                                                   -- Number of the data files of the current version
+    s.synced_rows,                                 -- Number of the rows as of the last sync
+    s.synced_at,                                   -- Time of the last sync that committed or found no changes
+    j.interval_seconds,                            -- Interval between the syncs, NULL if synced on demand only
+    j.enabled,                                     -- Whether the sink is synced periodically
+    r.started_at AS last_run_at,                   -- Start of the last sync
+    r.status AS last_run_status,                   -- Status of the last sync, e.g., 'succeeded' or 'failed'
+    r.message AS last_run_message                  -- Result or error of the last sync
+FROM
+    __sys__.lake_sinks s
+    LEFT JOIN __sys__.jobs j ON j.name = 'lake_sink:' || s.sink_name
+    LEFT JOIN (
+        SELECT job_name, started_at, status, message,
+               row_number() OVER (PARTITION BY job_name ORDER BY run_id DESC) AS n
+        FROM __sys__.job_runs
+    ) r ON r.job_name = j.name AND r.n = 1;`,
+	},
+	{
+		Schema: "__sys__",
+		Name:   QueryProfilesView,
+		// The superusers read all of the profiles, and the other users read their own ones only,
+		// which the handlers enforce, see QueryProfileRelations.
+		DDL: `SELECT
+    query_id,                                      -- ID of the query
+    connection_id,                                 -- Connection of the session that ran the query
+    query,                                         -- Text of the query
+    started_at,                                    -- Start of the query
+    latency_ms,                                    -- Latency of the query in milliseconds
+    plan,                                          -- Profile tree in JSON format
+    user_name                                      -- User of the session
+FROM
+    __sys__.query_profile_log;`,
+	},
+	{
+		Schema: "__sys__",
+		Name:   "table_sizes",
+		// The sizes are estimated from the row counts of the tables and the widths of the types of the columns,
+		// since the sizes of the blocks of a table are only available from pragma_storage_info, one table at a time.
+		// The compression of DuckDB usually makes the files much smaller than the estimates.
+		DDL: `WITH column_widths AS (
+    SELECT database_name, schema_name, table_name, column_name,
+        CASE
+            WHEN data_type IN ('BOOLEAN', 'TINYINT', 'UTINYINT') THEN 1
+            WHEN data_type IN ('SMALLINT', 'USMALLINT') THEN 2
+            WHEN data_type IN ('INTEGER', 'UINTEGER', 'FLOAT', 'DATE') THEN 4
+            WHEN data_type IN ('BIGINT', 'UBIGINT', 'DOUBLE', 'TIME', 'TIME WITH TIME ZONE') OR data_type LIKE 'TIMESTAMP%' THEN 8
+            WHEN data_type LIKE 'DECIMAL%' THEN
+                CASE WHEN numeric_precision <= 4 THEN 2 WHEN numeric_precision <= 9 THEN 4 WHEN numeric_precision <= 18 THEN 8 ELSE 16 END
+            ELSE 16                                -- The 16-byte values, and the headers of the strings and the nested values
+        END AS width
+    FROM duckdb_columns()
+    WHERE NOT internal
+), row_widths AS (
+    SELECT database_name, schema_name, table_name, sum(width) AS width
+    FROM column_widths
+    GROUP BY ALL
+), index_keys AS (
+    -- The key columns of the indexes, and of the primary keys and the unique constraints, which are indexed too
+    SELECT x.database_name, x.schema_name, x.table_name, k.expression
+    FROM duckdb_indexes() x, unnest(string_split(x.expressions[2:-2], ', ')) AS k(expression)
+    UNION ALL
+    SELECT c.database_name, c.schema_name, c.table_name, k.expression
+    FROM duckdb_constraints() c, unnest(c.constraint_column_names) AS k(expression)
+    WHERE c.constraint_type IN ('PRIMARY KEY', 'UNIQUE')
+), index_widths AS (
+    -- Each key of an index takes its width and the 8-byte row ID; the expressions are taken as 16 bytes
+    SELECT k.database_name, k.schema_name, k.table_name, sum(coalesce(c.width, 16) + 8) AS width
+    FROM index_keys k
+    LEFT JOIN column_widths c
+        ON c.database_name = k.database_name AND c.schema_name = k.schema_name AND c.table_name = k.table_name
+        AND (c.column_name = k.expression OR '"' || replace(c.column_name, '"', '""') || '"' = k.expression)
+    GROUP BY ALL
+)
+SELECT
+    t.database_name,                               -- Catalog of the table, i.e., the PostgreSQL database
+    t.schema_name,                                 -- Schema of the table, i.e., the MySQL database
+    t.table_name,                                  -- Name of the table
+    t.estimated_size AS estimated_rows,            -- Estimated number of the rows
+    t.column_count,                                -- Number of the columns
+    t.index_count,                                 -- Number of the indexes, including those of the constraints
+    (t.estimated_size * coalesce(r.width, 0))::BIGINT AS estimated_data_size,
+                                                   -- Estimated size of the uncompressed rows in bytes
+    (t.estimated_size * coalesce(i.width, 0))::BIGINT AS estimated_index_size,
+                                                   -- Estimated size of the indexes in bytes
+    (t.estimated_size * (coalesce(r.width, 0) + coalesce(i.width, 0)))::BIGINT AS estimated_total_size
+                                                   -- Sum of the estimated sizes of the rows and the indexes
+FROM
+    duckdb_tables() t
+    LEFT JOIN row_widths r USING (database_name, schema_name, table_name)
+    LEFT JOIN index_widths i USING (database_name, schema_name, table_name)
+WHERE
+    NOT t.internal AND NOT t.temporary;`,
+	},
 }
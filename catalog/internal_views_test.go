@@ -0,0 +1,41 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableSizesView(t *testing.T) {
+	db := newMigrationTestDB(t)
+	for _, v := range InternalViews {
+		if v.Name == "table_sizes" {
+			_, err := db.Exec("CREATE VIEW " + v.QualifiedName() + " AS " + v.DDL)
+			require.NoError(t, err)
+		}
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE t (id INTEGER PRIMARY KEY, name VARCHAR, amount DECIMAL(10, 2), "Ref Id" BIGINT UNIQUE)`,
+		`CREATE INDEX t_name ON t (name)`,
+		`INSERT INTO t SELECT range, 'name' || range, 1, range FROM range(1000)`,
+		`CREATE TABLE empty (b BOOLEAN)`,
+	} {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	var rows, columns, indexes, data, index, total int64
+	require.NoError(t, db.QueryRow("SELECT estimated_rows, column_count, index_count, estimated_data_size, estimated_index_size, estimated_total_size "+
+		"FROM __sys__.table_sizes WHERE schema_name = 'main' AND table_name = 't'").Scan(&rows, &columns, &indexes, &data, &index, &total))
+	require.EqualValues(t, 1000, rows)
+	require.EqualValues(t, 4, columns)
+	require.EqualValues(t, 3, indexes)
+	// INTEGER + VARCHAR + DECIMAL(10, 2) + BIGINT.
+	require.EqualValues(t, 1000*(4+16+8+8), data)
+	// The primary key, the unique constraint, and the index, each with the row IDs.
+	require.EqualValues(t, 1000*((4+8)+(8+8)+(16+8)), index)
+	require.Equal(t, data+index, total)
+
+	require.NoError(t, db.QueryRow("SELECT estimated_total_size FROM __sys__.table_sizes WHERE table_name = 'empty'").Scan(&total))
+	require.Zero(t, total)
+}
@@ -0,0 +1,337 @@
+package catalog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The masking policies hide the values of the columns in the results of the users without the UNMASK privilege,
+// e.g., when a replica is shared with analysts. A policy masks the columns of a table or a view with a method:
+//
+//   - `null` returns NULL.
+//   - `redact` returns '****', which hides the length of the value as well.
+//   - `email` keeps the first character of the local part and the domain, e.g., 'a****@example.com'.
+//   - `partial(p, s)` keeps the first p and the last s characters, e.g., partial(0, 4) of a card number.
+//   - `hash` returns the SHA-256 of the value in hex, which still allows counting and joining the values.
+//
+// The methods other than `null` apply to the strings only; the values of the other types are returned as NULL.
+// The policies and the users granted UNMASK are registered in InternalTables.MaskingPolicies and
+// InternalTables.UnmaskGrants, whose contents are cached until they are changed by the functions of this file.
+// The policies are bound to the names of the columns, so they are kept when a table is dropped and recreated.
+
+// Masking methods.
+const (
+	MaskNull    = "null"
+	MaskRedact  = "redact"
+	MaskEmail   = "email"
+	MaskPartial = "partial"
+	MaskHash    = "hash"
+)
+
+// MaskingPolicy masks a column of a table or a view.
+type MaskingPolicy struct {
+	Name   string
+	Schema string
+	Table  string
+	Column string
+	// Method is the canonical masking method, e.g., `partial(2, 4)`.
+	Method string
+}
+
+var maskPartialRegex = regexp.MustCompile(`(?i)^partial\s*\(\s*(\d+)\s*,\s*(\d+)\s*\)$`)
+
+// ParseMaskingMethod returns the canonical form of a masking method and the function that masks the values.
+func ParseMaskingMethod(method string) (string, func(any) any, error) {
+	method = strings.TrimSpace(method)
+	switch lower := strings.ToLower(method); lower {
+	case MaskNull:
+		return lower, func(any) any { return nil }, nil
+	case MaskRedact:
+		return lower, maskStrings(func(string) string { return "****" }), nil
+	case MaskEmail:
+		return lower, maskStrings(maskEmail), nil
+	case MaskHash:
+		return lower, maskStrings(func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}), nil
+	}
+	if m := maskPartialRegex.FindStringSubmatch(method); m != nil {
+		prefix, err1 := strconv.Atoi(m[1])
+		suffix, err2 := strconv.Atoi(m[2])
+		if err1 == nil && err2 == nil {
+			return fmt.Sprintf("%s(%d, %d)", MaskPartial, prefix, suffix),
+				maskStrings(func(s string) string { return maskPartial(s, prefix, suffix) }), nil
+		}
+	}
+	return "", nil, fmt.Errorf("unknown masking method %q", method)
+}
+
+// maskStrings returns the function that masks the strings with fn, and nulls the values of the other types.
+func maskStrings(fn func(string) string) func(any) any {
+	return func(v any) any {
+		switch v := v.(type) {
+		case string:
+			return fn(v)
+		case []byte:
+			return []byte(fn(string(v)))
+		}
+		return nil
+	}
+}
+
+// maskPartial keeps the first prefix and the last suffix characters of s, replacing the others with '*'.
+// All characters are replaced if s is not longer than the kept ones.
+func maskPartial(s string, prefix, suffix int) string {
+	r := []rune(s)
+	if len(r) <= prefix+suffix {
+		return strings.Repeat("*", len(r))
+	}
+	return string(r[:prefix]) + strings.Repeat("*", len(r)-prefix-suffix) + string(r[len(r)-suffix:])
+}
+
+func maskEmail(s string) string {
+	at := strings.LastIndexByte(s, '@')
+	if at < 0 {
+		return maskPartial(s, 0, 0)
+	}
+	return maskPartial(s[:at], 1, 0) + s[at:]
+}
+
+// masking is the cached contents of the internal tables of the masking policies.
+type masking struct {
+	// policies are the policies by the lower-cased schema, table, and column.
+	policies map[[3]string]*MaskingPolicy
+	masks    map[[3]string]func(any) any
+	// unmasked are the users granted UNMASK.
+	unmasked map[string]struct{}
+}
+
+var cachedMasking atomic.Pointer[masking]
+
+func maskingKey(schema, table, column string) [3]string {
+	return [3]string{strings.ToLower(schema), strings.ToLower(table), strings.ToLower(column)}
+}
+
+func loadMasking(ctx *sql.Context) (*masking, error) {
+	if m := cachedMasking.Load(); m != nil {
+		return m, nil
+	}
+	m := &masking{
+		policies: make(map[[3]string]*MaskingPolicy),
+		masks:    make(map[[3]string]func(any) any),
+		unmasked: make(map[string]struct{}),
+	}
+	rows, err := adapter.QueryCatalog(ctx, "SELECT policy_name, schema_name, table_name, column_name, method FROM "+
+		InternalTables.MaskingPolicies.QualifiedName())
+	if err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p := &MaskingPolicy{}
+		if err := rows.Scan(&p.Name, &p.Schema, &p.Table, &p.Column, &p.Method); err != nil {
+			return nil, ErrDuckDB.New(err)
+		}
+		_, mask, err := ParseMaskingMethod(p.Method)
+		if err != nil {
+			// A method that cannot be parsed hides the values entirely.
+			mask = func(any) any { return nil }
+		}
+		key := maskingKey(p.Schema, p.Table, p.Column)
+		m.policies[key], m.masks[key] = p, mask
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+
+	grants, err := adapter.QueryCatalog(ctx, "SELECT user_name FROM "+InternalTables.UnmaskGrants.QualifiedName())
+	if err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+	defer grants.Close()
+	for grants.Next() {
+		var user string
+		if err := grants.Scan(&user); err != nil {
+			return nil, ErrDuckDB.New(err)
+		}
+		m.unmasked[user] = struct{}{}
+	}
+	if err := grants.Err(); err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+
+	cachedMasking.Store(m)
+	return m, nil
+}
+
+// Masking is the set of the masking policies that apply to a session.
+type Masking struct {
+	m *masking
+}
+
+// SessionMasking returns the masking policies that apply to the user of the session,
+// or nil if there are none, or if the user is granted UNMASK.
+func SessionMasking(ctx *sql.Context) (*Masking, error) {
+	m, err := loadMasking(ctx)
+	if err != nil || len(m.policies) == 0 {
+		return nil, err
+	}
+	if _, ok := m.unmasked[ctx.Session.Client().User]; ok {
+		return nil, nil
+	}
+	return &Masking{m: m}, nil
+}
+
+// Mask returns the function that masks the values of the column, or nil if the column is not masked.
+func (m *Masking) Mask(schema, table, column string) func(any) any {
+	return m.m.masks[maskingKey(schema, table, column)]
+}
+
+// IsMaskedTable reports whether any column of the table is masked.
+func (m *Masking) IsMaskedTable(schema, table string) bool {
+	schema, table = strings.ToLower(schema), strings.ToLower(table)
+	for key := range m.m.policies {
+		if key[0] == schema && key[1] == table {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskedTables returns the lower-cased schemas and names of the masked tables and views.
+func (m *Masking) MaskedTables() [][2]string {
+	seen := make(map[[2]string]struct{})
+	var tables [][2]string
+	for key := range m.m.policies {
+		table := [2]string{key[0], key[1]}
+		if _, ok := seen[table]; !ok {
+			seen[table] = struct{}{}
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// TableMasks returns the functions that mask the columns of the table by the lower-cased names of the columns.
+func (m *Masking) TableMasks(schema, table string) map[string]func(any) any {
+	schema, table = strings.ToLower(schema), strings.ToLower(table)
+	masks := make(map[string]func(any) any)
+	for key, mask := range m.m.masks {
+		if key[0] == schema && key[1] == table {
+			masks[key[2]] = mask
+		}
+	}
+	return masks
+}
+
+// CreateMaskingPolicy creates a policy that masks the columns of a table or a view.
+// An existing policy of the same name is replaced if orReplace is true.
+func CreateMaskingPolicy(ctx *sql.Context, name, schema, table string, columns []string, method string, orReplace bool) error {
+	canonical, _, err := ParseMaskingMethod(method)
+	if err != nil {
+		return err
+	}
+	exists, err := maskingPolicyExists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if exists && !orReplace {
+		return fmt.Errorf("masking policy %q already exists", name)
+	}
+
+	// The columns are recorded by their names in the catalog.
+	rows, err := adapter.QueryCatalog(ctx, "SELECT column_name FROM information_schema.columns WHERE table_catalog = current_database() AND table_schema = ? AND table_name = ?", schema, table)
+	if err != nil {
+		return ErrDuckDB.New(err)
+	}
+	var existing []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			rows.Close()
+			return ErrDuckDB.New(err)
+		}
+		existing = append(existing, column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	if len(existing) == 0 {
+		return sql.ErrTableNotFound.New(table)
+	}
+	resolved := make([]string, len(columns))
+	for i, column := range columns {
+		for _, c := range existing {
+			if strings.EqualFold(c, column) {
+				resolved[i] = c
+				break
+			}
+		}
+		if resolved[i] == "" {
+			return sql.ErrColumnNotFound.New(column)
+		}
+	}
+
+	defer cachedMasking.Store(nil)
+	if exists {
+		if _, err := adapter.ExecCatalog(ctx, "DELETE FROM "+InternalTables.MaskingPolicies.QualifiedName()+" WHERE policy_name = ?", name); err != nil {
+			return ErrDuckDB.New(err)
+		}
+	}
+	for _, column := range resolved {
+		if _, err := adapter.ExecCatalog(ctx, InternalTables.MaskingPolicies.UpsertStmt(), schema, table, column, name, canonical); err != nil {
+			return ErrDuckDB.New(err)
+		}
+	}
+	return nil
+}
+
+// DropMaskingPolicy drops a policy, and returns false if it does not exist.
+func DropMaskingPolicy(ctx *sql.Context, name string) (bool, error) {
+	defer cachedMasking.Store(nil)
+	res, err := adapter.ExecCatalog(ctx, "DELETE FROM "+InternalTables.MaskingPolicies.QualifiedName()+" WHERE policy_name = ?", name)
+	if err != nil {
+		return false, ErrDuckDB.New(err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func maskingPolicyExists(ctx *sql.Context, name string) (bool, error) {
+	var n int
+	if err := adapter.QueryRowCatalog(ctx, "SELECT count(*) FROM "+InternalTables.MaskingPolicies.QualifiedName()+" WHERE policy_name = ?", name).Scan(&n); err != nil {
+		return false, ErrDuckDB.New(err)
+	}
+	return n > 0, nil
+}
+
+// GrantUnmask grants the UNMASK privilege to a user, who sees the unmasked values from the next query on.
+func GrantUnmask(ctx *sql.Context, user string) error {
+	defer cachedMasking.Store(nil)
+	if _, err := adapter.ExecCatalog(ctx, InternalTables.UnmaskGrants.UpsertStmt(), user, time.Now()); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// RevokeUnmask revokes the UNMASK privilege from a user, and returns false if the user was not granted it.
+func RevokeUnmask(ctx *sql.Context, user string) (bool, error) {
+	defer cachedMasking.Store(nil)
+	res, err := adapter.ExecCatalog(ctx, InternalTables.UnmaskGrants.DeleteStmt(), user)
+	if err != nil {
+		return false, ErrDuckDB.New(err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
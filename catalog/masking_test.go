@@ -0,0 +1,42 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMaskingMethod(t *testing.T) {
+	for method, expected := range map[string][2]any{
+		"NULL":              {"null", nil},
+		"redact":            {"redact", "****"},
+		"email":             {"email", "j*******@example.com"},
+		"partial(0, 4)":     {"partial(0, 4)", "****************.com"},
+		" Partial( 2 ,3 ) ": {"partial(2, 3)", "jo***************com"},
+	} {
+		canonical, mask, err := ParseMaskingMethod(method)
+		require.NoError(t, err, method)
+		require.Equal(t, expected[0], canonical, method)
+		require.Equal(t, expected[1], mask("john.doe@example.com"), method)
+	}
+
+	_, mask, err := ParseMaskingMethod("partial(2, 2)")
+	require.NoError(t, err)
+	require.Equal(t, "***", mask("abc"))
+	require.Equal(t, []byte("ab**ef"), mask([]byte("abcdef")))
+	require.Nil(t, mask(int64(42)))
+
+	_, mask, err = ParseMaskingMethod("email")
+	require.NoError(t, err)
+	require.Equal(t, "*****", mask("alice"))
+
+	_, mask, err = ParseMaskingMethod("hash")
+	require.NoError(t, err)
+	require.Len(t, mask("secret"), 64)
+	require.Equal(t, mask("secret"), mask("secret"))
+
+	for _, method := range []string{"", "shuffle", "partial(1)", "partial(-1, 2)"} {
+		_, _, err := ParseMaskingMethod(method)
+		require.Error(t, err, method)
+	}
+}
@@ -0,0 +1,283 @@
+package catalog
+
+import (
+	"context"
+	"crypto/sha256"
+	stdsql "database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The internal objects of a catalog are created when the catalog is created,
+// so a catalog created by an older version is upgraded when it is opened by a newer version:
+//
+//   - The internal tables are created if they do not exist, and changed by the CatalogMigrations.
+//   - The internal views and macros are recreated if their definitions have changed.
+//
+// The state of the upgrade is recorded in the schema_version internal table, one row per component.
+
+const (
+	// schemaVersionMigrations is the component whose version is the version of the last applied CatalogMigration.
+	schemaVersionMigrations = "migrations"
+	// schemaVersionInternalObjects is the component whose version is the checksum of the internal views and macros.
+	schemaVersionInternalObjects = "internal_objects"
+)
+
+// CatalogMigration is an up-migration of the internal objects of a catalog.
+// The migrations are applied in order, each in a transaction of its own, and never rolled back.
+// Up must be idempotent: the internal tables have been created by the current version when it runs,
+// and it may run again if the server crashes before its version is recorded.
+type CatalogMigration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, tx *stdsql.Tx) error
+}
+
+// CatalogMigrations are the migrations of the internal objects, in ascending order of version.
+// Append a migration here to change an internal table that may already exist in the data directory.
+var CatalogMigrations = []CatalogMigration{
+	{
+		Version:     1,
+		Description: "baseline: the internal tables are created by initCatalog",
+	},
+	{
+		Version:     2,
+		Description: "add the target schema of the Postgres subscriptions",
+		Up: func(ctx context.Context, tx *stdsql.Tx) error {
+			_, err := tx.ExecContext(ctx, "ALTER TABLE __sys__.pg_subscription ADD COLUMN IF NOT EXISTS subschema TEXT")
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "add the schema mapping of the Postgres subscriptions",
+		Up: func(ctx context.Context, tx *stdsql.Tx) error {
+			_, err := tx.ExecContext(ctx, "ALTER TABLE __sys__.pg_subscription ADD COLUMN IF NOT EXISTS subschemamapping TEXT")
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "replace the pg_proc table with the view of the built-in and the DuckDB functions",
+		Up: func(ctx context.Context, tx *stdsql.Tx) error {
+			// The built-in functions have been loaded into pg_proc_builtin, and the view is created afterward.
+			if exists, err := internalTableExists(ctx, tx, "__sys__", "pg_proc"); err != nil || !exists {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "DROP TABLE __sys__.pg_proc")
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "add the user of the query profiles",
+		Up: func(ctx context.Context, tx *stdsql.Tx) error {
+			// The table has been renamed since, see migration 8.
+			if exists, err := internalTableExists(ctx, tx, "__sys__", "query_profiles"); err != nil || !exists {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "ALTER TABLE __sys__.query_profiles ADD COLUMN IF NOT EXISTS user_name TEXT")
+			return err
+		},
+	},
+	{
+		Version:     6,
+		Description: "add the replication slot of the Postgres subscriptions",
+		Up: func(ctx context.Context, tx *stdsql.Tx) error {
+			_, err := tx.ExecContext(ctx, "ALTER TABLE __sys__.pg_subscription ADD COLUMN IF NOT EXISTS subslotname TEXT")
+			return err
+		},
+	},
+	{
+		Version:     7,
+		Description: "add the staleness of the full-text indexes",
+		Up: func(ctx context.Context, tx *stdsql.Tx) error {
+			_, err := tx.ExecContext(ctx, "ALTER TABLE __sys__.fts_indexes ADD COLUMN IF NOT EXISTS stale BOOLEAN DEFAULT false")
+			return err
+		},
+	},
+	{
+		Version:     8,
+		Description: "replace the query_profiles table with the view of the profiles of the user of the session",
+		Up: func(ctx context.Context, tx *stdsql.Tx) error {
+			// The profiles have been moved into query_profile_log, and the view is created afterward.
+			if exists, err := internalTableExists(ctx, tx, "__sys__", "query_profiles"); err != nil || !exists {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO "+InternalTables.QueryProfiles.QualifiedName()+
+				" SELECT query_id, connection_id, query, started_at, latency_ms, plan, user_name FROM __sys__.query_profiles"); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "DROP TABLE __sys__.query_profiles")
+			return err
+		},
+	},
+	{
+		Version:     9,
+		Description: "create the sequence of the OIDs of the user-defined types and sequences",
+		Up: func(ctx context.Context, tx *stdsql.Tx) error {
+			// The sequence starts after the OIDs assigned before it existed.
+			var start int64
+			if err := tx.QueryRowContext(ctx,
+				"SELECT greatest(coalesce(max(oid) + 1, 0), ?) FROM (SELECT oid FROM "+InternalTables.PGType.QualifiedName()+
+					" UNION ALL SELECT oid FROM "+InternalTables.PGEnum.QualifiedName()+
+					" UNION ALL SELECT oid FROM "+InternalTables.PGClass.QualifiedName()+")",
+				FirstUserObjectOID,
+			).Scan(&start); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "CREATE SEQUENCE IF NOT EXISTS "+objectOIDSequence+" START WITH "+strconv.FormatInt(start, 10))
+			return err
+		},
+	},
+}
+
+// internalTableExists reports whether a table exists in the internal schema of the current catalog.
+func internalTableExists(ctx context.Context, tx *stdsql.Tx, schema, table string) (bool, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, "SELECT count(*) FROM duckdb_tables() WHERE database_name = current_database()"+
+		" AND schema_name = ? AND table_name = ?", schema, table).Scan(&n)
+	return n > 0, err
+}
+
+// migrateCatalog applies the migrations newer than the schema version of the current catalog.
+func migrateCatalog(ctx context.Context, db *stdsql.DB, migrations []CatalogMigration) error {
+	return migrateComponent(ctx, db, schemaVersionMigrations, migrations)
+}
+
+// migrateComponent applies the migrations newer than the recorded version of the component,
+// i.e., the built-in internal tables or the tables of an internal extension.
+func migrateComponent(ctx context.Context, db *stdsql.DB, component string, migrations []CatalogMigration) error {
+	current, err := schemaVersion(ctx, db, component)
+	if err != nil {
+		return err
+	}
+	version := 0
+	if current != "" {
+		if version, err = strconv.Atoi(current); err != nil {
+			return fmt.Errorf("invalid schema version %q of %s: %w", current, component, err)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		logrus.Infof("Applying catalog migration %d of %s: %s", m.Version, component, m.Description)
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if m.Up != nil {
+			if err := m.Up(ctx, tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to apply catalog migration %d of %s (%s): %w", m.Version, component, m.Description, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, InternalTables.SchemaVersion.UpsertStmt(),
+			component, strconv.Itoa(m.Version), time.Now(),
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		version = m.Version
+	}
+	return nil
+}
+
+// createInternalObjects creates the internal views and macros of the current catalog.
+// They are replaced if their definitions have changed since they were created.
+func createInternalObjects(ctx context.Context, db *stdsql.DB) error {
+	checksum := internalObjectsChecksum()
+	recorded, err := schemaVersion(ctx, db, schemaVersionInternalObjects)
+	if err != nil {
+		return err
+	}
+	replace := recorded != checksum
+	if replace && recorded != "" {
+		logrus.Infoln("Recreating the internal views and macros, whose definitions have changed")
+	}
+
+	for _, v := range allInternalViews() {
+		if _, err := db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+v.Schema); err != nil {
+			return fmt.Errorf("failed to create internal schema %q: %w", v.Schema, err)
+		}
+		if _, err := db.ExecContext(ctx, createInternalViewStmt(v, replace)); err != nil {
+			return fmt.Errorf("failed to create internal view %q: %w", v.Name, err)
+		}
+	}
+
+	for _, m := range allInternalMacros() {
+		if _, err := db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+m.Schema); err != nil {
+			return fmt.Errorf("failed to create internal schema %q: %w", m.Schema, err)
+		}
+		if _, err := db.ExecContext(ctx, createInternalMacroStmt(m)); err != nil {
+			return fmt.Errorf("failed to create internal macro %q: %w", m.Name, err)
+		}
+	}
+
+	if replace {
+		if _, err := db.ExecContext(ctx, InternalTables.SchemaVersion.UpsertStmt(), schemaVersionInternalObjects, checksum, time.Now()); err != nil {
+			return fmt.Errorf("failed to record the version of the internal objects: %w", err)
+		}
+	}
+	return nil
+}
+
+func createInternalViewStmt(v InternalView, replace bool) string {
+	if replace {
+		return "CREATE OR REPLACE VIEW " + v.QualifiedName() + " AS " + v.DDL
+	}
+	return "CREATE VIEW IF NOT EXISTS " + v.QualifiedName() + " AS " + v.DDL
+}
+
+func createInternalMacroStmt(m InternalMacro) string {
+	definitions := make([]string, 0, len(m.Definitions))
+	for _, d := range m.Definitions {
+		macroParams := strings.Join(d.Params, ", ")
+		var asType string
+		if m.IsTableMacro {
+			asType = "TABLE\n"
+		} else {
+			asType = "\n"
+		}
+		definitions = append(definitions, fmt.Sprintf("\n(%s) AS %s%s", macroParams, asType, d.DDL))
+	}
+	return "CREATE OR REPLACE MACRO " + m.QualifiedName() + strings.Join(definitions, ",") + ";"
+}
+
+// internalObjectsChecksum returns the checksum of the definitions of the internal views and macros.
+func internalObjectsChecksum() string {
+	h := sha256.New()
+	for _, v := range allInternalViews() {
+		h.Write([]byte(createInternalViewStmt(v, true)))
+		h.Write([]byte{0})
+	}
+	for _, m := range allInternalMacros() {
+		h.Write([]byte(createInternalMacroStmt(m)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// schemaVersion returns the recorded version of a component, or "" if it has not been recorded.
+func schemaVersion(ctx context.Context, db *stdsql.DB, component string) (string, error) {
+	var version string
+	err := db.QueryRowContext(ctx, InternalTables.SchemaVersion.SelectColumnsStmt([]string{"version"}), component).Scan(&version)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the catalog schema version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,215 @@
+package catalog
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func newMigrationTestDB(t *testing.T) *stdsql.DB {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	db := stdsql.OpenDB(connector)
+	t.Cleanup(func() { db.Close() })
+
+	for _, it := range internalTables {
+		_, err := db.Exec("CREATE SCHEMA IF NOT EXISTS " + it.Schema)
+		require.NoError(t, err)
+		_, err = db.Exec("CREATE TABLE IF NOT EXISTS " + it.QualifiedName() + "(" + it.DDL + ")")
+		require.NoError(t, err)
+	}
+	return db
+}
+
+func TestMigrateCatalog(t *testing.T) {
+	ctx := context.Background()
+	db := newMigrationTestDB(t)
+
+	version := func() string {
+		v, err := schemaVersion(ctx, db, schemaVersionMigrations)
+		require.NoError(t, err)
+		return v
+	}
+	require.Equal(t, "", version())
+
+	// A fresh catalog applies all migrations.
+	latest := CatalogMigrations[len(CatalogMigrations)-1].Version
+	require.NoError(t, migrateCatalog(ctx, db, CatalogMigrations))
+	require.Equal(t, strconv.Itoa(latest), version())
+
+	// An upgraded binary applies only the new migrations, exactly once.
+	applied := 0
+	migrations := append(CatalogMigrations[:len(CatalogMigrations):len(CatalogMigrations)], CatalogMigration{
+		Version:     latest + 1,
+		Description: "add a column to an internal table",
+		Up: func(ctx context.Context, tx *stdsql.Tx) error {
+			applied++
+			_, err := tx.ExecContext(ctx, "ALTER TABLE "+InternalTables.QueryProfiles.QualifiedName()+" ADD COLUMN IF NOT EXISTS note TEXT")
+			return err
+		},
+	})
+	require.NoError(t, migrateCatalog(ctx, db, migrations))
+	require.Equal(t, strconv.Itoa(latest+1), version())
+	require.NoError(t, migrateCatalog(ctx, db, migrations))
+	require.Equal(t, 1, applied)
+	_, err := db.Exec("SELECT note FROM " + InternalTables.QueryProfiles.QualifiedName())
+	require.NoError(t, err)
+
+	// A failed migration is rolled back, and retried on the next start.
+	failing := append(migrations[:len(migrations):len(migrations)], CatalogMigration{
+		Version:     latest + 2,
+		Description: "fail after a change",
+		Up: func(ctx context.Context, tx *stdsql.Tx) error {
+			if _, err := tx.ExecContext(ctx, "CREATE TABLE __sys__.migration_leftover (id INT)"); err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	})
+	require.ErrorContains(t, migrateCatalog(ctx, db, failing), "boom")
+	require.Equal(t, strconv.Itoa(latest+1), version())
+	_, err = db.Exec("SELECT * FROM __sys__.migration_leftover")
+	require.Error(t, err)
+}
+
+func TestMigrateSubscriptionSchema(t *testing.T) {
+	ctx := context.Background()
+	db := newMigrationTestDB(t)
+
+	// The subscriptions of a catalog created before the target schemas have no schema.
+	_, err := db.Exec("DROP TABLE __sys__.pg_subscription")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE __sys__.pg_subscription (subname TEXT PRIMARY KEY, subconninfo TEXT, subpublication TEXT, subskiplsn TEXT, subenabled BOOLEAN)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO __sys__.pg_subscription VALUES ('sub', 'dsn', 'pub', '0/0', true)")
+	require.NoError(t, err)
+
+	require.NoError(t, migrateCatalog(ctx, db, CatalogMigrations))
+	var schema stdsql.NullString
+	require.NoError(t, db.QueryRow("SELECT subschema FROM __sys__.pg_subscription").Scan(&schema))
+	require.False(t, schema.Valid)
+	var mapping stdsql.NullString
+	require.NoError(t, db.QueryRow("SELECT subschemamapping FROM __sys__.pg_subscription").Scan(&mapping))
+	require.False(t, mapping.Valid)
+	var slot stdsql.NullString
+	require.NoError(t, db.QueryRow("SELECT subslotname FROM __sys__.pg_subscription").Scan(&slot))
+	require.False(t, slot.Valid)
+	_, err = db.Exec(InternalTables.PgSubscription.UpsertStmt(), "sub2", "dsn", "pub2", "0/0", true, "sub2_schema", "public:sub2_public", "pub2_replica")
+	require.NoError(t, err)
+}
+
+func TestCreateInternalObjects(t *testing.T) {
+	ctx := context.Background()
+	db := newMigrationTestDB(t)
+	require.NotEmpty(t, InternalViews)
+	v := InternalViews[0]
+
+	// A catalog created by an older version has a stale view and no recorded checksum.
+	_, err := db.Exec("CREATE SCHEMA IF NOT EXISTS " + v.Schema)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE VIEW " + v.QualifiedName() + " AS SELECT 'stale' AS stale")
+	require.NoError(t, err)
+
+	require.NoError(t, createInternalObjects(ctx, db))
+	recorded, err := schemaVersion(ctx, db, schemaVersionInternalObjects)
+	require.NoError(t, err)
+	require.Equal(t, internalObjectsChecksum(), recorded)
+	_, err = db.Exec("SELECT stale FROM " + v.QualifiedName())
+	require.Error(t, err)
+
+	// The objects are kept as they are while the definitions are unchanged.
+	_, err = db.Exec("CREATE OR REPLACE VIEW " + v.QualifiedName() + " AS SELECT 'kept' AS kept")
+	require.NoError(t, err)
+	require.NoError(t, createInternalObjects(ctx, db))
+	_, err = db.Exec("SELECT kept FROM " + v.QualifiedName())
+	require.NoError(t, err)
+
+	// A different checksum, as recorded by another version, recreates them.
+	_, err = db.Exec(InternalTables.SchemaVersion.UpsertStmt(), schemaVersionInternalObjects, "outdated", nil)
+	require.NoError(t, err)
+	require.NoError(t, createInternalObjects(ctx, db))
+	_, err = db.Exec("SELECT kept FROM " + v.QualifiedName())
+	require.Error(t, err)
+}
+
+func TestMigrateFTSIndexes(t *testing.T) {
+	ctx := context.Background()
+	db := newMigrationTestDB(t)
+
+	// The full-text indexes of a catalog created before their staleness is tracked are fresh.
+	_, err := db.Exec("DROP TABLE __sys__.fts_indexes")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE __sys__.fts_indexes (schema_name TEXT, table_name TEXT, index_name TEXT, key_column TEXT," +
+		" columns TEXT, stemmer TEXT, created_at TIMESTAMPTZ, PRIMARY KEY (schema_name, table_name))")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO __sys__.fts_indexes VALUES ('main', 'docs', 'docs_fts', 'id', '[\"body\"]', 'english', now())," +
+		" ('other', 'docs', 'docs_fts', 'id', '[\"body\"]', 'english', now()), ('main', 'notes', 'notes_fts', 'id', '[\"body\"]', 'english', now())")
+	require.NoError(t, err)
+
+	require.NoError(t, migrateCatalog(ctx, db, CatalogMigrations))
+	stale := func() []string {
+		rows, err := db.Query("SELECT schema_name || '.' || table_name FROM __sys__.fts_indexes WHERE stale ORDER BY 1")
+		require.NoError(t, err)
+		defer rows.Close()
+		var tables []string
+		for rows.Next() {
+			var table string
+			require.NoError(t, rows.Scan(&table))
+			tables = append(tables, table)
+		}
+		return tables
+	}
+	require.Empty(t, stale())
+
+	// An unqualified table is matched in all schemas.
+	_, err = db.Exec(MarkFTSIndexStaleStmt(), "MAIN", "Notes")
+	require.NoError(t, err)
+	require.Equal(t, []string{"main.notes"}, stale())
+	_, err = db.Exec(MarkFTSIndexStaleStmt(), "", "docs")
+	require.NoError(t, err)
+	require.Equal(t, []string{"main.docs", "main.notes", "other.docs"}, stale())
+}
+
+func TestMigrateQueryProfiles(t *testing.T) {
+	ctx := context.Background()
+	db := newMigrationTestDB(t)
+
+	// The profiles of a catalog created before the view are in the query_profiles table, whose users were added later.
+	_, err := db.Exec("CREATE TABLE __sys__.query_profiles (query_id TEXT PRIMARY KEY, connection_id UBIGINT, query TEXT," +
+		" started_at TIMESTAMP, latency_ms DOUBLE, plan TEXT)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO __sys__.query_profiles VALUES ('q1', 1, 'SELECT 1', now(), 1.5, '{}')")
+	require.NoError(t, err)
+
+	require.NoError(t, migrateCatalog(ctx, db, CatalogMigrations))
+	var query string
+	var user stdsql.NullString
+	require.NoError(t, db.QueryRow("SELECT query, user_name FROM "+InternalTables.QueryProfiles.QualifiedName()+
+		" WHERE query_id = 'q1'").Scan(&query, &user))
+	require.Equal(t, "SELECT 1", query)
+	require.False(t, user.Valid)
+
+	// The table is replaced with the view.
+	require.NoError(t, createInternalObjects(ctx, db))
+	_, err = db.Exec("SELECT user_name FROM __sys__.query_profiles")
+	require.NoError(t, err)
+}
+
+func TestMigrateObjectOIDs(t *testing.T) {
+	ctx := context.Background()
+	db := newMigrationTestDB(t)
+
+	// The OIDs assigned before the sequence existed are not assigned again.
+	_, err := db.Exec("INSERT INTO " + InternalTables.PGEnum.QualifiedName() + " (oid, enumtypid, enumsortorder, enumlabel) VALUES (20001, 20000, 1, 'a')")
+	require.NoError(t, err)
+
+	require.NoError(t, migrateCatalog(ctx, db, CatalogMigrations))
+	var oid int64
+	require.NoError(t, db.QueryRow("SELECT nextval('"+objectOIDSequence+"')").Scan(&oid))
+	require.Equal(t, int64(20002), oid)
+}
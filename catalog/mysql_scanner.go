@@ -0,0 +1,173 @@
+package catalog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The federated queries against other MySQL servers, e.g., the replication source, through the mysql extension of
+// DuckDB, symmetric to postgres_scanner:
+//
+//	SELECT * FROM mysql_query('<source>', 'SELECT ...')
+//
+// runs the inner query on the MySQL server of the source, over either protocol. The source is one of:
+//
+//   - a connection string, e.g., 'host=127.0.0.1 port=3306 user=root password=... database=db', or a mysql:// URI;
+//   - the name of a MySQL secret of DuckDB, e.g., created by `CREATE SECRET src (TYPE mysql, HOST ..., USER ...)`
+//     over the Postgres protocol, so that the credentials are not written in the queries;
+//   - `replication_source`, the secret of the source configured by CHANGE REPLICATION SOURCE TO,
+//     which is kept up to date by the binlog replication.
+//
+// The source is attached read-only as a database named after the hash of it when it is first queried, and the
+// source in the query is replaced with the name of the database, as mysql_query of DuckDB expects.
+
+// MySQLReplicationSourceSecret is the name of the MySQL secret of the replication source.
+const MySQLReplicationSourceSecret = "replication_source"
+
+// mysqlSourcePrefix is the prefix of the names of the attached MySQL sources.
+const mysqlSourcePrefix = "__mysql_"
+
+// ErrMySQLScannerUnavailable is returned if the mysql extension could not be loaded at startup.
+var ErrMySQLScannerUnavailable = errors.New("the mysql extension of DuckDB is not loaded, mysql_query() is unavailable")
+
+// mysqlQuerySourceRegex matches the source argument of the calls of mysql_query.
+var mysqlQuerySourceRegex = regexp.MustCompile(`(?i)\bmysql_query\(\s*'((?:[^']|'')*)'`)
+
+// HasMySQLScanner reports whether the mysql extension is loaded.
+func (prov *DatabaseProvider) HasMySQLScanner() bool {
+	return prov.mysqlScanner
+}
+
+// MySQLSourceName returns the name of the database that the source is attached as.
+func MySQLSourceName(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return mysqlSourcePrefix + hex.EncodeToString(sum[:8])
+}
+
+// isMySQLConnectionString reports whether the source is a connection string rather than the name of a secret.
+func isMySQLConnectionString(source string) bool {
+	return strings.Contains(source, "=") || strings.HasPrefix(strings.ToLower(source), "mysql://")
+}
+
+// AttachMySQLSource attaches the MySQL source read-only if it is not attached yet, and returns the name of the database.
+func (prov *DatabaseProvider) AttachMySQLSource(ctx context.Context, source string) (string, error) {
+	if !prov.mysqlScanner {
+		return "", ErrMySQLScannerUnavailable
+	}
+	if strings.TrimSpace(source) == "" {
+		return "", fmt.Errorf("the source of mysql_query() is empty")
+	}
+	name := MySQLSourceName(source)
+	var stmt string
+	if isMySQLConnectionString(source) {
+		stmt = fmt.Sprintf("ATTACH IF NOT EXISTS '%s' AS %s (TYPE mysql, READ_ONLY)",
+			strings.ReplaceAll(source, "'", "''"), QuoteIdentifierANSI(name))
+	} else {
+		stmt = fmt.Sprintf("ATTACH IF NOT EXISTS '' AS %s (TYPE mysql, SECRET %s, READ_ONLY)",
+			QuoteIdentifierANSI(name), QuoteIdentifierANSI(source))
+	}
+	if _, err := prov.storage.ExecContext(ctx, stmt); err != nil {
+		return "", fmt.Errorf("failed to attach the MySQL source of mysql_query(): %w", err)
+	}
+	return name, nil
+}
+
+// DetachMySQLSource detaches the MySQL source, so that it is attached again with its current credentials.
+func (prov *DatabaseProvider) DetachMySQLSource(ctx context.Context, source string) error {
+	if !prov.mysqlScanner {
+		return nil
+	}
+	_, err := prov.storage.ExecContext(ctx, "DETACH DATABASE IF EXISTS "+QuoteIdentifierANSI(MySQLSourceName(source)))
+	return err
+}
+
+// SetMySQLSecret creates or replaces the MySQL secret of the name given. The secret is kept in memory only.
+func (prov *DatabaseProvider) SetMySQLSecret(ctx context.Context, name, host string, port uint16, user, password string) error {
+	if !prov.mysqlScanner {
+		return ErrMySQLScannerUnavailable
+	}
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	stmt := fmt.Sprintf("CREATE OR REPLACE SECRET %s (TYPE mysql, HOST %s, PORT %d, USER %s, PASSWORD %s)",
+		QuoteIdentifierANSI(name), quote(host), port, quote(user), quote(password))
+	if _, err := prov.storage.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	return prov.DetachMySQLSource(ctx, name)
+}
+
+// DropMySQLSecret drops the MySQL secret of the name given if it exists.
+func (prov *DatabaseProvider) DropMySQLSecret(ctx context.Context, name string) error {
+	if !prov.mysqlScanner {
+		return nil
+	}
+	if _, err := prov.storage.ExecContext(ctx, "DROP SECRET IF EXISTS "+QuoteIdentifierANSI(name)); err != nil {
+		return err
+	}
+	return prov.DetachMySQLSource(ctx, name)
+}
+
+// HasMySQLQuery reports whether the query calls mysql_query with a literal source.
+func HasMySQLQuery(query string) bool {
+	return mysqlQuerySourceRegex.MatchString(query)
+}
+
+// RewriteMySQLQuery attaches the sources of the calls of mysql_query in the query,
+// and replaces the sources with the names of the attached databases.
+func (prov *DatabaseProvider) RewriteMySQLQuery(ctx context.Context, query string) (string, error) {
+	var err error
+	rewritten := mysqlQuerySourceRegex.ReplaceAllStringFunc(query, func(call string) string {
+		source := strings.ReplaceAll(mysqlQuerySourceRegex.FindStringSubmatch(call)[1], "''", "'")
+		if err != nil || strings.HasPrefix(source, mysqlSourcePrefix) {
+			return call
+		}
+		var name string
+		if name, err = prov.AttachMySQLSource(ctx, source); err != nil {
+			return call
+		}
+		return call[:strings.Index(call, "(")+1] + "'" + name + "'"
+	})
+	if err != nil {
+		return "", err
+	}
+	return rewritten, nil
+}
+
+// MySQLQuerySchema returns the MySQL schema of the result of the query on the attached MySQL source.
+func (prov *DatabaseProvider) MySQLQuerySchema(ctx context.Context, name, query, source string) (sql.Schema, error) {
+	rows, err := prov.storage.QueryContext(ctx, MySQLQueryStmt(name, query)+" LIMIT 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	schema := make(sql.Schema, len(columns))
+	for i, c := range columns {
+		precision, scale, _ := c.DecimalSize()
+		typ, err := mysqlDataType(AnnotatedDuckType{name: c.DatabaseTypeName()}, uint8(precision), uint8(scale))
+		if err != nil {
+			return nil, fmt.Errorf("unsupported type of column %q of mysql_query(): %w", c.Name(), err)
+		}
+		schema[i] = &sql.Column{
+			Name:     c.Name(),
+			Type:     typ,
+			Nullable: true,
+			Source:   source,
+		}
+	}
+	return schema, nil
+}
+
+// MySQLQueryStmt returns the DuckDB query that runs the query on the attached MySQL source.
+func MySQLQueryStmt(name, query string) string {
+	return fmt.Sprintf("SELECT * FROM mysql_query('%s', '%s')", name, strings.ReplaceAll(query, "'", "''"))
+}
@@ -0,0 +1,48 @@
+package catalog
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLSource(t *testing.T) {
+	for _, tt := range []struct {
+		source string
+		dsn    bool
+	}{
+		{"host=127.0.0.1 port=3306 user=root database=db", true},
+		{"mysql://root@127.0.0.1:3306/db", true},
+		{MySQLReplicationSourceSecret, false},
+		{"my_secret", false},
+	} {
+		require.Equal(t, tt.dsn, isMySQLConnectionString(tt.source), tt.source)
+
+		name := MySQLSourceName(tt.source)
+		require.True(t, strings.HasPrefix(name, mysqlSourcePrefix), name)
+		require.Equal(t, name, MySQLSourceName(tt.source))
+	}
+	require.NotEqual(t, MySQLSourceName("a"), MySQLSourceName("b"))
+}
+
+func TestRewriteMySQLQuery(t *testing.T) {
+	require.True(t, HasMySQLQuery(`SELECT * FROM mysql_query('replication_source', 'SELECT 1')`))
+	require.True(t, HasMySQLQuery(`select * from MYSQL_QUERY( 'host=h user=''u''', 'SELECT 1')`))
+	require.False(t, HasMySQLQuery(`SELECT * FROM postgres_query('db', 'SELECT 1')`))
+	require.False(t, HasMySQLQuery(`SELECT * FROM my_mysql_query('db', 'SELECT 1')`))
+
+	// The queries are left alone if the mysql extension is not loaded.
+	prov := &DatabaseProvider{}
+	_, err := prov.RewriteMySQLQuery(context.Background(), `SELECT * FROM mysql_query('replication_source', 'SELECT 1')`)
+	require.ErrorIs(t, err, ErrMySQLScannerUnavailable)
+
+	// The sources that are attached already are not attached again.
+	query := `SELECT * FROM mysql_query('` + MySQLSourceName("src") + `', 'SELECT 1')`
+	rewritten, err := prov.RewriteMySQLQuery(context.Background(), query)
+	require.NoError(t, err)
+	require.Equal(t, query, rewritten)
+
+	require.Equal(t, `SELECT * FROM mysql_query('__mysql_x', 'SELECT ''a''')`, MySQLQueryStmt("__mysql_x", `SELECT 'a'`))
+}
@@ -0,0 +1,565 @@
+package catalog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/information_schema"
+)
+
+// DuckDB does not support MySQL's table partitioning. The partitioning clause of a CREATE TABLE statement
+// is removed before the statement is parsed, and the table is created unpartitioned with a warning.
+// The partitioning is recorded in the ExtraTableInfo of the table, and is reported in information_schema.PARTITIONS.
+
+// ErrPartitionNotSupported is the code of the warning raised when the partitioning of a table is ignored.
+const ErrPartitionNotSupported = 1235 // ER_NOT_SUPPORTED_YET
+
+var createTableRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+(TEMPORARY\s+)?TABLE\b`)
+
+// PartitionInfo describes the partitioning of a table.
+type PartitionInfo struct {
+	Method                 string // RANGE, RANGE COLUMNS, LIST, LIST COLUMNS, HASH, LINEAR HASH, KEY, or LINEAR KEY
+	Expression             string `json:",omitempty"`
+	SubpartitionMethod     string `json:",omitempty"` // HASH, LINEAR HASH, KEY, or LINEAR KEY
+	SubpartitionExpression string `json:",omitempty"`
+	Partitions             []PartitionDefinition
+}
+
+// PartitionDefinition describes a partition of a table.
+type PartitionDefinition struct {
+	Name          string
+	Description   string   `json:",omitempty"` // the upper bound of a RANGE partition, or the values of a LIST partition
+	Comment       string   `json:",omitempty"`
+	Subpartitions []string `json:",omitempty"`
+}
+
+// LocatePartitionClause returns the position and the text of the partitioning clause of a CREATE TABLE statement.
+// The clause may be enclosed in a versioned comment, e.g., `/*!50100 PARTITION BY HASH (id) */` as written by mysqldump,
+// in which case only the content of the comment is located. The returned clause is empty if there is none.
+func LocatePartitionClause(query string) (start, end int, clause string) {
+	if !createTableRegex.MatchString(query) {
+		return 0, 0, ""
+	}
+
+	depth := 0
+	commentStart := -1 // the start of the enclosing versioned comment
+	start = -1
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(query, i)
+			continue
+		case strings.HasPrefix(query[i:], "/*!") && commentStart < 0:
+			commentStart = i
+			for i += 3; i < len(query) && query[i] >= '0' && query[i] <= '9'; i++ {
+			}
+			continue
+		case strings.HasPrefix(query[i:], "/*"):
+			if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = len(query)
+			}
+			continue
+		case strings.HasPrefix(query[i:], "*/") && commentStart >= 0:
+			if start > commentStart {
+				return start, i, strings.TrimSpace(query[start:i])
+			}
+			commentStart = -1
+			i += 2
+			continue
+		case c == '#' || strings.HasPrefix(query[i:], "--"):
+			if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(query)
+			}
+			continue
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ';' && depth == 0:
+			if start >= 0 {
+				return start, i, strings.TrimSpace(query[start:i])
+			}
+			return 0, 0, ""
+		case isWordByte(c) && (i == 0 || !isWordByte(query[i-1])):
+			j := i
+			for j < len(query) && isWordByte(query[j]) {
+				j++
+			}
+			word := query[i:j]
+			if depth == 0 {
+				if start < 0 && strings.EqualFold(word, "PARTITION") && nextWordIs(query[j:], "BY") {
+					start = i
+				} else if start >= 0 && commentStart < 0 && isPartitionClauseTerminator(word) {
+					// e.g., CREATE TABLE t (...) PARTITION BY HASH (id) AS SELECT ...
+					return start, i, strings.TrimSpace(query[start:i])
+				}
+			}
+			i = j
+			continue
+		}
+		i++
+	}
+	if start >= 0 && commentStart < 0 {
+		return start, len(query), strings.TrimSpace(query[start:])
+	}
+	return 0, 0, ""
+}
+
+// RemovePartitionClause returns the query without the partitioning clause of a CREATE TABLE statement,
+// along with the position and the length of the removed text.
+func RemovePartitionClause(query string) (stripped string, start, removed int) {
+	start, end, clause := LocatePartitionClause(query)
+	if clause == "" {
+		return query, 0, 0
+	}
+	return query[:start] + query[end:], start, end - start
+}
+
+func skipQuoted(s string, i int) int {
+	quote := s[i]
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func nextWordIs(s, word string) bool {
+	s = strings.TrimLeft(s, " \t\r\n")
+	return len(s) >= len(word) && strings.EqualFold(s[:len(word)], word) && (len(s) == len(word) || !isWordByte(s[len(word)]))
+}
+
+func isPartitionClauseTerminator(word string) bool {
+	switch strings.ToUpper(word) {
+	case "AS", "SELECT", "IGNORE", "REPLACE", "TABLE", "WITH":
+		return true
+	}
+	return false
+}
+
+// ParsePartitionClause parses a partitioning clause located by LocatePartitionClause.
+func ParsePartitionClause(clause string) (*PartitionInfo, error) {
+	l := &partitionLexer{src: clause}
+	if !l.acceptWord("PARTITION") || !l.acceptWord("BY") {
+		return nil, l.errorf("expected PARTITION BY")
+	}
+
+	var info PartitionInfo
+	var err error
+	if info.Method, info.Expression, err = l.partitionMethod(false); err != nil {
+		return nil, err
+	}
+	numPartitions := 1
+	if l.acceptWord("PARTITIONS") {
+		if numPartitions, err = l.count(); err != nil {
+			return nil, err
+		}
+	}
+	numSubpartitions := 0
+	if l.acceptWord("SUBPARTITION") {
+		if !l.acceptWord("BY") {
+			return nil, l.errorf("expected SUBPARTITION BY")
+		}
+		if info.SubpartitionMethod, info.SubpartitionExpression, err = l.partitionMethod(true); err != nil {
+			return nil, err
+		}
+		numSubpartitions = 1
+		if l.acceptWord("SUBPARTITIONS") {
+			if numSubpartitions, err = l.count(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if l.peekByte() == '(' {
+		definitions, err := l.group()
+		if err != nil {
+			return nil, err
+		}
+		if info.Partitions, err = parsePartitionDefinitions(definitions); err != nil {
+			return nil, err
+		}
+	} else {
+		if strings.HasPrefix(info.Method, "RANGE") || strings.HasPrefix(info.Method, "LIST") {
+			return nil, fmt.Errorf("for %s partitions each partition must be defined", info.Method)
+		}
+		// The partitions are named p0, p1, ... if they are not defined explicitly.
+		for i := range numPartitions {
+			info.Partitions = append(info.Partitions, PartitionDefinition{Name: "p" + strconv.Itoa(i)})
+		}
+	}
+	if !l.eof() {
+		return nil, l.errorf("unexpected %q", l.rest())
+	}
+
+	// The subpartitions are named <partition>sp0, <partition>sp1, ... if they are not defined explicitly.
+	for i := range info.Partitions {
+		p := &info.Partitions[i]
+		if len(p.Subpartitions) == 0 {
+			for j := range numSubpartitions {
+				p.Subpartitions = append(p.Subpartitions, p.Name+"sp"+strconv.Itoa(j))
+			}
+		}
+	}
+	return &info, nil
+}
+
+func parsePartitionDefinitions(definitions string) ([]PartitionDefinition, error) {
+	l := &partitionLexer{src: definitions}
+	var partitions []PartitionDefinition
+	for {
+		if !l.acceptWord("PARTITION") {
+			return nil, l.errorf("expected PARTITION")
+		}
+		var p PartitionDefinition
+		var err error
+		if p.Name, err = l.identifier(); err != nil {
+			return nil, err
+		}
+		if l.acceptWord("VALUES") {
+			switch {
+			case l.acceptWord("LESS"):
+				if !l.acceptWord("THAN") {
+					return nil, l.errorf("expected VALUES LESS THAN")
+				}
+				if l.acceptWord("MAXVALUE") {
+					p.Description = "MAXVALUE"
+				} else if p.Description, err = l.group(); err != nil {
+					return nil, err
+				}
+			case l.acceptWord("IN"):
+				if p.Description, err = l.group(); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, l.errorf("expected VALUES LESS THAN or VALUES IN")
+			}
+		}
+		if p.Comment, err = l.partitionOptions(); err != nil {
+			return nil, err
+		}
+		if l.peekByte() == '(' {
+			subdefinitions, err := l.group()
+			if err != nil {
+				return nil, err
+			}
+			sl := &partitionLexer{src: subdefinitions}
+			for {
+				if !sl.acceptWord("SUBPARTITION") {
+					return nil, sl.errorf("expected SUBPARTITION")
+				}
+				name, err := sl.identifier()
+				if err != nil {
+					return nil, err
+				}
+				if _, err := sl.partitionOptions(); err != nil {
+					return nil, err
+				}
+				p.Subpartitions = append(p.Subpartitions, name)
+				if !sl.acceptByte(',') {
+					break
+				}
+			}
+			if !sl.eof() {
+				return nil, sl.errorf("unexpected %q", sl.rest())
+			}
+		}
+		partitions = append(partitions, p)
+		if !l.acceptByte(',') {
+			break
+		}
+	}
+	if !l.eof() {
+		return nil, l.errorf("unexpected %q", l.rest())
+	}
+	return partitions, nil
+}
+
+// partitionLexer is a minimal lexer for the partitioning clause.
+type partitionLexer struct {
+	src string
+	pos int
+}
+
+func (l *partitionLexer) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid partitioning clause at position %d: %s", l.pos, fmt.Sprintf(format, args...))
+}
+
+func (l *partitionLexer) skipSpace() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			if j := strings.Index(l.src[l.pos+2:], "*/"); j >= 0 {
+				l.pos += j + 4
+			} else {
+				l.pos = len(l.src)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *partitionLexer) eof() bool {
+	l.skipSpace()
+	return l.pos >= len(l.src)
+}
+
+func (l *partitionLexer) rest() string {
+	return l.src[l.pos:]
+}
+
+func (l *partitionLexer) peekByte() byte {
+	if l.eof() {
+		return 0
+	}
+	return l.src[l.pos]
+}
+
+func (l *partitionLexer) acceptByte(c byte) bool {
+	if l.peekByte() == c {
+		l.pos++
+		return true
+	}
+	return false
+}
+
+func (l *partitionLexer) word() string {
+	l.skipSpace()
+	j := l.pos
+	for j < len(l.src) && isWordByte(l.src[j]) {
+		j++
+	}
+	return l.src[l.pos:j]
+}
+
+func (l *partitionLexer) acceptWord(word string) bool {
+	if w := l.word(); strings.EqualFold(w, word) {
+		l.pos += len(w)
+		return true
+	}
+	return false
+}
+
+func (l *partitionLexer) identifier() (string, error) {
+	if l.peekByte() == '`' {
+		start := l.pos
+		l.pos = skipQuoted(l.src, l.pos)
+		return strings.ReplaceAll(l.src[start+1:l.pos-1], "``", "`"), nil
+	}
+	w := l.word()
+	if w == "" {
+		return "", l.errorf("expected an identifier")
+	}
+	l.pos += len(w)
+	return w, nil
+}
+
+func (l *partitionLexer) count() (int, error) {
+	w := l.word()
+	n, err := strconv.Atoi(w)
+	if err != nil || n <= 0 {
+		return 0, l.errorf("expected a positive number of partitions")
+	}
+	l.pos += len(w)
+	return n, nil
+}
+
+// group returns the text in the parentheses at the current position.
+func (l *partitionLexer) group() (string, error) {
+	if !l.acceptByte('(') {
+		return "", l.errorf("expected (")
+	}
+	start, depth := l.pos, 1
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '\'', '"', '`':
+			l.pos = skipQuoted(l.src, l.pos)
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				l.pos++
+				return strings.TrimSpace(l.src[start : l.pos-1]), nil
+			}
+		}
+		l.pos++
+	}
+	return "", l.errorf("unbalanced parentheses")
+}
+
+// partitionMethod parses a partitioning method and its expression or column list.
+func (l *partitionLexer) partitionMethod(subpartition bool) (method, expression string, err error) {
+	linear := l.acceptWord("LINEAR")
+	switch {
+	case l.acceptWord("HASH"):
+		method = "HASH"
+	case l.acceptWord("KEY"):
+		method = "KEY"
+		if l.acceptWord("ALGORITHM") {
+			l.acceptByte('=')
+			if _, err := l.count(); err != nil {
+				return "", "", err
+			}
+		}
+	case !linear && !subpartition && l.acceptWord("RANGE"):
+		method = "RANGE"
+	case !linear && !subpartition && l.acceptWord("LIST"):
+		method = "LIST"
+	default:
+		return "", "", l.errorf("unsupported partitioning method %q", l.word())
+	}
+	if linear {
+		method = "LINEAR " + method
+	}
+	if (method == "RANGE" || method == "LIST") && l.acceptWord("COLUMNS") {
+		method += " COLUMNS"
+	}
+	expression, err = l.group()
+	return method, expression, err
+}
+
+// partitionOptions skips the options of a partition definition, and returns its comment.
+func (l *partitionLexer) partitionOptions() (comment string, err error) {
+	// Only the string following COMMENT [=] is the comment, e.g., DATA DIRECTORY = '/path' is not.
+	isComment := false
+	for {
+		switch c := l.peekByte(); {
+		case c == 0 || c == ',' || c == '(':
+			return comment, nil
+		case c == '=':
+			l.pos++
+		case c == '\'' || c == '"':
+			start := l.pos
+			l.pos = skipQuoted(l.src, l.pos)
+			if isComment {
+				comment = strings.ReplaceAll(l.src[start+1:l.pos-1], string(c)+string(c), string(c))
+			}
+			isComment = false
+		default:
+			w := l.word()
+			if w == "" {
+				return "", l.errorf("unexpected %q", l.rest())
+			}
+			l.pos += len(w)
+			isComment = strings.EqualFold(w, "COMMENT")
+		}
+	}
+}
+
+// partitionsRowIter implements the reader of information_schema.PARTITIONS.
+// Like MySQL, a table that is not partitioned has a single row with NULL partition information.
+func partitionsRowIter(ctx *sql.Context, cat sql.Catalog) (sql.RowIter, error) {
+	dbs, err := information_schema.AllDatabasesWithNames(ctx, cat, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []sql.Row
+	for _, db := range dbs {
+		d, ok := db.Database.(*Database)
+		if !ok {
+			continue
+		}
+		tables, err := d.findTables(ctx, "%")
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tables {
+			row := func(partition, subpartition, ordinal, subordinal, method, subMethod, expression, subExpression, description any, comment string) sql.Row {
+				return sql.Row{
+					db.CatalogName, // TABLE_CATALOG
+					db.SchemaName,  // TABLE_SCHEMA
+					t.Name(),       // TABLE_NAME
+					partition,      // PARTITION_NAME
+					subpartition,   // SUBPARTITION_NAME
+					ordinal,        // PARTITION_ORDINAL_POSITION
+					subordinal,     // SUBPARTITION_ORDINAL_POSITION
+					method,         // PARTITION_METHOD
+					subMethod,      // SUBPARTITION_METHOD
+					expression,     // PARTITION_EXPRESSION
+					subExpression,  // SUBPARTITION_EXPRESSION
+					description,    // PARTITION_DESCRIPTION
+					nil,            // TABLE_ROWS
+					uint64(0),      // AVG_ROW_LENGTH
+					uint64(0),      // DATA_LENGTH
+					nil,            // MAX_DATA_LENGTH
+					uint64(0),      // INDEX_LENGTH
+					uint64(0),      // DATA_FREE
+					nil,            // CREATE_TIME
+					nil,            // UPDATE_TIME
+					nil,            // CHECK_TIME
+					nil,            // CHECKSUM
+					comment,        // PARTITION_COMMENT
+					nil,            // NODEGROUP
+					nil,            // TABLESPACE_NAME
+				}
+			}
+
+			info := t.ExtraTableInfo().Partitioning
+			if info == nil {
+				rows = append(rows, row(nil, nil, nil, nil, nil, nil, nil, nil, nil, ""))
+				continue
+			}
+			for i, p := range info.Partitions {
+				var description any
+				if p.Description != "" {
+					description = p.Description
+				}
+				if len(p.Subpartitions) == 0 {
+					rows = append(rows, row(p.Name, nil, uint32(i+1), nil, info.Method, nil, info.Expression, nil, description, p.Comment))
+					continue
+				}
+				for j, sp := range p.Subpartitions {
+					rows = append(rows, row(p.Name, sp, uint32(i+1), uint32(j+1),
+						info.Method, info.SubpartitionMethod, info.Expression, info.SubpartitionExpression, description, p.Comment))
+				}
+			}
+		}
+	}
+	return sql.RowsToRowIter(rows...), nil
+}
+
+// RegisterInformationSchemaTables makes the information_schema tables that are empty in go-mysql-server
+// report the metadata recorded in the catalog.
+func RegisterInformationSchemaTables(ctx *sql.Context, infoSchema sql.Database) error {
+	table, ok, err := infoSchema.GetTableInsensitive(ctx, information_schema.PartitionsTableName)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return sql.ErrTableNotFound.New(information_schema.PartitionsTableName)
+	}
+	t, ok := table.(*information_schema.InformationSchemaTable)
+	if !ok {
+		return fmt.Errorf("unexpected information_schema.%s table type %T", information_schema.PartitionsTableName, table)
+	}
+	t.Reader = partitionsRowIter
+	return nil
+}
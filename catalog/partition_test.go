@@ -0,0 +1,109 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocatePartitionClause(t *testing.T) {
+	tests := []struct {
+		query    string
+		clause   string
+		stripped string
+	}{
+		{
+			query:    "CREATE TABLE t (id INT PRIMARY KEY) PARTITION BY HASH (id) PARTITIONS 4",
+			clause:   "PARTITION BY HASH (id) PARTITIONS 4",
+			stripped: "CREATE TABLE t (id INT PRIMARY KEY) ",
+		},
+		{
+			query:    "create table t (id int, p varchar(10) comment 'partition by') engine=InnoDB partition by key() partitions 2;",
+			clause:   "partition by key() partitions 2",
+			stripped: "create table t (id int, p varchar(10) comment 'partition by') engine=InnoDB ;",
+		},
+		{
+			query:    "CREATE TABLE t (id INT)\n/*!50100 PARTITION BY RANGE (id)\n(PARTITION p0 VALUES LESS THAN (10) ENGINE = InnoDB) */",
+			clause:   "PARTITION BY RANGE (id)\n(PARTITION p0 VALUES LESS THAN (10) ENGINE = InnoDB)",
+			stripped: "CREATE TABLE t (id INT)\n/*!50100 */",
+		},
+		{
+			query:    "CREATE TABLE t (id INT) PARTITION BY HASH (id) AS SELECT 1 AS id",
+			clause:   "PARTITION BY HASH (id)",
+			stripped: "CREATE TABLE t (id INT) AS SELECT 1 AS id",
+		},
+		{
+			query:    "CREATE TABLE t (id INT) /*!50100 COMMENT 'x' */",
+			stripped: "CREATE TABLE t (id INT) /*!50100 COMMENT 'x' */",
+		},
+		{
+			query:    "SELECT 1 FROM t PARTITION (p0)",
+			stripped: "SELECT 1 FROM t PARTITION (p0)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, _, clause := LocatePartitionClause(tt.query)
+			require.Equal(t, tt.clause, clause)
+			stripped, _, _ := RemovePartitionClause(tt.query)
+			require.Equal(t, tt.stripped, stripped)
+		})
+	}
+}
+
+func TestParsePartitionClause(t *testing.T) {
+	tests := []struct {
+		clause string
+		want   *PartitionInfo
+		err    bool
+	}{
+		{
+			clause: "PARTITION BY RANGE (id) (PARTITION p0 VALUES LESS THAN (10) COMMENT = 'small', PARTITION p1 VALUES LESS THAN MAXVALUE ENGINE = InnoDB)",
+			want: &PartitionInfo{Method: "RANGE", Expression: "id", Partitions: []PartitionDefinition{
+				{Name: "p0", Description: "10", Comment: "small"},
+				{Name: "p1", Description: "MAXVALUE"},
+			}},
+		},
+		{
+			clause: "PARTITION BY RANGE COLUMNS(d) (PARTITION `p 0` VALUES LESS THAN ('2020-01-01'))",
+			want: &PartitionInfo{Method: "RANGE COLUMNS", Expression: "d", Partitions: []PartitionDefinition{
+				{Name: "p 0", Description: "'2020-01-01'"},
+			}},
+		},
+		{
+			clause: "PARTITION BY LIST (c) (PARTITION p0 VALUES IN (1,2) DATA DIRECTORY = '/tmp', PARTITION p1 VALUES IN (3))",
+			want: &PartitionInfo{Method: "LIST", Expression: "c", Partitions: []PartitionDefinition{
+				{Name: "p0", Description: "1,2"},
+				{Name: "p1", Description: "3"},
+			}},
+		},
+		{
+			clause: "PARTITION BY LINEAR KEY ALGORITHM=2 (id) PARTITIONS 2",
+			want: &PartitionInfo{Method: "LINEAR KEY", Expression: "id", Partitions: []PartitionDefinition{
+				{Name: "p0"}, {Name: "p1"},
+			}},
+		},
+		{
+			clause: "PARTITION BY RANGE (YEAR(d)) SUBPARTITION BY HASH (TO_DAYS(d)) SUBPARTITIONS 2 (PARTITION p0 VALUES LESS THAN (1990), PARTITION p1 VALUES LESS THAN MAXVALUE (SUBPARTITION s0, SUBPARTITION s1))",
+			want: &PartitionInfo{Method: "RANGE", Expression: "YEAR(d)", SubpartitionMethod: "HASH", SubpartitionExpression: "TO_DAYS(d)", Partitions: []PartitionDefinition{
+				{Name: "p0", Description: "1990", Subpartitions: []string{"p0sp0", "p0sp1"}},
+				{Name: "p1", Description: "MAXVALUE", Subpartitions: []string{"s0", "s1"}},
+			}},
+		},
+		{clause: "PARTITION BY RANGE (id)", err: true},
+		{clause: "PARTITION BY HASH (id) PARTITIONS 0", err: true},
+		{clause: "PARTITION BY LINEAR RANGE (id)", err: true},
+		{clause: "PARTITION BY HASH (id) (PARTITION p0 VALUES LESS THAN (1", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.clause, func(t *testing.T) {
+			got, err := ParsePartitionClause(tt.clause)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package catalog
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// pg_proc lists the built-in functions of Postgres in InternalTables.PGProc, followed by the functions that
+// can be called in DuckDB, i.e., the functions and the macros of DuckDB, the internal macros, and the macros
+// created by the users. The functions of DuckDB that share their names with the built-in functions of Postgres
+// are left out, since the clients know the latter, and so are the operators and the helper macros named my_*.
+//
+// A function of DuckDB has one oid for all its overloads, while each overload is a row in pg_proc,
+// so the oid of an overload is derived from the oid of the function and its index among the overloads,
+// above the oids of Postgres. The functions of DuckDB, which are repeated in every catalog but listed once from
+// the system catalog, and the internal macros are in pg_catalog.
+
+// pgProcFirstOID is the oid of the first overload of the function of oid 0 in DuckDB.
+const pgProcFirstOID = 1 << 30
+
+// pgProcMaxOverloads is the maximum number of the overloads of a function that are given distinct oids.
+const pgProcMaxOverloads = 256
+
+// PgProcFunctions is the subquery of the functions of DuckDB listed in pg_proc, i.e., the rows of duckdb_functions()
+// with the name of their namespace in Postgres, nspname, and the index of each overload of a function, overload.
+const PgProcFunctions = `(SELECT f.*,
+        CASE WHEN f.internal OR f.schema_name = '__sys__' THEN 'pg_catalog' ELSE f.schema_name END AS nspname,
+        row_number() OVER (PARTITION BY f.database_name, f.function_oid ORDER BY f.parameter_types::VARCHAR, f.parameters::VARCHAR) - 1 AS overload
+    FROM duckdb_functions() f
+    WHERE (f.database_name = 'system' OR (f.database_name = current_database() AND NOT f.internal))
+        AND f.function_type <> 'pragma'
+        AND regexp_matches(f.function_name, '^[A-Za-z_][A-Za-z0-9_]*$')
+        AND NOT (f.schema_name = '__sys__' AND starts_with(f.function_name, 'my_'))
+        AND NOT ((f.internal OR f.schema_name = '__sys__')
+            AND f.function_name IN (SELECT proname FROM __sys__.pg_proc_builtin)))`
+
+// pgProcTypeOIDs maps the type names of DuckDB to the oids of the corresponding types of Postgres.
+var pgProcTypeOIDs = map[string]int{
+	"BOOLEAN":                    16,
+	"TINYINT":                    21,
+	"SMALLINT":                   21,
+	"INTEGER":                    23,
+	"BIGINT":                     20,
+	"UTINYINT":                   21,
+	"USMALLINT":                  23,
+	"UINTEGER":                   20,
+	"UBIGINT":                    1700,
+	"HUGEINT":                    1700,
+	"UHUGEINT":                   1700,
+	"FLOAT":                      700,
+	"DOUBLE":                     701,
+	"DECIMAL":                    1700,
+	"VARCHAR":                    25,
+	"BLOB":                       17,
+	"BIT":                        1560,
+	"DATE":                       1082,
+	"TIME":                       1083,
+	"TIME WITH TIME ZONE":        1266,
+	"TIMESTAMP":                  1114,
+	"TIMESTAMP_S":                1114,
+	"TIMESTAMP_MS":               1114,
+	"TIMESTAMP_NS":               1114,
+	"TIMESTAMP WITH TIME ZONE":   1184,
+	"INTERVAL":                   1186,
+	"UUID":                       2950,
+	"JSON":                       114,
+	"ANY":                        2276, // any
+	"BOOLEAN[]":                  1000,
+	"SMALLINT[]":                 1005,
+	"INTEGER[]":                  1007,
+	"BIGINT[]":                   1016,
+	"FLOAT[]":                    1021,
+	"DOUBLE[]":                   1022,
+	"DECIMAL[]":                  1231,
+	"VARCHAR[]":                  1009,
+	"BLOB[]":                     1001,
+	"DATE[]":                     1182,
+	"TIME[]":                     1183,
+	"TIMESTAMP[]":                1115,
+	"TIMESTAMP WITH TIME ZONE[]": 1185,
+	"INTERVAL[]":                 1187,
+	"UUID[]":                     2951,
+	"JSON[]":                     199,
+}
+
+// pgProcTypeOID returns the expression of the oid of the type of Postgres for a type name of DuckDB.
+// The other lists and arrays are anyarray, the other nested types are record, and the rest are the fallback.
+func pgProcTypeOID(expr string, fallback int) string {
+	names := make([]string, 0, len(pgProcTypeOIDs))
+	for name := range pgProcTypeOIDs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	b.WriteString("CASE " + expr)
+	for _, name := range names {
+		b.WriteString(" WHEN '" + name + "' THEN " + strconv.Itoa(pgProcTypeOIDs[name]))
+	}
+	b.WriteString(" ELSE CASE WHEN " + expr + " LIKE '%]' OR " + expr + " IN ('LIST', 'ARRAY') THEN 2277")
+	b.WriteString(" WHEN regexp_matches(" + expr + ", '^(STRUCT|MAP|UNION)\\b') THEN 2249")
+	b.WriteString(" ELSE " + strconv.Itoa(fallback) + " END END")
+	return b.String()
+}
+
+// pgProcViewDDL returns the definition of the pg_proc view.
+func pgProcViewDDL() string {
+	columns := []string{
+		"oid", "proname", "pronamespace", "proowner", "prolang", "procost", "prorows", "provariadic", "prosupport",
+		"prokind", "prosecdef", "proleakproof", "proisstrict", "proretset", "provolatile", "proparallel", "pronargs",
+		"pronargdefaults", "prorettype", "proargtypes", "proallargtypes", "proargmodes", "proargnames", "proargdefaults",
+		"protrftypes", "prosrc", "probin", "prosqlbody", "proconfig", "proacl",
+	}
+	return `SELECT ` + strings.Join(columns, ", ") + `
+FROM
+    __sys__.pg_proc_builtin
+UNION ALL
+SELECT
+    ` + strconv.Itoa(pgProcFirstOID) + ` + f.function_oid * ` + strconv.Itoa(pgProcMaxOverloads) + ` + f.overload AS oid,
+    f.function_name AS proname,
+    coalesce(n.oid, 2200) AS pronamespace,         -- The schemas unknown to pg_namespace are public
+    10 AS proowner,                                -- The bootstrap superuser
+    CASE WHEN f.function_type IN ('macro', 'table_macro') THEN 14 ELSE 12 END AS prolang,
+                                                   -- sql for the macros, internal for the rest
+    1 AS procost,
+    CASE WHEN f.function_type IN ('table', 'table_macro') THEN 1000 ELSE 0 END AS prorows,
+    CASE WHEN f.varargs IS NULL THEN 0 ELSE ` + pgProcTypeOID("f.varargs", 2276) + ` END AS provariadic,
+    0 AS prosupport,
+    CASE WHEN f.function_type = 'aggregate' THEN 'a' ELSE 'f' END AS prokind,
+    FALSE AS prosecdef,
+    FALSE AS proleakproof,
+    FALSE AS proisstrict,
+    f.function_type IN ('table', 'table_macro') AS proretset,
+    CASE
+        WHEN f.has_side_effects OR f.stability = 'VOLATILE' THEN 'v'
+        WHEN f.stability = 'CONSISTENT' THEN 'i'
+        WHEN f.stability = 'CONSISTENT_WITHIN_QUERY' THEN 's'
+        ELSE 'v'                                   -- The stability of the macros is unknown
+    END AS provolatile,
+    's' AS proparallel,
+    len(f.parameters) AS pronargs,
+    0 AS pronargdefaults,
+    CASE
+        WHEN f.function_type IN ('table', 'table_macro') THEN 2249
+                                                   -- record
+        ELSE ` + pgProcTypeOID("f.return_type", 2283) + `
+    END AS prorettype,                             -- anyelement if unknown, e.g., for the macros
+    array_to_string(list_transform(f.parameter_types, t -> ` + pgProcTypeOID("t", 2276) + `), ' ') AS proargtypes,
+    NULL AS proallargtypes,
+    NULL AS proargmodes,
+    '{' || array_to_string(f.parameters, ',') || '}' AS proargnames,
+    NULL AS proargdefaults,
+    NULL AS protrftypes,
+    coalesce(f.macro_definition, f.function_name) AS prosrc,
+    NULL AS probin,
+    NULL AS prosqlbody,
+    NULL AS proconfig,
+    NULL AS proacl
+FROM
+    ` + PgProcFunctions + ` f
+    LEFT JOIN __sys__.pg_namespace n ON n.nspname = f.nspname
+WHERE
+    f.overload < ` + strconv.Itoa(pgProcMaxOverloads) + `;`
+}
@@ -0,0 +1,59 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgProcView(t *testing.T) {
+	db := newMigrationTestDB(t)
+	_, err := db.Exec("INSERT INTO " + InternalTables.PGProc.QualifiedName() +
+		" (oid, proname, pronamespace, prokind, prorettype, proargtypes) VALUES (1299, 'now', 11, 'f', 1184, ''), (2108, 'sum', 11, 'a', 20, '23')")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO " + InternalTables.PGNamespace.QualifiedName() + " (oid, nspname, nspowner) VALUES (11, 'pg_catalog', 10), (2200, 'public', 6171)")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE MACRO main.add_one(x) AS x + 1")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE VIEW __sys__.pg_proc AS " + pgProcViewDDL())
+	require.NoError(t, err)
+
+	// The built-in functions of Postgres come first, and the functions of DuckDB of the same names are left out.
+	var n int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM __sys__.pg_proc WHERE proname = 'sum'").Scan(&n))
+	require.Equal(t, 1, n)
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM __sys__.pg_proc WHERE proname = 'now'").Scan(&n))
+	require.Equal(t, 1, n)
+
+	// The macros of the users are in their schemas.
+	var (
+		namespace, nargs int
+		lang             int
+		argnames         string
+	)
+	require.NoError(t, db.QueryRow("SELECT pronamespace, pronargs, prolang, proargnames FROM __sys__.pg_proc WHERE proname = 'add_one'").
+		Scan(&namespace, &nargs, &lang, &argnames))
+	require.Equal(t, 2200, namespace)
+	require.Equal(t, 1, nargs)
+	require.Equal(t, 14, lang)
+	require.Equal(t, "{x}", argnames)
+
+	// The functions of DuckDB are in pg_catalog once, with an oid for each overload.
+	var prorettype int
+	var argtypes string
+	require.NoError(t, db.QueryRow("SELECT pronamespace, prorettype, proargtypes FROM __sys__.pg_proc WHERE proname = 'lower'").
+		Scan(&namespace, &prorettype, &argtypes))
+	require.Equal(t, 11, namespace)
+	require.Equal(t, 25, prorettype)
+	require.Equal(t, "25", argtypes)
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM __sys__.pg_proc WHERE proname = 'list_sum'").Scan(&n))
+	require.Equal(t, 1, n)
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM __sys__.pg_proc WHERE proname = 'substring'").Scan(&n))
+	require.Greater(t, n, 1)
+	require.NoError(t, db.QueryRow("SELECT count(*) - count(DISTINCT oid) FROM __sys__.pg_proc").Scan(&n))
+	require.Zero(t, n)
+
+	// The operators and the helper macros are left out.
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM __sys__.pg_proc WHERE proname = '+' OR proname LIKE 'my\\_%' ESCAPE '\\'").Scan(&n))
+	require.Zero(t, n)
+}
@@ -0,0 +1,218 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+var _ sql.PrimaryKeyAlterableTable = (*Table)(nil)
+
+// CreatePrimaryKey implements sql.PrimaryKeyAlterableTable.
+func (t *Table) CreatePrimaryKey(ctx *sql.Context, columns []sql.IndexColumn) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ordinals := make([]int, len(columns))
+	for i, column := range columns {
+		idx := t.schema.Schema.IndexOfColName(column.Name)
+		if idx < 0 {
+			return sql.ErrKeyColumnDoesNotExist.New(column.Name)
+		}
+		ordinals[i] = idx
+	}
+	return t.alterPrimaryKey(ctx, ordinals)
+}
+
+// DropPrimaryKey implements sql.PrimaryKeyAlterableTable.
+func (t *Table) DropPrimaryKey(ctx *sql.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.schema.PkOrdinals) == 0 {
+		return sql.ErrCantDropFieldOrKey.New("PRIMARY")
+	}
+	return t.alterPrimaryKey(ctx, nil)
+}
+
+// alterPrimaryKey replaces the primary key of the table with the columns at the given ordinals.
+// DuckDB (as of 1.1) cannot add or drop a primary key in place, so the table is rebuilt:
+// a copy with the new primary key is created and filled, the original is dropped,
+// and the copy takes its name, comments, and indexes.
+// Tables replicated without indexes do not have a physical primary key, so only the recorded ordinals are updated.
+func (t *Table) alterPrimaryKey(ctx *sql.Context, ordinals []int) error {
+	// https://github.com/apecloud/myduckserver/issues/272
+	if t.comment.Meta.Replicated || isIndexCreationDisabled(ctx) {
+		if err := t.updateExtraTableInfo(ctx, func(info *ExtraTableInfo) {
+			info.PkOrdinals = ordinals
+		}); err != nil {
+			return err
+		}
+		return t.withSchema(ctx)
+	}
+
+	tableInfo := t.comment.Meta
+	tableInfo.PkOrdinals = ordinals
+	if err := t.rebuild(ctx, ordinals, tableInfo); err != nil {
+		return err
+	}
+
+	t.hasPrimaryKey = len(ordinals) > 0
+	t.comment.Meta.PkOrdinals = ordinals
+	return t.withSchema(ctx)
+}
+
+// rebuild replaces the table with a copy that has the primary key at the given ordinals and the given table info.
+// The caller must hold the lock of the table.
+func (t *Table) rebuild(ctx *sql.Context, ordinals []int, tableInfo ExtraTableInfo) error {
+	columns, err := queryColumns(ctx, t.db.catalog, t.db.name, t.name)
+	if err != nil {
+		return ErrDuckDB.New(err)
+	}
+	slices.SortFunc(columns, func(a, b *ColumnInfo) int { return a.ColumnIndex - b.ColumnIndex })
+
+	_, indexes, err := t.indexDefinitions(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	temporary := t.db.catalog == "temp"
+	fullTableName := FullTableName(t.db.catalog, t.db.name, t.name)
+	rebuildName := t.name + "$$rebuild"
+	fullRebuildName := FullTableName(t.db.catalog, t.db.name, rebuildName)
+
+	var sqls []string
+
+	// Create the copy with the new primary key
+	var b strings.Builder
+	if temporary {
+		b.WriteString(`CREATE TEMP TABLE ` + QuoteIdentifierANSI(rebuildName) + ` (`)
+	} else {
+		b.WriteString(`CREATE TABLE ` + fullRebuildName + ` (`)
+	}
+	for i, column := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(QuoteIdentifierANSI(column.ColumnName))
+		b.WriteString(" ")
+		b.WriteString(column.DuckType)
+		if !column.IsNullable || slices.Contains(ordinals, i) {
+			b.WriteString(" NOT NULL")
+		}
+		if column.ColumnDefault.Valid {
+			b.WriteString(" DEFAULT ")
+			b.WriteString(column.ColumnDefault.String)
+		}
+	}
+	if len(ordinals) > 0 {
+		keys := make([]string, len(ordinals))
+		for i, ord := range ordinals {
+			keys[i] = QuoteIdentifierANSI(columns[ord].ColumnName)
+		}
+		b.WriteString(", PRIMARY KEY (" + strings.Join(keys, ", ") + ")")
+	}
+	b.WriteString(")")
+	sqls = append(sqls, b.String())
+
+	// Move the rows, then replace the original table with the copy
+	sqls = append(sqls,
+		`INSERT INTO `+fullRebuildName+` SELECT * FROM `+fullTableName,
+		`DROP TABLE `+fullTableName,
+		`ALTER TABLE `+fullRebuildName+` RENAME TO `+QuoteIdentifierANSI(t.name),
+	)
+
+	// Restore the comments and the secondary indexes
+	comment := NewCommentWithMeta(t.comment.Text, tableInfo)
+	sqls = append(sqls, `COMMENT ON TABLE `+fullTableName+` IS '`+comment.Encode()+`'`)
+	for _, column := range columns {
+		if column.Comment.Valid {
+			sqls = append(sqls, `COMMENT ON COLUMN `+FullColumnName(t.db.catalog, t.db.name, t.name, column.ColumnName)+` IS '`+strings.ReplaceAll(column.Comment.String, "'", "''")+`'`)
+		}
+	}
+	sqls = append(sqls, indexes...)
+
+	// Rebuild the table atomically
+	joinedSQL := strings.Join(sqls, "; ")
+	if err := execAtomically(ctx, joinedSQL); err != nil {
+		ctx.GetLogger().WithError(err).Errorf("Failed to execute DuckDB SQL: %s", joinedSQL)
+		if IsDuckDBUniqueConstraintViolationError(err) || strings.Contains(err.Error(), "Duplicate key") {
+			return sql.ErrUniqueKeyViolation.New()
+		}
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// indexDefinitions returns the statements that drop the secondary indexes of the table,
+// and the ones that recreate them along with their comments, with the columns renamed by the given mapping.
+func (t *Table) indexDefinitions(ctx *sql.Context, renamed map[string]string) (drops []string, creates []string, err error) {
+	rows, err := adapter.QueryCatalog(ctx, `SELECT index_name, is_unique, comment, sql FROM duckdb_indexes() WHERE (database_name = ? AND schema_name = ? AND table_name = ?) or (database_name = 'temp' AND schema_name = 'main' AND table_name = ?)`,
+		t.db.catalog, t.db.name, t.name, t.name)
+	if err != nil {
+		return nil, nil, ErrDuckDB.New(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var indexName, createIndexSQL string
+		var isUnique bool
+		var comment stdsql.NullString
+		if err := rows.Scan(&indexName, &isUnique, &comment, &createIndexSQL); err != nil {
+			return nil, nil, ErrDuckDB.New(err)
+		}
+
+		columnNames, err := DecodeCreateindex(createIndexSQL)
+		if err != nil {
+			return nil, nil, ErrDuckDB.New(err)
+		}
+		for i, name := range columnNames {
+			for from, to := range renamed {
+				if strings.EqualFold(name, from) {
+					name = to
+					break
+				}
+			}
+			columnNames[i] = QuoteIdentifierANSI(name)
+		}
+
+		unique := ""
+		if isUnique {
+			unique = "UNIQUE "
+		}
+		drops = append(drops, `DROP INDEX `+FullIndexName(t.db.catalog, t.db.name, indexName))
+		creates = append(creates, `CREATE `+unique+`INDEX `+QuoteIdentifierANSI(indexName)+` ON `+FullTableName(t.db.catalog, t.db.name, t.name)+` (`+strings.Join(columnNames, ", ")+`)`)
+		if comment.String != "" {
+			creates = append(creates, `COMMENT ON INDEX `+FullIndexName(t.db.catalog, t.db.name, indexName)+` IS '`+strings.ReplaceAll(comment.String, "'", "''")+`'`)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, ErrDuckDB.New(err)
+	}
+	return drops, creates, nil
+}
+
+// execAtomically executes the statements in the current transaction,
+// or in a transaction of their own if there is no current transaction.
+func execAtomically(ctx *sql.Context, query string) error {
+	if adapter.TryGetTxn(ctx) != nil {
+		_, err := adapter.Exec(ctx, query)
+		return err
+	}
+	conn, err := adapter.GetConn(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -6,9 +6,11 @@ import (
 	"github.com/sirupsen/logrus"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	stdsql "database/sql"
 
@@ -31,49 +33,178 @@ type DatabaseProvider struct {
 	dbFile                    string
 	dsn                       string
 	externalProcedureRegistry sql.ExternalStoredProcedureRegistry
+	tableFunctions            map[string]sql.TableFunction
+	mysqlScanner              bool   // whether the mysql extension is loaded
+	vectorIndexes             bool   // whether the vss extension is enabled and loaded
+	readOnly                  bool   // whether the database files are opened in read-only mode
+	snapshot                  string // the version of the files opened in read-only mode, see Refresh
+	settings                  map[string]string
+	overQuotaTenants          *sync.Map // the tenants above their storage quotas, see CheckTenantQuota
+	tenantNames               *sync.Map // the names of the tenants by their lower-cased names, see TenantReferences
+	tenantGrants              *sync.Map // the grants of the tenants by tenantGrantKey, see GrantTenant
 	ready                     bool
 }
 
 var _ sql.DatabaseProvider = (*DatabaseProvider)(nil)
 var _ sql.MutableDatabaseProvider = (*DatabaseProvider)(nil)
 var _ sql.ExternalStoredProcedureProvider = (*DatabaseProvider)(nil)
+var _ sql.TableFunctionProvider = (*DatabaseProvider)(nil)
 var _ configuration.DataDirProvider = (*DatabaseProvider)(nil)
 
 const readOnlySuffix = "?access_mode=read_only"
 
+// ProviderOptions are the options of NewDBProvider.
+type ProviderOptions struct {
+	// DataDir is the directory of the database files, which defaults to the current directory.
+	DataDir string
+	// DefaultDB is the name of the default database. The default database is in memory if it is empty or "memory".
+	DefaultDB string
+	// DBFile is the name of the file of the default database in DataDir, which defaults to DefaultDB + ".db".
+	DBFile string
+	// DefaultTimeZone is the time zone of DuckDB, e.g., "UTC" or "Asia/Shanghai". It is the local time zone if empty.
+	DefaultTimeZone string
+	// ReadOnly opens the database files in read-only mode. The catalog must have been initialized by a writer.
+	ReadOnly bool
+	// Settings are the global settings of DuckDB applied on startup, e.g., {"memory_limit": "8GB"}.
+	Settings map[string]string
+	// VectorIndexes loads the vss extension for the HNSW indexes of the vectors, which must have been installed,
+	// e.g., by `--init --vector-indexes`. The indexes of the database files are only persisted if the experimental
+	// setting hnsw_enable_experimental_persistence is set as well.
+	VectorIndexes bool
+}
+
+// validate checks the options and fills in their defaults.
+func (opts *ProviderOptions) validate() error {
+	if opts.DataDir == "" {
+		opts.DataDir = "."
+	}
+	if opts.DefaultDB == "memory" {
+		opts.DefaultDB = ""
+	}
+	if opts.DefaultDB == "" {
+		if opts.DBFile != "" {
+			return fmt.Errorf("the file %q of the default database is given, but the default database is in memory", opts.DBFile)
+		}
+		if opts.ReadOnly {
+			return fmt.Errorf("the default database in memory cannot be read-only")
+		}
+	} else {
+		if strings.ContainsAny(opts.DefaultDB, `/\`) || opts.DefaultDB == "." || opts.DefaultDB == ".." {
+			return fmt.Errorf("invalid default database name %q", opts.DefaultDB)
+		}
+		if opts.DBFile == "" {
+			opts.DBFile = opts.DefaultDB + ".db"
+		} else if filepath.Base(opts.DBFile) != opts.DBFile {
+			return fmt.Errorf("the file %q of the default database must be in the data directory", opts.DBFile)
+		}
+	}
+	if info, err := os.Stat(opts.DataDir); err != nil {
+		return fmt.Errorf("invalid data directory: %w", err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("invalid data directory: %s is not a directory", opts.DataDir)
+	}
+	for name := range opts.Settings {
+		if !simpleIdentifierRegex.MatchString(name) {
+			return fmt.Errorf("invalid setting name %q", name)
+		}
+	}
+	return nil
+}
+
+var simpleIdentifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 func NewInMemoryDBProvider() *DatabaseProvider {
-	prov, err := NewDBProvider("", ".", "")
+	prov, err := NewDBProvider(ProviderOptions{})
 	if err != nil {
 		panic(err)
 	}
 	return prov
 }
 
-func NewDBProvider(defaultTimeZone, dataDir, defaultDB string) (prov *DatabaseProvider, err error) {
+func NewDBProvider(opts ProviderOptions) (prov *DatabaseProvider, err error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	freezeInternalExtensions()
 	prov = &DatabaseProvider{
 		mu:                        &sync.RWMutex{},
-		defaultTimeZone:           defaultTimeZone,
+		overQuotaTenants:          &sync.Map{},
+		tenantNames:               &sync.Map{},
+		tenantGrants:              &sync.Map{},
+		defaultTimeZone:           opts.DefaultTimeZone,
 		externalProcedureRegistry: sql.NewExternalStoredProcedureRegistry(), // This has no effect, just to satisfy the upper layer interface
-		dataDir:                   dataDir,
+		tableFunctions:            make(map[string]sql.TableFunction),
+		dataDir:                   opts.DataDir,
+		readOnly:                  opts.ReadOnly,
+		settings:                  opts.Settings,
+		vectorIndexes:             opts.VectorIndexes,
 	}
 
-	if defaultDB == "" || defaultDB == "memory" {
+	if opts.DefaultDB == "" {
 		prov.defaultCatalogName = "memory"
 		prov.dbFile = ""
 		prov.dsn = ""
 	} else {
-		prov.defaultCatalogName = defaultDB
-		prov.dbFile = defaultDB + ".db"
+		prov.defaultCatalogName = opts.DefaultDB
+		prov.dbFile = opts.DBFile
 		prov.dsn = filepath.Join(prov.dataDir, prov.dbFile)
 	}
 
-	prov.connector, err = duckdb.NewConnector(prov.dsn, nil)
+	dsn := prov.dsn
+	if prov.readOnly {
+		dsn += readOnlySuffix
+		// The version is taken before the files are opened, so that a change in between is picked up by Refresh.
+		if prov.snapshot, err = prov.snapshotVersion(); err != nil {
+			return nil, err
+		}
+	}
+	prov.connector, err = duckdb.NewConnector(dsn, nil)
 	if err != nil {
 		return nil, err
 	}
 	prov.storage = stdsql.OpenDB(prov.connector)
 	prov.pool = NewConnectionPool(prov.connector, prov.storage)
+	prov.pool.sessions = newTenantSessions(prov.tenantConnectionLimit, prov.TenantGranted)
+
+	if err := prov.loadExtensions(); err != nil {
+		prov.storage.Close()
+		prov.connector.Close()
+		return nil, err
+	}
 
+	// The catalog is initialized and migrated by the writers only.
+	if !prov.readOnly {
+		err = prov.initCatalog()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = prov.applySettings()
+	if err != nil {
+		return nil, err
+	}
+
+	err = prov.attachCatalogs()
+	if err != nil {
+		return nil, err
+	}
+
+	err = prov.attachForeignServers()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := prov.loadTenants(); err != nil {
+		logrus.WithError(err).Warnln("Failed to load the tenants")
+	}
+
+	prov.ready = true
+	return prov, nil
+}
+
+// loadExtensions installs and loads the extensions of DuckDB into the opened database.
+func (prov *DatabaseProvider) loadExtensions() error {
 	bootQueries := []string{
 		"INSTALL arrow",
 		"LOAD arrow",
@@ -85,24 +216,38 @@ func NewDBProvider(defaultTimeZone, dataDir, defaultDB string) (prov *DatabasePr
 
 	for _, q := range bootQueries {
 		if _, err := prov.storage.ExecContext(context.Background(), q); err != nil {
-			prov.storage.Close()
-			prov.connector.Close()
-			return nil, fmt.Errorf("failed to execute boot query %q: %w", q, err)
+			return fmt.Errorf("failed to execute boot query %q: %w", q, err)
 		}
 	}
 
-	err = prov.initCatalog()
-	if err != nil {
-		return nil, err
+	// The vss extension provides the HNSW indexes of the vectors. It is opt-in and only loaded here,
+	// so the server neither downloads it nor enables its experimental persistence by default.
+	if prov.vectorIndexes {
+		if _, err := prov.storage.ExecContext(context.Background(), "LOAD vss"); err != nil {
+			logrus.WithError(err).Warnln("Failed to load the vss extension; the HNSW indexes are unavailable")
+			prov.vectorIndexes = false
+		}
 	}
 
-	err = prov.attachCatalogs()
-	if err != nil {
-		return nil, err
+	// The mysql extension provides the federated queries against MySQL servers, see mysql_scanner.go.
+	// It is optional as well, since it is not built for all platforms.
+	prov.mysqlScanner = true
+	for _, q := range []string{
+		"INSTALL mysql_scanner",
+		"LOAD mysql_scanner",
+	} {
+		if _, err := prov.storage.ExecContext(context.Background(), q); err != nil {
+			logrus.WithError(err).Warnf("Failed to execute optional boot query %q; mysql_query() is unavailable", q)
+			prov.mysqlScanner = false
+			break
+		}
 	}
+	return nil
+}
 
-	prov.ready = true
-	return prov, nil
+// HasVectorIndexes reports whether the vss extension is enabled and loaded, see ProviderOptions.VectorIndexes.
+func (prov *DatabaseProvider) HasVectorIndexes() bool {
+	return prov.vectorIndexes
 }
 
 func (prov *DatabaseProvider) initCatalog() error {
@@ -117,26 +262,8 @@ func (prov *DatabaseProvider) initCatalog() error {
 	}
 
 	for _, t := range internalTables {
-		if _, err := prov.storage.ExecContext(
-			context.Background(),
-			"CREATE SCHEMA IF NOT EXISTS "+t.Schema,
-		); err != nil {
-			return fmt.Errorf("failed to create internal schema %q: %w", t.Schema, err)
-		}
-		if _, err := prov.storage.ExecContext(
-			context.Background(),
-			"CREATE TABLE IF NOT EXISTS "+t.QualifiedName()+"("+t.DDL+")",
-		); err != nil {
-			return fmt.Errorf("failed to create internal table %q: %w", t.Name, err)
-		}
-		for _, row := range t.InitialData {
-			if _, err := prov.storage.ExecContext(
-				context.Background(),
-				t.UpsertStmt(),
-				row...,
-			); err != nil {
-				return fmt.Errorf("failed to insert initial data into internal table %q: %w", t.Name, err)
-			}
+		if err := prov.createInternalTable(t); err != nil {
+			return err
 		}
 
 		initialFileContent := initialdata.InitialTableDataMap[t.Name]
@@ -177,56 +304,28 @@ func (prov *DatabaseProvider) initCatalog() error {
 		}
 	}
 
-	for _, v := range InternalViews {
-		if _, err := prov.storage.ExecContext(
-			context.Background(),
-			"CREATE SCHEMA IF NOT EXISTS "+v.Schema,
-		); err != nil {
-			return fmt.Errorf("failed to create internal schema %q: %w", v.Schema, err)
-		}
-		if _, err := prov.storage.ExecContext(
-			context.Background(),
-			"CREATE VIEW IF NOT EXISTS "+v.QualifiedName()+" AS "+v.DDL,
-		); err != nil {
-			return fmt.Errorf("failed to create internal view %q: %w", v.Name, err)
-		}
+	if err := migrateCatalog(context.Background(), prov.storage, CatalogMigrations); err != nil {
+		return err
 	}
 
-	for _, m := range InternalMacros {
-		if _, err := prov.storage.ExecContext(
-			context.Background(),
-			"CREATE SCHEMA IF NOT EXISTS "+m.Schema,
-		); err != nil {
-			return fmt.Errorf("failed to create internal schema %q: %w", m.Schema, err)
-		}
-		definitions := make([]string, 0, len(m.Definitions))
-		for _, d := range m.Definitions {
-			macroParams := strings.Join(d.Params, ", ")
-			var asType string
-			if m.IsTableMacro {
-				asType = "TABLE\n"
-			} else {
-				asType = "\n"
+	// The tables of the extensions are created and migrated after the built-in ones, see RegisterInternalExtension.
+	for _, ext := range registeredInternalExtensions() {
+		for _, t := range ext.Tables {
+			if err := prov.createInternalTable(t); err != nil {
+				return err
 			}
-			definitions = append(definitions, fmt.Sprintf("\n(%s) AS %s%s", macroParams, asType, d.DDL))
 		}
-		if _, err := prov.storage.ExecContext(
-			context.Background(),
-			"CREATE OR REPLACE MACRO "+m.QualifiedName()+strings.Join(definitions, ",")+";",
-		); err != nil {
-			return fmt.Errorf("failed to create internal macro %q: %w", m.Name, err)
+		if err := migrateComponent(context.Background(), prov.storage, extensionComponent(ext.Name), ext.Migrations); err != nil {
+			return err
 		}
 	}
 
-	if _, err := prov.pool.ExecContext(context.Background(), "PRAGMA enable_checkpoint_on_shutdown"); err != nil {
-		logrus.WithError(err).Fatalln("Failed to enable checkpoint on shutdown")
+	if err := createInternalObjects(context.Background(), prov.storage); err != nil {
+		return err
 	}
 
-	if prov.defaultTimeZone != "" {
-		_, err := prov.pool.ExecContext(context.Background(), fmt.Sprintf(`SET TimeZone = '%s'`, prov.defaultTimeZone))
-		if err != nil {
-			logrus.WithError(err).Fatalln("Failed to set the default time zone")
-		}
+	if _, err := prov.pool.ExecContext(context.Background(), "PRAGMA enable_checkpoint_on_shutdown"); err != nil {
+		logrus.WithError(err).Fatalln("Failed to enable checkpoint on shutdown")
 	}
 
 	// Postgres tables are created in the `public` schema by default.
@@ -238,21 +337,101 @@ func (prov *DatabaseProvider) initCatalog() error {
 	return nil
 }
 
+// createInternalTable creates the internal table if it does not exist, and upserts its initial data.
+func (prov *DatabaseProvider) createInternalTable(t InternalTable) error {
+	if _, err := prov.storage.ExecContext(
+		context.Background(),
+		"CREATE SCHEMA IF NOT EXISTS "+t.Schema,
+	); err != nil {
+		return fmt.Errorf("failed to create internal schema %q: %w", t.Schema, err)
+	}
+	if _, err := prov.storage.ExecContext(
+		context.Background(),
+		"CREATE TABLE IF NOT EXISTS "+t.QualifiedName()+"("+t.DDL+")",
+	); err != nil {
+		return fmt.Errorf("failed to create internal table %q: %w", t.Name, err)
+	}
+	for _, row := range t.InitialData {
+		if _, err := prov.storage.ExecContext(
+			context.Background(),
+			t.UpsertStmt(),
+			row...,
+		); err != nil {
+			return fmt.Errorf("failed to insert initial data into internal table %q: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// applySettings sets the default time zone and the global settings of DuckDB.
+// They are applied again when the database is reopened by Restart.
+func (prov *DatabaseProvider) applySettings() error {
+	settings := prov.settings
+	if prov.defaultTimeZone != "" {
+		if _, err := prov.storage.ExecContext(context.Background(), "SET GLOBAL TimeZone = "+quoteStringLiteral(prov.defaultTimeZone)); err != nil {
+			return fmt.Errorf("invalid default time zone %q: %w", prov.defaultTimeZone, err)
+		}
+	}
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := prov.storage.ExecContext(context.Background(), "SET GLOBAL "+name+" = "+quoteStringLiteral(settings[name])); err != nil {
+			return fmt.Errorf("invalid setting %s = %q: %w", name, settings[name], err)
+		}
+	}
+	return nil
+}
+
 func (prov *DatabaseProvider) IsReady() bool {
 	return prov.ready
 }
 
-func (prov *DatabaseProvider) HasCatalog(name string) bool {
-	name = strings.TrimSpace(name)
-	// in memory database does not need to be created
-	if name == "" || name == "memory" {
-		return true
+// Ping checks that the catalog is open and DuckDB is responsive.
+// It waits until the catalog is restarted, e.g., for a backup, or the context is done.
+func (prov *DatabaseProvider) Ping(ctx context.Context) error {
+	for !prov.mu.TryRLock() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the catalog is locked: %w", ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
 	}
+	defer prov.mu.RUnlock()
 
-	dsn := filepath.Join(prov.dataDir, name+".db")
-	// if already exists, return error
-	_, err := os.Stat(dsn)
-	return os.IsExist(err)
+	if !prov.ready {
+		return fmt.Errorf("the catalog is not initialized")
+	}
+	var one int
+	return prov.storage.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+func (prov *DatabaseProvider) HasCatalog(name string) bool {
+	_, _, ok, err := prov.LookupCatalog(name)
+	return err == nil && ok
+}
+
+// LookupCatalog finds the attached catalog with the given name, ignoring case, and returns its actual name
+// along with the schema that a PostgreSQL connection to it starts in, i.e., public if the catalog has one,
+// or main otherwise. The internal catalogs of DuckDB, system and temp, are never found.
+func (prov *DatabaseProvider) LookupCatalog(name string) (catalog string, schema string, ok bool, err error) {
+	var hasPublic bool
+	err = prov.storage.QueryRowContext(context.Background(),
+		`SELECT database_name, EXISTS (SELECT 1 FROM information_schema.schemata s WHERE s.catalog_name = d.database_name AND s.schema_name = 'public')
+		FROM duckdb_databases() d WHERE NOT internal AND lower(database_name) = lower(?) LIMIT 1`,
+		strings.TrimSpace(name),
+	).Scan(&catalog, &hasPublic)
+	if err == stdsql.ErrNoRows {
+		return "", "", false, nil
+	} else if err != nil {
+		return "", "", false, err
+	}
+	if hasPublic {
+		return catalog, "public", true, nil
+	}
+	return catalog, "main", true, nil
 }
 
 // attachCatalogs attaches all the databases in the data directory
@@ -287,7 +466,11 @@ func (prov *DatabaseProvider) AttachCatalog(file interface {
 		return fmt.Errorf("file %s is not a database file", file.Name())
 	}
 	name := strings.TrimSuffix(file.Name(), ".db")
-	if _, err := prov.storage.ExecContext(context.Background(), "ATTACH IF NOT EXISTS '"+filepath.Join(prov.dataDir, file.Name())+"' AS "+name); err != nil {
+	attachSQL := "ATTACH IF NOT EXISTS '" + filepath.Join(prov.dataDir, file.Name()) + "' AS " + name
+	if prov.readOnly {
+		attachSQL += " (READ_ONLY)"
+	}
+	if _, err := prov.storage.ExecContext(context.Background(), attachSQL); err != nil {
 		return fmt.Errorf("failed to attach database %s: %w", name, err)
 	}
 	return nil
@@ -410,6 +593,28 @@ func (prov *DatabaseProvider) ExternalStoredProcedures(ctx *sql.Context, name st
 	return prov.externalProcedureRegistry.LookupByName(name)
 }
 
+// RegisterTableFunctions registers the table functions of the MySQL protocol, e.g., mysql_query.
+// It must be called before the server starts.
+func (prov *DatabaseProvider) RegisterTableFunctions(fns ...sql.TableFunction) {
+	for _, fn := range fns {
+		prov.tableFunctions[strings.ToLower(fn.Name())] = fn
+	}
+}
+
+// TableFunction implements sql.TableFunctionProvider.
+func (prov *DatabaseProvider) TableFunction(ctx *sql.Context, name string) (sql.TableFunction, bool) {
+	fn, ok := prov.tableFunctions[strings.ToLower(name)]
+	return fn, ok
+}
+
+// WithTableFunctions implements sql.TableFunctionProvider.
+func (prov *DatabaseProvider) WithTableFunctions(fns ...sql.TableFunction) (sql.TableFunctionProvider, error) {
+	cp := *prov
+	cp.tableFunctions = make(map[string]sql.TableFunction, len(fns))
+	cp.RegisterTableFunctions(fns...)
+	return &cp, nil
+}
+
 // AllDatabases implements sql.DatabaseProvider.
 func (prov *DatabaseProvider) AllDatabases(ctx *sql.Context) []sql.Database {
 	prov.mu.RLock()
@@ -429,8 +634,7 @@ func (prov *DatabaseProvider) AllDatabases(ctx *sql.Context) []sql.Database {
 			panic(ErrDuckDB.New(err))
 		}
 
-		switch schemaName {
-		case "information_schema", "pg_catalog", "__sys__", "mysql":
+		if SchemaKindOf(schemaName) == ReservedSchema {
 			continue
 		}
 
@@ -450,13 +654,13 @@ func (prov *DatabaseProvider) Database(ctx *sql.Context, name string) (sql.Datab
 	defer prov.mu.RUnlock()
 
 	catalogName := adapter.GetCurrentCatalog(ctx)
-	ok, err := hasDatabase(ctx, catalogName, name)
+	schemaName, ok, err := resolveDatabase(ctx, catalogName, name)
 	if err != nil {
 		return nil, err
 	}
 
 	if ok {
-		return NewDatabase(name, catalogName), nil
+		return NewDatabase(schemaName, catalogName), nil
 	}
 	return nil, sql.ErrDatabaseNotFound.New(name)
 }
@@ -466,7 +670,7 @@ func (prov *DatabaseProvider) HasDatabase(ctx *sql.Context, name string) bool {
 	prov.mu.RLock()
 	defer prov.mu.RUnlock()
 
-	ok, err := hasDatabase(ctx, adapter.GetCurrentCatalog(ctx), name)
+	_, ok, err := resolveDatabase(ctx, adapter.GetCurrentCatalog(ctx), name)
 	if err != nil {
 		panic(err)
 	}
@@ -474,22 +678,17 @@ func (prov *DatabaseProvider) HasDatabase(ctx *sql.Context, name string) bool {
 	return ok
 }
 
-func hasDatabase(ctx *sql.Context, catalog string, name string) (bool, error) {
-	rows, err := adapter.QueryCatalog(ctx, "SELECT DISTINCT schema_name FROM information_schema.schemata WHERE catalog_name = ? AND schema_name ILIKE ?", catalog, name)
-	if err != nil {
-		return false, ErrDuckDB.New(err)
-	}
-	defer rows.Close()
-	return rows.Next(), nil
-}
-
 // CreateDatabase implements sql.MutableDatabaseProvider.
 func (prov *DatabaseProvider) CreateDatabase(ctx *sql.Context, name string) error {
+	if err := checkCreateDatabase(name); err != nil {
+		return err
+	}
+
 	prov.mu.Lock()
 	defer prov.mu.Unlock()
 
 	_, err := adapter.ExecCatalog(ctx, fmt.Sprintf(`CREATE SCHEMA %s`,
-		FullSchemaName(adapter.GetCurrentCatalog(ctx), name)))
+		FullSchemaName(adapter.GetCurrentCatalog(ctx), newDatabaseSchemaName(name))))
 	if err != nil {
 		return ErrDuckDB.New(err)
 	}
@@ -499,6 +698,10 @@ func (prov *DatabaseProvider) CreateDatabase(ctx *sql.Context, name string) erro
 
 // DropDatabase implements sql.MutableDatabaseProvider.
 func (prov *DatabaseProvider) DropDatabase(ctx *sql.Context, name string) error {
+	if err := checkDropDatabase(name); err != nil {
+		return err
+	}
+
 	prov.mu.Lock()
 	defer prov.mu.Unlock()
 
@@ -533,5 +736,11 @@ func (prov *DatabaseProvider) Restart(readOnly bool) error {
 	prov.connector = connector
 	prov.storage = storage
 
-	return prov.pool.Reset(connector, storage)
+	if err := prov.pool.Reset(connector, storage); err != nil {
+		return err
+	}
+	if err := prov.applySettings(); err != nil {
+		logrus.WithError(err).Warnln("Failed to apply the settings to the reopened database")
+	}
+	return nil
 }
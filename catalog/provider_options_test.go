@@ -0,0 +1,56 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	opts := ProviderOptions{}
+	require.NoError(t, opts.validate())
+	require.Equal(t, ".", opts.DataDir)
+	require.Empty(t, opts.DBFile)
+
+	opts = ProviderOptions{DataDir: dir, DefaultDB: "mydb"}
+	require.NoError(t, opts.validate())
+	require.Equal(t, "mydb.db", opts.DBFile)
+
+	opts = ProviderOptions{DataDir: dir, DefaultDB: "memory"}
+	require.NoError(t, opts.validate())
+	require.Empty(t, opts.DefaultDB)
+
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+	for _, opts := range []ProviderOptions{
+		{DataDir: filepath.Join(dir, "missing"), DefaultDB: "mydb"},
+		{DataDir: file, DefaultDB: "mydb"},
+		{DataDir: dir, DefaultDB: "../mydb"},
+		{DataDir: dir, DefaultDB: "mydb", DBFile: "sub/mydb.db"},
+		{DataDir: dir, DBFile: "mydb.db"},
+		{DataDir: dir, ReadOnly: true},
+		{DataDir: dir, DefaultDB: "mydb", Settings: map[string]string{"threads; DROP TABLE t": "1"}},
+	} {
+		require.Error(t, opts.validate(), "%+v", opts)
+	}
+}
+
+func TestApplySettings(t *testing.T) {
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	prov := &DatabaseProvider{storage: db, settings: map[string]string{"threads": "3", "memory_limit": "1GB"}}
+	require.NoError(t, prov.applySettings())
+	var threads int
+	require.NoError(t, db.QueryRow("SELECT current_setting('threads')").Scan(&threads))
+	require.Equal(t, 3, threads)
+
+	prov.settings = map[string]string{"no_such_setting": "1"}
+	require.Error(t, prov.applySettings())
+}
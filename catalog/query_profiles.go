@@ -0,0 +1,59 @@
+package catalog
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaxQueryProfiles is the number of the latest query profiles kept in InternalTables.QueryProfiles.
+// The older ones are deleted when a new one is recorded.
+const MaxQueryProfiles = 10000
+
+// QueryProfilesView is the internal view of the query profiles, which reads InternalTables.QueryProfiles.
+const QueryProfilesView = "query_profiles"
+
+// QueryProfileRelations are the names of the relations that the query profiles are read from.
+// The users other than the superusers read their own profiles only: the PostgreSQL handler filters the relations
+// by QueryProfilePredicate, and the MySQL handler refuses them, since the profiles are captured over PostgreSQL only.
+var QueryProfileRelations = []string{InternalTables.QueryProfiles.Name, QueryProfilesView}
+
+// IsQueryProfileRelation reports whether a relation is one of QueryProfileRelations. The schema is not compared,
+// since an unqualified name may be resolved in the internal schema through the search_path.
+func IsQueryProfileRelation(name string) bool {
+	return slices.Contains(QueryProfileRelations, strings.ToLower(name))
+}
+
+// QueryProfilePredicate returns the expression that the profiles of a user satisfy.
+func QueryProfilePredicate(user string) string {
+	return "user_name = " + quoteString(user)
+}
+
+// QueryProfile is the profile of a query captured while `myduck.profiling` is enabled on a session.
+type QueryProfile struct {
+	QueryID      string
+	ConnectionID uint32
+	User         string
+	Query        string
+	StartedAt    time.Time
+	Latency      time.Duration
+	Plan         string // the profile tree in JSON format
+}
+
+// RecordQueryProfile records a query profile in a catalog, and deletes the profiles beyond MaxQueryProfiles.
+// It runs outside the transaction of the session, so the profile is kept even if the query is rolled back.
+func (prov *DatabaseProvider) RecordQueryProfile(catalogName string, p QueryProfile) error {
+	table := FullTableName(catalogName, InternalTables.QueryProfiles.Schema, InternalTables.QueryProfiles.Name)
+	if _, err := prov.storage.ExecContext(context.Background(),
+		"INSERT OR REPLACE INTO "+table+" (query_id, connection_id, query, started_at, latency_ms, plan, user_name) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		p.QueryID, p.ConnectionID, p.Query, p.StartedAt.UTC(), float64(p.Latency.Microseconds())/1000, p.Plan, p.User,
+	); err != nil {
+		return err
+	}
+	_, err := prov.storage.ExecContext(context.Background(),
+		"DELETE FROM "+table+" WHERE started_at < (SELECT started_at FROM "+table+" ORDER BY started_at DESC LIMIT 1 OFFSET ?)",
+		MaxQueryProfiles-1,
+	)
+	return err
+}
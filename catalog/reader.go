@@ -0,0 +1,115 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/marcboeker/go-duckdb"
+	"github.com/sirupsen/logrus"
+)
+
+// A reader is a server that opens the database files of a writer in read-only mode, to scale out the reads
+// beyond a single process. DuckDB allows many processes to open a file in read-only mode, but none of them
+// while a process has it open for writing, so a reader serves a snapshot of the files, e.g., shared storage
+// where the files are replaced when the writer checkpoints and releases them, or the files restored from backups.
+//
+// The reader reopens the files periodically to pick up a newer snapshot, see Refresh. The internal catalog
+// is initialized and migrated by the writer, and the reader rejects all the writes.
+
+// ErrRefreshBusy is returned by Refresh if the sessions have transactions open, which would be aborted by a refresh.
+var ErrRefreshBusy = errors.New("the snapshot is in use by open transactions")
+
+// IsReadOnly reports whether the database files are opened in read-only mode, i.e., whether the server is a reader.
+func (prov *DatabaseProvider) IsReadOnly() bool {
+	return prov.readOnly
+}
+
+// snapshotVersion identifies the snapshot of the database files in the data directory by their sizes
+// and modification times, which change whenever a file is checkpointed or replaced.
+func (prov *DatabaseProvider) snapshotVersion() (string, error) {
+	files, err := os.ReadDir(prov.dataDir)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !(strings.HasSuffix(name, ".db") || strings.HasSuffix(name, ".db.wal")) {
+			continue
+		}
+		info, err := file.Info()
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		b.WriteString(name + ":" + strconv.FormatInt(info.Size(), 10) + ":" + strconv.FormatInt(info.ModTime().UnixNano(), 10) + ";")
+	}
+	return b.String(), nil
+}
+
+// Refresh reopens the database files of a reader if they have changed since they were opened, so that the new
+// sessions and queries see the latest snapshot. The sessions lose their connections to the previous snapshot,
+// so Refresh returns ErrRefreshBusy without reopening the files if any transaction is open, unless force is true.
+// The previous snapshot is kept if the files cannot be reopened, e.g., while a writer has them open.
+func (prov *DatabaseProvider) Refresh(force bool) (refreshed bool, err error) {
+	if !prov.readOnly {
+		return false, fmt.Errorf("only the read-only databases can be refreshed")
+	}
+	version, err := prov.snapshotVersion()
+	if err != nil {
+		return false, err
+	}
+
+	prov.mu.Lock()
+	defer prov.mu.Unlock()
+
+	if version == prov.snapshot {
+		return false, nil
+	}
+	if !force && prov.pool.HasTxns() {
+		return false, ErrRefreshBusy
+	}
+
+	// The new snapshot is opened alongside the previous one, which is closed only if the new one is ready.
+	connector, err := duckdb.NewConnector(prov.dsn+readOnlySuffix, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to open the snapshot: %w", err)
+	}
+	prevConnector, prevStorage := prov.connector, prov.storage
+	prov.connector, prov.storage = connector, stdsql.OpenDB(connector)
+	if err := prov.openSnapshot(); err != nil {
+		prov.storage.Close()
+		prov.connector.Close()
+		prov.connector, prov.storage = prevConnector, prevStorage
+		return false, fmt.Errorf("failed to open the snapshot: %w", err)
+	}
+
+	// The connections of the sessions to the previous snapshot are closed along with it,
+	// and the sessions connect to the new snapshot on their next queries.
+	if err := prov.pool.Reset(prov.connector, prov.storage); err != nil {
+		logrus.WithError(err).Warnln("Failed to close the connections to the previous snapshot")
+	}
+	prevStorage.Close()
+	prevConnector.Close()
+	prov.snapshot = version
+	return true, nil
+}
+
+// openSnapshot prepares the newly opened database files of a reader, the same as NewDBProvider does.
+func (prov *DatabaseProvider) openSnapshot() error {
+	if err := prov.loadExtensions(); err != nil {
+		return err
+	}
+	if err := prov.applySettings(); err != nil {
+		return err
+	}
+	if err := prov.attachCatalogs(); err != nil {
+		return err
+	}
+	return prov.attachForeignServers()
+}
@@ -0,0 +1,70 @@
+package catalog
+
+import (
+	"context"
+	stdsql "database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderRefresh(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// The writer initializes the catalog, and releases the file.
+	writer, err := NewDBProvider(ProviderOptions{DataDir: dir, DefaultDB: "myduck"})
+	require.NoError(t, err)
+	_, err = writer.Storage().Exec("CREATE TABLE t1 (i INTEGER)")
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	reader, err := NewDBProvider(ProviderOptions{DataDir: dir, DefaultDB: "myduck", ReadOnly: true})
+	require.NoError(t, err)
+	defer reader.Close()
+	require.True(t, reader.IsReadOnly())
+	_, err = reader.Storage().Exec("CREATE TABLE t2 (i INTEGER)")
+	require.Error(t, err)
+
+	// The snapshot is reopened only if the files have changed.
+	refreshed, err := reader.Refresh(false)
+	require.NoError(t, err)
+	require.False(t, refreshed)
+
+	// A newer snapshot replaces the file, e.g., synced from shared storage.
+	snapshot := filepath.Join(t.TempDir(), "myduck.db")
+	data, err := os.ReadFile(filepath.Join(dir, "myduck.db"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(snapshot, data, 0644))
+	db, err := stdsql.Open("duckdb", snapshot)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE t2 AS SELECT 42 AS i")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	require.NoError(t, os.Rename(snapshot, filepath.Join(dir, "myduck.db")))
+
+	// The refresh waits for the open transactions unless it is forced.
+	_, err = reader.Pool().GetTxn(ctx, 1, "", nil)
+	require.NoError(t, err)
+	_, err = reader.Refresh(false)
+	require.ErrorIs(t, err, ErrRefreshBusy)
+	refreshed, err = reader.Refresh(true)
+	require.NoError(t, err)
+	require.True(t, refreshed)
+	require.Nil(t, reader.Pool().TryGetTxn(1))
+
+	var i int
+	require.NoError(t, reader.Storage().QueryRow("SELECT i FROM t2").Scan(&i))
+	require.Equal(t, 42, i)
+	conn, err := reader.Pool().GetConn(ctx, 1)
+	require.NoError(t, err)
+	require.NoError(t, conn.QueryRowContext(ctx, "SELECT count(*) FROM t2").Scan(&i))
+	require.Equal(t, 1, i)
+
+	_, err = NewDBProvider(ProviderOptions{ReadOnly: true})
+	require.Error(t, err)
+	_, err = (&DatabaseProvider{}).Refresh(false)
+	require.Error(t, err)
+}
@@ -0,0 +1,280 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The row-level security restricts the rows of a table that the queries over PostgreSQL read and change,
+// like `ALTER TABLE ... ENABLE ROW LEVEL SECURITY` and `CREATE POLICY` of PostgreSQL:
+//
+//   - The owners of a table are the users that may alter it, who bypass the policies unless the row-level
+//     security of the table is forced. The privileges are checked by the PostgreSQL handler.
+//   - The USING expressions of the permissive policies that apply to a command and a user are combined with OR,
+//     and the ones of the restrictive policies are combined with AND. No row is visible without a permissive policy.
+//   - `current_user`, `session_user`, and `current_role` in the expressions refer to the user of the session.
+//
+// The tables and the policies are registered in InternalTables.RowSecurity and InternalTables.RowSecurityPolicies,
+// whose contents are cached until they are changed by the functions of this file. The policies are listed
+// in the pg_policies view. The predicates are injected into the queries by the PostgreSQL handler.
+
+// The commands of the row-level security policies.
+const (
+	PolicyCommandAll    = "ALL"
+	PolicyCommandSelect = "SELECT"
+	PolicyCommandInsert = "INSERT"
+	PolicyCommandUpdate = "UPDATE"
+	PolicyCommandDelete = "DELETE"
+)
+
+// PolicyRolePublic is the role of the policies that apply to all users.
+const PolicyRolePublic = "public"
+
+// RowSecurityPolicy is a policy created by CREATE POLICY.
+type RowSecurityPolicy struct {
+	Schema     string
+	Table      string
+	Name       string
+	Permissive bool
+	// Command is one of the PolicyCommand constants.
+	Command string
+	// Roles are the users to which the policy applies, or PolicyRolePublic.
+	Roles []string
+	// Using is the expression that the visible rows satisfy. It is empty if there is none.
+	Using string
+	// WithCheck is the expression that the new rows must satisfy. It is empty if there is none.
+	WithCheck string
+}
+
+// appliesTo reports whether the policy applies to a command of a user.
+func (p *RowSecurityPolicy) appliesTo(command, user string) bool {
+	if p.Command != PolicyCommandAll && p.Command != command {
+		return false
+	}
+	return slices.ContainsFunc(p.Roles, func(role string) bool {
+		return role == PolicyRolePublic || role == user
+	})
+}
+
+type rowSecurityTable struct {
+	enabled  bool
+	forced   bool
+	policies []*RowSecurityPolicy
+}
+
+// RowSecurity is the cached contents of the internal tables of the row-level security.
+type RowSecurity struct {
+	// tables are the tables by the lower-cased schema and name.
+	tables map[[2]string]*rowSecurityTable
+}
+
+var cachedRowSecurity atomic.Pointer[RowSecurity]
+
+func rowSecurityKey(schema, table string) [2]string {
+	return [2]string{strings.ToLower(schema), strings.ToLower(table)}
+}
+
+// LoadRowSecurity returns the row-level security of the tables.
+func LoadRowSecurity(ctx *sql.Context) (*RowSecurity, error) {
+	if rs := cachedRowSecurity.Load(); rs != nil {
+		return rs, nil
+	}
+	rs := &RowSecurity{tables: make(map[[2]string]*rowSecurityTable)}
+	rows, err := adapter.QueryCatalog(ctx, "SELECT schema_name, table_name, enabled, forced FROM "+
+		InternalTables.RowSecurity.QualifiedName())
+	if err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schema, table string
+		t := &rowSecurityTable{}
+		if err := rows.Scan(&schema, &table, &t.enabled, &t.forced); err != nil {
+			return nil, ErrDuckDB.New(err)
+		}
+		rs.tables[rowSecurityKey(schema, table)] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+
+	policies, err := adapter.QueryCatalog(ctx, "SELECT schema_name, table_name, policy_name, permissive, command, roles, "+
+		"coalesce(qual, ''), coalesce(with_check, '') FROM "+InternalTables.RowSecurityPolicies.QualifiedName()+
+		" ORDER BY policy_name")
+	if err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+	defer policies.Close()
+	for policies.Next() {
+		p := &RowSecurityPolicy{}
+		var roles string
+		if err := policies.Scan(&p.Schema, &p.Table, &p.Name, &p.Permissive, &p.Command, &roles, &p.Using, &p.WithCheck); err != nil {
+			return nil, ErrDuckDB.New(err)
+		}
+		p.Roles = strings.Split(roles, ",")
+		key := rowSecurityKey(p.Schema, p.Table)
+		t := rs.tables[key]
+		if t == nil {
+			// The policies of a table are kept while its row-level security is not enabled.
+			t = &rowSecurityTable{}
+			rs.tables[key] = t
+		}
+		t.policies = append(t.policies, p)
+	}
+	if err := policies.Err(); err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+
+	cachedRowSecurity.Store(rs)
+	return rs, nil
+}
+
+// ProtectedTables returns the lower-cased schemas and names of the tables whose rows are restricted for a user,
+// given whether the user owns a table.
+func (rs *RowSecurity) ProtectedTables(owns func(schema, table string) bool) [][2]string {
+	var tables [][2]string
+	for key, t := range rs.tables {
+		if t.enabled && (t.forced || !owns(key[0], key[1])) {
+			tables = append(tables, key)
+		}
+	}
+	return tables
+}
+
+var currentUserRegex = regexp.MustCompile(`(?i)\b(?:current_user|session_user|current_role)\b(?:\s*\(\s*\))?`)
+
+// Predicate returns the expression that the rows of a table read by a command of a user satisfy,
+// or false if the row-level security of the table is not enabled. The owners of the table are not
+// restricted unless it is forced, see ProtectedTables.
+func (rs *RowSecurity) Predicate(schema, table, command, user string) (string, bool) {
+	t := rs.tables[rowSecurityKey(schema, table)]
+	if t == nil || !t.enabled {
+		return "", false
+	}
+	var permissive, restrictive []string
+	for _, p := range t.policies {
+		if !p.appliesTo(command, user) {
+			continue
+		}
+		expr := "true"
+		if p.Using != "" {
+			expr = "(" + currentUserRegex.ReplaceAllLiteralString(p.Using, quoteString(user)) + ")"
+		}
+		if p.Permissive {
+			permissive = append(permissive, expr)
+		} else {
+			restrictive = append(restrictive, expr)
+		}
+	}
+	if len(permissive) == 0 {
+		return "false", true
+	}
+	predicate := "(" + strings.Join(permissive, " OR ") + ")"
+	for _, expr := range restrictive {
+		predicate += " AND " + expr
+	}
+	return predicate, true
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// SetRowSecurity enables or disables the row-level security of a table if enabled is not nil,
+// and forces it or not if forced is not nil. The user that enables it first is recorded.
+func SetRowSecurity(ctx *sql.Context, schema, table, user string, enabled, forced *bool) error {
+	if err := checkRowSecurityTable(ctx, schema, table); err != nil {
+		return err
+	}
+	owner, isEnabled, isForced := user, false, false
+	err := adapter.QueryRowCatalog(ctx, "SELECT owner_name, enabled, forced FROM "+InternalTables.RowSecurity.QualifiedName()+
+		" WHERE schema_name = ? AND table_name = ?", schema, table).Scan(&owner, &isEnabled, &isForced)
+	if err != nil && !errors.Is(err, stdsql.ErrNoRows) {
+		return ErrDuckDB.New(err)
+	}
+	if enabled != nil {
+		isEnabled = *enabled
+	}
+	if forced != nil {
+		isForced = *forced
+	}
+	defer cachedRowSecurity.Store(nil)
+	if _, err := adapter.ExecCatalog(ctx, InternalTables.RowSecurity.UpsertStmt(), schema, table, owner, isEnabled, isForced); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// CreateRowSecurityPolicy creates a policy of a table.
+func CreateRowSecurityPolicy(ctx *sql.Context, p *RowSecurityPolicy) error {
+	if err := checkRowSecurityTable(ctx, p.Schema, p.Table); err != nil {
+		return err
+	}
+	var n int
+	if err := adapter.QueryRowCatalog(ctx, "SELECT count(*) FROM "+InternalTables.RowSecurityPolicies.QualifiedName()+
+		" WHERE schema_name = ? AND table_name = ? AND policy_name = ?", p.Schema, p.Table, p.Name).Scan(&n); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	if n > 0 {
+		return fmt.Errorf("policy %q for table %q already exists", p.Name, p.Table)
+	}
+	// The expressions are validated against the columns of the table.
+	for _, expr := range []string{p.Using, p.WithCheck} {
+		if expr == "" {
+			continue
+		}
+		rows, err := adapter.Query(ctx, "SELECT 1 FROM "+FullTableName(adapter.GetCurrentCatalog(ctx), p.Schema, p.Table)+
+			" WHERE ("+currentUserRegex.ReplaceAllLiteralString(expr, "''")+") LIMIT 0")
+		if err != nil {
+			return fmt.Errorf("invalid expression of policy %q: %w", p.Name, err)
+		}
+		rows.Close()
+	}
+
+	var qual, withCheck any
+	if p.Using != "" {
+		qual = p.Using
+	}
+	if p.WithCheck != "" {
+		withCheck = p.WithCheck
+	}
+	defer cachedRowSecurity.Store(nil)
+	if _, err := adapter.ExecCatalog(ctx, InternalTables.RowSecurityPolicies.UpsertStmt(),
+		p.Schema, p.Table, p.Name, p.Permissive, p.Command, strings.Join(p.Roles, ","), qual, withCheck); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// DropRowSecurityPolicy drops a policy of a table, and returns false if it does not exist.
+func DropRowSecurityPolicy(ctx *sql.Context, schema, table, name string) (bool, error) {
+	defer cachedRowSecurity.Store(nil)
+	res, err := adapter.ExecCatalog(ctx, "DELETE FROM "+InternalTables.RowSecurityPolicies.QualifiedName()+
+		" WHERE schema_name = ? AND table_name = ? AND policy_name = ?", schema, table, name)
+	if err != nil {
+		return false, ErrDuckDB.New(err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// checkRowSecurityTable returns an error if the table does not exist in the current catalog.
+func checkRowSecurityTable(ctx *sql.Context, schema, table string) error {
+	var n int
+	if err := adapter.QueryRowCatalog(ctx, "SELECT count(*) FROM information_schema.tables WHERE table_catalog = current_database() "+
+		"AND table_schema = ? AND table_name = ? AND table_type = 'BASE TABLE'", schema, table).Scan(&n); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	if n == 0 {
+		return sql.ErrTableNotFound.New(table)
+	}
+	return nil
+}
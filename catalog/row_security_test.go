@@ -0,0 +1,50 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowSecurityPredicate(t *testing.T) {
+	rs := &RowSecurity{tables: map[[2]string]*rowSecurityTable{
+		{"public", "accounts"}: {
+			enabled: true,
+			policies: []*RowSecurityPolicy{
+				{Name: "own", Permissive: true, Command: PolicyCommandAll, Roles: []string{PolicyRolePublic}, Using: "owner = current_user"},
+				{Name: "team", Permissive: true, Command: PolicyCommandSelect, Roles: []string{"bob"}, Using: "team = 'x'"},
+				{Name: "active", Permissive: false, Command: PolicyCommandAll, Roles: []string{PolicyRolePublic}, Using: "active"},
+			},
+		},
+		{"public", "logs"}: {enabled: true},
+		{"public", "open"}: {enabled: false},
+	}}
+
+	pred, ok := rs.Predicate("public", "Accounts", PolicyCommandSelect, "alice")
+	require.True(t, ok)
+	require.Equal(t, "((owner = 'alice')) AND (active)", pred)
+
+	pred, ok = rs.Predicate("public", "accounts", PolicyCommandSelect, "bob")
+	require.True(t, ok)
+	require.Equal(t, "((owner = 'bob') OR (team = 'x')) AND (active)", pred)
+
+	pred, ok = rs.Predicate("public", "accounts", PolicyCommandDelete, "o'neil")
+	require.True(t, ok)
+	require.Equal(t, "((owner = 'o''neil')) AND (active)", pred)
+
+	// No row is visible without a permissive policy.
+	pred, ok = rs.Predicate("public", "logs", PolicyCommandSelect, "alice")
+	require.True(t, ok)
+	require.Equal(t, "false", pred)
+
+	_, ok = rs.Predicate("public", "open", PolicyCommandSelect, "alice")
+	require.False(t, ok)
+
+	// The owners bypass the policies unless they are forced.
+	none := func(schema, table string) bool { return false }
+	all := func(schema, table string) bool { return true }
+	require.ElementsMatch(t, [][2]string{{"public", "accounts"}, {"public", "logs"}}, rs.ProtectedTables(none))
+	require.Empty(t, rs.ProtectedTables(all))
+	rs.tables[[2]string{"public", "accounts"}].forced = true
+	require.ElementsMatch(t, [][2]string{{"public", "accounts"}}, rs.ProtectedTables(all))
+}
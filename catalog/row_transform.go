@@ -0,0 +1,15 @@
+package catalog
+
+// The rows of a replicated table may be filtered and transformed when its changes are flushed,
+// e.g., to keep the rows of a tenant only or to mask the personal data, by setting its storage parameters:
+//
+//	ALTER TABLE t SET (row_filter = 'tenant_id = 42', row_transform = 'email = NULL, phone = md5(phone)')
+//
+// The filter is a condition of the columns of the table. The rows that do not satisfy it are not inserted,
+// and the rows that no longer satisfy it after an update are deleted. The transform assigns an expression
+// of the columns of the table to each of the columns listed, which must not be a part of the primary key.
+// The expressions are evaluated by DuckDB. See InternalTables.RowTransforms.
+const (
+	RowFilterParam    = "row_filter"
+	RowTransformParam = "row_transform"
+)
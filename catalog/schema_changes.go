@@ -0,0 +1,118 @@
+package catalog
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// The schema changes, i.e., the DDL statements run by the clients of both protocols or applied by the replication,
+// are broadcast within the server once they are committed, so that the caches that depend on the schema are
+// invalidated promptly. The Postgres port prepares its affected prepared statements again, and notifies
+// the sessions that have run `LISTEN myduck_ddl` with the changes as the JSON payloads, e.g.,
+//
+//	{"command":"ALTER TABLE","object_type":"table","database":"mydb","schema":"public","name":"t","origin":"local"}
+//
+// A change without an object type is made by a statement whose objects are not known, e.g., a DuckDB-specific one,
+// and any object may have been changed by it.
+
+// SchemaChangeChannel is the channel of the notifications of the schema changes.
+const SchemaChangeChannel = "myduck_ddl"
+
+// The types of the objects of the schema changes.
+const (
+	SchemaObjectSchema = "schema"
+	SchemaObjectTable  = "table"
+	SchemaObjectView   = "view"
+	SchemaObjectIndex  = "index"
+)
+
+// The origins of the schema changes.
+const (
+	SchemaChangeLocal       = "local"
+	SchemaChangeReplication = "replication"
+)
+
+// SchemaChange is a change of the schema made by a DDL statement.
+type SchemaChange struct {
+	Command    string `json:"command"` // the command tag of the statement, e.g., ALTER TABLE
+	ObjectType string `json:"object_type,omitempty"`
+	Database   string `json:"database,omitempty"`
+	Schema     string `json:"schema,omitempty"`
+	Name       string `json:"name,omitempty"` // empty for a schema
+	Origin     string `json:"origin"`
+	// ConnectionID is the connection that made the change, or 0 for the replication.
+	ConnectionID uint32 `json:"-"`
+}
+
+// Payload returns the payload of the notification of the change.
+func (c SchemaChange) Payload() string {
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// maxPendingSchemaChanges is the number of the changes that a subscription holds until they are taken.
+// Beyond it, the pending changes are collapsed into a change of unknown objects.
+const maxPendingSchemaChanges = 1024
+
+// SchemaChangeSubscription receives the schema changes published after it is created.
+type SchemaChangeSubscription struct {
+	pending []SchemaChange
+	ready   chan struct{}
+}
+
+var schemaChangeHub = struct {
+	sync.Mutex
+	subscriptions map[*SchemaChangeSubscription]struct{}
+}{subscriptions: make(map[*SchemaChangeSubscription]struct{})}
+
+// SubscribeSchemaChanges returns a new subscription to the schema changes, which must be closed when it is no longer used.
+func SubscribeSchemaChanges() *SchemaChangeSubscription {
+	s := &SchemaChangeSubscription{ready: make(chan struct{}, 1)}
+	schemaChangeHub.Lock()
+	schemaChangeHub.subscriptions[s] = struct{}{}
+	schemaChangeHub.Unlock()
+	return s
+}
+
+// PublishSchemaChanges delivers the schema changes to all subscriptions. It never blocks on the subscribers.
+func PublishSchemaChanges(changes ...SchemaChange) {
+	if len(changes) == 0 {
+		return
+	}
+	schemaChangeHub.Lock()
+	defer schemaChangeHub.Unlock()
+	for s := range schemaChangeHub.subscriptions {
+		s.pending = append(s.pending, changes...)
+		if len(s.pending) > maxPendingSchemaChanges {
+			s.pending = []SchemaChange{{Command: "DDL"}}
+		}
+		select {
+		case s.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Ready returns the channel that receives a value when there are changes to take, and is closed along with the subscription.
+func (s *SchemaChangeSubscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Take returns the changes published since the last call, in order.
+func (s *SchemaChangeSubscription) Take() []SchemaChange {
+	schemaChangeHub.Lock()
+	defer schemaChangeHub.Unlock()
+	changes := s.pending
+	s.pending = nil
+	return changes
+}
+
+// Close ends the subscription.
+func (s *SchemaChangeSubscription) Close() {
+	schemaChangeHub.Lock()
+	defer schemaChangeHub.Unlock()
+	if _, ok := schemaChangeHub.subscriptions[s]; ok {
+		delete(schemaChangeHub.subscriptions, s)
+		close(s.ready)
+	}
+}
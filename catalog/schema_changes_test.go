@@ -0,0 +1,37 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaChangeSubscription(t *testing.T) {
+	s := SubscribeSchemaChanges()
+	PublishSchemaChanges()
+	require.Empty(t, s.Take())
+
+	change := SchemaChange{Command: "ALTER TABLE", ObjectType: SchemaObjectTable, Database: "db", Schema: "public", Name: "t", Origin: SchemaChangeLocal, ConnectionID: 7}
+	PublishSchemaChanges(change)
+	PublishSchemaChanges(SchemaChange{Command: "DROP SCHEMA", ObjectType: SchemaObjectSchema, Schema: "s", Origin: SchemaChangeReplication})
+	<-s.Ready()
+	changes := s.Take()
+	require.Len(t, changes, 2)
+	require.Equal(t, change, changes[0])
+	require.Equal(t, `{"command":"ALTER TABLE","object_type":"table","database":"db","schema":"public","name":"t","origin":"local"}`, changes[0].Payload())
+	require.Equal(t, `{"command":"DROP SCHEMA","object_type":"schema","schema":"s","origin":"replication"}`, changes[1].Payload())
+
+	// Too many pending changes are collapsed into one of unknown objects.
+	for range maxPendingSchemaChanges + 1 {
+		PublishSchemaChanges(change)
+	}
+	require.Equal(t, []SchemaChange{{Command: "DDL"}}, s.Take())
+
+	s.Close()
+	PublishSchemaChanges(change)
+	for range s.Ready() {
+		// The channel is drained until it is closed.
+	}
+	require.Empty(t, s.Take())
+	s.Close()
+}
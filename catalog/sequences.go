@@ -0,0 +1,84 @@
+package catalog
+
+import (
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The sequences created over the Postgres protocol are the sequences of DuckDB,
+// which are listed in pg_class with the OIDs assigned at creation.
+// The temporary sequences are not listed.
+
+// RegisterSequence lists a sequence in pg_class, unless it is listed already.
+func RegisterSequence(ctx *sql.Context, schema, name string) error {
+	oid, err := nextObjectOID(ctx)
+	if err != nil {
+		return err
+	}
+	namespace := "coalesce((SELECT oid FROM " + InternalTables.PGNamespace.QualifiedName() + " WHERE nspname = ?), 2200)"
+	if _, err := adapter.ExecCatalog(ctx,
+		"INSERT INTO "+InternalTables.PGClass.QualifiedName()+
+			" (oid, relname, relnamespace, reltype, reloftype, relowner, relam, relfilenode, reltablespace, relpages,"+
+			" reltuples, relallvisible, reltoastrelid, relhasindex, relisshared, relpersistence, relkind, relnatts,"+
+			" relchecks, relhasrules, relhastriggers, relhassubclass, relrowsecurity, relforcerowsecurity,"+
+			" relispopulated, relreplident, relispartition, relrewrite, relfrozenxid, relminmxid, relacl, reloptions, relpartbound)"+
+			" SELECT ?, ?, "+namespace+", 0, 0, 10, 0, ?, 0, 1, 1, 0, 0, false, false, 'p', 'S', 3,"+
+			" 0, false, false, false, false, false, true, 'n', false, 0, 0, 0, NULL, NULL, NULL"+
+			" WHERE NOT EXISTS (SELECT 1 FROM "+InternalTables.PGClass.QualifiedName()+
+			" WHERE relname = ? AND relnamespace = "+namespace+" AND relkind = 'S')",
+		oid, name, schema, oid, name, schema,
+	); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// UnregisterSequence removes a sequence from pg_class, along with its owner.
+func UnregisterSequence(ctx *sql.Context, schema, name string) error {
+	if _, err := adapter.ExecCatalog(ctx,
+		"DELETE FROM "+InternalTables.PGClass.QualifiedName()+
+			" WHERE relname = ? AND relkind = 'S' AND relnamespace = coalesce((SELECT oid FROM "+
+			InternalTables.PGNamespace.QualifiedName()+" WHERE nspname = ?), 2200)",
+		name, schema,
+	); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	if _, err := adapter.ExecCatalog(ctx, InternalTables.SequenceOwners.DeleteStmt(), schema, name); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// SetSequenceOwner records the column that owns a sequence in the same schema.
+func SetSequenceOwner(ctx *sql.Context, schema, sequence, table, column string) error {
+	if _, err := adapter.ExecCatalog(ctx, InternalTables.SequenceOwners.UpsertStmt(), schema, sequence, table, column); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// OwnedSequences returns the sequences owned by the columns of a table, keyed by the column names.
+func OwnedSequences(ctx *sql.Context, schema, table string) (map[string]string, error) {
+	rows, err := adapter.QueryCatalog(ctx,
+		"SELECT column_name, sequence_name FROM "+InternalTables.SequenceOwners.QualifiedName()+
+			" WHERE schema_name = ? AND table_name = ?",
+		schema, table,
+	)
+	if err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+	defer rows.Close()
+
+	sequences := make(map[string]string)
+	for rows.Next() {
+		var column, sequence string
+		if err := rows.Scan(&column, &sequence); err != nil {
+			return nil, ErrDuckDB.New(err)
+		}
+		sequences[column] = sequence
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+	return sequences, nil
+}
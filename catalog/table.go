@@ -31,12 +31,15 @@ type ExtraTableInfo struct {
 	Replicated bool
 	Sequence   string
 	Checks     []sql.CheckDefinition
+	// The partitioning of the table, which is recorded but not applied. See LocatePartitionClause.
+	Partitioning *PartitionInfo `json:",omitempty"`
 }
 
 type ColumnInfo struct {
 	ColumnName    string
 	ColumnIndex   int
 	DataType      sql.Type
+	DuckType      string
 	IsNullable    bool
 	ColumnDefault stdsql.NullString
 	Comment       stdsql.NullString
@@ -226,7 +229,7 @@ func (t *Table) AddColumn(ctx *sql.Context, column *sql.Column, order *sql.Colum
 
 	// TODO: Column order is ignored as DuckDB does not support it.
 
-	typ, err := DuckdbDataType(column.Type)
+	_, typ, err := columnDataType(column, columnDefinitions(ctx.Query()))
 	if err != nil {
 		return err
 	}
@@ -350,11 +353,6 @@ func (t *Table) ModifyColumn(ctx *sql.Context, columnName string, column *sql.Co
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	typ, err := DuckdbDataType(column.Type)
-	if err != nil {
-		return err
-	}
-
 	// Find existing column to check for AUTO_INCREMENT and PRIMARY KEY
 	var oldColumn *sql.Column
 	var oldColumnIndex int
@@ -368,11 +366,25 @@ func (t *Table) ModifyColumn(ctx *sql.Context, columnName string, column *sql.Co
 		return sql.ErrColumnNotFound.New(columnName)
 	}
 
+	definitions := columnDefinitions(ctx.Query())
+	if _, ok := definitions[strings.ToLower(column.Name)]; !ok {
+		// The column is not redefined by the statement, e.g., RENAME COLUMN, so it keeps its attributes.
+		meta, err := t.columnMeta(ctx, oldColumn.Name)
+		if err != nil {
+			return err
+		}
+		definitions[strings.ToLower(column.Name)] = columnAttributes{display: meta.Display, zerofill: meta.Zerofill}
+	}
+	columnType, typ, err := columnDataType(column, definitions)
+	if err != nil {
+		return err
+	}
+
 	baseSQL := `ALTER TABLE ` + FullTableName(t.db.catalog, t.db.name, t.name) + ` ALTER COLUMN ` + QuoteIdentifierANSI(columnName)
 	var sqls []string
 
 	// Add type modification
-	if !oldColumn.Type.Equals(column.Type) {
+	if !oldColumn.Type.Equals(columnType) {
 		sqls = append(sqls, baseSQL+` TYPE `+typ.name)
 	}
 
@@ -400,9 +412,12 @@ func (t *Table) ModifyColumn(ctx *sql.Context, columnName string, column *sql.Co
 	var sequenceName, fullSequenceName, createSequenceStmt string
 
 	// Handle AUTO_INCREMENT changes
+	if column.AutoIncrement {
+		// Keep the flag in the column comment, which is rewritten below, even if it is unchanged.
+		typ.mysql.AutoIncrement = true
+	}
 	if !oldColumn.AutoIncrement && column.AutoIncrement {
 		// Adding AUTO_INCREMENT
-		typ.mysql.AutoIncrement = true
 		uuid, err := uuid.NewRandom()
 		if err != nil {
 			return err
@@ -428,9 +443,18 @@ func (t *Table) ModifyColumn(ctx *sql.Context, columnName string, column *sql.Co
 		tableInfoChanged = true
 	}
 
-	// Handle column rename
+	// Handle column rename.
+	// DuckDB cannot rename a column of a table with indexes, so the secondary indexes are dropped
+	// and recreated over the renamed column. The constraints follow the column by themselves.
+	var recreateIndexes []string
 	if columnName != column.Name {
+		dropIndexes, createIndexes, err := t.indexDefinitions(ctx, map[string]string{columnName: column.Name})
+		if err != nil {
+			return err
+		}
+		sqls = append(sqls, dropIndexes...)
 		sqls = append(sqls, `ALTER TABLE `+FullTableName(t.db.catalog, t.db.name, t.name)+` RENAME `+QuoteIdentifierANSI(columnName)+` TO `+QuoteIdentifierANSI(column.Name))
+		recreateIndexes = createIndexes
 	}
 
 	// Update column comment
@@ -457,9 +481,11 @@ func (t *Table) ModifyColumn(ctx *sql.Context, columnName string, column *sql.Co
 		sqls = append(sqls, `COMMENT ON TABLE `+FullTableName(t.db.catalog, t.db.name, t.name)+` IS '`+comment.Encode()+`'`)
 	}
 
+	sqls = append(sqls, recreateIndexes...)
+
+	// Execute the statements atomically, so that a failure does not leave the indexes dropped
 	joinedSQL := strings.Join(sqls, "; ")
-	_, err = adapter.Exec(ctx, joinedSQL)
-	if err != nil {
+	if err := execAtomically(ctx, joinedSQL); err != nil {
 		ctx.GetLogger().WithError(err).Errorf("Failed to execute DuckDB SQL: %s", joinedSQL)
 		return ErrDuckDB.New(err)
 	}
@@ -729,6 +755,20 @@ func (t *Table) Comment() string {
 	return t.comment.Text
 }
 
+// columnMeta returns the MySQL type annotations of a column, which are kept in the column comment.
+func (t *Table) columnMeta(ctx *sql.Context, columnName string) (MySQLType, error) {
+	columns, err := queryColumns(ctx, t.db.catalog, t.db.name, t.name)
+	if err != nil {
+		return MySQLType{}, ErrDuckDB.New(err)
+	}
+	for _, col := range columns {
+		if strings.EqualFold(col.ColumnName, columnName) {
+			return DecodeComment[MySQLType](col.Comment.String).Meta, nil
+		}
+	}
+	return MySQLType{}, sql.ErrColumnNotFound.New(columnName)
+}
+
 func queryColumns(ctx *sql.Context, catalogName, schemaName, tableName string) ([]*ColumnInfo, error) {
 	rows, err := adapter.QueryCatalog(ctx, `
 		SELECT column_name, column_index, data_type, is_nullable, column_default, comment, numeric_precision, numeric_scale
@@ -763,6 +803,7 @@ func queryColumns(ctx *sql.Context, catalogName, schemaName, tableName string) (
 			ColumnName:    columnName,
 			ColumnIndex:   columnIndex,
 			DataType:      dataType,
+			DuckType:      dataTypes,
 			IsNullable:    isNullable,
 			ColumnDefault: columnDefault,
 			Comment:       comment,
@@ -0,0 +1,636 @@
+package catalog
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// A tenant is a database, i.e., a DuckDB catalog in its own file, isolated from the other tenants,
+// along with the limits of the resources it may use:
+//   - MaxConnections limits the number of the concurrent sessions whose current database is the tenant,
+//     on either protocol. A session is counted when it switches to the tenant, see ConnectionPool.UseSchema.
+//   - StorageQuota limits the size of the files of the tenant. The size is checked when the tenant is checkpointed
+//     or backed up, see CheckTenantQuota. A tenant found above its quota is read-only until a later check finds it
+//     within its quota again, e.g., after rows are deleted, or after its quota is raised by ALTER TENANT.
+//
+// The tenants are registered in InternalTables.Tenants of the default catalog, which is never a tenant itself.
+// The users other than the superusers may access only the tenants granted to them, see GrantTenant:
+//   - A session of such a user is bound to its user, see ConnectionPool.RestrictTenants, and cannot switch to
+//     a tenant not granted to the user, whether by connecting to it, by USE, or by setting the schema.
+//   - A statement of such a user is refused if its current database, or a tenant that qualifies a name in it,
+//     is not granted to the user, see TenantReferences. So a revoked grant takes effect at the next statement.
+//
+// The grants are changed only by GRANT and REVOKE, see ProtectedInternalTables.
+
+// Tenant is a tenant registered in InternalTables.Tenants.
+type Tenant struct {
+	Name string
+	// MaxConnections is the maximum number of the concurrent sessions, or 0 for no limit.
+	MaxConnections int
+	// StorageQuota is the maximum size of the files in bytes, or 0 for no limit.
+	StorageQuota int64
+	// CheckedSize and CheckedAt are the size of the files at the last check of the quota and the time of the check.
+	// CheckedAt is zero if the quota has never been checked.
+	CheckedSize int64
+	CheckedAt   time.Time
+	// OverQuota is whether the tenant was above its quota at the last check.
+	OverQuota bool
+	CreatedAt time.Time
+}
+
+var (
+	ErrTenantNotFound      = errors.NewKind("tenant %q does not exist")
+	ErrTenantExists        = errors.NewKind("tenant %q already exists")
+	ErrTenantQuotaExceeded = errors.NewKind("tenant %q exceeds its storage quota: %d bytes used of %d bytes")
+	// ErrTenantOverQuota refuses a write to a tenant that was above its storage quota at its last check.
+	ErrTenantOverQuota = errors.NewKind("tenant %q exceeds its storage quota")
+	// ErrTenantConnectionLimit refuses a session beyond the connection limit of a tenant.
+	ErrTenantConnectionLimit = errors.NewKind("too many connections for database %q")
+	// ErrTenantAccessDenied refuses the access to a tenant not granted to the user.
+	ErrTenantAccessDenied = errors.NewKind("permission denied for database %q")
+)
+
+// tenantTable returns the qualified name of InternalTables.Tenants in the default catalog.
+func (prov *DatabaseProvider) tenantTable() string {
+	return FullTableName(prov.defaultCatalogName, InternalTables.Tenants.Schema, InternalTables.Tenants.Name)
+}
+
+// CreateTenant creates the database of a tenant, or turns an existing database into a tenant.
+func (prov *DatabaseProvider) CreateTenant(name string, maxConnections int, storageQuota int64) error {
+	if err := prov.validateTenantName(name); err != nil {
+		return err
+	}
+	if _, ok, err := prov.Tenant(name); err != nil {
+		return err
+	} else if ok {
+		return ErrTenantExists.New(name)
+	}
+	if err := prov.CreateCatalog(name, true); err != nil {
+		return err
+	}
+	return prov.registerTenant(name, maxConnections, storageQuota)
+}
+
+func (prov *DatabaseProvider) validateTenantName(name string) error {
+	if !simpleIdentifierRegex.MatchString(name) {
+		return fmt.Errorf("invalid tenant name %q", name)
+	}
+	if name == prov.defaultCatalogName || name == "memory" || name == "system" || name == "temp" {
+		return fmt.Errorf("the database %q cannot be a tenant", name)
+	}
+	return nil
+}
+
+func (prov *DatabaseProvider) registerTenant(name string, maxConnections int, storageQuota int64) error {
+	if maxConnections < 0 || storageQuota < 0 {
+		return fmt.Errorf("the limits of a tenant must not be negative")
+	}
+	_, err := prov.storage.ExecContext(context.Background(),
+		"INSERT INTO "+prov.tenantTable()+" (tenant_name, max_connections, storage_quota, created_at) VALUES (?, ?, ?, now())",
+		name, maxConnections, storageQuota,
+	)
+	if err == nil {
+		prov.tenantNames.Store(strings.ToLower(name), name)
+	}
+	return err
+}
+
+// AlterTenant changes the limits of a tenant. The nil limits are left unchanged.
+// A change of the storage quota takes effect at the next check of the quota.
+func (prov *DatabaseProvider) AlterTenant(name string, maxConnections *int, storageQuota *int64) error {
+	if (maxConnections != nil && *maxConnections < 0) || (storageQuota != nil && *storageQuota < 0) {
+		return fmt.Errorf("the limits of a tenant must not be negative")
+	}
+	result, err := prov.storage.ExecContext(context.Background(),
+		"UPDATE "+prov.tenantTable()+" SET max_connections = coalesce(?::INTEGER, max_connections), storage_quota = coalesce(?::BIGINT, storage_quota)"+
+			" WHERE tenant_name = ?",
+		maxConnections, storageQuota, name,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTenantNotFound.New(name)
+	}
+	return nil
+}
+
+// DropTenant drops a tenant along with its database.
+func (prov *DatabaseProvider) DropTenant(name string, ifExists bool) error {
+	if _, ok, err := prov.Tenant(name); err != nil {
+		return err
+	} else if !ok {
+		if ifExists {
+			return nil
+		}
+		return ErrTenantNotFound.New(name)
+	}
+	if err := prov.DropCatalog(name, true); err != nil {
+		return err
+	}
+	if _, err := prov.storage.ExecContext(context.Background(),
+		"DELETE FROM "+prov.tenantTable()+" WHERE tenant_name = ?", name,
+	); err != nil {
+		return err
+	}
+	if _, err := prov.storage.ExecContext(context.Background(),
+		"DELETE FROM "+prov.tenantGrantTable()+" WHERE tenant_name = ?", name,
+	); err != nil {
+		return err
+	}
+	prov.overQuotaTenants.Delete(name)
+	prov.tenantNames.Delete(strings.ToLower(name))
+	prov.tenantGrants.Range(func(key, _ any) bool {
+		if strings.HasPrefix(key.(string), strings.ToLower(name)+"\x00") {
+			prov.tenantGrants.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
+
+// tenantGrantTable returns the qualified name of InternalTables.TenantGrants in the default catalog.
+func (prov *DatabaseProvider) tenantGrantTable() string {
+	return FullTableName(prov.defaultCatalogName, InternalTables.TenantGrants.Schema, InternalTables.TenantGrants.Name)
+}
+
+// tenantGrantKey is the key of a grant in DatabaseProvider.tenantGrants.
+// The names of the tenants are case-insensitive, but those of the users are not.
+func tenantGrantKey(name, user string) string {
+	return strings.ToLower(name) + "\x00" + user
+}
+
+// GrantTenant grants the access to a tenant to a user.
+func (prov *DatabaseProvider) GrantTenant(name, user string) error {
+	tenant, ok := prov.tenantNames.Load(strings.ToLower(name))
+	if !ok {
+		return ErrTenantNotFound.New(name)
+	}
+	if _, err := prov.storage.ExecContext(context.Background(),
+		"INSERT OR REPLACE INTO "+prov.tenantGrantTable()+" VALUES (?, ?, now())", tenant, user,
+	); err != nil {
+		return err
+	}
+	prov.tenantGrants.Store(tenantGrantKey(name, user), true)
+	return nil
+}
+
+// RevokeTenant revokes the access to a tenant from a user, and returns false if the user was not granted it.
+// The sessions of the user whose current database is the tenant are refused from their next statements.
+func (prov *DatabaseProvider) RevokeTenant(name, user string) (bool, error) {
+	res, err := prov.storage.ExecContext(context.Background(),
+		"DELETE FROM "+prov.tenantGrantTable()+" WHERE lower(tenant_name) = lower(?) AND user_name = ?", name, user,
+	)
+	if err != nil {
+		return false, err
+	}
+	prov.tenantGrants.Delete(tenantGrantKey(name, user))
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// TenantGranted reports whether a user may access the database, i.e., whether it is not a tenant,
+// or it is a tenant granted to the user.
+func (prov *DatabaseProvider) TenantGranted(name, user string) bool {
+	if _, ok := prov.tenantNames.Load(strings.ToLower(name)); !ok {
+		return true
+	}
+	_, ok := prov.tenantGrants.Load(tenantGrantKey(name, user))
+	return ok
+}
+
+const tenantColumns = "tenant_name, max_connections, storage_quota, coalesce(checked_size, 0), checked_at, over_quota, created_at"
+
+func scanTenant(row interface{ Scan(...any) error }) (Tenant, error) {
+	var (
+		t         Tenant
+		checkedAt stdsql.NullTime
+		createdAt stdsql.NullTime
+	)
+	if err := row.Scan(&t.Name, &t.MaxConnections, &t.StorageQuota, &t.CheckedSize, &checkedAt, &t.OverQuota, &createdAt); err != nil {
+		return Tenant{}, err
+	}
+	t.CheckedAt, t.CreatedAt = checkedAt.Time, createdAt.Time
+	return t, nil
+}
+
+// Tenant returns the tenant of the name, and false if the database is not a tenant.
+func (prov *DatabaseProvider) Tenant(name string) (Tenant, bool, error) {
+	t, err := scanTenant(prov.storage.QueryRowContext(context.Background(),
+		"SELECT "+tenantColumns+" FROM "+prov.tenantTable()+" WHERE tenant_name = ?", name,
+	))
+	if err == stdsql.ErrNoRows {
+		return Tenant{}, false, nil
+	} else if err != nil {
+		return Tenant{}, false, err
+	}
+	return t, true, nil
+}
+
+// Tenants returns all the tenants ordered by their names.
+func (prov *DatabaseProvider) Tenants() ([]Tenant, error) {
+	rows, err := prov.storage.QueryContext(context.Background(),
+		"SELECT "+tenantColumns+" FROM "+prov.tenantTable()+" ORDER BY tenant_name",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tenants []Tenant
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+// TenantStorageSize returns the size in bytes of the files of the database of a tenant, i.e., its data file and WAL.
+func (prov *DatabaseProvider) TenantStorageSize(name string) (int64, error) {
+	var size int64
+	file := filepath.Join(prov.dataDir, name+".db")
+	for _, f := range []string{file, file + ".wal"} {
+		info, err := os.Stat(f)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+// CheckTenantQuota checks the size of a tenant against its storage quota, and records the result.
+// It returns ErrTenantQuotaExceeded if the tenant is above its quota, and nil if the database is not a tenant.
+// The database should have been checkpointed, so that the size of its files reflects its data.
+func (prov *DatabaseProvider) CheckTenantQuota(name string) error {
+	t, ok, err := prov.Tenant(name)
+	if err != nil || !ok {
+		return err
+	}
+	size, err := prov.TenantStorageSize(name)
+	if err != nil {
+		return err
+	}
+	over := t.StorageQuota > 0 && size > t.StorageQuota
+	if _, err := prov.storage.ExecContext(context.Background(),
+		"UPDATE "+prov.tenantTable()+" SET checked_size = ?, checked_at = now(), over_quota = ? WHERE tenant_name = ?",
+		size, over, name,
+	); err != nil {
+		return err
+	}
+	if !over {
+		prov.overQuotaTenants.Delete(name)
+		return nil
+	}
+	if _, loaded := prov.overQuotaTenants.Swap(name, true); !loaded {
+		logrus.Warnf("Tenant %s exceeds its storage quota: %d bytes used of %d bytes; it is read-only until it is within its quota", name, size, t.StorageQuota)
+	}
+	return ErrTenantQuotaExceeded.New(name, size, t.StorageQuota)
+}
+
+// CheckTenantQuotas checkpoints all the tenants and checks their storage quotas.
+// The tenants above their quotas are logged rather than reported as errors.
+func (prov *DatabaseProvider) CheckTenantQuotas() error {
+	tenants, err := prov.Tenants()
+	if err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		if t.StorageQuota == 0 && !t.OverQuota {
+			continue
+		}
+		if _, err := prov.storage.ExecContext(context.Background(), "CHECKPOINT "+t.Name); err != nil {
+			return err
+		}
+		if err := prov.CheckTenantQuota(t.Name); err != nil && !ErrTenantQuotaExceeded.Is(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// TenantOverQuota reports whether the database is a tenant that was above its storage quota at the last check.
+func (prov *DatabaseProvider) TenantOverQuota(name string) bool {
+	_, ok := prov.overQuotaTenants.Load(name)
+	return ok
+}
+
+// HasTenantsOverQuota reports whether any tenant was above its storage quota at the last check.
+func (prov *DatabaseProvider) HasTenantsOverQuota() bool {
+	found := false
+	prov.overQuotaTenants.Range(func(any, any) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// loadTenants loads the names of the tenants, the tenants above their storage quotas at the last checks,
+// and the grants of the tenants.
+func (prov *DatabaseProvider) loadTenants() error {
+	tenants, err := prov.Tenants()
+	if err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		prov.tenantNames.Store(strings.ToLower(t.Name), t.Name)
+		if t.OverQuota {
+			prov.overQuotaTenants.Store(t.Name, true)
+		}
+	}
+	rows, err := prov.storage.QueryContext(context.Background(),
+		"SELECT tenant_name, user_name FROM "+prov.tenantGrantTable(),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, user string
+		if err := rows.Scan(&name, &user); err != nil {
+			return err
+		}
+		prov.tenantGrants.Store(tenantGrantKey(name, user), true)
+	}
+	return rows.Err()
+}
+
+// HasTenants reports whether any database is a tenant.
+func (prov *DatabaseProvider) HasTenants() bool {
+	found := false
+	prov.tenantNames.Range(func(any, any) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// TenantConnections returns the number of the sessions whose current database is the tenant.
+func (prov *DatabaseProvider) TenantConnections(name string) int {
+	return prov.pool.sessions.count(name)
+}
+
+// tenantConnectionLimit returns the connection limit of the database, or 0 if it is not a tenant or has no limit.
+func (prov *DatabaseProvider) tenantConnectionLimit(name string) (int, error) {
+	if _, ok := prov.tenantNames.Load(strings.ToLower(name)); !ok {
+		return 0, nil
+	}
+	t, ok, err := prov.Tenant(name)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return t.MaxConnections, nil
+}
+
+// tenantSessions counts the sessions by their current databases to enforce the connection limits of the tenants,
+// and keeps the sessions bound to their users out of the tenants not granted to the users.
+type tenantSessions struct {
+	mu       sync.Mutex
+	limit    func(name string) (int, error)
+	granted  func(name, user string) bool
+	catalogs map[uint32]string // the current database of each session
+	counts   map[string]int    // the number of the sessions of each database
+	users    map[uint32]string // the users of the sessions restricted to the tenants granted to them
+}
+
+func newTenantSessions(limit func(name string) (int, error), granted func(name, user string) bool) *tenantSessions {
+	return &tenantSessions{
+		limit:    limit,
+		granted:  granted,
+		catalogs: make(map[uint32]string),
+		counts:   make(map[string]int),
+		users:    make(map[uint32]string),
+	}
+}
+
+// restrict binds the session to the user, so that it may enter only the tenants granted to the user.
+// The binding outlives the connection of the session, which may be closed and reopened by the session,
+// e.g., by DISCARD ALL, until unrestrict is called.
+func (s *tenantSessions) restrict(id uint32, user string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[id] = user
+}
+
+// unrestrict unbinds the session from its user, if any.
+func (s *tenantSessions) unrestrict(id uint32) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, id)
+}
+
+// enter moves the session to the database. It returns ErrTenantAccessDenied if the session is bound to a user
+// who is not granted the database, or ErrTenantConnectionLimit if the database is a tenant that has reached
+// its connection limit, and leaves the session where it was.
+func (s *tenantSessions) enter(id uint32, name string) error {
+	if s == nil {
+		return nil
+	}
+	name = strings.ToLower(name)
+	limit, err := s.limit(name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[id]; ok && !s.granted(name, user) {
+		return ErrTenantAccessDenied.New(name)
+	}
+	last, ok := s.catalogs[id]
+	if ok && last == name {
+		return nil
+	}
+	if limit > 0 && s.counts[name] >= limit {
+		return ErrTenantConnectionLimit.New(name)
+	}
+	if ok {
+		s.remove(last)
+	}
+	s.catalogs[id] = name
+	s.counts[name]++
+	return nil
+}
+
+// leave removes the session, e.g., when its connection is closed.
+func (s *tenantSessions) leave(id uint32) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name, ok := s.catalogs[id]; ok {
+		delete(s.catalogs, id)
+		s.remove(name)
+	}
+}
+
+func (s *tenantSessions) remove(name string) {
+	if s.counts[name]--; s.counts[name] <= 0 {
+		delete(s.counts, name)
+	}
+}
+
+func (s *tenantSessions) count(name string) int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[strings.ToLower(name)]
+}
+
+func (s *tenantSessions) clear() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.catalogs)
+	clear(s.counts)
+}
+
+// TenantReferences returns the tenants whose names qualify the other names in the statement, e.g., acme in
+// `SELECT * FROM acme.main.t`. A schema named after a tenant is taken as a reference to the tenant as well.
+// The statement is read in the ways of both protocols, i.e., with and without the backslash escapes in the string
+// literals and the comments starting with '#', so that a reference cannot be hidden from either reading of it.
+// The comments are read as spaces, so they cannot split a qualified name either.
+//
+// The references are checked against the grants of the tenants, see backend.CheckTenantAccess, on top of the
+// sessions being kept out of the tenants not granted to their users, see ConnectionPool.RestrictTenants.
+func (prov *DatabaseProvider) TenantReferences(query string) []string {
+	if !prov.HasTenants() {
+		return nil
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, escapes := range []bool{true, false} {
+		for _, hashComments := range []bool{true, false} {
+			for _, qualifier := range qualifiers(query, escapes, hashComments) {
+				key := strings.ToLower(qualifier)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				if name, ok := prov.tenantNames.Load(key); ok {
+					names = append(names, name.(string))
+				}
+			}
+		}
+	}
+	return names
+}
+
+// qualifiers returns the first parts of the qualified names in the statement, i.e., the identifiers
+// followed by a dot and not preceded by one, outside the string literals and the comments.
+func qualifiers(query string, escapes, hashComments bool) []string {
+	var names []string
+	afterDot := false
+	for i := 0; i < len(query); {
+		if end, ok := skipComment(query, i, hashComments); ok {
+			i = end
+			continue
+		}
+		c := query[i]
+		var ident string
+		switch {
+		case c == '\'':
+			for i++; i < len(query); i++ {
+				if escapes && query[i] == '\\' {
+					i++
+				} else if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			i++
+			afterDot = false
+			continue
+		case c == '"' || c == '`':
+			end := skipQuoted(query, i)
+			ident = query[i+1 : max(i+1, end-1)]
+			ident = strings.ReplaceAll(ident, string([]byte{c, c}), string(c))
+			i = end
+		case isWordByte(c):
+			start := i
+			for i < len(query) && isWordByte(query[i]) {
+				i++
+			}
+			ident = query[start:i]
+		default:
+			if !isSpaceByte(c) {
+				afterDot = c == '.'
+			}
+			i++
+			continue
+		}
+		next := i
+		for next < len(query) {
+			if end, ok := skipComment(query, next, hashComments); ok {
+				next = end
+			} else if isSpaceByte(query[next]) {
+				next++
+			} else {
+				break
+			}
+		}
+		if !afterDot && next < len(query) && query[next] == '.' {
+			names = append(names, ident)
+		}
+		afterDot = false
+	}
+	return names
+}
+
+// skipComment returns the end of the comment at i, if any, in the reading of MySQL if hashComments is set.
+// The opening and the closing of an executable comment of MySQL, e.g., `/*!80000` and `*/`, are taken as
+// comments by themselves, since its content is executed.
+func skipComment(query string, i int, hashComments bool) (int, bool) {
+	rest := query[i:]
+	switch {
+	case strings.HasPrefix(rest, "/*!"):
+		for i += 3; i < len(query) && query[i] >= '0' && query[i] <= '9'; i++ {
+		}
+		return i, true
+	case strings.HasPrefix(rest, "/*"):
+		if j := strings.Index(rest[2:], "*/"); j >= 0 {
+			return i + j + 4, true
+		}
+		return len(query), true
+	case strings.HasPrefix(rest, "*/"):
+		return i + 2, true
+	// MySQL takes "--" as a comment only if it is followed by a space.
+	case strings.HasPrefix(rest, "--") && (!hashComments || len(rest) == 2 || isSpaceByte(rest[2]) || rest[2] < ' '),
+		hashComments && rest[0] == '#':
+		if j := strings.IndexByte(rest, '\n'); j >= 0 {
+			return i + j + 1, true
+		}
+		return len(query), true
+	}
+	return i, false
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f'
+}
@@ -0,0 +1,149 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenants(t *testing.T) {
+	dir := t.TempDir()
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	prov := &DatabaseProvider{storage: db, defaultCatalogName: "memory", dataDir: dir, overQuotaTenants: &sync.Map{}, tenantNames: &sync.Map{}, tenantGrants: &sync.Map{}}
+	_, err = db.Exec("CREATE SCHEMA __sys__")
+	require.NoError(t, err)
+	for _, table := range []InternalTable{InternalTables.Tenants, InternalTables.TenantGrants} {
+		_, err = db.Exec("CREATE TABLE " + table.QualifiedName() + " (" + table.DDL + ")")
+		require.NoError(t, err)
+	}
+
+	require.Error(t, prov.validateTenantName("memory"))
+	require.Error(t, prov.validateTenantName("a;b"))
+	require.NoError(t, prov.validateTenantName("acme"))
+
+	_, err = db.Exec("ATTACH '" + filepath.Join(dir, "acme.db") + "' AS acme")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE acme.t AS SELECT range AS i, repeat('x', 100) AS s FROM range(100000)")
+	require.NoError(t, err)
+	_, err = db.Exec("CHECKPOINT acme")
+	require.NoError(t, err)
+	require.NoError(t, prov.registerTenant("acme", 2, 1024))
+
+	require.Equal(t, []string{"acme"}, prov.TenantReferences(`SELECT * FROM "ACME".main.t JOIN Acme.t USING (i)`))
+	require.Empty(t, prov.TenantReferences(`SELECT 'acme.t', x.acme.t, acme FROM t`))
+	// A quote escaped by a backslash cannot hide the reference, whether or not the backslash escapes it.
+	require.Equal(t, []string{"acme"}, prov.TenantReferences(`SELECT 'a\' FROM acme.t -- '`))
+	require.Equal(t, []string{"acme"}, prov.TenantReferences(`SELECT 'a\'' , acme.t.i FROM t`))
+	// Neither can a comment hide or split a reference.
+	require.Equal(t, []string{"acme"}, prov.TenantReferences("SELECT * FROM acme /* x */ . t"))
+	require.Equal(t, []string{"acme"}, prov.TenantReferences("SELECT * FROM acme -- x\n.t"))
+	require.Equal(t, []string{"acme"}, prov.TenantReferences("SELECT * FROM /*!80000 acme.t */"))
+	require.Equal(t, []string{"acme"}, prov.TenantReferences("SELECT 1 # x\n, acme.t.i FROM t"))
+	require.Empty(t, prov.TenantReferences("SELECT 1 /* acme.t */ FROM t -- acme.t"))
+
+	// The tenant is accessible only to the users granted it.
+	require.False(t, prov.TenantGranted("acme", "alice"))
+	require.True(t, prov.TenantGranted("memory", "alice"))
+	require.NoError(t, prov.GrantTenant("ACME", "alice"))
+	require.True(t, prov.TenantGranted("acme", "alice"))
+	require.False(t, prov.TenantGranted("acme", "Alice"))
+	require.True(t, ErrTenantNotFound.Is(prov.GrantTenant("other", "alice")))
+	prov.tenantGrants.Clear()
+	require.NoError(t, prov.loadTenants())
+	require.True(t, prov.TenantGranted("acme", "alice"))
+	revoked, err := prov.RevokeTenant("acme", "alice")
+	require.NoError(t, err)
+	require.True(t, revoked)
+	require.False(t, prov.TenantGranted("acme", "alice"))
+	require.NoError(t, prov.GrantTenant("acme", "alice"))
+
+	tenant, ok, err := prov.Tenant("acme")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 2, tenant.MaxConnections)
+	require.Equal(t, int64(1024), tenant.StorageQuota)
+	require.True(t, tenant.CheckedAt.IsZero())
+	_, ok, err = prov.Tenant("other")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// The tenant is above its quota until the quota is raised.
+	size, err := prov.TenantStorageSize("acme")
+	require.NoError(t, err)
+	require.Greater(t, size, int64(1024))
+	err = prov.CheckTenantQuota("acme")
+	require.True(t, ErrTenantQuotaExceeded.Is(err), "%v", err)
+	require.True(t, prov.TenantOverQuota("acme"))
+	tenant, _, err = prov.Tenant("acme")
+	require.NoError(t, err)
+	require.True(t, tenant.OverQuota)
+	require.Equal(t, size, tenant.CheckedSize)
+	require.False(t, tenant.CheckedAt.IsZero())
+
+	quota := int64(0)
+	require.NoError(t, prov.AlterTenant("acme", nil, &quota))
+	require.True(t, prov.TenantOverQuota("acme"))
+	require.NoError(t, prov.CheckTenantQuotas())
+	require.False(t, prov.TenantOverQuota("acme"))
+	tenants, err := prov.Tenants()
+	require.NoError(t, err)
+	require.Len(t, tenants, 1)
+	require.Equal(t, 2, tenants[0].MaxConnections)
+	require.Zero(t, tenants[0].StorageQuota)
+	require.False(t, tenants[0].OverQuota)
+	require.True(t, ErrTenantNotFound.Is(prov.AlterTenant("other", nil, &quota)))
+
+	require.NoError(t, prov.DropTenant("acme", false))
+	require.False(t, prov.HasTenants())
+	// The grants are dropped along with the tenant.
+	require.NoError(t, prov.registerTenant("acme", 0, 0))
+	require.False(t, prov.TenantGranted("acme", "alice"))
+	require.NoError(t, prov.DropTenant("acme", false))
+	require.NoFileExists(t, filepath.Join(dir, "acme.db"))
+	require.NoError(t, prov.DropTenant("acme", true))
+	require.True(t, ErrTenantNotFound.Is(prov.DropTenant("acme", false)))
+}
+
+func TestTenantSessions(t *testing.T) {
+	s := newTenantSessions(func(name string) (int, error) {
+		if name == "acme" {
+			return 2, nil
+		}
+		return 0, nil
+	}, func(name, user string) bool {
+		return name != "acme" || user == "alice"
+	})
+	require.NoError(t, s.enter(1, "acme"))
+	require.NoError(t, s.enter(2, "ACME"))
+	require.NoError(t, s.enter(2, "acme"))
+	require.True(t, ErrTenantConnectionLimit.Is(s.enter(3, "acme")))
+	require.NoError(t, s.enter(3, "memory"))
+	require.Equal(t, 2, s.count("acme"))
+
+	// A session that switches away or closes frees its place.
+	require.NoError(t, s.enter(1, "memory"))
+	require.NoError(t, s.enter(3, "acme"))
+	s.leave(2)
+	require.Equal(t, 1, s.count("acme"))
+	require.Equal(t, 1, s.count("memory"))
+	s.clear()
+	require.Zero(t, s.count("acme"))
+
+	// A session bound to its user enters only the tenants granted to the user, even after it leaves.
+	s.restrict(4, "bob")
+	s.restrict(5, "alice")
+	require.True(t, ErrTenantAccessDenied.Is(s.enter(4, "acme")))
+	require.NoError(t, s.enter(4, "memory"))
+	require.NoError(t, s.enter(5, "acme"))
+	s.leave(4)
+	require.True(t, ErrTenantAccessDenied.Is(s.enter(4, "acme")))
+	s.unrestrict(4)
+	require.NoError(t, s.enter(4, "acme"))
+}
@@ -0,0 +1,34 @@
+package catalog
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A table with a retention policy has its rows deleted once they expire, i.e.,
+// when the value of the TTL column of a row is older than the TTL (time to live) of the table.
+// The expired rows are deleted in batches, so that a purge never holds a large transaction.
+
+// The storage parameters of a table that set its retention policy,
+// e.g., `ALTER TABLE t SET (ttl = '30 days', ttl_column = 'created_at')`.
+const (
+	TTLParam       = "ttl"
+	TTLColumnParam = "ttl_column"
+)
+
+// TTLPurgeStmt returns the statement that deletes at most batchSize expired rows of a table.
+// The TTL is the only parameter of the statement, which must be a valid interval, e.g., '30 days'.
+func TTLPurgeStmt(schema, table, column string, batchSize int) string {
+	qualified := ConnectIdentifiersANSI(schema, table)
+	var b strings.Builder
+	b.WriteString("DELETE FROM ")
+	b.WriteString(qualified)
+	b.WriteString(" WHERE rowid IN (SELECT rowid FROM ")
+	b.WriteString(qualified)
+	b.WriteString(" WHERE ")
+	b.WriteString(QuoteIdentifierANSI(column))
+	b.WriteString(" < CAST(now() AS TIMESTAMP) - CAST(? AS INTERVAL) LIMIT ")
+	b.WriteString(strconv.Itoa(batchSize))
+	b.WriteString(")")
+	return b.String()
+}
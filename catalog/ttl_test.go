@@ -0,0 +1,42 @@
+package catalog
+
+import (
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTLPurgeStmt(t *testing.T) {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+
+	for _, stmt := range []string{
+		`CREATE TABLE t (id INT PRIMARY KEY, "Created At" TIMESTAMP)`,
+		`INSERT INTO t SELECT i, now()::TIMESTAMP - INTERVAL (i) DAY + INTERVAL 1 HOUR FROM range(10) AS r(i)`,
+	} {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	// The rows older than 5 days expire, i.e., the ones with id > 5, and they are deleted in batches of 3 rows.
+	var purged []int64
+	for {
+		res, err := db.Exec(TTLPurgeStmt("main", "t", "Created At", 3), "5 days")
+		require.NoError(t, err)
+		n, err := res.RowsAffected()
+		require.NoError(t, err)
+		if n == 0 {
+			break
+		}
+		purged = append(purged, n)
+	}
+	require.Equal(t, []int64{3, 1}, purged)
+
+	var maxID int
+	require.NoError(t, db.QueryRow(`SELECT max(id) FROM t`).Scan(&maxID))
+	require.Equal(t, 5, maxID)
+}
@@ -35,6 +35,7 @@ type MySQLType struct {
 	Scale         uint8    `json:",omitempty"`
 	Unsigned      bool     `json:",omitempty"`
 	Display       uint8    `json:",omitempty"` // Display width for integer types
+	Zerofill      bool     `json:",omitempty"` // ZEROFILL flag for integer types, which are also unsigned
 	Collation     uint16   `json:",omitempty"` // For string types
 	Values        []string `json:",omitempty"` // For ENUM and SET
 	Default       string   `json:",omitempty"` // Default value of column
@@ -98,6 +99,19 @@ func newDateTimeType(mysqlName string, precision int) AnnotatedDuckType {
 	return AnnotatedDuckType{name, MySQLType{Name: mysqlName, Precision: uint8(precision)}}
 }
 
+// timestampPrecision returns the fractional seconds precision of the values of a DuckDB timestamp type.
+// The nanoseconds of TIMESTAMP_NS are beyond the maximum precision of MySQL, i.e., microseconds.
+func timestampPrecision(duckName string) int {
+	switch duckName {
+	case "TIMESTAMP_S":
+		return 0
+	case "TIMESTAMP_MS":
+		return 3
+	default:
+		return 6
+	}
+}
+
 func newEnumType(typ sql.EnumType) AnnotatedDuckType {
 	// For ENUM type, we need to escape single quotes in values
 	escapedValues := make([]string, len(typ.Values()))
@@ -206,6 +220,9 @@ func mysqlDataType(duckType AnnotatedDuckType, numericPrecision uint8, numericSc
 		duckName = "DECIMAL"
 	} else if strings.HasPrefix(duckName, "ENUM") {
 		duckName = "ENUM"
+	} else if strings.HasSuffix(duckName, "]") && (strings.HasPrefix(duckName, "FLOAT[") || strings.HasPrefix(duckName, "DOUBLE[")) {
+		// The vectors created over the Postgres protocol, e.g., FLOAT[3]. MySQL reads them as JSON arrays.
+		return types.JSON, nil
 	}
 
 	mysqlName := duckType.mysql.Name
@@ -246,7 +263,11 @@ func mysqlDataType(duckType AnnotatedDuckType, numericPrecision uint8, numericSc
 	}
 
 	if intBaseType != sqltypes.Null {
-		return types.CreateNumberTypeWithDisplayWidth(intBaseType, int(duckType.mysql.Display))
+		// The engine only keeps the display width of TINYINT(1), the others are kept in the annotations.
+		if t, err := types.CreateNumberTypeWithDisplayWidth(intBaseType, int(duckType.mysql.Display)); err == nil {
+			return t, nil
+		}
+		return types.CreateNumberType(intBaseType)
 	}
 
 	length := int64(duckType.mysql.Length)
@@ -259,11 +280,21 @@ func mysqlDataType(duckType AnnotatedDuckType, numericPrecision uint8, numericSc
 	case "DOUBLE":
 		return types.Float64, nil
 
-	case "TIMESTAMP", "TIMESTAMP_S", "TIMESTAMP_MS":
+	case "TIMESTAMP", "TIMESTAMP_S", "TIMESTAMP_MS", "TIMESTAMP_NS":
+		if mysqlName == "" {
+			// Not created by MySQL, e.g., over the Postgres protocol or by CREATE TABLE ... AS.
+			precision = timestampPrecision(duckName)
+		}
 		if mysqlName == "DATETIME" {
 			return types.CreateDatetimeType(sqltypes.Datetime, precision)
 		}
 		return types.CreateDatetimeType(sqltypes.Timestamp, precision)
+	case "TIMESTAMP WITH TIME ZONE", "TIMESTAMPTZ":
+		// e.g., the history tables. MySQL's TIMESTAMP is also an instant in time.
+		if mysqlName == "" {
+			precision = timestampPrecision(duckName)
+		}
+		return types.CreateDatetimeType(sqltypes.Timestamp, precision)
 
 	case "DATE":
 		return types.Date, nil
@@ -284,6 +315,18 @@ func mysqlDataType(duckType AnnotatedDuckType, numericPrecision uint8, numericSc
 
 	case "VARCHAR":
 		if mysqlName == "TEXT" {
+			if collation != sql.Collation_Unspecified {
+				// Keep the character set and collation of the column, e.g., TEXT CHARACTER SET latin1.
+				if length <= types.TinyTextBlobMax {
+					return types.CreateTinyText(collation), nil
+				} else if length <= types.TextBlobMax {
+					return types.CreateText(collation), nil
+				} else if length <= types.MediumTextBlobMax {
+					return types.CreateMediumText(collation), nil
+				} else {
+					return types.CreateLongText(collation), nil
+				}
+			}
 			if length <= types.TinyTextBlobMax {
 				return types.TinyText, nil
 			} else if length <= types.TextBlobMax {
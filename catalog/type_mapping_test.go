@@ -0,0 +1,42 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/dolthub/vitess/go/sqltypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDateTimePrecisionRoundTrip(t *testing.T) {
+	for _, mysqlType := range []sql.Type{
+		types.MustCreateDatetimeType(sqltypes.Datetime, 0),
+		types.MustCreateDatetimeType(sqltypes.Datetime, 3),
+		types.MustCreateDatetimeType(sqltypes.Datetime, 6),
+		types.MustCreateDatetimeType(sqltypes.Timestamp, 0),
+		types.MustCreateDatetimeType(sqltypes.Timestamp, 2),
+		types.MustCreateDatetimeType(sqltypes.Timestamp, 6),
+	} {
+		duckType, err := DuckdbDataType(mysqlType)
+		require.NoError(t, err)
+		typ, err := mysqlDataType(duckType, 0, 0)
+		require.NoError(t, err)
+		require.Equal(t, mysqlType, typ, "DuckDB type: %s", duckType.name)
+	}
+}
+
+func TestUnannotatedTimestampPrecision(t *testing.T) {
+	for duckName, expected := range map[string]sql.Type{
+		"TIMESTAMP":                types.MustCreateDatetimeType(sqltypes.Timestamp, 6),
+		"TIMESTAMP_S":              types.MustCreateDatetimeType(sqltypes.Timestamp, 0),
+		"TIMESTAMP_MS":             types.MustCreateDatetimeType(sqltypes.Timestamp, 3),
+		"TIMESTAMP_NS":             types.MustCreateDatetimeType(sqltypes.Timestamp, 6),
+		"TIMESTAMPTZ":              types.MustCreateDatetimeType(sqltypes.Timestamp, 6),
+		"TIMESTAMP WITH TIME ZONE": types.MustCreateDatetimeType(sqltypes.Timestamp, 6),
+	} {
+		typ, err := mysqlDataType(AnnotatedDuckType{name: duckName}, 0, 0)
+		require.NoError(t, err)
+		require.Equal(t, expected, typ, "DuckDB type: %s", duckName)
+	}
+}
@@ -0,0 +1,227 @@
+package catalog
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The types created over the Postgres protocol are created in DuckDB as well:
+//
+//   - An enum becomes an ENUM type of DuckDB.
+//   - A domain becomes an alias of its base type. Its constraints are not part of the type in DuckDB,
+//     and are added to the tables that use it instead.
+//   - A composite type becomes a STRUCT type of DuckDB.
+//
+// The types are registered in InternalTables.UserTypes and listed in pg_type (and pg_enum for the enums)
+// with the OIDs assigned at creation, which do not change until the types are dropped.
+
+// FirstUserObjectOID is the first OID assigned to the user-defined types and the sequences,
+// i.e., FirstNormalObjectId of Postgres.
+const FirstUserObjectOID = 16384
+
+// The kinds of the user-defined types, i.e., the typtype of pg_type.
+const (
+	UserTypeEnum      = "e"
+	UserTypeDomain    = "d"
+	UserTypeComposite = "c"
+)
+
+// UserType is a type created by CREATE TYPE or CREATE DOMAIN.
+type UserType struct {
+	Schema string
+	Name   string
+	OID    uint32
+	Kind   string
+	// BaseType is the DuckDB type of a domain or a composite type.
+	BaseType string
+	// BaseTypeOID is the Postgres type of a domain.
+	BaseTypeOID uint32
+	// Labels are the labels of an enum.
+	Labels []string
+	// NotNull, Default, and Check are the constraints of a domain. Check refers to the value as VALUE.
+	NotNull bool
+	Default string
+	Check   string
+}
+
+// definition returns the definition of the type in DuckDB.
+func (t *UserType) definition() string {
+	if t.Kind != UserTypeEnum {
+		return t.BaseType
+	}
+	labels := make([]string, len(t.Labels))
+	for i, label := range t.Labels {
+		labels[i] = quoteStringLiteral(label)
+	}
+	return "ENUM (" + strings.Join(labels, ", ") + ")"
+}
+
+// CreateUserType creates a type in DuckDB, assigns it an OID, and registers it.
+// The caller runs it in a transaction, so that a failure leaves neither the type nor a part of its registration behind.
+func CreateUserType(ctx *sql.Context, t *UserType) error {
+	if _, err := adapter.Exec(ctx, "CREATE TYPE "+ConnectIdentifiersANSI(t.Schema, t.Name)+" AS "+t.definition()); err != nil {
+		return err
+	}
+
+	oid, err := nextObjectOID(ctx)
+	if err != nil {
+		return err
+	}
+	t.OID = oid
+
+	labels, err := json.Marshal(t.Labels)
+	if err != nil {
+		return err
+	}
+	if _, err := adapter.ExecCatalog(ctx,
+		"INSERT INTO "+InternalTables.UserTypes.QualifiedName()+
+			" (schema_name, type_name, oid, kind, base_type, base_type_oid, labels, not_null, default_value, check_constraint)"+
+			" VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		t.Schema, t.Name, t.OID, t.Kind, t.BaseType, t.BaseTypeOID, string(labels), t.NotNull, t.Default, t.Check,
+	); err != nil {
+		return ErrDuckDB.New(err)
+	}
+
+	// The attributes of a domain follow its base type.
+	var typlen, typbyval, typcategory, typalign, typstorage string
+	switch t.Kind {
+	case UserTypeEnum:
+		typlen, typbyval, typcategory, typalign, typstorage = "4", "true", "'E'", "'i'", "'p'"
+	case UserTypeDomain:
+		typlen, typbyval, typcategory, typalign, typstorage = "b.typlen", "b.typbyval", "b.typcategory", "b.typalign", "b.typstorage"
+	default:
+		typlen, typbyval, typcategory, typalign, typstorage = "-1", "false", "'C'", "'d'", "'x'"
+	}
+	if _, err := adapter.ExecCatalog(ctx,
+		"INSERT INTO "+InternalTables.PGType.QualifiedName()+
+			" (oid, typname, typnamespace, typowner, typlen, typbyval, typtype, typcategory, typispreferred, typisdefined,"+
+			" typdelim, typrelid, typsubscript, typelem, typarray, typinput, typoutput, typreceive, typsend, typmodin,"+
+			" typmodout, typanalyze, typalign, typstorage, typnotnull, typbasetype, typtypmod, typndims, typcollation,"+
+			" typdefaultbin, typdefault, typacl)"+
+			" SELECT ?, ?, coalesce((SELECT oid FROM "+InternalTables.PGNamespace.QualifiedName()+" WHERE nspname = ?), 2200), 10, "+
+			typlen+", "+typbyval+", ?, "+typcategory+", false, true, ',', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, "+
+			typalign+", "+typstorage+", ?, ?, -1, 0, 0, NULL, ?, NULL"+
+			" FROM (SELECT 1) LEFT JOIN "+InternalTables.PGType.QualifiedName()+" b ON b.oid = ?",
+		t.OID, t.Name, t.Schema, t.Kind, t.NotNull, t.BaseTypeOID, nullIfEmpty(t.Default), t.BaseTypeOID,
+	); err != nil {
+		return ErrDuckDB.New(err)
+	}
+
+	for i, label := range t.Labels {
+		labelOID, err := nextObjectOID(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := adapter.ExecCatalog(ctx,
+			"INSERT INTO "+InternalTables.PGEnum.QualifiedName()+" (oid, enumtypid, enumsortorder, enumlabel) VALUES (?, ?, ?, ?)",
+			labelOID, t.OID, i+1, label,
+		); err != nil {
+			return ErrDuckDB.New(err)
+		}
+	}
+	return nil
+}
+
+// DropUserType drops a type in DuckDB and unregisters it.
+// The types that are not registered, e.g., the ones created over the MySQL protocol, are dropped as well.
+func DropUserType(ctx *sql.Context, schema, name string, ifExists, cascade bool) error {
+	var b strings.Builder
+	b.WriteString("DROP TYPE ")
+	if ifExists {
+		b.WriteString("IF EXISTS ")
+	}
+	b.WriteString(ConnectIdentifiersANSI(schema, name))
+	if cascade {
+		b.WriteString(" CASCADE")
+	}
+	if _, err := adapter.Exec(ctx, b.String()); err != nil {
+		return err
+	}
+
+	t, err := LookupUserType(ctx, schema, name)
+	if err != nil || t == nil {
+		return err
+	}
+	for _, stmt := range []string{
+		"DELETE FROM " + InternalTables.PGEnum.QualifiedName() + " WHERE enumtypid = ?",
+		"DELETE FROM " + InternalTables.PGType.QualifiedName() + " WHERE oid = ?",
+	} {
+		if _, err := adapter.ExecCatalog(ctx, stmt, t.OID); err != nil {
+			return ErrDuckDB.New(err)
+		}
+	}
+	if _, err := adapter.ExecCatalog(ctx, InternalTables.UserTypes.DeleteStmt(), schema, name); err != nil {
+		return ErrDuckDB.New(err)
+	}
+	return nil
+}
+
+// LookupUserType returns the registered type with the given name, or nil if there is none.
+func LookupUserType(ctx *sql.Context, schema, name string) (*UserType, error) {
+	types, err := queryUserTypes(ctx, " WHERE schema_name = ? AND type_name = ?", schema, name)
+	if err != nil || len(types) == 0 {
+		return nil, err
+	}
+	return types[0], nil
+}
+
+// LookupDomains returns the registered domains that have constraints.
+func LookupDomains(ctx *sql.Context) ([]*UserType, error) {
+	return queryUserTypes(ctx,
+		" WHERE kind = ? AND (not_null OR coalesce(default_value, '') <> '' OR coalesce(check_constraint, '') <> '')",
+		UserTypeDomain,
+	)
+}
+
+func queryUserTypes(ctx *sql.Context, where string, args ...any) ([]*UserType, error) {
+	rows, err := adapter.QueryCatalog(ctx,
+		"SELECT schema_name, type_name, oid, kind, coalesce(base_type, ''), coalesce(base_type_oid, 0), coalesce(labels, 'null'),"+
+			" coalesce(not_null, false), coalesce(default_value, ''), coalesce(check_constraint, '')"+
+			" FROM "+InternalTables.UserTypes.QualifiedName()+where,
+		args...,
+	)
+	if err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+	defer rows.Close()
+
+	var types []*UserType
+	for rows.Next() {
+		var t UserType
+		var labels string
+		if err := rows.Scan(&t.Schema, &t.Name, &t.OID, &t.Kind, &t.BaseType, &t.BaseTypeOID, &labels, &t.NotNull, &t.Default, &t.Check); err != nil {
+			return nil, ErrDuckDB.New(err)
+		}
+		if err := json.Unmarshal([]byte(labels), &t.Labels); err != nil {
+			return nil, err
+		}
+		types = append(types, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ErrDuckDB.New(err)
+	}
+	return types, nil
+}
+
+// objectOIDSequence is the sequence of the OIDs of the user-defined types, their enum labels, and the sequences,
+// created by the CatalogMigrations. An OID taken by a rolled back transaction is not reused.
+const objectOIDSequence = "__sys__.object_oids"
+
+// nextObjectOID returns a new OID for an object listed in pg_type, pg_enum, or pg_class.
+func nextObjectOID(ctx *sql.Context) (uint32, error) {
+	var oid uint32
+	if err := adapter.QueryRowCatalog(ctx, "SELECT nextval('"+objectOIDSequence+"')").Scan(&oid); err != nil {
+		return 0, ErrDuckDB.New(err)
+	}
+	return oid, nil
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
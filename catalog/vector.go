@@ -0,0 +1,89 @@
+package catalog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The vectors of MySQL, i.e., the columns of type VECTOR(n), are stored as the fixed-size arrays of DuckDB,
+// e.g., FLOAT[3], the same as the vectors created over the Postgres protocol (see pgserver/vector.go),
+// so that both protocols share them. The engine has no vector type, so VECTOR(n) is replaced with JSON
+// before the statement is parsed, see ReplaceVectorTypes, and the dimension of a column is looked up
+// in the original statement when the column is created, as the display width of an integer is.
+// The engine reads the vectors as JSON arrays, see mysqlDataType.
+
+// MaxVectorDimension is the maximum dimension of a vector column of MySQL.
+const MaxVectorDimension = 16383
+
+// vectorTypeRegex matches a column, or a cast, of type `VECTOR(n)`.
+var vectorTypeRegex = regexp.MustCompile("(?i)(`(?:[^`]|``)+`|[A-Za-z0-9_$\\x{80}-\\x{10FFFF}]+)\\s+(VECTOR\\s*\\(\\s*(\\d+)\\s*\\))")
+
+// ReplaceVectorTypes replaces the types `VECTOR(n)` in the statement with JSON, padded with spaces,
+// so that the positions in the statement are kept.
+func ReplaceVectorTypes(query string) (replaced string, ok bool) {
+	if !strings.Contains(strings.ToUpper(query), "VECTOR") {
+		return query, false
+	}
+	matches := vectorTypeRegex.FindAllStringSubmatchIndex(maskStringLiterals(query), -1)
+	if len(matches) == 0 {
+		return query, false
+	}
+	b := []byte(query)
+	for _, m := range matches {
+		copy(b[m[4]:m[5]], "JSON"+strings.Repeat(" ", m[5]-m[4]-len("JSON")))
+	}
+	return string(b), true
+}
+
+// vectorDimensions returns the dimensions of the vector columns defined by the statement by their lower-cased names.
+func vectorDimensions(query string) map[string]int {
+	if !strings.Contains(strings.ToUpper(query), "VECTOR") {
+		return nil
+	}
+	masked := maskStringLiterals(query)
+	dims := make(map[string]int)
+	for _, m := range vectorTypeRegex.FindAllStringSubmatchIndex(masked, -1) {
+		name := query[m[2]:m[3]]
+		if strings.HasPrefix(name, "`") {
+			name = strings.ReplaceAll(name[1:len(name)-1], "``", "`")
+		}
+		// The invalid dimensions are kept negative to be rejected, since zero stands for a column that is not a vector.
+		dim, err := strconv.Atoi(query[m[6]:m[7]])
+		if err != nil || dim <= 0 {
+			dim = -1
+		}
+		dims[strings.ToLower(name)] = dim
+	}
+	return dims
+}
+
+// newVectorType returns the annotated DuckDB type of a vector column of the dimension.
+func newVectorType(dim int) (AnnotatedDuckType, error) {
+	if dim <= 0 || dim > MaxVectorDimension {
+		return AnnotatedDuckType{}, fmt.Errorf("the dimension of a vector must be between 1 and %d", MaxVectorDimension)
+	}
+	return AnnotatedDuckType{fmt.Sprintf("FLOAT[%d]", dim), MySQLType{Name: "VECTOR", Length: uint32(dim)}}, nil
+}
+
+// maskStringLiterals returns the statement with the content of the string literals replaced with spaces,
+// so that the types can be matched outside them at the same positions.
+func maskStringLiterals(query string) string {
+	masked := []byte(query)
+	for i := 0; i < len(masked); {
+		switch masked[i] {
+		case '\'', '"':
+			end := skipQuoted(query, i)
+			for j := i + 1; j < end-1; j++ {
+				masked[j] = ' '
+			}
+			i = end
+		case '`':
+			i = skipQuoted(query, i)
+		default:
+			i++
+		}
+	}
+	return string(masked)
+}
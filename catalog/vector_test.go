@@ -0,0 +1,44 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceVectorTypes(t *testing.T) {
+	query := "CREATE TABLE t (id INT PRIMARY KEY, `Embedding` VECTOR(3), note VARCHAR(10) DEFAULT 'v VECTOR(2)')"
+	replaced, ok := ReplaceVectorTypes(query)
+	require.True(t, ok)
+	require.Equal(t, "CREATE TABLE t (id INT PRIMARY KEY, `Embedding` JSON     , note VARCHAR(10) DEFAULT 'v VECTOR(2)')", replaced)
+	require.Len(t, replaced, len(query))
+	require.Equal(t, map[string]int{"embedding": 3}, vectorDimensions(query))
+
+	replaced, ok = ReplaceVectorTypes("ALTER TABLE t ADD COLUMN v vector ( 768 )")
+	require.True(t, ok)
+	require.Equal(t, "ALTER TABLE t ADD COLUMN v JSON          ", replaced)
+
+	_, ok = ReplaceVectorTypes("CREATE TABLE t (v JSON, VECTOR INDEX (v))")
+	require.False(t, ok)
+}
+
+func TestVectorColumnDataType(t *testing.T) {
+	definitions := columnDefinitions("CREATE TABLE t (id INT PRIMARY KEY, v VECTOR(3))")
+	require.Equal(t, columnAttributes{vector: 3}, definitions["v"])
+
+	mysqlType, typ, err := columnDataType(&sql.Column{Name: "v", Type: types.JSON}, definitions)
+	require.NoError(t, err)
+	require.Equal(t, types.JSON, mysqlType)
+	require.Equal(t, "FLOAT[3]", typ.Name())
+	require.Equal(t, MySQLType{Name: "VECTOR", Length: 3}, typ.MySQL())
+
+	// The engine reads the vectors as JSON arrays.
+	restored, err := mysqlDataType(typ, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, types.JSON, restored)
+
+	_, _, err = columnDataType(&sql.Column{Name: "v", Type: types.JSON}, columnDefinitions("CREATE TABLE t (v VECTOR(0))"))
+	require.Error(t, err)
+}
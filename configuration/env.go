@@ -7,6 +7,7 @@ import (
 
 const (
 	replicationWithoutIndex = "REPLICATION_WITHOUT_INDEX"
+	replicaSourceSecret     = "REPLICA_SOURCE_SECRET"
 )
 
 func IsReplicationWithoutIndex() bool {
@@ -16,3 +17,10 @@ func IsReplicationWithoutIndex() bool {
 	}
 	return false
 }
+
+// ReplicaSourceSecret returns the secret that the key encrypting the password of the replication source
+// is derived from. The servers that share the secret can decrypt the passwords in the restored
+// or bootstrapped data of each other. An empty secret means that a random key is kept in the data directory.
+func ReplicaSourceSecret() string {
+	return os.Getenv(replicaSourceSecret)
+}
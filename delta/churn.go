@@ -0,0 +1,28 @@
+package delta
+
+import (
+	stdsql "database/sql"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// recordChurn adds the numbers of the rows deleted or updated by the flushed deltas to the churn of the tables,
+// which decides the tables to be compacted. See catalog.InternalTables.TableChurn.
+func recordChurn(ctx *sql.Context, tx *stdsql.Tx, churn map[tableIdentifier]int) error {
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT INTO "+catalog.InternalTables.TableChurn.QualifiedName()+
+			" (schema_name, table_name, changed_rows, last_changed_at) VALUES (?, ?, ?, now())"+
+			" ON CONFLICT DO UPDATE SET changed_rows = changed_rows + excluded.changed_rows, last_changed_at = excluded.last_changed_at",
+	)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for table, n := range churn {
+		if _, err := stmt.ExecContext(ctx, table.dbName, table.tableName, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -32,6 +32,8 @@ type DeltaController struct {
 	mutex  sync.Mutex
 	tables map[tableIdentifier]*DeltaAppender
 	seed   maphash.Seed
+	// pending are the batches flushed since the last commit, see Committed.
+	pending []Batch
 }
 
 func NewController() *DeltaController {
@@ -69,6 +71,7 @@ func (c *DeltaController) Close() {
 		da.appender.Release()
 	}
 	clear(c.tables)
+	c.discardBatches()
 }
 
 // Flush writes the accumulated changes to the database.
@@ -98,12 +101,34 @@ func (c *DeltaController) Flush(ctx *sql.Context, conn *stdsql.Conn, tx *stdsql.
 	//  https://duckdb.org/docs/sql/indexes.html#limitations-of-art-indexes
 	//  https://github.com/duckdb/duckdb/issues/14133
 
-	var stats FlushStats
+	var (
+		stats         FlushStats
+		historyTables map[tableIdentifier]string
+		transforms    map[tableIdentifier]*RowTransform
+		churn         map[tableIdentifier]int
+		written       []tableIdentifier
+	)
 
 	for table, appender := range c.tables {
 		deltaRowCount := appender.RowCount()
 		if deltaRowCount > 0 {
-			if err := c.updateTable(ctx, conn, tx, table, appender, &stats); err != nil {
+			if historyTables == nil {
+				var err error
+				if historyTables, err = loadHistoryTables(ctx, tx); err != nil {
+					return stats, err
+				}
+				if transforms, err = loadRowTransforms(ctx, tx); err != nil {
+					return stats, err
+				}
+			}
+			written = append(written, table)
+			if n := appender.counters.event.delete + appender.counters.event.update; n > 0 {
+				if churn == nil {
+					churn = make(map[tableIdentifier]int)
+				}
+				churn[table] = n
+			}
+			if err := c.updateTable(ctx, conn, tx, table, appender, historyTables[table], transforms[table], reason, &stats); err != nil {
 				return stats, err
 			}
 		}
@@ -120,6 +145,17 @@ func (c *DeltaController) Flush(ctx *sql.Context, conn *stdsql.Conn, tx *stdsql.
 		}
 	}
 
+	if len(churn) > 0 {
+		if err := recordChurn(ctx, tx, churn); err != nil {
+			return stats, err
+		}
+	}
+	if len(written) > 0 {
+		if err := markFTSIndexesStale(ctx, tx, written); err != nil {
+			return stats, err
+		}
+	}
+
 	if stats.DeltaSize > 0 {
 		if log := ctx.GetLogger(); log.Logger.IsLevelEnabled(logrus.DebugLevel) {
 			log.WithFields(logrus.Fields{
@@ -140,6 +176,9 @@ func (c *DeltaController) updateTable(
 	tx *stdsql.Tx,
 	table tableIdentifier,
 	appender *DeltaAppender,
+	historyTable string,
+	transform *RowTransform,
+	reason FlushReason,
 	stats *FlushStats,
 ) error {
 	if tx == nil {
@@ -147,6 +186,17 @@ func (c *DeltaController) updateTable(
 	}
 	defer appender.ResetCounters()
 
+	record := appender.Build()
+	defer record.Release()
+	c.keepBatch(table, appender, record, reason)
+
+	// Retain the changes before they are condensed, if the table is in history mode.
+	if historyTable != "" {
+		if err := c.recordHistory(ctx, conn, tx, table, appender, record, historyTable); err != nil {
+			return err
+		}
+	}
+
 	// We consider the following cases:
 	//  1. INSERT only - no DELETE or UPDATE. In this case, we can do a simple INSERT INTO in an optimized way,
 	//     without the deduplication step (as the source has confirmed that there are no duplicates) and the DELETE step.
@@ -158,6 +208,9 @@ func (c *DeltaController) updateTable(
 	//     Therefore, the temporary table is not needed as the delta view will be read only once.
 	//  4. The general case - INSERT, DELETE, and UPDATE. In this case, we need to create a temporary table
 	//     to store the deduplicated delta and then do the INSERT and DELETE steps.
+	//
+	// The new rows are filtered and transformed by the transform of the table, if any. An update of a filtered table
+	// may delete the row if the row no longer satisfies the filter, so case 3 does not apply to such tables.
 
 	// Identify the types of changes in the delta
 	hasInserts := appender.counters.event.insert > 0
@@ -173,32 +226,33 @@ func (c *DeltaController) updateTable(
 	switch {
 	case hasInserts && !hasDeletes && !hasUpdates:
 		// Case 1: INSERT only
-		return c.handleInsertOnly(ctx, conn, tx, table, appender, stats)
+		return c.handleInsertOnly(ctx, conn, tx, table, appender, record, transform, stats)
 	case hasDeletes && !hasInserts && !hasUpdates:
 		// Case 2: DELETE only
-		return c.handleDeleteOnly(ctx, conn, tx, table, appender, stats)
-	case appender.counters.action.delete == 0 && !withoutIndex:
+		return c.handleDeleteOnly(ctx, conn, tx, table, appender, record, stats)
+	case appender.counters.action.delete == 0 && !withoutIndex && transform.rejects() == "":
 		// Case 3: INSERT + non-primary-key UPDATE
-		return c.handleZeroDelete(ctx, conn, tx, table, appender, stats)
+		return c.handleZeroDelete(ctx, conn, tx, table, appender, record, transform, stats)
 	case withoutIndex:
 		// Case 4: Without index
-		return c.handleWithoutIndex(ctx, conn, tx, table, appender, stats)
+		return c.handleWithoutIndex(ctx, conn, tx, table, appender, record, transform, stats)
 	default:
 		// Case 4: General case
-		return c.handleGeneralCase(ctx, conn, tx, table, appender, stats)
+		return c.handleGeneralCase(ctx, conn, tx, table, appender, record, transform, stats)
 	}
 }
 
-// Helper function to build the Arrow record and register the view
+// Helper function to project the Arrow record and register the view
 func (c *DeltaController) prepareArrowView(
 	ctx *sql.Context,
 	conn *stdsql.Conn,
 	table tableIdentifier,
-	appender *DeltaAppender,
+	record arrow.Record,
 	fieldOffset int,
 	fieldIndices []int,
 ) (viewName string, close func(), err error) {
-	record := appender.Build()
+	// The record is shared by the views of the same delta, each of which holds a reference to it.
+	record.Retain()
 
 	// fmt.Println("record:", record)
 
@@ -269,10 +323,12 @@ func (c *DeltaController) handleInsertOnly(
 	tx *stdsql.Tx,
 	table tableIdentifier,
 	appender *DeltaAppender,
+	record arrow.Record,
+	transform *RowTransform,
 	stats *FlushStats,
 ) error {
 	// Ignore the augmented fields
-	viewName, release, err := c.prepareArrowView(ctx, conn, table, appender, appender.NumAugmentedFields(), nil)
+	viewName, release, err := c.prepareArrowView(ctx, conn, table, record, appender.NumAugmentedFields(), nil)
 	if err != nil {
 		return err
 	}
@@ -282,14 +338,15 @@ func (c *DeltaController) handleInsertOnly(
 	var b strings.Builder
 	b.Grow(128)
 
-	b.WriteString("INSERT INTO ")
-	b.WriteString(catalog.ConnectIdentifiersANSI(table.dbName, table.tableName))
-	b.WriteString(" SELECT ")
+	b.WriteString("SELECT ")
 	buildColumnList(&b, appender.BaseSchema())
 	b.WriteString(" FROM ")
 	b.WriteString(viewName)
 
-	sql := b.String()
+	sql := "INSERT INTO " +
+		catalog.ConnectIdentifiersANSI(table.dbName, table.tableName) +
+		targetColumnList(appender.BaseSchema()) +
+		" " + transform.Apply(b.String(), appender.BaseSchema())
 
 	result, err := tx.ExecContext(ctx, sql)
 	if err != nil {
@@ -320,10 +377,11 @@ func (c *DeltaController) handleDeleteOnly(
 	tx *stdsql.Tx,
 	table tableIdentifier,
 	appender *DeltaAppender,
+	record arrow.Record,
 	stats *FlushStats,
 ) error {
 	// Ignore all but the primary key fields
-	viewName, release, err := c.prepareArrowView(ctx, conn, table, appender, 0, getPrimaryKeyIndices(appender))
+	viewName, release, err := c.prepareArrowView(ctx, conn, table, record, 0, getPrimaryKeyIndices(appender))
 	if err != nil {
 		return err
 	}
@@ -364,9 +422,11 @@ func (c *DeltaController) handleZeroDelete(
 	tx *stdsql.Tx,
 	table tableIdentifier,
 	appender *DeltaAppender,
+	record arrow.Record,
+	transform *RowTransform,
 	stats *FlushStats,
 ) error {
-	viewName, release, err := c.prepareArrowView(ctx, conn, table, appender, 0, nil)
+	viewName, release, err := c.prepareArrowView(ctx, conn, table, record, 0, nil)
 	if err != nil {
 		return err
 	}
@@ -376,7 +436,8 @@ func (c *DeltaController) handleZeroDelete(
 
 	insertSQL := "INSERT OR REPLACE INTO " +
 		catalog.ConnectIdentifiersANSI(table.dbName, table.tableName) +
-		" SELECT * EXCLUDE (" + AugmentedColumnList + ") FROM (" + condenseDeltaSQL + ")"
+		targetColumnList(appender.BaseSchema()) + " " +
+		transform.Apply("SELECT * EXCLUDE ("+AugmentedColumnList+") FROM ("+condenseDeltaSQL+")", appender.BaseSchema())
 	result, err := tx.ExecContext(ctx, insertSQL)
 	if err != nil {
 		return err
@@ -407,9 +468,10 @@ func (c *DeltaController) materializeCondensedDelta(
 	tx *stdsql.Tx,
 	table tableIdentifier,
 	appender *DeltaAppender,
+	record arrow.Record,
 	stats *FlushStats,
 ) error {
-	viewName, release, err := c.prepareArrowView(ctx, conn, table, appender, 0, nil)
+	viewName, release, err := c.prepareArrowView(ctx, conn, table, record, 0, nil)
 	if err != nil {
 		return err
 	}
@@ -445,9 +507,11 @@ func (c *DeltaController) handleGeneralCase(
 	tx *stdsql.Tx,
 	table tableIdentifier,
 	appender *DeltaAppender,
+	record arrow.Record,
+	transform *RowTransform,
 	stats *FlushStats,
 ) error {
-	if err := c.materializeCondensedDelta(ctx, conn, tx, table, appender, stats); err != nil {
+	if err := c.materializeCondensedDelta(ctx, conn, tx, table, appender, record, stats); err != nil {
 		return err
 	}
 	defer tx.ExecContext(ctx, "DROP TABLE IF EXISTS temp.main.delta")
@@ -458,8 +522,9 @@ func (c *DeltaController) handleGeneralCase(
 	// Insert or replace new rows (action = INSERT) into the base table.
 	insertSQL := "INSERT OR REPLACE INTO " +
 		qualifiedTableName +
-		" SELECT * EXCLUDE (" + AugmentedColumnList + ") FROM temp.main.delta WHERE action = " +
-		strconv.Itoa(int(binlog.InsertRowEvent))
+		targetColumnList(appender.BaseSchema()) + " " +
+		transform.Apply("SELECT * EXCLUDE ("+AugmentedColumnList+") FROM temp.main.delta WHERE action = "+
+			strconv.Itoa(int(binlog.InsertRowEvent)), appender.BaseSchema())
 	result, err := tx.ExecContext(ctx, insertSQL)
 	if err == nil {
 		affected, err = result.RowsAffected()
@@ -477,15 +542,19 @@ func (c *DeltaController) handleGeneralCase(
 		}).Debug("Upserted")
 	}
 
-	// Delete rows that have been deleted.
+	// Delete rows that have been deleted, or that are filtered out by the transform of the table.
 	// The plan for `IN` is optimized to a SEMI JOIN,
 	// which is more efficient than ordinary INNER JOIN.
 	// DuckDB does not support multiple columns in `IN` clauses,
 	// so we need to handle this case separately using the `row()` function.
+	deleted := "action = " + strconv.Itoa(int(binlog.DeleteRowEvent))
+	if rejects := transform.rejects(); rejects != "" {
+		deleted += " OR " + rejects
+	}
 	inTuple := getPrimaryKeyStruct(appender.BaseSchema())
 	deleteSQL := "DELETE FROM " + qualifiedTableName +
 		" WHERE " + inTuple + " IN (SELECT " + inTuple +
-		"FROM temp.main.delta WHERE action = " + strconv.Itoa(int(binlog.DeleteRowEvent)) + ")"
+		"FROM temp.main.delta WHERE " + deleted + ")"
 	result, err = tx.ExecContext(ctx, deleteSQL)
 	if err == nil {
 		affected, err = result.RowsAffected()
@@ -539,9 +608,11 @@ func (c *DeltaController) handleWithoutIndex(
 	tx *stdsql.Tx,
 	table tableIdentifier,
 	appender *DeltaAppender,
+	record arrow.Record,
+	transform *RowTransform,
 	stats *FlushStats,
 ) error {
-	if err := c.materializeCondensedDelta(ctx, conn, tx, table, appender, stats); err != nil {
+	if err := c.materializeCondensedDelta(ctx, conn, tx, table, appender, record, stats); err != nil {
 		return err
 	}
 	defer tx.ExecContext(ctx, "DROP TABLE IF EXISTS temp.main.delta")
@@ -577,8 +648,9 @@ func (c *DeltaController) handleWithoutIndex(
 	// Insert new rows (action = INSERT) into the base table.
 	insertSQL := "INSERT INTO " +
 		qualifiedTableName +
-		" SELECT * EXCLUDE (" + AugmentedColumnList + ") " +
-		"FROM temp.main.delta WHERE action = " + strconv.Itoa(int(binlog.InsertRowEvent))
+		targetColumnList(appender.BaseSchema()) + " " +
+		transform.Apply("SELECT * EXCLUDE ("+AugmentedColumnList+") "+
+			"FROM temp.main.delta WHERE action = "+strconv.Itoa(int(binlog.InsertRowEvent)), appender.BaseSchema())
 	result, err = tx.ExecContext(ctx, insertSQL)
 	if err == nil {
 		affected, err = result.RowsAffected()
@@ -599,17 +671,35 @@ func (c *DeltaController) handleWithoutIndex(
 	return nil
 }
 
-// Helper function to build column list with timestamp handling
+// Helper function to build column list with timestamp handling.
+// The columns keep their names, so that the list may be the source of RowTransform.Apply.
 func buildColumnList(b *strings.Builder, schema sql.Schema) {
 	for i, col := range schema {
 		if i > 0 {
 			b.WriteString(", ")
 		}
-		b.WriteString(catalog.QuoteIdentifierANSI(col.Name))
+		name := catalog.QuoteIdentifierANSI(col.Name)
+		b.WriteString(name)
 		if isTimestampType(col.Type) {
-			b.WriteString("::TIMESTAMP")
+			b.WriteString("::TIMESTAMP AS ")
+			b.WriteString(name)
+		}
+	}
+}
+
+// Helper function to build the target column list of INSERT.
+// The columns are named explicitly, so that the columns added to the table on this side, if any, are left to their defaults.
+func targetColumnList(schema sql.Schema) string {
+	var b strings.Builder
+	b.WriteString(" (")
+	for i, col := range schema {
+		if i > 0 {
+			b.WriteString(", ")
 		}
+		b.WriteString(catalog.QuoteIdentifierANSI(col.Name))
 	}
+	b.WriteString(")")
+	return b.String()
 }
 
 // Helper function to get the primary key indices.
@@ -21,6 +21,8 @@ const (
 	InitFlushReason
 	// OnCloseFlushReason means that the changes have to be flushed because the controller is closed.
 	OnCloseFlushReason
+	// ManualFlushReason means that the changes have to be flushed because a flush is requested explicitly.
+	ManualFlushReason
 )
 
 func (r FlushReason) String() string {
@@ -41,6 +43,8 @@ func (r FlushReason) String() string {
 		return "Init"
 	case OnCloseFlushReason:
 		return "OnClose"
+	case ManualFlushReason:
+		return "Manual"
 	default:
 		return "Unknown"
 	}
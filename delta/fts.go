@@ -0,0 +1,24 @@
+package delta
+
+import (
+	stdsql "database/sql"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// markFTSIndexesStale marks the full-text indexes of the tables written by the flushed deltas stale,
+// so that they are rebuilt before they are searched. See catalog.RefreshFTSIndexes.
+func markFTSIndexesStale(ctx *sql.Context, tx *stdsql.Tx, tables []tableIdentifier) error {
+	stmt, err := tx.PrepareContext(ctx, catalog.MarkFTSIndexStaleStmt())
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, table := range tables {
+		if _, err := stmt.ExecContext(ctx, table.dbName, table.tableName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
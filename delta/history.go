@@ -0,0 +1,124 @@
+package delta
+
+import (
+	stdsql "database/sql"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/sirupsen/logrus"
+)
+
+// loadHistoryTables returns the history tables of the tables in history mode.
+func loadHistoryTables(ctx *sql.Context, tx *stdsql.Tx) (map[tableIdentifier]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT schema_name, table_name, history_table FROM "+catalog.InternalTables.HistoryTables.QualifiedName())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := make(map[tableIdentifier]string)
+	for rows.Next() {
+		var id tableIdentifier
+		var historyTable string
+		if err := rows.Scan(&id.dbName, &id.tableName, &historyTable); err != nil {
+			return nil, err
+		}
+		tables[id] = historyTable
+	}
+	return tables, rows.Err()
+}
+
+// recordHistory appends the changes in the delta to the history table, along with the transactions that made them.
+// The changes are recorded as they are, i.e., an update is recorded as a deletion followed by an insertion.
+//
+// The columns added to the table after the history mode is enabled are not recorded,
+// unless they are added to the history table as well.
+func (c *DeltaController) recordHistory(
+	ctx *sql.Context,
+	conn *stdsql.Conn,
+	tx *stdsql.Tx,
+	table tableIdentifier,
+	appender *DeltaAppender,
+	record arrow.Record,
+	historyTable string,
+) error {
+	historyColumns, err := loadColumnNames(ctx, tx, table.dbName, historyTable)
+	if err != nil {
+		return err
+	}
+
+	var columns []*sql.Column
+	for _, col := range appender.BaseSchema() {
+		if _, ok := historyColumns[col.Name]; ok {
+			columns = append(columns, col)
+		}
+	}
+
+	viewName, release, err := c.prepareArrowView(ctx, conn, table, record, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var b strings.Builder
+	b.Grow(256)
+	b.WriteString("INSERT INTO ")
+	b.WriteString(catalog.ConnectIdentifiersANSI(table.dbName, historyTable))
+	b.WriteString(" (")
+	for _, col := range columns {
+		b.WriteString(catalog.QuoteIdentifierANSI(col.Name))
+		b.WriteString(", ")
+	}
+	for i, col := range catalog.HistoryColumns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(col.Name)
+	}
+	b.WriteString(") SELECT ")
+	buildColumnList(&b, columns)
+	if len(columns) > 0 {
+		b.WriteString(", ")
+	}
+	// The changes are visible since the transaction of the flush commits, which is the time they are recorded at.
+	b.WriteString(AugmentedColumnList + ", now() FROM ")
+	b.WriteString(viewName)
+
+	result, err := tx.ExecContext(ctx, b.String())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if log := ctx.GetLogger(); log.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		log.WithFields(logrus.Fields{
+			"db":    table.dbName,
+			"table": table.tableName,
+			"rows":  affected,
+		}).Debug("Recorded history")
+	}
+	return nil
+}
+
+func loadColumnNames(ctx *sql.Context, tx *stdsql.Tx, schema, table string) (map[string]struct{}, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT column_name FROM duckdb_columns() WHERE schema_name = ? AND table_name = ?", schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = struct{}{}
+	}
+	return columns, rows.Err()
+}
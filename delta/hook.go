@@ -0,0 +1,114 @@
+package delta
+
+import (
+	"sync"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// WriteHook is notified of the changes committed by the replication, so that integrators can maintain secondary
+// indexes or caches, or push the changes to search engines, without forking the replication code.
+// The hooks are registered at startup with RegisterWriteHook.
+type WriteHook interface {
+	// OnCommit is called with the batches flushed in a transaction after it has committed, in the order of the flushes.
+	// It runs on the replication goroutine, so it should hand off any slow work. The records are released after
+	// OnCommit returns, so they must be retained to be used later. An error is logged and does not stop the replication,
+	// since the changes have been committed already.
+	OnCommit(ctx *sql.Context, batches []Batch) error
+}
+
+// Batch is the changes of a table flushed from the delta buffer.
+type Batch struct {
+	Database string
+	Table    string
+	// Schema is the schema of the table, without the augmented columns of Record.
+	Schema sql.Schema
+	// Record holds the changed rows, whose first columns are the augmented columns listed in AugmentedColumnList,
+	// followed by the columns of the table. The `action` column is 0 for a deletion and 2 for an insertion,
+	// and an update is a deletion followed by an insertion.
+	Record arrow.Record
+	Stats  BatchStats
+	Reason FlushReason
+}
+
+// BatchStats are the numbers of the row events and the resulting actions in a Batch.
+type BatchStats struct {
+	InsertEvents int
+	UpdateEvents int
+	DeleteEvents int
+	Insertions   int
+	Deletions    int
+}
+
+var (
+	writeHooksMu sync.RWMutex
+	writeHooks   []WriteHook
+)
+
+// RegisterWriteHook adds a hook that is notified of the changes committed by the replication.
+func RegisterWriteHook(hook WriteHook) {
+	writeHooksMu.Lock()
+	defer writeHooksMu.Unlock()
+	writeHooks = append(writeHooks, hook)
+}
+
+func registeredWriteHooks() []WriteHook {
+	writeHooksMu.RLock()
+	defer writeHooksMu.RUnlock()
+	return writeHooks
+}
+
+// Committed notifies the write hooks of the batches flushed since the last commit,
+// after the transaction that applied them has committed.
+func (c *DeltaController) Committed(ctx *sql.Context) {
+	c.mutex.Lock()
+	batches := c.pending
+	c.pending = nil
+	c.mutex.Unlock()
+	if len(batches) == 0 {
+		return
+	}
+	defer releaseBatches(batches)
+
+	for _, hook := range registeredWriteHooks() {
+		if err := hook.OnCommit(ctx, batches); err != nil {
+			ctx.GetLogger().WithError(err).Warnf("Write hook %T failed", hook)
+		}
+	}
+}
+
+// keepBatch keeps the batch until the transaction that applies it commits, if any write hook is registered.
+// The caller must hold the mutex.
+func (c *DeltaController) keepBatch(table tableIdentifier, appender *DeltaAppender, record arrow.Record, reason FlushReason) {
+	if len(registeredWriteHooks()) == 0 {
+		return
+	}
+	record.Retain()
+	c.pending = append(c.pending, Batch{
+		Database: table.dbName,
+		Table:    table.tableName,
+		Schema:   appender.BaseSchema(),
+		Record:   record,
+		Stats: BatchStats{
+			InsertEvents: appender.counters.event.insert,
+			UpdateEvents: appender.counters.event.update,
+			DeleteEvents: appender.counters.event.delete,
+			Insertions:   appender.counters.action.insert,
+			Deletions:    appender.counters.action.delete,
+		},
+		Reason: reason,
+	})
+}
+
+// discardBatches releases the batches kept since the last commit. The caller must hold the mutex.
+func (c *DeltaController) discardBatches() {
+	releaseBatches(c.pending)
+	c.pending = nil
+}
+
+func releaseBatches(batches []Batch) {
+	for _, b := range batches {
+		b.Record.Release()
+	}
+}
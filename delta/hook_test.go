@@ -0,0 +1,69 @@
+package delta
+
+import (
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apecloud/myduckserver/binlog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingHook struct {
+	batches []Batch
+	rows    []int64
+}
+
+func (h *recordingHook) OnCommit(ctx *sql.Context, batches []Batch) error {
+	for _, b := range batches {
+		h.batches = append(h.batches, b)
+		h.rows = append(h.rows, b.Record.Column(6).(*array.Int64).Value(0))
+	}
+	return nil
+}
+
+func TestWriteHook(t *testing.T) {
+	hook := &recordingHook{}
+	RegisterWriteHook(hook)
+	defer func() { writeHooks = nil }()
+
+	ctx := sql.NewEmptyContext()
+	c := NewController()
+	schema := sql.Schema{{Name: "id", Type: types.Int64}}
+
+	keep := func(id int64) {
+		appender, err := c.GetDeltaAppender("db", "t", schema)
+		require.NoError(t, err)
+		appender.Action().Append(int8(binlog.InsertRowEvent))
+		appender.TxnTag().AppendNull()
+		appender.TxnServer().Append([]byte(""))
+		appender.TxnGroup().AppendNull()
+		appender.TxnSeqNumber().Append(1)
+		appender.TxnStmtOrdinal().Append(0)
+		appender.Field(0).(*array.Int64Builder).Append(id)
+		appender.UpdateActionStats(binlog.InsertRowEvent, 1)
+		appender.ObserveEvents(binlog.InsertRowEvent, 1)
+
+		record := appender.Build()
+		c.keepBatch(tableIdentifier{"db", "t"}, appender, record, TimeTickFlushReason)
+		record.Release()
+		appender.ResetCounters()
+	}
+
+	// The batches of a transaction are delivered once it commits.
+	keep(1)
+	keep(2)
+	require.Empty(t, hook.batches)
+	c.Committed(ctx)
+	require.Equal(t, []int64{1, 2}, hook.rows)
+	require.Equal(t, "t", hook.batches[0].Table)
+	require.Equal(t, BatchStats{InsertEvents: 1, Insertions: 1}, hook.batches[0].Stats)
+	require.Equal(t, TimeTickFlushReason, hook.batches[0].Reason)
+
+	// The batches of a transaction that is rolled back are never delivered.
+	keep(3)
+	c.Close()
+	c.Committed(ctx)
+	require.Equal(t, []int64{1, 2}, hook.rows)
+}
@@ -0,0 +1,88 @@
+package delta
+
+import (
+	stdsql "database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// RowTransform filters and transforms the rows of a table that are inserted by the flushes,
+// see catalog.RowFilterParam.
+type RowTransform struct {
+	// Filter is the condition of the rows to keep, or empty to keep all rows.
+	Filter string
+	// Columns maps the transformed columns to their expressions.
+	Columns map[string]string
+}
+
+// loadRowTransforms returns the transforms of the tables that have any.
+func loadRowTransforms(ctx *sql.Context, tx *stdsql.Tx) (map[tableIdentifier]*RowTransform, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT schema_name, table_name, row_filter, column_exprs FROM "+catalog.InternalTables.RowTransforms.QualifiedName())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transforms := make(map[tableIdentifier]*RowTransform)
+	for rows.Next() {
+		var id tableIdentifier
+		var filter, columns stdsql.NullString
+		if err := rows.Scan(&id.dbName, &id.tableName, &filter, &columns); err != nil {
+			return nil, err
+		}
+		t := &RowTransform{Filter: filter.String}
+		if columns.Valid {
+			if err := json.Unmarshal([]byte(columns.String), &t.Columns); err != nil {
+				return nil, err
+			}
+		}
+		transforms[id] = t
+	}
+	return transforms, rows.Err()
+}
+
+// Apply returns the query of the rows to insert into a table of the given schema, given the query of the new rows,
+// whose columns are named after the columns of the table. The rows are filtered and their columns are transformed.
+// A nil transform returns the query as it is.
+func (t *RowTransform) Apply(query string, schema sql.Schema) string {
+	if t == nil {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 128)
+	b.WriteString("SELECT ")
+	for i, col := range schema {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		name := catalog.QuoteIdentifierANSI(col.Name)
+		if expr, ok := t.Columns[col.Name]; ok {
+			b.WriteString("(")
+			b.WriteString(expr)
+			b.WriteString(") AS ")
+		}
+		b.WriteString(name)
+	}
+	b.WriteString(" FROM (")
+	b.WriteString(query)
+	// OFFSET 0 keeps the filter from being pushed down into the scan of the Arrow view of the delta,
+	// which does not apply the filters correctly, see prepareArrowView.
+	b.WriteString(" OFFSET 0) AS __sys_row_transform__")
+	if t.Filter != "" {
+		b.WriteString(" WHERE (")
+		b.WriteString(t.Filter)
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// rejects returns the condition of the new rows that are filtered out, or "" if no rows are.
+func (t *RowTransform) rejects() string {
+	if t == nil || t.Filter == "" {
+		return ""
+	}
+	return "NOT coalesce((" + t.Filter + "), false)"
+}
@@ -0,0 +1,111 @@
+package delta
+
+import (
+	"context"
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apecloud/myduckserver/binlog"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	_ "github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowTransform(t *testing.T) {
+	for _, withoutIndex := range []string{"true", "false"} {
+		t.Run("without index "+withoutIndex, func(t *testing.T) {
+			t.Setenv("REPLICATION_WITHOUT_INDEX", withoutIndex)
+			testRowTransform(t)
+		})
+	}
+}
+
+func testRowTransform(t *testing.T) {
+	ctx := sql.NewEmptyContext()
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "CREATE SCHEMA __sys__")
+	require.NoError(t, err)
+	for _, it := range []catalog.InternalTable{
+		catalog.InternalTables.HistoryTables, catalog.InternalTables.TableChurn, catalog.InternalTables.RowTransforms,
+		catalog.InternalTables.FTSIndexes,
+	} {
+		_, err = conn.ExecContext(ctx, "CREATE TABLE "+it.QualifiedName()+" ("+it.DDL+")")
+		require.NoError(t, err)
+	}
+	_, err = conn.ExecContext(ctx, "CREATE TABLE t (id BIGINT PRIMARY KEY, tenant BIGINT, email VARCHAR)")
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, catalog.InternalTables.RowTransforms.UpsertStmt(), "main", "t", "tenant = 1", `{"email": "upper(email)"}`)
+	require.NoError(t, err)
+
+	c := NewController()
+	defer c.Close()
+	schema := sql.Schema{
+		{Name: "id", Type: types.Int64, PrimaryKey: true},
+		{Name: "tenant", Type: types.Int64},
+		{Name: "email", Type: types.Text},
+	}
+	appender, err := c.GetDeltaAppender("main", "t", schema)
+	require.NoError(t, err)
+	appendRow := func(action, event binlog.RowEventType, seq uint64, id, tenant int64, email string) {
+		appender.Action().Append(int8(action))
+		appender.TxnTag().AppendNull()
+		appender.TxnServer().Append([]byte(""))
+		appender.TxnGroup().AppendNull()
+		appender.TxnSeqNumber().Append(seq)
+		appender.TxnStmtOrdinal().Append(0)
+		appender.Field(0).(*array.Int64Builder).Append(id)
+		appender.Field(1).(*array.Int64Builder).Append(tenant)
+		appender.Field(2).(*array.StringBuilder).Append(email)
+		appender.UpdateActionStats(action, 1)
+		appender.ObserveEvents(event, 1)
+	}
+	flush := func() {
+		tx, err := conn.BeginTx(ctx, nil)
+		require.NoError(t, err)
+		_, err = c.Flush(ctx, conn, tx, TimeTickFlushReason)
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+	}
+	rows := func() [][]any {
+		rs, err := conn.QueryContext(ctx, "SELECT id, tenant, email FROM t ORDER BY id")
+		require.NoError(t, err)
+		defer rs.Close()
+		var result [][]any
+		for rs.Next() {
+			var id, tenant int64
+			var email string
+			require.NoError(t, rs.Scan(&id, &tenant, &email))
+			result = append(result, []any{id, tenant, email})
+		}
+		require.NoError(t, rs.Err())
+		return result
+	}
+
+	// Only the rows of the tenant are inserted, with their emails transformed.
+	appendRow(binlog.InsertRowEvent, binlog.InsertRowEvent, 1, 1, 1, "a@x")
+	appendRow(binlog.InsertRowEvent, binlog.InsertRowEvent, 1, 2, 2, "b@x")
+	flush()
+	require.Equal(t, [][]any{{int64(1), int64(1), "A@X"}}, rows())
+
+	// A row that moves out of the tenant is deleted, and a row that moves into it is inserted.
+	appendRow(binlog.DeleteRowEvent, binlog.UpdateRowEvent, 2, 1, 1, "a@x")
+	appendRow(binlog.InsertRowEvent, binlog.UpdateRowEvent, 2, 1, 2, "a@x")
+	appendRow(binlog.DeleteRowEvent, binlog.UpdateRowEvent, 2, 2, 2, "b@x")
+	appendRow(binlog.InsertRowEvent, binlog.UpdateRowEvent, 2, 2, 1, "b@y")
+	flush()
+	require.Equal(t, [][]any{{int64(2), int64(1), "B@Y"}}, rows())
+
+	// The rows are deleted regardless of the filter.
+	appendRow(binlog.DeleteRowEvent, binlog.DeleteRowEvent, 3, 2, 1, "b@y")
+	flush()
+	require.Empty(t, rows())
+}
@@ -304,8 +304,12 @@ func NewEngine(t *testing.T, harness enginetest.Harness, dbProvider sql.Database
 
 	builder := backend.NewDuckBuilder(e.Analyzer.ExecBuilder, provider)
 	e.Analyzer.ExecBuilder = builder
+	e.Parser = backend.NewParser()
 
 	ctx := enginetest.NewContext(harness)
+	if err := catalog.RegisterInformationSchemaTables(ctx, e.Analyzer.Catalog.InfoSchema); err != nil {
+		return nil, err
+	}
 
 	var supportsIndexes bool
 	if ih, ok := harness.(enginetest.IndexHarness); ok && ih.SupportsNativeIndexCreation() {
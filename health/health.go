@@ -0,0 +1,177 @@
+// Package health serves the liveness and readiness probes of the server over HTTP,
+// e.g., for the probes of Kubernetes and the health checks of load balancers:
+//
+//   - GET /livez succeeds if the process is up and DuckDB is responsive.
+//     It succeeds before the catalog is opened as well, e.g., during a restore at startup.
+//   - GET /readyz succeeds if the catalog is open, no restore is in progress,
+//     and the lags of the replication streams are within the threshold and have been updated recently.
+//
+// The probes respond with 200 OK or 503 Service Unavailable, along with the results of the checks in JSON.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const statusOK = "ok"
+
+var restoring atomic.Bool
+
+// SetRestoring sets whether a restore is in progress, during which the server is not ready.
+func SetRestoring(v bool) {
+	restoring.Store(v)
+}
+
+// Options are the options of the health server.
+type Options struct {
+	// Address is the address to listen on.
+	Address string
+	// MaxReplicationLag is the maximum lag of the replication streams for the server to be ready.
+	// The lags are not checked if it is not positive.
+	MaxReplicationLag time.Duration
+	// MaxReplicationSilence is the maximum time since the lag of a replication stream was last updated,
+	// beyond which the stream is considered stalled and the server is not ready.
+	// The staleness is not checked if it is not positive.
+	MaxReplicationSilence time.Duration
+	// Timeout is the timeout of the check of DuckDB.
+	Timeout time.Duration
+}
+
+// Server serves the liveness and readiness probes.
+type Server struct {
+	opts Options
+	ping atomic.Pointer[func(ctx context.Context) error]
+	srv  *http.Server
+}
+
+// NewServer creates a health server. The catalog is not open until SetPing is called.
+func NewServer(opts Options) *Server {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	s := &Server{opts: opts}
+	s.srv = &http.Server{
+		Addr:              opts.Address,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: opts.Timeout,
+	}
+	return s
+}
+
+// SetPing sets the function that checks that the catalog is open and DuckDB is responsive.
+func (s *Server) SetPing(ping func(ctx context.Context) error) {
+	s.ping.Store(&ping)
+}
+
+// Handler returns the handler of the probes.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", s.livez)
+	mux.HandleFunc("/healthz", s.livez)
+	mux.HandleFunc("/readyz", s.readyz)
+	return mux
+}
+
+// Start listens on the address and serves the probes in the background.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.opts.Address)
+	if err != nil {
+		return err
+	}
+	logrus.Infoln("Serving the health probes on", listener.Addr())
+	go func() {
+		if err := s.srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.WithError(err).Errorln("Failed to serve the health probes")
+		}
+	}()
+	return nil
+}
+
+// Close stops serving the probes.
+func (s *Server) Close() error {
+	return s.srv.Close()
+}
+
+// result is the response body of a probe.
+type result struct {
+	Status      string            `json:"status"`
+	Checks      map[string]string `json:"checks"`
+	Replication []ReplicationLag  `json:"replication,omitempty"`
+}
+
+func (s *Server) livez(w http.ResponseWriter, r *http.Request) {
+	res := result{Checks: make(map[string]string)}
+	if ping := s.ping.Load(); ping != nil {
+		res.Checks["duckdb"] = s.check(r.Context(), *ping)
+	}
+	respond(w, res)
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	res := result{Checks: make(map[string]string)}
+
+	if ping := s.ping.Load(); ping != nil {
+		res.Checks["catalog"] = s.check(r.Context(), *ping)
+	} else {
+		res.Checks["catalog"] = "not open"
+	}
+
+	if restoring.Load() {
+		res.Checks["restore"] = "in progress"
+	} else {
+		res.Checks["restore"] = statusOK
+	}
+
+	res.Replication = ReplicationLags()
+	res.Checks["replication"] = statusOK
+	for _, lag := range res.Replication {
+		if s.opts.MaxReplicationLag > 0 && lag.Lag > s.opts.MaxReplicationLag {
+			res.Checks["replication"] = fmt.Sprintf("%s lags behind by %s (max %s)",
+				lag.Name, lag.Lag.Round(time.Millisecond), s.opts.MaxReplicationLag)
+			break
+		}
+		if silence := time.Since(lag.UpdatedAt); s.opts.MaxReplicationSilence > 0 && silence > s.opts.MaxReplicationSilence {
+			res.Checks["replication"] = fmt.Sprintf("%s has not been heard from for %s (max %s)",
+				lag.Name, silence.Round(time.Millisecond), s.opts.MaxReplicationSilence)
+			break
+		}
+	}
+
+	respond(w, res)
+}
+
+func (s *Server) check(ctx context.Context, ping func(ctx context.Context) error) string {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	if err := ping(ctx); err != nil {
+		return err.Error()
+	}
+	return statusOK
+}
+
+// respond writes the result, whose status is ok if all checks are ok.
+func respond(w http.ResponseWriter, res result) {
+	res.Status = statusOK
+	code := http.StatusOK
+	for _, check := range res.Checks {
+		if check != statusOK {
+			res.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logrus.WithError(err).Warnln("Failed to write the health probe result")
+	}
+}
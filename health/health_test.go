@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, s *Server, path string) (int, result) {
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var res result
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	return rec.Code, res
+}
+
+func TestProbes(t *testing.T) {
+	s := NewServer(Options{MaxReplicationLag: time.Minute})
+
+	// Live but not ready before the catalog is open.
+	code, _ := probe(t, s, "/livez")
+	require.Equal(t, http.StatusOK, code)
+	code, res := probe(t, s, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "not open", res.Checks["catalog"])
+
+	var pingErr error
+	s.SetPing(func(context.Context) error { return pingErr })
+	code, _ = probe(t, s, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+
+	SetRestoring(true)
+	code, res = probe(t, s, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "in progress", res.Checks["restore"])
+	SetRestoring(false)
+
+	ReportCommit("sub", time.Now().Add(-time.Hour))
+	code, res = probe(t, s, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Len(t, res.Replication, 1)
+	require.Equal(t, "sub", res.Replication[0].Name)
+	require.GreaterOrEqual(t, res.Replication[0].LagSeconds, float64(3600))
+
+	// The lag is not checked by the liveness probe.
+	code, _ = probe(t, s, "/livez")
+	require.Equal(t, http.StatusOK, code)
+
+	ReportCaughtUp("sub")
+	code, _ = probe(t, s, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+
+	ReportCommit("sub", time.Now().Add(-time.Hour))
+	RemoveReplication("sub")
+	code, res = probe(t, s, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, res.Replication)
+
+	pingErr = errors.New("database is closed")
+	code, res = probe(t, s, "/livez")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "unavailable", res.Status)
+	require.Equal(t, "database is closed", res.Checks["duckdb"])
+}
+
+func TestReplicationSources(t *testing.T) {
+	s := NewServer(Options{MaxReplicationLag: time.Minute, MaxReplicationSilence: 100 * time.Millisecond})
+	s.SetPing(func(context.Context) error { return nil })
+	defer RemoveReplication("sub")
+
+	// The lag of a source is taken when it is checked.
+	var lag time.Duration
+	var updatedAt time.Time
+	WatchReplication("sub", func() (time.Duration, time.Time) { return lag, updatedAt })
+	code, res := probe(t, s, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, res.Replication, 1)
+
+	lag = time.Hour
+	code, res = probe(t, s, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Contains(t, res.Checks["replication"], "lags behind")
+
+	// A stream that has not been heard from for a while is stalled, even if it reported no lag.
+	// Until the source is heard from, it is given the time since it was registered.
+	lag, updatedAt = 0, time.Now().Add(-time.Hour)
+	code, _ = probe(t, s, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	time.Sleep(200 * time.Millisecond)
+	code, res = probe(t, s, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Contains(t, res.Checks["replication"], "has not been heard from")
+
+	ReportCaughtUp("sub")
+	code, _ = probe(t, s, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+}
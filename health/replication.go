@@ -0,0 +1,112 @@
+package health
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// The replication streams, i.e., the binlog replication from MySQL and the Postgres subscriptions,
+// report their lags here, which are checked by the readiness probe.
+//
+// The lag of a stream is the delay between the commit of a transaction on the source and its receipt,
+// measured whenever a transaction is received. It is reset to 0 when the source reports that there is
+// nothing more to send, e.g., by a heartbeat. Alternatively, a stream may register a LagSource, which is
+// asked for the lag whenever the lags are checked.
+//
+// The sources are expected to report regularly, e.g., on every heartbeat, so a lag that has not been
+// updated for a while indicates a stalled stream.
+
+var replication = struct {
+	sync.Mutex
+	lags    map[string]ReplicationLag
+	sources map[string]watchedSource
+}{lags: make(map[string]ReplicationLag), sources: make(map[string]watchedSource)}
+
+// LagSource returns the current lag of a replication stream and the last time the source was heard from,
+// which is zero if it has not been heard from yet.
+type LagSource func() (lag time.Duration, updatedAt time.Time)
+
+type watchedSource struct {
+	source LagSource
+	// since is the time the source was registered, which stands for updatedAt until the source is heard from.
+	since time.Time
+}
+
+// ReplicationLag is the lag of a replication stream.
+type ReplicationLag struct {
+	Name       string        `json:"name"`
+	Lag        time.Duration `json:"-"`
+	LagSeconds float64       `json:"lag_seconds"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+// ReportCommit records the lag of a replication stream at the receipt of a transaction committed on the source.
+func ReportCommit(name string, committedAt time.Time) {
+	if committedAt.IsZero() {
+		return
+	}
+	reportLag(name, max(time.Since(committedAt), 0))
+}
+
+// ReportCaughtUp records that a replication stream has received everything on the source.
+func ReportCaughtUp(name string) {
+	reportLag(name, 0)
+}
+
+// WatchReplication registers the LagSource of a replication stream, which replaces the lag reported so far.
+func WatchReplication(name string, source LagSource) {
+	replication.Lock()
+	defer replication.Unlock()
+	delete(replication.lags, name)
+	replication.sources[name] = watchedSource{source: source, since: time.Now()}
+}
+
+// RemoveReplication removes a stopped replication stream, whose lag is no longer checked.
+func RemoveReplication(name string) {
+	replication.Lock()
+	defer replication.Unlock()
+	delete(replication.lags, name)
+	delete(replication.sources, name)
+}
+
+func reportLag(name string, lag time.Duration) {
+	replication.Lock()
+	defer replication.Unlock()
+	delete(replication.sources, name)
+	replication.lags[name] = newReplicationLag(name, lag, time.Now())
+}
+
+func newReplicationLag(name string, lag time.Duration, updatedAt time.Time) ReplicationLag {
+	return ReplicationLag{
+		Name:       name,
+		Lag:        lag,
+		LagSeconds: lag.Seconds(),
+		UpdatedAt:  updatedAt,
+	}
+}
+
+// ReplicationLags returns the lags of the running replication streams, ordered by their names.
+func ReplicationLags() []ReplicationLag {
+	replication.Lock()
+	lags := make([]ReplicationLag, 0, len(replication.lags)+len(replication.sources))
+	for _, lag := range replication.lags {
+		lags = append(lags, lag)
+	}
+	sources := make(map[string]watchedSource, len(replication.sources))
+	for name, source := range replication.sources {
+		sources[name] = source
+	}
+	replication.Unlock()
+
+	// The sources are asked outside the lock, since they may take locks of their own.
+	for name, watched := range sources {
+		lag, updatedAt := watched.source()
+		if updatedAt.Before(watched.since) {
+			updatedAt = watched.since
+		}
+		lags = append(lags, newReplicationLag(name, max(lag, 0), updatedAt))
+	}
+	sort.Slice(lags, func(i, j int) bool { return lags[i].Name < lags[j].Name })
+	return lags
+}
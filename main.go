@@ -18,28 +18,20 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/apache/arrow-go/v18/arrow/flight"
-	"github.com/apache/arrow-go/v18/arrow/flight/flightsql"
-	"github.com/apecloud/myduckserver/backend"
 	"github.com/apecloud/myduckserver/catalog"
-	"github.com/apecloud/myduckserver/flightsqlserver"
-	"github.com/apecloud/myduckserver/myfunc"
+	"github.com/apecloud/myduckserver/health"
 	"github.com/apecloud/myduckserver/pgserver"
-	"github.com/apecloud/myduckserver/pgserver/logrepl"
-	"github.com/apecloud/myduckserver/pgserver/pgconfig"
-	"github.com/apecloud/myduckserver/plugin"
-	"github.com/apecloud/myduckserver/replica"
+	"github.com/apecloud/myduckserver/server"
+	"github.com/apecloud/myduckserver/shell"
 	"github.com/apecloud/myduckserver/transpiler"
-	sqle "github.com/dolthub/go-mysql-server"
-	"github.com/dolthub/go-mysql-server/memory"
-	"github.com/dolthub/go-mysql-server/server"
-	"github.com/dolthub/go-mysql-server/sql"
-	"github.com/dolthub/vitess/go/mysql"
 	_ "github.com/marcboeker/go-duckdb"
 	"github.com/sirupsen/logrus"
 )
@@ -47,21 +39,9 @@ import (
 var (
 	initMode = false
 
-	address       = "0.0.0.0"
-	port          = 3306
-	socket        string
-	defaultDb     = "myduck"
-	dataDirectory = "."
-	logLevel      = int(logrus.InfoLevel)
-
-	replicaOptions replica.ReplicaOptions
-
-	postgresPort = 5432
-
-	// Shared between the MySQL and Postgres servers.
-	superuserPassword = ""
-
-	defaultTimeZone = ""
+	// The configuration of the server, see server.Config.
+	cfg      = server.DefaultConfig()
+	logLevel = int(logrus.InfoLevel)
 
 	// for Restore
 	restoreFile            = ""
@@ -69,37 +49,69 @@ var (
 	restoreAccessKeyId     = ""
 	restoreSecretAccessKey = ""
 
-	flightsqlHost = "localhost"
-	flightsqlPort = -1 // Disabled by default
+	// for bootstrapping from a running server
+	bootstrapFrom = ""
+
+	healthPort                  = -1 // Disabled by default
+	healthMaxReplicationLag     = 30 * time.Second
+	healthMaxReplicationSilence = time.Minute
 )
 
 func init() {
 	flag.BoolVar(&initMode, "init", initMode, "Initialize the program and exit. The necessary extensions will be installed.")
 
-	flag.StringVar(&address, "address", address, "The address to bind to.")
-	flag.IntVar(&port, "port", port, "The port to bind to.")
-	flag.StringVar(&socket, "socket", socket, "The Unix domain socket to bind to.")
-	flag.StringVar(&dataDirectory, "datadir", dataDirectory, "The directory to store the database.")
-	flag.StringVar(&defaultDb, "default-db", defaultDb, "The default database name to use.")
+	flag.StringVar(&cfg.Address, "address", cfg.Address, "The address to bind to.")
+	flag.IntVar(&cfg.Port, "port", cfg.Port, "The port to bind to.")
+	flag.StringVar(&cfg.Socket, "socket", cfg.Socket, "The Unix domain socket to bind to.")
+	flag.StringVar(&cfg.DataDir, "datadir", cfg.DataDir, "The directory to store the database.")
+	flag.StringVar(&cfg.DefaultDB, "default-db", cfg.DefaultDB, "The default database name to use.")
 	flag.IntVar(&logLevel, "loglevel", logLevel, "The log level to use.")
 
-	flag.StringVar(&superuserPassword, "superuser-password", superuserPassword, "The password for the superuser account.")
-
-	flag.StringVar(&replicaOptions.ReportHost, "report-host", replicaOptions.ReportHost, "The host name or IP address of the replica to be reported to the source during replica registration.")
-	flag.IntVar(&replicaOptions.ReportPort, "report-port", replicaOptions.ReportPort, "The TCP/IP port number for connecting to the replica, to be reported to the source during replica registration.")
-	flag.StringVar(&replicaOptions.ReportUser, "report-user", replicaOptions.ReportUser, "The account user name of the replica to be reported to the source during replica registration.")
-	flag.StringVar(&replicaOptions.ReportPassword, "report-password", replicaOptions.ReportPassword, "The account password of the replica to be reported to the source during replica registration.")
-
-	flag.IntVar(&postgresPort, "pg-port", postgresPort, "The port to bind to for PostgreSQL wire protocol.")
-	flag.StringVar(&defaultTimeZone, "default-time-zone", defaultTimeZone, "The default time zone to use.")
+	flag.StringVar(&cfg.SuperuserPassword, "superuser-password", cfg.SuperuserPassword, "The password for the superuser account.")
+
+	flag.StringVar(&cfg.Replica.ReportHost, "report-host", cfg.Replica.ReportHost, "The host name or IP address of the replica to be reported to the source during replica registration.")
+	flag.IntVar(&cfg.Replica.ReportPort, "report-port", cfg.Replica.ReportPort, "The TCP/IP port number for connecting to the replica, to be reported to the source during replica registration.")
+	flag.StringVar(&cfg.Replica.ReportUser, "report-user", cfg.Replica.ReportUser, "The account user name of the replica to be reported to the source during replica registration.")
+	flag.StringVar(&cfg.Replica.ReportPassword, "report-password", cfg.Replica.ReportPassword, "The account password of the replica to be reported to the source during replica registration.")
+
+	flag.BoolVar(&cfg.MySQLCompression, "mysql-compression", cfg.MySQLCompression, "Support the compressed MySQL protocol (zlib and zstd) for clients that request it.")
+
+	flag.IntVar(&cfg.Postgres.Port, "pg-port", cfg.Postgres.Port, "The port to bind to for PostgreSQL wire protocol.")
+	flag.StringVar(&cfg.Postgres.VersionString, "pg-version-string", cfg.Postgres.VersionString, "The version string returned by version() in the PostgreSQL dialect.")
+	flag.BoolVar(&cfg.Postgres.PoolerMode, "pg-pooler-mode", cfg.Postgres.PoolerMode, "Do not rely on the session state in the internal queries, and report the changes of the session parameters, so that the PostgreSQL server works behind transaction-pooling proxies such as PgBouncer.")
+	flag.DurationVar(&cfg.Postgres.SlotCheckInterval, "pg-slot-check-interval", cfg.Postgres.SlotCheckInterval, "How often to check the WAL retained on the primaries by the replication slots of the subscriptions.")
+	flag.IntVar(&cfg.Postgres.SlotWALWarnSize, "pg-slot-wal-warn-size", cfg.Postgres.SlotWALWarnSize, "The size in MB of the WAL retained by a replication slot above which a warning is logged. Zero disables the warnings.")
+	flag.IntVar(&cfg.Postgres.MaxSlotWALKeepSize, "pg-max-slot-wal-keep-size", cfg.Postgres.MaxSlotWALKeepSize, "The size in MB of the WAL retained by a replication slot above which the slot is dropped and the subscription is resynced from a new snapshot. -1 disables the resyncs.")
+	flag.IntVar(&cfg.Postgres.MaxResultSize, "pg-max-result-size", cfg.Postgres.MaxResultSize, "The default limit in MB of the size of the result of a query, which can be changed by the session parameter myduck.max_result_size. Zero disables the limit.")
+	flag.IntVar(&cfg.Postgres.ResultBufferSize, "pg-result-buffer-size", cfg.Postgres.ResultBufferSize, "The size in MB of the rows of a result buffered in memory while the client is reading it.")
+	flag.BoolVar(&cfg.Postgres.ResultSpill, "pg-result-spill", cfg.Postgres.ResultSpill, "Spill the rows of a result beyond --pg-result-buffer-size to a temporary file instead of pausing the query until the client catches up.")
+	flag.DurationVar(&cfg.Postgres.CursorIdleTimeout, "pg-cursor-idle-timeout", cfg.Postgres.CursorIdleTimeout, "How long a cursor WITH HOLD is kept without being used before it is closed to release its materialized result. Zero keeps the cursors until the sessions end.")
+	flag.BoolVar(&cfg.Reader, "reader", cfg.Reader, "Open the database files in read-only mode to serve the reads beside a writer, and reopen them periodically to pick up a newer snapshot. DuckDB does not allow the files to be opened while a writer has them open, so the reader serves the snapshots of the files, e.g., on shared storage.")
+	flag.DurationVar(&cfg.ReaderRefreshInterval, "reader-refresh-interval", cfg.ReaderRefreshInterval, "How often a reader checks for a newer snapshot of the database files.")
+	flag.StringVar(&cfg.DefaultTimeZone, "default-time-zone", cfg.DefaultTimeZone, "The default time zone to use.")
+	flag.BoolVar(&cfg.VectorIndexes, "vector-indexes", cfg.VectorIndexes, "Load the vss extension of DuckDB for the HNSW indexes of the vectors. It is installed by --init --vector-indexes. The indexes are only persisted with --duckdb-setting hnsw_enable_experimental_persistence=true, which is experimental.")
+	flag.Func("duckdb-setting", "A global setting of DuckDB in the form of name=value, e.g., memory_limit=8GB. Can be repeated.", func(s string) error {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("expected name=value, got %q", s)
+		}
+		cfg.DuckDBSettings[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		return nil
+	})
 
 	flag.StringVar(&restoreFile, "restore-file", restoreFile, "The file to restore from.")
 	flag.StringVar(&restoreEndpoint, "restore-endpoint", restoreEndpoint, "The endpoint of object storage service to restore from.")
 	flag.StringVar(&restoreAccessKeyId, "restore-access-key-id", restoreAccessKeyId, "The access key ID to restore from.")
 	flag.StringVar(&restoreSecretAccessKey, "restore-secret-access-key", restoreSecretAccessKey, "The secret access key to restore from.")
+	flag.BoolVar(&cfg.RestoreResync, "restore-resync", cfg.RestoreResync, "Resync the restored subscriptions that cannot resume from their replication slots, and reset the restored binlog replica that cannot resume from its source, instead of disabling them.")
+	flag.StringVar(&bootstrapFrom, "bootstrap-from", bootstrapFrom, "The Postgres connection string of a running server to stream the data file from before starting, e.g., postgres://user@primary:5432/mydb.")
 
-	flag.StringVar(&flightsqlHost, "flightsql-host", flightsqlHost, "hostname for the Flight SQL service")
-	flag.IntVar(&flightsqlPort, "flightsql-port", flightsqlPort, "port number for the Flight SQL service")
+	flag.StringVar(&cfg.FlightSQLHost, "flightsql-host", cfg.FlightSQLHost, "hostname for the Flight SQL service")
+	flag.IntVar(&cfg.FlightSQLPort, "flightsql-port", cfg.FlightSQLPort, "port number for the Flight SQL service")
+
+	flag.IntVar(&healthPort, "health-port", healthPort, "The port to serve the HTTP liveness (/livez) and readiness (/readyz) probes on.")
+	flag.DurationVar(&healthMaxReplicationLag, "health-max-replication-lag", healthMaxReplicationLag, "The maximum replication lag for the server to be ready. Zero disables the check.")
+	flag.DurationVar(&healthMaxReplicationSilence, "health-max-replication-silence", healthMaxReplicationSilence, "The maximum time without hearing from a replication source for the server to be ready. Zero disables the check.")
 }
 
 func ensureSQLTranslate() {
@@ -110,117 +122,80 @@ func ensureSQLTranslate() {
 }
 
 func main() {
-	flag.Parse() // Parse all flags
-
-	if replicaOptions.ReportPort == 0 {
-		replicaOptions.ReportPort = port
+	// `myduckserver shell` connects to a running server instead of starting one.
+	if len(os.Args) > 1 && os.Args[1] == "shell" {
+		os.Exit(runShell(os.Args[2:]))
 	}
 
+	flag.Parse() // Parse all flags
+
 	logrus.SetLevel(logrus.Level(logLevel))
 
 	ensureSQLTranslate()
 
-	executeRestoreIfNeeded()
+	// Serve the probes before the restore, so that the server is live but not ready during the restore.
+	var healthServer *health.Server
+	if healthPort > 0 && !initMode {
+		healthServer = health.NewServer(health.Options{
+			Address:               net.JoinHostPort(cfg.Address, strconv.Itoa(healthPort)),
+			MaxReplicationLag:     healthMaxReplicationLag,
+			MaxReplicationSilence: healthMaxReplicationSilence,
+		})
+		if err := healthServer.Start(); err != nil {
+			logrus.WithError(err).Fatalln("Failed to start the health server")
+		}
+		defer healthServer.Close()
+	}
+
+	cfg.Restored = executeRestoreIfNeeded()
+	if executeBootstrapIfNeeded() {
+		cfg.Restored = true
+	}
 
 	if initMode {
 		provider := catalog.NewInMemoryDBProvider()
+		if cfg.VectorIndexes {
+			if _, err := provider.Storage().Exec("INSTALL vss"); err != nil {
+				logrus.WithError(err).Fatalln("Failed to install the vss extension")
+			}
+		}
 		provider.Close()
 		return
 	}
 
-	provider, err := catalog.NewDBProvider(defaultTimeZone, dataDirectory, defaultDb)
+	srv, err := server.Run(cfg)
 	if err != nil {
-		logrus.Fatalln("Failed to open the database:", err)
-	}
-	defer provider.Close()
-
-	// Clear the pipes directory on startup.
-	backend.RemoveAllPipes(dataDirectory)
-
-	engine := sqle.NewDefault(provider)
-
-	builder := backend.NewDuckBuilder(engine.Analyzer.ExecBuilder, provider)
-	engine.Analyzer.ExecBuilder = builder
-	engine.Analyzer.Catalog.RegisterFunction(sql.NewContext(context.Background()), myfunc.ExtraBuiltIns...)
-	engine.Analyzer.Catalog.MySQLDb.SetPlugins(plugin.AuthPlugins)
-
-	if err := setPersister(provider, engine, "root", superuserPassword); err != nil {
-		logrus.Fatalln("Failed to set the persister:", err)
+		logrus.WithError(err).Fatalln("Failed to start the server")
 	}
 
-	replica.RegisterReplicaOptions(&replicaOptions)
-	replica.RegisterReplicaController(provider, engine, builder)
-
-	serverConfig := server.Config{
-		Protocol: "tcp",
-		Address:  fmt.Sprintf("%s:%d", address, port),
-		Socket:   socket,
+	if healthServer != nil {
+		healthServer.SetPing(srv.Provider().Ping)
 	}
-	myServer, err := server.NewServerWithHandler(serverConfig, engine, backend.NewSessionBuilder(provider), nil, backend.WrapHandler(provider))
-	if err != nil {
-		logrus.WithError(err).Fatalln("Failed to create MySQL-protocol server")
-	}
-
-	if postgresPort > 0 {
-		pgServer, err := pgserver.NewServer(
-			provider,
-			address, postgresPort,
-			superuserPassword,
-			func() *sql.Context {
-				session := backend.NewSession(memory.NewSession(sql.NewBaseSession(), provider), provider)
-				return sql.NewContext(context.Background(), sql.WithSession(session))
-			},
-			pgserver.WithEngine(myServer.Engine),
-			pgserver.WithSessionManager(myServer.SessionManager()),
-			pgserver.WithConnID(&myServer.Listener.(*mysql.Listener).ConnectionID), // Shared connection ID counter
-		)
-		if err != nil {
-			logrus.WithError(err).Fatalln("Failed to create Postgres-protocol server")
-		}
 
-		// Check if there is a replication subscription and start replication if there is.
-		err = logrepl.UpdateSubscriptions(pgServer.NewInternalCtx())
-		if err != nil {
-			logrus.WithError(err).Warnln("Failed to update subscriptions")
+	// Shut down gracefully on SIGINT and SIGTERM, so that the databases are closed cleanly.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logrus.Infoln("Received", sig, "and shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logrus.WithError(err).Warnln("Failed to shut down gracefully")
 		}
+	}()
 
-		// Load the configuration for the Postgres server.
-		pgconfig.Init()
-		go pgServer.Start()
-	}
-
-	if flightsqlPort > 0 {
-
-		db := provider.Storage()
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer db.Close()
-
-		srv, err := flightsqlserver.NewSQLiteFlightSQLServer(db)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		server := flight.NewServerWithMiddleware(nil)
-		server.RegisterFlightService(flightsql.NewFlightServer(srv))
-		server.Init(net.JoinHostPort(*&flightsqlHost, strconv.Itoa(*&flightsqlPort)))
-		server.SetShutdownOnSignals(os.Interrupt, os.Kill)
-
-		fmt.Println("Starting SQLite Flight SQL Server on", server.Addr(), "...")
-
-		go server.Serve()
-	}
-
-	if err = myServer.Start(); err != nil {
-		logrus.WithError(err).Fatalln("Failed to start MySQL-protocol server")
+	if err := srv.Wait(); err != nil {
+		logrus.WithError(err).Fatalln("Failed to serve the MySQL protocol")
 	}
 }
 
-func executeRestoreIfNeeded() {
+// executeRestoreIfNeeded restores the data file from the object storage if the restore parameters are set,
+// and reports whether it has done so.
+func executeRestoreIfNeeded() bool {
 	// If none of the restore parameters are set, return early.
 	if restoreFile == "" && restoreEndpoint == "" && restoreAccessKeyId == "" && restoreSecretAccessKey == "" {
-		return
+		return false
 	}
 
 	// Map of required parameters to their names for validation.
@@ -238,10 +213,13 @@ func executeRestoreIfNeeded() {
 		}
 	}
 
+	health.SetRestoring(true)
+	defer health.SetRestoring(false)
+
 	msg, err := pgserver.ExecuteRestore(
-		defaultDb,
-		dataDirectory,
-		defaultDb+".db",
+		cfg.DefaultDB,
+		cfg.DataDir,
+		cfg.DefaultDB+".db",
 		restoreFile,
 		restoreEndpoint,
 		restoreAccessKeyId,
@@ -252,4 +230,65 @@ func executeRestoreIfNeeded() {
 	}
 
 	logrus.Infoln("Restore completed successfully:", msg)
+	return true
+}
+
+// executeBootstrapIfNeeded streams the data file from a running server if the bootstrap connection string is set,
+// and reports whether it has done so. See pgserver.FetchBackup.
+func executeBootstrapIfNeeded() bool {
+	if bootstrapFrom == "" {
+		return false
+	}
+	if restoreFile != "" {
+		logrus.Fatalln("The bootstrap connection string and the restore file are mutually exclusive.")
+	}
+
+	health.SetRestoring(true)
+	defer health.SetRestoring(false)
+
+	size, err := pgserver.FetchBackup(bootstrapFrom, cfg.DataDir, cfg.DefaultDB+".db")
+	if err != nil {
+		logrus.WithError(err).Fatalln("Failed to bootstrap from the running server")
+	}
+
+	logrus.Infof("Bootstrap completed successfully: streamed %d bytes", size)
+	return true
+}
+
+// runShell runs the SQL shell on a running server, and returns the exit code.
+func runShell(args []string) int {
+	opts := shell.Options{
+		Host:     "127.0.0.1",
+		Port:     cfg.Port,
+		User:     "root",
+		Password: os.Getenv("MYSQL_PWD"),
+	}
+	var execute string
+	fs := flag.NewFlagSet("shell", flag.ExitOnError)
+	fs.StringVar(&opts.Socket, "socket", opts.Socket, "The Unix domain socket of the server. The host and the port are used if it is empty.")
+	fs.StringVar(&opts.Host, "host", opts.Host, "The host of the server.")
+	fs.IntVar(&opts.Port, "port", opts.Port, "The MySQL-protocol port of the server.")
+	fs.StringVar(&opts.User, "user", opts.User, "The user to connect as.")
+	fs.StringVar(&opts.Password, "password", opts.Password, "The password of the user. Defaults to $MYSQL_PWD.")
+	fs.StringVar(&opts.Database, "database", opts.Database, "The database to use.")
+	fs.StringVar(&execute, "e", execute, "Execute the statements and meta-commands, and exit.")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	sh, err := shell.Open(ctx, opts, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to the server:", err)
+		return 1
+	}
+	defer sh.Close()
+
+	if execute != "" {
+		err = sh.Run(ctx, strings.NewReader(execute), false)
+	} else {
+		err = sh.Run(ctx, os.Stdin, shell.IsTerminal(os.Stdin))
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
 }
@@ -1365,6 +1365,35 @@ func TestRenameColumn(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "rename indexed column",
+			SetUpScript: []string{
+				"CREATE TABLE mytable2 (i bigint primary key, s varchar(20) not null unique, n int comment 'column n', index idx_n (n) comment 'index n')",
+				"INSERT INTO mytable2 VALUES (1, 'first row', 10), (2, 'second row', 20)",
+			},
+			Assertions: []queries.ScriptTestAssertion{
+				{
+					Query:    "ALTER TABLE mytable2 RENAME COLUMN n TO n2, RENAME COLUMN s TO s2",
+					Expected: []sql.Row{{types.NewOkResult(0)}},
+				},
+				{
+					Query: "SHOW FULL COLUMNS FROM mytable2",
+					Expected: []sql.Row{
+						{"i", "bigint", nil, "NO", "PRI", nil, "", "", ""},
+						{"s2", "varchar(20)", "utf8mb4_0900_bin", "NO", "UNI", nil, "", "", ""},
+						{"n2", "int", nil, "YES", "MUL", nil, "", "", "column n"},
+					},
+				},
+				{
+					Query:    "select i from mytable2 where n2 = 20",
+					Expected: []sql.Row{{2}},
+				},
+				{
+					Query:       "insert into mytable2 values (3, 'first row', 30)",
+					ExpectedErr: sql.ErrUniqueKeyViolation,
+				},
+			},
+		},
 	}
 	enginetest.TestRenameColumn(t, NewDefaultDuckHarness())
 }
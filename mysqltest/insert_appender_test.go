@@ -0,0 +1,117 @@
+package mysqltest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertAppender(t *testing.T) {
+	db, close, err := CreateTestServer(t, testutil.FindFreePort(), "bulk")
+	require.NoError(t, err)
+	defer close()
+
+	// The threshold is per session.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for _, stmt := range []string{
+		"SET myduck_insert_appender_threshold = 10",
+		"CREATE TABLE t (id INT PRIMARY KEY, name VARCHAR(20) NOT NULL, score DOUBLE, flag TINYINT, created DATETIME DEFAULT '2024-01-01 00:00:00')",
+	} {
+		_, err := conn.ExecContext(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	values := func(from, to int, format string) string {
+		tuples := make([]string, 0, to-from)
+		for i := from; i < to; i++ {
+			tuples = append(tuples, fmt.Sprintf(format, i))
+		}
+		return strings.Join(tuples, ",")
+	}
+	count := func() (n int) {
+		require.NoError(t, conn.QueryRowContext(ctx, "SELECT count(*) FROM t").Scan(&n))
+		return
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		affected int64
+		total    int
+		err      string
+	}{
+		{
+			name:     "all columns",
+			query:    "INSERT INTO t VALUES " + values(0, 100, "(%[1]d, 'name%[1]d', %[1]d.5, 1, '2024-10-01 12:00:00')"),
+			affected: 100,
+			total:    100,
+		},
+		{
+			name:     "omitted column with a default",
+			query:    "INSERT INTO t (id, name, score, flag) VALUES " + values(100, 150, "(%[1]d, 'name%[1]d', %[1]d, NULL)"),
+			affected: 50,
+			total:    150,
+		},
+		{
+			name:     "below the threshold",
+			query:    "INSERT INTO t (name, id) VALUES ('a', 150), ('b', 151)",
+			affected: 2,
+			total:    152,
+		},
+		{
+			name:  "duplicate key",
+			query: "INSERT INTO t (id, name) VALUES " + values(140, 160, "(%[1]d, 'name%[1]d')"),
+			err:   "uplicate",
+			total: 152,
+		},
+		{
+			name:  "null in a NOT NULL column",
+			query: "INSERT INTO t (id, name) VALUES " + values(200, 220, "(%d, NULL)"),
+			err:   "name",
+			total: 152,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := conn.ExecContext(ctx, tt.query)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+				affected, err := result.RowsAffected()
+				require.NoError(t, err)
+				require.Equal(t, tt.affected, affected)
+				insertID, err := result.LastInsertId()
+				require.NoError(t, err)
+				require.Zero(t, insertID)
+			}
+			require.Equal(t, tt.total, count())
+		})
+	}
+
+	var (
+		name    string
+		score   float64
+		flag    *int
+		created string
+	)
+	require.NoError(t, conn.QueryRowContext(ctx, "SELECT name, score, flag, created FROM t WHERE id = 42").Scan(&name, &score, &flag, &created))
+	require.Equal(t, "name42", name)
+	require.Equal(t, 42.5, score)
+	require.NotNil(t, flag)
+	require.Equal(t, 1, *flag)
+	require.Equal(t, "2024-10-01 12:00:00", created)
+
+	require.NoError(t, conn.QueryRowContext(ctx, "SELECT name, flag, created FROM t WHERE id = 120").Scan(&name, &flag, &created))
+	require.Equal(t, "name120", name)
+	require.Nil(t, flag)
+	require.Equal(t, "2024-01-01 00:00:00", created)
+}
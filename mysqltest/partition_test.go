@@ -0,0 +1,93 @@
+package mysqltest
+
+import (
+	"context"
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionedTables(t *testing.T) {
+	db, close, err := CreateTestServer(t, testutil.FindFreePort(), "parts")
+	require.NoError(t, err)
+	defer close()
+
+	// The warnings are per session.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE t1 (id INT PRIMARY KEY, v VARCHAR(10)) PARTITION BY RANGE (id) (PARTITION p0 VALUES LESS THAN (10), PARTITION p1 VALUES LESS THAN MAXVALUE)")
+	require.NoError(t, err)
+	var level, message string
+	var code int
+	require.NoError(t, conn.QueryRowContext(ctx, "SHOW WARNINGS").Scan(&level, &code, &message))
+	require.Equal(t, 1235, code)
+	require.Contains(t, message, "t1")
+
+	for _, stmt := range []string{
+		"CREATE TABLE t2 (id INT, c INT) PARTITION BY LIST (c) (PARTITION pa VALUES IN (1,2), PARTITION pb VALUES IN (3))",
+		"CREATE TABLE t3 (id INT PRIMARY KEY) /*!50100 PARTITION BY KEY () PARTITIONS 2 */",
+		"CREATE TABLE t4 (id INT PRIMARY KEY)",
+		"CREATE TABLE t5 (id INT PRIMARY KEY) PARTITION BY HASH (id) PARTITIONS 3",
+		"INSERT INTO t1 VALUES (1, 'a'), (20, 'b')",
+	} {
+		_, err := conn.ExecContext(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	// The tables are created unpartitioned.
+	var count int
+	require.NoError(t, conn.QueryRowContext(ctx, "SELECT count(*) FROM t1").Scan(&count))
+	require.Equal(t, 2, count)
+
+	rows, err := conn.QueryContext(ctx,
+		"SELECT TABLE_NAME, PARTITION_NAME, PARTITION_ORDINAL_POSITION, PARTITION_METHOD, PARTITION_EXPRESSION, PARTITION_DESCRIPTION"+
+			" FROM information_schema.PARTITIONS WHERE TABLE_SCHEMA = 'parts' ORDER BY TABLE_NAME, PARTITION_ORDINAL_POSITION")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	type partition struct {
+		table       string
+		name        stdsql.NullString
+		ordinal     stdsql.NullInt64
+		method      stdsql.NullString
+		expression  stdsql.NullString
+		description stdsql.NullString
+	}
+	var got []partition
+	for rows.Next() {
+		var p partition
+		require.NoError(t, rows.Scan(&p.table, &p.name, &p.ordinal, &p.method, &p.expression, &p.description))
+		got = append(got, p)
+	}
+	require.NoError(t, rows.Err())
+
+	str := func(s string) stdsql.NullString { return stdsql.NullString{String: s, Valid: true} }
+	num := func(i int64) stdsql.NullInt64 { return stdsql.NullInt64{Int64: i, Valid: true} }
+	require.Equal(t, []partition{
+		{"t1", str("p0"), num(1), str("RANGE"), str("id"), str("10")},
+		{"t1", str("p1"), num(2), str("RANGE"), str("id"), str("MAXVALUE")},
+		{"t2", str("pa"), num(1), str("LIST"), str("c"), str("1,2")},
+		{"t2", str("pb"), num(2), str("LIST"), str("c"), str("3")},
+		{"t3", str("p0"), num(1), str("KEY"), str(""), stdsql.NullString{}},
+		{"t3", str("p1"), num(2), str("KEY"), str(""), stdsql.NullString{}},
+		{table: "t4"},
+		{"t5", str("p0"), num(1), str("HASH"), str("id"), stdsql.NullString{}},
+		{"t5", str("p1"), num(2), str("HASH"), str("id"), stdsql.NullString{}},
+		{"t5", str("p2"), num(3), str("HASH"), str("id"), stdsql.NullString{}},
+	}, got)
+
+	// The partitioning is dropped along with the table, and is kept when the table is renamed.
+	for _, stmt := range []string{"DROP TABLE t2", "RENAME TABLE t5 TO t6"} {
+		_, err := conn.ExecContext(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+	require.NoError(t, conn.QueryRowContext(ctx, "SELECT count(*) FROM information_schema.PARTITIONS WHERE TABLE_SCHEMA = 'parts' AND TABLE_NAME = 't2'").Scan(&count))
+	require.Zero(t, count)
+	require.NoError(t, conn.QueryRowContext(ctx, "SELECT count(*) FROM information_schema.PARTITIONS WHERE TABLE_SCHEMA = 'parts' AND TABLE_NAME = 't6'").Scan(&count))
+	require.Equal(t, 3, count)
+}
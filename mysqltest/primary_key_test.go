@@ -0,0 +1,60 @@
+package mysqltest
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlterPrimaryKey(t *testing.T) {
+	db, close, err := CreateTestServer(t, testutil.FindFreePort(), "pk")
+	require.NoError(t, err)
+	defer close()
+
+	for _, stmt := range []string{
+		"CREATE TABLE t (id INT NOT NULL, k INT NOT NULL, v VARCHAR(10) DEFAULT 'x' COMMENT 'value', INDEX idx_v (v)) COMMENT 'keyed'",
+		"INSERT INTO t (id, k) VALUES (1, 1), (2, 1)",
+	} {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	showCreateTable := func() string {
+		var name, ddl string
+		require.NoError(t, db.QueryRow("SHOW CREATE TABLE t").Scan(&name, &ddl))
+		return ddl
+	}
+	require.NotContains(t, showCreateTable(), "PRIMARY KEY")
+
+	// The data violates the new primary key.
+	_, err = db.Exec("ALTER TABLE t ADD PRIMARY KEY (k)")
+	require.Error(t, err)
+	require.NotContains(t, showCreateTable(), "PRIMARY KEY")
+
+	_, err = db.Exec("ALTER TABLE t ADD PRIMARY KEY (id, k)")
+	require.NoError(t, err)
+	ddl := showCreateTable()
+	require.Contains(t, ddl, "PRIMARY KEY (`id`,`k`)")
+	require.Contains(t, ddl, "KEY `idx_v` (`v`)")
+	require.Contains(t, ddl, "COMMENT 'value'")
+	require.Contains(t, ddl, "COMMENT='keyed'")
+
+	// The rows are kept, and the primary key is enforced.
+	var count int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM t WHERE v = 'x'").Scan(&count))
+	require.Equal(t, 2, count)
+	_, err = db.Exec("INSERT INTO t (id, k) VALUES (1, 1)")
+	require.Error(t, err)
+
+	_, err = db.Exec("ALTER TABLE t ADD PRIMARY KEY (v)")
+	require.ErrorContains(t, err, "Multiple primary keys defined")
+
+	_, err = db.Exec("ALTER TABLE t DROP PRIMARY KEY")
+	require.NoError(t, err)
+	require.NotContains(t, showCreateTable(), "PRIMARY KEY")
+	_, err = db.Exec("INSERT INTO t (id, k) VALUES (1, 1)")
+	require.NoError(t, err)
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM t").Scan(&count))
+	require.Equal(t, 3, count)
+}
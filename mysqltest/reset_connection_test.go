@@ -0,0 +1,219 @@
+package mysqltest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetConnection(t *testing.T) {
+	port := testutil.FindFreePort()
+	db, closeServer, err := CreateTestServer(t, port, "reset_conn")
+	require.NoError(t, err)
+	defer closeServer()
+
+	_, err = db.Exec("CREATE TABLE reset_t (id INT PRIMARY KEY)")
+	require.NoError(t, err)
+
+	// The Go MySQL driver does not send COM_RESET_CONNECTION, so the test speaks the protocol itself.
+	c, err := dialRawConn(fmt.Sprintf("127.0.0.1:%d", port), "reset_conn")
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.exec("BEGIN"))
+	require.NoError(t, c.exec("INSERT INTO reset_t VALUES (1)"))
+
+	require.NoError(t, c.resetConnection())
+
+	// The transaction is rolled back, while the current database is preserved.
+	var n int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM reset_t").Scan(&n))
+	require.Zero(t, n)
+	require.NoError(t, c.exec("INSERT INTO reset_t VALUES (2)"))
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM reset_t").Scan(&n))
+	require.Equal(t, 1, n)
+}
+
+func TestChangeUser(t *testing.T) {
+	port := testutil.FindFreePort()
+	db, closeServer, err := CreateTestServer(t, port, "change_user")
+	require.NoError(t, err)
+	defer closeServer()
+
+	_, err = db.Exec("CREATE TABLE change_t (id INT PRIMARY KEY)")
+	require.NoError(t, err)
+
+	// The Go MySQL driver does not send COM_CHANGE_USER, so the test speaks the protocol itself.
+	c, err := dialRawConn(fmt.Sprintf("127.0.0.1:%d", port), "change_user")
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.exec("SET @v = 42"))
+	require.NoError(t, c.exec("BEGIN"))
+	require.NoError(t, c.exec("INSERT INTO change_t VALUES (1)"))
+
+	require.NoError(t, c.changeUser("root", "change_user"))
+
+	// Neither the transaction nor the user variables survive the change of the user.
+	var n int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM change_t").Scan(&n))
+	require.Zero(t, n)
+	require.NoError(t, c.exec("INSERT INTO change_t VALUES (COALESCE(@v, 0))"))
+	var id int
+	require.NoError(t, db.QueryRow("SELECT id FROM change_t").Scan(&id))
+	require.Zero(t, id)
+}
+
+// rawConn is a minimal MySQL protocol client for the commands that the Go MySQL driver does not send.
+type rawConn struct {
+	net.Conn
+	seq byte
+}
+
+func dialRawConn(addr, database string) (*rawConn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &rawConn{Conn: conn}
+	if _, err := c.readPacket(); err != nil { // the initial handshake
+		c.Close()
+		return nil, err
+	}
+	const (
+		clientLongPassword      = 0x1
+		clientConnectWithDB     = 0x8
+		clientProtocol41        = 0x200
+		clientSecureConnection  = 0x8000
+		clientPluginAuth        = 0x80000
+		charsetUTF8MB4GeneralCI = 45
+	)
+	response := binary.LittleEndian.AppendUint32(nil, clientLongPassword|clientConnectWithDB|clientProtocol41|clientSecureConnection|clientPluginAuth)
+	response = binary.LittleEndian.AppendUint32(response, 1<<24-1)
+	response = append(response, charsetUTF8MB4GeneralCI)
+	response = append(response, make([]byte, 23)...)
+	response = append(response, "root\x00"...)
+	response = append(response, 0) // empty password
+	response = append(response, database+"\x00"...)
+	response = append(response, "mysql_native_password\x00"...)
+	if err := c.writePacket(response); err != nil {
+		c.Close()
+		return nil, err
+	}
+	for {
+		packet, err := c.readPacket()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		switch packet[0] {
+		case 0x00:
+			return c, nil
+		case 0xfe: // auth switch request
+			if err := c.writePacket(nil); err != nil {
+				c.Close()
+				return nil, err
+			}
+		default:
+			c.Close()
+			return nil, packetError(packet)
+		}
+	}
+}
+
+func (c *rawConn) readPacket() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c, header[:]); err != nil {
+		return nil, err
+	}
+	c.seq = header[3] + 1
+	packet := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	_, err := io.ReadFull(c, packet)
+	return packet, err
+}
+
+func (c *rawConn) writePacket(payload []byte) error {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), c.seq}
+	_, err := c.Write(append(header, payload...))
+	return err
+}
+
+// command sends a command and reads the response, skipping the result set, if any.
+func (c *rawConn) command(payload []byte) error {
+	c.seq = 0
+	if err := c.writePacket(payload); err != nil {
+		return err
+	}
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	switch packet[0] {
+	case 0x00:
+		return nil
+	case 0xff:
+		return packetError(packet)
+	}
+	// The column definitions and the rows, each followed by an EOF packet.
+	for eofs := 0; eofs < 2; {
+		if packet, err = c.readPacket(); err != nil {
+			return err
+		}
+		switch {
+		case packet[0] == 0xfe && len(packet) < 9:
+			eofs++
+		case packet[0] == 0xff:
+			return packetError(packet)
+		}
+	}
+	return nil
+}
+
+func (c *rawConn) exec(query string) error {
+	return c.command(append([]byte{0x03}, query...)) // COM_QUERY
+}
+
+func (c *rawConn) resetConnection() error {
+	return c.command([]byte{0x1f}) // COM_RESET_CONNECTION
+}
+
+// changeUser sends COM_CHANGE_USER for a user with an empty password, and answers the auth switch request.
+func (c *rawConn) changeUser(user, database string) error {
+	c.seq = 0
+	payload := append([]byte{0x11}, user+"\x00"...)
+	payload = append(payload, 0) // empty password
+	payload = append(payload, database+"\x00"...)
+	if err := c.writePacket(payload); err != nil {
+		return err
+	}
+	for {
+		packet, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		switch packet[0] {
+		case 0x00:
+			return nil
+		case 0xfe: // auth switch request
+			if err := c.writePacket(nil); err != nil {
+				return err
+			}
+		default:
+			return packetError(packet)
+		}
+	}
+}
+
+func packetError(packet []byte) error {
+	if packet[0] == 0xff && len(packet) > 9 {
+		// error code (2 bytes), SQL state marker and SQL state (6 bytes), message
+		return errors.New(string(packet[9:]))
+	}
+	return fmt.Errorf("unexpected packet: %v", packet)
+}
@@ -0,0 +1,64 @@
+package mysqltest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkloadClasses(t *testing.T) {
+	db, closeServer, err := CreateTestServer(t, testutil.FindFreePort(), "sched")
+	require.NoError(t, err)
+	defer closeServer()
+
+	ctx := context.Background()
+	_, err = db.ExecContext(ctx, "SET GLOBAL myduck_max_background_queries = 1")
+	require.NoError(t, err)
+	defer db.ExecContext(ctx, "SET GLOBAL myduck_max_background_queries = DEFAULT")
+
+	var class string
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT @@myduck_workload_class").Scan(&class))
+	require.Equal(t, backend.WorkloadInteractive, class)
+
+	background := func() func(string) time.Duration {
+		conn, err := db.Conn(ctx)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		_, err = conn.ExecContext(ctx, "SET myduck_workload_class = 'background'")
+		require.NoError(t, err)
+		return func(query string) time.Duration {
+			start := time.Now()
+			_, err := conn.ExecContext(ctx, query)
+			require.NoError(t, err)
+			return time.Since(start)
+		}
+	}
+	long, short := background(), background()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		long("SELECT sleep(1)")
+	}()
+	require.Eventually(t, func() bool {
+		running, _ := backend.DefaultScheduler.Status(backend.WorkloadBackground)
+		return running == 1
+	}, 5*time.Second, time.Millisecond)
+
+	// An interactive query does not wait for the background query.
+	start := time.Now()
+	_, err = db.ExecContext(ctx, "SELECT 1")
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// A background query waits until the running one finishes.
+	require.Greater(t, short("SELECT 1"), 200*time.Millisecond)
+	<-done
+
+	_, err = db.ExecContext(ctx, "SET myduck_workload_class = 'batch'")
+	require.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package mysqltest
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apecloud/myduckserver/server"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// CreateTestServer starts a MySQL-protocol server backed by an in-memory DuckDB database,
+// and returns a connection pool to the given database, which is created if it does not exist.
+func CreateTestServer(t *testing.T, port int, database string) (db *stdsql.DB, close func() error, err error) {
+	srv, err := server.Run(server.DefaultConfig(),
+		server.WithAddress("127.0.0.1"),
+		server.WithPorts(port, 0),
+		server.WithDataDir(t.TempDir()),
+		server.WithDefaultDB("memory"),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	close = func() error {
+		return srv.Shutdown(context.Background())
+	}
+
+	root, err := connect(fmt.Sprintf("root@tcp(127.0.0.1:%d)/", port))
+	if err != nil {
+		close()
+		return nil, nil, err
+	}
+	defer root.Close()
+	if _, err = root.Exec("CREATE DATABASE IF NOT EXISTS " + database); err != nil {
+		close()
+		return nil, nil, err
+	}
+
+	// The parameters are interpolated on the client side, like `sysbench --db-ps-mode=disable`,
+	// since the server does not execute prepared statements with parameters in DuckDB yet.
+	db, err = connect(fmt.Sprintf("root@tcp(127.0.0.1:%d)/%s?interpolateParams=true", port, database))
+	if err != nil {
+		close()
+		return nil, nil, err
+	}
+	closeServer := close
+	close = func() error {
+		return errors.Join(db.Close(), closeServer())
+	}
+	return db, close, nil
+}
+
+// connect opens a connection pool and waits for the server to accept connections.
+func connect(dsn string) (*stdsql.DB, error) {
+	db, err := stdsql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	for range 50 {
+		if err = db.Ping(); err == nil {
+			return db, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	db.Close()
+	return nil, err
+}
@@ -0,0 +1,364 @@
+package mysqltest
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SysbenchOptions configures a sysbench-style OLTP read/write workload.
+// The number of statements of each kind per transaction defaults to that of `sysbench oltp_read_write`.
+type SysbenchOptions struct {
+	Tables    int
+	TableSize int
+	// CreateSecondary creates the secondary index on the k column, like `sysbench --create_secondary`.
+	CreateSecondary bool
+	// Threads is the number of concurrent connections.
+	Threads int
+	// Transactions is the number of transactions that each thread runs.
+	Transactions int
+	// MaxRetries is the number of times a transaction is retried after a write-write conflict.
+	MaxRetries int
+
+	PointSelects    int
+	SimpleRanges    int
+	SumRanges       int
+	OrderRanges     int
+	DistinctRanges  int
+	IndexUpdates    int
+	NonIndexUpdates int
+	DeleteInserts   int
+	RangeSize       int
+}
+
+// DefaultSysbenchOptions returns the options of `sysbench oltp_read_write` scaled down for a smoke test.
+// The secondary index is not created, since DuckDB rejects updating an indexed column
+// of a table with a primary key inside an explicit transaction.
+func DefaultSysbenchOptions() SysbenchOptions {
+	return SysbenchOptions{
+		Tables:          1,
+		TableSize:       1000,
+		Threads:         4,
+		Transactions:    20,
+		MaxRetries:      100,
+		PointSelects:    10,
+		SimpleRanges:    1,
+		SumRanges:       1,
+		OrderRanges:     1,
+		DistinctRanges:  1,
+		IndexUpdates:    1,
+		NonIndexUpdates: 1,
+		DeleteInserts:   1,
+		RangeSize:       100,
+	}
+}
+
+// BenchResult summarizes a benchmark run.
+type BenchResult struct {
+	Transactions int
+	Queries      int
+	Retries      int
+	Duration     time.Duration
+}
+
+// TPS returns the number of committed transactions per second.
+func (r *BenchResult) TPS() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Transactions) / r.Duration.Seconds()
+}
+
+func (r *BenchResult) String() string {
+	return fmt.Sprintf("transactions: %d, queries: %d, retries: %d, duration: %v, tps: %.2f",
+		r.Transactions, r.Queries, r.Retries, r.Duration, r.TPS())
+}
+
+// PrepareSysbench creates and populates the sbtest tables, like `sysbench oltp_read_write prepare`.
+func PrepareSysbench(ctx context.Context, db *stdsql.DB, opts SysbenchOptions) error {
+	const batchSize = 1000
+	rng := rand.New(rand.NewPCG(0, 0))
+	for i := 1; i <= opts.Tables; i++ {
+		table := fmt.Sprintf("sbtest%d", i)
+		stmts := []string{
+			"DROP TABLE IF EXISTS " + table,
+			"CREATE TABLE " + table + " (" +
+				"id INTEGER NOT NULL AUTO_INCREMENT, " +
+				"k INTEGER DEFAULT '0' NOT NULL, " +
+				"c CHAR(120) DEFAULT '' NOT NULL, " +
+				"pad CHAR(60) DEFAULT '' NOT NULL, " +
+				"PRIMARY KEY (id))",
+		}
+		for _, stmt := range stmts {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("%s: %w", stmt, err)
+			}
+		}
+
+		var b strings.Builder
+		for start := 1; start <= opts.TableSize; start += batchSize {
+			b.Reset()
+			b.WriteString("INSERT INTO " + table + " (id, k, c, pad) VALUES ")
+			for id := start; id < start+batchSize && id <= opts.TableSize; id++ {
+				if id > start {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(&b, "(%d, %d, '%s', '%s')", id, rng.IntN(opts.TableSize)+1, sysbenchString(rng, 10), sysbenchString(rng, 5))
+			}
+			if _, err := db.ExecContext(ctx, b.String()); err != nil {
+				return err
+			}
+		}
+
+		if opts.CreateSecondary {
+			stmt := fmt.Sprintf("CREATE INDEX k_%d ON %s (k)", i, table)
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("%s: %w", stmt, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sysbenchString returns groups of 11 random digits separated by dashes, like the c and pad columns of sysbench.
+func sysbenchString(rng *rand.Rand, groups int) string {
+	var b strings.Builder
+	for i := range groups {
+		if i > 0 {
+			b.WriteByte('-')
+		}
+		for range 11 {
+			b.WriteByte(byte('0' + rng.IntN(10)))
+		}
+	}
+	return b.String()
+}
+
+// RunSysbench runs the OLTP read/write transactions with concurrent threads.
+// The results of the queries are checked against the invariants of the workload,
+// e.g., a point select returns exactly one row. Any error other than a write-write conflict aborts the run.
+func RunSysbench(ctx context.Context, db *stdsql.DB, opts SysbenchOptions) (*BenchResult, error) {
+	opts.RangeSize = max(min(opts.RangeSize, opts.TableSize), 1)
+	db.SetMaxOpenConns(max(opts.Threads, 1))
+
+	var (
+		mu     sync.Mutex
+		result BenchResult
+		wg     sync.WaitGroup
+		errs   = make([]error, max(opts.Threads, 1))
+	)
+	start := time.Now()
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer conn.Close()
+
+			w := &sysbenchWorker{ctx: ctx, conn: conn, opts: opts, rng: rand.New(rand.NewPCG(uint64(i), uint64(time.Now().UnixNano())))}
+			for range opts.Transactions {
+				if err := w.run(); err != nil {
+					errs[i] = err
+					break
+				}
+			}
+			mu.Lock()
+			result.Transactions += w.transactions
+			result.Queries += w.queries
+			result.Retries += w.retries
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	result.Duration = time.Since(start)
+	return &result, errors.Join(errs...)
+}
+
+type sysbenchWorker struct {
+	ctx  context.Context
+	conn *stdsql.Conn
+	opts SysbenchOptions
+	rng  *rand.Rand
+
+	transactions int
+	queries      int
+	retries      int
+}
+
+func (w *sysbenchWorker) run() error {
+	table := fmt.Sprintf("sbtest%d", w.rng.IntN(w.opts.Tables)+1)
+	for attempt := 0; ; attempt++ {
+		queries, err := w.transaction(table)
+		if err == nil {
+			w.transactions++
+			w.queries += queries
+			return nil
+		}
+		if !IsConflict(err) || attempt >= w.opts.MaxRetries {
+			return err
+		}
+		w.retries++
+		time.Sleep(time.Duration(w.rng.IntN(1000)) * time.Microsecond)
+	}
+}
+
+func (w *sysbenchWorker) id() int {
+	return w.rng.IntN(w.opts.TableSize) + 1
+}
+
+func (w *sysbenchWorker) rangeStart() int {
+	return w.rng.IntN(w.opts.TableSize-w.opts.RangeSize+1) + 1
+}
+
+func (w *sysbenchWorker) transaction(table string) (queries int, err error) {
+	tx, err := w.conn.BeginTx(w.ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// count runs a query and returns the number of rows in the result.
+	count := func(query string, args ...any) (int, error) {
+		queries++
+		rows, err := tx.QueryContext(w.ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		return n, rows.Err()
+	}
+	// exec runs a statement and returns the number of affected rows.
+	exec := func(query string, args ...any) (int64, error) {
+		queries++
+		result, err := tx.ExecContext(w.ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	}
+	expect := func(kind string, got, want int64) error {
+		if got != want {
+			return fmt.Errorf("%s on %s: expected %d rows, got %d", kind, table, want, got)
+		}
+		return nil
+	}
+	size := int64(w.opts.RangeSize)
+
+	for range w.opts.PointSelects {
+		n, err := count("SELECT c FROM "+table+" WHERE id = ?", w.id())
+		if err != nil {
+			return queries, err
+		}
+		if err := expect("point select", int64(n), 1); err != nil {
+			return queries, err
+		}
+	}
+	for range w.opts.SimpleRanges {
+		start := w.rangeStart()
+		n, err := count("SELECT c FROM "+table+" WHERE id BETWEEN ? AND ?", start, start+w.opts.RangeSize-1)
+		if err != nil {
+			return queries, err
+		}
+		if err := expect("simple range", int64(n), size); err != nil {
+			return queries, err
+		}
+	}
+	for range w.opts.SumRanges {
+		start := w.rangeStart()
+		queries++
+		var sum stdsql.NullInt64
+		if err := tx.QueryRowContext(w.ctx, "SELECT SUM(k) FROM "+table+" WHERE id BETWEEN ? AND ?", start, start+w.opts.RangeSize-1).Scan(&sum); err != nil {
+			return queries, err
+		}
+		if !sum.Valid {
+			return queries, fmt.Errorf("sum range on %s: unexpected NULL", table)
+		}
+	}
+	for range w.opts.OrderRanges {
+		start := w.rangeStart()
+		n, err := count("SELECT c FROM "+table+" WHERE id BETWEEN ? AND ? ORDER BY c", start, start+w.opts.RangeSize-1)
+		if err != nil {
+			return queries, err
+		}
+		if err := expect("order range", int64(n), size); err != nil {
+			return queries, err
+		}
+	}
+	for range w.opts.DistinctRanges {
+		start := w.rangeStart()
+		n, err := count("SELECT DISTINCT c FROM "+table+" WHERE id BETWEEN ? AND ? ORDER BY c", start, start+w.opts.RangeSize-1)
+		if err != nil {
+			return queries, err
+		}
+		if n < 1 || n > w.opts.RangeSize {
+			return queries, fmt.Errorf("distinct range on %s: expected 1 to %d rows, got %d", table, w.opts.RangeSize, n)
+		}
+	}
+	for range w.opts.IndexUpdates {
+		n, err := exec("UPDATE "+table+" SET k = k + 1 WHERE id = ?", w.id())
+		if err != nil {
+			return queries, err
+		}
+		if err := expect("index update", n, 1); err != nil {
+			return queries, err
+		}
+	}
+	for range w.opts.NonIndexUpdates {
+		if _, err := exec("UPDATE "+table+" SET c = ? WHERE id = ?", sysbenchString(w.rng, 10), w.id()); err != nil {
+			return queries, err
+		}
+	}
+	for range w.opts.DeleteInserts {
+		// sysbench deletes a row and inserts it back. DuckDB rejects re-inserting a key
+		// that has been deleted in the same transaction, so the pair is issued as a REPLACE,
+		// which MySQL defines as a DELETE followed by an INSERT.
+		n, err := exec("REPLACE INTO "+table+" (id, k, c, pad) VALUES (?, ?, ?, ?)", w.id(), w.id(), sysbenchString(w.rng, 10), sysbenchString(w.rng, 5))
+		if err != nil {
+			return queries, err
+		}
+		if n < 1 {
+			return queries, fmt.Errorf("replace on %s: no rows affected", table)
+		}
+	}
+
+	return queries, tx.Commit()
+}
+
+// VerifySysbench checks that the sbtest tables still hold the rows with the ids from 1 to TableSize.
+func VerifySysbench(ctx context.Context, db *stdsql.DB, opts SysbenchOptions) error {
+	for i := 1; i <= opts.Tables; i++ {
+		table := fmt.Sprintf("sbtest%d", i)
+		var count, minID, maxID int64
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*), MIN(id), MAX(id) FROM "+table).Scan(&count, &minID, &maxID); err != nil {
+			return err
+		}
+		if count != int64(opts.TableSize) || minID != 1 || maxID != int64(opts.TableSize) {
+			return fmt.Errorf("%s has %d rows with ids from %d to %d, expected %d rows", table, count, minID, maxID, opts.TableSize)
+		}
+	}
+	return nil
+}
+
+// IsConflict reports whether the error is caused by a write-write conflict with a concurrent transaction,
+// in which case the transaction can be retried.
+func IsConflict(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "conflict") || strings.Contains(msg, "deadlock")
+}
@@ -0,0 +1,27 @@
+package mysqltest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSysbench(t *testing.T) {
+	db, close, err := CreateTestServer(t, testutil.FindFreePort(), "sbtest")
+	require.NoError(t, err)
+	defer close()
+
+	ctx := context.Background()
+	opts := DefaultSysbenchOptions()
+	opts.Tables = 2
+	require.NoError(t, PrepareSysbench(ctx, db, opts))
+
+	result, err := RunSysbench(ctx, db, opts)
+	require.NoError(t, err)
+	t.Log(result)
+	require.Equal(t, opts.Threads*opts.Transactions, result.Transactions)
+
+	require.NoError(t, VerifySysbench(ctx, db, opts))
+}
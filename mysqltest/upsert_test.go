@@ -0,0 +1,55 @@
+package mysqltest
+
+import (
+	stdsql "database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsert(t *testing.T) {
+	port := testutil.FindFreePort()
+	db, closeServer, err := CreateTestServer(t, port, "upsert")
+	require.NoError(t, err)
+	defer closeServer()
+
+	_, err = db.Exec("CREATE TABLE upsert_t (id INT PRIMARY KEY, u INT UNIQUE, v VARCHAR(10) DEFAULT 'default', n INT DEFAULT 0)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO upsert_t VALUES (1, 10, 'a', 0), (2, 20, 'b', 0)")
+	require.NoError(t, err)
+
+	affected := func(db *stdsql.DB, query string) int64 {
+		res, err := db.Exec(query)
+		require.NoError(t, err, query)
+		n, err := res.RowsAffected()
+		require.NoError(t, err)
+		return n
+	}
+	row := func(id int) string {
+		var u, n int
+		var v string
+		require.NoError(t, db.QueryRow("SELECT u, v, n FROM upsert_t WHERE id = ?", id).Scan(&u, &v, &n))
+		return fmt.Sprintf("%d %s %d", u, v, n)
+	}
+
+	// REPLACE sets the omitted columns to their defaults.
+	require.EqualValues(t, 2+1, affected(db, "REPLACE INTO upsert_t (id, u) VALUES (1, 10), (3, 30)"))
+	require.Equal(t, "10 default 0", row(1))
+	require.EqualValues(t, 1, affected(db, "REPLACE INTO upsert_t VALUES (1, 10, 'default', 0)"))
+
+	// The rows are matched on the primary key first, and then on the unique key.
+	require.EqualValues(t, 2+2, affected(db, "INSERT INTO upsert_t (id, u) VALUES (2, 0), (9, 30) ON DUPLICATE KEY UPDATE n = n + 1"))
+	require.Equal(t, "20 b 1", row(2))
+	require.Equal(t, "30 default 1", row(3))
+	require.EqualValues(t, 1, affected(db, "INSERT INTO upsert_t (id, u, v) VALUES (4, 40, 'x') AS new ON DUPLICATE KEY UPDATE v = new.v"))
+
+	// An update to the current values counts as 0, or 1 with CLIENT_FOUND_ROWS.
+	require.EqualValues(t, 0, affected(db, "INSERT INTO upsert_t (id, v) VALUES (4, 'x') ON DUPLICATE KEY UPDATE v = VALUES(v)"))
+	foundRows, err := connect(fmt.Sprintf("root@tcp(127.0.0.1:%d)/upsert?clientFoundRows=true", port))
+	require.NoError(t, err)
+	defer foundRows.Close()
+	require.EqualValues(t, 1+2, affected(foundRows, "INSERT INTO upsert_t (id, v) VALUES (4, 'x'), (1, 'y') ON DUPLICATE KEY UPDATE v = VALUES(v)"))
+	require.Equal(t, "10 y 0", row(1))
+}
@@ -24,6 +24,7 @@ func CauseImplicitCommitAfter(node sql.Node) bool {
 	case *plan.CreateDB, *plan.DropDB, *plan.AlterDB,
 		*plan.CreateTable, *plan.DropTable, *plan.RenameTable,
 		*plan.AddColumn, *plan.RenameColumn, *plan.DropColumn, *plan.ModifyColumn, *plan.AlterDefaultSet, *plan.AlterDefaultDrop,
+		*plan.AlterPK,
 		*plan.Truncate,
 		*plan.AnalyzeTable,
 		*plan.CreateIndex, *plan.DropIndex, *plan.AlterIndex,
@@ -42,6 +43,7 @@ func CauseSchemaChange(node sql.Node) bool {
 	case *plan.CreateDB, *plan.DropDB, *plan.AlterDB,
 		*plan.CreateTable, *plan.DropTable, *plan.RenameTable,
 		*plan.AddColumn, *plan.RenameColumn, *plan.DropColumn, *plan.ModifyColumn, *plan.AlterDefaultSet, *plan.AlterDefaultDrop,
+		*plan.AlterPK,
 		*plan.CreateIndex, *plan.DropIndex, *plan.AlterIndex,
 		*plan.CreateView, *plan.DropView:
 		return true
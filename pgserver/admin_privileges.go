@@ -0,0 +1,105 @@
+package pgserver
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// protectedTableRegex matches the references to the protected internal tables, see catalog.ProtectedInternalTables.
+var protectedTableRegex = func() *regexp.Regexp {
+	var names []string
+	for _, t := range catalog.ProtectedInternalTables {
+		names = append(names, regexp.QuoteMeta(t.Name))
+	}
+	return regexp.MustCompile(`(?i)\b(` + strings.Join(names, "|") + `)\b`)
+}()
+
+// checkProtectedTableWrite refuses a statement that may change a protected internal table, like the same check
+// of the MySQL protocol. The statements are executed by DuckDB as they are, so a statement that references such
+// a table is refused if it writes, or if it cannot be parsed.
+func (h *ConnectionHandler) checkProtectedTableWrite(statement ConvertedStatement) error {
+	m := protectedTableRegex.FindStringSubmatch(statement.String)
+	if m == nil || (statement.AST != nil && !isWriteStatement(statement.AST)) {
+		return nil
+	}
+	return newPgError("42501", "permission denied for table %s", strings.ToLower(m[1]))
+}
+
+// execAdminPrivilegeStatement grants or revokes REPLICATION or ADMIN, see backend/admin_privileges.go.
+func (h *ConnectionHandler) execAdminPrivilegeStatement(query string) (bool, error) {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, query)
+	if err != nil {
+		return false, err
+	}
+	tag, ok, err := backend.ExecAdminPrivilegeStatement(ctx, h.duckHandler.e.Analyzer.Catalog.MySQLDb, query)
+	if !ok || err != nil {
+		return false, err
+	}
+	return true, h.send(makeCommandComplete(tag, 0))
+}
+
+// runAdminStatement runs a subscription, backup, or restore statement if the user has the administrative
+// privilege it requires, and records it in the audit log.
+func (h *ConnectionHandler) runAdminStatement(statement ConvertedStatement) error {
+	var privilege, tag string
+	switch {
+	case statement.SubscriptionConfig != nil:
+		privilege = catalog.PrivilegeReplication
+		switch statement.SubscriptionConfig.Action {
+		case Create:
+			tag = "CREATE SUBSCRIPTION"
+		case Drop:
+			tag = "DROP SUBSCRIPTION"
+		default:
+			tag = "ALTER SUBSCRIPTION"
+		}
+	case statement.BackupConfig != nil:
+		privilege, tag = catalog.PrivilegeAdmin, "BACKUP DATABASE"
+	default:
+		privilege, tag = catalog.PrivilegeAdmin, "RESTORE DATABASE"
+	}
+
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, statement.String)
+	if err != nil {
+		return err
+	}
+	err = backend.RunAdminStatement(ctx, h.duckHandler.e.Analyzer.Catalog.MySQLDb, privilege, tag, statement.String, func() error {
+		return h.execAdminStatement(statement)
+	})
+	if backend.ErrAdminPrivilegeRequired.Is(err) {
+		return newPgError("42501", "%s", err.Error())
+	}
+	return err
+}
+
+// execAdminStatement executes a subscription, backup, or restore statement.
+func (h *ConnectionHandler) execAdminStatement(statement ConvertedStatement) error {
+	switch {
+	case statement.SubscriptionConfig != nil:
+		return h.executeSubscriptionSQL(statement.SubscriptionConfig)
+	case statement.BackupConfig != nil:
+		if statement.BackupConfig.ToStdout {
+			return h.streamBackup(statement.BackupConfig)
+		}
+		msg, err := h.executeBackup(statement.BackupConfig)
+		if err != nil {
+			return err
+		}
+		return h.send(&pgproto3.ErrorResponse{
+			Message: msg,
+		})
+	default:
+		msg, err := h.executeRestore(statement.RestoreConfig)
+		if err != nil {
+			return err
+		}
+		return h.send(&pgproto3.ErrorResponse{
+			Message: msg,
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckProtectedTableWrite(t *testing.T) {
+	h := &ConnectionHandler{}
+	for query, want := range map[string]bool{
+		"DELETE FROM __sys__.admin_grants":                        true,
+		"INSERT INTO __sys__.\"ADMIN_AUDIT_LOG\" SELECT * FROM t": true,
+		"DROP TABLE __sys__.admin_grants":                         true,
+		"UPDATE __sys__.tenant_grants SET user_name = 'bob'":      true,
+		"INSERT INTO __sys__.unmask_grants VALUES ('bob', now())": true,
+		"DELETE FROM __sys__.masking_policies":                    true,
+		"SELECT * FROM __sys__.admin_grants":                      false,
+		"DELETE FROM admin_grants_archive":                        false,
+	} {
+		stmt, err := parser.ParseOne(query)
+		require.NoError(t, err)
+		err = h.checkProtectedTableWrite(ConvertedStatement{String: query, AST: stmt.AST})
+		require.Equal(t, want, err != nil, query)
+	}
+	// The statements that cannot be parsed are refused as well.
+	require.Error(t, h.checkProtectedTableWrite(ConvertedStatement{String: "PRAGMA x; DELETE FROM __sys__.admin_grants"}))
+}
@@ -0,0 +1,327 @@
+package pgserver
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/sirupsen/logrus"
+)
+
+// CopyAppenderParameter is the session parameter that makes COPY FROM STDIN load the data through the DuckDB Appender.
+// It is off by default: the rows are appended one by one on a single thread,
+// which is slower than the parallel parsing pipeline unless the table is narrow or the host has few cores,
+// see BenchmarkCopyFrom.
+const CopyAppenderParameter = "myduck.copy_appender"
+
+// errAppenderUnsupported is returned by NewAppenderDataLoader if the COPY FROM cannot be loaded
+// through the DuckDB Appender, in which case the data is loaded through SQL instead.
+var errAppenderUnsupported = errors.New("COPY FROM is not supported by the appender")
+
+// AppenderDataLoader loads COPY FROM STDIN data in TEXT or CSV format through the DuckDB Appender.
+// The records of each chunk are parsed and converted to the column types in Go,
+// and appended to the table directly, without planning and executing an INSERT statement.
+//
+// The Appender writes all columns of the table and cannot fill in the defaults of the omitted columns,
+// so it is only used if every column is loaded and has a type that copyValueConverters supports.
+// The appended rows cannot be taken back by the statement, so the load runs in a transaction of its own,
+// and is only used outside of transaction blocks.
+type AppenderDataLoader struct {
+	ctx      *sql.Context
+	schema   string
+	table    sql.InsertableTable
+	conn     *stdsql.Conn
+	splitter *copyRecordSplitter
+	rows     *copyRowAppender
+	closed   bool
+	logger   *logrus.Entry
+}
+
+var _ DataLoader = (*AppenderDataLoader)(nil)
+
+func NewAppenderDataLoader(
+	ctx *sql.Context, handler *DuckHandler,
+	schema string, table sql.InsertableTable, columns tree.NameList,
+	options *tree.CopyOptions, textOptions *CopyTextOptions,
+) (DataLoader, error) {
+	if !handler.copyAppender || handler.inTxnBlock || adapter.TryGetTxn(ctx) != nil {
+		return nil, errAppenderUnsupported
+	}
+
+	names := copyColumnNames(table, columns)
+	format, err := newCopyTextFormat(options, textOptions, names)
+	if err != nil {
+		return nil, err
+	}
+	tableColumns, err := copyTableColumns(ctx, schema, table.Name())
+	if err != nil {
+		return nil, err
+	}
+	targets, ok := copyAppendTargets(table.Name(), names, tableColumns)
+	if !ok {
+		return nil, errAppenderUnsupported
+	}
+
+	conn, err := adapter.GetConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &AppenderDataLoader{
+		ctx:      ctx,
+		schema:   schema,
+		table:    table,
+		conn:     conn,
+		splitter: newCopyRecordSplitter(&format),
+		rows:     newCopyRowAppender(&format, names, targets),
+		logger:   ctx.GetLogger(),
+	}, nil
+}
+
+func (loader *AppenderDataLoader) Start() <-chan error {
+	ready := make(chan error, 1)
+	defer close(ready)
+
+	if _, err := loader.conn.ExecContext(loader.ctx, "BEGIN"); err != nil {
+		ready <- err
+		return ready
+	}
+	loader.logger.Debugf("Creating appender for %s.%s", loader.schema, loader.table.Name())
+	if err := loader.conn.Raw(func(driverConn any) error {
+		appender, err := duckdb.NewAppenderFromConn(driverConn.(driver.Conn), loader.schema, loader.table.Name())
+		loader.rows.appender = appender
+		return err
+	}); err != nil {
+		loader.rollback()
+		ready <- err
+	}
+	return ready
+}
+
+func (loader *AppenderDataLoader) LoadChunk(ctx *sql.Context, data []byte) error {
+	if loader.closed {
+		return ErrCopyAborted
+	}
+	if err := loader.splitter.Feed(data); err != nil {
+		loader.Abort(ctx)
+		return err
+	}
+	if records := loader.splitter.Records(0); records != nil {
+		if err := loader.rows.Append(records); err != nil {
+			loader.Abort(ctx)
+			return err
+		}
+	}
+	return nil
+}
+
+func (loader *AppenderDataLoader) Abort(ctx *sql.Context) error {
+	// Abort may be called again on teardown after a failed chunk has aborted the load.
+	if loader.closed {
+		return nil
+	}
+	loader.closed = true
+	// Closing the appender flushes the appended rows into the transaction, which is then rolled back.
+	return errors.Join(loader.rows.Close(), loader.rollback())
+}
+
+func (loader *AppenderDataLoader) Finish(ctx *sql.Context) (*LoadDataResults, error) {
+	if loader.closed {
+		return nil, ErrCopyAborted
+	}
+	records, err := loader.splitter.Flush()
+	if err == nil && len(records) > 0 {
+		err = loader.rows.Append(records)
+	}
+	if err != nil {
+		loader.Abort(ctx)
+		return nil, err
+	}
+
+	loader.closed = true
+	if err := loader.rows.Close(); err != nil {
+		loader.logger.Errorln("COPY operation failed:", err)
+		return nil, errors.Join(err, loader.rollback())
+	}
+	if _, err := loader.conn.ExecContext(loader.ctx, "COMMIT"); err != nil {
+		return nil, errors.Join(err, loader.rollback())
+	}
+	loader.logger.Debugf("Appended %d rows", loader.rows.count)
+
+	return &LoadDataResults{
+		RowsLoaded: int32(loader.rows.count),
+	}, nil
+}
+
+func (loader *AppenderDataLoader) rollback() error {
+	// The load may have been aborted because the context was canceled.
+	_, err := loader.conn.ExecContext(context.WithoutCancel(loader.ctx), "ROLLBACK")
+	return err
+}
+
+// setCopyAppender enables or disables loading COPY FROM STDIN data through the Appender.
+func (h *ConnectionHandler) setCopyAppender(value any, useDefault bool) error {
+	enabled := false
+	if !useDefault {
+		var err error
+		if enabled, err = parseBoolSetting(CopyAppenderParameter, value); err != nil {
+			return err
+		}
+	}
+	h.duckHandler.copyAppender = enabled
+	return nil
+}
+
+// copyValueConverter converts the text representation of a value to the Go value
+// that the DuckDB Appender accepts for the column type.
+type copyValueConverter func(s string) (driver.Value, bool)
+
+// copyValueConverters are the converters for the DuckDB column types that COPY FROM can append directly.
+// The columns of the other types are loaded through SQL, which casts the values.
+var copyValueConverters = map[string]copyValueConverter{
+	"BOOLEAN":   parseCopyBool,
+	"TINYINT":   copyIntConverter(8, func(v int64) driver.Value { return int8(v) }),
+	"SMALLINT":  copyIntConverter(16, func(v int64) driver.Value { return int16(v) }),
+	"INTEGER":   copyIntConverter(32, func(v int64) driver.Value { return int32(v) }),
+	"BIGINT":    copyIntConverter(64, func(v int64) driver.Value { return v }),
+	"UTINYINT":  copyUintConverter(8, func(v uint64) driver.Value { return uint8(v) }),
+	"USMALLINT": copyUintConverter(16, func(v uint64) driver.Value { return uint16(v) }),
+	"UINTEGER":  copyUintConverter(32, func(v uint64) driver.Value { return uint32(v) }),
+	"UBIGINT":   copyUintConverter(64, func(v uint64) driver.Value { return v }),
+	"FLOAT":     copyFloatConverter(32, func(v float64) driver.Value { return float32(v) }),
+	"DOUBLE":    copyFloatConverter(64, func(v float64) driver.Value { return v }),
+	"VARCHAR":   func(s string) (driver.Value, bool) { return s, true },
+}
+
+func copyIntConverter(bits int, conv func(int64) driver.Value) copyValueConverter {
+	return func(s string) (driver.Value, bool) {
+		v, err := strconv.ParseInt(strings.TrimSpace(s), 10, bits)
+		return conv(v), err == nil
+	}
+}
+
+func copyUintConverter(bits int, conv func(uint64) driver.Value) copyValueConverter {
+	return func(s string) (driver.Value, bool) {
+		v, err := strconv.ParseUint(strings.TrimSpace(s), 10, bits)
+		return conv(v), err == nil
+	}
+}
+
+func copyFloatConverter(bits int, conv func(float64) driver.Value) copyValueConverter {
+	return func(s string) (driver.Value, bool) {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), bits)
+		return conv(v), err == nil
+	}
+}
+
+// parseCopyBool parses a boolean like PostgreSQL, which accepts the unique prefixes of
+// true, false, yes, no, on, and off in any case, as well as 1 and 0.
+func parseCopyBool(s string) (driver.Value, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return nil, false
+	}
+	switch {
+	case strings.HasPrefix("true", s), strings.HasPrefix("yes", s), s == "1", s == "on":
+		return true, true
+	case strings.HasPrefix("false", s), strings.HasPrefix("no", s), s == "0", len(s) >= 2 && strings.HasPrefix("off", s):
+		return false, true
+	}
+	return nil, false
+}
+
+// copyAppendTarget is a column of the table that the Appender writes.
+type copyAppendTarget struct {
+	field   int // the index of the field in the COPY records
+	convert copyValueConverter
+	message string // the format of the error message for the values that cannot be converted
+}
+
+// copyAppendTargets maps the columns of the table to the fields of the COPY records.
+// It returns false if a column is not loaded or has a type that cannot be appended directly.
+func copyAppendTargets(table string, names []string, columns []copyTableColumn) ([]copyAppendTarget, bool) {
+	if len(names) != len(columns) {
+		return nil, false
+	}
+	targets := make([]copyAppendTarget, len(columns))
+	for i, col := range columns {
+		field := -1
+		for j, name := range names {
+			if strings.EqualFold(name, col.name) {
+				field = j
+				break
+			}
+		}
+		convert, ok := copyValueConverters[col.typ]
+		if field < 0 || !ok {
+			return nil, false
+		}
+		targets[i] = copyAppendTarget{
+			field:   field,
+			convert: convert,
+			// The same message as the one of copyCastExpr.
+			message: fmt.Sprintf(`invalid input syntax for type %s: "%%s" (COPY %s, column %s)`, strings.ToLower(col.typ), table, col.name),
+		}
+	}
+	return targets, true
+}
+
+// copyRowAppender parses the records of COPY FROM STDIN and appends them to a table through the DuckDB Appender.
+type copyRowAppender struct {
+	parser   *copyRecordParser
+	targets  []copyAppendTarget
+	values   []driver.Value
+	appender *duckdb.Appender
+	count    int64
+}
+
+func newCopyRowAppender(format *copyTextFormat, names []string, targets []copyAppendTarget) *copyRowAppender {
+	return &copyRowAppender{
+		parser:  newCopyRecordParser(format, names, nil, nil),
+		targets: targets,
+		values:  make([]driver.Value, len(targets)),
+	}
+}
+
+// Append parses a batch of complete records and appends them to the table.
+func (a *copyRowAppender) Append(data []byte) error {
+	for len(data) > 0 {
+		var err error
+		if data, err = a.parser.Next(data); err != nil {
+			return err
+		}
+		for i, target := range a.targets {
+			field, null := a.parser.Field(target.field)
+			if null {
+				a.values[i] = nil
+				continue
+			}
+			value, ok := target.convert(string(field))
+			if !ok {
+				return fmt.Errorf(target.message, field)
+			}
+			a.values[i] = value
+		}
+		if err := a.appender.AppendRow(a.values...); err != nil {
+			return err
+		}
+		a.count++
+	}
+	return nil
+}
+
+// Close flushes the appended rows to the table and releases the Appender.
+func (a *copyRowAppender) Close() error {
+	if a.appender == nil {
+		return nil
+	}
+	defer func() { a.appender = nil }()
+	return a.appender.Close()
+}
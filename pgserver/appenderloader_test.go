@@ -0,0 +1,263 @@
+package pgserver
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+// appendCopyRecords appends the COPY records to the table through a copyRowAppender.
+func appendCopyRecords(conn *stdsql.Conn, options *tree.CopyOptions, table string, names []string, columns []copyTableColumn, data []byte) (int64, error) {
+	format, err := newCopyTextFormat(options, &CopyTextOptions{}, names)
+	if err != nil {
+		return 0, err
+	}
+	targets, ok := copyAppendTargets(table, names, columns)
+	if !ok {
+		return 0, errAppenderUnsupported
+	}
+	rows := newCopyRowAppender(&format, names, targets)
+	if err := conn.Raw(func(driverConn any) error {
+		rows.appender, err = duckdb.NewAppenderFromConn(driverConn.(driver.Conn), "", table)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	err = rows.Append(data)
+	if closeErr := rows.Close(); err == nil {
+		err = closeErr
+	}
+	return rows.count, err
+}
+
+func TestCopyRowAppender(t *testing.T) {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	defer connector.Close()
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE t (id INTEGER, flag BOOLEAN, score DOUBLE, big UBIGINT, "it's" VARCHAR)`)
+	require.NoError(t, err)
+	columns := []copyTableColumn{{"id", "INTEGER"}, {"flag", "BOOLEAN"}, {"score", "DOUBLE"}, {"big", "UBIGINT"}, {"it's", "VARCHAR"}}
+	csv := &tree.CopyOptions{CopyFormat: tree.CopyFormatCSV}
+	text := &tree.CopyOptions{CopyFormat: tree.CopyFormatText}
+
+	tests := []struct {
+		name    string
+		options *tree.CopyOptions
+		names   []string
+		data    string
+		rows    int64
+		err     string
+	}{
+		{
+			name:    "text",
+			options: text,
+			names:   []string{"id", "flag", "score", "big", "it's"},
+			data:    "1\tt\t1.5\t18446744073709551615\ta\\tb\n2\t\\N\t\\N\t\\N\t\\N\n",
+			rows:    2,
+		},
+		{
+			name:    "csv with reordered columns",
+			options: csv,
+			names:   []string{"it's", "big", "score", "flag", "ID"},
+			data:    "\"x, y\",0, -Infinity ,Off, 3 \n,,,yes,4\n",
+			rows:    2,
+		},
+		{
+			name:    "invalid integer",
+			options: csv,
+			names:   []string{"id", "flag", "score", "big", "it's"},
+			data:    "1.5,t,0,0,x\n",
+			err:     `invalid input syntax for type integer: "1.5" (COPY t, column id)`,
+		},
+		{
+			name:    "invalid boolean",
+			options: csv,
+			names:   []string{"id", "flag", "score", "big", "it's"},
+			data:    "5,o,0,0,x\n",
+			err:     `invalid input syntax for type boolean: "o" (COPY t, column flag)`,
+		},
+		{
+			name:    "out of range",
+			options: csv,
+			names:   []string{"id", "flag", "score", "big", "it's"},
+			data:    "5,f,0,-1,x\n",
+			err:     `invalid input syntax for type ubigint: "-1" (COPY t, column big)`,
+		},
+		{
+			name:    "missing column",
+			options: csv,
+			names:   []string{"id", "flag", "score", "big", "it's"},
+			data:    "6,f\n",
+			err:     `missing data for column "score"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := conn.ExecContext(ctx, "DELETE FROM t")
+			require.NoError(t, err)
+			n, err := appendCopyRecords(conn, tt.options, "t", tt.names, columns, []byte(tt.data))
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.rows, n)
+		})
+	}
+
+	// The rows of the last successful test.
+	_, err = conn.ExecContext(ctx, "DELETE FROM t")
+	require.NoError(t, err)
+	_, err = appendCopyRecords(conn, csv, "t", []string{"it's", "big", "score", "flag", "ID"}, columns, []byte("\"x, y\",0, -Infinity ,Off, 3 \n,,,yes,4\n"))
+	require.NoError(t, err)
+	rows, err := conn.QueryContext(ctx, `SELECT id, flag, score::VARCHAR, big, "it's" FROM t ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+	var got [][]any
+	for rows.Next() {
+		var id, flag, score, big, note any
+		require.NoError(t, rows.Scan(&id, &flag, &score, &big, &note))
+		got = append(got, []any{id, flag, score, big, note})
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, [][]any{
+		{int32(3), false, "-inf", uint64(0), "x, y"},
+		{int32(4), true, nil, nil, nil},
+	}, got)
+}
+
+func TestCopyAppendTargets(t *testing.T) {
+	columns := []copyTableColumn{{"id", "BIGINT"}, {"name", "VARCHAR"}}
+	tests := []struct {
+		name    string
+		names   []string
+		columns []copyTableColumn
+		fields  []int
+	}{
+		{name: "all columns", names: []string{"id", "name"}, columns: columns, fields: []int{0, 1}},
+		{name: "reordered columns", names: []string{"Name", "ID"}, columns: columns, fields: []int{1, 0}},
+		{name: "omitted column", names: []string{"id"}, columns: columns},
+		{name: "unknown column", names: []string{"id", "other"}, columns: columns},
+		{name: "unsupported type", names: []string{"id", "created"}, columns: []copyTableColumn{{"id", "BIGINT"}, {"created", "TIMESTAMP"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, ok := copyAppendTargets("t", tt.names, tt.columns)
+			require.Equal(t, tt.fields != nil, ok)
+			for i, target := range targets {
+				require.Equal(t, tt.fields[i], target.field)
+			}
+		})
+	}
+}
+
+// BenchmarkCopyFrom compares loading COPY data through the Appender with loading it through
+// the parallel parsing pipeline and an INSERT statement.
+func BenchmarkCopyFrom(b *testing.B) {
+	const numRows = 200_000
+	var sb strings.Builder
+	for i := range numRows {
+		fmt.Fprintf(&sb, "%d,name_%d,%d.%02d,%t,\"quoted, text %d\"\n", i, i, i, i%100, i%2 == 0, i)
+	}
+	data := sb.String()
+	var chunks []string
+	for len(data) > 0 {
+		n := min(len(data), 64<<10)
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	options := &tree.CopyOptions{CopyFormat: tree.CopyFormatCSV}
+	columns := []copyTableColumn{{"id", "BIGINT"}, {"name", "VARCHAR"}, {"amount", "DOUBLE"}, {"flag", "BOOLEAN"}, {"note", "VARCHAR"}}
+	names := make([]string, len(columns))
+	exprs := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+		exprs[i] = copyCastExpr("t", col.name, col.typ)
+	}
+	insert := "INSERT INTO t SELECT " + strings.Join(exprs, ", ") + " FROM copy_source"
+
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(b, err)
+	defer connector.Close()
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE t (id BIGINT, name VARCHAR, amount DOUBLE, flag BOOLEAN, note VARCHAR)")
+	require.NoError(b, err)
+
+	b.Run("appender", func(b *testing.B) {
+		conn, err := db.Conn(context.Background())
+		require.NoError(b, err)
+		defer conn.Close()
+
+		b.SetBytes(int64(sb.Len()))
+		b.ResetTimer()
+		for range b.N {
+			format, err := newCopyTextFormat(options, &CopyTextOptions{}, names)
+			require.NoError(b, err)
+			targets, ok := copyAppendTargets("t", names, columns)
+			require.True(b, ok)
+			splitter := newCopyRecordSplitter(&format)
+			rows := newCopyRowAppender(&format, names, targets)
+			require.NoError(b, conn.Raw(func(driverConn any) error {
+				rows.appender, err = duckdb.NewAppenderFromConn(driverConn.(driver.Conn), "", "t")
+				return err
+			}))
+			for _, chunk := range chunks {
+				require.NoError(b, splitter.Feed([]byte(chunk)))
+				if records := splitter.Records(0); records != nil {
+					require.NoError(b, rows.Append(records))
+				}
+			}
+			records, err := splitter.Flush()
+			require.NoError(b, err)
+			require.NoError(b, rows.Append(records))
+			require.NoError(b, rows.Close())
+			require.EqualValues(b, numRows, rows.count)
+		}
+	})
+
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("insert/workers=%d", workers), func(b *testing.B) {
+			conn, err := db.Conn(context.Background())
+			require.NoError(b, err)
+			defer conn.Close()
+
+			b.SetBytes(int64(sb.Len()))
+			b.ResetTimer()
+			for range b.N {
+				p, err := startCopyPipeline(options, &CopyTextOptions{}, names, workers, copyBatchSize, chunks)
+				require.NoError(b, err)
+
+				var release func()
+				require.NoError(b, conn.Raw(func(driverConn any) error {
+					arrow, err := duckdb.NewArrowFromConn(driverConn.(driver.Conn))
+					if err != nil {
+						return err
+					}
+					release, err = arrow.RegisterView(p, "copy_source")
+					return err
+				}))
+				result, err := conn.ExecContext(context.Background(), insert)
+				release()
+				require.NoError(b, err)
+				n, err := result.RowsAffected()
+				require.NoError(b, err)
+				require.EqualValues(b, numRows, n)
+			}
+		})
+	}
+}
@@ -16,11 +16,13 @@ package pgserver
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"net"
 	"strings"
 
+	"github.com/apecloud/myduckserver/backend"
 	"github.com/dolthub/doltgresql/server/auth"
 	"github.com/dolthub/doltgresql/server/auth/rfc5802"
 
@@ -48,6 +50,7 @@ func InitSuperuser(password string) {
 	var err error
 	postgres := auth.CreateDefaultRole("postgres")
 	postgres.CanLogin = true
+	postgres.IsSuperUser = true
 	postgres.Password, err = auth.NewScramSha256Password(password)
 	if err != nil {
 		panic(err)
@@ -61,6 +64,20 @@ func InitSuperuser(password string) {
 	}
 }
 
+// markPostgresSuperuser marks the session of an authenticated superuser role, which has no MySQL account,
+// as the session of a superuser, see backend.IsSuperuser.
+func (h *ConnectionHandler) markPostgresSuperuser() error {
+	if h.duckHandler == nil || !auth.GetRole(h.mysqlConn.User).IsSuperUser {
+		return nil
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	ctx.Session.(*backend.Session).SetPostgresSuperuser()
+	return nil
+}
+
 // SASLBindingFlag are the flags for gs2-cbind-flag, used in SASL authentication.
 type SASLBindingFlag string
 
@@ -2,13 +2,16 @@ package pgserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
 	"github.com/apecloud/myduckserver/pgserver/logrepl"
 	"github.com/apecloud/myduckserver/storage"
 	"github.com/dolthub/go-mysql-server/sql"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // This file implements the logic for handling BACKUP SQL statements.
@@ -24,11 +27,16 @@ import (
 //     ENDPOINT = 's3.cn-northwest-1.amazonaws.com.cn'
 //     ACCESS_KEY_ID = 'xxxxxxxxxxxxx'
 //     SECRET_ACCESS_KEY = 'xxxxxxxxxxxx'
+//
+//   BACKUP DATABASE my_database TO STDOUT
+//     streams a copy of the database to the client instead, see streamBackup.
 
 type BackupConfig struct {
 	DbName        string
 	RemotePath    string
 	StorageConfig *storage.ObjectStorageConfig
+	// ToStdout is true if the backup is streamed to the client by BACKUP DATABASE ... TO STDOUT.
+	ToStdout bool
 }
 
 var backupRegex = regexp.MustCompile(
@@ -37,6 +45,8 @@ var backupRegex = regexp.MustCompile(
 		`(?:\s+ACCESS_KEY_ID\s*=\s*'([^']+)')?` +
 		`(?:\s+SECRET_ACCESS_KEY\s*=\s*'([^']+)')?`)
 
+var backupToStdoutRegex = regexp.MustCompile(`(?i)^\s*BACKUP\s+DATABASE\s+("(?:[^"]|"")+"|\S+)\s+TO\s+STDOUT\s*;?\s*$`)
+
 func NewBackupConfig(dbName, remotePath string, storageConfig *storage.ObjectStorageConfig) *BackupConfig {
 	return &BackupConfig{
 		DbName:        dbName,
@@ -46,6 +56,10 @@ func NewBackupConfig(dbName, remotePath string, storageConfig *storage.ObjectSto
 }
 
 func parseBackupSQL(sql string) (*BackupConfig, error) {
+	if matches := backupToStdoutRegex.FindStringSubmatch(sql); matches != nil {
+		return &BackupConfig{DbName: unquoteIdentifier(matches[1]), RemotePath: "STDOUT", ToStdout: true}, nil
+	}
+
 	matches := backupRegex.FindStringSubmatch(sql)
 	if matches == nil {
 		// No match means the SQL doesn't follow the expected pattern
@@ -88,41 +102,68 @@ func parseBackupSQL(sql string) (*BackupConfig, error) {
 	return NewBackupConfig(dbName, remotePath, storageConfig), nil
 }
 
-func (h *ConnectionHandler) executeBackup(backupConfig *BackupConfig) (string, error) {
+// executeBackup uploads a checkpointed copy of the data file of the database. The server is left writable and
+// its subscriptions are resumed afterward, and the attempt is recorded in the history, even if the backup fails.
+func (h *ConnectionHandler) executeBackup(backupConfig *BackupConfig) (msg string, err error) {
 	sqlCtx, err := h.duckHandler.sm.NewContextWithQuery(context.Background(), h.mysqlConn, "")
 	if err != nil {
 		return "", fmt.Errorf("failed to create context for query: %w", err)
 	}
 
-	if err := stopAllReplication(sqlCtx); err != nil {
-		return "", fmt.Errorf("failed to stop replication: %w", err)
-	}
+	// The backup is recorded after the server is writable again.
+	startedAt := time.Now()
+	defer func() {
+		recordBackup(sqlCtx, backupConfig, startedAt, msg, err)
+	}()
+
+	// The subscriptions are stopped while the data file is backed up, but their status is left as it is,
+	// so that the subscriptions enabled in the backup are reconciled and resumed after it is restored.
+	// See logrepl.ReconcileSubscriptions.
+	logrepl.PauseSubscriptions()
+	defer logrepl.ResumeSubscriptions(sqlCtx)
 
 	if err := doCheckpoint(sqlCtx); err != nil {
 		return "", fmt.Errorf("failed to do checkpoint: %w", err)
 	}
 
-	err = h.restartServer(true)
-	if err != nil {
-		return "", err
+	// The checkpointed database of a tenant is checked against its storage quota. A tenant above its quota
+	// is still backed up, but is read-only afterward, see backend.CheckTenantAccess.
+	if err := h.server.Provider.CheckTenantQuota(backupConfig.DbName); err != nil && !catalog.ErrTenantQuotaExceeded.Is(err) {
+		return "", fmt.Errorf("failed to check the storage quota: %w", err)
 	}
 
-	msg, err := backupConfig.StorageConfig.UploadFile(
+	if err := h.restartServer(true); err != nil {
+		return "", err
+	}
+	msg, err = backupConfig.StorageConfig.UploadFile(
 		h.server.Provider.DataDir(), backupConfig.DbName+".db", backupConfig.RemotePath)
+	if restartErr := h.restartServer(false); restartErr != nil {
+		if err == nil {
+			return msg, fmt.Errorf("backup finished: %s, but failed to restart server: %w", msg, restartErr)
+		}
+		err = errors.Join(err, fmt.Errorf("failed to restart server: %w", restartErr))
+	}
 	if err != nil {
 		return "", err
 	}
+	return msg, nil
+}
 
-	err = h.restartServer(false)
-	if err != nil {
-		return "", fmt.Errorf("backup finished: %s, but failed to restart server: %w", msg, err)
+// recordBackup records a backup in the history, which is listed by the \backups command of the shell.
+func recordBackup(sqlCtx *sql.Context, backupConfig *BackupConfig, startedAt time.Time, msg string, backupErr error) {
+	var errMsg any
+	if backupErr != nil {
+		errMsg = backupErr.Error()
 	}
-
-	if err = startAllReplication(sqlCtx); err != nil {
-		return "", fmt.Errorf("backup finished: %s, but failed to start replication: %w", msg, err)
+	if _, err := adapter.ExecCatalogInTxn(sqlCtx, catalog.InternalTables.BackupHistory.UpsertStmt(),
+		startedAt, backupConfig.DbName, backupConfig.RemotePath, time.Now(), msg, errMsg,
+	); err != nil {
+		sqlCtx.GetLogger().WithError(err).Warn("Failed to record the backup")
+		return
+	}
+	if err := adapter.CommitAndCloseTxn(sqlCtx); err != nil {
+		sqlCtx.GetLogger().WithError(err).Warn("Failed to record the backup")
 	}
-
-	return msg, nil
 }
 
 func (h *ConnectionHandler) restartServer(readOnly bool) error {
@@ -141,35 +182,3 @@ func doCheckpoint(sqlCtx *sql.Context) error {
 
 	return nil
 }
-
-func stopAllReplication(sqlCtx *sql.Context) error {
-	if err := logrepl.UpdateAllSubscriptionStatus(sqlCtx, false); err != nil {
-		return err
-	}
-
-	if err := adapter.CommitAndCloseTxn(sqlCtx); err != nil {
-		return err
-	}
-
-	if err := logrepl.UpdateSubscriptions(sqlCtx); err != nil {
-		return fmt.Errorf("failed to update subscriptions: %w", err)
-	}
-
-	return nil
-}
-
-func startAllReplication(sqlCtx *sql.Context) error {
-	if err := logrepl.UpdateAllSubscriptionStatus(sqlCtx, true); err != nil {
-		return err
-	}
-
-	if err := adapter.CommitAndCloseTxn(sqlCtx); err != nil {
-		return err
-	}
-
-	if err := logrepl.UpdateSubscriptions(sqlCtx); err != nil {
-		return fmt.Errorf("failed to update subscriptions: %w", err)
-	}
-
-	return nil
-}
@@ -0,0 +1,56 @@
+package pgserver
+
+import (
+	"context"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+)
+
+// COMMENT ON TABLE and COMMENT ON COLUMN replace the text of the comments only. The comments of the tables and
+// the columns created over MySQL also encode their meta, e.g., the original MySQL types of the columns,
+// which would be lost if the statements were passed through to DuckDB. See catalog.SetTableComment.
+
+func (h *ConnectionHandler) commentOnTable(stmt *tree.CommentOnTable) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	tn := stmt.Table.ToTableName()
+	schema := tn.Schema()
+	if schema == "" {
+		schema = adapter.GetCurrentSchema(ctx)
+	}
+	found, err := catalog.SetTableComment(ctx, schema, tn.Table(), stmt.Comment)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return newPgError("42P01", `relation "%s" does not exist`, tn.Table())
+	}
+	return nil
+}
+
+func (h *ConnectionHandler) commentOnColumn(stmt *tree.CommentOnColumn) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	if stmt.TableName == nil {
+		return newPgError("42601", "column name %q must be qualified", string(stmt.ColumnName))
+	}
+	tn := stmt.TableName.ToTableName()
+	schema := tn.Schema()
+	if schema == "" {
+		schema = adapter.GetCurrentSchema(ctx)
+	}
+	found, err := catalog.SetColumnComment(ctx, schema, tn.Table(), string(stmt.ColumnName), stmt.Comment)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return newPgError("42703", `column "%s" of relation "%s" does not exist`, string(stmt.ColumnName), tn.Table())
+	}
+	return nil
+}
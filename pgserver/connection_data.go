@@ -19,6 +19,7 @@ import (
 	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
 	"github.com/dolthub/go-mysql-server/sql"
 	"github.com/dolthub/vitess/go/vt/proto/query"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/lib/pq/oid"
 	"github.com/marcboeker/go-duckdb"
@@ -39,6 +40,16 @@ const (
 	ErrorResponseSeverity_Log     ErrorResponseSeverity = "LOG"
 )
 
+// newPgError returns an error that is reported to the client with the given SQLSTATE code,
+// instead of the generic internal_error.
+func newPgError(code string, format string, args ...any) error {
+	return &pgconn.PgError{
+		Severity: string(ErrorResponseSeverity_Error),
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
 // ReadyForQueryTransactionIndicator indicates the state of the transaction related to the query.
 type ReadyForQueryTransactionIndicator byte
 
@@ -91,6 +102,8 @@ type copyFromStdinState struct {
 
 	// For non-PG-parsable COPY FROM
 	rawOptions string
+	// textOptions stores the options of COPY FROM in TEXT or CSV format that are not supported by the parser.
+	textOptions *CopyTextOptions
 
 	// dataLoader is the implementation of DataLoader that is used to load each individual CopyData chunk into the
 	// target table.
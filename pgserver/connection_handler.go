@@ -25,18 +25,24 @@ import (
 	"io"
 	"net"
 	"os"
+	"regexp"
 	"runtime/debug"
 	"slices"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/apecloud/myduckserver/pgtypes"
 	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
 	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
 	gms "github.com/dolthub/go-mysql-server"
 	"github.com/dolthub/go-mysql-server/server"
 	"github.com/dolthub/go-mysql-server/sql"
 	"github.com/dolthub/vitess/go/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/sirupsen/logrus"
@@ -50,11 +56,25 @@ type ConnectionHandler struct {
 	portals            map[string]PortalData
 	duckHandler        *DuckHandler
 	backend            *pgproto3.Backend
+	startupReader      *countingReader
 	pgTypeMap          *pgtype.Map
 	waitForSync        bool
 	// copyFromStdinState is set when this connection is in the COPY FROM STDIN mode, meaning it is waiting on
 	// COPY DATA messages from the client to import data into tables.
 	copyFromStdinState *copyFromStdinState
+	// reportedParams are the last values of the parameters reported to the client with ParameterStatus,
+	// keyed by the lowercase parameter names.
+	reportedParams map[string]*pgproto3.ParameterStatus
+	// trace indicates whether the messages and the statements of the session are logged, see TraceParameter.
+	trace bool
+	// cursors are the cursors declared by the session, see declareCursor.
+	cursors cursorSet
+	// schemaChanges receives the schema changes published by all sessions, see deliverSchemaChanges.
+	schemaChanges *catalog.SchemaChangeSubscription
+	// pendingSchemaChanges are the schema changes made in the transaction block, published when it is committed.
+	pendingSchemaChanges []catalog.SchemaChange
+	// listening is the set of the channels that the session listens on.
+	listening map[string]struct{}
 
 	server *Server
 	logger *logrus.Entry
@@ -101,7 +121,6 @@ func NewConnectionHandler(conn net.Conn, handler mysql.Handler, engine *gms.Engi
 		preparedStatements: preparedStatements,
 		portals:            portals,
 		duckHandler:        duckHandler,
-		backend:            pgproto3.NewBackend(conn, conn),
 		pgTypeMap:          pgtype.NewMap(),
 
 		server: server,
@@ -110,11 +129,39 @@ func NewConnectionHandler(conn net.Conn, handler mysql.Handler, engine *gms.Engi
 			"protocol":     "pg",
 		}),
 	}
+	connectionHandler.setConn(conn)
 	connectionHandler.duckHandler.SetConnectionHandler(&connectionHandler)
 	return &connectionHandler
 }
 
+// teardown releases the resources held by the connection when it is closed, either by a Terminate message
+// or because the client went away: the in-flight COPY operation is aborted, all prepared statements and portals
+// are closed, and the transaction of the session is rolled back before the session is removed.
+func (h *ConnectionHandler) teardown() {
+	h.abortCopy()
+	h.resetCursors(true)
+	if h.schemaChanges != nil {
+		h.schemaChanges.Close()
+	}
+	for name := range h.portals {
+		h.deletePortal(name)
+	}
+	for name := range h.preparedStatements {
+		h.deletePreparedStatement(name)
+	}
+	// The backend connection is closed while the session still exists;
+	// otherwise a new session would be created just to look it up.
+	h.closeBackendConn()
+	h.duckHandler.ConnectionClosed(h.mysqlConn)
+}
+
 func (h *ConnectionHandler) closeBackendConn() {
+	// The transaction, if any, is rolled back along with the connection.
+	h.duckHandler.inTxnBlock = false
+	h.duckHandler.txnFailed = false
+	h.duckHandler.localSettings = nil
+	h.pendingSchemaChanges = nil
+	h.resetCursors(false)
 	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to create context for closing backend connection")
@@ -127,8 +174,8 @@ func (h *ConnectionHandler) closeBackendConn() {
 // Expected to run in a goroutine per connection.
 func (h *ConnectionHandler) HandleConnection() {
 	var returnErr error
-	if HandlePanics {
-		defer func() {
+	defer func() {
+		if HandlePanics {
 			if r := recover(); r != nil {
 				fmt.Printf("Listener recovered panic: %v\n%s\n", r, string(debug.Stack()))
 
@@ -149,24 +196,25 @@ func (h *ConnectionHandler) HandleConnection() {
 				}()
 				h.endOfMessages(eomErr)
 			}
+		}
 
-			if returnErr != nil {
-				fmt.Println(returnErr.Error())
-			}
+		if returnErr != nil {
+			fmt.Println(returnErr.Error())
+		}
 
-			h.duckHandler.ConnectionClosed(h.mysqlConn)
-			h.closeBackendConn()
-			if err := h.Conn().Close(); err != nil {
-				fmt.Printf("Failed to properly close connection:\n%v\n", err)
-			}
-		}()
-	}
+		h.teardown()
+		if err := h.Conn().Close(); err != nil {
+			fmt.Printf("Failed to properly close connection:\n%v\n", err)
+		}
+	}()
 	h.duckHandler.NewConnection(h.mysqlConn)
 
 	if proceed, err := h.handleStartup(); err != nil || !proceed {
 		returnErr = err
 		return
 	}
+	h.schemaChanges = catalog.SubscribeSchemaChanges()
+	go h.watchSchemaChanges(h.schemaChanges)
 
 	// Main session loop: read messages one at a time off the connection until we receive a |Terminate| message, in
 	// which case we hang up, or the connection is closed by the client, which generates an io.EOF from the connection.
@@ -191,62 +239,87 @@ func (h *ConnectionHandler) Conn() net.Conn {
 // setConn sets a new underlying net.Conn for this connection.
 func (h *ConnectionHandler) setConn(conn net.Conn) {
 	h.mysqlConn.Conn = conn
-	h.backend = pgproto3.NewBackend(conn, conn)
+	h.startupReader = &countingReader{Reader: conn}
+	h.backend = pgproto3.NewBackend(h.startupReader, conn)
 }
 
 // handleStartup handles the entire startup routine, including SSL requests, authentication, etc. Returns false if the
 // connection has been terminated, or if we should not proceed with the message loop.
 func (h *ConnectionHandler) handleStartup() (bool, error) {
-	startupMessage, err := h.backend.ReceiveStartupMessage()
+	sslDone, err := h.negotiateDirectSSL()
 	if err == io.EOF {
-		// Receiving EOF means that the connection has terminated, so we should just return
 		return false, nil
 	} else if err != nil {
-		return false, fmt.Errorf("error receiving startup message: %w", err)
+		return false, err
 	}
 
-	switch sm := startupMessage.(type) {
-	case *pgproto3.StartupMessage:
-		if err = h.handleAuthentication(sm); err != nil {
-			return false, err
-		}
-		if err = h.sendClientStartupMessages(); err != nil {
-			return false, err
-		}
-		if err = h.chooseInitialDatabase(sm); err != nil {
-			return false, err
-		}
-		return true, h.send(&pgproto3.ReadyForQuery{
-			TxStatus: byte(ReadyForQueryTransactionIndicator_Idle),
-		})
-	case *pgproto3.SSLRequest:
-		hasCertificate := len(certificate.Certificate) > 0
-		var performSSL = []byte("N")
-		if hasCertificate {
-			performSSL = []byte("S")
-		}
-		_, err = h.Conn().Write(performSSL)
-		if err != nil {
-			return false, fmt.Errorf("error sending SSL request: %w", err)
-		}
-		// If we have a certificate and the client has asked for SSL support, then we switch here.
-		// This involves swapping out our underlying net connection for a new one.
-		// We can't start in SSL mode, as the client does not attempt the handshake until after our response.
-		if hasCertificate {
-			h.setConn(tls.Server(h.Conn(), &tls.Config{
-				Certificates: []tls.Certificate{certificate},
-			}))
-		}
-		return h.handleStartup()
-	case *pgproto3.GSSEncRequest:
-		// we don't support GSSAPI
-		_, err = h.Conn().Write([]byte("N"))
-		if err != nil {
-			return false, fmt.Errorf("error sending response to GSS Enc Request: %w", err)
+	// The number of bytes consumed by the negotiation requests on the current connection.
+	consumed := 0
+	for {
+		startupMessage, err := h.backend.ReceiveStartupMessage()
+		if err == io.EOF {
+			// Receiving EOF means that the connection has terminated, so we should just return
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("error receiving startup message: %w", err)
+		}
+
+		switch sm := startupMessage.(type) {
+		case *pgproto3.StartupMessage:
+			if err = h.handleAuthentication(sm); err != nil {
+				return false, err
+			}
+			if err = h.markPostgresSuperuser(); err != nil {
+				return false, err
+			}
+			if err = h.sendClientStartupMessages(); err != nil {
+				return false, err
+			}
+			if err = h.chooseInitialDatabase(sm); err != nil {
+				return false, err
+			}
+			return true, h.send(&pgproto3.ReadyForQuery{
+				TxStatus: byte(ReadyForQueryTransactionIndicator_Idle),
+			})
+		case *pgproto3.SSLRequest:
+			// libpq falls back to an SSLRequest after a rejected GSSENCRequest,
+			// but the SSL negotiation can only happen once.
+			if sslDone {
+				return false, fmt.Errorf("terminating connection: SSL negotiation has already been performed")
+			}
+			sslDone = true
+			consumed += negotiationRequestSize
+			performSSL := []byte("N")
+			if hasCertificate() {
+				// The TLS handshake must not be preceded by data that the client sent before receiving our response.
+				if h.startupReader.n > consumed {
+					return false, errUnencryptedDataAfterSSLRequest
+				}
+				performSSL = []byte("S")
+			}
+			if _, err = h.Conn().Write(performSSL); err != nil {
+				return false, fmt.Errorf("error sending SSL request: %w", err)
+			}
+			// If we have a certificate and the client has asked for SSL support, then we switch here.
+			// This involves swapping out our underlying net connection for a new one.
+			// We can't start in SSL mode, as the client does not attempt the handshake until after our response.
+			if hasCertificate() {
+				h.setConn(tls.Server(h.Conn(), newTLSConfig()))
+				consumed = 0
+			}
+		case *pgproto3.GSSEncRequest:
+			// The GSSENCRequest must come before the SSL negotiation, and must not be sent over TLS.
+			if sslDone {
+				return false, fmt.Errorf("terminating connection: GSSAPI encryption requested after SSL negotiation")
+			}
+			consumed += negotiationRequestSize
+			// we don't support GSSAPI
+			if _, err = h.Conn().Write([]byte("N")); err != nil {
+				return false, fmt.Errorf("error sending response to GSS Enc Request: %w", err)
+			}
+		default:
+			return false, fmt.Errorf("terminating connection: unexpected start message: %#v", startupMessage)
 		}
-		return h.handleStartup()
-	default:
-		return false, fmt.Errorf("terminating connection: unexpected start message: %#v", startupMessage)
 	}
 }
 
@@ -282,20 +355,20 @@ func (h *ConnectionHandler) sendClientStartupMessages() error {
 	}
 
 	for _, param := range sessParams {
-		var value string
 		if param.Value != nil {
-			value = fmt.Sprintf("%v", param.Value)
-		} else {
-			_, v, ok := sql.SystemVariables.GetGlobal(param.Name)
-			if !ok {
-				return fmt.Errorf("error: %v variable was not found", param.Name)
+			if err := h.send(&pgproto3.ParameterStatus{
+				Name:  param.Name,
+				Value: fmt.Sprintf("%v", param.Value),
+			}); err != nil {
+				return err
 			}
-			value = fmt.Sprintf("%v", v)
+			continue
 		}
-		if err := h.send(&pgproto3.ParameterStatus{
-			Name:  param.Name,
-			Value: value,
-		}); err != nil {
+		_, v, ok := sql.SystemVariables.GetGlobal(param.Name)
+		if !ok {
+			return fmt.Errorf("error: %v variable was not found", param.Name)
+		}
+		if err := h.sendParameterStatus(param.Name, fmt.Sprintf("%v", v)); err != nil {
 			return err
 		}
 	}
@@ -306,35 +379,47 @@ func (h *ConnectionHandler) sendClientStartupMessages() error {
 }
 
 // chooseInitialDatabase attempts to choose the initial database for the connection,
-// if one is specified in the startup message provided
+// if one is specified in the startup message provided.
+// Every attached DuckDB catalog is a database that can be connected to by name. The names "postgres"
+// and "mysql" refer to the default catalog, as do the connections that do not specify a database.
 func (h *ConnectionHandler) chooseInitialDatabase(startupMessage *pgproto3.StartupMessage) error {
 	db, ok := startupMessage.Parameters["database"]
 	dbSpecified := ok && len(db) > 0
 	if !dbSpecified {
 		db = h.mysqlConn.User
 	}
+	provider := h.duckHandler.GetCatalogProvider()
+	if provider == nil {
+		return nil
+	}
 	if db == "postgres" || db == "mysql" {
-		if provider := h.duckHandler.GetCatalogProvider(); provider != nil {
-			db = provider.DefaultCatalogName()
-		}
+		db = provider.DefaultCatalogName()
 	}
 
-	useStmt := fmt.Sprintf("USE %s.public;", db)
-	setStmt := fmt.Sprintf("SET database TO %s;", db)
-	parsed, err := parser.ParseOne(setStmt)
-	if err != nil {
-		return err
+	catalogName, schemaName, found, err := provider.LookupCatalog(db)
+	if err == nil && !found {
+		err = newPgError("3D000", `database "%s" does not exist`, db)
+	}
+	if err == nil {
+		err = h.useDatabase(catalogName, schemaName)
 	}
-	err = h.duckHandler.ComQuery(context.Background(), h.mysqlConn, useStmt, parsed.AST, func(res *Result) error {
-		return nil
-	})
 	// If a database isn't specified, then we attempt to connect to a database with the same name as the user,
 	// ignoring any error
+	if catalog.ErrTenantConnectionLimit.Is(err) {
+		// The limit applies to the database named after the user as well.
+		dbSpecified = true
+	}
+	if err == nil {
+		h.duckHandler.startSession(catalogName)
+	} else if !dbSpecified {
+		h.duckHandler.startSession(provider.DefaultCatalogName())
+	}
 	if err != nil && dbSpecified {
+		code, message := errorCodeAndMessage(err)
 		_ = h.send(&pgproto3.ErrorResponse{
 			Severity: string(ErrorResponseSeverity_Fatal),
-			Code:     "3D000",
-			Message:  fmt.Sprintf(`"database "%s" does not exist, err: %v"`, db, err),
+			Code:     code,
+			Message:  message,
 			Routine:  "InitPostgres",
 		})
 		return err
@@ -377,6 +462,8 @@ func (h *ConnectionHandler) receiveMessage() (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("error receiving message: %w", err)
 	}
+	h.startHandlingMessage()
+	defer h.finishHandlingMessage()
 
 	if m, ok := msg.(json.Marshaler); ok && logrus.IsLevelEnabled(logrus.DebugLevel) {
 		msgInfo, err := m.MarshalJSON()
@@ -387,16 +474,24 @@ func (h *ConnectionHandler) receiveMessage() (bool, error) {
 	} else {
 		logrus.Debugf("Received message: %t", msg)
 	}
+	h.traceMessage("received", msg)
 
 	var stop bool
+	start := time.Now()
 	stop, endOfMessages, err = h.handleMessage(msg)
+	h.traceMessageHandled(msg, start, err)
 	if err != nil {
 		if !endOfMessages && h.waitForSync {
+			// Same as Postgres, the error of an extended query is reported right away,
+			// and the rest of its messages are discarded until Sync, which is answered by ReadyForQuery.
+			h.sendError(err)
 			if syncErr := h.discardToSync(); syncErr != nil {
 				fmt.Println(syncErr.Error())
 			}
+			h.endOfMessages(nil)
+		} else {
+			h.endOfMessages(err)
 		}
-		h.endOfMessages(err)
 	} else if endOfMessages {
 		h.endOfMessages(nil)
 	}
@@ -416,6 +511,10 @@ func (h *ConnectionHandler) handleMessage(msg pgproto3.Message) (stop, endOfMess
 	case *pgproto3.Sync:
 		h.waitForSync = false
 		return false, true, nil
+	case *pgproto3.Flush:
+		// The responses are sent as soon as they are ready, see send, so there is nothing pending.
+		// Unlike Sync, Flush does not end the extended query, so no ReadyForQuery is sent.
+		return false, false, h.backend.Flush()
 	case *pgproto3.Query:
 		endOfMessages, err = h.handleQuery(message)
 		return false, endOfMessages, err
@@ -459,22 +558,29 @@ func (h *ConnectionHandler) handleQuery(message *pgproto3.Query) (endOfMessages
 		return true, nil
 	}
 
-	handled, err := h.handledPSQLCommands(message.String)
-	if handled || err != nil {
-		return true, err
-	}
+	// The special commands are not allowed in a failed transaction block either, see failedTxnStatement.
+	if !h.duckHandler.txnFailed {
+		start := time.Now()
+		handled, err := h.handledPSQLCommands(message.String)
+		if handled || err != nil {
+			h.traceExecution(message.String, tracePathInPlace, start, err)
+			return true, err
+		}
 
-	// TODO: Remove this once we support `SELECT * FROM function()` syntax
-	// Github issue: https://github.com/dolthub/doltgresql/issues/464
-	handled, err = h.handledWorkbenchCommands(message.String)
-	if handled || err != nil {
-		return true, err
+		// TODO: Remove this once we support `SELECT * FROM function()` syntax
+		// Github issue: https://github.com/dolthub/doltgresql/issues/464
+		handled, err = h.handledWorkbenchCommands(message.String)
+		if handled || err != nil {
+			h.traceExecution(message.String, tracePathInPlace, start, err)
+			return true, err
+		}
 	}
 
 	statements, err := h.convertQuery(message.String)
 	if err != nil {
 		return true, err
 	}
+	h.traceConverted(message.String, statements)
 
 	// A query message destroys the unnamed statement and the unnamed portal
 	h.deletePreparedStatement("")
@@ -482,27 +588,57 @@ func (h *ConnectionHandler) handleQuery(message *pgproto3.Query) (endOfMessages
 
 	for _, statement := range statements {
 		statement.IsExtendedQuery = false
-		// Certain statement types get handled directly by the handler instead of being passed to the engine
-		handled, endOfMessages, err = h.handleStatementOutsideEngine(statement)
-		if handled {
-			if err != nil {
-				h.logger.Warnf("Failed to handle statement %v outside engine: %v", statement, err)
-				return true, err
-			}
-		} else {
-			if err != nil {
-				h.logger.Warnf("Failed to handle statement %v outside engine: %v", statement, err)
-			}
-			endOfMessages, err = true, h.run(statement)
-			if err != nil {
-				return true, err
-			}
+		if endOfMessages, err = h.execStatement(statement); err != nil {
+			return true, err
 		}
 	}
 
 	return endOfMessages, nil
 }
 
+// execStatement executes a statement of a simple query and sends its results.
+// The response parameter |endOfMessages| is the same as the one of handleStatementOutsideEngine.
+func (h *ConnectionHandler) execStatement(statement ConvertedStatement) (endOfMessages bool, err error) {
+	replacement, err := h.failedTxnStatement(statement)
+	if err != nil {
+		return true, err
+	}
+	if replacement != nil {
+		statement = *replacement
+	}
+	if err := h.checkWritable(statement); err != nil {
+		return true, err
+	}
+	if err := h.checkTenantAccess(statement); err != nil {
+		return true, err
+	}
+	if err := h.checkProtectedTableWrite(statement); err != nil {
+		return true, err
+	}
+	// Certain statement types get handled directly by the handler instead of being passed to the engine
+	var handled bool
+	start := time.Now()
+	handled, endOfMessages, err = h.handleStatementOutsideEngine(statement)
+	if handled {
+		h.traceExecution(statement.String, tracePathInPlace, start, err)
+		if err != nil {
+			h.logger.Warnf("Failed to handle statement %v outside engine: %v", statement, err)
+			return true, err
+		}
+		return endOfMessages, nil
+	}
+	if err != nil {
+		h.logger.Warnf("Failed to handle statement %v outside engine: %v", statement, err)
+	}
+	if err := h.applyRowSecurity(&statement); err != nil {
+		return true, err
+	}
+	start = time.Now()
+	err = h.run(statement)
+	h.traceExecution(statement.String, tracePathEngine, start, err)
+	return true, err
+}
+
 // handleStatementOutsideEngine handles any queries that should be handled by the handler directly, rather than being
 // passed to the engine. The response parameter |handled| is true if the query was handled, |endOfMessages| is true
 // if no more messages are expected for this query and server should send the client a READY FOR QUERY message,
@@ -513,7 +649,7 @@ func (h *ConnectionHandler) handleStatementOutsideEngine(statement ConvertedStat
 		// TODO: handle ALL keyword
 		return true, true, h.deallocatePreparedStatement(stmt.Name.String(), h.preparedStatements, statement, h.Conn())
 	case *tree.Discard:
-		return true, true, h.discardAll(statement)
+		return true, true, h.discard(statement, stmt.Mode)
 	case *tree.CopyFrom:
 		// When copying data from STDIN, the data is sent to the server as CopyData messages
 		// We send endOfMessages=false since the server will be in COPY DATA mode and won't
@@ -526,6 +662,9 @@ func (h *ConnectionHandler) handleStatementOutsideEngine(statement ConvertedStat
 	}
 
 	if statement.Tag == "COPY" {
+		if backend.IsExportStatement(statement.String) {
+			return true, true, h.handleExport(statement)
+		}
 		if target, format, options, ok := ParseCopyFrom(statement.String); ok {
 			stmt, err := parser.ParseOne("COPY " + target + " FROM STDIN")
 			if err != nil {
@@ -563,15 +702,28 @@ func (h *ConnectionHandler) handleStatementOutsideEngine(statement ConvertedStat
 func (h *ConnectionHandler) handleParse(message *pgproto3.Parse) error {
 	h.waitForSync = true
 
-	// TODO: "Named prepared statements must be explicitly closed before they can be redefined by another Parse message, but this is not required for the unnamed statement"
+	// Named prepared statements must be explicitly closed before they can be redefined by another Parse message,
+	// but this is not required for the unnamed statement.
+	if message.Name != "" {
+		if _, ok := h.preparedStatements[message.Name]; ok {
+			return newPgError("42P05", `prepared statement "%s" already exists`, message.Name)
+		}
+	} else {
+		h.deletePreparedStatement("")
+	}
+
 	statements, err := h.convertQuery(message.Query)
 	if err != nil {
 		return err
 	}
+	h.traceConverted(message.Query, statements)
 
 	// TODO(Noy): handle multiple statements
 	statement := statements[0]
 	statement.IsExtendedQuery = true
+	if _, err := h.failedTxnStatement(statement); err != nil {
+		return err
+	}
 	if statement.AST == nil && strings.TrimSpace(statement.String) == "" {
 		// special case: empty query
 		h.preparedStatements[message.Name] = PreparedStatementData{
@@ -595,7 +747,11 @@ func (h *ConnectionHandler) handleParse(message *pgproto3.Parse) error {
 		return h.send(&pgproto3.ParseComplete{})
 	}
 
-	stmt, params, fields, err := h.duckHandler.ComPrepareParsed(context.Background(), h.mysqlConn, statement.String, statement.AST)
+	if err := h.applyRowSecurity(&statement); err != nil {
+		return err
+	}
+
+	stmt, bindVarTypes, fields, err := h.duckHandler.ComPrepareParsed(context.Background(), h.mysqlConn, statement.String, statement.AST, message.ParameterOIDs)
 	if err != nil {
 		return err
 	}
@@ -604,23 +760,6 @@ func (h *ConnectionHandler) handleParse(message *pgproto3.Parse) error {
 		statement.Tag = GetStatementTag(stmt)
 	}
 
-	// https://www.postgresql.org/docs/current/protocol-flow.html#PROTOCOL-FLOW-EXT-QUERY
-	// > A parameter data type can be left unspecified by setting it to zero,
-	// > or by making the array of parameter type OIDs shorter than the number of
-	// > parameter symbols ($n)used in the query string.
-	// > ...
-	// > Parameter data types can be specified by OID;
-	// > if not given, the parser attempts to infer the data types in the same way
-	// > as it would do for untyped literal string constants.
-	bindVarTypes := message.ParameterOIDs
-	if len(bindVarTypes) < len(params) {
-		bindVarTypes = append(bindVarTypes, params[len(bindVarTypes):]...)
-	}
-	for i := range params {
-		if bindVarTypes[i] == 0 {
-			bindVarTypes[i] = params[i]
-		}
-	}
 	h.preparedStatements[message.Name] = PreparedStatementData{
 		Statement:    statement,
 		ReturnFields: fields,
@@ -642,7 +781,7 @@ func (h *ConnectionHandler) handleDescribe(message *pgproto3.Describe) error {
 	if message.ObjectType == 'S' {
 		preparedStatementData, ok := h.preparedStatements[message.Name]
 		if !ok {
-			return fmt.Errorf("prepared statement %s does not exist", message.Name)
+			return newPgError("26000", `prepared statement "%s" does not exist`, message.Name)
 		}
 
 		// https://www.postgresql.org/docs/current/protocol-flow.html
@@ -664,7 +803,7 @@ func (h *ConnectionHandler) handleDescribe(message *pgproto3.Describe) error {
 	} else {
 		portalData, ok := h.portals[message.Name]
 		if !ok {
-			return fmt.Errorf("portal %s does not exist", message.Name)
+			return newPgError("34000", `portal "%s" does not exist`, message.Name)
 		}
 
 		if portalData.Stmt != nil {
@@ -684,12 +823,18 @@ func (h *ConnectionHandler) handleDescribe(message *pgproto3.Describe) error {
 func (h *ConnectionHandler) handleBind(message *pgproto3.Bind) error {
 	h.waitForSync = true
 
-	// TODO: a named portal object lasts till the end of the current transaction, unless explicitly destroyed
-	//  we need to destroy the named portal as a side effect of the transaction ending
+	// A named portal lasts till the end of the current transaction unless explicitly destroyed,
+	// while the unnamed portal is replaced by the next Bind. See endOfMessages.
 	logrus.Tracef("binding portal %q to prepared statement %s", message.DestinationPortal, message.PreparedStatement)
+	if _, ok := h.portals[message.DestinationPortal]; ok && message.DestinationPortal != "" {
+		return newPgError("42P03", `portal "%s" already exists`, message.DestinationPortal)
+	}
 	preparedData, ok := h.preparedStatements[message.PreparedStatement]
 	if !ok {
-		return fmt.Errorf("prepared statement %s does not exist", message.PreparedStatement)
+		return newPgError("26000", `prepared statement "%s" does not exist`, message.PreparedStatement)
+	}
+	if _, err := h.failedTxnStatement(preparedData.Statement); err != nil {
+		return err
 	}
 
 	if preparedData.Stmt == nil {
@@ -699,6 +844,7 @@ func (h *ConnectionHandler) handleBind(message *pgproto3.Bind) error {
 			Fields:       nil,
 			Stmt:         nil,
 			Vars:         nil,
+			Closed:       preparedData.Closed,
 		}
 		return h.send(&pgproto3.BindComplete{})
 	}
@@ -721,6 +867,12 @@ func (h *ConnectionHandler) handleBind(message *pgproto3.Bind) error {
 	if err != nil {
 		return err
 	}
+	if returnsRow(preparedData.Statement.Tag) {
+		if err := checkResultFormats(message.ResultFormatCodes, len(fields)); err != nil {
+			return err
+		}
+		fields = withResultFormats(fields, message.ResultFormatCodes)
+	}
 
 	h.portals[message.DestinationPortal] = PortalData{
 		Statement:         preparedData.Statement,
@@ -740,7 +892,7 @@ func (h *ConnectionHandler) handleExecute(message *pgproto3.Execute) error {
 	// TODO: implement the RowMax
 	portalData, ok := h.portals[message.Portal]
 	if !ok {
-		return fmt.Errorf("portal %s does not exist", message.Portal)
+		return newPgError("34000", `portal "%s" does not exist`, message.Portal)
 	}
 
 	logrus.Tracef("executing portal %s with contents %v", message.Portal, portalData)
@@ -754,10 +906,39 @@ func (h *ConnectionHandler) handleExecute(message *pgproto3.Execute) error {
 		return h.send(&pgproto3.EmptyQueryResponse{})
 	}
 
+	if replacement, err := h.failedTxnStatement(query); err != nil {
+		return err
+	} else if replacement != nil {
+		return h.run(*replacement)
+	}
+	if err := h.checkWritable(query); err != nil {
+		return err
+	}
+	if err := h.checkTenantAccess(query); err != nil {
+		return err
+	}
+	if err := h.checkProtectedTableWrite(query); err != nil {
+		return err
+	}
+
 	// Certain statement types get handled directly by the handler instead of being passed to the engine
+	start := time.Now()
 	if strings.ToUpper(query.Tag) != "SELECT" || portalData.Stmt == nil {
 		handled, _, err := h.handleStatementOutsideEngine(query)
 		if handled {
+			h.traceExecution(query.String, tracePathInPlace, start, err)
+			return err
+		}
+	}
+
+	if strings.Contains(query.String, pgSettingsView) {
+		// The view must reflect the settings when the query is executed, not when it is prepared.
+		if err := h.createPgSettingsView(); err != nil {
+			return err
+		}
+	}
+	if strings.Contains(query.String, pgStatDatabaseView) {
+		if err := h.createPgStatDatabaseView(); err != nil {
 			return err
 		}
 	}
@@ -766,10 +947,16 @@ func (h *ConnectionHandler) handleExecute(message *pgproto3.Execute) error {
 	rowsAffected := int32(0)
 
 	callback := h.spoolRowsCallback(query, &rowsAffected, true)
-	err := h.duckHandler.ComExecuteBound(context.Background(), h.mysqlConn, portalData, callback)
+	err := h.runDDL(query, func() error {
+		return h.duckHandler.ComExecuteBound(context.Background(), h.mysqlConn, portalData, callback)
+	})
+	h.traceExecution(query.String, tracePathDuckDB, start, err)
 	if err != nil {
 		return err
 	}
+	if err := h.recordQueryInfo(query.Tag, rowsAffected); err != nil {
+		return err
+	}
 
 	return h.send(makeCommandComplete(query.Tag, rowsAffected))
 }
@@ -793,6 +980,11 @@ func makeCommandComplete(tag string, rows int32) *pgproto3.CommandComplete {
 // messages are expected, and the server should tell the client that it is ready for the next query, and |err| contains
 // any error that occurred while processing the COPY DATA message.
 func (h *ConnectionHandler) handleCopyData(message *pgproto3.CopyData) (stop bool, endOfMessages bool, err error) {
+	if h.copyFromStdinState == nil {
+		// Like PostgreSQL, ignore the data that a client sends after the COPY FROM STDIN query has failed,
+		// before it receives the error.
+		return false, false, nil
+	}
 	helper, messages, err := h.handleCopyDataHelper(message)
 	if err != nil {
 		h.copyFromStdinState.copyErr = err
@@ -824,6 +1016,7 @@ func (h *ConnectionHandler) handleCopyDataHelper(message *pgproto3.CopyData) (st
 			return false, true, fmt.Errorf("no target table found")
 		}
 		rawOptions := h.copyFromStdinState.rawOptions
+		textOptions := h.copyFromStdinState.textOptions
 
 		switch copyFrom.Options.CopyFormat {
 		case CopyFormatArrow:
@@ -832,20 +1025,29 @@ func (h *ConnectionHandler) handleCopyDataHelper(message *pgproto3.CopyData) (st
 				copyFrom.Table.Schema(), table, copyFrom.Columns,
 				rawOptions,
 			)
-		case tree.CopyFormatText:
-			// Remove `\.` from the end of the message data, if it exists
-			if bytes.HasSuffix(message.Data, []byte{'\\', '.', '\n'}) {
-				message.Data = message.Data[:len(message.Data)-3]
-			}
-			if bytes.HasSuffix(message.Data, []byte{'\\', '.', '\r', '\n'}) {
-				message.Data = message.Data[:len(message.Data)-4]
+		case tree.CopyFormatText, tree.CopyFormatCSV:
+			if rawOptions == "" {
+				// The records are parsed by us, and appended directly if enabled and the column types allow it,
+				// or parsed in parallel and inserted through SQL otherwise.
+				dataLoader, err = NewAppenderDataLoader(
+					sqlCtx, h.duckHandler,
+					copyFrom.Table.Schema(), table, copyFrom.Columns,
+					&copyFrom.Options, textOptions,
+				)
+				if errors.Is(err, errAppenderUnsupported) {
+					dataLoader, err = NewParallelCsvDataLoader(
+						sqlCtx, h.duckHandler,
+						copyFrom.Table.Schema(), table, copyFrom.Columns,
+						&copyFrom.Options, textOptions,
+					)
+				}
+				break
 			}
-			fallthrough
-		case tree.CopyFormatCSV:
+			// Non-PG-parsable options are passed to DuckDB's CSV reader.
 			dataLoader, err = NewCsvDataLoader(
 				sqlCtx, h.duckHandler,
 				copyFrom.Table.Schema(), table, copyFrom.Columns,
-				&copyFrom.Options,
+				&copyFrom.Options, textOptions,
 				rawOptions,
 			)
 		case tree.CopyFormatBinary:
@@ -881,8 +1083,8 @@ func (h *ConnectionHandler) handleCopyDataHelper(message *pgproto3.CopyData) (st
 // ready for the next query, and |err| contains any error that occurred while processing the COPY DATA message.
 func (h *ConnectionHandler) handleCopyDone(_ *pgproto3.CopyDone) (stop bool, endOfMessages bool, err error) {
 	if h.copyFromStdinState == nil {
-		return false, true,
-			fmt.Errorf("COPY DONE message received without a COPY FROM STDIN operation in progress")
+		// Ignored outside of COPY FROM STDIN, as CopyData is.
+		return false, false, nil
 	}
 
 	// If there was a previous error returned from processing a CopyData message, then don't return an error here
@@ -890,6 +1092,7 @@ func (h *ConnectionHandler) handleCopyDone(_ *pgproto3.CopyDone) (stop bool, end
 	// endOfMessage=true here, then the client gets confused about the unexpected/extra Idle message since the
 	// server has already reported it was idle in the last message after the returned error.
 	if h.copyFromStdinState.copyErr != nil {
+		h.abortCopy()
 		return false, false, nil
 	}
 
@@ -904,12 +1107,17 @@ func (h *ConnectionHandler) handleCopyDone(_ *pgproto3.CopyDone) (stop bool, end
 		return false, false, err
 	}
 
+	// The data loader is done with, whether it succeeds or not.
+	copyFrom := h.copyFromStdinState.copyFromStdinNode
+	h.copyFromStdinState = nil
 	loadDataResults, err := dataLoader.Finish(sqlCtx)
 	if err != nil {
 		return false, false, err
 	}
+	if err := markFTSIndexesStale(sqlCtx, copyFrom); err != nil {
+		return false, false, err
+	}
 
-	h.copyFromStdinState = nil
 	// We send back endOfMessage=true, since the COPY DONE message ends the COPY DATA flow and the server is ready
 	// to accept the next query now.
 	return false, true, h.send(&pgproto3.CommandComplete{
@@ -923,26 +1131,46 @@ func (h *ConnectionHandler) handleCopyDone(_ *pgproto3.CopyDone) (stop bool, end
 // |err| contains any error that occurred while processing the COPY DATA message.
 func (h *ConnectionHandler) handleCopyFail(_ *pgproto3.CopyFail) (stop bool, endOfMessages bool, err error) {
 	if h.copyFromStdinState == nil {
-		return false, true,
-			fmt.Errorf("COPY FAIL message received without a COPY FROM STDIN operation in progress")
+		// Ignored outside of COPY FROM STDIN, as CopyData is.
+		return false, false, nil
 	}
 
-	dataLoader := h.copyFromStdinState.dataLoader
-	if dataLoader == nil {
+	if h.copyFromStdinState.dataLoader == nil {
+		h.copyFromStdinState = nil
 		return false, true,
 			fmt.Errorf("no data loader found for COPY FROM STDIN operation")
 	}
 
-	h.copyFromStdinState = nil
+	h.abortCopy()
 	// We send back endOfMessage=true, since the COPY FAIL message ends the COPY DATA flow and the server is ready
 	// to accept the next query now.
 	return false, true, nil
 }
 
+// abortCopy aborts the in-progress COPY FROM STDIN operation, if any, and discards the loaded data.
+func (h *ConnectionHandler) abortCopy() {
+	if h.copyFromStdinState == nil {
+		return
+	}
+	dataLoader := h.copyFromStdinState.dataLoader
+	h.copyFromStdinState = nil
+	if dataLoader == nil {
+		return
+	}
+	sqlCtx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to create context for aborting COPY operation")
+		return
+	}
+	if err := dataLoader.Abort(sqlCtx); err != nil {
+		h.logger.WithError(err).Warn("Failed to abort COPY operation")
+	}
+}
+
 func (h *ConnectionHandler) deallocatePreparedStatement(name string, preparedStatements map[string]PreparedStatementData, query ConvertedStatement, conn net.Conn) error {
 	_, ok := preparedStatements[name]
 	if !ok {
-		return fmt.Errorf("prepared statement %s does not exist", name)
+		return newPgError("26000", `prepared statement "%s" does not exist`, name)
 	}
 	h.deletePreparedStatement(name)
 
@@ -951,43 +1179,57 @@ func (h *ConnectionHandler) deallocatePreparedStatement(name string, preparedSta
 	})
 }
 
+// deletePreparedStatement closes the prepared statement and the portals constructed from it,
+// which share its underlying statement.
 func (h *ConnectionHandler) deletePreparedStatement(name string) {
 	ps, ok := h.preparedStatements[name]
-	if ok {
-		delete(h.preparedStatements, name)
-		if ps.Closed.CompareAndSwap(false, true) {
-			ps.Stmt.Close()
+	if !ok {
+		return
+	}
+	delete(h.preparedStatements, name)
+	if ps.Closed == nil {
+		return
+	}
+	for portal, p := range h.portals {
+		if p.Closed == ps.Closed {
+			delete(h.portals, portal)
 		}
 	}
+	if ps.Stmt != nil && ps.Closed.CompareAndSwap(false, true) {
+		ps.Stmt.Close()
+	}
 }
 
+// deletePortal closes the portal. The underlying statement is owned by the prepared statement.
 func (h *ConnectionHandler) deletePortal(name string) {
-	p, ok := h.portals[name]
-	if ok {
-		delete(h.portals, name)
-		if p.Closed.CompareAndSwap(false, true) {
-			p.Stmt.Close()
-		}
-	}
+	delete(h.portals, name)
 }
 
-// convertBindParameters handles the conversion from bind parameters to variable values.
+// convertBindParameters decodes the bind parameters into values of the Go types that match their type OIDs,
+// so that they are bound to the DuckDB prepared statement as typed values rather than strings.
 func (h *ConnectionHandler) convertBindParameters(types []uint32, formatCodes []int16, values [][]byte) ([]any, error) {
 	if len(types) != len(values) {
-		return nil, fmt.Errorf("number of values does not match number of parameters")
+		return nil, newPgError("08P01", "bind message supplies %d parameters, but prepared statement requires %d", len(values), len(types))
+	}
+	if len(formatCodes) > 1 && len(formatCodes) != len(values) {
+		return nil, newPgError("08P01", "bind message has %d parameter formats but %d parameters", len(formatCodes), len(values))
 	}
-	bindings := make([]pgtype.Text, len(values))
+	vars := make([]any, len(values))
 	for i := range values {
-		typ := types[i]
-		// We'll rely on a library to decode each format, which will deal with text and binary representations for us
-		if err := h.pgTypeMap.Scan(typ, formatCodes[i], values[i], &bindings[i]); err != nil {
-			return nil, err
+		// No format codes means text for all parameters, and a single format code applies to all of them.
+		format := int16(pgtype.TextFormatCode)
+		switch len(formatCodes) {
+		case 0:
+		case 1:
+			format = formatCodes[0]
+		default:
+			format = formatCodes[i]
 		}
-	}
-
-	vars := make([]any, len(bindings))
-	for i, b := range bindings {
-		vars[i] = b.String
+		v, err := pgtypes.DecodeParameter(h.pgTypeMap, types[i], format, values[i])
+		if err != nil {
+			return nil, newPgError("22P02", "invalid value for parameter $%d: %v", i+1, err)
+		}
+		vars[i] = v
 	}
 	return vars, nil
 }
@@ -1009,36 +1251,25 @@ func (h *ConnectionHandler) run(statement ConvertedStatement) error {
 		statement.Tag = tag
 	}
 
-	if statement.SubscriptionConfig != nil {
-		return h.executeSubscriptionSQL(statement.SubscriptionConfig)
-	} else if statement.BackupConfig != nil {
-		msg, err := h.executeBackup(statement.BackupConfig)
-		if err != nil {
-			return err
-		}
-		return h.send(&pgproto3.ErrorResponse{
-			Message: msg,
-		})
-	} else if statement.RestoreConfig != nil {
-		msg, err := h.executeRestore(statement.RestoreConfig)
-		if err != nil {
-			return err
-		}
-		return h.send(&pgproto3.ErrorResponse{
-			Message: msg,
-		})
+	if statement.SubscriptionConfig != nil || statement.BackupConfig != nil || statement.RestoreConfig != nil {
+		return h.runAdminStatement(statement)
 	}
 
 	callback := h.spoolRowsCallback(statement, &rowsAffected, false)
-	if err := h.duckHandler.ComQuery(
-		context.Background(),
-		h.mysqlConn,
-		statement.String,
-		statement.AST,
-		callback,
-	); err != nil {
+	if err := h.runDDL(statement, func() error {
+		return h.duckHandler.ComQuery(
+			context.Background(),
+			h.mysqlConn,
+			statement.String,
+			statement.AST,
+			callback,
+		)
+	}); err != nil {
 		return fmt.Errorf("fallback statement execution failed: %w", err)
 	}
+	if err := h.recordQueryInfo(statement.Tag, rowsAffected); err != nil {
+		return err
+	}
 
 	return h.send(makeCommandComplete(statement.Tag, rowsAffected))
 }
@@ -1106,99 +1337,80 @@ func (h *ConnectionHandler) sendDescribeResponse(fields []pgproto3.FieldDescript
 }
 
 // handledPSQLCommands handles the special PSQL commands, such as \l and \dt.
+// The commands are recognized by the shapes of their catalog queries; see recognizePsqlQuery.
 func (h *ConnectionHandler) handledPSQLCommands(statement string) (bool, error) {
-	statement = strings.ToLower(statement)
-	// Command: \l
-	if statement == "select d.datname as \"name\",\n       pg_catalog.pg_get_userbyid(d.datdba) as \"owner\",\n       pg_catalog.pg_encoding_to_char(d.encoding) as \"encoding\",\n       d.datcollate as \"collate\",\n       d.datctype as \"ctype\",\n       d.daticulocale as \"icu locale\",\n       case d.datlocprovider when 'c' then 'libc' when 'i' then 'icu' end as \"locale provider\",\n       pg_catalog.array_to_string(d.datacl, e'\\n') as \"access privileges\"\nfrom pg_catalog.pg_database d\norder by 1;" {
-		query, err := h.convertQuery(`select d.datname as "Name", 'postgres' as "Owner", 'UTF8' as "Encoding", 'en_US.UTF-8' as "Collate", 'en_US.UTF-8' as "Ctype", 'en-US' as "ICU Locale", case d.datlocprovider when 'c' then 'libc' when 'i' then 'icu' end as "locale provider", '' as "access privileges" from pg_catalog.pg_database d order by 1;`)
-		if err != nil {
-			return false, err
-		}
-		return true, h.run(query[0])
+	q, ok := recognizePsqlQuery(statement)
+	if !ok {
+		return false, nil
 	}
-	// Command: \l on psql 16
-	if statement == "select\n  d.datname as \"name\",\n  pg_catalog.pg_get_userbyid(d.datdba) as \"owner\",\n  pg_catalog.pg_encoding_to_char(d.encoding) as \"encoding\",\n  case d.datlocprovider when 'c' then 'libc' when 'i' then 'icu' end as \"locale provider\",\n  d.datcollate as \"collate\",\n  d.datctype as \"ctype\",\n  d.daticulocale as \"icu locale\",\n  null as \"icu rules\",\n  pg_catalog.array_to_string(d.datacl, e'\\n') as \"access privileges\"\nfrom pg_catalog.pg_database d\norder by 1;" {
-		query, err := h.convertQuery(`select d.datname as "Name", 'postgres' as "Owner", 'UTF8' as "Encoding", 'en_US.UTF-8' as "Collate", 'en_US.UTF-8' as "Ctype", 'en-US' as "ICU Locale", case d.datlocprovider when 'c' then 'libc' when 'i' then 'icu' end as "locale provider", '' as "access privileges" from pg_catalog.pg_database d order by 1;`)
+	switch q.Command {
+	case psqlListDatabases:
+		query, err := h.convertQuery(q.replacementQuery())
 		if err != nil {
 			return false, err
 		}
 		return true, h.run(query[0])
-	}
-	// Command: \dt
-	if statement == "select n.nspname as \"schema\",\n  c.relname as \"name\",\n  case c.relkind when 'r' then 'table' when 'v' then 'view' when 'm' then 'materialized view' when 'i' then 'index' when 's' then 'sequence' when 't' then 'toast table' when 'f' then 'foreign table' when 'p' then 'partitioned table' when 'i' then 'partitioned index' end as \"type\",\n  pg_catalog.pg_get_userbyid(c.relowner) as \"owner\"\nfrom pg_catalog.pg_class c\n     left join pg_catalog.pg_namespace n on n.oid = c.relnamespace\n     left join pg_catalog.pg_am am on am.oid = c.relam\nwhere c.relkind in ('r','p','')\n      and n.nspname <> 'pg_catalog'\n      and n.nspname !~ '^pg_toast'\n      and n.nspname <> 'information_schema'\n  and pg_catalog.pg_table_is_visible(c.oid)\norder by 1,2;" {
-		return true, h.run(ConvertedStatement{
-			String: `SELECT table_schema AS "Schema", TABLE_NAME AS "Name", 'table' AS "Type", 'postgres' AS "Owner" FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA <> 'pg_catalog' AND TABLE_SCHEMA <> 'information_schema' AND TABLE_TYPE = 'BASE TABLE' ORDER BY 2;`,
-			Tag:    "SELECT",
-		})
-	}
-	// Command: \d
-	if statement == "select n.nspname as \"schema\",\n  c.relname as \"name\",\n  case c.relkind when 'r' then 'table' when 'v' then 'view' when 'm' then 'materialized view' when 'i' then 'index' when 's' then 'sequence' when 't' then 'toast table' when 'f' then 'foreign table' when 'p' then 'partitioned table' when 'i' then 'partitioned index' end as \"type\",\n  pg_catalog.pg_get_userbyid(c.relowner) as \"owner\"\nfrom pg_catalog.pg_class c\n     left join pg_catalog.pg_namespace n on n.oid = c.relnamespace\n     left join pg_catalog.pg_am am on am.oid = c.relam\nwhere c.relkind in ('r','p','v','m','s','f','')\n      and n.nspname <> 'pg_catalog'\n      and n.nspname !~ '^pg_toast'\n      and n.nspname <> 'information_schema'\n  and pg_catalog.pg_table_is_visible(c.oid)\norder by 1,2;" {
-		return true, h.run(ConvertedStatement{
-			String: `SELECT table_schema AS "Schema", TABLE_NAME AS "Name", IF(TABLE_TYPE = 'VIEW', 'view', 'table') AS "Type", 'postgres' AS "Owner" FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA <> 'pg_catalog' AND TABLE_SCHEMA <> 'information_schema' AND TABLE_TYPE = 'BASE TABLE' OR TABLE_TYPE = 'VIEW' ORDER BY 2;`,
-			Tag:    "SELECT",
-		})
-	}
-	// Alternate \d for psql 14
-	if statement == "select n.nspname as \"schema\",\n  c.relname as \"name\",\n  case c.relkind when 'r' then 'table' when 'v' then 'view' when 'm' then 'materialized view' when 'i' then 'index' when 's' then 'sequence' when 's' then 'special' when 't' then 'toast table' when 'f' then 'foreign table' when 'p' then 'partitioned table' when 'i' then 'partitioned index' end as \"type\",\n  pg_catalog.pg_get_userbyid(c.relowner) as \"owner\"\nfrom pg_catalog.pg_class c\n     left join pg_catalog.pg_namespace n on n.oid = c.relnamespace\n     left join pg_catalog.pg_am am on am.oid = c.relam\nwhere c.relkind in ('r','p','v','m','s','f','')\n      and n.nspname <> 'pg_catalog'\n      and n.nspname !~ '^pg_toast'\n      and n.nspname <> 'information_schema'\n  and pg_catalog.pg_table_is_visible(c.oid)\norder by 1,2;" {
-		return true, h.run(ConvertedStatement{
-			String: `SELECT table_schema AS "Schema", TABLE_NAME AS "Name", IF(TABLE_TYPE = 'VIEW', 'view', 'table') AS "Type", 'postgres' AS "Owner" FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA <> 'pg_catalog' AND TABLE_SCHEMA <> 'information_schema' AND TABLE_TYPE = 'BASE TABLE' OR TABLE_TYPE = 'VIEW' ORDER BY 2;`,
-			Tag:    "SELECT",
-		})
-	}
-	// Command: \d table_name
-	if strings.HasPrefix(statement, "select c.oid,\n  n.nspname,\n  c.relname\nfrom pg_catalog.pg_class c\n     left join pg_catalog.pg_namespace n on n.oid = c.relnamespace\nwhere c.relname operator(pg_catalog.~) '^(") && strings.HasSuffix(statement, ")$' collate pg_catalog.default\n  and pg_catalog.pg_table_is_visible(c.oid)\norder by 2, 3;") {
-		// There are >at least< 15 separate statements sent for this command, which is far too much to validate and
-		// implement, so we'll just return an error for now
-		return true, fmt.Errorf("PSQL command not yet supported")
-	}
-	// Command: \dn
-	if statement == "select n.nspname as \"name\",\n  pg_catalog.pg_get_userbyid(n.nspowner) as \"owner\"\nfrom pg_catalog.pg_namespace n\nwhere n.nspname !~ '^pg_' and n.nspname <> 'information_schema'\norder by 1;" {
-		return true, h.run(ConvertedStatement{
-			String: `SELECT 'public' AS "Name", 'pg_database_owner' AS "Owner";`,
-			Tag:    "SELECT",
-		})
-	}
-	// Command: \df
-	if statement == "select n.nspname as \"schema\",\n  p.proname as \"name\",\n  pg_catalog.pg_get_function_result(p.oid) as \"result data type\",\n  pg_catalog.pg_get_function_arguments(p.oid) as \"argument data types\",\n case p.prokind\n  when 'a' then 'agg'\n  when 'w' then 'window'\n  when 'p' then 'proc'\n  else 'func'\n end as \"type\"\nfrom pg_catalog.pg_proc p\n     left join pg_catalog.pg_namespace n on n.oid = p.pronamespace\nwhere pg_catalog.pg_function_is_visible(p.oid)\n      and n.nspname <> 'pg_catalog'\n      and n.nspname <> 'information_schema'\norder by 1, 2, 4;" {
-		return true, h.run(ConvertedStatement{
-			String: `SELECT '' AS "Schema", '' AS "Name", '' AS "Result data type", '' AS "Argument data types", '' AS "Type" LIMIT 0;`,
-			Tag:    "SELECT",
-		})
-	}
-	// Command: \dv
-	if statement == "select n.nspname as \"schema\",\n  c.relname as \"name\",\n  case c.relkind when 'r' then 'table' when 'v' then 'view' when 'm' then 'materialized view' when 'i' then 'index' when 's' then 'sequence' when 't' then 'toast table' when 'f' then 'foreign table' when 'p' then 'partitioned table' when 'i' then 'partitioned index' end as \"type\",\n  pg_catalog.pg_get_userbyid(c.relowner) as \"owner\"\nfrom pg_catalog.pg_class c\n     left join pg_catalog.pg_namespace n on n.oid = c.relnamespace\nwhere c.relkind in ('v','')\n      and n.nspname <> 'pg_catalog'\n      and n.nspname !~ '^pg_toast'\n      and n.nspname <> 'information_schema'\n  and pg_catalog.pg_table_is_visible(c.oid)\norder by 1,2;" {
-		return true, h.run(ConvertedStatement{
-			String: `SELECT table_schema AS "Schema", TABLE_NAME AS "Name", 'view' AS "Type", 'postgres' AS "Owner" FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA <> 'pg_catalog' AND TABLE_SCHEMA <> 'information_schema' AND TABLE_TYPE = 'VIEW' ORDER BY 2;`,
-			Tag:    "SELECT",
-		})
-	}
-	// Command: \du
-	if statement == "select r.rolname, r.rolsuper, r.rolinherit,\n  r.rolcreaterole, r.rolcreatedb, r.rolcanlogin,\n  r.rolconnlimit, r.rolvaliduntil,\n  array(select b.rolname\n        from pg_catalog.pg_auth_members m\n        join pg_catalog.pg_roles b on (m.roleid = b.oid)\n        where m.member = r.oid) as memberof\n, r.rolreplication\n, r.rolbypassrls\nfrom pg_catalog.pg_roles r\nwhere r.rolname !~ '^pg_'\norder by 1;" {
-		// We don't support users yet, so we'll just return nothing for now
+	default:
 		return true, h.run(ConvertedStatement{
-			String: `SELECT '' FROM dual LIMIT 0;`,
+			String: q.replacementQuery(),
 			Tag:    "SELECT",
 		})
 	}
-	return false, nil
 }
 
+// workbenchQueries are the queries sent by some workbenches, such as dolt-workbench, keyed by their lowercase text,
+// and their replacements.
+var workbenchQueries = map[string]string{
+	"select * from current_schema()":    `SELECT search_path AS "current_schema";`,
+	"select * from current_schema();":   `SELECT search_path AS "current_schema";`,
+	"select * from current_database()":  `SELECT DATABASE() AS "current_database";`,
+	"select * from current_database();": `SELECT DATABASE() AS "current_database";`,
+}
+
+// maxWorkbenchQueryLen is the length of the longest of workbenchQueries, beyond which a query is not looked up.
+var maxWorkbenchQueryLen = func() int {
+	n := 0
+	for query := range workbenchQueries {
+		n = max(n, len(query))
+	}
+	return n
+}()
+
 // handledWorkbenchCommands handles commands used by some workbenches, such as dolt-workbench.
 func (h *ConnectionHandler) handledWorkbenchCommands(statement string) (bool, error) {
-	lower := strings.ToLower(statement)
-	if lower == "select * from current_schema()" || lower == "select * from current_schema();" {
-		return true, h.run(ConvertedStatement{
-			String: `SELECT search_path AS "current_schema";`,
-			Tag:    "SELECT",
-		})
+	if len(statement) > maxWorkbenchQueryLen {
+		return false, nil
 	}
-	if lower == "select * from current_database()" || lower == "select * from current_database();" {
-		return true, h.run(ConvertedStatement{
-			String: `SELECT DATABASE() AS "current_database";`,
-			Tag:    "SELECT",
-		})
+	replacement, ok := workbenchQueries[strings.ToLower(statement)]
+	if !ok {
+		return false, nil
 	}
-	return false, nil
+	return true, h.run(ConvertedStatement{
+		String: replacement,
+		Tag:    "SELECT",
+	})
+}
+
+// failedTxnStatement checks the statement against the failed transaction block, if any.
+// Same as Postgres, only the statements that end the transaction block are allowed, and COMMIT rolls it back.
+// The returned statement, if any, should be run instead.
+func (h *ConnectionHandler) failedTxnStatement(statement ConvertedStatement) (*ConvertedStatement, error) {
+	if !h.duckHandler.txnFailed {
+		return nil, nil
+	}
+	switch statement.AST.(type) {
+	case *tree.RollbackTransaction:
+		return nil, nil
+	case *tree.CommitTransaction:
+		return &ConvertedStatement{
+			String:          "ROLLBACK",
+			AST:             &tree.RollbackTransaction{},
+			Tag:             "ROLLBACK",
+			PgParsable:      true,
+			IsExtendedQuery: statement.IsExtendedQuery,
+		}, nil
+	}
+	return nil, newPgError("25P02", "current transaction is aborted, commands ignored until end of transaction block")
 }
 
 // endOfMessages should be called from HandleConnection or a function within HandleConnection. This represents the end
@@ -1209,8 +1421,29 @@ func (h *ConnectionHandler) endOfMessages(err error) {
 	if err != nil {
 		h.sendError(err)
 	}
+	// Portals last until the end of the transaction.
+	if len(h.portals) > 0 && !h.duckHandler.inTxnBlock {
+		for name := range h.portals {
+			h.deletePortal(name)
+		}
+	}
+	if poolerMode {
+		if err := h.reportParameterChanges(); err != nil {
+			// The failure to report the parameters does not abort the transaction block;
+			// the changes are reported again at the end of the next query.
+			h.sendErrorResponse(err)
+		}
+	}
+	if !h.duckHandler.inTxnBlock {
+		h.cursors.mu.Lock()
+		sendErr := h.deliverSchemaChanges()
+		h.cursors.mu.Unlock()
+		if sendErr != nil {
+			panic(sendErr)
+		}
+	}
 	if sendErr := h.send(&pgproto3.ReadyForQuery{
-		TxStatus: byte(ReadyForQueryTransactionIndicator_Idle),
+		TxStatus: byte(h.duckHandler.txnStatus()),
 	}); sendErr != nil {
 		// We panic here for the same reason as above.
 		panic(sendErr)
@@ -1218,12 +1451,22 @@ func (h *ConnectionHandler) endOfMessages(err error) {
 }
 
 // sendError sends the given error to the client. This should generally never be called directly.
+// The transaction block, if any, is aborted by the error and stays so until it ends.
 func (h *ConnectionHandler) sendError(err error) {
 	fmt.Println(err.Error())
+	if h.duckHandler.inTxnBlock {
+		h.duckHandler.txnFailed = true
+	}
+	h.sendErrorResponse(err)
+}
+
+// sendErrorResponse sends the ErrorResponse message of the given error to the client.
+func (h *ConnectionHandler) sendErrorResponse(err error) {
+	code, message := errorCodeAndMessage(err)
 	if sendErr := h.send(&pgproto3.ErrorResponse{
 		Severity: string(ErrorResponseSeverity_Error),
-		Code:     "XX000", // internal_error for now
-		Message:  err.Error(),
+		Code:     code,
+		Message:  message,
 	}); sendErr != nil {
 		// If we're unable to send anything to the connection, then there's something wrong with the connection and
 		// we should terminate it. This will be caught in HandleConnection's defer block.
@@ -1231,12 +1474,66 @@ func (h *ConnectionHandler) sendError(err error) {
 	}
 }
 
+// errorCodeAndMessage returns the SQLSTATE code and the message that the error is reported with.
+// The code is internal_error unless the error says otherwise.
+func errorCodeAndMessage(err error) (string, string) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code, pgErr.Message
+	}
+	switch {
+	case catalog.ErrTenantConnectionLimit.Is(err):
+		return "53300", err.Error()
+	case catalog.ErrTenantAccessDenied.Is(err):
+		return "42501", err.Error()
+	case catalog.ErrTenantOverQuota.Is(err):
+		return "53100", err.Error()
+	}
+	if m := missingCatalogRegex.FindStringSubmatch(err.Error()); m != nil {
+		return "3D000", fmt.Sprintf(`database "%s" does not exist`, m[1])
+	}
+	return "XX000", err.Error()
+}
+
+// missingCatalogRegex matches the error that DuckDB returns for a reference to a catalog that is not attached,
+// e.g., in a cross-database query.
+var missingCatalogRegex = regexp.MustCompile(`\bCatalog (?:with name )?"?([^"\s!]+)"? does not exist`)
+
 // convertQuery takes the given Postgres query, and converts it as a list of ast.ConvertedStatement that will work with the handler.
 func (h *ConnectionHandler) convertQuery(query string, modifiers ...QueryModifier) ([]ConvertedStatement, error) {
+	// The user-defined rewrite rules patch the queries before anything else.
+	query = backend.DefaultRewriter.Rewrite(backend.RewriteProtocolPostgres, query)
 	for _, modifier := range modifiers {
 		query = modifier(query)
 	}
 
+	// The time travel queries are not valid PostgreSQL, so they are rewritten before being parsed.
+	if forSystemTimeRegex.MatchString(query) {
+		var err error
+		if query, err = h.convertForSystemTime(query); err != nil {
+			return nil, err
+		}
+	}
+
+	// The SHOW statements of MySQL are not valid PostgreSQL either.
+	query, err := h.convertMySQLShow(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pgvector syntax is not valid PostgreSQL without the extension, so it is rewritten before being parsed too.
+	if query, err = convertVectorSyntax(query, h.vectorIndexes()); err != nil {
+		return nil, err
+	}
+
+	// The full-text search of Postgres is rewritten into the BM25 matches of the fts extension of DuckDB.
+	if fullTextSearchRegex.MatchString(query) {
+		var err error
+		if query, err = h.convertFullTextSearch(query); err != nil {
+			return nil, err
+		}
+	}
+
 	// Check if the query is a subscription query, and if so, parse it as a subscription query.
 	subscriptionConfig, err := parseSubscriptionSQL(query)
 	if subscriptionConfig != nil && err == nil {
@@ -1297,15 +1594,6 @@ func (h *ConnectionHandler) convertQuery(query string, modifiers ...QueryModifie
 	return convertedStmts, nil
 }
 
-// discardAll handles the DISCARD ALL command
-func (h *ConnectionHandler) discardAll(query ConvertedStatement) error {
-	h.closeBackendConn()
-
-	return h.send(&pgproto3.CommandComplete{
-		CommandTag: []byte(query.Tag),
-	})
-}
-
 // handleCopyFromStdinQuery handles the COPY FROM STDIN query at the Doltgres layer, without passing it to the engine.
 // COPY FROM STDIN can't be handled directly by the GMS engine, since COPY FROM STDIN relies on multiple messages sent
 // over the wire.
@@ -1319,15 +1607,25 @@ func (h *ConnectionHandler) handleCopyFromStdinQuery(
 	}
 	sqlCtx.SetLogger(sqlCtx.GetLogger().WithField("query", query.String))
 
-	table, err := ValidateCopyFrom(copyFrom, sqlCtx)
+	table, err := ValidateCopyFrom(copyFrom, sqlCtx, h.duckHandler.e.Analyzer.Catalog)
 	if err != nil {
 		return err
 	}
 
+	var textOptions *CopyTextOptions
+	switch copyFrom.Options.CopyFormat {
+	case tree.CopyFormatText, tree.CopyFormatCSV:
+		textOptions, rawOptions, err = resolveCopyTextOptions(&copyFrom.Options, rawOptions, true)
+		if err != nil {
+			return err
+		}
+	}
+
 	h.copyFromStdinState = &copyFromStdinState{
 		copyFromStdinNode: copyFrom,
 		targetTable:       table,
 		rawOptions:        rawOptions,
+		textOptions:       textOptions,
 	}
 
 	var format byte
@@ -1360,6 +1658,7 @@ func (h *ConnectionHandler) discardToSync() error {
 
 // Send sends the given message over the connection.
 func (h *ConnectionHandler) send(message pgproto3.BackendMessage) error {
+	h.traceMessage("sent", message)
 	h.backend.Send(message)
 	return h.backend.Flush()
 }
@@ -1380,6 +1679,12 @@ func (h *ConnectionHandler) handleCopyToStdout(query ConvertedStatement, copyTo
 		return err
 	}
 	ctx.SetLogger(ctx.GetLogger().WithField("query", query.String))
+	if err := checkCopyToMasking(ctx, query.String); err != nil {
+		return err
+	}
+	if err := h.checkRowSecurity(ctx, query.String); err != nil {
+		return err
+	}
 
 	// Create cancelable context
 	childCtx, cancel := context.WithCancel(ctx)
@@ -1415,6 +1720,15 @@ func (h *ConnectionHandler) handleCopyToStdout(query ConvertedStatement, copyTo
 		}
 	}
 
+	var textOptions *CopyTextOptions
+	switch format {
+	case tree.CopyFormatText, tree.CopyFormatCSV:
+		textOptions, rawOptions, err = resolveCopyTextOptions(options, rawOptions, false)
+		if err != nil {
+			return err
+		}
+	}
+
 	var writer DataWriter
 
 	switch format {
@@ -1430,7 +1744,7 @@ func (h *ConnectionHandler) handleCopyToStdout(query ConvertedStatement, copyTo
 			ctx, h.duckHandler,
 			schema, table, columns,
 			stmt,
-			options, rawOptions,
+			options, textOptions, rawOptions,
 		)
 	}
 	if err != nil {
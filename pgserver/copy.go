@@ -1,8 +1,10 @@
 package pgserver
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
@@ -82,15 +84,20 @@ const (
 	OptionValueTypeInt                           // int
 	OptionValueTypeFloat                         // float64
 	OptionValueTypeString                        // string
+	OptionValueTypeList                          // []string, a parenthesized list of column names or `*`
 )
 
+// ErrUnsupportedCopyOption is returned by ParseCopyOptions if an option is not allowed.
+var ErrUnsupportedCopyOption = errors.New("unsupported option")
+
 // ParseCopyOptions parses the options string and returns the CopyOptions.
-// The options string is a comma-separated list of key-value pairs: `OPT1 1, OPT2, OPT3 'v3', OPT4 E'v4', ...`.
+// The options string is a comma-separated list of key-value pairs: `OPT1 1, OPT2, OPT3 'v3', OPT4 E'v4', OPT5 (a, b), ...`.
 // The allowed map specifies the allowed options and their types. Its keys are the option names in uppercase.
 func ParseCopyOptions(options string, allowed map[string]OptionValueType) (result map[string]any, err error) {
 	result = make(map[string]any)
 	var key, value string
 	inQuotes := false
+	parens := 0
 	expectComma := false
 	readingKey := true
 	var sb strings.Builder
@@ -102,7 +109,7 @@ func ParseCopyOptions(options string, allowed map[string]OptionValueType) (resul
 		}
 		k = strings.ToUpper(k)
 		if _, ok := allowed[k]; !ok {
-			return fmt.Errorf("unsupported option: %s", k)
+			return fmt.Errorf("%w: %s", ErrUnsupportedCopyOption, k)
 		}
 		v := strings.TrimSpace(value)
 
@@ -146,6 +153,12 @@ func ParseCopyOptions(options string, allowed map[string]OptionValueType) (resul
 				return fmt.Errorf("invalid string value for %s: %q", k, v)
 			}
 			result[k] = v
+		case OptionValueTypeList:
+			val, err := parseCopyColumnList(v)
+			if err != nil {
+				return fmt.Errorf("invalid column list for %s: %v", k, err)
+			}
+			result[k] = val
 		}
 		key, value = "", ""
 		readingKey = true
@@ -160,8 +173,24 @@ func ParseCopyOptions(options string, allowed map[string]OptionValueType) (resul
 		case '\'':
 			inQuotes = !inQuotes
 			sb.WriteRune(c)
-		case ',':
+		case '(':
 			if !inQuotes {
+				if parens == 0 && readingKey && sb.Len() > 0 {
+					// e.g., `FORCE_QUOTE(a, b)`
+					key = sb.String()
+					sb.Reset()
+					readingKey = false
+				}
+				parens++
+			}
+			sb.WriteRune(c)
+		case ')':
+			if !inQuotes && parens > 0 {
+				parens--
+			}
+			sb.WriteRune(c)
+		case ',':
+			if !inQuotes && parens == 0 {
 				if readingKey {
 					key = sb.String()
 				} else {
@@ -177,7 +206,7 @@ func ParseCopyOptions(options string, allowed map[string]OptionValueType) (resul
 			}
 		default:
 			if unicode.IsSpace(c) {
-				if !inQuotes {
+				if !inQuotes && parens == 0 {
 					if sb.Len() > 0 {
 						if readingKey {
 							key = sb.String()
@@ -209,3 +238,182 @@ func ParseCopyOptions(options string, allowed map[string]OptionValueType) (resul
 
 	return result, nil
 }
+
+// parseCopyColumnList parses a parenthesized list of column names, e.g., `(a, "B")`, or `*` for all columns.
+// Unquoted names are folded to lower case, as Postgres does.
+func parseCopyColumnList(v string) ([]string, error) {
+	if v == "*" {
+		return []string{"*"}, nil
+	}
+	if !strings.HasPrefix(v, "(") || !strings.HasSuffix(v, ")") {
+		return nil, fmt.Errorf("expected a parenthesized list: %q", v)
+	}
+	var names []string
+	for _, name := range strings.Split(v[1:len(v)-1], ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("empty column name in %q", v)
+		case len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`):
+			names = append(names, strings.ReplaceAll(name[1:len(name)-1], `""`, `"`))
+		default:
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return names, nil
+}
+
+// CopyTextOptions holds the options of COPY in TEXT or CSV format that are not supported by the Postgres parser.
+type CopyTextOptions struct {
+	ForceNotNull []string // COPY FROM only
+	ForceNull    []string // COPY FROM only
+	ForceQuote   []string // COPY TO only, `*` for all columns
+	Encoding     string
+}
+
+var copyTextOptionTypes = map[string]OptionValueType{
+	"HEADER":         OptionValueTypeBool,
+	"DELIMITER":      OptionValueTypeString,
+	"NULL":           OptionValueTypeString,
+	"QUOTE":          OptionValueTypeString,
+	"ESCAPE":         OptionValueTypeString,
+	"FORCE_NOT_NULL": OptionValueTypeList,
+	"FORCE_NULL":     OptionValueTypeList,
+	"FORCE_QUOTE":    OptionValueTypeList,
+	"ENCODING":       OptionValueTypeString,
+}
+
+// ParseCopyTextOptions parses the options of COPY in TEXT or CSV format that cannot be parsed by the Postgres parser,
+// e.g., `HEADER, FORCE_NOT_NULL (a, b), ENCODING 'UTF8'`. The standard options are merged into |options|.
+// If there are non-Postgres options, an error wrapping ErrUnsupportedCopyOption is returned.
+func ParseCopyTextOptions(rawOptions string, options *tree.CopyOptions) (*CopyTextOptions, error) {
+	parsed, err := ParseCopyOptions(rawOptions, copyTextOptionTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	textOptions := &CopyTextOptions{}
+	for k, v := range parsed {
+		switch k {
+		case "HEADER":
+			options.HasHeader = true
+			options.Header = v.(bool)
+		case "DELIMITER":
+			options.Delimiter = tree.NewStrVal(v.(string))
+		case "NULL":
+			options.Null = tree.NewStrVal(v.(string))
+		case "QUOTE":
+			options.Quote = tree.NewStrVal(v.(string))
+		case "ESCAPE":
+			options.Escape = tree.NewStrVal(v.(string))
+		case "FORCE_NOT_NULL":
+			textOptions.ForceNotNull = v.([]string)
+		case "FORCE_NULL":
+			textOptions.ForceNull = v.([]string)
+		case "FORCE_QUOTE":
+			textOptions.ForceQuote = v.([]string)
+		case "ENCODING":
+			textOptions.Encoding = v.(string)
+		}
+	}
+	return textOptions, nil
+}
+
+// ValidateCopyTextOptions returns an error if the options of COPY in TEXT or CSV format are invalid
+// or not supported, e.g., QUOTE in TEXT format or FORCE_QUOTE for COPY FROM.
+func ValidateCopyTextOptions(options *tree.CopyOptions, textOptions *CopyTextOptions, from bool) error {
+	csv := options.CopyFormat == tree.CopyFormatCSV
+	if !csv {
+		switch {
+		case options.Quote != nil:
+			return fmt.Errorf("COPY QUOTE requires CSV mode")
+		case options.Escape != nil:
+			return fmt.Errorf("COPY ESCAPE requires CSV mode")
+		case len(textOptions.ForceNotNull) > 0:
+			return fmt.Errorf("COPY FORCE_NOT_NULL requires CSV mode")
+		case len(textOptions.ForceNull) > 0:
+			return fmt.Errorf("COPY FORCE_NULL requires CSV mode")
+		case len(textOptions.ForceQuote) > 0:
+			return fmt.Errorf("COPY FORCE_QUOTE requires CSV mode")
+		}
+	}
+	if from && len(textOptions.ForceQuote) > 0 {
+		return fmt.Errorf("COPY FORCE_QUOTE cannot be used with COPY FROM")
+	}
+	if !from && len(textOptions.ForceNotNull) > 0 {
+		return fmt.Errorf("COPY FORCE_NOT_NULL cannot be used with COPY TO")
+	}
+	if !from && len(textOptions.ForceNull) > 0 {
+		return fmt.Errorf("COPY FORCE_NULL cannot be used with COPY TO")
+	}
+	if slices.Contains(textOptions.ForceNotNull, "*") || slices.Contains(textOptions.ForceNull, "*") {
+		return fmt.Errorf("COPY FORCE_NOT_NULL and FORCE_NULL require a column list")
+	}
+
+	for _, s := range []struct {
+		name  string
+		value *tree.StrVal
+	}{{"QUOTE", options.Quote}, {"ESCAPE", options.Escape}} {
+		if s.value != nil && len(s.value.RawString()) != 1 {
+			return fmt.Errorf("COPY %s must be a single one-byte character", s.name)
+		}
+	}
+	if options.Delimiter != nil {
+		d, ok := options.Delimiter.(*tree.StrVal)
+		if !ok || len(d.RawString()) != 1 {
+			return fmt.Errorf("COPY delimiter must be a single one-byte character")
+		}
+		c := d.RawString()[0]
+		if c == '\n' || c == '\r' {
+			return fmt.Errorf("COPY delimiter cannot be newline or carriage return")
+		}
+		quote := byte('"')
+		if options.Quote != nil {
+			quote = options.Quote.RawString()[0]
+		}
+		if csv && c == quote {
+			return fmt.Errorf("COPY delimiter and quote must be different")
+		}
+	}
+	if options.Null != nil {
+		if _, ok := options.Null.(*tree.StrVal); !ok {
+			return fmt.Errorf("COPY null representation must be a string")
+		}
+	}
+
+	if textOptions.Encoding != "" {
+		switch strings.ToUpper(strings.ReplaceAll(textOptions.Encoding, "-", "")) {
+		case "UTF8", "UNICODE", "SQL_ASCII":
+		default:
+			return fmt.Errorf("COPY encoding %q is not supported, only UTF8 is supported", textOptions.Encoding)
+		}
+	}
+	return nil
+}
+
+// resolveCopyTextOptions parses and validates the options of COPY in TEXT or CSV format.
+// The returned raw options contain the non-Postgres options, which should be passed to DuckDB as is.
+func resolveCopyTextOptions(options *tree.CopyOptions, rawOptions string, from bool) (*CopyTextOptions, string, error) {
+	textOptions := &CopyTextOptions{}
+	if rawOptions != "" {
+		parsed, err := ParseCopyTextOptions(rawOptions, options)
+		if errors.Is(err, ErrUnsupportedCopyOption) {
+			return textOptions, rawOptions, nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		textOptions, rawOptions = parsed, ""
+	}
+	return textOptions, rawOptions, ValidateCopyTextOptions(options, textOptions, from)
+}
+
+// checkCopyColumns returns an error if a column in |names| is not one of the COPY columns.
+func checkCopyColumns(option string, names []string, columns []string) error {
+	for _, name := range names {
+		if name != "*" && !slices.Contains(columns, name) {
+			return fmt.Errorf(`%s column "%s" not referenced by COPY`, option, name)
+		}
+	}
+	return nil
+}
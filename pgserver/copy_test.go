@@ -1,7 +1,12 @@
 package pgserver
 
 import (
+	"errors"
+	"reflect"
 	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
 )
 
 func TestParseCopyOptions(t *testing.T) {
@@ -319,6 +324,32 @@ func TestParseCopyOptions(t *testing.T) {
 			expected: nil,
 			wantErr:  true,
 		},
+		{
+			name:    "List options",
+			options: `OPT1 (a, "B""c"), OPT2(d), OPT3 *, OPT4 'x'`,
+			allowed: map[string]OptionValueType{
+				"OPT1": OptionValueTypeList,
+				"OPT2": OptionValueTypeList,
+				"OPT3": OptionValueTypeList,
+				"OPT4": OptionValueTypeString,
+			},
+			expected: map[string]any{
+				"OPT1": []string{"a", `B"c`},
+				"OPT2": []string{"d"},
+				"OPT3": []string{"*"},
+				"OPT4": "x",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "List option without parentheses",
+			options: "OPT1 a",
+			allowed: map[string]OptionValueType{
+				"OPT1": OptionValueTypeList,
+			},
+			expected: nil,
+			wantErr:  true,
+		},
 		{
 			name:     "Empty options string",
 			options:  "",
@@ -339,7 +370,7 @@ func TestParseCopyOptions(t *testing.T) {
 					t.Errorf("ParseCopyOptions() got = %v, want %v", result, tt.expected)
 				}
 				for k, v := range tt.expected {
-					if result[k] != v {
+					if !reflect.DeepEqual(result[k], v) {
 						t.Errorf("ParseCopyOptions() got = %v, want %v", result, tt.expected)
 					}
 				}
@@ -347,3 +378,141 @@ func TestParseCopyOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveCopyTextOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     tree.CopyFormat
+		rawOptions string
+		from       bool
+		wantRaw    string
+		wantErr    bool
+	}{
+		{
+			name:       "Postgres options",
+			format:     tree.CopyFormatCSV,
+			rawOptions: "HEADER, DELIMITER '|', FORCE_NOT_NULL (a, b), ENCODING 'UTF8'",
+			from:       true,
+		},
+		{
+			name:       "Non-Postgres options are passed through",
+			format:     tree.CopyFormatCSV,
+			rawOptions: "HEADER, DATEFORMAT '%d/%m/%Y'",
+			from:       false,
+			wantRaw:    "HEADER, DATEFORMAT '%d/%m/%Y'",
+		},
+		{
+			name:       "FORCE_QUOTE with COPY FROM",
+			format:     tree.CopyFormatCSV,
+			rawOptions: "FORCE_QUOTE *",
+			from:       true,
+			wantErr:    true,
+		},
+		{
+			name:       "FORCE_NOT_NULL with COPY TO",
+			format:     tree.CopyFormatCSV,
+			rawOptions: "FORCE_NOT_NULL (a)",
+			from:       false,
+			wantErr:    true,
+		},
+		{
+			name:       "QUOTE in TEXT format",
+			format:     tree.CopyFormatText,
+			rawOptions: "QUOTE '\"'",
+			from:       true,
+			wantErr:    true,
+		},
+		{
+			name:       "Same delimiter and quote",
+			format:     tree.CopyFormatCSV,
+			rawOptions: "DELIMITER '\"'",
+			from:       false,
+			wantErr:    true,
+		},
+		{
+			name:       "Unsupported encoding",
+			format:     tree.CopyFormatCSV,
+			rawOptions: "ENCODING 'LATIN1'",
+			from:       true,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &tree.CopyOptions{CopyFormat: tt.format}
+			_, raw, err := resolveCopyTextOptions(options, tt.rawOptions, tt.from)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveCopyTextOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && raw != tt.wantRaw {
+				t.Errorf("resolveCopyTextOptions() raw = %q, want %q", raw, tt.wantRaw)
+			}
+		})
+	}
+
+	_, err := ParseCopyTextOptions("FREEZE", &tree.CopyOptions{})
+	if !errors.Is(err, ErrUnsupportedCopyOption) {
+		t.Errorf("ParseCopyTextOptions() error = %v, want %v", err, ErrUnsupportedCopyOption)
+	}
+}
+
+func TestSimpleViewSource(t *testing.T) {
+	tests := []struct {
+		name      string
+		stmt      string // as stored by DuckDB
+		wantTable string
+		wantExprs int
+		wantErr   bool
+	}{
+		{
+			name:      "Column aliases",
+			stmt:      "CREATE VIEW v (x, y) AS SELECT a, b AS bb FROM t WHERE (a > 1);",
+			wantTable: "t",
+			wantExprs: 2,
+		},
+		{
+			name:      "Star from a qualified table",
+			stmt:      "CREATE VIEW v2 AS SELECT * FROM s.t;",
+			wantTable: "s.t",
+			wantExprs: 1,
+		},
+		{
+			name:    "Aggregation",
+			stmt:    "CREATE VIEW v AS SELECT a, count(*) FROM t GROUP BY a;",
+			wantErr: true,
+		},
+		{
+			name:    "Join",
+			stmt:    "CREATE VIEW v AS SELECT t.a FROM t, u;",
+			wantErr: true,
+		},
+		{
+			name:    "Distinct",
+			stmt:    "CREATE VIEW v AS SELECT DISTINCT a FROM t;",
+			wantErr: true,
+		},
+		{
+			name:    "Limit",
+			stmt:    "CREATE VIEW v AS SELECT a FROM t LIMIT 1;",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tt.stmt)
+			if err != nil {
+				t.Fatalf("ParseOne() error = %v", err)
+			}
+			base, exprs, err := simpleViewSource(stmt.AST.(*tree.CreateView))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("simpleViewSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if base.String() != tt.wantTable || len(exprs) != tt.wantExprs {
+				t.Errorf("simpleViewSource() = %s, %d exprs, want %s, %d exprs", base, len(exprs), tt.wantTable, tt.wantExprs)
+			}
+		})
+	}
+}
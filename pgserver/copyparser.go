@@ -0,0 +1,475 @@
+package pgserver
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+)
+
+// copyTextFormat describes how the records of a COPY FROM STDIN stream in TEXT or CSV format are encoded.
+type copyTextFormat struct {
+	csv          bool
+	delimiter    byte
+	quote        byte // CSV only
+	escape       byte // CSV only
+	null         string
+	header       bool
+	forceNotNull []bool // CSV only, indexed by column
+	forceNull    []bool // CSV only, indexed by column
+}
+
+func newCopyTextFormat(options *tree.CopyOptions, textOptions *CopyTextOptions, columns []string) (copyTextFormat, error) {
+	format := copyTextFormat{
+		csv:       options.CopyFormat == tree.CopyFormatCSV,
+		delimiter: '\t',
+		null:      `\N`,
+		header:    options.HasHeader && options.Header,
+	}
+	if err := ValidateCopyTextOptions(options, textOptions, true); err != nil {
+		return format, err
+	}
+
+	if format.csv {
+		format.delimiter = ','
+		format.quote = '"'
+		format.escape = '"'
+		format.null = ""
+	}
+	if options.Delimiter != nil {
+		format.delimiter = options.Delimiter.(*tree.StrVal).RawString()[0]
+	}
+	if options.Null != nil {
+		format.null = options.Null.(*tree.StrVal).RawString()
+	}
+	if options.Quote != nil {
+		format.quote = options.Quote.RawString()[0]
+		format.escape = format.quote
+	}
+	if options.Escape != nil {
+		format.escape = options.Escape.RawString()[0]
+	}
+
+	var err error
+	if format.forceNotNull, err = bindCopyColumns("FORCE_NOT_NULL", textOptions.ForceNotNull, columns); err != nil {
+		return format, err
+	}
+	if format.forceNull, err = bindCopyColumns("FORCE_NULL", textOptions.ForceNull, columns); err != nil {
+		return format, err
+	}
+	return format, nil
+}
+
+// bindCopyColumns returns whether each of the COPY columns is in |names|.
+func bindCopyColumns(option string, names []string, columns []string) ([]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if err := checkCopyColumns(option, names, columns); err != nil {
+		return nil, err
+	}
+	flags := make([]bool, len(columns))
+	for i, col := range columns {
+		flags[i] = slices.Contains(names, col)
+	}
+	return flags, nil
+}
+
+// isCopyEndMarker returns whether the record is the end-of-data marker `\.`.
+func isCopyEndMarker(record []byte) bool {
+	record = bytes.TrimSuffix(record, []byte{'\r'})
+	return len(record) == 2 && record[0] == '\\' && record[1] == '.'
+}
+
+// copyMaxRecordSize is the maximum size of a single record in a COPY FROM STDIN stream.
+// It is the same as the limit of Postgres (MaxAllocSize), which prevents a malformed stream,
+// e.g., one with an unterminated quoted field, from being buffered without bound.
+const copyMaxRecordSize = 1<<30 - 1
+
+// copyRecordSplitter reassembles the records of a COPY FROM STDIN stream, which arrives in chunks
+// that do not necessarily end on record boundaries. It only tracks the quoting and escaping state
+// that is needed to find the record boundaries, leaving the parsing of the fields to copyRecordParser.
+type copyRecordSplitter struct {
+	format        *copyTextFormat
+	maxRecordSize int
+	buf           []byte
+	start         int  // start of the first complete record in buf
+	end           int  // end of the last complete record in buf
+	scanned       int  // number of bytes in buf that have been scanned
+	inQuote       bool // inside a quoted CSV field
+	escaped       bool // the next byte is escaped
+	skipHeader    bool
+	done          bool // the end-of-data marker has been seen
+}
+
+func newCopyRecordSplitter(format *copyTextFormat) *copyRecordSplitter {
+	return &copyRecordSplitter{format: format, maxRecordSize: copyMaxRecordSize, skipHeader: format.header}
+}
+
+// Feed appends a chunk of the stream to the splitter.
+// An error is returned if a record exceeds the maximum record size.
+func (s *copyRecordSplitter) Feed(chunk []byte) error {
+	if s.done {
+		// The data after the end-of-data marker is ignored.
+		return nil
+	}
+	s.buf = append(s.buf, chunk...)
+	f := s.format
+	for i := s.scanned; i < len(s.buf); i++ {
+		c := s.buf[i]
+		switch {
+		case s.escaped:
+			s.escaped = false
+			continue
+		case s.inQuote:
+			if c == f.escape && f.escape != f.quote {
+				s.escaped = true
+			} else if c == f.quote {
+				s.inQuote = false
+			}
+			continue
+		case f.csv && c == f.quote:
+			s.inQuote = true
+			continue
+		case !f.csv && c == '\\':
+			s.escaped = true
+			continue
+		case c != '\n':
+			continue
+		}
+
+		// Now we have found the end of a record.
+		if i-s.end > s.maxRecordSize {
+			return s.errRecordTooLarge()
+		}
+		if isCopyEndMarker(s.buf[s.end:i]) {
+			s.done = true
+			s.buf = s.buf[:s.end]
+			break
+		}
+		s.end = i + 1
+		if s.skipHeader {
+			s.skipHeader = false
+			s.start = s.end
+		}
+	}
+	s.scanned = len(s.buf)
+
+	// Check the incomplete record as well, so that it will not be buffered without bound.
+	if len(s.buf)-s.end > s.maxRecordSize {
+		return s.errRecordTooLarge()
+	}
+	return nil
+}
+
+func (s *copyRecordSplitter) errRecordTooLarge() error {
+	return fmt.Errorf("COPY row exceeds the maximum size of %d bytes", s.maxRecordSize)
+}
+
+// Records returns the complete records that have been buffered if they add up to at least |minSize| bytes.
+// Otherwise, it returns nil and the records are kept buffered.
+func (s *copyRecordSplitter) Records(minSize int) []byte {
+	if s.end == s.start || s.end-s.start < minSize {
+		return nil
+	}
+	records := s.buf[s.start:s.end]
+
+	// The returned records are owned by the caller now, so the incomplete record is moved to a new buffer.
+	rest := s.buf[s.end:]
+	s.buf = make([]byte, len(rest), max(2*len(rest), minSize))
+	copy(s.buf, rest)
+	s.scanned -= s.end
+	s.start, s.end = 0, 0
+	return records
+}
+
+// Flush returns all buffered records at the end of the stream, including the last record
+// if it is not terminated by a newline.
+func (s *copyRecordSplitter) Flush() ([]byte, error) {
+	if !s.done && s.end < len(s.buf) {
+		if s.inQuote {
+			return nil, fmt.Errorf("unterminated CSV quoted field")
+		}
+		switch {
+		case isCopyEndMarker(s.buf[s.end:]):
+			s.buf = s.buf[:s.end]
+		case s.skipHeader:
+			s.start = len(s.buf)
+		}
+		s.end = len(s.buf)
+	}
+	records := s.buf[s.start:s.end]
+	s.buf = nil
+	s.start, s.end, s.scanned = 0, 0, 0
+	return records, nil
+}
+
+// copyRecordParser parses the records of a COPY FROM STDIN stream in TEXT or CSV format
+// into Arrow records with a string column for each target column.
+// DuckDB casts the strings to the actual column types when the Arrow records are inserted.
+type copyRecordParser struct {
+	format  *copyTextFormat
+	columns []string
+	builder *array.RecordBuilder
+
+	// The buffers for the fields of the current record.
+	scratch []byte
+	ends    []int // end offsets of the fields in scratch
+	nulls   []bool
+}
+
+// newCopyRecordParser returns a parser that builds Arrow records of the given schema.
+// The schema may be nil if the records are only parsed with Next and Field.
+func newCopyRecordParser(format *copyTextFormat, columns []string, schema *arrow.Schema, alloc memory.Allocator) *copyRecordParser {
+	p := &copyRecordParser{
+		format:  format,
+		columns: columns,
+		ends:    make([]int, 0, len(columns)),
+		nulls:   make([]bool, 0, len(columns)),
+	}
+	if schema != nil {
+		p.builder = array.NewRecordBuilder(alloc, schema)
+	}
+	return p
+}
+
+// newCopyArrowSchema returns the Arrow schema of the records produced by copyRecordParser.
+func newCopyArrowSchema(columns []string) *arrow.Schema {
+	fields := make([]arrow.Field, len(columns))
+	for i, name := range columns {
+		fields[i] = arrow.Field{Name: name, Type: arrow.BinaryTypes.String, Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+func (p *copyRecordParser) Release() {
+	if p.builder != nil {
+		p.builder.Release()
+	}
+}
+
+// Parse parses a batch of complete records into an Arrow record.
+func (p *copyRecordParser) Parse(data []byte) (arrow.Record, error) {
+	for len(data) > 0 {
+		var err error
+		if data, err = p.Next(data); err != nil {
+			// Discard the partially built record batch.
+			p.builder.NewRecord().Release()
+			return nil, err
+		}
+
+		for i := range p.ends {
+			b := p.builder.Field(i).(*array.StringBuilder)
+			if field, null := p.Field(i); null {
+				b.AppendNull()
+			} else {
+				b.BinaryBuilder.Append(field)
+			}
+		}
+	}
+	return p.builder.NewRecord(), nil
+}
+
+// Next parses the first record of |data| and returns the remaining data.
+// The fields of the record are available through Field until the next call.
+func (p *copyRecordParser) Next(data []byte) ([]byte, error) {
+	p.scratch = p.scratch[:0]
+	p.ends = p.ends[:0]
+	p.nulls = p.nulls[:0]
+
+	if p.format.csv {
+		data = p.parseCSVRecord(data)
+	} else {
+		data = p.parseTextRecord(data)
+	}
+
+	if len(p.ends) < len(p.columns) {
+		return nil, fmt.Errorf(`missing data for column "%s"`, p.columns[len(p.ends)])
+	}
+	if len(p.ends) > len(p.columns) {
+		return nil, fmt.Errorf("extra data after last expected column")
+	}
+	return data, nil
+}
+
+// Field returns the value of the i-th field of the current record, and whether it is NULL.
+// The value is only valid until the next call to Next.
+func (p *copyRecordParser) Field(i int) ([]byte, bool) {
+	start := 0
+	if i > 0 {
+		start = p.ends[i-1]
+	}
+	return p.scratch[start:p.ends[i]], p.nulls[i]
+}
+
+func (p *copyRecordParser) addField(null bool) {
+	p.ends = append(p.ends, len(p.scratch))
+	p.nulls = append(p.nulls, null)
+}
+
+// parseTextRecord parses the first record of |data| in TEXT format and returns the remaining data.
+func (p *copyRecordParser) parseTextRecord(data []byte) []byte {
+	f := p.format
+	start := 0
+	for i := 0; ; i++ {
+		if i < len(data) && data[i] == '\\' && i+1 < len(data) {
+			i++ // skip the escaped byte
+			continue
+		}
+		last := i == len(data) || data[i] == '\n'
+		if !last && data[i] != f.delimiter {
+			continue
+		}
+
+		raw := data[start:i]
+		if last {
+			raw = bytes.TrimSuffix(raw, []byte{'\r'})
+		}
+		if string(raw) == f.null {
+			p.addField(true)
+		} else {
+			p.scratch = appendDecodedText(p.scratch, raw)
+			p.addField(false)
+		}
+
+		if last {
+			if i < len(data) {
+				i++
+			}
+			return data[i:]
+		}
+		start = i + 1
+	}
+}
+
+// appendDecodedText decodes the backslash escape sequences of a field in TEXT format.
+func appendDecodedText(dst []byte, raw []byte) []byte {
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' || i+1 == len(raw) {
+			dst = append(dst, c)
+			continue
+		}
+		i++
+		c = raw[i]
+		switch c {
+		case 'b':
+			c = '\b'
+		case 'f':
+			c = '\f'
+		case 'n':
+			c = '\n'
+		case 'r':
+			c = '\r'
+		case 't':
+			c = '\t'
+		case 'v':
+			c = '\v'
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// Up to three octal digits
+			v := c - '0'
+			for j := 0; j < 2 && i+1 < len(raw) && raw[i+1] >= '0' && raw[i+1] <= '7'; j++ {
+				i++
+				v = v<<3 | (raw[i] - '0')
+			}
+			c = v
+		case 'x':
+			// Up to two hex digits
+			if i+1 < len(raw) && isHexDigit(raw[i+1]) {
+				i++
+				v := hexValue(raw[i])
+				if i+1 < len(raw) && isHexDigit(raw[i+1]) {
+					i++
+					v = v<<4 | hexValue(raw[i])
+				}
+				c = v
+			}
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// parseCSVRecord parses the first record of |data| in CSV format and returns the remaining data.
+func (p *copyRecordParser) parseCSVRecord(data []byte) []byte {
+	f := p.format
+	i := 0
+	for {
+		// Parse a field.
+		start, fieldStart := i, len(p.scratch)
+		quoted, inQuote := false, false
+		for ; i < len(data); i++ {
+			c := data[i]
+			if inQuote {
+				if c == f.escape && i+1 < len(data) && (data[i+1] == f.quote || data[i+1] == f.escape) {
+					i++
+					p.scratch = append(p.scratch, data[i])
+				} else if c == f.quote {
+					inQuote = false
+				} else {
+					p.scratch = append(p.scratch, c)
+				}
+				continue
+			}
+			if c == f.delimiter || c == '\n' {
+				break
+			}
+			if c == f.quote {
+				quoted, inQuote = true, true
+				continue
+			}
+			p.scratch = append(p.scratch, c)
+		}
+
+		last := i == len(data) || data[i] == '\n'
+		raw := data[start:i]
+		if last && len(raw) > 0 && raw[len(raw)-1] == '\r' && !inQuote {
+			// Strip the carriage return of a CRLF line ending.
+			raw = raw[:len(raw)-1]
+			p.scratch = p.scratch[:len(p.scratch)-1]
+		}
+
+		col := len(p.ends)
+		null := false
+		switch {
+		case quoted:
+			// A quoted field is never NULL, unless FORCE_NULL is specified for the column.
+			null = col < len(f.forceNull) && f.forceNull[col] && string(p.scratch[fieldStart:]) == f.null
+		case col < len(f.forceNotNull) && f.forceNotNull[col]:
+			// The null string is not matched if FORCE_NOT_NULL is specified for the column.
+		default:
+			// An unquoted field that matches the null string is NULL.
+			null = string(raw) == f.null
+		}
+		if null {
+			p.scratch = p.scratch[:fieldStart]
+		}
+		p.addField(null)
+
+		if i < len(data) {
+			i++
+		}
+		if last {
+			return data[i:]
+		}
+	}
+}
@@ -79,5 +79,9 @@ func normalizeSearchPathSchema(ctx *sql.Context, schemaName string) string {
 		client := ctx.Session.Client()
 		return client.User
 	}
+	if len(schemaName) > 1 && schemaName[0] == '"' && schemaName[len(schemaName)-1] == '"' {
+		// The names that are not plain lower-case identifiers are quoted, see setValueString.
+		return strings.ReplaceAll(schemaName[1:len(schemaName)-1], `""`, `"`)
+	}
 	return schemaName
 }
@@ -0,0 +1,193 @@
+package pgserver
+
+import (
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// inheritColumnComments copies the MySQL types recorded in the comments of the columns read by
+// a `CREATE TABLE ... AS SELECT` or `INSERT INTO ... SELECT` statement to the columns written by it,
+// so that the table keeps the original types when it is read over the MySQL protocol.
+func inheritColumnComments(ctx *sql.Context, stmt tree.Statement) {
+	var (
+		target  tree.TableExpr
+		columns []string
+		query   *tree.Select
+	)
+	switch stmt := stmt.(type) {
+	case *tree.CreateTable:
+		if !stmt.As() || stmt.Persistence.IsTemporary() {
+			return
+		}
+		target, query = &stmt.Table, stmt.AsSource
+	case *tree.Insert:
+		target, query = stmt.Table, stmt.Rows
+		for _, name := range stmt.Columns {
+			columns = append(columns, string(name))
+		}
+	default:
+		return
+	}
+	if aliased, ok := target.(*tree.AliasedTableExpr); ok {
+		target = aliased.Expr
+	}
+	tn, ok := target.(*tree.TableName)
+	if !ok {
+		return
+	}
+
+	currentSchema := adapter.GetCurrentSchema(ctx)
+	sources := queryColumnSources(query, currentSchema)
+	if len(sources) == 0 {
+		return
+	}
+	schema := tn.Schema()
+	if schema == "" {
+		schema = currentSchema
+	}
+	if err := catalog.InheritColumnComments(ctx, adapter.GetCurrentCatalog(ctx), schema, tn.Table(), columns, sources); err != nil {
+		ctx.GetLogger().WithError(err).Warnf("Failed to record the column types of table %s", tn.Table())
+	}
+}
+
+// fromTable is a table in the FROM clause of a query, which is derived if it is not a table of the catalog,
+// e.g., a subquery or a common table expression.
+type fromTable struct {
+	alias string
+	table *catalog.TableName
+}
+
+// queryColumnSources returns the sources of the result columns of a query, see catalog.ColumnSource.
+// Only the columns that are direct references to the columns of the tables in the FROM clause have sources.
+// It returns nil if the result columns cannot be told, e.g., for `*` over a derived table, or for a UNION,
+// whose branches may read different columns.
+func queryColumnSources(s *tree.Select, currentSchema string) []catalog.ColumnSource {
+	if s == nil {
+		return nil
+	}
+	ctes := make(map[string]bool)
+	if s.With != nil {
+		for _, cte := range s.With.CTEList {
+			ctes[string(cte.Name.Alias)] = true
+		}
+	}
+
+	var clause *tree.SelectClause
+	switch stmt := s.Select.(type) {
+	case *tree.ParenSelect:
+		if s.With == nil {
+			return queryColumnSources(stmt.Select, currentSchema)
+		}
+		return nil
+	case *tree.SelectClause:
+		clause = stmt
+	default:
+		return nil
+	}
+
+	var tables []fromTable
+	expandable := true
+	var collect func(expr tree.TableExpr, alias string)
+	collect = func(expr tree.TableExpr, alias string) {
+		switch e := expr.(type) {
+		case *tree.AliasedTableExpr:
+			if e.As.Alias != "" {
+				alias = string(e.As.Alias)
+			}
+			collect(e.Expr, alias)
+		case *tree.ParenTableExpr:
+			collect(e.Expr, alias)
+		case *tree.JoinTableExpr:
+			switch e.Cond.(type) {
+			case tree.NaturalJoinCond, *tree.UsingJoinCond:
+				// The joined columns appear only once in `*`.
+				expandable = false
+			}
+			collect(e.Left, "")
+			collect(e.Right, "")
+		case *tree.TableName:
+			if alias == "" {
+				alias = e.Table()
+			}
+			if e.Schema() == "" && ctes[e.Table()] {
+				tables = append(tables, fromTable{alias: alias})
+				return
+			}
+			schema := e.Schema()
+			if schema == "" {
+				schema = currentSchema
+			}
+			tables = append(tables, fromTable{alias: alias, table: &catalog.TableName{Schema: schema, Table: e.Table()}})
+		default:
+			tables = append(tables, fromTable{alias: alias})
+		}
+	}
+	for _, expr := range clause.From.Tables {
+		collect(expr, "")
+	}
+
+	// all returns the tables of the FROM clause, or nil if any of them is derived.
+	all := func() []catalog.TableName {
+		names := make([]catalog.TableName, 0, len(tables))
+		for _, t := range tables {
+			if t.table == nil {
+				return nil
+			}
+			names = append(names, *t.table)
+		}
+		return names
+	}
+	// named returns the table of the given alias, or nil if it is derived or unknown.
+	named := func(alias string) []catalog.TableName {
+		for _, t := range tables {
+			if t.alias == alias && t.table != nil {
+				return []catalog.TableName{*t.table}
+			}
+		}
+		return nil
+	}
+
+	sources := make([]catalog.ColumnSource, 0, len(clause.Exprs))
+	for _, selectExpr := range clause.Exprs {
+		switch expr := tree.StripParens(selectExpr.Expr).(type) {
+		case tree.UnqualifiedStar:
+			if !expandable || all() == nil {
+				return nil
+			}
+			sources = append(sources, catalog.ColumnSource{Tables: all()})
+		case *tree.AllColumnsSelector:
+			star := named(expr.TableName.Parts[0])
+			if !expandable || star == nil {
+				return nil
+			}
+			sources = append(sources, catalog.ColumnSource{Tables: star})
+		case *tree.UnresolvedName:
+			switch {
+			case expr.Star && expr.NumParts == 1:
+				if !expandable || all() == nil {
+					return nil
+				}
+				sources = append(sources, catalog.ColumnSource{Tables: all()})
+			case expr.Star && expr.NumParts == 2:
+				star := named(expr.Parts[1])
+				if !expandable || star == nil {
+					return nil
+				}
+				sources = append(sources, catalog.ColumnSource{Tables: star})
+			case expr.Star:
+				return nil
+			case expr.NumParts == 1:
+				sources = append(sources, catalog.ColumnSource{Tables: all(), Column: expr.Parts[0]})
+			case expr.NumParts == 2:
+				sources = append(sources, catalog.ColumnSource{Tables: named(expr.Parts[1]), Column: expr.Parts[0]})
+			default:
+				sources = append(sources, catalog.ColumnSource{})
+			}
+		default:
+			sources = append(sources, catalog.ColumnSource{})
+		}
+	}
+	return sources
+}
@@ -0,0 +1,61 @@
+package pgserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryColumnSources(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []string // "-" for a column without a source, "tables.column" otherwise
+	}{
+		{"CREATE TABLE t AS SELECT * FROM a", []string{"public.a.*"}},
+		{"CREATE TABLE t AS SELECT x.id, y.name FROM s.a x JOIN b y ON x.id = y.id", []string{"s.a.id", "public.b.name"}},
+		{"CREATE TABLE t AS SELECT id, x.* FROM s.a x JOIN b ON x.id = b.id", []string{"s.a,public.b.id", "s.a.*"}},
+		// An expression named after a column has no source.
+		{"CREATE TABLE t AS SELECT (id) AS flag, id + 1 AS id, 1 AS one FROM a", []string{"public.a.id", "-", "-"}},
+		{"CREATE TABLE t AS SELECT id, name FROM a WHERE id IN (SELECT id FROM b)", []string{"public.a.id", "public.a.name"}},
+		{"CREATE TABLE t AS SELECT id, sub.name FROM a, (SELECT name FROM b) sub", []string{"-", "-"}},
+		{"CREATE TABLE t AS SELECT * FROM a, (SELECT name FROM b) sub", nil},
+		{"CREATE TABLE t AS SELECT * FROM a JOIN b USING (id)", nil},
+		{"CREATE TABLE t AS WITH c AS (SELECT 1 AS id) SELECT c.id, a.id FROM c, a", []string{"-", "public.a.id"}},
+		{"CREATE TABLE t AS SELECT id FROM a UNION ALL SELECT id FROM b", nil},
+		{"INSERT INTO t (flag, id) SELECT flag, count(*) FROM a GROUP BY flag", []string{"public.a.flag", "-"}},
+		{"INSERT INTO t VALUES (1, 2)", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tt.query)
+			require.NoError(t, err)
+			var query *tree.Select
+			switch stmt := stmt.AST.(type) {
+			case *tree.CreateTable:
+				query = stmt.AsSource
+			case *tree.Insert:
+				query = stmt.Rows
+			}
+			var sources []string
+			for _, source := range queryColumnSources(query, "public") {
+				if len(source.Tables) == 0 {
+					sources = append(sources, "-")
+					continue
+				}
+				var tables []string
+				for _, table := range source.Tables {
+					tables = append(tables, table.Schema+"."+table.Table)
+				}
+				column := source.Column
+				if column == "" {
+					column = "*"
+				}
+				sources = append(sources, strings.Join(tables, ",")+"."+column)
+			}
+			require.Equal(t, tt.expected, sources)
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The cursors of DECLARE, FETCH, MOVE and CLOSE:
+//
+//   - DECLARE materializes the result of the query into a temporary table of the DuckDB connection of the session,
+//     in the current transaction, and FETCH reads the rows at the position of the cursor from the table by their rowids.
+//     So the cursors can move in both directions unless they are declared with NO SCROLL.
+//   - A cursor without HOLD can only be declared in a transaction block, and is closed when the block ends.
+//   - A cursor WITH HOLD is kept after the block commits, or is declared outside of a block, until it is closed
+//     or the session ends. It is closed if the block that declared it is rolled back, the same as Postgres.
+//   - A cursor WITH HOLD that has not been used for the idle timeout of the server, see WithCursorIdleTimeout,
+//     is closed to release its table, since the clients that abandon such cursors would hold it till they disconnect.
+//     The cursors of a session in a transaction block are kept until the block ends.
+//
+// The row-level security applies to the query of DECLARE the same as to a SELECT, and the cursors over the tables
+// with masking policies are refused. BINARY cursors are not supported.
+
+// cursorTablePrefix is the prefix of the temporary tables of the cursors, which DISCARD TEMP leaves to the cursors.
+const cursorTablePrefix = "__myduck_cursor_"
+
+// DefaultCursorIdleTimeout is the default idle timeout of the cursors WITH HOLD.
+const DefaultCursorIdleTimeout = time.Hour
+
+// cursorIdleTimeout is how long a cursor WITH HOLD is kept without being used, or 0 to keep it till the session ends.
+var cursorIdleTimeout = DefaultCursorIdleTimeout
+
+// WithCursorIdleTimeout sets the idle timeout of the cursors WITH HOLD. Zero keeps them till the sessions end.
+func WithCursorIdleTimeout(timeout time.Duration) ListenerOpt {
+	return func(l *Listener) {
+		cursorIdleTimeout = timeout
+	}
+}
+
+// declareCursorQueryRegex matches the query of a DECLARE statement, which follows the first FOR after CURSOR.
+var declareCursorQueryRegex = regexp.MustCompile(`(?is)^\s*DECLARE\s.*?\bCURSOR\b.*?\bFOR\s+(.+?)[\s;]*$`)
+
+// cursor is a cursor declared by the session.
+type cursor struct {
+	name string
+	// table is the temporary table of the result of the query.
+	table    string
+	hold     bool
+	noScroll bool
+	// inTxn indicates whether the cursor is declared in the current transaction block.
+	inTxn bool
+	rows  int64
+	// pos is the position of the cursor: 0 before the first row, 1 to rows on a row, and rows+1 after the last row.
+	pos      int64
+	lastUsed time.Time
+}
+
+// cursorSet holds the cursors of a session. The cursors are used by the goroutine of the connection
+// while it handles a message, and closed by the timer of the idle timeout while it does not, see closeIdleCursors.
+type cursorSet struct {
+	mu      sync.Mutex
+	cursors map[string]*cursor
+	seq     uint64
+	// busy indicates whether a message of the client is being handled.
+	busy   bool
+	closed bool
+	timer  *time.Timer
+}
+
+// seek returns the position that FETCH or MOVE moves the cursor to, and the first and the last positions
+// of the rows that it passes over in order, or n = 0 if there are none.
+func (c *cursor) seek(fetchType tree.FetchType, count int64) (pos, first, last, n int64) {
+	switch fetchType {
+	case tree.FetchAll:
+		return c.forward(c.rows + 1)
+	case tree.FetchBackwardAll:
+		return c.backward(c.rows + 1)
+	case tree.FetchFirst:
+		return c.moveTo(1)
+	case tree.FetchLast:
+		return c.moveTo(c.rows)
+	case tree.FetchAbsolute:
+		if count < 0 {
+			count += c.rows + 1
+		}
+		return c.moveTo(count)
+	case tree.FetchRelative:
+		return c.moveTo(c.pos + count)
+	}
+	switch {
+	case count > 0:
+		return c.forward(count)
+	case count < 0:
+		return c.backward(-count)
+	}
+	// FETCH 0 fetches the current row again.
+	return c.moveTo(c.pos)
+}
+
+func (c *cursor) forward(count int64) (pos, first, last, n int64) {
+	if count > c.rows+1-c.pos {
+		count = c.rows + 1 - c.pos
+	}
+	pos, first, last = c.pos+count, c.pos+1, min(c.pos+count, c.rows)
+	return pos, first, last, max(last-first+1, 0)
+}
+
+func (c *cursor) backward(count int64) (pos, first, last, n int64) {
+	if count > c.pos {
+		count = c.pos
+	}
+	pos, first, last = c.pos-count, min(c.pos-1, c.rows), max(c.pos-count, 1)
+	return pos, first, last, max(first-last+1, 0)
+}
+
+func (c *cursor) moveTo(target int64) (pos, first, last, n int64) {
+	switch {
+	case target < 1:
+		return 0, 0, 0, 0
+	case target > c.rows:
+		return c.rows + 1, 0, 0, 0
+	}
+	return target, target, target, 1
+}
+
+// fetchQuery returns the query of the rows between the positions, in order.
+func (c *cursor) fetchQuery(first, last, n int64) string {
+	query := "SELECT * FROM temp.main." + catalog.QuoteIdentifierANSI(c.table)
+	switch {
+	case n == 0:
+		return query + " WHERE false"
+	case first <= last:
+		return fmt.Sprintf("%s WHERE rowid BETWEEN %d AND %d ORDER BY rowid", query, first-1, last-1)
+	}
+	return fmt.Sprintf("%s WHERE rowid BETWEEN %d AND %d ORDER BY rowid DESC", query, last-1, first-1)
+}
+
+// declareCursor handles DECLARE, which materializes the result of the query for the cursor.
+func (h *ConnectionHandler) declareCursor(statement ConvertedStatement, stmt *tree.DeclareCursor) error {
+	name := string(stmt.Name)
+	if stmt.Binary {
+		return newPgError("0A000", "BINARY cursors are not supported")
+	}
+	if !stmt.Hold && !h.duckHandler.inTxnBlock {
+		return newPgError("25P01", "DECLARE CURSOR can only be used in transaction blocks")
+	}
+	if _, ok := h.cursors.cursors[name]; ok {
+		return newPgError("42P03", `cursor "%s" already exists`, name)
+	}
+	m := declareCursorQueryRegex.FindStringSubmatch(statement.String)
+	if m == nil {
+		return newPgError("42601", "invalid DECLARE statement: %s", statement.String)
+	}
+	query := ConvertedStatement{String: m[1], AST: stmt.Select, Tag: "SELECT", PgParsable: true}
+	if err := h.applyRowSecurity(&query); err != nil {
+		return err
+	}
+
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, statement.String)
+	if err != nil {
+		return err
+	}
+	if relations, err := loadMaskedRelations(ctx); err != nil {
+		return err
+	} else if relations != nil {
+		if name := relations.mentionedIn(query.String); name != "" {
+			return newPgError("42501", "permission denied to declare a cursor over the masked table %s", name)
+		}
+	}
+
+	h.cursors.seq++
+	c := &cursor{
+		name:     name,
+		table:    fmt.Sprintf("%s%d", cursorTablePrefix, h.cursors.seq),
+		hold:     stmt.Hold,
+		noScroll: stmt.Scroll == tree.NoScroll,
+		inTxn:    h.duckHandler.inTxnBlock,
+		lastUsed: time.Now(),
+	}
+	res, err := adapter.Exec(ctx, "CREATE TEMP TABLE "+catalog.QuoteIdentifierANSI(c.table)+" AS "+query.String)
+	if err != nil {
+		return err
+	}
+	if c.rows, err = res.RowsAffected(); err != nil {
+		return err
+	}
+	if h.cursors.cursors == nil {
+		h.cursors.cursors = make(map[string]*cursor)
+	}
+	h.cursors.cursors[name] = c
+	return h.send(makeCommandComplete("DECLARE CURSOR", 0))
+}
+
+// fetchCursor handles FETCH, or MOVE if move is true.
+func (h *ConnectionHandler) fetchCursor(cs tree.CursorStmt, move bool) error {
+	c, ok := h.cursors.cursors[string(cs.Name)]
+	if !ok {
+		return newPgError("34000", `cursor "%s" does not exist`, cs.Name)
+	}
+	pos, first, last, n := c.seek(cs.FetchType, cs.Count)
+	if c.noScroll && (pos < c.pos || first > last) {
+		return newPgError("55000", "cursor can only scan forward")
+	}
+	c.pos, c.lastUsed = pos, time.Now()
+	if move {
+		return h.send(makeCommandComplete("MOVE", int32(n)))
+	}
+
+	query := c.fetchQuery(first, last, n)
+	parsed, err := parser.ParseOne(query)
+	if err != nil {
+		return err
+	}
+	statement := ConvertedStatement{String: query, AST: parsed.AST, Tag: "FETCH", PgParsable: true}
+	rows := int32(0)
+	if err := h.duckHandler.ComQuery(context.Background(), h.mysqlConn, query, parsed.AST, h.spoolRowsCallback(statement, &rows, false)); err != nil {
+		return err
+	}
+	return h.send(makeCommandComplete("FETCH", rows))
+}
+
+// closeCursor handles CLOSE.
+func (h *ConnectionHandler) closeCursor(stmt *tree.CloseCursor) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	if stmt.All {
+		for _, c := range h.cursors.cursors {
+			if err := h.dropCursor(ctx, c); err != nil {
+				return err
+			}
+		}
+		return h.send(makeCommandComplete("CLOSE CURSOR ALL", 0))
+	}
+	c, ok := h.cursors.cursors[string(stmt.Name)]
+	if !ok {
+		return newPgError("34000", `cursor "%s" does not exist`, stmt.Name)
+	}
+	if err := h.dropCursor(ctx, c); err != nil {
+		return err
+	}
+	return h.send(makeCommandComplete("CLOSE CURSOR", 0))
+}
+
+// dropCursor closes a cursor and drops its table.
+func (h *ConnectionHandler) dropCursor(ctx *sql.Context, c *cursor) error {
+	if _, err := adapter.Exec(ctx, "DROP TABLE IF EXISTS temp.main."+catalog.QuoteIdentifierANSI(c.table)); err != nil {
+		return err
+	}
+	delete(h.cursors.cursors, c.name)
+	return nil
+}
+
+// endCursorTxn closes the cursors without HOLD at the end of a transaction block, and the cursors WITH HOLD
+// declared in the block if it is rolled back, whose tables are dropped along with the transaction.
+func (h *ConnectionHandler) endCursorTxn(ctx *sql.Context, committed bool) {
+	for name, c := range h.cursors.cursors {
+		switch {
+		case !committed && c.inTxn:
+			delete(h.cursors.cursors, name)
+		case !c.hold:
+			if err := h.dropCursor(ctx, c); err != nil {
+				h.logger.WithError(err).Warnf("Failed to close cursor %s", name)
+				delete(h.cursors.cursors, name)
+			}
+		default:
+			c.inTxn = false
+		}
+	}
+}
+
+// resetCursors forgets the cursors, whose tables are gone with the DuckDB connection of the session.
+// If closed is true, the session ends, and the cursors are no longer closed by the idle timeout.
+func (h *ConnectionHandler) resetCursors(closed bool) {
+	h.cursors.mu.Lock()
+	defer h.cursors.mu.Unlock()
+	h.cursors.cursors = nil
+	if closed {
+		h.cursors.closed = true
+		if h.cursors.timer != nil {
+			h.cursors.timer.Stop()
+		}
+	}
+}
+
+// startHandlingMessage marks the session busy, so that its cursors are not closed by the idle timeout meanwhile.
+func (h *ConnectionHandler) startHandlingMessage() {
+	h.cursors.mu.Lock()
+	defer h.cursors.mu.Unlock()
+	h.cursors.busy = true
+}
+
+// finishHandlingMessage marks the session idle, and schedules the idle timeout of its cursors.
+func (h *ConnectionHandler) finishHandlingMessage() {
+	h.cursors.mu.Lock()
+	defer h.cursors.mu.Unlock()
+	h.cursors.busy = false
+	h.scheduleIdleCursors()
+}
+
+// scheduleIdleCursors sets the timer to close the cursors WITH HOLD once the first of them times out.
+// It must be called with the lock of the cursors held.
+func (h *ConnectionHandler) scheduleIdleCursors() {
+	if h.cursors.timer != nil {
+		h.cursors.timer.Stop()
+		h.cursors.timer = nil
+	}
+	if cursorIdleTimeout <= 0 || h.cursors.closed || h.duckHandler.inTxnBlock {
+		return
+	}
+	var earliest time.Time
+	for _, c := range h.cursors.cursors {
+		if earliest.IsZero() || c.lastUsed.Before(earliest) {
+			earliest = c.lastUsed
+		}
+	}
+	if !earliest.IsZero() {
+		h.cursors.timer = time.AfterFunc(time.Until(earliest.Add(cursorIdleTimeout)), h.closeIdleCursors)
+	}
+}
+
+// closeIdleCursors closes the cursors that have timed out. It runs on the timer while the session is idle,
+// i.e., the goroutine of the connection is waiting for the next message, which it handles after this returns.
+func (h *ConnectionHandler) closeIdleCursors() {
+	h.cursors.mu.Lock()
+	defer h.cursors.mu.Unlock()
+	// The timer is set again when the message being handled is done.
+	if h.cursors.busy || h.cursors.closed || h.duckHandler.inTxnBlock {
+		return
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		h.logger.WithError(err).Warn("Failed to create context for closing idle cursors")
+		return
+	}
+	deadline := time.Now().Add(-cursorIdleTimeout)
+	for name, c := range h.cursors.cursors {
+		if c.lastUsed.After(deadline) {
+			continue
+		}
+		if err := h.dropCursor(ctx, c); err != nil {
+			h.logger.WithError(err).Warnf("Failed to close idle cursor %s", name)
+			delete(h.cursors.cursors, name)
+			continue
+		}
+		h.logger.Infof("Closed cursor %s, which has not been used for %s", name, cursorIdleTimeout)
+	}
+	h.scheduleIdleCursors()
+}
@@ -0,0 +1,83 @@
+package pgserver
+
+import (
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorSeek(t *testing.T) {
+	fetch := func(c *cursor, query string) []int64 {
+		stmt, err := parser.ParseOne(query)
+		require.NoError(t, err)
+		cs := stmt.AST.(*tree.FetchCursor).CursorStmt
+		pos, first, last, n := c.seek(cs.FetchType, cs.Count)
+		c.pos = pos
+		var rows []int64
+		for i := int64(0); i < n; i++ {
+			if first <= last {
+				rows = append(rows, first+i)
+			} else {
+				rows = append(rows, first-i)
+			}
+		}
+		return rows
+	}
+
+	c := &cursor{rows: 5}
+	require.Equal(t, []int64{1, 2}, fetch(c, "FETCH 2 FROM c"))
+	require.Equal(t, []int64{2}, fetch(c, "FETCH 0 FROM c"))
+	require.Equal(t, []int64{3, 4, 5}, fetch(c, "FETCH FORWARD 3 FROM c"))
+	require.Equal(t, int64(5), c.pos)
+	require.Empty(t, fetch(c, "FETCH NEXT FROM c"))
+	require.Equal(t, int64(6), c.pos)
+	require.Empty(t, fetch(c, "FETCH NEXT FROM c"))
+	require.Equal(t, []int64{5, 4}, fetch(c, "FETCH BACKWARD 2 FROM c"))
+	require.Equal(t, []int64{3, 2, 1}, fetch(c, "FETCH BACKWARD ALL FROM c"))
+	require.Equal(t, int64(0), c.pos)
+	require.Equal(t, []int64{5}, fetch(c, "FETCH LAST FROM c"))
+	require.Equal(t, []int64{4}, fetch(c, "FETCH ABSOLUTE -2 FROM c"))
+	require.Equal(t, []int64{3}, fetch(c, "FETCH RELATIVE -1 FROM c"))
+	require.Empty(t, fetch(c, "FETCH ABSOLUTE 9 FROM c"))
+	require.Equal(t, int64(6), c.pos)
+	require.Equal(t, []int64{1}, fetch(c, "FETCH FIRST FROM c"))
+	require.Equal(t, []int64{2, 3, 4, 5}, fetch(c, "FETCH ALL FROM c"))
+	require.Equal(t, int64(6), c.pos)
+
+	require.Equal(t, `SELECT * FROM temp.main."t" WHERE rowid BETWEEN 1 AND 3 ORDER BY rowid DESC`, (&cursor{table: "t"}).fetchQuery(4, 2, 3))
+	require.Equal(t, `SELECT * FROM temp.main."t" WHERE false`, (&cursor{table: "t"}).fetchQuery(0, 0, 0))
+}
+
+func TestCursorTable(t *testing.T) {
+	m := declareCursorQueryRegex.FindStringSubmatch("DECLARE c NO SCROLL CURSOR WITH HOLD FOR SELECT i FROM range(10) t(i) ORDER BY i DESC;")
+	require.NotNil(t, m)
+	require.Equal(t, "SELECT i FROM range(10) t(i) ORDER BY i DESC", m[1])
+
+	db, err := stdsql.Open("duckdb", "")
+	require.NoError(t, err)
+	defer db.Close()
+	res, err := db.Exec("CREATE TEMP TABLE " + cursorTablePrefix + "1 AS " + m[1])
+	require.NoError(t, err)
+	n, err := res.RowsAffected()
+	require.NoError(t, err)
+	require.Equal(t, int64(10), n)
+
+	// The rows are read in the order of the query.
+	c := &cursor{table: cursorTablePrefix + "1", rows: n}
+	pos, first, last, n := c.seek(tree.FetchNormal, 3)
+	require.Equal(t, int64(3), pos)
+	rows, err := db.Query(c.fetchQuery(first, last, n))
+	require.NoError(t, err)
+	defer rows.Close()
+	var values []int
+	for rows.Next() {
+		var v int
+		require.NoError(t, rows.Scan(&v))
+		values = append(values, v)
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, []int{9, 8, 7}, values)
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/apecloud/myduckserver/adapter"
 	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/catalog"
 	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
 	"github.com/dolthub/go-mysql-server/sql"
 	"github.com/sirupsen/logrus"
@@ -61,6 +62,7 @@ type PipeDataLoader struct {
 	errPipe  atomic.Pointer[os.File] // for error handling
 	rowCount chan int64
 	err      atomic.Pointer[error]
+	closed   atomic.Bool // set once the load is aborted or finished
 	logger   *logrus.Entry
 }
 
@@ -113,6 +115,10 @@ func (loader *PipeDataLoader) LoadChunk(ctx *sql.Context, data []byte) error {
 }
 
 func (loader *PipeDataLoader) Abort(ctx *sql.Context) error {
+	// Abort may be called again on teardown after a failed chunk has aborted the load.
+	if !loader.closed.CompareAndSwap(false, true) {
+		return nil
+	}
 	defer os.Remove(loader.pipePath)
 	loader.err.Store(&ErrCopyAborted)
 	loader.cancel()
@@ -127,6 +133,9 @@ func (loader *PipeDataLoader) Finish(ctx *sql.Context) (*LoadDataResults, error)
 		loader.logger.Errorln("COPY operation failed:", *errp)
 		return nil, *errp
 	}
+	if !loader.closed.CompareAndSwap(false, true) {
+		return nil, ErrCopyAborted
+	}
 
 	// Close the pipe to signal the reader to exit
 	if err := loader.pipe.Load().Close(); err != nil {
@@ -148,16 +157,25 @@ func (loader *PipeDataLoader) Finish(ctx *sql.Context) (*LoadDataResults, error)
 
 type CsvDataLoader struct {
 	PipeDataLoader
-	options *tree.CopyOptions
+	options     *tree.CopyOptions
+	textOptions *CopyTextOptions
+	rawOptions  string
+	splitter    *copyRecordSplitter
 }
 
 var _ DataLoader = (*CsvDataLoader)(nil)
 
 func NewCsvDataLoader(
 	ctx *sql.Context, handler *DuckHandler,
-	schema string, table sql.InsertableTable, columns tree.NameList, options *tree.CopyOptions,
-	rawOptions string, // For non-PG-parsable COPY FROM, unused for now
+	schema string, table sql.InsertableTable, columns tree.NameList,
+	options *tree.CopyOptions, textOptions *CopyTextOptions,
+	rawOptions string, // Non-PG options, which are passed to DuckDB as is
 ) (DataLoader, error) {
+	format, err := newCopyTextFormat(options, textOptions, copyColumnNames(table, columns))
+	if err != nil {
+		return nil, err
+	}
+
 	// Create the FIFO pipe
 	duckBuilder := handler.e.Analyzer.ExecBuilder.(*backend.DuckBuilder)
 	pipePath, err := duckBuilder.CreatePipe(ctx, "pg-copy-from")
@@ -180,7 +198,10 @@ func NewCsvDataLoader(
 			rowCount: make(chan int64, 1),
 			logger:   ctx.GetLogger(),
 		},
-		options: options,
+		options:     options,
+		textOptions: textOptions,
+		rawOptions:  rawOptions,
+		splitter:    newCopyRecordSplitter(&format),
 	}
 	loader.read = func() {
 		loader.executeCopy(loader.buildSQL(), pipePath)
@@ -189,6 +210,33 @@ func NewCsvDataLoader(
 	return loader, nil
 }
 
+// LoadChunk forwards the complete records to DuckDB, which stops at the end-of-data marker `\.`
+// even if the marker and the preceding records span multiple chunks.
+func (loader *CsvDataLoader) LoadChunk(ctx *sql.Context, data []byte) error {
+	if err := loader.splitter.Feed(data); err != nil {
+		loader.Abort(ctx)
+		return err
+	}
+	if records := loader.splitter.Records(0); records != nil {
+		return loader.PipeDataLoader.LoadChunk(ctx, records)
+	}
+	return nil
+}
+
+func (loader *CsvDataLoader) Finish(ctx *sql.Context) (*LoadDataResults, error) {
+	records, err := loader.splitter.Flush()
+	if err != nil {
+		loader.Abort(ctx)
+		return nil, err
+	}
+	if len(records) > 0 {
+		if err := loader.PipeDataLoader.LoadChunk(ctx, records); err != nil {
+			return nil, err
+		}
+	}
+	return loader.PipeDataLoader.Finish(ctx)
+}
+
 // buildSQL builds the DuckDB COPY FROM statement.
 func (loader *CsvDataLoader) buildSQL() string {
 	var b strings.Builder
@@ -213,12 +261,8 @@ func (loader *CsvDataLoader) buildSQL() string {
 
 	options := loader.options
 
-	b.WriteString(", HEADER ")
-	if options.HasHeader && options.Header {
-		b.WriteString("true")
-	} else {
-		b.WriteString("false")
-	}
+	// The header is skipped by the splitter.
+	b.WriteString(", HEADER false")
 
 	if options.Delimiter != nil {
 		b.WriteString(", SEP ")
@@ -248,6 +292,17 @@ func (loader *CsvDataLoader) buildSQL() string {
 		b.WriteString(`, NULLSTR '\N'`)
 	}
 
+	if len(loader.textOptions.ForceNotNull) > 0 {
+		b.WriteString(", FORCE_NOT_NULL (")
+		b.WriteString(quoteCopyColumns(loader.textOptions.ForceNotNull))
+		b.WriteString(")")
+	}
+
+	if loader.rawOptions != "" {
+		b.WriteString(", ")
+		b.WriteString(loader.rawOptions)
+	}
+
 	b.WriteString(")")
 
 	return b.String()
@@ -287,3 +342,27 @@ func singleQuotedDuckChar(s string) string {
 	}
 	return strconv.QuoteRune(r) // e.g., tab -> '\t'
 }
+
+// copyColumnNames returns the names of the columns that are loaded by COPY FROM.
+func copyColumnNames(table sql.Table, columns tree.NameList) []string {
+	names := make([]string, 0, len(table.Schema()))
+	if len(columns) > 0 {
+		for _, col := range columns {
+			names = append(names, string(col))
+		}
+	} else {
+		for _, col := range table.Schema() {
+			names = append(names, col.Name)
+		}
+	}
+	return names
+}
+
+// quoteCopyColumns returns the comma-separated list of quoted column names.
+func quoteCopyColumns(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = catalog.QuoteIdentifierANSI(name)
+	}
+	return strings.Join(quoted, ", ")
+}
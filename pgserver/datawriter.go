@@ -35,7 +35,7 @@ func NewDuckDataWriter(
 	handler *DuckHandler,
 	schema string, table sql.Table, columns tree.NameList,
 	query string,
-	options *tree.CopyOptions, rawOptions string,
+	options *tree.CopyOptions, textOptions *CopyTextOptions, rawOptions string,
 ) (*DuckDataWriter, error) {
 	// Create the FIFO pipe
 	db := handler.e.Analyzer.ExecBuilder.(*backend.DuckBuilder)
@@ -126,12 +126,26 @@ func NewDuckDataWriter(
 		}
 
 		if options.Null != nil {
-			builder.WriteString(`, NULLSTR '`)
+			builder.WriteString(`, NULLSTR `)
 			builder.WriteString(options.Null.String())
-			builder.WriteString(`'`)
 		} else if options.CopyFormat == tree.CopyFormatText {
 			builder.WriteString(`, NULLSTR '\N'`)
 		}
+
+		if len(textOptions.ForceQuote) > 0 {
+			if textOptions.ForceQuote[0] == "*" {
+				builder.WriteString(", FORCE_QUOTE *")
+			} else {
+				if table != nil {
+					if err := checkCopyColumns("FORCE_QUOTE", textOptions.ForceQuote, copyColumnNames(table, columns)); err != nil {
+						return nil, err
+					}
+				}
+				builder.WriteString(", FORCE_QUOTE (")
+				builder.WriteString(quoteCopyColumns(textOptions.ForceQuote))
+				builder.WriteString(")")
+			}
+		}
 		builder.WriteString(")")
 
 	case tree.CopyFormatBinary:
@@ -0,0 +1,137 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+)
+
+// discardPlansRegex matches `DISCARD PLANS`, which is not supported by the Postgres parser.
+var discardPlansRegex = regexp.MustCompile(`(?i)^\s*discard\s+plans\s*;?\s*$`)
+
+// discard handles the DISCARD ALL|TEMP|SEQUENCES commands.
+// DISCARD PLANS is handled by the in-place handler of the DISCARD tag, see discardPlans.
+func (h *ConnectionHandler) discard(query ConvertedStatement, mode tree.DiscardMode) error {
+	switch mode {
+	case tree.DiscardModeAll:
+		return h.discardAll(query)
+	case tree.DiscardModeTemp:
+		if err := h.discardTemp(); err != nil {
+			return err
+		}
+		return h.send(makeCommandComplete("DISCARD TEMP", 0))
+	case tree.DiscardModeSequences:
+		// Postgres caches the values of the sequences used by the session, e.g., for currval() and lastval().
+		// DuckDB keeps the state of a sequence in the sequence itself, so there is nothing to discard.
+		return h.send(makeCommandComplete("DISCARD SEQUENCES", 0))
+	}
+	return fmt.Errorf("unsupported DISCARD mode: %s", query.String)
+}
+
+// discardAll handles the DISCARD ALL command, which resets the session to its initial state:
+// the prepared statements and portals are closed, and the backend connection is closed along with
+// its temporary objects and settings. The session stops listening on all channels, as by UNLISTEN *.
+func (h *ConnectionHandler) discardAll(query ConvertedStatement) error {
+	if h.duckHandler.inTxnBlock {
+		return newPgError("25001", "DISCARD ALL cannot run inside a transaction block")
+	}
+	// The prepared statements live on the backend connection, so they are closed first.
+	for name := range h.portals {
+		h.deletePortal(name)
+	}
+	for name := range h.preparedStatements {
+		h.deletePreparedStatement(name)
+	}
+	h.closeBackendConn()
+	// The profiling setting lives on the closed DuckDB connection.
+	h.duckHandler.profiling = false
+	h.listening = nil
+
+	return h.send(makeCommandComplete("DISCARD ALL", 0))
+}
+
+// discardTemp drops the temporary views, tables, sequences and macros of the session.
+// The tables of the cursors are kept, the same as the cursors are by Postgres.
+func (h *ConnectionHandler) discardTemp() error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	// The dependents are dropped before their dependencies, e.g., the tables before the sequences of their columns.
+	rows, err := adapter.Query(ctx, `
+		SELECT 1, 'VIEW', view_name FROM duckdb_views() WHERE temporary AND NOT internal
+		UNION ALL
+		SELECT 2, 'TABLE', table_name FROM duckdb_tables() WHERE temporary AND NOT starts_with(table_name, '`+cursorTablePrefix+`')
+		UNION ALL
+		SELECT 3, 'SEQUENCE', sequence_name FROM duckdb_sequences() WHERE temporary
+		UNION ALL
+		SELECT 4, CASE function_type WHEN 'table_macro' THEN 'MACRO TABLE' ELSE 'MACRO' END, function_name
+		FROM duckdb_functions() WHERE database_name = 'temp' AND NOT internal AND function_type IN ('macro', 'table_macro')
+		ORDER BY 1`)
+	if err != nil {
+		return err
+	}
+	var drops []string
+	for rows.Next() {
+		var (
+			order      int
+			kind, name string
+		)
+		if err := rows.Scan(&order, &kind, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		drops = append(drops, `DROP `+kind+` IF EXISTS temp.main.`+catalog.QuoteIdentifierANSI(name))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, drop := range drops {
+		if _, err := adapter.Exec(ctx, drop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discardPlans handles the DISCARD PLANS command. The prepared statements are kept,
+// but their DuckDB statements are prepared again, see replanPreparedStatements.
+func (h *ConnectionHandler) discardPlans() error {
+	h.replanPreparedStatements(func(PreparedStatementData) bool { return true })
+	return h.send(makeCommandComplete("DISCARD PLANS", 0))
+}
+
+// replanPreparedStatements prepares the DuckDB statements of the selected prepared statements again,
+// so that they are planned against the current catalog. The portals bound to the previous statements are closed.
+func (h *ConnectionHandler) replanPreparedStatements(selected func(PreparedStatementData) bool) {
+	var names []string
+	for name, ps := range h.preparedStatements {
+		if ps.Stmt != nil && selected(ps) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		ps := h.preparedStatements[name]
+		stmt, bindVarTypes, fields, err := h.duckHandler.ComPrepareParsed(context.Background(), h.mysqlConn, ps.Statement.String, ps.Statement.AST, ps.BindVarTypes)
+		if err != nil {
+			// Same as Postgres, a statement that can no longer be planned, e.g., because its table has been dropped,
+			// reports the error when it is used again.
+			h.logger.WithError(err).Debugf("Failed to prepare statement %q again", name)
+			continue
+		}
+		h.deletePreparedStatement(name)
+		h.preparedStatements[name] = PreparedStatementData{
+			Statement:    ps.Statement,
+			ReturnFields: fields,
+			BindVarTypes: bindVarTypes,
+			Stmt:         stmt,
+			Closed:       new(atomic.Bool),
+		}
+	}
+}
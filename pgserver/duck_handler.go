@@ -25,6 +25,7 @@ import (
 	"os"
 	"regexp"
 	"runtime/trace"
+	"slices"
 	"sync"
 	"time"
 
@@ -85,6 +86,28 @@ type DuckHandler struct {
 	readTimeout       time.Duration
 	encodeLoggedQuery bool
 	connectionHandler *ConnectionHandler
+	// profiling indicates whether the DuckDB query profiles should be captured, see ProfilingParameter.
+	profiling bool
+	// copyAppender indicates whether COPY FROM STDIN should load the data through the Appender, see CopyAppenderParameter.
+	copyAppender bool
+	// replicaMaxLag is the bound of the replication lag for the read queries, or nil if they never wait,
+	// see ReplicaMaxLagParameter.
+	replicaMaxLag *uint64
+	// resultLimit is the limit of the size of the results set by the session, or nil for the default of the server,
+	// see MaxResultSizeParameter.
+	resultLimit *uint64
+	// inTxnBlock indicates whether the session is in a transaction block started by BEGIN.
+	inTxnBlock bool
+	// txnFailed indicates whether a statement has failed in the current transaction block.
+	txnFailed bool
+	// localSettings holds the functions that restore the parameters changed by SET LOCAL in the current
+	// transaction block to their values before the first SET LOCAL. They are called when the transaction block ends.
+	localSettings map[string]func(ctx *sql.Context) error
+	// sequenceUse is the use of the sequences in the session, see lastSequence.
+	sequenceUse sequenceUse
+	// stats are the counters of pg_stat_database of the database of the session, see startSession.
+	stats        *databaseStats
+	sessionStart time.Time
 }
 
 func (h *DuckHandler) SetConnectionHandler(handler *ConnectionHandler) {
@@ -130,7 +153,7 @@ func (h *DuckHandler) ComExecuteBound(ctx context.Context, conn *mysql.Conn, por
 }
 
 // ComPrepareParsed implements the Handler interface.
-func (h *DuckHandler) ComPrepareParsed(ctx context.Context, c *mysql.Conn, query string, parsed tree.Statement) (*duckdb.Stmt, []uint32, []pgproto3.FieldDescription, error) {
+func (h *DuckHandler) ComPrepareParsed(ctx context.Context, c *mysql.Conn, query string, parsed tree.Statement, specifiedOIDs []uint32) (*duckdb.Stmt, []uint32, []pgproto3.FieldDescription, error) {
 	// In order to implement this correctly, we need to contribute to DuckDB's C API and go-duckdb
 	// to expose the parameter types and result types of a prepared statement.
 	// Currently, we have to work around this.
@@ -153,10 +176,16 @@ func (h *DuckHandler) ComPrepareParsed(ctx context.Context, c *mysql.Conn, query
 		return nil, nil, nil, err
 	}
 
+	if insert, ok := parsed.(*tree.Insert); ok {
+		if query, err = convertOnConflict(sqlCtx, query, insert); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
 	var (
-		stmt       *duckdb.Stmt
-		stmtType   duckdb.StmtType
-		paramTypes []duckdb.Type
+		stmt      *duckdb.Stmt
+		stmtType  duckdb.StmtType
+		paramOIDs []uint32
 	)
 	// This is a bit of a hack to get DuckDB's underlying prepared statement.
 	// But we know that the connection is a DuckDB connection and it is kept alive.
@@ -169,9 +198,9 @@ func (h *DuckHandler) ComPrepareParsed(ctx context.Context, c *mysql.Conn, query
 		n := s.NumInput()
 		stmt = s.(*duckdb.Stmt)
 		stmtType = stmt.StatementType()
-		paramTypes = make([]duckdb.Type, n)
-		for i := 0; i < n; i++ {
-			paramTypes[i] = stmt.ParamType(i + 1) // 1-based index
+		paramOIDs = make([]uint32, n)
+		for i := range paramOIDs {
+			paramOIDs[i] = pgtypes.ParameterOID(stmt.ParamType(i + 1)) // 1-based index
 		}
 		return nil
 	})
@@ -180,10 +209,28 @@ func (h *DuckHandler) ComPrepareParsed(ctx context.Context, c *mysql.Conn, query
 		return nil, nil, nil, err
 	}
 
-	paramOIDs := make([]uint32, len(paramTypes))
-	for i, t := range paramTypes {
-		paramOIDs[i] = pgtypes.DuckdbTypeToPostgresOID[t]
+	// https://www.postgresql.org/docs/current/protocol-flow.html#PROTOCOL-FLOW-EXT-QUERY
+	// > A parameter data type can be left unspecified by setting it to zero,
+	// > or by making the array of parameter type OIDs shorter than the number of
+	// > parameter symbols ($n)used in the query string.
+	// > ...
+	// > Parameter data types can be specified by OID;
+	// > if not given, the parser attempts to infer the data types in the same way
+	// > as it would do for untyped literal string constants.
+	if len(specifiedOIDs) > len(paramOIDs) {
+		stmt.Close()
+		return nil, nil, nil, newPgError("08P01", "%d parameter types were specified, but the statement has %d parameters", len(specifiedOIDs), len(paramOIDs))
+	}
+	// The parameters whose types DuckDB cannot determine are resolved when the values are bound,
+	// so the result types are probed with the values of the types that will be bound.
+	unresolved := make([]bool, len(paramOIDs))
+	for i, oid := range paramOIDs {
+		unresolved[i] = oid == pgtype.UnknownOID
+		if i < len(specifiedOIDs) && specifiedOIDs[i] != 0 {
+			paramOIDs[i] = specifiedOIDs[i]
+		}
 	}
+	inferParameterTypes(parsed, paramOIDs)
 
 	var (
 		fields []pgproto3.FieldDescription
@@ -203,8 +250,17 @@ func (h *DuckHandler) ComPrepareParsed(ctx context.Context, c *mysql.Conn, query
 			// Add LIMIT 0 to avoid executing the actual query.
 			query = "SELECT * FROM (" + sql.RemoveSpaceAndDelimiter(query, ';') + ") LIMIT 0"
 		}
-		params := make([]any, len(paramTypes)) // all nil
+		params := make([]any, len(paramOIDs)) // NULL for the resolved parameters
+		for i, oid := range paramOIDs {
+			if unresolved[i] {
+				params[i] = parameterProbeValue(oid)
+			}
+		}
 		rows, err = conn.QueryContext(sqlCtx, query, params...)
+		if err != nil && slices.Contains(unresolved, true) {
+			// The probe values may be rejected by the query, e.g., as the arguments of a table function, so fall back to NULLs.
+			rows, err = conn.QueryContext(sqlCtx, query, make([]any, len(paramOIDs))...)
+		}
 		if err != nil {
 			break
 		}
@@ -250,6 +306,7 @@ func (h *DuckHandler) ComResetConnection(c *mysql.Conn) error {
 
 	// Dispose of the connection's current session
 	h.maybeReleaseAllLocks(c)
+	h.endSession()
 	h.e.CloseSession(c.ConnectionID)
 
 	// Create a new session and set the current database
@@ -266,6 +323,9 @@ func (h *DuckHandler) ConnectionClosed(c *mysql.Conn) {
 	defer h.e.CloseSession(c.ConnectionID)
 
 	h.maybeReleaseAllLocks(c)
+	if provider := h.GetCatalogProvider(); provider != nil {
+		provider.Pool().UnrestrictTenants(c.ConnectionID)
+	}
 
 	logrus.WithField(sql.ConnectionIdLogField, c.ConnectionID).Infof("ConnectionClosed")
 }
@@ -347,7 +407,41 @@ func (h *DuckHandler) doQuery(ctx context.Context, c *mysql.Conn, query string,
 		}
 	}()
 
+	// The query waits until the scheduler admits it in the workload class of the session.
+	// The slot is held until all rows have been sent to the client.
+	switch parsed.(type) {
+	case *tree.BeginTransaction, *tree.CommitTransaction, *tree.RollbackTransaction, *tree.SetVar:
+		// The statements that change the session state only are never queued, see backend.DuckBuilder.Build.
+	default:
+		queryCtx := sqlCtx
+		if c, ok := ctx.(*sql.Context); ok && c != nil {
+			queryCtx = c
+		}
+		// Read queries wait for the replication before taking a slot, so that they do not hold it while waiting.
+		if err = h.waitForReplica(queryCtx, parsed); err != nil {
+			return err
+		}
+		var release func()
+		if release, err = sqlCtx.Session.(*backend.Session).AcquireQuerySlot(queryCtx); err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	var masking *queryMasking
+	if masking, err = checkMasking(sqlCtx, query, parsed); err != nil {
+		return err
+	}
+
+	countStatement(sqlCtx, parsed)
+	inTxnBlock, txnFailed := h.inTxnBlock, h.txnFailed
 	schema, rowIter, qFlags, err := queryExec(sqlCtx, query, parsed, stmt, vars)
+	h.trackTransaction(sqlCtx, parsed, err)
+	h.countTransaction(parsed, inTxnBlock, txnFailed, err)
+	h.trackSequence(sqlCtx, query, parsed, err)
+	if err == nil {
+		err = markFTSIndexesStale(sqlCtx, parsed)
+	}
 	if err != nil {
 		if printErrorStackTraces {
 			fmt.Printf("error running query: %+v\n", err)
@@ -356,9 +450,29 @@ func (h *DuckHandler) doQuery(ctx context.Context, c *mysql.Conn, query string,
 		return err
 	}
 
-	// If the query is "USE <database>", we need to update the current database in the session.
-	if currentSchema := sqlCtx.Session.(*backend.Session).CurrentSchemaOfUnderlyingConn(); len(currentSchema) > 0 {
-		sqlCtx.SetCurrentDatabase(currentSchema)
+	if !types.IsOkResultSchema(schema) && schema != nil {
+		var masked sql.RowIter
+		if masked, err = masking.maskResults(schema, rowIter); err != nil {
+			rowIter.Close(sqlCtx)
+			return err
+		}
+		rowIter = masked
+	}
+
+	if h.profiling {
+		// The profile is complete only after all rows have been sent to the client.
+		defer h.recordProfile(sqlCtx, query, start)
+	}
+
+	// A setting of DuckDB like `SET schema = 'xxx'` may switch the current schema of the connection,
+	// while `USE xxx` and `SET database = xxx` are handled by setDatabase.
+	if _, ok := parsed.(*tree.SetVar); ok {
+		sqlCtx.Session.(*backend.Session).SyncCurrentDatabase()
+	}
+
+	callback = h.countRows(parsed, callback)
+	if h.stats != nil {
+		defer func() { h.stats.activeTime.Add(time.Since(start).Microseconds()) }()
 	}
 
 	// create result before goroutines to avoid |ctx| racing
@@ -397,6 +511,79 @@ func (h *DuckHandler) doQuery(ctx context.Context, c *mysql.Conn, query string,
 	return callback(r)
 }
 
+// trackTransaction keeps track of the transaction block after a statement is executed.
+// A transaction ends with COMMIT or ROLLBACK even if they fail.
+func (h *DuckHandler) trackTransaction(ctx *sql.Context, parsed tree.Statement, err error) {
+	switch parsed.(type) {
+	case *tree.BeginTransaction:
+		if err == nil && !h.inTxnBlock {
+			h.inTxnBlock = true
+			h.txnFailed = false
+		}
+	case *tree.CommitTransaction, *tree.RollbackTransaction:
+		if h.inTxnBlock && h.connectionHandler != nil {
+			_, commit := parsed.(*tree.CommitTransaction)
+			h.connectionHandler.endCursorTxn(ctx, commit && err == nil)
+			h.connectionHandler.endSchemaChangeTxn(commit && err == nil && !h.txnFailed)
+		}
+		h.inTxnBlock = false
+		h.txnFailed = false
+		h.restoreLocalSettings(ctx)
+	}
+}
+
+// atomically runs fn in the transaction block of the session if there is one, or in a transaction of its own otherwise,
+// which is rolled back if fn fails.
+func (h *DuckHandler) atomically(ctx *sql.Context, fn func() error) error {
+	if h.inTxnBlock {
+		return fn()
+	}
+	if _, err := adapter.Exec(ctx, "BEGIN"); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if _, rollbackErr := adapter.Exec(ctx, "ROLLBACK"); rollbackErr != nil {
+			ctx.GetLogger().WithError(rollbackErr).Warn("Failed to roll back the transaction")
+		}
+		return err
+	}
+	_, err := adapter.Exec(ctx, "COMMIT")
+	return err
+}
+
+// txnStatus returns the transaction status of the session reported by ReadyForQuery.
+func (h *DuckHandler) txnStatus() ReadyForQueryTransactionIndicator {
+	switch {
+	case h.txnFailed:
+		return ReadyForQueryTransactionIndicator_FailedTransactionBlock
+	case h.inTxnBlock:
+		return ReadyForQueryTransactionIndicator_TransactionBlock
+	default:
+		return ReadyForQueryTransactionIndicator_Idle
+	}
+}
+
+// rememberLocalSetting records how to restore a parameter before it is changed by SET LOCAL,
+// unless it has been changed by SET LOCAL already in the current transaction block.
+func (h *DuckHandler) rememberLocalSetting(name string, restore func(ctx *sql.Context) error) {
+	if h.localSettings == nil {
+		h.localSettings = make(map[string]func(ctx *sql.Context) error)
+	}
+	if _, ok := h.localSettings[name]; !ok {
+		h.localSettings[name] = restore
+	}
+}
+
+// restoreLocalSettings reverts the parameters changed by SET LOCAL at the end of a transaction block.
+func (h *DuckHandler) restoreLocalSettings(ctx *sql.Context) {
+	for name, restore := range h.localSettings {
+		if err := restore(ctx); err != nil {
+			ctx.GetLogger().WithError(err).Warnf("Failed to restore parameter %q after SET LOCAL", name)
+		}
+	}
+	h.localSettings = nil
+}
+
 // QueryExecutor is a function that executes a query and returns the result as a schema and iterator. Either of
 // |parsed| or |analyzed| can be nil depending on the use case
 type QueryExecutor func(ctx *sql.Context, query string, parsed tree.Statement, stmt *duckdb.Stmt, vars []any) (sql.Schema, sql.RowIter, *sql.QueryFlags, error)
@@ -406,11 +593,6 @@ type QueryExecutor func(ctx *sql.Context, query string, parsed tree.Statement, s
 func (h *DuckHandler) executeQuery(ctx *sql.Context, query string, parsed tree.Statement, _ *duckdb.Stmt, _ []any) (sql.Schema, sql.RowIter, *sql.QueryFlags, error) {
 	// return h.e.QueryWithBindings(ctx, query, parsed, nil, nil)
 
-	sql.IncrementStatusVariable(ctx, "Questions", 1)
-	if _, ok := parsed.(tree.SelectStatement); ok {
-		sql.IncrementStatusVariable(ctx, "Com_select", 1)
-	}
-
 	var (
 		schema sql.Schema
 		iter   sql.RowIter
@@ -425,7 +607,42 @@ func (h *DuckHandler) executeQuery(ctx *sql.Context, query string, parsed tree.S
 	case *tree.BeginTransaction, *tree.CommitTransaction, *tree.RollbackTransaction,
 		*tree.CreateTable, *tree.DropTable, *tree.AlterTable, *tree.CreateIndex, *tree.DropIndex,
 		*tree.Insert, *tree.Update, *tree.Delete, *tree.Truncate, *tree.CopyFrom, *tree.CopyTo, *tree.SetVar:
+		var defaults []string
+		var serials []serialColumn
+		if ct, ok := parsed.(*tree.CreateTable); ok {
+			query, defaults, err = applyDomainConstraints(ctx, query, ct)
+			if err != nil {
+				break
+			}
+			query, serials, err = createSerialSequences(ctx, query, ct)
+			if err != nil {
+				break
+			}
+			for _, serial := range serials {
+				defaults = append(defaults, serial.setDefaultStmt(ct.Table.String()))
+			}
+		}
+		if insert, ok := parsed.(*tree.Insert); ok {
+			if query, err = convertOnConflict(ctx, query, insert); err != nil {
+				break
+			}
+		}
 		result, err = adapter.Exec(ctx, query)
+		if err != nil {
+			dropSerialSequences(ctx, serials)
+			break
+		}
+		switch stmt := parsed.(type) {
+		case *tree.CreateTable, *tree.Insert:
+			inheritColumnComments(ctx, stmt)
+		case *tree.DropTable:
+			dropOwnedSequences(ctx, stmt)
+		}
+		for _, stmt := range defaults {
+			if _, err = adapter.Exec(ctx, stmt); err != nil {
+				break
+			}
+		}
 		if err != nil {
 			break
 		}
@@ -623,16 +840,8 @@ func schemaToFieldDescriptions(ctx *sql.Context, s sql.Schema, resultFormatCodes
 				// > In simple Query mode, the format of retrieved values is always text, except ...
 				format = pgproto3.TextFormat
 			} else {
-				if resultFormatCodes != nil && len(resultFormatCodes) > 0 {
-					// Specified overall or per-column format codes
-					if len(resultFormatCodes) == 1 {
-						format = resultFormatCodes[0]
-					} else {
-						format = resultFormatCodes[i]
-					}
-				} else {
-					format = pgType.PG.Codec.PreferredFormat()
-				}
+				// The formats are given by the result format codes of Bind, see resultFormat.
+				format = resultFormat(resultFormatCodes, i)
 			}
 			size = int16(pgType.Size)
 		} else {
@@ -717,6 +926,9 @@ func (h *DuckHandler) resultForMax1RowIter(ctx *sql.Context, schema sql.Schema,
 	if err != nil {
 		return nil, err
 	}
+	if limit := h.maxResultSize(); limit > 0 && uint64(rowSize(outputRow)) > limit {
+		return nil, errResultTooLarge(limit)
+	}
 
 	ctx.GetLogger().Tracef("spooling result row %s", outputRow)
 
@@ -730,7 +942,12 @@ func (h *DuckHandler) resultForDefaultIter(ctx *sql.Context, schema sql.Schema,
 
 	eg, ctx := ctx.NewErrgroup()
 
-	var rowChan = make(chan sql.Row, 512)
+	// The rows are converted to wire format as soon as they are read, and buffered in the spool
+	// until they are sent, so that the buffering is bounded by their size rather than their number.
+	spool := newResultSpool(resultBufferSize, resultSpill)
+	defer spool.release()
+	limit := h.maxResultSize()
+	var okResult *types.OkResult
 
 	pan2err := func() {
 		if recoveredPanic := recover(); recoveredPanic != nil {
@@ -740,11 +957,13 @@ func (h *DuckHandler) resultForDefaultIter(ctx *sql.Context, schema sql.Schema,
 
 	wg := sync.WaitGroup{}
 	wg.Add(2)
-	// Read rows off the row iterator and send them to the row channel.
+	// Read rows off the row iterator, convert them to wire format, and add them to the spool.
 	eg.Go(func() error {
 		defer pan2err()
 		defer wg.Done()
-		defer close(rowChan)
+		defer spool.close()
+		var rows int
+		var size uint64
 		for {
 			select {
 			case <-ctx.Done():
@@ -757,10 +976,31 @@ func (h *DuckHandler) resultForDefaultIter(ctx *sql.Context, schema sql.Schema,
 				if err != nil {
 					return err
 				}
-				select {
-				case rowChan <- row:
-				case <-ctx.Done():
-					return nil
+				if types.IsOkResult(row) {
+					if rows > 0 {
+						panic("Got OkResult mixed with RowResult")
+					}
+					result := row[0].(types.OkResult)
+					okResult = &result
+					continue
+				}
+
+				outputRow, err := h.rowToBytes(ctx, schema, resultFields, row)
+				if err != nil {
+					return err
+				}
+				rowBytes := rowSize(outputRow)
+				rows++
+				size += uint64(rowBytes)
+				if limit > 0 && size > limit {
+					// The query is terminated early instead of reading the rest of the result.
+					return errResultTooLarge(limit)
+				}
+				if err := spool.put(ctx, Row{outputRow}, rowBytes); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					return err
 				}
 			}
 		}
@@ -777,60 +1017,61 @@ func (h *DuckHandler) resultForDefaultIter(ctx *sql.Context, schema sql.Schema,
 	timer := time.NewTimer(waitTime)
 	defer timer.Stop()
 
-	// reads rows from the channel, converts them to wire format,
-	// and calls |callback| to give them to vitess.
+	// reads rows from the spool, and calls |callback| to give them to the client
+	// in batches of at most rowsBatch rows or maxBatchBytes bytes.
 	eg.Go(func() error {
 		defer pan2err()
 		// defer cancelF()
 		defer wg.Done()
+		var batchBytes int64
 		for {
 			if r == nil {
 				r = &Result{Fields: resultFields}
 			}
-			if r.RowsAffected == rowsBatch {
+			if r.RowsAffected == rowsBatch || batchBytes >= maxBatchBytes {
 				if err := callback(r); err != nil {
 					return err
 				}
 				r = nil
+				batchBytes = 0
 				processedAtLeastOneBatch = true
 				continue
 			}
 
-			select {
-			case <-ctx.Done():
-				return nil
-			case row, ok := <-rowChan:
-				if !ok {
-					return nil
-				}
-				if types.IsOkResult(row) {
-					if len(r.Rows) > 0 {
-						panic("Got OkResult mixed with RowResult")
-					}
-					result := row[0].(types.OkResult)
+			row, ok, closed, err := spool.next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				ctx.GetLogger().Tracef("spooling result row %+v", row.val)
+				r.Rows = append(r.Rows, row)
+				r.RowsAffected++
+				batchBytes += rowSize(row.val)
+			} else if closed {
+				if okResult != nil {
 					r = &Result{
-						RowsAffected: result.RowsAffected,
+						RowsAffected: okResult.RowsAffected,
 					}
-					continue
-				}
-
-				outputRow, err := h.rowToBytes(ctx, schema, resultFields, row)
-				if err != nil {
-					return err
 				}
-
-				ctx.GetLogger().Tracef("spooling result row %+v", outputRow)
-				r.Rows = append(r.Rows, Row{outputRow})
-				r.RowsAffected++
-			case <-timer.C:
-				if h.readTimeout != 0 {
-					// Cancel and return so Vitess can call the CloseConnection callback
-					ctx.GetLogger().Tracef("connection timeout")
-					return fmt.Errorf("row read wait bigger than connection timeout")
+				return nil
+			} else {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-spool.added:
+				case <-timer.C:
+					if h.readTimeout != 0 {
+						// Cancel and return so Vitess can call the CloseConnection callback
+						ctx.GetLogger().Tracef("connection timeout")
+						return fmt.Errorf("row read wait bigger than connection timeout")
+					}
 				}
 			}
 			if !timer.Stop() {
-				<-timer.C
+				select {
+				case <-timer.C:
+				default:
+				}
 			}
 			timer.Reset(waitTime)
 		}
@@ -849,6 +1090,9 @@ func (h *DuckHandler) resultForDefaultIter(ctx *sql.Context, schema sql.Schema,
 		ctx.GetLogger().WithError(err).Warn("error running query")
 		returnErr = err
 	}
+	if spool.spilledBytes > 0 {
+		ctx.GetLogger().Debugf("Spilled %d bytes of the result to disk", spool.spilledBytes)
+	}
 
 	return
 }
@@ -0,0 +1,25 @@
+package pgserver
+
+import (
+	"context"
+
+	"github.com/apecloud/myduckserver/backend"
+)
+
+// handleExport executes `COPY ... TO 's3://...'`, which exports a table or a query to the object storage,
+// see backend.ExecExport. The tables restricted by the row-level security cannot be exported, the same as COPY TO.
+func (h *ConnectionHandler) handleExport(statement ConvertedStatement) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, statement.String)
+	if err != nil {
+		return err
+	}
+	ctx.SetLogger(ctx.GetLogger().WithField("query", statement.String))
+	if err := h.checkRowSecurity(ctx, statement.String); err != nil {
+		return err
+	}
+	rows, _, err := backend.ExecExport(ctx, h.duckHandler.e.Analyzer.Catalog.MySQLDb, statement.String)
+	if err != nil {
+		return err
+	}
+	return h.send(makeCommandComplete("COPY", int32(rows)))
+}
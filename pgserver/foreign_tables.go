@@ -0,0 +1,225 @@
+package pgserver
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+)
+
+// The foreign servers and the foreign tables of Postgres, on top of the ATTACH of DuckDB, see catalog/foreign_tables.go:
+//
+//   - `CREATE SERVER [IF NOT EXISTS] pg FOREIGN DATA WRAPPER postgres_fdw OPTIONS (host 'h', dbname 'db', user 'u', password 'p')`
+//     creates a server of Postgres. The wrappers mysql_fdw, sqlite_fdw (OPTIONS (database '/path/to/file.db')),
+//     and parquet_fdw are supported as well. The credentials are given in the options of the server,
+//     since there are no user mappings.
+//   - `CREATE FOREIGN TABLE [IF NOT EXISTS] orders (id int, total numeric(10,2)) SERVER pg OPTIONS (schema_name 'public', table_name 'orders')`
+//     creates a view of the remote table. The columns may be omitted, i.e., `()`, to take all columns of the remote table.
+//     A foreign table of a Parquet server reads the files of its `filename` option instead, e.g., OPTIONS (filename 's3://bucket/*.parquet').
+//   - `DROP FOREIGN TABLE [IF EXISTS] orders` and `DROP SERVER [IF EXISTS] pg [CASCADE]` drop them.
+
+var (
+	createServerRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+SERVER\s+(IF\s+NOT\s+EXISTS\s+)?(` + identifierPattern + `)` +
+		`(?:\s+TYPE\s+'[^']*')?(?:\s+VERSION\s+'[^']*')?\s+FOREIGN\s+DATA\s+WRAPPER\s+(` + identifierPattern + `)` +
+		`(?:\s+OPTIONS\s*\((.*)\))?[\s;]*$`)
+	dropServerRegex         = regexp.MustCompile(`(?is)^\s*DROP\s+SERVER\s+(IF\s+EXISTS\s+)?(.+?)(?:\s+(CASCADE|RESTRICT))?[\s;]*$`)
+	createForeignTableRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+FOREIGN\s+TABLE\s+(IF\s+NOT\s+EXISTS\s+)?` +
+		`(` + identifierPattern + `(?:\s*\.\s*` + identifierPattern + `)?)\s*\((.*?)\)\s*SERVER\s+(` + identifierPattern + `)` +
+		`(?:\s+OPTIONS\s*\((.*)\))?[\s;]*$`)
+	dropForeignTableRegex = regexp.MustCompile(`(?is)^\s*DROP\s+FOREIGN\s+TABLE\s+(IF\s+EXISTS\s+)?(.+?)(?:\s+(CASCADE|RESTRICT))?[\s;]*$`)
+	fdwOptionRegex        = regexp.MustCompile(`(?s)^\s*(` + identifierPattern + `)\s+'((?:[^']|'')*)'\s*(?:,|$)`)
+)
+
+// isForeignDDL reports whether the statement creates or drops a foreign server or a foreign table.
+func isForeignDDL(query string) bool {
+	return createServerRegex.MatchString(query) || dropServerRegex.MatchString(query) ||
+		createForeignTableRegex.MatchString(query) || dropForeignTableRegex.MatchString(query)
+}
+
+// parseFDWOptions parses the options of a foreign server or a foreign table, i.e., `key 'value', ...`.
+func parseFDWOptions(options string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	for rest := options; strings.TrimSpace(rest) != ""; {
+		m := fdwOptionRegex.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, newPgError("42601", "syntax error in OPTIONS at or near %q", strings.TrimSpace(rest))
+		}
+		key := unquoteIdentifier(m[1])
+		if _, ok := parsed[key]; ok {
+			return nil, newPgError("42710", `option "%s" provided more than once`, key)
+		}
+		parsed[key] = strings.ReplaceAll(m[2], "''", "'")
+		rest = rest[len(m[0]):]
+	}
+	return parsed, nil
+}
+
+// handleForeignDDL runs CREATE SERVER, DROP SERVER, CREATE FOREIGN TABLE, or DROP FOREIGN TABLE,
+// and returns the tag of its CommandComplete message.
+func (h *ConnectionHandler) handleForeignDDL(query string) (string, error) {
+	switch {
+	case createServerRegex.MatchString(query):
+		return "CREATE SERVER", h.createForeignServer(createServerRegex.FindStringSubmatch(query))
+	case dropServerRegex.MatchString(query):
+		return "DROP SERVER", h.dropForeignServers(dropServerRegex.FindStringSubmatch(query))
+	case createForeignTableRegex.MatchString(query):
+		return "CREATE FOREIGN TABLE", h.createForeignTable(createForeignTableRegex.FindStringSubmatch(query))
+	default:
+		return "DROP FOREIGN TABLE", h.dropForeignTables(dropForeignTableRegex.FindStringSubmatch(query))
+	}
+}
+
+func (h *ConnectionHandler) createForeignServer(m []string) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	name := unquoteIdentifier(m[2])
+	if s, err := catalog.LookupForeignServer(ctx, name); err != nil {
+		return err
+	} else if s != nil {
+		if m[1] != "" {
+			return nil
+		}
+		return newPgError("42710", `server "%s" already exists`, name)
+	}
+	wrapper, ok := catalog.ForeignWrapper(unquoteIdentifier(m[3]))
+	if !ok {
+		return newPgError("42704", `foreign-data wrapper "%s" does not exist`, unquoteIdentifier(m[3]))
+	}
+	options, err := parseFDWOptions(m[4])
+	if err != nil {
+		return err
+	}
+	return catalog.CreateForeignServer(ctx, &catalog.ForeignServer{Name: name, Wrapper: wrapper, Options: options})
+}
+
+func (h *ConnectionHandler) dropForeignServers(m []string) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	cascade := strings.EqualFold(m[3], "CASCADE")
+	for _, ident := range identifierRegex.FindAllString(m[2], -1) {
+		name := unquoteIdentifier(ident)
+		s, err := catalog.LookupForeignServer(ctx, name)
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			if m[1] != "" {
+				continue
+			}
+			return newPgError("42704", `server "%s" does not exist`, name)
+		}
+		if !cascade {
+			tables, err := catalog.ListForeignTables(ctx, name)
+			if err != nil {
+				return err
+			}
+			if len(tables) > 0 {
+				return newPgError("2BP01", `cannot drop server %s because foreign table %s.%s depends on it`,
+					name, tables[0].Schema, tables[0].Name)
+			}
+		}
+		if err := catalog.DropForeignServer(ctx, name, cascade); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *ConnectionHandler) createForeignTable(m []string) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	tn, err := parser.ParseQualifiedTableName(m[2])
+	if err != nil {
+		return err
+	}
+	t := &catalog.ForeignTable{Schema: tn.Schema(), Name: tn.Table()}
+	if t.Schema == "" {
+		t.Schema = adapter.GetCurrentSchema(ctx)
+	}
+	if exists, err := catalog.IsForeignTable(ctx, t.Schema, t.Name); err != nil {
+		return err
+	} else if exists {
+		if m[1] != "" {
+			return nil
+		}
+		return newPgError("42P07", `relation "%s" already exists`, t.Name)
+	}
+
+	t.Server = unquoteIdentifier(m[4])
+	server, err := catalog.LookupForeignServer(ctx, t.Server)
+	if err != nil {
+		return err
+	}
+	if server == nil {
+		return newPgError("42704", `server "%s" does not exist`, t.Server)
+	}
+	options, err := parseFDWOptions(m[5])
+	if err != nil {
+		return err
+	}
+	if t.Remote, err = server.RemoteTable(t.Name, options); err != nil {
+		return newPgError("HV00D", "%s", err.Error())
+	}
+
+	// The declared columns are parsed as the columns of a table, and cast to their types.
+	if strings.TrimSpace(m[3]) != "" {
+		stmt, err := parser.ParseOne("CREATE TABLE t (" + m[3] + ")")
+		if err != nil {
+			return err
+		}
+		for _, def := range stmt.AST.(*tree.CreateTable).Defs {
+			col, ok := def.(*tree.ColumnTableDef)
+			if !ok {
+				return newPgError("0A000", "constraints are not supported on foreign tables")
+			}
+			typ, _, err := duckDBType(ctx, col.Type)
+			if err != nil {
+				return err
+			}
+			name := catalog.QuoteIdentifierANSI(string(col.Name))
+			t.Columns = append(t.Columns, "CAST("+name+" AS "+typ+") AS "+name)
+		}
+	}
+	return catalog.CreateForeignTable(ctx, t)
+}
+
+func (h *ConnectionHandler) dropForeignTables(m []string) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Split(m[2], ",") {
+		tn, err := parser.ParseQualifiedTableName(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		schema := tn.Schema()
+		if schema == "" {
+			schema = adapter.GetCurrentSchema(ctx)
+		}
+		exists, err := catalog.IsForeignTable(ctx, schema, tn.Table())
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if m[1] != "" {
+				continue
+			}
+			return newPgError("42P01", `foreign table "%s" does not exist`, tn.Table())
+		}
+		if err := catalog.DropForeignTable(ctx, schema, tn.Table()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForeignDDLRegex(t *testing.T) {
+	m := createServerRegex.FindStringSubmatch(`CREATE SERVER IF NOT EXISTS "Pg" FOREIGN DATA WRAPPER postgres_fdw OPTIONS (host 'h', dbname 'db');`)
+	require.NotNil(t, m)
+	require.Equal(t, []string{"IF NOT EXISTS ", `"Pg"`, "postgres_fdw", "host 'h', dbname 'db'"}, m[1:])
+
+	m = createServerRegex.FindStringSubmatch(`create server files foreign data wrapper parquet_fdw`)
+	require.NotNil(t, m)
+	require.Equal(t, []string{"", "files", "parquet_fdw", ""}, m[1:])
+
+	m = dropServerRegex.FindStringSubmatch(`DROP SERVER IF EXISTS pg, "My Server" CASCADE;`)
+	require.NotNil(t, m)
+	require.Equal(t, []string{"IF EXISTS ", `pg, "My Server"`, "CASCADE"}, m[1:])
+
+	m = createForeignTableRegex.FindStringSubmatch(`CREATE FOREIGN TABLE s.orders (id int, total numeric(10,2)) SERVER pg OPTIONS (table_name 'orders')`)
+	require.NotNil(t, m)
+	require.Equal(t, []string{"", "s.orders", "id int, total numeric(10,2)", "pg", "table_name 'orders'"}, m[1:])
+
+	m = createForeignTableRegex.FindStringSubmatch(`CREATE FOREIGN TABLE events () SERVER files OPTIONS (filename '/data/*.parquet')`)
+	require.NotNil(t, m)
+	require.Equal(t, []string{"", "events", "", "files", "filename '/data/*.parquet'"}, m[1:])
+
+	m = dropForeignTableRegex.FindStringSubmatch(`DROP FOREIGN TABLE orders, s.events`)
+	require.NotNil(t, m)
+	require.Equal(t, []string{"", "orders, s.events", ""}, m[1:])
+
+	require.False(t, isForeignDDL(`CREATE TABLE orders (id int)`))
+	require.False(t, isForeignDDL(`DROP TABLE orders`))
+}
+
+func TestParseFDWOptions(t *testing.T) {
+	options, err := parseFDWOptions(`host 'localhost', "Port" '5432',password 'it''s'`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"host": "localhost", "Port": "5432", "password": "it's"}, options)
+
+	options, err = parseFDWOptions("")
+	require.NoError(t, err)
+	require.Empty(t, options)
+
+	_, err = parseFDWOptions(`host localhost`)
+	require.Error(t, err)
+	_, err = parseFDWOptions(`host 'a', host 'b'`)
+	require.Error(t, err)
+}
@@ -0,0 +1,470 @@
+package pgserver
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The full-text search compatibility layer, built on the fts extension of DuckDB:
+//
+//   - `CREATE INDEX name ON t USING gin (to_tsvector('english', title || ' ' || body))` builds the full-text index
+//     of `t` over the columns `title` and `body`, with the stemmer of the configuration.
+//     The documents are identified by the primary key of `t`, which must consist of a single column.
+//     A table has at most one full-text index. The writes to the table mark the index stale, and a stale index
+//     is rebuilt before the next search over it, see catalog.RefreshFTSIndexes.
+//   - `DROP INDEX name` drops the full-text index.
+//   - `to_tsvector(...) @@ to_tsquery(...)` (or plainto_tsquery, phraseto_tsquery, websearch_to_tsquery)
+//     becomes a BM25 match against the index, and `ts_rank(to_tsvector(...), to_tsquery(...))` becomes its score.
+//     The terms of a query are required unless they are combined with `|` (or `or` for websearch_to_tsquery).
+//     The negations and the phrases are matched as plain terms.
+//
+// The index of a match is the one whose columns include the columns of the tsvector.
+// The operands of the match are limited to the columns and the string literals for the tsvector,
+// and a string literal or a parameter for the tsquery.
+//
+// The MATCH ... AGAINST syntax of MySQL is rewritten over the same indexes, see backend/fts.go.
+
+// ftsStemmers maps the text search configurations of Postgres to the stemmers of the fts extension.
+var ftsStemmers = map[string]string{
+	"simple":     "none",
+	"arabic":     "arabic",
+	"basque":     "basque",
+	"catalan":    "catalan",
+	"danish":     "danish",
+	"dutch":      "dutch",
+	"english":    "english",
+	"finnish":    "finnish",
+	"french":     "french",
+	"german":     "german",
+	"greek":      "greek",
+	"hindi":      "hindi",
+	"hungarian":  "hungarian",
+	"indonesian": "indonesian",
+	"irish":      "irish",
+	"italian":    "italian",
+	"lithuanian": "lithuanian",
+	"nepali":     "nepali",
+	"norwegian":  "norwegian",
+	"portuguese": "portuguese",
+	"romanian":   "romanian",
+	"russian":    "russian",
+	"serbian":    "serbian",
+	"spanish":    "spanish",
+	"swedish":    "swedish",
+	"tamil":      "tamil",
+	"turkish":    "turkish",
+}
+
+// defaultFTSConfig is the default of the `default_text_search_config` setting of Postgres.
+const defaultFTSConfig = "english"
+
+// ftsColumns collects the columns referenced by an expression.
+type ftsColumns struct {
+	names []string
+}
+
+func (v *ftsColumns) VisitPre(expr tree.Expr) (recurse bool, newExpr tree.Expr) {
+	if name, ok := expr.(*tree.UnresolvedName); ok {
+		v.names = append(v.names, name.Parts[0])
+		return false, expr
+	}
+	return true, expr
+}
+
+func (v *ftsColumns) VisitPost(expr tree.Expr) tree.Expr {
+	return expr
+}
+
+// ftsIndexDefinition returns the columns and the stemmer of a `CREATE INDEX ... USING gin (to_tsvector(...))` statement.
+// ok is false if the statement does not create a full-text index.
+func ftsIndexDefinition(stmt tree.Statement) (columns []string, stemmer string, ok bool, err error) {
+	create, isCreate := stmt.(*tree.CreateIndex)
+	if !isCreate || !create.Inverted || len(create.Columns) == 0 {
+		return nil, "", false, nil
+	}
+	config := ""
+	v := &ftsColumns{}
+	for _, elem := range create.Columns {
+		fn, isFunc := elem.Expr.(*tree.FuncExpr)
+		if !isFunc || !strings.EqualFold(fn.Func.String(), "to_tsvector") || len(fn.Exprs) == 0 || len(fn.Exprs) > 2 {
+			return nil, "", false, nil
+		}
+		doc := fn.Exprs[0]
+		if len(fn.Exprs) == 2 {
+			s, isStr := fn.Exprs[0].(*tree.StrVal)
+			if !isStr || (config != "" && config != strings.ToLower(s.RawString())) {
+				return nil, "", true, newPgError("0A000", "a full-text index must use a single text search configuration")
+			}
+			config, doc = strings.ToLower(s.RawString()), fn.Exprs[1]
+		}
+		tree.WalkExpr(v, doc)
+	}
+	if len(v.names) == 0 {
+		return nil, "", true, newPgError("0A000", "a full-text index must reference at least one column")
+	}
+	if config == "" {
+		config = defaultFTSConfig
+	}
+	if stemmer, ok = ftsStemmers[config]; !ok {
+		return nil, "", true, newPgError("42704", `text search configuration "%s" does not exist`, config)
+	}
+	return v.names, stemmer, true, nil
+}
+
+// isFTSCreateIndex reports whether the statement creates a full-text index.
+func isFTSCreateIndex(stmt tree.Statement) bool {
+	_, _, ok, _ := ftsIndexDefinition(stmt)
+	return ok
+}
+
+// createFTSIndex builds the full-text index of a table and registers it.
+func (h *ConnectionHandler) createFTSIndex(create *tree.CreateIndex) error {
+	names, stemmer, _, err := ftsIndexDefinition(create)
+	if err != nil {
+		return err
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	schema, table, err := h.resolveHistoryTarget(ctx, create.Table.String())
+	if err != nil {
+		return err
+	}
+
+	var key string
+	for _, col := range table.Schema() {
+		if !col.PrimaryKey {
+			continue
+		}
+		if key != "" {
+			key = ""
+			break
+		}
+		key = col.Name
+	}
+	if key == "" {
+		return newPgError("0A000", `a full-text index requires a single-column primary key on relation "%s"`, table.Name())
+	}
+
+	var columns []string
+	for _, name := range names {
+		idx := table.Schema().IndexOfColName(name)
+		if idx < 0 {
+			return newPgError("42703", `column "%s" does not exist`, name)
+		}
+		if col := table.Schema()[idx].Name; !containsFold(columns, col) {
+			columns = append(columns, col)
+		}
+	}
+
+	name := string(create.Name)
+	if name == "" {
+		// The default name of Postgres for an index on an expression, e.g., docs_to_tsvector_idx.
+		name = table.Name() + "_to_tsvector_idx"
+	}
+	existing, err := catalog.LookupFTSIndexOfTable(ctx, schema, table.Name())
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Name != name {
+		return newPgError("0A000", `relation "%s" already has the full-text index "%s"`, table.Name(), existing.Name)
+	}
+	if existing != nil && create.IfNotExists {
+		return nil
+	}
+	return catalog.CreateFTSIndex(ctx, &catalog.FTSIndex{
+		Schema:  schema,
+		Table:   table.Name(),
+		Name:    name,
+		Key:     key,
+		Columns: columns,
+		Stemmer: stemmer,
+	})
+}
+
+// isFTSDropIndex reports whether the statement drops full-text indexes only.
+func (h *ConnectionHandler) isFTSDropIndex(stmt tree.Statement) (bool, error) {
+	drop, ok := stmt.(*tree.DropIndex)
+	if !ok || len(drop.IndexList) == 0 {
+		return false, nil
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return false, err
+	}
+	indexes, err := catalog.LoadFTSIndexes(ctx)
+	if err != nil || len(indexes) == 0 {
+		return false, err
+	}
+	for _, tn := range drop.IndexList {
+		if findFTSIndex(indexes, tn) == nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// dropFTSIndexes drops the full-text indexes and unregisters them.
+func (h *ConnectionHandler) dropFTSIndexes(drop *tree.DropIndex) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	indexes, err := catalog.LoadFTSIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tn := range drop.IndexList {
+		index := findFTSIndex(indexes, tn)
+		if index == nil {
+			return newPgError("42704", `index "%s" does not exist`, tn.Index)
+		}
+		if err := catalog.DropFTSIndex(ctx, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findFTSIndex returns the full-text index with the given name, which may be qualified by a schema.
+func findFTSIndex(indexes []catalog.FTSIndex, tn *tree.TableIndexName) *catalog.FTSIndex {
+	// `DROP INDEX s.idx` is parsed as the index `idx` of the table `s`, which is the schema in Postgres.
+	schema := tn.Table.Table()
+	for i, index := range indexes {
+		if index.Name == string(tn.Index) && (schema == "" || index.Schema == schema) {
+			return &indexes[i]
+		}
+	}
+	return nil
+}
+
+// markFTSIndexesStale marks the full-text indexes of the tables written by a statement stale,
+// in the transaction of the statement.
+func markFTSIndexesStale(ctx *sql.Context, stmt tree.Statement) error {
+	var tables []tree.TableExpr
+	switch stmt := stmt.(type) {
+	case *tree.Insert:
+		tables = append(tables, stmt.Table)
+	case *tree.Update:
+		tables = append(tables, stmt.Table)
+	case *tree.Delete:
+		tables = append(tables, stmt.Table)
+	case *tree.Truncate:
+		for i := range stmt.Tables {
+			tables = append(tables, &stmt.Tables[i])
+		}
+	case *tree.CopyFrom:
+		tables = append(tables, &stmt.Table)
+	}
+	for _, table := range tables {
+		if aliased, ok := table.(*tree.AliasedTableExpr); ok {
+			table = aliased.Expr
+		}
+		tn, ok := table.(*tree.TableName)
+		if !ok {
+			continue
+		}
+		if err := catalog.MarkFTSIndexStale(ctx, tn.Schema(), tn.Table()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// precompile a regex to detect the full-text search quickly
+var fullTextSearchRegex = regexp.MustCompile(`(?i)@@|\bts_rank(?:_cd)?\s*\(`)
+
+// tsvectorPattern matches `to_tsvector([config,] document)`, where the document consists of columns and string literals.
+const tsvectorPattern = `to_tsvector\s*\(\s*(?:'(?:[^']|'')*'\s*,\s*)?((?:[^()';]|'(?:[^']|'')*')+?)\s*\)`
+
+// tsqueryPattern matches `to_tsquery([config,] query)` and its variants, where the query is a string literal or a parameter.
+const tsqueryPattern = `(to_tsquery|plainto_tsquery|phraseto_tsquery|websearch_to_tsquery)\s*\(\s*(?:'(?:[^']|'')*'\s*,\s*)?('(?:[^']|'')*'|\$\d+)\s*\)`
+
+// precompile a regex to match "to_tsvector(...) @@ to_tsquery(...)"
+var tsMatchRegex = regexp.MustCompile(`(?i)\b` + tsvectorPattern + `\s*@@\s*` + tsqueryPattern)
+
+// precompile a regex to match "ts_rank(to_tsvector(...), to_tsquery(...) [, normalization])"
+var tsRankRegex = regexp.MustCompile(`(?i)\bts_rank(?:_cd)?\s*\(\s*` + tsvectorPattern + `\s*,\s*` + tsqueryPattern + `\s*(?:,\s*\d+\s*)?\)`)
+
+// precompile a regex to match the operators of tsquery
+var tsqueryOperatorRegex = regexp.MustCompile(`<\d*->|:\*|[&|!()]`)
+
+// precompile a regex to match the "or" of websearch_to_tsquery
+var websearchOrRegex = regexp.MustCompile(`(?i)\bor\b`)
+
+// convertFullTextSearch rewrites the full-text search in the query into the BM25 matches of the fts extension.
+func (h *ConnectionHandler) convertFullTextSearch(query string) (string, error) {
+	if !tsMatchRegex.MatchString(query) && !tsRankRegex.MatchString(query) {
+		return query, nil
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return "", err
+	}
+	indexes, err := catalog.LoadFTSIndexes(ctx)
+	if err != nil {
+		return "", err
+	}
+	query, used, err := rewriteFullTextSearch(query, indexes, adapter.GetCurrentSchema(ctx))
+	if err != nil {
+		return "", err
+	}
+	return query, catalog.RefreshFTSIndexes(ctx, used)
+}
+
+// rewriteFullTextSearch rewrites the full-text search in the query with the given full-text indexes,
+// and returns the indexes searched by the query.
+func rewriteFullTextSearch(query string, indexes []catalog.FTSIndex, currentSchema string) (string, []*catalog.FTSIndex, error) {
+	var rewriteErr error
+	var used []*catalog.FTSIndex
+	rewrite := func(re *regexp.Regexp, format func(match string) string) {
+		query = re.ReplaceAllStringFunc(query, func(s string) string {
+			m := re.FindStringSubmatch(s)
+			match, index, err := ftsMatch(query, m[1], strings.ToLower(m[2]), m[3], indexes, currentSchema)
+			if err != nil {
+				if rewriteErr == nil {
+					rewriteErr = err
+				}
+				return s
+			}
+			if !slices.Contains(used, index) {
+				used = append(used, index)
+			}
+			return format(match)
+		})
+	}
+	rewrite(tsRankRegex, func(match string) string { return "coalesce(" + match + ", 0)" })
+	rewrite(tsMatchRegex, func(match string) string { return "(" + match + " IS NOT NULL)" })
+	if rewriteErr != nil {
+		return "", nil, rewriteErr
+	}
+	return query, used, nil
+}
+
+// ftsMatch returns the BM25 match of a document against a query.
+func ftsMatch(query, document, function, operand string, indexes []catalog.FTSIndex, currentSchema string) (string, *catalog.FTSIndex, error) {
+	var qualifier string
+	var columns []string
+	forEachUnquoted(document, func(segment string, quoted bool) {
+		if quoted {
+			return
+		}
+		for _, ref := range qualifiedIdentifierRegex.FindAllString(segment, -1) {
+			parts := identifierRegex.FindAllString(ref, -1)
+			if len(parts) > 1 {
+				qualifier = strings.Join(parts[:len(parts)-1], ".")
+			}
+			columns = append(columns, unquoteIdentifier(parts[len(parts)-1]))
+		}
+	})
+	if len(columns) == 0 {
+		return "", nil, newPgError("0A000", "full-text search requires a document over the columns of a table")
+	}
+
+	index, err := resolveFTSIndex(query, qualifier, columns, indexes, currentSchema)
+	if err != nil {
+		return "", nil, err
+	}
+	var fields []string
+	for _, column := range index.Columns {
+		if containsFold(columns, column) {
+			fields = append(fields, column)
+		}
+	}
+	if len(fields) == len(index.Columns) {
+		fields = nil
+	}
+
+	conjunctive := true
+	if strings.HasPrefix(operand, "$") {
+		operand = "CAST(" + operand + " AS VARCHAR)"
+	} else {
+		text := strings.ReplaceAll(operand[1:len(operand)-1], "''", "'")
+		switch function {
+		case "to_tsquery":
+			conjunctive = !strings.Contains(text, "|")
+			text = tsqueryOperatorRegex.ReplaceAllString(text, " ")
+		case "websearch_to_tsquery":
+			conjunctive = !websearchOrRegex.MatchString(text)
+			text = websearchOrRegex.ReplaceAllString(strings.NewReplacer(`"`, " ", "-", " ").Replace(text), " ")
+		}
+		operand = "'" + strings.ReplaceAll(strings.Join(strings.Fields(text), " "), "'", "''") + "'"
+	}
+
+	keyRef := catalog.QuoteIdentifierANSI(index.Key)
+	if qualifier != "" {
+		keyRef = qualifier + "." + keyRef
+	}
+	return catalog.FTSMatchExpr(index.Schema, index.Table, keyRef, operand, fields, conjunctive), index, nil
+}
+
+// resolveFTSIndex returns the full-text index that covers the columns of a document.
+// If several indexes do, the one of the table named by the qualifier or the query is preferred,
+// and then the one in the current schema.
+func resolveFTSIndex(query, qualifier string, columns []string, indexes []catalog.FTSIndex, currentSchema string) (*catalog.FTSIndex, error) {
+	var candidates []*catalog.FTSIndex
+	for i, index := range indexes {
+		covered := true
+		for _, column := range columns {
+			if !containsFold(index.Columns, column) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			candidates = append(candidates, &indexes[i])
+		}
+	}
+	prefer := func(pred func(*catalog.FTSIndex) bool) {
+		var preferred []*catalog.FTSIndex
+		for _, index := range candidates {
+			if pred(index) {
+				preferred = append(preferred, index)
+			}
+		}
+		if len(preferred) > 0 {
+			candidates = preferred
+		}
+	}
+	if qualifier != "" {
+		table := unquoteIdentifier(lastIdentifier(qualifier))
+		prefer(func(index *catalog.FTSIndex) bool { return strings.EqualFold(index.Table, table) })
+	}
+	if len(candidates) > 1 {
+		prefer(func(index *catalog.FTSIndex) bool {
+			return regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(index.Table) + `\b`).MatchString(query)
+		})
+	}
+	if len(candidates) > 1 {
+		prefer(func(index *catalog.FTSIndex) bool { return index.Schema == currentSchema })
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, newPgError("0A000", "no full-text index covers the columns %s", strings.Join(columns, ", "))
+	case 1:
+		return candidates[0], nil
+	default:
+		return nil, newPgError("0A000", "full-text search over the columns %s is ambiguous", strings.Join(columns, ", "))
+	}
+}
+
+// precompile a regex to match a possibly qualified identifier
+var qualifiedIdentifierRegex = regexp.MustCompile(identifierPattern + `(?:\s*\.\s*` + identifierPattern + `)*`)
+
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
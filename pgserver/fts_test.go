@@ -0,0 +1,110 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFTSIndexDefinition(t *testing.T) {
+	tests := []struct {
+		query   string
+		ok      bool
+		columns []string
+		stemmer string
+		err     bool
+	}{
+		{"CREATE INDEX docs_fts ON docs USING gin (to_tsvector('english', title || ' ' || body))", true, []string{"title", "body"}, "english", false},
+		{"CREATE INDEX ON docs USING gin (to_tsvector('simple', body))", true, []string{"body"}, "none", false},
+		{"CREATE INDEX ON docs USING gin (to_tsvector(body))", true, []string{"body"}, "english", false},
+		{"CREATE INDEX ON docs USING gin (to_tsvector('klingon', body))", true, nil, "", true},
+		{"CREATE INDEX ON docs USING gin (tags)", false, nil, "", false},
+		{"CREATE INDEX ON docs (title)", false, nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tt.query)
+			require.NoError(t, err)
+			columns, stemmer, ok, err := ftsIndexDefinition(stmt.AST)
+			require.Equal(t, tt.ok, ok)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.columns, columns)
+			require.Equal(t, tt.stemmer, stemmer)
+		})
+	}
+}
+
+func TestRewriteFullTextSearch(t *testing.T) {
+	indexes := []catalog.FTSIndex{
+		{Schema: "public", Table: "docs", Name: "docs_fts", Key: "id", Columns: []string{"title", "body"}},
+		{Schema: "public", Table: "notes", Name: "notes_fts", Key: "note_id", Columns: []string{"body"}},
+	}
+	tests := []struct {
+		query    string
+		expected string
+		err      bool
+	}{
+		{
+			"SELECT id FROM docs WHERE to_tsvector('english', title || ' ' || body) @@ to_tsquery('english', 'cat & dog')",
+			`SELECT id FROM docs WHERE ("fts_public_docs".match_bm25("id", 'cat dog', conjunctive := 1) IS NOT NULL)`,
+			false,
+		},
+		{
+			"SELECT id FROM docs WHERE to_tsvector(title) @@ to_tsquery('cat | dog')",
+			`SELECT id FROM docs WHERE ("fts_public_docs".match_bm25("id", 'cat dog', fields := 'title') IS NOT NULL)`,
+			false,
+		},
+		{
+			"SELECT d.id, ts_rank(to_tsvector(d.body), plainto_tsquery($1)) AS rank FROM docs d ORDER BY rank DESC",
+			`SELECT d.id, coalesce("fts_public_docs".match_bm25(d."id", CAST($1 AS VARCHAR), fields := 'body', conjunctive := 1), 0) AS rank FROM docs d ORDER BY rank DESC`,
+			false,
+		},
+		{
+			"SELECT * FROM notes WHERE to_tsvector(body) @@ websearch_to_tsquery('cats or dogs')",
+			`SELECT * FROM notes WHERE ("fts_public_notes".match_bm25("note_id", 'cats dogs') IS NOT NULL)`,
+			false,
+		},
+		{
+			// Both of the indexes cover `body`, and neither table is named by the query.
+			"SELECT * FROM v WHERE to_tsvector(body) @@ to_tsquery('cat')",
+			"",
+			true,
+		},
+		{
+			"SELECT * FROM docs WHERE to_tsvector(summary) @@ to_tsquery('cat')",
+			"",
+			true,
+		},
+		{
+			"SELECT '{\"a\": 1}'::jsonb @@ '$.a == 1'",
+			"SELECT '{\"a\": 1}'::jsonb @@ '$.a == 1'",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rewritten, _, err := rewriteFullTextSearch(tt.query, indexes, "public")
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, rewritten)
+		})
+	}
+
+	// The indexes searched by a query are refreshed before it runs, once each.
+	_, used, err := rewriteFullTextSearch(
+		"SELECT ts_rank(to_tsvector(body), to_tsquery('cat')) FROM notes WHERE to_tsvector(body) @@ to_tsquery('cat')",
+		indexes, "public",
+	)
+	require.NoError(t, err)
+	require.Len(t, used, 1)
+	require.Same(t, &indexes[1], used[0])
+}
@@ -0,0 +1,247 @@
+package pgserver
+
+import (
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The history mode of the replicated tables, see catalog.CreateHistoryTableStmt:
+//
+//   - `SELECT myduck_enable_history('t')` creates the history table of `t` and starts recording its changes.
+//   - `SELECT myduck_disable_history('t')` stops recording the changes of `t`. The history table is kept.
+//   - `SELECT ... FROM t FOR SYSTEM_TIME AS OF '<timestamp>'` reads the state of `t` at the given time.
+//     The history starts when the history mode is enabled, so there are no rows before that.
+//
+// The changes are recorded by the delta pipeline, i.e., only the changes made by the replication are recorded.
+
+// precompile a regex to match "select myduck_enable_history('xxx');" or "select myduck_disable_history('xxx');"
+var myduckHistoryFuncRegex = regexp.MustCompile(`(?i)^\s*select\s+(pg_catalog\.)?myduck_(enable|disable)_history\(\s*'((?:[^']|'')+)'\s*\)\s*;?\s*$`)
+
+// identifierPattern matches a possibly quoted identifier.
+const identifierPattern = `(?:"(?:[^"]|"")+"|[A-Za-z_][\w$]*)`
+
+// precompile a regex to match "xxx FOR SYSTEM_TIME AS OF [TIMESTAMP] 'yyy'"
+var forSystemTimeRegex = regexp.MustCompile(`(?i)(` + identifierPattern + `(?:\s*\.\s*` + identifierPattern + `)?)\s+FOR\s+SYSTEM_TIME\s+AS\s+OF\s+(?:TIMESTAMP\s+)?('(?:[^']|'')*')`)
+
+// precompile a regex to match the alias of a table reference
+var tableAliasRegex = regexp.MustCompile(`(?i)^\s+(AS\s+)?(` + identifierPattern + `)`)
+
+// nonAliasKeywords are the keywords that may follow a table reference without an alias.
+var nonAliasKeywords = []string{
+	"cross", "except", "fetch", "for", "full", "group", "having", "inner", "intersect", "join", "left",
+	"limit", "natural", "offset", "on", "order", "qualify", "right", "union", "using", "where", "window",
+}
+
+// historyTable is a table in history mode.
+type historyTable struct {
+	schema       string
+	table        string
+	historyTable string
+	keyColumns   []string
+}
+
+// resolveHistoryTarget resolves a possibly qualified table name to the schema and the name of the table,
+// looking the table up in the current schema if the name is not qualified.
+func (h *ConnectionHandler) resolveHistoryTarget(ctx *sql.Context, name string) (schema string, table sql.Table, err error) {
+	tn, err := parser.ParseQualifiedTableName(name)
+	if err != nil {
+		return "", nil, err
+	}
+	cat := h.duckHandler.e.Analyzer.Catalog
+	for _, schema := range copyTargetSchemas(ctx, tn.Schema()) {
+		db, err := cat.Database(ctx, schema)
+		if sql.ErrDatabaseNotFound.Is(err) {
+			continue
+		} else if err != nil {
+			return "", nil, err
+		}
+		table, _, err := cat.DatabaseTable(ctx, db, tn.Table())
+		if err == nil {
+			return db.Name(), table, nil
+		} else if !sql.ErrTableNotFound.Is(err) {
+			return "", nil, err
+		}
+	}
+	return "", nil, newPgError("42P01", `relation "%s" does not exist`, name)
+}
+
+// lookupHistoryTable returns the history mode of the table, or nil if the table is not in history mode.
+func lookupHistoryTable(ctx *sql.Context, schema, table string) (*historyTable, error) {
+	var historyName, keyColumns string
+	if err := adapter.QueryRowCatalog(ctx,
+		catalog.InternalTables.HistoryTables.SelectColumnsStmt([]string{"history_table", "key_columns"}),
+		schema, table,
+	).Scan(&historyName, &keyColumns); err != nil {
+		if errors.Is(err, stdsql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	ht := &historyTable{schema: schema, table: table, historyTable: historyName}
+	if err := json.Unmarshal([]byte(keyColumns), &ht.keyColumns); err != nil {
+		return nil, err
+	}
+	return ht, nil
+}
+
+// setHistoryMode enables or disables the history mode of a table, and returns the name of its history table.
+func (h *ConnectionHandler) setHistoryMode(name string, enabled bool) (string, error) {
+	if h.duckHandler.inTxnBlock {
+		return "", newPgError("25001", "the history mode cannot be changed inside a transaction block")
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return "", err
+	}
+	schema, table, err := h.resolveHistoryTarget(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	ht, err := lookupHistoryTable(ctx, schema, table.Name())
+	if err != nil {
+		return "", err
+	}
+
+	if !enabled {
+		if ht == nil {
+			return "", newPgError("55000", `table "%s" is not in history mode`, table.Name())
+		}
+		if _, err := adapter.ExecCatalog(ctx, catalog.InternalTables.HistoryTables.DeleteStmt(), schema, table.Name()); err != nil {
+			return "", err
+		}
+		return ht.historyTable, nil
+	}
+
+	if ht != nil {
+		return "", newPgError("55000", `table "%s" is already in history mode`, table.Name())
+	}
+	// Without a primary key, the history of a row cannot be told from the history of another.
+	var keyColumns []string
+	if pkTable, ok := table.(sql.PrimaryKeyTable); ok {
+		pkSchema := pkTable.PrimaryKeySchema()
+		for _, i := range pkSchema.PkOrdinals {
+			keyColumns = append(keyColumns, pkSchema.Schema[i].Name)
+		}
+	}
+	if len(keyColumns) == 0 {
+		return "", newPgError("55000", `table "%s" has no primary key`, table.Name())
+	}
+	keys, err := json.Marshal(keyColumns)
+	if err != nil {
+		return "", err
+	}
+
+	historyName := catalog.HistoryTableName(table.Name())
+	// The history table and the registration are created atomically,
+	// so that the delta pipeline never sees a table in history mode without its history table.
+	for _, stmt := range []struct {
+		query string
+		args  []any
+	}{
+		{catalog.CreateHistoryTableStmt(schema, table.Name()), nil},
+		{"INSERT INTO " + catalog.InternalTables.HistoryTables.QualifiedName() + " VALUES (?, ?, ?, ?, now())",
+			[]any{schema, table.Name(), historyName, string(keys)}},
+	} {
+		if _, err := adapter.ExecCatalogInTxn(ctx, stmt.query, stmt.args...); err != nil {
+			if tx := adapter.TryGetTxn(ctx); tx != nil {
+				tx.Rollback()
+				adapter.CloseTxn(ctx)
+			}
+			return "", err
+		}
+	}
+	if err := adapter.CommitAndCloseTxn(ctx); err != nil {
+		return "", err
+	}
+	return historyName, nil
+}
+
+// convertForSystemTime rewrites the `FOR SYSTEM_TIME AS OF` clauses of a query into subqueries
+// that reconstruct the state of the tables from their history tables.
+func (h *ConnectionHandler) convertForSystemTime(query string) (string, error) {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range forSystemTimeRegex.FindAllStringSubmatchIndex(query, -1) {
+		name, asOf := query[m[2]:m[3]], query[m[4]:m[5]]
+		schema, table, err := h.resolveHistoryTarget(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		ht, err := lookupHistoryTable(ctx, schema, table.Name())
+		if err != nil {
+			return "", err
+		}
+		if ht == nil {
+			return "", newPgError("55000", `table "%s" is not in history mode`, table.Name())
+		}
+		subquery, err := ht.asOfQuery(ctx, asOf+"::TIMESTAMPTZ")
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(query[last:m[0]])
+		b.WriteString("(")
+		b.WriteString(subquery)
+		b.WriteString(")")
+		last = m[1]
+		// Keep the alias of the table reference, or alias the subquery with the name of the table.
+		if alias := tableAliasRegex.FindStringSubmatch(query[last:]); alias == nil ||
+			(alias[1] == "" && slices.Contains(nonAliasKeywords, strings.ToLower(alias[2]))) {
+			b.WriteString(" AS ")
+			b.WriteString(catalog.QuoteIdentifierANSI(table.Name()))
+		}
+	}
+	b.WriteString(query[last:])
+	return b.String(), nil
+}
+
+// asOfQuery returns the query that reconstructs the state of the table at the given time.
+func (ht *historyTable) asOfQuery(ctx *sql.Context, asOf string) (string, error) {
+	rows, err := adapter.QueryCatalog(ctx,
+		"SELECT column_name FROM duckdb_columns() WHERE schema_name = ? AND table_name = ? ORDER BY column_index",
+		ht.schema, ht.historyTable,
+	)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return "", err
+		}
+		if !slices.ContainsFunc(catalog.HistoryColumns, func(c struct{ Name, Type string }) bool { return c.Name == name }) {
+			columns = append(columns, catalog.QuoteIdentifierANSI(name))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		return "", fmt.Errorf("history table %s.%s does not exist", ht.schema, ht.historyTable)
+	}
+
+	keys := make([]string, len(ht.keyColumns))
+	for i, key := range ht.keyColumns {
+		keys[i] = catalog.QuoteIdentifierANSI(key)
+	}
+	return catalog.HistoryAsOfQuery(ht.schema, ht.historyTable, columns, keys, asOf), nil
+}
@@ -2,13 +2,11 @@ package pgserver
 
 import (
 	"context"
-	stdsql "database/sql"
-	"errors"
 	"fmt"
 	"regexp"
 	"strings"
 
-	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/backend"
 	"github.com/apecloud/myduckserver/catalog"
 	"github.com/apecloud/myduckserver/pgserver/pgconfig"
 	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
@@ -16,57 +14,9 @@ import (
 	"github.com/jackc/pgx/v5/pgproto3"
 )
 
-// precompile a regex to match "select pg_catalog.pg_is_in_recovery();"
-var pgIsInRecoveryRegex = regexp.MustCompile(`(?i)^\s*select\s+pg_catalog\.pg_is_in_recovery\(\s*\)\s*;?\s*$`)
-
-// precompile a regex to match "select pg_catalog.pg_current_wal_lsn();" or "select pg_catalog.pg_last_wal_replay_lsn();"
-var pgWALLSNRegex = regexp.MustCompile(`(?i)^\s*select\s+pg_catalog\.(pg_current_wal_lsn|pg_last_wal_replay_lsn)\(\s*\)\s*;?\s*$`)
-
 // precompile a regex to match "select pg_catalog.current_setting('xxx');".
 var currentSettingRegex = regexp.MustCompile(`(?i)^\s*select\s+(pg_catalog.)?current_setting\(\s*'([^']+)'\s*\)\s*;?\s*$`)
 
-// isInRecovery will get the count of
-func (h *ConnectionHandler) isInRecovery() (string, error) {
-	// Grab a sql.Context.
-	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
-	if err != nil {
-		return "f", err
-	}
-	var count int
-	if err := adapter.QueryRow(ctx, catalog.InternalTables.PgSubscription.CountAllStmt()).Scan(&count); err != nil {
-		return "f", err
-	}
-
-	if count == 0 {
-		return "f", nil
-	} else {
-		return "t", nil
-	}
-}
-
-// readOneWALPositionStr reads one of the recorded WAL position from the WAL position table
-func (h *ConnectionHandler) readOneWALPositionStr() (string, error) {
-	// Grab a sql.Context.
-	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
-	if err != nil {
-		return "0/0", err
-	}
-
-	// TODO(neo.zty): needs to be fixed
-	var subscription, conn, publication, lsn string
-	var enabled bool
-
-	if err := adapter.QueryRow(ctx, catalog.InternalTables.PgSubscription.SelectAllStmt()).Scan(&subscription, &conn, &publication, &lsn, &enabled); err != nil {
-		if errors.Is(err, stdsql.ErrNoRows) {
-			// if no lsn is stored, return 0
-			return "0/0", nil
-		}
-		return "0/0", err
-	}
-
-	return lsn, nil
-}
-
 // queryPGSetting will query the system variable value from the system variable map
 func (h *ConnectionHandler) queryPGSetting(name string) (any, error) {
 	sysVar, _, ok := sql.SystemVariables.GetGlobal(name)
@@ -86,39 +36,115 @@ func (h *ConnectionHandler) queryPGSetting(name string) (any, error) {
 
 // setPgSessionVar will set the session variable to the value provided for pg.
 // And reply with the CommandComplete and ParameterStatus messages.
-func (h *ConnectionHandler) setPgSessionVar(name string, value any, useDefault bool, tag string) (bool, error) {
+// If local is true, the previous value is restored at the end of the current transaction block (SET LOCAL).
+func (h *ConnectionHandler) setPgSessionVar(name string, value any, useDefault bool, local bool, tag string) (bool, error) {
+	if _, _, ok := sql.SystemVariables.GetGlobal(name); !ok {
+		return false, fmt.Errorf("error: %s variable was not found", name)
+	}
+	if local && !h.duckHandler.inTxnBlock {
+		return true, h.ignoreSetLocal(tag)
+	}
+	v, err := h.applyPgSessionVar(name, value, useDefault, local)
+	if err != nil {
+		return false, err
+	}
+	// Sent CommandComplete message
+	err = h.send(makeCommandComplete(tag, 0))
+	if err != nil {
+		return true, err
+	}
+	// Sent ParameterStatus message
+	if err := h.sendParameterStatus(name, fmt.Sprintf("%v", v)); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// applyPgSessionVar sets the session variable to the value provided for pg, and returns the new value.
+// If local is true, the previous value is restored at the end of the current transaction block.
+func (h *ConnectionHandler) applyPgSessionVar(name string, value any, useDefault bool, local bool) (any, error) {
 	sysVar, _, ok := sql.SystemVariables.GetGlobal(name)
 	if !ok {
-		return false, fmt.Errorf("error: %s variable was not found", name)
+		return nil, fmt.Errorf("error: %s variable was not found", name)
 	}
 	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	if useDefault {
 		value = sysVar.GetDefault()
+	} else if p, ok := sysVar.(*pgconfig.Parameter); ok {
+		if s, ok := value.(string); ok {
+			if value, err = parsePgSetting(p, s); err != nil {
+				return nil, err
+			}
+		}
 	}
-	err = sysVar.GetSessionScope().SetValue(ctx, name, value)
-	if err != nil {
-		return false, err
+	if local {
+		previous, err := ctx.GetSessionVariable(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		h.duckHandler.rememberLocalSetting(name, func(ctx *sql.Context) error {
+			if err := ctx.SetSessionVariable(ctx, name, previous); err != nil {
+				return err
+			}
+			return h.sendParameterStatus(name, fmt.Sprintf("%v", previous))
+		})
+	}
+	if err := sysVar.GetSessionScope().SetValue(ctx, name, value); err != nil {
+		return nil, err
+	}
+	if !local {
+		// A session-level SET overrides any SET LOCAL of the same parameter when the transaction block ends.
+		delete(h.duckHandler.localSettings, name)
 	}
 	v, err := sysVar.GetSessionScope().GetValue(ctx, name, sql.Collation_Default)
 	if err != nil {
-		return false, fmt.Errorf("error: %s variable was not found, err: %w", name, err)
+		return nil, fmt.Errorf("error: %s variable was not found, err: %w", name, err)
 	}
-	// Sent CommandComplete message
-	err = h.send(makeCommandComplete(tag, 0))
+	return v, nil
+}
+
+// setDatabase handles `USE name`, `SET database = name`, and `SET schema = name`, and replies with a CommandComplete message.
+// The name is a schema in the current catalog, a catalog, or `catalog.schema`, the same as DuckDB's `USE`.
+func (h *ConnectionHandler) setDatabase(values tree.Exprs) error {
+	if len(values) != 1 {
+		return newPgError("22023", "SET database takes only one argument")
+	}
+	var catalogName, schemaName string
+	switch val := values[0].(type) {
+	case *tree.UnresolvedName:
+		switch val.NumParts {
+		case 1:
+			schemaName = val.Parts[0]
+		case 2:
+			catalogName, schemaName = val.Parts[1], val.Parts[0]
+		default:
+			return newPgError("42601", "improper qualified name (too many dotted names): %s", val)
+		}
+	case *tree.StrVal:
+		schemaName = val.RawString()
+	default:
+		return newPgError("22023", `invalid value for parameter "database": "%v"`, val)
+	}
+	if err := h.useDatabase(catalogName, schemaName); err != nil {
+		return err
+	}
+	return h.send(makeCommandComplete("SET", 0))
+}
+
+// useDatabase switches the current database of the session and its DuckDB connection, see backend.Session.UseSchema.
+func (h *ConnectionHandler) useDatabase(catalogName, schemaName string) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
 	if err != nil {
-		return true, err
+		return err
 	}
-	// Sent ParameterStatus message
-	if err := h.send(&pgproto3.ParameterStatus{
-		Name:  name,
-		Value: fmt.Sprintf("%v", v),
-	}); err != nil {
-		return true, err
+	err = ctx.Session.(*backend.Session).UseSchema(ctx, catalogName, schemaName)
+	if sql.ErrDatabaseNotFound.Is(err) {
+		return newPgError("3F000", `schema "%s" does not exist`, schemaName)
 	}
-	return true, nil
+	return err
 }
 
 type InPlaceHandler struct {
@@ -144,31 +170,136 @@ var selectionConversions = []SelectionConversion{
 	{
 		needConvert: func(query *ConvertedStatement) bool {
 			sql := RemoveComments(query.String)
-			// TODO(sean): Evaluate the conditions by iterating over the AST.
-			return pgIsInRecoveryRegex.MatchString(sql)
+			return myduckFlushDeltasRegex.MatchString(sql)
 		},
 		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
-			isInRecovery, err := h.isInRecovery()
+			flushed, err := h.flushDeltas()
+			if err != nil {
+				return err
+			}
+			query.String = fmt.Sprintf(`SELECT %d::UBIGINT AS "myduck_flush_deltas";`, flushed)
+			return nil
+		},
+		// The flush must happen when the query is executed, not when it is parsed.
+		isConstQuery: true,
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return myduckSwitchoverRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			sqlStr, err := h.switchover(query.String)
 			if err != nil {
 				return err
 			}
-			sqlStr := fmt.Sprintf(`SELECT '%s' AS "pg_is_in_recovery";`, isInRecovery)
 			query.String = sqlStr
 			return nil
 		},
+		// The switchover must happen when the query is executed, not when it is parsed.
+		isConstQuery: true,
 	},
 	{
 		needConvert: func(query *ConvertedStatement) bool {
 			sql := RemoveComments(query.String)
-			// TODO(sean): Evaluate the conditions by iterating over the AST.
-			return pgWALLSNRegex.MatchString(sql)
+			return myduckPauseApplyRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			sqlStr, err := h.pauseApply(query.String)
+			if err != nil {
+				return err
+			}
+			query.String = sqlStr
+			return nil
+		},
+		// The pause must happen when the query is executed, not when it is parsed.
+		isConstQuery: true,
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return myduckWaitForLSNRegex.MatchString(sql)
 		},
 		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
-			lsnStr, err := h.readOneWALPositionStr()
+			applied, err := h.waitForLSN(query.String)
+			if err != nil {
+				return err
+			}
+			query.String = fmt.Sprintf(`SELECT %t AS "wait_for_lsn";`, applied)
+			return nil
+		},
+		// The wait must happen when the query is executed, not when it is parsed.
+		isConstQuery: true,
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return myduckAppliedLSNRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			query.String = convertAppliedLSN(RemoveComments(query.String))
+			return nil
+		},
+		// The applied LSN must be read when the query is executed, not when it is parsed.
+		isConstQuery: true,
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return myduckJobFuncRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			sqlStr, err := h.controlJob(RemoveComments(query.String))
+			if err != nil {
+				return err
+			}
+			query.String = sqlStr
+			return nil
+		},
+		// The job must be run or canceled when the query is executed, not when it is parsed.
+		isConstQuery: true,
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return myduckHistoryFuncRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			matches := myduckHistoryFuncRegex.FindStringSubmatch(RemoveComments(query.String))
+			name := strings.ReplaceAll(matches[3], "''", "'")
+			historyTable, err := h.setHistoryMode(name, strings.EqualFold(matches[2], "enable"))
+			if err != nil {
+				return err
+			}
+			query.String = fmt.Sprintf(`SELECT '%s' AS "myduck_%s_history";`, strings.ReplaceAll(historyTable, "'", "''"), strings.ToLower(matches[2]))
+			return nil
+		},
+		isConstQuery: true,
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return myduckReplicationFuncRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			sqlStr, err := convertReplicationFuncs(RemoveComments(query.String))
+			if err != nil {
+				return err
+			}
+			query.String = sqlStr
+			return nil
+		},
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			return catalog.HasMySQLQuery(RemoveComments(query.String))
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			// The sources of mysql_query are attached as databases, see catalog/mysql_scanner.go.
+			sqlStr, err := h.duckHandler.GetCatalogProvider().RewriteMySQLQuery(context.Background(), RemoveComments(query.String))
 			if err != nil {
 				return err
 			}
-			sqlStr := fmt.Sprintf(`SELECT '%s' AS "%s";`, lsnStr, "pg_current_wal_lsn")
 			query.String = sqlStr
 			return nil
 		},
@@ -203,6 +334,121 @@ var selectionConversions = []SelectionConversion{
 		},
 		isConstQuery: true,
 	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return setConfigRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			matches := setConfigRegex.FindStringSubmatch(RemoveComments(query.String))
+			local, err := parseBoolSetting("is_local", matches[3])
+			if err != nil {
+				return err
+			}
+			setting, err := h.setConfig(matches[1], strings.ReplaceAll(matches[2], "''", "'"), local)
+			if err != nil {
+				return err
+			}
+			query.String = fmt.Sprintf(`SELECT %s AS "set_config";`, quoteSettingLiteral(setting))
+			return nil
+		},
+		// The parameter must be set when the query is executed, not when it is parsed.
+		isConstQuery: true,
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return setvalRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			matches := setvalRegex.FindStringSubmatch(RemoveComments(query.String))
+			isCalled := true
+			if matches[3] != "" {
+				var err error
+				if isCalled, err = parseBoolSetting("is_called", strings.Trim(matches[3], "'")); err != nil {
+					return err
+				}
+			}
+			v, err := h.setval(strings.ReplaceAll(matches[1], "''", "'"), matches[2], isCalled)
+			if err != nil {
+				return err
+			}
+			query.String = fmt.Sprintf(`SELECT %d::BIGINT AS "setval";`, v)
+			return nil
+		},
+		// The sequence must be set when the query is executed, not when it is parsed.
+		isConstQuery: true,
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return sessionFuncRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			sqlStr, err := h.convertSessionFuncs(RemoveComments(query.String))
+			if err != nil {
+				return err
+			}
+			query.String = sqlStr
+			return nil
+		},
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return pgSettingsRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			if poolerMode {
+				// A temporary view would be left in the backend session, which may be shared with other clients.
+				sql, err := h.inlinePgSettings(RemoveComments(query.String))
+				if err != nil {
+					return err
+				}
+				query.String = sql
+				return nil
+			}
+			if err := h.createPgSettingsView(); err != nil {
+				return err
+			}
+			query.String = convertPgSettings(RemoveComments(query.String))
+			return nil
+		},
+		// The view is refreshed again when a prepared statement is executed, see handleExecute.
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return pgStatDatabaseRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			if poolerMode {
+				query.String = inlinePgStatDatabase(RemoveComments(query.String))
+				return nil
+			}
+			if err := h.createPgStatDatabaseView(); err != nil {
+				return err
+			}
+			query.String = convertPgStatDatabase(RemoveComments(query.String))
+			return nil
+		},
+		// The view is refreshed again when a prepared statement is executed, see handleExecute.
+	},
+	{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return myduckTenantsRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			// The sizes and the counters are inlined as of the conversion, even for a prepared statement.
+			sql, err := h.inlineMyduckTenants(RemoveComments(query.String))
+			if err != nil {
+				return err
+			}
+			query.String = sql
+			return nil
+		},
+	},
 	{
 		needConvert: func(query *ConvertedStatement) bool {
 			sql := RemoveComments(query.String)
@@ -317,6 +563,16 @@ var inPlaceHandlers = map[string]InPlaceHandler{
 				return false, nil
 			}
 			key := strings.ToLower(showVar.Name)
+			if p, ok := serverParameters[key]; ok {
+				setting, err := p.show(h)
+				if err != nil {
+					return false, err
+				}
+				return true, h.run(ConvertedStatement{
+					String: fmt.Sprintf(`SELECT '%s' AS "%s";`, setting, key),
+					Tag:    "SELECT",
+				})
+			}
 			if key != "all" {
 				setting, err := h.queryPGSetting(key)
 				if err != nil {
@@ -341,19 +597,16 @@ var inPlaceHandlers = map[string]InPlaceHandler{
 			switch stmt := query.AST.(type) {
 			case *tree.SetVar:
 				key := strings.ToLower(stmt.Name)
-				if key == "database" {
-					// This is the statement of `USE xxx`, which is used for changing the schema.
-					// Route it to the engine directly.
-					return false, nil
+				if key == "database" || key == "schema" {
+					// This is the statement of `USE xxx`, `SET database = xxx`, or DuckDB's `SET schema = xxx`,
+					// which is used for changing the schema.
+					return true, nil
 				}
-				if !pgconfig.IsValidPostgresConfigParameter(key) {
-					// This is a configuration of DuckDB, it should be bypassed to DuckDB
-					return false, nil
+				if _, ok := serverParameters[key]; ok || pgconfig.IsValidPostgresConfigParameter(key) {
+					return true, nil
 				}
-				if len(stmt.Values) > 1 {
-					return false, fmt.Errorf("error: invalid set statement: %v", query.String)
-				}
-				return true, nil
+				// This is a configuration of DuckDB, which is bypassed to DuckDB except for SET LOCAL.
+				return stmt.Local, nil
 			case *tree.SetSessionCharacteristics:
 				// This is a statement of `SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL xxx`.
 				return true, nil
@@ -362,46 +615,54 @@ var inPlaceHandlers = map[string]InPlaceHandler{
 		},
 		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
 			var key string
-			var value any
-			var isDefault bool
+			var values tree.Exprs
+			var isDefault, local bool
 			switch stmt := query.AST.(type) {
 			case *tree.SetVar:
 				key = strings.ToLower(stmt.Name)
-				value = stmt.Values[0]
-				_, isDefault = value.(tree.DefaultVal)
+				values = stmt.Values
+				if len(values) == 1 {
+					_, isDefault = values[0].(tree.DefaultVal)
+				}
+				local = stmt.Local
 			case *tree.SetSessionCharacteristics:
 				// This is a statement of `SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL xxx`.
 				key = "default_transaction_isolation"
-				value = strings.ReplaceAll(stmt.Modes.Isolation.String(), " ", "-")
+				values = tree.Exprs{tree.NewStrVal(strings.ReplaceAll(stmt.Modes.Isolation.String(), " ", "-"))}
 				isDefault = false
 			default:
 				return false, fmt.Errorf("error: invalid set statement: %v", query.String)
 			}
 
-			if key == "database" {
-				// This is the statement of `USE xxx`, which is used for changing the schema.
-				// Route it to the engine directly.
-				return false, nil
+			if key == "database" || key == "schema" {
+				// The schema is switched in the same way as the database, so that the switch to a tenant
+				// is checked against its grants and its connection limit, see ConnectionPool.UseSchema.
+				return true, h.setDatabase(values)
 			}
-			if !pgconfig.IsValidPostgresConfigParameter(key) {
-				// This is a configuration of DuckDB, it should be bypassed to DuckDB
-				return false, nil
+			p, isServerParameter := serverParameters[key]
+			if !isServerParameter && !pgconfig.IsValidPostgresConfigParameter(key) {
+				// This is a configuration of DuckDB, which is bypassed to DuckDB except for SET LOCAL.
+				if !local {
+					// A session-level SET overrides any SET LOCAL of the same parameter when the transaction block ends.
+					delete(h.duckHandler.localSettings, key)
+					return false, nil
+				}
+				return true, h.setDuckDBLocal(key, values, isDefault)
 			}
 
 			var v any
-			switch val := value.(type) {
-			case *tree.UnresolvedName:
-				if val.NumParts != 1 {
-					return false, fmt.Errorf("error: invalid value in set statement: %v", query.String)
+			if !isDefault {
+				s, err := setValueString(key, values)
+				if err != nil {
+					return false, err
 				}
-				v = val.Parts[0]
-			case *tree.StrVal:
-				v = val.RawString()
-			default:
-				v = fmt.Sprintf("%v", val)
+				v = s
 			}
 
-			return h.setPgSessionVar(key, v, isDefault, "SET")
+			if isServerParameter {
+				return true, h.setServerParameter(key, p, v, isDefault, local)
+			}
+			return h.setPgSessionVar(key, v, isDefault, local, "SET")
 		},
 	},
 	"RESET": {
@@ -430,7 +691,7 @@ var inPlaceHandlers = map[string]InPlaceHandler{
 				return false, nil
 			}
 			if !resetVar.ResetAll {
-				return h.setPgSessionVar(key, nil, true, "RESET")
+				return h.setPgSessionVar(key, nil, true, false, "RESET")
 			}
 			// TODO(sean): Implement RESET ALL
 			_ = h.send(&pgproto3.ErrorResponse{
@@ -441,6 +702,383 @@ var inPlaceHandlers = map[string]InPlaceHandler{
 			return true, nil
 		},
 	},
+	"ALTER TABLE": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return isTTLAlterTable(query.AST) || isRowTransformAlterTable(query.AST), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			var err error
+			switch {
+			case isTTLAlterTable(query.AST):
+				err = h.alterTableTTL(query.AST.(*tree.AlterTable))
+			case isRowTransformAlterTable(query.AST):
+				err = h.alterTableRowTransform(query.AST.(*tree.AlterTable))
+			default:
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete(query.Tag, 0))
+		},
+	},
+	"CREATE INDEX": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return isFTSCreateIndex(query.AST), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			if !isFTSCreateIndex(query.AST) {
+				return false, nil
+			}
+			if err := h.createFTSIndex(query.AST.(*tree.CreateIndex)); err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete(query.Tag, 0))
+		},
+	},
+	"DROP INDEX": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return h.isFTSDropIndex(query.AST)
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			if ok, err := h.isFTSDropIndex(query.AST); !ok || err != nil {
+				return false, err
+			}
+			if err := h.dropFTSIndexes(query.AST.(*tree.DropIndex)); err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete(query.Tag, 0))
+		},
+	},
+	"CREATE TYPE": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			_, ok := query.AST.(*tree.CreateType)
+			return ok, nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			create, ok := query.AST.(*tree.CreateType)
+			if !ok {
+				return false, nil
+			}
+			if err := h.createType(create); err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete(query.Tag, 0))
+		},
+	},
+	"DROP TYPE": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			_, ok := query.AST.(*tree.DropType)
+			return ok, nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			drop, ok := query.AST.(*tree.DropType)
+			if !ok {
+				return false, nil
+			}
+			if err := h.dropTypes(drop); err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete(query.Tag, 0))
+		},
+	},
+	"COMMENT ON TABLE": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			_, ok := query.AST.(*tree.CommentOnTable)
+			return ok, nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			stmt, ok := query.AST.(*tree.CommentOnTable)
+			if !ok {
+				return false, nil
+			}
+			if err := h.commentOnTable(stmt); err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete("COMMENT", 0))
+		},
+	},
+	"COMMENT ON COLUMN": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			_, ok := query.AST.(*tree.CommentOnColumn)
+			return ok, nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			stmt, ok := query.AST.(*tree.CommentOnColumn)
+			if !ok {
+				return false, nil
+			}
+			if err := h.commentOnColumn(stmt); err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete("COMMENT", 0))
+		},
+	},
+	"CREATE SEQUENCE": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			_, ok := query.AST.(*tree.CreateSequence)
+			return ok, nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			create, ok := query.AST.(*tree.CreateSequence)
+			if !ok {
+				return false, nil
+			}
+			if err := h.createSequence(query.String, create); err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete(query.Tag, 0))
+		},
+	},
+	"DROP SEQUENCE": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			_, ok := query.AST.(*tree.DropSequence)
+			return ok, nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			drop, ok := query.AST.(*tree.DropSequence)
+			if !ok {
+				return false, nil
+			}
+			if err := h.dropSequences(drop); err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete(query.Tag, 0))
+		},
+	},
+	// CREATE DOMAIN, DROP DOMAIN, and the DDL of the foreign servers and tables are not supported by the parser,
+	// so they are tagged by their first word.
+	"CREATE": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return createDomainRegex.MatchString(query.String) || isForeignDDL(query.String) || backend.IsMaskingStatement(query.String) ||
+				isRowSecurityDDL(query.String) || backend.IsLakeSinkStatement(query.String) || isTenantStatement(query.String), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			if isTenantStatement(query.String) {
+				return h.execTenantStatement(query.String)
+			}
+			if backend.IsMaskingStatement(query.String) {
+				return h.execMaskingStatement(query.String)
+			}
+			if backend.IsLakeSinkStatement(query.String) {
+				return h.execLakeSinkStatement(query.String)
+			}
+			if isRowSecurityDDL(query.String) {
+				tag, err := h.handleRowSecurityDDL(query.String)
+				if err != nil {
+					return false, err
+				}
+				return true, h.send(makeCommandComplete(tag, 0))
+			}
+			if isForeignDDL(query.String) {
+				tag, err := h.handleForeignDDL(query.String)
+				if err != nil {
+					return false, err
+				}
+				return true, h.send(makeCommandComplete(tag, 0))
+			}
+			if !createDomainRegex.MatchString(query.String) {
+				return false, nil
+			}
+			if err := h.createDomain(query.String); err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete("CREATE DOMAIN", 0))
+		},
+	},
+	"DROP": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return dropDomainRegex.MatchString(query.String) || isForeignDDL(query.String) || backend.IsMaskingStatement(query.String) ||
+				isRowSecurityDDL(query.String) || backend.IsLakeSinkStatement(query.String) || isTenantStatement(query.String), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			if isTenantStatement(query.String) {
+				return h.execTenantStatement(query.String)
+			}
+			if backend.IsMaskingStatement(query.String) {
+				return h.execMaskingStatement(query.String)
+			}
+			if backend.IsLakeSinkStatement(query.String) {
+				return h.execLakeSinkStatement(query.String)
+			}
+			if isRowSecurityDDL(query.String) {
+				tag, err := h.handleRowSecurityDDL(query.String)
+				if err != nil {
+					return false, err
+				}
+				return true, h.send(makeCommandComplete(tag, 0))
+			}
+			if isForeignDDL(query.String) {
+				tag, err := h.handleForeignDDL(query.String)
+				if err != nil {
+					return false, err
+				}
+				return true, h.send(makeCommandComplete(tag, 0))
+			}
+			if !dropDomainRegex.MatchString(query.String) {
+				return false, nil
+			}
+			if err := h.dropDomains(query.String); err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete("DROP DOMAIN", 0))
+		},
+	},
+	"ALTER": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return isRowSecurityDDL(query.String) || isTenantStatement(query.String), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			if isTenantStatement(query.String) {
+				return h.execTenantStatement(query.String)
+			}
+			if !isRowSecurityDDL(query.String) {
+				return false, nil
+			}
+			tag, err := h.handleRowSecurityDDL(query.String)
+			if err != nil {
+				return false, err
+			}
+			return true, h.send(makeCommandComplete(tag, 0))
+		},
+	},
+	"GRANT": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return backend.IsMaskingStatement(query.String) || backend.IsAdminPrivilegeStatement(query.String) ||
+				isTenantGrantStatement(query.String), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			if isTenantGrantStatement(query.String) {
+				return h.execTenantStatement(query.String)
+			}
+			if backend.IsAdminPrivilegeStatement(query.String) {
+				return h.execAdminPrivilegeStatement(query.String)
+			}
+			return h.execMaskingStatement(query.String)
+		},
+	},
+	"REVOKE": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return backend.IsMaskingStatement(query.String) || backend.IsAdminPrivilegeStatement(query.String) ||
+				isTenantGrantStatement(query.String), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			if isTenantGrantStatement(query.String) {
+				return h.execTenantStatement(query.String)
+			}
+			if backend.IsAdminPrivilegeStatement(query.String) {
+				return h.execAdminPrivilegeStatement(query.String)
+			}
+			return h.execMaskingStatement(query.String)
+		},
+	},
+	// The cursors are handled by the handler, see declareCursor.
+	"DECLARE CURSOR": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return true, nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			stmt, ok := query.AST.(*tree.DeclareCursor)
+			if !ok {
+				return false, nil
+			}
+			return true, h.declareCursor(query, stmt)
+		},
+	},
+	"FETCH": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return true, nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			stmt, ok := query.AST.(*tree.FetchCursor)
+			if !ok {
+				return false, nil
+			}
+			return true, h.fetchCursor(stmt.CursorStmt, false)
+		},
+	},
+	"MOVE": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return true, nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			stmt, ok := query.AST.(*tree.MoveCursor)
+			if !ok {
+				return false, nil
+			}
+			return true, h.fetchCursor(stmt.CursorStmt, true)
+		},
+	},
+	"CLOSE": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return true, nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			stmt, ok := query.AST.(*tree.CloseCursor)
+			if !ok {
+				return false, nil
+			}
+			return true, h.closeCursor(stmt)
+		},
+	},
+	"DISCARD": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return discardPlansRegex.MatchString(query.String), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			if !discardPlansRegex.MatchString(query.String) {
+				return false, nil
+			}
+			return true, h.discardPlans()
+		},
+	},
+	// CHECKPOINT and VACUUM are not supported by the parser, so they are tagged by their first word.
+	"CHECKPOINT": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return backend.IsStorageStatement(query.String), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			return h.execStorageStatement(query.String)
+		},
+	},
+	"FORCE": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return backend.IsStorageStatement(query.String), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			return h.execStorageStatement(query.String)
+		},
+	},
+	"VACUUM": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return backend.IsStorageStatement(query.String), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			return h.execStorageStatement(query.String)
+		},
+	},
+	// LISTEN is not supported by the parser, so it is tagged by its first word. See schema_changes.go.
+	"LISTEN": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			return listenRegex.MatchString(query.String), nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			return h.listen(query.String)
+		},
+	},
+	"UNLISTEN": {
+		ShouldBeHandledInPlace: func(h *ConnectionHandler, query *ConvertedStatement) (bool, error) {
+			_, ok := query.AST.(*tree.Unlisten)
+			return ok, nil
+		},
+		Handler: func(h *ConnectionHandler, query ConvertedStatement) (bool, error) {
+			stmt, ok := query.AST.(*tree.Unlisten)
+			if !ok {
+				return false, nil
+			}
+			return true, h.unlisten(stmt)
+		},
+	},
 }
 
 // shouldQueryBeHandledInPlace determines whether a query should be handled in place, rather than being
@@ -0,0 +1,53 @@
+package pgserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/catalog"
+)
+
+// The background jobs are defined in __sys__.jobs and their runs are listed in __sys__.job_runs,
+// which are queried directly on this protocol. See backend.JobScheduler.
+//
+//   - `SELECT myduck_run_job('name')` runs the job as soon as possible, and returns false if it is already running.
+//   - `SELECT myduck_cancel_job('name')` cancels the current run of the job, and returns whether the job was running.
+//
+// Both require the ADMIN privilege, and are recorded in the audit log, see backend.RunAdminStatement.
+
+// precompile a regex to match "select myduck_run_job('name');" and "select myduck_cancel_job('name');"
+var myduckJobFuncRegex = regexp.MustCompile(`(?i)^\s*select\s+(?:pg_catalog\.)?myduck_(run|cancel)_job\(\s*'((?:[^']|'')*)'\s*\)\s*;?\s*$`)
+
+// controlJob runs or cancels a job, and returns the constant query of the result.
+func (h *ConnectionHandler) controlJob(query string) (string, error) {
+	matches := myduckJobFuncRegex.FindStringSubmatch(query)
+	action, name := strings.ToLower(matches[1]), strings.ReplaceAll(matches[2], "''", "'")
+	function := "myduck_" + action + "_job"
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, query)
+	if err != nil {
+		return "", err
+	}
+	scheduler := backend.JobSchedulerOf(h.duckHandler.GetCatalogProvider())
+	var result bool
+	err = backend.RunAdminStatement(ctx, h.duckHandler.e.Analyzer.Catalog.MySQLDb, catalog.PrivilegeAdmin, function, query, func() error {
+		if action == "cancel" {
+			result = scheduler.CancelJob(name)
+			return nil
+		}
+		var err error
+		result, err = scheduler.RunJob(context.Background(), name)
+		return err
+	})
+	if backend.ErrAdminPrivilegeRequired.Is(err) {
+		return "", newPgError("42501", "%s", err.Error())
+	} else if errors.Is(err, backend.ErrJobNotFound) {
+		return "", newPgError("42704", `job "%s" does not exist`, name)
+	} else if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`SELECT %t AS "%s";`, result, function), nil
+}
@@ -0,0 +1,15 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobFuncRegex(t *testing.T) {
+	m := myduckJobFuncRegex.FindStringSubmatch(`SELECT myduck_run_job('daily''s sales');`)
+	require.Equal(t, []string{"run", "daily''s sales"}, m[1:])
+	m = myduckJobFuncRegex.FindStringSubmatch(`select pg_catalog.MYDUCK_CANCEL_JOB( 'refresh' )`)
+	require.Equal(t, []string{"CANCEL", "refresh"}, m[1:])
+	require.False(t, myduckJobFuncRegex.MatchString(`SELECT myduck_run_job('a'), 1`))
+}
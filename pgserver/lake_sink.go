@@ -0,0 +1,20 @@
+package pgserver
+
+import (
+	"context"
+
+	"github.com/apecloud/myduckserver/backend"
+)
+
+// execLakeSinkStatement executes a statement that manages the lake sinks, see backend/lake_sink.go.
+func (h *ConnectionHandler) execLakeSinkStatement(query string) (bool, error) {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, query)
+	if err != nil {
+		return false, err
+	}
+	tag, ok, err := backend.ExecLakeSinkStatement(ctx, h.duckHandler.e.Analyzer.Catalog.MySQLDb, query)
+	if !ok || err != nil {
+		return false, err
+	}
+	return true, h.send(makeCommandComplete(tag, 0))
+}
@@ -50,6 +50,15 @@ func WithCertificate(cert tls.Certificate) ListenerOpt {
 	}
 }
 
+// WithVersionString sets the value of version().
+func WithVersionString(version string) ListenerOpt {
+	return func(l *Listener) {
+		if version != "" {
+			versionString = version
+		}
+	}
+}
+
 func WithEngine(engine *gms.Engine) ListenerOpt {
 	return func(l *Listener) {
 		l.engine = engine
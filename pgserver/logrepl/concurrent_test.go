@@ -0,0 +1,130 @@
+package logrepl_test
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
+	"github.com/apecloud/myduckserver/pgtest"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConcurrentSubscriptions runs two subscriptions to the same primary at once, each of which replicates
+// a publication of its own into a schema of its own in a session of its own.
+func TestConcurrentSubscriptions(t *testing.T) {
+	containerName, dsn, _, err := StartPostgresServer()
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, exec.Command("docker", "kill", containerName).Run())
+	}()
+	primaryDns := dsn + "?sslmode=disable"
+
+	ctx, server, replicaConn, closeServer, err := pgtest.CreateTestServer(t, findFreePort())
+	require.NoError(t, err)
+	defer func() {
+		replicaConn.Close(ctx)
+		require.NoError(t, closeServer())
+	}()
+
+	primary, err := pgx.Connect(ctx, primaryDns)
+	require.NoError(t, err)
+	defer primary.Close(ctx)
+	for _, query := range []string{
+		"CREATE TABLE public.items (id INT PRIMARY KEY, name TEXT)",
+		"CREATE TABLE public.orders (id INT PRIMARY KEY, item_id INT)",
+		"INSERT INTO public.items VALUES (1, 'one'), (2, 'two')",
+		"INSERT INTO public.orders VALUES (1, 1)",
+		"CREATE PUBLICATION pub_items FOR TABLE public.items",
+		"CREATE PUBLICATION pub_orders FOR TABLE public.orders",
+	} {
+		_, err := primary.Exec(ctx, query)
+		require.NoError(t, err, query)
+	}
+
+	logrepl.SetContextFactory(server.Provider, server.NewInternalCtx)
+	defer logrepl.SetContextFactory(server.Provider, nil)
+
+	subscriptions := []struct{ name, publication, schema string }{
+		{"sub_items", "pub_items", "items_replica"},
+		{"sub_orders", "pub_orders", "orders_replica"},
+	}
+
+	// Both subscriptions copy their initial data at once.
+	var wg sync.WaitGroup
+	errs := make([]error, len(subscriptions))
+	for i, sub := range subscriptions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = func() error {
+				sqlCtx := server.NewInternalCtx()
+				defer adapter.CloseConn(sqlCtx)
+				r, err := logrepl.NewLogicalReplicator(sub.name, primaryDns)
+				if err != nil {
+					return err
+				}
+				r.SetTargetSchema(sub.schema)
+				lsn, err := r.Snapshot(sqlCtx, sub.publication, false)
+				if err != nil {
+					return err
+				}
+				if err := logrepl.CreateSubscription(sqlCtx, sub.name, primaryDns, sub.publication, lsn.String(), true, sub.schema, ""); err != nil {
+					return err
+				}
+				return adapter.CommitAndCloseTxn(sqlCtx)
+			}()
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	updateCtx := server.NewInternalCtx()
+	defer adapter.CloseConn(updateCtx)
+	require.NoError(t, logrepl.UpdateSubscriptions(updateCtx))
+	defer func() {
+		for _, sub := range subscriptions {
+			require.NoError(t, logrepl.DeleteSubscription(updateCtx, sub.name))
+		}
+		require.NoError(t, adapter.CommitAndCloseTxn(updateCtx))
+		require.NoError(t, logrepl.UpdateSubscriptions(updateCtx))
+	}()
+
+	// Both subscriptions apply the changes at once.
+	for i := 3; i <= 50; i++ {
+		_, err := primary.Exec(ctx, fmt.Sprintf("INSERT INTO public.items VALUES (%d, 'item %d')", i, i))
+		require.NoError(t, err)
+		_, err = primary.Exec(ctx, fmt.Sprintf("INSERT INTO public.orders VALUES (%d, %d)", i, i))
+		require.NoError(t, err)
+	}
+	_, err = primary.Exec(ctx, "UPDATE public.items SET name = 'ONE' WHERE id = 1")
+	require.NoError(t, err)
+	_, err = primary.Exec(ctx, "DELETE FROM public.orders WHERE id = 1")
+	require.NoError(t, err)
+
+	count := func(query string) int {
+		var n int
+		require.NoError(t, replicaConn.QueryRow(context.Background(), query).Scan(&n))
+		return n
+	}
+	require.Eventually(t, func() bool {
+		return count("SELECT count(*) FROM items_replica.items") == 50 &&
+			count("SELECT count(*) FROM orders_replica.orders") == 49
+	}, 30*time.Second, 500*time.Millisecond)
+
+	var name string
+	require.NoError(t, replicaConn.QueryRow(ctx, "SELECT name FROM items_replica.items WHERE id = 1").Scan(&name))
+	require.Equal(t, "ONE", name)
+
+	// Each subscription copies and replicates only the tables of its publication into its own schema.
+	require.Equal(t, 0, count("SELECT count(*) FROM information_schema.tables WHERE table_schema = 'items_replica' AND table_name = 'orders'"))
+	require.Equal(t, 0, count("SELECT count(*) FROM information_schema.tables WHERE table_schema = 'orders_replica' AND table_name = 'items'"))
+	require.Equal(t, 0, count("SELECT count(*) FROM information_schema.tables WHERE table_schema = 'public' AND table_name IN ('items', 'orders')"))
+}
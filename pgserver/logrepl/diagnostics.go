@@ -0,0 +1,221 @@
+package logrepl
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/delta"
+	"github.com/jackc/pglogrepl"
+)
+
+// ErrReplicatorNotRunning is returned when a diagnostic request is sent to a replicator that is not running.
+var ErrReplicatorNotRunning = errors.New("replicator is not running")
+
+// ReplicationStatus is a snapshot of the replicationState of a running replicator.
+type ReplicationStatus struct {
+	Subscription          string
+	SlotName              string
+	LastWrittenLSN        pglogrepl.LSN
+	LastReceivedLSN       pglogrepl.LSN
+	LastCommitLSN         pglogrepl.LSN
+	CurrentTransactionLSN pglogrepl.LSN
+	InStream              bool
+	ProcessMessages       bool
+	OngoingBatchTxn       bool
+	DirtyTxn              bool
+	DirtyStream           bool
+	DeltaBufSize          uint64
+	CommitCount           uint64
+	LastCommitTime        time.Time
+	CachedRelations       int
+	// ApplyPaused is true while the application of the changes is paused, see PauseApply.
+	ApplyPaused bool
+	// Progress is how far the WAL sent by the primary has been applied, which is tracked continuously.
+	Progress ReplicationProgress
+}
+
+// CachedRelation is a relation schema received from the primary and cached by a replicator.
+type CachedRelation struct {
+	Subscription string
+	RelationID   uint32
+	Namespace    string
+	RelationName string
+	Columns      []string // "name type" of each column
+	KeyColumns   []string
+}
+
+// inspect runs fn on the replication goroutine, which owns the replicationState,
+// and waits for it to finish.
+func (r *LogicalReplicator) inspect(fn func(state *replicationState)) error {
+	r.mu.Lock()
+	if !r.running {
+		r.mu.Unlock()
+		return ErrReplicatorNotRunning
+	}
+	requests, done := r.requests, r.done
+	r.mu.Unlock()
+
+	finished := make(chan struct{})
+	select {
+	case requests <- func(state *replicationState) {
+		defer close(finished)
+		fn(state)
+	}:
+	case <-done:
+		return ErrReplicatorNotRunning
+	}
+	select {
+	case <-finished:
+		return nil
+	case <-done:
+		return ErrReplicatorNotRunning
+	}
+}
+
+// Status returns a snapshot of the replication state.
+func (r *LogicalReplicator) Status() (status ReplicationStatus, err error) {
+	err = r.inspect(func(state *replicationState) {
+		status = ReplicationStatus{
+			Subscription:          r.subscription,
+			SlotName:              state.slotName,
+			LastWrittenLSN:        state.lastWrittenLSN,
+			LastReceivedLSN:       state.lastReceivedLSN,
+			LastCommitLSN:         state.lastCommitLSN,
+			CurrentTransactionLSN: state.currentTransactionLSN,
+			InStream:              state.inStream,
+			ProcessMessages:       state.processMessages,
+			OngoingBatchTxn:       state.ongoingBatchTxn,
+			DirtyTxn:              state.dirtyTxn,
+			DirtyStream:           state.dirtyStream,
+			DeltaBufSize:          state.deltaBufSize,
+			CommitCount:           state.commitCount,
+			LastCommitTime:        state.lastCommitTime,
+			CachedRelations:       len(state.relations),
+			ApplyPaused:           state.pause.paused,
+			Progress:              r.Progress(),
+		}
+	})
+	return status, err
+}
+
+// CachedRelations returns the relation schemas cached by the replicator, ordered by relation ID.
+func (r *LogicalReplicator) CachedRelations() (relations []CachedRelation, err error) {
+	err = r.inspect(func(state *replicationState) {
+		for id, rel := range state.relations {
+			cached := CachedRelation{
+				Subscription: r.subscription,
+				RelationID:   id,
+				Namespace:    rel.Namespace,
+				RelationName: rel.RelationName,
+			}
+			for _, col := range rel.Columns {
+				typeName := fmt.Sprintf("oid:%d", col.DataType)
+				if typ, ok := state.typeMap.TypeForOID(col.DataType); ok {
+					typeName = typ.Name
+				}
+				cached.Columns = append(cached.Columns, col.Name+" "+typeName)
+			}
+			for _, i := range state.keys[id] {
+				cached.KeyColumns = append(cached.KeyColumns, rel.Columns[i].Name)
+			}
+			relations = append(relations, cached)
+		}
+	})
+	slices.SortFunc(relations, func(a, b CachedRelation) int {
+		return cmp.Compare(a.RelationID, b.RelationID)
+	})
+	return relations, err
+}
+
+// FlushDeltas forces the delta buffer to be flushed and returns the number of bytes that were buffered.
+// If the buffered changes end with a complete transaction of the primary, they are committed along with the LSN.
+// Otherwise, they are flushed into the ongoing transaction, which is committed once the primary's transaction ends.
+func (r *LogicalReplicator) FlushDeltas() (flushed uint64, err error) {
+	if inspectErr := r.inspect(func(state *replicationState) {
+		flushed = state.deltaBufSize
+		if !state.dirtyStream {
+			err = r.commitOngoingTxnIfClean(state, delta.ManualFlushReason)
+			return
+		}
+		tx := adapter.TryGetTxn(state.replicaCtx)
+		if tx == nil {
+			return
+		}
+		conn, connErr := adapter.GetCatalogConn(state.replicaCtx)
+		if connErr != nil {
+			err = connErr
+			return
+		}
+		err = r.flushDeltaBuffer(state, conn, tx, delta.ManualFlushReason)
+	}); inspectErr != nil {
+		return 0, inspectErr
+	}
+	return flushed, err
+}
+
+// runningReplicators returns the replicators of the subscriptions that are running, ordered by subscription name.
+func runningReplicators() []*LogicalReplicator {
+	var replicators []*LogicalReplicator
+	subscriptionMap.Range(func(key, value any) bool {
+		if sub, ok := value.(*Subscription); ok && sub.Replicator != nil && sub.Replicator.Running() {
+			replicators = append(replicators, sub.Replicator)
+		}
+		return true
+	})
+	slices.SortFunc(replicators, func(a, b *LogicalReplicator) int {
+		return strings.Compare(a.subscription, b.subscription)
+	})
+	return replicators
+}
+
+// ReplicationStatuses returns the replication state of every running subscription.
+// A replicator that stops while being inspected is skipped.
+func ReplicationStatuses() ([]ReplicationStatus, error) {
+	var statuses []ReplicationStatus
+	for _, r := range runningReplicators() {
+		status, err := r.Status()
+		if errors.Is(err, ErrReplicatorNotRunning) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// ReplicationRelations returns the relation schemas cached by every running subscription.
+func ReplicationRelations() ([]CachedRelation, error) {
+	var relations []CachedRelation
+	for _, r := range runningReplicators() {
+		cached, err := r.CachedRelations()
+		if errors.Is(err, ErrReplicatorNotRunning) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		relations = append(relations, cached...)
+	}
+	return relations, nil
+}
+
+// FlushAllDeltas forces the delta buffers of every running subscription to be flushed,
+// and returns the total number of bytes that were buffered.
+func FlushAllDeltas() (uint64, error) {
+	var total uint64
+	for _, r := range runningReplicators() {
+		flushed, err := r.FlushDeltas()
+		if errors.Is(err, ErrReplicatorNotRunning) {
+			continue
+		} else if err != nil {
+			return total, fmt.Errorf("failed to flush the deltas of subscription %s: %w", r.subscription, err)
+		}
+		total += flushed
+	}
+	return total, nil
+}
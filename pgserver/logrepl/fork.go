@@ -0,0 +1,107 @@
+package logrepl
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/jackc/pgx/v5"
+)
+
+// A replica bootstrapped from another one by a streamed backup inherits its subscriptions, but it must not stream from
+// their slots, which the other replica keeps streaming from. So the slots are copied on the primaries while the
+// subscriptions are paused for the backup, when the LSNs of the slots are not ahead of the ones in the backup, and the
+// copies are recorded in the backup, so that the new replica streams from its own slots from the LSNs in the backup.
+// See ForkSlots and RecordForkedSlots.
+
+// maxSlotNameLength is the maximum length of a replication slot name, which is NAMEDATALEN - 1 of Postgres.
+const maxSlotNameLength = 63
+
+// forkedSlotName returns the name of the copy of a slot, which ends with the given suffix.
+func forkedSlotName(slotName, suffix string) string {
+	if len(slotName)+1+len(suffix) > maxSlotNameLength {
+		slotName = slotName[:maxSlotNameLength-1-len(suffix)]
+	}
+	return slotName + "_" + suffix
+}
+
+// ForkSlots copies the replication slots of the enabled subscriptions on their primaries, and returns the copies keyed
+// by the subscription name. The copies are named after the slots with the given suffix, which must be unique to the
+// new replica. It must be called while the subscriptions are paused, see PauseSubscriptions. The copies are dropped
+// if any slot fails to be copied.
+func ForkSlots(ctx *sql.Context, suffix string) (map[string]string, error) {
+	subMap, err := loadSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	forked := make(map[string]string)
+	for name, sub := range subMap {
+		if !sub.Enabled {
+			continue
+		}
+		r, err := sub.newReplicator()
+		if err == nil {
+			err = r.copyReplicationSlot(sub.slot(), forkedSlotName(sub.slot(), suffix))
+		}
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to copy the replication slot of subscription %s: %w", name, err),
+				DropForkedSlots(ctx, forked))
+		}
+		forked[name] = forkedSlotName(sub.slot(), suffix)
+	}
+	return forked, nil
+}
+
+// DropForkedSlots drops the copies of the slots made by ForkSlots, e.g., if the backup fails to be streamed.
+func DropForkedSlots(ctx *sql.Context, forked map[string]string) error {
+	if len(forked) == 0 {
+		return nil
+	}
+	subMap, err := loadSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for name, slotName := range forked {
+		sub, ok := subMap[name]
+		if !ok {
+			continue
+		}
+		r, err := sub.newReplicator()
+		if err == nil {
+			err = r.DropReplicationSlotIfExists(slotName)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// RecordForkedSlots records the copies of the slots made by ForkSlots as the slots of the subscriptions
+// in the catalog attached under the given name, i.e., the backup.
+func RecordForkedSlots(ctx context.Context, conn *stdsql.Conn, catalogName string, forked map[string]string) error {
+	table := catalog.ConnectIdentifiersANSI(catalogName, catalog.InternalTables.PgSubscription.Schema, catalog.InternalTables.PgSubscription.Name)
+	for name, slotName := range forked {
+		if _, err := conn.ExecContext(ctx, "UPDATE "+table+" SET subslotname = ? WHERE subname = ?", slotName, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyReplicationSlot copies the logical replication slot on the primary, along with its restart and confirmed LSNs.
+func (r *LogicalReplicator) copyReplicationSlot(src, dst string) error {
+	conn, err := pgx.Connect(context.Background(), r.PrimaryDns())
+	if err != nil {
+		return fmt.Errorf("failed to connect to primary database: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(context.Background(), "SELECT pg_copy_logical_replication_slot($1, $2, false)", src, dst); err != nil {
+		return err
+	}
+	r.logger.Infof("Replication slot '%s' copied to '%s'", src, dst)
+	return nil
+}
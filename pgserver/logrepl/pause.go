@@ -0,0 +1,145 @@
+package logrepl
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apecloud/myduckserver/delta"
+	"github.com/jackc/pglogrepl"
+)
+
+// The application of the replicated changes can be paused, so that external tools can copy the database file
+// or run exports that are consistent with a known LSN of the primary:
+//
+//  1. PauseApply asks the replicators to pause. Each of them stops at the next transaction boundary of the primary,
+//     flushes the pending deltas, and commits them along with the LSN.
+//  2. While paused, a replicator leaves the messages of the primary unread and keeps sending the status updates,
+//     so the connection stays alive and the slot retains the WAL from the paused LSN on.
+//  3. ResumeApply resumes the replicators. A pause also ends by itself after its timeout, so a tool that fails
+//     to resume does not let the slot retain the WAL of the primary forever.
+//
+// Nothing is written by the replicators while paused, though the clients of the server can still write.
+
+// ErrApplyNotPaused is returned when the replicators do not reach a transaction boundary of the primary in time,
+// because they keep receiving the changes of a large transaction. The pause is canceled then.
+var ErrApplyNotPaused = errors.New("the replication did not reach a transaction boundary in time")
+
+// PauseApplyWaitTimeout is how long PauseApply waits for the replicators to pause.
+var PauseApplyWaitTimeout = 10 * time.Second
+
+// DefaultPauseApplyTimeout is how long a pause lasts if no timeout is given.
+const DefaultPauseApplyTimeout = 10 * time.Minute
+
+// PausedApply is a replicator paused by PauseApply.
+type PausedApply struct {
+	Subscription string
+	// LSN is the WAL position of the primary up to which the changes have been applied.
+	LSN pglogrepl.LSN
+	// Until is when the pause ends by itself.
+	Until time.Time
+}
+
+// applyPause is the pause of a replicator, which is owned by the replication goroutine.
+type applyPause struct {
+	// until is when the pause ends by itself, or zero if no pause is requested.
+	until time.Time
+	// paused is true once the replicator has stopped applying the changes.
+	paused bool
+}
+
+// requested reports whether a pause is requested or ongoing.
+func (p *applyPause) requested() bool {
+	return !p.until.IsZero()
+}
+
+// PauseApply pauses the running replicators at the next transaction boundary of the primary for the timeout given,
+// and waits until all of them are paused. A replicator that is already paused is paused until the new timeout.
+func PauseApply(timeout time.Duration) ([]PausedApply, error) {
+	replicators := runningReplicators()
+	until := time.Now().Add(timeout)
+	for _, r := range replicators {
+		err := r.inspect(func(state *replicationState) {
+			state.pause.until = until
+		})
+		if err != nil && !errors.Is(err, ErrReplicatorNotRunning) {
+			return nil, err
+		}
+	}
+
+	deadline := time.Now().Add(min(PauseApplyWaitTimeout, timeout))
+	var paused []PausedApply
+	for _, r := range replicators {
+		for {
+			var status PausedApply
+			requested := false
+			err := r.inspect(func(state *replicationState) {
+				requested = state.pause.requested()
+				if state.pause.paused {
+					status = PausedApply{Subscription: r.subscription, LSN: state.lastWrittenLSN, Until: state.pause.until}
+				}
+			})
+			if errors.Is(err, ErrReplicatorNotRunning) {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			if status.Subscription != "" {
+				paused = append(paused, status)
+				break
+			}
+			if !requested || time.Now().After(deadline) {
+				if _, err := ResumeApply(); err != nil {
+					r.logger.Warnf("Failed to cancel the pause of the replication: %v", err)
+				}
+				return nil, fmt.Errorf("failed to pause subscription %s: %w", r.subscription, ErrApplyNotPaused)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	return paused, nil
+}
+
+// ResumeApply resumes the running replicators that are paused or asked to pause,
+// and returns their subscriptions.
+func ResumeApply() ([]string, error) {
+	var resumed []string
+	for _, r := range runningReplicators() {
+		err := r.inspect(func(state *replicationState) {
+			if state.pause.requested() {
+				state.pause = applyPause{}
+				resumed = append(resumed, r.subscription)
+				r.logger.Info("Resumed applying the replication")
+			}
+		})
+		if err != nil && !errors.Is(err, ErrReplicatorNotRunning) {
+			return resumed, err
+		}
+	}
+	return resumed, nil
+}
+
+// checkPause ends the pause of the replicator if it has timed out, or pauses the replicator
+// if it is asked to and it is at a transaction boundary of the primary. It returns whether the replicator is paused.
+func (r *LogicalReplicator) checkPause(state *replicationState) (bool, error) {
+	if !state.pause.requested() {
+		return false, nil
+	}
+	if time.Now().After(state.pause.until) {
+		state.pause = applyPause{}
+		r.logger.Warn("The pause of the replication timed out, resuming")
+		return false, nil
+	}
+	if state.pause.paused {
+		return true, nil
+	}
+	if state.dirtyStream || state.inStream {
+		return false, nil
+	}
+	if err := r.commitOngoingTxn(state, delta.ManualFlushReason); err != nil {
+		return false, err
+	}
+	state.pause.paused = true
+	r.logger.Infof("Paused applying the replication at LSN %s until %s", state.lastWrittenLSN, state.pause.until.Format(time.RFC3339))
+	return true, nil
+}
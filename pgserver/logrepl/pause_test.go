@@ -0,0 +1,46 @@
+package logrepl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPause(t *testing.T) {
+	r := &LogicalReplicator{logger: logrus.WithField("component", "replicator")}
+	state := &replicationState{}
+
+	paused, err := r.checkPause(state)
+	require.NoError(t, err)
+	require.False(t, paused)
+
+	// The replicator does not pause in the middle of a transaction of the primary.
+	state.pause.until = time.Now().Add(time.Minute)
+	state.dirtyStream = true
+	paused, err = r.checkPause(state)
+	require.NoError(t, err)
+	require.False(t, paused)
+	require.True(t, state.pause.requested())
+
+	state.dirtyStream = false
+	state.inStream = true
+	paused, err = r.checkPause(state)
+	require.NoError(t, err)
+	require.False(t, paused)
+
+	// A paused replicator stays paused until the pause times out.
+	state.inStream = false
+	state.pause.paused = true
+	paused, err = r.checkPause(state)
+	require.NoError(t, err)
+	require.True(t, paused)
+
+	state.pause.until = time.Now().Add(-time.Second)
+	paused, err = r.checkPause(state)
+	require.NoError(t, err)
+	require.False(t, paused)
+	require.False(t, state.pause.requested())
+	require.False(t, state.pause.paused)
+}
@@ -0,0 +1,257 @@
+package logrepl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// pingInterval is the minimum interval between two replies requested from the primary by WaitForLag.
+const pingInterval = time.Second
+
+// ReplicationProgress is how far a replicator has applied the WAL sent by the primary.
+type ReplicationProgress struct {
+	// SentLSN is the WAL position that the primary has sent up to, i.e., sent_lsn in pg_stat_replication.
+	SentLSN pglogrepl.LSN
+	// AppliedLSN is the WAL position up to which all changes are visible on the replica.
+	AppliedLSN pglogrepl.LSN
+	// ReceivedAt is the time of the last message from the primary, which reported SentLSN.
+	ReceivedAt time.Time
+	// PendingSince is the commit time on the primary of the oldest transaction that has been received
+	// but not applied yet, or zero if there is none.
+	PendingSince time.Time
+}
+
+// Lag returns the number of bytes of the WAL that the primary has sent but the replica has not applied yet.
+func (p ReplicationProgress) Lag() uint64 {
+	if p.SentLSN <= p.AppliedLSN {
+		return 0
+	}
+	return uint64(p.SentLSN - p.AppliedLSN)
+}
+
+// progressTracker tracks the ReplicationProgress of a replicator. It is updated by the replication goroutine
+// and read by the others without going through it, so it is cheap enough to be checked before each read query.
+type progressTracker struct {
+	mu       sync.Mutex
+	progress ReplicationProgress
+	// caughtUpLSN is the end of the WAL reported by the last keepalive that arrived between transactions,
+	// i.e., all changes before it have been received. They are applied once the ongoing transaction is committed.
+	caughtUpLSN pglogrepl.LSN
+	// pingedAt is the time a reply was last requested from the primary, see requestReply.
+	pingedAt time.Time
+	// changed is closed and replaced whenever the progress changes.
+	changed chan struct{}
+}
+
+func (t *progressTracker) get() (ReplicationProgress, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.changed == nil {
+		t.changed = make(chan struct{})
+	}
+	return t.progress, t.changed
+}
+
+// received records the progress after a message from the primary.
+func (t *progressTracker) received(state *replicationState, keepalive bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress.SentLSN = max(t.progress.SentLSN, state.lastReceivedLSN)
+	t.progress.ReceivedAt = time.Now()
+	if keepalive {
+		// The reply to the last request, if any, has arrived.
+		t.pingedAt = time.Time{}
+		if !state.inStream && !state.dirtyStream {
+			t.caughtUpLSN = max(t.caughtUpLSN, state.lastReceivedLSN)
+		}
+	}
+	t.update(state)
+}
+
+// applied records the progress after the ongoing transaction is committed.
+func (t *progressTracker) applied(state *replicationState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.update(state)
+}
+
+func (t *progressTracker) update(state *replicationState) {
+	t.progress.PendingSince = state.pendingSince
+	t.progress.AppliedLSN = max(t.progress.AppliedLSN, state.lastWrittenLSN)
+	if !state.dirtyTxn && !state.dirtyStream && !state.inStream {
+		t.progress.AppliedLSN = max(t.progress.AppliedLSN, t.caughtUpLSN)
+	}
+	if t.changed != nil {
+		close(t.changed)
+		t.changed = nil
+	}
+}
+
+// shouldPing returns whether a reply should be requested from the primary, and marks it as requested if so.
+// A request is skipped while the reply to the last one is on the way.
+func (t *progressTracker) shouldPing() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.pingedAt.IsZero() && time.Since(t.pingedAt) < pingInterval {
+		return false
+	}
+	t.pingedAt = time.Now()
+	return true
+}
+
+// Progress returns how far the replicator has applied the WAL sent by the primary.
+func (r *LogicalReplicator) Progress() ReplicationProgress {
+	progress, _ := r.progress.get()
+	return progress
+}
+
+// replicationLag is the health.LagSource of the replicator. The lag is the time since the commit of the oldest
+// transaction that has not been applied, so it keeps growing while the replicator is stuck applying it.
+func (r *LogicalReplicator) replicationLag() (time.Duration, time.Time) {
+	progress := r.Progress()
+	if progress.PendingSince.IsZero() {
+		return 0, progress.ReceivedAt
+	}
+	return time.Since(progress.PendingSince), progress.ReceivedAt
+}
+
+// requestReply asks the primary to send a keepalive immediately, which reports the current end of its WAL.
+// It does not wait for the request to be sent, since the replication goroutine may be busy applying changes.
+func (r *LogicalReplicator) requestReply() {
+	if !r.progress.shouldPing() {
+		return
+	}
+	go func() {
+		err := r.inspect(func(state *replicationState) {
+			state.replyRequested = true
+		})
+		if err != nil && !errors.Is(err, ErrReplicatorNotRunning) {
+			r.logger.Warnf("Failed to request a reply from the primary: %v", err)
+		}
+	}()
+}
+
+// WaitForLag blocks until the lag of the replicator is at most maxLag bytes, as of a message that the primary sent
+// after the call. It returns ErrReplicatorNotRunning if the replicator stops, or the error of ctx if it is done first.
+func (r *LogicalReplicator) WaitForLag(ctx context.Context, maxLag uint64) error {
+	r.mu.Lock()
+	running, done := r.running, r.done
+	r.mu.Unlock()
+	if !running {
+		return ErrReplicatorNotRunning
+	}
+
+	since := time.Now()
+	r.requestReply()
+	for {
+		progress, changed := r.progress.get()
+		if progress.ReceivedAt.After(since) && progress.Lag() <= maxLag {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-time.After(pingInterval):
+			// The reply may have been lost, e.g., on reconnection.
+			r.requestReply()
+		case <-done:
+			return ErrReplicatorNotRunning
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// WaitForReplicationLag blocks until the lag of every running subscription is at most maxLag bytes, see WaitForLag.
+func WaitForReplicationLag(ctx context.Context, maxLag uint64) error {
+	for _, r := range runningReplicators() {
+		err := r.WaitForLag(ctx, maxLag)
+		if errors.Is(err, ErrReplicatorNotRunning) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("subscription %s has not caught up within %d bytes: %w", r.subscription, maxLag, err)
+		}
+	}
+	return nil
+}
+
+// WaitForLSN blocks until the replicator has applied the WAL of the primary up to lsn, i.e., the changes committed on
+// the primary before lsn are visible on the replica. It returns ErrReplicatorNotRunning if the replicator stops,
+// or the error of ctx if it is done first.
+func (r *LogicalReplicator) WaitForLSN(ctx context.Context, lsn pglogrepl.LSN) error {
+	r.mu.Lock()
+	running, done := r.running, r.done
+	r.mu.Unlock()
+	if !running {
+		return ErrReplicatorNotRunning
+	}
+
+	for {
+		progress, changed := r.progress.get()
+		if progress.AppliedLSN >= lsn {
+			return nil
+		}
+		// The primary may be idle, or the WAL up to lsn may hold no changes of the publication,
+		// in which case only a keepalive moves the applied LSN past it.
+		r.requestReply()
+		select {
+		case <-changed:
+		case <-time.After(pingInterval):
+		case <-done:
+			return ErrReplicatorNotRunning
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// subscriptionReplicators returns the running replicators of the subscription named, or of all subscriptions if the
+// name is empty.
+func subscriptionReplicators(subscription string) []*LogicalReplicator {
+	replicators := runningReplicators()
+	if subscription == "" {
+		return replicators
+	}
+	for _, r := range replicators {
+		if r.subscription == subscription {
+			return []*LogicalReplicator{r}
+		}
+	}
+	return nil
+}
+
+// AppliedLSN returns the WAL position up to which the running subscription named, or every running subscription if
+// the name is empty, has applied the changes of its primary, i.e., the smallest one. The position is a token of
+// read-your-writes consistency: the writes committed on the primary before it are visible on the replica.
+// It returns false if no such subscription is running.
+func AppliedLSN(subscription string) (pglogrepl.LSN, bool) {
+	replicators := subscriptionReplicators(subscription)
+	if len(replicators) == 0 {
+		return 0, false
+	}
+	applied := replicators[0].Progress().AppliedLSN
+	for _, r := range replicators[1:] {
+		applied = min(applied, r.Progress().AppliedLSN)
+	}
+	return applied, true
+}
+
+// WaitForAppliedLSN blocks until the running subscription named, or every running subscription if the name is empty,
+// has applied the WAL of its primary up to lsn, see WaitForLSN. It returns ErrReplicatorNotRunning if no such
+// subscription is running, or if one stops before it catches up.
+func WaitForAppliedLSN(ctx context.Context, lsn pglogrepl.LSN, subscription string) error {
+	replicators := subscriptionReplicators(subscription)
+	if len(replicators) == 0 {
+		return ErrReplicatorNotRunning
+	}
+	for _, r := range replicators {
+		if err := r.WaitForLSN(ctx, lsn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package logrepl
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressTracker(t *testing.T) {
+	var tracker progressTracker
+	state := &replicationState{lastWrittenLSN: 100}
+
+	// A transaction is being received.
+	state.lastReceivedLSN = 300
+	state.dirtyTxn, state.dirtyStream = true, true
+	state.pendingSince = time.Now().Add(-time.Minute)
+	tracker.received(state, false)
+	progress, changed := tracker.get()
+	require.Equal(t, pglogrepl.LSN(300), progress.SentLSN)
+	require.Equal(t, pglogrepl.LSN(100), progress.AppliedLSN)
+	require.Equal(t, uint64(200), progress.Lag())
+	require.Equal(t, state.pendingSince, progress.PendingSince)
+
+	// The transaction has been received, but it is still in the ongoing batch.
+	state.lastCommitLSN = 250
+	state.dirtyStream = false
+	state.lastReceivedLSN = 320
+	tracker.received(state, true)
+	<-changed
+	require.Equal(t, uint64(220), lagOf(&tracker))
+
+	// Committing the batch applies everything up to the keepalive.
+	state.lastWrittenLSN = state.lastCommitLSN
+	state.dirtyTxn = false
+	state.pendingSince = time.Time{}
+	tracker.applied(state)
+	progress, _ = tracker.get()
+	require.Equal(t, pglogrepl.LSN(320), progress.AppliedLSN)
+	require.Zero(t, progress.Lag())
+	require.True(t, progress.PendingSince.IsZero())
+
+	// A keepalive in the middle of a streamed transaction does not apply anything.
+	state.inStream = true
+	state.lastReceivedLSN = 400
+	tracker.received(state, true)
+	require.Equal(t, uint64(80), lagOf(&tracker))
+
+	// Only one reply is requested from the primary at a time.
+	require.True(t, tracker.shouldPing())
+	require.False(t, tracker.shouldPing())
+	tracker.received(state, true)
+	require.True(t, tracker.shouldPing())
+}
+
+func lagOf(t *progressTracker) uint64 {
+	progress, _ := t.get()
+	return progress.Lag()
+}
+
+func TestWaitForLSN(t *testing.T) {
+	r := &LogicalReplicator{mu: &sync.Mutex{}, running: true, done: make(chan struct{})}
+	defer close(r.done)
+	state := &replicationState{lastWrittenLSN: 100}
+	r.progress.applied(state)
+
+	// The LSN has been applied already.
+	require.NoError(t, r.WaitForLSN(context.Background(), 100))
+
+	// The LSN is applied later.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		state.lastWrittenLSN = 200
+		r.progress.applied(state)
+	}()
+	require.NoError(t, r.WaitForLSN(context.Background(), 150))
+
+	// The LSN is not applied in time.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, r.WaitForLSN(ctx, 300), context.DeadlineExceeded)
+
+	// The replicator is not running.
+	require.ErrorIs(t, (&LogicalReplicator{mu: &sync.Mutex{}}).WaitForLSN(context.Background(), 100), ErrReplicatorNotRunning)
+}
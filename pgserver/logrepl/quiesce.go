@@ -0,0 +1,155 @@
+package logrepl
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/delta"
+)
+
+// ErrReplicationBusy is returned when the tables altered by a DDL statement cannot be quiesced in time,
+// because the replicators keep receiving the changes of a large transaction of the primary.
+var ErrReplicationBusy = errors.New("the table is being replicated, and the replication did not quiesce in time")
+
+// errStreamDirty is returned by quiesce when the replicator is in the middle of a transaction of the primary.
+var errStreamDirty = errors.New("the replication stream is in the middle of a transaction")
+
+// DDLQuiesceTimeout is how long a DDL statement waits for the replicators of its tables to quiesce.
+var DDLQuiesceTimeout = 10 * time.Second
+
+// TableName is the name of a table that may be altered by a DDL statement.
+// A table whose schema is not known is named once for each schema that it may be looked up in.
+type TableName struct {
+	Schema string
+	Table  string
+}
+
+// RunDDL runs a DDL statement that alters the given tables, coordinated with the running replicators.
+//
+// Running DDL on a table while it is being replicated races with the delta flushes:
+// the buffered changes of the table may be written after the DDL with the old schema,
+// and the ongoing transaction of the replicator may conflict with the DDL.
+// To avoid this, every replicator that replicates any of the tables is paused while the DDL runs:
+//
+//  1. The replicator waits until it is at a transaction boundary of the primary.
+//  2. The pending deltas are flushed and committed along with the LSN, so nothing is buffered with the old schema.
+//  3. The DDL runs while the replicator is blocked.
+//  4. The cached schemas of the tables are updated, then the replicator resumes.
+//
+// Replicators that do not replicate any of the tables are not affected.
+func RunDDL(tables []TableName, ddl func() error) error {
+	deadline := time.Now().Add(DDLQuiesceTimeout)
+	for {
+		ran := false
+		err := runDDLWithReplicators(runningReplicators(), tables, func() error {
+			ran = true
+			return ddl()
+		})
+		if !errors.Is(err, errStreamDirty) || ran {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return ErrReplicationBusy
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// runDDLWithReplicators quiesces the replicators one by one, and runs the DDL once all of them are quiesced.
+func runDDLWithReplicators(replicators []*LogicalReplicator, tables []TableName, ddl func() error) error {
+	if len(replicators) == 0 {
+		return ddl()
+	}
+	err := replicators[0].quiesce(tables, func() error {
+		return runDDLWithReplicators(replicators[1:], tables, ddl)
+	})
+	if errors.Is(err, ErrReplicatorNotRunning) {
+		return runDDLWithReplicators(replicators[1:], tables, ddl)
+	}
+	return err
+}
+
+// quiesce runs fn on the replication goroutine after flushing the pending deltas,
+// if the replicator replicates any of the tables. Otherwise, fn runs without pausing the replicator.
+func (r *LogicalReplicator) quiesce(tables []TableName, fn func() error) (err error) {
+	affected := false
+	inspectErr := r.inspect(func(state *replicationState) {
+		var relations []uint32
+		for id, rel := range state.relations {
+			for _, t := range tables {
+				if strings.EqualFold(rel.Namespace, t.Schema) && strings.EqualFold(rel.RelationName, t.Table) {
+					relations = append(relations, id)
+					break
+				}
+			}
+		}
+		if len(relations) == 0 {
+			return
+		}
+		affected = true
+
+		if state.dirtyStream {
+			err = errStreamDirty
+			return
+		}
+		// All the pending deltas have to be flushed, since they are committed along with the LSN.
+		// The DDL flush reason also drops the delta appenders, which are recreated with the updated schemas.
+		if err = r.commitOngoingTxn(state, delta.DDLStmtFlushReason); err != nil {
+			return
+		}
+
+		if err = fn(); err != nil {
+			return
+		}
+
+		for _, id := range relations {
+			if err = state.cacheRelation(state.relations[id]); err != nil {
+				return
+			}
+			r.checkReplicatedColumns(state, id)
+		}
+	})
+	if inspectErr != nil {
+		return inspectErr
+	}
+	if !affected {
+		return fn()
+	}
+	return err
+}
+
+// checkReplicatedColumns warns if the table of a relation no longer has all the replicated columns after a DDL,
+// in which case the subsequent changes of the relation cannot be applied.
+func (r *LogicalReplicator) checkReplicatedColumns(state *replicationState, relationID uint32) {
+	rel := state.relations[relationID]
+	rows, err := adapter.QueryCatalog(state.replicaCtx,
+		"SELECT column_name FROM duckdb_columns() WHERE schema_name = ? AND table_name = ?",
+		rel.Namespace, rel.RelationName,
+	)
+	if err != nil {
+		r.logger.Warnf("Failed to check the columns of %s.%s: %v", rel.Namespace, rel.RelationName, err)
+		return
+	}
+	defer rows.Close()
+
+	columns := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			r.logger.Warnf("Failed to check the columns of %s.%s: %v", rel.Namespace, rel.RelationName, err)
+			return
+		}
+		columns[name] = struct{}{}
+	}
+	if len(columns) == 0 {
+		r.logger.Warnf("Replicated table %s.%s no longer exists", rel.Namespace, rel.RelationName)
+		return
+	}
+	for _, col := range rel.Columns {
+		if _, ok := columns[col.Name]; !ok {
+			r.logger.Warnf("Replicated column %q of %s.%s no longer exists", col.Name, rel.Namespace, rel.RelationName)
+		}
+	}
+}
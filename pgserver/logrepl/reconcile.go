@@ -0,0 +1,210 @@
+package logrepl
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/jackc/pglogrepl"
+)
+
+// A backup carries the LSNs of the subscriptions in the data file, but not their replication slots, which live on the
+// primaries. A replica restored from the backup can resume a subscription only if its slot still retains the changes
+// since the LSN of the replica. Otherwise, e.g., if the slot has been dropped, or if the replica that took the backup
+// has kept replicating from the slot since, starting the subscription would silently skip the changes in between.
+// So the restored subscriptions are reconciled with their slots before they are started, see ReconcileSubscriptions.
+// The binlog replica is reconciled with its source likewise, see binlogreplication.ReconcileRestored.
+
+// ReconcileStatus is the state of a restored subscription relative to its replication slot on the primary.
+type ReconcileStatus string
+
+const (
+	// ReconcileResumable means that the slot retains the changes since the LSN of the replica.
+	ReconcileResumable ReconcileStatus = "resumable"
+	// ReconcileSlotMissing means that the slot does not exist on the primary.
+	ReconcileSlotMissing ReconcileStatus = "slot missing"
+	// ReconcileSlotAhead means that the changes since the LSN of the replica have been confirmed to the slot already.
+	ReconcileSlotAhead ReconcileStatus = "slot ahead"
+	// ReconcileWALLost means that the primary has removed the WAL that the slot needs.
+	ReconcileWALLost ReconcileStatus = "wal lost"
+	// ReconcileSlotActive means that another replica is streaming from the slot, e.g., the one that took the backup.
+	ReconcileSlotActive ReconcileStatus = "slot active"
+	// ReconcileUnknown means that the slot could not be checked, e.g., since the primary is unreachable.
+	ReconcileUnknown ReconcileStatus = "unknown"
+)
+
+// Reconciliation is the result of the reconciliation of a restored subscription.
+type Reconciliation struct {
+	Subscription string
+	SlotName     string
+	// LSN is the LSN of the replica, and SlotLSN is the confirmed_flush_lsn of the slot.
+	LSN     pglogrepl.LSN
+	SlotLSN pglogrepl.LSN
+	Status  ReconcileStatus
+	// Resynced is true if the subscription has been copied again from a new snapshot,
+	// and Disabled is true if the subscription has been disabled since it cannot be resumed.
+	Resynced bool
+	Disabled bool
+	Err      error
+}
+
+func (rec Reconciliation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "subscription %s: %s (replica at %s", rec.Subscription, rec.Status, rec.LSN)
+	if rec.SlotLSN != 0 {
+		fmt.Fprintf(&b, ", slot %s at %s", rec.SlotName, rec.SlotLSN)
+	}
+	b.WriteString(")")
+	switch {
+	case rec.Err != nil:
+		fmt.Fprintf(&b, ": %v", rec.Err)
+	case rec.Resynced:
+		b.WriteString(", resynced from a new snapshot")
+	case rec.Disabled:
+		b.WriteString(", disabled")
+	}
+	return b.String()
+}
+
+// reconcileStatus compares the LSN of the replica with the state of the slot.
+func reconcileStatus(lsn pglogrepl.LSN, state SlotState, exists bool) ReconcileStatus {
+	switch {
+	case !exists:
+		return ReconcileSlotMissing
+	case state.WALStatus == "lost":
+		return ReconcileWALLost
+	case state.Active:
+		return ReconcileSlotActive
+	case state.ConfirmedFlushLSN > lsn:
+		return ReconcileSlotAhead
+	}
+	return ReconcileResumable
+}
+
+// ReconcileSubscriptions checks the enabled subscriptions of a restored catalog against their slots on the primaries.
+// It must be called before the subscriptions are started, see UpdateSubscriptions. A subscription that cannot be
+// resumed is resynced from a new snapshot if resync is true, or disabled otherwise, so that it is never started with
+// a gap in its changes. A subscription whose slot is active is never resynced, since that would take the slot over
+// from the replica streaming from it.
+func ReconcileSubscriptions(ctx *sql.Context, resync bool) ([]Reconciliation, error) {
+	subMap, err := loadSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var results []Reconciliation
+	for _, sub := range subMap {
+		if !sub.Enabled {
+			continue
+		}
+		results = append(results, reconcileSubscription(ctx, sub, resync))
+	}
+	slices.SortFunc(results, func(a, b Reconciliation) int {
+		return strings.Compare(a.Subscription, b.Subscription)
+	})
+	return results, nil
+}
+
+// check compares the LSN of the subscription with the state of its slot on the primary.
+func (rec *Reconciliation) check(sub *Subscription, r *LogicalReplicator) error {
+	lsn, err := pglogrepl.ParseLSN(sub.LsnStr)
+	if err != nil {
+		return err
+	}
+	rec.LSN = lsn
+	state, exists, err := r.SlotState(sub.slot())
+	if err != nil {
+		return err
+	}
+	rec.SlotLSN = state.ConfirmedFlushLSN
+	rec.Status = reconcileStatus(rec.LSN, state, exists)
+	return nil
+}
+
+func reconcileSubscription(ctx *sql.Context, sub *Subscription, resync bool) Reconciliation {
+	rec := Reconciliation{Subscription: sub.Subscription, SlotName: sub.slot(), Status: ReconcileUnknown}
+	r, err := sub.newReplicator()
+	if err == nil {
+		err = rec.check(sub, r)
+	}
+	if err != nil {
+		// The primary may be down for a while, in which case the subscription is left to retry as usual.
+		rec.Err = err
+		return rec
+	}
+	if rec.Status == ReconcileResumable {
+		return rec
+	}
+
+	if resync && rec.Status != ReconcileSlotActive {
+		rec.Err = resyncRestored(ctx, sub, r)
+		rec.Resynced = rec.Err == nil
+	} else {
+		rec.Err = disableRestored(ctx, sub)
+		rec.Disabled = rec.Err == nil
+	}
+	return rec
+}
+
+// resyncRestored copies the data of the primary again in the snapshot of a new slot, see resyncSubscription.
+// The subscription is not running yet, so it is started as usual by UpdateSubscriptions.
+func resyncRestored(ctx *sql.Context, sub *Subscription, r *LogicalReplicator) error {
+	if err := r.DropReplicationSlotIfExists(sub.slot()); err != nil {
+		return err
+	}
+	lsn, err := r.Snapshot(ctx, sub.Publication, true)
+	if err != nil {
+		return err
+	}
+	if err := UpdateSubscriptionLsn(ctx, lsn.String(), sub.Subscription); err != nil {
+		return err
+	}
+	return adapter.CommitAndCloseTxn(ctx)
+}
+
+func disableRestored(ctx *sql.Context, sub *Subscription) error {
+	if err := UpdateSubscriptionStatus(ctx, false, sub.Subscription); err != nil {
+		return err
+	}
+	return adapter.CommitAndCloseTxn(ctx)
+}
+
+// CheckRestoredSubscriptions checks the enabled subscriptions recorded in another catalog, e.g., the one attached by
+// RESTORE, against their slots on the primaries, without changing them. The subscriptions of a catalog are replicated
+// only while the server runs on it, and are reconciled by ReconcileSubscriptions then.
+func CheckRestoredSubscriptions(ctx *sql.Context, catalogName string) ([]Reconciliation, error) {
+	// The catalog may be restored from an older version, so only the columns of the first version are read.
+	rows, err := adapter.QueryCatalog(ctx, "SELECT subname, subconninfo, subpublication, subskiplsn FROM "+
+		catalog.ConnectIdentifiersANSI(catalogName, catalog.InternalTables.PgSubscription.Schema, catalog.InternalTables.PgSubscription.Name)+
+		" WHERE subenabled ORDER BY subname")
+	if err != nil {
+		return nil, err
+	}
+	var subs []*Subscription
+	for rows.Next() {
+		sub := &Subscription{Enabled: true}
+		if err := rows.Scan(&sub.Subscription, &sub.Conn, &sub.Publication, &sub.LsnStr); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]Reconciliation, 0, len(subs))
+	for _, sub := range subs {
+		rec := Reconciliation{Subscription: sub.Subscription, SlotName: sub.slot(), Status: ReconcileUnknown}
+		r, err := NewLogicalReplicator(sub.Subscription, sub.Conn)
+		if err == nil {
+			err = rec.check(sub, r)
+		}
+		rec.Err = err
+		results = append(results, rec)
+	}
+	return results, nil
+}
@@ -0,0 +1,42 @@
+package logrepl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileStatus(t *testing.T) {
+	const lsn = 0x1000
+	for _, tt := range []struct {
+		state  SlotState
+		exists bool
+		want   ReconcileStatus
+	}{
+		{SlotState{}, false, ReconcileSlotMissing},
+		{SlotState{ConfirmedFlushLSN: lsn - 1}, true, ReconcileResumable},
+		{SlotState{ConfirmedFlushLSN: lsn}, true, ReconcileResumable},
+		{SlotState{ConfirmedFlushLSN: lsn + 1}, true, ReconcileSlotAhead},
+		{SlotState{ConfirmedFlushLSN: lsn, Active: true}, true, ReconcileSlotActive},
+		{SlotState{WALStatus: "lost"}, true, ReconcileWALLost},
+	} {
+		require.Equal(t, tt.want, reconcileStatus(lsn, tt.state, tt.exists), "%+v", tt.state)
+	}
+
+	rec := Reconciliation{Subscription: "sub", SlotName: "pub", LSN: lsn, SlotLSN: lsn + 1, Status: ReconcileSlotAhead, Disabled: true}
+	require.Equal(t, "subscription sub: slot ahead (replica at 0/1000, slot pub at 0/1001), disabled", rec.String())
+	rec = Reconciliation{Subscription: "sub", SlotName: "pub", Status: ReconcileUnknown, Err: errors.New("connection refused")}
+	require.Equal(t, "subscription sub: unknown (replica at 0/0): connection refused", rec.String())
+}
+
+func TestForkedSlotName(t *testing.T) {
+	require.Equal(t, "mypub_a1b2c3d4", forkedSlotName("mypub", "a1b2c3d4"))
+
+	// The name is truncated to the maximum length of Postgres, keeping the suffix.
+	long := strings.Repeat("p", maxSlotNameLength)
+	name := forkedSlotName(long, "a1b2c3d4")
+	require.Len(t, name, maxSlotNameLength)
+	require.True(t, strings.HasSuffix(name, "_a1b2c3d4"))
+}
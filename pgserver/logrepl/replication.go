@@ -19,7 +19,6 @@ import (
 	stdsql "database/sql"
 	"errors"
 	"fmt"
-	"math"
 	"strings"
 	"sync"
 	"time"
@@ -28,6 +27,7 @@ import (
 	"github.com/apecloud/myduckserver/binlog"
 	"github.com/apecloud/myduckserver/catalog"
 	"github.com/apecloud/myduckserver/delta"
+	"github.com/apecloud/myduckserver/health"
 	"github.com/apecloud/myduckserver/pgtypes"
 	"github.com/dolthub/go-mysql-server/sql"
 	"github.com/jackc/pglogrepl"
@@ -49,12 +49,26 @@ type LogicalReplicator struct {
 	subscription  string
 	primaryDns    string
 	flushInterval time.Duration
+	// targetSchema is the schema that the tables are replicated into, or empty for the schemas of the primary.
+	targetSchema string
+	// schemaMapping maps the schemas of the primary to the schemas of the replica, which overrides targetSchema.
+	schemaMapping map[string]string
+	// slotName is the replication slot that the changes are streamed from, or empty for the slot named after the
+	// publication.
+	slotName string
 
 	running         bool
 	messageReceived bool
 	stop            chan struct{}
 	mu              *sync.Mutex
 
+	// requests are the diagnostic requests that are served by the replication goroutine, see inspect.
+	requests chan func(*replicationState)
+	// done is closed when the replication goroutine exits.
+	done chan struct{}
+	// progress tracks the sent and applied WAL positions, see Progress.
+	progress progressTracker
+
 	logger *logrus.Entry
 }
 
@@ -74,6 +88,43 @@ func NewLogicalReplicator(subscription, primaryDns string) (*LogicalReplicator,
 	}, nil
 }
 
+// SetTargetSchema sets the schema of the replica that the tables of the primary are replicated into, whatever their
+// schemas on the primary are, so that the subscriptions to different primaries do not write to the same tables.
+// The tables are replicated into the schemas of the same names as on the primary if it is empty.
+func (r *LogicalReplicator) SetTargetSchema(schema string) {
+	r.targetSchema = schema
+}
+
+// SetSchemaMapping sets the schemas of the replica that the tables of the schemas of the primary are replicated into,
+// see ParseSchemaMapping. The schemas that are not mapped are replicated as set by SetTargetSchema.
+func (r *LogicalReplicator) SetSchemaMapping(mapping map[string]string) {
+	r.schemaMapping = mapping
+}
+
+// SetSlotName sets the replication slot that the changes are streamed from, e.g., the slot of a replica bootstrapped
+// from another one, see ForkSlots. The slot named after the publication is used if it is empty.
+func (r *LogicalReplicator) SetSlotName(slotName string) {
+	r.slotName = slotName
+}
+
+// slot returns the replication slot that the changes of the publication are streamed from.
+func (r *LogicalReplicator) slot(publication string) string {
+	if r.slotName != "" {
+		return r.slotName
+	}
+	return publication
+}
+
+// replicaTable returns the table of the replica that a table of the primary is replicated into.
+func (r *LogicalReplicator) replicaTable(schema, name string) tableName {
+	if target, ok := r.schemaMapping[schema]; ok {
+		schema = target
+	} else if r.targetSchema != "" {
+		schema = r.targetSchema
+	}
+	return tableName{schema: schema, name: name}
+}
+
 // PrimaryDns returns the DNS for the primary database. Not suitable for RPCs used in replication e.g.
 // StartReplication. See ReplicationDns.
 func (r *LogicalReplicator) PrimaryDns() string {
@@ -89,55 +140,22 @@ func (r *LogicalReplicator) ReplicationDns() string {
 	return fmt.Sprintf("%s?replication=database", r.primaryDns)
 }
 
-// CaughtUp returns true if the replication slot is caught up to the primary, and false otherwise. This only works if
-// there is only a single replication slot on the primary, so it's only suitable for testing. This method uses a
-// threshold value to determine if the primary considers us caught up. This corresponds to the maximum number of bytes
-// that the primary is ahead of the replica's last flush position. This rarely is zero when caught up, since the
-// primary often sends additional WAL records after the last WAL location that was flushed to the replica. These
-// additional WAL locations cannot be recorded as flushed since they don't result in writes to the replica, and could
-// result in the primary not sending us necessary records after a shutdown and restart.
+// CaughtUp returns true if the replicator is caught up to the primary, and false otherwise. This method uses a
+// threshold value to determine if we are caught up, which is the maximum number of bytes of the WAL that the primary
+// has sent but we have not applied, see ReplicationProgress.Lag. The progress is tracked in-process for each
+// subscription, so it is cheap to call, but it is only as recent as the last message from the primary.
 func (r *LogicalReplicator) CaughtUp(threshold int) (bool, error) {
 	r.mu.Lock()
 	if !r.messageReceived {
 		r.mu.Unlock()
-		// We can't query the replication state until after receiving our first message
+		// We don't know the position of the primary until after receiving our first message
 		return false, nil
 	}
 	r.mu.Unlock()
 
-	r.logger.Debugf("Checking replication lag with threshold %d\n", threshold)
-	conn, err := pgx.Connect(context.Background(), r.PrimaryDns())
-	if err != nil {
-		return false, err
-	}
-	defer conn.Close(context.Background())
-
-	result, err := conn.Query(context.Background(), "SELECT pg_wal_lsn_diff(sent_lsn, flush_lsn) AS replication_lag FROM pg_stat_replication")
-	if err != nil {
-		return false, err
-	}
-	defer result.Close()
-
-	for result.Next() {
-		rows, err := result.Values()
-		if err != nil {
-			return false, err
-		}
-
-		row := rows[0]
-		r.logger.Debugf("Current replication lag: %+v", row)
-		lag, ok := row.(pgtype.Numeric)
-		if ok && lag.Valid {
-			return int(math.Abs(float64(lag.Int.Int64()))) < threshold, nil
-		}
-	}
-
-	if result.Err() != nil {
-		return false, result.Err()
-	}
-
-	// If we didn't get any rows, that usually means that replication has stopped and we're caught up
-	return true, nil
+	lag := r.Progress().Lag()
+	r.logger.Debugf("Current replication lag: %d, threshold: %d", lag, threshold)
+	return lag < uint64(threshold), nil
 }
 
 // maxConsecutiveFailures is the maximum number of consecutive RPC errors that can occur before we stop
@@ -185,13 +203,21 @@ type replicationState struct {
 	keys      map[uint32][]uint16 // relationID -> slice of key column indices
 	deltas    *delta.DeltaController
 
+	// tables are the states of the initial copy of the tables, which are kept across resets, see skipRelation.
+	tables map[tableName]SubscriptionTable
+
 	deltaBufSize    uint64    // size of the delta buffer in bytes
 	lastCommitTime  time.Time // time of last commit
 	commitCount     uint64    // number of commits
 	ongoingBatchTxn bool      // true if we're in a batched transaction
 	dirtyTxn        bool      // true if we have uncommitted changes
 	dirtyStream     bool      // true if the binlog stream does not end with a commit
+	replyRequested  bool      // true if the next status update should request a reply from the primary
+	pendingSince    time.Time // commit time of the oldest transaction not applied yet, see ReplicationProgress
 	inTxnStmtID     uint64    // statement ID within transaction
+
+	// pause is the pause of the application of the changes, which is kept across resets, see PauseApply.
+	pause applyPause
 }
 
 func (state *replicationState) reset(ctx *sql.Context, slotName string, lsn pglogrepl.LSN) {
@@ -214,12 +240,39 @@ func (state *replicationState) reset(ctx *sql.Context, slotName string, lsn pglo
 		keys:           map[uint32][]uint16{},
 		deltas:         delta.NewController(),
 		lastCommitTime: time.Now(),
+		tables:         state.tables,
+		pause:          state.pause,
+	}
+}
+
+// cacheRelation caches the relation and derives the schema and the key columns of the delta buffer from it.
+func (state *replicationState) cacheRelation(rel *pglogrepl.RelationMessageV2) error {
+	schema := make(sql.Schema, len(rel.Columns))
+	var keys []uint16
+	for i, col := range rel.Columns {
+		pgType, err := pgtypes.NewPostgresType(state.typeMap, col.DataType, col.TypeModifier)
+		if err != nil {
+			return err
+		}
+		schema[i] = &sql.Column{
+			Name:       col.Name,
+			Type:       pgType,
+			PrimaryKey: col.Flags == 1,
+		}
+		if col.Flags == 1 {
+			keys = append(keys, uint16(i))
+		}
 	}
+	state.relations[rel.RelationID] = rel
+	state.schemas[rel.RelationID] = schema
+	state.keys[rel.RelationID] = keys
+	return nil
 }
 
-// StartReplication starts the replication process for the given slot name. This function blocks until replication is
-// stopped via the Stop method, or an error occurs.
-func (r *LogicalReplicator) StartReplication(sqlCtx *sql.Context, slotName string) error {
+// StartReplication starts the replication process of the given publication from its slot, see SetSlotName. This function
+// blocks until replication is stopped via the Stop method, or an error occurs.
+func (r *LogicalReplicator) StartReplication(sqlCtx *sql.Context, publication string) error {
+	slotName := r.slot(publication)
 	sqlCtx.SetLogger(r.logger)
 	standbyMessageTimeout := 10 * time.Second
 	nextStandbyMessageDeadline := time.Now().Add(standbyMessageTimeout)
@@ -231,6 +284,9 @@ func (r *LogicalReplicator) StartReplication(sqlCtx *sql.Context, slotName strin
 
 	state := &replicationState{}
 	state.reset(sqlCtx, slotName, lastWrittenLsn)
+	if err := r.loadTableStates(sqlCtx, state); err != nil {
+		return err
+	}
 
 	// Switch to the `public` schema.
 	if _, err := adapter.ExecCatalog(sqlCtx, "USE public"); err != nil {
@@ -278,10 +334,12 @@ func (r *LogicalReplicator) StartReplication(sqlCtx *sql.Context, slotName strin
 			WALWritePosition: state.lastReceivedLSN + 1,
 			WALFlushPosition: state.lastWrittenLSN + 1,
 			WALApplyPosition: state.lastWrittenLSN + 1,
+			ReplyRequested:   state.replyRequested,
 		})
 		if err != nil {
 			return handleErrWithRetry(err, false)
 		}
+		state.replyRequested = false
 
 		r.logger.Debugf("Sent Standby status message with WALWritePosition = %s, WALApplyPosition = %s\n", state.lastReceivedLSN+1, state.lastWrittenLSN+1)
 		nextStandbyMessageDeadline = time.Now().Add(standbyMessageTimeout)
@@ -293,7 +351,10 @@ func (r *LogicalReplicator) StartReplication(sqlCtx *sql.Context, slotName strin
 	r.running = true
 	r.messageReceived = false
 	r.stop = make(chan struct{})
+	r.requests = make(chan func(*replicationState))
+	r.done = make(chan struct{})
 	r.mu.Unlock()
+	health.WatchReplication(r.subscription, r.replicationLag)
 
 	ticker := time.NewTicker(r.flushInterval)
 	defer ticker.Stop()
@@ -311,7 +372,7 @@ func (r *LogicalReplicator) StartReplication(sqlCtx *sql.Context, slotName strin
 
 			if primaryConn == nil {
 				var err error
-				primaryConn, err = r.beginReplication(slotName, state.lastWrittenLSN)
+				primaryConn, err = r.beginReplication(publication, slotName, state.lastWrittenLSN)
 				if err != nil {
 					// unlike other error cases, back off a little here, since we're likely to just get the same error again
 					// on initial replication establishment
@@ -327,6 +388,8 @@ func (r *LogicalReplicator) StartReplication(sqlCtx *sql.Context, slotName strin
 			}
 
 			if time.Now().After(nextStandbyMessageDeadline) && state.lastReceivedLSN > 0 {
+				// Ask for a keepalive, which tells the health probe that the primary is still there when it is idle.
+				state.replyRequested = true
 				err := sendStandbyStatusUpdate(state)
 				if err != nil {
 					return err
@@ -337,6 +400,26 @@ func (r *LogicalReplicator) StartReplication(sqlCtx *sql.Context, slotName strin
 				}
 			}
 
+			paused, err := r.checkPause(state)
+			if err != nil {
+				return err
+			}
+			if paused {
+				// The messages of the primary are left unread while paused, so the slot retains the WAL,
+				// and the status updates above keep the connection alive.
+				select {
+				case <-r.stop:
+					return errShutdownRequested
+				case request := <-r.requests:
+					request(state)
+					if state.replyRequested && primaryConn != nil {
+						return sendStandbyStatusUpdate(state)
+					}
+				case <-ticker.C:
+				}
+				return nil
+			}
+
 			ctx, cancel := context.WithDeadline(context.Background(), nextStandbyMessageDeadline)
 			receiveMsgChan := make(chan rcvMsg)
 			msgReceiverExited = make(chan struct{})
@@ -359,6 +442,13 @@ func (r *LogicalReplicator) StartReplication(sqlCtx *sql.Context, slotName strin
 				return nil
 			case msgAndErr = <-receiveMsgChan:
 				cancel()
+			case request := <-r.requests:
+				cancel()
+				request(state)
+				if state.replyRequested && primaryConn != nil {
+					return sendStandbyStatusUpdate(state)
+				}
+				return nil
 			case <-ticker.C:
 				cancel()
 				if time.Since(state.lastCommitTime) > r.flushInterval {
@@ -408,6 +498,7 @@ func (r *LogicalReplicator) StartReplication(sqlCtx *sql.Context, slotName strin
 
 				r.logger.Debugln("Primary Keepalive Message =>", "ServerWALEnd:", pkm.ServerWALEnd, "ServerTime:", pkm.ServerTime, "ReplyRequested:", pkm.ReplyRequested)
 				state.lastReceivedLSN = pkm.ServerWALEnd
+				r.progress.received(state, true)
 
 				if pkm.ReplyRequested {
 					return sendStandbyStatusUpdate(state)
@@ -423,6 +514,7 @@ func (r *LogicalReplicator) StartReplication(sqlCtx *sql.Context, slotName strin
 					// TODO: do we need more than one handler, one for each connection?
 					return handleErrWithRetry(err, true)
 				}
+				r.progress.received(state, false)
 				if commit {
 					return sendStandbyStatusUpdate(state)
 				}
@@ -467,6 +559,7 @@ func (r *LogicalReplicator) shutdown(ctx *sql.Context, state *replicationState)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.logger.Info("shutting down replicator")
+	health.RemoveReplication(r.subscription)
 
 	r.commitOngoingTxnIfClean(state, delta.OnCloseFlushReason)
 
@@ -475,6 +568,7 @@ func (r *LogicalReplicator) shutdown(ctx *sql.Context, state *replicationState)
 
 	r.running = false
 	close(r.stop)
+	close(r.done)
 }
 
 // Running returns whether replication is currently running
@@ -501,7 +595,7 @@ func (r *LogicalReplicator) Stop() {
 
 // beginReplication starts a new replication connection to the primary server and returns it. The LSN provided is the
 // last one we have confirmed that we flushed to disk.
-func (r *LogicalReplicator) beginReplication(slotName string, lastFlushLsn pglogrepl.LSN) (*pgconn.PgConn, error) {
+func (r *LogicalReplicator) beginReplication(publication, slotName string, lastFlushLsn pglogrepl.LSN) (*pgconn.PgConn, error) {
 	r.logger.Debugf("Connecting to primary for replication: %s", r.ReplicationDns())
 	conn, err := pgconn.Connect(context.Background(), r.ReplicationDns())
 	if err != nil {
@@ -512,7 +606,7 @@ func (r *LogicalReplicator) beginReplication(slotName string, lastFlushLsn pglog
 	// we also need to set 'streaming' to 'true'
 	pluginArguments := []string{
 		"proto_version '2'",
-		fmt.Sprintf("publication_names '%s'", slotName),
+		fmt.Sprintf("publication_names '%s'", publication),
 		"messages 'true'",
 		"streaming 'true'",
 	}
@@ -675,6 +769,64 @@ func (r *LogicalReplicator) createReplicationSlot(slotName string) error {
 	return nil
 }
 
+// SlotSnapshot is a replication slot along with the snapshot of the primary exported at its consistent point.
+// The data read in the snapshot plus the changes streamed from the slot starting at ConsistentPoint are exactly
+// the data of the primary, without any rows lost or duplicated.
+type SlotSnapshot struct {
+	SlotName        string
+	SnapshotName    string
+	ConsistentPoint pglogrepl.LSN
+
+	// conn is the replication connection that created the slot. The snapshot is valid only while it is open and idle.
+	conn *pgconn.PgConn
+}
+
+// Close releases the exported snapshot. The replication slot is kept.
+func (s *SlotSnapshot) Close() error {
+	return s.conn.Close(context.Background())
+}
+
+// CreateReplicationSlotWithSnapshot creates the replication slot named and exports a snapshot of the primary that is
+// consistent with it, which can be imported by other transactions with SET TRANSACTION SNAPSHOT until the returned
+// SlotSnapshot is closed. It fails if the slot already exists, since its consistent point has passed.
+// A temporary slot is dropped when the SlotSnapshot is closed, which is enough to copy a table again.
+func (r *LogicalReplicator) CreateReplicationSlotWithSnapshot(slotName string, temporary bool) (*SlotSnapshot, error) {
+	conn, err := pgconn.Connect(context.Background(), r.ReplicationDns())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to replication database: %w", err)
+	}
+
+	result, err := pglogrepl.CreateReplicationSlot(
+		context.Background(),
+		conn,
+		slotName,
+		outputPlugin,
+		pglogrepl.CreateReplicationSlotOptions{
+			Temporary:      temporary,
+			SnapshotAction: "EXPORT_SNAPSHOT",
+			Mode:           pglogrepl.LogicalReplication,
+		},
+	)
+	if err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("error creating replication slot '%s': %w", slotName, err)
+	}
+
+	lsn, err := pglogrepl.ParseLSN(result.ConsistentPoint)
+	if err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("failed to parse the consistent point of replication slot '%s': %w", slotName, err)
+	}
+
+	r.logger.Infof("Replication slot '%s' created with snapshot %s at %s", slotName, result.SnapshotName, lsn)
+	return &SlotSnapshot{
+		SlotName:        result.SlotName,
+		SnapshotName:    result.SnapshotName,
+		ConsistentPoint: lsn,
+		conn:            conn,
+	}, nil
+}
+
 // processMessage processes a logical replication message as appropriate. A couple important aspects:
 //  1. Relation messages describe tables being replicated and are used to build a type map for decoding tuples
 //  2. INSERT/UPDATE/DELETE messages describe changes to rows that must be applied to the replica.
@@ -700,6 +852,9 @@ func (r *LogicalReplicator) processMessage(
 
 	switch logicalMsg := logicalMsg.(type) {
 	case *pglogrepl.RelationMessageV2:
+		// The relation is known by the name of its table in the replica from now on.
+		logicalMsg.Namespace = r.replicaTable(logicalMsg.Namespace, logicalMsg.RelationName).schema
+
 		_, exists := state.relations[logicalMsg.RelationID]
 		if exists {
 			// This means schema changes have occurred, so we need to
@@ -710,33 +865,32 @@ func (r *LogicalReplicator) processMessage(
 			}
 		}
 
-		state.relations[logicalMsg.RelationID] = logicalMsg
-
-		schema := make(sql.Schema, len(logicalMsg.Columns))
-		var keys []uint16
-		for i, col := range logicalMsg.Columns {
-			pgType, err := pgtypes.NewPostgresType(state.typeMap, col.DataType, col.TypeModifier)
-			if err != nil {
-				return false, err
-			}
-			schema[i] = &sql.Column{
-				Name:       col.Name,
-				Type:       pgType,
-				PrimaryKey: col.Flags == 1,
-			}
-			if col.Flags == 1 {
-				keys = append(keys, uint16(i))
-			}
+		if err := state.cacheRelation(logicalMsg); err != nil {
+			return false, err
 		}
-		state.schemas[logicalMsg.RelationID] = schema
-		state.keys[logicalMsg.RelationID] = keys
 
 		// Create the table if it doesn't exist
+		if _, err := adapter.ExecCatalog(state.replicaCtx, "CREATE SCHEMA IF NOT EXISTS "+catalog.QuoteIdentifierANSI(logicalMsg.Namespace)); err != nil {
+			return false, err
+		}
 		if ddl, err := generateCreateTableStmt(logicalMsg); err != nil {
 			return false, err
 		} else if _, err := adapter.ExecCatalog(state.replicaCtx, ddl); err != nil {
 			return false, err
 		}
+		// A relation is sent again when its table is altered on the primary.
+		command := "CREATE TABLE"
+		if exists {
+			command = "ALTER TABLE"
+		}
+		catalog.PublishSchemaChanges(catalog.SchemaChange{
+			Command:    command,
+			ObjectType: catalog.SchemaObjectTable,
+			Database:   adapter.GetCurrentCatalog(state.replicaCtx),
+			Schema:     logicalMsg.Namespace,
+			Name:       logicalMsg.RelationName,
+			Origin:     catalog.SchemaChangeReplication,
+		})
 
 	case *pglogrepl.BeginMessage:
 		// Indicates the beginning of a group of changes in a transaction.
@@ -764,6 +918,9 @@ func (r *LogicalReplicator) processMessage(
 			}
 			state.ongoingBatchTxn = true
 		}
+		if state.pendingSince.IsZero() {
+			state.pendingSince = logicalMsg.CommitTime
+		}
 
 	case *pglogrepl.CommitMessage:
 		r.logger.Debugf("CommitMessage: %v", logicalMsg)
@@ -780,6 +937,10 @@ func (r *LogicalReplicator) processMessage(
 		}
 		state.dirtyStream = false
 		state.inTxnStmtID = 0
+		if !state.dirtyTxn {
+			// Nothing of the batch is left to be applied.
+			state.pendingSince = time.Time{}
+		}
 
 		state.processMessages = false
 
@@ -789,6 +950,9 @@ func (r *LogicalReplicator) processMessage(
 			r.logger.Debugf("Received stale message, ignoring. Last written LSN: %s Message LSN: %s", state.lastWrittenLSN, xld.ServerWALEnd)
 			return false, nil
 		}
+		if state.skipRelation(logicalMsg.RelationID) {
+			return false, nil
+		}
 
 		err = r.append(state, logicalMsg.RelationID, logicalMsg.Tuple.Columns, binlog.InsertRowEvent, binlog.InsertRowEvent, false)
 		if err != nil {
@@ -804,6 +968,9 @@ func (r *LogicalReplicator) processMessage(
 			r.logger.Debugf("Received stale message, ignoring. Last written LSN: %s Message LSN: %s", state.lastWrittenLSN, xld.ServerWALEnd)
 			return false, nil
 		}
+		if state.skipRelation(logicalMsg.RelationID) {
+			return false, nil
+		}
 
 		// Delete the old tuple
 		switch logicalMsg.OldTupleType {
@@ -838,6 +1005,9 @@ func (r *LogicalReplicator) processMessage(
 			r.logger.Debugf("Received stale message, ignoring. Last written LSN: %s Message LSN: %s", state.lastWrittenLSN, xld.ServerWALEnd)
 			return false, nil
 		}
+		if state.skipRelation(logicalMsg.RelationID) {
+			return false, nil
+		}
 
 		// Determine which columns to use based on OldTupleType
 		switch logicalMsg.OldTupleType {
@@ -871,6 +1041,9 @@ func (r *LogicalReplicator) processMessage(
 
 		// Truncate the tables
 		for _, relationID := range logicalMsg.RelationIDs {
+			if state.skipRelation(relationID) {
+				continue
+			}
 			if err := r.truncate(state, relationID); err != nil {
 				return false, err
 			}
@@ -888,6 +1061,10 @@ func (r *LogicalReplicator) processMessage(
 		r.logger.Debugf("Logical decoding message: %q, %q, %d", logicalMsg.Prefix, logicalMsg.Content, logicalMsg.Xid)
 	case *pglogrepl.StreamStartMessageV2:
 		state.inStream = true
+		if state.pendingSince.IsZero() {
+			// The commit time of a streamed transaction is not known until it is committed.
+			state.pendingSince = time.Now()
+		}
 		r.logger.Debugf("Stream start message: xid %d, first segment? %d", logicalMsg.Xid, logicalMsg.FirstSegment)
 	case *pglogrepl.StreamStopMessageV2:
 		state.inStream = false
@@ -1010,6 +1187,7 @@ func (r *LogicalReplicator) commitOngoingTxn(state *replicationState, flushReaso
 	if err := tx.Commit(); err != nil {
 		return err
 	}
+	state.deltas.Committed(state.replicaCtx)
 
 	// Reset transaction state
 	state.ongoingBatchTxn = false
@@ -1019,6 +1197,8 @@ func (r *LogicalReplicator) commitOngoingTxn(state *replicationState, flushReaso
 	state.lastCommitTime = time.Now()
 
 	state.lastWrittenLSN = state.lastCommitLSN
+	state.pendingSince = time.Time{}
+	r.progress.applied(state)
 
 	return nil
 }
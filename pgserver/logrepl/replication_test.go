@@ -719,7 +719,7 @@ func RunReplicationScript(t *testing.T, dsn string, script ReplicationTest) {
 }
 
 func newReplicator(sqlCtx *sql.Context, t *testing.T, primaryDns string) *logrepl.LogicalReplicator {
-	err := logrepl.CreateSubscription(sqlCtx, subscriptionName, primaryDns, slotName, pglogrepl.LSN(0).String(), true)
+	err := logrepl.CreateSubscription(sqlCtx, subscriptionName, primaryDns, slotName, pglogrepl.LSN(0).String(), true, "", "")
 	require.NoError(t, err)
 
 	tx := adapter.TryGetTxn(sqlCtx)
@@ -0,0 +1,46 @@
+package logrepl
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// A schema mapping, e.g., 'sales:sales_eu,public:eu', maps the schemas of the primary to the schemas of the replica
+// that their tables are replicated into, so that the tables of several primaries, e.g., all in their `public` schemas,
+// are consolidated into the replica without colliding. The schemas that are not mapped are replicated into the target
+// schema of the subscription if any, or into the schemas of the same names otherwise.
+
+// ParseSchemaMapping parses a schema mapping of the form 'src:dst,src2:dst2'.
+func ParseSchemaMapping(s string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		src, dst, ok := strings.Cut(pair, ":")
+		src, dst = strings.TrimSpace(src), strings.TrimSpace(dst)
+		if !ok || src == "" || dst == "" {
+			return nil, fmt.Errorf("invalid schema mapping %q: expected 'source:target' pairs separated by commas", pair)
+		}
+		if _, exists := mapping[src]; exists {
+			return nil, fmt.Errorf("invalid schema mapping: schema %q is mapped more than once", src)
+		}
+		mapping[src] = dst
+	}
+	return mapping, nil
+}
+
+// FormatSchemaMapping formats a schema mapping in the form parsed by ParseSchemaMapping, ordered by the source schemas.
+func FormatSchemaMapping(mapping map[string]string) string {
+	sources := make([]string, 0, len(mapping))
+	for src := range mapping {
+		sources = append(sources, src)
+	}
+	slices.Sort(sources)
+	pairs := make([]string, len(sources))
+	for i, src := range sources {
+		pairs[i] = src + ":" + mapping[src]
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,32 @@
+package logrepl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaMapping(t *testing.T) {
+	mapping, err := ParseSchemaMapping(" public : eu , sales:sales_eu")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"public": "eu", "sales": "sales_eu"}, mapping)
+	require.Equal(t, "public:eu,sales:sales_eu", FormatSchemaMapping(mapping))
+
+	mapping, err = ParseSchemaMapping("")
+	require.NoError(t, err)
+	require.Empty(t, mapping)
+
+	for _, invalid := range []string{"public", "public:", ":eu", "public:eu,", "public:eu,public:us"} {
+		_, err := ParseSchemaMapping(invalid)
+		require.Error(t, err, invalid)
+	}
+
+	r := &LogicalReplicator{}
+	require.Equal(t, tableName{"public", "t"}, r.replicaTable("public", "t"))
+	r.SetSchemaMapping(map[string]string{"public": "eu"})
+	require.Equal(t, tableName{"eu", "t"}, r.replicaTable("public", "t"))
+	require.Equal(t, tableName{"sales", "t"}, r.replicaTable("sales", "t"))
+	r.SetTargetSchema("other")
+	require.Equal(t, tableName{"eu", "t"}, r.replicaTable("public", "t"))
+	require.Equal(t, tableName{"other", "t"}, r.replicaTable("sales", "t"))
+}
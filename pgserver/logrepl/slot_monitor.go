@@ -0,0 +1,245 @@
+package logrepl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// A replication slot makes the primary retain the WAL since its restart_lsn, which grows without bound while MyDuck
+// is down or the replication is stuck, and may fill up the disk of the primary. The slot monitor checks the slots of
+// the subscriptions periodically, warns when they retain too much WAL, and optionally drops the slot and resyncs the
+// subscription from a new snapshot, like max_slot_wal_keep_size of Postgres but without losing the replica.
+
+// SlotMonitorOptions configures the slot monitor.
+type SlotMonitorOptions struct {
+	// Interval is how often the slots are checked.
+	Interval time.Duration
+	// WarnSize is the size in bytes of the retained WAL above which a warning is logged. Zero disables the warnings.
+	WarnSize int64
+	// MaxKeepSize is the size in bytes of the retained WAL above which the slot of an enabled subscription is dropped
+	// and the subscription is resynced. Zero disables the resyncs.
+	MaxKeepSize int64
+}
+
+// SlotState is the state of the replication slot of a subscription on the primary, as of the last check.
+type SlotState struct {
+	Subscription      string
+	SlotName          string
+	Active            bool
+	RestartLSN        pglogrepl.LSN
+	ConfirmedFlushLSN pglogrepl.LSN
+	// RetainedBytes is the size of the WAL that the primary retains for the slot.
+	RetainedBytes int64
+	// WALStatus is the availability of the WAL for the slot, see wal_status in pg_replication_slots.
+	// It is "lost" if the primary has removed the WAL that the slot needs.
+	WALStatus string
+	CheckedAt time.Time
+}
+
+// slotStates are the SlotState of the subscriptions, keyed by the subscription name.
+var slotStates sync.Map
+
+// resyncPending are the subscriptions whose resync has failed, keyed by the subscription name.
+// They are resynced again on the next check, since their slots may have been dropped already.
+var resyncPending sync.Map
+
+// SlotState queries the state of the replication slot named on the primary.
+// It returns false if the slot does not exist.
+func (r *LogicalReplicator) SlotState(slotName string) (SlotState, bool, error) {
+	conn, err := pgx.Connect(context.Background(), r.PrimaryDns())
+	if err != nil {
+		return SlotState{}, false, fmt.Errorf("failed to connect to primary database: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	state := SlotState{Subscription: r.subscription, SlotName: slotName, CheckedAt: time.Now()}
+	var restartLSN, confirmedFlushLSN string
+	err = conn.QueryRow(context.Background(), `SELECT active,
+		coalesce(restart_lsn::text, ''),
+		coalesce(confirmed_flush_lsn::text, ''),
+		coalesce(pg_wal_lsn_diff(pg_current_wal_lsn(), restart_lsn), 0)::bigint,
+		coalesce(wal_status, '')
+		FROM pg_replication_slots WHERE slot_name = $1`, slotName,
+	).Scan(&state.Active, &restartLSN, &confirmedFlushLSN, &state.RetainedBytes, &state.WALStatus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return state, false, nil
+	} else if err != nil {
+		return state, false, fmt.Errorf("error querying replication slot: %w", err)
+	}
+
+	// The LSNs are NULL if the WAL of the slot has been lost.
+	if restartLSN != "" {
+		if state.RestartLSN, err = pglogrepl.ParseLSN(restartLSN); err != nil {
+			return state, false, err
+		}
+	}
+	if confirmedFlushLSN != "" {
+		if state.ConfirmedFlushLSN, err = pglogrepl.ParseLSN(confirmedFlushLSN); err != nil {
+			return state, false, err
+		}
+	}
+	return state, true, nil
+}
+
+// ReplicationSlots returns the states of the replication slots of the subscriptions as of the last check,
+// ordered by subscription name.
+func ReplicationSlots() []SlotState {
+	var states []SlotState
+	slotStates.Range(func(key, value any) bool {
+		states = append(states, value.(SlotState))
+		return true
+	})
+	slices.SortFunc(states, func(a, b SlotState) int {
+		return strings.Compare(a.Subscription, b.Subscription)
+	})
+	return states
+}
+
+// SlotMonitor checks the replication slots of the subscriptions periodically.
+type SlotMonitor struct {
+	// newCtx creates the context of a replicator, which is needed to resync a subscription.
+	newCtx func() *sql.Context
+	opts   SlotMonitorOptions
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewSlotMonitor(newCtx func() *sql.Context, opts SlotMonitorOptions) *SlotMonitor {
+	return &SlotMonitor{newCtx: newCtx, opts: opts}
+}
+
+// Start runs the checks in the background until Stop is called.
+func (m *SlotMonitor) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for {
+			checkSlots(m.newCtx, m.opts)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(m.opts.Interval):
+			}
+		}
+	}()
+}
+
+// Stop stops the checks and waits for the current one to finish.
+func (m *SlotMonitor) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+		m.wg.Wait()
+	}
+}
+
+// checkSlots checks the replication slot of every subscription.
+func checkSlots(newCtx func() *sql.Context, opts SlotMonitorOptions) {
+	var subscriptions []*Subscription
+	subscriptionMap.Range(func(key, value any) bool {
+		if sub, ok := value.(*Subscription); ok && sub.Replicator != nil {
+			subscriptions = append(subscriptions, sub)
+		}
+		return true
+	})
+	live := make(map[string]bool, len(subscriptions))
+	for _, sub := range subscriptions {
+		live[sub.Subscription] = true
+		checkSlot(newCtx, sub, opts)
+	}
+	// Forget the dropped subscriptions.
+	for _, m := range []*sync.Map{&slotStates, &resyncPending} {
+		m.Range(func(key, value any) bool {
+			if !live[key.(string)] {
+				m.Delete(key)
+			}
+			return true
+		})
+	}
+}
+
+func checkSlot(newCtx func() *sql.Context, sub *Subscription, opts SlotMonitorOptions) {
+	logger := sub.Replicator.logger.WithField("subscription", sub.Subscription)
+	if _, pending := resyncPending.Load(sub.Subscription); pending && sub.Enabled {
+		resync(newCtx, sub, logger)
+		return
+	}
+
+	state, exists, err := sub.Replicator.SlotState(sub.slot())
+	if err != nil {
+		logger.WithError(err).Warn("Failed to check the replication slot")
+		return
+	}
+	if !exists {
+		// The slot is created along with the subscription.
+		slotStates.Delete(sub.Subscription)
+		return
+	}
+	slotStates.Store(sub.Subscription, state)
+
+	lost := state.WALStatus == "lost"
+	if !lost && (opts.MaxKeepSize <= 0 || state.RetainedBytes <= opts.MaxKeepSize) {
+		if opts.WarnSize > 0 && state.RetainedBytes > opts.WarnSize {
+			logger.Warnf("The replication slot %s retains %d bytes of WAL on the primary since %s, which exceeds %d bytes",
+				state.SlotName, state.RetainedBytes, state.RestartLSN, opts.WarnSize)
+		}
+		return
+	}
+
+	switch {
+	case opts.MaxKeepSize <= 0:
+		logger.Errorf("The primary has removed the WAL needed by the replication slot %s, so the subscription must be recreated", state.SlotName)
+	case !sub.Enabled:
+		logger.Warnf("The replication slot %s retains %d bytes of WAL on the primary, but the subscription is not resynced since it is disabled",
+			state.SlotName, state.RetainedBytes)
+	default:
+		logger.Warnf("The replication slot %s retains %d bytes of WAL on the primary, which exceeds %d bytes, resyncing the subscription",
+			state.SlotName, state.RetainedBytes, opts.MaxKeepSize)
+		resync(newCtx, sub, logger)
+	}
+}
+
+// resync drops the replication slot of the subscription, and copies the data of the primary again in the snapshot
+// of a new slot, then restarts the replication from it.
+func resync(newCtx func() *sql.Context, sub *Subscription, logger *logrus.Entry) {
+	if err := resyncSubscription(newCtx(), sub); err != nil {
+		logger.WithError(err).Error("Failed to resync the subscription, retrying on the next check")
+		resyncPending.Store(sub.Subscription, true)
+		return
+	}
+	logger.Info("Resynced the subscription")
+	resyncPending.Delete(sub.Subscription)
+}
+
+func resyncSubscription(ctx *sql.Context, sub *Subscription) error {
+	r := sub.Replicator
+	r.Stop()
+	if err := r.DropReplicationSlotIfExists(sub.slot()); err != nil {
+		return err
+	}
+	lsn, err := r.Snapshot(ctx, sub.Publication, true)
+	if err != nil {
+		return err
+	}
+	if err := UpdateSubscriptionLsn(ctx, lsn.String(), sub.Subscription); err != nil {
+		return err
+	}
+	if err := adapter.CommitAndCloseTxn(ctx); err != nil {
+		return err
+	}
+	go r.StartReplication(ctx, sub.Publication)
+	return nil
+}
@@ -0,0 +1,220 @@
+package logrepl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5"
+)
+
+// Snapshot creates the replication slot of the publication, see SetSlotName, and copies the tables of the primary into the replica in the snapshot
+// exported at the slot's consistent point, which is returned. The streaming from the slot must start at that point,
+// so that no changes are lost or applied twice. The slot is dropped if the snapshot cannot be read at all, since it
+// would retain the WAL on the primary forever.
+//
+// The tables of the publication are copied one by one, and a table that fails to be copied is left in the error state of
+// pg_subscription_rel instead of failing the others, so that it can be copied again by RefreshSubscriptionTables.
+func (r *LogicalReplicator) Snapshot(sqlCtx *sql.Context, publication string, replace bool) (pglogrepl.LSN, error) {
+	snapshot, err := r.CreateReplicationSlotWithSnapshot(r.slot(publication), false)
+	if err != nil {
+		return 0, err
+	}
+
+	failed, err := r.copySnapshot(sqlCtx, snapshot, publication, nil, replace)
+	if closeErr := snapshot.Close(); closeErr != nil {
+		r.logger.Warnf("failed to release the exported snapshot: %v", closeErr)
+	}
+	if err != nil {
+		if dropErr := r.DropReplicationSlotIfExists(snapshot.SlotName); dropErr != nil {
+			r.logger.Warnf("failed to drop replication slot %s: %v", snapshot.SlotName, dropErr)
+		}
+		return 0, err
+	}
+	if len(failed) > 0 {
+		r.logger.Warnf("Failed to copy %d tables of subscription %s: %v; they are not replicated until copied again by ALTER SUBSCRIPTION %s REFRESH TABLES",
+			len(failed), r.subscription, failed, r.subscription)
+	}
+	return snapshot.ConsistentPoint, nil
+}
+
+// copySnapshot copies the tables of the publication in the exported snapshot into the replica, each in a transaction
+// of its own, and records their states in pg_subscription_rel. If only is nil, all tables are copied and the states
+// of the subscription are reset, otherwise only the tables given, which are named as in the replica, are.
+// If replace is true, the existing tables of the replica are replaced, which is the case of a resync.
+// The tables that fail to be copied are returned.
+func (r *LogicalReplicator) copySnapshot(sqlCtx *sql.Context, snapshot *SlotSnapshot, publication string, only []tableName, replace bool) ([]tableName, error) {
+	// If there is ongoing transcation, commit it
+	if txn := adapter.TryGetTxn(sqlCtx); txn != nil {
+		if err := func() error {
+			defer txn.Rollback()
+			defer adapter.CloseTxn(sqlCtx)
+			return txn.Commit()
+		}(); err != nil {
+			return nil, fmt.Errorf("failed to commit current transaction: %w", err)
+		}
+	}
+
+	attachName := fmt.Sprintf("__pg_src_%d__", sqlCtx.ID())
+	if _, err := adapter.ExecCatalog(sqlCtx, fmt.Sprintf("ATTACH '%s' AS %s (TYPE POSTGRES, READ_ONLY)", r.PrimaryDns(), attachName)); err != nil {
+		return nil, fmt.Errorf("failed to attach connection: %w", err)
+	}
+
+	defer func() {
+		if _, err := adapter.ExecCatalog(sqlCtx, fmt.Sprintf("DETACH %s", attachName)); err != nil {
+			r.logger.Warnf("failed to detach connection: %v", err)
+		}
+	}()
+
+	// COPY DATABASE is buggy - it corrupts the WAL so the server cannot be restarted.
+	// So we need to copy tables one by one.
+	// if _, err := adapter.ExecCatalogInTxn(sqlCtx, fmt.Sprintf("COPY FROM DATABASE %s TO mysql", attachName)); err != nil {
+	// 	return fmt.Errorf("failed to copy from database: %w", err)
+	// }
+
+	// The tables of the primary, and the tables of the replica that they are copied into.
+	sources, err := r.publicationTables(publication)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]tableName, len(sources))
+	for i, t := range sources {
+		tables[i] = r.replicaTable(t.schema, t.name)
+	}
+
+	var failed []tableName
+	if only != nil {
+		source := make(map[tableName]tableName, len(tables))
+		for i, t := range tables {
+			source[t] = sources[i]
+		}
+		sources, tables = sources[:0], tables[:0]
+		for _, t := range only {
+			if s, ok := source[t]; ok {
+				sources, tables = append(sources, s), append(tables, t)
+				continue
+			}
+			err := inCatalogTxn(sqlCtx, func() error {
+				return setTableSyncState(sqlCtx, r.subscription, t, TableSyncError, 0, "the table does not exist on the primary")
+			})
+			if err != nil {
+				return nil, err
+			}
+			failed = append(failed, t)
+		}
+	}
+
+	// Create all schemas in the target database, and mark the tables as waiting to be copied.
+	if err := inCatalogTxn(sqlCtx, func() error {
+		if only == nil {
+			if err := deleteSubscriptionTables(sqlCtx, r.subscription); err != nil {
+				return err
+			}
+		}
+		for _, t := range tables {
+			if _, err := adapter.ExecCatalogInTxn(sqlCtx, `CREATE SCHEMA IF NOT EXISTS `+catalog.QuoteIdentifierANSI(t.schema)); err != nil {
+				return fmt.Errorf("failed to create schema: %w", err)
+			}
+			if err := setTableSyncState(sqlCtx, r.subscription, t, TableSyncWaiting, 0, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	for i, t := range tables {
+		if err := r.copyTable(sqlCtx, snapshot, attachName, sources[i], t, replace); err != nil {
+			r.logger.Warnf("Failed to copy table %s: %v", t, err)
+			failed = append(failed, t)
+		}
+	}
+	return failed, nil
+}
+
+// copyTable copies a table of the primary in the exported snapshot into the table t of the replica, and marks it as
+// synced at the consistent point of the snapshot in the same transaction. If the copy fails, it is marked with the error.
+func (r *LogicalReplicator) copyTable(sqlCtx *sql.Context, snapshot *SlotSnapshot, attachName string, source, t tableName, replace bool) error {
+	if err := inCatalogTxn(sqlCtx, func() error {
+		return setTableSyncState(sqlCtx, r.subscription, t, TableSyncCopying, 0, "")
+	}); err != nil {
+		return err
+	}
+
+	create := `CREATE TABLE `
+	if replace {
+		create = `CREATE OR REPLACE TABLE `
+	}
+	copyErr := inCatalogTxn(sqlCtx, func() error {
+		// The transaction on the attached database begins with importing the snapshot, before reading any table.
+		if _, err := adapter.ExecCatalogInTxn(
+			sqlCtx,
+			fmt.Sprintf("CALL postgres_execute('%s', 'SET TRANSACTION SNAPSHOT ''%s''')", attachName, snapshot.SnapshotName),
+		); err != nil {
+			return fmt.Errorf("failed to import snapshot %s: %w", snapshot.SnapshotName, err)
+		}
+		if _, err := adapter.ExecCatalogInTxn(
+			sqlCtx,
+			create+catalog.ConnectIdentifiersANSI(t.schema, t.name)+` AS FROM `+catalog.ConnectIdentifiersANSI(attachName, source.schema, source.name),
+		); err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+		return setTableSyncState(sqlCtx, r.subscription, t, TableSyncReady, snapshot.ConsistentPoint, "")
+	})
+	if copyErr == nil {
+		return nil
+	}
+
+	if err := inCatalogTxn(sqlCtx, func() error {
+		return setTableSyncState(sqlCtx, r.subscription, t, TableSyncError, 0, copyErr.Error())
+	}); err != nil {
+		r.logger.Warnf("Failed to record the error of table %s: %v", t, err)
+	}
+	return copyErr
+}
+
+// publicationTables returns the tables of the publication on the primary. Only they are replicated by the slot,
+// so a subscription does not copy the tables of the others that share the primary.
+func (r *LogicalReplicator) publicationTables(publication string) ([]tableName, error) {
+	conn, err := pgx.Connect(context.Background(), r.PrimaryDns())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to primary database: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	rows, err := conn.Query(context.Background(),
+		`SELECT schemaname, tablename FROM pg_publication_tables WHERE pubname = $1 ORDER BY schemaname, tablename`, publication)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the tables of publication %s: %w", publication, err)
+	}
+	defer rows.Close()
+
+	var tables []tableName
+	for rows.Next() {
+		var t tableName
+		if err := rows.Scan(&t.schema, &t.name); err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// inCatalogTxn runs fn in a new transaction of the catalog, which is committed if fn succeeds.
+func inCatalogTxn(sqlCtx *sql.Context, fn func() error) error {
+	txn, err := adapter.GetCatalogTxn(sqlCtx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get transaction: %w", err)
+	}
+	defer txn.Rollback()
+	defer adapter.CloseTxn(sqlCtx)
+
+	if err := fn(); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
@@ -17,7 +17,24 @@ type Subscription struct {
 	Publication  string
 	LsnStr       string
 	Enabled      bool
-	Replicator   *LogicalReplicator
+	// Schema is the schema of the replica that the tables are replicated into, or empty for the schemas of the primary.
+	Schema string
+	// SchemaMapping maps the schemas of the primary to the schemas of the replica, see ParseSchemaMapping.
+	SchemaMapping string
+	// SlotName is the replication slot of the subscription, or empty for the slot named after the publication,
+	// see ForkSlots.
+	SlotName   string
+	Replicator *LogicalReplicator
+	// provider is the database provider of the server that runs the replication, see SetContextFactory.
+	provider *catalog.DatabaseProvider
+}
+
+// slot returns the replication slot that the subscription streams from.
+func (sub *Subscription) slot() string {
+	if sub.SlotName != "" {
+		return sub.SlotName
+	}
+	return sub.Publication
 }
 
 var keyColumns = []string{"subname"}
@@ -26,39 +43,116 @@ var lsnValueColumns = []string{"subskiplsn"}
 
 var subscriptionMap = sync.Map{}
 
-func UpdateSubscriptions(ctx *sql.Context) error {
+// updateMu serializes UpdateSubscriptions, which may be called by several sessions at once.
+var updateMu sync.Mutex
+
+// contextFactories are the functions that create the contexts of the replicators of the servers in the process
+// by their database providers, see SetContextFactory.
+var contextFactories sync.Map // map[*catalog.DatabaseProvider]func() *sql.Context
+
+// SetContextFactory sets the function that creates the contexts of the replicators of the server of the provider.
+// Each replicator applies the changes in a session of its own, so that the subscriptions share neither a DuckDB
+// connection nor a transaction with each other or with the session that starts them. If it is not set, the replicators
+// run in the context given to UpdateSubscriptions. A nil newCtx removes the function.
+func SetContextFactory(provider *catalog.DatabaseProvider, newCtx func() *sql.Context) {
+	if newCtx == nil {
+		contextFactories.Delete(provider)
+		return
+	}
+	contextFactories.Store(provider, newCtx)
+}
+
+// providerSession is a session that knows its database provider, e.g., backend.Session.
+type providerSession interface {
+	Provider() *catalog.DatabaseProvider
+}
+
+// providerOf returns the database provider of the session of the context, or nil if it has none.
+func providerOf(ctx *sql.Context) *catalog.DatabaseProvider {
+	if sess, ok := ctx.Session.(providerSession); ok {
+		return sess.Provider()
+	}
+	return nil
+}
+
+// start starts the replication of the subscription in the background, in a context of its own if possible,
+// whose DuckDB connection is closed when the replication stops.
+func (sub *Subscription) start(ctx *sql.Context) {
+	newCtx, ok := contextFactories.Load(sub.provider)
+	if !ok {
+		go sub.Replicator.StartReplication(ctx, sub.Publication)
+		return
+	}
+	ctx = newCtx.(func() *sql.Context)()
+	go func() {
+		defer adapter.CloseConn(ctx)
+		sub.Replicator.StartReplication(ctx, sub.Publication)
+	}()
+}
+
+// loadSubscriptions returns the recorded subscriptions, keyed by the subscription name, without their replicators.
+func loadSubscriptions(ctx *sql.Context) (map[string]*Subscription, error) {
 	rows, err := adapter.QueryCatalog(ctx, catalog.InternalTables.PgSubscription.SelectAllStmt())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
 
+	provider := providerOf(ctx)
 	var subMap = make(map[string]*Subscription)
 	for rows.Next() {
 		var name, conn, pub, lsn string
 		var enabled bool
-		if err := rows.Scan(&name, &conn, &pub, &lsn, &enabled); err != nil {
-			return err
+		var schema, schemaMapping, slotName stdsql.NullString
+		if err := rows.Scan(&name, &conn, &pub, &lsn, &enabled, &schema, &schemaMapping, &slotName); err != nil {
+			return nil, err
 		}
 		subMap[name] = &Subscription{
-			Subscription: name,
-			Conn:         conn,
-			Publication:  pub,
-			LsnStr:       lsn,
-			Enabled:      enabled,
-			Replicator:   nil,
+			Subscription:  name,
+			Conn:          conn,
+			Publication:   pub,
+			LsnStr:        lsn,
+			Enabled:       enabled,
+			Schema:        schema.String,
+			SchemaMapping: schemaMapping.String,
+			SlotName:      slotName.String,
+			Replicator:    nil,
+			provider:      provider,
 		}
 	}
+	return subMap, rows.Err()
+}
+
+// newReplicator creates the replicator of the subscription, which replicates into the schemas of the subscription.
+func (sub *Subscription) newReplicator() (*LogicalReplicator, error) {
+	replicator, err := NewLogicalReplicator(sub.Subscription, sub.Conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create logical replicator: %v", err)
+	}
+	replicator.SetTargetSchema(sub.Schema)
+	mapping, err := ParseSchemaMapping(sub.SchemaMapping)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema mapping of subscription %s: %v", sub.Subscription, err)
+	}
+	replicator.SetSchemaMapping(mapping)
+	replicator.SetSlotName(sub.SlotName)
+	return replicator, nil
+}
 
-	if err = rows.Err(); err != nil {
+func UpdateSubscriptions(ctx *sql.Context) error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	subMap, err := loadSubscriptions(ctx)
+	if err != nil {
 		return err
 	}
 
 	for tempName, tempSub := range subMap {
 		if _, loaded := subscriptionMap.LoadOrStore(tempName, tempSub); !loaded {
-			replicator, err := NewLogicalReplicator(tempName, tempSub.Conn)
+			replicator, err := tempSub.newReplicator()
 			if err != nil {
-				return fmt.Errorf("failed to create logical replicator: %v", err)
+				return err
 			}
 
 			if sub, ok := subscriptionMap.Load(tempName); ok {
@@ -67,12 +161,12 @@ func UpdateSubscriptions(ctx *sql.Context) error {
 				}
 			}
 
-			err = replicator.CreateReplicationSlotIfNotExists(tempSub.Publication)
+			err = replicator.CreateReplicationSlotIfNotExists(tempSub.slot())
 			if err != nil {
 				return fmt.Errorf("failed to create replication slot: %v", err)
 			}
 			if tempSub.Enabled {
-				go replicator.StartReplication(ctx, tempSub.Publication)
+				tempSub.start(ctx)
 			}
 		} else {
 			if sub, ok := subscriptionMap.Load(tempName); ok {
@@ -80,7 +174,7 @@ func UpdateSubscriptions(ctx *sql.Context) error {
 					if tempSub.Enabled != subscription.Enabled {
 						subscription.Enabled = tempSub.Enabled
 						if subscription.Enabled {
-							go subscription.Replicator.StartReplication(ctx, subscription.Publication)
+							subscription.start(ctx)
 						} else {
 							subscription.Replicator.Stop()
 						}
@@ -103,11 +197,63 @@ func UpdateSubscriptions(ctx *sql.Context) error {
 	return nil
 }
 
-func CreateSubscription(ctx *sql.Context, name, conn, pub, lsn string, enabled bool) error {
-	_, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.PgSubscription.UpsertStmt(), name, conn, pub, lsn, enabled)
+// StopSubscriptions stops the replication of the subscriptions of the server of the provider when the server shuts
+// down, without changing their recorded status, and forgets them, so that they are started again with the server.
+func StopSubscriptions(provider *catalog.DatabaseProvider) {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+	subscriptionMap.Range(func(key, value any) bool {
+		if sub, ok := value.(*Subscription); ok && sub.provider == provider {
+			if sub.Replicator != nil {
+				sub.Replicator.Stop()
+			}
+			subscriptionMap.Delete(key)
+		}
+		return true
+	})
+}
+
+// PauseSubscriptions stops the replication of the enabled subscriptions without changing their recorded status,
+// e.g., while the data file is backed up. See ResumeSubscriptions.
+func PauseSubscriptions() {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+	subscriptionMap.Range(func(_, value any) bool {
+		if sub, ok := value.(*Subscription); ok && sub.Enabled && sub.Replicator != nil {
+			sub.Replicator.Stop()
+		}
+		return true
+	})
+}
+
+// ResumeSubscriptions restarts the replication of the enabled subscriptions stopped by PauseSubscriptions.
+func ResumeSubscriptions(ctx *sql.Context) {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+	subscriptionMap.Range(func(_, value any) bool {
+		if sub, ok := value.(*Subscription); ok && sub.Enabled && sub.Replicator != nil {
+			sub.start(ctx)
+		}
+		return true
+	})
+}
+
+// CreateSubscription records the subscription. The tables are replicated into the schemas mapped by the schema mapping,
+// see ParseSchemaMapping, then into the schema given, or into the schemas of the primary if both are empty.
+func CreateSubscription(ctx *sql.Context, name, conn, pub, lsn string, enabled bool, schema, schemaMapping string) error {
+	_, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.PgSubscription.UpsertStmt(),
+		name, conn, pub, lsn, enabled, nullIfEmpty(schema), nullIfEmpty(schemaMapping), nil)
 	return err
 }
 
+// nullIfEmpty returns nil for an empty string, which is stored as NULL.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 func UpdateSubscriptionStatus(ctx *sql.Context, enabled bool, name string) error {
 	_, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.PgSubscription.UpdateStmt(keyColumns, statusValueColumns), enabled, name)
 	return err
@@ -119,8 +265,10 @@ func UpdateAllSubscriptionStatus(ctx *sql.Context, enabled bool) error {
 }
 
 func DeleteSubscription(ctx *sql.Context, name string) error {
-	_, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.PgSubscription.DeleteStmt(), name)
-	return err
+	if _, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.PgSubscription.DeleteStmt(), name); err != nil {
+		return err
+	}
+	return deleteSubscriptionTables(ctx, name)
 }
 
 func UpdateSubscriptionLsn(ctx *sql.Context, lsn, name string) error {
@@ -0,0 +1,97 @@
+package logrepl
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// A switchover moves a replica to the primary role and back. The subscriptions are parked when the replica is promoted,
+// i.e., they are disabled but kept along with their slots, and resubscribed when it is demoted, possibly to another
+// primary. The tables may have been written while the server was the primary, so they are copied again from a new
+// snapshot of the primary then, the same as a resync.
+
+var resubscribeValueColumns = []string{"subconninfo", "subskiplsn", "subenabled"}
+
+// Subscriptions returns the recorded subscriptions ordered by name, without their replicators.
+func Subscriptions(ctx *sql.Context) ([]*Subscription, error) {
+	subMap, err := loadSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]*Subscription, 0, len(subMap))
+	for _, sub := range subMap {
+		subs = append(subs, sub)
+	}
+	slices.SortFunc(subs, func(a, b *Subscription) int {
+		return strings.Compare(a.Subscription, b.Subscription)
+	})
+	return subs, nil
+}
+
+// ParkSubscriptions disables the subscriptions given and stops their replication. The replicators commit the changes
+// applied so far when they stop, so the replica is consistent with the LSNs of the subscriptions afterward.
+func ParkSubscriptions(ctx *sql.Context, names []string) error {
+	for _, name := range names {
+		if err := UpdateSubscriptionStatus(ctx, false, name); err != nil {
+			return err
+		}
+	}
+	if err := adapter.CommitAndCloseTxn(ctx); err != nil {
+		return err
+	}
+	return UpdateSubscriptions(ctx)
+}
+
+// ResubscribeSubscriptions points the subscriptions given to the primary of the connection string, copies their tables
+// again in the snapshot of a new slot, and starts them. A subscription is enabled only once its tables are copied,
+// so the call can be repeated for the subscriptions left disabled by a failure.
+func ResubscribeSubscriptions(ctx *sql.Context, subs []*Subscription, conn string) error {
+	for _, sub := range subs {
+		if err := resubscribe(ctx, sub, conn); err != nil {
+			return fmt.Errorf("failed to resubscribe subscription %s: %w", sub.Subscription, err)
+		}
+	}
+	return UpdateSubscriptions(ctx)
+}
+
+func resubscribe(ctx *sql.Context, sub *Subscription, conn string) error {
+	// The replicator is connected to the previous primary, so it is created again by UpdateSubscriptions.
+	forgetSubscription(sub.Subscription)
+
+	if err := CreatePublicationIfNotExists(conn, sub.Publication); err != nil {
+		return err
+	}
+	sub.Conn = conn
+	r, err := sub.newReplicator()
+	if err != nil {
+		return err
+	}
+	if err := r.DropReplicationSlotIfExists(sub.slot()); err != nil {
+		return err
+	}
+	lsn, err := r.Snapshot(ctx, sub.Publication, true)
+	if err != nil {
+		return err
+	}
+	if _, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.PgSubscription.UpdateStmt(keyColumns, resubscribeValueColumns),
+		conn, lsn.String(), true, sub.Subscription); err != nil {
+		return err
+	}
+	return adapter.CommitAndCloseTxn(ctx)
+}
+
+// forgetSubscription stops the replication of the subscription and removes it from the running subscriptions.
+func forgetSubscription(name string) {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+	if value, ok := subscriptionMap.LoadAndDelete(name); ok {
+		if sub, ok := value.(*Subscription); ok && sub.Replicator != nil {
+			sub.Replicator.Stop()
+		}
+	}
+}
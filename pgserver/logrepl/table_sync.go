@@ -0,0 +1,198 @@
+package logrepl
+
+import (
+	stdsql "database/sql"
+	"fmt"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/jackc/pglogrepl"
+)
+
+// The initial copy of a subscription is done table by table, and the state of each table is recorded in the
+// pg_subscription_rel internal table, like pg_subscription_rel of Postgres. The replicator skips the changes of the
+// tables that are not synced yet, and the changes of a synced table that were committed before the snapshot that it
+// was copied in, since they are in the copy already. So a table whose copy has failed can be copied again later in
+// a new snapshot, see RefreshSubscriptionTables, without copying the others again.
+// The tables that are not in pg_subscription_rel, i.e., created on the primary after the initial copy,
+// are replicated from the start.
+
+// TableSyncState is the state of the initial copy of a table of a subscription, see srsubstate in pg_subscription_rel.
+type TableSyncState string
+
+const (
+	// TableSyncWaiting means that the table is waiting to be copied.
+	TableSyncWaiting TableSyncState = "i"
+	// TableSyncCopying means that the table is being copied.
+	TableSyncCopying TableSyncState = "d"
+	// TableSyncReady means that the table has been copied and its changes are replicated.
+	TableSyncReady TableSyncState = "r"
+	// TableSyncError means that the copy has failed. Unlike Postgres, the copy is not retried automatically.
+	TableSyncError TableSyncState = "e"
+)
+
+// SubscriptionTable is the state of a table of a subscription.
+type SubscriptionTable struct {
+	Schema string
+	Name   string
+	State  TableSyncState
+	// LSN is the consistent point of the snapshot that the table was copied in, if it is synced.
+	LSN pglogrepl.LSN
+	// LastError is the error of the last copy, if it has failed.
+	LastError string
+	UpdatedAt time.Time
+}
+
+type tableName struct {
+	schema string
+	name   string
+}
+
+func (t tableName) String() string {
+	return catalog.ConnectIdentifiersANSI(t.schema, t.name)
+}
+
+// SubscriptionTables returns the states of the tables of the subscription, ordered by schema and name.
+func SubscriptionTables(ctx *sql.Context, subscription string) ([]SubscriptionTable, error) {
+	rows, err := adapter.QueryCatalog(ctx,
+		"SELECT schemaname, relname, srsubstate, srsublsn, srlasterror, srupdated FROM "+
+			catalog.InternalTables.PgSubscriptionRel.QualifiedName()+" WHERE subname = ? ORDER BY schemaname, relname",
+		subscription)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []SubscriptionTable
+	for rows.Next() {
+		var t SubscriptionTable
+		var lsn, lastError stdsql.NullString
+		var updatedAt stdsql.NullTime
+		if err := rows.Scan(&t.Schema, &t.Name, &t.State, &lsn, &lastError, &updatedAt); err != nil {
+			return nil, err
+		}
+		if lsn.Valid {
+			if t.LSN, err = pglogrepl.ParseLSN(lsn.String); err != nil {
+				return nil, err
+			}
+		}
+		t.LastError = lastError.String
+		t.UpdatedAt = updatedAt.Time
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// setTableSyncState records the state of a table of the subscription in the ongoing transaction.
+// The LSN is recorded only for a synced table, and the error only for a failed one.
+func setTableSyncState(ctx *sql.Context, subscription string, t tableName, state TableSyncState, lsn pglogrepl.LSN, lastError string) error {
+	var lsnValue, errorValue any
+	if state == TableSyncReady {
+		lsnValue = lsn.String()
+	}
+	if state == TableSyncError {
+		errorValue = lastError
+	}
+	_, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.PgSubscriptionRel.UpsertStmt(),
+		subscription, t.schema, t.name, string(state), lsnValue, errorValue, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record the state of table %s: %w", t, err)
+	}
+	return nil
+}
+
+// deleteSubscriptionTables deletes the states of all tables of the subscription in the ongoing transaction.
+func deleteSubscriptionTables(ctx *sql.Context, subscription string) error {
+	_, err := adapter.ExecCatalogInTxn(ctx,
+		"DELETE FROM "+catalog.InternalTables.PgSubscriptionRel.QualifiedName()+" WHERE subname = ?", subscription)
+	return err
+}
+
+// loadTableStates loads the states of the tables of the subscription into the replication state,
+// which decide the changes to be skipped, see skipRelation.
+func (r *LogicalReplicator) loadTableStates(ctx *sql.Context, state *replicationState) error {
+	tables, err := SubscriptionTables(ctx, r.subscription)
+	if err != nil {
+		return fmt.Errorf("failed to load the table states of subscription %s: %w", r.subscription, err)
+	}
+	state.tables = make(map[tableName]SubscriptionTable, len(tables))
+	for _, t := range tables {
+		state.tables[tableName{schema: t.Schema, name: t.Name}] = t
+	}
+	return nil
+}
+
+// skipRelation returns whether the changes of the relation in the current transaction are to be skipped,
+// because the table is not synced yet, or the changes are in its copy already.
+func (state *replicationState) skipRelation(relationID uint32) bool {
+	rel, ok := state.relations[relationID]
+	if !ok {
+		return false
+	}
+	t, ok := state.tables[tableName{schema: rel.Namespace, name: rel.RelationName}]
+	if !ok {
+		return false
+	}
+	// Same as Postgres, a transaction that ends at or after the consistent point is not in the snapshot.
+	return t.State != TableSyncReady || state.currentTransactionLSN < t.LSN
+}
+
+// RefreshSubscriptionTables copies the tables of the subscription again in a new snapshot of the primary, replacing
+// their copies in the replica. If table is empty, all tables that are not synced are copied, otherwise only the table
+// given is. The replication of the subscription is paused meanwhile, and resumes from where it was, so that the changes
+// of the tables committed after the new snapshot are applied to their new copies.
+func RefreshSubscriptionTables(ctx *sql.Context, subscription string, schema string, table string) error {
+	value, ok := subscriptionMap.Load(subscription)
+	sub, _ := value.(*Subscription)
+	if !ok || sub == nil || sub.Replicator == nil {
+		return fmt.Errorf("subscription %s does not exist", subscription)
+	}
+
+	var targets []tableName
+	if table != "" {
+		targets = append(targets, tableName{schema: schema, name: table})
+	} else {
+		tables, err := SubscriptionTables(ctx, subscription)
+		if err != nil {
+			return err
+		}
+		for _, t := range tables {
+			if t.State != TableSyncReady {
+				targets = append(targets, tableName{schema: t.Schema, name: t.Name})
+			}
+		}
+		if len(targets) == 0 {
+			return nil
+		}
+	}
+
+	r := sub.Replicator
+	r.Stop()
+	defer func() {
+		if sub.Enabled {
+			sub.start(ctx)
+		}
+	}()
+
+	// A temporary slot is enough for the snapshot, since the changes are streamed from the slot of the subscription.
+	snapshot, err := r.CreateReplicationSlotWithSnapshot(sub.slot()+"_sync", true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := snapshot.Close(); err != nil {
+			r.logger.Warnf("failed to release the exported snapshot: %v", err)
+		}
+	}()
+
+	failed, err := r.copySnapshot(ctx, snapshot, sub.Publication, targets, true)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to copy %d of %d tables: %v, see pg_subscription_rel", len(failed), len(targets), failed)
+	}
+	return nil
+}
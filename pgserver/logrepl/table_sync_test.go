@@ -0,0 +1,50 @@
+package logrepl
+
+import (
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/require"
+)
+
+func relation(id uint32, namespace, name string) *pglogrepl.RelationMessageV2 {
+	rel := &pglogrepl.RelationMessageV2{}
+	rel.RelationID, rel.Namespace, rel.RelationName = id, namespace, name
+	return rel
+}
+
+func TestSkipRelation(t *testing.T) {
+	state := &replicationState{
+		relations: map[uint32]*pglogrepl.RelationMessageV2{
+			1: relation(1, "public", "synced"),
+			2: relation(2, "public", "failed"),
+			3: relation(3, "public", "copying"),
+			4: relation(4, "public", "created_later"),
+		},
+		tables: map[tableName]SubscriptionTable{
+			{"public", "synced"}:  {Schema: "public", Name: "synced", State: TableSyncReady, LSN: 1000},
+			{"public", "failed"}:  {Schema: "public", Name: "failed", State: TableSyncError, LastError: "failed"},
+			{"public", "copying"}: {Schema: "public", Name: "copying", State: TableSyncCopying},
+		},
+	}
+
+	// The transactions before the snapshot of a synced table are in its copy.
+	state.currentTransactionLSN = 999
+	require.True(t, state.skipRelation(1))
+	state.currentTransactionLSN = 1000
+	require.False(t, state.skipRelation(1))
+
+	// The tables that are not synced are skipped until they are copied.
+	state.currentTransactionLSN = 2000
+	require.True(t, state.skipRelation(2))
+	require.True(t, state.skipRelation(3))
+
+	// The tables that were not copied initially, or are unknown, are replicated.
+	require.False(t, state.skipRelation(4))
+	require.False(t, state.skipRelation(5))
+
+	// The table states survive the reset on reconnection.
+	state.reset(nil, "slot", 2000)
+	require.Len(t, state.tables, 3)
+	state.deltas.Close()
+}
@@ -0,0 +1,508 @@
+package pgserver
+
+import (
+	"context"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The masking policies, see backend/masking.go, are applied to the results over PostgreSQL through the syntax tree
+// of the query, since the queries run by DuckDB are not planned by the engine:
+//
+//   - The column of a plain `SELECT expr, ...` over tables that references a masked column is masked with
+//     the method of the column, and one computed from a masked column, e.g., `lower(email)`, is NULL.
+//     The columns of `*` are masked by their names, which are the ones of the tables.
+//   - The queries whose columns cannot be traced to the tables, e.g., the ones that select from a subquery,
+//     a common table expression, or a table function, are refused if they read a masked table.
+//   - The views that read a masked table, unless masked themselves, are refused, as they may rename its columns.
+//   - The statements that write the values read from a masked table, e.g., INSERT ... SELECT and
+//     CREATE TABLE ... AS, are refused, as they would copy the values unmasked.
+//
+// COPY TO is refused for the queries that read a masked table, as its rows are not encoded by the handler.
+
+// execMaskingStatement executes a statement that manages the masking policies.
+func (h *ConnectionHandler) execMaskingStatement(query string) (bool, error) {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, query)
+	if err != nil {
+		return false, err
+	}
+	tag, ok, err := backend.ExecMaskingStatement(ctx, h.duckHandler.e.Analyzer.Catalog.MySQLDb, query)
+	if !ok || err != nil {
+		return false, err
+	}
+	return true, h.send(makeCommandComplete(tag, 0))
+}
+
+// maskedRelations are the relations that expose the values of the masked columns, by their lower-cased names.
+type maskedRelations struct {
+	masking *catalog.Masking
+	// tables are the masked tables and views.
+	tables map[string][2]string
+	// views are the views that read a masked table, directly or through the other views, without being masked.
+	views map[string]struct{}
+}
+
+// loadMaskedRelations returns the relations that expose the masked columns to the user of the session,
+// or nil if the user sees the unmasked values.
+func loadMaskedRelations(ctx *sql.Context) (*maskedRelations, error) {
+	masking, err := catalog.SessionMasking(ctx)
+	if err != nil || masking == nil {
+		return nil, err
+	}
+	r := &maskedRelations{masking: masking, tables: make(map[string][2]string), views: make(map[string]struct{})}
+	for _, table := range masking.MaskedTables() {
+		r.tables[table[1]] = table
+	}
+
+	rows, err := adapter.QueryCatalog(ctx, "SELECT view_name, sql FROM duckdb_views() WHERE NOT internal")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	definitions := make(map[string]string)
+	for rows.Next() {
+		var name, definition string
+		if err := rows.Scan(&name, &definition); err != nil {
+			return nil, err
+		}
+		definitions[strings.ToLower(name)] = definition
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// A view reads a masked table if its definition mentions one, or a view that reads one.
+	for changed := true; changed; {
+		changed = false
+		for name, definition := range definitions {
+			if _, ok := r.views[name]; ok {
+				continue
+			}
+			if _, ok := r.tables[name]; ok {
+				continue
+			}
+			if r.mentionedIn(definition) != "" {
+				r.views[name] = struct{}{}
+				changed = true
+			}
+		}
+	}
+	return r, nil
+}
+
+// mentionedIn returns the name of a masked table or a view that reads one, which appears in a query.
+func (r *maskedRelations) mentionedIn(query string) string {
+	for name := range r.tables {
+		if mentionsName(query, name) {
+			return name
+		}
+	}
+	for name := range r.views {
+		if mentionsName(query, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// columnMasks returns the masks of the columns of the masked tables read by a query by the names of the columns.
+// A name masked differently by two tables is NULL.
+func (r *maskedRelations) columnMasks(tables []string) map[string]func(any) any {
+	columns := make(map[string]func(any) any)
+	for _, name := range tables {
+		table, ok := r.tables[name]
+		if !ok {
+			continue
+		}
+		for column, mask := range r.masking.TableMasks(table[0], table[1]) {
+			if _, ok := columns[column]; ok {
+				mask = nullMask
+			}
+			columns[column] = mask
+		}
+	}
+	return columns
+}
+
+// nullMask masks the values derived from a masked column.
+func nullMask(any) any { return nil }
+
+// queryMasking is the masking of the result of a query that reads a masked table.
+type queryMasking struct {
+	relations *maskedRelations
+	parsed    *tree.Select
+	// tables are the lower-cased names of the masked tables that the query reads.
+	tables []string
+}
+
+// checkMasking returns an error if a statement reads a masked table in a way that the masks cannot be applied to,
+// see the comment at the top of this file, and returns the masking of its result if it is a query that reads one.
+func checkMasking(ctx *sql.Context, query string, parsed tree.Statement) (*queryMasking, error) {
+	relations, err := loadMaskedRelations(ctx)
+	if err != nil || relations == nil {
+		return nil, err
+	}
+	if parsed == nil {
+		if name := relations.mentionedIn(query); name != "" {
+			return nil, newPgError("42501", "the masked columns of %s cannot be traced through the statement", name)
+		}
+		return nil, nil
+	}
+
+	var reads tableReads
+	var write bool
+	switch s := parsed.(type) {
+	case *tree.Select:
+		reads.selectStatement(s)
+	case *tree.Insert:
+		write = true
+		reads.with(s.With)
+		reads.selectStatement(s.Rows)
+	case *tree.Update:
+		write = true
+		reads.with(s.With)
+		for _, e := range s.Exprs {
+			reads.expr(e.Expr)
+		}
+		reads.tableExprs(s.From)
+		// The SET expressions may copy the masked columns of the target into the others.
+		if tn, ok := updateTarget(s.Table); ok {
+			for column := range relations.columnMasks([]string{strings.ToLower(tn.Table())}) {
+				for _, e := range s.Exprs {
+					if mentionsName(tree.AsString(e.Expr), column) {
+						return nil, newPgError("42501", "permission denied to copy the masked column %s", column)
+					}
+				}
+			}
+		}
+	case *tree.CreateTable:
+		write = true
+		reads.selectStatement(s.AsSource)
+	default:
+		return nil, nil
+	}
+
+	if reads.source != "" {
+		return nil, newPgError("42501", "the masked columns cannot be traced through the table source %s", reads.source)
+	}
+	var tables []string
+	for _, name := range reads.tables {
+		if _, ok := relations.views[name]; ok {
+			return nil, newPgError("42501", "the masked columns cannot be traced through the view %s", name)
+		}
+		if _, ok := relations.tables[name]; ok {
+			tables = append(tables, name)
+		}
+	}
+	if len(tables) == 0 {
+		return nil, nil
+	}
+	if write {
+		return nil, newPgError("42501", "permission denied to copy the masked table %s", tables[0])
+	}
+	return &queryMasking{relations: relations, parsed: parsed.(*tree.Select), tables: tables}, nil
+}
+
+// updateTarget returns the table updated by an UPDATE.
+func updateTarget(e tree.TableExpr) (*tree.TableName, bool) {
+	if aliased, ok := e.(*tree.AliasedTableExpr); ok {
+		e = aliased.Expr
+	}
+	tn, ok := e.(*tree.TableName)
+	return tn, ok
+}
+
+// maskResults wraps the iterator of the result of a query with the masks of its columns.
+// It returns an error if the columns of the result cannot be traced to the masked columns.
+func (q *queryMasking) maskResults(schema sql.Schema, iter sql.RowIter) (sql.RowIter, error) {
+	if q == nil {
+		return iter, nil
+	}
+	names := make([]string, len(schema))
+	for i, col := range schema {
+		names[i] = strings.ToLower(col.Name)
+	}
+	masks, err := selectMasks(q.parsed, names, q.relations.columnMasks(q.tables), true)
+	if err != nil {
+		return nil, err
+	}
+	return backend.NewMaskingIter(iter, masks), nil
+}
+
+// selectMasks returns the masks of the result columns of a query, whose names are given, by the masks of
+// the masked columns by their names. The columns of `*` are masked by their names only if byName is true.
+func selectMasks(s *tree.Select, names []string, columns map[string]func(any) any, byName bool) ([]func(any) any, error) {
+	if s.With != nil {
+		return nil, errUntraceableMasking("a common table expression")
+	}
+	switch clause := s.Select.(type) {
+	case *tree.ParenSelect:
+		return selectMasks(clause.Select, names, columns, byName)
+	case *tree.UnionClause:
+		// The names of the columns are the ones of the left side.
+		left, err := selectMasks(clause.Left, names, columns, byName)
+		if err != nil {
+			return nil, err
+		}
+		right, err := selectMasks(clause.Right, names, columns, false)
+		if err != nil {
+			return nil, err
+		}
+		for i, mask := range right {
+			if mask != nil || left[i] != nil {
+				left[i] = nullMask
+			}
+		}
+		return left, nil
+	case *tree.ValuesClause:
+		return make([]func(any) any, len(names)), nil
+	case *tree.SelectClause:
+		return selectClauseMasks(clause, names, columns, byName)
+	}
+	return nil, errUntraceableMasking(tree.AsString(s))
+}
+
+func selectClauseMasks(s *tree.SelectClause, names []string, columns map[string]func(any) any, byName bool) ([]func(any) any, error) {
+	// The relations of FROM must be tables, whose columns are the ones of the results.
+	relations := make(map[string]struct{})
+	var from func(e tree.TableExpr) error
+	from = func(e tree.TableExpr) error {
+		switch e := e.(type) {
+		case *tree.TableName:
+			relations[strings.ToLower(e.Table())] = struct{}{}
+			return nil
+		case *tree.AliasedTableExpr:
+			if e.As.Alias != "" {
+				relations[strings.ToLower(string(e.As.Alias))] = struct{}{}
+			}
+			if _, ok := e.Expr.(*tree.TableName); ok {
+				return from(e.Expr)
+			}
+		case *tree.ParenTableExpr:
+			return from(e.Expr)
+		case *tree.JoinTableExpr:
+			if err := from(e.Left); err != nil {
+				return err
+			}
+			return from(e.Right)
+		}
+		return errUntraceableMasking(tree.AsString(e))
+	}
+	for _, t := range s.From.Tables {
+		if err := from(t); err != nil {
+			return nil, err
+		}
+	}
+
+	isStar := func(e tree.SelectExpr) bool {
+		switch e := e.Expr.(type) {
+		case tree.UnqualifiedStar, *tree.AllColumnsSelector:
+			return true
+		case *tree.UnresolvedName:
+			return e.Star
+		}
+		return false
+	}
+	// The expressions before the first `*` and after the last one are mapped to the columns by their positions,
+	// and the columns in between are the ones of `*`.
+	first, last := len(s.Exprs), -1
+	for i, e := range s.Exprs {
+		if isStar(e) {
+			first, last = min(first, i), i
+		}
+	}
+	masks := make([]func(any) any, len(names))
+	if last < 0 {
+		if len(s.Exprs) != len(names) {
+			return nil, errUntraceableMasking(tree.AsString(&s.Exprs))
+		}
+		for i, e := range s.Exprs {
+			masks[i] = exprMask(e.Expr, columns, relations)
+		}
+		return masks, nil
+	}
+	suffix := len(s.Exprs) - last - 1
+	if !byName || first+suffix > len(names) {
+		return nil, errUntraceableMasking(tree.AsString(&s.Exprs))
+	}
+	for _, e := range s.Exprs[first : last+1] {
+		if !isStar(e) {
+			return nil, errUntraceableMasking(tree.AsString(&s.Exprs))
+		}
+	}
+	for i, e := range s.Exprs[:first] {
+		masks[i] = exprMask(e.Expr, columns, relations)
+	}
+	for i := first; i < len(names)-suffix; i++ {
+		masks[i] = columns[names[i]]
+	}
+	for i, e := range s.Exprs[last+1:] {
+		masks[len(names)-suffix+i] = exprMask(e.Expr, columns, relations)
+	}
+	return masks, nil
+}
+
+// exprMask returns the mask of a column computed by an expression: the mask of the masked column that it references,
+// or NULL if it is computed from a masked column, or from a whole row, e.g., `t` or `COLUMNS(*)`.
+func exprMask(e tree.Expr, columns map[string]func(any) any, relations map[string]struct{}) func(any) any {
+	if name, ok := e.(*tree.UnresolvedName); ok && !name.Star {
+		column := strings.ToLower(name.Parts[0])
+		if mask, ok := columns[column]; ok {
+			return mask
+		}
+		if _, ok := relations[column]; ok && name.NumParts == 1 && len(columns) > 0 {
+			return nullMask
+		}
+		return nil
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	text := tree.AsString(e)
+	if mentionsName(text, "columns") {
+		return nullMask
+	}
+	for name := range columns {
+		if mentionsName(text, name) {
+			return nullMask
+		}
+	}
+	for name := range relations {
+		if mentionsName(text, name) {
+			return nullMask
+		}
+	}
+	return nil
+}
+
+func errUntraceableMasking(source string) error {
+	return newPgError("42501", "the masked columns cannot be traced through %s", source)
+}
+
+// tableReads collects the names of the tables and views read by a statement.
+type tableReads struct {
+	// tables are the lower-cased names, including the ones of the common table expressions.
+	tables []string
+	// source is a table source that is not a table, e.g., a table function, which reads the tables unknown.
+	source string
+}
+
+func (r *tableReads) with(with *tree.With) {
+	if with == nil {
+		return
+	}
+	for _, cte := range with.CTEList {
+		if s, ok := cte.Stmt.(*tree.Select); ok {
+			r.selectStatement(s)
+		} else {
+			r.source = tree.AsString(cte.Stmt)
+		}
+	}
+}
+
+func (r *tableReads) selectStatement(s *tree.Select) {
+	if s == nil {
+		return
+	}
+	r.with(s.With)
+	r.selectClause(s.Select)
+}
+
+func (r *tableReads) selectClause(s tree.SelectStatement) {
+	switch s := s.(type) {
+	case *tree.ParenSelect:
+		r.selectStatement(s.Select)
+	case *tree.UnionClause:
+		r.selectStatement(s.Left)
+		r.selectStatement(s.Right)
+	case *tree.ValuesClause:
+		for _, row := range s.Rows {
+			for _, e := range row {
+				r.expr(e)
+			}
+		}
+	case *tree.SelectClause:
+		r.tableExprs(s.From.Tables)
+		for _, e := range s.Exprs {
+			r.expr(e.Expr)
+		}
+		if s.Where != nil {
+			r.expr(s.Where.Expr)
+		}
+		if s.Having != nil {
+			r.expr(s.Having.Expr)
+		}
+	}
+}
+
+func (r *tableReads) tableExprs(tables tree.TableExprs) {
+	for _, t := range tables {
+		r.tableExpr(t)
+	}
+}
+
+func (r *tableReads) tableExpr(e tree.TableExpr) {
+	switch e := e.(type) {
+	case *tree.TableName:
+		r.tables = append(r.tables, strings.ToLower(e.Table()))
+	case *tree.AliasedTableExpr:
+		r.tableExpr(e.Expr)
+	case *tree.ParenTableExpr:
+		r.tableExpr(e.Expr)
+	case *tree.JoinTableExpr:
+		r.tableExpr(e.Left)
+		r.tableExpr(e.Right)
+		if cond, ok := e.Cond.(*tree.OnJoinCond); ok {
+			r.expr(cond.Expr)
+		}
+	case *tree.Subquery:
+		r.selectClause(e.Select)
+	case *tree.RowsFromExpr:
+		// The table functions that generate the rows read no tables.
+		for _, item := range e.Items {
+			if f, ok := item.(*tree.FuncExpr); !ok || !isGeneratorFunction(f) {
+				r.source = tree.AsString(e)
+			}
+		}
+	default:
+		r.source = tree.AsString(e)
+	}
+}
+
+// isGeneratorFunction reports whether a table function generates its rows without reading any table.
+func isGeneratorFunction(f *tree.FuncExpr) bool {
+	switch strings.ToLower(tree.AsString(&f.Func)) {
+	case "generate_series", "range", "unnest", "generate_subscripts":
+		return true
+	}
+	return false
+}
+
+func (r *tableReads) expr(e tree.Expr) {
+	if e == nil {
+		return
+	}
+	tree.SimpleVisit(e, func(e tree.Expr) (bool, tree.Expr, error) {
+		if sq, ok := e.(*tree.Subquery); ok {
+			r.selectClause(sq.Select)
+			return false, e, nil
+		}
+		return true, e, nil
+	})
+}
+
+// checkCopyToMasking returns an error if a COPY TO reads a masked table for a user that is not granted UNMASK.
+func checkCopyToMasking(ctx *sql.Context, query string) error {
+	relations, err := loadMaskedRelations(ctx)
+	if err != nil || relations == nil {
+		return err
+	}
+	if name := relations.mentionedIn(query); name != "" {
+		return newPgError("42501", "permission denied to copy the masked table %s", name)
+	}
+	return nil
+}
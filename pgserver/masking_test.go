@@ -0,0 +1,88 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectMasks(t *testing.T) {
+	redact := func(any) any { return "****" }
+	columns := map[string]func(any) any{"email": redact}
+	masked := func(masks []func(any) any) []string {
+		var kinds []string
+		for _, mask := range masks {
+			switch {
+			case mask == nil:
+				kinds = append(kinds, "")
+			case mask("x@y") == nil:
+				kinds = append(kinds, "null")
+			default:
+				kinds = append(kinds, "redact")
+			}
+		}
+		return kinds
+	}
+
+	for _, c := range []struct {
+		query    string
+		names    []string
+		expected []string
+	}{
+		{"SELECT id, email FROM users", []string{"id", "email"}, []string{"", "redact"}},
+		{"SELECT email AS x FROM users", []string{"x"}, []string{"redact"}},
+		{"SELECT u.email AS id, lower(email) FROM users AS u", []string{"id", "lower"}, []string{"redact", "null"}},
+		{"SELECT * FROM users", []string{"id", "email"}, []string{"", "redact"}},
+		{"SELECT id AS email, * , 1 FROM users", []string{"email", "id", "email", "?column?"}, []string{"", "", "redact", ""}},
+		{"SELECT users FROM users", []string{"users"}, []string{"null"}},
+		{"SELECT COLUMNS('e.*') FROM users", []string{"email"}, []string{"null"}},
+		{"SELECT email FROM users UNION SELECT name FROM t", []string{"email"}, []string{"null"}},
+		{"SELECT u.id FROM users u JOIN t ON u.id = t.id WHERE t.x IN (SELECT 1)", []string{"id"}, []string{""}},
+	} {
+		stmt, err := parser.ParseOne(c.query)
+		require.NoError(t, err)
+		masks, err := selectMasks(stmt.AST.(*tree.Select), c.names, columns, true)
+		require.NoError(t, err, c.query)
+		require.Equal(t, c.expected, masked(masks), c.query)
+	}
+
+	// The columns of the subqueries, the common table expressions, and the table functions cannot be traced.
+	for _, c := range []struct {
+		query string
+		names []string
+	}{
+		{"SELECT x FROM (SELECT email AS x FROM users) s", []string{"x"}},
+		{"WITH t AS (SELECT email AS x FROM users) SELECT * FROM t", []string{"x"}},
+		{"SELECT * FROM query_table('users')", []string{"email"}},
+		{"SELECT 1 UNION SELECT * FROM users", []string{"?column?"}},
+		{"SELECT COLUMNS(*) FROM users", []string{"id", "email"}},
+	} {
+		stmt, err := parser.ParseOne(c.query)
+		require.NoError(t, err)
+		_, err = selectMasks(stmt.AST.(*tree.Select), c.names, columns, true)
+		require.Error(t, err, c.query)
+	}
+}
+
+func TestTableReads(t *testing.T) {
+	for query, expected := range map[string][]string{
+		"SELECT * FROM a JOIN b ON a.id = b.id WHERE x IN (SELECT x FROM c)": {"a", "b", "c"},
+		"WITH t AS (SELECT * FROM Users) SELECT * FROM t":                    {"users", "t"},
+		"SELECT * FROM generate_series(1, 3)":                                nil,
+	} {
+		stmt, err := parser.ParseOne(query)
+		require.NoError(t, err)
+		var reads tableReads
+		reads.selectStatement(stmt.AST.(*tree.Select))
+		require.Empty(t, reads.source, query)
+		require.Equal(t, expected, reads.tables, query)
+	}
+
+	stmt, err := parser.ParseOne("SELECT * FROM t JOIN query_table('users') AS u ON true")
+	require.NoError(t, err)
+	var reads tableReads
+	reads.selectStatement(stmt.AST.(*tree.Select))
+	require.NotEmpty(t, reads.source)
+}
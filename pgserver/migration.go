@@ -0,0 +1,154 @@
+package pgserver
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// `SELECT * FROM myduck.apply_migration(script)` applies a schema migration script atomically:
+// all statements of the script are parsed and converted first, then executed one by one in a single
+// transaction, which is rolled back if any statement fails. The error reports the failing statement.
+// The script is a string literal, e.g., a dollar-quoted one: `myduck.apply_migration($$ ... $$)`.
+// BEGIN and COMMIT in the script are ignored, since the script runs in its own transaction anyway.
+// It returns the executed statements with their tags.
+
+// precompile a regex to match "select [* from] myduck.apply_migration(script);"
+var myduckApplyMigrationRegex = regexp.MustCompile(`(?is)^\s*select\s+(?:\*\s+from\s+)?myduck\.apply_migration\(\s*(.+?)\s*\)\s*;?\s*$`)
+
+// The conversion is registered at the front of selectionConversions, so that the other conversions do not touch
+// the script, and by init, since it executes the statements of the script through selectionConversions again.
+func init() {
+	selectionConversions = append([]SelectionConversion{{
+		needConvert: func(query *ConvertedStatement) bool {
+			sql := RemoveComments(query.String)
+			return myduckApplyMigrationRegex.MatchString(sql)
+		},
+		doConvert: func(h *ConnectionHandler, query *ConvertedStatement) error {
+			sqlStr, err := h.applyMigration(query.String)
+			if err != nil {
+				return err
+			}
+			query.String = sqlStr
+			return nil
+		},
+		// The migration must be applied when the query is executed, not when it is parsed.
+		isConstQuery: true,
+	}}, selectionConversions...)
+}
+
+var migrationColumns = []diagColumn{
+	{"statement", "INTEGER"},
+	{"tag", "VARCHAR"},
+}
+
+// migrationScript returns the script of myduck.apply_migration(script), which must be a string literal.
+func migrationScript(query string) (string, error) {
+	matches := myduckApplyMigrationRegex.FindStringSubmatch(query)
+	if matches == nil {
+		// The call may follow comments.
+		matches = myduckApplyMigrationRegex.FindStringSubmatch(RemoveComments(query))
+	}
+	if matches == nil {
+		return "", newPgError("42601", "invalid call of myduck.apply_migration()")
+	}
+	stmt, err := parser.ParseOne("SELECT " + matches[1])
+	if err == nil {
+		if clause, ok := stmt.AST.(*tree.Select).Select.(*tree.SelectClause); ok && len(clause.Exprs) == 1 {
+			if s, ok := clause.Exprs[0].Expr.(*tree.StrVal); ok {
+				return s.RawString(), nil
+			}
+		}
+	}
+	return "", newPgError("22023", "the migration script must be a string literal")
+}
+
+// migrationStatement is a statement of a migration script with its 1-based position in the script.
+type migrationStatement struct {
+	ConvertedStatement
+	ordinal int
+}
+
+// parseMigration parses and converts all statements of the migration script before any of them is executed.
+func (h *ConnectionHandler) parseMigration(script string) ([]migrationStatement, error) {
+	statements, err := h.convertQuery(script)
+	if err != nil {
+		return nil, err
+	}
+	// convertQuery falls back to a single unparsable statement if the script does not parse.
+	if len(statements) == 1 && !statements[0].PgParsable {
+		_, err := parser.Parse(script)
+		if err == nil {
+			return nil, newPgError("42601", "the migration script is invalid")
+		}
+		return nil, newPgError("42601", "the migration script is invalid: %s", err.Error())
+	}
+	migration := make([]migrationStatement, 0, len(statements))
+	for i, statement := range statements {
+		if statement.SubscriptionConfig != nil || statement.BackupConfig != nil || statement.RestoreConfig != nil ||
+			myduckApplyMigrationRegex.MatchString(RemoveComments(statement.String)) {
+			return nil, unsupportedMigrationStatement(i, statement)
+		}
+		switch stmt := statement.AST.(type) {
+		case nil, *tree.BeginTransaction, *tree.CommitTransaction:
+			continue
+		case *tree.RollbackTransaction, *tree.Savepoint, *tree.ReleaseSavepoint, *tree.RollbackToSavepoint, *tree.CopyTo:
+			return nil, unsupportedMigrationStatement(i, statement)
+		case *tree.CopyFrom:
+			if stmt.Stdin {
+				return nil, unsupportedMigrationStatement(i, statement)
+			}
+		}
+		migration = append(migration, migrationStatement{ConvertedStatement: statement, ordinal: i + 1})
+	}
+	return migration, nil
+}
+
+func unsupportedMigrationStatement(i int, statement ConvertedStatement) error {
+	return newPgError("0A000", "statement %d of the migration script is not supported in a migration: %s", i+1, statement.String)
+}
+
+// applyMigration runs myduck.apply_migration() and returns the query of its result.
+func (h *ConnectionHandler) applyMigration(query string) (string, error) {
+	script, err := migrationScript(query)
+	if err != nil {
+		return "", err
+	}
+	if h.duckHandler.inTxnBlock {
+		return "", newPgError("25001", "myduck.apply_migration() cannot run inside a transaction block")
+	}
+	statements, err := h.parseMigration(script)
+	if err != nil {
+		return "", err
+	}
+
+	// The results of the statements are not sent to the client, only the result of the migration is.
+	backend := h.backend
+	h.backend = pgproto3.NewBackend(strings.NewReader(""), io.Discard)
+	defer func() { h.backend = backend }()
+
+	if _, err := h.execStatement(ConvertedStatement{String: "BEGIN", AST: &tree.BeginTransaction{}, Tag: "BEGIN", PgParsable: true}); err != nil {
+		return "", err
+	}
+	rows := make([][]string, 0, len(statements))
+	for _, statement := range statements {
+		if _, err := h.execStatement(statement.ConvertedStatement); err != nil {
+			if _, rollbackErr := h.execStatement(ConvertedStatement{String: "ROLLBACK", AST: &tree.RollbackTransaction{}, Tag: "ROLLBACK", PgParsable: true}); rollbackErr != nil {
+				h.logger.WithError(rollbackErr).Warn("Failed to roll back the migration")
+			}
+			code, message := errorCodeAndMessage(err)
+			return "", newPgError(code, "the migration is rolled back since statement %d failed: %s\nSTATEMENT: %s", statement.ordinal, message, statement.String)
+		}
+		rows = append(rows, []string{strconv.Itoa(statement.ordinal), diagString(statement.Tag)})
+	}
+	if _, err := h.execStatement(ConvertedStatement{String: "COMMIT", AST: &tree.CommitTransaction{}, Tag: "COMMIT", PgParsable: true}); err != nil {
+		return "", err
+	}
+	h.logger.Infof("Applied a migration of %d statements", len(statements))
+	return "SELECT * FROM " + diagRelation(migrationColumns, rows) + ";", nil
+}
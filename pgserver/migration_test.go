@@ -0,0 +1,53 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationScript(t *testing.T) {
+	script, err := migrationScript("SELECT * FROM myduck.apply_migration($$CREATE TABLE t (s TEXT DEFAULT 'x');$$);")
+	require.NoError(t, err)
+	require.Equal(t, "CREATE TABLE t (s TEXT DEFAULT 'x');", script)
+
+	script, err = migrationScript("select myduck.apply_migration($m$ALTER TABLE t ADD c INT$m$)")
+	require.NoError(t, err)
+	require.Equal(t, "ALTER TABLE t ADD c INT", script)
+
+	script, err = migrationScript("-- v2\nSELECT myduck.apply_migration('DROP TABLE ''t''')")
+	require.NoError(t, err)
+	require.Equal(t, "DROP TABLE 't'", script)
+
+	_, err = migrationScript("SELECT myduck.apply_migration(current_setting('x'))")
+	require.ErrorContains(t, err, "must be a string literal")
+	_, err = migrationScript("SELECT myduck.apply_migration('a', 'b')")
+	require.ErrorContains(t, err, "must be a string literal")
+}
+
+func TestParseMigration(t *testing.T) {
+	h := &ConnectionHandler{}
+	statements, err := h.parseMigration(`
+		BEGIN;
+		CREATE TABLE t (id INT PRIMARY KEY, s TEXT);
+		CREATE INDEX t_s ON t (s);
+		INSERT INTO t VALUES (1, 'a;b');
+		COMMIT;
+	`)
+	require.NoError(t, err)
+	require.Len(t, statements, 3)
+	var tags []string
+	for _, s := range statements {
+		tags = append(tags, s.Tag)
+	}
+	require.Equal(t, []string{"CREATE TABLE", "CREATE INDEX", "INSERT"}, tags)
+	require.Equal(t, []int{2, 3, 4}, []int{statements[0].ordinal, statements[1].ordinal, statements[2].ordinal})
+
+	_, err = h.parseMigration("CREATE TABLE t (id INT); CREATE TABLE u (id INT,);")
+	require.ErrorContains(t, err, "the migration script is invalid")
+
+	_, err = h.parseMigration("CREATE TABLE t (id INT); ROLLBACK;")
+	require.ErrorContains(t, err, "statement 2 of the migration script is not supported")
+	_, err = h.parseMigration("COPY t FROM STDIN;")
+	require.ErrorContains(t, err, "statement 1 of the migration script is not supported")
+}
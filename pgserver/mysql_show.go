@@ -0,0 +1,172 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/catalog"
+)
+
+// The SHOW statements of MySQL are accepted on the Postgres port for the users who are used to them.
+// They are rewritten into the queries of information_schema before being parsed, with the same columns as MySQL:
+//
+//   - SHOW [FULL] TABLES [{FROM | IN} db] [LIKE 'pattern' | WHERE expr]
+//   - SHOW {DATABASES | SCHEMAS} [LIKE 'pattern' | WHERE expr]
+//   - SHOW [FULL] {COLUMNS | FIELDS} {FROM | IN} [db.]table [{FROM | IN} db] [LIKE 'pattern' | WHERE expr]
+//
+// A database is a schema in the current catalog, the same as for the MySQL protocol. The names are matched
+// case-insensitively, and may be quoted with double quotes or backticks. The LIKE pattern is matched
+// against the first column case-insensitively, and the WHERE condition may refer to any column.
+
+// mysqlIdentifierPattern matches an identifier, which may be quoted with backticks as well.
+const mysqlIdentifierPattern = `(?:"(?:[^"]|"")+"|` + "`(?:[^`]|``)+`" + `|[A-Za-z_][\w$]*)`
+
+// mysqlShowFilterPattern matches the optional LIKE or WHERE clause of a SHOW statement, and the end of the statement.
+const mysqlShowFilterPattern = `(?:\s+LIKE\s+('(?:[^']|'')*')|\s+WHERE\s+(.+?))?\s*;?\s*$`
+
+var (
+	mysqlShowTablesRegex = regexp.MustCompile(`(?is)^\s*SHOW\s+(FULL\s+)?TABLES(?:\s+(?:FROM|IN)\s+(` +
+		mysqlIdentifierPattern + `))?` + mysqlShowFilterPattern)
+	mysqlShowDatabasesRegex = regexp.MustCompile(`(?is)^\s*SHOW\s+(?:DATABASES|SCHEMAS)` + mysqlShowFilterPattern)
+	mysqlShowColumnsRegex   = regexp.MustCompile(`(?is)^\s*SHOW\s+(FULL\s+)?(?:COLUMNS|FIELDS)\s+(?:FROM|IN)\s+(?:(` +
+		mysqlIdentifierPattern + `)\s*\.\s*)?(` + mysqlIdentifierPattern + `)(?:\s+(?:FROM|IN)\s+(` +
+		mysqlIdentifierPattern + `))?` + mysqlShowFilterPattern)
+)
+
+// unquoteMySQLIdentifier is unquoteIdentifier that accepts the identifiers quoted with backticks as well.
+func unquoteMySQLIdentifier(ident string) string {
+	if len(ident) >= 2 && strings.HasPrefix(ident, "`") && strings.HasSuffix(ident, "`") {
+		return strings.ReplaceAll(ident[1:len(ident)-1], "``", "`")
+	}
+	return unquoteIdentifier(ident)
+}
+
+// convertMySQLShow rewrites a SHOW statement of MySQL into the equivalent query, or returns the query as it is.
+func (h *ConnectionHandler) convertMySQLShow(query string) (string, error) {
+	if !hasSubstringFold(query, "show") {
+		return query, nil
+	}
+	return rewriteMySQLShow(query, func() (string, error) {
+		ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+		if err != nil {
+			return "", err
+		}
+		return ctx.GetCurrentDatabase(), nil
+	})
+}
+
+// rewriteMySQLShow rewrites a SHOW statement of MySQL into the equivalent query, or returns the query as it is.
+// The current database is used if the statement does not name the database.
+func rewriteMySQLShow(query string, currentDatabase func() (string, error)) (string, error) {
+	database := func(ident string) (string, error) {
+		if ident != "" {
+			return unquoteMySQLIdentifier(ident), nil
+		}
+		return currentDatabase()
+	}
+	if m := mysqlShowTablesRegex.FindStringSubmatch(query); m != nil {
+		db, err := database(m[2])
+		if err != nil {
+			return "", err
+		}
+		return mysqlShowTablesQuery(db, m[1] != "", m[3], m[4]), nil
+	}
+	if m := mysqlShowDatabasesRegex.FindStringSubmatch(query); m != nil {
+		return mysqlShowDatabasesQuery(m[1], m[2]), nil
+	}
+	if m := mysqlShowColumnsRegex.FindStringSubmatch(query); m != nil {
+		// `FROM db` after the table takes precedence over `db.table`, the same as MySQL.
+		ident := m[2]
+		if m[4] != "" {
+			ident = m[4]
+		}
+		db, err := database(ident)
+		if err != nil {
+			return "", err
+		}
+		return mysqlShowColumnsQuery(db, unquoteMySQLIdentifier(m[3]), m[1] != "", m[5], m[6]), nil
+	}
+	return query, nil
+}
+
+// mysqlShowQuery selects the columns of the rows of a SHOW statement from the given query, and applies its LIKE pattern
+// to the first column, or its WHERE condition. The rows are ordered by the given expression of the columns of the query.
+func mysqlShowQuery(query string, columns []string, like string, where string, orderBy string) string {
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	for i, column := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(catalog.QuoteIdentifierANSI(column))
+	}
+	b.WriteString(" FROM (")
+	b.WriteString(query)
+	b.WriteString(") AS t")
+	if like != "" {
+		fmt.Fprintf(&b, " WHERE %s ILIKE %s", catalog.QuoteIdentifierANSI(columns[0]), like)
+	} else if where != "" {
+		fmt.Fprintf(&b, " WHERE %s", where)
+	}
+	b.WriteString(" ORDER BY ")
+	b.WriteString(orderBy)
+	return b.String()
+}
+
+func mysqlShowTablesQuery(db string, full bool, like string, where string) string {
+	columns := []string{"Tables_in_" + db}
+	query := fmt.Sprintf("SELECT table_name AS %s", catalog.QuoteIdentifierANSI(columns[0]))
+	if full {
+		columns = append(columns, "Table_type")
+		query += `, table_type AS "Table_type"`
+	}
+	query += fmt.Sprintf(" FROM information_schema.tables WHERE table_catalog = current_database() AND lower(table_schema) = lower(%s)",
+		quoteSettingLiteral(db))
+	return mysqlShowQuery(query, columns, like, where, "1")
+}
+
+func mysqlShowDatabasesQuery(like string, where string) string {
+	// The reserved schemas are hidden except information_schema, the same as the MySQL protocol.
+	var hidden []string
+	for _, name := range catalog.ReservedSchemaNames() {
+		if name != "information_schema" {
+			hidden = append(hidden, quoteSettingLiteral(name))
+		}
+	}
+	query := `SELECT DISTINCT schema_name AS "Database" FROM information_schema.schemata WHERE catalog_name = current_database()`
+	if len(hidden) > 0 {
+		query += " AND lower(schema_name) NOT IN (" + strings.Join(hidden, ", ") + ")"
+	}
+	return mysqlShowQuery(query, []string{"Database"}, like, where, "1")
+}
+
+func mysqlShowColumnsQuery(db string, table string, full bool, like string, where string) string {
+	columns := []string{"Field", "Type", "Null", "Key", "Default", "Extra"}
+	if full {
+		columns = []string{"Field", "Type", "Collation", "Null", "Key", "Default", "Extra", "Privileges", "Comment"}
+	}
+	var b strings.Builder
+	b.WriteString(`SELECT c.column_name AS "Field", lower(c.data_type) AS "Type", `)
+	if full {
+		b.WriteString(`NULL::VARCHAR AS "Collation", `)
+	}
+	b.WriteString(`c.is_nullable AS "Null", `)
+	b.WriteString(`coalesce((SELECT CASE WHEN bool_or(k.constraint_type = 'PRIMARY KEY') THEN 'PRI' ` +
+		`WHEN bool_or(k.constraint_type = 'UNIQUE') THEN 'UNI' END FROM duckdb_constraints() k ` +
+		`WHERE k.database_name = c.table_catalog AND k.schema_name = c.table_schema AND k.table_name = c.table_name ` +
+		`AND list_contains(k.constraint_column_names, c.column_name)), '') AS "Key", `)
+	b.WriteString(`c.column_default AS "Default", `)
+	b.WriteString(`CASE WHEN c.column_default LIKE 'nextval(%' THEN 'auto_increment' ELSE '' END AS "Extra"`)
+	if full {
+		b.WriteString(`, 'select,insert,update,references' AS "Privileges", `)
+		b.WriteString(`coalesce((SELECT d.comment FROM duckdb_columns() d WHERE d.database_name = c.table_catalog ` +
+			`AND d.schema_name = c.table_schema AND d.table_name = c.table_name AND d.column_name = c.column_name), '') AS "Comment"`)
+	}
+	b.WriteString(`, c.ordinal_position`)
+	fmt.Fprintf(&b, " FROM information_schema.columns c WHERE c.table_catalog = current_database() "+
+		"AND lower(c.table_schema) = lower(%s) AND lower(c.table_name) = lower(%s)",
+		quoteSettingLiteral(db), quoteSettingLiteral(table))
+	return mysqlShowQuery(b.String(), columns, like, where, "ordinal_position")
+}
@@ -0,0 +1,116 @@
+package pgserver
+
+import (
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteMySQLShow(t *testing.T) {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	defer connector.Close()
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+
+	for _, stmt := range []string{
+		`CREATE SCHEMA "MyDB"`,
+		`CREATE SEQUENCE "MyDB".seq`,
+		`CREATE TABLE "MyDB".users (id INT PRIMARY KEY DEFAULT nextval('"MyDB".seq'), name VARCHAR UNIQUE, note TEXT)`,
+		`CREATE TABLE "MyDB".orders (id INT, user_id INT)`,
+		`CREATE VIEW "MyDB".user_names AS SELECT name FROM "MyDB".users`,
+		`COMMENT ON COLUMN "MyDB".users.note IS 'free text'`,
+		`CREATE SCHEMA other`,
+	} {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	current := func() (string, error) { return "mydb", nil }
+	query := func(t *testing.T, show string) ([]string, [][]string) {
+		q, err := rewriteMySQLShow(show, current)
+		require.NoError(t, err)
+		require.NotEqual(t, show, q)
+		// The rewritten query goes through the Postgres parser as well.
+		_, err = parser.ParseOne(q)
+		require.NoError(t, err, q)
+		rows, err := db.Query(q)
+		require.NoError(t, err, q)
+		defer rows.Close()
+		columns, err := rows.Columns()
+		require.NoError(t, err)
+		var result [][]string
+		for rows.Next() {
+			values := make([]stdsql.NullString, len(columns))
+			dest := make([]any, len(columns))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			require.NoError(t, rows.Scan(dest...))
+			row := make([]string, len(columns))
+			for i, v := range values {
+				row[i] = v.String
+				if !v.Valid {
+					row[i] = "NULL"
+				}
+			}
+			result = append(result, row)
+		}
+		require.NoError(t, rows.Err())
+		return columns, result
+	}
+
+	t.Run("tables", func(t *testing.T) {
+		columns, rows := query(t, "show tables")
+		require.Equal(t, []string{"Tables_in_mydb"}, columns)
+		require.Equal(t, [][]string{{"orders"}, {"user_names"}, {"users"}}, rows)
+
+		columns, rows = query(t, "SHOW FULL TABLES FROM `MyDB` LIKE 'USER%';")
+		require.Equal(t, []string{"Tables_in_MyDB", "Table_type"}, columns)
+		require.Equal(t, [][]string{{"user_names", "VIEW"}, {"users", "BASE TABLE"}}, rows)
+
+		_, rows = query(t, `SHOW TABLES IN other`)
+		require.Empty(t, rows)
+	})
+
+	t.Run("databases", func(t *testing.T) {
+		columns, rows := query(t, "SHOW DATABASES")
+		require.Equal(t, []string{"Database"}, columns)
+		require.Contains(t, rows, []string{"MyDB"})
+		require.Contains(t, rows, []string{"other"})
+		require.NotContains(t, rows, []string{"pg_catalog"})
+
+		_, rows = query(t, `SHOW SCHEMAS WHERE "Database" = 'other'`)
+		require.Equal(t, [][]string{{"other"}}, rows)
+	})
+
+	t.Run("columns", func(t *testing.T) {
+		columns, rows := query(t, "SHOW COLUMNS FROM users")
+		require.Equal(t, []string{"Field", "Type", "Null", "Key", "Default", "Extra"}, columns)
+		require.Len(t, rows, 3)
+		require.Equal(t, []string{"id", "integer", "NO", "PRI"}, rows[0][:4])
+		require.Equal(t, "auto_increment", rows[0][5])
+		require.Equal(t, []string{"name", "varchar", "YES", "UNI", "NULL", ""}, rows[1])
+		require.Equal(t, []string{"note", "varchar", "YES", "", "NULL", ""}, rows[2])
+
+		columns, rows = query(t, "show full fields in other.users from `MyDB` like 'n%'")
+		require.Equal(t, []string{"Field", "Type", "Collation", "Null", "Key", "Default", "Extra", "Privileges", "Comment"}, columns)
+		require.Len(t, rows, 2)
+		require.Equal(t, "free text", rows[1][8])
+
+		_, rows = query(t, `SHOW COLUMNS FROM "MyDB".orders WHERE "Field" = 'user_id'`)
+		require.Len(t, rows, 1)
+		require.Equal(t, "user_id", rows[0][0])
+	})
+
+	t.Run("others", func(t *testing.T) {
+		for _, q := range []string{"SHOW search_path", "SHOW TABLES FROM", "SELECT 'show tables'"} {
+			rewritten, err := rewriteMySQLShow(q, current)
+			require.NoError(t, err)
+			require.Equal(t, q, rewritten)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package pgserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+)
+
+const (
+	// alpnProtocol is the ALPN protocol name of PostgreSQL, which is required for direct SSL connections.
+	alpnProtocol = "postgresql"
+	// tlsHandshakeRecord is the first byte of a TLS ClientHello message.
+	tlsHandshakeRecord = 0x16
+	// negotiationRequestSize is the size of an SSLRequest or a GSSENCRequest message.
+	negotiationRequestSize = 8
+)
+
+var errUnencryptedDataAfterSSLRequest = errors.New("terminating connection: received unencrypted data after SSL request")
+
+// countingReader counts the bytes read from the connection, so that the unencrypted data
+// pipelined after an SSLRequest can be detected before switching to TLS.
+type countingReader struct {
+	io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+// prefixedConn is a connection whose first bytes have been consumed to detect the kind of the startup.
+type prefixedConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixedConn) Read(p []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(p, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+func hasCertificate() bool {
+	return len(certificate.Certificate) > 0
+}
+
+func newTLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		// Clients that send ALPN must ask for the PostgreSQL protocol.
+		NextProtos: []string{alpnProtocol},
+	}
+}
+
+// negotiateDirectSSL detects the direct SSL negotiation of PostgreSQL 17 and later,
+// in which the client starts the TLS handshake right away instead of sending an SSLRequest.
+// It returns true if the connection has been switched to TLS.
+func (h *ConnectionHandler) negotiateDirectSSL() (bool, error) {
+	var first [1]byte
+	if _, err := io.ReadFull(h.Conn(), first[:]); err != nil {
+		return false, err
+	}
+	conn := &prefixedConn{Conn: h.Conn(), prefix: first[:]}
+	if first[0] != tlsHandshakeRecord {
+		h.setConn(conn)
+		return false, nil
+	}
+
+	if !hasCertificate() {
+		return false, errors.New("terminating connection: direct SSL connection is not supported without a server certificate")
+	}
+	tlsConn := tls.Server(conn, newTLSConfig())
+	if err := tlsConn.Handshake(); err != nil {
+		return false, err
+	}
+	if tlsConn.ConnectionState().NegotiatedProtocol != alpnProtocol {
+		return false, errors.New("terminating connection: received direct SSL connection request without ALPN protocol negotiation extension")
+	}
+	h.setConn(tlsConn)
+	return true, nil
+}
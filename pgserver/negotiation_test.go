@@ -0,0 +1,155 @@
+package pgserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dolthub/vitess/go/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func negotiationRequest(code uint32) []byte {
+	buf := make([]byte, negotiationRequestSize)
+	binary.BigEndian.PutUint32(buf, negotiationRequestSize)
+	binary.BigEndian.PutUint32(buf[4:], code)
+	return buf
+}
+
+var (
+	sslRequest    = negotiationRequest(80877103)
+	gssEncRequest = negotiationRequest(80877104)
+)
+
+func TestHandleStartupNegotiation(t *testing.T) {
+	saved := certificate
+	certificate = newTestCertificate(t)
+	defer func() { certificate = saved }()
+
+	clientTLS := func(conn net.Conn, protos ...string) *tls.Conn {
+		return tls.Client(conn, &tls.Config{InsecureSkipVerify: true, NextProtos: protos})
+	}
+
+	tests := []struct {
+		name    string
+		client  func(conn net.Conn) error
+		wantErr bool
+	}{
+		{
+			name: "GSSENCRequest followed by SSLRequest",
+			client: func(conn net.Conn) error {
+				reply := make([]byte, 1)
+				if _, err := conn.Write(gssEncRequest); err != nil {
+					return err
+				}
+				if _, err := io.ReadFull(conn, reply); err != nil || reply[0] != 'N' {
+					return io.ErrUnexpectedEOF
+				}
+				if _, err := conn.Write(sslRequest); err != nil {
+					return err
+				}
+				if _, err := io.ReadFull(conn, reply); err != nil || reply[0] != 'S' {
+					return io.ErrUnexpectedEOF
+				}
+				return clientTLS(conn, alpnProtocol).Handshake()
+			},
+		},
+		{
+			name: "SSLRequest over TLS",
+			client: func(conn net.Conn) error {
+				reply := make([]byte, 1)
+				if _, err := conn.Write(sslRequest); err != nil {
+					return err
+				}
+				if _, err := io.ReadFull(conn, reply); err != nil {
+					return err
+				}
+				tlsConn := clientTLS(conn)
+				if err := tlsConn.Handshake(); err != nil {
+					return err
+				}
+				_, err := tlsConn.Write(sslRequest)
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unencrypted data after SSLRequest",
+			client: func(conn net.Conn) error {
+				_, err := conn.Write(append(sslRequest, gssEncRequest...))
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "Direct SSL",
+			client: func(conn net.Conn) error {
+				return clientTLS(conn, alpnProtocol).Handshake()
+			},
+		},
+		{
+			name: "Direct SSL without ALPN",
+			client: func(conn net.Conn) error {
+				return clientTLS(conn).Handshake()
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer listener.Close()
+
+			clientConn, err := net.Dial("tcp", listener.Addr().String())
+			require.NoError(t, err)
+			serverConn, err := listener.Accept()
+			require.NoError(t, err)
+			defer serverConn.Close()
+
+			h := &ConnectionHandler{mysqlConn: &mysql.Conn{Conn: serverConn}}
+			h.setConn(serverConn)
+			done := make(chan error, 1)
+			go func() {
+				_, err := h.handleStartup()
+				done <- err
+			}()
+
+			clientErr := tt.client(clientConn)
+			if !tt.wantErr {
+				require.NoError(t, clientErr)
+			}
+			// Hang up; a successful negotiation ends with EOF while waiting for the StartupMessage.
+			clientConn.Close()
+			if err := <-done; tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
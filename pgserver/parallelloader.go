@@ -0,0 +1,467 @@
+package pgserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// copyBatchSize is the minimum size of the data that is parsed into an Arrow record at a time.
+	copyBatchSize = 1 << 20
+	// copyQueueSize is the number of incoming chunks that can be queued before the network reads are blocked.
+	copyQueueSize = 64
+)
+
+// ParallelCsvDataLoader loads COPY FROM STDIN data in TEXT or CSV format through a pipeline:
+// the network reads feed a bounded queue of chunks, a splitter cuts the chunks into batches of complete records,
+// multiple parser workers convert the batches into Arrow records, and a single writer
+// inserts the Arrow records into the DuckDB table in their original order.
+type ParallelCsvDataLoader struct {
+	ctx       *sql.Context
+	cancel    context.CancelCauseFunc
+	schema    string
+	table     sql.InsertableTable
+	columns   tree.NameList
+	names     []string          // the names of the loaded columns
+	types     map[string]string // the DuckDB types of the loaded columns, keyed by lower-cased name
+	arrowName string
+	pipeline  *copyPipeline
+	done      chan struct{} // closed when the writer exits
+	rows      int64
+	logger    *logrus.Entry
+}
+
+var _ DataLoader = (*ParallelCsvDataLoader)(nil)
+
+func NewParallelCsvDataLoader(
+	ctx *sql.Context, handler *DuckHandler,
+	schema string, table sql.InsertableTable, columns tree.NameList,
+	options *tree.CopyOptions, textOptions *CopyTextOptions,
+) (DataLoader, error) {
+	names := copyColumnNames(table, columns)
+	format, err := newCopyTextFormat(options, textOptions, names)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := copyColumnTypes(ctx, schema, table.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	// Create cancelable context
+	childCtx, cancel := context.WithCancelCause(ctx)
+	ctx.Context = childCtx
+
+	loader := &ParallelCsvDataLoader{
+		ctx:       ctx,
+		cancel:    cancel,
+		schema:    schema,
+		table:     table,
+		columns:   columns,
+		names:     names,
+		types:     types,
+		arrowName: "__sys_copy_from_csv_" + strconv.Itoa(int(ctx.ID())) + "__",
+		pipeline:  newCopyPipeline(childCtx, cancel, format, names, runtime.GOMAXPROCS(0), copyBatchSize),
+		done:      make(chan struct{}),
+		logger:    ctx.GetLogger(),
+	}
+	return loader, nil
+}
+
+func (loader *ParallelCsvDataLoader) Start() <-chan error {
+	ready := make(chan error, 1)
+	loader.pipeline.Start()
+	go loader.write(ready)
+	return ready
+}
+
+func (loader *ParallelCsvDataLoader) LoadChunk(ctx *sql.Context, data []byte) error {
+	// The message buffer is reused for the next message, so the data must be copied.
+	if err := loader.pipeline.Send(bytes.Clone(data)); err != nil {
+		return fmt.Errorf("COPY operation has been aborted: %w", err)
+	}
+	return nil
+}
+
+func (loader *ParallelCsvDataLoader) Abort(ctx *sql.Context) error {
+	loader.cancel(ErrCopyAborted)
+	<-loader.done // Ensure the writer has exited
+	return nil
+}
+
+func (loader *ParallelCsvDataLoader) Finish(ctx *sql.Context) (*LoadDataResults, error) {
+	// Close the queue to signal the pipeline that there is no more data.
+	loader.pipeline.CloseSend()
+	<-loader.done
+
+	if err := context.Cause(loader.ctx); err != nil {
+		loader.logger.Errorln("COPY operation failed:", err)
+		return nil, err
+	}
+	loader.cancel(nil)
+
+	return &LoadDataResults{
+		RowsLoaded: int32(loader.rows),
+	}, nil
+}
+
+// buildSQL builds the DuckDB INSERT statement.
+func (loader *ParallelCsvDataLoader) buildSQL() string {
+	var b strings.Builder
+	b.Grow(256)
+
+	b.WriteString("INSERT INTO ")
+	if loader.schema != "" {
+		b.WriteString(loader.schema)
+		b.WriteString(".")
+	}
+	b.WriteString(loader.table.Name())
+
+	if len(loader.columns) > 0 {
+		b.WriteString(" (")
+		b.WriteString(loader.columns.String())
+		b.WriteString(")")
+	}
+
+	// The values are parsed as strings. Cast them explicitly so that
+	// a malformed value is reported along with the column it belongs to.
+	b.WriteString(" SELECT ")
+	for i, name := range loader.names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(copyCastExpr(loader.table.Name(), name, loader.types[strings.ToLower(name)]))
+	}
+
+	b.WriteString(" FROM ")
+	b.WriteString(loader.arrowName)
+
+	return b.String()
+}
+
+// copyCastExpr returns the expression that casts the string value of a column to the column type.
+// Unlike an implicit cast, it fails with an error message that references the column.
+func copyCastExpr(table, column, typ string) string {
+	col := catalog.QuoteIdentifierANSI(column)
+	if typ == "" || typ == "VARCHAR" {
+		return col
+	}
+	msg := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	return fmt.Sprintf(
+		"COALESCE(TRY_CAST(%s AS %s), CASE WHEN %s IS NULL THEN NULL ELSE error(%s || %s || %s) END)",
+		col, typ, col,
+		msg(fmt.Sprintf(`invalid input syntax for type %s: "`, strings.ToLower(typ))),
+		col,
+		msg(fmt.Sprintf(`" (COPY %s, column %s)`, table, column)),
+	)
+}
+
+// copyColumnTypes returns the DuckDB types of the columns of the table, keyed by lower-cased name.
+func copyColumnTypes(ctx *sql.Context, schema, table string) (map[string]string, error) {
+	columns, err := copyTableColumns(ctx, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(columns))
+	for _, col := range columns {
+		types[strings.ToLower(col.name)] = col.typ
+	}
+	return types, nil
+}
+
+// copyTableColumn is a column of the target table of COPY FROM.
+type copyTableColumn struct {
+	name string
+	typ  string // the DuckDB type
+}
+
+// copyTableColumns returns the columns of the table in their order of definition.
+func copyTableColumns(ctx *sql.Context, schema, table string) ([]copyTableColumn, error) {
+	if schema == "" {
+		schema = adapter.GetCurrentSchema(ctx)
+	}
+	rows, err := adapter.QueryCatalog(ctx,
+		"SELECT column_name, data_type FROM duckdb_columns() WHERE database_name = ? AND schema_name = ? AND table_name = ? ORDER BY column_index",
+		adapter.GetCurrentCatalog(ctx), schema, table,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []copyTableColumn
+	for rows.Next() {
+		var col copyTableColumn
+		if err := rows.Scan(&col.name, &col.typ); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// write is the single writer of the pipeline. It inserts the parsed Arrow records into DuckDB.
+func (loader *ParallelCsvDataLoader) write(ready chan<- error) {
+	defer close(loader.done)
+
+	conn, err := adapter.GetConn(loader.ctx)
+	if err != nil {
+		loader.cancel(err)
+		ready <- err
+		return
+	}
+
+	// Register the pipeline as an Arrow stream in DuckDB.
+	loader.logger.Debugf("Registering Arrow record reader into DuckDB: %s", loader.arrowName)
+	var release func()
+	if err := conn.Raw(func(driverConn any) error {
+		conn := driverConn.(*duckdb.Conn)
+		arrow, err := duckdb.NewArrowFromConn(conn)
+		if err != nil {
+			return err
+		}
+
+		release, err = arrow.RegisterView(loader.pipeline, loader.arrowName)
+		return err
+	}); err != nil {
+		loader.cancel(err)
+		ready <- err
+		return
+	}
+	defer release()
+	close(ready)
+
+	// Execute the INSERT statement.
+	// This will block until the pipeline has been drained.
+	sql := loader.buildSQL()
+	loader.logger.Debugln("Executing SQL:", sql)
+	result, err := conn.ExecContext(loader.ctx, sql)
+	if err != nil {
+		loader.cancel(err)
+		return
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		loader.cancel(err)
+		return
+	}
+
+	loader.logger.Debugf("Inserted %d rows", rows)
+	loader.rows = rows
+}
+
+// copyBatch is a batch of complete records that is parsed by a parser worker.
+type copyBatch struct {
+	data   []byte
+	record arrow.Record
+	err    error
+	done   chan struct{} // closed when the batch has been parsed
+}
+
+// copyPipeline splits and parses the data of a COPY FROM STDIN stream in parallel.
+// It implements array.RecordReader, which yields the parsed records in the order of the input data.
+type copyPipeline struct {
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	format    copyTextFormat
+	columns   []string
+	schema    *arrow.Schema
+	alloc     memory.Allocator
+	workers   int
+	batchSize int
+
+	chunks  chan []byte     // network reads -> splitter
+	batches chan *copyBatch // splitter -> parser workers
+	ordered chan *copyBatch // splitter -> writer, in the order of the input data
+
+	refCount atomic.Int64
+	record   arrow.Record
+	err      error
+}
+
+var _ array.RecordReader = (*copyPipeline)(nil)
+
+func newCopyPipeline(
+	ctx context.Context, cancel context.CancelCauseFunc,
+	format copyTextFormat, columns []string,
+	workers int, batchSize int,
+) *copyPipeline {
+	workers = max(workers, 1)
+	p := &copyPipeline{
+		ctx:       ctx,
+		cancel:    cancel,
+		format:    format,
+		columns:   columns,
+		schema:    newCopyArrowSchema(columns),
+		alloc:     memory.DefaultAllocator,
+		workers:   workers,
+		batchSize: batchSize,
+		chunks:    make(chan []byte, copyQueueSize),
+		batches:   make(chan *copyBatch, workers),
+		ordered:   make(chan *copyBatch, 2*workers),
+	}
+	p.refCount.Store(1)
+	return p
+}
+
+// Start launches the splitter and the parser workers.
+func (p *copyPipeline) Start() {
+	go p.split()
+	for range p.workers {
+		go p.parse()
+	}
+}
+
+// Send queues a chunk of the input data. It blocks if the queue is full.
+func (p *copyPipeline) Send(chunk []byte) error {
+	select {
+	case p.chunks <- chunk:
+		return nil
+	case <-p.ctx.Done():
+		return context.Cause(p.ctx)
+	}
+}
+
+// CloseSend signals that there is no more input data.
+func (p *copyPipeline) CloseSend() {
+	close(p.chunks)
+}
+
+func (p *copyPipeline) split() {
+	defer close(p.ordered)
+	defer close(p.batches)
+
+	splitter := newCopyRecordSplitter(&p.format)
+	for {
+		select {
+		case chunk, ok := <-p.chunks:
+			if !ok {
+				records, err := splitter.Flush()
+				if err != nil {
+					p.cancel(err)
+					return
+				}
+				p.dispatch(records)
+				return
+			}
+			if err := splitter.Feed(chunk); err != nil {
+				p.cancel(err)
+				return
+			}
+			if records := splitter.Records(p.batchSize); records != nil {
+				if !p.dispatch(records) {
+					return
+				}
+			}
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *copyPipeline) dispatch(data []byte) bool {
+	if len(data) == 0 {
+		return true
+	}
+	batch := &copyBatch{data: data, done: make(chan struct{})}
+	select {
+	case p.batches <- batch:
+	case <-p.ctx.Done():
+		return false
+	}
+	select {
+	case p.ordered <- batch:
+	case <-p.ctx.Done():
+		return false
+	}
+	return true
+}
+
+func (p *copyPipeline) parse() {
+	parser := newCopyRecordParser(&p.format, p.columns, p.schema, p.alloc)
+	defer parser.Release()
+	for batch := range p.batches {
+		batch.record, batch.err = parser.Parse(batch.data)
+		close(batch.done)
+	}
+}
+
+func (p *copyPipeline) Retain() {
+	p.refCount.Add(1)
+}
+
+func (p *copyPipeline) Release() {
+	if p.refCount.Add(-1) == 0 && p.record != nil {
+		p.record.Release()
+		p.record = nil
+	}
+}
+
+func (p *copyPipeline) Schema() *arrow.Schema {
+	return p.schema
+}
+
+func (p *copyPipeline) Next() bool {
+	if p.record != nil {
+		p.record.Release()
+		p.record = nil
+	}
+	if p.err != nil {
+		return false
+	}
+
+	var batch *copyBatch
+	select {
+	case b, ok := <-p.ordered:
+		if !ok {
+			// The splitter may have exited because of an error.
+			p.err = context.Cause(p.ctx)
+			return false
+		}
+		batch = b
+	case <-p.ctx.Done():
+		p.err = context.Cause(p.ctx)
+		return false
+	}
+
+	select {
+	case <-batch.done:
+	case <-p.ctx.Done():
+		p.err = context.Cause(p.ctx)
+		return false
+	}
+	if batch.err != nil {
+		p.err = batch.err
+		p.cancel(batch.err)
+		return false
+	}
+	p.record = batch.record
+	return true
+}
+
+func (p *copyPipeline) Record() arrow.Record {
+	return p.record
+}
+
+func (p *copyPipeline) Err() error {
+	return p.err
+}
@@ -0,0 +1,272 @@
+package pgserver
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+// startCopyPipeline starts a pipeline and feeds it with the chunks in the background.
+func startCopyPipeline(options *tree.CopyOptions, textOptions *CopyTextOptions, columns []string, workers, batchSize int, chunks []string) (*copyPipeline, error) {
+	format, err := newCopyTextFormat(options, textOptions, columns)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	p := newCopyPipeline(ctx, cancel, format, columns, workers, batchSize)
+	p.Start()
+	go func() {
+		defer p.CloseSend()
+		for _, chunk := range chunks {
+			if p.Send([]byte(chunk)) != nil {
+				return
+			}
+		}
+	}()
+	return p, nil
+}
+
+func TestCopyPipeline(t *testing.T) {
+	csv := &tree.CopyOptions{CopyFormat: tree.CopyFormatCSV}
+	text := &tree.CopyOptions{CopyFormat: tree.CopyFormatText}
+
+	tests := []struct {
+		name        string
+		options     *tree.CopyOptions
+		textOptions *CopyTextOptions
+		chunks      []string
+		expected    [][]any // nil for NULL
+		wantErr     bool
+	}{
+		{
+			name:     "Text format with escapes and NULL",
+			options:  text,
+			chunks:   []string{"1\ta\\tb\n2\t\\N\n3\t\\101\\x42\\\\\n"},
+			expected: [][]any{{"1", "a\tb"}, {"2", nil}, {"3", "AB\\"}},
+		},
+		{
+			name:     "Records spanning chunks",
+			options:  text,
+			chunks:   []string{"1\tfo", "o\n2", "\tbar\n", "3\tbaz"},
+			expected: [][]any{{"1", "foo"}, {"2", "bar"}, {"3", "baz"}},
+		},
+		{
+			name:     "End-of-data marker",
+			options:  text,
+			chunks:   []string{"1\ta\n\\", ".\r\n2\tb\n"},
+			expected: [][]any{{"1", "a"}},
+		},
+		{
+			name:     "End-of-data marker in the middle of a chunk",
+			options:  csv,
+			chunks:   []string{"1,\"\\.\n\"\n2,b\n\\.\n3,c\n"},
+			expected: [][]any{{"1", "\\.\n"}, {"2", "b"}},
+		},
+		{
+			name:     "CSV with quoted fields and empty strings",
+			options:  csv,
+			chunks:   []string{"1,\"a,\"\"b\"\"\nc\"\r\n2,\n", "3,\"\"\n"},
+			expected: [][]any{{"1", "a,\"b\"\nc"}, {"2", nil}, {"3", ""}},
+		},
+		{
+			name: "CSV with header, delimiter, and NULL string",
+			options: &tree.CopyOptions{
+				CopyFormat: tree.CopyFormatCSV,
+				HasHeader:  true,
+				Header:     true,
+				Delimiter:  tree.NewStrVal("|"),
+				Null:       tree.NewStrVal("NULL"),
+			},
+			chunks:   []string{"id|name\n1|NULL\n2|\"NULL\"\n"},
+			expected: [][]any{{"1", nil}, {"2", "NULL"}},
+		},
+		{
+			name:        "CSV with FORCE_NOT_NULL",
+			options:     csv,
+			textOptions: &CopyTextOptions{ForceNotNull: []string{"name"}},
+			chunks:      []string{",\n"},
+			expected:    [][]any{{nil, ""}},
+		},
+		{
+			name:        "CSV with FORCE_NULL",
+			options:     csv,
+			textOptions: &CopyTextOptions{ForceNull: []string{"name"}},
+			chunks:      []string{"\"\",\"\"\n"},
+			expected:    [][]any{{"", nil}},
+		},
+		{
+			name:        "FORCE_NOT_NULL with an unknown column",
+			options:     csv,
+			textOptions: &CopyTextOptions{ForceNotNull: []string{"unknown"}},
+			wantErr:     true,
+		},
+		{
+			name:        "FORCE_NOT_NULL in TEXT format",
+			options:     text,
+			textOptions: &CopyTextOptions{ForceNotNull: []string{"name"}},
+			wantErr:     true,
+		},
+		{
+			name:    "Missing column",
+			options: csv,
+			chunks:  []string{"1,a\n2\n"},
+			wantErr: true,
+		},
+		{
+			name:    "Extra column",
+			options: text,
+			chunks:  []string{"1\ta\tb\n"},
+			wantErr: true,
+		},
+		{
+			name:    "Unterminated quoted field",
+			options: csv,
+			chunks:  []string{"1,\"a\n"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A tiny batch size to exercise the ordering of the batches.
+			textOptions := tt.textOptions
+			if textOptions == nil {
+				textOptions = &CopyTextOptions{}
+			}
+			p, err := startCopyPipeline(tt.options, textOptions, []string{"id", "name"}, 4, 1, tt.chunks)
+			if tt.wantErr && err != nil {
+				return
+			}
+			require.NoError(t, err)
+
+			var rows [][]any
+			for p.Next() {
+				rec := p.Record()
+				for i := 0; i < int(rec.NumRows()); i++ {
+					row := make([]any, rec.NumCols())
+					for j := range row {
+						col := rec.Column(j).(*array.String)
+						if !col.IsNull(i) {
+							row[j] = col.Value(i)
+						}
+					}
+					rows = append(rows, row)
+				}
+			}
+			if tt.wantErr {
+				require.Error(t, p.Err())
+				return
+			}
+			require.NoError(t, p.Err())
+			require.Equal(t, tt.expected, rows)
+		})
+	}
+}
+
+func TestCopyRecordSplitterMaxRecordSize(t *testing.T) {
+	format, err := newCopyTextFormat(&tree.CopyOptions{CopyFormat: tree.CopyFormatText}, &CopyTextOptions{}, nil)
+	require.NoError(t, err)
+
+	splitter := newCopyRecordSplitter(&format)
+	splitter.maxRecordSize = 8
+	require.NoError(t, splitter.Feed([]byte("1\tabc\n2\tab")))
+	require.Equal(t, []byte("1\tabc\n"), splitter.Records(0))
+	require.NoError(t, splitter.Feed([]byte("cd")))
+	// The incomplete record is too large.
+	require.Error(t, splitter.Feed([]byte("efgh")))
+}
+
+func TestCopyCastExpr(t *testing.T) {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	defer connector.Close()
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+
+	query := fmt.Sprintf("SELECT %s, %s FROM (VALUES ('1', 'x'), (NULL, NULL)) v(\"id\", \"it's\")",
+		copyCastExpr("t", "id", "INTEGER"), copyCastExpr("t", "it's", "VARCHAR"))
+	rows, err := db.Query(query)
+	require.NoError(t, err)
+	var values [][]any
+	for rows.Next() {
+		var id, name any
+		require.NoError(t, rows.Scan(&id, &name))
+		values = append(values, []any{id, name})
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, [][]any{{int32(1), "x"}, {nil, nil}}, values)
+
+	_, err = db.Exec(fmt.Sprintf("SELECT %s FROM (VALUES ('2024-01-02'), ('x')) v(\"it's\")", copyCastExpr("t", "it's", "DATE")))
+	require.ErrorContains(t, err, `invalid input syntax for type date: "x" (COPY t, column it's)`)
+}
+
+func BenchmarkCopyPipeline(b *testing.B) {
+	const rows = 200_000
+	var sb strings.Builder
+	for i := range rows {
+		fmt.Fprintf(&sb, "%d,name_%d,%d.%02d,2024-01-%02d 12:34:56,\"quoted, text %d\"\n", i, i, i, i%100, i%28+1, i)
+	}
+	data := sb.String()
+	var chunks []string
+	for len(data) > 0 {
+		n := min(len(data), 64<<10)
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	options := &tree.CopyOptions{CopyFormat: tree.CopyFormatCSV}
+	columns := []string{"id", "name", "amount", "created_at", "note"}
+
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(b, err)
+	defer connector.Close()
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE t (id BIGINT, name VARCHAR, amount DECIMAL(18, 2), created_at TIMESTAMP, note VARCHAR)")
+	require.NoError(b, err)
+
+	types := []string{"BIGINT", "VARCHAR", "DECIMAL(18,2)", "TIMESTAMP", "VARCHAR"}
+	exprs := make([]string, len(columns))
+	for i, col := range columns {
+		exprs[i] = copyCastExpr("t", col, types[i])
+	}
+	insert := "INSERT INTO t SELECT " + strings.Join(exprs, ", ") + " FROM copy_source"
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			conn, err := db.Conn(context.Background())
+			require.NoError(b, err)
+			defer conn.Close()
+
+			b.SetBytes(int64(sb.Len()))
+			b.ResetTimer()
+			for range b.N {
+				p, err := startCopyPipeline(options, &CopyTextOptions{}, columns, workers, copyBatchSize, chunks)
+				require.NoError(b, err)
+
+				var release func()
+				require.NoError(b, conn.Raw(func(driverConn any) error {
+					arrow, err := duckdb.NewArrowFromConn(driverConn.(driver.Conn))
+					if err != nil {
+						return err
+					}
+					release, err = arrow.RegisterView(p, "copy_source")
+					return err
+				}))
+				result, err := conn.ExecContext(context.Background(), insert)
+				release()
+				require.NoError(b, err)
+				n, err := result.RowsAffected()
+				require.NoError(b, err)
+				require.EqualValues(b, rows, n)
+			}
+		})
+	}
+}
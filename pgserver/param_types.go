@@ -0,0 +1,140 @@
+package pgserver
+
+import (
+	"go/constant"
+	"math"
+
+	"github.com/apecloud/myduckserver/pgtypes"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/types"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// inferParameterTypes fills in the types of the parameters that DuckDB cannot determine, e.g., in `SELECT $1 + 1`.
+// It follows the PostgreSQL rules for the parameters of unknown types:
+// a parameter that is an operand of an operator takes the type of the other operand if it is known from the query,
+// the operands of the boolean operators are boolean, and the remaining parameters are resolved as text.
+// The parsed statement may be nil, in which case all unknown parameters are resolved as text.
+func inferParameterTypes(parsed tree.Statement, oids []uint32) {
+	unknown := false
+	for _, oid := range oids {
+		if oid == pgtype.UnknownOID {
+			unknown = true
+			break
+		}
+	}
+	if !unknown {
+		return
+	}
+
+	if parsed != nil {
+		// The statement is only inspected here, and errors are not expected since the visitor never fails.
+		_, _ = tree.SimpleStmtVisit(parsed, func(expr tree.Expr) (bool, tree.Expr, error) {
+			var left, right tree.Expr
+			switch expr := expr.(type) {
+			case *tree.BinaryExpr:
+				left, right = expr.Left, expr.Right
+			case *tree.ComparisonExpr:
+				left, right = expr.Left, expr.Right
+			case *tree.AndExpr:
+				inferOperandType(expr.Left, tree.DBoolTrue, oids)
+				inferOperandType(expr.Right, tree.DBoolTrue, oids)
+				return true, expr, nil
+			case *tree.OrExpr:
+				inferOperandType(expr.Left, tree.DBoolTrue, oids)
+				inferOperandType(expr.Right, tree.DBoolTrue, oids)
+				return true, expr, nil
+			case *tree.NotExpr:
+				inferOperandType(expr.Expr, tree.DBoolTrue, oids)
+				return true, expr, nil
+			default:
+				return true, expr, nil
+			}
+			inferOperandType(left, right, oids)
+			inferOperandType(right, left, oids)
+			return true, expr, nil
+		})
+	}
+
+	for i, oid := range oids {
+		if oid == pgtype.UnknownOID {
+			oids[i] = pgtype.TextOID
+		}
+	}
+}
+
+// inferOperandType assigns the type of the other operand to the operand if it is a parameter of unknown type.
+func inferOperandType(operand, other tree.Expr, oids []uint32) {
+	p, ok := operand.(*tree.Placeholder)
+	if !ok || int(p.Idx) >= len(oids) || oids[p.Idx] != pgtype.UnknownOID {
+		return
+	}
+	if oid := constantExprType(other, oids); oid != pgtype.UnknownOID {
+		oids[p.Idx] = oid
+	}
+}
+
+// constantExprType returns the type of the expression if it can be determined without binding the query.
+func constantExprType(expr tree.Expr, oids []uint32) uint32 {
+	switch expr := expr.(type) {
+	case *tree.ParenExpr:
+		return constantExprType(expr.Expr, oids)
+	case *tree.CastExpr:
+		if typ, ok := expr.Type.(*types.T); ok {
+			return uint32(typ.Oid())
+		}
+	case *tree.NumVal:
+		// An integer literal is an int4 if it fits, and the other numeric literals are numeric.
+		if expr.Kind() == constant.Int {
+			if v, err := expr.AsInt64(); err == nil {
+				if v >= math.MinInt32 && v <= math.MaxInt32 {
+					return pgtype.Int4OID
+				}
+				return pgtype.Int8OID
+			}
+		}
+		return pgtype.NumericOID
+	case *tree.DBool:
+		return pgtype.BoolOID
+	case *tree.Placeholder:
+		// A parameter whose type is known from DuckDB or the client.
+		if int(expr.Idx) < len(oids) {
+			return oids[expr.Idx]
+		}
+	}
+	return pgtype.UnknownOID
+}
+
+// parameterProbeTexts are the text representations of the values that are bound to the parameters
+// of unresolved types to probe the result types of a prepared statement.
+var parameterProbeTexts = map[uint32]string{
+	pgtype.BoolOID:        "f",
+	pgtype.Int2OID:        "0",
+	pgtype.Int4OID:        "0",
+	pgtype.Int8OID:        "0",
+	pgtype.Float4OID:      "0",
+	pgtype.Float8OID:      "0",
+	pgtype.NumericOID:     "0",
+	pgtype.TextOID:        "",
+	pgtype.VarcharOID:     "",
+	pgtype.DateOID:        "2000-01-01",
+	pgtype.TimeOID:        "00:00:00",
+	pgtype.TimestampOID:   "2000-01-01 00:00:00",
+	pgtype.TimestamptzOID: "2000-01-01 00:00:00+00",
+	pgtype.IntervalOID:    "0",
+	pgtype.UUIDOID:        "00000000-0000-0000-0000-000000000000",
+}
+
+// parameterProbeValue returns a value of the Go type that a parameter of the type is decoded into,
+// or nil if the type has no probe value.
+func parameterProbeValue(oid uint32) any {
+	text, ok := parameterProbeTexts[oid]
+	if !ok {
+		return nil
+	}
+	v, err := pgtypes.DecodeParameter(pgtypes.DefaultTypeMap, oid, pgtype.TextFormatCode, []byte(text))
+	if err != nil {
+		return nil
+	}
+	return v
+}
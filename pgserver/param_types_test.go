@@ -0,0 +1,39 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferParameterTypes(t *testing.T) {
+	const unknown = pgtype.UnknownOID
+	tests := []struct {
+		query string
+		oids  []uint32 // the types reported by DuckDB or specified by the client
+		want  []uint32
+	}{
+		{query: "SELECT $1", oids: []uint32{unknown}, want: []uint32{pgtype.TextOID}},
+		{query: "SELECT $1 + 1", oids: []uint32{unknown}, want: []uint32{pgtype.Int4OID}},
+		{query: "SELECT 10000000000 - $1", oids: []uint32{unknown}, want: []uint32{pgtype.Int8OID}},
+		{query: "SELECT $1 * 1.5", oids: []uint32{unknown}, want: []uint32{pgtype.NumericOID}},
+		{query: "SELECT $1 AND true", oids: []uint32{unknown}, want: []uint32{pgtype.BoolOID}},
+		{query: "SELECT $1 < (now()::date)", oids: []uint32{unknown}, want: []uint32{pgtype.DateOID}},
+		{query: "SELECT $1 = $2", oids: []uint32{unknown, pgtype.Int8OID}, want: []uint32{pgtype.Int8OID, pgtype.Int8OID}},
+		{query: "SELECT $1 = $2", oids: []uint32{unknown, unknown}, want: []uint32{pgtype.TextOID, pgtype.TextOID}},
+		{query: "SELECT 1 WHERE $1 > 0 AND $2 = 'x'", oids: []uint32{unknown, unknown}, want: []uint32{pgtype.Int4OID, pgtype.TextOID}},
+		{query: "SELECT $1 + 1", oids: []uint32{pgtype.Float8OID}, want: []uint32{pgtype.Float8OID}},
+	}
+	for _, tt := range tests {
+		stmt, err := parser.ParseOne(tt.query)
+		require.NoError(t, err)
+		inferParameterTypes(stmt.AST, tt.oids)
+		require.Equal(t, tt.want, tt.oids, tt.query)
+	}
+
+	oids := []uint32{unknown, pgtype.Int4OID}
+	inferParameterTypes(nil, oids)
+	require.Equal(t, []uint32{pgtype.TextOID, pgtype.Int4OID}, oids)
+}
@@ -0,0 +1,84 @@
+package pgserver
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
+)
+
+// The consistent snapshots of the replica for external tools, e.g., copying the database file or running exports:
+//
+//   - `SELECT * FROM myduck.pause_apply([timeout_ms])` stops applying the replicated changes at the next transaction
+//     boundary of the primary, see logrepl.PauseApply, and returns the LSN that each subscription paused at.
+//     The pause ends by itself after the timeout, 10 minutes by default.
+//   - `SELECT * FROM myduck.resume_apply()` resumes applying the changes, and returns the resumed subscriptions.
+//
+// The changes received meanwhile are retained by the replication slots on the primaries.
+
+// precompile a regex to match "select [* from] myduck.pause_apply([timeout_ms]);" or "select [* from] myduck.resume_apply();"
+var myduckPauseApplyRegex = regexp.MustCompile(`(?i)^\s*select\s+(?:\*\s+from\s+)?myduck\.(?:(pause_apply)\(\s*(\d+)?\s*\)|(resume_apply)\(\s*\))\s*;?\s*$`)
+
+var pausedApplyColumns = []diagColumn{
+	{"subscription", "VARCHAR"},
+	{"lsn", "VARCHAR"},
+	{"paused_until", "TIMESTAMPTZ"},
+}
+
+var resumedApplyColumns = []diagColumn{
+	{"subscription", "VARCHAR"},
+}
+
+func pausedApplyRelation(paused []logrepl.PausedApply) string {
+	rows := make([][]string, len(paused))
+	for i, p := range paused {
+		rows[i] = []string{
+			diagString(p.Subscription),
+			diagString(p.LSN.String()),
+			diagString(p.Until.UTC().Format(time.RFC3339Nano)),
+		}
+	}
+	return diagRelation(pausedApplyColumns, rows)
+}
+
+func resumedApplyRelation(subscriptions []string) string {
+	rows := make([][]string, len(subscriptions))
+	for i, sub := range subscriptions {
+		rows[i] = []string{diagString(sub)}
+	}
+	return diagRelation(resumedApplyColumns, rows)
+}
+
+// pauseApply runs myduck.pause_apply() or myduck.resume_apply() and returns the query of its result.
+func (h *ConnectionHandler) pauseApply(query string) (string, error) {
+	matches := myduckPauseApplyRegex.FindStringSubmatch(RemoveComments(query))
+	if matches[3] != "" {
+		resumed, err := logrepl.ResumeApply()
+		if err != nil {
+			return "", err
+		}
+		return "SELECT * FROM " + resumedApplyRelation(resumed) + ";", nil
+	}
+
+	timeout := logrepl.DefaultPauseApplyTimeout
+	if matches[2] != "" {
+		ms, err := strconv.ParseInt(matches[2], 10, 64)
+		if err != nil || ms == 0 {
+			return "", newPgError("22023", `invalid timeout: "%s"`, matches[2])
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	if _, ok := logrepl.AppliedLSN(""); !ok {
+		return "", newPgError("55000", "no subscription is running")
+	}
+	paused, err := logrepl.PauseApply(timeout)
+	if errors.Is(err, logrepl.ErrApplyNotPaused) {
+		return "", newPgError("55006", "%s", err.Error())
+	} else if err != nil {
+		return "", err
+	}
+	h.logger.Infof("Paused applying the replication for %s", timeout)
+	return "SELECT * FROM " + pausedApplyRelation(paused) + ";", nil
+}
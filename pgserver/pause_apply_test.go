@@ -0,0 +1,57 @@
+package pgserver
+
+import (
+	stdsql "database/sql"
+	"testing"
+	"time"
+
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
+	"github.com/jackc/pglogrepl"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPauseApplyRegex(t *testing.T) {
+	m := myduckPauseApplyRegex.FindStringSubmatch("SELECT myduck.pause_apply();")
+	require.NotNil(t, m)
+	require.Equal(t, "pause_apply", m[1])
+	require.Empty(t, m[2])
+
+	m = myduckPauseApplyRegex.FindStringSubmatch(" select * from MYDUCK.pause_apply( 60000 ) ")
+	require.NotNil(t, m)
+	require.Equal(t, "60000", m[2])
+
+	m = myduckPauseApplyRegex.FindStringSubmatch("SELECT * FROM myduck.resume_apply()")
+	require.NotNil(t, m)
+	require.Equal(t, "resume_apply", m[3])
+
+	require.Nil(t, myduckPauseApplyRegex.FindStringSubmatch("SELECT myduck.pause_apply('1s')"))
+	require.Nil(t, myduckPauseApplyRegex.FindStringSubmatch("SELECT myduck.resume_apply(1)"))
+	require.Nil(t, myduckPauseApplyRegex.FindStringSubmatch("SELECT myduck.pause_apply() FROM t"))
+}
+
+func TestPauseApplyRelations(t *testing.T) {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	defer connector.Close()
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+
+	paused := []logrepl.PausedApply{{
+		Subscription: "it's",
+		LSN:          pglogrepl.LSN(0x16B3748),
+		Until:        time.Date(2024, 11, 1, 8, 30, 0, 0, time.UTC),
+	}}
+	var sub, lsn string
+	var until float64
+	require.NoError(t, db.QueryRow("SELECT subscription, lsn, epoch(paused_until::TIMESTAMP) FROM "+pausedApplyRelation(paused)).Scan(&sub, &lsn, &until))
+	require.Equal(t, "it's", sub)
+	require.Equal(t, "0/16B3748", lsn)
+	require.Equal(t, float64(1730449800), until)
+
+	var n int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM "+resumedApplyRelation(nil)).Scan(&n))
+	require.Zero(t, n)
+	require.NoError(t, db.QueryRow("SELECT subscription FROM "+resumedApplyRelation([]string{"a", "b"})+" ORDER BY 1 DESC LIMIT 1").Scan(&sub))
+	require.Equal(t, "b", sub)
+}
@@ -0,0 +1,246 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/pgserver/pgconfig"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/dolthub/vitess/go/sqltypes"
+)
+
+// pgSettingsRegex matches the references to the pg_settings view.
+var pgSettingsRegex = regexp.MustCompile(`(?i)\b(FROM|JOIN)\s+(?:pg_catalog\.)?(?:"pg_settings"|pg_settings\b)`)
+
+// pgSettingsView is the per-connection temporary view that backs pg_settings.
+// It is recreated before each query that reads pg_settings, so that it reflects the current session.
+const pgSettingsView = "temp.main.pg_settings"
+
+// The scopes of the settings in pg_settings.
+const (
+	settingScopeGlobal  = "GLOBAL"
+	settingScopeSession = "SESSION"
+	// settingScopeLocal is the scope of a setting changed by SET LOCAL in the current transaction.
+	settingScopeLocal = "LOCAL"
+)
+
+// pgSetting is a row of pg_settings that comes from the Postgres configuration parameters
+// or the MySQL system variables. The settings of DuckDB are read from duckdb_settings() directly.
+type pgSetting struct {
+	Name      string
+	Setting   string
+	Category  string
+	ShortDesc string
+	Context   string
+	VarType   string
+	Source    string
+	BootVal   string
+	ResetVal  string
+	Scope     string
+}
+
+// pgSettings collects the Postgres configuration parameters and the MySQL system variables with their values
+// in the current session. A MySQL system variable is omitted if there is a Postgres parameter with the same name.
+func (h *ConnectionHandler) pgSettings(ctx *sql.Context) ([]pgSetting, error) {
+	params := pgconfig.Parameters()
+	settings := make([]pgSetting, 0, len(params))
+	for _, p := range params {
+		val, err := ctx.GetSessionVariable(ctx, p.Name)
+		if err != nil {
+			return nil, err
+		}
+		setting := formatSettingValue(p.Type, val)
+		source, scope := string(p.Source), settingScopeSession
+		if setting != formatSettingValue(p.Type, p.Default) {
+			source = "session"
+		}
+		if _, ok := h.duckHandler.localSettings[p.Name]; ok {
+			source, scope = "session", settingScopeLocal
+		}
+		settings = append(settings, pgSetting{
+			Name:      p.Name,
+			Setting:   setting,
+			Category:  p.Category,
+			ShortDesc: p.ShortDesc,
+			Context:   string(p.Context),
+			VarType:   settingVarType(p.Type),
+			Source:    source,
+			BootVal:   formatSettingValue(p.Type, p.Default),
+			ResetVal:  formatSettingValue(p.Type, p.ResetVal),
+			Scope:     scope,
+		})
+	}
+
+	globals := sql.SystemVariables.GetAllGlobalVariables()
+	names := make([]string, 0, len(globals))
+	for name := range globals {
+		if !pgconfig.IsValidPostgresConfigParameter(name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		sysVar, global, ok := sql.SystemVariables.GetGlobal(name)
+		if !ok {
+			continue
+		}
+		val, scope := global, settingScopeGlobal
+		if !sysVar.IsGlobalOnly() {
+			v, err := ctx.GetSessionVariable(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			val, scope = v, settingScopeSession
+		}
+		setting := formatSettingValue(sysVar.GetType(), val)
+		source := "default"
+		if setting != formatSettingValue(sysVar.GetType(), sysVar.GetDefault()) {
+			source = strings.ToLower(scope)
+		}
+		varContext := "user"
+		if sysVar.IsReadOnly() {
+			varContext = "internal"
+		}
+		settings = append(settings, pgSetting{
+			Name:     name,
+			Setting:  setting,
+			Category: "MySQL System Variables",
+			Context:  varContext,
+			VarType:  settingVarType(sysVar.GetType()),
+			Source:   source,
+			BootVal:  formatSettingValue(sysVar.GetType(), sysVar.GetDefault()),
+			ResetVal: formatSettingValue(sysVar.GetType(), sysVar.GetDefault()),
+			Scope:    scope,
+		})
+	}
+	return settings, nil
+}
+
+// createPgSettingsView (re)creates the temporary view that backs pg_settings for the current session.
+func (h *ConnectionHandler) createPgSettingsView() error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	settings, err := h.pgSettings(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = adapter.Exec(ctx, "CREATE OR REPLACE TEMP VIEW pg_settings AS "+pgSettingsQuery(settings))
+	return err
+}
+
+// pgSettingsQuery returns the query of pg_settings, which merges the given settings with the settings of DuckDB.
+// The given settings take precedence over the DuckDB settings with the same name.
+func pgSettingsQuery(settings []pgSetting) string {
+	var b strings.Builder
+	b.WriteString("SELECT name, setting, NULL::VARCHAR AS unit, category, short_desc, NULL::VARCHAR AS extra_desc, ")
+	b.WriteString("context, vartype, source, NULL::VARCHAR AS min_val, NULL::VARCHAR AS max_val, NULL::VARCHAR[] AS enumvals, ")
+	b.WriteString("boot_val, reset_val, NULL::VARCHAR AS sourcefile, NULL::INTEGER AS sourceline, false AS pending_restart, scope ")
+	b.WriteString("FROM (")
+	if len(settings) > 0 {
+		b.WriteString("SELECT * FROM (VALUES ")
+		for i, s := range settings {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString("(")
+			for j, v := range []string{s.Name, s.Setting, s.Category, s.ShortDesc, s.Context, s.VarType, s.Source, s.BootVal, s.ResetVal, s.Scope} {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteString(quoteSettingLiteral(v))
+			}
+			fmt.Fprintf(&b, ", %d)", i)
+		}
+		b.WriteString(") AS t(name, setting, category, short_desc, context, vartype, source, boot_val, reset_val, scope, priority) UNION ALL ")
+	}
+	fmt.Fprintf(&b, "SELECT name, value, 'DuckDB Settings', description, 'user', input_type, 'default', NULL, NULL, "+
+		"CASE scope WHEN 'GLOBAL' THEN '%s' ELSE '%s' END, %d FROM duckdb_settings()", settingScopeGlobal, settingScopeSession, len(settings))
+	b.WriteString(") QUALIFY row_number() OVER (PARTITION BY lower(name) ORDER BY priority) = 1 ORDER BY name")
+	return b.String()
+}
+
+// convertPgSettings replaces the references to pg_settings in the query with the temporary view.
+func convertPgSettings(query string) string {
+	return pgSettingsRegex.ReplaceAllString(query, "$1 "+pgSettingsView)
+}
+
+// inlinePgSettings replaces the references to pg_settings in the query with the subquery of the settings
+// of the current session. Unlike convertPgSettings, it does not create any temporary objects in the session,
+// at the cost of the settings being captured when the query is prepared rather than when it is executed.
+func (h *ConnectionHandler) inlinePgSettings(query string) (string, error) {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return "", err
+	}
+	settings, err := h.pgSettings(ctx)
+	if err != nil {
+		return "", err
+	}
+	return inlineView(query, pgSettingsRegex, pgSettingsQuery(settings), "pg_settings"), nil
+}
+
+// inlineView replaces the table references matched by re, whose first group is FROM or JOIN,
+// with the subquery, which is aliased with the name of the view unless the reference has an alias.
+func inlineView(query string, re *regexp.Regexp, subquery string, name string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(query, -1) {
+		b.WriteString(query[last:m[0]])
+		b.WriteString(query[m[2]:m[3]]) // FROM or JOIN
+		b.WriteString(" (")
+		b.WriteString(subquery)
+		b.WriteString(")")
+		last = m[1]
+		// Keep the alias of the table reference, or alias the subquery with the name of the view.
+		if alias := tableAliasRegex.FindStringSubmatch(query[last:]); alias == nil ||
+			(alias[1] == "" && slices.Contains(nonAliasKeywords, strings.ToLower(alias[2]))) {
+			b.WriteString(" AS " + name)
+		}
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
+
+func quoteSettingLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// formatSettingValue formats the value of a setting the way Postgres displays it, e.g., `on` for a true Boolean.
+func formatSettingValue(t sql.Type, v any) string {
+	if v == nil {
+		return ""
+	}
+	if _, ok := t.(types.SystemBoolType); ok {
+		if b, err := parseBoolSetting("", v); err == nil {
+			if b {
+				return "on"
+			}
+			return "off"
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// settingVarType returns the pg_settings.vartype of a setting of the given type.
+func settingVarType(t sql.Type) string {
+	if _, ok := t.(types.SystemBoolType); ok {
+		return "bool"
+	}
+	if t.String() == "system_enum" {
+		return "enum"
+	}
+	switch t.Type() {
+	case sqltypes.Int64, sqltypes.Uint64:
+		return "integer"
+	case sqltypes.Float64:
+		return "real"
+	}
+	return "string"
+}
@@ -18,6 +18,7 @@ package pgconfig
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -50,6 +51,18 @@ func Init() {
 	sql.SystemVariables.AddSystemVariables(params)
 }
 
+// Parameters returns all postgres configuration parameters, sorted by name.
+func Parameters() []*Parameter {
+	params := make([]*Parameter, 0, len(postgresConfigParameters))
+	for _, sysVar := range postgresConfigParameters {
+		if p, ok := sysVar.(*Parameter); ok {
+			params = append(params, p)
+		}
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params
+}
+
 var (
 	ErrInvalidValue          = errors.NewKind("ERROR:  invalid value for parameter \"%s\": \"%s\"")
 	ErrCannotChangeAtRuntime = errors.NewKind("ERROR:  parameter \"%s\" cannot be changed now")
@@ -60,6 +73,7 @@ var _ sql.SystemVariable = (*Parameter)(nil)
 type Parameter struct {
 	Name         string
 	Default      any
+	Unit         string // The unit of a numeric value, e.g., "kB" or "ms", or empty if it has none.
 	Category     string
 	ShortDesc    string
 	Context      ParameterContext
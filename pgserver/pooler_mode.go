@@ -0,0 +1,58 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// poolerMode makes the server safe to run behind transaction-pooling proxies, e.g., PgBouncer or ProxySQL,
+// which may serve the consecutive transactions of a client with different server connections.
+// In this mode, the internal queries do not rely on the session state, e.g., temporary views,
+// and the changes to the reported parameters are always sent to the client with ParameterStatus,
+// so that the proxy can track them and replay them on another server connection.
+var poolerMode bool
+
+// WithPoolerMode enables the compatibility mode for transaction-pooling proxies, see poolerMode.
+func WithPoolerMode(enabled bool) ListenerOpt {
+	return func(l *Listener) {
+		poolerMode = enabled
+	}
+}
+
+// sendParameterStatus sends the ParameterStatus message for the parameter, and remembers the reported value,
+// so that the later changes of the parameter can be reported in the pooler mode.
+func (h *ConnectionHandler) sendParameterStatus(name, value string) error {
+	if h.reportedParams == nil {
+		h.reportedParams = make(map[string]*pgproto3.ParameterStatus)
+	}
+	h.reportedParams[strings.ToLower(name)] = &pgproto3.ParameterStatus{Name: name, Value: value}
+	return h.send(&pgproto3.ParameterStatus{Name: name, Value: value})
+}
+
+// reportParameterChanges sends the ParameterStatus messages for the reported parameters
+// whose values have changed since they were last reported, e.g., by RESET, DISCARD ALL,
+// or at the end of a transaction block that used SET LOCAL.
+func (h *ConnectionHandler) reportParameterChanges() error {
+	if len(h.reportedParams) == 0 {
+		return nil
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	for _, reported := range h.reportedParams {
+		v, err := ctx.GetSessionVariable(ctx, reported.Name)
+		if err != nil {
+			continue
+		}
+		if value := fmt.Sprintf("%v", v); value != reported.Value {
+			if err := h.sendParameterStatus(reported.Name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
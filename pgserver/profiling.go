@@ -0,0 +1,128 @@
+package pgserver
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/google/uuid"
+	"github.com/marcboeker/go-duckdb"
+)
+
+// ProfilingParameter is the session parameter that toggles the capturing of DuckDB query profiles.
+// When enabled, the profile of each subsequent statement is stored in `__sys__.query_profile_log`, which is read
+// through the `__sys__.query_profiles` view, where the users other than the superusers see their own profiles only,
+// see restrictsQueryProfiles.
+const ProfilingParameter = "myduck.profiling"
+
+// queryProfileReadRegex matches the statements that may read the query profiles: the ones that mention
+// catalog.QueryProfileRelations, and the ones that call the table functions of DuckDB that read the tables
+// by the names computed when they run, e.g., `query_table('__sys__.' || 'query_profile_log')`.
+var queryProfileReadRegex = regexp.MustCompile(`(?is)\b(?:` + strings.Join(catalog.QueryProfileRelations, "|") + `)\b|` +
+	`\bquery(?:_table)?"?\s*(?:(?:/\*.*?\*/|--[^\n]*\n)\s*)*\(`)
+
+// restrictsQueryProfiles reports whether a statement of a user other than a superuser may read the query profiles.
+// Such a statement is rewritten to read the profiles of the user only, like the tables with row-level security,
+// see applyRowSecurity, so its table functions are refused; it is refused if it cannot be rewritten.
+func (h *ConnectionHandler) restrictsQueryProfiles(ctx *sql.Context, query string) bool {
+	return queryProfileReadRegex.MatchString(query) && !h.isSuperuser(ctx)
+}
+
+// refuseQueryProfiles returns the error of a statement that may read the query profiles of the other users.
+func refuseQueryProfiles() error {
+	return newPgError("42501", "permission denied to read the query profiles of the other users")
+}
+
+// queryProfileNode is the JSON representation of a node in DuckDB's profiling tree.
+type queryProfileNode struct {
+	Metrics  map[string]string  `json:"metrics"`
+	Children []queryProfileNode `json:"children,omitempty"`
+}
+
+func newQueryProfileNode(info duckdb.ProfilingInfo) queryProfileNode {
+	node := queryProfileNode{Metrics: info.Metrics}
+	if len(info.Children) > 0 {
+		node.Children = make([]queryProfileNode, len(info.Children))
+		for i, child := range info.Children {
+			node.Children[i] = newQueryProfileNode(child)
+		}
+	}
+	return node
+}
+
+// setProfiling enables or disables the capturing of query profiles on the underlying DuckDB connection.
+func (h *DuckHandler) setProfiling(ctx *sql.Context, enabled bool) error {
+	stmt := "PRAGMA disable_profiling"
+	if enabled {
+		// The profiles are collected via the C API instead of being written to a file or stdout.
+		stmt = "PRAGMA enable_profiling = 'no_output'"
+	}
+	if _, err := adapter.ExecCatalog(ctx, stmt); err != nil {
+		return err
+	}
+	h.profiling = enabled
+	return nil
+}
+
+// recordProfile saves the profile of the last executed query into `__sys__.query_profile_log`, see
+// catalog.DatabaseProvider.RecordQueryProfile. Failing to record a profile must not fail the query, so errors are only logged.
+func (h *DuckHandler) recordProfile(ctx *sql.Context, query string, start time.Time) {
+	latency := time.Since(start)
+
+	conn, err := adapter.GetCatalogConn(ctx)
+	if err != nil {
+		ctx.GetLogger().WithError(err).Warn("Failed to get connection for recording the query profile")
+		return
+	}
+	info, err := duckdb.GetProfilingInfo(conn)
+	if err != nil {
+		// No query has been executed by DuckDB, e.g., the statement is handled by the server itself.
+		ctx.GetLogger().WithError(err).Debug("No query profile is available")
+		return
+	}
+	if name, ok := info.Metrics["QUERY_NAME"]; ok && name != query {
+		// The profile belongs to a previous query.
+		return
+	}
+	h.countProfile(info.Metrics)
+
+	plan, err := json.Marshal(newQueryProfileNode(info))
+	if err != nil {
+		ctx.GetLogger().WithError(err).Warn("Failed to encode the query profile")
+		return
+	}
+
+	if err := ctx.Session.(*backend.Session).Provider().RecordQueryProfile(adapter.GetCurrentCatalog(ctx), catalog.QueryProfile{
+		QueryID:      uuid.NewString(),
+		ConnectionID: ctx.Session.ID(),
+		User:         ctx.Session.Client().User,
+		Query:        query,
+		StartedAt:    start,
+		Latency:      latency,
+		Plan:         string(plan),
+	}); err != nil {
+		ctx.GetLogger().WithError(err).Warn("Failed to record the query profile")
+	}
+}
+
+// setProfiling handles `SET myduck.profiling = on|off`.
+func (h *ConnectionHandler) setProfiling(value any, useDefault bool) error {
+	enabled := false
+	if !useDefault {
+		var err error
+		if enabled, err = parseBoolSetting(ProfilingParameter, value); err != nil {
+			return err
+		}
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	return h.duckHandler.setProfiling(ctx, enabled)
+}
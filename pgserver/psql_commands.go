@@ -0,0 +1,547 @@
+package pgserver
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree/treecmp"
+)
+
+// psqlCommand is a psql meta-command, such as \l and \dt, recognized by the shape of its catalog query.
+//
+// psql implements the meta-commands by sending queries against pg_catalog, whose exact text
+// differs between psql versions and depends on the options and patterns given to the commands.
+// Rather than matching the query text, the query is parsed, and the command is identified by
+// the catalog tables it reads and the columns it returns. The relation kinds and the name patterns
+// are then extracted from the WHERE clause, so that a single replacement query serves all versions.
+type psqlCommand int
+
+const (
+	psqlUnknownCommand         psqlCommand = iota
+	psqlListDatabases                      // \l
+	psqlListRelations                      // \d, \dt, \dv, \dm, \ds, \dE
+	psqlLookupRelation                     // \d NAME, the first of the queries describing a relation
+	psqlDescribeRelation                   // \d NAME, the properties of the relation
+	psqlDescribeColumns                    // \d NAME, the columns
+	psqlDescribeIndexes                    // \d NAME, the indexes
+	psqlDescribeChecks                     // \d NAME, the check constraints
+	psqlDescribeForeignKeys                // \d NAME, the foreign keys
+	psqlDescribeReferencedBy               // \d NAME, the foreign keys that reference the table
+	psqlDescribeViewDefinition             // \d+ NAME, the definition of a view
+	psqlDescribeOther                      // \d NAME, the other footers, such as policies and triggers, which are always empty
+	psqlListSchemas                        // \dn
+	psqlListFunctions                      // \df
+	psqlListRoles                          // \du
+)
+
+// psqlQuery describes a recognized psql catalog query.
+type psqlQuery struct {
+	Command psqlCommand
+	// RelKinds are the relation kinds listed by \d and its variants, e.g., 'r' and 'p' for \dt.
+	RelKinds []string
+	// NamePattern and SchemaPattern are the regular expressions that psql builds from the pattern
+	// given to the command, e.g., `^(foo.*)$` for `\dt foo*`. They are empty if there is no pattern.
+	NamePattern   string
+	SchemaPattern string
+	// OID is the relation described by the queries that follow psqlLookupRelation,
+	// i.e., the oid returned by the replacement query of psqlLookupRelation.
+	OID string
+	// Verbose is set for the verbose variants of \d that list the relations, e.g., \dt+, which add their descriptions.
+	Verbose bool
+	// Columns are the result columns of the queries that follow psqlLookupRelation,
+	// which vary with the options of the command, e.g., \d+ adds the storage and the description of the columns.
+	Columns []string
+}
+
+// psqlDefaultCollation matches the no-op collation that psql appends to the pattern matches,
+// which the parser does not accept.
+var psqlDefaultCollation = regexp.MustCompile(`(?i)\s+COLLATE\s+pg_catalog\.default\b`)
+
+// recognizePsqlQuery checks whether the query is sent by psql to implement a meta-command.
+func recognizePsqlQuery(query string) (psqlQuery, bool) {
+	// psql always qualifies the catalog tables, which cheaply rules out most queries.
+	if !hasSubstringFold(query, "pg_catalog.") {
+		return psqlQuery{}, false
+	}
+	// The queries that follow the lookup of \d NAME refer to the relation by its oid in a string literal.
+	if m := psqlRelationOIDRegex.FindStringSubmatch(query); m != nil {
+		return recognizePsqlDescribeQuery(query, strings.ToLower(m[1]), m[2]), true
+	}
+	stmt, err := parser.ParseOne(psqlDefaultCollation.ReplaceAllString(query, ""))
+	if err != nil {
+		return psqlQuery{}, false
+	}
+	sel, ok := stmt.AST.(*tree.Select)
+	if !ok || sel.With != nil || len(sel.OrderBy) == 0 || sel.Limit != nil {
+		return psqlQuery{}, false
+	}
+	clause, ok := sel.Select.(*tree.SelectClause)
+	if !ok || len(clause.From.Tables) != 1 || clause.GroupBy != nil || clause.Having != nil {
+		return psqlQuery{}, false
+	}
+	tables := psqlCatalogTables(clause.From.Tables[0], nil)
+	if len(tables) == 0 {
+		return psqlQuery{}, false
+	}
+	columns := psqlColumnNames(clause.Exprs)
+
+	var (
+		q        psqlQuery
+		patterns = make(map[string]string)
+	)
+	if clause.Where != nil {
+		psqlCollectFilters(clause.Where.Expr, &q, patterns)
+	}
+
+	switch tables[0] {
+	case "pg_database":
+		if psqlHasColumns(columns, "name", "owner", "encoding") {
+			q.Command = psqlListDatabases
+			q.NamePattern = patterns["datname"]
+		}
+	case "pg_class":
+		if psqlHasColumns(columns, "schema", "name", "type", "owner") && q.RelKinds != nil {
+			q.Command = psqlListRelations
+			q.Verbose = slices.Contains(columns, "description")
+		} else if slices.Equal(columns, []string{"oid", "nspname", "relname"}) {
+			q.Command = psqlLookupRelation
+		}
+		q.NamePattern, q.SchemaPattern = patterns["relname"], patterns["nspname"]
+	case "pg_namespace":
+		if len(tables) == 1 && slices.Equal(columns, []string{"name", "owner"}) {
+			q.Command = psqlListSchemas
+			q.NamePattern = patterns["nspname"]
+		}
+	case "pg_proc":
+		if psqlHasColumns(columns, "schema", "name", "result data type", "argument data types") {
+			q.Command = psqlListFunctions
+			q.NamePattern, q.SchemaPattern = patterns["proname"], patterns["nspname"]
+		}
+	case "pg_roles":
+		if psqlHasColumns(columns, "rolname", "rolsuper", "rolcanlogin") {
+			q.Command = psqlListRoles
+			q.NamePattern = patterns["rolname"]
+		}
+	}
+	if q.Command == psqlUnknownCommand {
+		return psqlQuery{}, false
+	}
+	if q.Command != psqlListRelations {
+		q.RelKinds = nil
+	}
+	return q, true
+}
+
+// hasSubstringFold reports whether substr is within s regardless of the case, without making a lowercase copy of s,
+// since it runs on every query. substr must be in lowercase ASCII. If it contains a byte that is not a letter,
+// the candidates are the occurrences in s of the last such byte, e.g., `.`, which are found with strings.IndexByte;
+// otherwise, they are the occurrences of its first letter in either case.
+func hasSubstringFold(s, substr string) bool {
+	if substr == "" {
+		// Same as strings.Contains.
+		return true
+	}
+	anchor := strings.LastIndexFunc(substr, func(r rune) bool { return r < 'a' || r > 'z' })
+	if anchor < 0 {
+		first := string([]byte{substr[0], substr[0] - 'a' + 'A'})
+		for i := 0; i+len(substr) <= len(s); i++ {
+			j := strings.IndexAny(s[i:], first)
+			if j < 0 {
+				return false
+			}
+			i += j
+			if i+len(substr) <= len(s) && strings.EqualFold(s[i:i+len(substr)], substr) {
+				return true
+			}
+		}
+		return false
+	}
+	for i := anchor; i < len(s); i++ {
+		j := strings.IndexByte(s[i:], substr[anchor])
+		if j < 0 {
+			return false
+		}
+		i += j
+		if start := i - anchor; start >= 0 && start+len(substr) <= len(s) && strings.EqualFold(s[start:start+len(substr)], substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// psqlRelationOIDRegex matches the references to the described relation in the queries of \d NAME,
+// e.g., `WHERE c.oid = '16384'` and `pg_catalog.pg_get_viewdef('16384'::pg_catalog.oid, true)`.
+var psqlRelationOIDRegex = regexp.MustCompile(`(?i)\b(oid|attrelid|indrelid|conrelid|polrelid|stxrelid|inhrelid|inhparent|prrelid|tgrelid|ev_class|pg_partition_ancestors|pg_get_viewdef)\s*(?:=|\()\s*'(\d+)'`)
+
+// recognizePsqlDescribeQuery identifies a query of \d NAME on the relation with the given oid.
+// The queries that are not identified are the footers that do not apply to DuckDB, which are answered with no rows.
+func recognizePsqlDescribeQuery(query, reference, oid string) psqlQuery {
+	q := psqlQuery{Command: psqlDescribeOther, OID: oid}
+	if reference == "pg_get_viewdef" {
+		q.Command = psqlDescribeViewDefinition
+		return q
+	}
+	stmt, err := parser.ParseOne(psqlDefaultCollation.ReplaceAllString(query, ""))
+	if err != nil {
+		return q
+	}
+	sel, ok := stmt.AST.(*tree.Select)
+	if !ok {
+		return q
+	}
+	clause, ok := sel.Select.(*tree.SelectClause)
+	if !ok || len(clause.From.Tables) == 0 {
+		return q
+	}
+	var tables []string
+	for _, expr := range clause.From.Tables {
+		if tables = psqlCatalogTables(expr, tables); tables == nil {
+			return q
+		}
+	}
+	columns := psqlColumnNames(clause.Exprs)
+
+	switch {
+	case tables[0] == "pg_class" && psqlHasColumns(columns, "relchecks", "relkind"):
+		q.Command = psqlDescribeRelation
+	case tables[0] == "pg_attribute" && len(columns) > 0 && columns[0] == "attname":
+		q.Command = psqlDescribeColumns
+	case slices.Contains(tables, "pg_index") && psqlHasColumns(columns, "relname", "indisprimary"):
+		q.Command = psqlDescribeIndexes
+	case tables[0] == "pg_constraint" && psqlHasColumns(columns, "sametable", "conname", "condef"):
+		q.Command = psqlDescribeForeignKeys
+	case tables[0] == "pg_constraint" && psqlHasColumns(columns, "conname", "ontable", "condef"):
+		q.Command = psqlDescribeReferencedBy
+	case tables[0] == "pg_constraint" && slices.Equal(columns, []string{"conname", "pg_get_constraintdef"}):
+		q.Command = psqlDescribeChecks
+	default:
+		return q
+	}
+	q.Columns = columns
+	return q
+}
+
+// psqlCatalogTables returns the pg_catalog tables in the FROM clause in order of appearance.
+// It returns nil if any table is not qualified with pg_catalog.
+func psqlCatalogTables(expr tree.TableExpr, tables []string) []string {
+	switch expr := expr.(type) {
+	case *tree.AliasedTableExpr:
+		return psqlCatalogTables(expr.Expr, tables)
+	case *tree.ParenTableExpr:
+		return psqlCatalogTables(expr.Expr, tables)
+	case *tree.JoinTableExpr:
+		if tables = psqlCatalogTables(expr.Left, tables); tables == nil {
+			return nil
+		}
+		return psqlCatalogTables(expr.Right, tables)
+	case *tree.TableName:
+		if !expr.ExplicitSchema || !strings.EqualFold(expr.Schema(), "pg_catalog") {
+			return nil
+		}
+		return append(tables, strings.ToLower(expr.Table()))
+	default:
+		return nil
+	}
+}
+
+// psqlColumnNames returns the lowercase names of the result columns, i.e., their aliases,
+// the referenced columns, or the unqualified names of the called functions.
+func psqlColumnNames(exprs tree.SelectExprs) []string {
+	names := make([]string, len(exprs))
+	for i, expr := range exprs {
+		if expr.As != "" {
+			names[i] = strings.ToLower(string(expr.As))
+		} else if name, ok := expr.Expr.(*tree.UnresolvedName); ok {
+			names[i] = strings.ToLower(name.Parts[0])
+		} else if fn, ok := expr.Expr.(*tree.FuncExpr); ok {
+			name := strings.ToLower(fn.Func.String())
+			names[i] = name[strings.LastIndexByte(name, '.')+1:]
+		}
+	}
+	return names
+}
+
+func psqlHasColumns(columns []string, names ...string) bool {
+	for _, name := range names {
+		if !slices.Contains(columns, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// psqlCollectFilters extracts the relation kinds and the pattern matches from the WHERE clause.
+// The patterns are keyed by the lowercase name of the matched column, such as relname and nspname.
+func psqlCollectFilters(expr tree.Expr, q *psqlQuery, patterns map[string]string) {
+	switch expr := expr.(type) {
+	case *tree.AndExpr:
+		psqlCollectFilters(expr.Left, q, patterns)
+		psqlCollectFilters(expr.Right, q, patterns)
+	case *tree.ParenExpr:
+		psqlCollectFilters(expr.Expr, q, patterns)
+	case *tree.ComparisonExpr:
+		column, ok := expr.Left.(*tree.UnresolvedName)
+		if !ok {
+			return
+		}
+		name := strings.ToLower(column.Parts[0])
+		switch expr.Operator.Symbol {
+		case treecmp.In:
+			tuple, ok := expr.Right.(*tree.Tuple)
+			if !ok || name != "relkind" {
+				return
+			}
+			kinds := make([]string, 0, len(tuple.Exprs))
+			for _, e := range tuple.Exprs {
+				if s, ok := e.(*tree.StrVal); ok {
+					kinds = append(kinds, s.RawString())
+				}
+			}
+			q.RelKinds = kinds
+		case treecmp.RegMatch:
+			if s, ok := expr.Right.(*tree.StrVal); ok {
+				patterns[name] = s.RawString()
+			}
+		}
+	}
+}
+
+// psqlRelationTypes maps the relation kinds of pg_class to the table types of information_schema.tables.
+var psqlRelationTypes = map[string]string{
+	"r": "BASE TABLE",
+	"p": "BASE TABLE",
+	"v": "VIEW",
+}
+
+// replacementQuery returns the query that produces the output of the meta-command.
+// It returns an empty string if the command is not supported.
+func (q psqlQuery) replacementQuery() string {
+	var b strings.Builder
+	switch q.Command {
+	case psqlListDatabases:
+		b.WriteString(`SELECT d.datname AS "Name", 'postgres' AS "Owner", 'UTF8' AS "Encoding", 'en_US.UTF-8' AS "Collate", 'en_US.UTF-8' AS "Ctype", 'en-US' AS "ICU Locale", 'libc' AS "Locale Provider", '' AS "Access privileges" FROM pg_catalog.pg_database d`)
+		b.WriteString(" WHERE TRUE")
+		psqlWritePatternMatch(&b, "d.datname", q.NamePattern)
+	case psqlListRelations:
+		var types []string
+		for _, kind := range q.RelKinds {
+			if typ, ok := psqlRelationTypes[kind]; ok && !slices.Contains(types, typ) {
+				types = append(types, typ)
+			}
+		}
+		b.WriteString(`SELECT table_schema AS "Schema", table_name AS "Name", CASE table_type WHEN 'VIEW' THEN 'view' ELSE 'table' END AS "Type", 'postgres' AS "Owner"`)
+		if q.Verbose {
+			b.WriteString(`, ` + catalog.SchemaNameSYS + "." + catalog.MacroNameMyCommentText + `(TABLE_COMMENT) AS "Description"`)
+		}
+		b.WriteString(" FROM information_schema.tables")
+		if len(types) == 0 {
+			b.WriteString(" WHERE FALSE")
+		} else {
+			b.WriteString(" WHERE table_type IN ('")
+			b.WriteString(strings.Join(types, "', '"))
+			b.WriteString("')")
+		}
+		if q.SchemaPattern == "" {
+			b.WriteString(" AND table_schema <> 'pg_catalog' AND table_schema <> 'information_schema'")
+		}
+		psqlWritePatternMatch(&b, "table_schema", q.SchemaPattern)
+		psqlWritePatternMatch(&b, "table_name", q.NamePattern)
+	case psqlLookupRelation:
+		b.WriteString("SELECT r.oid, r.nspname, r.relname FROM " + psqlRelations + " r WHERE r.database_name = current_database()")
+		if q.SchemaPattern == "" {
+			// psql looks up the relations visible in the search path.
+			b.WriteString(" AND r.nspname = current_schema()")
+		}
+		psqlWritePatternMatch(&b, "r.nspname", q.SchemaPattern)
+		psqlWritePatternMatch(&b, "r.relname", q.NamePattern)
+		b.WriteString(" ORDER BY 2, 3;")
+		return b.String()
+	case psqlDescribeRelation:
+		psqlWriteColumns(&b, q.Columns, map[string]string{
+			"relchecks":       "r.relchecks",
+			"relkind":         "r.relkind",
+			"relhasindex":     "r.index_count > 0 OR EXISTS (SELECT 1 FROM duckdb_constraints() k WHERE k.table_oid = r.oid AND k.constraint_type IN ('PRIMARY KEY', 'UNIQUE'))",
+			"relhastriggers":  "r.relkind = 'r'", // psql lists the foreign keys of the tables with triggers only
+			"reltablespace":   "0",
+			"relpersistence":  "'p'",
+			"relreplident":    "'d'",
+			"amname":          "NULL",
+			"":                "''", // reloptions and reloftype
+			"array_to_string": "''", // reloptions of \d+
+		}, "false")
+		b.WriteString(" FROM " + psqlRelations + " r WHERE r.oid = " + q.OID + ";")
+		return b.String()
+	case psqlDescribeColumns:
+		psqlWriteColumns(&b, q.Columns, map[string]string{
+			"attname":         "c.column_name",
+			"format_type":     psqlFormatType("c.data_type"),
+			"":                "c.column_default", // the unnamed subquery on pg_attrdef
+			"attnotnull":      "NOT c.is_nullable",
+			"attstorage":      "'p'",
+			"col_description": catalog.SchemaNameSYS + "." + catalog.MacroNameMyCommentText + "(c.comment)",
+		}, "NULL")
+		b.WriteString(" FROM duckdb_columns() c WHERE c.table_oid = " + q.OID + " ORDER BY c.column_index;")
+		return b.String()
+	case psqlDescribeIndexes:
+		psqlWriteColumns(&b, q.Columns, map[string]string{
+			"relname":              "i.relname",
+			"indisprimary":         "i.indisprimary",
+			"indisunique":          "i.indisunique",
+			"indisvalid":           "true",
+			"pg_get_indexdef":      "i.indexdef",
+			"pg_get_constraintdef": "i.condef",
+			"contype":              "i.contype",
+			"reltablespace":        "0",
+		}, "false")
+		b.WriteString(" FROM (" +
+			"SELECT k.constraint_name AS relname, k.constraint_type = 'PRIMARY KEY' AS indisprimary, true AS indisunique," +
+			" 'CREATE UNIQUE INDEX ' || k.constraint_name || ' ON ' || k.table_name || ' USING art (' || array_to_string(k.constraint_column_names, ', ') || ')' AS indexdef," +
+			" k.constraint_text AS condef, CASE k.constraint_type WHEN 'PRIMARY KEY' THEN 'p' ELSE 'u' END AS contype" +
+			" FROM duckdb_constraints() k WHERE k.table_oid = " + q.OID + " AND k.constraint_type IN ('PRIMARY KEY', 'UNIQUE')" +
+			" UNION ALL " +
+			"SELECT x.index_name, x.is_primary, x.is_unique," +
+			" 'CREATE ' || CASE WHEN x.is_unique THEN 'UNIQUE ' ELSE '' END || 'INDEX ' || x.index_name || ' ON ' || x.table_name ||" +
+			" ' USING ' || lower(coalesce(nullif(regexp_extract(x.sql, 'USING\\s+(\\w+)', 1), ''), 'art')) || ' (' || regexp_extract(x.sql, '\\(([^)]*)\\)', 1) || ')'," +
+			" NULL, NULL" +
+			" FROM duckdb_indexes() x WHERE x.table_oid = " + q.OID +
+			") i ORDER BY i.indisprimary DESC, i.relname;")
+		return b.String()
+	case psqlDescribeChecks:
+		psqlWriteColumns(&b, q.Columns, map[string]string{
+			"conname":              "k.constraint_name",
+			"pg_get_constraintdef": "'CHECK ' || k.expression",
+		}, "NULL")
+		b.WriteString(" FROM duckdb_constraints() k WHERE k.table_oid = " + q.OID + " AND k.constraint_type = 'CHECK' ORDER BY k.constraint_name;")
+		return b.String()
+	case psqlDescribeForeignKeys:
+		psqlWriteColumns(&b, q.Columns, map[string]string{
+			"sametable": "true",
+			"conname":   "k.constraint_name",
+			"condef":    "k.constraint_text",
+			"ontable":   "k.table_name",
+		}, "NULL")
+		b.WriteString(" FROM duckdb_constraints() k WHERE k.table_oid = " + q.OID + " AND k.constraint_type = 'FOREIGN KEY' ORDER BY k.constraint_name;")
+		return b.String()
+	case psqlDescribeReferencedBy:
+		psqlWriteColumns(&b, q.Columns, map[string]string{
+			"conname": "k.constraint_name",
+			"ontable": "k.table_name",
+			"condef":  "k.constraint_text",
+		}, "NULL")
+		b.WriteString(" FROM duckdb_constraints() k JOIN " + psqlRelations + " r" +
+			" ON k.database_name = r.database_name AND k.schema_name = r.nspname AND k.referenced_table = r.relname" +
+			" WHERE r.oid = " + q.OID + " AND k.constraint_type = 'FOREIGN KEY' ORDER BY k.constraint_name;")
+		return b.String()
+	case psqlDescribeViewDefinition:
+		// Postgres returns the query of the view only.
+		return `SELECT regexp_replace(v.sql, '^\s*CREATE\s+(?:OR\s+REPLACE\s+)?(?:TEMP\w*\s+)?VIEW\s+.*?\s+AS\s+', '', 'i') AS pg_get_viewdef` +
+			" FROM duckdb_views() v WHERE v.view_oid = " + q.OID + ";"
+	case psqlDescribeOther:
+		return "SELECT NULL LIMIT 0;"
+	case psqlListSchemas:
+		b.WriteString(`SELECT * FROM (SELECT 'public' AS "Name", 'pg_database_owner' AS "Owner") WHERE TRUE`)
+		psqlWritePatternMatch(&b, `"Name"`, q.NamePattern)
+	case psqlListFunctions:
+		// The functions are those of pg_proc other than the built-in functions of Postgres, see catalog/pg_proc.go.
+		b.WriteString(`SELECT f.nspname AS "Schema", f.function_name AS "Name",`)
+		b.WriteString(" CASE WHEN f.function_type IN ('table', 'table_macro') THEN 'SETOF record'")
+		b.WriteString(" ELSE coalesce(" + psqlFormatType("f.return_type") + `, 'anyelement') END AS "Result data type",`)
+		b.WriteString(" array_to_string(list_transform(range(1, len(f.parameters) + 1), i -> f.parameters[i] || ' ' ||")
+		b.WriteString(" coalesce(" + psqlFormatType("f.parameter_types[i]") + `, 'anyelement')), ', ') AS "Argument data types",`)
+		b.WriteString(` CASE WHEN f.function_type = 'aggregate' THEN 'agg' ELSE 'func' END AS "Type"`)
+		b.WriteString(" FROM " + catalog.PgProcFunctions + " f WHERE TRUE")
+		if q.SchemaPattern == "" && q.NamePattern == "" {
+			b.WriteString(" AND f.nspname <> 'pg_catalog'")
+		}
+		psqlWritePatternMatch(&b, "f.nspname", q.SchemaPattern)
+		psqlWritePatternMatch(&b, "f.function_name", q.NamePattern)
+	case psqlListRoles:
+		// We don't support users yet, so we'll just return nothing for now
+		return `SELECT '' AS rolname LIMIT 0;`
+	default:
+		return ""
+	}
+	b.WriteString(" ORDER BY 1, 2;")
+	return b.String()
+}
+
+// psqlRelations lists the relations of DuckDB in the shape of pg_class, for the queries of \d NAME.
+const psqlRelations = "(SELECT table_oid AS oid, database_name, schema_name AS nspname, table_name AS relname, 'r' AS relkind," +
+	" check_constraint_count AS relchecks, index_count FROM duckdb_tables() WHERE NOT internal" +
+	" UNION ALL SELECT view_oid, database_name, schema_name, view_name, 'v', 0, 0 FROM duckdb_views() WHERE NOT internal)"
+
+// psqlTypeNames maps the DuckDB types to the names printed by format_type of Postgres.
+var psqlTypeNames = map[string]string{
+	"BOOLEAN":                  "boolean",
+	"TINYINT":                  "smallint",
+	"SMALLINT":                 "smallint",
+	"INTEGER":                  "integer",
+	"BIGINT":                   "bigint",
+	"UTINYINT":                 "smallint",
+	"USMALLINT":                "integer",
+	"UINTEGER":                 "bigint",
+	"UBIGINT":                  "numeric",
+	"HUGEINT":                  "numeric",
+	"UHUGEINT":                 "numeric",
+	"FLOAT":                    "real",
+	"DOUBLE":                   "double precision",
+	"VARCHAR":                  "text",
+	"BLOB":                     "bytea",
+	"DATE":                     "date",
+	"TIME":                     "time without time zone",
+	"TIME WITH TIME ZONE":      "time with time zone",
+	"TIMESTAMP":                "timestamp without time zone",
+	"TIMESTAMP WITH TIME ZONE": "timestamp with time zone",
+	"INTERVAL":                 "interval",
+	"UUID":                     "uuid",
+	"JSON":                     "json",
+}
+
+// psqlFormatType returns the expression that formats a DuckDB type name like format_type of Postgres.
+func psqlFormatType(column string) string {
+	names := make([]string, 0, len(psqlTypeNames))
+	for name := range psqlTypeNames {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	b.WriteString("CASE " + column)
+	for _, name := range names {
+		b.WriteString(" WHEN '" + name + "' THEN '" + psqlTypeNames[name] + "'")
+	}
+	// e.g., DECIMAL(10,2) -> numeric(10,2)
+	b.WriteString(" ELSE regexp_replace(lower(" + column + "), '^decimal', 'numeric') END")
+	return b.String()
+}
+
+// psqlWriteColumns writes the select list that answers the given result columns of a query of \d NAME.
+// The columns that are not in exprs get the default expression.
+func psqlWriteColumns(b *strings.Builder, columns []string, exprs map[string]string, defaultExpr string) {
+	b.WriteString("SELECT ")
+	for i, column := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		expr, ok := exprs[column]
+		if !ok {
+			expr = defaultExpr
+		}
+		b.WriteString(expr)
+	}
+}
+
+func psqlWritePatternMatch(b *strings.Builder, column, pattern string) {
+	if pattern == "" {
+		return
+	}
+	b.WriteString(" AND regexp_matches(")
+	b.WriteString(column)
+	b.WriteString(", '")
+	b.WriteString(strings.ReplaceAll(pattern, "'", "''"))
+	b.WriteString("')")
+}
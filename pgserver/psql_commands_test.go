@@ -0,0 +1,291 @@
+package pgserver
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// psqlCorpus maps the files in testdata/psql/<version>/ to the expected recognition results.
+// The files contain the queries sent by psql 13 to 16 for the meta-commands.
+var psqlCorpus = map[string]psqlQuery{
+	"l":          {Command: psqlListDatabases},
+	"l_pattern":  {Command: psqlListDatabases, NamePattern: "^(post.*)$"},
+	"d":          {Command: psqlListRelations, RelKinds: []string{"r", "p", "v", "m", "S", "f", ""}},
+	"dt":         {Command: psqlListRelations, RelKinds: []string{"r", "p", ""}},
+	"dv":         {Command: psqlListRelations, RelKinds: []string{"v", ""}},
+	"dt_pattern": {Command: psqlListRelations, RelKinds: []string{"r", "p", ""}, NamePattern: "^(psql_corpus.*)$"},
+	"dt_schema":  {Command: psqlListRelations, RelKinds: []string{"r", "p", ""}, SchemaPattern: "^(public)$"},
+	"d_name":     {Command: psqlLookupRelation, NamePattern: "^(psql_corpus)$"},
+	"dn":         {Command: psqlListSchemas},
+	"df":         {Command: psqlListFunctions},
+	"du":         {Command: psqlListRoles},
+}
+
+// psqlCorpusDir returns the directory of the corpus. It does not depend on the working directory,
+// which is changed by the tests that start a server.
+func psqlCorpusDir(t *testing.T) string {
+	_, file, _, ok := runtime.Caller(0)
+	require.True(t, ok)
+	return filepath.Join(filepath.Dir(file), "testdata", "psql")
+}
+
+func TestRecognizePsqlQueryCorpus(t *testing.T) {
+	dir := psqlCorpusDir(t)
+	versions, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.NotEmpty(t, versions)
+
+	for _, version := range versions {
+		for name, want := range psqlCorpus {
+			t.Run(version.Name()+"/"+name, func(t *testing.T) {
+				query, err := os.ReadFile(filepath.Join(dir, version.Name(), name+".sql"))
+				require.NoError(t, err)
+				got, ok := recognizePsqlQuery(string(query))
+				require.True(t, ok)
+				require.Equal(t, want, got)
+			})
+		}
+	}
+}
+
+func TestRecognizePsqlQueryIgnoresOtherQueries(t *testing.T) {
+	for _, query := range []string{
+		`SELECT 1`,
+		`SELECT * FROM pg_catalog.pg_class`,
+		`SELECT c.relname FROM pg_catalog.pg_class c ORDER BY 1`,
+		// Not qualified with pg_catalog
+		`SELECT n.nspname AS "Name", pg_catalog.pg_get_userbyid(n.nspowner) AS "Owner" FROM pg_namespace n ORDER BY 1`,
+		// Reads a user table
+		`SELECT n.nspname as "Schema", c.relname as "Name", 'table' as "Type", 'me' as "Owner" FROM pg_catalog.pg_class c JOIN t n ON n.oid = c.relnamespace WHERE c.relkind IN ('r') ORDER BY 1, 2`,
+		// Limited
+		`SELECT d.datname as "Name", 'me' as "Owner", 'UTF8' as "Encoding" FROM pg_catalog.pg_database d ORDER BY 1 LIMIT 1`,
+		`SELECT pg_type.oid, enumlabel FROM pg_enum JOIN pg_type ON pg_type.oid=enumtypid ORDER BY oid, enumsortorder`,
+		`not a query`,
+	} {
+		_, ok := recognizePsqlQuery(query)
+		require.False(t, ok, query)
+	}
+}
+
+func TestPsqlReplacementQuery(t *testing.T) {
+	tests := []struct {
+		query    psqlQuery
+		contains []string
+		excludes []string
+	}{
+		{
+			query:    psqlQuery{Command: psqlListRelations, RelKinds: []string{"r", "p", ""}},
+			contains: []string{"table_type IN ('BASE TABLE')", "table_schema <> 'pg_catalog'"},
+			excludes: []string{"regexp_matches"},
+		},
+		{
+			query:    psqlQuery{Command: psqlListRelations, RelKinds: []string{"r", "p", "v", "m", "S", "f", ""}},
+			contains: []string{"table_type IN ('BASE TABLE', 'VIEW')"},
+		},
+		{
+			query:    psqlQuery{Command: psqlListRelations, RelKinds: []string{"S", ""}},
+			contains: []string{"WHERE FALSE"},
+		},
+		{
+			query:    psqlQuery{Command: psqlListRelations, RelKinds: []string{"v", ""}, NamePattern: "^(it's)$", SchemaPattern: "^(public)$"},
+			contains: []string{"table_type IN ('VIEW')", "regexp_matches(table_name, '^(it''s)$')", "regexp_matches(table_schema, '^(public)$')"},
+			excludes: []string{"table_schema <> 'pg_catalog'"},
+		},
+		{
+			query:    psqlQuery{Command: psqlListRelations, RelKinds: []string{"r", "p", ""}, Verbose: true},
+			contains: []string{`__sys__.my_comment_text(TABLE_COMMENT) AS "Description"`},
+		},
+		{
+			query:    psqlQuery{Command: psqlListDatabases, NamePattern: "^(post.*)$"},
+			contains: []string{"FROM pg_catalog.pg_database d", "regexp_matches(d.datname, '^(post.*)$')"},
+		},
+		{
+			query:    psqlQuery{Command: psqlListSchemas, NamePattern: "^(public)$"},
+			contains: []string{`regexp_matches("Name", '^(public)$')`},
+		},
+		{
+			query:    psqlQuery{Command: psqlListFunctions},
+			contains: []string{"FROM duckdb_functions() f", "f.nspname <> 'pg_catalog'", `AS "Argument data types"`},
+			excludes: []string{"regexp_matches(f.function_name, '^("},
+		},
+		{
+			query:    psqlQuery{Command: psqlListFunctions, NamePattern: "^(my_macro)$"},
+			contains: []string{"regexp_matches(f.function_name, '^(my_macro)$')"},
+			excludes: []string{"f.nspname <> 'pg_catalog'"},
+		},
+	}
+	for _, tt := range tests {
+		got := tt.query.replacementQuery()
+		for _, s := range tt.contains {
+			require.Contains(t, got, s)
+		}
+		for _, s := range tt.excludes {
+			require.NotContains(t, got, s)
+		}
+		require.True(t, strings.HasSuffix(got, ";"), got)
+	}
+	require.Contains(t, psqlQuery{Command: psqlLookupRelation}.replacementQuery(), "r.nspname = current_schema()")
+	require.Empty(t, psqlQuery{Command: psqlUnknownCommand}.replacementQuery())
+}
+
+// The queries sent by psql 16 for \d NAME after the lookup of the relation.
+func TestRecognizePsqlDescribeQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		command  psqlCommand
+		contains []string
+	}{
+		{
+			`SELECT c.relchecks, c.relkind, c.relhasindex, c.relhasrules, c.relhastriggers, c.relrowsecurity, c.relforcerowsecurity, false AS relhasoids, c.relispartition, '', c.reltablespace, CASE WHEN c.reloftype = 0 THEN '' ELSE c.reloftype::pg_catalog.regtype::pg_catalog.text END, c.relpersistence, c.relreplident, am.amname
+FROM pg_catalog.pg_class c
+ LEFT JOIN pg_catalog.pg_class tc ON (c.reltoastrelid = tc.oid)
+LEFT JOIN pg_catalog.pg_am am ON (c.relam = am.oid)
+WHERE c.oid = '16384';`,
+			psqlDescribeRelation,
+			[]string{"SELECT r.relchecks, r.relkind, r.index_count > 0", "'', 0, '', 'p', 'd', NULL FROM", "WHERE r.oid = 16384;"},
+		},
+		{
+			`SELECT a.attname,
+  pg_catalog.format_type(a.atttypid, a.atttypmod),
+  (SELECT pg_catalog.pg_get_expr(d.adbin, d.adrelid, true)
+   FROM pg_catalog.pg_attrdef d
+   WHERE d.adrelid = a.attrelid AND d.adnum = a.attnum AND a.atthasdef),
+  a.attnotnull,
+  (SELECT c.collname FROM pg_catalog.pg_collation c, pg_catalog.pg_type t
+   WHERE c.oid = a.attcollation AND t.oid = a.atttypid AND a.attcollation <> t.typcollation) AS attcollation,
+  a.attidentity,
+  a.attgenerated
+FROM pg_catalog.pg_attribute a
+WHERE a.attrelid = '16384' AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum;`,
+			psqlDescribeColumns,
+			[]string{"SELECT c.column_name, CASE c.data_type WHEN", "c.column_default, NOT c.is_nullable, NULL, NULL, NULL FROM", "c.table_oid = 16384"},
+		},
+		{
+			`SELECT c2.relname, i.indisprimary, i.indisunique, i.indisclustered, i.indisvalid, pg_catalog.pg_get_indexdef(i.indexrelid, 0, true),
+  pg_catalog.pg_get_constraintdef(con.oid, true), contype, condeferrable, condeferred, i.indisreplident, c2.reltablespace
+FROM pg_catalog.pg_class c, pg_catalog.pg_class c2, pg_catalog.pg_index i
+  LEFT JOIN pg_catalog.pg_constraint con ON (conrelid = i.indrelid AND conindid = i.indexrelid AND contype IN ('p','u','x'))
+WHERE c.oid = '16384' AND c.oid = i.indrelid AND i.indexrelid = c2.oid
+ORDER BY i.indisprimary DESC, c2.relname;`,
+			psqlDescribeIndexes,
+			[]string{"SELECT i.relname, i.indisprimary, i.indisunique, false, true, i.indexdef, i.condef, i.contype, false, false, false, 0 FROM"},
+		},
+		{
+			`SELECT r.conname, pg_catalog.pg_get_constraintdef(r.oid, true)
+FROM pg_catalog.pg_constraint r
+WHERE r.conrelid = '16384' AND r.contype = 'c'
+ORDER BY 1;`,
+			psqlDescribeChecks,
+			[]string{"k.constraint_type = 'CHECK'"},
+		},
+		{
+			`SELECT true as sametable, conname,
+  pg_catalog.pg_get_constraintdef(r.oid, true) as condef,
+  conrelid::pg_catalog.regclass AS ontable
+FROM pg_catalog.pg_constraint r
+WHERE r.conrelid = '16384' AND r.contype = 'f'
+     AND conparentid = 0
+ORDER BY conname`,
+			psqlDescribeForeignKeys,
+			[]string{"SELECT true, k.constraint_name, k.constraint_text, k.table_name FROM"},
+		},
+		{
+			`SELECT conname, conrelid::pg_catalog.regclass AS ontable,
+       pg_catalog.pg_get_constraintdef(oid, true) AS condef
+  FROM pg_catalog.pg_constraint c
+ WHERE confrelid IN (SELECT pg_catalog.pg_partition_ancestors('16384')
+                     UNION ALL VALUES ('16384'::pg_catalog.regclass))
+       AND contype = 'f' AND conparentid = 0
+ORDER BY conname;`,
+			psqlDescribeReferencedBy,
+			[]string{"k.referenced_table = r.relname", "r.oid = 16384"},
+		},
+		{
+			`SELECT pg_catalog.pg_get_viewdef('16384'::pg_catalog.oid, true);`,
+			psqlDescribeViewDefinition,
+			[]string{"v.view_oid = 16384"},
+		},
+		{
+			`SELECT pol.polname, pol.polpermissive,
+  CASE WHEN pol.polroles = '{0}' THEN NULL ELSE pg_catalog.array_to_string(array(select rolname from pg_catalog.pg_roles where oid = any (pol.polroles) order by 1),',') END,
+  pg_catalog.pg_get_expr(pol.polqual, pol.polrelid),
+  pg_catalog.pg_get_expr(pol.polwithcheck, pol.polrelid),
+  CASE pol.polcmd
+    WHEN 'r' THEN 'SELECT'
+    WHEN 'a' THEN 'INSERT'
+    WHEN 'w' THEN 'UPDATE'
+    WHEN 'd' THEN 'DELETE'
+    END AS cmd
+FROM pg_catalog.pg_policy pol
+WHERE pol.polrelid = '16384' ORDER BY 1;`,
+			psqlDescribeOther,
+			[]string{"LIMIT 0"},
+		},
+		{
+			`SELECT c.oid::pg_catalog.regclass
+FROM pg_catalog.pg_class c, pg_catalog.pg_inherits i
+WHERE c.oid = i.inhparent AND i.inhrelid = '16384'
+  AND c.relkind != 'p' AND c.relkind != 'I'
+ORDER BY inhseqno;`,
+			psqlDescribeOther,
+			[]string{"LIMIT 0"},
+		},
+	}
+	for _, tt := range tests {
+		q, ok := recognizePsqlQuery(tt.query)
+		require.True(t, ok, tt.query)
+		require.Equal(t, tt.command, q.Command, tt.query)
+		require.Equal(t, "16384", q.OID)
+		got := q.replacementQuery()
+		for _, s := range tt.contains {
+			require.Contains(t, got, s)
+		}
+	}
+}
+
+func TestHasSubstringFold(t *testing.T) {
+	require.True(t, hasSubstringFold("SELECT * FROM pg_catalog.pg_class", "pg_catalog."))
+	require.True(t, hasSubstringFold("select * from PG_CATALOG.pg_class", "pg_catalog."))
+	require.True(t, hasSubstringFold("pg_catalog.", "pg_catalog."))
+	require.False(t, hasSubstringFold("SELECT * FROM pg_catalog", "pg_catalog."))
+	require.False(t, hasSubstringFold("SELECT t.a FROM catalog.t", "pg_catalog."))
+	require.False(t, hasSubstringFold(".", "pg_catalog."))
+
+	// Without a byte that is not a letter.
+	require.True(t, hasSubstringFold("SHOW TABLES", "show"))
+	require.True(t, hasSubstringFold("/* s */ sHoW columns FROM t", "show"))
+	require.False(t, hasSubstringFold("SELECT 1", "show"))
+	require.False(t, hasSubstringFold("sho", "show"))
+	require.False(t, hasSubstringFold("", "show"))
+	require.True(t, hasSubstringFold("", ""))
+	require.True(t, hasSubstringFold("SELECT 1", ""))
+}
+
+// BenchmarkSpecialCommandDispatch measures the overhead of checking the queries that are not
+// the special commands of psql and the workbenches, which is paid by every Query message.
+func BenchmarkSpecialCommandDispatch(b *testing.B) {
+	queries := []string{
+		"SELECT 1",
+		"INSERT INTO t VALUES (1, 'a')",
+		"UPDATE accounts SET balance = balance + 1 WHERE id = 42",
+		"SELECT " + strings.Repeat("a_rather_long_column_name, ", 100) + "b FROM t WHERE c > 0",
+	}
+	h := &ConnectionHandler{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, q := range queries {
+			if _, ok := recognizePsqlQuery(q); ok {
+				b.Fatal(q)
+			}
+			if handled, _ := h.handledWorkbenchCommands(q); handled {
+				b.Fatal(q)
+			}
+		}
+	}
+}
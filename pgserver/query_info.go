@@ -0,0 +1,44 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// recordQueryInfo records the metrics of a statement that has completed with the given tag and row count
+// in the session, which row_count() and found_rows() return afterwards, as ROW_COUNT() and FOUND_ROWS() of MySQL do:
+// the affected rows of a DML statement, -1 for a query, and 0 for the other statements.
+func (h *ConnectionHandler) recordQueryInfo(tag string, rows int32) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	switch {
+	case tag == "INSERT" || tag == "DELETE" || tag == "MERGE":
+		ctx.SetLastQueryInfoInt(sql.RowCount, int64(rows))
+	case tag == "UPDATE":
+		ctx.SetLastQueryInfoInt(sql.RowCount, int64(rows))
+		ctx.SetLastQueryInfoInt(sql.FoundRows, int64(rows))
+	case returnsRow(tag):
+		ctx.SetLastQueryInfoInt(sql.RowCount, -1)
+		ctx.SetLastQueryInfoInt(sql.FoundRows, int64(rows))
+	default:
+		ctx.SetLastQueryInfoInt(sql.RowCount, 0)
+	}
+	return nil
+}
+
+// queryInfoFunction returns the session function that returns the metric of the last statement.
+func queryInfoFunction(key string) sessionFunction {
+	return sessionFunction{
+		Eval: func(h *ConnectionHandler, _ []string) (string, error) {
+			ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d::BIGINT", ctx.GetLastQueryInfoInt(key)), nil
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package pgserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
+	"github.com/jackc/pglogrepl"
+)
+
+// The read-your-writes consistency of the applications that write to the primary and read from the replica:
+//
+//   - `SELECT myduck.applied_lsn(['subscription'])` returns the WAL position of the primary up to which the changes
+//     are visible on the replica, i.e., the smallest one of the running subscriptions, or NULL if none is running.
+//   - `SELECT myduck.wait_for_lsn('X/Y', timeout_ms [, 'subscription'])` waits until the changes committed on the
+//     primary before the LSN given, e.g., pg_current_wal_lsn() of the primary after a write, are visible on the replica.
+//     It returns true once they are, or false if they are not within the timeout, in which case the application may
+//     read from the primary instead.
+//
+// The LSNs of different primaries are not comparable, so the subscription is given if the replica has several primaries.
+// The replicas of MySQL primaries report the applied GTIDs in @@GLOBAL.gtid_executed instead, as MySQL does.
+
+// precompile a regex to match the calls of "myduck.applied_lsn()" or "myduck.applied_lsn('subscription')"
+var myduckAppliedLSNRegex = regexp.MustCompile(`(?i)\bmyduck\.applied_lsn\(\s*(?:'((?:[^']|'')*)'\s*)?\)`)
+
+// precompile a regex to match "select myduck.wait_for_lsn('X/Y', timeout_ms [, 'subscription']);"
+var myduckWaitForLSNRegex = regexp.MustCompile(`(?i)^\s*select\s+myduck\.wait_for_lsn\(\s*'([^']*)'\s*,\s*(\d+)\s*(?:,\s*'((?:[^']|'')*)'\s*)?\)\s*;?\s*$`)
+
+// convertAppliedLSN substitutes the applied LSNs into the query.
+func convertAppliedLSN(query string) string {
+	return myduckAppliedLSNRegex.ReplaceAllStringFunc(query, func(call string) string {
+		subscription := strings.ReplaceAll(myduckAppliedLSNRegex.FindStringSubmatch(call)[1], "''", "'")
+		lsn, ok := logrepl.AppliedLSN(subscription)
+		if !ok {
+			return "NULL::VARCHAR"
+		}
+		return "'" + lsn.String() + "'::VARCHAR"
+	})
+}
+
+// waitForLSN runs myduck.wait_for_lsn() and returns whether the LSN has been applied within the timeout.
+func (h *ConnectionHandler) waitForLSN(query string) (bool, error) {
+	matches := myduckWaitForLSNRegex.FindStringSubmatch(RemoveComments(query))
+	lsn, err := pglogrepl.ParseLSN(matches[1])
+	if err != nil {
+		return false, newPgError("22P02", `invalid input syntax for type pg_lsn: "%s"`, matches[1])
+	}
+	timeout, err := strconv.ParseInt(matches[2], 10, 64)
+	if err != nil {
+		return false, newPgError("22023", `invalid timeout: "%s"`, matches[2])
+	}
+	subscription := strings.ReplaceAll(matches[3], "''", "'")
+	if _, ok := logrepl.AppliedLSN(subscription); !ok {
+		if subscription != "" {
+			return false, newPgError("55000", `subscription "%s" is not running`, subscription)
+		}
+		return false, newPgError("55000", "no subscription is running")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Millisecond)
+	defer cancel()
+	err = logrepl.WaitForAppliedLSN(ctx, lsn, subscription)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return false, nil
+	case errors.Is(err, logrepl.ErrReplicatorNotRunning):
+		return false, newPgError("55000", "the replication stopped before LSN %s was applied", lsn)
+	}
+	return false, fmt.Errorf("failed to wait for LSN %s: %w", lsn, err)
+}
@@ -0,0 +1,29 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadYourWritesFuncs(t *testing.T) {
+	// No subscription is running.
+	require.Equal(t, `SELECT NULL::VARCHAR AS lsn, NULL::VARCHAR`,
+		convertAppliedLSN(`SELECT myduck.applied_lsn() AS lsn, MYDUCK.applied_lsn( 'it''s' )`))
+
+	m := myduckWaitForLSNRegex.FindStringSubmatch(`SELECT myduck.wait_for_lsn('0/16B3748', 5000, 'it''s');`)
+	require.NotNil(t, m)
+	require.Equal(t, []string{"0/16B3748", "5000", "it''s"}, m[1:])
+	m = myduckWaitForLSNRegex.FindStringSubmatch(`select myduck.wait_for_lsn( '0/16B3748' , 0 )`)
+	require.NotNil(t, m)
+	require.Equal(t, []string{"0/16B3748", "0", ""}, m[1:])
+	require.Nil(t, myduckWaitForLSNRegex.FindStringSubmatch(`SELECT myduck.wait_for_lsn('0/16B3748')`))
+
+	h := &ConnectionHandler{}
+	_, err := h.waitForLSN(`SELECT myduck.wait_for_lsn('not an lsn', 10)`)
+	require.ErrorContains(t, err, "invalid input syntax for type pg_lsn")
+	_, err = h.waitForLSN(`SELECT myduck.wait_for_lsn('0/16B3748', 10)`)
+	require.ErrorContains(t, err, "no subscription is running")
+	_, err = h.waitForLSN(`SELECT myduck.wait_for_lsn('0/16B3748', 10, 'sub')`)
+	require.ErrorContains(t, err, `subscription "sub" is not running`)
+}
@@ -0,0 +1,59 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+)
+
+// ReplicaMaxLagParameter is the session parameter that bounds the replication lag seen by the read queries.
+// When it is set to a number of bytes, each SELECT outside a transaction block waits until every running
+// subscription has applied the WAL sent by the primary, but at most that many bytes, so that the reads are
+// close to synchronous with the primary. It is off by default, i.e., the reads never wait.
+const ReplicaMaxLagParameter = "myduck.replica_max_lag"
+
+// replicaWaitTimeout is how long a read query waits for the replication to catch up before it fails.
+const replicaWaitTimeout = 10 * time.Second
+
+// waitForReplica delays the statement until the replication lag is within the bound of the session, if any.
+func (h *DuckHandler) waitForReplica(ctx context.Context, parsed tree.Statement) error {
+	if h.replicaMaxLag == nil || h.inTxnBlock {
+		return nil
+	}
+	if _, ok := parsed.(*tree.Select); !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, replicaWaitTimeout)
+	defer cancel()
+	if err := logrepl.WaitForReplicationLag(ctx, *h.replicaMaxLag); err != nil {
+		return newPgError("57014", "canceling statement due to replication lag: %v", err)
+	}
+	return nil
+}
+
+// replicaMaxLagSetting returns the value of ReplicaMaxLagParameter shown by SHOW.
+func (h *DuckHandler) replicaMaxLagSetting() string {
+	if h.replicaMaxLag == nil {
+		return "off"
+	}
+	return strconv.FormatUint(*h.replicaMaxLag, 10)
+}
+
+// setReplicaMaxLag handles `SET myduck.replica_max_lag = off|<bytes>`.
+func (h *ConnectionHandler) setReplicaMaxLag(value any, useDefault bool) error {
+	var maxLag *uint64
+	if setting := strings.ToLower(strings.TrimSpace(fmt.Sprint(value))); !useDefault && setting != "off" {
+		bytes, err := strconv.ParseUint(setting, 10, 64)
+		if err != nil {
+			return newPgError("22023", `invalid value for parameter "%s": "%v"`, ReplicaMaxLagParameter, value)
+		}
+		maxLag = &bytes
+	}
+	h.duckHandler.replicaMaxLag = maxLag
+	return nil
+}
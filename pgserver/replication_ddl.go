@@ -0,0 +1,58 @@
+package pgserver
+
+import (
+	"context"
+	"errors"
+
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+)
+
+// ddlTargets returns the tables whose schema or existence is changed by a DDL statement.
+func ddlTargets(stmt tree.Statement) []tree.TableName {
+	switch stmt := stmt.(type) {
+	case *tree.AlterTable:
+		return []tree.TableName{stmt.Table.ToTableName()}
+	case *tree.RenameTable:
+		if !stmt.IsView && !stmt.IsSequence {
+			return []tree.TableName{stmt.Name.ToTableName()}
+		}
+	case *tree.DropTable:
+		return stmt.Names
+	case *tree.CreateIndex:
+		return []tree.TableName{stmt.Table}
+	}
+	return nil
+}
+
+// runDDL runs a DDL statement, coordinated with the replicators of the tables that it alters,
+// and records its schema changes. See logrepl.RunDDL and recordSchemaChanges.
+func (h *ConnectionHandler) runDDL(statement ConvertedStatement, exec func() error) error {
+	if err := h.runDDLWithReplicators(statement, exec); err != nil {
+		return err
+	}
+	return h.recordSchemaChanges(statement)
+}
+
+// runDDLWithReplicators runs a DDL statement, coordinated with the replicators of the tables that it alters.
+func (h *ConnectionHandler) runDDLWithReplicators(statement ConvertedStatement, exec func() error) error {
+	targets := ddlTargets(statement.AST)
+	if len(targets) == 0 {
+		return exec()
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	var tables []logrepl.TableName
+	for _, target := range targets {
+		for _, schema := range copyTargetSchemas(ctx, target.Schema()) {
+			tables = append(tables, logrepl.TableName{Schema: schema, Table: target.Table()})
+		}
+	}
+	err = logrepl.RunDDL(tables, exec)
+	if errors.Is(err, logrepl.ErrReplicationBusy) {
+		return newPgError("55006", "%s", err.Error())
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDDLTargets(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"ALTER TABLE t ADD COLUMN c INT", []string{"t"}},
+		{"ALTER TABLE s.t RENAME COLUMN a TO b", []string{"s.t"}},
+		{"ALTER TABLE s.t RENAME TO u", []string{"s.t"}},
+		{"DROP TABLE a, s.b", []string{"a", "s.b"}},
+		{"CREATE INDEX idx ON s.t (c)", []string{"s.t"}},
+		{"ALTER VIEW v RENAME TO w", nil},
+		{"CREATE TABLE t (id INT)", nil},
+		{"INSERT INTO t VALUES (1)", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tt.query)
+			require.NoError(t, err)
+			var names []string
+			for _, tn := range ddlTargets(stmt.AST) {
+				name := tn.Table()
+				if tn.Schema() != "" {
+					name = tn.Schema() + "." + name
+				}
+				names = append(names, name)
+			}
+			require.Equal(t, tt.expected, names)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package pgserver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
+)
+
+// The diagnostic functions of the logical replication, which help debugging replication issues in the field:
+//
+//   - `SELECT myduck_flush_deltas()` forces the delta buffers of the running subscriptions to be flushed,
+//     and returns the number of bytes that were buffered.
+//   - `SELECT * FROM myduck_replication_state()` returns the replication state of the running subscriptions.
+//   - `SELECT * FROM myduck_replication_relations()` returns the relation schemas cached by the running subscriptions.
+//   - `SELECT * FROM myduck_replication_slots()` returns the replication slots of the subscriptions on the primaries,
+//     as of the last check of the slot monitor, see logrepl.SlotMonitor.
+//
+// They are evaluated by the server and substituted into the query, since DuckDB knows nothing about the replicators.
+
+// precompile a regex to match "select myduck_flush_deltas();"
+var myduckFlushDeltasRegex = regexp.MustCompile(`(?i)^\s*select\s+(pg_catalog\.)?myduck_flush_deltas\(\s*\)\s*;?\s*$`)
+
+// precompile a regex to match the table functions "myduck_replication_state()", "myduck_replication_relations()",
+// and "myduck_replication_slots()"
+var myduckReplicationFuncRegex = regexp.MustCompile(`(?i)\b(?:pg_catalog\.)?(myduck_replication_state|myduck_replication_relations|myduck_replication_slots)\(\s*\)`)
+
+// diagColumn is a column of the relation returned by a diagnostic table function.
+type diagColumn struct {
+	name string
+	typ  string
+}
+
+var replicationStateColumns = []diagColumn{
+	{"subscription", "VARCHAR"},
+	{"slot_name", "VARCHAR"},
+	{"last_written_lsn", "VARCHAR"},
+	{"last_received_lsn", "VARCHAR"},
+	{"last_commit_lsn", "VARCHAR"},
+	{"current_transaction_lsn", "VARCHAR"},
+	{"in_stream", "BOOLEAN"},
+	{"process_messages", "BOOLEAN"},
+	{"ongoing_batch_txn", "BOOLEAN"},
+	{"dirty_txn", "BOOLEAN"},
+	{"dirty_stream", "BOOLEAN"},
+	{"delta_buffer_size", "UBIGINT"},
+	{"commit_count", "UBIGINT"},
+	{"last_commit_time", "TIMESTAMPTZ"},
+	{"cached_relations", "INTEGER"},
+	{"sent_lsn", "VARCHAR"},
+	{"applied_lsn", "VARCHAR"},
+	{"lag_bytes", "UBIGINT"},
+	{"last_received_time", "TIMESTAMPTZ"},
+	{"apply_paused", "BOOLEAN"},
+}
+
+var replicationSlotColumns = []diagColumn{
+	{"subscription", "VARCHAR"},
+	{"slot_name", "VARCHAR"},
+	{"active", "BOOLEAN"},
+	{"restart_lsn", "VARCHAR"},
+	{"confirmed_flush_lsn", "VARCHAR"},
+	{"retained_bytes", "BIGINT"},
+	{"wal_status", "VARCHAR"},
+	{"checked_at", "TIMESTAMPTZ"},
+}
+
+var replicationRelationColumns = []diagColumn{
+	{"subscription", "VARCHAR"},
+	{"relation_id", "UINTEGER"},
+	{"schema_name", "VARCHAR"},
+	{"table_name", "VARCHAR"},
+	{"columns", "VARCHAR[]"},
+	{"key_columns", "VARCHAR[]"},
+}
+
+// diagRelation renders the rows as a subquery with typed columns, which has the columns even if there are no rows.
+// The values must already be SQL literals.
+func diagRelation(columns []diagColumn, rows [][]string) string {
+	var b strings.Builder
+	b.WriteString("(SELECT ")
+	for i, col := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, `NULL::%s AS "%s"`, col.typ, col.name)
+	}
+	b.WriteString(" WHERE false")
+	for _, row := range rows {
+		b.WriteString(" UNION ALL SELECT ")
+		for i, value := range row {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%s::%s", value, columns[i].typ)
+		}
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+func diagString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func diagStringList(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = diagString(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func replicationStateRelation(statuses []logrepl.ReplicationStatus) string {
+	rows := make([][]string, len(statuses))
+	for i, s := range statuses {
+		rows[i] = []string{
+			diagString(s.Subscription),
+			diagString(s.SlotName),
+			diagString(s.LastWrittenLSN.String()),
+			diagString(s.LastReceivedLSN.String()),
+			diagString(s.LastCommitLSN.String()),
+			diagString(s.CurrentTransactionLSN.String()),
+			strconv.FormatBool(s.InStream),
+			strconv.FormatBool(s.ProcessMessages),
+			strconv.FormatBool(s.OngoingBatchTxn),
+			strconv.FormatBool(s.DirtyTxn),
+			strconv.FormatBool(s.DirtyStream),
+			strconv.FormatUint(s.DeltaBufSize, 10),
+			strconv.FormatUint(s.CommitCount, 10),
+			diagString(s.LastCommitTime.UTC().Format(time.RFC3339Nano)),
+			strconv.Itoa(s.CachedRelations),
+			diagString(s.Progress.SentLSN.String()),
+			diagString(s.Progress.AppliedLSN.String()),
+			strconv.FormatUint(s.Progress.Lag(), 10),
+			diagString(s.Progress.ReceivedAt.UTC().Format(time.RFC3339Nano)),
+			strconv.FormatBool(s.ApplyPaused),
+		}
+	}
+	return diagRelation(replicationStateColumns, rows)
+}
+
+func replicationSlotsRelation(slots []logrepl.SlotState) string {
+	rows := make([][]string, len(slots))
+	for i, s := range slots {
+		rows[i] = []string{
+			diagString(s.Subscription),
+			diagString(s.SlotName),
+			strconv.FormatBool(s.Active),
+			diagString(s.RestartLSN.String()),
+			diagString(s.ConfirmedFlushLSN.String()),
+			strconv.FormatInt(s.RetainedBytes, 10),
+			diagString(s.WALStatus),
+			diagString(s.CheckedAt.UTC().Format(time.RFC3339Nano)),
+		}
+	}
+	return diagRelation(replicationSlotColumns, rows)
+}
+
+func replicationRelationsRelation(relations []logrepl.CachedRelation) string {
+	rows := make([][]string, len(relations))
+	for i, rel := range relations {
+		rows[i] = []string{
+			diagString(rel.Subscription),
+			strconv.FormatUint(uint64(rel.RelationID), 10),
+			diagString(rel.Namespace),
+			diagString(rel.RelationName),
+			diagStringList(rel.Columns),
+			diagStringList(rel.KeyColumns),
+		}
+	}
+	return diagRelation(replicationRelationColumns, rows)
+}
+
+// convertReplicationFuncs substitutes the results of the replication table functions into the query.
+func convertReplicationFuncs(query string) (string, error) {
+	var err error
+	converted := myduckReplicationFuncRegex.ReplaceAllStringFunc(query, func(call string) string {
+		if err != nil {
+			return call
+		}
+		name := strings.ToLower(myduckReplicationFuncRegex.FindStringSubmatch(call)[1])
+		switch name {
+		case "myduck_replication_state":
+			var statuses []logrepl.ReplicationStatus
+			if statuses, err = logrepl.ReplicationStatuses(); err == nil {
+				return replicationStateRelation(statuses)
+			}
+		case "myduck_replication_relations":
+			var relations []logrepl.CachedRelation
+			if relations, err = logrepl.ReplicationRelations(); err == nil {
+				return replicationRelationsRelation(relations)
+			}
+		case "myduck_replication_slots":
+			return replicationSlotsRelation(logrepl.ReplicationSlots())
+		}
+		return call
+	})
+	return converted, err
+}
+
+// flushDeltas forces the delta buffers of the running subscriptions to be flushed.
+func (h *ConnectionHandler) flushDeltas() (uint64, error) {
+	flushed, err := logrepl.FlushAllDeltas()
+	if err != nil {
+		h.logger.WithError(err).Warn("Failed to flush the replication deltas")
+	}
+	return flushed, err
+}
@@ -0,0 +1,120 @@
+package pgserver
+
+import (
+	stdsql "database/sql"
+	"testing"
+	"time"
+
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
+	"github.com/jackc/pglogrepl"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicationDiagnosticRelations(t *testing.T) {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	defer connector.Close()
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+
+	status := logrepl.ReplicationStatus{
+		Subscription:    "it's",
+		SlotName:        "slot",
+		LastWrittenLSN:  pglogrepl.LSN(0x16B3748),
+		LastReceivedLSN: pglogrepl.LSN(0x16B3800),
+		DirtyTxn:        true,
+		DeltaBufSize:    1 << 40,
+		CommitCount:     3,
+		LastCommitTime:  time.Date(2024, 11, 1, 8, 30, 0, 0, time.UTC),
+		CachedRelations: 1,
+		Progress: logrepl.ReplicationProgress{
+			SentLSN:    pglogrepl.LSN(0x16B3800),
+			AppliedLSN: pglogrepl.LSN(0x16B3748),
+			ReceivedAt: time.Date(2024, 11, 1, 8, 30, 1, 0, time.UTC),
+		},
+	}
+	relation := logrepl.CachedRelation{
+		Subscription: "it's",
+		RelationID:   16385,
+		Namespace:    "public",
+		RelationName: "items",
+		Columns:      []string{"id int4", "name text"},
+		KeyColumns:   []string{"id"},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected [][]any
+	}{
+		{
+			name:     "no subscriptions",
+			query:    "SELECT count(*), count(subscription) FROM " + replicationStateRelation(nil),
+			expected: [][]any{{int64(0), int64(0)}},
+		},
+		{
+			name:  "state",
+			query: "SELECT subscription, last_written_lsn, last_received_lsn, dirty_txn, in_stream, delta_buffer_size, commit_count, epoch(last_commit_time::TIMESTAMP), cached_relations FROM " + replicationStateRelation([]logrepl.ReplicationStatus{status}),
+			expected: [][]any{
+				{"it's", "0/16B3748", "0/16B3800", true, false, uint64(1 << 40), uint64(3), float64(1730449800), int32(1)},
+			},
+		},
+		{
+			name:     "progress",
+			query:    "SELECT sent_lsn, applied_lsn, lag_bytes, epoch(last_received_time::TIMESTAMP) FROM " + replicationStateRelation([]logrepl.ReplicationStatus{status}),
+			expected: [][]any{{"0/16B3800", "0/16B3748", uint64(0xB8), float64(1730449801)}},
+		},
+		{
+			name: "slots",
+			query: "SELECT subscription, restart_lsn, retained_bytes, wal_status FROM " + replicationSlotsRelation([]logrepl.SlotState{{
+				Subscription:  "it's",
+				SlotName:      "slot",
+				RestartLSN:    pglogrepl.LSN(0x16B3748),
+				RetainedBytes: 1 << 33,
+				WALStatus:     "extended",
+			}}),
+			expected: [][]any{{"it's", "0/16B3748", int64(1 << 33), "extended"}},
+		},
+		{
+			name:  "relations",
+			query: "SELECT relation_id, schema_name || '.' || table_name, array_to_string(columns, ', '), key_columns[1] FROM " + replicationRelationsRelation([]logrepl.CachedRelation{relation, relation}),
+			expected: [][]any{
+				{uint32(16385), "public.items", "id int4, name text", "id"},
+				{uint32(16385), "public.items", "id int4, name text", "id"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := db.Query(tt.query)
+			require.NoError(t, err)
+			defer rows.Close()
+			columns, err := rows.Columns()
+			require.NoError(t, err)
+			var got [][]any
+			for rows.Next() {
+				row := make([]any, len(columns))
+				ptrs := make([]any, len(columns))
+				for i := range row {
+					ptrs[i] = &row[i]
+				}
+				require.NoError(t, rows.Scan(ptrs...))
+				got = append(got, row)
+			}
+			require.NoError(t, rows.Err())
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestConvertReplicationFuncs(t *testing.T) {
+	// No subscription is running in the test.
+	converted, err := convertReplicationFuncs("SELECT slot_name FROM pg_catalog.MYDUCK_REPLICATION_STATE() s, myduck_replication_relations ( )")
+	require.NoError(t, err)
+	require.Equal(t, "SELECT slot_name FROM "+replicationStateRelation(nil)+" s, myduck_replication_relations ( )", converted)
+
+	converted, err = convertReplicationFuncs("SELECT * FROM myduck_replication_relations()")
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM "+replicationRelationsRelation(nil), converted)
+}
@@ -1,7 +1,9 @@
 package pgserver
 
 import (
+	"context"
 	"fmt"
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
 	"github.com/apecloud/myduckserver/storage"
 	"os"
 	"path/filepath"
@@ -22,6 +24,13 @@ import (
 //     ENDPOINT = 's3.cn-northwest-1.amazonaws.com.cn'
 //     ACCESS_KEY_ID = 'xxxxxxxxxxxxx'
 //     SECRET_ACCESS_KEY = 'xxxxxxxxxxxx'
+//
+// The restored database is attached as a catalog of its own. Its subscriptions are checked against their replication
+// slots on the primaries, and the result is reported along with the restore, but they are not started, since the
+// subscriptions of a catalog are replicated only while the server runs on it. A server started on a restored data
+// file, e.g., with --restore-file, reconciles the subscriptions before it starts them, see
+// logrepl.ReconcileSubscriptions. With --restore-resync, the subscriptions that cannot resume are resynced from new
+// snapshots instead of being disabled.
 
 type RestoreConfig struct {
 	DbName        string
@@ -102,7 +111,25 @@ func (h *ConnectionHandler) executeRestore(restoreConfig *RestoreConfig) (string
 	if err != nil {
 		return "", fmt.Errorf("failed to attach catalog: %w", err)
 	}
-	return msg, nil
+	return msg + h.checkRestoredSubscriptions(restoreConfig.DbName), nil
+}
+
+// checkRestoredSubscriptions reports whether the subscriptions of the restored catalog can resume from their slots.
+func (h *ConnectionHandler) checkRestoredSubscriptions(dbName string) string {
+	ctx, err := h.duckHandler.sm.NewContextWithQuery(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return fmt.Sprintf("\nfailed to check the restored subscriptions: %v", err)
+	}
+	results, err := logrepl.CheckRestoredSubscriptions(ctx, dbName)
+	if err != nil {
+		return fmt.Sprintf("\nfailed to check the restored subscriptions: %v", err)
+	}
+	var b strings.Builder
+	for _, rec := range results {
+		b.WriteString("\n")
+		b.WriteString(rec.String())
+	}
+	return b.String()
 }
 
 // ExecuteRestore downloads the specified file from the remote storage and restores it to the specified local directory.
@@ -0,0 +1,47 @@
+package pgserver
+
+import (
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// The formats of the columns of a result in the extended query mode are given by the result format codes of Bind:
+// none means text for all columns, one applies to all columns, or else one per column. The formats are reported
+// by the RowDescription of Describe on the portal and of Execute, and the DataRows are encoded in them.
+// Describe on a prepared statement reports text, since the formats are not known before Bind.
+
+// resultFormat returns the format of the i-th column of a result with the result format codes.
+func resultFormat(codes []int16, i int) int16 {
+	switch {
+	case len(codes) == 0:
+		return pgproto3.TextFormat
+	case len(codes) == 1:
+		return codes[0]
+	case i < len(codes):
+		return codes[i]
+	}
+	return pgproto3.TextFormat
+}
+
+// checkResultFormats returns an error if the result format codes of Bind are invalid for a result of the columns.
+func checkResultFormats(codes []int16, columns int) error {
+	for _, code := range codes {
+		if code != pgproto3.TextFormat && code != pgproto3.BinaryFormat {
+			return newPgError("22023", "unsupported format code: %d", code)
+		}
+	}
+	if len(codes) > 1 && len(codes) != columns {
+		return newPgError("08P01", "bind message has %d result formats but query has %d columns", len(codes), columns)
+	}
+	return nil
+}
+
+// withResultFormats returns the fields of a result in the formats of the result format codes.
+func withResultFormats(fields []pgproto3.FieldDescription, codes []int16) []pgproto3.FieldDescription {
+	fields = slices.Clone(fields)
+	for i := range fields {
+		fields[i].Format = resultFormat(codes, i)
+	}
+	return fields
+}
@@ -0,0 +1,31 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultFormats(t *testing.T) {
+	fields := []pgproto3.FieldDescription{{Name: []byte("a")}, {Name: []byte("b")}, {Name: []byte("c")}}
+	formats := func(fields []pgproto3.FieldDescription) []int16 {
+		var formats []int16
+		for _, f := range fields {
+			formats = append(formats, f.Format)
+		}
+		return formats
+	}
+
+	require.Equal(t, []int16{0, 0, 0}, formats(withResultFormats(fields, nil)))
+	require.Equal(t, []int16{1, 1, 1}, formats(withResultFormats(fields, []int16{1})))
+	require.Equal(t, []int16{1, 0, 1}, formats(withResultFormats(fields, []int16{1, 0, 1})))
+	// The fields of the prepared statement are left as they are.
+	require.Equal(t, []int16{0, 0, 0}, formats(fields))
+
+	require.NoError(t, checkResultFormats(nil, 3))
+	require.NoError(t, checkResultFormats([]int16{1}, 3))
+	require.NoError(t, checkResultFormats([]int16{0, 1, 1}, 3))
+	require.ErrorContains(t, checkResultFormats([]int16{0, 1}, 3), "bind message has 2 result formats but query has 3 columns")
+	require.ErrorContains(t, checkResultFormats([]int16{2}, 3), "unsupported format code: 2")
+}
@@ -0,0 +1,88 @@
+package pgserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxResultSizeParameter is the session parameter that limits the size of the result of a query in bytes,
+// as encoded in the DataRow messages. A query whose result exceeds the limit is terminated with an error
+// once the limit is reached, after the rows within the limit have been sent. `off` or 0 disables the limit,
+// and DEFAULT restores the limit of the server, see WithResultLimits.
+const MaxResultSizeParameter = "myduck.max_result_size"
+
+// maxBatchBytes bounds the size of a batch of rows passed to the callback of resultForDefaultIter,
+// in addition to rowsBatch, so that a batch of very wide rows is flushed early.
+const maxBatchBytes = 1 << 20
+
+var (
+	// defaultMaxResultSize is the limit of MaxResultSizeParameter of the sessions, or 0 for no limit.
+	defaultMaxResultSize uint64
+	// resultBufferSize is the size of the rows that are buffered in memory while the client is reading the result.
+	resultBufferSize int64 = 16 << 20
+	// resultSpill indicates whether the rows beyond resultBufferSize are spilled to a temporary file
+	// instead of pausing the query until the client catches up, see resultSpool.
+	resultSpill bool
+)
+
+// WithResultLimits sets the default limit of MaxResultSizeParameter, and the buffering of the results, see resultSpool.
+// The sizes are in bytes. A zero bufferSize keeps the default of 16 MiB.
+func WithResultLimits(maxResultSize uint64, bufferSize int64, spill bool) ListenerOpt {
+	return func(l *Listener) {
+		defaultMaxResultSize = maxResultSize
+		if bufferSize > 0 {
+			resultBufferSize = bufferSize
+		}
+		resultSpill = spill
+	}
+}
+
+// maxResultSize returns the limit of the size of the results of the session, or 0 for no limit.
+func (h *DuckHandler) maxResultSize() uint64 {
+	if h.resultLimit != nil {
+		return *h.resultLimit
+	}
+	return defaultMaxResultSize
+}
+
+// showMaxResultSize returns the value of MaxResultSizeParameter shown by SHOW.
+func (h *DuckHandler) showMaxResultSize() string {
+	if limit := h.maxResultSize(); limit > 0 {
+		return strconv.FormatUint(limit, 10)
+	}
+	return "off"
+}
+
+// setMaxResultSize handles `SET myduck.max_result_size = off|<bytes>`.
+func (h *ConnectionHandler) setMaxResultSize(value any, useDefault bool) error {
+	if useDefault {
+		h.duckHandler.resultLimit = nil
+		return nil
+	}
+	var limit uint64
+	if setting := strings.ToLower(strings.TrimSpace(fmt.Sprint(value))); setting != "off" {
+		var err error
+		if limit, err = strconv.ParseUint(setting, 10, 64); err != nil {
+			return newPgError("22023", `invalid value for parameter "%s": "%v"`, MaxResultSizeParameter, value)
+		}
+	}
+	h.duckHandler.resultLimit = &limit
+	return nil
+}
+
+// errResultTooLarge is returned when the result of a query exceeds the limit of MaxResultSizeParameter.
+func errResultTooLarge(limit uint64) error {
+	return newPgError("54000", // program_limit_exceeded
+		"the result of the query exceeds %d bytes, the limit of %s; add a LIMIT to the query or raise the limit",
+		limit, MaxResultSizeParameter)
+}
+
+// rowSize returns the size of an encoded row in a DataRow message.
+func rowSize(row [][]byte) int64 {
+	size := int64(2)
+	for _, v := range row {
+		size += 4 + int64(len(v))
+	}
+	return size
+}
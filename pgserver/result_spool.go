@@ -0,0 +1,192 @@
+package pgserver
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// resultSpool buffers the encoded rows of a result between the goroutine that reads them from DuckDB
+// and the one that sends them to the client, see resultForDefaultIter. Up to `limit` bytes of rows are kept
+// in memory. Beyond that, the reader either waits for the sender to catch up, or spills the rows to a temporary
+// file if `spill` is set, so that a slow client neither blows up the memory nor holds the DuckDB query open.
+// The rows are always returned in the order they are added.
+type resultSpool struct {
+	limit int64
+	spill bool
+
+	mu       sync.Mutex
+	rows     []spooledRow
+	head     int
+	memBytes int64
+	// file holds the spilled rows from readOff to writeOff. The rows are added to the file
+	// as long as it has unread rows, so that they stay in order.
+	file              *os.File
+	readOff, writeOff int64
+	spilledRows       int
+	spilledBytes      int64
+	closed            bool
+
+	// added is notified when a row is added or the spool is closed, and removed when a row is removed.
+	added   chan struct{}
+	removed chan struct{}
+}
+
+type spooledRow struct {
+	row  Row
+	size int64
+}
+
+func newResultSpool(limit int64, spill bool) *resultSpool {
+	return &resultSpool{
+		limit:   limit,
+		spill:   spill,
+		added:   make(chan struct{}, 1),
+		removed: make(chan struct{}, 1),
+	}
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// put adds a row of the given encoded size, waiting for room in memory if the spool does not spill.
+func (s *resultSpool) put(ctx context.Context, row Row, size int64) error {
+	for {
+		s.mu.Lock()
+		if s.spilledRows == 0 && (s.memBytes+size <= s.limit || s.head == len(s.rows)) {
+			s.rows = append(s.rows, spooledRow{row, size})
+			s.memBytes += size
+			s.mu.Unlock()
+			notify(s.added)
+			return nil
+		}
+		if s.spill {
+			err := s.spillRow(row)
+			s.mu.Unlock()
+			notify(s.added)
+			return err
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.removed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// next removes the first row without waiting. If there is none, it returns whether the spool is closed.
+func (s *resultSpool) next() (row Row, ok bool, closed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.head < len(s.rows) {
+		r := s.rows[s.head]
+		s.rows[s.head] = spooledRow{}
+		s.head++
+		s.memBytes -= r.size
+		if s.head == len(s.rows) {
+			s.rows, s.head = s.rows[:0], 0
+		}
+		notify(s.removed)
+		return r.row, true, false, nil
+	}
+	if s.spilledRows > 0 {
+		row, err = s.readSpilled()
+		return row, err == nil, false, err
+	}
+	return Row{}, false, s.closed, nil
+}
+
+// close marks the end of the rows.
+func (s *resultSpool) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	notify(s.added)
+}
+
+// release removes the temporary file, if any.
+func (s *resultSpool) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// The spilled rows are encoded as the total length, the number of the columns, and the columns,
+// each of which is its length (-1 for NULL) followed by its bytes.
+
+func (s *resultSpool) spillRow(row Row) error {
+	if s.file == nil {
+		f, err := os.CreateTemp("", "myduck-result-*")
+		if err != nil {
+			return fmt.Errorf("failed to create the spill file of the result: %w", err)
+		}
+		// The file is removed right away, so that it is deleted even if the server crashes.
+		os.Remove(f.Name())
+		s.file = f
+	}
+
+	size := 4
+	for _, v := range row.val {
+		size += 4 + len(v)
+	}
+	buf := make([]byte, 4, 4+size)
+	binary.BigEndian.PutUint32(buf, uint32(size))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(row.val)))
+	for _, v := range row.val {
+		if v == nil {
+			buf = binary.BigEndian.AppendUint32(buf, ^uint32(0))
+			continue
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(v)))
+		buf = append(buf, v...)
+	}
+	if _, err := s.file.WriteAt(buf, s.writeOff); err != nil {
+		return fmt.Errorf("failed to spill the result: %w", err)
+	}
+	s.writeOff += int64(len(buf))
+	s.spilledRows++
+	s.spilledBytes += int64(len(buf))
+	return nil
+}
+
+func (s *resultSpool) readSpilled() (Row, error) {
+	var header [4]byte
+	if _, err := s.file.ReadAt(header[:], s.readOff); err != nil {
+		return Row{}, fmt.Errorf("failed to read the spilled result: %w", err)
+	}
+	buf := make([]byte, binary.BigEndian.Uint32(header[:]))
+	if _, err := s.file.ReadAt(buf, s.readOff+4); err != nil && err != io.EOF {
+		return Row{}, fmt.Errorf("failed to read the spilled result: %w", err)
+	}
+	s.readOff += 4 + int64(len(buf))
+	s.spilledRows--
+	if s.spilledRows == 0 {
+		// The file is reused from the start once it is drained.
+		s.readOff, s.writeOff = 0, 0
+	}
+
+	row := Row{val: make([][]byte, binary.BigEndian.Uint32(buf))}
+	buf = buf[4:]
+	for i := range row.val {
+		n := binary.BigEndian.Uint32(buf)
+		buf = buf[4:]
+		if n == ^uint32(0) {
+			continue
+		}
+		row.val[i] = buf[:n:n]
+		buf = buf[n:]
+	}
+	return row, nil
+}
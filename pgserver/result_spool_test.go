@@ -0,0 +1,68 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultSpool(t *testing.T) {
+	ctx := context.Background()
+	rowOf := func(i int) Row {
+		if i%3 == 0 {
+			// NULLs and empty values must survive the spilling.
+			return Row{val: [][]byte{nil, {}, []byte(fmt.Sprint(i))}}
+		}
+		return Row{val: [][]byte{[]byte(fmt.Sprint(i)), []byte("x")}}
+	}
+
+	// The rows beyond the memory limit are spilled, and the rows are read in order.
+	spool := newResultSpool(20, true)
+	defer spool.release()
+	for i := 0; i < 10; i++ {
+		row := rowOf(i)
+		require.NoError(t, spool.put(ctx, row, rowSize(row.val)))
+		if i == 5 {
+			// Drain the spool partially while some rows are spilled.
+			for j := 0; j < 3; j++ {
+				got, ok, _, err := spool.next()
+				require.NoError(t, err)
+				require.True(t, ok)
+				require.Equal(t, rowOf(j), got)
+			}
+		}
+	}
+	require.Positive(t, spool.spilledBytes)
+	spool.close()
+	for i := 3; i < 10; i++ {
+		got, ok, _, err := spool.next()
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, rowOf(i), got)
+	}
+	_, ok, closed, err := spool.next()
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.True(t, closed)
+
+	// Without spilling, put waits until there is room in memory.
+	spool = newResultSpool(20, false)
+	defer spool.release()
+	row := rowOf(1)
+	require.NoError(t, spool.put(ctx, row, 15))
+	done := make(chan error)
+	go func() { done <- spool.put(ctx, row, 15) }()
+	select {
+	case <-done:
+		t.Fatal("put did not wait for room in memory")
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, ok, _, err = spool.next()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, <-done)
+	require.Zero(t, spool.spilledBytes)
+}
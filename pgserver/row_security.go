@@ -0,0 +1,503 @@
+package pgserver
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The row-level security of the tables, see catalog/row_security.go, is managed by the statements of PostgreSQL:
+//
+//	ALTER TABLE name {ENABLE | DISABLE | FORCE | NO FORCE} ROW LEVEL SECURITY
+//	CREATE POLICY name ON table [AS {PERMISSIVE | RESTRICTIVE}] [FOR {ALL | SELECT | INSERT | UPDATE | DELETE}]
+//	    [TO role, ...] [USING (expr)] [WITH CHECK (expr)]
+//	DROP POLICY [IF EXISTS] name ON table
+//
+// They are allowed for the owners of the table, i.e., the superusers, whose MySQL account has SUPER, and the users
+// whose MySQL account has ALTER on the table. The owners bypass the policies unless the row-level security is forced,
+// except the superusers, who always bypass them.
+//
+// The policies are enforced by rewriting the statements before they are run by DuckDB: a restricted table read by
+// a query is replaced with `(SELECT * FROM table WHERE predicate) AS table`, and the predicate is added to the WHERE
+// clause of an UPDATE or a DELETE of the table. The statements that cannot be rewritten, i.e., the ones that cannot
+// be parsed, and COPY TO, are refused if they read a restricted table; so are the table functions such as
+// query_table, and the other table sources that are not tables, for the users with restricted tables. The names of
+// the common table expressions shadow the tables only within their statements. Like in PostgreSQL, the views read
+// the tables with the privileges of their owner. The new rows of INSERT and UPDATE are not checked, so the policies
+// FOR INSERT and the WITH CHECK expressions are refused.
+
+var (
+	alterRowSecurityRegex = regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?(` + identifierPattern +
+		`(?:\s*\.\s*` + identifierPattern + `)?)\s+(ENABLE|DISABLE|FORCE|NO\s+FORCE)\s+ROW\s+LEVEL\s+SECURITY[\s;]*$`)
+	createPolicyRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+POLICY\s+(` + identifierPattern + `)\s+ON\s+(` + identifierPattern +
+		`(?:\s*\.\s*` + identifierPattern + `)?)(?:\s+AS\s+(PERMISSIVE|RESTRICTIVE))?(?:\s+FOR\s+(ALL|SELECT|INSERT|UPDATE|DELETE))?` +
+		`(?:\s+TO\s+(.+?))?(?:\s+USING\s*\((.+?)\))?(?:\s+WITH\s+CHECK\s*\((.+?)\))?[\s;]*$`)
+	dropPolicyRegex = regexp.MustCompile(`(?is)^\s*DROP\s+POLICY\s+(IF\s+EXISTS\s+)?(` + identifierPattern + `)\s+ON\s+(` +
+		identifierPattern + `(?:\s*\.\s*` + identifierPattern + `)?)(?:\s+(?:CASCADE|RESTRICT))?[\s;]*$`)
+	policyRoleRegex = regexp.MustCompile(`^` + identifierPattern + `$`)
+)
+
+// isRowSecurityDDL reports whether the query manages the row-level security.
+func isRowSecurityDDL(query string) bool {
+	return alterRowSecurityRegex.MatchString(query) || createPolicyRegex.MatchString(query) || dropPolicyRegex.MatchString(query)
+}
+
+// handleRowSecurityDDL executes a statement that manages the row-level security, and returns its command tag.
+func (h *ConnectionHandler) handleRowSecurityDDL(query string) (string, error) {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, query)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case alterRowSecurityRegex.MatchString(query):
+		m := alterRowSecurityRegex.FindStringSubmatch(query)
+		schema, table, err := h.rowSecurityTable(ctx, m[1])
+		if err != nil {
+			return "", err
+		}
+		var enabled, forced *bool
+		switch action := strings.ToUpper(strings.Join(strings.Fields(m[2]), " ")); action {
+		case "ENABLE", "DISABLE":
+			v := action == "ENABLE"
+			enabled = &v
+		default:
+			v := action == "FORCE"
+			forced = &v
+		}
+		return "ALTER TABLE", catalog.SetRowSecurity(ctx, schema, table, ctx.Session.Client().User, enabled, forced)
+
+	case createPolicyRegex.MatchString(query):
+		m := createPolicyRegex.FindStringSubmatch(query)
+		schema, table, err := h.rowSecurityTable(ctx, m[2])
+		if err != nil {
+			return "", err
+		}
+		if strings.EqualFold(m[4], catalog.PolicyCommandInsert) || m[7] != "" {
+			return "", newPgError("0A000", "policies that check the new rows are not supported")
+		}
+		p := &catalog.RowSecurityPolicy{
+			Schema:     schema,
+			Table:      table,
+			Name:       unquoteIdentifier(m[1]),
+			Permissive: !strings.EqualFold(m[3], "RESTRICTIVE"),
+			Command:    catalog.PolicyCommandAll,
+			Roles:      []string{catalog.PolicyRolePublic},
+			Using:      strings.TrimSpace(m[6]),
+		}
+		if m[4] != "" {
+			p.Command = strings.ToUpper(m[4])
+		}
+		if m[5] != "" {
+			p.Roles = nil
+			for _, role := range strings.Split(m[5], ",") {
+				role = strings.TrimSpace(role)
+				if !policyRoleRegex.MatchString(role) {
+					return "", newPgError("42601", `syntax error at or near "%s"`, role)
+				}
+				switch role = unquoteIdentifier(role); role {
+				case "current_user", "current_role", "session_user":
+					role = ctx.Session.Client().User
+				}
+				p.Roles = append(p.Roles, role)
+			}
+		}
+		if err := catalog.CreateRowSecurityPolicy(ctx, p); err != nil {
+			return "", err
+		}
+		return "CREATE POLICY", nil
+
+	default:
+		m := dropPolicyRegex.FindStringSubmatch(query)
+		schema, table, err := h.rowSecurityTable(ctx, m[3])
+		if err != nil {
+			return "", err
+		}
+		name := unquoteIdentifier(m[2])
+		dropped, err := catalog.DropRowSecurityPolicy(ctx, schema, table, name)
+		if err != nil {
+			return "", err
+		}
+		if !dropped && m[1] == "" {
+			return "", newPgError("42704", `policy "%s" for table "%s" does not exist`, name, table)
+		}
+		return "DROP POLICY", nil
+	}
+}
+
+// rowSecurityTable resolves the name of a table whose row-level security is managed by the user of the session,
+// and returns an error if the user does not own the table.
+func (h *ConnectionHandler) rowSecurityTable(ctx *sql.Context, name string) (schema, table string, err error) {
+	tn, err := parser.ParseQualifiedTableName(name)
+	if err != nil {
+		return "", "", err
+	}
+	schema, table = tn.Schema(), tn.Table()
+	if schema == "" {
+		schema = adapter.GetCurrentSchema(ctx)
+	}
+	if !h.ownsTable(ctx, schema, table) {
+		return "", "", newPgError("42501", "must be owner of table %s", table)
+	}
+	return schema, table, nil
+}
+
+// ownsTable reports whether the user of the session owns a table, i.e., is a superuser,
+// or its MySQL account has ALTER on the table. The other users that have no MySQL account own no table.
+func (h *ConnectionHandler) ownsTable(ctx *sql.Context, schema, table string) bool {
+	subject := sql.PrivilegeCheckSubject{Database: schema, Table: table}
+	return backend.HasPrivilege(ctx, h.duckHandler.e.Analyzer.Catalog.MySQLDb, subject, sql.PrivilegeType_Alter)
+}
+
+// protectedTables returns the lower-cased schemas and names of the tables whose rows are restricted
+// for the user of the session.
+func (h *ConnectionHandler) protectedTables(ctx *sql.Context, rs *catalog.RowSecurity) [][2]string {
+	if h.isSuperuser(ctx) {
+		return nil
+	}
+	return rs.ProtectedTables(func(schema, table string) bool {
+		return h.ownsTable(ctx, schema, table)
+	})
+}
+
+// isSuperuser reports whether the user of the session is a superuser, see backend.IsSuperuser.
+func (h *ConnectionHandler) isSuperuser(ctx *sql.Context) bool {
+	return backend.IsSuperuser(ctx, h.duckHandler.e.Analyzer.Catalog.MySQLDb)
+}
+
+// applyRowSecurity rewrites a statement to read and change only the rows of the tables that its user may access,
+// and the query profiles of its user only, see restrictsQueryProfiles.
+func (h *ConnectionHandler) applyRowSecurity(statement *ConvertedStatement) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, statement.String)
+	if err != nil {
+		return err
+	}
+	rs, err := catalog.LoadRowSecurity(ctx)
+	if err != nil {
+		return err
+	}
+	tables := h.protectedTables(ctx, rs)
+	profiles := h.restrictsQueryProfiles(ctx, statement.String)
+	if len(tables) == 0 && !profiles {
+		return nil
+	}
+	if !statement.PgParsable || statement.AST == nil {
+		if profiles {
+			return refuseQueryProfiles()
+		}
+		return refuseRowSecurity(statement.String, tables)
+	}
+	if _, ok := statement.AST.(*tree.CreateView); ok && profiles {
+		// The views read the relations with the privileges of their owner, see rowSecurityRewriter.statement.
+		return refuseQueryProfiles()
+	}
+
+	user := ctx.Session.Client().User
+	rw := newRowSecurityRewriter(adapter.GetCurrentSchema(ctx), func(schema, table, command string) (string, bool) {
+		if profiles && catalog.IsQueryProfileRelation(table) {
+			return catalog.QueryProfilePredicate(user), true
+		}
+		if !slices.Contains(tables, [2]string{strings.ToLower(schema), strings.ToLower(table)}) {
+			return "", false
+		}
+		return rs.Predicate(schema, table, command, user)
+	})
+	rw.statement(statement.AST)
+	if rw.err != nil || !rw.changed {
+		return rw.err
+	}
+	statement.String = tree.AsString(statement.AST)
+	return nil
+}
+
+// checkRowSecurity returns an error if a statement that is not rewritten, e.g., COPY TO, reads a table
+// whose rows are restricted for the user of the session.
+func (h *ConnectionHandler) checkRowSecurity(ctx *sql.Context, query string) error {
+	rs, err := catalog.LoadRowSecurity(ctx)
+	if err != nil {
+		return err
+	}
+	if h.restrictsQueryProfiles(ctx, query) {
+		return refuseQueryProfiles()
+	}
+	return refuseRowSecurity(query, h.protectedTables(ctx, rs))
+}
+
+// refuseRowSecurity returns an error if a statement that cannot be rewritten reads a restricted table.
+func refuseRowSecurity(query string, tables [][2]string) error {
+	for _, table := range tables {
+		if mentionsName(query, table[1]) {
+			return newPgError("42501", "row-level security of table %s cannot be applied to the statement", table[1])
+		}
+	}
+	return nil
+}
+
+// mentionsName reports whether a lower-cased name appears as a word in a query.
+func mentionsName(query, name string) bool {
+	lower := strings.ToLower(query)
+	return strings.Contains(lower, name) && regexp.MustCompile(`\b`+regexp.QuoteMeta(name)+`\b`).MatchString(lower)
+}
+
+// rowSecurityRewriter injects the predicates of the row-level security into a statement in place.
+type rowSecurityRewriter struct {
+	schema string // the current schema
+	// predicateOf returns the predicate of the rows of a table that a command may access, see catalog.RowSecurity.
+	predicateOf func(schema, table, command string) (string, bool)
+	// ctes are the scopes of the names of the common table expressions, which are not tables, innermost last.
+	ctes    []map[string]struct{}
+	changed bool
+	err     error
+}
+
+func newRowSecurityRewriter(schema string, predicateOf func(schema, table, command string) (string, bool)) *rowSecurityRewriter {
+	return &rowSecurityRewriter{schema: schema, predicateOf: predicateOf}
+}
+
+// isCTE reports whether a name refers to a common table expression in scope.
+func (rw *rowSecurityRewriter) isCTE(name string) bool {
+	name = strings.ToLower(name)
+	for _, scope := range rw.ctes {
+		if _, ok := scope[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// scoped runs f within a new scope of the names of the common table expressions,
+// i.e., the ones of the WITH clause of a statement are invisible outside of it.
+func (rw *rowSecurityRewriter) scoped(f func()) {
+	rw.ctes = append(rw.ctes, make(map[string]struct{}))
+	defer func() { rw.ctes = rw.ctes[:len(rw.ctes)-1] }()
+	f()
+}
+
+func (rw *rowSecurityRewriter) statement(stmt tree.Statement) {
+	switch s := stmt.(type) {
+	case *tree.Select:
+		rw.selectStatement(s)
+	case *tree.ParenSelect:
+		rw.selectStatement(s.Select)
+	case *tree.Insert:
+		rw.scoped(func() {
+			rw.with(s.With)
+			rw.selectStatement(s.Rows)
+		})
+	case *tree.Update:
+		rw.scoped(func() {
+			rw.with(s.With)
+			s.Table = rw.target(s.Table, catalog.PolicyCommandUpdate, &s.Where)
+			for _, e := range s.Exprs {
+				e.Expr = rw.expr(e.Expr)
+			}
+			for i, t := range s.From {
+				s.From[i] = rw.tableExpr(t)
+			}
+			if s.Where != nil {
+				s.Where.Expr = rw.expr(s.Where.Expr)
+			}
+		})
+	case *tree.Delete:
+		rw.scoped(func() {
+			rw.with(s.With)
+			s.Table = rw.target(s.Table, catalog.PolicyCommandDelete, &s.Where)
+			for i, t := range s.Using {
+				s.Using[i] = rw.tableExpr(t)
+			}
+			if s.Where != nil {
+				s.Where.Expr = rw.expr(s.Where.Expr)
+			}
+		})
+	case *tree.CreateTable:
+		rw.selectStatement(s.AsSource)
+	case *tree.CreateView:
+		// The views read the tables with the privileges of their owner.
+	}
+}
+
+// with rewrites the common table expressions, and adds their names to the current scope.
+// A name is added after its body is rewritten, so that a body reading a table of the same name is restricted;
+// only the recursive term of a recursive one refers to itself.
+func (rw *rowSecurityRewriter) with(with *tree.With) {
+	if with == nil {
+		return
+	}
+	scope := rw.ctes[len(rw.ctes)-1]
+	for _, cte := range with.CTEList {
+		name := strings.ToLower(string(cte.Name.Alias))
+		if union, ok := recursiveUnion(with, cte); ok {
+			rw.selectStatement(union.Left)
+			scope[name] = struct{}{}
+			rw.selectStatement(union.Right)
+			continue
+		}
+		rw.statement(cte.Stmt)
+		scope[name] = struct{}{}
+	}
+}
+
+// recursiveUnion returns the UNION of the non-recursive and the recursive terms of a recursive common table expression.
+func recursiveUnion(with *tree.With, cte *tree.CTE) (*tree.UnionClause, bool) {
+	if !with.Recursive {
+		return nil, false
+	}
+	s, ok := cte.Stmt.(*tree.Select)
+	if !ok || s.With != nil {
+		return nil, false
+	}
+	union, ok := s.Select.(*tree.UnionClause)
+	return union, ok
+}
+
+func (rw *rowSecurityRewriter) selectStatement(s *tree.Select) {
+	if s == nil {
+		return
+	}
+	rw.scoped(func() {
+		rw.with(s.With)
+		rw.selectClause(s.Select)
+	})
+}
+
+func (rw *rowSecurityRewriter) selectClause(s tree.SelectStatement) {
+	switch s := s.(type) {
+	case *tree.ParenSelect:
+		rw.selectStatement(s.Select)
+	case *tree.UnionClause:
+		rw.selectStatement(s.Left)
+		rw.selectStatement(s.Right)
+	case *tree.ValuesClause:
+		for _, row := range s.Rows {
+			for i, e := range row {
+				row[i] = rw.expr(e)
+			}
+		}
+	case *tree.SelectClause:
+		for i, t := range s.From.Tables {
+			s.From.Tables[i] = rw.tableExpr(t)
+		}
+		for i := range s.Exprs {
+			s.Exprs[i].Expr = rw.expr(s.Exprs[i].Expr)
+		}
+		if s.Where != nil {
+			s.Where.Expr = rw.expr(s.Where.Expr)
+		}
+		if s.Having != nil {
+			s.Having.Expr = rw.expr(s.Having.Expr)
+		}
+	}
+}
+
+func (rw *rowSecurityRewriter) tableExpr(e tree.TableExpr) tree.TableExpr {
+	switch e := e.(type) {
+	case *tree.TableName:
+		if pred := rw.predicate(e, catalog.PolicyCommandSelect); pred != nil {
+			return &tree.AliasedTableExpr{Expr: restrictedTable(e, pred), As: tree.AliasClause{Alias: e.ObjectName}}
+		}
+	case *tree.AliasedTableExpr:
+		if tn, ok := e.Expr.(*tree.TableName); ok {
+			if pred := rw.predicate(tn, catalog.PolicyCommandSelect); pred != nil {
+				e.Expr = restrictedTable(tn, pred)
+				if e.As.Alias == "" {
+					e.As.Alias = tn.ObjectName
+				}
+			}
+		} else {
+			e.Expr = rw.tableExpr(e.Expr)
+		}
+	case *tree.ParenTableExpr:
+		e.Expr = rw.tableExpr(e.Expr)
+	case *tree.JoinTableExpr:
+		e.Left = rw.tableExpr(e.Left)
+		e.Right = rw.tableExpr(e.Right)
+		if cond, ok := e.Cond.(*tree.OnJoinCond); ok {
+			cond.Expr = rw.expr(cond.Expr)
+		}
+	case *tree.Subquery:
+		rw.selectClause(e.Select)
+	default:
+		// The table functions, e.g., query_table('t'), and the statement sources read the tables by the names
+		// that cannot be resolved here.
+		rw.err = newPgError("42501", "row-level security cannot be applied to the table source %s", tree.AsString(e))
+	}
+	return e
+}
+
+// target adds the predicate of a command to the WHERE clause of an UPDATE or a DELETE of a restricted table.
+func (rw *rowSecurityRewriter) target(e tree.TableExpr, command string, where **tree.Where) tree.TableExpr {
+	tn, ok := e.(*tree.TableName)
+	if aliased, isAliased := e.(*tree.AliasedTableExpr); isAliased {
+		tn, ok = aliased.Expr.(*tree.TableName)
+	}
+	if !ok {
+		return e
+	}
+	pred := rw.predicate(tn, command)
+	if pred == nil {
+		return e
+	}
+	if *where == nil {
+		*where = tree.NewWhere(tree.AstWhere, pred)
+	} else {
+		(*where).Expr = &tree.AndExpr{Left: &tree.ParenExpr{Expr: (*where).Expr}, Right: &tree.ParenExpr{Expr: pred}}
+	}
+	return e
+}
+
+// expr rewrites the subqueries of an expression.
+func (rw *rowSecurityRewriter) expr(e tree.Expr) tree.Expr {
+	if e == nil {
+		return nil
+	}
+	newExpr, err := tree.SimpleVisit(e, func(e tree.Expr) (bool, tree.Expr, error) {
+		if sq, ok := e.(*tree.Subquery); ok {
+			rw.selectClause(sq.Select)
+			return false, e, nil
+		}
+		return true, e, nil
+	})
+	if err != nil {
+		rw.err = err
+		return e
+	}
+	return newExpr
+}
+
+// predicate returns the predicate of the rows of a table that a command of the user may access,
+// or nil if the table is not restricted.
+func (rw *rowSecurityRewriter) predicate(tn *tree.TableName, command string) tree.Expr {
+	schema := rw.schema
+	if tn.ExplicitSchema {
+		schema = tn.Schema()
+	} else if rw.isCTE(tn.Table()) {
+		return nil
+	}
+	text, ok := rw.predicateOf(schema, tn.Table(), command)
+	if !ok {
+		return nil
+	}
+	pred, err := parser.ParseExpr(text)
+	if err != nil {
+		rw.err = newPgError("42601", "invalid row-level security policy of table %s: %v", tn.Table(), err)
+		return nil
+	}
+	rw.changed = true
+	return pred
+}
+
+// restrictedTable returns the subquery that reads the rows of a table that satisfy a predicate.
+func restrictedTable(tn *tree.TableName, pred tree.Expr) *tree.Subquery {
+	return &tree.Subquery{Select: &tree.ParenSelect{Select: &tree.Select{Select: &tree.SelectClause{
+		Exprs: tree.SelectExprs{tree.StarSelectExpr()},
+		From:  tree.From{Tables: tree.TableExprs{tn}},
+		Where: tree.NewWhere(tree.AstWhere, pred),
+	}}}}
+}
@@ -0,0 +1,105 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowSecurityRewriter(t *testing.T) {
+	predicateOf := func(schema, table, command string) (string, bool) {
+		if schema != "public" || table != "accounts" {
+			return "", false
+		}
+		if command == "SELECT" {
+			return "(owner = 'alice')", true
+		}
+		return "false", true
+	}
+	for query, expected := range map[string]string{
+		"SELECT * FROM accounts":                                       "SELECT * FROM (SELECT * FROM accounts WHERE (owner = 'alice')) AS accounts",
+		"SELECT a.id FROM accounts AS a JOIN t ON a.id = t.id":         "SELECT a.id FROM (SELECT * FROM accounts WHERE (owner = 'alice')) AS a JOIN t ON a.id = t.id",
+		"SELECT * FROM t WHERE id IN (SELECT id FROM public.accounts)": "SELECT * FROM t WHERE id IN (SELECT id FROM (SELECT * FROM public.accounts WHERE (owner = 'alice')) AS accounts)",
+		"UPDATE accounts SET balance = 0 WHERE id = $1":                "UPDATE accounts SET balance = 0 WHERE (id = $1) AND (false)",
+		"DELETE FROM accounts":                                         "DELETE FROM accounts WHERE false",
+		"INSERT INTO t SELECT * FROM accounts":                         "INSERT INTO t SELECT * FROM (SELECT * FROM accounts WHERE (owner = 'alice')) AS accounts",
+		"CREATE TABLE t2 AS SELECT * FROM accounts":                    "CREATE TABLE t2 AS SELECT * FROM (SELECT * FROM accounts WHERE (owner = 'alice')) AS accounts",
+		// The body of a common table expression reads the table of the same name.
+		"WITH accounts AS (SELECT * FROM accounts) SELECT * FROM accounts": "WITH accounts AS (SELECT * FROM (SELECT * FROM accounts WHERE (owner = 'alice')) AS accounts) SELECT * FROM accounts",
+		// A common table expression is invisible outside of its statement.
+		"(WITH accounts AS (SELECT 1) SELECT 1) UNION SELECT * FROM accounts":                                                         "(WITH accounts AS (SELECT 1) SELECT 1) UNION SELECT * FROM (SELECT * FROM accounts WHERE (owner = 'alice')) AS accounts",
+		"SELECT * FROM t WHERE id IN (WITH accounts AS (SELECT 1 AS id) SELECT id FROM accounts) AND id IN (SELECT id FROM accounts)": "SELECT * FROM t WHERE (id IN (WITH accounts AS (SELECT 1 AS id) SELECT id FROM accounts)) AND (id IN (SELECT id FROM (SELECT * FROM accounts WHERE (owner = 'alice')) AS accounts))",
+		// Only the recursive term of a recursive common table expression refers to itself.
+		"WITH RECURSIVE accounts AS (SELECT id FROM accounts UNION ALL SELECT id + 1 FROM accounts WHERE id < 3) SELECT * FROM accounts": "WITH RECURSIVE accounts AS (SELECT id FROM (SELECT * FROM accounts WHERE (owner = 'alice')) AS accounts UNION ALL SELECT id + 1 FROM accounts WHERE id < 3) SELECT * FROM accounts",
+	} {
+		stmt, err := parser.ParseOne(query)
+		require.NoError(t, err)
+		rw := newRowSecurityRewriter("public", predicateOf)
+		rw.statement(stmt.AST)
+		require.NoError(t, rw.err)
+		require.True(t, rw.changed, query)
+		require.Equal(t, expected, tree.AsString(stmt.AST))
+	}
+
+	for _, query := range []string{
+		"SELECT * FROM t",
+		"SELECT * FROM other.accounts",
+		"WITH accounts AS (SELECT 1 AS id) SELECT * FROM accounts",
+	} {
+		stmt, err := parser.ParseOne(query)
+		require.NoError(t, err)
+		rw := newRowSecurityRewriter("public", predicateOf)
+		rw.statement(stmt.AST)
+		require.NoError(t, rw.err)
+		require.False(t, rw.changed, query)
+	}
+
+	// The table sources other than the tables cannot be rewritten.
+	for _, query := range []string{
+		"SELECT * FROM query_table('accounts')",
+		"SELECT * FROM t JOIN query_table('accounts') AS a ON t.id = a.id",
+		"SELECT * FROM t WHERE id IN (SELECT id FROM query('SELECT * FROM accounts'))",
+	} {
+		stmt, err := parser.ParseOne(query)
+		require.NoError(t, err)
+		rw := newRowSecurityRewriter("public", predicateOf)
+		rw.statement(stmt.AST)
+		require.Error(t, rw.err, query)
+	}
+}
+
+func TestRowSecurityDDL(t *testing.T) {
+	m := createPolicyRegex.FindStringSubmatch(`CREATE POLICY "own rows" ON public.accounts AS RESTRICTIVE FOR SELECT TO alice, PUBLIC USING (owner = current_user AND id IN (1, 2)) WITH CHECK (id > 0);`)
+	require.NotNil(t, m)
+	require.Equal(t, []string{`"own rows"`, "public.accounts", "RESTRICTIVE", "SELECT", "alice, PUBLIC", "owner = current_user AND id IN (1, 2)", "id > 0"}, m[1:])
+
+	m = createPolicyRegex.FindStringSubmatch("create policy p on accounts using (owner = current_user)")
+	require.NotNil(t, m)
+	require.Equal(t, []string{"p", "accounts", "", "", "", "owner = current_user", ""}, m[1:])
+
+	m = alterRowSecurityRegex.FindStringSubmatch("ALTER TABLE IF EXISTS ONLY accounts NO FORCE ROW LEVEL SECURITY")
+	require.Equal(t, []string{"accounts", "NO FORCE"}, m[1:])
+
+	m = dropPolicyRegex.FindStringSubmatch("DROP POLICY IF EXISTS p ON s.accounts CASCADE")
+	require.Equal(t, []string{"IF EXISTS ", "p", "s.accounts"}, m[1:])
+
+	require.False(t, isRowSecurityDDL("ALTER TABLE accounts ADD COLUMN c INT"))
+}
+
+func TestQueryProfileReadRegex(t *testing.T) {
+	for query, want := range map[string]bool{
+		"SELECT * FROM __sys__.query_profiles":                         true,
+		"/* comment */ SELECT plan FROM Query_Profile_Log":             true,
+		"SELECT * FROM \"query_profiles\"":                             true,
+		"SELECT * FROM query_table('__sys__.' || 'query_profile_log')": true,
+		"SELECT * FROM query /* comment */ ('SELECT 1')":               true,
+		"SELECT * FROM \"query\"('SELECT 1')":                          true,
+		"SELECT query FROM logs":                                       false,
+		"SELECT * FROM query_profiles_archive":                         false,
+		"SET myduck.profiling = on":                                    false,
+	} {
+		require.Equal(t, want, queryProfileReadRegex.MatchString(query), query)
+	}
+}
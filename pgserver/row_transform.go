@@ -0,0 +1,146 @@
+package pgserver
+
+import (
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/apecloud/myduckserver/delta"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// The filters and the transforms of the rows of the replicated tables, see catalog.RowFilterParam:
+//
+//   - `ALTER TABLE t SET (row_filter = 'tenant_id = 42')` keeps the replicated rows of `t` of the tenant only.
+//   - `ALTER TABLE t SET (row_transform = 'email = NULL, phone = md5(phone)')` masks the columns of the replicated rows.
+//   - `ALTER TABLE t RESET (row_filter, row_transform)` removes them.
+//
+// They apply to the changes flushed after they are set. The rows already in the table are left as they are.
+
+// isRowTransformAlterTable reports whether the statement only changes the filter or the transform of a table.
+func isRowTransformAlterTable(stmt tree.Statement) bool {
+	return isStorageParamsAlterTable(stmt, catalog.RowFilterParam, catalog.RowTransformParam)
+}
+
+// alterTableRowTransform sets or resets the filter and the transform of a table.
+func (h *ConnectionHandler) alterTableRowTransform(alter *tree.AlterTable) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	schema, table, err := h.resolveHistoryTarget(ctx, alter.Table.String())
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if alter.IfExists && errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+			return nil
+		}
+		return err
+	}
+
+	var filter, columns stdsql.NullString
+	if err := adapter.QueryRowCatalog(ctx,
+		catalog.InternalTables.RowTransforms.SelectColumnsStmt([]string{"row_filter", "column_exprs"}),
+		schema, table.Name(),
+	).Scan(&filter, &columns); err != nil && !errors.Is(err, stdsql.ErrNoRows) {
+		return err
+	}
+	transform := &delta.RowTransform{Filter: filter.String}
+	if columns.Valid {
+		if err := json.Unmarshal([]byte(columns.String), &transform.Columns); err != nil {
+			return err
+		}
+	}
+	for _, cmd := range alter.Cmds {
+		switch cmd := cmd.(type) {
+		case *tree.AlterTableSetStorageParams:
+			for _, param := range cmd.StorageParams {
+				value := storageParamValue(param)
+				if strings.EqualFold(string(param.Key), catalog.RowFilterParam) {
+					transform.Filter = strings.TrimSpace(value)
+				} else if transform.Columns, err = parseRowTransform(table, value); err != nil {
+					return err
+				}
+			}
+		case *tree.AlterTableResetStorageParams:
+			for _, name := range cmd.Params {
+				if strings.EqualFold(string(name), catalog.RowFilterParam) {
+					transform.Filter = ""
+				} else {
+					transform.Columns = nil
+				}
+			}
+		}
+	}
+
+	if transform.Filter == "" && len(transform.Columns) == 0 {
+		_, err := adapter.ExecCatalog(ctx, catalog.InternalTables.RowTransforms.DeleteStmt(), schema, table.Name())
+		return err
+	}
+	// The expressions are evaluated by DuckDB, so they are checked against the table by DuckDB as well.
+	check := transform.Apply("SELECT * FROM "+catalog.ConnectIdentifiersANSI(schema, table.Name()), table.Schema()) + " LIMIT 0"
+	rows, err := adapter.QueryCatalog(ctx, check)
+	if err != nil {
+		return newPgError("22023", "invalid row filter or transform of relation \"%s\": %v", table.Name(), err)
+	}
+	rows.Close()
+
+	filter = stdsql.NullString{String: transform.Filter, Valid: transform.Filter != ""}
+	columns = stdsql.NullString{}
+	if len(transform.Columns) > 0 {
+		b, err := json.Marshal(transform.Columns)
+		if err != nil {
+			return err
+		}
+		columns = stdsql.NullString{String: string(b), Valid: true}
+	}
+	_, err = adapter.ExecCatalog(ctx, catalog.InternalTables.RowTransforms.UpsertStmt(), schema, table.Name(), filter, columns)
+	return err
+}
+
+// parseRowTransform parses the assignments of a transform, e.g., 'email = NULL, phone = md5(phone)',
+// into the expressions of the columns of the table.
+func parseRowTransform(table sql.Table, transform string) (map[string]string, error) {
+	invalid := newPgError("22023", `invalid value for parameter "%s": "%s"`, catalog.RowTransformParam, transform)
+	if strings.TrimSpace(transform) == "" {
+		return nil, nil
+	}
+	stmt, err := parser.ParseOne("UPDATE t SET " + transform)
+	if err != nil {
+		return nil, invalid
+	}
+	update, ok := stmt.AST.(*tree.Update)
+	if !ok || update.Where != nil || len(update.OrderBy) > 0 || update.Limit != nil || len(update.From) > 0 {
+		return nil, invalid
+	}
+	if _, ok := update.Returning.(*tree.NoReturningClause); !ok && update.Returning != nil {
+		return nil, invalid
+	}
+
+	columns := make(map[string]string, len(update.Exprs))
+	for _, expr := range update.Exprs {
+		if expr.Tuple || len(expr.Names) != 1 {
+			return nil, invalid
+		}
+		idx := table.Schema().IndexOfColName(string(expr.Names[0]))
+		if idx < 0 {
+			return nil, newPgError("42703", `column "%s" of relation "%s" does not exist`, expr.Names[0], table.Name())
+		}
+		col := table.Schema()[idx]
+		// The deletions and the updates find the rows by their primary keys, which must be kept as they are.
+		if col.PrimaryKey {
+			return nil, newPgError("55000", `column "%s" of relation "%s" is a part of the primary key`, col.Name, table.Name())
+		}
+		if _, ok := columns[col.Name]; ok {
+			return nil, newPgError("42601", `multiple assignments to same column "%s"`, col.Name)
+		}
+		columns[col.Name] = tree.AsString(expr.Expr)
+	}
+	return columns, nil
+}
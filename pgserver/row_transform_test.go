@@ -0,0 +1,38 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRowTransform(t *testing.T) {
+	table := memory.NewTable(memory.NewDatabase("db"), "users", sql.NewPrimaryKeySchema(sql.Schema{
+		{Name: "id", Type: types.Int64, PrimaryKey: true},
+		{Name: "Email", Type: types.Text},
+		{Name: "phone", Type: types.Text},
+	}), nil)
+
+	columns, err := parseRowTransform(table, `email = NULL, phone = left(phone, 3) || '****'`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"Email": "NULL", "phone": "left(phone, 3) || '****'"}, columns)
+
+	columns, err = parseRowTransform(table, " ")
+	require.NoError(t, err)
+	require.Empty(t, columns)
+
+	for transform, code := range map[string]string{
+		"id = 0":                      "55000",
+		"name = NULL":                 "42703",
+		"email = NULL, email = 'x'":   "42601",
+		"email = NULL WHERE id = 1":   "22023",
+		"email = NULL; DROP TABLE t":  "22023",
+		"(email, phone) = ('a', 'b')": "22023",
+	} {
+		_, err := parseRowTransform(table, transform)
+		require.ErrorContains(t, err, code, transform)
+	}
+}
@@ -0,0 +1,222 @@
+package pgserver
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// The schema changes, see catalog.SchemaChange, are delivered to a session when it is idle and not in a transaction
+// block, or at the end of the message that it is handling otherwise, right before ReadyForQuery:
+//   - The prepared statements that mention the changed objects are prepared again, see replanPreparedStatements.
+//   - If the session listens on the channel myduck_ddl, the changes are sent to it as the notifications.
+//
+// The DDL statements of a transaction block are published when it is committed, and dropped if it is rolled back.
+// Only myduck_ddl is notified by the server, while LISTEN and UNLISTEN accept any channel.
+
+// listenRegex matches LISTEN, which is not supported by the Postgres parser.
+var listenRegex = regexp.MustCompile(`(?is)^\s*LISTEN\s+(` + identifierPattern + `)[\s;]*$`)
+
+// schemaChangesOf returns the schema changes made by a DDL statement executed by DuckDB in a connection,
+// whose current database and schema are the defaults of the objects.
+func schemaChangesOf(statement ConvertedStatement, database, schema string, connID uint32) []catalog.SchemaChange {
+	change := func(command, objectType string, prefix tree.ObjectNamePrefix, name string) catalog.SchemaChange {
+		c := catalog.SchemaChange{
+			Command:      command,
+			ObjectType:   objectType,
+			Database:     database,
+			Schema:       schema,
+			Name:         name,
+			Origin:       catalog.SchemaChangeLocal,
+			ConnectionID: connID,
+		}
+		if prefix.ExplicitCatalog {
+			c.Database = prefix.Catalog()
+		}
+		if prefix.ExplicitSchema {
+			c.Schema = prefix.Schema()
+		}
+		return c
+	}
+	table := func(command, objectType string, name tree.TableName) catalog.SchemaChange {
+		return change(command, objectType, name.ObjectNamePrefix, name.Table())
+	}
+
+	if !statement.PgParsable {
+		// The objects of the DuckDB-specific statements are not known.
+		switch statement.Tag {
+		case "CREATE", "ALTER", "DROP":
+			return []catalog.SchemaChange{change(statement.Tag, "", tree.ObjectNamePrefix{}, "")}
+		}
+		return nil
+	}
+
+	var changes []catalog.SchemaChange
+	switch stmt := statement.AST.(type) {
+	case *tree.CreateTable:
+		changes = append(changes, table("CREATE TABLE", catalog.SchemaObjectTable, stmt.Table))
+	case *tree.AlterTable:
+		changes = append(changes, table("ALTER TABLE", catalog.SchemaObjectTable, stmt.Table.ToTableName()))
+	case *tree.RenameTable:
+		command, objectType := "ALTER TABLE", catalog.SchemaObjectTable
+		if stmt.IsView {
+			command, objectType = "ALTER VIEW", catalog.SchemaObjectView
+		} else if stmt.IsSequence {
+			return nil
+		}
+		changes = append(changes,
+			table(command, objectType, stmt.Name.ToTableName()),
+			table(command, objectType, stmt.NewName.ToTableName()),
+		)
+	case *tree.DropTable:
+		for _, name := range stmt.Names {
+			changes = append(changes, table("DROP TABLE", catalog.SchemaObjectTable, name))
+		}
+	case *tree.CreateView:
+		changes = append(changes, table("CREATE VIEW", catalog.SchemaObjectView, stmt.Name))
+	case *tree.DropView:
+		for _, name := range stmt.Names {
+			changes = append(changes, table("DROP VIEW", catalog.SchemaObjectView, name))
+		}
+	case *tree.CreateIndex:
+		changes = append(changes, table("CREATE INDEX", catalog.SchemaObjectIndex, stmt.Table))
+	case *tree.DropIndex:
+		for _, index := range stmt.IndexList {
+			changes = append(changes, change("DROP INDEX", catalog.SchemaObjectIndex, index.Table.ObjectNamePrefix, index.Table.Table()))
+		}
+	case *tree.CreateSchema:
+		c := change("CREATE SCHEMA", catalog.SchemaObjectSchema, tree.ObjectNamePrefix{}, "")
+		c.Schema = stmt.Schema.Schema()
+		changes = append(changes, c)
+	case *tree.DropSchema:
+		for _, name := range stmt.Names {
+			c := change("DROP SCHEMA", catalog.SchemaObjectSchema, tree.ObjectNamePrefix{}, "")
+			c.Schema = name.Schema()
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// schemaChangeAffects reports whether a schema change may affect a statement, i.e., whether the statement
+// mentions the changed object. The indexes do not change the results of the statements.
+func schemaChangeAffects(change catalog.SchemaChange, query string) bool {
+	var name string
+	switch change.ObjectType {
+	case "":
+		return true
+	case catalog.SchemaObjectIndex:
+		return false
+	case catalog.SchemaObjectSchema:
+		name = change.Schema
+	default:
+		name = change.Name
+	}
+	return name == "" || strings.Contains(strings.ToLower(query), strings.ToLower(name))
+}
+
+// recordSchemaChanges publishes the schema changes made by a statement of the session,
+// or keeps them until the end of the transaction block if it is in one.
+func (h *ConnectionHandler) recordSchemaChanges(statement ConvertedStatement) error {
+	switch strings.SplitN(statement.Tag, " ", 2)[0] {
+	case "CREATE", "ALTER", "DROP":
+	default:
+		return nil
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	changes := schemaChangesOf(statement, adapter.GetCurrentCatalog(ctx), ctx.GetCurrentDatabase(), ctx.Session.ID())
+	if h.duckHandler.inTxnBlock {
+		h.pendingSchemaChanges = append(h.pendingSchemaChanges, changes...)
+		return nil
+	}
+	catalog.PublishSchemaChanges(changes...)
+	return nil
+}
+
+// endSchemaChangeTxn publishes the schema changes of a transaction block if it is committed, or drops them otherwise.
+func (h *ConnectionHandler) endSchemaChangeTxn(committed bool) {
+	if committed {
+		catalog.PublishSchemaChanges(h.pendingSchemaChanges...)
+	}
+	h.pendingSchemaChanges = nil
+}
+
+// listen handles LISTEN.
+func (h *ConnectionHandler) listen(query string) (bool, error) {
+	m := listenRegex.FindStringSubmatch(query)
+	if m == nil {
+		return false, nil
+	}
+	if h.listening == nil {
+		h.listening = make(map[string]struct{})
+	}
+	h.listening[unquoteIdentifier(m[1])] = struct{}{}
+	return true, h.send(makeCommandComplete("LISTEN", 0))
+}
+
+// unlisten handles UNLISTEN.
+func (h *ConnectionHandler) unlisten(stmt *tree.Unlisten) error {
+	if stmt.Star {
+		h.listening = nil
+	} else if stmt.ChannelName != nil {
+		delete(h.listening, stmt.ChannelName.Parts[0])
+	}
+	return h.send(makeCommandComplete("UNLISTEN", 0))
+}
+
+// watchSchemaChanges delivers the schema changes to the session while it is idle, until the subscription is closed.
+// The session is known to be idle by the state of its cursors, see finishHandlingMessage.
+func (h *ConnectionHandler) watchSchemaChanges(subscription *catalog.SchemaChangeSubscription) {
+	for range subscription.Ready() {
+		h.cursors.mu.Lock()
+		// Otherwise, they are delivered at the end of the message being handled, of the transaction block,
+		// or of the extended query whose portals are bound to the prepared statements.
+		if !h.cursors.busy && !h.cursors.closed && !h.duckHandler.inTxnBlock && len(h.portals) == 0 {
+			if err := h.deliverSchemaChanges(); err != nil {
+				h.logger.WithError(err).Warn("Failed to deliver the schema changes")
+			}
+		}
+		h.cursors.mu.Unlock()
+	}
+}
+
+// deliverSchemaChanges prepares the affected prepared statements again, and notifies the session of the changes
+// if it listens on catalog.SchemaChangeChannel. It must not be called in a transaction block.
+func (h *ConnectionHandler) deliverSchemaChanges() error {
+	if h.schemaChanges == nil {
+		return nil
+	}
+	changes := h.schemaChanges.Take()
+	if len(changes) == 0 {
+		return nil
+	}
+	h.replanPreparedStatements(func(ps PreparedStatementData) bool {
+		for _, change := range changes {
+			if schemaChangeAffects(change, ps.Statement.String) {
+				return true
+			}
+		}
+		return false
+	})
+	if _, ok := h.listening[catalog.SchemaChangeChannel]; !ok {
+		return nil
+	}
+	for _, change := range changes {
+		if err := h.send(&pgproto3.NotificationResponse{
+			PID:     change.ConnectionID,
+			Channel: catalog.SchemaChangeChannel,
+			Payload: change.Payload(),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
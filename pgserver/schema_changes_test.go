@@ -0,0 +1,81 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaChangesOf(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []string // command, object type, schema and name of the changes
+	}{
+		{"CREATE TABLE t (id INT)", []string{"CREATE TABLE table main t"}},
+		{"ALTER TABLE s.t ADD COLUMN c INT", []string{"ALTER TABLE table s t"}},
+		{"ALTER TABLE t RENAME TO u", []string{"ALTER TABLE table main t", "ALTER TABLE table main u"}},
+		{"ALTER VIEW v RENAME TO w", []string{"ALTER VIEW view main v", "ALTER VIEW view main w"}},
+		{"DROP TABLE a, s.b", []string{"DROP TABLE table main a", "DROP TABLE table s b"}},
+		{"CREATE VIEW v AS SELECT 1", []string{"CREATE VIEW view main v"}},
+		{"DROP VIEW s.v", []string{"DROP VIEW view s v"}},
+		{"CREATE INDEX idx ON t (c)", []string{"CREATE INDEX index main t"}},
+		{"CREATE SCHEMA s", []string{"CREATE SCHEMA schema s "}},
+		{"DROP SCHEMA a, b", []string{"DROP SCHEMA schema a ", "DROP SCHEMA schema b "}},
+		{"ALTER SEQUENCE q RENAME TO r", nil},
+		{"INSERT INTO t VALUES (1)", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tt.query)
+			require.NoError(t, err)
+			changes := schemaChangesOf(ConvertedStatement{
+				String:     tt.query,
+				AST:        stmt.AST,
+				Tag:        stmt.AST.StatementTag(),
+				PgParsable: true,
+			}, "db", "main", 7)
+			var actual []string
+			for _, c := range changes {
+				require.Equal(t, "db", c.Database)
+				require.Equal(t, catalog.SchemaChangeLocal, c.Origin)
+				require.Equal(t, uint32(7), c.ConnectionID)
+				actual = append(actual, c.Command+" "+c.ObjectType+" "+c.Schema+" "+c.Name)
+			}
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+
+	// The objects of the statements that the parser does not support are not known.
+	changes := schemaChangesOf(ConvertedStatement{String: "CREATE MACRO m(a) AS a", Tag: "CREATE"}, "db", "main", 7)
+	require.Equal(t, []catalog.SchemaChange{{Command: "CREATE", Database: "db", Schema: "main", Origin: catalog.SchemaChangeLocal, ConnectionID: 7}}, changes)
+}
+
+func TestSchemaChangeAffects(t *testing.T) {
+	table := catalog.SchemaChange{ObjectType: catalog.SchemaObjectTable, Schema: "main", Name: "Orders"}
+	require.True(t, schemaChangeAffects(table, "SELECT * FROM orders WHERE id = $1"))
+	require.False(t, schemaChangeAffects(table, "SELECT * FROM items"))
+	require.False(t, schemaChangeAffects(catalog.SchemaChange{ObjectType: catalog.SchemaObjectIndex, Name: "items"}, "SELECT * FROM items"))
+	require.True(t, schemaChangeAffects(catalog.SchemaChange{ObjectType: catalog.SchemaObjectSchema, Schema: "s"}, "SELECT * FROM s.items"))
+	require.True(t, schemaChangeAffects(catalog.SchemaChange{Command: "DDL"}, "SELECT 1"))
+}
+
+func TestListenRegex(t *testing.T) {
+	for query, channel := range map[string]string{
+		"LISTEN myduck_ddl":      "myduck_ddl",
+		"listen MyDuck_DDL;":     "myduck_ddl",
+		"  LISTEN \"Chan\" ; \n": "Chan",
+	} {
+		m := listenRegex.FindStringSubmatch(query)
+		require.NotNil(t, m, query)
+		require.Equal(t, channel, unquoteIdentifier(m[1]), query)
+	}
+	require.Nil(t, listenRegex.FindStringSubmatch("LISTEN"))
+	require.Nil(t, listenRegex.FindStringSubmatch("LISTEN a b"))
+
+	// UNLISTEN is supported by the parser.
+	stmt, err := parser.ParseOne("UNLISTEN myduck_ddl")
+	require.NoError(t, err)
+	require.Equal(t, "UNLISTEN", stmt.AST.StatementTag())
+}
@@ -0,0 +1,540 @@
+package pgserver
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/types"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The sequences of Postgres are the sequences of DuckDB, listed in pg_class and information_schema.sequences:
+//
+//   - `CREATE SEQUENCE` is translated into DuckDB. CACHE is ignored, and AS sets the bounds of the type.
+//     OWNED BY makes the sequence dropped along with the table of the column.
+//   - A serial column, i.e., `serial`, `bigserial`, or `smallserial`, becomes a column of the integer type
+//     that defaults to the next value of the sequence `<table>_<column>_seq`, which is owned by the column.
+//     The default is set after the table is created, since DuckDB never lets the sequence of a default of
+//     CREATE TABLE be replaced.
+//   - nextval() and currval() are the ones of DuckDB, whose values are kept in the session already.
+//   - setval() recreates the sequence to start with the given value, in a transaction that detaches the defaults
+//     of the columns that refer to the sequence and attaches them again, since DuckDB cannot move a sequence.
+//     It fails for the columns that default to the sequence in CREATE TABLE.
+//   - lastval() is currval() of the sequence advanced last in the session, by nextval() or by
+//     the serial columns omitted from INSERT.
+
+var (
+	// nextvalRegex matches the calls of nextval() on a literal sequence name.
+	nextvalRegex = regexp.MustCompile(`(?i)\bnextval\s*\(\s*'((?:[^']|'')+)'`)
+	// setvalRegex matches "SELECT setval('seq', value [, is_called])", whose value may be an expression.
+	// sequenceAsInt4Regex matches the names of int4 in the AS option, which the parser takes for int8.
+	sequenceAsInt4Regex = regexp.MustCompile(`(?i)\bAS\s+(?:integer|int4|int)\b`)
+	setvalRegex         = regexp.MustCompile(`(?is)^\s*select\s+(?:pg_catalog\.)?setval\(\s*'((?:[^']|'')+)'\s*,\s*(.+?)\s*(?:,\s*(true|false|'t'|'f')\s*)?\)\s*;?\s*$`)
+)
+
+// serialTypes maps the serial types to their integer types and the maximum values of their sequences.
+var serialTypes = map[string]struct {
+	typ string
+	max int64
+}{
+	"smallserial": {"SMALLINT", 32767},
+	"serial2":     {"SMALLINT", 32767},
+	"serial":      {"INTEGER", 2147483647},
+	"serial4":     {"INTEGER", 2147483647},
+	"bigserial":   {"BIGINT", 0},
+	"serial8":     {"BIGINT", 0},
+}
+
+// sequenceName returns the schema and the name of a sequence, defaulting the schema to the current one.
+func sequenceName(ctx *sql.Context, name string) (string, string, error) {
+	tn, err := parser.ParseQualifiedTableName(name)
+	if err != nil {
+		return "", "", err
+	}
+	schema := tn.Schema()
+	if schema == "" {
+		schema = adapter.GetCurrentSchema(ctx)
+	}
+	return schema, tn.Table(), nil
+}
+
+// createSequenceStmt translates CREATE SEQUENCE into DuckDB.
+// It returns the column of OWNED BY as well, which is nil if there is none.
+func createSequenceStmt(query string, create *tree.CreateSequence, schema string) (string, *tree.ColumnItem, error) {
+	var b strings.Builder
+	b.WriteString("CREATE ")
+	temporary := create.Persistence.IsTemporary()
+	if temporary {
+		b.WriteString("TEMP ")
+	}
+	b.WriteString("SEQUENCE ")
+	if create.IfNotExists {
+		b.WriteString("IF NOT EXISTS ")
+	}
+	if temporary {
+		b.WriteString(catalog.QuoteIdentifierANSI(create.Name.Table()))
+	} else {
+		b.WriteString(catalog.ConnectIdentifiersANSI(schema, create.Name.Table()))
+	}
+
+	var owner *tree.ColumnItem
+	var bound int64
+	increment, hasMin, hasMax := int64(1), false, false
+	for _, opt := range create.Options {
+		switch opt.Name {
+		case tree.SeqOptAs:
+			switch opt.AsIntegerType.Family() {
+			case types.IntFamily:
+				switch {
+				case opt.AsIntegerType.Width() == 16:
+					bound = 32767
+				case opt.AsIntegerType.Width() == 32 || sequenceAsInt4Regex.MatchString(query):
+					bound = 2147483647
+				}
+			default:
+				return "", nil, newPgError("22023", "sequence type must be smallint, integer, or bigint")
+			}
+		case tree.SeqOptStart:
+			fmt.Fprintf(&b, " START WITH %d", *opt.IntVal)
+		case tree.SeqOptIncrement:
+			increment = *opt.IntVal
+			fmt.Fprintf(&b, " INCREMENT BY %d", increment)
+		case tree.SeqOptMinValue:
+			if opt.IntVal != nil {
+				hasMin = true
+				fmt.Fprintf(&b, " MINVALUE %d", *opt.IntVal)
+			}
+		case tree.SeqOptMaxValue:
+			if opt.IntVal != nil {
+				hasMax = true
+				fmt.Fprintf(&b, " MAXVALUE %d", *opt.IntVal)
+			}
+		case tree.SeqOptCycle:
+			b.WriteString(" CYCLE")
+		case tree.SeqOptOwnedBy:
+			owner = opt.ColumnItemVal
+		case tree.SeqOptNoCycle, tree.SeqOptCache:
+		default:
+			return "", nil, newPgError("0A000", "CREATE SEQUENCE option %s is not supported", opt.Name)
+		}
+	}
+	if bound != 0 {
+		if increment > 0 && !hasMax {
+			fmt.Fprintf(&b, " MAXVALUE %d", bound)
+		} else if increment < 0 && !hasMin {
+			fmt.Fprintf(&b, " MINVALUE %d", -bound-1)
+		}
+	}
+	return b.String(), owner, nil
+}
+
+func (h *ConnectionHandler) createSequence(query string, create *tree.CreateSequence) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	schema := create.Name.Schema()
+	if schema == "" {
+		schema = adapter.GetCurrentSchema(ctx)
+	}
+	stmt, owner, err := createSequenceStmt(query, create, schema)
+	if err != nil {
+		return err
+	}
+	return h.duckHandler.atomically(ctx, func() error {
+		if _, err := adapter.Exec(ctx, stmt); err != nil {
+			return err
+		}
+		if create.Persistence.IsTemporary() {
+			return nil
+		}
+		if err := catalog.RegisterSequence(ctx, schema, create.Name.Table()); err != nil {
+			return err
+		}
+		if owner != nil && owner.TableName != nil {
+			return catalog.SetSequenceOwner(ctx, schema, create.Name.Table(), owner.TableName.Object(), string(owner.ColumnName))
+		}
+		return nil
+	})
+}
+
+func (h *ConnectionHandler) dropSequences(drop *tree.DropSequence) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	for _, name := range drop.Names {
+		schema := name.Schema()
+		if schema == "" {
+			schema = adapter.GetCurrentSchema(ctx)
+		}
+		var b strings.Builder
+		b.WriteString("DROP SEQUENCE ")
+		if drop.IfExists {
+			b.WriteString("IF EXISTS ")
+		}
+		b.WriteString(catalog.ConnectIdentifiersANSI(schema, name.Table()))
+		if drop.DropBehavior == tree.DropCascade {
+			b.WriteString(" CASCADE")
+		}
+		if _, err := adapter.Exec(ctx, b.String()); err != nil {
+			return err
+		}
+		if err := catalog.UnregisterSequence(ctx, schema, name.Table()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serialColumn is a serial column of CREATE TABLE.
+type serialColumn struct {
+	schema   string
+	column   string
+	typ      string
+	max      int64
+	sequence string
+}
+
+// setDefaultStmt returns the statement that makes the column of a table default to the next value of its sequence.
+func (serial serialColumn) setDefaultStmt(table string) string {
+	return "ALTER TABLE " + table + " ALTER COLUMN " + catalog.QuoteIdentifierANSI(serial.column) +
+		" SET DEFAULT nextval(" + quoteSettingLiteral(catalog.ConnectIdentifiersANSI(serial.schema, serial.sequence)) + ")"
+}
+
+// serialColumnRegex returns the regex that matches the definition of a serial column up to its type.
+func serialColumnRegex(column string) *regexp.Regexp {
+	name := `"` + regexp.QuoteMeta(strings.ReplaceAll(column, `"`, `""`)) + `"`
+	if column == strings.ToLower(column) {
+		name = `(?:` + name + `|\b` + regexp.QuoteMeta(column) + `\b)`
+	}
+	return regexp.MustCompile(`(?i)([(,]\s*` + name + `\s+)((?:small|big)?serial[248]?)\b`)
+}
+
+// rewriteSerialColumns replaces the serial types of CREATE TABLE with their integer types.
+// If the sequences are to be created, the sequences of the columns are named by sequenceOf, and the columns are
+// made NOT NULL, whose defaults are set by serialColumn.setDefaultStmt once the table is created.
+func rewriteSerialColumns(query string, create *tree.CreateTable, schema string, sequenceOf func(column string) (string, error)) (string, []serialColumn, error) {
+	var serials []serialColumn
+	for _, def := range create.Defs {
+		col, ok := def.(*tree.ColumnTableDef)
+		if !ok || !col.IsSerial {
+			continue
+		}
+		re := serialColumnRegex(string(col.Name))
+		m := re.FindStringSubmatchIndex(query)
+		if m == nil {
+			return "", nil, newPgError("42601", `cannot find the type of serial column "%s"`, col.Name)
+		}
+		serial := serialTypes[strings.ToLower(query[m[4]:m[5]])]
+		replacement := serial.typ
+		if sequenceOf != nil {
+			sequence, err := sequenceOf(string(col.Name))
+			if err != nil {
+				return "", nil, err
+			}
+			serials = append(serials, serialColumn{schema: schema, column: string(col.Name), typ: serial.typ, max: serial.max, sequence: sequence})
+			replacement += " NOT NULL"
+		}
+		query = query[:m[4]] + replacement + query[m[5]:]
+	}
+	return query, serials, nil
+}
+
+// createSerialSequences creates the sequences of the serial columns of CREATE TABLE, and returns the query
+// whose serial columns are of the integer types, along with the columns whose defaults are to be set.
+// The sequences are not created if the table exists already, or if the table is temporary.
+func createSerialSequences(ctx *sql.Context, query string, create *tree.CreateTable) (string, []serialColumn, error) {
+	hasSerial := false
+	for _, def := range create.Defs {
+		if col, ok := def.(*tree.ColumnTableDef); ok && col.IsSerial {
+			hasSerial = true
+			break
+		}
+	}
+	if !hasSerial {
+		return query, nil, nil
+	}
+	query = RemoveComments(query)
+
+	schema := create.Table.Schema()
+	if schema == "" {
+		schema = adapter.GetCurrentSchema(ctx)
+	}
+	createSequences := !create.Persistence.IsTemporary()
+	if createSequences && create.IfNotExists {
+		exists, err := tableExists(ctx, create)
+		if err != nil {
+			return "", nil, err
+		}
+		createSequences = !exists
+	}
+	if !createSequences {
+		query, _, err := rewriteSerialColumns(query, create, schema, nil)
+		return query, nil, err
+	}
+
+	// Same as Postgres, the name of a sequence is suffixed with a number if it is taken.
+	taken := make(map[string]bool)
+	sequenceOf := func(column string) (string, error) {
+		base := create.Table.Table() + "_" + column + "_seq"
+		for i := 0; ; i++ {
+			name := base
+			if i > 0 {
+				name += strconv.Itoa(i)
+			}
+			if taken[name] {
+				continue
+			}
+			var count int
+			if err := adapter.QueryRowCatalog(ctx,
+				"SELECT count(*) FROM duckdb_sequences() WHERE database_name = current_database() AND schema_name = ? AND sequence_name = ?",
+				schema, name,
+			).Scan(&count); err != nil {
+				return "", err
+			}
+			if count == 0 {
+				taken[name] = true
+				return name, nil
+			}
+		}
+	}
+	query, serials, err := rewriteSerialColumns(query, create, schema, sequenceOf)
+	if err != nil {
+		return "", nil, err
+	}
+	for i, serial := range serials {
+		stmt := "CREATE SEQUENCE " + catalog.ConnectIdentifiersANSI(schema, serial.sequence)
+		if serial.max != 0 {
+			stmt += fmt.Sprintf(" MAXVALUE %d", serial.max)
+		}
+		if _, err := adapter.Exec(ctx, stmt); err != nil {
+			dropSerialSequences(ctx, serials[:i])
+			return "", nil, err
+		}
+		if err := catalog.RegisterSequence(ctx, schema, serial.sequence); err != nil {
+			return "", nil, err
+		}
+		if err := catalog.SetSequenceOwner(ctx, schema, serial.sequence, create.Table.Table(), serial.column); err != nil {
+			return "", nil, err
+		}
+	}
+	return query, serials, nil
+}
+
+// dropSerialSequences drops the sequences created for the serial columns of a table that is not created.
+func dropSerialSequences(ctx *sql.Context, serials []serialColumn) {
+	for _, serial := range serials {
+		if _, err := adapter.Exec(ctx, "DROP SEQUENCE IF EXISTS "+catalog.ConnectIdentifiersANSI(serial.schema, serial.sequence)); err != nil {
+			ctx.GetLogger().WithError(err).Warnf("Failed to drop sequence %s", serial.sequence)
+			continue
+		}
+		if err := catalog.UnregisterSequence(ctx, serial.schema, serial.sequence); err != nil {
+			ctx.GetLogger().WithError(err).Warnf("Failed to unregister sequence %s", serial.sequence)
+		}
+	}
+}
+
+// dropOwnedSequences drops the sequences owned by the columns of the dropped tables.
+func dropOwnedSequences(ctx *sql.Context, drop *tree.DropTable) {
+	for _, name := range drop.Names {
+		schema := name.Schema()
+		if schema == "" {
+			schema = adapter.GetCurrentSchema(ctx)
+		}
+		owned, err := catalog.OwnedSequences(ctx, schema, name.Table())
+		if err != nil {
+			ctx.GetLogger().WithError(err).Warnf("Failed to look up the sequences of table %s", name.Table())
+			continue
+		}
+		serials := make([]serialColumn, 0, len(owned))
+		for column, sequence := range owned {
+			serials = append(serials, serialColumn{schema: schema, column: column, sequence: sequence})
+		}
+		dropSerialSequences(ctx, serials)
+	}
+}
+
+// setval implements setval(name, value, is_called), and returns the value.
+func (h *ConnectionHandler) setval(name, value string, isCalled bool) (int64, error) {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return 0, err
+	}
+	schema, sequence, err := sequenceName(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	var v int64
+	if err := adapter.QueryRow(ctx, "SELECT ("+value+")::BIGINT").Scan(&v); err != nil {
+		return 0, err
+	}
+
+	var (
+		increment, minValue, maxValue int64
+		cycle, temporary              bool
+	)
+	if err := adapter.QueryRow(ctx,
+		"SELECT increment_by, min_value, max_value, cycle, temporary FROM duckdb_sequences()"+
+			" WHERE (database_name = current_database() OR temporary) AND schema_name = ? AND sequence_name = ?"+
+			" ORDER BY temporary DESC LIMIT 1",
+		schema, sequence,
+	).Scan(&increment, &minValue, &maxValue, &cycle, &temporary); err != nil {
+		if errors.Is(err, stdsql.ErrNoRows) {
+			return 0, newPgError("42P01", `relation "%s" does not exist`, name)
+		}
+		return 0, err
+	}
+	if v < minValue || v > maxValue {
+		return 0, newPgError("22003", `setval: value %d is out of bounds for sequence "%s" (%d..%d)`, v, sequence, minValue, maxValue)
+	}
+
+	qualified := catalog.ConnectIdentifiersANSI(schema, sequence)
+	if temporary {
+		qualified = catalog.QuoteIdentifierANSI(sequence)
+	}
+	detach, attach, err := sequenceDefaults(ctx, schema, sequence, temporary)
+	if err != nil {
+		return 0, err
+	}
+	create := "CREATE OR REPLACE "
+	if temporary {
+		create += "TEMP "
+	}
+	create += fmt.Sprintf("SEQUENCE %s START WITH %d INCREMENT BY %d MINVALUE %d MAXVALUE %d", qualified, v, increment, minValue, maxValue)
+	if cycle {
+		create += " CYCLE"
+	}
+	stmts := append(append(detach, create), attach...)
+	if isCalled {
+		// The value is the one returned last, as well as the current value of the session.
+		stmts = append(stmts, "SELECT nextval("+quoteSettingLiteral(qualified)+")")
+	}
+
+	if err := h.duckHandler.atomically(ctx, func() error {
+		for _, stmt := range stmts {
+			if _, err := adapter.Exec(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, newPgError("0A000", `setval cannot move sequence "%s" to %d: %v`, sequence, v, err)
+	}
+	return v, nil
+}
+
+// sequenceDefaults returns the statements that detach the defaults of the columns that refer to a sequence,
+// and the ones that attach them again.
+func sequenceDefaults(ctx *sql.Context, schema, sequence string, temporary bool) (detach, attach []string, err error) {
+	database := "current_database()"
+	if temporary {
+		database = "'temp'"
+	}
+	rows, err := adapter.QueryCatalog(ctx,
+		"SELECT schema_name, table_name, column_name, column_default FROM duckdb_columns()"+
+			" WHERE database_name = "+database+" AND column_default ILIKE '%nextval%'",
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableSchema, table, column, def string
+		if err := rows.Scan(&tableSchema, &table, &column, &def); err != nil {
+			return nil, nil, err
+		}
+		if !refersToSequence(def, tableSchema, schema, sequence) {
+			continue
+		}
+		alter := "ALTER TABLE " + catalog.ConnectIdentifiersANSI(tableSchema, table) + " ALTER COLUMN " + catalog.QuoteIdentifierANSI(column)
+		if temporary {
+			alter = "ALTER TABLE " + catalog.QuoteIdentifierANSI(table) + " ALTER COLUMN " + catalog.QuoteIdentifierANSI(column)
+		}
+		detach = append(detach, alter+" DROP DEFAULT")
+		attach = append(attach, alter+" SET DEFAULT "+def)
+	}
+	return detach, attach, rows.Err()
+}
+
+// refersToSequence reports whether a default calls nextval() on a sequence,
+// whose unqualified names are resolved in the schema of the table.
+func refersToSequence(def, tableSchema, schema, sequence string) bool {
+	for _, m := range nextvalRegex.FindAllStringSubmatch(def, -1) {
+		tn, err := parser.ParseQualifiedTableName(strings.ReplaceAll(m[1], "''", "'"))
+		if err != nil {
+			continue
+		}
+		s := tn.Schema()
+		if s == "" {
+			s = tableSchema
+		}
+		if s == schema && tn.Table() == sequence {
+			return true
+		}
+	}
+	return false
+}
+
+// sequenceUse is the use of the sequences in the session that lastval() refers to.
+type sequenceUse struct {
+	// sequence is the sequence advanced last by nextval(), as a qualified name.
+	sequence string
+	// insert is the last INSERT, which may have advanced the sequences of the serial columns after that.
+	insert *tree.Insert
+}
+
+// trackSequence keeps track of the use of the sequences after a statement is executed.
+func (h *DuckHandler) trackSequence(ctx *sql.Context, query string, parsed tree.Statement, err error) {
+	if err != nil {
+		return
+	}
+	if m := nextvalRegex.FindAllStringSubmatch(query, -1); len(m) > 0 {
+		schema, sequence, err := sequenceName(ctx, strings.ReplaceAll(m[len(m)-1][1], "''", "'"))
+		if err != nil {
+			return
+		}
+		h.sequenceUse = sequenceUse{sequence: catalog.ConnectIdentifiersANSI(schema, sequence)}
+		return
+	}
+	if insert, ok := parsed.(*tree.Insert); ok && len(insert.Columns) > 0 {
+		h.sequenceUse.insert = insert
+	}
+}
+
+// lastSequence returns the sequence that lastval() refers to, or "" if there is none.
+func (h *DuckHandler) lastSequence(ctx *sql.Context) (string, error) {
+	if insert := h.sequenceUse.insert; insert != nil {
+		table := insert.Table
+		if aliased, ok := table.(*tree.AliasedTableExpr); ok {
+			table = aliased.Expr
+		}
+		if tn, ok := table.(*tree.TableName); ok {
+			schema := tn.Schema()
+			if schema == "" {
+				schema = adapter.GetCurrentSchema(ctx)
+			}
+			owned, err := catalog.OwnedSequences(ctx, schema, tn.Table())
+			if err != nil {
+				return "", err
+			}
+			for column, sequence := range owned {
+				if !slices.Contains(insert.Columns, tree.Name(column)) {
+					return catalog.ConnectIdentifiersANSI(schema, sequence), nil
+				}
+			}
+		}
+	}
+	return h.sequenceUse.sequence, nil
+}
@@ -0,0 +1,119 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSequenceStmt(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+		owner    string
+	}{
+		{
+			"CREATE SEQUENCE s",
+			`CREATE SEQUENCE "public"."s"`,
+			"",
+		},
+		{
+			"CREATE SEQUENCE IF NOT EXISTS s AS integer START WITH 3 INCREMENT BY 2 NO MINVALUE CACHE 10 NO CYCLE OWNED BY t.id",
+			`CREATE SEQUENCE IF NOT EXISTS "public"."s" START WITH 3 INCREMENT BY 2 MAXVALUE 2147483647`,
+			"t.id",
+		},
+		{
+			"CREATE SEQUENCE s AS smallint INCREMENT -1 MAXVALUE -1 CYCLE",
+			`CREATE SEQUENCE "public"."s" INCREMENT BY -1 MAXVALUE -1 CYCLE MINVALUE -32768`,
+			"",
+		},
+		{
+			"CREATE TEMP SEQUENCE s MINVALUE 0 MAXVALUE 100",
+			`CREATE TEMP SEQUENCE "s" MINVALUE 0 MAXVALUE 100`,
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tt.query)
+			require.NoError(t, err)
+			create, owner, err := createSequenceStmt(tt.query, stmt.AST.(*tree.CreateSequence), "public")
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, create)
+			if tt.owner == "" {
+				require.Nil(t, owner)
+			} else {
+				require.Equal(t, tt.owner, owner.String())
+			}
+		})
+	}
+}
+
+func TestRewriteSerialColumns(t *testing.T) {
+	query := `CREATE TABLE t (id serial PRIMARY KEY, "Big" BIGSERIAL, serial_no smallserial NOT NULL, note text DEFAULT 'serial')`
+	stmt, err := parser.ParseOne(query)
+	require.NoError(t, err)
+	create := stmt.AST.(*tree.CreateTable)
+
+	rewritten, serials, err := rewriteSerialColumns(query, create, "public", func(column string) (string, error) {
+		return "t_" + column + "_seq", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, `CREATE TABLE t (`+
+		`id INTEGER NOT NULL PRIMARY KEY, `+
+		`"Big" BIGINT NOT NULL, `+
+		`serial_no SMALLINT NOT NULL NOT NULL, `+
+		`note text DEFAULT 'serial')`, rewritten)
+	require.Equal(t, []serialColumn{
+		{schema: "public", column: "id", typ: "INTEGER", max: 2147483647, sequence: "t_id_seq"},
+		{schema: "public", column: "Big", typ: "BIGINT", max: 0, sequence: "t_Big_seq"},
+		{schema: "public", column: "serial_no", typ: "SMALLINT", max: 32767, sequence: "t_serial_no_seq"},
+	}, serials)
+	// The defaults are set once the table is created.
+	require.Equal(t, `ALTER TABLE t ALTER COLUMN "Big" SET DEFAULT nextval('"public"."t_Big_seq"')`, serials[1].setDefaultStmt("t"))
+
+	// The types are replaced only if the sequences are not to be created.
+	rewritten, serials, err = rewriteSerialColumns(query, create, "public", nil)
+	require.NoError(t, err)
+	require.Equal(t, `CREATE TABLE t (id INTEGER PRIMARY KEY, "Big" BIGINT, serial_no SMALLINT NOT NULL, note text DEFAULT 'serial')`, rewritten)
+	require.Empty(t, serials)
+}
+
+func TestSetvalRegex(t *testing.T) {
+	tests := []struct {
+		query   string
+		matches []string
+	}{
+		{"SELECT setval('s', 42)", []string{"s", "42", ""}},
+		{"SELECT pg_catalog.setval('public.t_id_seq', 42, true);", []string{"public.t_id_seq", "42", "true"}},
+		{"select setval('s', (SELECT max(id) FROM t), false)", []string{"s", "(SELECT max(id) FROM t)", "false"}},
+		{"SELECT setval('s', coalesce(max(id), 1)) FROM t", nil},
+	}
+	for _, tt := range tests {
+		m := setvalRegex.FindStringSubmatch(tt.query)
+		if tt.matches == nil {
+			require.Nil(t, m, tt.query)
+			continue
+		}
+		require.Equal(t, tt.matches, m[1:], tt.query)
+	}
+}
+
+func TestRefersToSequence(t *testing.T) {
+	for _, tt := range []struct {
+		def      string
+		schema   string
+		expected bool
+	}{
+		{`nextval('"public"."t_id_seq"')`, "other", true},
+		{`nextval('t_id_seq')`, "public", true},
+		{`nextval('t_id_seq')`, "other", false},
+		{`nextval('public.t_id_seq2')`, "public", false},
+		{`(nextval('s') + nextval('public.t_id_seq'))`, "other", true},
+		{`nextval('"T_id_seq"')`, "public", false},
+	} {
+		require.Equal(t, tt.expected, refersToSequence(tt.def, tt.schema, "public", "t_id_seq"), tt.def)
+	}
+}
@@ -2,6 +2,7 @@ package pgserver
 
 import (
 	"fmt"
+	"github.com/apecloud/myduckserver/backend"
 	"github.com/apecloud/myduckserver/catalog"
 	"github.com/dolthub/go-mysql-server/server"
 	"github.com/dolthub/go-mysql-server/sql"
@@ -25,14 +26,23 @@ func NewServer(provider *catalog.DatabaseProvider, host string, port int, passwo
 		mysql.ListenerConfig{
 			Protocol: "tcp",
 			Address:  addr,
-			Listener: l,
+			Listener: backend.NewStatusListener(l),
 		},
 		options...,
 	)
 	if err != nil {
 		return nil, err
 	}
-	return &Server{Listener: listener, Provider: provider, NewInternalCtx: newCtx}, nil
+	newInternalCtx := func() *sql.Context {
+		ctx := newCtx()
+		// The DuckDB connections are keyed by the session IDs, so the internal sessions, e.g., of the replicators,
+		// take their IDs from the counter of the client connections in order not to share a connection with them.
+		if listener.connID != nil {
+			ctx.Session.SetConnectionId(listener.connID.Add(1))
+		}
+		return ctx
+	}
+	return &Server{Listener: listener, Provider: provider, NewInternalCtx: newInternalCtx}, nil
 }
 
 func (s *Server) Start() {
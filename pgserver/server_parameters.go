@@ -0,0 +1,140 @@
+package pgserver
+
+import (
+	"context"
+	stdsql "database/sql"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// The parameters that SET and SHOW accept are of three kinds:
+//
+//   - The Postgres configuration parameters of pgconfig, which are the system variables of the session.
+//   - The parameters of the server, e.g., ProfilingParameter, which are kept by the handlers, see serverParameters.
+//   - The settings of DuckDB, e.g., memory_limit, which are set on the DuckDB connection of the session.
+//
+// SET LOCAL changes any of them until the end of the current transaction block, see rememberLocalSetting.
+
+// serverParameter is a session parameter implemented by the server.
+type serverParameter struct {
+	// show returns the value shown by SHOW, which set accepts as well.
+	show func(h *ConnectionHandler) (string, error)
+	// set changes the value, or restores the default if useDefault is true.
+	set func(h *ConnectionHandler, value any, useDefault bool) error
+}
+
+// serverParameters are the session parameters implemented by the server, keyed by their names.
+var serverParameters = map[string]serverParameter{
+	ProfilingParameter: {
+		show: func(h *ConnectionHandler) (string, error) { return onOff(h.duckHandler.profiling), nil },
+		set:  (*ConnectionHandler).setProfiling,
+	},
+	CopyAppenderParameter: {
+		show: func(h *ConnectionHandler) (string, error) { return onOff(h.duckHandler.copyAppender), nil },
+		set:  (*ConnectionHandler).setCopyAppender,
+	},
+	WorkloadClassParameter: {
+		show: (*ConnectionHandler).workloadClass,
+		set:  (*ConnectionHandler).setWorkloadClass,
+	},
+	ReplicaMaxLagParameter: {
+		show: func(h *ConnectionHandler) (string, error) { return h.duckHandler.replicaMaxLagSetting(), nil },
+		set:  (*ConnectionHandler).setReplicaMaxLag,
+	},
+	TraceParameter: {
+		show: func(h *ConnectionHandler) (string, error) { return onOff(h.trace), nil },
+		set:  (*ConnectionHandler).setTrace,
+	},
+	MaxResultSizeParameter: {
+		show: func(h *ConnectionHandler) (string, error) { return h.duckHandler.showMaxResultSize(), nil },
+		set:  (*ConnectionHandler).setMaxResultSize,
+	},
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+// setServerParameter handles `SET [LOCAL] name = value` of a server parameter,
+// and replies with a CommandComplete message.
+func (h *ConnectionHandler) setServerParameter(name string, p serverParameter, value any, useDefault, local bool) error {
+	if local {
+		if !h.duckHandler.inTxnBlock {
+			return h.ignoreSetLocal("SET")
+		}
+		previous, err := p.show(h)
+		if err != nil {
+			return err
+		}
+		h.duckHandler.rememberLocalSetting(name, func(*sql.Context) error {
+			return p.set(h, previous, false)
+		})
+	}
+	if err := p.set(h, value, useDefault); err != nil {
+		return err
+	}
+	if !local {
+		// A session-level SET overrides any SET LOCAL of the same parameter when the transaction block ends.
+		delete(h.duckHandler.localSettings, name)
+	}
+	return h.send(makeCommandComplete("SET", 0))
+}
+
+// setDuckDBLocal handles `SET LOCAL name = value` of a DuckDB setting, and replies with a CommandComplete message.
+// DuckDB does not support SET LOCAL, so the setting is changed for the session,
+// and its previous value is restored when the transaction block ends.
+func (h *ConnectionHandler) setDuckDBLocal(name string, values tree.Exprs, useDefault bool) error {
+	if !h.duckHandler.inTxnBlock {
+		return h.ignoreSetLocal("SET")
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	var previous stdsql.NullString
+	if err := adapter.QueryRow(ctx, "SELECT current_setting(?)::VARCHAR", name).Scan(&previous); err != nil {
+		return err
+	}
+
+	setting := catalog.QuoteIdentifierANSI(name)
+	stmt := "RESET " + setting
+	if !useDefault {
+		exprs := make([]string, len(values))
+		for i, v := range values {
+			exprs[i] = tree.AsString(v)
+		}
+		stmt = "SET " + setting + " = " + strings.Join(exprs, ", ")
+	}
+	if _, err := adapter.Exec(ctx, stmt); err != nil {
+		return err
+	}
+	h.duckHandler.rememberLocalSetting(name, func(ctx *sql.Context) error {
+		restore := "RESET " + setting
+		if previous.Valid {
+			restore = "SET " + setting + " = " + quoteSettingLiteral(previous.String)
+		}
+		_, err := adapter.Exec(ctx, restore)
+		return err
+	})
+	return h.send(makeCommandComplete("SET", 0))
+}
+
+// ignoreSetLocal replies to SET LOCAL outside a transaction block, which has no effect, the same as Postgres.
+func (h *ConnectionHandler) ignoreSetLocal(tag string) error {
+	if err := h.send(&pgproto3.NoticeResponse{
+		Severity: "WARNING",
+		Code:     "25P01",
+		Message:  "SET LOCAL can only be used in transaction blocks",
+	}); err != nil {
+		return err
+	}
+	return h.send(makeCommandComplete(tag, 0))
+}
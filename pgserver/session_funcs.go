@@ -0,0 +1,214 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/pgserver/pgconfig"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// versionString is the value of version(), see WithVersionString.
+var versionString = "PostgreSQL 16.1 (MyDuck Server) on " + runtime.GOARCH + "-" + runtime.GOOS
+
+// sessionFunction is a function of the Postgres dialect whose value comes from the state of the session,
+// which DuckDB knows nothing about. The calls of the function are replaced by the SQL expressions
+// returned by Eval before the query is sent to DuckDB.
+type sessionFunction struct {
+	// Keyword is true if the function is called without parentheses, e.g., `current_user`.
+	Keyword bool
+	// NumArgs is the number of arguments, which must be constants.
+	NumArgs int
+	// Eval returns the SQL expression that replaces a call with the given arguments.
+	Eval func(h *ConnectionHandler, args []string) (string, error)
+}
+
+// sessionFunctions is the registry of the session functions, keyed by the lowercase function name.
+// set_config() is not here since it changes the session; see setConfigRegex.
+var sessionFunctions = map[string]sessionFunction{
+	"current_user": {
+		Keyword: true,
+		Eval: func(h *ConnectionHandler, _ []string) (string, error) {
+			return quoteSettingLiteral(h.mysqlConn.User), nil
+		},
+	},
+	"session_user": {
+		Keyword: true,
+		Eval: func(h *ConnectionHandler, _ []string) (string, error) {
+			return quoteSettingLiteral(h.mysqlConn.User), nil
+		},
+	},
+	"pg_backend_pid": {
+		Eval: func(h *ConnectionHandler, _ []string) (string, error) {
+			return fmt.Sprintf("%d::INTEGER", h.mysqlConn.ConnectionID), nil
+		},
+	},
+	"version": {
+		Eval: func(h *ConnectionHandler, _ []string) (string, error) {
+			return quoteSettingLiteral(versionString), nil
+		},
+	},
+	"txid_current": {
+		// DuckDB has txid_current() but not in pg_catalog.
+		Eval: func(h *ConnectionHandler, _ []string) (string, error) {
+			return "txid_current()", nil
+		},
+	},
+	"lastval": {
+		Eval: func(h *ConnectionHandler, _ []string) (string, error) {
+			ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+			if err != nil {
+				return "", err
+			}
+			sequence, err := h.duckHandler.lastSequence(ctx)
+			if err != nil {
+				return "", err
+			}
+			if sequence == "" {
+				return "", newPgError("55000", "lastval is not yet defined in this session")
+			}
+			return "currval(" + quoteSettingLiteral(sequence) + ")", nil
+		},
+	},
+	"current_schemas": {
+		NumArgs: 1,
+		Eval: func(h *ConnectionHandler, args []string) (string, error) {
+			includeImplicit, err := parseBoolSetting("current_schemas", strings.Trim(args[0], "'"))
+			if err != nil {
+				return "", err
+			}
+			ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+			if err != nil {
+				return "", err
+			}
+			var schemas []string
+			if includeImplicit {
+				schemas = append(schemas, quoteSettingLiteral("pg_catalog"))
+			}
+			if schema := adapter.GetCurrentSchema(ctx); schema != "" {
+				schemas = append(schemas, quoteSettingLiteral(schema))
+			}
+			return "[" + strings.Join(schemas, ", ") + "]::VARCHAR[]", nil
+		},
+	},
+	// row_count() and found_rows() are the MySQL functions of the metrics of the last statement, see recordQueryInfo.
+	"row_count":  queryInfoFunction(sql.RowCount),
+	"found_rows": queryInfoFunction(sql.FoundRows),
+}
+
+var sessionFuncRegex = func() *regexp.Regexp {
+	var names []string
+	for name := range sessionFunctions {
+		names = append(names, name)
+	}
+	// A call is preceded by neither a qualifier other than pg_catalog nor a part of an identifier.
+	// The arguments, if any, must be constants.
+	return regexp.MustCompile(`(?i)(^|[^\w.$"'])(?:pg_catalog\.)?(` + strings.Join(names, "|") + `)\b(\s*\(\s*((?:'(?:[^']|'')*'|[\w.+-]+)?)\s*\))?`)
+}()
+
+// selectItemEndRegex matches the text that follows an unaliased item of a select list.
+var selectItemEndRegex = regexp.MustCompile(`(?i)^\s*(,|;|\)|$|FROM\b|WHERE\b|UNION\b|ORDER\b|LIMIT\b)`)
+
+// selectItemStartRegex matches the text that precedes an item of a select list.
+var selectItemStartRegex = regexp.MustCompile(`(?i)(\bSELECT|,)\s*$`)
+
+// convertSessionFuncs replaces the calls of the session functions in the query with their values.
+// A call that is an item of a select list is aliased to the function name, as Postgres names the column.
+// The string literals and quoted identifiers in the query are left untouched.
+func (h *ConnectionHandler) convertSessionFuncs(query string) (string, error) {
+	var b strings.Builder
+	var err error
+	forEachUnquoted(query, func(segment string, quoted bool) {
+		if quoted || err != nil {
+			b.WriteString(segment)
+			return
+		}
+		matches := sessionFuncRegex.FindAllStringSubmatchIndex(segment, -1)
+		last := 0
+		for _, m := range matches {
+			name := strings.ToLower(segment[m[4]:m[5]])
+			fn := sessionFunctions[name]
+			hasParens := m[6] >= 0
+			var args []string
+			if hasParens && m[8] < m[9] {
+				args = []string{segment[m[8]:m[9]]}
+			}
+			if (!fn.Keyword && !hasParens) || len(args) != fn.NumArgs {
+				continue
+			}
+			var expr string
+			if expr, err = fn.Eval(h, args); err != nil {
+				return
+			}
+			b.WriteString(segment[last:m[3]])
+			b.WriteString(expr)
+			if selectItemStartRegex.MatchString(segment[:m[3]]) && selectItemEndRegex.MatchString(segment[m[1]:]) {
+				b.WriteString(` AS "` + name + `"`)
+			}
+			last = m[1]
+		}
+		b.WriteString(segment[last:])
+	})
+	return b.String(), err
+}
+
+// forEachUnquoted splits the query into the segments inside and outside
+// of the string literals and quoted identifiers, and calls fn for each of them in order.
+func forEachUnquoted(query string, fn func(segment string, quoted bool)) {
+	start := 0
+	for i := 0; i < len(query); i++ {
+		quote := query[i]
+		if quote != '\'' && quote != '"' {
+			continue
+		}
+		if i > start {
+			fn(query[start:i], false)
+		}
+		j := i + 1
+		for j < len(query) {
+			if query[j] == quote {
+				if j+1 < len(query) && query[j+1] == quote {
+					j += 2
+					continue
+				}
+				break
+			}
+			j++
+		}
+		end := min(j+1, len(query))
+		fn(query[i:end], true)
+		start, i = end, end-1
+	}
+	if start < len(query) {
+		fn(query[start:], false)
+	}
+}
+
+// setConfigRegex matches "SELECT set_config('name', 'value', is_local);".
+var setConfigRegex = regexp.MustCompile(`(?i)^\s*select\s+(?:pg_catalog\.)?set_config\(\s*'([^']+)'\s*,\s*'((?:[^']|'')*)'\s*,\s*(\w+)\s*\)\s*;?\s*$`)
+
+// setConfig implements set_config(name, value, is_local), which is equivalent to SET [LOCAL] name = value.
+// It returns the new value of the parameter.
+func (h *ConnectionHandler) setConfig(name, value string, local bool) (string, error) {
+	name = strings.ToLower(name)
+	if !pgconfig.IsValidPostgresConfigParameter(name) {
+		return "", newPgError("42704", `unrecognized configuration parameter "%s"`, name)
+	}
+	if local && !h.duckHandler.inTxnBlock {
+		// The setting would be reverted at the end of the implicit transaction immediately.
+		return value, nil
+	}
+	v, err := h.applyPgSessionVar(name, value, false, local)
+	if err != nil {
+		return "", err
+	}
+	setting := fmt.Sprintf("%v", v)
+	if err := h.sendParameterStatus(name, setting); err != nil {
+		return "", err
+	}
+	return setting, nil
+}
@@ -0,0 +1,38 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/dolthub/vitess/go/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertSessionFuncs(t *testing.T) {
+	h := &ConnectionHandler{mysqlConn: &mysql.Conn{User: "alice", ConnectionID: 42}}
+	version := quoteSettingLiteral(versionString)
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT current_user", `SELECT 'alice' AS "current_user"`},
+		{"SELECT session_user, pg_backend_pid();", `SELECT 'alice' AS "session_user", 42::INTEGER AS "pg_backend_pid";`},
+		{"SELECT pg_catalog.version() AS v", "SELECT " + version + " AS v"},
+		{"SELECT upper(version()) FROM t", "SELECT upper(" + version + ") FROM t"},
+		{"SELECT * FROM t WHERE owner = current_user", "SELECT * FROM t WHERE owner = 'alice'"},
+		{"SELECT pg_catalog.txid_current()", `SELECT txid_current() AS "txid_current"`},
+		// Not calls of the session functions.
+		{"SELECT version FROM t", "SELECT version FROM t"},
+		{"SELECT s.version() FROM t", "SELECT s.version() FROM t"},
+		{"SELECT 'current_user', \"current_user\" FROM t", "SELECT 'current_user', \"current_user\" FROM t"},
+		{"SELECT my_current_user FROM t", "SELECT my_current_user FROM t"},
+		{"SELECT version(1)", "SELECT version(1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			converted, err := h.convertSessionFuncs(tt.query)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, converted)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package pgserver
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/apecloud/myduckserver/pgserver/pgconfig"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/dolthub/vitess/go/sqltypes"
+)
+
+// parseBoolSetting parses the boolean value of a setting the same way as Postgres, i.e.,
+// `on`, `off`, `1`, `0`, and the unique prefixes of `true`, `false`, `yes`, and `no`, case-insensitively.
+func parseBoolSetting(name string, v any) (bool, error) {
+	s := strings.ToLower(strings.TrimSpace(fmt.Sprintf("%v", v)))
+	switch {
+	case s == "1" || s == "on":
+		return true, nil
+	case s == "0" || s == "of" || s == "off":
+		return false, nil
+	case s != "" && (strings.HasPrefix("true", s) || strings.HasPrefix("yes", s)):
+		return true, nil
+	case s != "" && (strings.HasPrefix("false", s) || strings.HasPrefix("no", s)):
+		return false, nil
+	}
+	return false, newPgError("22023", `parameter "%s" requires a Boolean value`, name)
+}
+
+// setValueString returns the text form of the values of `SET name = v1, v2, ...`. Only the list parameters
+// take multiple values, which are joined with ", ", and quoted as identifiers if the parameter requires so.
+func setValueString(name string, values tree.Exprs) (string, error) {
+	list, quoted := pgconfig.IsListParameter(name)
+	if len(values) == 0 || (len(values) > 1 && !list) {
+		return "", newPgError("22023", "SET %s takes only one argument", name)
+	}
+	elems := make([]string, len(values))
+	for i, value := range values {
+		var s string
+		switch val := value.(type) {
+		case *tree.UnresolvedName:
+			if val.NumParts != 1 {
+				return "", newPgError("22023", `invalid value for parameter "%s": "%s"`, name, val)
+			}
+			s = val.Parts[0]
+		case *tree.StrVal:
+			s = val.RawString()
+		case *tree.NumVal:
+			s = val.String()
+		case *tree.DBool:
+			s = strconv.FormatBool(bool(*val))
+		case tree.DefaultVal:
+			return "", newPgError("42601", "DEFAULT cannot be a part of the list of values of parameter \"%s\"", name)
+		default:
+			if value == tree.DNull {
+				return "", newPgError("22023", `parameter "%s" cannot be set to NULL`, name)
+			}
+			s = fmt.Sprintf("%v", val)
+		}
+		if quoted {
+			s = quoteSettingIdentifier(s)
+		}
+		elems[i] = s
+	}
+	return strings.Join(elems, ", "), nil
+}
+
+var plainIdentifierRegex = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// quoteSettingIdentifier quotes an element of a list setting like search_path if it is not a plain lower-case identifier.
+func quoteSettingIdentifier(s string) string {
+	if plainIdentifierRegex.MatchString(s) {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// parsePgSetting converts the text form of the value of a parameter to the value of its type.
+// The numeric values may have a unit, e.g., '4MB' or '30s', which is converted to the unit of the parameter.
+func parsePgSetting(p *pgconfig.Parameter, value string) (any, error) {
+	if _, ok := p.Type.(types.SystemBoolType); ok {
+		b, err := parseBoolSetting(p.Name, value)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return int8(1), nil
+		}
+		return int8(0), nil
+	}
+
+	var v any = value
+	switch p.Type.Type() {
+	case sqltypes.Int64, sqltypes.Float64:
+		f, err := parseSettingNumber(p.Name, p.Unit, value)
+		if err != nil {
+			return nil, err
+		}
+		v = f
+		if p.Type.Type() == sqltypes.Int64 {
+			// Same as Postgres, a fractional value is rounded to the nearest integer.
+			f = math.RoundToEven(f)
+			if f < math.MinInt64 || f >= math.MaxInt64 {
+				return nil, newPgError("22003", `value is out of range for parameter "%s": "%s"`, p.Name, value)
+			}
+			v = int64(f)
+		}
+	}
+	converted, _, err := p.Type.Convert(v)
+	if err != nil {
+		switch v.(type) {
+		case int64, float64:
+			unit := p.Unit
+			if unit != "" {
+				unit = " " + unit
+			}
+			return nil, newPgError("22023", `%v%s is outside the valid range for parameter "%s"`, v, unit, p.Name)
+		}
+		return nil, newPgError("22023", `invalid value for parameter "%s": "%s"`, p.Name, value)
+	}
+	return converted, nil
+}
+
+var settingNumberRegex = regexp.MustCompile(`^\s*([-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?)\s*([a-zA-Z]*)\s*$`)
+
+// The sizes of the memory units and the time units in bytes and in milliseconds, respectively.
+var (
+	memoryUnits = map[string]float64{"B": 1, "kB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40}
+	timeUnits   = map[string]float64{"us": 0.001, "ms": 1, "s": 1000, "min": 60 * 1000, "h": 60 * 60 * 1000, "d": 24 * 60 * 60 * 1000}
+)
+
+// parseSettingNumber parses a numeric value with an optional unit, and returns it in the given unit of the parameter.
+// The units are case-sensitive, e.g., 'kB' but not 'KB', the same as Postgres.
+func parseSettingNumber(name, unit, value string) (float64, error) {
+	invalid := newPgError("22023", `invalid value for parameter "%s": "%s"`, name, value)
+	m := settingNumberRegex.FindStringSubmatch(value)
+	if m == nil {
+		return 0, invalid
+	}
+	f, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, invalid
+	}
+	if m[2] == "" {
+		return f, nil
+	}
+
+	// A unit like "8kB" is a multiple of a base unit.
+	baseUnit := strings.TrimLeft(unit, "0123456789")
+	multiple := 1.0
+	if n := unit[:len(unit)-len(baseUnit)]; n != "" {
+		multiple, _ = strconv.ParseFloat(n, 64)
+	}
+	units := memoryUnits
+	if _, ok := memoryUnits[baseUnit]; !ok {
+		units = timeUnits
+	}
+	from, ok := units[m[2]]
+	to, ok2 := units[baseUnit]
+	if !ok || !ok2 {
+		return 0, invalid
+	}
+	return f * from / (to * multiple), nil
+}
@@ -0,0 +1,112 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/pgserver/pgconfig"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func requirePgErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	require.Equal(t, code, pgErr.Code, pgErr.Message)
+}
+
+func TestParseBoolSetting(t *testing.T) {
+	for _, s := range []string{"on", "ON", "true", "t", "tr", "yes", "y", "1", " True "} {
+		b, err := parseBoolSetting("p", s)
+		require.NoError(t, err, s)
+		require.True(t, b, s)
+	}
+	for _, s := range []string{"off", "of", "false", "f", "no", "n", "0"} {
+		b, err := parseBoolSetting("p", s)
+		require.NoError(t, err, s)
+		require.False(t, b, s)
+	}
+	for _, s := range []string{"", "o", "2", "truee", "enabled"} {
+		_, err := parseBoolSetting("p", s)
+		requirePgErrorCode(t, err, "22023")
+	}
+}
+
+func TestSetValueString(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		code  string
+	}{
+		{query: "SET search_path = a, \"B\", 'c d', public", want: `a, "B", "c d", public`},
+		{query: "SET search_path TO '$user'", want: `"$user"`},
+		{query: "SET datestyle = iso, mdy", want: "iso, mdy"},
+		{query: "SET application_name = 'It''s'", want: "It's"},
+		{query: "SET enable_seqscan = on", want: "on"},
+		{query: "SET enable_seqscan TO false", want: "false"},
+		{query: "SET work_mem = 4096", want: "4096"},
+		{query: "SET extra_float_digits = -1", want: "-1"},
+		{query: "SET work_mem = 1, 2", code: "22023"},
+		{query: "SET application_name = NULL", code: "22023"},
+		{query: "SET application_name = a.b", code: "22023"},
+	}
+	for _, tt := range tests {
+		stmts, err := parser.Parse(tt.query)
+		require.NoError(t, err, tt.query)
+		stmt := stmts[0].AST.(*tree.SetVar)
+		got, err := setValueString(stmt.Name, stmt.Values)
+		if tt.code != "" {
+			requirePgErrorCode(t, err, tt.code)
+			continue
+		}
+		require.NoError(t, err, tt.query)
+		require.Equal(t, tt.want, got, tt.query)
+	}
+}
+
+func TestParsePgSetting(t *testing.T) {
+	params := make(map[string]*pgconfig.Parameter)
+	for _, p := range pgconfig.Parameters() {
+		params[p.Name] = p
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  any
+		code  string
+	}{
+		{name: "enable_seqscan", value: "off", want: int8(0)},
+		{name: "enable_seqscan", value: "Yes", want: int8(1)},
+		{name: "enable_seqscan", value: "maybe", code: "22023"},
+		{name: "work_mem", value: "4096", want: int64(4096)},
+		{name: "work_mem", value: "4MB", want: int64(4096)},
+		{name: "work_mem", value: "1.5 GB", want: int64(1572864)},
+		{name: "work_mem", value: "65536B", want: int64(64)},
+		{name: "work_mem", value: "4mb", code: "22023"},
+		{name: "work_mem", value: "4s", code: "22023"},
+		{name: "work_mem", value: "lots", code: "22023"},
+		{name: "work_mem", value: "1kB", code: "22023"},
+		{name: "shared_buffers", value: "128MB", want: int64(16384)},
+		{name: "statement_timeout", value: "1min", want: int64(60000)},
+		{name: "statement_timeout", value: "250", want: int64(250)},
+		{name: "extra_float_digits", value: "2", want: int64(2)},
+		{name: "extra_float_digits", value: "2kB", code: "22023"},
+		{name: "client_min_messages", value: "WARNING", want: "warning"},
+		{name: "client_min_messages", value: "loud", code: "22023"},
+		{name: "application_name", value: "4MB", want: "4MB"},
+	}
+	for _, tt := range tests {
+		p := params[tt.name]
+		require.NotNil(t, p, tt.name)
+		got, err := parsePgSetting(p, tt.value)
+		if tt.code != "" {
+			requirePgErrorCode(t, err, tt.code)
+			continue
+		}
+		require.NoError(t, err, "%s = %s", tt.name, tt.value)
+		require.Equal(t, tt.want, got, "%s = %s", tt.name, tt.value)
+	}
+}
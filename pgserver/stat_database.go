@@ -0,0 +1,255 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// pg_stat_database reports the activity of the Postgres sessions in each database, i.e., DuckDB catalog,
+// since the server started. DuckDB does not track most of the statistics of Postgres, so some are proxies:
+//   - tup_returned is the number of rows returned to the clients.
+//   - tup_fetched is the number of rows scanned by DuckDB, and blks_read is the number of vectors of them.
+//     They are taken from the query profiles, so only the sessions with myduck.profiling on contribute to them.
+//   - The counters that have no equivalent in DuckDB, e.g., blks_hit and deadlocks, are always 0.
+
+// pgStatDatabaseRegex matches the references to the pg_stat_database view.
+var pgStatDatabaseRegex = regexp.MustCompile(`(?i)\b(FROM|JOIN)\s+(?:pg_catalog\.)?(?:"pg_stat_database"|pg_stat_database\b)`)
+
+// pgStatDatabaseView is the per-connection temporary view that backs pg_stat_database.
+// Like pg_settings, it is recreated before each query that reads pg_stat_database.
+const pgStatDatabaseView = "temp.main.pg_stat_database"
+
+// vectorSize is the number of rows in a vector of DuckDB, which stands for a block in pg_stat_database.
+const vectorSize = 2048
+
+// databaseStats are the counters of pg_stat_database of a database.
+type databaseStats struct {
+	numBackends  atomic.Int64
+	sessions     atomic.Int64
+	xactCommit   atomic.Int64
+	xactRollback atomic.Int64
+	blksRead     atomic.Int64
+	tupReturned  atomic.Int64
+	tupFetched   atomic.Int64
+	tupInserted  atomic.Int64
+	tupUpdated   atomic.Int64
+	tupDeleted   atomic.Int64
+	// sessionTime and activeTime are in microseconds.
+	sessionTime atomic.Int64
+	activeTime  atomic.Int64
+}
+
+var (
+	databaseStatsMu sync.Mutex
+	databaseStatsOf = make(map[string]*databaseStats)
+	statsResetTime  = time.Now()
+)
+
+// statsOfDatabase returns the counters of the database, which are created on the first use.
+func statsOfDatabase(name string) *databaseStats {
+	databaseStatsMu.Lock()
+	defer databaseStatsMu.Unlock()
+	stats, ok := databaseStatsOf[name]
+	if !ok {
+		stats = &databaseStats{}
+		databaseStatsOf[name] = stats
+	}
+	return stats
+}
+
+// startSession counts a new session in the database, which ends with endSession.
+func (h *DuckHandler) startSession(database string) {
+	h.stats = statsOfDatabase(database)
+	h.stats.numBackends.Add(1)
+	h.stats.sessions.Add(1)
+	h.sessionStart = time.Now()
+}
+
+func (h *DuckHandler) endSession() {
+	if h.stats == nil {
+		return
+	}
+	h.stats.numBackends.Add(-1)
+	h.stats.sessionTime.Add(time.Since(h.sessionStart).Microseconds())
+	h.stats = nil
+}
+
+// countStatement counts the statement in the status variables shown by SHOW STATUS.
+func countStatement(ctx *sql.Context, parsed tree.Statement) {
+	sql.IncrementStatusVariable(ctx, "Questions", 1)
+	var name string
+	switch parsed.(type) {
+	case *tree.Select:
+		name = "Com_select"
+	case *tree.Insert:
+		name = "Com_insert"
+	case *tree.Update:
+		name = "Com_update"
+	case *tree.Delete:
+		name = "Com_delete"
+	case *tree.BeginTransaction:
+		name = "Com_begin"
+	case *tree.CommitTransaction:
+		name = "Com_commit"
+	case *tree.RollbackTransaction:
+		name = "Com_rollback"
+	case *tree.SetVar:
+		name = "Com_set_option"
+	default:
+		return
+	}
+	sql.IncrementStatusVariable(ctx, name, 1)
+}
+
+// countTransaction counts the transaction ended by the statement, given whether the session was in a transaction
+// block and whether the block had failed before the statement. A statement outside a block is a transaction itself.
+func (h *DuckHandler) countTransaction(parsed tree.Statement, inTxnBlock bool, txnFailed bool, err error) {
+	if h.stats == nil {
+		return
+	}
+	switch parsed.(type) {
+	case *tree.BeginTransaction:
+		return
+	case *tree.CommitTransaction:
+		if !inTxnBlock {
+			return
+		}
+		if err == nil && !txnFailed {
+			h.stats.xactCommit.Add(1)
+		} else {
+			h.stats.xactRollback.Add(1)
+		}
+	case *tree.RollbackTransaction:
+		if inTxnBlock {
+			h.stats.xactRollback.Add(1)
+		}
+	default:
+		if inTxnBlock {
+			return
+		}
+		if err == nil {
+			h.stats.xactCommit.Add(1)
+		} else {
+			h.stats.xactRollback.Add(1)
+		}
+	}
+}
+
+// countRows wraps the callback of a statement to count the rows returned to the client or modified by it.
+func (h *DuckHandler) countRows(parsed tree.Statement, callback func(*Result) error) func(*Result) error {
+	stats := h.stats
+	if stats == nil {
+		return callback
+	}
+	return func(r *Result) error {
+		if r != nil {
+			if len(r.Fields) > 0 {
+				stats.tupReturned.Add(int64(len(r.Rows)))
+			} else {
+				switch parsed.(type) {
+				case *tree.Insert:
+					stats.tupInserted.Add(int64(r.RowsAffected))
+				case *tree.Update:
+					stats.tupUpdated.Add(int64(r.RowsAffected))
+				case *tree.Delete:
+					stats.tupDeleted.Add(int64(r.RowsAffected))
+				}
+			}
+		}
+		return callback(r)
+	}
+}
+
+// countProfile counts the rows scanned by a query from its profile metrics.
+func (h *DuckHandler) countProfile(metrics map[string]string) {
+	if h.stats == nil {
+		return
+	}
+	scanned, err := strconv.ParseInt(metrics["CUMULATIVE_ROWS_SCANNED"], 10, 64)
+	if err != nil || scanned <= 0 {
+		return
+	}
+	h.stats.tupFetched.Add(scanned)
+	h.stats.blksRead.Add((scanned + vectorSize - 1) / vectorSize)
+}
+
+// pgStatDatabaseQuery returns the query of pg_stat_database with the current counters.
+func pgStatDatabaseQuery() string {
+	databaseStatsMu.Lock()
+	names := make([]string, 0, len(databaseStatsOf))
+	for name := range databaseStatsOf {
+		names = append(names, name)
+	}
+	databaseStatsMu.Unlock()
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("SELECT d.database_oid AS datid, d.database_name AS datname, coalesce(s.numbackends, 0)::INTEGER AS numbackends")
+	for _, name := range []string{"xact_commit", "xact_rollback", "blks_read"} {
+		fmt.Fprintf(&b, ", coalesce(s.%s, 0)::BIGINT AS %s", name, name)
+	}
+	b.WriteString(", 0::BIGINT AS blks_hit")
+	for _, name := range []string{"tup_returned", "tup_fetched", "tup_inserted", "tup_updated", "tup_deleted"} {
+		fmt.Fprintf(&b, ", coalesce(s.%s, 0)::BIGINT AS %s", name, name)
+	}
+	b.WriteString(", 0::BIGINT AS conflicts, 0::BIGINT AS temp_files, 0::BIGINT AS temp_bytes, 0::BIGINT AS deadlocks")
+	b.WriteString(", NULL::BIGINT AS checksum_failures, NULL::TIMESTAMPTZ AS checksum_last_failure")
+	b.WriteString(", 0::DOUBLE AS blk_read_time, 0::DOUBLE AS blk_write_time")
+	b.WriteString(", coalesce(s.session_time, 0)::DOUBLE AS session_time, coalesce(s.active_time, 0)::DOUBLE AS active_time")
+	b.WriteString(", 0::DOUBLE AS idle_in_transaction_time")
+	b.WriteString(", coalesce(s.sessions, 0)::BIGINT AS sessions, 0::BIGINT AS sessions_abandoned, 0::BIGINT AS sessions_fatal, 0::BIGINT AS sessions_killed")
+	fmt.Fprintf(&b, ", '%s'::TIMESTAMPTZ AS stats_reset", statsResetTime.UTC().Format(time.RFC3339Nano))
+	b.WriteString(" FROM duckdb_databases() d")
+	if len(names) > 0 {
+		b.WriteString(" LEFT JOIN (VALUES ")
+		for i, name := range names {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			s := statsOfDatabase(name)
+			fmt.Fprintf(&b, "(%s, %d, %d, %d, %d, %d, %d, %d, %d, %d, %d, %.3f, %.3f)",
+				quoteSettingLiteral(name),
+				s.numBackends.Load(), s.sessions.Load(), s.xactCommit.Load(), s.xactRollback.Load(), s.blksRead.Load(),
+				s.tupReturned.Load(), s.tupFetched.Load(), s.tupInserted.Load(), s.tupUpdated.Load(), s.tupDeleted.Load(),
+				float64(s.sessionTime.Load())/1000, float64(s.activeTime.Load())/1000,
+			)
+		}
+		b.WriteString(") AS s(datname, numbackends, sessions, xact_commit, xact_rollback, blks_read,")
+		b.WriteString(" tup_returned, tup_fetched, tup_inserted, tup_updated, tup_deleted, session_time, active_time)")
+		b.WriteString(" ON d.database_name = s.datname")
+	}
+	b.WriteString(" WHERE NOT d.internal ORDER BY datid")
+	return b.String()
+}
+
+// createPgStatDatabaseView (re)creates the temporary view that backs pg_stat_database for the current session.
+func (h *ConnectionHandler) createPgStatDatabaseView() error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	_, err = adapter.Exec(ctx, "CREATE OR REPLACE TEMP VIEW pg_stat_database AS "+pgStatDatabaseQuery())
+	return err
+}
+
+// convertPgStatDatabase replaces the references to pg_stat_database in the query with the temporary view.
+func convertPgStatDatabase(query string) string {
+	return pgStatDatabaseRegex.ReplaceAllString(query, "$1 "+pgStatDatabaseView)
+}
+
+// inlinePgStatDatabase replaces the references to pg_stat_database in the query with the subquery of the current
+// counters, without creating any temporary objects in the session, see inlinePgSettings.
+func inlinePgStatDatabase(query string) string {
+	return inlineView(query, pgStatDatabaseRegex, pgStatDatabaseQuery(), "pg_stat_database")
+}
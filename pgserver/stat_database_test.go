@@ -0,0 +1,53 @@
+package pgserver
+
+import (
+	stdsql "database/sql"
+	"errors"
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgStatDatabase(t *testing.T) {
+	connector, err := duckdb.NewConnector("", nil)
+	require.NoError(t, err)
+	defer connector.Close()
+	db := stdsql.OpenDB(connector)
+	defer db.Close()
+
+	h := &DuckHandler{}
+	h.startSession("memory")
+
+	// A statement outside a transaction block is a transaction itself.
+	h.countTransaction(&tree.Insert{}, false, false, nil)
+	h.countTransaction(&tree.Select{}, false, false, errors.New("failed"))
+	// BEGIN; ...; COMMIT of a failed block is a rollback.
+	h.countTransaction(&tree.BeginTransaction{}, false, false, nil)
+	h.countTransaction(&tree.Insert{}, true, false, errors.New("failed"))
+	h.countTransaction(&tree.CommitTransaction{}, true, true, nil)
+
+	callback := h.countRows(&tree.Insert{}, func(*Result) error { return nil })
+	require.NoError(t, callback(&Result{RowsAffected: 3}))
+	callback = h.countRows(&tree.Select{}, func(*Result) error { return nil })
+	require.NoError(t, callback(&Result{Fields: make([]pgproto3.FieldDescription, 1), Rows: make([]Row, 2)}))
+	h.countProfile(map[string]string{"CUMULATIVE_ROWS_SCANNED": "5000"})
+
+	query := "SELECT datname, numbackends, xact_commit, xact_rollback, blks_read, tup_returned, tup_fetched, tup_inserted, sessions FROM pg_stat_database"
+	var (
+		datname                                                     string
+		numbackends                                                 int32
+		commits, rollbacks, blks, returned, fetched, inserted, sess int64
+	)
+	require.NoError(t, db.QueryRow(inlinePgStatDatabase(query)).Scan(
+		&datname, &numbackends, &commits, &rollbacks, &blks, &returned, &fetched, &inserted, &sess))
+	require.Equal(t, "memory", datname)
+	require.Equal(t, []int64{1, 2, 3, 2, 5000, 3, 1}, []int64{commits, rollbacks, blks, returned, fetched, inserted, sess})
+	require.Equal(t, int32(1), numbackends)
+
+	h.endSession()
+	require.NoError(t, db.QueryRow(inlinePgStatDatabase("SELECT numbackends FROM pg_catalog.pg_stat_database d WHERE d.datname = 'memory'")).Scan(&numbackends))
+	require.Equal(t, int32(0), numbackends)
+}
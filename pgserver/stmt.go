@@ -278,7 +278,7 @@ func getPgCatalogRegex() *regexp.Regexp {
 			}
 			internalNames = append(internalNames, table.Name)
 		}
-		for _, view := range catalog.InternalViews {
+		for _, view := range catalog.GetInternalViews() {
 			if view.Schema != "__sys__" {
 				continue
 			}
@@ -374,7 +374,7 @@ var (
 func getRenamePgCatalogFuncRegex() *regexp.Regexp {
 	initRenameMacroRegex.Do(func() {
 		var internalNames []string
-		for _, view := range catalog.InternalMacros {
+		for _, view := range catalog.GetInternalMacros() {
 			if strings.ToLower(view.Schema) != "pg_catalog" {
 				continue
 			}
@@ -387,8 +387,8 @@ func getRenamePgCatalogFuncRegex() *regexp.Regexp {
 		// Compile the regex
 		// The pattern matches:
 		// - Branch A: "pg_catalog.<funcName>("
-		// - Branch B: "<funcName>(" without a preceding "."
-		pattern := `(?i)(?:pg_catalog\.("?(?:` + namesAlt + `)"?)\(|(^|[^\.])("?(?:` + namesAlt + `)"?)\()`
+		// - Branch B: "<funcName>(" without a preceding "." or a part of another name
+		pattern := `(?i)(?:pg_catalog\.("?(?:` + namesAlt + `)"?)\(|(^|[^\.\w])("?(?:` + namesAlt + `)"?)\()`
 		renameMacroRegex = regexp.MustCompile(pattern)
 	})
 	return renameMacroRegex
@@ -411,21 +411,29 @@ func getRenamePgCatalogFuncRegex() *regexp.Regexp {
 //	pg_catalog.xyz(456) AS result4
 func ConvertPgCatalogFuncToSys(sql string) string {
 	re := getRenamePgCatalogFuncRegex()
+	// A match consumes the "(" that may precede the next function name, e.g., in "f(g(",
+	// so the replacement is repeated until no name is left. The renamed ones never match again.
+	for {
+		converted := renamePgCatalogFuncs(re, sql)
+		if converted == sql {
+			return converted
+		}
+		sql = converted
+	}
+}
+
+func renamePgCatalogFuncs(re *regexp.Regexp, sql string) string {
 	return re.ReplaceAllStringFunc(sql, func(m string) string {
 		sub := re.FindStringSubmatch(m)
 		// sub[1]  => Function name from branch A (pg_catalog.<func>)
-		// sub[2]  => Matches from branch B (^|[^.]), not the function name
+		// sub[2]  => Matches from branch B (^|[^.\w]), not the function name
 		// sub[3]  => Function name from branch B
-		var funcName string
 		if sub[1] != "" {
 			// Matched branch A
-			funcName = sub[1]
-		} else {
-			// Matched branch B
-			funcName = sub[3]
+			return "__sys__." + sub[1] + "("
 		}
-		// Return __sys__.<funcName>(
-		return "__sys__." + funcName + "("
+		// Matched branch B, whose preceding character is kept
+		return sub[2] + "__sys__." + sub[3] + "("
 	})
 }
 
@@ -463,7 +471,7 @@ func getPgFuncRegex() *regexp.Regexp {
 	initMacroRegex.Do(func() {
 		// Collect the fully qualified names of all macros.
 		var macroPatterns []string
-		for _, macro := range catalog.InternalMacros {
+		for _, macro := range catalog.GetInternalMacros() {
 			if macro.IsTableMacro {
 				qualified := regexp.QuoteMeta(macro.QualifiedName())
 				macroPatterns = append(macroPatterns, qualified)
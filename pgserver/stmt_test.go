@@ -180,3 +180,24 @@ func TestRemoveComments(t *testing.T) {
 		})
 	}
 }
+
+func TestConvertPgCatalogFuncToSys(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT pg_is_in_recovery()", "SELECT __sys__.pg_is_in_recovery()"},
+		{"SELECT pg_catalog.pg_current_wal_lsn()", "SELECT __sys__.pg_current_wal_lsn()"},
+		{"SELECT (pg_last_wal_replay_lsn())", "SELECT (__sys__.pg_last_wal_replay_lsn())"},
+		{"SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), '0/0')", "SELECT __sys__.pg_wal_lsn_diff(__sys__.pg_current_wal_lsn(), '0/0')"},
+		{"SELECT x_pg_is_in_recovery()", "SELECT x_pg_is_in_recovery()"},
+		{"SELECT s.pg_is_in_recovery()", "SELECT s.pg_is_in_recovery()"},
+	}
+
+	for _, tt := range tests {
+		got := ConvertPgCatalogFuncToSys(tt.query)
+		if got != tt.want {
+			t.Errorf("ConvertPgCatalogFuncToSys(%q) = %q; want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package pgserver
+
+import (
+	"context"
+
+	"github.com/apecloud/myduckserver/backend"
+)
+
+// execStorageStatement executes CHECKPOINT or VACUUM, see backend/storage_maintenance.go.
+func (h *ConnectionHandler) execStorageStatement(query string) (bool, error) {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, query)
+	if err != nil {
+		return false, err
+	}
+	tag, ok, err := backend.ExecStorageStatement(ctx, h.duckHandler.e.Analyzer.Catalog.MySQLDb, query)
+	if !ok || err != nil {
+		return false, err
+	}
+	return true, h.send(makeCommandComplete(tag, 0))
+}
@@ -0,0 +1,321 @@
+package pgserver
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/binlogreplication"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// `BACKUP DATABASE db TO STDOUT` streams a backup of a running server to the client in a binary COPY, so that
+// a replica can be bootstrapped from the server without a shared object storage, see FetchBackup. The data file is
+// checkpointed and copied like the backup to the object storage, and the backup is a tar archive of the copy and of
+// the key that encrypts the password of the binlog replication source, without which the new replica cannot connect
+// to the source. The server is read-only only while the data file is copied locally, not while it is streamed.
+//
+// The new replica must not stream from the replication slots of the subscriptions of the server, which the server
+// keeps streaming from. So the slots are copied on the primaries while the subscriptions are paused, and the copies
+// are recorded as the slots of the subscriptions in the backup, see logrepl.ForkSlots. The copies are dropped if the
+// backup fails to be streamed, but they are left on the primaries if the new replica never starts.
+
+// streamChunkSize is the size of the CopyData messages of a streamed backup.
+const streamChunkSize = 1 << 20
+
+// The entries of the archive of a streamed backup.
+const (
+	backupArchiveDataFile  = "data.db"
+	backupArchiveSourceKey = "source-key"
+)
+
+// streamBackup copies the data file into a temporary directory and streams it to the client.
+func (h *ConnectionHandler) streamBackup(backupConfig *BackupConfig) (err error) {
+	sqlCtx, err := h.duckHandler.sm.NewContextWithQuery(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return fmt.Errorf("failed to create context for query: %w", err)
+	}
+
+	startedAt := time.Now()
+	var msg string
+	defer func() {
+		recordBackup(sqlCtx, backupConfig, startedAt, msg, err)
+	}()
+
+	dataDir := h.server.Provider.DataDir()
+	dir, err := os.MkdirTemp(dataDir, ".backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, backupArchiveDataFile)
+
+	forked, err := h.copyDataFile(sqlCtx, backupConfig.DbName, path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if dropErr := logrepl.DropForkedSlots(sqlCtx, forked); dropErr != nil {
+				sqlCtx.GetLogger().WithError(dropErr).Warn("Failed to drop the replication slots of the streamed backup")
+			}
+		}
+	}()
+	if err := recordForkedSlots(sqlCtx, path, fmt.Sprintf("__sys_backup_%d__", h.mysqlConn.ConnectionID), forked); err != nil {
+		return fmt.Errorf("failed to record the replication slots of the backup: %w", err)
+	}
+
+	if err := h.send(&pgproto3.CopyOutResponse{
+		OverallFormat:     1,
+		ColumnFormatCodes: []uint16{1},
+	}); err != nil {
+		return err
+	}
+	out := bufio.NewWriterSize(copyDataWriter{h}, streamChunkSize)
+	size, err := writeBackupArchive(out, path, binlogreplication.SourceKeyFile(dataDir))
+	if err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if err := h.send(&pgproto3.CopyDone{}); err != nil {
+		return err
+	}
+	msg = fmt.Sprintf("streamed %d bytes to the client", size)
+	return h.send(makeCommandComplete("COPY", 0))
+}
+
+// copyDataFile checkpoints the data file of the database and copies it to the given path, like executeBackup, and
+// copies the replication slots of the subscriptions for the new replica meanwhile. The server is left writable and
+// its subscriptions are resumed afterward, even if the copy fails.
+func (h *ConnectionHandler) copyDataFile(sqlCtx *sql.Context, dbName, path string) (forked map[string]string, err error) {
+	logrepl.PauseSubscriptions()
+	defer logrepl.ResumeSubscriptions(sqlCtx)
+
+	if err := doCheckpoint(sqlCtx); err != nil {
+		return nil, fmt.Errorf("failed to do checkpoint: %w", err)
+	}
+	forked, err = logrepl.ForkSlots(sqlCtx, uuid.NewString()[:8])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.restartServer(true); err != nil {
+		return nil, errors.Join(err, logrepl.DropForkedSlots(sqlCtx, forked))
+	}
+	err = copyFile(filepath.Join(h.server.Provider.DataDir(), dbName+".db"), path)
+	if restartErr := h.restartServer(false); restartErr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to restart server: %w", restartErr))
+	}
+	if err != nil {
+		return nil, errors.Join(err, logrepl.DropForkedSlots(sqlCtx, forked))
+	}
+	return forked, nil
+}
+
+// recordForkedSlots records the copies of the replication slots in the copied data file, which is attached under
+// the given alias meanwhile. The data file is checkpointed when it is detached, so it is complete without its WAL file.
+func recordForkedSlots(sqlCtx *sql.Context, path, alias string, forked map[string]string) error {
+	if len(forked) == 0 {
+		return nil
+	}
+	conn, err := adapter.GetCatalogConn(sqlCtx)
+	if err != nil {
+		return err
+	}
+	quotedAlias := catalog.QuoteIdentifierANSI(alias)
+	if _, err := conn.ExecContext(sqlCtx, "ATTACH "+quoteSettingLiteral(path)+" AS "+quotedAlias); err != nil {
+		return err
+	}
+	err = logrepl.RecordForkedSlots(sqlCtx, conn, alias, forked)
+	if _, detachErr := conn.ExecContext(sqlCtx, "DETACH "+quotedAlias); err == nil {
+		err = detachErr
+	}
+	return err
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyDataWriter sends the written bytes to the client in CopyData messages.
+type copyDataWriter struct {
+	h *ConnectionHandler
+}
+
+func (w copyDataWriter) Write(p []byte) (int, error) {
+	if err := w.h.send(&pgproto3.CopyData{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeBackupArchive writes the archive of the data file and of the source key, if it exists, and returns the size
+// of the data file.
+func writeBackupArchive(w io.Writer, dataFile, sourceKeyFile string) (int64, error) {
+	tw := tar.NewWriter(w)
+	file, err := os.Open(dataFile)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: backupArchiveDataFile, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(tw, file)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := os.ReadFile(sourceKeyFile)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if key != nil {
+		if err := tw.WriteHeader(&tar.Header{Name: backupArchiveSourceKey, Mode: 0600, Size: int64(len(key))}); err != nil {
+			return 0, err
+		}
+		if _, err := tw.Write(key); err != nil {
+			return 0, err
+		}
+	}
+	return size, tw.Close()
+}
+
+// extractBackupArchive extracts the archive written by writeBackupArchive into the data file localDir/localFile
+// and the source key of the data directory, and returns the size of the data file. They are replaced only after
+// the whole archive is read, so that a broken stream never leaves a partial data file.
+func extractBackupArchive(r io.Reader, localDir, localFile string) (int64, error) {
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(localDir, localFile+".part-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var size int64 = -1
+	var key []byte
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		switch hdr.Name {
+		case backupArchiveDataFile:
+			if size, err = io.Copy(tmp, tr); err != nil {
+				return 0, err
+			}
+		case backupArchiveSourceKey:
+			if key, err = io.ReadAll(tr); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("unexpected entry %q in the backup", hdr.Name)
+		}
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("the backup has no data file")
+	}
+	if err := tmp.Sync(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	if key != nil {
+		keyFile := binlogreplication.SourceKeyFile(localDir)
+		if err := os.MkdirAll(filepath.Dir(keyFile), 0755); err != nil {
+			return 0, err
+		}
+		if err := os.WriteFile(keyFile, key, 0600); err != nil {
+			return 0, err
+		}
+	}
+	// The WAL file of a previous data file must not be replayed on the new one.
+	target := filepath.Join(localDir, localFile)
+	if err := os.Remove(target + ".wal"); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// FetchBackup bootstraps a data directory from a running server, which is given by the connection string,
+// by streaming a backup of the database of the connection string into localDir/localFile.
+// It returns the size of the data file.
+func FetchBackup(connString, localDir, localFile string) (int64, error) {
+	ctx := context.Background()
+	config, err := pgconn.ParseConfig(connString)
+	if err != nil {
+		return 0, fmt.Errorf("invalid connection string: %w", err)
+	}
+	if config.Database == "" {
+		return 0, fmt.Errorf("the database to bootstrap from is not given in the connection string")
+	}
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to %s: %w", config.Host, err)
+	}
+	defer conn.Close(ctx)
+
+	type result struct {
+		size int64
+		err  error
+	}
+	pr, pw := io.Pipe()
+	extracted := make(chan result, 1)
+	go func() {
+		size, err := extractBackupArchive(pr, localDir, localFile)
+		// Unblock the stream if the archive is not read to the end.
+		pr.CloseWithError(err)
+		extracted <- result{size, err}
+	}()
+
+	stmt := "BACKUP DATABASE " + catalog.QuoteIdentifierANSI(config.Database) + " TO STDOUT"
+	_, err = conn.CopyTo(ctx, pw, stmt)
+	pw.CloseWithError(err)
+	res := <-extracted
+	if err != nil {
+		return 0, fmt.Errorf("failed to stream the backup: %w", err)
+	}
+	return res.size, res.err
+}
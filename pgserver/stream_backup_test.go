@@ -0,0 +1,78 @@
+package pgserver
+
+import (
+	"bytes"
+	"context"
+	stdsql "database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apecloud/myduckserver/binlogreplication"
+	_ "github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBackupToStdout(t *testing.T) {
+	config, err := parseBackupSQL(`BACKUP DATABASE "my db" TO STDOUT;`)
+	require.NoError(t, err)
+	require.True(t, config.ToStdout)
+	require.Equal(t, "my db", config.DbName)
+	require.Nil(t, config.StorageConfig)
+
+	config, err = parseBackupSQL("backup database mydb to stdout")
+	require.NoError(t, err)
+	require.True(t, config.ToStdout)
+	require.Equal(t, "mydb", config.DbName)
+}
+
+func TestBackupArchive(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	db, err := stdsql.Open("duckdb", filepath.Join(src, "src.db"))
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE SCHEMA s",
+		"CREATE TABLE s.t (id INT PRIMARY KEY, v VARCHAR)",
+		"INSERT INTO s.t VALUES (1, 'a'), (2, 'b')",
+		"CHECKPOINT",
+	} {
+		_, err := db.ExecContext(ctx, stmt)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+	keyFile := binlogreplication.SourceKeyFile(src)
+	require.NoError(t, os.MkdirAll(filepath.Dir(keyFile), 0755))
+	require.NoError(t, os.WriteFile(keyFile, []byte("0123456789abcdef0123456789abcdef"), 0600))
+
+	var archive bytes.Buffer
+	size, err := writeBackupArchive(&archive, filepath.Join(src, "src.db"), keyFile)
+	require.NoError(t, err)
+	require.Positive(t, size)
+
+	// The data file replaces the previous one along with its WAL file, and the key is readable only by the owner.
+	dst := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "mysql.db.wal"), []byte("stale"), 0644))
+	extracted, err := extractBackupArchive(bytes.NewReader(archive.Bytes()), dst, "mysql.db")
+	require.NoError(t, err)
+	require.Equal(t, size, extracted)
+	require.NoFileExists(t, filepath.Join(dst, "mysql.db.wal"))
+	info, err := os.Stat(binlogreplication.SourceKeyFile(dst))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	copied, err := stdsql.Open("duckdb", filepath.Join(dst, "mysql.db"))
+	require.NoError(t, err)
+	defer copied.Close()
+	var v string
+	require.NoError(t, copied.QueryRowContext(ctx, "SELECT v FROM s.t WHERE id = 2").Scan(&v))
+	require.Equal(t, "b", v)
+
+	// A truncated archive leaves nothing behind.
+	broken := t.TempDir()
+	_, err = extractBackupArchive(bytes.NewReader(archive.Bytes()[:archive.Len()/2]), broken, "mysql.db")
+	require.Error(t, err)
+	entries, err := os.ReadDir(broken)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
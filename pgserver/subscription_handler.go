@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/apecloud/myduckserver/adapter"
-	"github.com/apecloud/myduckserver/catalog"
 	"github.com/apecloud/myduckserver/pgserver/logrepl"
 	"github.com/dolthub/go-mysql-server/sql"
 	"github.com/jackc/pglogrepl"
@@ -20,11 +19,28 @@ import (
 //    PUBLICATION mypub;
 //    This statement sets up a new subscription named 'mysub' that connects to a specified PostgreSQL
 //    database and listens for changes published under the 'mypub' publication.
+//    The existing data is copied in the snapshot exported by the new replication slot, and the changes are
+//    streamed from the slot's consistent point, so the copy and the stream neither overlap nor leave a gap.
+//
+//    The tables are replicated into the schemas of the same names as on the primary by default. With
+//    WITH (schema = 'myschema'), all tables of the subscription are replicated into the schema given instead,
+//    so that several subscriptions, e.g., to the `public` schemas of different primaries, apply concurrently
+//    without writing to the same tables. Each subscription applies its changes in a session of its own.
+//
+//    With WITH (schema_mapping = 'sales:eu_sales,public:eu'), the tables of each schema listed are replicated into
+//    the schema mapped to it instead, so that the tables of several primaries are consolidated into distinct schemas.
+//    The schemas that are not listed are replicated into the schema given by the `schema` option, if any.
 //
 // 2. Altering a subscription (enable/disable):
 //    ALTER SUBSCRIPTION mysub enable;
 //    ALTER SUBSCRIPTION mysub disable;
 //
+//    Refreshing the tables of a subscription:
+//    ALTER SUBSCRIPTION mysub REFRESH TABLES;
+//    ALTER SUBSCRIPTION mysub REFRESH TABLE myschema.mytable;
+//    The initial copy of each table is recorded in pg_subscription_rel. The first statement copies the tables that
+//    are not synced, e.g., whose copy has failed, again in a new snapshot, and the second one copies the table given.
+//
 // 3. Dropping a subscription:
 //    DROP SUBSCRIPTION mysub;
 //    This statement removes the specified subscription.
@@ -37,6 +53,7 @@ const (
 	Drop         Action = "DROP"
 	AlterDisable Action = "DISABLE"
 	AlterEnable  Action = "ENABLE"
+	AlterRefresh Action = "REFRESH"
 )
 
 // ConnectionDetails holds parsed connection string components.
@@ -54,14 +71,29 @@ type SubscriptionConfig struct {
 	PublicationName  string
 	Connection       *ConnectionDetails // Embedded pointer to ConnectionDetails
 	Action           Action
+	// Schema is the schema of the replica that the tables are replicated into, given by WITH (schema = ...).
+	Schema string
+	// SchemaMapping maps the schemas of the primary to the schemas of the replica, given by WITH (schema_mapping = ...).
+	SchemaMapping map[string]string
+	// TableSchema and TableName are the table of REFRESH TABLE, or empty for all tables that are not synced.
+	TableSchema string
+	TableName   string
 }
 
 // createRegex matches and extracts components from a CREATE SUBSCRIPTION SQL statement. Example matched command:
-var createRegex = regexp.MustCompile(`(?i)^CREATE\s+SUBSCRIPTION\s+([\w-]+)\s+CONNECTION\s+'([^']+)'(?:\s+PUBLICATION\s+([\w-]+))?;?$`)
+var createRegex = regexp.MustCompile(`(?i)^CREATE\s+SUBSCRIPTION\s+([\w-]+)\s+CONNECTION\s+'([^']+)'(?:\s+PUBLICATION\s+([\w-]+))?(?:\s+WITH\s*\(([^)]*)\))?;?$`)
+
+// optionRegex matches an option in the WITH clause of CREATE SUBSCRIPTION, and captures its name and value.
+// The options are separated by commas, which may appear in the quoted values as well.
+var optionRegex = regexp.MustCompile(`^\s*(\w+)\s*=\s*(?:'([^']*)'|(\w+))\s*(?:,|$)`)
 
 // alterRegex matches ALTER SUBSCRIPTION SQL commands and captures the subscription name and the action to be taken.
 var alterRegex = regexp.MustCompile(`(?i)^ALTER\s+SUBSCRIPTION\s+([\w-]+)\s+(disable|enable);?$`)
 
+// refreshRegex matches ALTER SUBSCRIPTION ... REFRESH TABLES and REFRESH TABLE [schema.]table,
+// and captures the subscription name and the table, if any.
+var refreshRegex = regexp.MustCompile(`(?i)^ALTER\s+SUBSCRIPTION\s+([\w-]+)\s+REFRESH\s+(?:TABLES|TABLE\s+(?:(\w+)\.)?(\w+));?$`)
+
 // dropRegex matches DROP SUBSCRIPTION SQL commands and captures the subscription name.
 var dropRegex = regexp.MustCompile(`(?i)^DROP\s+SUBSCRIPTION\s+([\w-]+);?$`)
 
@@ -84,6 +116,9 @@ func parseSubscriptionSQL(sql string) (*SubscriptionConfig, error) {
 			return nil, err
 		}
 		config.Connection = conn
+		if err := config.parseOptions(matches[4]); err != nil {
+			return nil, err
+		}
 
 	case alterRegex.MatchString(sql):
 		matches := alterRegex.FindStringSubmatch(sql)
@@ -97,6 +132,15 @@ func parseSubscriptionSQL(sql string) (*SubscriptionConfig, error) {
 			return nil, fmt.Errorf("invalid ALTER SUBSCRIPTION action: %s", matches[2])
 		}
 
+	case refreshRegex.MatchString(sql):
+		matches := refreshRegex.FindStringSubmatch(sql)
+		config.Action = AlterRefresh
+		config.SubscriptionName = matches[1]
+		config.TableSchema, config.TableName = matches[2], matches[3]
+		if config.TableName != "" && config.TableSchema == "" {
+			config.TableSchema = "public"
+		}
+
 	case dropRegex.MatchString(sql):
 		matches := dropRegex.FindStringSubmatch(sql)
 		config.Action = Drop
@@ -109,6 +153,34 @@ func parseSubscriptionSQL(sql string) (*SubscriptionConfig, error) {
 	return &config, nil
 }
 
+// parseOptions parses the options in the WITH clause of CREATE SUBSCRIPTION.
+func (config *SubscriptionConfig) parseOptions(options string) error {
+	if strings.TrimSpace(options) == "" {
+		return nil
+	}
+	for options != "" {
+		matches := optionRegex.FindStringSubmatch(options)
+		if matches == nil {
+			return fmt.Errorf("invalid subscription option: %s", strings.TrimSpace(options))
+		}
+		options = options[len(matches[0]):]
+		value := matches[2] + matches[3]
+		switch strings.ToLower(matches[1]) {
+		case "schema":
+			config.Schema = value
+		case "schema_mapping":
+			mapping, err := logrepl.ParseSchemaMapping(value)
+			if err != nil {
+				return err
+			}
+			config.SchemaMapping = mapping
+		default:
+			return fmt.Errorf("unrecognized subscription parameter: %q", matches[1])
+		}
+	}
+	return nil
+}
+
 // parseConnectionString parses the given connection string and returns a ConnectionDetails.
 func parseConnectionString(connStr string) (*ConnectionDetails, error) {
 	details := &ConnectionDetails{}
@@ -170,6 +242,8 @@ func (h *ConnectionHandler) executeSubscriptionSQL(subscriptionConfig *Subscript
 		return h.executeEnableSubscription(subscriptionConfig)
 	case AlterDisable:
 		return h.executeDisableSubscription(subscriptionConfig)
+	case AlterRefresh:
+		return h.executeRefreshSubscription(subscriptionConfig)
 	default:
 		return fmt.Errorf("unsupported action: %s", subscriptionConfig.Action)
 	}
@@ -217,6 +291,20 @@ func (h *ConnectionHandler) executeDisableSubscription(subscriptionConfig *Subsc
 	return nil
 }
 
+func (h *ConnectionHandler) executeRefreshSubscription(subscriptionConfig *SubscriptionConfig) error {
+	sqlCtx, err := h.duckHandler.sm.NewContextWithQuery(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return fmt.Errorf("failed to create context for query: %w", err)
+	}
+
+	if err = logrepl.RefreshSubscriptionTables(sqlCtx, subscriptionConfig.SubscriptionName,
+		subscriptionConfig.TableSchema, subscriptionConfig.TableName); err != nil {
+		return fmt.Errorf("failed to refresh subscription: %w", err)
+	}
+
+	return nil
+}
+
 func (h *ConnectionHandler) executeDrop(subscriptionConfig *SubscriptionConfig) error {
 	sqlCtx, err := h.duckHandler.sm.NewContextWithQuery(context.Background(), h.mysqlConn, "")
 	if err != nil {
@@ -244,122 +332,32 @@ func (h *ConnectionHandler) executeCreate(subscriptionConfig *SubscriptionConfig
 		return fmt.Errorf("failed to create context for query: %w", err)
 	}
 
-	lsn, err := h.doSnapshot(sqlCtx, subscriptionConfig)
+	err = logrepl.CreatePublicationIfNotExists(subscriptionConfig.ToDNS(), subscriptionConfig.PublicationName)
 	if err != nil {
-		return fmt.Errorf("failed to create snapshot for CREATE SUBSCRIPTION: %w", err)
-	}
-
-	err = h.doCreateSubscription(sqlCtx, subscriptionConfig, lsn)
-	if err != nil {
-		return fmt.Errorf("failed to execute CREATE SUBSCRIPTION: %w", err)
-	}
-
-	return nil
-}
-
-func (h *ConnectionHandler) doSnapshot(sqlCtx *sql.Context, subscriptionConfig *SubscriptionConfig) (pglogrepl.LSN, error) {
-	// If there is ongoing transcation, commit it
-	if txn := adapter.TryGetTxn(sqlCtx); txn != nil {
-		if err := func() error {
-			defer txn.Rollback()
-			defer adapter.CloseTxn(sqlCtx)
-			return txn.Commit()
-		}(); err != nil {
-			return 0, fmt.Errorf("failed to commit current transaction: %w", err)
-		}
-	}
-
-	connInfo := subscriptionConfig.ToConnectionInfo()
-	attachName := fmt.Sprintf("__pg_src_%d__", sqlCtx.ID())
-	if _, err := adapter.ExecCatalog(sqlCtx, fmt.Sprintf("ATTACH '%s' AS %s (TYPE POSTGRES, READ_ONLY)", connInfo, attachName)); err != nil {
-		return 0, fmt.Errorf("failed to attach connection: %w", err)
+		return fmt.Errorf("failed to create publication: %w", err)
 	}
 
-	defer func() {
-		if _, err := adapter.ExecCatalog(sqlCtx, fmt.Sprintf("DETACH %s", attachName)); err != nil {
-			h.logger.Warnf("failed to detach connection: %v", err)
-		}
-	}()
-
-	var currentLSN string
-	err := adapter.QueryRowCatalog(
-		sqlCtx,
-		fmt.Sprintf("SELECT * FROM postgres_query('%s', 'SELECT pg_current_wal_lsn()')", attachName),
-	).Scan(&currentLSN)
+	// The slot is named after the publication, see logrepl.UpdateSubscriptions.
+	replicator, err := logrepl.NewLogicalReplicator(subscriptionConfig.SubscriptionName, subscriptionConfig.ToDNS())
 	if err != nil {
-		return 0, fmt.Errorf("failed to query WAL LSN: %w", err)
+		return fmt.Errorf("failed to create logical replicator: %w", err)
 	}
-
-	lsn, err := pglogrepl.ParseLSN(currentLSN)
+	replicator.SetTargetSchema(subscriptionConfig.Schema)
+	replicator.SetSchemaMapping(subscriptionConfig.SchemaMapping)
+	lsn, err := replicator.Snapshot(sqlCtx, subscriptionConfig.PublicationName, false)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse LSN: %w", err)
-	}
-
-	// COPY DATABASE is buggy - it corrupts the WAL so the server cannot be restarted.
-	// So we need to copy tables one by one.
-	// if _, err := adapter.ExecCatalogInTxn(sqlCtx, fmt.Sprintf("COPY FROM DATABASE %s TO mysql", attachName)); err != nil {
-	// 	return 0, fmt.Errorf("failed to copy from database: %w", err)
-	// }
-
-	type table struct {
-		schema string
-		name   string
-	}
-	var tables []table
-
-	// Get all tables from the source database
-	if err := func() error {
-		rows, err := adapter.QueryCatalog(sqlCtx, `SELECT database, schema, name FROM (SHOW ALL TABLES) WHERE database = '`+attachName+`'`)
-		if err != nil {
-			return fmt.Errorf("failed to query tables: %w", err)
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var database, schema, tableName string
-			if err := rows.Scan(&database, &schema, &tableName); err != nil {
-				return fmt.Errorf("failed to scan table: %w", err)
-			}
-			tables = append(tables, table{schema: schema, name: tableName})
-		}
-
-		return nil
-	}(); err != nil {
-		return 0, err
-	}
-
-	// Create all schemas in the target database
-	for _, t := range tables {
-		if _, err := adapter.ExecCatalogInTxn(sqlCtx, `CREATE SCHEMA IF NOT EXISTS `+catalog.QuoteIdentifierANSI(t.schema)); err != nil {
-			return 0, fmt.Errorf("failed to create schema: %w", err)
-		}
+		return fmt.Errorf("failed to create snapshot for CREATE SUBSCRIPTION: %w", err)
 	}
 
-	txn, err := adapter.GetCatalogTxn(sqlCtx, nil)
+	err = h.doCreateSubscription(sqlCtx, subscriptionConfig, lsn)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get transaction: %w", err)
-	}
-	defer txn.Rollback()
-	defer adapter.CloseTxn(sqlCtx)
-
-	for _, t := range tables {
-		if _, err := adapter.ExecCatalogInTxn(
-			sqlCtx,
-			`CREATE TABLE `+catalog.ConnectIdentifiersANSI(t.schema, t.name)+` AS FROM `+catalog.ConnectIdentifiersANSI(attachName, t.schema, t.name),
-		); err != nil {
-			return 0, fmt.Errorf("failed to create table: %w", err)
-		}
+		return fmt.Errorf("failed to execute CREATE SUBSCRIPTION: %w", err)
 	}
 
-	return lsn, txn.Commit()
+	return nil
 }
 
 func (h *ConnectionHandler) doCreateSubscription(sqlCtx *sql.Context, subscriptionConfig *SubscriptionConfig, lsn pglogrepl.LSN) error {
-	err := logrepl.CreatePublicationIfNotExists(subscriptionConfig.ToDNS(), subscriptionConfig.PublicationName)
-	if err != nil {
-		return fmt.Errorf("failed to create publication: %w", err)
-	}
-
 	tx, err := adapter.GetCatalogTxn(sqlCtx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to get transaction: %w", err)
@@ -367,7 +365,8 @@ func (h *ConnectionHandler) doCreateSubscription(sqlCtx *sql.Context, subscripti
 	defer tx.Rollback()
 	defer adapter.CloseTxn(sqlCtx)
 
-	if err = logrepl.CreateSubscription(sqlCtx, subscriptionConfig.SubscriptionName, subscriptionConfig.ToDNS(), subscriptionConfig.PublicationName, lsn.String(), true); err != nil {
+	if err = logrepl.CreateSubscription(sqlCtx, subscriptionConfig.SubscriptionName, subscriptionConfig.ToDNS(), subscriptionConfig.PublicationName, lsn.String(), true,
+		subscriptionConfig.Schema, logrepl.FormatSchemaMapping(subscriptionConfig.SchemaMapping)); err != nil {
 		return fmt.Errorf("failed to write subscription: %w", err)
 	}
 
@@ -0,0 +1,47 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSubscriptionSQL(t *testing.T) {
+	config, err := parseSubscriptionSQL(`CREATE SUBSCRIPTION mysub CONNECTION 'dbname=postgres host=127.0.0.1 port=5432 user=postgres password=root' PUBLICATION mypub`)
+	require.NoError(t, err)
+	require.Equal(t, Create, config.Action)
+	require.Equal(t, "mysub", config.SubscriptionName)
+	require.Equal(t, "mypub", config.PublicationName)
+	require.Equal(t, "", config.Schema)
+
+	config, err = parseSubscriptionSQL(`CREATE SUBSCRIPTION mysub CONNECTION 'host=127.0.0.1 user=postgres' PUBLICATION mypub WITH (schema = 'mysub_schema');`)
+	require.NoError(t, err)
+	require.Equal(t, "mysub_schema", config.Schema)
+	require.Equal(t, "5432", config.Connection.Port)
+
+	config, err = parseSubscriptionSQL(`CREATE SUBSCRIPTION mysub CONNECTION 'host=127.0.0.1' PUBLICATION mypub WITH (SCHEMA=other)`)
+	require.NoError(t, err)
+	require.Equal(t, "other", config.Schema)
+
+	_, err = parseSubscriptionSQL(`CREATE SUBSCRIPTION mysub CONNECTION 'host=127.0.0.1' PUBLICATION mypub WITH (copy_data = false)`)
+	require.ErrorContains(t, err, "unrecognized subscription parameter")
+
+	config, err = parseSubscriptionSQL(`CREATE SUBSCRIPTION mysub CONNECTION 'host=127.0.0.1' PUBLICATION mypub WITH (schema_mapping = 'public:eu,sales:eu_sales', schema = other)`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"public": "eu", "sales": "eu_sales"}, config.SchemaMapping)
+	require.Equal(t, "other", config.Schema)
+
+	_, err = parseSubscriptionSQL(`CREATE SUBSCRIPTION mysub CONNECTION 'host=127.0.0.1' PUBLICATION mypub WITH (schema_mapping = 'public')`)
+	require.ErrorContains(t, err, "schema mapping")
+
+	config, err = parseSubscriptionSQL(`ALTER SUBSCRIPTION mysub REFRESH TABLE orders`)
+	require.NoError(t, err)
+	require.Equal(t, AlterRefresh, config.Action)
+	require.Equal(t, "public", config.TableSchema)
+	require.Equal(t, "orders", config.TableName)
+
+	config, err = parseSubscriptionSQL(`ALTER SUBSCRIPTION mysub REFRESH TABLES;`)
+	require.NoError(t, err)
+	require.Equal(t, AlterRefresh, config.Action)
+	require.Equal(t, "", config.TableName)
+}
@@ -0,0 +1,200 @@
+package pgserver
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// The switchover of the server between the primary and the replica roles, e.g., for disaster recovery drills:
+//
+//   - `SELECT myduck.promote()` parks the enabled subscriptions, see logrepl.ParkSubscriptions,
+//     and lets the clients write again if the server has been demoted.
+//   - `SELECT myduck.demote('host=... port=... user=... password=... dbname=...')` resubscribes the subscriptions
+//     to the primary given, see logrepl.ResubscribeSubscriptions, and rejects the writes of the clients from then on,
+//     the same as a hot standby of Postgres.
+//
+// Both are idempotent: promoting a primary, or demoting a replica of the same primary, changes nothing. The changes of
+// the role are recorded in __sys__.role_changes, so a demoted server stays read-only across restarts. A server that has
+// never been demoted accepts writes as before, whether it has subscriptions or not.
+
+const (
+	rolePrimary = "primary"
+	roleReplica = "replica"
+)
+
+// precompile a regex to match "select myduck.promote();" or "select myduck.demote('conninfo');"
+var myduckSwitchoverRegex = regexp.MustCompile(`(?i)^\s*select\s+myduck\.(?:(promote)\(\s*\)|(demote)\(\s*'((?:[^']|'')*)'\s*\))\s*;?\s*$`)
+
+// serverRole caches whether the server has been demoted, which is checked for every statement.
+var serverRole struct {
+	once     sync.Once
+	readOnly atomic.Bool
+}
+
+// switchover runs myduck.promote() or myduck.demote() and returns the query of its result.
+func (h *ConnectionHandler) switchover(query string) (string, error) {
+	matches := myduckSwitchoverRegex.FindStringSubmatch(RemoveComments(query))
+	if h.duckHandler.inTxnBlock {
+		return "", newPgError("25001", "myduck.%s() cannot run inside a transaction block", strings.ToLower(matches[1]+matches[2]))
+	}
+	ctx, err := h.duckHandler.sm.NewContextWithQuery(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to create context for query: %w", err)
+	}
+	if matches[1] != "" {
+		msg, err := h.promote(ctx)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`SELECT '%s' AS "promote";`, strings.ReplaceAll(msg, "'", "''")), nil
+	}
+	msg, err := h.demote(ctx, strings.ReplaceAll(matches[3], "''", "'"))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`SELECT '%s' AS "demote";`, strings.ReplaceAll(msg, "'", "''")), nil
+}
+
+func (h *ConnectionHandler) promote(ctx *sql.Context) (string, error) {
+	subs, err := logrepl.Subscriptions(ctx)
+	if err != nil {
+		return "", err
+	}
+	var enabled []string
+	for _, sub := range subs {
+		if sub.Enabled {
+			enabled = append(enabled, sub.Subscription)
+		}
+	}
+	if len(enabled) == 0 && !h.serverReadOnly() {
+		return "the server is already a primary", nil
+	}
+
+	if err := logrepl.ParkSubscriptions(ctx, enabled); err != nil {
+		return "", fmt.Errorf("failed to park the subscriptions: %w", err)
+	}
+	if err := recordRoleChange(ctx, rolePrimary, enabled); err != nil {
+		return "", err
+	}
+	return "promoted to primary, parked subscriptions: " + joinOrNone(enabled), nil
+}
+
+func (h *ConnectionHandler) demote(ctx *sql.Context, connInfo string) (string, error) {
+	details, err := parseConnectionString(connInfo)
+	if err != nil || details.Host == "" {
+		return "", newPgError("22023", "invalid connection string of the primary: %q", connInfo)
+	}
+	conn := (&SubscriptionConfig{Connection: details}).ToDNS()
+	primary := fmt.Sprintf("%s:%s/%s", details.Host, details.Port, details.DBName)
+
+	subs, err := logrepl.Subscriptions(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(subs) == 0 {
+		return "", newPgError("55000", "there are no subscriptions to resubscribe, create them by CREATE SUBSCRIPTION instead")
+	}
+	var parked []*logrepl.Subscription
+	var names []string
+	for _, sub := range subs {
+		if !sub.Enabled {
+			parked = append(parked, sub)
+			names = append(names, sub.Subscription)
+		} else if sub.Conn != conn {
+			return "", newPgError("55000", `subscription "%s" is replicating from another primary, promote the server first`, sub.Subscription)
+		}
+	}
+	if len(parked) == 0 && h.serverReadOnly() {
+		return "the server is already a replica of " + primary, nil
+	}
+
+	// The writes are rejected before the tables are copied, so that no write is lost silently by the copy.
+	if err := recordRoleChange(ctx, roleReplica, names); err != nil {
+		return "", err
+	}
+	if err := logrepl.ResubscribeSubscriptions(ctx, parked, conn); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("demoted to replica of %s, resubscribed subscriptions: %s", primary, joinOrNone(names)), nil
+}
+
+func joinOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// recordRoleChange records the new role of the server, which takes effect immediately.
+func recordRoleChange(ctx *sql.Context, role string, subscriptions []string) error {
+	if _, err := adapter.ExecCatalogInTxn(ctx, catalog.InternalTables.RoleChanges.UpsertStmt(),
+		time.Now(), role, strings.Join(subscriptions, ","),
+	); err != nil {
+		return err
+	}
+	if err := adapter.CommitAndCloseTxn(ctx); err != nil {
+		return err
+	}
+	serverRole.once.Do(func() {})
+	serverRole.readOnly.Store(role == roleReplica)
+	return nil
+}
+
+// serverReadOnly reports whether the server has been demoted. The role is loaded once, when it is first needed.
+func (h *ConnectionHandler) serverReadOnly() bool {
+	serverRole.once.Do(func() {
+		ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+		if err != nil {
+			h.logger.WithError(err).Warn("Failed to load the role of the server")
+			return
+		}
+		var role string
+		err = adapter.QueryRowCatalog(ctx, "SELECT role FROM "+catalog.InternalTables.RoleChanges.QualifiedName()+
+			" ORDER BY changed_at DESC LIMIT 1").Scan(&role)
+		if err != nil && !errors.Is(err, stdsql.ErrNoRows) {
+			h.logger.WithError(err).Warn("Failed to load the role of the server")
+			return
+		}
+		serverRole.readOnly.Store(role == roleReplica)
+	})
+	return serverRole.readOnly.Load()
+}
+
+// checkWritable rejects the statements that write data or change the schema while the server is demoted
+// or is a reader, see catalog/reader.go. The subscriptions can still be managed,
+// and the statements that cannot be parsed are let through.
+func (h *ConnectionHandler) checkWritable(statement ConvertedStatement) error {
+	if statement.AST == nil || statement.SubscriptionConfig != nil || !isWriteStatement(statement.AST) {
+		return nil
+	}
+	if !h.serverReadOnly() && !h.isReader() {
+		return nil
+	}
+	return newPgError("25006", "cannot execute %s in a read-only transaction", statement.Tag)
+}
+
+// isReader reports whether the server opens the database files in read-only mode.
+func (h *ConnectionHandler) isReader() bool {
+	if h.duckHandler == nil {
+		return false
+	}
+	provider := h.duckHandler.GetCatalogProvider()
+	return provider != nil && provider.IsReadOnly()
+}
+
+func isWriteStatement(stmt tree.Statement) bool {
+	return tree.CanWriteData(stmt) || tree.CanModifySchema(stmt)
+}
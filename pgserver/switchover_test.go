@@ -0,0 +1,64 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwitchoverRegex(t *testing.T) {
+	m := myduckSwitchoverRegex.FindStringSubmatch("SELECT myduck.promote();")
+	require.NotNil(t, m)
+	require.Equal(t, "promote", m[1])
+
+	m = myduckSwitchoverRegex.FindStringSubmatch(" select MYDUCK.demote( 'host=pg port=5432 password=it''s' ) ")
+	require.NotNil(t, m)
+	require.Equal(t, "demote", m[2])
+	require.Equal(t, "host=pg port=5432 password=it''s", m[3])
+
+	require.Nil(t, myduckSwitchoverRegex.FindStringSubmatch("SELECT myduck.promote() FROM t"))
+	require.Nil(t, myduckSwitchoverRegex.FindStringSubmatch("SELECT myduck.demote()"))
+}
+
+func TestCheckWritable(t *testing.T) {
+	serverRole.once.Do(func() {})
+	defer serverRole.readOnly.Store(false)
+
+	h := &ConnectionHandler{}
+	check := func(query string) error {
+		stmt, err := parser.ParseOne(query)
+		require.NoError(t, err)
+		return h.checkWritable(ConvertedStatement{String: query, AST: stmt.AST, Tag: stmt.AST.StatementTag()})
+	}
+
+	serverRole.readOnly.Store(false)
+	require.NoError(t, check("INSERT INTO t VALUES (1)"))
+
+	serverRole.readOnly.Store(true)
+	for _, query := range []string{
+		"INSERT INTO t VALUES (1)",
+		"UPDATE t SET a = 1",
+		"DELETE FROM t",
+		"TRUNCATE t",
+		"COPY t FROM STDIN",
+		"CREATE TABLE t (a INT)",
+		"ALTER TABLE t ADD COLUMN b INT",
+		"DROP TABLE t",
+	} {
+		err := check(query)
+		require.Error(t, err, query)
+		require.Contains(t, err.Error(), "read-only transaction", query)
+	}
+	for _, query := range []string{
+		"SELECT * FROM t",
+		"COPY t TO STDOUT",
+		"SET search_path = s",
+		"SHOW search_path",
+		"BEGIN",
+		"COMMIT",
+		"SELECT myduck.promote()",
+	} {
+		require.NoError(t, check(query), query)
+	}
+}
@@ -0,0 +1,259 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/catalog"
+)
+
+// The tenants are the databases isolated in their own DuckDB files with limits on their resources,
+// see catalog/tenants.go. They are managed by the superusers:
+//
+//	CREATE TENANT name [WITH (MAX_CONNECTIONS = n, STORAGE_QUOTA = '10GB')]
+//	ALTER TENANT name WITH (MAX_CONNECTIONS = n, STORAGE_QUOTA = '10GB')
+//	DROP TENANT [IF EXISTS] name
+//	GRANT CONNECT ON DATABASE name TO user [, ...]
+//	REVOKE CONNECT ON DATABASE name FROM user [, ...]
+//
+// A limit of 0 is no limit. CREATE TENANT creates the database, or turns an existing database into a tenant,
+// and DROP TENANT drops the database. The clients connect to a tenant by its name as the database:
+//   - A connection beyond MAX_CONNECTIONS of the tenant is refused, the same as CONNECTION LIMIT of Postgres.
+//     The sessions of both protocols whose current database is the tenant are counted.
+//   - The storage quota is checked when the tenant is checkpointed or backed up, e.g., by BACKUP DATABASE.
+//     The writes to a tenant above its quota are refused until a later check finds it within its quota.
+//   - The users other than the superusers may access only the tenants granted to them by GRANT CONNECT,
+//     whether by connecting to them, by switching to them, or by referencing them in their statements.
+//
+// The myduck_tenants view summarizes the limits, the size, and the activity of each tenant since the server started,
+// where the activity is that of pg_stat_database.
+
+var (
+	createTenantRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+TENANT\s+(` + tenantIdentifier + `)(?:\s+WITH\s*\((.*)\))?[\s;]*$`)
+	alterTenantRegex  = regexp.MustCompile(`(?is)^\s*ALTER\s+TENANT\s+(` + tenantIdentifier + `)\s+(?:WITH|SET)\s*\((.*)\)[\s;]*$`)
+	dropTenantRegex   = regexp.MustCompile(`(?is)^\s*DROP\s+TENANT\s+(IF\s+EXISTS\s+)?(` + tenantIdentifier + `)[\s;]*$`)
+	grantTenantRegex  = regexp.MustCompile(`(?is)^\s*GRANT\s+CONNECT\s+ON\s+DATABASE\s+(` + tenantIdentifier + `)\s+TO\s+(` + tenantIdentifierList + `)[\s;]*$`)
+	revokeTenantRegex = regexp.MustCompile(`(?is)^\s*REVOKE\s+CONNECT\s+ON\s+DATABASE\s+(` + tenantIdentifier + `)\s+FROM\s+(` + tenantIdentifierList + `)[\s;]*$`)
+	// tenantIdentifierRegex matches each name in a list of the users.
+	tenantIdentifierRegex = regexp.MustCompile(tenantIdentifier)
+	// tenantOptionRegex matches an option of CREATE TENANT and ALTER TENANT, whose value may be quoted or preceded by '='.
+	tenantOptionRegex = regexp.MustCompile(`(?s)^\s*([A-Za-z_]+)\s*=?\s*'?([^']*?)'?\s*$`)
+
+	// myduckTenantsRegex matches the references to the myduck_tenants view.
+	myduckTenantsRegex = regexp.MustCompile(`(?i)\b(FROM|JOIN)\s+(?:__sys__\.)?(?:"myduck_tenants"|myduck_tenants\b)`)
+)
+
+const (
+	tenantIdentifier     = `"(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*`
+	tenantIdentifierList = `(?:` + tenantIdentifier + `)(?:\s*,\s*(?:` + tenantIdentifier + `))*`
+)
+
+func isTenantStatement(query string) bool {
+	return createTenantRegex.MatchString(query) || alterTenantRegex.MatchString(query) || dropTenantRegex.MatchString(query) ||
+		isTenantGrantStatement(query)
+}
+
+// isTenantGrantStatement reports whether the query grants or revokes the access to a tenant.
+func isTenantGrantStatement(query string) bool {
+	return grantTenantRegex.MatchString(query) || revokeTenantRegex.MatchString(query)
+}
+
+// tenantLimits are the options of CREATE TENANT and ALTER TENANT. The options that are not given are nil.
+type tenantLimits struct {
+	maxConnections *int
+	storageQuota   *int64
+}
+
+func parseTenantOptions(options string) (tenantLimits, error) {
+	var limits tenantLimits
+	if strings.TrimSpace(options) == "" {
+		return limits, nil
+	}
+	for _, option := range strings.Split(options, ",") {
+		m := tenantOptionRegex.FindStringSubmatch(option)
+		if m == nil {
+			return limits, newPgError("42601", "invalid option of tenant: %q", strings.TrimSpace(option))
+		}
+		switch name, value := strings.ToUpper(m[1]), strings.TrimSpace(m[2]); name {
+		case "MAX_CONNECTIONS":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return limits, newPgError("22023", "invalid value for MAX_CONNECTIONS: %q", value)
+			}
+			limits.maxConnections = &n
+		case "STORAGE_QUOTA":
+			// The quota is in bytes unless it has a unit, e.g., '10GB'.
+			f, err := parseSettingNumber("storage_quota", "B", value)
+			if err != nil || f < 0 || f > math.MaxInt64 {
+				return limits, newPgError("22023", "invalid value for STORAGE_QUOTA: %q", value)
+			}
+			quota := int64(f)
+			limits.storageQuota = &quota
+		default:
+			return limits, newPgError("42601", "unknown option of tenant: %s", name)
+		}
+	}
+	return limits, nil
+}
+
+// execTenantStatement executes a statement that manages the tenants.
+func (h *ConnectionHandler) execTenantStatement(query string) (bool, error) {
+	provider := h.duckHandler.GetCatalogProvider()
+	if provider == nil {
+		return false, fmt.Errorf("database provider not found")
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, query)
+	if err != nil {
+		return false, err
+	}
+	if mysqlDb := h.duckHandler.e.Analyzer.Catalog.MySQLDb; mysqlDb != nil && mysqlDb.Enabled() && !h.isSuperuser(ctx) {
+		return false, newPgError("42501", "must be superuser to manage tenants")
+	}
+
+	var tag string
+	switch {
+	case createTenantRegex.MatchString(query):
+		m := createTenantRegex.FindStringSubmatch(query)
+		limits, err := parseTenantOptions(m[2])
+		if err != nil {
+			return false, err
+		}
+		var maxConnections int
+		var storageQuota int64
+		if limits.maxConnections != nil {
+			maxConnections = *limits.maxConnections
+		}
+		if limits.storageQuota != nil {
+			storageQuota = *limits.storageQuota
+		}
+		tag, err = "CREATE TENANT", provider.CreateTenant(unquoteIdentifier(m[1]), maxConnections, storageQuota)
+		if err != nil {
+			return false, err
+		}
+
+	case alterTenantRegex.MatchString(query):
+		m := alterTenantRegex.FindStringSubmatch(query)
+		limits, err := parseTenantOptions(m[2])
+		if err != nil {
+			return false, err
+		}
+		tag, err = "ALTER TENANT", provider.AlterTenant(unquoteIdentifier(m[1]), limits.maxConnections, limits.storageQuota)
+		if err != nil {
+			return false, err
+		}
+
+	case dropTenantRegex.MatchString(query):
+		m := dropTenantRegex.FindStringSubmatch(query)
+		name := unquoteIdentifier(m[2])
+		if name == adapter.GetCurrentCatalog(ctx) {
+			return false, newPgError("55006", "cannot drop the currently open database")
+		}
+		tag, err = "DROP TENANT", provider.DropTenant(name, m[1] != "")
+		if err != nil {
+			return false, err
+		}
+
+	case grantTenantRegex.MatchString(query):
+		m := grantTenantRegex.FindStringSubmatch(query)
+		tag = "GRANT"
+		for _, user := range tenantIdentifierRegex.FindAllString(m[2], -1) {
+			if err := provider.GrantTenant(unquoteIdentifier(m[1]), unquoteIdentifier(user)); err != nil {
+				return false, err
+			}
+		}
+
+	case revokeTenantRegex.MatchString(query):
+		m := revokeTenantRegex.FindStringSubmatch(query)
+		tag = "REVOKE"
+		for _, user := range tenantIdentifierRegex.FindAllString(m[2], -1) {
+			if _, err := provider.RevokeTenant(unquoteIdentifier(m[1]), unquoteIdentifier(user)); err != nil {
+				return false, err
+			}
+		}
+
+	default:
+		return false, nil
+	}
+	return true, h.send(makeCommandComplete(tag, 0))
+}
+
+// checkTenantAccess refuses a statement whose current database, or a tenant that it references, is not granted
+// to its user other than a superuser, or that writes to a tenant above its storage quota, see backend.CheckTenantAccess.
+func (h *ConnectionHandler) checkTenantAccess(statement ConvertedStatement) error {
+	if h.duckHandler == nil {
+		return nil
+	}
+	provider := h.duckHandler.GetCatalogProvider()
+	if provider == nil || !provider.HasTenants() {
+		return nil
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, statement.String)
+	if err != nil {
+		return err
+	}
+	write := statement.AST != nil && statement.SubscriptionConfig == nil && isWriteStatement(statement.AST)
+	return backend.CheckTenantAccess(ctx, statement.String, write)
+}
+
+// myduckTenantsQuery returns the query of the myduck_tenants view with the current sizes and counters.
+func myduckTenantsQuery(provider *catalog.DatabaseProvider) (string, error) {
+	tenants, err := provider.Tenants()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT t.tenant_name, t.max_connections, t.storage_quota, coalesce(s.size, 0)::BIGINT AS size,")
+	b.WriteString(" t.checked_size, t.checked_at, t.over_quota, coalesce(s.numbackends, 0)::INTEGER AS connections")
+	for _, name := range []string{"sessions", "xact_commit", "xact_rollback", "tup_returned", "tup_inserted", "tup_updated", "tup_deleted"} {
+		fmt.Fprintf(&b, ", coalesce(s.%s, 0)::BIGINT AS %s", name, name)
+	}
+	b.WriteString(", coalesce(s.active_time, 0)::DOUBLE AS active_time, t.created_at")
+	fmt.Fprintf(&b, " FROM %s t", catalog.FullTableName(provider.DefaultCatalogName(), catalog.InternalTables.Tenants.Schema, catalog.InternalTables.Tenants.Name))
+	b.WriteString(" LEFT JOIN (VALUES ")
+	for i, tenant := range tenants {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		size, err := provider.TenantStorageSize(tenant.Name)
+		if err != nil {
+			return "", err
+		}
+		s := statsOfDatabase(tenant.Name)
+		fmt.Fprintf(&b, "(%s, %d, %d, %d, %d, %d, %d, %d, %d, %d, %.3f)",
+			quoteSettingLiteral(tenant.Name), size,
+			provider.TenantConnections(tenant.Name), s.sessions.Load(), s.xactCommit.Load(), s.xactRollback.Load(),
+			s.tupReturned.Load(), s.tupInserted.Load(), s.tupUpdated.Load(), s.tupDeleted.Load(),
+			float64(s.activeTime.Load())/1000,
+		)
+	}
+	if len(tenants) == 0 {
+		// VALUES cannot be empty, and a NULL name joins no tenant.
+		b.WriteString("(NULL, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0.0)")
+	}
+	b.WriteString(") AS s(tenant_name, size, numbackends, sessions, xact_commit, xact_rollback,")
+	b.WriteString(" tup_returned, tup_inserted, tup_updated, tup_deleted, active_time)")
+	b.WriteString(" ON t.tenant_name = s.tenant_name")
+	b.WriteString(" ORDER BY t.tenant_name")
+	return b.String(), nil
+}
+
+// inlineMyduckTenants replaces the references to myduck_tenants in the query with the subquery of the current
+// sizes and counters, see inlinePgStatDatabase.
+func (h *ConnectionHandler) inlineMyduckTenants(query string) (string, error) {
+	provider := h.duckHandler.GetCatalogProvider()
+	if provider == nil {
+		return "", fmt.Errorf("database provider not found")
+	}
+	subquery, err := myduckTenantsQuery(provider)
+	if err != nil {
+		return "", err
+	}
+	return inlineView(query, myduckTenantsRegex, subquery, "myduck_tenants"), nil
+}
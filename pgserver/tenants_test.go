@@ -0,0 +1,61 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantStatements(t *testing.T) {
+	m := createTenantRegex.FindStringSubmatch(`CREATE TENANT acme WITH (MAX_CONNECTIONS = 10, STORAGE_QUOTA = '2GB');`)
+	require.NotNil(t, m)
+	require.Equal(t, "acme", unquoteIdentifier(m[1]))
+	limits, err := parseTenantOptions(m[2])
+	require.NoError(t, err)
+	require.Equal(t, 10, *limits.maxConnections)
+	require.Equal(t, int64(2<<30), *limits.storageQuota)
+
+	m = createTenantRegex.FindStringSubmatch(`create tenant "Acme"`)
+	require.NotNil(t, m)
+	require.Equal(t, "Acme", unquoteIdentifier(m[1]))
+	limits, err = parseTenantOptions(m[2])
+	require.NoError(t, err)
+	require.Nil(t, limits.maxConnections)
+	require.Nil(t, limits.storageQuota)
+
+	m = alterTenantRegex.FindStringSubmatch(`ALTER TENANT acme SET (storage_quota 1048576)`)
+	require.NotNil(t, m)
+	limits, err = parseTenantOptions(m[2])
+	require.NoError(t, err)
+	require.Nil(t, limits.maxConnections)
+	require.Equal(t, int64(1<<20), *limits.storageQuota)
+
+	m = dropTenantRegex.FindStringSubmatch(`DROP TENANT IF EXISTS acme`)
+	require.NotNil(t, m)
+	require.NotEmpty(t, m[1])
+	require.Equal(t, "acme", m[2])
+
+	require.True(t, isTenantStatement("DROP TENANT acme"))
+	require.False(t, isTenantStatement("DROP TABLE acme"))
+	require.False(t, isTenantStatement("CREATE TENANT a; DROP TABLE t"))
+
+	m = grantTenantRegex.FindStringSubmatch(`GRANT CONNECT ON DATABASE acme TO alice, "Bob, Jr.";`)
+	require.NotNil(t, m)
+	require.Equal(t, []string{"alice", `"Bob, Jr."`}, tenantIdentifierRegex.FindAllString(m[2], -1))
+	require.True(t, isTenantGrantStatement(`revoke connect on database "Acme" from alice`))
+	require.False(t, isTenantGrantStatement("GRANT CONNECT ON DATABASE acme TO alice; DROP TABLE t"))
+	require.False(t, isTenantGrantStatement("GRANT SELECT ON t TO alice"))
+
+	for _, options := range []string{"MAX_CONNECTIONS = -1", "MAX_CONNECTIONS = x", "STORAGE_QUOTA = '1XB'", "QUOTA = 1"} {
+		_, err := parseTenantOptions(options)
+		require.Error(t, err, options)
+	}
+}
+
+func TestMyduckTenantsRegex(t *testing.T) {
+	require.True(t, myduckTenantsRegex.MatchString("SELECT * FROM myduck_tenants"))
+	require.True(t, myduckTenantsRegex.MatchString(`select size from __sys__."myduck_tenants" t`))
+	require.False(t, myduckTenantsRegex.MatchString("SELECT * FROM myduck_tenants_backup"))
+	require.Equal(t, "SELECT size FROM (SELECT 1 AS size) AS myduck_tenants",
+		inlineView("SELECT size FROM myduck_tenants", myduckTenantsRegex, "SELECT 1 AS size", "myduck_tenants"))
+}
@@ -0,0 +1,86 @@
+package pgserver
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// TraceParameter is the session parameter that toggles the tracing of the session, for debugging the compatibility
+// issues of the clients. When enabled, each protocol message received or sent, the SQL converted from each query,
+// and the execution path and timing of each statement are written to the log with the connection ID.
+const TraceParameter = "myduck.trace"
+
+// The execution paths of the traced statements.
+const (
+	// tracePathInPlace is for the statements handled by the server itself, see handleStatementOutsideEngine.
+	tracePathInPlace = "in-place"
+	// tracePathEngine is for the statements executed by DuckHandler.executeQuery,
+	// which may adapt them before running them in DuckDB.
+	tracePathEngine = "engine"
+	// tracePathDuckDB is for the portals of the statements prepared in DuckDB, which are executed as they are.
+	tracePathDuckDB = "duckdb"
+)
+
+// traceMessage logs a protocol message received from or sent to the client.
+func (h *ConnectionHandler) traceMessage(direction string, msg any) {
+	if !h.trace {
+		return
+	}
+	var body any = msg
+	if m, ok := msg.(json.Marshaler); ok {
+		if data, err := m.MarshalJSON(); err == nil {
+			body = string(data)
+		}
+	}
+	h.logger.WithField("trace", direction).Infof("%T %v", msg, body)
+}
+
+// traceMessageHandled logs the time taken to handle a message from the client.
+func (h *ConnectionHandler) traceMessageHandled(msg pgproto3.FrontendMessage, start time.Time, err error) {
+	if !h.trace {
+		return
+	}
+	entry := h.logger.WithField("trace", "handled").WithField("elapsed", time.Since(start))
+	if err != nil {
+		entry = entry.WithError(err)
+	}
+	entry.Infof("%T", msg)
+}
+
+// traceConverted logs the statements converted from a query.
+func (h *ConnectionHandler) traceConverted(query string, statements []ConvertedStatement) {
+	if !h.trace {
+		return
+	}
+	for i, statement := range statements {
+		h.logger.WithField("trace", "converted").Infof("statement %d/%d of %q: tag=%s pg_parsable=%v sql=%q",
+			i+1, len(statements), query, statement.Tag, statement.PgParsable, statement.String)
+	}
+}
+
+// traceExecution logs the execution path and the time taken to execute a statement.
+func (h *ConnectionHandler) traceExecution(query string, path string, start time.Time, err error) {
+	if !h.trace {
+		return
+	}
+	entry := h.logger.WithField("trace", "executed").WithField("path", path).WithField("elapsed", time.Since(start))
+	if err != nil {
+		entry = entry.WithError(err)
+	}
+	entry.Infof("%q", query)
+}
+
+// setTrace handles `SET myduck.trace = on|off`.
+func (h *ConnectionHandler) setTrace(value any, useDefault bool) error {
+	enabled := false
+	if !useDefault {
+		var err error
+		if enabled, err = parseBoolSetting(TraceParameter, value); err != nil {
+			return err
+		}
+	}
+	h.trace = enabled
+	return nil
+}
@@ -0,0 +1,143 @@
+package pgserver
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// The retention policies of the tables, see backend.TTLPurger:
+//
+//   - `ALTER TABLE t SET (ttl = '30 days', ttl_column = 'created_at')` sets the policy of `t`.
+//     The rows of `t` whose `created_at` is older than 30 days are deleted in the background.
+//   - `ALTER TABLE t RESET (ttl)` removes the policy of `t`.
+//
+// A policy takes effect once both of the parameters are set.
+// The policies and the statistics of the purges are stored in catalog.InternalTables.TTLTables.
+
+// isTTLAlterTable reports whether the statement only changes the retention policy of a table.
+func isTTLAlterTable(stmt tree.Statement) bool {
+	return isStorageParamsAlterTable(stmt, catalog.TTLParam, catalog.TTLColumnParam)
+}
+
+// isStorageParamsAlterTable reports whether the statement only sets or resets the given storage parameters of a table.
+func isStorageParamsAlterTable(stmt tree.Statement, params ...string) bool {
+	alter, ok := stmt.(*tree.AlterTable)
+	if !ok || len(alter.Cmds) == 0 {
+		return false
+	}
+	isParam := func(name string) bool {
+		return slices.Contains(params, strings.ToLower(name))
+	}
+	for _, cmd := range alter.Cmds {
+		switch cmd := cmd.(type) {
+		case *tree.AlterTableSetStorageParams:
+			for _, param := range cmd.StorageParams {
+				if !isParam(string(param.Key)) {
+					return false
+				}
+			}
+		case *tree.AlterTableResetStorageParams:
+			for _, name := range cmd.Params {
+				if !isParam(string(name)) {
+					return false
+				}
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// storageParamValue returns the text of the value of a storage parameter.
+func storageParamValue(param tree.StorageParam) string {
+	if s, ok := param.Value.(*tree.StrVal); ok {
+		return s.RawString()
+	}
+	return tree.AsStringWithFlags(param.Value, tree.FmtBareStrings)
+}
+
+// alterTableTTL sets or resets the retention policy of a table.
+func (h *ConnectionHandler) alterTableTTL(alter *tree.AlterTable) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	schema, table, err := h.resolveHistoryTarget(ctx, alter.Table.String())
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if alter.IfExists && errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+			return nil
+		}
+		return err
+	}
+
+	var ttl, column stdsql.NullString
+	if err := adapter.QueryRowCatalog(ctx,
+		catalog.InternalTables.TTLTables.SelectColumnsStmt([]string{"ttl", "ttl_column"}),
+		schema, table.Name(),
+	).Scan(&ttl, &column); err != nil && !errors.Is(err, stdsql.ErrNoRows) {
+		return err
+	}
+	for _, cmd := range alter.Cmds {
+		switch cmd := cmd.(type) {
+		case *tree.AlterTableSetStorageParams:
+			for _, param := range cmd.StorageParams {
+				value := stdsql.NullString{String: storageParamValue(param), Valid: true}
+				if strings.EqualFold(string(param.Key), catalog.TTLParam) {
+					ttl = value
+				} else {
+					column = value
+				}
+			}
+		case *tree.AlterTableResetStorageParams:
+			for _, name := range cmd.Params {
+				if strings.EqualFold(string(name), catalog.TTLParam) {
+					ttl = stdsql.NullString{}
+				} else {
+					column = stdsql.NullString{}
+				}
+			}
+		}
+	}
+
+	if !ttl.Valid && !column.Valid {
+		_, err := adapter.ExecCatalog(ctx, catalog.InternalTables.TTLTables.DeleteStmt(), schema, table.Name())
+		return err
+	}
+	if ttl.Valid {
+		var positive bool
+		if err := adapter.QueryRowCatalog(ctx, "SELECT CAST(? AS INTERVAL) > INTERVAL 0 SECOND", ttl.String).Scan(&positive); err != nil {
+			return newPgError("22023", `invalid value for parameter "%s": "%s"`, catalog.TTLParam, ttl.String)
+		} else if !positive {
+			return newPgError("22023", `parameter "%s" must be a positive interval`, catalog.TTLParam)
+		}
+	}
+	if column.Valid {
+		idx := table.Schema().IndexOfColName(column.String)
+		if idx < 0 {
+			return newPgError("42703", `column "%s" of relation "%s" does not exist`, column.String, table.Name())
+		}
+		col := table.Schema()[idx]
+		if !types.IsTime(col.Type) {
+			return newPgError("42804", `column "%s" of relation "%s" is not of a date or timestamp type`, col.Name, table.Name())
+		}
+		column.String = col.Name
+	}
+
+	_, err = adapter.ExecCatalog(ctx,
+		"INSERT INTO "+catalog.InternalTables.TTLTables.QualifiedName()+" (schema_name, table_name, ttl, ttl_column) VALUES (?, ?, ?, ?)"+
+			" ON CONFLICT DO UPDATE SET ttl = excluded.ttl, ttl_column = excluded.ttl_column",
+		schema, table.Name(), ttl, column,
+	)
+	return err
+}
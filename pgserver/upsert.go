@@ -0,0 +1,115 @@
+package pgserver
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// DuckDB supports INSERT ... ON CONFLICT with the same semantics and affected-row counts as Postgres,
+// i.e., DO NOTHING counts the inserted rows, and DO UPDATE counts the inserted and the updated rows.
+// The following differences are rewritten:
+//
+//   - ON CONFLICT ON CONSTRAINT is not supported by DuckDB, so the constraint is replaced with its columns.
+//     DuckDB names a primary key after its columns, e.g., t_a_pkey, so t_pkey of Postgres is accepted too.
+//   - ON CONFLICT DO NOTHING without a conflict target is an error in DuckDB if the table has no unique keys,
+//     while Postgres inserts the rows as usual, so the clause is removed.
+
+var (
+	onConstraintRegex      = regexp.MustCompile(`(?is)\bON\s+CONFLICT\s+ON\s+CONSTRAINT\s+("(?:[^"]|"")+"|\w+)`)
+	onConflictNothingRegex = regexp.MustCompile(`(?is)\s*\bON\s+CONFLICT\s+DO\s+NOTHING\b`)
+)
+
+// convertOnConflict rewrites the ON CONFLICT clause of an INSERT into the one that DuckDB accepts.
+func convertOnConflict(ctx *sql.Context, query string, insert *tree.Insert) (string, error) {
+	oc := insert.OnConflict
+	if oc == nil || (oc.Constraint == "" && (!oc.DoNothing || len(oc.Columns) > 0)) {
+		return query, nil
+	}
+	table := insert.Table
+	if aliased, ok := table.(*tree.AliasedTableExpr); ok {
+		table = aliased.Expr
+	}
+	tn, ok := table.(*tree.TableName)
+	if !ok {
+		return query, nil
+	}
+	schema := tn.Schema()
+	if schema == "" {
+		schema = adapter.GetCurrentSchema(ctx)
+	}
+
+	if oc.Constraint == "" {
+		var keys int
+		if err := adapter.QueryRowCatalog(ctx,
+			"SELECT (SELECT count(*) FROM duckdb_constraints() WHERE database_name = current_database() AND schema_name = ? AND table_name = ?"+
+				" AND constraint_type IN ('PRIMARY KEY', 'UNIQUE'))"+
+				" + (SELECT count(*) FROM duckdb_indexes() WHERE database_name = current_database() AND schema_name = ? AND table_name = ? AND is_unique)",
+			schema, tn.Table(), schema, tn.Table(),
+		).Scan(&keys); err != nil {
+			return "", err
+		}
+		if keys > 0 {
+			return query, nil
+		}
+		return replaceLastMatch(query, onConflictNothingRegex, ""), nil
+	}
+
+	columns, err := constraintColumns(ctx, schema, tn.Table(), string(oc.Constraint))
+	if err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		return "", newPgError("42704", `constraint "%s" for table "%s" does not exist`, oc.Constraint, tn.Table())
+	}
+	names := make(tree.NameList, len(columns))
+	for i, column := range columns {
+		names[i] = tree.Name(column)
+	}
+	return replaceLastMatch(query, onConstraintRegex, "ON CONFLICT ("+tree.AsString(&names)+")"), nil
+}
+
+// constraintColumns returns the columns of a primary key or unique constraint of a table.
+func constraintColumns(ctx *sql.Context, schema, table, constraint string) ([]string, error) {
+	rows, err := adapter.QueryCatalog(ctx,
+		"SELECT unnest(constraint_column_names) FROM (SELECT constraint_column_names FROM duckdb_constraints()"+
+			" WHERE database_name = current_database() AND schema_name = ? AND table_name = ?"+
+			" AND constraint_type IN ('PRIMARY KEY', 'UNIQUE')"+
+			" AND (constraint_name = ? OR (constraint_type = 'PRIMARY KEY' AND table_name || '_pkey' = ?))"+
+			" ORDER BY constraint_name = ? DESC LIMIT 1)",
+		schema, table, constraint, constraint, constraint,
+	)
+	if err != nil {
+		return nil, catalog.ErrDuckDB.New(err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, catalog.ErrDuckDB.New(err)
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// replaceLastMatch replaces the last match of the regex in the query, which is the clause
+// that follows the inserted values.
+func replaceLastMatch(query string, re *regexp.Regexp, repl string) string {
+	m := re.FindAllStringIndex(query, -1)
+	if len(m) == 0 {
+		return query
+	}
+	last := m[len(m)-1]
+	var b strings.Builder
+	b.WriteString(query[:last[0]])
+	b.WriteString(repl)
+	b.WriteString(query[last[1]:])
+	return b.String()
+}
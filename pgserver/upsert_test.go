@@ -0,0 +1,31 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceOnConflict(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			query: `INSERT INTO t VALUES (1, 'on conflict on constraint x') ON CONFLICT ON CONSTRAINT t_pkey DO NOTHING`,
+			want:  `INSERT INTO t VALUES (1, 'on conflict on constraint x') ON CONFLICT (a, "B") DO NOTHING`,
+		},
+		{
+			query: `insert into t values (1) on conflict on constraint "T_Key" do update set b = excluded.b returning *`,
+			want:  `insert into t values (1) ON CONFLICT (a, "B") do update set b = excluded.b returning *`,
+		},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, replaceLastMatch(tt.query, onConstraintRegex, `ON CONFLICT (a, "B")`))
+	}
+
+	require.Equal(t,
+		"INSERT INTO t VALUES (1) RETURNING *",
+		replaceLastMatch("INSERT INTO t VALUES (1) ON CONFLICT\n DO NOTHING RETURNING *", onConflictNothingRegex, ""),
+	)
+}
@@ -0,0 +1,315 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/apecloud/myduckserver/pgtypes"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/types"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// The user-defined types of Postgres, created in DuckDB by catalog.CreateUserType:
+//
+//   - `CREATE TYPE mood AS ENUM ('sad', 'ok', 'happy')` creates an enum, whose values are sent as text.
+//   - `CREATE TYPE point2 AS (x int, y int)` creates a composite type, i.e., a STRUCT of DuckDB.
+//   - `CREATE DOMAIN price AS numeric(10,2) NOT NULL DEFAULT 0 CHECK (VALUE >= 0)` creates a domain,
+//     whose values are sent as the values of its base type.
+//     The constraints of a domain are added to the tables created with columns of the domain:
+//     NOT NULL and CHECK become the CHECK constraints of the table, and DEFAULT becomes the default of the column
+//     unless the column has its own. Altering the domain does not change the existing tables.
+//   - `DROP TYPE` and `DROP DOMAIN` drop them.
+
+var (
+	createDomainRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+DOMAIN\s+(` + identifierPattern + `(?:\s*\.\s*` + identifierPattern + `)?)\s+(?:AS\s+)?(.+?)[\s;]*$`)
+	dropDomainRegex   = regexp.MustCompile(`(?is)^\s*DROP\s+DOMAIN\s+(.+?)[\s;]*$`)
+	domainValueRegex  = regexp.MustCompile(`(?i)\bvalue\b`)
+	// int4TypeRegex matches the names of int4 at the start of a type, which the parser takes for int8.
+	int4TypeRegex = regexp.MustCompile(`(?i)^\s*(?:integer|int4|int)\b(\s*\[)?`)
+)
+
+// userTypeName returns the schema and the name of a type, defaulting the schema to the current one.
+func userTypeName(ctx *sql.Context, name *tree.UnresolvedObjectName) (string, string) {
+	if name.HasExplicitSchema() {
+		return name.Schema(), name.Object()
+	}
+	return adapter.GetCurrentSchema(ctx), name.Object()
+}
+
+// duckDBType returns the DuckDB type and the Postgres OID of a type reference.
+func duckDBType(ctx *sql.Context, ref tree.ResolvableTypeReference) (string, uint32, error) {
+	switch t := ref.(type) {
+	case *types.T:
+		oid := uint32(t.Oid())
+		name, ok := pgtypes.PostgresOIDToDuckDBTypeName[oid]
+		if !ok {
+			return t.SQLString(), oid, nil
+		}
+		if oid == pgtype.NumericOID && t.Precision() > 0 {
+			name = fmt.Sprintf("DECIMAL(%d,%d)", t.Precision(), t.Scale())
+		}
+		return name, oid, nil
+	case *tree.UnresolvedObjectName:
+		schema, name := userTypeName(ctx, t)
+		ut, err := catalog.LookupUserType(ctx, schema, name)
+		if err != nil {
+			return "", 0, err
+		}
+		if ut == nil {
+			return "", 0, newPgError("42704", `type "%s" does not exist`, t.String())
+		}
+		return catalog.ConnectIdentifiersANSI(ut.Schema, ut.Name), ut.OID, nil
+	default:
+		return "", 0, newPgError("0A000", `type "%s" is not supported`, ref.SQLString())
+	}
+}
+
+func (h *ConnectionHandler) createType(create *tree.CreateType) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	schema, name := userTypeName(ctx, create.TypeName)
+	if create.IfNotExists {
+		if ut, err := catalog.LookupUserType(ctx, schema, name); err != nil || ut != nil {
+			return err
+		}
+	}
+
+	t := &catalog.UserType{Schema: schema, Name: name}
+	switch create.Variety {
+	case tree.Enum:
+		t.Kind = catalog.UserTypeEnum
+		for _, label := range create.EnumLabels {
+			t.Labels = append(t.Labels, string(label))
+		}
+	case tree.Composite:
+		t.Kind = catalog.UserTypeComposite
+		fields := make([]string, len(create.CompositeTypeList))
+		for i, elem := range create.CompositeTypeList {
+			typ, _, err := duckDBType(ctx, elem.Type)
+			if err != nil {
+				return err
+			}
+			fields[i] = catalog.QuoteIdentifierANSI(string(elem.Label)) + " " + typ
+		}
+		t.BaseType = "STRUCT(" + strings.Join(fields, ", ") + ")"
+	default:
+		return newPgError("0A000", "CREATE TYPE of this kind is not supported")
+	}
+	return h.duckHandler.atomically(ctx, func() error {
+		return catalog.CreateUserType(ctx, t)
+	})
+}
+
+func (h *ConnectionHandler) dropTypes(drop *tree.DropType) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	return h.duckHandler.atomically(ctx, func() error {
+		for _, n := range drop.Names {
+			schema, name := userTypeName(ctx, n)
+			if err := catalog.DropUserType(ctx, schema, name, drop.IfExists, drop.DropBehavior == tree.DropCascade); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// parseCreateDomain parses CREATE DOMAIN, which the parser does not support,
+// as the definition of a column named VALUE.
+func parseCreateDomain(query string) (*tree.CreateTable, *tree.ColumnTableDef, error) {
+	m := createDomainRegex.FindStringSubmatch(query)
+	if m == nil {
+		return nil, nil, newPgError("42601", "syntax error at or near DOMAIN")
+	}
+	stmt, err := parser.ParseOne("CREATE TABLE " + m[1] + " (value " + m[2] + ")")
+	if err != nil {
+		return nil, nil, err
+	}
+	ct := stmt.AST.(*tree.CreateTable)
+	if len(ct.Defs) != 1 {
+		return nil, nil, newPgError("42601", "syntax error in CREATE DOMAIN")
+	}
+	def, ok := ct.Defs[0].(*tree.ColumnTableDef)
+	if !ok {
+		return nil, nil, newPgError("42601", "syntax error in CREATE DOMAIN")
+	}
+	if m := int4TypeRegex.FindStringSubmatch(m[2]); m != nil && m[1] == "" {
+		def.Type = types.Int4
+	}
+	return ct, def, nil
+}
+
+func (h *ConnectionHandler) createDomain(query string) error {
+	ct, def, err := parseCreateDomain(query)
+	if err != nil {
+		return err
+	}
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+
+	t := &catalog.UserType{
+		Schema:  ct.Table.Schema(),
+		Name:    ct.Table.Table(),
+		Kind:    catalog.UserTypeDomain,
+		NotNull: def.Nullable.Nullability == tree.NotNull,
+	}
+	if t.Schema == "" {
+		t.Schema = adapter.GetCurrentSchema(ctx)
+	}
+	if t.BaseType, t.BaseTypeOID, err = duckDBType(ctx, def.Type); err != nil {
+		return err
+	}
+	if def.DefaultExpr.Expr != nil {
+		t.Default = tree.AsString(def.DefaultExpr.Expr)
+	}
+	var checks []string
+	for _, check := range def.CheckExprs {
+		checks = append(checks, "("+tree.AsString(check.Expr)+")")
+	}
+	t.Check = strings.Join(checks, " AND ")
+	return h.duckHandler.atomically(ctx, func() error {
+		return catalog.CreateUserType(ctx, t)
+	})
+}
+
+func (h *ConnectionHandler) dropDomains(query string) error {
+	m := dropDomainRegex.FindStringSubmatch(query)
+	if m == nil {
+		return newPgError("42601", "syntax error at or near DOMAIN")
+	}
+	stmt, err := parser.ParseOne("DROP TYPE " + m[1])
+	if err != nil {
+		return err
+	}
+	return h.dropTypes(stmt.AST.(*tree.DropType))
+}
+
+// applyDomainConstraints adds the constraints of the domains to CREATE TABLE.
+// It returns the query with the CHECK constraints and the statements that set the defaults of the columns,
+// which are to be executed after the table is created.
+func applyDomainConstraints(ctx *sql.Context, query string, create *tree.CreateTable) (string, []string, error) {
+	if create.As() {
+		return query, nil, nil
+	}
+	var columns []*tree.ColumnTableDef
+	for _, def := range create.Defs {
+		if col, ok := def.(*tree.ColumnTableDef); ok {
+			if _, ok := col.Type.(*tree.UnresolvedObjectName); ok {
+				columns = append(columns, col)
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return query, nil, nil
+	}
+	domains, err := catalog.LookupDomains(ctx)
+	if err != nil || len(domains) == 0 {
+		return query, nil, err
+	}
+
+	var checks, defaults []string
+	for _, col := range columns {
+		schema, name := userTypeName(ctx, col.Type.(*tree.UnresolvedObjectName))
+		for _, domain := range domains {
+			if domain.Schema != schema || domain.Name != name {
+				continue
+			}
+			checks = append(checks, domainChecks(domain, string(col.Name))...)
+			if domain.Default != "" && col.DefaultExpr.Expr == nil {
+				defaults = append(defaults,
+					"ALTER TABLE "+create.Table.String()+" ALTER COLUMN "+catalog.QuoteIdentifierANSI(string(col.Name))+
+						" SET DEFAULT "+domain.Default)
+			}
+		}
+	}
+	if len(checks) > 0 {
+		if query, err = addTableConstraints(query, checks); err != nil {
+			return "", nil, err
+		}
+	}
+	// The defaults are not to be set on the existing table of CREATE TABLE IF NOT EXISTS.
+	if len(defaults) > 0 && create.IfNotExists {
+		if exists, err := tableExists(ctx, create); err != nil || exists {
+			return query, nil, err
+		}
+	}
+	return query, defaults, nil
+}
+
+// domainChecks returns the CHECK constraints of a domain on a column.
+func domainChecks(domain *catalog.UserType, column string) []string {
+	ref := catalog.QuoteIdentifierANSI(column)
+	var checks []string
+	if domain.NotNull {
+		checks = append(checks, "CHECK ("+ref+" IS NOT NULL)")
+	}
+	if domain.Check != "" {
+		var b strings.Builder
+		forEachUnquoted(domain.Check, func(segment string, quoted bool) {
+			if quoted {
+				b.WriteString(segment)
+			} else {
+				b.WriteString(domainValueRegex.ReplaceAllLiteralString(segment, ref))
+			}
+		})
+		checks = append(checks, "CHECK ("+b.String()+")")
+	}
+	return checks
+}
+
+// addTableConstraints appends the constraints to the column list of CREATE TABLE.
+func addTableConstraints(query string, constraints []string) (string, error) {
+	query = RemoveComments(query)
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '\'', '"':
+			for i++; i < len(query); i++ {
+				if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return query[:i] + ", " + strings.Join(constraints, ", ") + query[i:], nil
+			}
+		}
+	}
+	return "", newPgError("42601", "syntax error in CREATE TABLE")
+}
+
+// tableExists reports whether the table of CREATE TABLE exists already.
+func tableExists(ctx *sql.Context, create *tree.CreateTable) (bool, error) {
+	schema := create.Table.Schema()
+	if schema == "" {
+		schema = adapter.GetCurrentSchema(ctx)
+	}
+	var count int
+	if err := adapter.QueryRowCatalog(ctx,
+		"SELECT count(*) FROM duckdb_tables() WHERE database_name = current_database() AND schema_name = ? AND table_name = ?",
+		schema, create.Table.Table(),
+	).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,52 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCreateDomain(t *testing.T) {
+	ct, def, err := parseCreateDomain(`CREATE DOMAIN public."Price" AS numeric(10,2) NOT NULL DEFAULT 0 CHECK (VALUE >= 0) CHECK (VALUE < 1000);`)
+	require.NoError(t, err)
+	require.Equal(t, "public", ct.Table.Schema())
+	require.Equal(t, "Price", ct.Table.Table())
+	require.Equal(t, types.MakeDecimal(10, 2), def.Type)
+	require.Equal(t, tree.NotNull, def.Nullable.Nullability)
+	require.Equal(t, "0", tree.AsString(def.DefaultExpr.Expr))
+	require.Len(t, def.CheckExprs, 2)
+	require.Equal(t, "value >= 0", tree.AsString(def.CheckExprs[0].Expr))
+
+	_, def, err = parseCreateDomain(`create domain email text`)
+	require.NoError(t, err)
+	require.Equal(t, types.String, def.Type)
+	require.Nil(t, def.DefaultExpr.Expr)
+
+	// Unlike CockroachDB, integer is int4.
+	_, def, err = parseCreateDomain(`CREATE DOMAIN quantity AS integer CHECK (VALUE > 0)`)
+	require.NoError(t, err)
+	require.Equal(t, types.Int4, def.Type)
+
+	_, _, err = parseCreateDomain(`CREATE DOMAIN d AS int PRIMARY KEY REFERENCES`)
+	require.Error(t, err)
+}
+
+func TestDomainChecks(t *testing.T) {
+	domain := &catalog.UserType{Kind: catalog.UserTypeDomain, NotNull: true, Check: "(value ~ '^value$') AND (length(value) < 10)"}
+	require.Equal(t, []string{
+		`CHECK ("Code" IS NOT NULL)`,
+		`CHECK (("Code" ~ '^value$') AND (length("Code") < 10))`,
+	}, domainChecks(domain, "Code"))
+}
+
+func TestAddTableConstraints(t *testing.T) {
+	query, err := addTableConstraints(
+		`CREATE TABLE "t(1)" (id int PRIMARY KEY, note text DEFAULT ')', amount price) -- comment)`,
+		[]string{`CHECK ("amount" >= 0)`},
+	)
+	require.NoError(t, err)
+	require.Equal(t, `CREATE TABLE "t(1)" (id int PRIMARY KEY, note text DEFAULT ')', amount price, CHECK ("amount" >= 0)) `, query)
+}
@@ -16,25 +16,275 @@ package pgserver
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
+	"github.com/apecloud/myduckserver/adapter"
+	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/parser"
 	"github.com/cockroachdb/cockroachdb-parser/pkg/sql/sem/tree"
 	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/analyzer"
 )
 
+// maxCopyViewDepth limits the nesting of the views that a COPY FROM may target.
+const maxCopyViewDepth = 16
+
 // ValidateCopyFrom returns an error if the CopyFrom node is invalid.
-func ValidateCopyFrom(cf *tree.CopyFrom, ctx *sql.Context) (sql.InsertableTable, error) {
-	table, err := GetSqlTableFromContext(ctx, cf.Table.Schema(), cf.Table.Table())
+// The target is resolved through the engine catalog, see resolveCopyFromTarget, and the CopyFrom node is
+// rewritten in place to name the resolved base table, so that the data loaders write to the table
+// that the privileges are checked for.
+func ValidateCopyFrom(cf *tree.CopyFrom, ctx *sql.Context, cat *analyzer.Catalog) (sql.InsertableTable, error) {
+	table, err := resolveCopyFromTarget(ctx, cat, cf, 0)
 	if err != nil {
 		return nil, err
 	}
-	if table == nil {
-		return nil, fmt.Errorf(`relation "%s" does not exist`, cf.Table.Table())
+	if err := validateCopyColumns(table, cf.Table.Table(), cf.Columns); err != nil {
+		return nil, err
 	}
-	if it, ok := table.(sql.InsertableTable); !ok {
+	it, ok := table.(sql.InsertableTable)
+	if !ok {
 		return nil, fmt.Errorf(`table "%s" is read-only`, cf.Table.Table())
-	} else {
-		return it, nil
 	}
+	if err := checkCopyFromPrivileges(ctx, cat, cf.Table.Schema(), cf.Table.Table()); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// resolveCopyFromTarget resolves the relation that a COPY FROM loads data into.
+// A qualified name is looked up in its schema only. An unqualified name is looked up in the current schema,
+// and then in the schemas on the search_path in order. The names are matched case-insensitively.
+// If the relation is a simple updatable view, the view is resolved to its base table; see resolveCopyFromView.
+// The CopyFrom node is rewritten to name the resolved table with its actual schema and name.
+func resolveCopyFromTarget(ctx *sql.Context, cat *analyzer.Catalog, cf *tree.CopyFrom, depth int) (sql.Table, error) {
+	name := cf.Table.Table()
+	for _, schema := range copyTargetSchemas(ctx, cf.Table.Schema()) {
+		db, err := cat.Database(ctx, schema)
+		if sql.ErrDatabaseNotFound.Is(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		table, _, err := cat.DatabaseTable(ctx, db, name)
+		if err == nil {
+			cf.Table = tree.MakeTableNameWithSchema("", tree.Name(db.Name()), tree.Name(table.Name()))
+			return table, nil
+		} else if !sql.ErrTableNotFound.Is(err) {
+			return nil, err
+		}
+		table, ok, err := resolveCopyFromView(ctx, cat, cf, db, depth)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return table, nil
+		}
+	}
+	return nil, newPgError("42P01", `relation "%s" does not exist`, name)
+}
+
+// copyTargetSchemas returns the schemas that a relation named in a COPY statement is looked up in.
+func copyTargetSchemas(ctx *sql.Context, schema string) []string {
+	if schema != "" {
+		return []string{schema}
+	}
+	schemas := []string{ctx.GetCurrentDatabase()}
+	path, err := SearchPath(ctx)
+	if err != nil {
+		return schemas
+	}
+	for _, elem := range path {
+		elem = strings.Trim(elem, `"`)
+		if elem != "" && !slices.ContainsFunc(schemas, func(s string) bool { return strings.EqualFold(s, elem) }) {
+			schemas = append(schemas, elem)
+		}
+	}
+	return schemas
+}
+
+// checkCopyFromPrivileges returns an error if the user may not insert into the target of a COPY FROM.
+// The privileges are those of the MySQL account with the same name as the user, see backend.HasPrivilege.
+func checkCopyFromPrivileges(ctx *sql.Context, cat *analyzer.Catalog, database, table string) error {
+	subject := sql.PrivilegeCheckSubject{Database: database, Table: table}
+	if !backend.HasPrivilege(ctx, cat.MySQLDb, subject, sql.PrivilegeType_Insert) {
+		return newPgError("42501", "permission denied for table %s", table)
+	}
+	return nil
+}
+
+// validateCopyColumns returns an error if the column list of a COPY statement
+// references an unknown column or references a column more than once.
+func validateCopyColumns(table sql.Table, relation string, columns tree.NameList) error {
+	schema := table.Schema()
+	seen := make(map[string]struct{}, len(columns))
+	for _, column := range columns {
+		name := strings.ToLower(string(column))
+		if schema.IndexOfColName(name) < 0 {
+			return fmt.Errorf(`column "%s" of relation "%s" does not exist`, column, relation)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf(`column "%s" specified more than once`, column)
+		}
+		seen[name] = struct{}{}
+	}
+	return nil
+}
+
+// resolveCopyFromView resolves the target of a COPY FROM that is a view in the given schema.
+// Like PostgreSQL's auto-updatable views, the view must select plain columns from a single relation
+// without DISTINCT, GROUP BY, HAVING, window functions, LIMIT, or WITH.
+// The CopyFrom node is rewritten to target the base relation with the columns that the view columns map to,
+// and then the base relation is resolved in turn, so the columns of nested views are mapped level by level;
+// the omitted columns of the base table are filled with their defaults.
+// It returns false if there is no such view.
+func resolveCopyFromView(ctx *sql.Context, cat *analyzer.Catalog, cf *tree.CopyFrom, db sql.Database, depth int) (sql.Table, bool, error) {
+	name := cf.Table.Table()
+	vdb, ok := db.(sql.ViewDatabase)
+	if !ok {
+		return nil, false, nil
+	}
+	view, ok, err := vdb.GetViewDefinition(ctx, name)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if depth >= maxCopyViewDepth {
+		return nil, false, fmt.Errorf(`cannot copy to view "%s": too many levels of nested views`, name)
+	}
+
+	stmt, err := parser.ParseOne(view.CreateViewStatement)
+	if err != nil {
+		return nil, false, fmt.Errorf(`cannot copy to view "%s"`, name)
+	}
+	cv, ok := stmt.AST.(*tree.CreateView)
+	if !ok {
+		return nil, false, fmt.Errorf(`cannot copy to view "%s"`, name)
+	}
+	base, exprs, err := simpleViewSource(cv)
+	if err != nil {
+		return nil, false, fmt.Errorf(`cannot copy to view "%s": %w`, name, err)
+	}
+
+	// An unqualified base relation is in the schema of the view.
+	baseSchema := base.Schema()
+	if baseSchema == "" {
+		baseSchema = db.Name()
+	}
+
+	// Map the view columns to the columns of the base relation, which may be a view itself.
+	// An empty string marks a view column that is not a plain column reference.
+	var viewColumns, baseColumns []string
+	for _, expr := range exprs {
+		star := false
+		switch e := expr.Expr.(type) {
+		case tree.UnqualifiedStar:
+			star = true
+		case *tree.UnresolvedName:
+			if e.Star {
+				star = true
+				break
+			}
+			viewColumns = append(viewColumns, e.Parts[0])
+			baseColumns = append(baseColumns, e.Parts[0])
+		default:
+			viewColumns = append(viewColumns, "")
+			baseColumns = append(baseColumns, "")
+		}
+		if star {
+			columns, err := relationColumns(ctx, baseSchema, base.Table())
+			if err != nil {
+				return nil, false, err
+			}
+			viewColumns = append(viewColumns, columns...)
+			baseColumns = append(baseColumns, columns...)
+			continue
+		}
+		if expr.As != "" {
+			viewColumns[len(viewColumns)-1] = string(expr.As)
+		}
+	}
+	for i, alias := range cv.ColumnNames {
+		if i < len(viewColumns) {
+			viewColumns[i] = string(alias)
+		}
+	}
+
+	targets := cf.Columns
+	if len(targets) == 0 {
+		targets = make(tree.NameList, len(viewColumns))
+		for i, col := range viewColumns {
+			targets[i] = tree.Name(col)
+		}
+	}
+	columns := make(tree.NameList, len(targets))
+	for i, target := range targets {
+		idx := -1
+		for j, col := range viewColumns {
+			if strings.EqualFold(col, string(target)) {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 || target == "" {
+			return nil, false, fmt.Errorf(`column "%s" of relation "%s" does not exist`, target, name)
+		}
+		if baseColumns[idx] == "" {
+			return nil, false, fmt.Errorf(`cannot insert into column "%s" of view "%s": view columns that are not columns of their base relation are not updatable`, target, name)
+		}
+		columns[i] = tree.Name(baseColumns[idx])
+	}
+
+	cf.Table = tree.MakeTableNameWithSchema("", tree.Name(baseSchema), tree.Name(base.Table()))
+	cf.Columns = columns
+	table, err := resolveCopyFromTarget(ctx, cat, cf, depth+1)
+	if err != nil {
+		return nil, false, err
+	}
+	return table, true, nil
+}
+
+// relationColumns returns the names of the columns of a table or a view, which a star of a view expands to.
+func relationColumns(ctx *sql.Context, schema, name string) ([]string, error) {
+	rows, err := adapter.Query(ctx, "SELECT * FROM "+catalog.FullTableName(adapter.GetCurrentCatalog(ctx), schema, name)+" LIMIT 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+// simpleViewSource returns the base relation and the select list of a simple updatable view.
+func simpleViewSource(cv *tree.CreateView) (*tree.TableName, tree.SelectExprs, error) {
+	sel := cv.AsSource
+	if sel == nil || sel.With != nil || sel.Limit != nil || len(sel.OrderBy) > 0 {
+		return nil, nil, fmt.Errorf("views containing WITH, LIMIT, or ORDER BY are not automatically updatable")
+	}
+	clause, ok := sel.Select.(*tree.SelectClause)
+	if !ok {
+		return nil, nil, fmt.Errorf("views containing UNION, INTERSECT, EXCEPT, or VALUES are not automatically updatable")
+	}
+	if clause.Distinct || clause.DistinctOn != nil {
+		return nil, nil, fmt.Errorf("views containing DISTINCT are not automatically updatable")
+	}
+	if len(clause.GroupBy) > 0 || clause.Having != nil {
+		return nil, nil, fmt.Errorf("views containing GROUP BY or HAVING are not automatically updatable")
+	}
+	if len(clause.Window) > 0 {
+		return nil, nil, fmt.Errorf("views containing window functions are not automatically updatable")
+	}
+	if len(clause.From.Tables) != 1 {
+		return nil, nil, fmt.Errorf("views that do not select from a single table or view are not automatically updatable")
+	}
+	aliased, ok := clause.From.Tables[0].(*tree.AliasedTableExpr)
+	if !ok {
+		return nil, nil, fmt.Errorf("views that do not select from a single table or view are not automatically updatable")
+	}
+	base, ok := aliased.Expr.(*tree.TableName)
+	if !ok {
+		return nil, nil, fmt.Errorf("views that do not select from a single table or view are not automatically updatable")
+	}
+	return base, clause.Exprs, nil
 }
 
 // ValidateCopyTo returns an error if the CopyTo node is invalid, for example if it contains columns that
@@ -0,0 +1,127 @@
+package pgserver
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/apecloud/myduckserver/catalog"
+)
+
+// The pgvector compatibility layer. The vectors are stored as the fixed-size arrays of DuckDB, e.g., FLOAT[3],
+// which support the <-> (Euclidean distance) and <=> (cosine distance) operators of pgvector natively.
+// The rest of the syntax of pgvector is rewritten before the query is parsed:
+//
+//   - The type `vector(n)` becomes `FLOAT[n]`, and the cast `::vector` becomes `::FLOAT[]`.
+//   - `a <#> b` (the negative inner product) becomes `(-list_inner_product(a, b))`.
+//   - `CREATE INDEX ... USING hnsw (c vector_l2_ops) WITH (m = 16)` becomes an HNSW index of the vss extension
+//     with the corresponding metric, i.e., `l2sq`, `cosine`, or `ip`. The indexes are only available if the server
+//     loads the vss extension, i.e., with --vector-indexes; otherwise, the statement fails.
+//
+// The operands of <#> are limited to the column references, the literals, and the parameters.
+
+// precompile a regex to detect the pgvector syntax quickly
+var vectorSyntaxRegex = regexp.MustCompile(`(?i)\bvector\b|<#>|\busing\s+hnsw\b`)
+
+// precompile a regex to match the "vector(n)" type
+var vectorTypeRegex = regexp.MustCompile(`(?i)\bvector\s*\(\s*(\d+)\s*\)`)
+
+// precompile a regex to match the "::vector" cast without dimensions
+var vectorCastRegex = regexp.MustCompile(`(?i)::\s*vector\b`)
+
+// vectorOperandPattern matches a parameter, a string literal with an optional cast, an array literal, or a column reference.
+const vectorOperandPattern = `(\$\d+|'(?:[^']|'')*'(?:\s*::\s*\w+(?:\[\d*\])?)?|\[[^\[\]]*\]|` +
+	identifierPattern + `(?:\s*\.\s*` + identifierPattern + `)*)`
+
+// precompile a regex to match "a <#> b"
+var negativeInnerProductRegex = regexp.MustCompile(vectorOperandPattern + `\s*<#>\s*` + vectorOperandPattern)
+
+// precompile a regex to match "CREATE INDEX [IF NOT EXISTS] [name] ON table USING hnsw (column [opclass]) [WITH (options)]"
+var hnswIndexRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+INDEX\s+(IF\s+NOT\s+EXISTS\s+)?(?:(` + identifierPattern + `)\s+)?ON\s+(` +
+	identifierPattern + `(?:\s*\.\s*` + identifierPattern + `)?)\s+USING\s+hnsw\s*\(\s*(` + identifierPattern + `)(?:\s+(\w+))?\s*\)` +
+	`(?:\s*WITH\s*\(([^()]*)\))?\s*;?\s*$`)
+
+// precompile a regex to match an identifier
+var identifierRegex = regexp.MustCompile(identifierPattern)
+
+// hnswMetrics maps the operator classes of pgvector to the metrics of the HNSW indexes of DuckDB.
+var hnswMetrics = map[string]string{
+	"":                  "l2sq",
+	"vector_l2_ops":     "l2sq",
+	"vector_cosine_ops": "cosine",
+	"vector_ip_ops":     "ip",
+}
+
+// convertVectorSyntax rewrites the pgvector syntax in the query into the DuckDB syntax.
+// The HNSW indexes are rejected unless vectorIndexes is set, see catalog.ProviderOptions.VectorIndexes.
+func convertVectorSyntax(query string, vectorIndexes bool) (string, error) {
+	if !vectorSyntaxRegex.MatchString(query) {
+		return query, nil
+	}
+	if m := hnswIndexRegex.FindStringSubmatch(query); m != nil {
+		if converted, ok := convertHNSWIndex(m); ok {
+			if !vectorIndexes {
+				return "", newPgError("0A000", "HNSW indexes are not enabled; start the server with --vector-indexes")
+			}
+			return converted, nil
+		}
+	}
+	var b strings.Builder
+	forEachUnquoted(query, func(segment string, quoted bool) {
+		if !quoted {
+			segment = vectorTypeRegex.ReplaceAllString(segment, "FLOAT[$1]")
+			segment = vectorCastRegex.ReplaceAllString(segment, "::FLOAT[]")
+		}
+		b.WriteString(segment)
+	})
+	query = negativeInnerProductRegex.ReplaceAllString(b.String(), "(-list_inner_product($1, $2))")
+	return query, nil
+}
+
+// convertHNSWIndex converts the submatches of hnswIndexRegex into a CREATE INDEX statement of the vss extension.
+func convertHNSWIndex(m []string) (string, bool) {
+	ifNotExists, name, table, column, opclass, options := m[1], m[2], m[3], m[4], strings.ToLower(m[5]), m[6]
+	metric, ok := hnswMetrics[opclass]
+	if !ok {
+		return "", false
+	}
+	if name == "" {
+		// The default name of Postgres, e.g., items_embedding_idx.
+		name = catalog.QuoteIdentifierANSI(unquoteIdentifier(lastIdentifier(table)) + "_" + unquoteIdentifier(column) + "_idx")
+	}
+
+	var b strings.Builder
+	b.WriteString("CREATE INDEX ")
+	if ifNotExists != "" {
+		b.WriteString("IF NOT EXISTS ")
+	}
+	b.WriteString(name + " ON " + table + " USING HNSW (" + column + ") WITH (metric = '" + metric + "'")
+	if options = strings.TrimSpace(options); options != "" {
+		b.WriteString(", " + options)
+	}
+	b.WriteString(")")
+	return b.String(), true
+}
+
+// lastIdentifier returns the last part of a possibly qualified name.
+func lastIdentifier(name string) string {
+	parts := identifierRegex.FindAllString(name, -1)
+	return parts[len(parts)-1]
+}
+
+// unquoteIdentifier returns the name denoted by an identifier:
+// the quoted identifiers are unquoted, and the others are folded to lower case.
+func unquoteIdentifier(ident string) string {
+	if len(ident) >= 2 && strings.HasPrefix(ident, `"`) && strings.HasSuffix(ident, `"`) {
+		return strings.ReplaceAll(ident[1:len(ident)-1], `""`, `"`)
+	}
+	return strings.ToLower(ident)
+}
+
+// vectorIndexes reports whether the HNSW indexes are available to the connection.
+func (h *ConnectionHandler) vectorIndexes() bool {
+	if h.duckHandler == nil {
+		return false
+	}
+	provider := h.duckHandler.GetCatalogProvider()
+	return provider != nil && provider.HasVectorIndexes()
+}
@@ -0,0 +1,62 @@
+package pgserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertVectorSyntax(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			"CREATE TABLE items (id bigserial PRIMARY KEY, embedding vector(3))",
+			"CREATE TABLE items (id bigserial PRIMARY KEY, embedding FLOAT[3])",
+		},
+		{
+			"SELECT * FROM items ORDER BY embedding <-> '[3,1,2]'::vector LIMIT 5",
+			"SELECT * FROM items ORDER BY embedding <-> '[3,1,2]'::FLOAT[] LIMIT 5",
+		},
+		{
+			"SELECT id, items.embedding <#> '[3,1,2]'::vector(3) AS score FROM items",
+			"SELECT id, (-list_inner_product(items.embedding, '[3,1,2]'::FLOAT[3])) AS score FROM items",
+		},
+		{
+			"SELECT * FROM items ORDER BY embedding <#> $1 LIMIT 5",
+			"SELECT * FROM items ORDER BY (-list_inner_product(embedding, $1)) LIMIT 5",
+		},
+		{
+			"CREATE INDEX ON items USING hnsw (embedding vector_l2_ops)",
+			`CREATE INDEX "items_embedding_idx" ON items USING HNSW (embedding) WITH (metric = 'l2sq')`,
+		},
+		{
+			"CREATE INDEX IF NOT EXISTS idx ON public.Items USING HNSW (embedding vector_cosine_ops) WITH (m = 16, ef_construction = 64);",
+			`CREATE INDEX IF NOT EXISTS idx ON public.Items USING HNSW (embedding) WITH (metric = 'cosine', m = 16, ef_construction = 64)`,
+		},
+		{
+			// The strings and the other operator classes are left untouched.
+			"SELECT 'vector(3)', vector FROM t",
+			"SELECT 'vector(3)', vector FROM t",
+		},
+		{
+			"CREATE INDEX ON items USING hnsw (embedding vector_l1_ops)",
+			"CREATE INDEX ON items USING hnsw (embedding vector_l1_ops)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			converted, err := convertVectorSyntax(tt.query, true)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, converted)
+		})
+	}
+
+	// The HNSW indexes are rejected if the vss extension is not enabled, while the rest of the syntax is not.
+	_, err := convertVectorSyntax("CREATE INDEX ON items USING hnsw (embedding vector_l2_ops)", false)
+	require.ErrorContains(t, err, "--vector-indexes")
+	converted, err := convertVectorSyntax("SELECT embedding::vector FROM items", false)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT embedding::FLOAT[] FROM items", converted)
+}
@@ -0,0 +1,40 @@
+package pgserver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apecloud/myduckserver/backend"
+)
+
+// WorkloadClassParameter is the session parameter that tags the queries of the session
+// as `interactive` or `background` for the query scheduler, see backend.WorkloadClassVariable.
+const WorkloadClassParameter = "myduck.workload_class"
+
+// setWorkloadClass handles `SET myduck.workload_class = interactive|background`.
+func (h *ConnectionHandler) setWorkloadClass(value any, useDefault bool) error {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return err
+	}
+	if useDefault {
+		value = backend.WorkloadInteractive
+	}
+	if err := ctx.SetSessionVariable(ctx, backend.WorkloadClassVariable, fmt.Sprint(value)); err != nil {
+		return newPgError("22023", `invalid value for parameter "%s": "%v"`, WorkloadClassParameter, value)
+	}
+	return nil
+}
+
+// workloadClass returns the workload class of the session.
+func (h *ConnectionHandler) workloadClass() (string, error) {
+	ctx, err := h.duckHandler.NewContext(context.Background(), h.mysqlConn, "")
+	if err != nil {
+		return "", err
+	}
+	class, err := ctx.GetSessionVariable(ctx, backend.WorkloadClassVariable)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(class), nil
+}
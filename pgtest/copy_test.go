@@ -0,0 +1,115 @@
+package pgtest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFromTargetResolution(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	for _, stmt := range []string{
+		"CREATE SCHEMA extra",
+		"CREATE TABLE public.items (id INTEGER, name VARCHAR)",
+		"CREATE TABLE extra.items (id INTEGER, name VARCHAR)",
+		"CREATE TABLE extra.only_extra (id INTEGER)",
+		"CREATE VIEW extra.item_names AS SELECT name AS label, id FROM items",
+		"CREATE TABLE nested (a INTEGER, b VARCHAR)",
+		"CREATE VIEW nested_v1 AS SELECT a, b FROM nested",
+		"CREATE VIEW nested_alias AS SELECT a AS x FROM nested_v1",
+		"CREATE VIEW nested_omitted AS SELECT a FROM nested_v1",
+	} {
+		_, err := conn.Exec(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	tests := []struct {
+		name       string
+		searchPath string
+		copy       string
+		data       string
+		table      string // the table that receives the rows
+		code       string
+	}{
+		{name: "current schema", copy: "COPY items FROM STDIN", data: "1\ta\n", table: "public.items"},
+		{name: "case-insensitive name", copy: "COPY ITEMS FROM STDIN", data: "2\tb\n", table: "public.items"},
+		{name: "qualified name", copy: "COPY Extra.Items FROM STDIN", data: "3\tc\n", table: "extra.items"},
+		{name: "search path", searchPath: "extra, public", copy: "COPY only_extra FROM STDIN", data: "4\n", table: "extra.only_extra"},
+		{name: "current schema before search path", searchPath: "extra, public", copy: "COPY items FROM STDIN", data: "5\te\n", table: "public.items"},
+		{name: "view on search path", searchPath: "extra", copy: "COPY item_names (label) FROM STDIN", data: "f\n", table: "extra.items"},
+		{name: "nested view with alias", copy: "COPY nested_alias (x) FROM STDIN", data: "8\n", table: "public.nested"},
+		{name: "nested view with omitted column", copy: "COPY nested_omitted FROM STDIN", data: "9\n", table: "public.nested"},
+		{name: "not on search path", searchPath: "public", copy: "COPY only_extra FROM STDIN", data: "6\n", code: "42P01"},
+		{name: "nonexistent", copy: "COPY nonexistent FROM STDIN", data: "7\n", code: "42P01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searchPath := tt.searchPath
+			if searchPath == "" {
+				searchPath = `"$user", public`
+			}
+			_, err := conn.Exec(ctx, "SET search_path TO "+searchPath)
+			require.NoError(t, err)
+
+			var before int
+			if tt.table != "" {
+				require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM "+tt.table).Scan(&before))
+			}
+
+			tag, err := conn.PgConn().CopyFrom(ctx, strings.NewReader(tt.data), tt.copy)
+			if tt.code != "" {
+				var pgErr *pgconn.PgError
+				require.True(t, errors.As(err, &pgErr), "unexpected error: %v", err)
+				require.Equal(t, tt.code, pgErr.Code, pgErr.Message)
+				return
+			}
+			require.NoError(t, err)
+			require.EqualValues(t, 1, tag.RowsAffected())
+
+			var after int
+			require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM "+tt.table).Scan(&after))
+			require.Equal(t, before+1, after)
+		})
+	}
+}
+
+func TestCopyFromAppender(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, "CREATE TABLE appended (id INTEGER, score DOUBLE, name VARCHAR)")
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, "SET myduck.copy_appender = on")
+	require.NoError(t, err)
+	var setting string
+	require.NoError(t, conn.QueryRow(ctx, "SHOW myduck.copy_appender").Scan(&setting))
+	require.Equal(t, "on", setting)
+
+	tag, err := conn.PgConn().CopyFrom(ctx, strings.NewReader("1,1.5,a\n2,,\"b, c\"\n"), "COPY appended FROM STDIN (FORMAT CSV)")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, tag.RowsAffected())
+
+	// A failed load leaves no rows behind.
+	_, err = conn.PgConn().CopyFrom(ctx, strings.NewReader("3,0,d\nx,0,e\n"), "COPY appended FROM STDIN (FORMAT CSV)")
+	var pgErr *pgconn.PgError
+	require.True(t, errors.As(err, &pgErr), "unexpected error: %v", err)
+
+	// Partial column lists fall back to SQL, which fills in the defaults.
+	tag, err = conn.PgConn().CopyFrom(ctx, strings.NewReader("4\n"), "COPY appended (id) FROM STDIN (FORMAT CSV)")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, tag.RowsAffected())
+
+	var count int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM appended").Scan(&count))
+	require.Equal(t, 3, count)
+}
@@ -0,0 +1,64 @@
+package pgtest
+
+import (
+	stdsql "database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/apecloud/myduckserver/server"
+	"github.com/apecloud/myduckserver/testutil"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+// TestInheritColumnTypes tests that the tables written by `CREATE TABLE ... AS SELECT` and `INSERT INTO ... SELECT`
+// over either protocol keep the MySQL types of the columns that they copy when read over the MySQL protocol.
+func TestInheritColumnTypes(t *testing.T) {
+	mysqlPort, pgPort := testutil.FindFreePort(), testutil.FindFreePort()
+	ctx, _, conn, close, err := CreateTestServer(t, pgPort, server.WithPorts(mysqlPort, pgPort))
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	mysql, err := stdsql.Open("mysql", fmt.Sprintf("root@tcp(127.0.0.1:%d)/public", mysqlPort))
+	require.NoError(t, err)
+	defer mysql.Close()
+
+	// YEAR is stored as SMALLINT, and recorded in the comment of the column.
+	for _, stmt := range []string{
+		"CREATE TABLE src (id INT PRIMARY KEY, y YEAR)",
+		"INSERT INTO src VALUES (1, 2024)",
+	} {
+		_, err = mysql.Exec(stmt)
+		require.NoError(t, err, stmt)
+	}
+	for _, stmt := range []string{
+		// An expression named after a copied column does not inherit its type.
+		"CREATE TABLE ctas AS SELECT s.y AS born, (s.y + 1)::SMALLINT AS y FROM public.src s",
+		"CREATE TABLE dst (id INTEGER, y SMALLINT, z SMALLINT)",
+		"INSERT INTO dst (y, id, z) SELECT y, id, y + 0 FROM src",
+		"CREATE TABLE mysql_dst (y SMALLINT)",
+	} {
+		_, err = conn.Exec(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+	_, err = mysql.Exec("INSERT INTO mysql_dst SELECT y FROM src")
+	require.NoError(t, err)
+
+	dataTypes := func(table string) map[string]string {
+		rows, err := mysql.Query("SELECT column_name, data_type FROM information_schema.columns WHERE table_schema = 'public' AND table_name = ?", table)
+		require.NoError(t, err)
+		defer rows.Close()
+		types := make(map[string]string)
+		for rows.Next() {
+			var name, typ string
+			require.NoError(t, rows.Scan(&name, &typ))
+			types[name] = typ
+		}
+		require.NoError(t, rows.Err())
+		return types
+	}
+	require.Equal(t, map[string]string{"born": "year", "y": "smallint"}, dataTypes("ctas"))
+	require.Equal(t, map[string]string{"id": "int", "y": "year", "z": "smallint"}, dataTypes("dst"))
+	require.Equal(t, map[string]string{"y": "year"}, dataTypes("mysql_dst"))
+}
@@ -0,0 +1,129 @@
+package pgtest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectToAttachedCatalogs(t *testing.T) {
+	port := testutil.FindFreePort()
+	ctx, _, conn, close, err := CreateTestServer(t, port)
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, "ATTACH ':memory:' AS analytics")
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, "CREATE TABLE analytics.main.events (id INTEGER)")
+	require.NoError(t, err)
+
+	rows, err := conn.Query(ctx, "SELECT datname FROM pg_catalog.pg_database ORDER BY datname")
+	require.NoError(t, err)
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	require.NoError(t, err)
+	require.Equal(t, []string{"analytics", "memory"}, names)
+
+	tests := []struct {
+		database string
+		catalog  string
+		schema   string
+		code     string
+	}{
+		{database: "memory", catalog: "memory", schema: "public"},
+		{database: "postgres", catalog: "memory", schema: "public"},
+		{database: "analytics", catalog: "analytics", schema: "main"},
+		{database: "Analytics", catalog: "analytics", schema: "main"},
+		{database: "nonexistent", code: "3D000"},
+		{database: "system", code: "3D000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.database, func(t *testing.T) {
+			c, err := pgx.Connect(ctx, fmt.Sprintf("postgres://postgres:@127.0.0.1:%d/%s", port, tt.database))
+			if tt.code != "" {
+				var pgErr *pgconn.PgError
+				require.True(t, errors.As(err, &pgErr), "unexpected error: %v", err)
+				require.Equal(t, tt.code, pgErr.Code)
+				require.Equal(t, fmt.Sprintf(`database "%s" does not exist`, tt.database), pgErr.Message)
+				return
+			}
+			require.NoError(t, err)
+			defer c.Close(ctx)
+
+			var catalog, schema string
+			require.NoError(t, c.QueryRow(ctx, "SELECT current_database(), current_schema()").Scan(&catalog, &schema))
+			require.Equal(t, tt.catalog, catalog)
+			require.Equal(t, tt.schema, schema)
+		})
+	}
+
+	t.Run("cross-database reference", func(t *testing.T) {
+		_, err := conn.Exec(ctx, "SELECT * FROM nonexistent.main.events")
+		var pgErr *pgconn.PgError
+		require.True(t, errors.As(err, &pgErr), "unexpected error: %v", err)
+		require.Equal(t, "3D000", pgErr.Code, pgErr.Message)
+	})
+}
+
+func TestSwitchDatabase(t *testing.T) {
+	port := testutil.FindFreePort()
+	ctx, _, conn, close, err := CreateTestServer(t, port)
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	for _, stmt := range []string{
+		"CREATE SCHEMA s1",
+		"CREATE SCHEMA s2",
+		"CREATE TABLE s1.t (v TEXT)",
+		"CREATE TABLE s2.t (v TEXT)",
+		"INSERT INTO s1.t VALUES ('s1')",
+		"INSERT INTO s2.t VALUES ('s2')",
+	} {
+		_, err := conn.Exec(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	// The current schema is the same for the queries executed by DuckDB and by the engine,
+	// whichever statement switches it, and with both the simple and the extended protocol.
+	for _, mode := range []pgx.QueryExecMode{pgx.QueryExecModeSimpleProtocol, pgx.QueryExecModeCacheStatement} {
+		for _, tt := range []struct {
+			stmt   string
+			schema string
+		}{
+			{"USE s1", "s1"},
+			{"SET database = s2", "s2"},
+			{"USE s2", "s2"},
+			{"SET database TO 's1'", "s1"},
+			{"USE memory.s2", "s2"},
+			{"USE public", "public"},
+			{"SET database = s1", "s1"},
+		} {
+			_, err := conn.Exec(ctx, tt.stmt, mode)
+			require.NoError(t, err, tt.stmt)
+
+			var schema string
+			require.NoError(t, conn.QueryRow(ctx, "SELECT current_schema()", mode).Scan(&schema), tt.stmt)
+			require.Equal(t, tt.schema, schema, tt.stmt)
+			if tt.schema != "public" {
+				var v string
+				require.NoError(t, conn.QueryRow(ctx, "SELECT v FROM t", mode).Scan(&v), tt.stmt)
+				require.Equal(t, tt.schema, v, tt.stmt)
+			}
+		}
+	}
+
+	// The current schema is kept if the switch fails.
+	_, err = conn.Exec(ctx, "SET database = nonexistent")
+	var pgErr *pgconn.PgError
+	require.True(t, errors.As(err, &pgErr), "unexpected error: %v", err)
+	require.Equal(t, "3F000", pgErr.Code)
+	var schema string
+	require.NoError(t, conn.QueryRow(ctx, "SELECT current_schema()").Scan(&schema))
+	require.Equal(t, "s1", schema)
+}
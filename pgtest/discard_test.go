@@ -0,0 +1,89 @@
+package pgtest
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscard(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	countTemp := func() (n int) {
+		require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM duckdb_tables() WHERE temporary", pgx.QueryExecModeSimpleProtocol).Scan(&n))
+		return
+	}
+
+	for _, mode := range []pgx.QueryExecMode{pgx.QueryExecModeSimpleProtocol, pgx.QueryExecModeExec} {
+		t.Run(mode.String(), func(t *testing.T) {
+			_, err := conn.Exec(ctx, "CREATE TEMP TABLE discard_t (id INT)")
+			require.NoError(t, err)
+			_, err = conn.Exec(ctx, "CREATE TEMP VIEW discard_v AS SELECT * FROM discard_t")
+			require.NoError(t, err)
+			_, err = conn.Exec(ctx, "CREATE TEMP SEQUENCE discard_s")
+			require.NoError(t, err)
+			require.Equal(t, 1, countTemp())
+
+			tag, err := conn.Exec(ctx, "DISCARD TEMP", mode)
+			require.NoError(t, err)
+			require.Equal(t, "DISCARD TEMP", tag.String())
+			require.Equal(t, 0, countTemp())
+			_, err = conn.Exec(ctx, "SELECT * FROM discard_v")
+			require.Error(t, err)
+			_, err = conn.Exec(ctx, "SELECT nextval('discard_s')")
+			require.Error(t, err)
+
+			tag, err = conn.Exec(ctx, "DISCARD SEQUENCES", mode)
+			require.NoError(t, err)
+			require.Equal(t, "DISCARD SEQUENCES", tag.String())
+		})
+	}
+
+	t.Run("PLANS", func(t *testing.T) {
+		_, err := conn.Exec(ctx, "CREATE TABLE discard_plans (id INT, v INT)")
+		require.NoError(t, err)
+		_, err = conn.Exec(ctx, "INSERT INTO discard_plans VALUES (1, 10)")
+		require.NoError(t, err)
+		_, err = conn.Prepare(ctx, "plan", "SELECT v FROM discard_plans WHERE id = $1")
+		require.NoError(t, err)
+
+		tag, err := conn.Exec(ctx, "DISCARD PLANS", pgx.QueryExecModeSimpleProtocol)
+		require.NoError(t, err)
+		require.Equal(t, "DISCARD PLANS", tag.String())
+
+		// The prepared statement survives DISCARD PLANS.
+		var v int
+		require.NoError(t, conn.QueryRow(ctx, "plan", 1).Scan(&v))
+		require.Equal(t, 10, v)
+
+		_, err = conn.Exec(ctx, "DISCARD PLANS", pgx.QueryExecModeExec)
+		require.NoError(t, err)
+		require.NoError(t, conn.QueryRow(ctx, "plan", 1).Scan(&v))
+		require.Equal(t, 10, v)
+	})
+
+	t.Run("ALL", func(t *testing.T) {
+		_, err := conn.Exec(ctx, "CREATE TEMP TABLE discard_all (id INT)")
+		require.NoError(t, err)
+
+		tx, err := conn.Begin(ctx)
+		require.NoError(t, err)
+		_, err = tx.Exec(ctx, "DISCARD ALL")
+		require.ErrorContains(t, err, "cannot run inside a transaction block")
+		require.NoError(t, tx.Rollback(ctx))
+
+		tag, err := conn.Exec(ctx, "DISCARD ALL", pgx.QueryExecModeSimpleProtocol)
+		require.NoError(t, err)
+		require.Equal(t, "DISCARD ALL", tag.String())
+		require.Equal(t, 0, countTemp())
+
+		// The prepared statements are deallocated.
+		var v int
+		require.ErrorContains(t, conn.QueryRow(ctx, "plan", 1).Scan(&v), "does not exist")
+	})
+}
@@ -0,0 +1,59 @@
+package pgtest
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailedTransactionBlock(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, "CREATE TABLE failed_txn (id INT)")
+	require.NoError(t, err)
+
+	requireAborted := func(err error) {
+		var pgErr *pgconn.PgError
+		require.ErrorAs(t, err, &pgErr)
+		require.Equal(t, "25P02", pgErr.Code)
+	}
+	count := func() (n int) {
+		require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM failed_txn").Scan(&n))
+		return
+	}
+
+	for _, mode := range []pgx.QueryExecMode{pgx.QueryExecModeSimpleProtocol, pgx.QueryExecModeExec} {
+		t.Run(mode.String(), func(t *testing.T) {
+			for _, end := range []string{"ROLLBACK", "COMMIT"} {
+				_, err := conn.Exec(ctx, "BEGIN", mode)
+				require.NoError(t, err)
+				_, err = conn.Exec(ctx, "INSERT INTO failed_txn VALUES (1)", mode)
+				require.NoError(t, err)
+				_, err = conn.Exec(ctx, "SELECT * FROM no_such_table", mode)
+				require.Error(t, err)
+
+				// The statements are rejected until the end of the transaction block.
+				_, err = conn.Exec(ctx, "SELECT 1", mode)
+				requireAborted(err)
+				_, err = conn.Exec(ctx, "INSERT INTO failed_txn VALUES (2)", mode)
+				requireAborted(err)
+				_, err = conn.Exec(ctx, "SET application_name = 'failed'", mode)
+				requireAborted(err)
+				require.Equal(t, byte('E'), conn.PgConn().TxStatus())
+
+				// COMMIT rolls back the failed transaction block.
+				tag, err := conn.Exec(ctx, end, mode)
+				require.NoError(t, err)
+				require.Equal(t, "ROLLBACK", tag.String())
+				require.Equal(t, byte('I'), conn.PgConn().TxStatus())
+				require.Zero(t, count())
+			}
+		})
+	}
+}
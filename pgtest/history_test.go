@@ -0,0 +1,65 @@
+package pgtest
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryMode(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	for _, stmt := range []string{
+		"CREATE TABLE public.history_t (id INT PRIMARY KEY, v VARCHAR)",
+		"INSERT INTO public.history_t VALUES (1, 'a'), (2, 'b')",
+		"CREATE TABLE public.history_nopk (id INT, v VARCHAR)",
+	} {
+		_, err := conn.Exec(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	requireSQLState := func(t *testing.T, code string, err error) {
+		var pgErr *pgconn.PgError
+		require.ErrorAs(t, err, &pgErr)
+		require.Equal(t, code, pgErr.Code)
+	}
+
+	var historyTable string
+	require.NoError(t, conn.QueryRow(ctx, "SELECT myduck_enable_history('public.history_t')").Scan(&historyTable))
+	require.Equal(t, "history_t__history", historyTable)
+
+	_, err = conn.Exec(ctx, "SELECT myduck_enable_history('history_t')")
+	requireSQLState(t, "55000", err)
+	_, err = conn.Exec(ctx, "SELECT myduck_enable_history('history_nopk')")
+	requireSQLState(t, "55000", err)
+	_, err = conn.Exec(ctx, "SELECT myduck_enable_history('history_missing')")
+	requireSQLState(t, "42P01", err)
+
+	// The rows in the table at the time the history mode is enabled are the start of the history.
+	var count int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM history_t__history WHERE __action = 2").Scan(&count))
+	require.Equal(t, 2, count)
+
+	var v string
+	require.NoError(t, conn.QueryRow(ctx,
+		"SELECT h.v FROM history_t FOR SYSTEM_TIME AS OF '2100-01-01 00:00:00+00' h WHERE h.id = 2",
+	).Scan(&v))
+	require.Equal(t, "b", v)
+	require.NoError(t, conn.QueryRow(ctx,
+		"SELECT count(*) FROM public.history_t FOR SYSTEM_TIME AS OF TIMESTAMP '2000-01-01 00:00:00+00'",
+	).Scan(&count))
+	require.Zero(t, count)
+
+	_, err = conn.Exec(ctx, "SELECT count(*) FROM history_nopk FOR SYSTEM_TIME AS OF '2100-01-01 00:00:00+00'")
+	requireSQLState(t, "55000", err)
+
+	require.NoError(t, conn.QueryRow(ctx, "SELECT myduck_disable_history('history_t')").Scan(&historyTable))
+	require.Equal(t, "history_t__history", historyTable)
+	_, err = conn.Exec(ctx, "SELECT myduck_disable_history('history_t')")
+	requireSQLState(t, "55000", err)
+}
@@ -0,0 +1,148 @@
+package pgtest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedBindParameters(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	timestamp := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	tests := []struct {
+		typ   string
+		value any
+		text  string // the stored value cast to VARCHAR
+	}{
+		{typ: "BOOLEAN", value: true, text: "true"},
+		{typ: "SMALLINT", value: int16(-32768), text: "-32768"},
+		{typ: "INTEGER", value: int32(2147483647), text: "2147483647"},
+		{typ: "BIGINT", value: int64(9007199254740993), text: "9007199254740993"},
+		{typ: "REAL", value: float32(1.5), text: "1.5"},
+		{typ: "DOUBLE", value: 0.1, text: "0.1"},
+		{typ: "DECIMAL(38,10)", value: "1234567890123456789012345678.0123456789", text: "1234567890123456789012345678.0123456789"},
+		{typ: "VARCHAR", value: "it's a 'quoted' string", text: "it's a 'quoted' string"},
+		{typ: "BLOB", value: []byte{0, 1, 0xff}, text: `\x00\x01\xFF`},
+		{typ: "DATE", value: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), text: "2024-01-02"},
+		{typ: "TIMESTAMP", value: timestamp, text: "2024-01-02 03:04:05.123456"},
+		{typ: "TIMESTAMPTZ", value: timestamp.In(time.FixedZone("", -5*3600)), text: "1704164645123456"},
+		{typ: "INTERVAL", value: pgtype.Interval{Months: 1, Days: 2, Microseconds: 3, Valid: true}, text: "1 month 2 days 00:00:00.000003"},
+		{typ: "UUID", value: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", text: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.typ, func(t *testing.T) {
+			// pgx caches the parameter types by the statement text, so each type gets its own table.
+			table := fmt.Sprintf("bind_params_%d", i)
+			_, err := conn.Exec(ctx, "CREATE TABLE "+table+" (v "+tt.typ+")")
+			require.NoError(t, err)
+			// The parameter types are inferred from the target column, so pgx sends them in the binary format if possible.
+			_, err = conn.Exec(ctx, "INSERT INTO "+table+" VALUES ($1), ($2)", tt.value, nil)
+			require.NoError(t, err)
+
+			var n int64
+			require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM "+table+" WHERE v = $1", tt.value).Scan(&n))
+			require.EqualValues(t, 1, n)
+			require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM "+table+" WHERE v IS NULL").Scan(&n))
+			require.EqualValues(t, 1, n)
+
+			if tt.text != "" {
+				var text string
+				expr := "v::VARCHAR"
+				if tt.typ == "TIMESTAMPTZ" {
+					// The text representation depends on the session time zone.
+					expr = "epoch_us(v)::VARCHAR"
+				}
+				require.NoError(t, conn.QueryRow(ctx, "SELECT "+expr+" FROM "+table+" WHERE v IS NOT NULL").Scan(&text))
+				require.Equal(t, tt.text, text)
+			}
+		})
+	}
+
+}
+
+func TestDescribeParameters(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, "CREATE TABLE describe_params (d DECIMAL(10,2), u UUID, tz TIMESTAMPTZ, l INT[], e ENUM('a', 'b'), s VARCHAR)")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		query     string
+		paramOIDs []uint32 // the types specified by the client
+		want      []uint32
+	}{
+		{
+			name:  "INSERT",
+			query: "INSERT INTO describe_params VALUES ($1, $2, $3, $4, $5, $6)",
+			want:  []uint32{pgtype.NumericOID, pgtype.UUIDOID, pgtype.TimestamptzOID, pgtype.TextArrayOID, pgtype.TextOID, pgtype.TextOID},
+		},
+		{
+			name:  "WHERE",
+			query: "SELECT s FROM describe_params WHERE d = $1 AND tz > $2",
+			want:  []uint32{pgtype.NumericOID, pgtype.TimestamptzOID},
+		},
+		{
+			name:      "Partially specified types",
+			query:     "SELECT s FROM describe_params WHERE d = $1 AND tz > $2",
+			paramOIDs: []uint32{pgtype.Int8OID},
+			want:      []uint32{pgtype.Int8OID, pgtype.TimestamptzOID},
+		},
+		{
+			name:  "Unknown type",
+			query: "SELECT $1",
+			want:  []uint32{pgtype.TextOID},
+		},
+		{
+			name:  "Type inferred from the other operand",
+			query: "SELECT $1 + 1, $2 AND true",
+			want:  []uint32{pgtype.Int4OID, pgtype.BoolOID},
+		},
+		{
+			name:  "No parameters",
+			query: "SELECT s FROM describe_params",
+			want:  []uint32{},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := conn.PgConn().Prepare(ctx, fmt.Sprintf("describe_params_%d", i), tt.query, tt.paramOIDs)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, sd.ParamOIDs)
+		})
+	}
+
+	t.Run("Too many parameter types", func(t *testing.T) {
+		_, err := conn.PgConn().Prepare(ctx, "too_many", "SELECT $1::INT", []uint32{pgtype.Int4OID, pgtype.Int4OID})
+		require.ErrorContains(t, err, "08P01")
+	})
+
+	t.Run("Bind the described types", func(t *testing.T) {
+		_, err := conn.Exec(ctx, "INSERT INTO describe_params VALUES ($1, $2, $3, $4, $5, $6)",
+			"12.34", "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", time.Now(), []string{"1", "2"}, "b", "x")
+		require.NoError(t, err)
+		var text string
+		require.NoError(t, conn.QueryRow(ctx, "SELECT l::VARCHAR || e || d::VARCHAR FROM describe_params").Scan(&text))
+		require.Equal(t, "[1, 2]b12.34", text)
+	})
+
+	t.Run("Bind the inferred types", func(t *testing.T) {
+		var text string
+		var sum int32
+		require.NoError(t, conn.QueryRow(ctx, "SELECT $1, $2 + 1", "it's", 41).Scan(&text, &sum))
+		require.Equal(t, "it's", text)
+		require.EqualValues(t, 42, sum)
+	})
+}
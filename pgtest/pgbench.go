@@ -0,0 +1,233 @@
+package pgtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PgbenchOptions configures a pgbench-style workload, i.e., the built-in TPC-B-like script of pgbench.
+type PgbenchOptions struct {
+	// Scale is the number of branches. Each branch has 10 tellers and AccountsPerBranch accounts.
+	Scale int
+	// AccountsPerBranch defaults to 100000 as in pgbench, which is usually too large for a smoke test.
+	AccountsPerBranch int
+	// Clients is the number of concurrent connections.
+	Clients int
+	// Transactions is the number of transactions that each client runs.
+	Transactions int
+	// MaxRetries is the number of times a transaction is retried after a serialization failure,
+	// e.g., a write-write conflict in DuckDB.
+	MaxRetries int
+	// QueryMode is the protocol to submit the queries with, like `pgbench -M`:
+	// "simple" (the default), "extended", or "prepared".
+	QueryMode string
+}
+
+func (o *PgbenchOptions) queryExecMode() (pgx.QueryExecMode, error) {
+	switch o.QueryMode {
+	case "", "simple":
+		return pgx.QueryExecModeSimpleProtocol, nil
+	case "extended":
+		return pgx.QueryExecModeExec, nil
+	case "prepared":
+		return pgx.QueryExecModeCacheStatement, nil
+	default:
+		return 0, fmt.Errorf("invalid query mode: %q", o.QueryMode)
+	}
+}
+
+func (o *PgbenchOptions) setDefaults() {
+	o.Scale = max(o.Scale, 1)
+	if o.AccountsPerBranch <= 0 {
+		o.AccountsPerBranch = 100000
+	}
+	o.Clients = max(o.Clients, 1)
+	o.Transactions = max(o.Transactions, 1)
+}
+
+// BenchResult summarizes a benchmark run.
+type BenchResult struct {
+	Transactions int
+	Retries      int
+	Duration     time.Duration
+}
+
+// TPS returns the number of committed transactions per second.
+func (r *BenchResult) TPS() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Transactions) / r.Duration.Seconds()
+}
+
+func (r *BenchResult) String() string {
+	return fmt.Sprintf("transactions: %d, retries: %d, duration: %v, tps: %.2f", r.Transactions, r.Retries, r.Duration, r.TPS())
+}
+
+// InitPgbench creates and populates the pgbench tables, like `pgbench -i`.
+func InitPgbench(ctx context.Context, conn *pgx.Conn, opts PgbenchOptions) error {
+	opts.setDefaults()
+	stmts := []string{
+		"DROP TABLE IF EXISTS pgbench_history",
+		"DROP TABLE IF EXISTS pgbench_tellers",
+		"DROP TABLE IF EXISTS pgbench_accounts",
+		"DROP TABLE IF EXISTS pgbench_branches",
+		"CREATE TABLE pgbench_branches (bid INT NOT NULL PRIMARY KEY, bbalance INT, filler CHAR(88))",
+		"CREATE TABLE pgbench_tellers (tid INT NOT NULL PRIMARY KEY, bid INT, tbalance INT, filler CHAR(84))",
+		"CREATE TABLE pgbench_accounts (aid INT NOT NULL PRIMARY KEY, bid INT, abalance INT, filler CHAR(84))",
+		"CREATE TABLE pgbench_history (tid INT, bid INT, aid INT, delta INT, mtime TIMESTAMP, filler CHAR(22))",
+		fmt.Sprintf("INSERT INTO pgbench_branches (bid, bbalance) SELECT i, 0 FROM generate_series(1, %d) AS t(i)", opts.Scale),
+		fmt.Sprintf("INSERT INTO pgbench_tellers (tid, bid, tbalance) SELECT i, (i - 1) / 10 + 1, 0 FROM generate_series(1, %d) AS t(i)", 10*opts.Scale),
+		fmt.Sprintf("INSERT INTO pgbench_accounts (aid, bid, abalance, filler) SELECT i, (i - 1) / %d + 1, 0, '' FROM generate_series(1, %d) AS t(i)",
+			opts.AccountsPerBranch, opts.AccountsPerBranch*opts.Scale),
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// RunPgbench runs the TPC-B-like transactions of pgbench with concurrent clients connected to dsn.
+// Any error other than a serialization failure aborts the run.
+func RunPgbench(ctx context.Context, dsn string, opts PgbenchOptions) (*BenchResult, error) {
+	opts.setDefaults()
+	var (
+		mu     sync.Mutex
+		result BenchResult
+		wg     sync.WaitGroup
+		errs   = make([]error, opts.Clients)
+	)
+	start := time.Now()
+	for i := range opts.Clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			committed, retries, err := runPgbenchClient(ctx, dsn, opts, uint64(i))
+			mu.Lock()
+			result.Transactions += committed
+			result.Retries += retries
+			mu.Unlock()
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	result.Duration = time.Since(start)
+	return &result, errors.Join(errs...)
+}
+
+func runPgbenchClient(ctx context.Context, dsn string, opts PgbenchOptions, seed uint64) (committed, retries int, err error) {
+	mode, err := opts.queryExecMode()
+	if err != nil {
+		return 0, 0, err
+	}
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return 0, 0, err
+	}
+	config.DefaultQueryExecMode = mode
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { conn.Close(ctx) }()
+
+	rng := rand.New(rand.NewPCG(seed, uint64(time.Now().UnixNano())))
+	for range opts.Transactions {
+		aid := rng.IntN(opts.AccountsPerBranch*opts.Scale) + 1
+		bid := rng.IntN(opts.Scale) + 1
+		tid := rng.IntN(10*opts.Scale) + 1
+		delta := rng.IntN(10001) - 5000
+
+		for attempt := 0; ; attempt++ {
+			err = pgbenchTransaction(ctx, conn, aid, bid, tid, delta)
+			if err == nil {
+				committed++
+				break
+			}
+			if !IsSerializationFailure(err) || attempt >= opts.MaxRetries {
+				return committed, retries, err
+			}
+			retries++
+			time.Sleep(time.Duration(rng.IntN(1000)) * time.Microsecond)
+			// pgx closes the connection if the rollback of the failed transaction fails.
+			if conn.IsClosed() {
+				if conn, err = pgx.ConnectConfig(ctx, config); err != nil {
+					return committed, retries, err
+				}
+			}
+		}
+	}
+	return committed, retries, nil
+}
+
+// The parameters are cast explicitly because their types cannot be inferred from the statements yet,
+// and the simple protocol sends them as string literals.
+func pgbenchTransaction(ctx context.Context, conn *pgx.Conn, aid, bid, tid, delta int) error {
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "UPDATE pgbench_accounts SET abalance = abalance + $1::INT WHERE aid = $2::INT", delta, aid); err != nil {
+			return err
+		}
+		var balance int64
+		if err := tx.QueryRow(ctx, "SELECT abalance FROM pgbench_accounts WHERE aid = $1::INT", aid).Scan(&balance); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "UPDATE pgbench_tellers SET tbalance = tbalance + $1::INT WHERE tid = $2::INT", delta, tid); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "UPDATE pgbench_branches SET bbalance = bbalance + $1::INT WHERE bid = $2::INT", delta, bid); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO pgbench_history (tid, bid, aid, delta, mtime) VALUES ($1::INT, $2::INT, $3::INT, $4::INT, CURRENT_TIMESTAMP)", tid, bid, aid, delta)
+		return err
+	})
+}
+
+// VerifyPgbench checks the consistency of the pgbench tables after a run:
+// every committed transaction is recorded in the history exactly once,
+// and the balances of the accounts, tellers, and branches add up to the sum of the deltas.
+func VerifyPgbench(ctx context.Context, conn *pgx.Conn, result *BenchResult) error {
+	var history int64
+	if err := conn.QueryRow(ctx, "SELECT count(*) FROM pgbench_history").Scan(&history); err != nil {
+		return err
+	}
+	if history != int64(result.Transactions) {
+		return fmt.Errorf("pgbench_history has %d rows, but %d transactions were committed", history, result.Transactions)
+	}
+
+	sums := make([]int64, 4)
+	for i, query := range []string{
+		"SELECT COALESCE(sum(delta), 0)::BIGINT FROM pgbench_history",
+		"SELECT COALESCE(sum(abalance), 0)::BIGINT FROM pgbench_accounts",
+		"SELECT COALESCE(sum(tbalance), 0)::BIGINT FROM pgbench_tellers",
+		"SELECT COALESCE(sum(bbalance), 0)::BIGINT FROM pgbench_branches",
+	} {
+		if err := conn.QueryRow(ctx, query).Scan(&sums[i]); err != nil {
+			return fmt.Errorf("%s: %w", query, err)
+		}
+	}
+	if sums[1] != sums[0] || sums[2] != sums[0] || sums[3] != sums[0] {
+		return fmt.Errorf("inconsistent balances: history %d, accounts %d, tellers %d, branches %d", sums[0], sums[1], sums[2], sums[3])
+	}
+	return nil
+}
+
+// IsSerializationFailure reports whether the error is caused by a concurrent transaction,
+// in which case the transaction can be retried.
+func IsSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01") {
+		return true
+	}
+	// DuckDB reports write-write conflicts as transaction errors, e.g., "Conflict on tuple deletion!"
+	return strings.Contains(strings.ToLower(err.Error()), "conflict")
+}
@@ -0,0 +1,31 @@
+package pgtest
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgbench(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	opts := PgbenchOptions{
+		Scale:             2,
+		AccountsPerBranch: 1000,
+		Clients:           4,
+		Transactions:      20,
+		MaxRetries:        100,
+	}
+	require.NoError(t, InitPgbench(ctx, conn, opts))
+
+	result, err := RunPgbench(ctx, conn.Config().ConnString(), opts)
+	require.NoError(t, err)
+	t.Log(result)
+	require.Equal(t, opts.Clients*opts.Transactions, result.Transactions)
+
+	require.NoError(t, VerifyPgbench(ctx, conn, result))
+}
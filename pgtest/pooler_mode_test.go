@@ -0,0 +1,76 @@
+package pgtest
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/pgserver"
+	"github.com/apecloud/myduckserver/server"
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolerMode(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort(), func(cfg *server.Config) {
+		cfg.Postgres.PoolerMode = true
+	})
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+	defer pgserver.WithPoolerMode(false)(nil)
+
+	t.Run("pg_settings without temporary views", func(t *testing.T) {
+		_, err := conn.Exec(ctx, "SET application_name = 'pooled'")
+		require.NoError(t, err)
+		for _, query := range []string{
+			"SELECT setting FROM pg_settings WHERE name = 'application_name'",
+			"SELECT s.setting FROM pg_catalog.pg_settings AS s WHERE s.name = 'application_name'",
+			"SELECT s.setting FROM pg_settings s JOIN (SELECT 'application_name' AS name) t ON s.name = t.name",
+		} {
+			var setting string
+			require.NoError(t, conn.QueryRow(ctx, query, pgx.QueryExecModeSimpleProtocol).Scan(&setting), query)
+			require.Equal(t, "pooled", setting, query)
+		}
+		var n int
+		require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM duckdb_views() WHERE temporary AND NOT internal").Scan(&n))
+		require.Zero(t, n)
+	})
+
+	t.Run("ParameterStatus on changes", func(t *testing.T) {
+		c, err := pgx.Connect(ctx, conn.Config().ConnString())
+		require.NoError(t, err)
+		hijacked, err := c.PgConn().Hijack()
+		require.NoError(t, err)
+		defer hijacked.Conn.Close()
+		frontend := hijacked.Frontend
+
+		// query runs the query and returns the reported values of application_name.
+		query := func(sql string) (reported []string) {
+			frontend.Send(&pgproto3.Query{String: sql})
+			require.NoError(t, frontend.Flush())
+			for {
+				msg, err := frontend.Receive()
+				require.NoError(t, err)
+				switch msg := msg.(type) {
+				case *pgproto3.ErrorResponse:
+					t.Fatalf("%s: %s", sql, msg.Message)
+				case *pgproto3.ParameterStatus:
+					if msg.Name == "application_name" {
+						reported = append(reported, msg.Value)
+					}
+				case *pgproto3.ReadyForQuery:
+					return reported
+				}
+			}
+		}
+
+		require.Equal(t, []string{"app"}, query("SET application_name = 'app'"))
+		require.Empty(t, query("SELECT 1"))
+		require.Empty(t, query("BEGIN"))
+		require.Equal(t, []string{"local"}, query("SET LOCAL application_name = 'local'"))
+		require.Equal(t, []string{"app"}, query("COMMIT"))
+		require.Equal(t, []string{"func"}, query("SELECT set_config('application_name', 'func', false)"))
+		require.Empty(t, query("SELECT 1"))
+	})
+}
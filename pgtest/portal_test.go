@@ -0,0 +1,91 @@
+package pgtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreparedStatementAndPortalLifetime(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	c, err := pgx.Connect(ctx, conn.Config().ConnString())
+	require.NoError(t, err)
+	hijacked, err := c.PgConn().Hijack()
+	require.NoError(t, err)
+	defer hijacked.Conn.Close()
+	frontend := hijacked.Frontend
+
+	// roundTrip sends the messages followed by a Sync and returns the SQLSTATE codes of the errors
+	// and the number of executed commands before the ReadyForQuery message.
+	roundTrip := func(t *testing.T, msgs ...pgproto3.FrontendMessage) (codes []string, completed int) {
+		for _, msg := range msgs {
+			frontend.Send(msg)
+		}
+		if _, ok := msgs[len(msgs)-1].(*pgproto3.Query); !ok {
+			frontend.Send(&pgproto3.Sync{})
+		}
+		require.NoError(t, frontend.Flush())
+		for {
+			msg, err := frontend.Receive()
+			require.NoError(t, err)
+			switch msg := msg.(type) {
+			case *pgproto3.ErrorResponse:
+				codes = append(codes, msg.Code)
+			case *pgproto3.CommandComplete:
+				completed++
+			case *pgproto3.ReadyForQuery:
+				return codes, completed
+			}
+		}
+	}
+	parse := func(name string) *pgproto3.Parse {
+		return &pgproto3.Parse{Name: name, Query: "SELECT 1"}
+	}
+	bind := func(portal, stmt string) *pgproto3.Bind {
+		return &pgproto3.Bind{DestinationPortal: portal, PreparedStatement: stmt}
+	}
+	execute := func(portal string) *pgproto3.Execute {
+		return &pgproto3.Execute{Portal: portal}
+	}
+
+	tests := []struct {
+		name      string
+		msgs      []pgproto3.FrontendMessage
+		codes     []string
+		completed int
+	}{
+		{name: "Parse a named statement", msgs: []pgproto3.FrontendMessage{parse("s1")}},
+		{name: "Redefine the named statement", msgs: []pgproto3.FrontendMessage{parse("s1")}, codes: []string{"42P05"}},
+		{name: "Redefine the unnamed statement", msgs: []pgproto3.FrontendMessage{parse(""), parse(""), bind("", ""), execute("")}, completed: 1},
+		{name: "Bind an unknown statement", msgs: []pgproto3.FrontendMessage{bind("", "nope")}, codes: []string{"26000"}},
+		{name: "Named portal outside of a transaction", msgs: []pgproto3.FrontendMessage{bind("p1", "s1"), execute("p1")}, completed: 1},
+		{name: "Named portal is destroyed at the end of the implicit transaction", msgs: []pgproto3.FrontendMessage{execute("p1")}, codes: []string{"34000"}},
+		{name: "Begin", msgs: []pgproto3.FrontendMessage{&pgproto3.Query{String: "BEGIN"}}, completed: 1},
+		{name: "Bind a named portal in the transaction", msgs: []pgproto3.FrontendMessage{bind("p2", "s1"), bind("", "s1")}},
+		{name: "Named portal survives Sync", msgs: []pgproto3.FrontendMessage{execute("p2")}, completed: 1},
+		{name: "Rebind the unnamed portal", msgs: []pgproto3.FrontendMessage{bind("", "s1"), execute("")}, completed: 1},
+		{name: "Rebind the named portal", msgs: []pgproto3.FrontendMessage{bind("p2", "s1")}, codes: []string{"42P03"}},
+		{name: "The failed transaction rejects statements", msgs: []pgproto3.FrontendMessage{bind("", "s1"), execute("")}, codes: []string{"25P02"}},
+		{name: "Commit", msgs: []pgproto3.FrontendMessage{&pgproto3.Query{String: "COMMIT"}}, completed: 1},
+		{name: "Named portal is destroyed at commit", msgs: []pgproto3.FrontendMessage{execute("p2")}, codes: []string{"34000"}},
+		{name: "Closing a statement closes its portals", msgs: []pgproto3.FrontendMessage{
+			bind("p3", "s1"), &pgproto3.Close{ObjectType: 'S', Name: "s1"}, execute("p3"),
+		}, codes: []string{"34000"}},
+		{name: "Named statement can be redefined after Close", msgs: []pgproto3.FrontendMessage{parse("s1"), bind("", "s1"), execute("")}, completed: 1},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d %s", i, tt.name), func(t *testing.T) {
+			codes, completed := roundTrip(t, tt.msgs...)
+			require.Equal(t, tt.codes, codes)
+			require.Equal(t, tt.completed, completed)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package pgtest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPsqlMetaCommands replays the catalog queries sent by psql 13 to 16 for the meta-commands
+// and checks the names of the listed objects.
+func TestPsqlMetaCommands(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, "CREATE TABLE psql_corpus (id INT)")
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, "CREATE VIEW psql_corpus_view AS SELECT * FROM psql_corpus")
+	require.NoError(t, err)
+
+	// The names in the second column of the output, or the first if there is only one, that start with psql_corpus.
+	tests := map[string]struct {
+		names   []string
+		wantErr bool
+	}{
+		"l":          {},
+		"l_pattern":  {},
+		"d":          {names: []string{"psql_corpus", "psql_corpus_view"}},
+		"dt":         {names: []string{"psql_corpus"}},
+		"dv":         {names: []string{"psql_corpus_view"}},
+		"dt_pattern": {names: []string{"psql_corpus"}},
+		"dt_schema":  {names: []string{"psql_corpus"}},
+		"d_name":     {wantErr: true},
+		"dn":         {},
+		"df":         {},
+		"du":         {},
+	}
+
+	dir := filepath.Join("..", "pgserver", "testdata", "psql")
+	versions, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, version := range versions {
+		for name, tt := range tests {
+			t.Run(version.Name()+"/"+name, func(t *testing.T) {
+				query, err := os.ReadFile(filepath.Join(dir, version.Name(), name+".sql"))
+				require.NoError(t, err)
+				// psql uses the simple query protocol.
+				results, err := conn.PgConn().Exec(ctx, string(query)).ReadAll()
+				if tt.wantErr {
+					require.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+				require.Len(t, results, 1)
+
+				var names []string
+				for _, row := range results[0].Rows {
+					name := string(row[0])
+					if len(row) > 1 {
+						name = string(row[1])
+					}
+					if strings.HasPrefix(name, "psql_corpus") {
+						names = append(names, name)
+					}
+				}
+				require.Equal(t, tt.names, names)
+			})
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package pgtest
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicationDiagnosticFunctions(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	// No subscription is running, so there is nothing to flush or report.
+	var flushed uint64
+	require.NoError(t, conn.QueryRow(ctx, "SELECT myduck_flush_deltas()").Scan(&flushed))
+	require.Zero(t, flushed)
+
+	var count int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM myduck_replication_state() WHERE slot_name IS NOT NULL").Scan(&count))
+	require.Zero(t, count)
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM pg_catalog.myduck_replication_relations() r WHERE r.relation_id > 0").Scan(&count))
+	require.Zero(t, count)
+}
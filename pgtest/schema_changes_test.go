@@ -0,0 +1,102 @@
+package pgtest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaChangeNotifications(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	listener, err := pgx.Connect(ctx, conn.Config().ConnString())
+	require.NoError(t, err)
+	defer listener.Close(ctx)
+
+	tag, err := listener.Exec(ctx, "LISTEN myduck_ddl", pgx.QueryExecModeSimpleProtocol)
+	require.NoError(t, err)
+	require.Equal(t, "LISTEN", tag.String())
+
+	// The notifications carry the backend PID of the session that made the changes.
+	var pid uint32
+	require.NoError(t, conn.QueryRow(ctx, "SELECT pg_backend_pid()", pgx.QueryExecModeSimpleProtocol).Scan(&pid))
+
+	// next waits for the next notification, which is delivered while the listener is idle.
+	next := func() catalog.SchemaChange {
+		waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		n, err := listener.WaitForNotification(waitCtx)
+		require.NoError(t, err)
+		require.Equal(t, catalog.SchemaChangeChannel, n.Channel)
+		require.Equal(t, pid, n.PID)
+		var change catalog.SchemaChange
+		require.NoError(t, json.Unmarshal([]byte(n.Payload), &change))
+		return change
+	}
+	none := func() {
+		waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		_, err := listener.WaitForNotification(waitCtx)
+		require.Error(t, err)
+	}
+
+	_, err = conn.Exec(ctx, "CREATE TABLE ddl_t (id INT)")
+	require.NoError(t, err)
+	change := next()
+	require.Equal(t, "CREATE TABLE", change.Command)
+	require.Equal(t, catalog.SchemaObjectTable, change.ObjectType)
+	require.Equal(t, "ddl_t", change.Name)
+	require.Equal(t, catalog.SchemaChangeLocal, change.Origin)
+
+	_, err = conn.Exec(ctx, "ALTER TABLE ddl_t ADD COLUMN v INT")
+	require.NoError(t, err)
+	require.Equal(t, "ALTER TABLE", next().Command)
+
+	// The changes of a transaction block are delivered once it is committed.
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, "CREATE VIEW ddl_v AS SELECT * FROM ddl_t")
+	require.NoError(t, err)
+	none()
+	require.NoError(t, tx.Commit(ctx))
+	change = next()
+	require.Equal(t, "CREATE VIEW", change.Command)
+	require.Equal(t, "ddl_v", change.Name)
+
+	// The changes of a rolled back transaction block are dropped.
+	tx, err = conn.Begin(ctx)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, "DROP VIEW ddl_v")
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback(ctx))
+	none()
+
+	// The prepared statements of the listener survive the changes of their tables.
+	_, err = listener.Prepare(ctx, "ddl_select", "SELECT count(*) FROM ddl_t")
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, "DROP VIEW ddl_v")
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, "ALTER TABLE ddl_t ADD COLUMN w INT")
+	require.NoError(t, err)
+	require.Equal(t, "DROP VIEW", next().Command)
+	require.Equal(t, "ALTER TABLE", next().Command)
+	var n int
+	require.NoError(t, listener.QueryRow(ctx, "ddl_select").Scan(&n))
+	require.Equal(t, 0, n)
+
+	tag, err = listener.Exec(ctx, "UNLISTEN *", pgx.QueryExecModeSimpleProtocol)
+	require.NoError(t, err)
+	require.Equal(t, "UNLISTEN", tag.String())
+	_, err = conn.Exec(ctx, "DROP TABLE ddl_t")
+	require.NoError(t, err)
+	none()
+}
@@ -2,80 +2,38 @@ package pgtest
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"sync/atomic"
 	"testing"
 
-	"github.com/apecloud/myduckserver/backend"
-	"github.com/apecloud/myduckserver/catalog"
 	"github.com/apecloud/myduckserver/pgserver"
-	pgConfig "github.com/apecloud/myduckserver/pgserver/pgconfig"
-	sqle "github.com/dolthub/go-mysql-server"
-	"github.com/dolthub/go-mysql-server/memory"
-	"github.com/dolthub/go-mysql-server/server"
-	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/apecloud/myduckserver/server"
 	"github.com/jackc/pgx/v5"
 )
 
-func CreateTestServer(t *testing.T, port int) (ctx context.Context, pgServer *pgserver.Server, conn *pgx.Conn, close func() error, err error) {
-	provider := catalog.NewInMemoryDBProvider()
-
-	// Postgres tables are created in the `public` schema by default.
-	// Create the `public` schema if it doesn't exist.
-	_, err = provider.Pool().ExecContext(context.Background(), "CREATE SCHEMA IF NOT EXISTS public")
+// CreateTestServer starts a server backed by an in-memory DuckDB database that serves the Postgres protocol
+// on the given port, and returns a connection to it. The options modify the configuration of the server.
+func CreateTestServer(t *testing.T, port int, opts ...server.Option) (ctx context.Context, pgServer *pgserver.Server, conn *pgx.Conn, close func() error, err error) {
+	cfg := server.DefaultConfig()
+	cfg.Postgres.SlotCheckInterval = 0
+	srv, err := server.Run(cfg, append([]server.Option{
+		server.WithAddress("127.0.0.1"),
+		server.WithPorts(0, port),
+		server.WithDataDir(t.TempDir()),
+		server.WithDefaultDB("memory"),
+	}, opts...)...)
 	if err != nil {
 		return nil, nil, nil, nil, err
 	}
-
-	engine := sqle.NewDefault(provider)
-
-	builder := backend.NewDuckBuilder(engine.Analyzer.ExecBuilder, provider)
-	engine.Analyzer.ExecBuilder = builder
-
-	config := server.Config{
-		Address: fmt.Sprintf("127.0.0.1:%d", port-1), // Unused
-	}
-
-	sb := backend.NewSessionBuilder(provider)
-	tracer := sql.NoopTracer
-
-	sm := server.NewSessionManager(
-		sb, tracer,
-		engine.Analyzer.Catalog.Database,
-		engine.MemoryManager,
-		engine.ProcessList,
-		config.Address,
-	)
-
-	var connID atomic.Uint32
-
-	pgServer, err = pgserver.NewServer(
-		provider,
-		"127.0.0.1", port,
-		"",
-		func() *sql.Context {
-			session := backend.NewSession(memory.NewSession(sql.NewBaseSession(), provider), provider)
-			return sql.NewContext(context.Background(), sql.WithSession(session))
-		},
-		pgserver.WithEngine(engine),
-		pgserver.WithSessionManager(sm),
-		pgserver.WithConnID(&connID),
-	)
-	if err != nil {
-		panic(err)
-	}
-	pgConfig.Init()
-	go pgServer.Start()
-
 	ctx = context.Background()
-
 	close = func() error {
-		pgServer.Listener.Close()
-		return errors.Join(
-			provider.Pool().Close(),
-			provider.Close(),
-		)
+		return srv.Shutdown(context.Background())
+	}
+
+	// Postgres tables are created in the `public` schema by default.
+	// Create the `public` schema if it doesn't exist.
+	if _, err = srv.Provider().Pool().ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS public"); err != nil {
+		close()
+		return nil, nil, nil, nil, err
 	}
 
 	// Since we use the in-memory DuckDB storage, we need to connect to the `memory` database
@@ -85,5 +43,5 @@ func CreateTestServer(t *testing.T, port int) (ctx context.Context, pgServer *pg
 		close()
 		return nil, nil, nil, nil, err
 	}
-	return
+	return ctx, srv.PostgresServer(), conn, close, nil
 }
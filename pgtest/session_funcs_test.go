@@ -0,0 +1,59 @@
+package pgtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionFunctions(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	for _, mode := range []pgx.QueryExecMode{pgx.QueryExecModeSimpleProtocol, pgx.QueryExecModeCacheStatement} {
+		t.Run(mode.String(), func(t *testing.T) {
+			var currentUser, sessionUser, version string
+			var pid int32
+			require.NoError(t, conn.QueryRow(ctx,
+				"SELECT current_user, session_user, pg_catalog.pg_backend_pid(), version()", mode,
+			).Scan(&currentUser, &sessionUser, &pid, &version))
+			require.Equal(t, "postgres", currentUser)
+			require.Equal(t, "postgres", sessionUser)
+			require.Positive(t, pid)
+			require.True(t, strings.HasPrefix(version, "PostgreSQL "), version)
+
+			var schemas []string
+			require.NoError(t, conn.QueryRow(ctx, "SELECT current_schemas(true)", mode).Scan(&schemas))
+			require.Equal(t, []string{"pg_catalog", "public"}, schemas)
+			require.NoError(t, conn.QueryRow(ctx, "SELECT pg_catalog.current_schemas(false)", mode).Scan(&schemas))
+			require.Equal(t, []string{"public"}, schemas)
+
+			var txid int64
+			require.NoError(t, conn.QueryRow(ctx, "SELECT pg_catalog.txid_current()", mode).Scan(&txid))
+		})
+	}
+
+	var setting string
+	require.NoError(t, conn.QueryRow(ctx, "SELECT pg_catalog.set_config('application_name', 'set_config_app', false)").Scan(&setting))
+	require.Equal(t, "set_config_app", setting)
+	require.NoError(t, conn.QueryRow(ctx, "SHOW application_name", pgx.QueryExecModeSimpleProtocol).Scan(&setting))
+	require.Equal(t, "set_config_app", setting)
+
+	// set_config(..., true) is reverted at the end of the transaction block, like SET LOCAL.
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.QueryRow(ctx, "SELECT set_config('application_name', 'local_app', true)").Scan(&setting))
+	require.NoError(t, tx.QueryRow(ctx, "SHOW application_name", pgx.QueryExecModeSimpleProtocol).Scan(&setting))
+	require.Equal(t, "local_app", setting)
+	require.NoError(t, tx.Commit(ctx))
+	require.NoError(t, conn.QueryRow(ctx, "SHOW application_name", pgx.QueryExecModeSimpleProtocol).Scan(&setting))
+	require.Equal(t, "set_config_app", setting)
+
+	_, err = conn.Exec(ctx, "SELECT set_config('no_such_parameter', 'x', false)")
+	require.ErrorContains(t, err, "unrecognized configuration parameter")
+}
@@ -0,0 +1,139 @@
+package pgtest
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgSettings(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	querySetting := func(name string) (setting, source, scope string) {
+		require.NoError(t, conn.QueryRow(ctx,
+			"SELECT setting, source, scope FROM pg_catalog.pg_settings WHERE name = $1", name,
+		).Scan(&setting, &source, &scope))
+		return
+	}
+
+	// The Postgres parameters, the MySQL system variables, and the DuckDB settings are merged.
+	var category string
+	for name, expected := range map[string]string{
+		"application_name":    "Reporting and Logging / What to Log",
+		"max_allowed_packet":  "MySQL System Variables",
+		"memory_limit":        "DuckDB Settings",
+		"enable_object_cache": "DuckDB Settings",
+	} {
+		require.NoError(t, conn.QueryRow(ctx, "SELECT category FROM pg_settings s WHERE s.name = $1", name).Scan(&category), name)
+		require.Equal(t, expected, category, name)
+	}
+
+	_, err = conn.Exec(ctx, "SET application_name = 'settings_test'")
+	require.NoError(t, err)
+	setting, source, scope := querySetting("application_name")
+	require.Equal(t, "settings_test", setting)
+	require.Equal(t, "session", source)
+	require.Equal(t, "SESSION", scope)
+
+	// SET LOCAL is reverted when the transaction block ends, with either COMMIT or ROLLBACK.
+	for _, end := range []string{"COMMIT", "ROLLBACK"} {
+		t.Run(end, func(t *testing.T) {
+			_, err := conn.Exec(ctx, "BEGIN")
+			require.NoError(t, err)
+			_, err = conn.Exec(ctx, "SET LOCAL application_name = 'local_app'")
+			require.NoError(t, err)
+			_, err = conn.Exec(ctx, "SET LOCAL application_name = 'local_app2'")
+			require.NoError(t, err)
+
+			var v string
+			require.NoError(t, conn.QueryRow(ctx, "SHOW application_name", pgx.QueryExecModeSimpleProtocol).Scan(&v))
+			require.Equal(t, "local_app2", v)
+			setting, _, scope := querySetting("application_name")
+			require.Equal(t, "local_app2", setting)
+			require.Equal(t, "LOCAL", scope)
+
+			_, err = conn.Exec(ctx, end)
+			require.NoError(t, err)
+			require.NoError(t, conn.QueryRow(ctx, "SHOW application_name", pgx.QueryExecModeSimpleProtocol).Scan(&v))
+			require.Equal(t, "settings_test", v)
+			_, _, scope = querySetting("application_name")
+			require.Equal(t, "SESSION", scope)
+		})
+	}
+
+	// A session-level SET after SET LOCAL in the same transaction block is kept.
+	for _, stmt := range []string{
+		"BEGIN",
+		"SET LOCAL application_name = 'local_app'",
+		"SET application_name = 'session_app'",
+		"COMMIT",
+	} {
+		_, err := conn.Exec(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+	setting, _, _ = querySetting("application_name")
+	require.Equal(t, "session_app", setting)
+
+	// SET LOCAL outside a transaction block has no effect.
+	_, err = conn.Exec(ctx, "SET LOCAL application_name = 'ignored'")
+	require.NoError(t, err)
+	setting, _, _ = querySetting("application_name")
+	require.Equal(t, "session_app", setting)
+}
+
+func TestSetLocalServerAndDuckDBSettings(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	show := func(name string) string {
+		var v string
+		require.NoError(t, conn.QueryRow(ctx, "SHOW "+name, pgx.QueryExecModeSimpleProtocol).Scan(&v))
+		return v
+	}
+	_, err = conn.Exec(ctx, "SET memory_limit = '2GB'")
+	require.NoError(t, err)
+	memoryLimit := show("memory_limit")
+
+	// SET LOCAL of the parameters of the server and the settings of DuckDB is reverted as well.
+	for _, end := range []string{"COMMIT", "ROLLBACK"} {
+		t.Run(end, func(t *testing.T) {
+			for _, stmt := range []string{
+				"BEGIN",
+				"SET LOCAL myduck.max_result_size = 1024",
+				"SET LOCAL myduck.copy_appender = on",
+				"SET LOCAL memory_limit = '1GB'",
+			} {
+				_, err := conn.Exec(ctx, stmt)
+				require.NoError(t, err, stmt)
+			}
+			require.Equal(t, "1024", show("myduck.max_result_size"))
+			require.Equal(t, "on", show("myduck.copy_appender"))
+			require.NotEqual(t, memoryLimit, show("memory_limit"))
+
+			_, err := conn.Exec(ctx, end)
+			require.NoError(t, err)
+			require.NotEqual(t, "1024", show("myduck.max_result_size"))
+			require.Equal(t, "off", show("myduck.copy_appender"))
+			require.Equal(t, memoryLimit, show("memory_limit"))
+		})
+	}
+
+	// A session-level SET after SET LOCAL in the same transaction block is kept.
+	for _, stmt := range []string{
+		"BEGIN",
+		"SET LOCAL myduck.copy_appender = on",
+		"SET myduck.copy_appender = on",
+		"COMMIT",
+	} {
+		_, err := conn.Exec(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+	require.Equal(t, "on", show("myduck.copy_appender"))
+}
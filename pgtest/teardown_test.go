@@ -0,0 +1,83 @@
+package pgtest
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionTeardown(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, "CREATE TABLE teardown (id INT PRIMARY KEY, v INT)")
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, "INSERT INTO teardown VALUES (1, 0)")
+	require.NoError(t, err)
+	dsn := conn.Config().ConnString()
+
+	// drop closes the network connection without sending a Terminate message.
+	drop := func(c *pgx.Conn) {
+		require.NoError(t, c.PgConn().Conn().Close())
+	}
+	count := func() int64 {
+		var n int64
+		require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM teardown").Scan(&n))
+		return n
+	}
+
+	t.Run("Open transaction", func(t *testing.T) {
+		c, err := pgx.Connect(ctx, dsn)
+		require.NoError(t, err)
+		_, err = c.Exec(ctx, "BEGIN")
+		require.NoError(t, err)
+		_, err = c.Exec(ctx, "UPDATE teardown SET v = 1 WHERE id = 1")
+		require.NoError(t, err)
+		_, err = c.Prepare(ctx, "stmt", "SELECT v FROM teardown WHERE id = $1::INT")
+		require.NoError(t, err)
+		drop(c)
+
+		// The transaction is rolled back, so the update does not conflict with it.
+		require.Eventually(t, func() bool {
+			_, err := conn.Exec(ctx, "UPDATE teardown SET v = v + 10 WHERE id = 1")
+			return err == nil
+		}, 5*time.Second, 50*time.Millisecond)
+		var v int64
+		require.NoError(t, conn.QueryRow(ctx, "SELECT v FROM teardown WHERE id = 1").Scan(&v))
+		require.EqualValues(t, 10, v)
+	})
+
+	t.Run("COPY in progress", func(t *testing.T) {
+		c, err := pgx.Connect(ctx, dsn)
+		require.NoError(t, err)
+
+		r, w := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			_, err := c.PgConn().CopyFrom(context.Background(), r, "COPY teardown FROM STDIN")
+			done <- err
+		}()
+		_, err = w.Write([]byte("2\t2\n3\t3\n"))
+		require.NoError(t, err)
+		// Give the client a moment to send the data before hanging up.
+		time.Sleep(100 * time.Millisecond)
+		drop(c)
+		w.Close()
+		require.Error(t, <-done)
+
+		// The loaded rows are discarded, and the table can be loaded again.
+		require.Eventually(t, func() bool {
+			tag, err := conn.PgConn().CopyFrom(ctx, strings.NewReader("2\t2\n"), "COPY teardown FROM STDIN")
+			return err == nil && tag.RowsAffected() == 1
+		}, 5*time.Second, 50*time.Millisecond)
+		require.EqualValues(t, 2, count())
+	})
+}
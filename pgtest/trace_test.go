@@ -0,0 +1,68 @@
+package pgtest
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	hook := test.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	traces := func() map[string]int {
+		counts := make(map[string]int)
+		for _, entry := range hook.AllEntries() {
+			if kind, ok := entry.Data["trace"].(string); ok {
+				counts[kind]++
+				require.NotNil(t, entry.Data["connectionID"])
+				if kind == "executed" {
+					counts[kind+":"+entry.Data["path"].(string)]++
+				}
+			}
+		}
+		hook.Reset()
+		return counts
+	}
+
+	var n int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM range(10)").Scan(&n))
+	require.Empty(t, traces())
+
+	_, err = conn.Exec(ctx, "SET myduck.trace = on")
+	require.NoError(t, err)
+	var setting string
+	require.NoError(t, conn.QueryRow(ctx, "SHOW myduck.trace", pgx.QueryExecModeSimpleProtocol).Scan(&setting))
+	require.Equal(t, "on", setting)
+	hook.Reset()
+
+	// The simple protocol.
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM range(10)", pgx.QueryExecModeSimpleProtocol).Scan(&n))
+	counts := traces()
+	require.Equal(t, 1, counts["received"])
+	require.Equal(t, 1, counts["handled"])
+	require.Equal(t, 1, counts["converted"])
+	require.Equal(t, 1, counts["executed:engine"])
+	require.GreaterOrEqual(t, counts["sent"], 4) // RowDescription, DataRow, CommandComplete, ReadyForQuery
+
+	// The extended protocol.
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM range($1::INTEGER)", 5).Scan(&n))
+	require.Equal(t, 5, n)
+	counts = traces()
+	require.Equal(t, 1, counts["executed:duckdb"])
+
+	_, err = conn.Exec(ctx, "SET myduck.trace = off")
+	require.NoError(t, err)
+	hook.Reset()
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM range(10)").Scan(&n))
+	require.Empty(t, traces())
+}
@@ -0,0 +1,79 @@
+package pgtest
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableTTL(t *testing.T) {
+	ctx, pgServer, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	for _, stmt := range []string{
+		"CREATE TABLE public.ttl_t (id INT PRIMARY KEY, created_at TIMESTAMP, v VARCHAR)",
+		"INSERT INTO public.ttl_t SELECT i, now()::TIMESTAMP - INTERVAL (i) DAY + INTERVAL 1 HOUR, 'x' FROM range(10) AS r(i)",
+	} {
+		_, err := conn.Exec(ctx, stmt)
+		require.NoError(t, err, stmt)
+	}
+
+	requireSQLState := func(t *testing.T, code string, err error) {
+		var pgErr *pgconn.PgError
+		require.ErrorAs(t, err, &pgErr)
+		require.Equal(t, code, pgErr.Code)
+	}
+	_, err = conn.Exec(ctx, "ALTER TABLE ttl_t SET (ttl = 'forever')")
+	requireSQLState(t, "22023", err)
+	_, err = conn.Exec(ctx, "ALTER TABLE ttl_t SET (ttl_column = 'nope')")
+	requireSQLState(t, "42703", err)
+	_, err = conn.Exec(ctx, "ALTER TABLE ttl_t SET (ttl_column = 'v')")
+	requireSQLState(t, "42804", err)
+	_, err = conn.Exec(ctx, "ALTER TABLE ttl_missing SET (ttl = '1 day')")
+	requireSQLState(t, "42P01", err)
+	_, err = conn.Exec(ctx, "ALTER TABLE IF EXISTS ttl_missing SET (ttl = '1 day')")
+	require.NoError(t, err)
+
+	_, err = conn.Exec(ctx, "ALTER TABLE ttl_t SET (ttl = '5 days', ttl_column = 'created_at')")
+	require.NoError(t, err)
+
+	purger := backend.NewTTLPurger(pgServer.Provider)
+	count := func() (n int) {
+		require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM ttl_t").Scan(&n))
+		return
+	}
+
+	// Nothing is purged while the purges are paused.
+	require.NoError(t, sql.SystemVariables.SetGlobal(backend.TTLPausedVariable, int8(1)))
+	purged, err := purger.PurgeExpired(ctx)
+	require.NoError(t, err)
+	require.Zero(t, purged)
+	require.Equal(t, 10, count())
+
+	require.NoError(t, sql.SystemVariables.SetGlobal(backend.TTLPausedVariable, int8(0)))
+	require.NoError(t, sql.SystemVariables.SetGlobal(backend.TTLBatchSizeVariable, int64(3)))
+	defer sql.SystemVariables.SetGlobal(backend.TTLBatchSizeVariable, int64(10000))
+	purged, err = purger.PurgeExpired(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, purged)
+	require.Equal(t, 6, count())
+
+	var purgedRows int
+	require.NoError(t, conn.QueryRow(ctx,
+		"SELECT purged_rows FROM __sys__.ttl_tables WHERE schema_name = 'public' AND table_name = 'ttl_t' AND last_error IS NULL",
+	).Scan(&purgedRows))
+	require.Equal(t, 4, purgedRows)
+
+	// The policy is gone once it is reset.
+	_, err = conn.Exec(ctx, "ALTER TABLE ttl_t RESET (ttl, ttl_column)")
+	require.NoError(t, err)
+	var n int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM __sys__.ttl_tables").Scan(&n))
+	require.Zero(t, n)
+}
@@ -0,0 +1,94 @@
+package pgtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadyForQueryTxStatus(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	status := func() byte { return conn.PgConn().TxStatus() }
+	require.Equal(t, byte('I'), status())
+
+	_, err = conn.Exec(ctx, "BEGIN")
+	require.NoError(t, err)
+	require.Equal(t, byte('T'), status())
+	_, err = conn.Exec(ctx, "SELECT 1")
+	require.NoError(t, err)
+	require.Equal(t, byte('T'), status())
+
+	_, err = conn.Exec(ctx, "SELECT * FROM no_such_table")
+	require.Error(t, err)
+	require.Equal(t, byte('E'), status())
+
+	_, err = conn.Exec(ctx, "ROLLBACK")
+	require.NoError(t, err)
+	require.Equal(t, byte('I'), status())
+
+	_, err = conn.Exec(ctx, "BEGIN")
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, "COMMIT")
+	require.NoError(t, err)
+	require.Equal(t, byte('I'), status())
+}
+
+func TestFlushMessage(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	c, err := pgx.Connect(ctx, conn.Config().ConnString())
+	require.NoError(t, err)
+	hijacked, err := c.PgConn().Hijack()
+	require.NoError(t, err)
+	defer hijacked.Conn.Close()
+	frontend := hijacked.Frontend
+
+	// send sends the messages followed by a Flush, and returns the types of the responses
+	// until the one of the given type.
+	send := func(until pgproto3.BackendMessage, msgs ...pgproto3.FrontendMessage) (received []string) {
+		for _, msg := range msgs {
+			frontend.Send(msg)
+		}
+		frontend.Send(&pgproto3.Flush{})
+		require.NoError(t, frontend.Flush())
+		for {
+			msg, err := frontend.Receive()
+			require.NoError(t, err)
+			received = append(received, fmt.Sprintf("%T", msg))
+			if fmt.Sprintf("%T", msg) == fmt.Sprintf("%T", until) {
+				return received
+			}
+		}
+	}
+
+	// The responses are received without a Sync, and no ReadyForQuery is sent.
+	require.Equal(t, []string{"*pgproto3.ParseComplete", "*pgproto3.BindComplete", "*pgproto3.DataRow", "*pgproto3.CommandComplete"},
+		send(&pgproto3.CommandComplete{},
+			&pgproto3.Parse{Query: "SELECT 1"},
+			&pgproto3.Bind{},
+			&pgproto3.Execute{},
+		))
+
+	// An error is reported before the Sync, and the rest of the messages are discarded until the Sync.
+	require.Equal(t, []string{"*pgproto3.ErrorResponse"},
+		send(&pgproto3.ErrorResponse{},
+			&pgproto3.Bind{PreparedStatement: "nope"},
+			&pgproto3.Execute{},
+		))
+	frontend.Send(&pgproto3.Sync{})
+	require.NoError(t, frontend.Flush())
+	msg, err := frontend.Receive()
+	require.NoError(t, err)
+	require.Equal(t, &pgproto3.ReadyForQuery{TxStatus: 'I'}, msg)
+}
@@ -0,0 +1,39 @@
+package pgtest
+
+import (
+	"testing"
+
+	"github.com/apecloud/myduckserver/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkloadClass(t *testing.T) {
+	ctx, _, conn, close, err := CreateTestServer(t, testutil.FindFreePort())
+	require.NoError(t, err)
+	defer close()
+	defer conn.Close(ctx)
+
+	show := func() (class string) {
+		require.NoError(t, conn.QueryRow(ctx, "SHOW myduck.workload_class", pgx.QueryExecModeSimpleProtocol).Scan(&class))
+		return
+	}
+	require.Equal(t, "interactive", show())
+
+	_, err = conn.Exec(ctx, "SET myduck.workload_class = background")
+	require.NoError(t, err)
+	require.Equal(t, "background", show())
+
+	// The queries of a background session run in the background class.
+	var n int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM range(10)").Scan(&n))
+	require.Equal(t, 10, n)
+
+	_, err = conn.Exec(ctx, "SET myduck.workload_class = 'batch'")
+	require.ErrorContains(t, err, "invalid value")
+	require.Equal(t, "background", show())
+
+	_, err = conn.Exec(ctx, "SET myduck.workload_class = DEFAULT")
+	require.NoError(t, err)
+	require.Equal(t, "interactive", show())
+}
@@ -0,0 +1,248 @@
+package pgtypes
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/marcboeker/go-duckdb"
+)
+
+// parameterDecoder decodes a bind parameter in the text or binary format into a Go value
+// that can be bound to a DuckDB prepared statement.
+type parameterDecoder func(m *pgtype.Map, oid uint32, format int16, src []byte) (any, error)
+
+// parameterDecoders maps the OIDs of the parameter types to their decoders.
+// Types that DuckDB cannot bind natively are passed in their text representations,
+// which are cast to the parameter types by DuckDB without loss of precision.
+var parameterDecoders = map[uint32]parameterDecoder{
+	pgtype.BoolOID:        decodeAs[bool],
+	pgtype.Int2OID:        decodeAs[int16],
+	pgtype.Int4OID:        decodeAs[int32],
+	pgtype.Int8OID:        decodeAs[int64],
+	pgtype.OIDOID:         decodeAs[uint32],
+	pgtype.XIDOID:         decodeAs[uint32],
+	pgtype.CIDOID:         decodeAs[uint32],
+	pgtype.Float4OID:      decodeAs[float32],
+	pgtype.Float8OID:      decodeAs[float64],
+	pgtype.NumericOID:     decodeNumeric,
+	pgtype.ByteaOID:       decodeAs[[]byte],
+	pgtype.TextOID:        decodeAs[string],
+	pgtype.VarcharOID:     decodeAs[string],
+	pgtype.BPCharOID:      decodeAs[string],
+	pgtype.NameOID:        decodeAs[string],
+	pgtype.QCharOID:       decodeAs[string],
+	pgtype.JSONOID:        decodeAs[string],
+	pgtype.JSONBOID:       decodeAs[string],
+	pgtype.XMLOID:         decodeAs[string],
+	pgtype.UnknownOID:     decodeAs[string],
+	pgtype.DateOID:        decodeDate,
+	pgtype.TimeOID:        decodeTime,
+	pgtype.TimestampOID:   decodeTimestamp,
+	pgtype.TimestamptzOID: decodeTimestamptz,
+	pgtype.IntervalOID:    decodeInterval,
+	pgtype.UUIDOID:        decodeValuer[pgtype.UUID],
+	pgtype.InetOID:        decodeValuer[pgtype.Text],
+	pgtype.CIDROID:        decodeValuer[pgtype.Text],
+	pgtype.BitOID:         decodeValuer[pgtype.Bits],
+	pgtype.VarbitOID:      decodeValuer[pgtype.Bits],
+}
+
+// ParameterOID returns the OID of the parameter type reported by DuckDB for a prepared statement.
+// DuckDB reports only the type ID of a parameter, so the element type of a LIST is unknown,
+// and a text array is used instead; its elements are cast to the element type by DuckDB.
+// The nested types without an array counterpart are passed in their text representations.
+// The parameters whose types cannot be determined are reported as unknown.
+func ParameterOID(t duckdb.Type) uint32 {
+	switch t {
+	case duckdb.TYPE_LIST, duckdb.TYPE_ARRAY:
+		return pgtype.TextArrayOID
+	case duckdb.TYPE_STRUCT, duckdb.TYPE_MAP, duckdb.TYPE_UNION:
+		return pgtype.TextOID
+	}
+	if oid, ok := DuckdbTypeToPostgresOID[t]; ok {
+		return oid
+	}
+	return pgtype.UnknownOID
+}
+
+// DecodeParameter decodes a bind parameter of the extended query protocol according to its type OID.
+// NULL is decoded as nil. The parameters of unknown types are passed as strings in the text format.
+func DecodeParameter(m *pgtype.Map, oid uint32, format int16, src []byte) (any, error) {
+	if src == nil {
+		return nil, nil
+	}
+	if decode, ok := parameterDecoders[oid]; ok {
+		return decode(m, oid, format, src)
+	}
+	if typ, ok := m.TypeForOID(oid); ok {
+		if codec, ok := typ.Codec.(*pgtype.ArrayCodec); ok {
+			return decodeArray(m, oid, codec.ElementType, format, src)
+		}
+	}
+	if format == pgtype.TextFormatCode {
+		return string(src), nil
+	}
+	var text pgtype.Text
+	if err := m.Scan(oid, format, src, &text); err != nil {
+		return nil, fmt.Errorf("cannot decode binary parameter of type %d: %w", oid, err)
+	}
+	return text.String, nil
+}
+
+func decodeAs[T any](m *pgtype.Map, oid uint32, format int16, src []byte) (any, error) {
+	var v T
+	if err := m.Scan(oid, format, src, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeValuer decodes the parameter into its driver value, which is a string for the types used with it.
+func decodeValuer[T any, PT interface {
+	*T
+	driver.Valuer
+}](m *pgtype.Map, oid uint32, format int16, src []byte) (any, error) {
+	var v T
+	if err := m.Scan(oid, format, src, PT(&v)); err != nil {
+		return nil, err
+	}
+	return PT(&v).Value()
+}
+
+func decodeNumeric(m *pgtype.Map, oid uint32, format int16, src []byte) (any, error) {
+	var n pgtype.Numeric
+	if err := m.Scan(oid, format, src, &n); err != nil {
+		return nil, err
+	}
+	// The text representation keeps the precision of the number, and DuckDB casts it to DECIMAL exactly.
+	return n.Value()
+}
+
+func decodeDate(m *pgtype.Map, oid uint32, format int16, src []byte) (any, error) {
+	var d pgtype.Date
+	if err := m.Scan(oid, format, src, &d); err != nil {
+		return nil, err
+	}
+	if d.InfinityModifier != pgtype.Finite {
+		return d.InfinityModifier.String(), nil
+	}
+	return d.Time, nil
+}
+
+func decodeTime(m *pgtype.Map, oid uint32, format int16, src []byte) (any, error) {
+	var t pgtype.Time
+	if err := m.Scan(oid, format, src, &t); err != nil {
+		return nil, err
+	}
+	return formatMicrosOfDay(t.Microseconds), nil
+}
+
+func decodeTimestamp(m *pgtype.Map, oid uint32, format int16, src []byte) (any, error) {
+	var ts pgtype.Timestamp
+	if err := m.Scan(oid, format, src, &ts); err != nil {
+		return nil, err
+	}
+	if ts.InfinityModifier != pgtype.Finite {
+		return ts.InfinityModifier.String(), nil
+	}
+	return ts.Time, nil
+}
+
+func decodeTimestamptz(m *pgtype.Map, oid uint32, format int16, src []byte) (any, error) {
+	var ts pgtype.Timestamptz
+	if err := m.Scan(oid, format, src, &ts); err != nil {
+		return nil, err
+	}
+	if ts.InfinityModifier != pgtype.Finite {
+		return ts.InfinityModifier.String(), nil
+	}
+	// A time.Time would be bound as a TIMESTAMP and then converted with the session time zone,
+	// so the instant is passed with its offset instead.
+	return ts.Time.UTC().Format("2006-01-02 15:04:05.999999-07:00"), nil
+}
+
+func decodeInterval(m *pgtype.Map, oid uint32, format int16, src []byte) (any, error) {
+	var iv pgtype.Interval
+	if err := m.Scan(oid, format, src, &iv); err != nil {
+		return nil, err
+	}
+	return duckdb.Interval{Months: iv.Months, Days: iv.Days, Micros: iv.Microseconds}, nil
+}
+
+// decodeArray decodes a one-dimensional array into a DuckDB list literal, since DuckDB cannot bind lists.
+// The literal is cast to the list type of the parameter by DuckDB.
+func decodeArray(m *pgtype.Map, oid uint32, elemType *pgtype.Type, format int16, src []byte) (any, error) {
+	var arr pgtype.Array[any]
+	if err := m.Scan(oid, format, src, &arr); err != nil {
+		return nil, err
+	}
+	if len(arr.Dims) > 1 {
+		return nil, fmt.Errorf("multidimensional arrays are not supported as parameters")
+	}
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, elem := range arr.Elements {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		s, err := formatListElement(elemType.OID, elem)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(s)
+	}
+	b.WriteByte(']')
+	return b.String(), nil
+}
+
+func formatListElement(oid uint32, elem any) (string, error) {
+	switch v := elem.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		// DuckDB's cast from VARCHAR to a list has no escaping and trims the elements,
+		// so the strings that it would misread are rejected.
+		if v == "" || strings.TrimSpace(v) != v || strings.EqualFold(v, "NULL") || strings.ContainsAny(v, `,[]{}()'"\`) {
+			return "", fmt.Errorf("array element %q of type %d cannot be passed as a parameter", v, oid)
+		}
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		switch oid {
+		case pgtype.DateOID:
+			return v.Format(time.DateOnly), nil
+		case pgtype.TimestamptzOID:
+			return v.UTC().Format("2006-01-02 15:04:05.999999-07:00"), nil
+		default:
+			return v.Format("2006-01-02 15:04:05.999999"), nil
+		}
+	case pgtype.Numeric:
+		s, err := v.Value()
+		if err != nil {
+			return "", err
+		}
+		return s.(string), nil
+	case pgtype.Time:
+		return formatMicrosOfDay(v.Microseconds), nil
+	case [16]byte:
+		u, err := pgtype.UUID{Bytes: v, Valid: true}.Value()
+		if err != nil {
+			return "", err
+		}
+		return u.(string), nil
+	case int8, int16, int32, int64, int, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("array element of type %T cannot be passed as a parameter", elem)
+	}
+}
+
+func formatMicrosOfDay(micros int64) string {
+	d := time.Duration(micros) * time.Microsecond
+	return fmt.Sprintf("%02d:%02d:%02d.%06d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, micros%1e6)
+}
@@ -0,0 +1,111 @@
+package pgtypes
+
+import (
+	"math/big"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeParameter(t *testing.T) {
+	date := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	timestamp := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	numeric := pgtype.Numeric{Int: big.NewInt(-123456789012345678), Exp: -10, Valid: true}
+	uuid := [16]byte{0xa0, 0xee, 0xbc, 0x99, 0x9c, 0x0b, 0x4e, 0xf8, 0xbb, 0x6d, 0x6b, 0xb9, 0xbd, 0x38, 0x0a, 0x11}
+
+	tests := []struct {
+		name    string
+		oid     uint32
+		value   any
+		want    any
+		wantErr bool
+	}{
+		{name: "bool", oid: pgtype.BoolOID, value: true, want: true},
+		{name: "int2", oid: pgtype.Int2OID, value: int16(-2), want: int16(-2)},
+		{name: "int4", oid: pgtype.Int4OID, value: int32(1 << 30), want: int32(1 << 30)},
+		{name: "int8", oid: pgtype.Int8OID, value: int64(1 << 62), want: int64(1 << 62)},
+		{name: "oid", oid: pgtype.OIDOID, value: uint32(4294967295), want: uint32(4294967295)},
+		{name: "float4", oid: pgtype.Float4OID, value: float32(1.5), want: float32(1.5)},
+		{name: "float8", oid: pgtype.Float8OID, value: 0.1, want: 0.1},
+		{name: "numeric", oid: pgtype.NumericOID, value: numeric, want: "-12345678.9012345678"},
+		{name: "text", oid: pgtype.TextOID, value: "it's", want: "it's"},
+		{name: "varchar", oid: pgtype.VarcharOID, value: "abc", want: "abc"},
+		{name: "bpchar", oid: pgtype.BPCharOID, value: "abc ", want: "abc "},
+		{name: "name", oid: pgtype.NameOID, value: "pg_class", want: "pg_class"},
+		{name: "json", oid: pgtype.JSONOID, value: `{"a":1}`, want: `{"a":1}`},
+		{name: "jsonb", oid: pgtype.JSONBOID, value: `{"a": 1}`, want: `{"a": 1}`},
+		{name: "bytea", oid: pgtype.ByteaOID, value: []byte{0, 1, 0xff}, want: []byte{0, 1, 0xff}},
+		{name: "date", oid: pgtype.DateOID, value: date, want: date},
+		{name: "infinite date", oid: pgtype.DateOID, value: pgtype.Date{InfinityModifier: pgtype.Infinity, Valid: true}, want: "infinity"},
+		{name: "time", oid: pgtype.TimeOID, value: pgtype.Time{Microseconds: 45296789012, Valid: true}, want: "12:34:56.789012"},
+		{name: "timestamp", oid: pgtype.TimestampOID, value: timestamp, want: timestamp},
+		{name: "timestamptz", oid: pgtype.TimestamptzOID, value: timestamp.In(time.FixedZone("", 7200)), want: "2024-01-02 03:04:05.123456+00:00"},
+		{name: "interval", oid: pgtype.IntervalOID, value: pgtype.Interval{Months: 1, Days: 2, Microseconds: 3, Valid: true}, want: duckdb.Interval{Months: 1, Days: 2, Micros: 3}},
+		{name: "uuid", oid: pgtype.UUIDOID, value: uuid, want: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"},
+		{name: "inet", oid: pgtype.InetOID, value: netip.MustParsePrefix("192.168.0.1/24"), want: "192.168.0.1/24"},
+		{name: "NULL", oid: pgtype.Int4OID, value: nil, want: nil},
+		{name: "int4[]", oid: pgtype.Int4ArrayOID, value: []any{int32(1), nil, int32(3)}, want: "[1, NULL, 3]"},
+		{name: "float8[]", oid: pgtype.Float8ArrayOID, value: []float64{1.5, -2}, want: "[1.5, -2]"},
+		{name: "bool[]", oid: pgtype.BoolArrayOID, value: []bool{true, false}, want: "[true, false]"},
+		{name: "text[]", oid: pgtype.TextArrayOID, value: []string{"a", "b-c"}, want: "[a, b-c]"},
+		{name: "empty text[]", oid: pgtype.TextArrayOID, value: []string{}, want: "[]"},
+		{name: "date[]", oid: pgtype.DateArrayOID, value: []time.Time{date}, want: "[2024-01-02]"},
+		{name: "numeric[]", oid: pgtype.NumericArrayOID, value: []pgtype.Numeric{numeric}, want: "[-12345678.9012345678]"},
+		{name: "uuid[]", oid: pgtype.UUIDArrayOID, value: [][16]byte{uuid}, want: "[a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11]"},
+		{name: "text[] with a comma", oid: pgtype.TextArrayOID, value: []string{"a,b"}, wantErr: true},
+		{name: "text[] with the string NULL", oid: pgtype.TextArrayOID, value: []string{"null"}, wantErr: true},
+	}
+
+	m := pgtype.NewMap()
+	for _, tt := range tests {
+		for _, format := range []int16{pgtype.TextFormatCode, pgtype.BinaryFormatCode} {
+			src, err := m.Encode(tt.oid, format, tt.value, nil)
+			require.NoError(t, err, tt.name)
+			got, err := DecodeParameter(m, tt.oid, format, src)
+			if tt.wantErr {
+				require.Error(t, err, "%s (format %d)", tt.name, format)
+				continue
+			}
+			require.NoError(t, err, "%s (format %d)", tt.name, format)
+			require.Equal(t, tt.want, got, "%s (format %d)", tt.name, format)
+		}
+	}
+}
+
+func TestDecodeParameterOfUnknownType(t *testing.T) {
+	m := pgtype.NewMap()
+	for _, oid := range []uint32{0, pgtype.UnknownOID, 999999} {
+		got, err := DecodeParameter(m, oid, pgtype.TextFormatCode, []byte("42"))
+		require.NoError(t, err)
+		require.Equal(t, "42", got)
+	}
+}
+
+func TestDecodeMultidimensionalArrayParameter(t *testing.T) {
+	_, err := DecodeParameter(pgtype.NewMap(), pgtype.Int4ArrayOID, pgtype.TextFormatCode, []byte("{{1,2},{3,4}}"))
+	require.Error(t, err)
+}
+
+func TestParameterOID(t *testing.T) {
+	tests := []struct {
+		typ  duckdb.Type
+		want uint32
+	}{
+		{typ: duckdb.TYPE_INTEGER, want: pgtype.Int4OID},
+		{typ: duckdb.TYPE_DECIMAL, want: pgtype.NumericOID},
+		{typ: duckdb.TYPE_UUID, want: pgtype.UUIDOID},
+		{typ: duckdb.TYPE_TIMESTAMP_TZ, want: pgtype.TimestamptzOID},
+		{typ: duckdb.TYPE_UBIGINT, want: pgtype.NumericOID},
+		{typ: duckdb.TYPE_ENUM, want: pgtype.TextOID},
+		{typ: duckdb.TYPE_LIST, want: pgtype.TextArrayOID},
+		{typ: duckdb.TYPE_STRUCT, want: pgtype.TextOID},
+		{typ: duckdb.TYPE_INVALID, want: pgtype.UnknownOID},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, ParameterOID(tt.typ), "DuckDB type %d", tt.typ)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"reflect"
+	"regexp"
 	"strings"
 
 	"github.com/apache/arrow-go/v18/arrow"
@@ -249,6 +250,9 @@ func PostgresTypeSize(oid uint32) int32 {
 	return -1
 }
 
+// arraySuffixRegex matches the suffix of the names of the LIST and ARRAY types.
+var arraySuffixRegex = regexp.MustCompile(`\[\d*\]$`)
+
 // GoDuckDBTypeNameToPostgresType parses a type name reported by the go-duckdb driver
 // into a corresponding pgtype.Type with its precision and scale (if applicable).
 // Unknown types are fallback to text.
@@ -256,10 +260,10 @@ func PostgresTypeSize(oid uint32) int32 {
 // TODO(fan): Make this function more rigorous for nested types.
 func GoDuckDBTypeNameToPostgresType(name string) (pt *pgtype.Type, precision, scale int32, fallback bool, err error) {
 	var list bool
-	if strings.HasSuffix(name, "[]") {
-		// LIST type
-		// Ref: logicalTypeNameList in go-duckdb
-		name = strings.TrimSuffix(name, "[]")
+	if loc := arraySuffixRegex.FindStringIndex(name); loc != nil {
+		// LIST type, e.g., INTEGER[], or ARRAY type, e.g., FLOAT[3] (the vectors)
+		// Ref: logicalTypeNameList and logicalTypeNameArray in go-duckdb
+		name = name[:loc[0]]
 		list = true
 	}
 
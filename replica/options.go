@@ -57,5 +57,15 @@ func RegisterReplicaOptions(options *ReplicaOptions) {
 			Type:              types.NewSystemBoolType("replica_is_loading_snapshot"),
 			Default:           false,
 		},
+		&sql.MysqlSystemVariable{
+			// If enabled, a replica that has not applied any binlog events clones the schemas and data
+			// of the source when replication is started, and then streams the binlog from the clone.
+			Name:              "replica_initial_sync",
+			Scope:             sql.GetMysqlScope(sql.SystemVariableScope_Global),
+			Dynamic:           true,
+			SetVarHintApplies: false,
+			Type:              types.NewSystemBoolType("replica_initial_sync"),
+			Default:           false,
+		},
 	})
 }
@@ -31,10 +31,10 @@ import (
 	"github.com/apecloud/myduckserver/mycontext"
 )
 
-// registerReplicaController registers the replica controller into the engine
+// RegisterReplicaController creates a replica controller of the server and registers it into the engine
 // to handle the replication commands, such as START REPLICA, STOP REPLICA, etc.
-func RegisterReplicaController(provider *catalog.DatabaseProvider, engine *sqle.Engine, builder *backend.DuckBuilder) {
-	replica := binlogreplication.MyBinlogReplicaController
+func RegisterReplicaController(provider *catalog.DatabaseProvider, engine *sqle.Engine, builder *backend.DuckBuilder) *binlogreplication.MyBinlogReplicaController {
+	replica := binlogreplication.NewMyBinlogReplicaController()
 	replica.SetEngine(engine)
 
 	stdctx := context.Background()
@@ -51,10 +51,15 @@ func RegisterReplicaController(provider *catalog.DatabaseProvider, engine *sqle.
 	replica.SetTableWriterProvider(twp)
 	builder.FlushDeltaBuffer = nil // TODO: implement this
 
-	engine.Analyzer.Catalog.BinlogReplicaController = binlogreplication.MyBinlogReplicaController
+	engine.Analyzer.Catalog.BinlogReplicaController = replica
+	return replica
+}
 
+// AutoStartReplica restarts the replication if it was running when the server stopped.
+// It is called after the replica controller is registered, and a restored replica is reconciled.
+func AutoStartReplica(replica *binlogreplication.MyBinlogReplicaController) {
 	// If we're unable to restart replication, log an error, but don't prevent the server from starting up
-	if err := binlogreplication.MyBinlogReplicaController.AutoStart(ctx); err != nil {
+	if err := replica.AutoStart(context.Background()); err != nil {
 		logrus.Errorf("unable to restart replication: %s", err.Error())
 	}
 }
@@ -95,3 +100,7 @@ func (twp *tableWriterProvider) FlushDeltaBuffer(ctx *sql.Context, conn *stdsql.
 func (twp *tableWriterProvider) DiscardDeltaBuffer(ctx *sql.Context) {
 	twp.controller.Close()
 }
+
+func (twp *tableWriterProvider) DeltaBufferCommitted(ctx *sql.Context) {
+	twp.controller.Committed(ctx)
+}
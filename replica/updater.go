@@ -24,18 +24,31 @@ func isPkUpdate(schema sql.Schema, identifyColumns, dataColumns mysql.Bitmap) bo
 	return false
 }
 
+// getPrimaryKeyIndices returns the indices of the primary key columns,
+// or nil if any of them is not present in the row image.
+// The rows parsed from a row image have an entry for every column, so the indices are the column ordinals.
 func getPrimaryKeyIndices(schema sql.Schema, columns mysql.Bitmap) []int {
-	var count int
 	var indices []int
 	for i, c := range schema {
-		set := columns.Count() > i && columns.Bit(i)
-		if c.PrimaryKey && !set {
+		if !c.PrimaryKey {
+			continue
+		}
+		if columns.Count() <= i || !columns.Bit(i) {
 			return nil
-		} else if c.PrimaryKey && set {
-			indices = append(indices, count)
 		}
-		if set {
-			count++
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+// getColumnIndices returns the indices of the columns present in the row image.
+// With --binlog-row-image=minimal, the before image contains only the primary key columns
+// and the after image contains only the columns that are set by the statement.
+func getColumnIndices(columnCount int, columns mysql.Bitmap) []int {
+	indices := make([]int, 0, columns.BitCount())
+	for i := range columnCount {
+		if columns.Bit(i) {
+			indices = append(indices, i)
 		}
 	}
 	return indices
@@ -61,6 +74,11 @@ func (twp *tableWriterProvider) newTableUpdater(
 	for i, idx := range pkColumns {
 		pkSubSchema[i] = schema[idx]
 	}
+	keyIndices := pkColumns // in the order of the primary key, as in the WHERE clauses
+	if len(pkColumns) == 0 {
+		keyIndices = getColumnIndices(columnCount, identifyColumns)
+	}
+	dataIndices := getColumnIndices(columnCount, dataColumns)
 
 	var (
 		sql                 string
@@ -76,7 +94,7 @@ func (twp *tableWriterProvider) newTableUpdater(
 		sql, paramCount = buildDeleteTemplate(fullTableName, columnCount, schema, pkColumns, identifyColumns)
 	case binlog.UpdateRowEvent:
 		pkUpdate = isPkUpdate(schema, identifyColumns, dataColumns)
-		if pkUpdate {
+		if pkUpdate && dataCount == columnCount {
 			// If the primary key is being updated, we need to use DELETE + INSERT.
 			//
 			// For example, if the primary has executed `UPDATE t SET pk = pk + 1;`,
@@ -93,17 +111,19 @@ func (twp *tableWriterProvider) newTableUpdater(
 			if len(pkIndicesInIdentify) == 0 || len(pkIndicesInData) == 0 {
 				return nil, ErrPartialPrimaryKeyUpdate
 			}
-			sql, paramCount = buildInsertTemplate(fullTableName, columnCount, true)
+			sql, paramCount = buildInsertTemplate(fullTableName, schema, dataIndices, true)
 			cleanup, _ = buildDeleteTemplate(fullTableName, columnCount, schema, pkColumns, identifyColumns)
 			replace = true
 		} else if keyCount < columnCount || dataCount < columnCount {
+			// A partial after image, e.g., with --binlog-row-image=minimal, contains only the changed columns,
+			// so only these columns are updated. The new values of the primary key, if changed, are set as well.
 			sql, paramCount = buildUpdateTemplate(fullTableName, columnCount, schema, pkColumns, identifyColumns, dataColumns)
 		} else {
-			sql, paramCount = buildInsertTemplate(fullTableName, columnCount, true)
+			sql, paramCount = buildInsertTemplate(fullTableName, schema, dataIndices, true)
 			replace = true
 		}
 	case binlog.InsertRowEvent:
-		sql, paramCount = buildInsertTemplate(fullTableName, columnCount, false)
+		sql, paramCount = buildInsertTemplate(fullTableName, schema, dataIndices, false)
 	}
 
 	logrus.WithFields(logrus.Fields{
@@ -122,17 +142,21 @@ func (twp *tableWriterProvider) newTableUpdater(
 
 	return &tableUpdater{
 		provider:   twp.provider,
+		tx:         txn,
 		stmt:       stmt,
 		replace:    replace,
 		cleanup:    cleanup,
 		paramCount: paramCount,
 
-		pkIndicesInIdentify: pkIndicesInIdentify,
-		pkIndicesInData:     pkIndicesInData,
+		pkSubSchema: pkSubSchema,
+		keyIndices:  keyIndices,
+		dataIndices: dataIndices,
 	}, nil
 }
 
-func buildInsertTemplate(tableName string, columnCount int, replace bool) (string, int) {
+// buildInsertTemplate builds an INSERT statement for the columns present in the after image.
+// The omitted columns of a partial after image take their default values.
+func buildInsertTemplate(tableName string, schema sql.Schema, columns []int, replace bool) (string, int) {
 	var builder strings.Builder
 	builder.Grow(32)
 	builder.WriteString("INSERT")
@@ -141,15 +165,22 @@ func buildInsertTemplate(tableName string, columnCount int, replace bool) (strin
 	}
 	builder.WriteString(" INTO ")
 	builder.WriteString(tableName)
-	builder.WriteString(" VALUES (")
-	for i := range columnCount {
+	builder.WriteString(" (")
+	for i, c := range columns {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(quoteIdentifier(schema[c].Name))
+	}
+	builder.WriteString(") VALUES (")
+	for i := range columns {
 		builder.WriteString("?")
-		if i < columnCount-1 {
+		if i < len(columns)-1 {
 			builder.WriteString(", ")
 		}
 	}
 	builder.WriteString(")")
-	return builder.String(), columnCount
+	return builder.String(), len(columns)
 }
 
 func buildDeleteTemplate(tableName string, columnCount int, schema sql.Schema, pkColumns []int, identifyColumns mysql.Bitmap) (string, int) {
@@ -237,17 +268,21 @@ type tableUpdater struct {
 	cleanup    string
 	paramCount int
 
-	pkSubSchema         sql.Schema
-	pkIndicesInIdentify []int
-	pkIndicesInData     []int
+	pkSubSchema sql.Schema
+	keyIndices  []int // the columns that identify a row in the WHERE clause
+	dataIndices []int // the columns present in the after image
 }
 
 var _ binlogreplication.TableWriter = &tableUpdater{}
 
 func (tu *tableUpdater) Insert(ctx *sql.Context, rows []sql.Row) error {
 	defer tu.stmt.Close()
+	buf := make(sql.Row, len(tu.dataIndices))
 	for _, row := range rows {
-		if _, err := tu.stmt.ExecContext(ctx.Context, row...); err != nil {
+		for i, idx := range tu.dataIndices {
+			buf[i] = row[idx]
+		}
+		if _, err := tu.stmt.ExecContext(ctx.Context, buf...); err != nil {
 			return err
 		}
 	}
@@ -256,18 +291,12 @@ func (tu *tableUpdater) Insert(ctx *sql.Context, rows []sql.Row) error {
 
 func (tu *tableUpdater) Delete(ctx *sql.Context, keyRows []sql.Row) error {
 	defer tu.stmt.Close()
-	buf := make(sql.Row, len(tu.pkIndicesInIdentify))
+	buf := make(sql.Row, len(tu.keyIndices))
 	for _, row := range keyRows {
-		var keys sql.Row
-		if len(tu.pkIndicesInIdentify) > 0 {
-			for i, idx := range tu.pkIndicesInIdentify {
-				buf[i] = row[idx]
-			}
-			keys = buf
-		} else {
-			keys = row
+		for i, idx := range tu.keyIndices {
+			buf[i] = row[idx]
 		}
-		if _, err := tu.stmt.ExecContext(ctx.Context, keys...); err != nil {
+		if _, err := tu.stmt.ExecContext(ctx.Context, buf...); err != nil {
 			return err
 		}
 	}
@@ -284,19 +313,17 @@ func (tu *tableUpdater) Update(ctx *sql.Context, keyRows []sql.Row, valueRows []
 	}
 
 	// UPDATE t SET col1 = ?, col2 = ? WHERE key1 = ? AND key2 = ?
-	buf := make([]interface{}, tu.paramCount)
+	defer tu.stmt.Close()
+	buf := make(sql.Row, tu.paramCount)
 	for i, values := range valueRows {
 		keys := keyRows[i]
-		copy(buf, values)
-		if len(tu.pkIndicesInIdentify) > 0 {
-			for j, idx := range tu.pkIndicesInIdentify {
-				buf[len(values)+j] = keys[idx]
-			}
-		} else {
-			copy(buf[len(values):], keys)
+		for j, idx := range tu.dataIndices {
+			buf[j] = values[idx]
 		}
-		args := buf[:len(values)+len(keys)]
-		if _, err := tu.stmt.ExecContext(ctx.Context, args...); err != nil {
+		for j, idx := range tu.keyIndices {
+			buf[len(tu.dataIndices)+j] = keys[idx]
+		}
+		if _, err := tu.stmt.ExecContext(ctx.Context, buf...); err != nil {
 			return err
 		}
 	}
@@ -324,10 +351,8 @@ func (tu *tableUpdater) doInsertThenDelete(ctx *sql.Context, beforeRows []sql.Ro
 	afterKey := make(sql.Row, len(tu.pkSubSchema))
 	for i, before := range beforeRows {
 		after := afterRows[i]
-		for j, idx := range tu.pkIndicesInIdentify {
+		for j, idx := range tu.keyIndices {
 			beforeKey[j] = before[idx]
-		}
-		for j, idx := range tu.pkIndicesInData {
 			afterKey[j] = after[idx]
 		}
 		if yes, err := beforeKey.Equals(afterKey, tu.pkSubSchema); err != nil {
@@ -0,0 +1,92 @@
+package replica
+
+import (
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/types"
+	"github.com/stretchr/testify/require"
+	"vitess.io/vitess/go/mysql"
+)
+
+func newBitmap(count int, present ...int) mysql.Bitmap {
+	bitmap := mysql.NewServerBitmap(count)
+	for _, i := range present {
+		bitmap.Set(i, true)
+	}
+	return bitmap
+}
+
+func TestUpdaterTemplatesForPartialRowImages(t *testing.T) {
+	// The primary key is declared in a different order than the columns: PRIMARY KEY (b, a)
+	schema := sql.Schema{
+		{Name: "a", Type: types.Int32, PrimaryKey: true},
+		{Name: "b", Type: types.Int32, PrimaryKey: true},
+		{Name: "c", Type: types.Text},
+		{Name: "d", Type: types.Text},
+	}
+	pkColumns := []int{1, 0}
+	table := `"db"."t"`
+
+	minimalBefore := newBitmap(4, 0, 1)
+	full := newBitmap(4, 0, 1, 2, 3)
+
+	require.Equal(t, []int{0, 1}, getPrimaryKeyIndices(schema, minimalBefore))
+	require.Nil(t, getPrimaryKeyIndices(schema, newBitmap(4, 1, 2)))
+	require.Equal(t, []int{0, 2}, getColumnIndices(4, newBitmap(4, 0, 2)))
+
+	tests := []struct {
+		name     string
+		build    func() (string, int)
+		wantSQL  string
+		wantArgs int
+	}{
+		{
+			name: "insert with omitted columns",
+			build: func() (string, int) {
+				return buildInsertTemplate(table, schema, []int{0, 1, 3}, false)
+			},
+			wantSQL:  `INSERT INTO "db"."t" ("a", "b", "d") VALUES (?, ?, ?)`,
+			wantArgs: 3,
+		},
+		{
+			name: "update of the changed columns",
+			build: func() (string, int) {
+				return buildUpdateTemplate(table, 4, schema, pkColumns, minimalBefore, newBitmap(4, 2))
+			},
+			wantSQL:  `UPDATE "db"."t" SET "c" = ? WHERE "b" = ? AND "a" = ?`,
+			wantArgs: 3,
+		},
+		{
+			name: "update of a primary key column",
+			build: func() (string, int) {
+				return buildUpdateTemplate(table, 4, schema, pkColumns, minimalBefore, newBitmap(4, 0, 3))
+			},
+			wantSQL:  `UPDATE "db"."t" SET "a" = ?, "d" = ? WHERE "b" = ? AND "a" = ?`,
+			wantArgs: 4,
+		},
+		{
+			name: "delete by the primary key",
+			build: func() (string, int) {
+				return buildDeleteTemplate(table, 4, schema, pkColumns, minimalBefore)
+			},
+			wantSQL:  `DELETE FROM "db"."t" WHERE "b" = ? AND "a" = ?`,
+			wantArgs: 2,
+		},
+		{
+			name: "full row image",
+			build: func() (string, int) {
+				return buildInsertTemplate(table, schema, getColumnIndices(4, full), true)
+			},
+			wantSQL:  `INSERT OR REPLACE INTO "db"."t" ("a", "b", "c", "d") VALUES (?, ?, ?, ?)`,
+			wantArgs: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, count := tt.build()
+			require.Equal(t, tt.wantSQL, sql)
+			require.Equal(t, tt.wantArgs, count)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2024-2025 ApeCloud, Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"github.com/apecloud/myduckserver/pgserver"
+	"github.com/apecloud/myduckserver/replica"
+)
+
+// Config is the configuration of a server. The zero values of the ports disable the corresponding services,
+// except for the MySQL protocol, which is always served; use DefaultConfig for the defaults of the command line.
+type Config struct {
+	// Address is the address to bind the MySQL, Postgres and health services to.
+	Address string
+	// Port is the port of the MySQL protocol. Zero picks a free port, see Server.MySQLAddr.
+	Port int
+	// Socket is the Unix domain socket of the MySQL protocol. It is not served if empty.
+	Socket string
+	// DataDir is the directory to store the databases in.
+	DataDir string
+	// DefaultDB is the name of the default database. The default database is in memory if it is "memory".
+	DefaultDB string
+	// DefaultTimeZone is the time zone of DuckDB. It is the local time zone if empty.
+	DefaultTimeZone string
+	// DuckDBSettings are the global settings of DuckDB, e.g., memory_limit and threads.
+	DuckDBSettings map[string]string
+	// VectorIndexes loads the vss extension for the HNSW indexes of the vectors, see catalog.ProviderOptions.
+	VectorIndexes bool
+	// SuperuserPassword is the password of the superuser account, shared between the MySQL and Postgres servers.
+	SuperuserPassword string
+	// MySQLCompression supports the compressed MySQL protocol (zlib and zstd) for the clients that request it.
+	MySQLCompression bool
+	// Replica is the configuration of the MySQL replication. Its ReportPort defaults to Port.
+	Replica replica.ReplicaOptions
+
+	Postgres PostgresConfig
+
+	// FlightSQLHost and FlightSQLPort are the address of the Flight SQL service, which is disabled if the port is not positive.
+	FlightSQLHost string
+	FlightSQLPort int
+
+	// Reader opens the database files in read-only mode to serve the reads beside a writer, and reopens them
+	// every ReaderRefreshInterval to pick up a newer snapshot. See catalog/reader.go.
+	Reader                bool
+	ReaderRefreshInterval time.Duration
+
+	// Restored indicates that the data file has just been restored or bootstrapped from another server,
+	// so that the subscriptions are reconciled with their replication slots, and the binlog replica with
+	// its source, before they are started.
+	Restored bool
+	// RestoreResync resyncs the restored subscriptions that cannot resume from their slots, and resets the binlog
+	// replica that cannot resume from its source, instead of disabling them.
+	RestoreResync bool
+}
+
+// PostgresConfig is the configuration of the Postgres protocol.
+type PostgresConfig struct {
+	// Port is the port of the Postgres protocol, which is disabled if it is not positive.
+	Port int
+	// VersionString is the value of version() in the Postgres dialect.
+	VersionString string
+	// PoolerMode runs the server safely behind transaction-pooling proxies, e.g., PgBouncer.
+	PoolerMode bool
+	// SlotCheckInterval is how often the WAL retained on the primaries by the replication slots of the subscriptions
+	// is checked. Zero disables the checks.
+	SlotCheckInterval time.Duration
+	// SlotWALWarnSize is the size in MB of the WAL retained by a slot above which a warning is logged.
+	SlotWALWarnSize int
+	// MaxSlotWALKeepSize is the size in MB of the WAL retained by a slot above which the subscription is resynced.
+	// A negative value disables the resyncs.
+	MaxSlotWALKeepSize int
+	// MaxResultSize is the default limit in MB of the size of the result of a query. Zero disables the limit.
+	MaxResultSize int
+	// ResultBufferSize is the size in MB of the rows of a result buffered in memory while the client is reading it.
+	ResultBufferSize int
+	// ResultSpill spills the rows of a result beyond ResultBufferSize to a temporary file.
+	ResultSpill bool
+	// CursorIdleTimeout is how long an idle cursor WITH HOLD is kept. Zero keeps the cursors until the sessions end.
+	CursorIdleTimeout time.Duration
+}
+
+// DefaultConfig returns the default configuration, which is also the default of the command line.
+func DefaultConfig() Config {
+	return Config{
+		Address:        "0.0.0.0",
+		Port:           3306,
+		DataDir:        ".",
+		DefaultDB:      "myduck",
+		DuckDBSettings: make(map[string]string),
+		Postgres: PostgresConfig{
+			Port:               5432,
+			SlotCheckInterval:  time.Minute,
+			SlotWALWarnSize:    1024,
+			MaxSlotWALKeepSize: -1,
+			ResultBufferSize:   16,
+			CursorIdleTimeout:  pgserver.DefaultCursorIdleTimeout,
+		},
+		FlightSQLHost:         "localhost",
+		FlightSQLPort:         -1,
+		ReaderRefreshInterval: 30 * time.Second,
+	}
+}
+
+// Option modifies the configuration of a server, see Run.
+type Option func(*Config)
+
+// WithAddress sets the address to bind to.
+func WithAddress(address string) Option {
+	return func(cfg *Config) { cfg.Address = address }
+}
+
+// WithPorts sets the ports of the MySQL and Postgres protocols. A zero MySQL port picks a free one,
+// and a non-positive Postgres port disables the Postgres protocol.
+func WithPorts(mysqlPort, postgresPort int) Option {
+	return func(cfg *Config) {
+		cfg.Port = mysqlPort
+		cfg.Postgres.Port = postgresPort
+	}
+}
+
+// WithSocket sets the Unix domain socket of the MySQL protocol.
+func WithSocket(socket string) Option {
+	return func(cfg *Config) { cfg.Socket = socket }
+}
+
+// WithDataDir sets the directory to store the databases in.
+func WithDataDir(dir string) Option {
+	return func(cfg *Config) { cfg.DataDir = dir }
+}
+
+// WithDefaultDB sets the name of the default database. The default database is in memory if it is "memory".
+func WithDefaultDB(name string) Option {
+	return func(cfg *Config) { cfg.DefaultDB = name }
+}
+
+// WithSuperuserPassword sets the password of the superuser account.
+func WithSuperuserPassword(password string) Option {
+	return func(cfg *Config) { cfg.SuperuserPassword = password }
+}
+
+// WithDuckDBSetting sets a global setting of DuckDB, e.g., WithDuckDBSetting("memory_limit", "8GB").
+func WithDuckDBSetting(name, value string) Option {
+	return func(cfg *Config) {
+		if cfg.DuckDBSettings == nil {
+			cfg.DuckDBSettings = make(map[string]string)
+		}
+		cfg.DuckDBSettings[name] = value
+	}
+}
+
+// WithVectorIndexes loads the vss extension for the HNSW indexes of the vectors.
+func WithVectorIndexes() Option {
+	return func(cfg *Config) { cfg.VectorIndexes = true }
+}
+
+// WithReplication sets the configuration of the MySQL replication.
+func WithReplication(opts replica.ReplicaOptions) Option {
+	return func(cfg *Config) { cfg.Replica = opts }
+}
+
+// WithPostgres sets the configuration of the Postgres protocol.
+func WithPostgres(pg PostgresConfig) Option {
+	return func(cfg *Config) { cfg.Postgres = pg }
+}
+
+// WithReader runs the server as a reader that refreshes its snapshot at the interval.
+func WithReader(refreshInterval time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.Reader = true
+		cfg.ReaderRefreshInterval = refreshInterval
+	}
+}
+
+// WithFlightSQL enables the Flight SQL service on the address.
+func WithFlightSQL(host string, port int) Option {
+	return func(cfg *Config) {
+		cfg.FlightSQLHost = host
+		cfg.FlightSQLPort = port
+	}
+}
@@ -11,7 +11,7 @@
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.
-package main
+package server
 
 import (
 	"context"
@@ -39,7 +39,7 @@ func (m *MySQLPersister) Persist(ctx *sql.Context, data []byte) error {
 }
 
 // https://github.com/dolthub/go-mysql-server/blob/main/_example/users_example.go
-func setPersister(provider sql.DatabaseProvider, engine *sqle.Engine, superuser, password string) error {
+func setPersister(provider sql.DatabaseProvider, engine *sqle.Engine, dataDir, superuser, password string) error {
 	session := memory.NewSession(sql.NewBaseSession(), provider)
 	ctx := sql.NewContext(context.Background(), sql.WithSession(session))
 	ctx.SetCurrentDatabase("mysql")
@@ -53,7 +53,7 @@ func setPersister(provider sql.DatabaseProvider, engine *sqle.Engine, superuser,
 	// The persister here simply stands-in for your provided persistence function. The database calls this whenever it
 	// needs to save any changes to any of the "mysql" database's tables. The memory session persists in memory,
 	// but can be swapped out with the lines below
-	persister := &MySQLPersister{FilePath: path.Join(dataDirectory, persistFile)}
+	persister := &MySQLPersister{FilePath: path.Join(dataDir, persistFile)}
 	mysqlDb.SetPersister(persister)
 
 	if _, err := os.Stat(persister.FilePath); err == nil {
@@ -0,0 +1,436 @@
+// Copyright 2024-2025 ApeCloud, Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server runs MyDuck Server in-process, so that it can be embedded in other Go programs and tests:
+//
+//	srv, err := server.Run(server.DefaultConfig(), server.WithPorts(0, 0), server.WithDefaultDB("memory"))
+//	if err != nil { ... }
+//	defer srv.Shutdown(context.Background())
+//	db, err := sql.Open("mysql", "root@tcp("+srv.MySQLAddr().String()+")/")
+//
+// Each server has its own databases, MySQL replica controller, job scheduler and replicators of the Postgres
+// subscriptions, all of which are stopped by Shutdown. Some of the components are still global to the process,
+// e.g., the system variables and the Postgres configuration, and the Postgres subscriptions are registered
+// by their names, so the servers in a process should not have subscriptions of the same names.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/flight/flightsql"
+	"github.com/apecloud/myduckserver/backend"
+	"github.com/apecloud/myduckserver/binlogreplication"
+	"github.com/apecloud/myduckserver/catalog"
+	"github.com/apecloud/myduckserver/flightsqlserver"
+	"github.com/apecloud/myduckserver/health"
+	"github.com/apecloud/myduckserver/myfunc"
+	"github.com/apecloud/myduckserver/pgserver"
+	"github.com/apecloud/myduckserver/pgserver/logrepl"
+	"github.com/apecloud/myduckserver/pgserver/pgconfig"
+	"github.com/apecloud/myduckserver/plugin"
+	"github.com/apecloud/myduckserver/replica"
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	gmsserver "github.com/dolthub/go-mysql-server/server"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/vitess/go/mysql"
+	_ "github.com/marcboeker/go-duckdb"
+	"github.com/sirupsen/logrus"
+)
+
+// Server is a MyDuck Server running in-process.
+type Server struct {
+	cfg      Config
+	provider *catalog.DatabaseProvider
+	engine   *sqle.Engine
+	mysql    *gmsserver.Server
+	postgres *pgserver.Server
+	replica  *binlogreplication.MyBinlogReplicaController
+	jobs     *backend.JobScheduler
+
+	// stops are the functions that stop the background services, called in reverse order on shutdown.
+	stops []func()
+
+	done     chan struct{} // closed when the MySQL server stops accepting connections
+	err      error
+	shutdown sync.Once
+}
+
+// Run starts a server with the configuration modified by the options, and returns once the server accepts
+// connections. The server runs until Shutdown is called.
+func Run(cfg Config, opts ...Option) (*Server, error) {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.Replica.ReportPort == 0 {
+		cfg.Replica.ReportPort = cfg.Port
+	}
+
+	s := &Server{cfg: cfg, done: make(chan struct{})}
+	if err := s.start(); err != nil {
+		if s.mysql != nil {
+			s.mysql.Close()
+		}
+		s.close()
+		return nil, err
+	}
+
+	go func() {
+		defer close(s.done)
+		s.err = s.mysql.Start()
+	}()
+	return s, nil
+}
+
+// start opens the databases and starts the services. The services started so far are stopped by the caller on error.
+func (s *Server) start() (err error) {
+	cfg := s.cfg
+	if cfg.Reader {
+		if cfg.ReaderRefreshInterval <= 0 {
+			return fmt.Errorf("the refresh interval of a reader must be positive")
+		}
+		if cfg.FlightSQLPort > 0 {
+			return fmt.Errorf("the Flight SQL service is not supported by a reader")
+		}
+	}
+
+	s.provider, err = catalog.NewDBProvider(catalog.ProviderOptions{
+		DataDir:         cfg.DataDir,
+		DefaultDB:       cfg.DefaultDB,
+		DefaultTimeZone: cfg.DefaultTimeZone,
+		ReadOnly:        cfg.Reader,
+		Settings:        cfg.DuckDBSettings,
+		VectorIndexes:   cfg.VectorIndexes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open the database: %w", err)
+	}
+	s.stops = append(s.stops, func() { s.provider.Close() })
+
+	// Clear the pipes directory on startup.
+	backend.RemoveAllPipes(cfg.DataDir)
+
+	if err = s.buildEngine(); err != nil {
+		return err
+	}
+	if err = s.startBackgroundServices(); err != nil {
+		return err
+	}
+	if err = s.listenMySQL(); err != nil {
+		return err
+	}
+	if cfg.Postgres.Port > 0 {
+		if err = s.startPostgres(); err != nil {
+			return err
+		}
+	}
+	if cfg.FlightSQLPort > 0 {
+		if err = s.startFlightSQL(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) buildEngine() error {
+	provider := s.provider
+	engine := sqle.NewDefault(provider)
+
+	builder := backend.NewDuckBuilder(engine.Analyzer.ExecBuilder, provider)
+	engine.Analyzer.ExecBuilder = builder
+	backend.AddUnsignedResultRule(engine.Analyzer)
+	engine.Analyzer.Catalog.RegisterFunction(sql.NewContext(context.Background()), myfunc.ExtraBuiltIns...)
+	engine.Analyzer.Catalog.RegisterFunction(sql.NewContext(context.Background()), backend.JobFunctions...)
+	engine.Analyzer.Catalog.RegisterFunction(sql.NewContext(context.Background()), backend.FullTextFunctions...)
+	engine.Analyzer.Catalog.RegisterFunction(sql.NewContext(context.Background()), backend.VectorFunctions...)
+	provider.RegisterTableFunctions(backend.NewMySQLQueryFunction(provider))
+	engine.Analyzer.Catalog.MySQLDb.SetPlugins(plugin.AuthPlugins)
+	engine.Parser = backend.NewParser()
+	if err := catalog.RegisterInformationSchemaTables(sql.NewContext(context.Background()), engine.Analyzer.Catalog.InfoSchema); err != nil {
+		return fmt.Errorf("failed to register the information_schema tables: %w", err)
+	}
+
+	if err := setPersister(provider, engine, s.cfg.DataDir, "root", s.cfg.SuperuserPassword); err != nil {
+		return fmt.Errorf("failed to set the persister: %w", err)
+	}
+
+	replica.RegisterReplicaOptions(&s.cfg.Replica)
+	s.replica = replica.RegisterReplicaController(provider, engine, builder)
+	if s.cfg.Restored && !s.cfg.Reader {
+		reconcileRestoredReplica(s.replica, s.cfg.RestoreResync)
+	}
+	replica.AutoStartReplica(s.replica)
+	// The replication is stopped before the databases are closed, and restarts with the server.
+	s.stops = append(s.stops, s.replica.Stop)
+
+	s.engine = engine
+	return nil
+}
+
+func (s *Server) startBackgroundServices() error {
+	if s.cfg.Reader {
+		return s.startReaderServices()
+	}
+
+	// Run the background jobs defined in __sys__.jobs, along with the background services as the system jobs:
+	// the purges of the expired rows of the tables with a retention policy,
+	// the refreshes of the user-defined rules that rewrite the incoming queries,
+	// and the rewrites of the tables heavily updated by the replication in the maintenance window.
+	s.jobs = backend.NewJobScheduler()
+	s.jobs.AddSystemJob(backend.NewTTLPurger(s.provider).Job())
+	rewriteRuleRefresher := backend.NewRewriteRuleRefresher(s.provider)
+	rewriteRuleRefresher.Load()
+	s.jobs.AddSystemJob(rewriteRuleRefresher.Job())
+	s.jobs.AddSystemJob(backend.NewCompactor(s.provider).Job())
+	if err := s.jobs.Start(s.provider.Storage()); err != nil {
+		return fmt.Errorf("failed to start the job scheduler: %w", err)
+	}
+	backend.SetJobScheduler(s.provider, s.jobs)
+	s.stops = append(s.stops, func() {
+		backend.SetJobScheduler(s.provider, nil)
+		s.jobs.Stop()
+		rewriteRuleRefresher.SaveHits()
+	})
+	return nil
+}
+
+// startReaderServices starts the background services of a reader, which leaves the writes to the writer.
+func (s *Server) startReaderServices() error {
+	snapshotRefresher := backend.NewSnapshotRefresher(s.provider, s.cfg.ReaderRefreshInterval)
+	snapshotRefresher.Start()
+	s.stops = append(s.stops, snapshotRefresher.Stop)
+
+	rewriteRuleRefresher := backend.NewRewriteRuleRefresher(s.provider)
+	rewriteRuleRefresher.Start()
+	s.stops = append(s.stops, rewriteRuleRefresher.Stop)
+	return nil
+}
+
+func (s *Server) listenMySQL() error {
+	serverConfig := gmsserver.Config{
+		Protocol: "tcp",
+		Address:  net.JoinHostPort(s.cfg.Address, strconv.Itoa(s.cfg.Port)),
+		Socket:   s.cfg.Socket,
+	}
+	listener, err := gmsserver.NewListener(serverConfig.Protocol, serverConfig.Address, serverConfig.Socket)
+	if errors.Is(err, gmsserver.UnixSocketInUseError) {
+		logrus.WithError(err).Warnln("Failed to listen on the Unix domain socket")
+	} else if err != nil {
+		return fmt.Errorf("failed to create MySQL-protocol listener: %w", err)
+	}
+	// The bytes are counted on the wire, i.e., after compression.
+	serverConfig.Listener = backend.NewStatusListener(listener)
+	if s.cfg.MySQLCompression {
+		serverConfig.Listener = backend.NewCompressionListener(serverConfig.Listener)
+	}
+	// COM_CHANGE_USER is intercepted in the plain packets, i.e., after decompression.
+	changeUser := backend.NewChangeUserListener(serverConfig.Listener, serverConfig.TLSConfig)
+	serverConfig.Listener = changeUser
+	s.mysql, err = gmsserver.NewServerWithHandler(serverConfig, s.engine, backend.NewSessionBuilder(s.provider, s.engine.Analyzer.Catalog.MySQLDb), nil,
+		changeUser.WrapHandler(backend.WrapHandler(s.provider, s.engine.Analyzer.Catalog.MySQLDb)))
+	if err != nil {
+		serverConfig.Listener.Close()
+		return fmt.Errorf("failed to create MySQL-protocol server: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) startPostgres() error {
+	pg := s.cfg.Postgres
+	provider := s.provider
+	pgServer, err := pgserver.NewServer(
+		provider,
+		s.cfg.Address, pg.Port,
+		s.cfg.SuperuserPassword,
+		func() *sql.Context {
+			session := backend.NewSession(memory.NewSession(sql.NewBaseSession(), provider), provider)
+			return sql.NewContext(context.Background(), sql.WithSession(session))
+		},
+		pgserver.WithEngine(s.mysql.Engine),
+		pgserver.WithSessionManager(s.mysql.SessionManager()),
+		pgserver.WithConnID(&s.mysql.Listener.(*mysql.Listener).ConnectionID), // Shared connection ID counter
+		pgserver.WithVersionString(pg.VersionString),
+		pgserver.WithPoolerMode(pg.PoolerMode),
+		pgserver.WithResultLimits(uint64(pg.MaxResultSize)<<20, int64(pg.ResultBufferSize)<<20, pg.ResultSpill),
+		pgserver.WithCursorIdleTimeout(pg.CursorIdleTimeout),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create Postgres-protocol server: %w", err)
+	}
+	s.postgres = pgServer
+	s.stops = append(s.stops, pgServer.Close)
+
+	// The subscriptions are applied by the writer.
+	if !s.cfg.Reader {
+		s.startSubscriptions(pgServer)
+	}
+
+	// Load the configuration for the Postgres server.
+	pgconfig.Init()
+	go pgServer.Start()
+	return nil
+}
+
+// startSubscriptions starts the Postgres subscriptions, and the monitor of their replication slots.
+func (s *Server) startSubscriptions(pgServer *pgserver.Server) {
+	pg := s.cfg.Postgres
+
+	// Check if there is a replication subscription and start replication if there is.
+	// Each subscription applies the changes in an internal session of its own.
+	logrepl.SetContextFactory(s.provider, pgServer.NewInternalCtx)
+	// The replicators are stopped before the Postgres server and the databases are closed.
+	s.stops = append(s.stops, func() {
+		logrepl.StopSubscriptions(s.provider)
+		logrepl.SetContextFactory(s.provider, nil)
+	})
+	if s.cfg.Restored {
+		reconcileRestoredSubscriptions(pgServer.NewInternalCtx(), s.cfg.RestoreResync)
+	}
+	if err := logrepl.UpdateSubscriptions(pgServer.NewInternalCtx()); err != nil {
+		logrus.WithError(err).Warnln("Failed to update subscriptions")
+	}
+
+	if pg.SlotCheckInterval > 0 {
+		// Warn about, or resync, the subscriptions whose slots retain too much WAL on the primaries.
+		slotMonitor := logrepl.NewSlotMonitor(pgServer.NewInternalCtx, logrepl.SlotMonitorOptions{
+			Interval:    pg.SlotCheckInterval,
+			WarnSize:    int64(pg.SlotWALWarnSize) << 20,
+			MaxKeepSize: int64(max(pg.MaxSlotWALKeepSize, 0)) << 20,
+		})
+		slotMonitor.Start()
+		s.stops = append(s.stops, slotMonitor.Stop)
+	}
+}
+
+func (s *Server) startFlightSQL() error {
+	srv, err := flightsqlserver.NewSQLiteFlightSQLServer(s.provider.Storage())
+	if err != nil {
+		return fmt.Errorf("failed to create Flight SQL server: %w", err)
+	}
+
+	server := flight.NewServerWithMiddleware(nil)
+	server.RegisterFlightService(flightsql.NewFlightServer(srv))
+	if err := server.Init(net.JoinHostPort(s.cfg.FlightSQLHost, strconv.Itoa(s.cfg.FlightSQLPort))); err != nil {
+		return fmt.Errorf("failed to listen for Flight SQL: %w", err)
+	}
+	s.stops = append(s.stops, server.Shutdown)
+
+	logrus.Infoln("Starting Flight SQL Server on", server.Addr())
+	go server.Serve()
+	return nil
+}
+
+// reconcileRestoredSubscriptions checks the subscriptions of the restored data file against their replication slots
+// before they are started, and resyncs or disables the ones that cannot resume. See logrepl.ReconcileSubscriptions.
+func reconcileRestoredSubscriptions(ctx *sql.Context, resync bool) {
+	health.SetRestoring(true)
+	defer health.SetRestoring(false)
+
+	results, err := logrepl.ReconcileSubscriptions(ctx, resync)
+	if err != nil {
+		logrus.WithError(err).Warnln("Failed to reconcile the restored subscriptions")
+		return
+	}
+	for _, rec := range results {
+		if rec.Err == nil && rec.Status == logrepl.ReconcileResumable {
+			logrus.Infoln("Reconciled the restored", rec)
+		} else {
+			logrus.Warnln("Reconciled the restored", rec)
+		}
+	}
+}
+
+// reconcileRestoredReplica checks the binlog position of the restored data file against the replication source
+// before the replication is started, and resets or stops the replica that cannot resume.
+// See binlogreplication.ReconcileRestored.
+func reconcileRestoredReplica(replica *binlogreplication.MyBinlogReplicaController, resync bool) {
+	health.SetRestoring(true)
+	defer health.SetRestoring(false)
+
+	rec, err := replica.ReconcileRestored(resync)
+	switch {
+	case err != nil:
+		logrus.WithError(err).Warnln("Failed to reconcile the restored binlog replica")
+	case rec == nil:
+	case rec.Err == nil && rec.Status == binlogreplication.ReplicaResumable:
+		logrus.Infoln("Reconciled the restored", rec)
+	default:
+		logrus.Warnln("Reconciled the restored", rec)
+	}
+}
+
+// Provider returns the database provider of the server.
+func (s *Server) Provider() *catalog.DatabaseProvider {
+	return s.provider
+}
+
+// Engine returns the query engine of the server.
+func (s *Server) Engine() *sqle.Engine {
+	return s.engine
+}
+
+// MySQLAddr returns the address the MySQL protocol is served on, e.g., to find the port picked for a zero Port.
+func (s *Server) MySQLAddr() net.Addr {
+	return s.mysql.Listener.Addr()
+}
+
+// PostgresAddr returns the address the Postgres protocol is served on, or nil if it is disabled.
+func (s *Server) PostgresAddr() net.Addr {
+	if s.postgres == nil {
+		return nil
+	}
+	return s.postgres.Listener.Addr()
+}
+
+// PostgresServer returns the Postgres-protocol server, or nil if it is disabled.
+func (s *Server) PostgresServer() *pgserver.Server {
+	return s.postgres
+}
+
+// Wait blocks until the server stops accepting MySQL connections, i.e., until it is shut down.
+func (s *Server) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// Shutdown stops accepting connections, stops the background services, the MySQL replication and the replicators
+// of the Postgres subscriptions, and closes the databases.
+// It returns the error of the context if the MySQL listener does not stop before the context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var err error
+	s.shutdown.Do(func() {
+		s.mysql.Close()
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		s.close()
+	})
+	return err
+}
+
+// close stops the services started so far in reverse order.
+func (s *Server) close() {
+	for i := len(s.stops) - 1; i >= 0; i-- {
+		s.stops[i]()
+	}
+	s.stops = nil
+}
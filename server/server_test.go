@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunAndShutdown(t *testing.T) {
+	srv, err := Run(DefaultConfig(),
+		WithAddress("127.0.0.1"),
+		WithPorts(0, 0),
+		WithDataDir(t.TempDir()),
+		WithDefaultDB("memory"),
+	)
+	require.NoError(t, err)
+	require.Nil(t, srv.PostgresAddr())
+
+	db, err := stdsql.Open("mysql", fmt.Sprintf("root@tcp(%s)/", srv.MySQLAddr()))
+	require.NoError(t, err)
+	defer db.Close()
+	var one int
+	require.NoError(t, db.QueryRow("SELECT 1").Scan(&one))
+	require.Equal(t, 1, one)
+
+	require.NoError(t, srv.Shutdown(context.Background()))
+	require.NoError(t, srv.Wait())
+	// Shutdown is idempotent.
+	require.NoError(t, srv.Shutdown(context.Background()))
+}
+
+func TestRunWithPostgres(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Postgres.SlotCheckInterval = 0
+	srv, err := Run(cfg,
+		WithAddress("127.0.0.1"),
+		WithPorts(0, 55432),
+		WithDataDir(t.TempDir()),
+		WithDefaultDB("memory"),
+	)
+	require.NoError(t, err)
+	defer srv.Shutdown(context.Background())
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, fmt.Sprintf("postgres://postgres:@%s/memory", srv.PostgresAddr()))
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+	var one int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT 1").Scan(&one))
+	require.Equal(t, 1, one)
+}
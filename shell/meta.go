@@ -0,0 +1,138 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// metaCommand is a command of the shell that starts with a backslash.
+type metaCommand struct {
+	names       []string
+	args        string
+	description string
+	run         func(s *Shell, ctx context.Context, arg string) error
+}
+
+var metaCommands []metaCommand
+
+func init() {
+	metaCommands = []metaCommand{
+		{names: []string{`\?`, `\h`, `\help`}, description: "Show this help.", run: (*Shell).help},
+		{names: []string{`\q`, `\quit`}, description: "Quit the shell."},
+		{names: []string{`\s`, `\status`}, description: "Show the status of the server and the connection.", run: (*Shell).status},
+		{names: []string{`\r`, `\replication`}, description: "Show the status of the replication from MySQL and the Postgres subscriptions.", run: (*Shell).replication},
+		{names: []string{`\b`, `\backups`}, args: "[N]", description: "Show the last N backups taken by BACKUP DATABASE (default 10).", run: (*Shell).backups},
+		{names: []string{`\v`, `\settings`}, args: "[PATTERN]", description: "Show the global settings whose names contain PATTERN.", run: (*Shell).settings},
+		{names: []string{`\u`, `\use`}, args: "DATABASE", description: "Use another database.", run: (*Shell).use},
+	}
+}
+
+// runMetaCommand runs a meta-command, and returns true if the shell should quit.
+func (s *Shell) runMetaCommand(ctx context.Context, line string) (bool, error) {
+	if isQuitCommand(line) {
+		return true, nil
+	}
+	name, arg, _ := strings.Cut(strings.TrimRight(line, "; \t"), " ")
+	arg = strings.TrimSpace(arg)
+	for _, cmd := range metaCommands {
+		for _, n := range cmd.names {
+			if n != name {
+				continue
+			}
+			if cmd.run == nil {
+				return true, nil
+			}
+			return false, cmd.run(s, ctx, arg)
+		}
+	}
+	return false, fmt.Errorf(`unknown command %s, try \? for help`, name)
+}
+
+func (s *Shell) help(_ context.Context, _ string) error {
+	fmt.Fprintln(s.out, `Statements are terminated by ";", or by "\G" to show the rows vertically.`)
+	fmt.Fprintln(s.out)
+	for _, cmd := range metaCommands {
+		usage := strings.Join(cmd.names, ", ")
+		if cmd.args != "" {
+			usage += " " + cmd.args
+		}
+		fmt.Fprintf(s.out, "  %-28s %s\n", usage, cmd.description)
+	}
+	fmt.Fprintln(s.out)
+	return nil
+}
+
+func (s *Shell) status(ctx context.Context, _ string) error {
+	fmt.Fprintln(s.out, "Server:", s.addr)
+	return s.Execute(ctx,
+		"SELECT version() AS version, connection_id() AS connection_id, current_user() AS user, database() AS `database`",
+		true,
+	)
+}
+
+func (s *Shell) replication(ctx context.Context, _ string) error {
+	fmt.Fprintln(s.out, "Replication from MySQL:")
+	if err := s.Execute(ctx, "SHOW REPLICA STATUS", true); err != nil {
+		return err
+	}
+	// The connection strings of the subscriptions are not shown, as they may contain passwords.
+	fmt.Fprintln(s.out, "Postgres subscriptions:")
+	if err := s.Execute(ctx,
+		"SELECT subname AS name, subpublication AS publication, subschema AS `schema`, subschemamapping AS schema_mapping, subenabled AS enabled, subskiplsn AS lsn"+
+			" FROM __sys__.pg_subscription ORDER BY subname",
+		false,
+	); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, "Tables of the subscriptions that are not synced:")
+	return s.Execute(ctx,
+		"SELECT subname AS subscription, schemaname AS `schema`, relname AS `table`,"+
+			" CASE srsubstate WHEN 'i' THEN 'waiting' WHEN 'd' THEN 'copying' ELSE 'error' END AS state,"+
+			" srlasterror AS error, srupdated AS updated_at"+
+			" FROM __sys__.pg_subscription_rel WHERE srsubstate <> 'r' ORDER BY subname, schemaname, relname",
+		false,
+	)
+}
+
+func (s *Shell) backups(ctx context.Context, arg string) error {
+	limit := 10
+	if arg != "" {
+		if _, err := fmt.Sscanf(arg, "%d", &limit); err != nil || limit <= 0 {
+			return fmt.Errorf("invalid number of backups: %s", arg)
+		}
+	}
+	return s.Execute(ctx, fmt.Sprintf(
+		"SELECT started_at, finished_at, db_name AS `database`, remote_path,"+
+			" CASE WHEN error IS NULL THEN 'OK' ELSE 'FAILED' END AS status, coalesce(error, message) AS message"+
+			" FROM __sys__.backup_history ORDER BY started_at DESC LIMIT %d", limit),
+		false,
+	)
+}
+
+func (s *Shell) settings(ctx context.Context, pattern string) error {
+	query := "SHOW GLOBAL VARIABLES"
+	if pattern != "" {
+		query += " LIKE " + quoteString("%"+pattern+"%")
+	}
+	return s.Execute(ctx, query, false)
+}
+
+func (s *Shell) use(ctx context.Context, database string) error {
+	if database == "" {
+		return fmt.Errorf("no database is given")
+	}
+	if _, err := s.conn.ExecContext(ctx, "USE "+quoteIdentifier(strings.Trim(database, "`"))); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, "Database changed")
+	return nil
+}
+
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(s) + "'"
+}
+
+func quoteIdentifier(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
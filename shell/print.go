@@ -0,0 +1,74 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const null = "NULL"
+
+func cell(v *string) string {
+	if v == nil {
+		return null
+	}
+	return *v
+}
+
+// printTable prints the rows in a table like the one of the MySQL client.
+func printTable(w io.Writer, columns []string, rows [][]*string) {
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = utf8.RuneCountInString(column)
+	}
+	for _, row := range rows {
+		for i, v := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell(v)))
+		}
+	}
+
+	var border strings.Builder
+	border.WriteByte('+')
+	for _, width := range widths {
+		border.WriteString(strings.Repeat("-", width+2))
+		border.WriteByte('+')
+	}
+	line := func(values []string) {
+		var b strings.Builder
+		b.WriteByte('|')
+		for i, v := range values {
+			b.WriteByte(' ')
+			b.WriteString(v)
+			b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(v)+1))
+			b.WriteByte('|')
+		}
+		fmt.Fprintln(w, b.String())
+	}
+
+	fmt.Fprintln(w, border.String())
+	line(columns)
+	fmt.Fprintln(w, border.String())
+	values := make([]string, len(columns))
+	for _, row := range rows {
+		for i, v := range row {
+			values[i] = cell(v)
+		}
+		line(values)
+	}
+	fmt.Fprintln(w, border.String())
+}
+
+// printVertical prints each row as a list of the columns and the values, like \G of the MySQL client.
+func printVertical(w io.Writer, columns []string, rows [][]*string) {
+	width := 0
+	for _, column := range columns {
+		width = max(width, utf8.RuneCountInString(column))
+	}
+	for n, row := range rows {
+		fmt.Fprintf(w, "%s %d. row %s\n", strings.Repeat("*", 27), n+1, strings.Repeat("*", 27))
+		for i, column := range columns {
+			fmt.Fprintf(w, "%s%s: %s\n", strings.Repeat(" ", width-utf8.RuneCountInString(column)), column, cell(row[i]))
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// Package shell implements `myduckserver shell`, a minimal SQL shell that connects to a running server
+// over the MySQL protocol, so that the server can be managed where no MySQL or Postgres client is installed,
+// e.g., in a container.
+//
+// Besides SQL statements terminated by ";" (or "\G" for the vertical output), the shell accepts
+// the meta-commands listed by "\?", which show the status of the server, the replication, the backups,
+// and the settings.
+package shell
+
+import (
+	"bufio"
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Options are the options to connect to the server.
+type Options struct {
+	// Socket is the Unix domain socket of the server. Host and Port are used if it is empty.
+	Socket   string
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Database string
+}
+
+// DSN returns the data source name of the server for the MySQL driver.
+func (o Options) DSN() string {
+	cfg := mysql.NewConfig()
+	cfg.User = o.User
+	cfg.Passwd = o.Password
+	cfg.DBName = o.Database
+	if o.Socket != "" {
+		cfg.Net, cfg.Addr = "unix", o.Socket
+	} else {
+		cfg.Net, cfg.Addr = "tcp", o.Host+":"+strconv.Itoa(o.Port)
+	}
+	return cfg.FormatDSN()
+}
+
+// Shell is a session of the shell on a connection to the server.
+type Shell struct {
+	conn *stdsql.Conn
+	out  io.Writer
+	addr string
+}
+
+// Open connects to the server. The shell keeps a single connection, so that the session state,
+// e.g., the current database, is retained across the statements.
+func Open(ctx context.Context, opts Options, out io.Writer) (*Shell, error) {
+	db, err := stdsql.Open("mysql", opts.DSN())
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		db.Close()
+		return nil, err
+	}
+	addr := opts.Socket
+	if addr == "" {
+		addr = opts.Host + ":" + strconv.Itoa(opts.Port)
+	}
+	return &Shell{conn: conn, out: out, addr: addr}, nil
+}
+
+// Close closes the connection to the server.
+func (s *Shell) Close() error {
+	return s.conn.Close()
+}
+
+// Run reads the statements and the meta-commands from the input and executes them until the input ends
+// or the shell is quit. The prompts are shown if the input is interactive.
+// The errors of the statements are printed, and only the last one is returned if the input is not interactive.
+func (s *Shell) Run(ctx context.Context, in io.Reader, interactive bool) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	var lastErr error
+	var pending strings.Builder
+	for {
+		if interactive {
+			if pending.Len() == 0 {
+				fmt.Fprint(s.out, "myduck> ")
+			} else {
+				fmt.Fprint(s.out, "     -> ")
+			}
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Text()
+
+		if pending.Len() == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, `\`) || isQuitCommand(trimmed) {
+				quit, err := s.runMetaCommand(ctx, trimmed)
+				if err != nil {
+					fmt.Fprintln(s.out, "ERROR:", err)
+					lastErr = err
+				}
+				if quit {
+					return nil
+				}
+				continue
+			}
+		}
+
+		pending.WriteString(line)
+		pending.WriteByte('\n')
+		stmts, rest := splitStatements(pending.String())
+		pending.Reset()
+		pending.WriteString(rest)
+		for _, stmt := range stmts {
+			if err := s.Execute(ctx, stmt.query, stmt.vertical); err != nil {
+				fmt.Fprintln(s.out, "ERROR:", err)
+				lastErr = err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// The last statement may be left unterminated at the end of the input.
+	if query := strings.TrimSpace(pending.String()); query != "" {
+		if err := s.Execute(ctx, query, false); err != nil {
+			fmt.Fprintln(s.out, "ERROR:", err)
+			lastErr = err
+		}
+	}
+	if interactive {
+		fmt.Fprintln(s.out)
+		return nil
+	}
+	return lastErr
+}
+
+// Execute executes a statement and prints its result.
+func (s *Shell) Execute(ctx context.Context, query string, vertical bool) error {
+	start := time.Now()
+	if !returnsRows(query) {
+		result, err := s.conn.ExecContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		affected, _ := result.RowsAffected()
+		fmt.Fprintf(s.out, "Query OK, %d %s affected (%s)\n\n", affected, plural(affected, "row", "rows"), elapsed(start))
+		return nil
+	}
+
+	rows, err := s.conn.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, values, err := readRows(rows)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		fmt.Fprintf(s.out, "Query OK (%s)\n\n", elapsed(start))
+		return nil
+	}
+	if len(values) == 0 {
+		fmt.Fprintf(s.out, "Empty set (%s)\n\n", elapsed(start))
+		return nil
+	}
+	if vertical {
+		printVertical(s.out, columns, values)
+	} else {
+		printTable(s.out, columns, values)
+	}
+	n := int64(len(values))
+	fmt.Fprintf(s.out, "%d %s in set (%s)\n\n", n, plural(n, "row", "rows"), elapsed(start))
+	return nil
+}
+
+// readRows reads all rows of a result as strings, where NULL is nil.
+func readRows(rows *stdsql.Rows) ([]string, [][]*string, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	var values [][]*string
+	raw := make([]stdsql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		row := make([]*string, len(columns))
+		for i, b := range raw {
+			if b != nil {
+				v := string(b)
+				row[i] = &v
+			}
+		}
+		values = append(values, row)
+	}
+	return columns, values, rows.Err()
+}
+
+// statement is a statement split from the input, which is terminated by ";" or "\G".
+type statement struct {
+	query    string
+	vertical bool
+}
+
+// splitStatements splits the terminated statements from the input, and returns the rest of the input.
+// The terminators in the quoted strings, the quoted identifiers, and the comments are ignored.
+func splitStatements(input string) ([]statement, string) {
+	var stmts []statement
+	start := 0
+	var quote byte
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case quote == '\n' || quote == '*':
+			// In a comment
+			if quote == '\n' && c == '\n' {
+				quote = 0
+			} else if quote == '*' && c == '*' && i+1 < len(input) && input[i+1] == '/' {
+				quote = 0
+				i++
+			}
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '#' || (c == '-' && strings.HasPrefix(input[i:], "-- ")):
+			quote = '\n'
+		case c == '/' && strings.HasPrefix(input[i:], "/*"):
+			quote = '*'
+			i++
+		case c == ';' || (c == '\\' && i+1 < len(input) && (input[i+1] == 'G' || input[i+1] == 'g')):
+			vertical := c == '\\' && input[i+1] == 'G'
+			if query := strings.TrimSpace(input[start:i]); query != "" {
+				stmts = append(stmts, statement{query: query, vertical: vertical})
+			}
+			if c == '\\' {
+				i++
+			}
+			start = i + 1
+		}
+	}
+	rest := input[start:]
+	if strings.TrimSpace(rest) == "" {
+		rest = ""
+	}
+	return stmts, rest
+}
+
+// returnsRows returns true if the statement returns rows, judging by its first keyword.
+func returnsRows(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	keyword, _, _ := strings.Cut(query, " ")
+	keyword, _, _ = strings.Cut(keyword, "\n")
+	switch strings.ToUpper(keyword) {
+	case "SELECT", "SHOW", "DESCRIBE", "DESC", "EXPLAIN", "WITH", "VALUES", "TABLE", "CALL", "FROM", "PRAGMA", "SUMMARIZE":
+		return true
+	}
+	return false
+}
+
+func isQuitCommand(line string) bool {
+	switch strings.ToLower(strings.TrimRight(line, ";")) {
+	case "quit", "exit":
+		return true
+	}
+	return false
+}
+
+func plural(n int64, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+func elapsed(start time.Time) string {
+	return fmt.Sprintf("%.2f sec", time.Since(start).Seconds())
+}
+
+// IsTerminal returns true if the file is a terminal, in which case the shell is interactive.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,53 @@
+package shell
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []statement
+		rest  string
+	}{
+		{input: "SELECT 1;", want: []statement{{query: "SELECT 1"}}},
+		{input: "SELECT 1; SELECT 2\\G\nSELECT", want: []statement{{query: "SELECT 1"}, {query: "SELECT 2", vertical: true}}, rest: "\nSELECT"},
+		{input: "SELECT ';', \"\\\";\", `a;b`\n", rest: "SELECT ';', \"\\\";\", `a;b`\n"},
+		{input: "SELECT 1 -- ;\n, 2 /* ; */ # ;\n;", want: []statement{{query: "SELECT 1 -- ;\n, 2 /* ; */ # ;"}}},
+		{input: ";;\n", want: nil},
+	}
+	for _, tt := range tests {
+		stmts, rest := splitStatements(tt.input)
+		require.Equal(t, tt.want, stmts, tt.input)
+		require.Equal(t, tt.rest, rest, tt.input)
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	v := "héllo"
+	var b strings.Builder
+	printTable(&b, []string{"id", "name"}, [][]*string{{&v, nil}})
+	require.Equal(t, ""+
+		"+-------+------+\n"+
+		"| id    | name |\n"+
+		"+-------+------+\n"+
+		"| héllo | NULL |\n"+
+		"+-------+------+\n", b.String())
+
+	b.Reset()
+	printVertical(&b, []string{"id", "name"}, [][]*string{{&v, nil}})
+	require.Equal(t, ""+
+		"*************************** 1. row ***************************\n"+
+		"  id: héllo\n"+
+		"name: NULL\n", b.String())
+}
+
+func TestReturnsRows(t *testing.T) {
+	require.True(t, returnsRows("select 1"))
+	require.True(t, returnsRows("(SELECT 1) UNION (SELECT 2)"))
+	require.True(t, returnsRows("SHOW\nTABLES"))
+	require.False(t, returnsRows("INSERT INTO t VALUES (1)"))
+}
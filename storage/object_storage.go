@@ -208,3 +208,24 @@ func parseS3RegionCode(endpoint string) string {
 
 	return ""
 }
+
+// DuckDBURL returns the URL of the remote path that DuckDB reads and writes, which knows the s3:// scheme only.
+func (storageConfig *ObjectStorageConfig) DuckDBURL(remotePath string) string {
+	return "s3://" + remotePath
+}
+
+// DuckDBSecretStmt returns the statement that creates a temporary S3 secret of DuckDB with the credentials,
+// which applies to the URLs under the scope given. The S3-compatible storage is accessed over HTTP,
+// with the bucket in the path of the URL.
+func (storageConfig *ObjectStorageConfig) DuckDBSecretStmt(name, scope string) string {
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	stmt := fmt.Sprintf("CREATE OR REPLACE TEMPORARY SECRET %s (TYPE s3, KEY_ID %s, SECRET %s, REGION %s, SCOPE %s",
+		name, quote(storageConfig.AccessKeyId), quote(storageConfig.SecretAccessKey), quote(storageConfig.Region), quote(scope))
+	if storageConfig.Endpoint != "" {
+		stmt += ", ENDPOINT " + quote(storageConfig.Endpoint)
+	}
+	if storageConfig.Provider == "s3c" {
+		stmt += ", URL_STYLE 'path', USE_SSL false"
+	}
+	return stmt + ")"
+}
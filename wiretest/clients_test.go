@@ -0,0 +1,301 @@
+package wiretest
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apecloud/myduckserver/server"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+// client is a connection of a driver under test. The queries are written with the placeholders of Postgres,
+// i.e., $1, $2, ..., which are rewritten for the drivers of MySQL.
+type client interface {
+	// protocol is either "postgres" or "mysql".
+	protocol() string
+	// exec executes a statement, with the arguments bound by the driver, and returns the number of the affected rows.
+	exec(ctx context.Context, query string, args ...any) (int64, error)
+	// queryRow executes a query and scans its only row into dest.
+	queryRow(ctx context.Context, query string, args []any, dest ...any) error
+	// execPrepared prepares a statement once, and executes it with each of the argument lists.
+	execPrepared(ctx context.Context, query string, argLists [][]any) error
+	// begin, commit and rollback manage a transaction through the API of the driver.
+	begin(ctx context.Context) error
+	commit(ctx context.Context) error
+	rollback(ctx context.Context) error
+	// copyIn loads the rows into the columns of the table through the bulk load of the protocol,
+	// i.e., COPY FROM STDIN of Postgres, or LOAD DATA LOCAL INFILE of MySQL, and returns the number of the loaded rows.
+	copyIn(ctx context.Context, table string, columns []string, rows [][]any) (int64, error)
+	close() error
+}
+
+// clientFactory opens a client of a driver to the server.
+type clientFactory struct {
+	name string
+	open func(t *testing.T, srv *server.Server) client
+}
+
+var clientFactories = []clientFactory{
+	{name: "pgx", open: func(t *testing.T, srv *server.Server) client {
+		return openPgx(t, srv, pgx.QueryExecModeCacheStatement, false)
+	}},
+	{name: "pgx-describe-exec", open: func(t *testing.T, srv *server.Server) client {
+		return openPgx(t, srv, pgx.QueryExecModeDescribeExec, false)
+	}},
+	{name: "pgx-simple-protocol", open: func(t *testing.T, srv *server.Server) client {
+		// The simple protocol goes with the text format of COPY.
+		return openPgx(t, srv, pgx.QueryExecModeSimpleProtocol, true)
+	}},
+	{name: "lib/pq", open: func(t *testing.T, srv *server.Server) client {
+		return openSQL(t, "postgres", PostgresDSN(srv), "postgres")
+	}},
+	{name: "lib/pq-binary-parameters", open: func(t *testing.T, srv *server.Server) client {
+		return openSQL(t, "postgres", PostgresDSN(srv)+"&binary_parameters=yes", "postgres")
+	}},
+	{name: "go-sql-driver/mysql", open: func(t *testing.T, srv *server.Server) client {
+		return openSQL(t, "mysql", MySQLDSN(srv), "mysql")
+	}},
+}
+
+// pgxClient is a client of pgx, which uses the extended protocol with the binary format where it can,
+// unless it is in the simple protocol mode.
+type pgxClient struct {
+	conn     *pgx.Conn
+	tx       pgx.Tx
+	textCopy bool
+}
+
+func openPgx(t *testing.T, srv *server.Server, mode pgx.QueryExecMode, textCopy bool) client {
+	config, err := pgx.ParseConfig(PostgresDSN(srv))
+	require.NoError(t, err)
+	config.DefaultQueryExecMode = mode
+	conn, err := pgx.ConnectConfig(context.Background(), config)
+	require.NoError(t, err)
+	return &pgxClient{conn: conn, textCopy: textCopy}
+}
+
+type pgxQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func (c *pgxClient) querier() pgxQuerier {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.conn
+}
+
+func (c *pgxClient) protocol() string { return "postgres" }
+
+func (c *pgxClient) exec(ctx context.Context, query string, args ...any) (int64, error) {
+	tag, err := c.querier().Exec(ctx, query, args...)
+	return tag.RowsAffected(), err
+}
+
+func (c *pgxClient) queryRow(ctx context.Context, query string, args []any, dest ...any) error {
+	return c.querier().QueryRow(ctx, query, args...).Scan(dest...)
+}
+
+var statementSeq atomic.Int64
+
+func (c *pgxClient) execPrepared(ctx context.Context, query string, argLists [][]any) error {
+	name := fmt.Sprintf("wire_stmt_%d", statementSeq.Add(1))
+	if _, err := c.conn.Prepare(ctx, name, query); err != nil {
+		return err
+	}
+	for _, args := range argLists {
+		// pgx executes the prepared statement of the name with the extended protocol, whatever the mode is.
+		if _, err := c.querier().Exec(ctx, name, args...); err != nil {
+			return err
+		}
+	}
+	return c.conn.Deallocate(ctx, name)
+}
+
+func (c *pgxClient) begin(ctx context.Context) (err error) {
+	c.tx, err = c.conn.Begin(ctx)
+	return err
+}
+
+func (c *pgxClient) commit(ctx context.Context) error {
+	tx := c.tx
+	c.tx = nil
+	return tx.Commit(ctx)
+}
+
+func (c *pgxClient) rollback(ctx context.Context) error {
+	tx := c.tx
+	c.tx = nil
+	return tx.Rollback(ctx)
+}
+
+func (c *pgxClient) copyIn(ctx context.Context, table string, columns []string, rows [][]any) (int64, error) {
+	if !c.textCopy {
+		// The binary format.
+		return c.conn.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows))
+	}
+	tag, err := c.conn.PgConn().CopyFrom(ctx, strings.NewReader(tabSeparated(rows)),
+		fmt.Sprintf("COPY %s (%s) FROM STDIN", table, strings.Join(columns, ", ")))
+	return tag.RowsAffected(), err
+}
+
+func (c *pgxClient) close() error {
+	return c.conn.Close(context.Background())
+}
+
+// sqlClient is a client of a driver of database/sql, pinned to one connection of the pool.
+type sqlClient struct {
+	conn  *stdsql.Conn
+	tx    *stdsql.Tx
+	proto string
+}
+
+func openSQL(t *testing.T, driver, dsn, proto string) client {
+	db, err := stdsql.Open(driver, dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	conn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	return &sqlClient{conn: conn, proto: proto}
+}
+
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (stdsql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *stdsql.Row
+	PrepareContext(ctx context.Context, query string) (*stdsql.Stmt, error)
+}
+
+func (c *sqlClient) querier() sqlQuerier {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.conn
+}
+
+var placeholderRegex = regexp.MustCompile(`\$\d+`)
+
+// rebind rewrites the placeholders of Postgres for MySQL.
+func (c *sqlClient) rebind(query string) string {
+	if c.proto != "mysql" {
+		return query
+	}
+	return placeholderRegex.ReplaceAllString(query, "?")
+}
+
+func (c *sqlClient) protocol() string { return c.proto }
+
+func (c *sqlClient) exec(ctx context.Context, query string, args ...any) (int64, error) {
+	result, err := c.querier().ExecContext(ctx, c.rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (c *sqlClient) queryRow(ctx context.Context, query string, args []any, dest ...any) error {
+	return c.querier().QueryRowContext(ctx, c.rebind(query), args...).Scan(dest...)
+}
+
+func (c *sqlClient) execPrepared(ctx context.Context, query string, argLists [][]any) error {
+	stmt, err := c.querier().PrepareContext(ctx, c.rebind(query))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, args := range argLists {
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *sqlClient) begin(ctx context.Context) (err error) {
+	c.tx, err = c.conn.BeginTx(ctx, nil)
+	return err
+}
+
+func (c *sqlClient) commit(context.Context) error {
+	tx := c.tx
+	c.tx = nil
+	return tx.Commit()
+}
+
+func (c *sqlClient) rollback(context.Context) error {
+	tx := c.tx
+	c.tx = nil
+	return tx.Rollback()
+}
+
+var loadDataSeq atomic.Int64
+
+func (c *sqlClient) copyIn(ctx context.Context, table string, columns []string, rows [][]any) (int64, error) {
+	if c.proto == "mysql" {
+		name := fmt.Sprintf("wire_load_%d", loadDataSeq.Add(1))
+		mysql.RegisterReaderHandler(name, func() io.Reader { return strings.NewReader(tabSeparated(rows)) })
+		defer mysql.DeregisterReaderHandler(name)
+		return c.exec(ctx, fmt.Sprintf("LOAD DATA LOCAL INFILE 'Reader::%s' INTO TABLE %s (%s)", name, table, strings.Join(columns, ", ")))
+	}
+
+	// lib/pq sends the rows of the prepared COPY statement in a transaction.
+	tx, err := c.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return 0, err
+		}
+	}
+	result, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (c *sqlClient) close() error {
+	return c.conn.Close()
+}
+
+// tabSeparated formats the rows in the text format of COPY, which is also the default of LOAD DATA.
+// The values must not contain tabs, newlines or backslashes.
+func tabSeparated(rows [][]any) string {
+	var b strings.Builder
+	for _, row := range rows {
+		for i, v := range row {
+			if i > 0 {
+				b.WriteByte('\t')
+			}
+			if v == nil {
+				b.WriteString(`\N`)
+			} else {
+				fmt.Fprint(&b, v)
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,216 @@
+package wiretest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriverConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the conformance tests start a server")
+	}
+	srv := StartServer(t)
+	ctx := context.Background()
+
+	scenarios := []struct {
+		name string
+		run  func(t *testing.T, ctx context.Context, c client)
+	}{
+		{"prepared statements", testPreparedStatements},
+		{"transactions", testTransactions},
+		{"bulk load", testBulkLoad},
+		{"type round trip", testTypeRoundTrip},
+	}
+	for _, factory := range clientFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			c := factory.open(t, srv)
+			defer c.close()
+			for _, scenario := range scenarios {
+				t.Run(scenario.name, func(t *testing.T) {
+					scenario.run(t, ctx, c)
+				})
+			}
+		})
+	}
+}
+
+// recreateTable drops the table if it exists, and creates it with the columns.
+func recreateTable(t *testing.T, ctx context.Context, c client, table, columns string) {
+	_, err := c.exec(ctx, "DROP TABLE IF EXISTS "+table)
+	require.NoError(t, err)
+	_, err = c.exec(ctx, "CREATE TABLE "+table+" ("+columns+")")
+	require.NoError(t, err)
+}
+
+func count(t *testing.T, ctx context.Context, c client, table string) int64 {
+	var n int64
+	require.NoError(t, c.queryRow(ctx, "SELECT count(*) FROM "+table, nil, &n))
+	return n
+}
+
+func testPreparedStatements(t *testing.T, ctx context.Context, c client) {
+	recreateTable(t, ctx, c, "wire_prepared", "id INTEGER PRIMARY KEY, name VARCHAR(64), score DOUBLE")
+
+	// A prepared statement is executed many times, with the NULLs among its arguments.
+	var argLists [][]any
+	for i := 1; i <= 50; i++ {
+		var score any
+		if i%10 != 0 {
+			score = float64(i) / 2
+		}
+		argLists = append(argLists, []any{i, "name-" + string(rune('a'+i%26)), score})
+	}
+	require.NoError(t, c.execPrepared(ctx, "INSERT INTO wire_prepared (id, name, score) VALUES ($1, $2, $3)", argLists))
+	require.EqualValues(t, 50, count(t, ctx, c, "wire_prepared"))
+
+	var (
+		name  string
+		score *float64
+	)
+	require.NoError(t, c.queryRow(ctx, "SELECT name, score FROM wire_prepared WHERE id = $1", []any{3}, &name, &score))
+	require.Equal(t, "name-d", name)
+	require.NotNil(t, score)
+	require.Equal(t, 1.5, *score)
+	require.NoError(t, c.queryRow(ctx, "SELECT name, score FROM wire_prepared WHERE id = $1", []any{10}, &name, &score))
+	require.Nil(t, score)
+
+	// The arguments in the predicates, the projections and the aggregates.
+	var n int64
+	require.NoError(t, c.queryRow(ctx, "SELECT count(*) FROM wire_prepared WHERE id > $1 AND name <> $2", []any{20, "name-z"}, &n))
+	require.EqualValues(t, 29, n)
+
+	affected, err := c.exec(ctx, "UPDATE wire_prepared SET score = $1 WHERE id <= $2", 0.0, 5)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, affected)
+	affected, err = c.exec(ctx, "DELETE FROM wire_prepared WHERE score IS NULL")
+	require.NoError(t, err)
+	require.EqualValues(t, 5, affected)
+
+	// An error of a statement leaves the connection usable.
+	_, err = c.exec(ctx, "INSERT INTO wire_prepared (id, name) VALUES ($1, $2)", 1, "duplicate")
+	require.Error(t, err)
+	require.EqualValues(t, 45, count(t, ctx, c, "wire_prepared"))
+}
+
+func testTransactions(t *testing.T, ctx context.Context, c client) {
+	recreateTable(t, ctx, c, "wire_txn", "id INTEGER PRIMARY KEY, v VARCHAR(16)")
+
+	// The changes of a rolled back transaction are discarded.
+	require.NoError(t, c.begin(ctx))
+	_, err := c.exec(ctx, "INSERT INTO wire_txn VALUES ($1, $2)", 1, "rolled back")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, count(t, ctx, c, "wire_txn"))
+	require.NoError(t, c.rollback(ctx))
+	require.EqualValues(t, 0, count(t, ctx, c, "wire_txn"))
+
+	// The changes of a committed transaction are kept, including those of its prepared statements.
+	require.NoError(t, c.begin(ctx))
+	_, err = c.exec(ctx, "INSERT INTO wire_txn VALUES ($1, $2)", 1, "committed")
+	require.NoError(t, err)
+	require.NoError(t, c.execPrepared(ctx, "INSERT INTO wire_txn VALUES ($1, $2)", [][]any{{2, "a"}, {3, "b"}}))
+	_, err = c.exec(ctx, "UPDATE wire_txn SET v = $1 WHERE id = $2", "updated", 2)
+	require.NoError(t, err)
+	require.NoError(t, c.commit(ctx))
+	require.EqualValues(t, 3, count(t, ctx, c, "wire_txn"))
+	var v string
+	require.NoError(t, c.queryRow(ctx, "SELECT v FROM wire_txn WHERE id = $1", []any{2}, &v))
+	require.Equal(t, "updated", v)
+
+	// A failed statement in a transaction is recovered by the rollback.
+	require.NoError(t, c.begin(ctx))
+	_, err = c.exec(ctx, "INSERT INTO wire_txn VALUES ($1, $2)", 1, "duplicate")
+	require.Error(t, err)
+	require.NoError(t, c.rollback(ctx))
+	require.EqualValues(t, 3, count(t, ctx, c, "wire_txn"))
+}
+
+func testBulkLoad(t *testing.T, ctx context.Context, c client) {
+	recreateTable(t, ctx, c, "wire_copy", "id INTEGER, name VARCHAR(64), amount DOUBLE")
+
+	var rows [][]any
+	for i := 0; i < 1000; i++ {
+		var amount any
+		if i%100 != 0 {
+			amount = float64(i) * 1.25
+		}
+		rows = append(rows, []any{int32(i), "row " + string(rune('A'+i%26)), amount})
+	}
+	n, err := c.copyIn(ctx, "wire_copy", []string{"id", "name", "amount"}, rows)
+	require.NoError(t, err)
+	require.EqualValues(t, len(rows), n)
+
+	var (
+		total, nulls int64
+		sum          float64
+	)
+	require.NoError(t, c.queryRow(ctx, "SELECT count(*), count(*) - count(amount), sum(amount) FROM wire_copy", nil, &total, &nulls, &sum))
+	require.EqualValues(t, 1000, total)
+	require.EqualValues(t, 10, nulls)
+	require.Equal(t, (999*1000/2-(0+100+200+300+400+500+600+700+800+900))*1.25, sum)
+	var name string
+	require.NoError(t, c.queryRow(ctx, "SELECT name FROM wire_copy WHERE id = $1", []any{27}, &name))
+	require.Equal(t, "row B", name)
+}
+
+// typeCase is a value of a type that makes a round trip through the protocol: it is bound as an argument,
+// stored in a column of the type, and scanned back into a variable of the type of the value.
+type typeCase struct {
+	name string
+	// pgType and mysqlType are the types of the column for each protocol. The case is skipped if the type is empty.
+	pgType, mysqlType string
+	value             any
+}
+
+var typeCases = []typeCase{
+	{name: "boolean", pgType: "BOOLEAN", mysqlType: "BOOLEAN", value: true},
+	{name: "smallint", pgType: "SMALLINT", mysqlType: "SMALLINT", value: int16(-32768)},
+	{name: "integer", pgType: "INTEGER", mysqlType: "INT", value: int32(2147483647)},
+	{name: "bigint", pgType: "BIGINT", mysqlType: "BIGINT", value: int64(-9223372036854775808)},
+	{name: "real", pgType: "REAL", mysqlType: "FLOAT", value: float32(1.5)},
+	{name: "double", pgType: "DOUBLE PRECISION", mysqlType: "DOUBLE", value: 3.141592653589793},
+	{name: "numeric", pgType: "NUMERIC(10,2)", mysqlType: "DECIMAL(10,2)", value: "12345678.90"},
+	{name: "text", pgType: "TEXT", mysqlType: "TEXT", value: "héllo, 世界 'quoted'"},
+	{name: "empty text", pgType: "VARCHAR(8)", mysqlType: "VARCHAR(8)", value: ""},
+	{name: "binary", pgType: "BYTEA", mysqlType: "BLOB", value: []byte{0, 1, 2, 0x7f, 0x80, 0xff}},
+	{name: "date", pgType: "DATE", mysqlType: "DATE", value: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	{name: "timestamp", pgType: "TIMESTAMP", mysqlType: "DATETIME(6)", value: time.Date(2024, 12, 31, 23, 59, 58, 123456000, time.UTC)},
+	{name: "timestamptz", pgType: "TIMESTAMPTZ", value: time.Date(2001, 9, 9, 1, 46, 40, 0, time.UTC)},
+	{name: "uuid", pgType: "UUID", value: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"},
+}
+
+func testTypeRoundTrip(t *testing.T, ctx context.Context, c client) {
+	for _, tc := range typeCases {
+		typ := tc.pgType
+		if c.protocol() == "mysql" {
+			typ = tc.mysqlType
+		}
+		if typ == "" {
+			continue
+		}
+		t.Run(tc.name, func(t *testing.T) {
+			recreateTable(t, ctx, c, "wire_types", "id INTEGER, v "+typ)
+			_, err := c.exec(ctx, "INSERT INTO wire_types VALUES ($1, $2), ($3, NULL)", 1, tc.value, 2)
+			require.NoError(t, err)
+
+			got := reflect.New(reflect.TypeOf(tc.value))
+			require.NoError(t, c.queryRow(ctx, "SELECT v FROM wire_types WHERE id = $1", []any{1}, got.Interface()))
+			if want, ok := tc.value.(time.Time); ok {
+				require.True(t, want.Equal(got.Elem().Interface().(time.Time)), "want %v, got %v", want, got.Elem())
+			} else {
+				require.Equal(t, tc.value, got.Elem().Interface())
+			}
+
+			// The value is found by the argument of its type, and NULL is scanned into a pointer.
+			var id int64
+			require.NoError(t, c.queryRow(ctx, "SELECT id FROM wire_types WHERE v = $1", []any{tc.value}, &id))
+			require.EqualValues(t, 1, id)
+			null := reflect.New(reflect.PointerTo(reflect.TypeOf(tc.value)))
+			require.NoError(t, c.queryRow(ctx, "SELECT v FROM wire_types WHERE id = $1", []any{2}, null.Interface()))
+			require.True(t, null.Elem().IsNil())
+		})
+	}
+}
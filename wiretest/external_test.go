@@ -0,0 +1,97 @@
+package wiretest
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// externalTimeout bounds a run of the scenarios by a driver in a subprocess, including the startup of its runtime.
+const externalTimeout = 5 * time.Minute
+
+// runExternal runs the command of a driver in a subprocess, and fails the test with its output if it fails.
+func runExternal(t *testing.T, name string, args ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), externalTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	t.Logf("%s", out)
+	require.NoError(t, err, "%s", out)
+}
+
+// testdataPath returns the absolute path of a file in testdata, which is mounted or passed to the subprocesses.
+func testdataPath(t *testing.T, name string) string {
+	path, err := filepath.Abs(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	return path
+}
+
+func TestPsycopgConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the conformance tests start a server")
+	}
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 is not installed")
+	}
+	if err := exec.Command(python, "-c", "import psycopg").Run(); err != nil {
+		t.Skip("psycopg is not installed, see https://www.psycopg.org/psycopg3/docs/basic/install.html")
+	}
+	script := testdataPath(t, "psycopg_conformance.py")
+
+	srv := StartServer(t)
+	host, port := PostgresHostPort(t, srv)
+	runExternal(t, python, script, host, strconv.Itoa(port))
+}
+
+// pgjdbcJar returns the jar of the Postgres JDBC driver, given by PGJDBC_JAR, or downloaded for the compatibility
+// tests into compatibility/pg/java.
+func pgjdbcJar() string {
+	if jar := os.Getenv("PGJDBC_JAR"); jar != "" {
+		return jar
+	}
+	jars, _ := filepath.Glob(filepath.Join("..", "compatibility", "pg", "java", "postgresql-*.jar"))
+	if len(jars) == 0 {
+		return ""
+	}
+	jar, _ := filepath.Abs(jars[len(jars)-1])
+	return jar
+}
+
+func TestJDBCConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the conformance tests start a server")
+	}
+	jar := pgjdbcJar()
+	if jar == "" {
+		t.Skip("the jar of the Postgres JDBC driver is not found, set PGJDBC_JAR")
+	}
+	source := testdataPath(t, "Conformance.java")
+
+	// The program is run with a local JDK, or in a container of a JDK, which shares the network of the host
+	// to reach the server on the loopback address.
+	var name string
+	var args []string
+	if java, err := exec.LookPath("java"); err == nil {
+		name, args = java, []string{"-cp", jar, source}
+	} else if docker, err := exec.LookPath("docker"); err == nil {
+		name, args = docker, []string{
+			"run", "--rm", "--network", "host",
+			"-v", jar + ":/wire/pgjdbc.jar:ro",
+			"-v", source + ":/wire/Conformance.java:ro",
+			"eclipse-temurin:21-jdk",
+			"java", "-cp", "/wire/pgjdbc.jar", "/wire/Conformance.java",
+		}
+	} else {
+		t.Skip("neither java nor docker is installed")
+	}
+
+	srv := StartServer(t)
+	host, port := PostgresHostPort(t, srv)
+	runExternal(t, name, append(args, host, strconv.Itoa(port))...)
+}
@@ -0,0 +1,78 @@
+// Package wiretest checks the conformance of the MySQL and Postgres wire protocols of MyDuck Server
+// with the real client drivers, i.e., pgx, lib/pq, psycopg, the Postgres JDBC driver, and go-sql-driver/mysql.
+//
+// The same scenarios, i.e., prepared statements, transactions, bulk loads, and the round trip of the values
+// of the common types, are run by every driver against a server started in-process. The drivers of the other
+// languages are run in subprocesses, and their tests are skipped if their runtimes are not installed:
+//   - psycopg requires python3 with psycopg 3 installed.
+//   - JDBC requires the jar of the driver, given by PGJDBC_JAR or found in compatibility/pg/java,
+//     and either a local JDK 11+, or Docker to run it in a container of eclipse-temurin.
+package wiretest
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/apecloud/myduckserver/server"
+	"github.com/apecloud/myduckserver/testutil"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+// MySQLDatabase is the database the MySQL clients connect to.
+const MySQLDatabase = "wire"
+
+// StartServer runs a server in-process with the MySQL and Postgres protocols on free ports of the loopback address,
+// and shuts it down at the end of the test.
+func StartServer(t *testing.T) *server.Server {
+	cfg := server.DefaultConfig()
+	cfg.Postgres.SlotCheckInterval = 0
+	srv, err := server.Run(cfg,
+		server.WithAddress("127.0.0.1"),
+		server.WithPorts(0, testutil.FindFreePort()),
+		server.WithDataDir(t.TempDir()),
+		server.WithDefaultDB("memory"),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background())
+	})
+
+	// The Postgres clients use the public schema of the default database, and the MySQL clients use their own.
+	db, err := stdsql.Open("mysql", fmt.Sprintf("root@tcp(%s)/", srv.MySQLAddr()))
+	require.NoError(t, err)
+	defer db.Close()
+	for _, stmt := range []string{
+		"CREATE DATABASE IF NOT EXISTS " + MySQLDatabase,
+		"SET GLOBAL local_infile = 1", // LOAD DATA LOCAL INFILE
+	} {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err, stmt)
+	}
+	return srv
+}
+
+// PostgresDSN returns the URL to connect to the Postgres protocol of the server as the superuser.
+func PostgresDSN(srv *server.Server) string {
+	return fmt.Sprintf("postgres://postgres:@%s/memory?sslmode=disable", srv.PostgresAddr())
+}
+
+// PostgresHostPort returns the host and the port of the Postgres protocol of the server, for the drivers
+// run in subprocesses.
+func PostgresHostPort(t *testing.T, srv *server.Server) (string, int) {
+	host, port, err := net.SplitHostPort(srv.PostgresAddr().String())
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return host, p
+}
+
+// MySQLDSN returns the DSN of go-sql-driver/mysql to connect to MySQLDatabase as root.
+// The times are parsed in UTC, and the server-side prepared statements are used for the queries with arguments.
+func MySQLDSN(srv *server.Server) string {
+	return fmt.Sprintf("root@tcp(%s)/%s?parseTime=true&loc=UTC&interpolateParams=false", srv.MySQLAddr(), MySQLDatabase)
+}
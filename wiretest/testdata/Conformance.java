@@ -0,0 +1,215 @@
+import java.io.StringReader;
+import java.math.BigDecimal;
+import java.sql.Connection;
+import java.sql.Date;
+import java.sql.DriverManager;
+import java.sql.PreparedStatement;
+import java.sql.ResultSet;
+import java.sql.SQLException;
+import java.sql.Statement;
+import java.sql.Timestamp;
+import java.util.Arrays;
+import java.util.Objects;
+import java.util.UUID;
+
+import org.postgresql.PGConnection;
+
+/**
+ * Runs the conformance scenarios of wiretest with the Postgres JDBC driver.
+ *
+ * <p>Usage: java -cp postgresql.jar Conformance.java HOST PORT
+ */
+public class Conformance {
+    interface Scenario {
+        void run(Connection conn) throws Exception;
+    }
+
+    static void check(boolean ok, Object... message) {
+        if (!ok) {
+            throw new AssertionError(Arrays.deepToString(message));
+        }
+    }
+
+    static void recreateTable(Connection conn, String table, String columns) throws SQLException {
+        try (Statement stmt = conn.createStatement()) {
+            stmt.execute("DROP TABLE IF EXISTS " + table);
+            stmt.execute("CREATE TABLE " + table + " (" + columns + ")");
+        }
+    }
+
+    static long count(Connection conn, String table) throws SQLException {
+        try (Statement stmt = conn.createStatement(); ResultSet rs = stmt.executeQuery("SELECT count(*) FROM " + table)) {
+            rs.next();
+            return rs.getLong(1);
+        }
+    }
+
+    static void preparedStatements(Connection conn) throws Exception {
+        recreateTable(conn, "wire_prepared", "id INTEGER PRIMARY KEY, name VARCHAR(64), score DOUBLE");
+        // prepareThreshold=1 switches to a named server-side statement from the first execution.
+        try (PreparedStatement stmt = conn.prepareStatement("INSERT INTO wire_prepared (id, name, score) VALUES (?, ?, ?)")) {
+            for (int i = 1; i <= 50; i++) {
+                stmt.setInt(1, i);
+                stmt.setString(2, "name-" + (char) ('a' + i % 26));
+                if (i % 10 == 0) {
+                    stmt.setNull(3, java.sql.Types.DOUBLE);
+                } else {
+                    stmt.setDouble(3, i / 2.0);
+                }
+                check(stmt.executeUpdate() == 1, "insert", i);
+            }
+        }
+        check(count(conn, "wire_prepared") == 50, "count");
+
+        // The batches are sent as pipelined executions of the same statement.
+        try (PreparedStatement stmt = conn.prepareStatement("UPDATE wire_prepared SET score = ? WHERE id = ?")) {
+            for (int i = 1; i <= 5; i++) {
+                stmt.setDouble(1, 0);
+                stmt.setInt(2, i);
+                stmt.addBatch();
+            }
+            check(Arrays.stream(stmt.executeBatch()).sum() == 5, "batch");
+        }
+        try (PreparedStatement stmt = conn.prepareStatement("SELECT name, score FROM wire_prepared WHERE id = ?")) {
+            stmt.setInt(1, 3);
+            try (ResultSet rs = stmt.executeQuery()) {
+                check(rs.next() && rs.getString(1).equals("name-d") && rs.getDouble(2) == 1.5, "select 3");
+            }
+            stmt.setInt(1, 10);
+            try (ResultSet rs = stmt.executeQuery()) {
+                check(rs.next() && rs.getObject(2) == null, "select 10");
+            }
+        }
+        try (Statement stmt = conn.createStatement()) {
+            check(stmt.executeUpdate("DELETE FROM wire_prepared WHERE score IS NULL") == 5, "delete");
+        }
+        try (PreparedStatement stmt = conn.prepareStatement("INSERT INTO wire_prepared (id, name) VALUES (?, ?)")) {
+            stmt.setInt(1, 1);
+            stmt.setString(2, "duplicate");
+            stmt.executeUpdate();
+            check(false, "the duplicate key is inserted");
+        } catch (SQLException e) {
+            // expected
+        }
+        check(count(conn, "wire_prepared") == 45, "count after delete");
+    }
+
+    static void transactions(Connection conn) throws Exception {
+        recreateTable(conn, "wire_txn", "id INTEGER PRIMARY KEY, v VARCHAR(16)");
+        conn.setAutoCommit(false);
+        try (PreparedStatement stmt = conn.prepareStatement("INSERT INTO wire_txn VALUES (?, ?)")) {
+            stmt.setInt(1, 1);
+            stmt.setString(2, "rolled back");
+            stmt.executeUpdate();
+            check(count(conn, "wire_txn") == 1, "count in transaction");
+            conn.rollback();
+            check(count(conn, "wire_txn") == 0, "count after rollback");
+            conn.rollback();
+
+            for (int i = 1; i <= 3; i++) {
+                stmt.setInt(1, i);
+                stmt.setString(2, "committed");
+                stmt.executeUpdate();
+            }
+            conn.commit();
+            check(count(conn, "wire_txn") == 3, "count after commit");
+            conn.commit();
+
+            stmt.setInt(1, 1);
+            stmt.setString(2, "duplicate");
+            try {
+                stmt.executeUpdate();
+                check(false, "the duplicate key is inserted");
+            } catch (SQLException e) {
+                // expected
+            }
+            conn.rollback();
+        } finally {
+            conn.setAutoCommit(true);
+        }
+        check(count(conn, "wire_txn") == 3, "count after failed transaction");
+    }
+
+    static void bulkLoad(Connection conn) throws Exception {
+        recreateTable(conn, "wire_copy", "id INTEGER, name VARCHAR(64), amount DOUBLE");
+        StringBuilder data = new StringBuilder();
+        for (int i = 0; i < 1000; i++) {
+            data.append(i).append('\t').append("row ").append((char) ('A' + i % 26)).append('\t')
+                    .append(i % 100 == 0 ? "\\N" : String.valueOf(i * 1.25)).append('\n');
+        }
+        long n = conn.unwrap(PGConnection.class).getCopyAPI()
+                .copyIn("COPY wire_copy (id, name, amount) FROM STDIN", new StringReader(data.toString()));
+        check(n == 1000, "copy", n);
+        try (Statement stmt = conn.createStatement();
+                ResultSet rs = stmt.executeQuery("SELECT count(*), count(*) - count(amount), sum(amount) FROM wire_copy")) {
+            rs.next();
+            check(rs.getLong(1) == 1000 && rs.getLong(2) == 10 && rs.getDouble(3) == (499500 - 4500) * 1.25, "sum");
+        }
+    }
+
+    static void typeRoundTrip(Connection conn) throws Exception {
+        Object[][] cases = {
+            {"BOOLEAN", true},
+            {"SMALLINT", (short) -32768},
+            {"INTEGER", 2147483647},
+            {"BIGINT", -9223372036854775808L},
+            {"DOUBLE PRECISION", 3.141592653589793},
+            {"NUMERIC(10,2)", new BigDecimal("12345678.90")},
+            {"TEXT", "héllo, 世界 'quoted'"},
+            {"BYTEA", new byte[] {0, 1, 2, 0x7f, (byte) 0x80, (byte) 0xff}},
+            {"DATE", Date.valueOf("2024-02-29")},
+            {"TIMESTAMP", Timestamp.valueOf("2024-12-31 23:59:58.123456")},
+            {"UUID", UUID.fromString("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11")},
+        };
+        for (Object[] c : cases) {
+            String type = (String) c[0];
+            Object value = c[1];
+            recreateTable(conn, "wire_types", "id INTEGER, v " + type);
+            try (PreparedStatement stmt = conn.prepareStatement("INSERT INTO wire_types VALUES (1, ?), (2, NULL)")) {
+                stmt.setObject(1, value);
+                stmt.executeUpdate();
+            }
+            try (PreparedStatement stmt = conn.prepareStatement("SELECT v FROM wire_types WHERE id = ?")) {
+                stmt.setInt(1, 1);
+                try (ResultSet rs = stmt.executeQuery()) {
+                    check(rs.next(), type);
+                    Object got = rs.getObject(1, value.getClass());
+                    check(Objects.deepEquals(value, got), type, value, got);
+                }
+                stmt.setInt(1, 2);
+                try (ResultSet rs = stmt.executeQuery()) {
+                    check(rs.next() && rs.getObject(1) == null, type, "NULL");
+                }
+            }
+            try (PreparedStatement stmt = conn.prepareStatement("SELECT id FROM wire_types WHERE v = ?")) {
+                stmt.setObject(1, value);
+                try (ResultSet rs = stmt.executeQuery()) {
+                    check(rs.next() && rs.getInt(1) == 1, type, "lookup");
+                }
+            }
+        }
+    }
+
+    public static void main(String[] args) throws Exception {
+        String url = "jdbc:postgresql://" + args[0] + ":" + args[1] + "/memory?user=postgres&prepareThreshold=1";
+        boolean failed = false;
+        try (Connection conn = DriverManager.getConnection(url)) {
+            Object[][] scenarios = {
+                {"preparedStatements", (Scenario) Conformance::preparedStatements},
+                {"transactions", (Scenario) Conformance::transactions},
+                {"bulkLoad", (Scenario) Conformance::bulkLoad},
+                {"typeRoundTrip", (Scenario) Conformance::typeRoundTrip},
+            };
+            for (Object[] s : scenarios) {
+                try {
+                    ((Scenario) s[1]).run(conn);
+                    System.out.println("ok " + s[0]);
+                } catch (Exception | AssertionError e) {
+                    failed = true;
+                    System.out.println("FAIL " + s[0] + ": " + e);
+                }
+            }
+        }
+        System.exit(failed ? 1 : 0);
+    }
+}
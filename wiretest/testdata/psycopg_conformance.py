@@ -0,0 +1,141 @@
+"""Runs the conformance scenarios of wiretest with psycopg 3.
+
+Usage: python3 psycopg_conformance.py HOST PORT
+"""
+
+import datetime
+import decimal
+import sys
+import uuid
+
+import psycopg
+
+
+def recreate_table(conn, table, columns):
+    conn.execute(f"DROP TABLE IF EXISTS {table}")
+    conn.execute(f"CREATE TABLE {table} ({columns})")
+
+
+def count(conn, table):
+    return conn.execute(f"SELECT count(*) FROM {table}").fetchone()[0]
+
+
+def test_prepared_statements(conn):
+    recreate_table(conn, "wire_prepared", "id INTEGER PRIMARY KEY, name VARCHAR(64), score DOUBLE")
+    with conn.cursor() as cur:
+        for i in range(1, 51):
+            score = None if i % 10 == 0 else i / 2
+            # prepare=True uses a named prepared statement from the first execution.
+            cur.execute("INSERT INTO wire_prepared (id, name, score) VALUES (%s, %s, %s)",
+                        (i, "name-" + chr(ord("a") + i % 26), score), prepare=True)
+    assert count(conn, "wire_prepared") == 50
+    row = conn.execute("SELECT name, score FROM wire_prepared WHERE id = %s", (3,), prepare=True).fetchone()
+    assert row == ("name-d", 1.5), row
+    row = conn.execute("SELECT name, score FROM wire_prepared WHERE id = %s", (10,), prepare=True).fetchone()
+    assert row[1] is None, row
+
+    with conn.cursor() as cur:
+        cur.executemany("UPDATE wire_prepared SET score = %s WHERE id = %s", [(0.0, i) for i in range(1, 6)])
+    assert conn.execute("DELETE FROM wire_prepared WHERE score IS NULL").rowcount == 5
+    try:
+        conn.execute("INSERT INTO wire_prepared (id, name) VALUES (%s, %s)", (1, "duplicate"))
+        raise AssertionError("the duplicate key is inserted")
+    except psycopg.Error:
+        pass
+    assert count(conn, "wire_prepared") == 45
+
+
+def test_transactions(conn):
+    recreate_table(conn, "wire_txn", "id INTEGER PRIMARY KEY, v VARCHAR(16)")
+
+    class Rollback(Exception):
+        pass
+
+    try:
+        with conn.transaction():
+            conn.execute("INSERT INTO wire_txn VALUES (%s, %s)", (1, "rolled back"))
+            assert count(conn, "wire_txn") == 1
+            raise Rollback()
+    except Rollback:
+        pass
+    assert count(conn, "wire_txn") == 0
+
+    with conn.transaction():
+        conn.execute("INSERT INTO wire_txn VALUES (%s, %s)", (1, "committed"))
+        with conn.cursor() as cur:
+            cur.executemany("INSERT INTO wire_txn VALUES (%s, %s)", [(2, "a"), (3, "b")])
+        conn.execute("UPDATE wire_txn SET v = %s WHERE id = %s", ("updated", 2))
+    assert count(conn, "wire_txn") == 3
+    assert conn.execute("SELECT v FROM wire_txn WHERE id = 2").fetchone()[0] == "updated"
+
+    try:
+        with conn.transaction():
+            conn.execute("INSERT INTO wire_txn VALUES (%s, %s)", (1, "duplicate"))
+        raise AssertionError("the duplicate key is inserted")
+    except psycopg.Error:
+        pass
+    assert count(conn, "wire_txn") == 3
+
+
+def test_bulk_load(conn):
+    recreate_table(conn, "wire_copy", "id INTEGER, name VARCHAR(64), amount DOUBLE")
+    with conn.cursor() as cur:
+        with cur.copy("COPY wire_copy (id, name, amount) FROM STDIN") as copy:
+            for i in range(1000):
+                copy.write_row((i, "row " + chr(ord("A") + i % 26), None if i % 100 == 0 else i * 1.25))
+    row = conn.execute("SELECT count(*), count(*) - count(amount), sum(amount) FROM wire_copy").fetchone()
+    assert row == (1000, 10, (499500 - 4500) * 1.25), row
+
+    # COPY TO STDOUT returns the rows in the text format.
+    with conn.cursor() as cur:
+        with cur.copy("COPY (SELECT id, name FROM wire_copy WHERE id < 3 ORDER BY id) TO STDOUT") as copy:
+            data = b"".join(bytes(chunk) for chunk in copy)
+    assert data == b"0\trow A\n1\trow B\n2\trow C\n", data
+
+
+TYPE_CASES = [
+    ("BOOLEAN", True),
+    ("SMALLINT", -32768),
+    ("INTEGER", 2147483647),
+    ("BIGINT", -9223372036854775808),
+    ("DOUBLE PRECISION", 3.141592653589793),
+    ("NUMERIC(10,2)", decimal.Decimal("12345678.90")),
+    ("TEXT", "héllo, 世界 'quoted'"),
+    ("BYTEA", b"\x00\x01\x02\x7f\x80\xff"),
+    ("DATE", datetime.date(2024, 2, 29)),
+    ("TIMESTAMP", datetime.datetime(2024, 12, 31, 23, 59, 58, 123456)),
+    ("TIMESTAMPTZ", datetime.datetime(2001, 9, 9, 1, 46, 40, tzinfo=datetime.timezone.utc)),
+    ("UUID", uuid.UUID("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11")),
+]
+
+
+def test_type_round_trip(conn):
+    for binary in (False, True):
+        for typ, value in TYPE_CASES:
+            recreate_table(conn, "wire_types", f"id INTEGER, v {typ}")
+            conn.execute("INSERT INTO wire_types VALUES (%s, %s), (%s, NULL)", (1, value, 2))
+            with conn.cursor(binary=binary) as cur:
+                got = cur.execute("SELECT v FROM wire_types WHERE id = %s", (1,)).fetchone()[0]
+                if isinstance(got, memoryview):
+                    got = bytes(got)
+                assert got == value, (typ, binary, value, got)
+                assert cur.execute("SELECT id FROM wire_types WHERE v = %s", (value,)).fetchone()[0] == 1, typ
+                assert cur.execute("SELECT v FROM wire_types WHERE id = %s", (2,)).fetchone()[0] is None, typ
+
+
+def main():
+    host, port = sys.argv[1], int(sys.argv[2])
+    failed = False
+    with psycopg.connect(host=host, port=port, dbname="memory", user="postgres", autocommit=True) as conn:
+        for test in (test_prepared_statements, test_transactions, test_bulk_load, test_type_round_trip):
+            try:
+                test(conn)
+                print(f"ok {test.__name__}")
+            except Exception as e:
+                failed = True
+                print(f"FAIL {test.__name__}: {e!r}")
+    sys.exit(1 if failed else 0)
+
+
+if __name__ == "__main__":
+    main()